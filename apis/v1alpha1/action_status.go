@@ -28,6 +28,8 @@ const (
 	Finished
 	//Unknown status
 	Unknown
+	//Retrying status
+	Retrying
 )
 
 var statuses []string = []string{
@@ -35,10 +37,11 @@ var statuses []string = []string{
 	"Starting",
 	"Finished",
 	"Unknown",
+	"Retrying",
 }
 
 func (a ActionStatus) String() string {
-	if a < Failed || a > Unknown {
+	if a < Failed || a > Retrying {
 		return "Unknown"
 	}
 	return statuses[a]
@@ -36,10 +36,56 @@ const (
 	GenerateCertAction ActionType = "GenerateCert"
 	//RequestCertAction string
 	ResizePVCAction ActionType = "ResizePVC"
+	//ResizeResourcesAction string
+	ResizeResourcesAction ActionType = "ResizeResources"
+	//ScheduledScalingAction string
+	ScheduledScalingAction ActionType = "ScheduledScaling"
+	//ScheduledRestartAction string
+	ScheduledRestartAction ActionType = "ScheduledRestart"
+	//SelfHealingAction string
+	SelfHealingAction ActionType = "SelfHealing"
+	//NodeHealthAction string
+	NodeHealthAction ActionType = "NodeHealth"
+	//StoragePressureAction string
+	StoragePressureAction ActionType = "StoragePressure"
+	//CloneAction string
+	CloneAction ActionType = "Clone"
+	//DatabaseRegionsAction string
+	DatabaseRegionsAction ActionType = "DatabaseRegions"
+	//SQLReadinessAction string
+	SQLReadinessAction ActionType = "SQLReadiness"
 	//UpgradeAction string
 	UpgradeAction ActionType = "Upgrade"
 	//PartitionedUpdateAction string
 	PartitionedUpdateAction ActionType = "PartitionedUpdate"
+	//DemoWorkloadAction string
+	DemoWorkloadAction ActionType = "DemoWorkload"
+	//EvictionAction string
+	EvictionAction ActionType = "Eviction"
+	//HealthMetricsAction string
+	HealthMetricsAction ActionType = "HealthMetrics"
+	//RequestedOperationAction string
+	RequestedOperationAction ActionType = "RequestedOperation"
+	//ScheduledExportAction string
+	ScheduledExportAction ActionType = "ScheduledExport"
+	//ReplicationAction string
+	ReplicationAction ActionType = "Replication"
+	//BackupHealthAction string
+	BackupHealthAction ActionType = "BackupHealth"
+	//AutoscalingAction string
+	AutoscalingAction ActionType = "Autoscaling"
+	//ResourceAutoscalingAction string
+	ResourceAutoscalingAction ActionType = "ResourceAutoscaling"
+	//DeadNodeReplacementAction string
+	DeadNodeReplacementAction ActionType = "DeadNodeReplacement"
+	//CertificateRenewalAction string
+	CertificateRenewalAction ActionType = "CertificateRenewal"
+	//CertificateExpiryAction string
+	CertificateExpiryAction ActionType = "CertificateExpiry"
+	//CertificateReloadAction string
+	CertificateReloadAction ActionType = "CertificateReload"
+	//TopologyLocalityAction string
+	TopologyLocalityAction ActionType = "TopologyLocality"
 	//UnknownAction string
 	UnknownAction ActionType = "Unknown"
 )
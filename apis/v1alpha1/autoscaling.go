@@ -0,0 +1,98 @@
+/*
+Copyright 2021 The Cockroach Authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    https://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package v1alpha1
+
+import (
+	"math"
+	"time"
+
+	"github.com/cockroachdb/errors"
+)
+
+const (
+	defaultTargetCPUUtilization = 70
+	defaultScaleDownDelay       = 10 * time.Minute
+	// autoscalingTolerance is how far the load can be from a target, as a
+	// fraction of the target, before it calls for another number of nodes
+	autoscalingTolerance = 0.1
+)
+
+// Validate checks that the bounds of the number of nodes are consistent.
+func (a *Autoscaling) Validate() error {
+	if a.MinNodes > a.MaxNodes {
+		return errors.New("minNodes must not be greater than maxNodes")
+	}
+	return nil
+}
+
+// TargetCPUUtilizationOrDefault returns the average percentage of the CPU of
+// the nodes the cluster is scaled to.
+func (a *Autoscaling) TargetCPUUtilizationOrDefault() int32 {
+	if a.TargetCPUUtilization == nil {
+		return defaultTargetCPUUtilization
+	}
+	return *a.TargetCPUUtilization
+}
+
+// ScaleDownDelayOrDefault returns how long the cluster keeps its nodes after
+// it was last scaled.
+func (a *Autoscaling) ScaleDownDelayOrDefault() time.Duration {
+	if a.ScaleDownDelay == nil {
+		return defaultScaleDownDelay
+	}
+	return a.ScaleDownDelay.Duration
+}
+
+// DesiredNodes returns the number of nodes the load measured on the given
+// number of nodes calls for, within the bounds. Each target calls for the
+// number of nodes that brings the average load to it, and the largest wins, so
+// that the cluster only shrinks when every target allows it.
+func (a *Autoscaling) DesiredNodes(nodes int32, load AutoscalingStatus) int32 {
+	desired := nodesForTarget(nodes, load.CPUUtilization, a.TargetCPUUtilizationOrDefault())
+	if a.TargetSQLConnections > 0 {
+		desired = max32(desired, nodesForTarget(nodes, load.SQLConnections, a.TargetSQLConnections))
+	}
+	if a.TargetQueriesPerSecond > 0 {
+		desired = max32(desired, nodesForTarget(nodes, load.QueriesPerSecond, a.TargetQueriesPerSecond))
+	}
+
+	if desired < a.MinNodes {
+		return a.MinNodes
+	}
+	if desired > a.MaxNodes {
+		return a.MaxNodes
+	}
+	return desired
+}
+
+// nodesForTarget returns the number of nodes that brings the average load of
+// the nodes to the target. The number of nodes is kept while the load is
+// within the tolerance of the target.
+func nodesForTarget(nodes, load, target int32) int32 {
+	ratio := float64(load) / float64(target)
+	if math.Abs(ratio-1) <= autoscalingTolerance {
+		return nodes
+	}
+	return int32(math.Ceil(float64(nodes) * ratio))
+}
+
+func max32(a, b int32) int32 {
+	if a > b {
+		return a
+	}
+	return b
+}
@@ -0,0 +1,85 @@
+/*
+Copyright 2021 The Cockroach Authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    https://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package v1alpha1_test
+
+import (
+	"testing"
+	"time"
+
+	. "github.com/cockroachdb/cockroach-operator/apis/v1alpha1"
+	"github.com/stretchr/testify/require"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+func TestAutoscalingDefaults(t *testing.T) {
+	unset := &Autoscaling{MinNodes: 3, MaxNodes: 9}
+	require.NoError(t, unset.Validate())
+	require.Equal(t, int32(70), unset.TargetCPUUtilizationOrDefault())
+	require.Equal(t, 10*time.Minute, unset.ScaleDownDelayOrDefault())
+
+	cpu := int32(50)
+	set := &Autoscaling{MinNodes: 5, MaxNodes: 3, TargetCPUUtilization: &cpu, ScaleDownDelay: &metav1.Duration{Duration: time.Hour}}
+	require.EqualError(t, set.Validate(), "minNodes must not be greater than maxNodes")
+	require.Equal(t, int32(50), set.TargetCPUUtilizationOrDefault())
+	require.Equal(t, time.Hour, set.ScaleDownDelayOrDefault())
+}
+
+func TestAutoscalingDesiredNodes(t *testing.T) {
+	autoscaling := &Autoscaling{MinNodes: 3, MaxNodes: 12, TargetSQLConnections: 100, TargetQueriesPerSecond: 500}
+
+	tests := []struct {
+		name     string
+		load     AutoscalingStatus
+		expected int32
+	}{
+		{
+			name:     "load within the tolerance of the targets",
+			load:     AutoscalingStatus{CPUUtilization: 75, SQLConnections: 90, QueriesPerSecond: 400},
+			expected: 4,
+		},
+		{
+			name:     "CPU above its target",
+			load:     AutoscalingStatus{CPUUtilization: 90, SQLConnections: 50, QueriesPerSecond: 100},
+			expected: 6,
+		},
+		{
+			name:     "the busiest target wins",
+			load:     AutoscalingStatus{CPUUtilization: 90, SQLConnections: 200, QueriesPerSecond: 100},
+			expected: 8,
+		},
+		{
+			name:     "every target below",
+			load:     AutoscalingStatus{CPUUtilization: 35, SQLConnections: 40, QueriesPerSecond: 100},
+			expected: 3,
+		},
+		{
+			name:     "capped at the maximum",
+			load:     AutoscalingStatus{CPUUtilization: 100, QueriesPerSecond: 2000},
+			expected: 12,
+		},
+		{
+			name:     "no load",
+			expected: 3,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			require.Equal(t, tt.expected, autoscaling.DesiredNodes(4, tt.load))
+		})
+	}
+}
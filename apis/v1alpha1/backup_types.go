@@ -0,0 +1,155 @@
+/*
+Copyright 2021 The Cockroach Authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    https://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package v1alpha1
+
+import (
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+//BackupPhase is the phase of the backup schedules of a CrdbBackup
+type BackupPhase string
+
+const (
+	//BackupPending the schedules wait for the cluster or the URI of the collection
+	BackupPending BackupPhase = "Pending"
+	//BackupScheduled the schedules are created and take the backups
+	BackupScheduled BackupPhase = "Scheduled"
+	//BackupFailed the schedules could not be created
+	BackupFailed BackupPhase = "Failed"
+)
+
+// +k8s:openapi-gen=true
+// +k8s:deepcopy-gen=true
+
+// BackupRetention selects the full backups of the collection to keep, with
+// their incremental backups. A backup kept by any of the rules is kept, and
+// the latest backup is always kept
+type BackupRetention struct {
+	// (Optional) KeepLast is the number of the most recent full backups to keep
+	// +kubebuilder:validation:Minimum=1
+	// +optional
+	KeepLast int32 `json:"keepLast,omitempty"`
+	// (Optional) KeepDaily is the number of the most recent days whose last
+	// full backup is kept
+	// +kubebuilder:validation:Minimum=1
+	// +optional
+	KeepDaily int32 `json:"keepDaily,omitempty"`
+	// (Optional) MaxAge is how long the full backups are kept, for instance 720h
+	// +optional
+	MaxAge *metav1.Duration `json:"maxAge,omitempty"`
+	// (Optional) Image is the rclone image of the Jobs deleting the expired
+	// backups from the collection
+	// Default: rclone/rclone:1.57.0
+	// +optional
+	Image string `json:"image,omitempty"`
+}
+
+// +k8s:openapi-gen=true
+// +k8s:deepcopy-gen=true
+
+// CrdbBackupSpec defines the backup schedules of a cluster
+type CrdbBackupSpec struct {
+	// ClusterName is the name of the CrdbCluster, in the namespace of the
+	// backup, to back up
+	// +required
+	ClusterName string `json:"clusterName"`
+	// (Optional) URI is the URI of the backup collection, in the format of the
+	// CockroachDB BACKUP statement. For instance: s3://bucket/path?AUTH=implicit
+	// +optional
+	URI string `json:"uri,omitempty"`
+	// (Optional) URISecretRef selects the key of a secret holding the URI of the
+	// backup collection, for URIs with credentials. It takes precedence over URI
+	// +optional
+	URISecretRef *corev1.SecretKeySelector `json:"uriSecretRef,omitempty"`
+	// FullBackupSchedule is the crontab of the full backups, for instance @daily
+	// +kubebuilder:validation:MinLength=1
+	// +required
+	FullBackupSchedule string `json:"fullBackupSchedule"`
+	// (Optional) IncrementalBackupSchedule is the crontab of the incremental
+	// backups taken between the full backups, for instance @hourly
+	// Default: every backup is a full backup
+	// +optional
+	IncrementalBackupSchedule string `json:"incrementalBackupSchedule,omitempty"`
+	// (Optional) Retention prunes the expired backups of the collection
+	// periodically, which works with s3, gs, azure and nodelocal URIs
+	// Default: the backups are kept
+	// +optional
+	Retention *BackupRetention `json:"retention,omitempty"`
+}
+
+// +k8s:openapi-gen=true
+// +k8s:deepcopy-gen=true
+
+// CrdbBackupStatus is the observed state of the backup schedules
+type CrdbBackupStatus struct {
+	// Phase of the backup schedules
+	Phase BackupPhase `json:"phase,omitempty"`
+	// ScheduleIDs are the IDs of the schedules in the cluster
+	ScheduleIDs []int64 `json:"scheduleIDs,omitempty"`
+	// ObservedGeneration is the generation of the spec the schedules were
+	// created for
+	ObservedGeneration int64 `json:"observedGeneration,omitempty"`
+	// LastSuccessfulBackupTime is when the last successful backup finished
+	LastSuccessfulBackupTime *metav1.Time `json:"lastSuccessfulBackupTime,omitempty"`
+	// LastFailedBackupTime is when the last failed backup finished
+	LastFailedBackupTime *metav1.Time `json:"lastFailedBackupTime,omitempty"`
+	// Message explains why the schedules are pending or failed, or why the
+	// last backup failed when it is more recent than the last successful one
+	Message string `json:"message,omitempty"`
+	// LastPruneTime is when the expired backups were last looked for
+	LastPruneTime *metav1.Time `json:"lastPruneTime,omitempty"`
+	// PrunedBackups are the paths of the backups the last prune deleted
+	PrunedBackups []string `json:"prunedBackups,omitempty"`
+}
+
+// +genclient
+// +k8s:deepcopy-gen:interfaces=k8s.io/apimachinery/pkg/runtime.Object
+// +k8s:deepcopy-gen=true
+// +kubebuilder:object:root=true
+// +kubebuilder:resource:categories=all;cockroachdb
+// +kubebuilder:subresource:status
+// +kubebuilder:printcolumn:name="Cluster",type=string,JSONPath=`.spec.clusterName`
+// +kubebuilder:printcolumn:name="Phase",type=string,JSONPath=`.status.phase`
+// +kubebuilder:printcolumn:name="Last Success",type=date,JSONPath=`.status.lastSuccessfulBackupTime`
+// +kubebuilder:printcolumn:name="Age",type=date,JSONPath=`.metadata.creationTimestamp`
+// +k8s:openapi-gen=true
+
+// CrdbBackup schedules the full and incremental backups of a cluster into a
+// backup collection, with the schedules of CockroachDB
+type CrdbBackup struct {
+	metav1.TypeMeta   `json:",inline"`
+	metav1.ObjectMeta `json:"metadata,omitempty"`
+
+	Spec   CrdbBackupSpec   `json:"spec,omitempty"`
+	Status CrdbBackupStatus `json:"status,omitempty"`
+}
+
+// +k8s:deepcopy-gen:interfaces=k8s.io/apimachinery/pkg/runtime.Object
+// +k8s:deepcopy-gen=true
+// +kubebuilder:object:root=true
+
+// CrdbBackupList contains a list of CrdbBackup
+type CrdbBackupList struct {
+	metav1.TypeMeta `json:",inline"`
+	metav1.ListMeta `json:"metadata,omitempty"`
+	Items           []CrdbBackup `json:"items"`
+}
+
+func init() {
+	SchemeBuilder.Register(&CrdbBackup{}, &CrdbBackupList{})
+}
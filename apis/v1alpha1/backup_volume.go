@@ -0,0 +1,36 @@
+/*
+Copyright 2021 The Cockroach Authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    https://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package v1alpha1
+
+import (
+	apiresource "k8s.io/apimachinery/pkg/api/resource"
+)
+
+var defaultBackupVolumeSize = apiresource.MustParse("100Gi")
+
+// Provisioned returns whether the operator provisions the claim of the volume.
+func (v *BackupVolume) Provisioned() bool {
+	return v != nil && v.ClaimName == ""
+}
+
+// SizeOrDefault returns the storage request of the provisioned claim.
+func (v *BackupVolume) SizeOrDefault() apiresource.Quantity {
+	if v == nil || v.Size == nil {
+		return defaultBackupVolumeSize.DeepCopy()
+	}
+	return v.Size.DeepCopy()
+}
@@ -0,0 +1,39 @@
+/*
+Copyright 2021 The Cockroach Authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    https://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package v1alpha1_test
+
+import (
+	"testing"
+
+	. "github.com/cockroachdb/cockroach-operator/apis/v1alpha1"
+	"github.com/stretchr/testify/require"
+	apiresource "k8s.io/apimachinery/pkg/api/resource"
+)
+
+func TestBackupVolumeDefaults(t *testing.T) {
+	var unset *BackupVolume
+	require.False(t, unset.Provisioned())
+	require.Equal(t, "100Gi", unset.SizeOrDefault().String())
+
+	size := apiresource.MustParse("1Ti")
+	provisioned := &BackupVolume{Size: &size}
+	require.True(t, provisioned.Provisioned())
+	require.Equal(t, "1Ti", provisioned.SizeOrDefault().String())
+
+	existing := &BackupVolume{ClaimName: "nfs-backups"}
+	require.False(t, existing.Provisioned())
+}
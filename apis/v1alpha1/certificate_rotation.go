@@ -0,0 +1,39 @@
+/*
+Copyright 2021 The Cockroach Authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    https://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package v1alpha1
+
+import "time"
+
+// ReloadOrDefault returns how the nodes load the renewed certificates.
+func (r *CertificateRotation) ReloadOrDefault() CertificateReload {
+	if r == nil || r.Reload == "" {
+		return CertificateReloadRolling
+	}
+	return r.Reload
+}
+
+// RenewalTime returns when a certificate valid from notBefore to notAfter is
+// renewed. Without a renewBefore, it is the one of the Vault PKI, if any.
+func (r *CertificateRotation) RenewalTime(notBefore, notAfter time.Time, vault *VaultPKI) time.Time {
+	if r != nil && r.RenewBefore != nil {
+		return notAfter.Add(-r.RenewBefore.Duration)
+	}
+	if vault != nil {
+		return vault.RenewalTime(notBefore, notAfter)
+	}
+	return notAfter.Add(-notAfter.Sub(notBefore) / 3)
+}
@@ -0,0 +1,45 @@
+/*
+Copyright 2021 The Cockroach Authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    https://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package v1alpha1_test
+
+import (
+	"testing"
+	"time"
+
+	. "github.com/cockroachdb/cockroach-operator/apis/v1alpha1"
+	"github.com/stretchr/testify/require"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+func TestCertificateRotationReload(t *testing.T) {
+	var unset *CertificateRotation
+	require.Equal(t, CertificateReloadRolling, unset.ReloadOrDefault())
+	require.Equal(t, CertificateReloadRolling, (&CertificateRotation{}).ReloadOrDefault())
+	require.Equal(t, CertificateReloadSIGHUP, (&CertificateRotation{Reload: CertificateReloadSIGHUP}).ReloadOrDefault())
+}
+
+func TestCertificateRotationRenewalTime(t *testing.T) {
+	notBefore := time.Date(2021, 6, 1, 0, 0, 0, 0, time.UTC)
+	notAfter := notBefore.Add(30 * 24 * time.Hour)
+	vault := &VaultPKI{RenewBefore: &metav1.Duration{Duration: 72 * time.Hour}}
+	set := &CertificateRotation{RenewBefore: &metav1.Duration{Duration: 48 * time.Hour}}
+
+	var unset *CertificateRotation
+	require.Equal(t, notBefore.Add(20*24*time.Hour), unset.RenewalTime(notBefore, notAfter, nil))
+	require.Equal(t, notBefore.Add(27*24*time.Hour), unset.RenewalTime(notBefore, notAfter, vault))
+	require.Equal(t, notBefore.Add(28*24*time.Hour), set.RenewalTime(notBefore, notAfter, vault))
+}
@@ -0,0 +1,145 @@
+/*
+Copyright 2021 The Cockroach Authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    https://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package v1alpha1
+
+import (
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+//ChangefeedPhase is the phase of the changefeed job of a CrdbChangefeed
+type ChangefeedPhase string
+
+const (
+	//ChangefeedPending the changefeed waits for the cluster to be ready or for the URI of the sink
+	ChangefeedPending ChangefeedPhase = "Pending"
+	//ChangefeedRunning the changefeed job emits the changes to the sink
+	ChangefeedRunning ChangefeedPhase = "Running"
+	//ChangefeedPaused the changefeed job is paused
+	ChangefeedPaused ChangefeedPhase = "Paused"
+	//ChangefeedFailed the changefeed job could not start, failed or was canceled
+	ChangefeedFailed ChangefeedPhase = "Failed"
+)
+
+//ChangefeedFormat is the format of the messages a changefeed emits
+type ChangefeedFormat string
+
+const (
+	//ChangefeedJSON emits JSON messages
+	ChangefeedJSON ChangefeedFormat = "json"
+	//ChangefeedAvro emits Avro messages, which need a schema registry
+	ChangefeedAvro ChangefeedFormat = "avro"
+)
+
+// +k8s:openapi-gen=true
+// +k8s:deepcopy-gen=true
+
+// CrdbChangefeedSpec defines a changefeed of tables of a cluster
+type CrdbChangefeedSpec struct {
+	// ClusterName is the name of the CrdbCluster, in the namespace of the
+	// changefeed, to watch the tables of. The changefeed waits until the cluster
+	// is ready, so the cluster can be created along with the changefeed
+	// +required
+	ClusterName string `json:"clusterName"`
+	// Tables are the qualified names of the tables to watch, such as
+	// movr.public.rides
+	// +kubebuilder:validation:MinItems=1
+	// +required
+	Tables []string `json:"tables"`
+	// (Optional) SinkURI is the URI of the sink the changes are emitted to, in
+	// the format of the CockroachDB CREATE CHANGEFEED statement. For instance:
+	// kafka://kafka.default:9092
+	// +optional
+	SinkURI string `json:"sinkURI,omitempty"`
+	// (Optional) SinkURISecretRef selects the key of a secret holding the URI of
+	// the sink, for URIs with credentials. It takes precedence over SinkURI
+	// +optional
+	SinkURISecretRef *corev1.SecretKeySelector `json:"sinkURISecretRef,omitempty"`
+	// (Optional) Format of the messages emitted to the sink
+	// Default: json
+	// +kubebuilder:validation:Enum=json;avro
+	// +optional
+	Format ChangefeedFormat `json:"format,omitempty"`
+	// (Optional) Resolved is how often resolved timestamps are emitted to the
+	// sink. For instance: 10s
+	// Default: no resolved timestamps are emitted
+	// +optional
+	Resolved *metav1.Duration `json:"resolved,omitempty"`
+	// (Optional) Paused pauses the changefeed job, which resumes from where it
+	// stopped once unset
+	// Default: false
+	// +optional
+	Paused bool `json:"paused,omitempty"`
+}
+
+// +k8s:openapi-gen=true
+// +k8s:deepcopy-gen=true
+
+// CrdbChangefeedStatus is the observed state of the changefeed
+type CrdbChangefeedStatus struct {
+	// Phase of the changefeed
+	Phase ChangefeedPhase `json:"phase,omitempty"`
+	// JobID is the ID of the changefeed job
+	JobID int64 `json:"jobID,omitempty"`
+	// SpecHash identifies the spec the changefeed job was created for. The job
+	// is created again when the tables, the sink, the format or the resolved
+	// timestamps change
+	SpecHash string `json:"specHash,omitempty"`
+	// HighWater is the time up to which all the changes were emitted
+	HighWater *metav1.Time `json:"highWater,omitempty"`
+	// RunningStatus is the status the running changefeed job reports
+	RunningStatus string `json:"runningStatus,omitempty"`
+	// Message explains why the changefeed is pending or failed
+	Message string `json:"message,omitempty"`
+}
+
+// +genclient
+// +k8s:deepcopy-gen:interfaces=k8s.io/apimachinery/pkg/runtime.Object
+// +k8s:deepcopy-gen=true
+// +kubebuilder:object:root=true
+// +kubebuilder:resource:categories=all;cockroachdb
+// +kubebuilder:subresource:status
+// +kubebuilder:printcolumn:name="Cluster",type=string,JSONPath=`.spec.clusterName`
+// +kubebuilder:printcolumn:name="Phase",type=string,JSONPath=`.status.phase`
+// +kubebuilder:printcolumn:name="High Water",type=date,JSONPath=`.status.highWater`
+// +kubebuilder:printcolumn:name="Age",type=date,JSONPath=`.metadata.creationTimestamp`
+// +k8s:openapi-gen=true
+
+// CrdbChangefeed runs a changefeed job emitting the changes of tables of a
+// cluster to a sink
+type CrdbChangefeed struct {
+	metav1.TypeMeta   `json:",inline"`
+	metav1.ObjectMeta `json:"metadata,omitempty"`
+
+	Spec   CrdbChangefeedSpec   `json:"spec,omitempty"`
+	Status CrdbChangefeedStatus `json:"status,omitempty"`
+}
+
+// +k8s:deepcopy-gen:interfaces=k8s.io/apimachinery/pkg/runtime.Object
+// +k8s:deepcopy-gen=true
+// +kubebuilder:object:root=true
+
+// CrdbChangefeedList contains a list of CrdbChangefeed
+type CrdbChangefeedList struct {
+	metav1.TypeMeta `json:",inline"`
+	metav1.ListMeta `json:"metadata,omitempty"`
+	Items           []CrdbChangefeed `json:"items"`
+}
+
+func init() {
+	SchemeBuilder.Register(&CrdbChangefeed{}, &CrdbChangefeedList{})
+}
@@ -0,0 +1,136 @@
+/*
+Copyright 2021 The Cockroach Authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    https://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package v1alpha1
+
+import (
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// ClientCertPhase is the phase of the certificate of a CrdbClientCert
+type ClientCertPhase string
+
+const (
+	//ClientCertPending the cluster or its certificates do not exist yet
+	ClientCertPending ClientCertPhase = "Pending"
+	//ClientCertIssued the certificate is in the secret
+	ClientCertIssued ClientCertPhase = "Issued"
+	//ClientCertFailed the certificate cannot be issued, see the message
+	ClientCertFailed ClientCertPhase = "Failed"
+)
+
+// +k8s:openapi-gen=true
+// +k8s:deepcopy-gen=true
+
+// CrdbClientCertSpec defines the client certificate of a SQL user of a cluster
+type CrdbClientCertSpec struct {
+	// ClusterName is the name of the CrdbCluster whose CA signs the certificate
+	// +required
+	ClusterName string `json:"clusterName"`
+	// (Optional) ClusterNamespace is the namespace of the cluster. The namespace
+	// of the CrdbClientCert must be in the clientCertNamespaces of the cluster
+	// when it is another one
+	// Default: the namespace of the CrdbClientCert
+	// +optional
+	ClusterNamespace string `json:"clusterNamespace,omitempty"`
+	// User is the SQL user of the certificate
+	// +kubebuilder:validation:Pattern=`^[a-z0-9_][a-z0-9_.-]*$`
+	// +kubebuilder:validation:MaxLength=63
+	// +required
+	User string `json:"user"`
+	// (Optional) SecretName is the name of the secret the certificate is saved
+	// into, in the namespace of the CrdbClientCert
+	// Default: the name of the CrdbClientCert
+	// +optional
+	SecretName string `json:"secretName,omitempty"`
+	// (Optional) RenewBefore is how long before it expires the certificate is
+	// renewed
+	// Default: a third of the lifetime of the certificate
+	// +optional
+	RenewBefore *metav1.Duration `json:"renewBefore,omitempty"`
+}
+
+// +k8s:openapi-gen=true
+// +k8s:deepcopy-gen=true
+
+// CrdbClientCertStatus is the observed state of the client certificate
+type CrdbClientCertStatus struct {
+	// Phase of the certificate
+	Phase ClientCertPhase `json:"phase,omitempty"`
+	// NotBefore is when the certificate in the secret became valid
+	NotBefore *metav1.Time `json:"notBefore,omitempty"`
+	// NotAfter is when the certificate in the secret expires
+	NotAfter *metav1.Time `json:"notAfter,omitempty"`
+	// RenewalTime is when the certificate will be renewed
+	RenewalTime *metav1.Time `json:"renewalTime,omitempty"`
+	// Message explains why the certificate is pending or cannot be issued
+	Message string `json:"message,omitempty"`
+}
+
+// +genclient
+// +k8s:deepcopy-gen:interfaces=k8s.io/apimachinery/pkg/runtime.Object
+// +k8s:deepcopy-gen=true
+// +kubebuilder:object:root=true
+// +kubebuilder:resource:categories=all;cockroachdb
+// +kubebuilder:subresource:status
+// +kubebuilder:printcolumn:name="Cluster",type=string,JSONPath=`.spec.clusterName`
+// +kubebuilder:printcolumn:name="User",type=string,JSONPath=`.spec.user`
+// +kubebuilder:printcolumn:name="Phase",type=string,JSONPath=`.status.phase`
+// +kubebuilder:printcolumn:name="Expires",type=date,JSONPath=`.status.notAfter`
+// +kubebuilder:printcolumn:name="Age",type=date,JSONPath=`.metadata.creationTimestamp`
+// +k8s:openapi-gen=true
+
+// CrdbClientCert issues a client certificate of a SQL user signed by the CA of
+// a cluster into a secret, and renews it before it expires
+type CrdbClientCert struct {
+	metav1.TypeMeta   `json:",inline"`
+	metav1.ObjectMeta `json:"metadata,omitempty"`
+
+	Spec   CrdbClientCertSpec   `json:"spec,omitempty"`
+	Status CrdbClientCertStatus `json:"status,omitempty"`
+}
+
+// +k8s:deepcopy-gen:interfaces=k8s.io/apimachinery/pkg/runtime.Object
+// +k8s:deepcopy-gen=true
+// +kubebuilder:object:root=true
+
+// CrdbClientCertList contains a list of CrdbClientCert
+type CrdbClientCertList struct {
+	metav1.TypeMeta `json:",inline"`
+	metav1.ListMeta `json:"metadata,omitempty"`
+	Items           []CrdbClientCert `json:"items"`
+}
+
+func init() {
+	SchemeBuilder.Register(&CrdbClientCert{}, &CrdbClientCertList{})
+}
+
+// ClusterNamespaceOrDefault returns the namespace of the cluster of the
+// certificate
+func (c *CrdbClientCert) ClusterNamespaceOrDefault() string {
+	if c.Spec.ClusterNamespace != "" {
+		return c.Spec.ClusterNamespace
+	}
+	return c.Namespace
+}
+
+// SecretNameOrDefault returns the name of the secret of the certificate
+func (c *CrdbClientCert) SecretNameOrDefault() string {
+	if c.Spec.SecretName != "" {
+		return c.Spec.SecretName
+	}
+	return c.Name
+}
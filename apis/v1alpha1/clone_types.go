@@ -0,0 +1,42 @@
+/*
+Copyright 2021 The Cockroach Authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    https://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package v1alpha1
+
+//CloneState is the state of the clone of another cluster
+type CloneState string
+
+const (
+	//CloneBackingUp the source cluster is being backed up
+	CloneBackingUp CloneState = "BackingUp"
+	//CloneRestoring the backup is being restored into the cluster
+	CloneRestoring CloneState = "Restoring"
+	//CloneSucceeded the backup was restored and the connection secret published
+	CloneSucceeded CloneState = "Succeeded"
+	//CloneFailed the backup or the restore failed
+	CloneFailed CloneState = "Failed"
+)
+
+//Done returns whether the clone is over, successfully or not
+func (s *CloneStatus) Done() bool {
+	return s != nil && (s.State == CloneSucceeded || s.State == CloneFailed)
+}
+
+//HasBackupURI returns whether the backup collection is given by a URI rather
+//than defaulting to the backup volume
+func (s *CloneSource) HasBackupURI() bool {
+	return s.BackupURI != "" || s.BackupURISecretRef != nil
+}
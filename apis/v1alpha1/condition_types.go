@@ -30,4 +30,36 @@ const (
 	InitializedCondition ClusterConditionType = "Initialized"
 	//ClusterRestartCondition string
 	ClusterRestartCondition ClusterConditionType = "RestartedCluster"
+	//DegradedCondition is true when some nodes of the cluster are dead or suspect
+	DegradedCondition ClusterConditionType = "Degraded"
+	//StoragePressureCondition is true when some stores of the cluster are nearly full
+	StoragePressureCondition ClusterConditionType = "StoragePressure"
+	//ReadyCondition is true when the cluster answers SQL queries through its public service
+	ReadyCondition ClusterConditionType = "Ready"
+	//SecretsAvailableCondition is false while secrets referenced by the spec do not exist
+	SecretsAvailableCondition ClusterConditionType = "SecretsAvailable"
+	//DatabaseRegionsCondition is true once the databases have the regions of the spec
+	DatabaseRegionsCondition ClusterConditionType = "DatabaseRegionsConfigured"
+	//AntiAffinityRelaxedCondition is true while the required pod anti-affinity is relaxed for lack of schedulable nodes
+	AntiAffinityRelaxedCondition ClusterConditionType = "AntiAffinityRelaxed"
+	//ProgressingCondition is true while the spec is being rolled out to the pods, false once it is or while the cluster is paused
+	ProgressingCondition ClusterConditionType = "Progressing"
+	//DemoWorkloadLoadedCondition is true once the sample data of the demo workload is loaded
+	DemoWorkloadLoadedCondition ClusterConditionType = "DemoWorkloadLoaded"
+	//EvictionSafeCondition is true while every pod is ready and every range is fully replicated
+	EvictionSafeCondition ClusterConditionType = "EvictionSafe"
+	//ReplicatingCondition is true while a standby cluster replicates the virtual cluster of its primary cluster
+	ReplicatingCondition ClusterConditionType = "Replicating"
+	//PromotedCondition is true once a standby cluster was promoted to primary, false while its promotion waits or runs
+	PromotedCondition ClusterConditionType = "Promoted"
+	//LastBackupCompletedCondition is true once a backup of the CrdbBackups of the cluster completed
+	LastBackupCompletedCondition ClusterConditionType = "LastBackupCompleted"
+	//BackupFailingCondition is true while the schedules or the last backup of some CrdbBackups of the cluster failed
+	BackupFailingCondition ClusterConditionType = "BackupFailing"
+	//ScaleDownSafeCondition is false while a scale down is blocked because the replicas of the ranges would not fit on the remaining nodes
+	ScaleDownSafeCondition ClusterConditionType = "ScaleDownSafe"
+	//UpgradeSafeCondition is false while an upgrade is held because some nodes are unavailable, some ranges miss replicas or schema changes run
+	UpgradeSafeCondition ClusterConditionType = "UpgradeSafe"
+	//CertificateExpiringSoonCondition is true while a certificate of the cluster expires within 30 days, or has expired
+	CertificateExpiringSoonCondition ClusterConditionType = "CertificateExpiringSoon"
 )
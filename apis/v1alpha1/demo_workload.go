@@ -0,0 +1,60 @@
+/*
+Copyright 2021 The Cockroach Authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    https://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package v1alpha1
+
+import "fmt"
+
+// DemoWorkloadName is the name of a workload of `cockroach workload`
+type DemoWorkloadName string
+
+const (
+	// MovrWorkload is the ride sharing application of the CockroachDB tutorials
+	MovrWorkload DemoWorkloadName = "movr"
+	// BankWorkload is a table of accounts and their balances
+	BankWorkload DemoWorkloadName = "bank"
+	// TPCCWorkload is the schema and data of the TPC-C benchmark
+	TPCCWorkload DemoWorkloadName = "tpcc"
+)
+
+// ScaleFactorOrDefault returns the scale factor of the workload, 1 if unset.
+func (w *DemoWorkload) ScaleFactorOrDefault() int32 {
+	if w.ScaleFactor < 1 {
+		return 1
+	}
+	return w.ScaleFactor
+}
+
+// InitFlags returns the flags of `cockroach workload init` that load the data
+// of the workload at its scale factor.
+func (w *DemoWorkload) InitFlags() []string {
+	s := w.ScaleFactorOrDefault()
+
+	switch w.Name {
+	case MovrWorkload:
+		return []string{
+			fmt.Sprintf("--num-users=%d", 50*s),
+			fmt.Sprintf("--num-vehicles=%d", 15*s),
+			fmt.Sprintf("--num-rides=%d", 500*s),
+		}
+	case BankWorkload:
+		return []string{fmt.Sprintf("--rows=%d", 1000*s)}
+	case TPCCWorkload:
+		return []string{fmt.Sprintf("--warehouses=%d", s)}
+	}
+
+	return nil
+}
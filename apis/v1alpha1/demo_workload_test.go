@@ -0,0 +1,59 @@
+/*
+Copyright 2021 The Cockroach Authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    https://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package v1alpha1_test
+
+import (
+	"testing"
+
+	api "github.com/cockroachdb/cockroach-operator/apis/v1alpha1"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestDemoWorkloadInitFlags(t *testing.T) {
+	tests := []struct {
+		name     string
+		workload api.DemoWorkload
+		expected []string
+	}{
+		{
+			name:     "movr at the default scale factor",
+			workload: api.DemoWorkload{Name: api.MovrWorkload},
+			expected: []string{"--num-users=50", "--num-vehicles=15", "--num-rides=500"},
+		},
+		{
+			name:     "movr scaled",
+			workload: api.DemoWorkload{Name: api.MovrWorkload, ScaleFactor: 4},
+			expected: []string{"--num-users=200", "--num-vehicles=60", "--num-rides=2000"},
+		},
+		{
+			name:     "bank scaled",
+			workload: api.DemoWorkload{Name: api.BankWorkload, ScaleFactor: 3},
+			expected: []string{"--rows=3000"},
+		},
+		{
+			name:     "tpcc scaled",
+			workload: api.DemoWorkload{Name: api.TPCCWorkload, ScaleFactor: 2},
+			expected: []string{"--warehouses=2"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.expected, tt.workload.InitFlags())
+		})
+	}
+}
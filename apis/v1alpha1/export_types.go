@@ -0,0 +1,173 @@
+/*
+Copyright 2021 The Cockroach Authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    https://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package v1alpha1
+
+import (
+	"github.com/cockroachdb/errors"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+//ExportFormat is the format of the files an export writes
+type ExportFormat string
+
+const (
+	//ExportCSV writes CSV files
+	ExportCSV ExportFormat = "csv"
+	//ExportParquet writes Parquet files
+	ExportParquet ExportFormat = "parquet"
+)
+
+// +k8s:openapi-gen=true
+// +k8s:deepcopy-gen=true
+
+// CrdbExportSpec defines the exports of a table, or of the results of a query,
+// of a cluster on a schedule
+type CrdbExportSpec struct {
+	// ClusterName is the name of the CrdbCluster, in the namespace of the
+	// export, to export from
+	// +required
+	ClusterName string `json:"clusterName"`
+	// Schedule is the crontab of the exports, in UTC. For instance: "0 2 * * *"
+	// or @daily
+	// +required
+	Schedule string `json:"schedule"`
+	// (Optional) Table is the qualified name of the table to export, such as
+	// movr.public.rides. Either Table or Query must be set
+	// +optional
+	Table string `json:"table,omitempty"`
+	// (Optional) Query is the SELECT statement whose results are exported
+	// +optional
+	Query string `json:"query,omitempty"`
+	// (Optional) Format of the exported files
+	// Default: csv
+	// +kubebuilder:validation:Enum=csv;parquet
+	// +optional
+	Format ExportFormat `json:"format,omitempty"`
+	// (Optional) URI is the URI of the directory the exports are written to, in
+	// the format of the CockroachDB EXPORT statement. Each export writes its
+	// files in a subdirectory named after its scheduled time. For instance:
+	// s3://bucket/path?AUTH=implicit
+	// +optional
+	URI string `json:"uri,omitempty"`
+	// (Optional) URISecretRef selects the key of a secret holding the URI of the
+	// directory, for URIs with credentials. It takes precedence over URI
+	// +optional
+	URISecretRef *corev1.SecretKeySelector `json:"uriSecretRef,omitempty"`
+	// (Optional) Suspend stops the exports that are not running yet
+	// Default: false
+	// +optional
+	Suspend bool `json:"suspend,omitempty"`
+	// (Optional) SuccessfulJobsHistoryLimit is the number of the Jobs of
+	// successful exports that are kept
+	// Default: 3
+	// +kubebuilder:validation:Minimum=0
+	// +optional
+	SuccessfulJobsHistoryLimit *int32 `json:"successfulJobsHistoryLimit,omitempty"`
+	// (Optional) FailedJobsHistoryLimit is the number of the Jobs of failed
+	// exports that are kept
+	// Default: 1
+	// +kubebuilder:validation:Minimum=0
+	// +optional
+	FailedJobsHistoryLimit *int32 `json:"failedJobsHistoryLimit,omitempty"`
+}
+
+// +k8s:openapi-gen=true
+// +k8s:deepcopy-gen=true
+
+// CrdbExportStatus is the observed state of the exports
+type CrdbExportStatus struct {
+	// Active is the name of the Job of the running export
+	Active string `json:"active,omitempty"`
+	// LastScheduleTime is the scheduled time of the last export that started
+	LastScheduleTime *metav1.Time `json:"lastScheduleTime,omitempty"`
+	// LastSuccessfulTime is when the last successful export finished
+	LastSuccessfulTime *metav1.Time `json:"lastSuccessfulTime,omitempty"`
+	// LastFailedTime is when the last failed export finished
+	LastFailedTime *metav1.Time `json:"lastFailedTime,omitempty"`
+	// Message explains why the exports do not run, or why the last one failed
+	Message string `json:"message,omitempty"`
+}
+
+// Validate checks that the spec exports either a table or a query, which the
+// schema cannot express.
+func (s CrdbExportSpec) Validate() error {
+	if (s.Table == "") == (s.Query == "") {
+		return errors.New("either table or query must be set")
+	}
+	if s.URI == "" && s.URISecretRef == nil {
+		return errors.New("uri or uriSecretRef is required")
+	}
+	return nil
+}
+
+// SuccessfulJobsHistoryLimitOrDefault returns the number of the Jobs of
+// successful exports that are kept, 3 if unset.
+func (s CrdbExportSpec) SuccessfulJobsHistoryLimitOrDefault() int {
+	if s.SuccessfulJobsHistoryLimit == nil {
+		return 3
+	}
+	return int(*s.SuccessfulJobsHistoryLimit)
+}
+
+// FailedJobsHistoryLimitOrDefault returns the number of the Jobs of failed
+// exports that are kept, 1 if unset.
+func (s CrdbExportSpec) FailedJobsHistoryLimitOrDefault() int {
+	if s.FailedJobsHistoryLimit == nil {
+		return 1
+	}
+	return int(*s.FailedJobsHistoryLimit)
+}
+
+// +genclient
+// +k8s:deepcopy-gen:interfaces=k8s.io/apimachinery/pkg/runtime.Object
+// +k8s:deepcopy-gen=true
+// +kubebuilder:object:root=true
+// +kubebuilder:resource:categories=all;cockroachdb
+// +kubebuilder:subresource:status
+// +kubebuilder:printcolumn:name="Cluster",type=string,JSONPath=`.spec.clusterName`
+// +kubebuilder:printcolumn:name="Schedule",type=string,JSONPath=`.spec.schedule`
+// +kubebuilder:printcolumn:name="Suspend",type=boolean,JSONPath=`.spec.suspend`
+// +kubebuilder:printcolumn:name="Active",type=string,JSONPath=`.status.active`
+// +kubebuilder:printcolumn:name="Last Schedule",type=date,JSONPath=`.status.lastScheduleTime`
+// +kubebuilder:printcolumn:name="Age",type=date,JSONPath=`.metadata.creationTimestamp`
+// +k8s:openapi-gen=true
+
+// CrdbExport exports a table, or the results of a query, of a cluster to cloud
+// storage on a schedule, like a CronJob
+type CrdbExport struct {
+	metav1.TypeMeta   `json:",inline"`
+	metav1.ObjectMeta `json:"metadata,omitempty"`
+
+	Spec   CrdbExportSpec   `json:"spec,omitempty"`
+	Status CrdbExportStatus `json:"status,omitempty"`
+}
+
+// +k8s:deepcopy-gen:interfaces=k8s.io/apimachinery/pkg/runtime.Object
+// +k8s:deepcopy-gen=true
+// +kubebuilder:object:root=true
+
+// CrdbExportList contains a list of CrdbExport
+type CrdbExportList struct {
+	metav1.TypeMeta `json:",inline"`
+	metav1.ListMeta `json:"metadata,omitempty"`
+	Items           []CrdbExport `json:"items"`
+}
+
+func init() {
+	SchemeBuilder.Register(&CrdbExport{}, &CrdbExportList{})
+}
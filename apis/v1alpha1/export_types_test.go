@@ -0,0 +1,79 @@
+/*
+Copyright 2021 The Cockroach Authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    https://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package v1alpha1_test
+
+import (
+	"testing"
+
+	api "github.com/cockroachdb/cockroach-operator/apis/v1alpha1"
+	"github.com/cockroachdb/cockroach-operator/pkg/ptr"
+	"github.com/stretchr/testify/assert"
+	corev1 "k8s.io/api/core/v1"
+)
+
+func TestCrdbExportSpecValidate(t *testing.T) {
+	tests := []struct {
+		name     string
+		spec     api.CrdbExportSpec
+		expected string
+	}{
+		{
+			name: "a table",
+			spec: api.CrdbExportSpec{Table: "movr.public.rides", URI: "s3://bucket/exports"},
+		},
+		{
+			name: "a query with a URI in a secret",
+			spec: api.CrdbExportSpec{Query: "SELECT * FROM movr.rides", URISecretRef: &corev1.SecretKeySelector{Key: "uri"}},
+		},
+		{
+			name:     "neither a table nor a query",
+			spec:     api.CrdbExportSpec{URI: "s3://bucket/exports"},
+			expected: "either table or query must be set",
+		},
+		{
+			name:     "both a table and a query",
+			spec:     api.CrdbExportSpec{Table: "movr.rides", Query: "SELECT 1", URI: "s3://bucket/exports"},
+			expected: "either table or query must be set",
+		},
+		{
+			name:     "no URI",
+			spec:     api.CrdbExportSpec{Table: "movr.rides"},
+			expected: "uri or uriSecretRef is required",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := tt.spec.Validate()
+			if tt.expected == "" {
+				assert.NoError(t, err)
+				return
+			}
+			assert.EqualError(t, err, tt.expected)
+		})
+	}
+}
+
+func TestCrdbExportSpecHistoryLimits(t *testing.T) {
+	unset := api.CrdbExportSpec{}
+	assert.Equal(t, 3, unset.SuccessfulJobsHistoryLimitOrDefault())
+	assert.Equal(t, 1, unset.FailedJobsHistoryLimitOrDefault())
+
+	set := api.CrdbExportSpec{SuccessfulJobsHistoryLimit: ptr.Int32(0), FailedJobsHistoryLimit: ptr.Int32(5)}
+	assert.Equal(t, 0, set.SuccessfulJobsHistoryLimitOrDefault())
+	assert.Equal(t, 5, set.FailedJobsHistoryLimitOrDefault())
+}
@@ -0,0 +1,31 @@
+/*
+Copyright 2021 The Cockroach Authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    https://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package v1alpha1
+
+//FailureReason is the machine-readable cause of a failed action
+type FailureReason string
+
+const (
+	//ImagePullBackOffReason the database image cannot be pulled
+	ImagePullBackOffReason FailureReason = "ImagePullBackOff"
+	//InitTimeoutReason the database pods did not start in time to initialize the cluster
+	InitTimeoutReason FailureReason = "InitTimeout"
+	//DecommissionStalledReason no range moved off a decommissioning node in time
+	DecommissionStalledReason FailureReason = "DecommissionStalled"
+	//CertErrorReason the certificates of the cluster cannot be generated or stored
+	CertErrorReason FailureReason = "CertError"
+)
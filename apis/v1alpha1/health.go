@@ -0,0 +1,125 @@
+/*
+Copyright 2021 The Cockroach Authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    https://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package v1alpha1
+
+import (
+	"fmt"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+//HealthStatus is the health of a cluster as reported to GitOps tools such as
+//Argo CD and Flux
+type HealthStatus string
+
+const (
+	//HealthHealthy means the spec is rolled out and the cluster works
+	HealthHealthy HealthStatus = "Healthy"
+	//HealthProgressing means the spec is being rolled out
+	HealthProgressing HealthStatus = "Progressing"
+	//HealthDegraded means the cluster or the operator failed and needs attention
+	HealthDegraded HealthStatus = "Degraded"
+	//HealthSuspended means the reconciliation of the cluster is paused
+	HealthSuspended HealthStatus = "Suspended"
+)
+
+const (
+	//HealthPausedMessage is the message of a paused cluster
+	HealthPausedMessage = "Reconciliation is paused"
+	//HealthNotObservedMessage is the message of a cluster whose last spec is not
+	//observed by the operator yet
+	HealthNotObservedMessage = "Waiting for the operator to observe the spec"
+)
+
+// +k8s:deepcopy-gen=false
+// +kubebuilder:object:generate=false
+
+//HealthActionRule maps the status of an action of the operator to a health
+//status
+type HealthActionRule struct {
+	Status ActionStatus
+	Health HealthStatus
+}
+
+// +k8s:deepcopy-gen=false
+// +kubebuilder:object:generate=false
+
+//HealthRule maps a condition of the cluster with the given status to a health
+//status
+type HealthRule struct {
+	Condition ClusterConditionType
+	Status    metav1.ConditionStatus
+	Health    HealthStatus
+}
+
+//HealthActionRules are checked in order once the spec is observed. The first
+//action of the cluster with the status of a rule gives the health of the
+//cluster.
+var HealthActionRules = []HealthActionRule{
+	{Status: Failed, Health: HealthDegraded},
+	{Status: Retrying, Health: HealthProgressing},
+}
+
+//HealthRules are checked in order when no HealthActionRules matches. The first
+//matching condition gives the health of the cluster, which is healthy if none
+//matches. The Argo CD health check script in config/argocd is generated from
+//these rules.
+var HealthRules = []HealthRule{
+	{Condition: DegradedCondition, Status: metav1.ConditionTrue, Health: HealthDegraded},
+	{Condition: ProgressingCondition, Status: metav1.ConditionTrue, Health: HealthProgressing},
+	{Condition: InitializedCondition, Status: metav1.ConditionFalse, Health: HealthProgressing},
+	{Condition: SecretsAvailableCondition, Status: metav1.ConditionFalse, Health: HealthProgressing},
+	{Condition: ReadyCondition, Status: metav1.ConditionFalse, Health: HealthDegraded},
+}
+
+// Health returns the health of the cluster and a message explaining it, the
+// way the GitOps health checks read it from the custom resource:
+//   - a paused cluster is suspended
+//   - the cluster is progressing until the operator observed the last spec
+//   - otherwise the first matching HealthActionRules or HealthRules gives the
+//     health
+func (cr *CrdbCluster) Health() (HealthStatus, string) {
+	if cr.Spec.Paused {
+		return HealthSuspended, HealthPausedMessage
+	}
+
+	if cr.Status.ObservedGeneration < cr.Generation {
+		return HealthProgressing, HealthNotObservedMessage
+	}
+
+	for _, rule := range HealthActionRules {
+		for _, a := range cr.Status.OperatorActions {
+			if a.Status == rule.Status.String() {
+				return rule.Health, fmt.Sprintf("Action %s is %s: %s", a.Type, a.Status, a.Message)
+			}
+		}
+	}
+
+	for _, rule := range HealthRules {
+		for _, c := range cr.Status.Conditions {
+			if c.Type != rule.Condition || c.Status != rule.Status {
+				continue
+			}
+			if c.Message != "" {
+				return rule.Health, c.Message
+			}
+			return rule.Health, fmt.Sprintf("%s is %s", c.Type, c.Status)
+		}
+	}
+
+	return HealthHealthy, ""
+}
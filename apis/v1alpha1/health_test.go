@@ -0,0 +1,112 @@
+/*
+Copyright 2021 The Cockroach Authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    https://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package v1alpha1_test
+
+import (
+	"testing"
+
+	. "github.com/cockroachdb/cockroach-operator/apis/v1alpha1"
+	"github.com/stretchr/testify/require"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+func TestHealth(t *testing.T) {
+	condition := func(ctype ClusterConditionType, status metav1.ConditionStatus, message string) ClusterCondition {
+		return ClusterCondition{Type: ctype, Status: status, Message: message}
+	}
+
+	tests := []struct {
+		name    string
+		mutate  func(cr *CrdbCluster)
+		health  HealthStatus
+		message string
+	}{
+		{
+			name:   "healthy",
+			mutate: func(cr *CrdbCluster) {},
+			health: HealthHealthy,
+		},
+		{
+			name:    "paused",
+			mutate:  func(cr *CrdbCluster) { cr.Spec.Paused = true },
+			health:  HealthSuspended,
+			message: "Reconciliation is paused",
+		},
+		{
+			name:    "spec not observed",
+			mutate:  func(cr *CrdbCluster) { cr.Generation = 3 },
+			health:  HealthProgressing,
+			message: "Waiting for the operator to observe the spec",
+		},
+		{
+			name: "failed action",
+			mutate: func(cr *CrdbCluster) {
+				cr.Status.OperatorActions = []ClusterAction{
+					{Type: DeployAction, Status: ActionStatus(Retrying).String(), Message: "timeout"},
+					{Type: InitializeAction, Status: ActionStatus(Failed).String(), Message: "no nodes"},
+				}
+			},
+			health:  HealthDegraded,
+			message: "Action Initialize is Failed: no nodes",
+		},
+		{
+			name: "retried action",
+			mutate: func(cr *CrdbCluster) {
+				cr.Status.OperatorActions = []ClusterAction{
+					{Type: DeployAction, Status: ActionStatus(Retrying).String(), Message: "timeout"},
+				}
+			},
+			health:  HealthProgressing,
+			message: "Action Deploy is Retrying: timeout",
+		},
+		{
+			name: "degraded before progressing",
+			mutate: func(cr *CrdbCluster) {
+				cr.Status.Conditions = []ClusterCondition{
+					condition(ProgressingCondition, metav1.ConditionTrue, "2 of 3 pods are ready"),
+					condition(DegradedCondition, metav1.ConditionTrue, "node 2 is dead"),
+				}
+			},
+			health:  HealthDegraded,
+			message: "node 2 is dead",
+		},
+		{
+			name: "not initialized",
+			mutate: func(cr *CrdbCluster) {
+				cr.Status.Conditions = []ClusterCondition{
+					condition(InitializedCondition, metav1.ConditionFalse, ""),
+					condition(ProgressingCondition, metav1.ConditionFalse, ""),
+				}
+			},
+			health:  HealthProgressing,
+			message: "Initialized is False",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cr := &CrdbCluster{}
+			cr.Generation = 2
+			cr.Status.ObservedGeneration = 2
+			tt.mutate(cr)
+
+			health, message := cr.Health()
+			require.Equal(t, tt.health, health)
+			require.Equal(t, tt.message, message)
+		})
+	}
+}
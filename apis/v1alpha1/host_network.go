@@ -0,0 +1,89 @@
+/*
+Copyright 2021 The Cockroach Authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    https://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package v1alpha1
+
+import (
+	"strings"
+
+	"github.com/cockroachdb/errors"
+	corev1 "k8s.io/api/core/v1"
+)
+
+const (
+	// minNodePort and maxNodePort bound the default range of the node ports
+	// kube-proxy opens on the nodes.
+	minNodePort = 30000
+	maxNodePort = 32767
+)
+
+// hostPorts are the ports the Kubernetes components listen on on the nodes.
+var hostPorts = map[int32]string{
+	2379:  "etcd",
+	2380:  "etcd",
+	6443:  "kube-apiserver",
+	10248: "kubelet",
+	10249: "kube-proxy",
+	10250: "kubelet",
+	10255: "kubelet",
+	10256: "kube-proxy",
+	10257: "kube-controller-manager",
+	10259: "kube-scheduler",
+}
+
+// ValidateHostNetwork checks that the ports of the nodes do not conflict with
+// the ports opened on the Kubernetes nodes, and that the spec sets nothing
+// that does not work on the host network.
+func (s *CrdbClusterSpec) ValidateHostNetwork() error {
+	if !s.HostNetwork {
+		return nil
+	}
+
+	for _, port := range []struct {
+		name   string
+		number *int32
+	}{
+		{"grpcPort", s.GRPCPort},
+		{"httpPort", s.HTTPPort},
+		{"sqlPort", s.SQLPort},
+	} {
+		if port.number == nil {
+			continue
+		}
+		if component, ok := hostPorts[*port.number]; ok {
+			return errors.Newf("%s %d conflicts with the port of %s on the nodes", port.name, *port.number, component)
+		}
+		if *port.number >= minNodePort && *port.number <= maxNodePort {
+			return errors.Newf("%s %d is in the range of the node ports of the services", port.name, *port.number)
+		}
+	}
+
+	if s.DNS != nil && s.DNS.Policy == corev1.DNSClusterFirst {
+		return errors.New("the ClusterFirst DNS policy does not resolve the services on the host network, use ClusterFirstWithHostNet")
+	}
+	if s.ServiceMesh != nil {
+		return errors.New("a service mesh does not inject the pods on the host network")
+	}
+	if s.NetworkPolicy.IsEnabled() {
+		return errors.New("a network policy does not apply to the pods on the host network")
+	}
+	for _, sysctl := range s.Sysctls {
+		if strings.HasPrefix(sysctl.Name, "net.") {
+			return errors.Newf("sysctl %s is not isolated from the nodes on the host network", sysctl.Name)
+		}
+	}
+	return nil
+}
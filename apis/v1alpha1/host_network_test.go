@@ -0,0 +1,86 @@
+/*
+Copyright 2021 The Cockroach Authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    https://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package v1alpha1
+
+import (
+	"testing"
+
+	"github.com/cockroachdb/cockroach-operator/pkg/ptr"
+	"github.com/stretchr/testify/require"
+	corev1 "k8s.io/api/core/v1"
+)
+
+func TestValidateHostNetwork(t *testing.T) {
+	require.NoError(t, (&CrdbClusterSpec{SQLPort: ptr.Int32(10250), ServiceMesh: &ServiceMesh{}}).ValidateHostNetwork())
+
+	valid := CrdbClusterSpec{
+		HostNetwork:   true,
+		GRPCPort:      ptr.Int32(26258),
+		HTTPPort:      ptr.Int32(8080),
+		SQLPort:       ptr.Int32(26257),
+		DNS:           &DNSSettings{Policy: corev1.DNSClusterFirstWithHostNet},
+		NetworkPolicy: &NetworkPolicy{},
+		Sysctls:       []corev1.Sysctl{{Name: "vm.swappiness", Value: "1"}},
+	}
+	require.NoError(t, valid.ValidateHostNetwork())
+
+	tests := []struct {
+		name     string
+		update   func(s *CrdbClusterSpec)
+		expected string
+	}{
+		{
+			name:     "port of the kubelet",
+			update:   func(s *CrdbClusterSpec) { s.HTTPPort = ptr.Int32(10250) },
+			expected: "httpPort 10250 conflicts with the port of kubelet on the nodes",
+		},
+		{
+			name:     "node port",
+			update:   func(s *CrdbClusterSpec) { s.SQLPort = ptr.Int32(30000) },
+			expected: "sqlPort 30000 is in the range of the node ports of the services",
+		},
+		{
+			name:     "cluster first DNS policy",
+			update:   func(s *CrdbClusterSpec) { s.DNS.Policy = corev1.DNSClusterFirst },
+			expected: "the ClusterFirst DNS policy does not resolve the services on the host network, use ClusterFirstWithHostNet",
+		},
+		{
+			name:     "service mesh",
+			update:   func(s *CrdbClusterSpec) { s.ServiceMesh = &ServiceMesh{Type: ServiceMeshIstio} },
+			expected: "a service mesh does not inject the pods on the host network",
+		},
+		{
+			name:     "network policy",
+			update:   func(s *CrdbClusterSpec) { s.NetworkPolicy.Enabled = true },
+			expected: "a network policy does not apply to the pods on the host network",
+		},
+		{
+			name: "network sysctl",
+			update: func(s *CrdbClusterSpec) {
+				s.Sysctls = append(s.Sysctls, corev1.Sysctl{Name: "net.core.somaxconn", Value: "4096"})
+			},
+			expected: "sysctl net.core.somaxconn is not isolated from the nodes on the host network",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			spec := *valid.DeepCopy()
+			tt.update(&spec)
+			require.EqualError(t, spec.ValidateHostNetwork(), tt.expected)
+		})
+	}
+}
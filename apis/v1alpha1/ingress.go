@@ -0,0 +1,67 @@
+/*
+Copyright 2021 The Cockroach Authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    https://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package v1alpha1
+
+import "github.com/cockroachdb/errors"
+
+// Validate checks the endpoints, and that TLS is only terminated for the
+// Ingress of the DB Console.
+func (i *Ingress) Validate() error {
+	if i.UI != nil {
+		if err := i.UI.validate("ui"); err != nil {
+			return err
+		}
+		if i.UI.Gateway != nil && i.UI.TLSSecretName != "" {
+			return errors.New("the listener of the Gateway terminates the TLS of the HTTPRoute, ui needs no tlsSecretName")
+		}
+	}
+	if i.SQL != nil {
+		if err := i.SQL.validate("sql"); err != nil {
+			return err
+		}
+		if i.SQL.TLSSecretName != "" {
+			return errors.New("TLS is passed through to the SQL port, sql needs no tlsSecretName")
+		}
+	}
+	// the TLS passthrough of an ingress controller applies to every Ingress
+	// of the host
+	if i.UI != nil && i.SQL != nil && i.UI.Host == i.SQL.Host {
+		return errors.Newf("ui and sql need distinct hosts, not %s", i.UI.Host)
+	}
+	return nil
+}
+
+// Passthrough returns whether TLS is passed through to the nodes rather than
+// terminated by the Ingress.
+func (e *IngressEndpoint) Passthrough() bool {
+	return e.TLSSecretName == ""
+}
+
+func (e *IngressEndpoint) validate(name string) error {
+	if e.Host == "" {
+		return errors.Newf("%s needs a host", name)
+	}
+	if e.Gateway != nil {
+		if e.Gateway.Name == "" {
+			return errors.Newf("the gateway of %s needs a name", name)
+		}
+		if e.IngressClassName != nil {
+			return errors.Newf("the route of %s has no ingressClassName, the gateway sets it", name)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,87 @@
+/*
+Copyright 2021 The Cockroach Authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    https://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package v1alpha1
+
+import (
+	"testing"
+
+	"github.com/cockroachdb/cockroach-operator/pkg/ptr"
+	"github.com/stretchr/testify/require"
+)
+
+func TestIngressValidate(t *testing.T) {
+	tests := []struct {
+		name    string
+		ingress Ingress
+		err     string
+	}{
+		{
+			name: "accepts ingresses",
+			ingress: Ingress{
+				UI:  &IngressEndpoint{Host: "ui.example.com", TLSSecretName: "ui-tls", IngressClassName: ptr.String("nginx")},
+				SQL: &IngressEndpoint{Host: "sql.example.com"},
+			},
+		},
+		{
+			name: "accepts routes",
+			ingress: Ingress{
+				UI:  &IngressEndpoint{Host: "ui.example.com", Gateway: &GatewayRef{Name: "gw", SectionName: "https"}},
+				SQL: &IngressEndpoint{Host: "sql.example.com", Gateway: &GatewayRef{Name: "gw", SectionName: "tls"}},
+			},
+		},
+		{
+			name:    "rejects an endpoint without a host",
+			ingress: Ingress{SQL: &IngressEndpoint{}},
+			err:     "sql needs a host",
+		},
+		{
+			name:    "rejects a gateway without a name",
+			ingress: Ingress{UI: &IngressEndpoint{Host: "ui.example.com", Gateway: &GatewayRef{}}},
+			err:     "the gateway of ui needs a name",
+		},
+		{
+			name:    "rejects a TLS secret of the SQL endpoint",
+			ingress: Ingress{SQL: &IngressEndpoint{Host: "sql.example.com", TLSSecretName: "sql-tls"}},
+			err:     "TLS is passed through to the SQL port",
+		},
+		{
+			name:    "rejects a TLS secret of an HTTPRoute",
+			ingress: Ingress{UI: &IngressEndpoint{Host: "ui.example.com", TLSSecretName: "ui-tls", Gateway: &GatewayRef{Name: "gw"}}},
+			err:     "the listener of the Gateway terminates the TLS of the HTTPRoute",
+		},
+		{
+			name: "rejects the same host for both endpoints",
+			ingress: Ingress{
+				UI:  &IngressEndpoint{Host: "crdb.example.com"},
+				SQL: &IngressEndpoint{Host: "crdb.example.com"},
+			},
+			err: "ui and sql need distinct hosts",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := tt.ingress.Validate()
+			if tt.err == "" {
+				require.NoError(t, err)
+			} else {
+				require.Error(t, err)
+				require.Contains(t, err.Error(), tt.err)
+			}
+		})
+	}
+}
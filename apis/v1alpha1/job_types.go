@@ -0,0 +1,130 @@
+/*
+Copyright 2021 The Cockroach Authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    https://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package v1alpha1
+
+import (
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+//JobPhase is the phase of the command run by a CrdbJob
+type JobPhase string
+
+const (
+	//JobPending the Job is created but its pod did not start yet
+	JobPending JobPhase = "Pending"
+	//JobRunning the command is running
+	JobRunning JobPhase = "Running"
+	//JobSucceeded the command exited successfully
+	JobSucceeded JobPhase = "Succeeded"
+	//JobFailed the command failed more times than the backoff limit allows
+	JobFailed JobPhase = "Failed"
+)
+
+// +k8s:openapi-gen=true
+// +k8s:deepcopy-gen=true
+
+// CrdbJobSpec defines a cockroach command run once against a cluster
+type CrdbJobSpec struct {
+	// ClusterName is the name of the CrdbCluster, in the namespace of the job,
+	// the command connects to
+	// +required
+	ClusterName string `json:"clusterName"`
+	// Args are the arguments of the cockroach binary, for instance
+	// ["workload", "init", "movr"]. The host of the cluster and the root client
+	// certificate are given by the environment
+	// +kubebuilder:validation:MinItems=1
+	// +required
+	Args []string `json:"args"`
+	// (Optional) Image runs the command with another image than the one of the
+	// cluster, it must have the cockroach binary at /cockroach/cockroach
+	// +optional
+	Image string `json:"image,omitempty"`
+	// (Optional) BackoffLimit is the number of times the command is retried
+	// before the job fails
+	// Default: 0
+	// +kubebuilder:validation:Minimum=0
+	// +optional
+	BackoffLimit int32 `json:"backoffLimit,omitempty"`
+	// (Optional) TTLSecondsAfterFinished deletes the CrdbJob, with its Job and
+	// pods, this long after the command finished. The job is kept when unset
+	// +kubebuilder:validation:Minimum=0
+	// +optional
+	TTLSecondsAfterFinished *int32 `json:"ttlSecondsAfterFinished,omitempty"`
+	// (Optional) Resources are the resource requirements of the job container
+	// +optional
+	Resources corev1.ResourceRequirements `json:"resources,omitempty"`
+}
+
+// +k8s:openapi-gen=true
+// +k8s:deepcopy-gen=true
+
+// CrdbJobStatus is the observed state of the command
+type CrdbJobStatus struct {
+	// Phase of the command
+	Phase JobPhase `json:"phase,omitempty"`
+	// StartTime is when the Job started
+	StartTime *metav1.Time `json:"startTime,omitempty"`
+	// CompletionTime is when the command succeeded or the job failed
+	CompletionTime *metav1.Time `json:"completionTime,omitempty"`
+	// ExitCode of the last run of the command
+	ExitCode *int32 `json:"exitCode,omitempty"`
+	// Message explains why the job is pending or failed
+	Message string `json:"message,omitempty"`
+}
+
+//Finished returns whether the command succeeded or the job failed
+func (s CrdbJobStatus) Finished() bool {
+	return s.Phase == JobSucceeded || s.Phase == JobFailed
+}
+
+// +genclient
+// +k8s:deepcopy-gen:interfaces=k8s.io/apimachinery/pkg/runtime.Object
+// +k8s:deepcopy-gen=true
+// +kubebuilder:object:root=true
+// +kubebuilder:resource:categories=all;cockroachdb
+// +kubebuilder:subresource:status
+// +kubebuilder:printcolumn:name="Cluster",type=string,JSONPath=`.spec.clusterName`
+// +kubebuilder:printcolumn:name="Phase",type=string,JSONPath=`.status.phase`
+// +kubebuilder:printcolumn:name="Exit Code",type=integer,JSONPath=`.status.exitCode`
+// +kubebuilder:printcolumn:name="Age",type=date,JSONPath=`.metadata.creationTimestamp`
+// +k8s:openapi-gen=true
+
+// CrdbJob runs a cockroach command, such as debug zip, workload or nodelocal
+// upload, as a Job with the certificates of a cluster
+type CrdbJob struct {
+	metav1.TypeMeta   `json:",inline"`
+	metav1.ObjectMeta `json:"metadata,omitempty"`
+
+	Spec   CrdbJobSpec   `json:"spec,omitempty"`
+	Status CrdbJobStatus `json:"status,omitempty"`
+}
+
+// +k8s:deepcopy-gen:interfaces=k8s.io/apimachinery/pkg/runtime.Object
+// +k8s:deepcopy-gen=true
+// +kubebuilder:object:root=true
+
+// CrdbJobList contains a list of CrdbJob
+type CrdbJobList struct {
+	metav1.TypeMeta `json:",inline"`
+	metav1.ListMeta `json:"metadata,omitempty"`
+	Items           []CrdbJob `json:"items"`
+}
+
+func init() {
+	SchemeBuilder.Register(&CrdbJob{}, &CrdbJobList{})
+}
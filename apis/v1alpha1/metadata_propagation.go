@@ -0,0 +1,62 @@
+/*
+Copyright 2021 The Cockroach Authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    https://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package v1alpha1
+
+// DefaultPropagatedResources are the kinds of the generated resources the
+// additional labels and annotations are set on when metadataPropagation is not
+// set.
+var DefaultPropagatedResources = []PropagatedResource{
+	PropagateStatefulSet,
+	PropagatePod,
+	PropagateService,
+	PropagatePersistentVolumeClaim,
+	PropagateSecret,
+}
+
+// Propagates returns whether the additional labels and annotations are
+// propagated to the resources of the kind.
+func (p *MetadataPropagation) Propagates(kind PropagatedResource) bool {
+	resources := DefaultPropagatedResources
+	if p != nil {
+		resources = p.Resources
+	}
+	for _, r := range resources {
+		if r == kind {
+			return true
+		}
+	}
+	return false
+}
+
+// PropagatedAnnotations returns the additional annotations of the resources of
+// the kind, nil when they are not propagated to it.
+func (s *CrdbClusterSpec) PropagatedAnnotations(kind PropagatedResource) map[string]string {
+	if !s.MetadataPropagation.Propagates(kind) {
+		return nil
+	}
+	return s.AdditionalAnnotations
+}
+
+// PropagatedLabels returns the additional labels of the resources of the kind,
+// nil when they are not propagated to it. The pods always get them since the
+// statefulset, the services and the disruption budget select the pods by them.
+func (s *CrdbClusterSpec) PropagatedLabels(kind PropagatedResource) map[string]string {
+	if kind != PropagatePod && !s.MetadataPropagation.Propagates(kind) {
+		return nil
+	}
+	return s.AdditionalLabels
+}
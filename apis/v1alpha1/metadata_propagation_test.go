@@ -0,0 +1,66 @@
+/*
+Copyright 2021 The Cockroach Authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    https://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package v1alpha1_test
+
+import (
+	"testing"
+
+	api "github.com/cockroachdb/cockroach-operator/apis/v1alpha1"
+	"github.com/stretchr/testify/require"
+)
+
+func TestPropagatedAnnotations(t *testing.T) {
+	annotations := map[string]string{"cost-center": "db"}
+	spec := api.CrdbClusterSpec{AdditionalAnnotations: annotations}
+	for _, kind := range api.DefaultPropagatedResources {
+		require.Equal(t, annotations, spec.PropagatedAnnotations(kind), kind)
+	}
+
+	spec.MetadataPropagation = &api.MetadataPropagation{Resources: []api.PropagatedResource{
+		api.PropagatePod,
+		api.PropagatePersistentVolumeClaim,
+	}}
+	require.Equal(t, annotations, spec.PropagatedAnnotations(api.PropagatePod))
+	require.Equal(t, annotations, spec.PropagatedAnnotations(api.PropagatePersistentVolumeClaim))
+	require.Nil(t, spec.PropagatedAnnotations(api.PropagateStatefulSet))
+	require.Nil(t, spec.PropagatedAnnotations(api.PropagateSecret))
+
+	// an empty list propagates them nowhere
+	spec.MetadataPropagation = &api.MetadataPropagation{}
+	require.Nil(t, spec.PropagatedAnnotations(api.PropagatePod))
+}
+
+func TestPropagatedLabels(t *testing.T) {
+	labels := map[string]string{"team": "storage"}
+	spec := api.CrdbClusterSpec{AdditionalLabels: labels}
+	for _, kind := range api.DefaultPropagatedResources {
+		require.Equal(t, labels, spec.PropagatedLabels(kind), kind)
+	}
+
+	spec.MetadataPropagation = &api.MetadataPropagation{Resources: []api.PropagatedResource{
+		api.PropagateStatefulSet,
+	}}
+	require.Equal(t, labels, spec.PropagatedLabels(api.PropagateStatefulSet))
+	require.Nil(t, spec.PropagatedLabels(api.PropagateService))
+	require.Nil(t, spec.PropagatedLabels(api.PropagatePersistentVolumeClaim))
+	require.Nil(t, spec.PropagatedLabels(api.PropagateSecret))
+
+	// the pods are selected by them, they keep them even with an empty list
+	spec.MetadataPropagation = &api.MetadataPropagation{}
+	require.Equal(t, labels, spec.PropagatedLabels(api.PropagatePod))
+	require.Nil(t, spec.PropagatedLabels(api.PropagateStatefulSet))
+}
@@ -0,0 +1,136 @@
+/*
+Copyright 2021 The Cockroach Authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    https://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package v1alpha1
+
+import (
+	"strings"
+
+	"github.com/cockroachdb/errors"
+)
+
+// ValidateMultiCluster checks that the regions and their CrdbClusters are
+// listed once each, and that the region of this cluster, the CrdbCluster
+// named name, is listed with its name and its number of nodes.
+func (s *CrdbClusterSpec) ValidateMultiCluster(name string) error {
+	m := s.MultiCluster
+	if m == nil {
+		return nil
+	}
+	if m.Region == "" {
+		return errors.New("the region of the cluster is required")
+	}
+
+	regions, clusters := map[string]bool{}, map[string]bool{}
+	for _, region := range m.Regions {
+		if region.Name == "" || region.Cluster == "" {
+			return errors.New("a region has no name or no cluster")
+		}
+		if regions[region.Name] {
+			return errors.Newf("region %q is listed more than once", region.Name)
+		}
+		regions[region.Name] = true
+		if clusters[region.Cluster] {
+			return errors.Newf("cluster %q runs more than one region", region.Cluster)
+		}
+		clusters[region.Cluster] = true
+		for _, addr := range region.JoinAddrs {
+			if err := validateAddr(addr); err != nil || strings.Contains(addr, "$(") {
+				return errors.Newf("invalid join address %q of region %s", addr, region.Name)
+			}
+		}
+	}
+
+	local := m.LocalRegion()
+	if local == nil {
+		return errors.Newf("region %q is not listed in the regions", m.Region)
+	}
+	if local.Cluster != name {
+		return errors.Newf("region %q is run by cluster %q, not %q", m.Region, local.Cluster, name)
+	}
+	nodes := s.Nodes
+	for _, pool := range s.NodePools {
+		nodes += pool.Nodes
+	}
+	if local.Nodes != nodes {
+		return errors.Newf("region %q is listed with %d nodes, the cluster has %d", m.Region, local.Nodes, nodes)
+	}
+
+	// the nodes are in the region of the cluster
+	for _, pool := range s.NodePools {
+		if pool.Locality != "" && pool.Region() != m.Region {
+			return errors.Newf("node pool %q is in region %q, not %q", pool.Name, pool.Region(), m.Region)
+		}
+	}
+	for _, arg := range s.AdditionalArgs {
+		if locality := strings.TrimPrefix(arg, "--locality="); locality != arg {
+			if region := (NodePool{Locality: locality}).Region(); region != m.Region {
+				return errors.Newf("the --locality of the additional arguments is not in region %q", m.Region)
+			}
+		}
+	}
+
+	if m.CASecret != "" && (s.VaultPKI != nil || s.ExternalCA != nil || s.SplitCA != nil || s.NodeTLSSecret != "") {
+		return errors.New("caSecret cannot be set with vaultPKI, externalCA, splitCA or nodeTLSSecret")
+	}
+	return nil
+}
+
+// LocalRegion returns the region of this cluster, nil if it is not listed.
+func (m *MultiCluster) LocalRegion() *ClusterRegion {
+	for i := range m.Regions {
+		if m.Regions[i].Name == m.Region {
+			return &m.Regions[i]
+		}
+	}
+	return nil
+}
+
+// IsFirstRegion returns true when the region of this cluster is the first one,
+// which initializes the cluster and generates the shared CA.
+func (m *MultiCluster) IsFirstRegion() bool {
+	return len(m.Regions) > 0 && m.Regions[0].Name == m.Region
+}
+
+// FirstRegion returns the name of the first region.
+func (m *MultiCluster) FirstRegion() string {
+	if len(m.Regions) == 0 {
+		return ""
+	}
+	return m.Regions[0].Name
+}
+
+// RegionsBefore returns the regions upgraded before the region of this
+// cluster.
+func (m *MultiCluster) RegionsBefore() []ClusterRegion {
+	for i, region := range m.Regions {
+		if region.Name == m.Region {
+			return m.Regions[:i]
+		}
+	}
+	return nil
+}
+
+// RemoteJoinAddrs returns the join addresses of the other regions.
+func (m *MultiCluster) RemoteJoinAddrs() []string {
+	var addrs []string
+	for _, region := range m.Regions {
+		if region.Name != m.Region {
+			addrs = append(addrs, region.JoinAddrs...)
+		}
+	}
+	return addrs
+}
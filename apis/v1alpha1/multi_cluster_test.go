@@ -0,0 +1,130 @@
+/*
+Copyright 2021 The Cockroach Authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    https://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package v1alpha1
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func multiClusterSpec() CrdbClusterSpec {
+	return CrdbClusterSpec{
+		Nodes:          3,
+		AdditionalArgs: []string{"--locality=region=us-east1,zone=us-east1-b"},
+		MultiCluster: &MultiCluster{
+			Region: "us-east1",
+			Regions: []ClusterRegion{
+				{Name: "us-west1", Cluster: "crdb-west", Nodes: 3, JoinAddrs: []string{"crdb-west-0.west.db.example.com:26258"}},
+				{Name: "us-east1", Cluster: "crdb-east", Nodes: 3, JoinAddrs: []string{"crdb-east-0.east.db.example.com:26258"}},
+				{Name: "europe-west1", Cluster: "crdb-europe", Nodes: 3, JoinAddrs: []string{"crdb-europe-0.europe.db.example.com:26258"}},
+			},
+			CASecret: "crdb-shared-ca",
+		},
+	}
+}
+
+func TestValidateMultiCluster(t *testing.T) {
+	spec := multiClusterSpec()
+	require.NoError(t, spec.ValidateMultiCluster("crdb-east"))
+	require.NoError(t, (&CrdbClusterSpec{}).ValidateMultiCluster("crdb"))
+
+	tests := []struct {
+		name     string
+		update   func(s *CrdbClusterSpec)
+		expected string
+	}{
+		{
+			name:     "no region",
+			update:   func(s *CrdbClusterSpec) { s.MultiCluster.Region = "" },
+			expected: "the region of the cluster is required",
+		},
+		{
+			name:     "region without a cluster",
+			update:   func(s *CrdbClusterSpec) { s.MultiCluster.Regions[0].Cluster = "" },
+			expected: "a region has no name or no cluster",
+		},
+		{
+			name:     "duplicate region",
+			update:   func(s *CrdbClusterSpec) { s.MultiCluster.Regions[2].Name = "us-west1" },
+			expected: `region "us-west1" is listed more than once`,
+		},
+		{
+			name:     "cluster running two regions",
+			update:   func(s *CrdbClusterSpec) { s.MultiCluster.Regions[0].Cluster = "crdb-east" },
+			expected: `cluster "crdb-east" runs more than one region`,
+		},
+		{
+			name:     "invalid join address",
+			update:   func(s *CrdbClusterSpec) { s.MultiCluster.Regions[0].JoinAddrs = []string{"a:1,b:2"} },
+			expected: `invalid join address "a:1,b:2" of region us-west1`,
+		},
+		{
+			name:     "region not listed",
+			update:   func(s *CrdbClusterSpec) { s.MultiCluster.Region = "asia-east1" },
+			expected: `region "asia-east1" is not listed in the regions`,
+		},
+		{
+			name:     "region of another cluster",
+			update:   func(s *CrdbClusterSpec) { s.MultiCluster.Regions[1].Cluster = "crdb" },
+			expected: `region "us-east1" is run by cluster "crdb", not "crdb-east"`,
+		},
+		{
+			name:     "other number of nodes",
+			update:   func(s *CrdbClusterSpec) { s.NodePools = []NodePool{{Name: "large", Nodes: 2}} },
+			expected: `region "us-east1" is listed with 3 nodes, the cluster has 5`,
+		},
+		{
+			name: "node pool in another region",
+			update: func(s *CrdbClusterSpec) {
+				s.Nodes = 1
+				s.NodePools = []NodePool{{Name: "large", Nodes: 2, Locality: "region=us-west1"}}
+			},
+			expected: `node pool "large" is in region "us-west1", not "us-east1"`,
+		},
+		{
+			name:     "locality in another region",
+			update:   func(s *CrdbClusterSpec) { s.AdditionalArgs = []string{"--locality=zone=us-east1-b"} },
+			expected: `the --locality of the additional arguments is not in region "us-east1"`,
+		},
+		{
+			name:     "shared CA with Vault",
+			update:   func(s *CrdbClusterSpec) { s.VaultPKI = &VaultPKI{} },
+			expected: "caSecret cannot be set with vaultPKI, externalCA, splitCA or nodeTLSSecret",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			spec := multiClusterSpec()
+			tt.update(&spec)
+			require.EqualError(t, spec.ValidateMultiCluster("crdb-east"), tt.expected)
+		})
+	}
+}
+
+func TestMultiClusterRegions(t *testing.T) {
+	m := multiClusterSpec().MultiCluster
+	require.Equal(t, "crdb-east", m.LocalRegion().Cluster)
+	require.False(t, m.IsFirstRegion())
+	require.Equal(t, "us-west1", m.FirstRegion())
+	require.Equal(t, []ClusterRegion{m.Regions[0]}, m.RegionsBefore())
+	require.Equal(t, []string{"crdb-west-0.west.db.example.com:26258", "crdb-europe-0.europe.db.example.com:26258"}, m.RemoteJoinAddrs())
+
+	m.Region = "us-west1"
+	require.True(t, m.IsFirstRegion())
+	require.Empty(t, m.RegionsBefore())
+}
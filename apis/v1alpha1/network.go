@@ -0,0 +1,113 @@
+/*
+Copyright 2021 The Cockroach Authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    https://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package v1alpha1
+
+import (
+	"net"
+	"regexp"
+	"strings"
+
+	"github.com/cockroachdb/errors"
+)
+
+// PodNamePrefix starts the hosts that hold the name of the pod of each node.
+const PodNamePrefix = "$(POD_NAME)."
+
+var (
+	// addrRegexp matches the addresses `<host>[:<port>]`, where the host is a
+	// DNS name or an IP address, in brackets with a port for IPv6.
+	addrRegexp = regexp.MustCompile(`^[a-zA-Z0-9.:\[\]-]+$`)
+	// localityTierRegexp matches a locality tier `<key>=<value>`.
+	localityTierRegexp = regexp.MustCompile(`^[a-zA-Z0-9_-]+=[a-zA-Z0-9_.-]+$`)
+)
+
+// Validate checks the advertised addresses and the additional join addresses.
+func (n *NetworkSettings) Validate() error {
+	if n.AdvertiseAddr != "" {
+		if !strings.HasPrefix(n.AdvertiseAddr, PodNamePrefix) {
+			return errors.Newf("advertiseAddr %q must start with %s", n.AdvertiseAddr, PodNamePrefix)
+		}
+		if err := validateAddr(n.AdvertiseAddr); err != nil {
+			return errors.Wrap(err, "invalid advertiseAddr")
+		}
+	}
+	tiers := map[string]bool{}
+	for _, addr := range n.LocalityAdvertiseAddrs {
+		if !localityTierRegexp.MatchString(addr.Locality) {
+			return errors.Newf("invalid locality tier %q: must be <key>=<value>", addr.Locality)
+		}
+		if tiers[addr.Locality] {
+			return errors.Newf("locality tier %q is listed more than once", addr.Locality)
+		}
+		tiers[addr.Locality] = true
+		if err := validateAddr(addr.Addr); err != nil {
+			return errors.Wrapf(err, "invalid address of locality tier %s", addr.Locality)
+		}
+	}
+	for _, addr := range n.AdditionalJoinAddrs {
+		if strings.Contains(addr, "$(") {
+			return errors.Newf("invalid join address %q: must not hold the name of a pod", addr)
+		}
+		if err := validateAddr(addr); err != nil {
+			return errors.Wrap(err, "invalid join address")
+		}
+	}
+	return nil
+}
+
+// CertHosts returns the hosts of the advertised addresses, for the node
+// certificate. `$(POD_NAME)` is replaced with a wildcard, which matches the name
+// of any pod.
+func (n *NetworkSettings) CertHosts() []string {
+	var hosts []string
+	addrs := []string{n.AdvertiseAddr}
+	for _, addr := range n.LocalityAdvertiseAddrs {
+		addrs = append(addrs, addr.Addr)
+	}
+	seen := map[string]bool{}
+	for _, addr := range addrs {
+		if addr == "" {
+			continue
+		}
+		host := addrHost(addr)
+		if strings.HasPrefix(host, PodNamePrefix) {
+			host = "*." + strings.TrimPrefix(host, PodNamePrefix)
+		}
+		if !seen[host] {
+			seen[host] = true
+			hosts = append(hosts, host)
+		}
+	}
+	return hosts
+}
+
+// validateAddr checks that addr is `<host>[:<port>]`, where the host may start
+// with `$(POD_NAME).`.
+func validateAddr(addr string) error {
+	if !addrRegexp.MatchString(strings.TrimPrefix(addr, PodNamePrefix)) {
+		return errors.Newf("invalid address %q: must be <host>[:<port>]", addr)
+	}
+	return nil
+}
+
+// addrHost returns the host of the address `<host>[:<port>]`.
+func addrHost(addr string) string {
+	if host, _, err := net.SplitHostPort(addr); err == nil {
+		return host
+	}
+	return strings.Trim(addr, "[]")
+}
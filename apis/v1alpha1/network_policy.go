@@ -0,0 +1,68 @@
+/*
+Copyright 2021 The Cockroach Authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    https://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package v1alpha1
+
+import (
+	"net"
+
+	"github.com/cockroachdb/errors"
+)
+
+// Validate checks that the allowed clients come with an enabled policy, and
+// that each of them selects pods, namespaces or an IP block.
+func (p *NetworkPolicy) Validate() error {
+	if !p.Enabled && (len(p.AllowedNamespaces) > 0 || len(p.AllowedClients) > 0) {
+		return errors.New("allowedNamespaces and allowedClients need an enabled network policy")
+	}
+
+	seen := map[string]bool{}
+	for _, ns := range p.AllowedNamespaces {
+		if ns == "" {
+			return errors.New("an allowed namespace has no name")
+		}
+		if seen[ns] {
+			return errors.Newf("duplicate allowed namespace %q", ns)
+		}
+		seen[ns] = true
+	}
+
+	for i, peer := range p.AllowedClients {
+		if peer.IPBlock == nil {
+			if peer.PodSelector == nil && peer.NamespaceSelector == nil {
+				return errors.Newf("allowed client %d selects no pods, namespaces or IP block", i)
+			}
+			continue
+		}
+		if peer.PodSelector != nil || peer.NamespaceSelector != nil {
+			return errors.Newf("allowed client %d combines an IP block with selectors", i)
+		}
+		if _, _, err := net.ParseCIDR(peer.IPBlock.CIDR); err != nil {
+			return errors.Wrapf(err, "invalid IP block of allowed client %d", i)
+		}
+		for _, cidr := range peer.IPBlock.Except {
+			if _, _, err := net.ParseCIDR(cidr); err != nil {
+				return errors.Wrapf(err, "invalid exception of the IP block of allowed client %d", i)
+			}
+		}
+	}
+	return nil
+}
+
+// IsEnabled returns whether the cluster has a NetworkPolicy.
+func (p *NetworkPolicy) IsEnabled() bool {
+	return p != nil && p.Enabled
+}
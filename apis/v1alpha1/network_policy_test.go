@@ -0,0 +1,109 @@
+/*
+Copyright 2021 The Cockroach Authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    https://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package v1alpha1
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	networkingv1 "k8s.io/api/networking/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+func TestNetworkPolicyValidate(t *testing.T) {
+	selector := &metav1.LabelSelector{MatchLabels: map[string]string{"app": "web"}}
+
+	tests := []struct {
+		name   string
+		policy NetworkPolicy
+		err    string
+	}{
+		{
+			name:   "accepts a policy without allowed clients",
+			policy: NetworkPolicy{Enabled: true},
+		},
+		{
+			name: "accepts namespaces, selectors and IP blocks",
+			policy: NetworkPolicy{
+				Enabled:           true,
+				AllowedNamespaces: []string{"web", "ingress-nginx"},
+				AllowedClients: []networkingv1.NetworkPolicyPeer{
+					{PodSelector: selector, NamespaceSelector: &metav1.LabelSelector{}},
+					{IPBlock: &networkingv1.IPBlock{CIDR: "10.0.0.0/8", Except: []string{"10.1.0.0/16"}}},
+				},
+			},
+		},
+		{
+			name:   "rejects allowed clients of a disabled policy",
+			policy: NetworkPolicy{AllowedNamespaces: []string{"web"}},
+			err:    "allowedNamespaces and allowedClients need an enabled network policy",
+		},
+		{
+			name:   "rejects a duplicate namespace",
+			policy: NetworkPolicy{Enabled: true, AllowedNamespaces: []string{"web", "web"}},
+			err:    `duplicate allowed namespace "web"`,
+		},
+		{
+			name: "rejects a client without a selector",
+			policy: NetworkPolicy{
+				Enabled:        true,
+				AllowedClients: []networkingv1.NetworkPolicyPeer{{}},
+			},
+			err: "allowed client 0 selects no pods, namespaces or IP block",
+		},
+		{
+			name: "rejects an IP block with selectors",
+			policy: NetworkPolicy{
+				Enabled: true,
+				AllowedClients: []networkingv1.NetworkPolicyPeer{
+					{PodSelector: selector, IPBlock: &networkingv1.IPBlock{CIDR: "10.0.0.0/8"}},
+				},
+			},
+			err: "allowed client 0 combines an IP block with selectors",
+		},
+		{
+			name: "rejects an invalid IP block",
+			policy: NetworkPolicy{
+				Enabled: true,
+				AllowedClients: []networkingv1.NetworkPolicyPeer{
+					{PodSelector: selector},
+					{IPBlock: &networkingv1.IPBlock{CIDR: "10.0.0.1"}},
+				},
+			},
+			err: "invalid IP block of allowed client 1",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := tt.policy.Validate()
+			if tt.err == "" {
+				require.NoError(t, err)
+			} else {
+				require.Error(t, err)
+				require.Contains(t, err.Error(), tt.err)
+			}
+		})
+	}
+}
+
+func TestNetworkPolicyIsEnabled(t *testing.T) {
+	var unset *NetworkPolicy
+	require.False(t, unset.IsEnabled())
+	require.False(t, (&NetworkPolicy{}).IsEnabled())
+	require.True(t, (&NetworkPolicy{Enabled: true}).IsEnabled())
+}
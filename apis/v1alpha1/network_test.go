@@ -0,0 +1,100 @@
+/*
+Copyright 2021 The Cockroach Authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    https://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package v1alpha1
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestNetworkSettingsValidate(t *testing.T) {
+	valid := &NetworkSettings{
+		AdvertiseAddr: "$(POD_NAME).east.db.example.com:26258",
+		LocalityAdvertiseAddrs: []LocalityAdvertiseAddr{
+			{Locality: "region=us-east1", Addr: "$(POD_NAME).cockroachdb.default.svc.cluster.local"},
+			{Locality: "zone=us-west1-a", Addr: "[fd00::1]:26258"},
+		},
+		AdditionalJoinAddrs: []string{"vm-0.west.db.example.com:26258", "10.1.0.4"},
+	}
+	require.NoError(t, valid.Validate())
+	require.NoError(t, (&NetworkSettings{}).Validate())
+
+	tests := []struct {
+		name     string
+		network  NetworkSettings
+		expected string
+	}{
+		{
+			name:     "advertised address without the pod name",
+			network:  NetworkSettings{AdvertiseAddr: "db.example.com"},
+			expected: `advertiseAddr "db.example.com" must start with $(POD_NAME).`,
+		},
+		{
+			name:     "advertised address with a space",
+			network:  NetworkSettings{AdvertiseAddr: "$(POD_NAME).db.example.com --insecure"},
+			expected: `invalid advertiseAddr: invalid address "$(POD_NAME).db.example.com --insecure": must be <host>[:<port>]`,
+		},
+		{
+			name:     "locality without a value",
+			network:  NetworkSettings{LocalityAdvertiseAddrs: []LocalityAdvertiseAddr{{Locality: "region", Addr: "10.0.0.1"}}},
+			expected: `invalid locality tier "region": must be <key>=<value>`,
+		},
+		{
+			name: "locality listed twice",
+			network: NetworkSettings{LocalityAdvertiseAddrs: []LocalityAdvertiseAddr{
+				{Locality: "region=us-east1", Addr: "10.0.0.1"},
+				{Locality: "region=us-east1", Addr: "10.0.0.2"},
+			}},
+			expected: `locality tier "region=us-east1" is listed more than once`,
+		},
+		{
+			name:     "locality without an address",
+			network:  NetworkSettings{LocalityAdvertiseAddrs: []LocalityAdvertiseAddr{{Locality: "region=us-east1"}}},
+			expected: `invalid address of locality tier region=us-east1: invalid address "": must be <host>[:<port>]`,
+		},
+		{
+			name:     "join address with several addresses",
+			network:  NetworkSettings{AdditionalJoinAddrs: []string{"vm-0:26258,vm-1:26258"}},
+			expected: `invalid join address: invalid address "vm-0:26258,vm-1:26258": must be <host>[:<port>]`,
+		},
+		{
+			name:     "join address with the pod name",
+			network:  NetworkSettings{AdditionalJoinAddrs: []string{"$(POD_NAME).db.example.com"}},
+			expected: `invalid join address "$(POD_NAME).db.example.com": must not hold the name of a pod`,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			require.EqualError(t, tt.network.Validate(), tt.expected)
+		})
+	}
+}
+
+func TestNetworkSettingsCertHosts(t *testing.T) {
+	network := &NetworkSettings{
+		AdvertiseAddr: "$(POD_NAME).east.db.example.com:26258",
+		LocalityAdvertiseAddrs: []LocalityAdvertiseAddr{
+			{Locality: "region=us-east1", Addr: "$(POD_NAME).east.db.example.com"},
+			{Locality: "zone=us-east1-a", Addr: "10.0.0.1:26258"},
+			{Locality: "zone=us-east1-b", Addr: "[fd00::1]:26258"},
+		},
+		AdditionalJoinAddrs: []string{"vm-0.west.db.example.com"},
+	}
+	require.Equal(t, []string{"*.east.db.example.com", "10.0.0.1", "fd00::1"}, network.CertHosts())
+	require.Empty(t, (&NetworkSettings{}).CertHosts())
+}
@@ -0,0 +1,95 @@
+/*
+Copyright 2021 The Cockroach Authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    https://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package v1alpha1
+
+import (
+	"strings"
+
+	"github.com/cockroachdb/errors"
+)
+
+// ValidateNodePools checks that every node pool has a name of its own, and
+// that the cluster is not autoscaled: the autoscalers measure and scale the
+// nodes of the cluster only.
+func (s *CrdbClusterSpec) ValidateNodePools() error {
+	names := make(map[string]bool, len(s.NodePools))
+	for _, pool := range s.NodePools {
+		if names[pool.Name] {
+			return errors.Newf("node pool %q is listed more than once", pool.Name)
+		}
+		names[pool.Name] = true
+	}
+
+	if len(s.NodePools) > 0 && s.Autoscaling != nil {
+		return errors.New("autoscaling is not supported with node pools")
+	}
+	if len(s.NodePools) > 0 && s.ResourceAutoscaling != nil {
+		return errors.New("resourceAutoscaling is not supported with node pools")
+	}
+	return nil
+}
+
+// NodePool returns the node pool with the given name, nil if there is none.
+func (s *CrdbClusterSpec) NodePool(name string) *NodePool {
+	for i := range s.NodePools {
+		if s.NodePools[i].Name == name {
+			return &s.NodePools[i]
+		}
+	}
+	return nil
+}
+
+// PVCReclaimPolicy returns the reclaim policy of the PVCs of the node pool
+// with the given name, the one of the cluster when the pool sets none.
+func (s *CrdbClusterSpec) PVCReclaimPolicy(pool string) PVCReclaimPolicy {
+	if p := s.NodePool(pool); p != nil && p.DataStore != nil && p.DataStore.ReclaimPolicy != "" {
+		return p.DataStore.ReclaimPolicy
+	}
+	return s.DataStore.ReclaimPolicy
+}
+
+// PoolNodeSelector returns the node selector of the node pool with the given
+// name, the one of the cluster when the pool sets none.
+func (s *CrdbClusterSpec) PoolNodeSelector(pool string) map[string]string {
+	if p := s.NodePool(pool); p != nil && p.NodeSelector != nil {
+		return p.NodeSelector
+	}
+	return s.NodeSelector
+}
+
+// Region returns the region in the locality of the node pool, empty if the
+// pool sets none.
+func (p NodePool) Region() string {
+	for _, tier := range strings.Split(p.Locality, ",") {
+		kv := strings.SplitN(tier, "=", 2)
+		if len(kv) == 2 && strings.TrimSpace(kv[0]) == "region" {
+			return strings.TrimSpace(kv[1])
+		}
+	}
+	return ""
+}
+
+// RegionNodePools returns the node pools whose locality is in the region.
+func (s *CrdbClusterSpec) RegionNodePools(region string) []NodePool {
+	var pools []NodePool
+	for _, pool := range s.NodePools {
+		if pool.Region() == region {
+			pools = append(pools, pool)
+		}
+	}
+	return pools
+}
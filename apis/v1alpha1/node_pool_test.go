@@ -0,0 +1,89 @@
+/*
+Copyright 2021 The Cockroach Authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    https://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package v1alpha1_test
+
+import (
+	"testing"
+
+	api "github.com/cockroachdb/cockroach-operator/apis/v1alpha1"
+	"github.com/stretchr/testify/require"
+)
+
+func TestNodePools(t *testing.T) {
+	spec := api.CrdbClusterSpec{NodePools: []api.NodePool{
+		{Name: "large", Nodes: 3},
+		{Name: "small", Nodes: 1},
+	}}
+	require.NoError(t, spec.ValidateNodePools())
+	require.Equal(t, int32(1), spec.NodePool("small").Nodes)
+	require.Nil(t, spec.NodePool("medium"))
+
+	spec.NodePools = append(spec.NodePools, api.NodePool{Name: "large", Nodes: 5})
+	require.EqualError(t, spec.ValidateNodePools(), `node pool "large" is listed more than once`)
+
+	spec.NodePools = spec.NodePools[:2]
+	spec.Autoscaling = &api.Autoscaling{}
+	require.EqualError(t, spec.ValidateNodePools(), "autoscaling is not supported with node pools")
+	spec.Autoscaling = nil
+	spec.ResourceAutoscaling = &api.ResourceAutoscaling{}
+	require.EqualError(t, spec.ValidateNodePools(), "resourceAutoscaling is not supported with node pools")
+}
+
+func TestPVCReclaimPolicy(t *testing.T) {
+	spec := api.CrdbClusterSpec{
+		DataStore: api.Volume{ReclaimPolicy: api.PVCReclaimDelete},
+		NodePools: []api.NodePool{
+			{Name: "large", DataStore: &api.Volume{ReclaimPolicy: api.PVCReclaimRetain}},
+			{Name: "small", DataStore: &api.Volume{}},
+		},
+	}
+	require.Equal(t, api.PVCReclaimDelete, spec.PVCReclaimPolicy(""))
+	require.Equal(t, api.PVCReclaimRetain, spec.PVCReclaimPolicy("large"))
+	require.Equal(t, api.PVCReclaimDelete, spec.PVCReclaimPolicy("small"))
+	// a removed pool follows the cluster
+	require.Equal(t, api.PVCReclaimDelete, spec.PVCReclaimPolicy("medium"))
+}
+
+func TestPoolNodeSelector(t *testing.T) {
+	ssd := map[string]string{"disk": "local-ssd"}
+	large := map[string]string{"node.kubernetes.io/instance-type": "n2-standard-8"}
+	spec := api.CrdbClusterSpec{
+		NodeSelector: ssd,
+		NodePools: []api.NodePool{
+			{Name: "large", NodeSelector: large},
+			{Name: "small"},
+		},
+	}
+	require.Equal(t, ssd, spec.PoolNodeSelector(""))
+	require.Equal(t, large, spec.PoolNodeSelector("large"))
+	require.Equal(t, ssd, spec.PoolNodeSelector("small"))
+}
+
+func TestRegionNodePools(t *testing.T) {
+	spec := api.CrdbClusterSpec{NodePools: []api.NodePool{
+		{Name: "east", Locality: "region=us-east1,zone=us-east1-b"},
+		{Name: "west", Locality: "zone=us-west1-a, region=us-west1"},
+		{Name: "default"},
+	}}
+	require.Equal(t, "us-east1", spec.NodePools[0].Region())
+	require.Equal(t, "us-west1", spec.NodePools[1].Region())
+	require.Empty(t, spec.NodePools[2].Region())
+
+	require.Len(t, spec.RegionNodePools("us-west1"), 1)
+	require.Equal(t, "west", spec.RegionNodePools("us-west1")[0].Name)
+	require.Empty(t, spec.RegionNodePools("europe-west1"))
+}
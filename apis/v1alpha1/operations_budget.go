@@ -0,0 +1,59 @@
+/*
+Copyright 2021 The Cockroach Authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    https://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package v1alpha1
+
+import "time"
+
+// OperationsHistory is how long the disruptive operations are kept in the
+// status, the longest period of an operations budget.
+const OperationsHistory = 24 * time.Hour
+
+// UntilOperationAllowed returns how long to wait from now before another
+// disruptive operation can start, given the operations started before. It is
+// zero when the budget allows one more operation or when there is no budget.
+func (b *OperationsBudget) UntilOperationAllowed(started []DisruptiveOperation, now time.Time) time.Duration {
+	if b == nil {
+		return 0
+	}
+
+	wait := untilBelow(b.MaxPerHour, time.Hour, started, now)
+	if w := untilBelow(b.MaxPerDay, OperationsHistory, started, now); w > wait {
+		wait = w
+	}
+	return wait
+}
+
+// untilBelow returns how long to wait before fewer than max of the operations,
+// oldest first, started within the last period.
+func untilBelow(max int32, period time.Duration, started []DisruptiveOperation, now time.Time) time.Duration {
+	if max <= 0 {
+		return 0
+	}
+
+	var inPeriod []time.Time
+	for _, op := range started {
+		if now.Sub(op.StartTime.Time) < period {
+			inPeriod = append(inPeriod, op.StartTime.Time)
+		}
+	}
+	if len(inPeriod) < int(max) {
+		return 0
+	}
+
+	// the operation that must leave the period for another one to fit
+	return inPeriod[len(inPeriod)-int(max)].Add(period).Sub(now)
+}
@@ -0,0 +1,72 @@
+/*
+Copyright 2021 The Cockroach Authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    https://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package v1alpha1_test
+
+import (
+	"testing"
+	"time"
+
+	api "github.com/cockroachdb/cockroach-operator/apis/v1alpha1"
+	"github.com/stretchr/testify/assert"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+func TestUntilOperationAllowed(t *testing.T) {
+	now := time.Date(2021, time.June, 2, 12, 0, 0, 0, time.UTC)
+	// operations started the given durations ago, oldest first
+	started := func(ago ...time.Duration) []api.DisruptiveOperation {
+		var ops []api.DisruptiveOperation
+		for _, d := range ago {
+			ops = append(ops, api.DisruptiveOperation{Action: api.ClusterRestartAction, StartTime: metav1.NewTime(now.Add(-d))})
+		}
+		return ops
+	}
+
+	tests := []struct {
+		name    string
+		budget  *api.OperationsBudget
+		started []api.DisruptiveOperation
+		wait    time.Duration
+	}{
+		{name: "no budget", started: started(time.Minute, time.Second)},
+		{name: "no limits", budget: &api.OperationsBudget{}, started: started(time.Minute, time.Second)},
+		{name: "within the hourly limit", budget: &api.OperationsBudget{MaxPerHour: 2}, started: started(10 * time.Minute)},
+		{
+			name:    "hourly limit reached",
+			budget:  &api.OperationsBudget{MaxPerHour: 2},
+			started: started(3*time.Hour, 40*time.Minute, 10*time.Minute),
+			wait:    20 * time.Minute,
+		},
+		{
+			name:    "daily limit reached",
+			budget:  &api.OperationsBudget{MaxPerHour: 2, MaxPerDay: 2},
+			started: started(20*time.Hour, 3*time.Hour),
+			wait:    4 * time.Hour,
+		},
+		{
+			name:    "operations older than a day do not count",
+			budget:  &api.OperationsBudget{MaxPerDay: 1},
+			started: started(25 * time.Hour),
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.wait, tt.budget.UntilOperationAllowed(tt.started, now))
+		})
+	}
+}
@@ -0,0 +1,120 @@
+/*
+Copyright 2021 The Cockroach Authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    https://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package v1alpha1
+
+import (
+	"regexp"
+	"strings"
+
+	"github.com/cockroachdb/errors"
+)
+
+const (
+	// DefaultGRPCPortName is the default name of the gRPC port
+	DefaultGRPCPortName = "grpc"
+	// DefaultHTTPPortName is the default name of the port of the DB Console
+	DefaultHTTPPortName = "http"
+	// DefaultSQLPortName is the default name of the SQL port
+	DefaultSQLPortName = "sql"
+)
+
+// portNameRegexp matches the IANA service names Kubernetes accepts as port
+// names, the length aside.
+var portNameRegexp = regexp.MustCompile(`^[a-z0-9]([a-z0-9-]*[a-z0-9])?$`)
+
+// GRPCOrDefault returns the name of the gRPC port, grpc if none is set.
+func (n *PortNames) GRPCOrDefault() string {
+	if n == nil || n.GRPC == "" {
+		return DefaultGRPCPortName
+	}
+	return n.GRPC
+}
+
+// HTTPOrDefault returns the name of the port of the DB Console, http if none
+// is set.
+func (n *PortNames) HTTPOrDefault() string {
+	if n == nil || n.HTTP == "" {
+		return DefaultHTTPPortName
+	}
+	return n.HTTP
+}
+
+// SQLOrDefault returns the name of the SQL port, sql if none is set.
+func (n *PortNames) SQLOrDefault() string {
+	if n == nil || n.SQL == "" {
+		return DefaultSQLPortName
+	}
+	return n.SQL
+}
+
+// ValidatePorts checks that the gRPC, HTTP and SQL ports are distinct, as the
+// nodes listen on the three of them, and that their names are distinct valid
+// port names.
+func (s *CrdbClusterSpec) ValidatePorts() error {
+	ports := map[int32]string{}
+	for _, port := range []struct {
+		name   string
+		number *int32
+	}{
+		{"grpcPort", s.GRPCPort},
+		{"httpPort", s.HTTPPort},
+		{"sqlPort", s.SQLPort},
+	} {
+		if port.number == nil {
+			continue
+		}
+		if *port.number < 1 || *port.number > 65535 {
+			return errors.Newf("%s %d is not between 1 and 65535", port.name, *port.number)
+		}
+		if other, ok := ports[*port.number]; ok {
+			return errors.Newf("%s and %s are both %d", other, port.name, *port.number)
+		}
+		ports[*port.number] = port.name
+	}
+
+	names := map[string]bool{}
+	for _, name := range []string{
+		s.PortNames.GRPCOrDefault(),
+		s.PortNames.HTTPOrDefault(),
+		s.PortNames.SQLOrDefault(),
+	} {
+		if err := validatePortName(name); err != nil {
+			return err
+		}
+		if names[name] {
+			return errors.Newf("port name %q is used more than once", name)
+		}
+		names[name] = true
+	}
+	return nil
+}
+
+// validatePortName checks that name is an IANA service name: at most 15
+// lowercase letters, digits and hyphens, with at least one letter and no
+// hyphen at either end or next to another.
+func validatePortName(name string) error {
+	if len(name) > 15 || !portNameRegexp.MatchString(name) {
+		return errors.Newf("invalid port name %q: must be at most 15 lowercase letters, digits and hyphens", name)
+	}
+	if strings.Contains(name, "--") {
+		return errors.Newf("invalid port name %q: must not contain consecutive hyphens", name)
+	}
+	if !strings.ContainsAny(name, "abcdefghijklmnopqrstuvwxyz") {
+		return errors.Newf("invalid port name %q: must contain a letter", name)
+	}
+	return nil
+}
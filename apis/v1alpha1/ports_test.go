@@ -0,0 +1,64 @@
+/*
+Copyright 2021 The Cockroach Authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    https://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package v1alpha1
+
+import (
+	"testing"
+
+	"github.com/cockroachdb/cockroach-operator/pkg/ptr"
+	"github.com/stretchr/testify/require"
+)
+
+func TestPortNamesOrDefault(t *testing.T) {
+	var names *PortNames
+	require.Equal(t, "grpc", names.GRPCOrDefault())
+	require.Equal(t, "http", names.HTTPOrDefault())
+	require.Equal(t, "sql", names.SQLOrDefault())
+
+	names = &PortNames{GRPC: "tcp-grpc", HTTP: "https-ui", SQL: "tcp-sql"}
+	require.Equal(t, "tcp-grpc", names.GRPCOrDefault())
+	require.Equal(t, "https-ui", names.HTTPOrDefault())
+	require.Equal(t, "tcp-sql", names.SQLOrDefault())
+}
+
+func TestValidatePorts(t *testing.T) {
+	spec := func(grpc, http, sql int32, names *PortNames) *CrdbClusterSpec {
+		return &CrdbClusterSpec{
+			GRPCPort:  ptr.Int32(grpc),
+			HTTPPort:  ptr.Int32(http),
+			SQLPort:   ptr.Int32(sql),
+			PortNames: names,
+		}
+	}
+
+	require.NoError(t, (&CrdbClusterSpec{}).ValidatePorts())
+	require.NoError(t, spec(26258, 8080, 26257, nil).ValidatePorts())
+	require.NoError(t, spec(36258, 443, 5432, &PortNames{GRPC: "tcp-grpc", HTTP: "https-ui"}).ValidatePorts())
+
+	require.EqualError(t, spec(26257, 8080, 26257, nil).ValidatePorts(), "grpcPort and sqlPort are both 26257")
+	require.EqualError(t, spec(26258, 70000, 26257, nil).ValidatePorts(), "httpPort 70000 is not between 1 and 65535")
+	require.EqualError(t, spec(26258, 8080, 26257, &PortNames{SQL: "grpc"}).ValidatePorts(),
+		`port name "grpc" is used more than once`)
+	require.EqualError(t, spec(26258, 8080, 26257, &PortNames{HTTP: "HTTP"}).ValidatePorts(),
+		`invalid port name "HTTP": must be at most 15 lowercase letters, digits and hyphens`)
+	require.EqualError(t, spec(26258, 8080, 26257, &PortNames{HTTP: "a-very-long-port-name"}).ValidatePorts(),
+		`invalid port name "a-very-long-port-name": must be at most 15 lowercase letters, digits and hyphens`)
+	require.EqualError(t, spec(26258, 8080, 26257, &PortNames{GRPC: "tcp--grpc"}).ValidatePorts(),
+		`invalid port name "tcp--grpc": must not contain consecutive hyphens`)
+	require.EqualError(t, spec(26258, 8080, 26257, &PortNames{SQL: "5432"}).ValidatePorts(),
+		`invalid port name "5432": must contain a letter`)
+}
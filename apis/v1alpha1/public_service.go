@@ -0,0 +1,141 @@
+/*
+Copyright 2021 The Cockroach Authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    https://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package v1alpha1
+
+import (
+	"net"
+	"regexp"
+	"strings"
+
+	"github.com/cockroachdb/errors"
+	corev1 "k8s.io/api/core/v1"
+)
+
+// Validate checks the type of the service, and that the options of the
+// external traffic only come with the types that expose the service.
+func (s *PublicService) Validate() error {
+	serviceType := s.TypeOrDefault()
+	switch serviceType {
+	case corev1.ServiceTypeClusterIP, corev1.ServiceTypeNodePort, corev1.ServiceTypeLoadBalancer:
+	default:
+		return errors.Newf("unsupported public service type %q", serviceType)
+	}
+
+	if len(s.LoadBalancerSourceRanges) > 0 && serviceType != corev1.ServiceTypeLoadBalancer {
+		return errors.Newf("loadBalancerSourceRanges needs the LoadBalancer type, not %s", serviceType)
+	}
+	for _, cidr := range s.LoadBalancerSourceRanges {
+		if _, _, err := net.ParseCIDR(cidr); err != nil {
+			return errors.Wrapf(err, "invalid load balancer source range %q", cidr)
+		}
+	}
+
+	if s.ExternalTrafficPolicy != "" && serviceType == corev1.ServiceTypeClusterIP {
+		return errors.New("externalTrafficPolicy needs the NodePort or LoadBalancer type")
+	}
+	switch s.ExternalTrafficPolicy {
+	case "", corev1.ServiceExternalTrafficPolicyTypeCluster, corev1.ServiceExternalTrafficPolicyTypeLocal:
+	default:
+		return errors.Newf("unsupported external traffic policy %q", s.ExternalTrafficPolicy)
+	}
+
+	if s.ExternalDNS != nil {
+		if err := s.ExternalDNS.Validate(); err != nil {
+			return errors.Wrap(err, "invalid externalDNS")
+		}
+	}
+	return nil
+}
+
+// TypeOrDefault returns the type of the public service.
+func (s *PublicService) TypeOrDefault() corev1.ServiceType {
+	if s == nil || s.Type == "" {
+		return corev1.ServiceTypeClusterIP
+	}
+	return s.Type
+}
+
+// ExternalTrafficPolicyOrDefault returns how the traffic from outside the
+// Kubernetes cluster is routed, or an empty policy for a ClusterIP service.
+func (s *PublicService) ExternalTrafficPolicyOrDefault() corev1.ServiceExternalTrafficPolicyType {
+	if s.TypeOrDefault() == corev1.ServiceTypeClusterIP {
+		return ""
+	}
+	if s.ExternalTrafficPolicy == "" {
+		return corev1.ServiceExternalTrafficPolicyTypeCluster
+	}
+	return s.ExternalTrafficPolicy
+}
+
+// regionPattern matches the regions that can be part of the name of a
+// service.
+var regionPattern = regexp.MustCompile(`^[a-z0-9]([-a-z0-9]*[a-z0-9])?$`)
+
+// Validate checks that the hostnames are set, and that each region is listed
+// once, with a name that can be part of the name of its service.
+func (d *ExternalDNS) Validate() error {
+	if len(d.Hostnames) == 0 && len(d.Regions) == 0 {
+		return errors.New("neither hostnames nor regions are set")
+	}
+	if err := validateHostnames(d.Hostnames); err != nil {
+		return err
+	}
+	if d.TTL != nil && *d.TTL < 1 {
+		return errors.Newf("the TTL must be positive, not %d", *d.TTL)
+	}
+
+	regions := make(map[string]bool, len(d.Regions))
+	for _, region := range d.Regions {
+		if !regionPattern.MatchString(region.Region) {
+			return errors.Newf("region %q must be lowercase alphanumeric characters or '-'", region.Region)
+		}
+		if regions[region.Region] {
+			return errors.Newf("region %q is listed more than once", region.Region)
+		}
+		regions[region.Region] = true
+
+		if len(region.Hostnames) == 0 {
+			return errors.Newf("region %q has no hostnames", region.Region)
+		}
+		if err := validateHostnames(region.Hostnames); err != nil {
+			return errors.Wrapf(err, "region %q", region.Region)
+		}
+	}
+	return nil
+}
+
+// RegionHostnames returns the hostnames of the region, nil if it has none.
+func (d *ExternalDNS) RegionHostnames(region string) []string {
+	if d == nil {
+		return nil
+	}
+	for _, r := range d.Regions {
+		if r.Region == region {
+			return r.Hostnames
+		}
+	}
+	return nil
+}
+
+func validateHostnames(hostnames []string) error {
+	for _, hostname := range hostnames {
+		if hostname == "" || strings.ContainsAny(hostname, ", ") {
+			return errors.Newf("invalid hostname %q", hostname)
+		}
+	}
+	return nil
+}
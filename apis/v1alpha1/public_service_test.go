@@ -0,0 +1,153 @@
+/*
+Copyright 2021 The Cockroach Authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    https://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package v1alpha1
+
+import (
+	"testing"
+
+	"github.com/cockroachdb/cockroach-operator/pkg/ptr"
+	"github.com/stretchr/testify/require"
+	corev1 "k8s.io/api/core/v1"
+)
+
+func TestPublicServiceDefaults(t *testing.T) {
+	var unset *PublicService
+	require.Equal(t, corev1.ServiceTypeClusterIP, unset.TypeOrDefault())
+	require.Empty(t, unset.ExternalTrafficPolicyOrDefault())
+
+	lb := &PublicService{Type: corev1.ServiceTypeLoadBalancer}
+	require.Equal(t, corev1.ServiceExternalTrafficPolicyTypeCluster, lb.ExternalTrafficPolicyOrDefault())
+	lb.ExternalTrafficPolicy = corev1.ServiceExternalTrafficPolicyTypeLocal
+	require.Equal(t, corev1.ServiceExternalTrafficPolicyTypeLocal, lb.ExternalTrafficPolicyOrDefault())
+}
+
+func TestExternalDNSRegionHostnames(t *testing.T) {
+	var unset *ExternalDNS
+	require.Nil(t, unset.RegionHostnames("us-east1"))
+
+	dns := &ExternalDNS{Regions: []RegionHostnames{
+		{Region: "us-east1", Hostnames: []string{"east.example.com"}},
+	}}
+	require.Equal(t, []string{"east.example.com"}, dns.RegionHostnames("us-east1"))
+	require.Nil(t, dns.RegionHostnames("us-west1"))
+}
+
+func TestPublicServiceValidate(t *testing.T) {
+	tests := []struct {
+		name    string
+		service PublicService
+		err     string
+	}{
+		{
+			name:    "accepts the default",
+			service: PublicService{},
+		},
+		{
+			name: "accepts a load balancer",
+			service: PublicService{
+				Type:                     corev1.ServiceTypeLoadBalancer,
+				LoadBalancerSourceRanges: []string{"10.0.0.0/8", "192.168.1.0/24"},
+				ExternalTrafficPolicy:    corev1.ServiceExternalTrafficPolicyTypeLocal,
+			},
+		},
+		{
+			name:    "rejects an unsupported type",
+			service: PublicService{Type: corev1.ServiceTypeExternalName},
+			err:     `unsupported public service type "ExternalName"`,
+		},
+		{
+			name: "rejects source ranges without a load balancer",
+			service: PublicService{
+				Type:                     corev1.ServiceTypeNodePort,
+				LoadBalancerSourceRanges: []string{"10.0.0.0/8"},
+			},
+			err: "loadBalancerSourceRanges needs the LoadBalancer type, not NodePort",
+		},
+		{
+			name: "rejects an invalid source range",
+			service: PublicService{
+				Type:                     corev1.ServiceTypeLoadBalancer,
+				LoadBalancerSourceRanges: []string{"10.0.0.1"},
+			},
+			err: `invalid load balancer source range "10.0.0.1"`,
+		},
+		{
+			name:    "rejects a traffic policy of a ClusterIP service",
+			service: PublicService{ExternalTrafficPolicy: corev1.ServiceExternalTrafficPolicyTypeLocal},
+			err:     "externalTrafficPolicy needs the NodePort or LoadBalancer type",
+		},
+		{
+			name: "accepts the hostnames of the service and of the regions",
+			service: PublicService{
+				Type: corev1.ServiceTypeLoadBalancer,
+				ExternalDNS: &ExternalDNS{
+					Hostnames: []string{"db.example.com"},
+					TTL:       ptr.Int32(60),
+					Regions: []RegionHostnames{
+						{Region: "us-east1", Hostnames: []string{"us-east1.db.example.com"}},
+					},
+				},
+			},
+		},
+		{
+			name:    "rejects externalDNS without hostnames",
+			service: PublicService{ExternalDNS: &ExternalDNS{TTL: ptr.Int32(60)}},
+			err:     "invalid externalDNS: neither hostnames nor regions are set",
+		},
+		{
+			name:    "rejects a list of hostnames in a hostname",
+			service: PublicService{ExternalDNS: &ExternalDNS{Hostnames: []string{"a.example.com,b.example.com"}}},
+			err:     `invalid hostname "a.example.com,b.example.com"`,
+		},
+		{
+			name: "rejects a region that cannot name a service",
+			service: PublicService{ExternalDNS: &ExternalDNS{
+				Regions: []RegionHostnames{{Region: "US_East", Hostnames: []string{"east.example.com"}}},
+			}},
+			err: `region "US_East" must be lowercase alphanumeric characters or '-'`,
+		},
+		{
+			name: "rejects a region listed twice",
+			service: PublicService{ExternalDNS: &ExternalDNS{
+				Regions: []RegionHostnames{
+					{Region: "us-east1", Hostnames: []string{"east.example.com"}},
+					{Region: "us-east1", Hostnames: []string{"east2.example.com"}},
+				},
+			}},
+			err: `region "us-east1" is listed more than once`,
+		},
+		{
+			name: "rejects a region without hostnames",
+			service: PublicService{ExternalDNS: &ExternalDNS{
+				Regions: []RegionHostnames{{Region: "us-east1"}},
+			}},
+			err: `region "us-east1" has no hostnames`,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := tt.service.Validate()
+			if tt.err == "" {
+				require.NoError(t, err)
+			} else {
+				require.Error(t, err)
+				require.Contains(t, err.Error(), tt.err)
+			}
+		})
+	}
+}
@@ -0,0 +1,39 @@
+/*
+Copyright 2021 The Cockroach Authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    https://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package v1alpha1
+
+//DefaultVirtualCluster is the virtual cluster CockroachDB creates for the
+//application data of a virtualized cluster
+const DefaultVirtualCluster = "main"
+
+//VirtualClusterName returns the name of the virtual cluster of the standby the
+//stream is replicated into
+func (s *ReplicationSource) VirtualClusterName() string {
+	if s.VirtualCluster == "" {
+		return DefaultVirtualCluster
+	}
+	return s.VirtualCluster
+}
+
+//SourceVirtualClusterName returns the name of the virtual cluster of the
+//primary cluster to replicate
+func (s *ReplicationSource) SourceVirtualClusterName() string {
+	if s.SourceVirtualCluster == "" {
+		return DefaultVirtualCluster
+	}
+	return s.SourceVirtualCluster
+}
@@ -0,0 +1,34 @@
+/*
+Copyright 2021 The Cockroach Authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    https://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package v1alpha1_test
+
+import (
+	"testing"
+
+	api "github.com/cockroachdb/cockroach-operator/apis/v1alpha1"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestReplicationSourceVirtualClusters(t *testing.T) {
+	source := api.ReplicationSource{}
+	assert.Equal(t, "main", source.VirtualClusterName())
+	assert.Equal(t, "main", source.SourceVirtualClusterName())
+
+	source = api.ReplicationSource{SourceVirtualCluster: "app", VirtualCluster: "app-standby"}
+	assert.Equal(t, "app-standby", source.VirtualClusterName())
+	assert.Equal(t, "app", source.SourceVirtualClusterName())
+}
@@ -0,0 +1,78 @@
+/*
+Copyright 2021 The Cockroach Authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    https://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package v1alpha1
+
+// OperationType is an operation that can be requested with the
+// crdb.io/operation annotation
+type OperationType string
+
+const (
+	//OperationRollingRestart restarts the pods one at a time
+	OperationRollingRestart OperationType = "RollingRestart"
+	//OperationBackup takes a full backup of the cluster into its backup volume
+	OperationBackup OperationType = "Backup"
+	//OperationRotateCerts issues new node and client certificates signed by
+	//the CA of the cluster and restarts the pods to load them
+	OperationRotateCerts OperationType = "RotateCerts"
+	//OperationRotateCA replaces the CA of the cluster with a new one, restarting
+	//the pods once the nodes trust both, once the certificates are signed by
+	//the new CA and once the old CA is retired
+	OperationRotateCA OperationType = "RotateCA"
+	//OperationReplaceNode replaces the pod of the given ordinal with an empty
+	//store
+	OperationReplaceNode OperationType = "ReplaceNode"
+	//OperationDecommissionNode decommissions the node of the pod of the given
+	//ordinal, then replaces the pod with an empty store that joins as a new
+	//node
+	OperationDecommissionNode OperationType = "DecommissionNode"
+)
+
+// OperationTypes are all the operations that can be requested
+var OperationTypes = []OperationType{OperationRollingRestart, OperationBackup, OperationRotateCerts, OperationRotateCA, OperationReplaceNode, OperationDecommissionNode}
+
+// OperationState is the state of a requested operation
+type OperationState string
+
+const (
+	//OperationRunning the operation started
+	OperationRunning OperationState = "Running"
+	//OperationSucceeded the operation is over
+	OperationSucceeded OperationState = "Succeeded"
+	//OperationFailed the operation could not start or failed
+	OperationFailed OperationState = "Failed"
+)
+
+// CARotationPhase is the phase of the rotation of the CA of a cluster
+type CARotationPhase string
+
+const (
+	//CARotationTrustBundle the nodes load a bundle of the old and the new CA
+	//certificates
+	CARotationTrustBundle CARotationPhase = "TrustBundle"
+	//CARotationReissue the node and client certificates are signed by the new CA
+	CARotationReissue CARotationPhase = "Reissue"
+	//CARotationRetireOldCA the old CA certificate is removed from the bundle
+	CARotationRetireOldCA CARotationPhase = "RetireOldCA"
+)
+
+// CARotationPhases are the phases of the rotation of a CA, in order
+var CARotationPhases = []CARotationPhase{CARotationTrustBundle, CARotationReissue, CARotationRetireOldCA}
+
+// Done returns whether the operation is over, successfully or not
+func (o *RequestedOperation) Done() bool {
+	return o != nil && (o.State == OperationSucceeded || o.State == OperationFailed)
+}
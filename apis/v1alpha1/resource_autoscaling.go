@@ -0,0 +1,148 @@
+/*
+Copyright 2021 The Cockroach Authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    https://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package v1alpha1
+
+import (
+	"math"
+	"time"
+
+	"github.com/cockroachdb/errors"
+	corev1 "k8s.io/api/core/v1"
+	apiresource "k8s.io/apimachinery/pkg/api/resource"
+)
+
+const (
+	defaultTargetUtilization = 70
+	defaultResizeDownDelay   = 6 * time.Hour
+	// resourceTolerance is how far the recommended requests can be from the
+	// current ones, as a fraction of them, before the pods are resized
+	resourceTolerance = 0.1
+	// the recommended requests are rounded up to these steps, so that small
+	// changes of the usage do not show in the spec
+	cpuStepMilli = 100
+	memoryStep   = 64 << 20
+)
+
+// autoscaledResources are the resources the requests of which can be
+// autoscaled
+var autoscaledResources = []corev1.ResourceName{corev1.ResourceCPU, corev1.ResourceMemory}
+
+// Validate checks that only the CPU and memory are bounded, and that their
+// bounds are consistent.
+func (a *ResourceAutoscaling) Validate() error {
+	for _, bounds := range []corev1.ResourceList{a.MinAllowed, a.MaxAllowed} {
+		for name := range bounds {
+			if name != corev1.ResourceCPU && name != corev1.ResourceMemory {
+				return errors.Newf("resource %s cannot be autoscaled", name)
+			}
+		}
+	}
+
+	for _, name := range autoscaledResources {
+		min, hasMin := a.MinAllowed[name]
+		max, hasMax := a.MaxAllowed[name]
+		if hasMin != hasMax {
+			return errors.Newf("%s must be set in both minAllowed and maxAllowed", name)
+		}
+		if hasMin && min.Cmp(max) > 0 {
+			return errors.Newf("minAllowed %s must not be greater than maxAllowed", name)
+		}
+	}
+	return nil
+}
+
+// TargetUtilizationOrDefault returns the percentage of the requests the peak
+// usage of the pods is kept at.
+func (a *ResourceAutoscaling) TargetUtilizationOrDefault() int32 {
+	if a.TargetUtilization == nil {
+		return defaultTargetUtilization
+	}
+	return *a.TargetUtilization
+}
+
+// ResizeDownDelayOrDefault returns how long the usage is observed after the
+// pods were last resized before their requests are lowered.
+func (a *ResourceAutoscaling) ResizeDownDelayOrDefault() time.Duration {
+	if a.ResizeDownDelay == nil {
+		return defaultResizeDownDelay
+	}
+	return a.ResizeDownDelay.Duration
+}
+
+// Recommend returns the requests that bring the peak usage to the target
+// utilization, within the bounds, for every autoscaled resource measured.
+func (a *ResourceAutoscaling) Recommend(peak corev1.ResourceList) corev1.ResourceList {
+	target := float64(a.TargetUtilizationOrDefault())
+	recommended := corev1.ResourceList{}
+	for _, name := range autoscaledResources {
+		usage, measured := peak[name]
+		min, bounded := a.MinAllowed[name]
+		if !measured || !bounded {
+			continue
+		}
+
+		var request *apiresource.Quantity
+		if name == corev1.ResourceCPU {
+			milli := roundUp(float64(usage.MilliValue())*100/target, cpuStepMilli)
+			request = apiresource.NewMilliQuantity(milli, apiresource.DecimalSI)
+		} else {
+			bytes := roundUp(float64(usage.Value())*100/target, memoryStep)
+			request = apiresource.NewQuantity(bytes, apiresource.BinarySI)
+		}
+
+		if max := a.MaxAllowed[name]; request.Cmp(max) > 0 {
+			recommended[name] = max.DeepCopy()
+		} else if request.Cmp(min) < 0 {
+			recommended[name] = min.DeepCopy()
+		} else {
+			recommended[name] = *request
+		}
+	}
+	return recommended
+}
+
+// NextRequests returns the requests the pods are resized to from the current
+// ones, and whether they differ. The requests the recommendation raises beyond
+// the tolerance are raised right away, while the ones it lowers beyond the
+// tolerance are only lowered when lower is set.
+func NextRequests(current, recommended corev1.ResourceList, lower bool) (corev1.ResourceList, bool) {
+	next := current.DeepCopy()
+	if next == nil {
+		next = corev1.ResourceList{}
+	}
+
+	changed := false
+	for name, want := range recommended {
+		have, ok := current[name]
+		if !ok {
+			next[name] = want.DeepCopy()
+			changed = true
+			continue
+		}
+
+		ratio := float64(want.MilliValue()) / float64(have.MilliValue())
+		if ratio > 1+resourceTolerance || (lower && ratio < 1-resourceTolerance) {
+			next[name] = want.DeepCopy()
+			changed = true
+		}
+	}
+	return next, changed
+}
+
+func roundUp(value float64, step int64) int64 {
+	return int64(math.Ceil(value/float64(step))) * step
+}
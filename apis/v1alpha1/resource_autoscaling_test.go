@@ -0,0 +1,192 @@
+/*
+Copyright 2021 The Cockroach Authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    https://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package v1alpha1_test
+
+import (
+	"testing"
+	"time"
+
+	. "github.com/cockroachdb/cockroach-operator/apis/v1alpha1"
+	"github.com/stretchr/testify/require"
+	corev1 "k8s.io/api/core/v1"
+	apiresource "k8s.io/apimachinery/pkg/api/resource"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+func resources(cpu, memory string) corev1.ResourceList {
+	list := corev1.ResourceList{}
+	if cpu != "" {
+		list[corev1.ResourceCPU] = apiresource.MustParse(cpu)
+	}
+	if memory != "" {
+		list[corev1.ResourceMemory] = apiresource.MustParse(memory)
+	}
+	return list
+}
+
+func TestResourceAutoscalingValidate(t *testing.T) {
+	tests := []struct {
+		name        string
+		autoscaling ResourceAutoscaling
+		expected    string
+	}{
+		{
+			name:        "valid bounds",
+			autoscaling: ResourceAutoscaling{MinAllowed: resources("1", "4Gi"), MaxAllowed: resources("4", "16Gi")},
+		},
+		{
+			name:        "minimum above the maximum",
+			autoscaling: ResourceAutoscaling{MinAllowed: resources("8", "4Gi"), MaxAllowed: resources("4", "16Gi")},
+			expected:    "minAllowed cpu must not be greater than maxAllowed",
+		},
+		{
+			name:        "missing maximum",
+			autoscaling: ResourceAutoscaling{MinAllowed: resources("1", "4Gi"), MaxAllowed: resources("4", "")},
+			expected:    "memory must be set in both minAllowed and maxAllowed",
+		},
+		{
+			name: "unsupported resource",
+			autoscaling: ResourceAutoscaling{
+				MinAllowed: corev1.ResourceList{corev1.ResourceEphemeralStorage: apiresource.MustParse("1Gi")},
+				MaxAllowed: corev1.ResourceList{corev1.ResourceEphemeralStorage: apiresource.MustParse("2Gi")},
+			},
+			expected: "resource ephemeral-storage cannot be autoscaled",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := tt.autoscaling.Validate()
+			if tt.expected == "" {
+				require.NoError(t, err)
+			} else {
+				require.EqualError(t, err, tt.expected)
+			}
+		})
+	}
+}
+
+func TestResourceAutoscalingDefaults(t *testing.T) {
+	unset := &ResourceAutoscaling{}
+	require.Equal(t, int32(70), unset.TargetUtilizationOrDefault())
+	require.Equal(t, 6*time.Hour, unset.ResizeDownDelayOrDefault())
+
+	target := int32(50)
+	set := &ResourceAutoscaling{TargetUtilization: &target, ResizeDownDelay: &metav1.Duration{Duration: time.Hour}}
+	require.Equal(t, int32(50), set.TargetUtilizationOrDefault())
+	require.Equal(t, time.Hour, set.ResizeDownDelayOrDefault())
+}
+
+func TestResourceAutoscalingRecommend(t *testing.T) {
+	target := int32(50)
+	autoscaling := &ResourceAutoscaling{
+		MinAllowed:        resources("500m", "2Gi"),
+		MaxAllowed:        resources("4", "16Gi"),
+		TargetUtilization: &target,
+	}
+
+	tests := []struct {
+		name     string
+		peak     corev1.ResourceList
+		expected corev1.ResourceList
+	}{
+		{
+			name:     "within the bounds, rounded up",
+			peak:     resources("730m", "3000Mi"),
+			expected: resources("1500m", "6016Mi"),
+		},
+		{
+			name:     "capped at the bounds",
+			peak:     resources("100m", "12Gi"),
+			expected: resources("500m", "16Gi"),
+		},
+		{
+			name:     "only the measured resources",
+			peak:     resources("1", ""),
+			expected: resources("2", ""),
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			recommended := autoscaling.Recommend(tt.peak)
+			require.Len(t, recommended, len(tt.expected))
+			for name, quantity := range tt.expected {
+				actual := recommended[name]
+				require.Zero(t, quantity.Cmp(actual), "%s: expected %s, got %s", name, quantity.String(), actual.String())
+			}
+		})
+	}
+}
+
+func TestNextRequests(t *testing.T) {
+	tests := []struct {
+		name        string
+		current     corev1.ResourceList
+		recommended corev1.ResourceList
+		lower       bool
+		expected    corev1.ResourceList
+		changed     bool
+	}{
+		{
+			name:        "within the tolerance",
+			current:     resources("2", "8Gi"),
+			recommended: resources("2100m", "7680Mi"),
+			expected:    resources("2", "8Gi"),
+		},
+		{
+			name:        "raised right away",
+			current:     resources("2", "8Gi"),
+			recommended: resources("3", "4Gi"),
+			expected:    resources("3", "8Gi"),
+			changed:     true,
+		},
+		{
+			name:        "lowered after the delay",
+			current:     resources("2", "8Gi"),
+			recommended: resources("3", "4Gi"),
+			lower:       true,
+			expected:    resources("3", "4Gi"),
+			changed:     true,
+		},
+		{
+			name:        "not lowered before the delay",
+			current:     resources("2", "8Gi"),
+			recommended: resources("1", "4Gi"),
+			expected:    resources("2", "8Gi"),
+		},
+		{
+			name:        "missing request",
+			current:     nil,
+			recommended: resources("1", ""),
+			expected:    resources("1", ""),
+			changed:     true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			next, changed := NextRequests(tt.current, tt.recommended, tt.lower)
+			require.Equal(t, tt.changed, changed)
+			require.Len(t, next, len(tt.expected))
+			for name, quantity := range tt.expected {
+				actual := next[name]
+				require.Zero(t, quantity.Cmp(actual), "%s: expected %s, got %s", name, quantity.String(), actual.String())
+			}
+		})
+	}
+}
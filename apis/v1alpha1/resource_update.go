@@ -0,0 +1,115 @@
+/*
+Copyright 2021 The Cockroach Authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    https://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package v1alpha1
+
+import (
+	"time"
+
+	"github.com/cockroachdb/errors"
+)
+
+const week = 7 * 24 * time.Hour
+
+// defaultResizePodTimeout is how long a resized pod can take to become ready
+// when the spec does not set it.
+const defaultResizePodTimeout = 10 * time.Minute
+
+var weekdays = map[string]time.Weekday{
+	"Sun": time.Sunday,
+	"Mon": time.Monday,
+	"Tue": time.Tuesday,
+	"Wed": time.Wednesday,
+	"Thu": time.Thursday,
+	"Fri": time.Friday,
+	"Sat": time.Saturday,
+}
+
+// PodTimeoutOrDefault returns how long a resized pod can take to have the new
+// resources and become ready.
+func (s *ResourceUpdateStrategy) PodTimeoutOrDefault() time.Duration {
+	if s == nil || s.PodTimeout == nil {
+		return defaultResizePodTimeout
+	}
+	return s.PodTimeout.Duration
+}
+
+// UntilMaintenanceWindow returns how long to wait from now before a resize can
+// start. It is zero when now is within one of the maintenance windows or when
+// there are none.
+func (s *ResourceUpdateStrategy) UntilMaintenanceWindow(now time.Time) (time.Duration, error) {
+	if s == nil || len(s.MaintenanceWindows) == 0 {
+		return 0, nil
+	}
+
+	var wait time.Duration
+	for i, w := range s.MaintenanceWindows {
+		d, err := w.until(now.UTC())
+		if err != nil {
+			return 0, err
+		}
+		if d == 0 {
+			return 0, nil
+		}
+		if i == 0 || d < wait {
+			wait = d
+		}
+	}
+
+	return wait, nil
+}
+
+// until returns how long to wait from now until the window opens, or zero if it
+// is open.
+func (w MaintenanceWindow) until(now time.Time) (time.Duration, error) {
+	start, err := time.Parse("15:04", w.Start)
+	if err != nil {
+		return 0, errors.Wrapf(err, "invalid start of maintenance window %q", w.Start)
+	}
+
+	duration := w.Duration.Duration
+	if duration <= 0 || duration > week {
+		return 0, errors.Newf("invalid duration of maintenance window %s, it must be positive and at most a week", duration)
+	}
+
+	days := make(map[time.Weekday]bool, len(w.Days))
+	for _, day := range w.Days {
+		weekday, ok := weekdays[day]
+		if !ok {
+			return 0, errors.Newf("invalid day of maintenance window %q", day)
+		}
+		days[weekday] = true
+	}
+
+	// a window that opened up to a week ago can still be open, and the next
+	// one opens within a week
+	midnight := time.Date(now.Year(), now.Month(), now.Day(), 0, 0, 0, 0, time.UTC)
+	for i := -7; i <= 7; i++ {
+		opens := midnight.AddDate(0, 0, i).Add(time.Duration(start.Hour())*time.Hour + time.Duration(start.Minute())*time.Minute)
+		if len(days) > 0 && !days[opens.Weekday()] {
+			continue
+		}
+
+		if opens.After(now) {
+			return opens.Sub(now), nil
+		}
+		if now.Before(opens.Add(duration)) {
+			return 0, nil
+		}
+	}
+
+	return 0, errors.Newf("maintenance window starting at %s never opens", w.Start)
+}
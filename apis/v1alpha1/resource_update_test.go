@@ -0,0 +1,86 @@
+/*
+Copyright 2021 The Cockroach Authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    https://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package v1alpha1_test
+
+import (
+	"testing"
+	"time"
+
+	api "github.com/cockroachdb/cockroach-operator/apis/v1alpha1"
+	"github.com/stretchr/testify/require"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+func TestResizePodTimeoutOrDefault(t *testing.T) {
+	var none *api.ResourceUpdateStrategy
+	require.Equal(t, 10*time.Minute, none.PodTimeoutOrDefault())
+
+	strategy := &api.ResourceUpdateStrategy{PodTimeout: &metav1.Duration{Duration: 30 * time.Minute}}
+	require.Equal(t, 30*time.Minute, strategy.PodTimeoutOrDefault())
+}
+
+func TestUntilMaintenanceWindow(t *testing.T) {
+	// a Wednesday
+	now := time.Date(2021, time.June, 2, 10, 30, 0, 0, time.UTC)
+
+	window := func(start string, duration time.Duration, days ...string) api.MaintenanceWindow {
+		return api.MaintenanceWindow{Start: start, Duration: metav1.Duration{Duration: duration}, Days: days}
+	}
+
+	tests := []struct {
+		name    string
+		windows []api.MaintenanceWindow
+		wait    time.Duration
+		err     string
+	}{
+		{name: "no window"},
+		{name: "open window", windows: []api.MaintenanceWindow{window("10:00", time.Hour)}},
+		{name: "later today", windows: []api.MaintenanceWindow{window("22:00", time.Hour)}, wait: 11*time.Hour + 30*time.Minute},
+		{name: "tomorrow", windows: []api.MaintenanceWindow{window("09:00", time.Hour)}, wait: 22*time.Hour + 30*time.Minute},
+		{name: "open since yesterday", windows: []api.MaintenanceWindow{window("23:00", 12*time.Hour)}},
+		{name: "on saturdays", windows: []api.MaintenanceWindow{window("01:00", 4*time.Hour, "Sat")}, wait: 2*24*time.Hour + 14*time.Hour + 30*time.Minute},
+		{name: "open since saturday", windows: []api.MaintenanceWindow{window("00:00", 5*24*time.Hour, "Sat")}},
+		{
+			name:    "closest window",
+			windows: []api.MaintenanceWindow{window("01:00", time.Hour, "Sun"), window("12:00", time.Hour, "Mon", "Wed")},
+			wait:    90 * time.Minute,
+		},
+		{name: "invalid start", windows: []api.MaintenanceWindow{window("25:00", time.Hour)}, err: `invalid start of maintenance window "25:00"`},
+		{name: "invalid duration", windows: []api.MaintenanceWindow{window("10:00", 0)}, err: "invalid duration of maintenance window 0s"},
+		{name: "invalid day", windows: []api.MaintenanceWindow{window("10:00", time.Hour, "Someday")}, err: `invalid day of maintenance window "Someday"`},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			strategy := &api.ResourceUpdateStrategy{MaintenanceWindows: tt.windows}
+			wait, err := strategy.UntilMaintenanceWindow(now)
+			if tt.err != "" {
+				require.Error(t, err)
+				require.Contains(t, err.Error(), tt.err)
+				return
+			}
+
+			require.NoError(t, err)
+			require.Equal(t, tt.wait, wait)
+		})
+	}
+
+	var none *api.ResourceUpdateStrategy
+	wait, err := none.UntilMaintenanceWindow(now)
+	require.NoError(t, err)
+	require.Zero(t, wait)
+}
@@ -0,0 +1,164 @@
+/*
+Copyright 2021 The Cockroach Authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    https://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package v1alpha1
+
+import (
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+//RestorePhase is the phase of the restore of a CrdbRestore
+type RestorePhase string
+
+const (
+	//RestorePending the restore waits for the cluster to be ready or for the URI of the collection
+	RestorePending RestorePhase = "Pending"
+	//RestoreRunning the RESTORE job is running
+	RestoreRunning RestorePhase = "Running"
+	//RestoreSucceeded the RESTORE job succeeded
+	RestoreSucceeded RestorePhase = "Succeeded"
+	//RestoreFailed the restore could not start or its job failed
+	RestoreFailed RestorePhase = "Failed"
+)
+
+// Condition types of the status of a CrdbRestore.
+const (
+	//RestoreClusterReady is true once the cluster is initialized and answers SQL queries
+	RestoreClusterReady = "ClusterReady"
+	//RestoreRestoring is true while the RESTORE job is running
+	RestoreRestoring = "Restoring"
+	//RestoreComplete is true once the RESTORE job succeeded
+	RestoreComplete = "Complete"
+	//RestoreFailedCondition is true when the restore could not start or its job failed
+	RestoreFailedCondition = "Failed"
+)
+
+// +k8s:openapi-gen=true
+// +k8s:deepcopy-gen=true
+
+// CrdbRestoreSpec defines a restore of a backup into a cluster
+type CrdbRestoreSpec struct {
+	// ClusterName is the name of the CrdbCluster, in the namespace of the
+	// restore, to restore into. The restore waits until the cluster is ready,
+	// so the cluster can be created along with the restore
+	// +required
+	ClusterName string `json:"clusterName"`
+	// (Optional) URI is the URI of the backup collection, in the format of the
+	// CockroachDB RESTORE statement. For instance: s3://bucket/path?AUTH=implicit
+	// +optional
+	URI string `json:"uri,omitempty"`
+	// (Optional) URISecretRef selects the key of a secret holding the URI of the
+	// backup collection, for URIs with credentials. It takes precedence over URI
+	// +optional
+	URISecretRef *corev1.SecretKeySelector `json:"uriSecretRef,omitempty"`
+	// (Optional) Backup is the path of the backup in the collection to restore.
+	// For instance: 2021/06/01-120000.00
+	// Default: the latest backup of the collection
+	// +optional
+	Backup string `json:"backup,omitempty"`
+	// (Optional) AsOf restores the data as it was at this time, from the end of
+	// the full backup to the end of its last incremental backup. The times
+	// between the ends of the backups need a backup taken with its revision
+	// history
+	// Default: the end of the last backup
+	// +optional
+	AsOf *metav1.Time `json:"asOf,omitempty"`
+	// (Optional) Databases are the databases to restore. They must not exist in
+	// the cluster
+	// Default: the whole cluster is restored, the cluster must have no user data
+	// +optional
+	Databases []string `json:"databases,omitempty"`
+	// (Optional) Tables are the qualified names of the tables to restore, such
+	// as movr.public.rides. It cannot be set with Databases
+	// +optional
+	Tables []string `json:"tables,omitempty"`
+	// (Optional) IntoDB is the existing database the tables are restored into,
+	// instead of their original database
+	// +optional
+	IntoDB string `json:"intoDB,omitempty"`
+}
+
+// +k8s:openapi-gen=true
+// +k8s:deepcopy-gen=true
+
+// CrdbRestoreStatus is the observed state of the restore
+type CrdbRestoreStatus struct {
+	// Phase of the restore
+	Phase RestorePhase `json:"phase,omitempty"`
+	// Conditions are the readiness of the cluster and the progress of the
+	// restore
+	Conditions []metav1.Condition `json:"conditions,omitempty"`
+	// Backup is the path of the restored backup in the collection
+	Backup string `json:"backup,omitempty"`
+	// (Optional) AsOf restores the data as it was at this time, from the end of
+	// the full backup to the end of its last incremental backup. The times
+	// between the ends of the backups need a backup taken with its revision
+	// history
+	// Default: the end of the last backup
+	// +optional
+	AsOf *metav1.Time `json:"asOf,omitempty"`
+	// JobID is the ID of the RESTORE job
+	JobID int64 `json:"jobID,omitempty"`
+	// Progress is the percentage of the restore that is done
+	Progress int32 `json:"progress,omitempty"`
+	// StartTime is when the RESTORE job started
+	StartTime *metav1.Time `json:"startTime,omitempty"`
+	// CompletionTime is when the RESTORE job succeeded or failed
+	CompletionTime *metav1.Time `json:"completionTime,omitempty"`
+}
+
+//Finished returns whether the restore succeeded or failed
+func (s CrdbRestoreStatus) Finished() bool {
+	return s.Phase == RestoreSucceeded || s.Phase == RestoreFailed
+}
+
+// +genclient
+// +k8s:deepcopy-gen:interfaces=k8s.io/apimachinery/pkg/runtime.Object
+// +k8s:deepcopy-gen=true
+// +kubebuilder:object:root=true
+// +kubebuilder:resource:categories=all;cockroachdb
+// +kubebuilder:subresource:status
+// +kubebuilder:printcolumn:name="Cluster",type=string,JSONPath=`.spec.clusterName`
+// +kubebuilder:printcolumn:name="Phase",type=string,JSONPath=`.status.phase`
+// +kubebuilder:printcolumn:name="Progress",type=integer,JSONPath=`.status.progress`
+// +kubebuilder:printcolumn:name="Age",type=date,JSONPath=`.metadata.creationTimestamp`
+// +k8s:openapi-gen=true
+
+// CrdbRestore restores a backup, or some of its databases or tables, into a
+// cluster once it is ready
+type CrdbRestore struct {
+	metav1.TypeMeta   `json:",inline"`
+	metav1.ObjectMeta `json:"metadata,omitempty"`
+
+	Spec   CrdbRestoreSpec   `json:"spec,omitempty"`
+	Status CrdbRestoreStatus `json:"status,omitempty"`
+}
+
+// +k8s:deepcopy-gen:interfaces=k8s.io/apimachinery/pkg/runtime.Object
+// +k8s:deepcopy-gen=true
+// +kubebuilder:object:root=true
+
+// CrdbRestoreList contains a list of CrdbRestore
+type CrdbRestoreList struct {
+	metav1.TypeMeta `json:",inline"`
+	metav1.ListMeta `json:"metadata,omitempty"`
+	Items           []CrdbRestore `json:"items"`
+}
+
+func init() {
+	SchemeBuilder.Register(&CrdbRestore{}, &CrdbRestoreList{})
+}
@@ -0,0 +1,97 @@
+/*
+Copyright 2021 The Cockroach Authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    https://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package v1alpha1
+
+import (
+	"time"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// maxRetryBackoff caps the time between two retries of a failed action.
+const maxRetryBackoff = 10 * time.Minute
+
+// defaultRetryPolicies are used for the reasons without a retry policy in the
+// spec, and for the fields a retry policy of the spec leaves unset.
+var defaultRetryPolicies = map[FailureReason]RetryPolicy{
+	// the image can be pushed, or the pull secret fixed, at any time
+	ImagePullBackOffReason:    newRetryPolicy(ImagePullBackOffReason, -1, time.Minute),
+	InitTimeoutReason:         newRetryPolicy(InitTimeoutReason, 3, 30*time.Second),
+	DecommissionStalledReason: newRetryPolicy(DecommissionStalledReason, 5, 5*time.Minute),
+	CertErrorReason:           newRetryPolicy(CertErrorReason, 5, 10*time.Second),
+}
+
+// unknownRetryPolicy is used for the reasons without a default retry policy.
+var unknownRetryPolicy = newRetryPolicy("", 0, 0)
+
+func newRetryPolicy(reason FailureReason, maxRetries int32, backoff time.Duration) RetryPolicy {
+	return RetryPolicy{
+		Reason:     reason,
+		MaxRetries: &maxRetries,
+		Backoff:    &metav1.Duration{Duration: backoff},
+	}
+}
+
+// RetryPolicyFor returns the retry policy of the given failure reason, with the
+// fields that are not set in the spec taken from the default policy.
+func (s *CrdbClusterSpec) RetryPolicyFor(reason FailureReason) RetryPolicy {
+	policy, ok := defaultRetryPolicies[reason]
+	if !ok {
+		policy = unknownRetryPolicy
+		policy.Reason = reason
+	}
+
+	for _, p := range s.RetryPolicies {
+		if p.Reason != reason {
+			continue
+		}
+		if p.MaxRetries != nil {
+			policy.MaxRetries = p.MaxRetries
+		}
+		if p.Backoff != nil {
+			policy.Backoff = p.Backoff
+		}
+	}
+
+	return policy
+}
+
+// RetryAfter returns how long to wait before the given retry of a failed
+// action, counting from 1, and false if the policy allows no more retries.
+// The backoff doubles at each retry, up to 10 minutes.
+func (p RetryPolicy) RetryAfter(retry int32) (time.Duration, bool) {
+	maxRetries := int32(0)
+	if p.MaxRetries != nil {
+		maxRetries = *p.MaxRetries
+	}
+	if retry < 1 || (maxRetries >= 0 && retry > maxRetries) {
+		return 0, false
+	}
+
+	var wait time.Duration
+	if p.Backoff != nil {
+		wait = p.Backoff.Duration
+	}
+	for i := int32(1); i < retry && wait < maxRetryBackoff; i++ {
+		wait *= 2
+	}
+	if wait > maxRetryBackoff {
+		wait = maxRetryBackoff
+	}
+
+	return wait, true
+}
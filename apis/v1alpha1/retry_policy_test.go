@@ -0,0 +1,61 @@
+/*
+Copyright 2021 The Cockroach Authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    https://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package v1alpha1_test
+
+import (
+	"testing"
+	"time"
+
+	. "github.com/cockroachdb/cockroach-operator/apis/v1alpha1"
+	"github.com/stretchr/testify/require"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+func TestRetryPolicy(t *testing.T) {
+	three := int32(3)
+	spec := &CrdbClusterSpec{
+		RetryPolicies: []RetryPolicy{
+			{Reason: CertErrorReason, MaxRetries: &three},
+			{Reason: ImagePullBackOffReason, Backoff: &metav1.Duration{Duration: 4 * time.Minute}},
+		},
+	}
+
+	tests := []struct {
+		name   string
+		reason FailureReason
+		retry  int32
+		wait   time.Duration
+		ok     bool
+	}{
+		{name: "default policy", reason: InitTimeoutReason, retry: 1, wait: 30 * time.Second, ok: true},
+		{name: "backoff doubles", reason: InitTimeoutReason, retry: 3, wait: 2 * time.Minute, ok: true},
+		{name: "no retries left", reason: InitTimeoutReason, retry: 4},
+		{name: "max retries from the spec", reason: CertErrorReason, retry: 4},
+		{name: "backoff from the default policy", reason: CertErrorReason, retry: 2, wait: 20 * time.Second, ok: true},
+		{name: "backoff is capped", reason: ImagePullBackOffReason, retry: 3, wait: 10 * time.Minute, ok: true},
+		{name: "retries forever", reason: ImagePullBackOffReason, retry: 1000, wait: 10 * time.Minute, ok: true},
+		{name: "unknown reason", reason: "Other", retry: 1},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			wait, ok := spec.RetryPolicyFor(tt.reason).RetryAfter(tt.retry)
+			require.Equal(t, tt.ok, ok)
+			require.Equal(t, tt.wait, wait)
+		})
+	}
+}
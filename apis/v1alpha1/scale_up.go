@@ -0,0 +1,60 @@
+/*
+Copyright 2021 The Cockroach Authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    https://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package v1alpha1
+
+// DefaultScaleUpTopologyKey is the label of the Kubernetes nodes whose values
+// are the failure domains of a ZoneParallel scale up by default.
+const DefaultScaleUpTopologyKey = "topology.kubernetes.io/zone"
+
+// TypeOrDefault returns how the nodes of a scale up are added.
+func (s *ScaleUpStrategy) TypeOrDefault() ScaleUpType {
+	if s == nil || s.Type == "" {
+		return ScaleUpAllAtOnce
+	}
+	return s.Type
+}
+
+// TopologyKeyOrDefault returns the label of the Kubernetes nodes whose values
+// are the failure domains.
+func (s *ScaleUpStrategy) TopologyKeyOrDefault() string {
+	if s == nil || s.TopologyKey == "" {
+		return DefaultScaleUpTopologyKey
+	}
+	return s.TopologyKey
+}
+
+// NextReplicas returns the replicas of a statefulset with current replicas, of
+// which ready are ready, on the way to desired ones. A step adds one replica
+// per failure domain with ZoneParallel, and one with Serial, once the previous
+// step is ready.
+func (s *ScaleUpStrategy) NextReplicas(current, ready, desired int32, domains int) int32 {
+	if desired <= current || s.TypeOrDefault() == ScaleUpAllAtOnce {
+		return desired
+	}
+	if ready < current {
+		return current
+	}
+
+	step := int32(1)
+	if s.TypeOrDefault() == ScaleUpZoneParallel && domains > 1 {
+		step = int32(domains)
+	}
+	if current+step > desired {
+		return desired
+	}
+	return current + step
+}
@@ -0,0 +1,59 @@
+/*
+Copyright 2021 The Cockroach Authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    https://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package v1alpha1_test
+
+import (
+	"testing"
+
+	api "github.com/cockroachdb/cockroach-operator/apis/v1alpha1"
+	"github.com/stretchr/testify/require"
+)
+
+func TestScaleUpStrategyDefaults(t *testing.T) {
+	var s *api.ScaleUpStrategy
+	require.Equal(t, api.ScaleUpAllAtOnce, s.TypeOrDefault())
+	require.Equal(t, "topology.kubernetes.io/zone", s.TopologyKeyOrDefault())
+
+	s = &api.ScaleUpStrategy{Type: api.ScaleUpZoneParallel, TopologyKey: "rack"}
+	require.Equal(t, api.ScaleUpZoneParallel, s.TypeOrDefault())
+	require.Equal(t, "rack", s.TopologyKeyOrDefault())
+}
+
+func TestScaleUpStrategyNextReplicas(t *testing.T) {
+	tests := []struct {
+		name     string
+		strategy *api.ScaleUpStrategy
+		current  int32
+		ready    int32
+		domains  int
+		want     int32
+	}{
+		{name: "all at once by default", current: 3, ready: 3, domains: 3, want: 12},
+		{name: "one node at a time", strategy: &api.ScaleUpStrategy{Type: api.ScaleUpSerial}, current: 3, ready: 3, domains: 3, want: 4},
+		{name: "one node per failure domain", strategy: &api.ScaleUpStrategy{Type: api.ScaleUpZoneParallel}, current: 3, ready: 3, domains: 3, want: 6},
+		{name: "the last step is smaller", strategy: &api.ScaleUpStrategy{Type: api.ScaleUpZoneParallel}, current: 9, ready: 9, domains: 5, want: 12},
+		{name: "one node without failure domains", strategy: &api.ScaleUpStrategy{Type: api.ScaleUpZoneParallel}, current: 3, ready: 3, want: 4},
+		{name: "waits for the previous step", strategy: &api.ScaleUpStrategy{Type: api.ScaleUpZoneParallel}, current: 6, ready: 4, domains: 3, want: 6},
+		{name: "scales down at once", strategy: &api.ScaleUpStrategy{Type: api.ScaleUpSerial}, current: 15, ready: 10, domains: 3, want: 12},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			require.Equal(t, tt.want, tt.strategy.NextReplicas(tt.current, tt.ready, 12, tt.domains))
+		})
+	}
+}
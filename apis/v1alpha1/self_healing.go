@@ -0,0 +1,92 @@
+/*
+Copyright 2021 The Cockroach Authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    https://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package v1alpha1
+
+import (
+	"time"
+)
+
+const (
+	defaultUnhealthyThreshold    = 10 * time.Minute
+	defaultCrashLoopRestarts     = 5
+	defaultReplaceStoreAfter     = 30 * time.Minute
+	defaultRescheduleAfter       = 5 * time.Minute
+	defaultReplaceDeadNodesAfter = time.Hour
+)
+
+// UnhealthyThresholdOrDefault returns how long a pod can stay not ready before it is
+// unhealthy.
+func (s *SelfHealing) UnhealthyThresholdOrDefault() time.Duration {
+	if s == nil || s.UnhealthyThreshold == nil {
+		return defaultUnhealthyThreshold
+	}
+	return s.UnhealthyThreshold.Duration
+}
+
+// CrashLoopRestartsOrDefault returns the number of restarts of a crash-looping
+// container after which its pod is unhealthy.
+func (s *SelfHealing) CrashLoopRestartsOrDefault() int32 {
+	if s == nil || s.CrashLoopRestarts == nil {
+		return defaultCrashLoopRestarts
+	}
+	return *s.CrashLoopRestarts
+}
+
+// ReplaceStoreEnabled returns whether the stores of the pods that restarting
+// did not heal are replaced.
+func (s *SelfHealing) ReplaceStoreEnabled() bool {
+	return s != nil && s.ReplaceStore
+}
+
+// ReplaceStoreAfterOrDefault returns how long a restarted pod can stay
+// unhealthy before its store is replaced.
+func (s *SelfHealing) ReplaceStoreAfterOrDefault() time.Duration {
+	if s == nil || s.ReplaceStoreAfter == nil {
+		return defaultReplaceStoreAfter
+	}
+	return s.ReplaceStoreAfter.Duration
+}
+
+// RescheduleEnabled returns whether the pods that stay on a lost node are
+// rescheduled.
+func (s *SelfHealing) RescheduleEnabled() bool {
+	return s != nil && s.RescheduleFromLostNodes
+}
+
+// RescheduleAfterOrDefault returns how long a pod can stay on a lost node
+// before it is rescheduled.
+func (s *SelfHealing) RescheduleAfterOrDefault() time.Duration {
+	if s == nil || s.RescheduleAfter == nil {
+		return defaultRescheduleAfter
+	}
+	return s.RescheduleAfter.Duration
+}
+
+// ReplaceDeadNodesEnabled returns whether the dead nodes are decommissioned and
+// the stores of their pods replaced.
+func (s *SelfHealing) ReplaceDeadNodesEnabled() bool {
+	return s != nil && s.ReplaceDeadNodes
+}
+
+// ReplaceDeadNodesAfterOrDefault returns how long a node can stay dead before
+// it is replaced.
+func (s *SelfHealing) ReplaceDeadNodesAfterOrDefault() time.Duration {
+	if s == nil || s.ReplaceDeadNodesAfter == nil {
+		return defaultReplaceDeadNodesAfter
+	}
+	return s.ReplaceDeadNodesAfter.Duration
+}
@@ -0,0 +1,58 @@
+/*
+Copyright 2021 The Cockroach Authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    https://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package v1alpha1_test
+
+import (
+	"testing"
+	"time"
+
+	. "github.com/cockroachdb/cockroach-operator/apis/v1alpha1"
+	"github.com/stretchr/testify/require"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+func TestSelfHealingDefaults(t *testing.T) {
+	var unset *SelfHealing
+	require.Equal(t, 10*time.Minute, unset.UnhealthyThresholdOrDefault())
+	require.Equal(t, int32(5), unset.CrashLoopRestartsOrDefault())
+	require.False(t, unset.ReplaceStoreEnabled())
+	require.Equal(t, 30*time.Minute, unset.ReplaceStoreAfterOrDefault())
+	require.False(t, unset.RescheduleEnabled())
+	require.Equal(t, 5*time.Minute, unset.RescheduleAfterOrDefault())
+	require.False(t, unset.ReplaceDeadNodesEnabled())
+	require.Equal(t, time.Hour, unset.ReplaceDeadNodesAfterOrDefault())
+
+	restarts := int32(2)
+	set := &SelfHealing{
+		UnhealthyThreshold:      &metav1.Duration{Duration: time.Minute},
+		CrashLoopRestarts:       &restarts,
+		ReplaceStore:            true,
+		ReplaceStoreAfter:       &metav1.Duration{Duration: time.Hour},
+		RescheduleFromLostNodes: true,
+		RescheduleAfter:         &metav1.Duration{Duration: 2 * time.Minute},
+		ReplaceDeadNodes:        true,
+		ReplaceDeadNodesAfter:   &metav1.Duration{Duration: 3 * time.Hour},
+	}
+	require.Equal(t, time.Minute, set.UnhealthyThresholdOrDefault())
+	require.Equal(t, int32(2), set.CrashLoopRestartsOrDefault())
+	require.True(t, set.ReplaceStoreEnabled())
+	require.Equal(t, time.Hour, set.ReplaceStoreAfterOrDefault())
+	require.True(t, set.RescheduleEnabled())
+	require.Equal(t, 2*time.Minute, set.RescheduleAfterOrDefault())
+	require.True(t, set.ReplaceDeadNodesEnabled())
+	require.Equal(t, 3*time.Hour, set.ReplaceDeadNodesAfterOrDefault())
+}
@@ -0,0 +1,57 @@
+/*
+Copyright 2021 The Cockroach Authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    https://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package v1alpha1
+
+const (
+	defaultWarningThreshold  = 80
+	defaultCriticalThreshold = 90
+)
+
+// WarningThresholdOrDefault returns the percentage of used capacity of a store
+// above which the cluster is under storage pressure.
+func (s *StoragePressure) WarningThresholdOrDefault() int32 {
+	if s == nil || s.WarningThreshold == nil {
+		return defaultWarningThreshold
+	}
+	return *s.WarningThreshold
+}
+
+// CriticalThresholdOrDefault returns the percentage of used capacity of a
+// store above which the volumes are expanded.
+func (s *StoragePressure) CriticalThresholdOrDefault() int32 {
+	if s == nil || s.CriticalThreshold == nil {
+		return defaultCriticalThreshold
+	}
+	return *s.CriticalThreshold
+}
+
+// ExpansionEnabled returns whether the volumes are expanded when a store
+// crosses the critical threshold.
+func (s *StoragePressure) ExpansionEnabled() bool {
+	return s != nil && (s.ExpandBy > 0 || (s.ExpandStep != nil && s.ExpandStep.Sign() > 0))
+}
+
+// ExpandedSize returns the storage request volumes of the given size are
+// expanded to, before it is rounded and capped: the larger growth of ExpandBy
+// and ExpandStep.
+func (s *StoragePressure) ExpandedSize(requested int64) int64 {
+	size := requested * int64(100+s.ExpandBy) / 100
+	if s.ExpandStep != nil && requested+s.ExpandStep.Value() > size {
+		size = requested + s.ExpandStep.Value()
+	}
+	return size
+}
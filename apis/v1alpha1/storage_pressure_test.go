@@ -0,0 +1,55 @@
+/*
+Copyright 2021 The Cockroach Authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    https://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package v1alpha1_test
+
+import (
+	"testing"
+
+	. "github.com/cockroachdb/cockroach-operator/apis/v1alpha1"
+	"github.com/stretchr/testify/require"
+	apiresource "k8s.io/apimachinery/pkg/api/resource"
+)
+
+func TestStoragePressureDefaults(t *testing.T) {
+	var unset *StoragePressure
+	require.Equal(t, int32(80), unset.WarningThresholdOrDefault())
+	require.Equal(t, int32(90), unset.CriticalThresholdOrDefault())
+	require.False(t, unset.ExpansionEnabled())
+
+	warning, critical := int32(70), int32(85)
+	set := &StoragePressure{WarningThreshold: &warning, CriticalThreshold: &critical, ExpandBy: 20}
+	require.Equal(t, int32(70), set.WarningThresholdOrDefault())
+	require.Equal(t, int32(85), set.CriticalThresholdOrDefault())
+	require.True(t, set.ExpansionEnabled())
+}
+
+func TestStoragePressureExpandedSize(t *testing.T) {
+	const gi = int64(1 << 30)
+	step := apiresource.MustParse("50Gi")
+
+	byPercentage := &StoragePressure{ExpandBy: 20}
+	require.Equal(t, 120*gi, byPercentage.ExpandedSize(100*gi))
+
+	byStep := &StoragePressure{ExpandStep: &step}
+	require.True(t, byStep.ExpansionEnabled())
+	require.Equal(t, 150*gi, byStep.ExpandedSize(100*gi))
+
+	// the larger growth wins
+	both := &StoragePressure{ExpandBy: 20, ExpandStep: &step}
+	require.Equal(t, 150*gi, both.ExpandedSize(100*gi))
+	require.Equal(t, 600*gi, both.ExpandedSize(500*gi))
+}
@@ -0,0 +1,97 @@
+/*
+Copyright 2021 The Cockroach Authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    https://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package v1alpha1
+
+import (
+	"time"
+
+	"github.com/cockroachdb/errors"
+)
+
+const (
+	// defaultCertDuration and defaultCADuration are the lifetimes the
+	// cockroach binary gives to the certificates and to the CA
+	defaultCertDuration = 5 * 365 * 24 * time.Hour
+	defaultCADuration   = 10 * 365 * 24 * time.Hour
+	defaultRSAKeySize   = 2048
+	defaultECDSAKeySize = 256
+)
+
+// Validate checks that the key size fits the algorithm and that the
+// certificates do not outlive the CA.
+func (t *TLSConfig) Validate() error {
+	switch t.KeyAlgorithmOrDefault() {
+	case KeyAlgorithmRSA:
+		switch t.KeySizeOrDefault() {
+		case 2048, 3072, 4096:
+		default:
+			return errors.Newf("RSA keys must be of 2048, 3072 or 4096 bits, not %d", t.KeySize)
+		}
+	case KeyAlgorithmECDSA:
+		switch t.KeySizeOrDefault() {
+		case 256, 384:
+		default:
+			return errors.Newf("ECDSA curves must be of 256 or 384 bits, not %d", t.KeySize)
+		}
+	default:
+		return errors.Newf("unsupported key algorithm %q", t.KeyAlgorithm)
+	}
+
+	if t.CertDurationOrDefault() <= 0 || t.CADurationOrDefault() <= 0 {
+		return errors.New("certDuration and caDuration must be positive")
+	}
+	if t.CertDurationOrDefault() > t.CADurationOrDefault() {
+		return errors.New("certDuration must not be greater than caDuration")
+	}
+	return nil
+}
+
+// CertDurationOrDefault returns the lifetime of the node and client
+// certificates.
+func (t *TLSConfig) CertDurationOrDefault() time.Duration {
+	if t.CertDuration == nil {
+		return defaultCertDuration
+	}
+	return t.CertDuration.Duration
+}
+
+// CADurationOrDefault returns the lifetime of the CA.
+func (t *TLSConfig) CADurationOrDefault() time.Duration {
+	if t.CADuration == nil {
+		return defaultCADuration
+	}
+	return t.CADuration.Duration
+}
+
+// KeyAlgorithmOrDefault returns the algorithm of the private keys.
+func (t *TLSConfig) KeyAlgorithmOrDefault() KeyAlgorithm {
+	if t.KeyAlgorithm == "" {
+		return KeyAlgorithmRSA
+	}
+	return t.KeyAlgorithm
+}
+
+// KeySizeOrDefault returns the size of the RSA keys or of the ECDSA curve.
+func (t *TLSConfig) KeySizeOrDefault() int32 {
+	if t.KeySize != 0 {
+		return t.KeySize
+	}
+	if t.KeyAlgorithmOrDefault() == KeyAlgorithmECDSA {
+		return defaultECDSAKeySize
+	}
+	return defaultRSAKeySize
+}
@@ -0,0 +1,87 @@
+/*
+Copyright 2021 The Cockroach Authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    https://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package v1alpha1_test
+
+import (
+	"testing"
+	"time"
+
+	. "github.com/cockroachdb/cockroach-operator/apis/v1alpha1"
+	"github.com/stretchr/testify/require"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+func TestTLSConfigDefaults(t *testing.T) {
+	tls := &TLSConfig{}
+	require.NoError(t, tls.Validate())
+	require.Equal(t, 43800*time.Hour, tls.CertDurationOrDefault())
+	require.Equal(t, 87600*time.Hour, tls.CADurationOrDefault())
+	require.Equal(t, KeyAlgorithmRSA, tls.KeyAlgorithmOrDefault())
+	require.Equal(t, int32(2048), tls.KeySizeOrDefault())
+
+	tls = &TLSConfig{KeyAlgorithm: KeyAlgorithmECDSA}
+	require.NoError(t, tls.Validate())
+	require.Equal(t, int32(256), tls.KeySizeOrDefault())
+}
+
+func TestTLSConfigValidate(t *testing.T) {
+	day := func(days int) *metav1.Duration {
+		return &metav1.Duration{Duration: time.Duration(days) * 24 * time.Hour}
+	}
+
+	tests := []struct {
+		name string
+		tls  TLSConfig
+		err  string
+	}{
+		{
+			name: "short-lived ECDSA certificates",
+			tls:  TLSConfig{CertDuration: day(30), CADuration: day(365), KeyAlgorithm: KeyAlgorithmECDSA, KeySize: 384},
+		},
+		{
+			name: "RSA key too small",
+			tls:  TLSConfig{KeySize: 256},
+			err:  "RSA keys must be of 2048, 3072 or 4096 bits, not 256",
+		},
+		{
+			name: "unsupported ECDSA curve",
+			tls:  TLSConfig{KeyAlgorithm: KeyAlgorithmECDSA, KeySize: 2048},
+			err:  "ECDSA curves must be of 256 or 384 bits, not 2048",
+		},
+		{
+			name: "certificates outliving the CA",
+			tls:  TLSConfig{CertDuration: day(365), CADuration: day(30)},
+			err:  "certDuration must not be greater than caDuration",
+		},
+		{
+			name: "zero lifetime",
+			tls:  TLSConfig{CertDuration: day(0)},
+			err:  "certDuration and caDuration must be positive",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := tt.tls.Validate()
+			if tt.err == "" {
+				require.NoError(t, err)
+			} else {
+				require.EqualError(t, err, tt.err)
+			}
+		})
+	}
+}
@@ -0,0 +1,94 @@
+/*
+Copyright 2021 The Cockroach Authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    https://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package v1alpha1
+
+import (
+	"regexp"
+	"strings"
+
+	"github.com/cockroachdb/errors"
+	corev1 "k8s.io/api/core/v1"
+)
+
+// DefaultLocalityTiers are the tiers of the locality of the nodes when
+// topologyLocality sets none, from the well-known topology labels of the
+// Kubernetes nodes.
+var DefaultLocalityTiers = []LocalityTier{
+	{Key: "region", NodeLabel: corev1.LabelTopologyRegion},
+	{Key: "zone", NodeLabel: corev1.LabelTopologyZone},
+}
+
+// labelKey is the format of the key of a label: an optional DNS subdomain
+// prefix and a name.
+var labelKey = regexp.MustCompile(`^([a-z0-9]([-a-z0-9]*[a-z0-9])?(\.[a-z0-9]([-a-z0-9]*[a-z0-9])?)*/)?[A-Za-z0-9]([-A-Za-z0-9_.]*[A-Za-z0-9])?$`)
+
+// TiersOrDefault returns the tiers of the locality, DefaultLocalityTiers when
+// none is set.
+func (t *TopologyLocality) TiersOrDefault() []LocalityTier {
+	if t == nil || len(t.Tiers) == 0 {
+		return DefaultLocalityTiers
+	}
+	return t.Tiers
+}
+
+// Locality returns the locality of a node whose pod runs on a Kubernetes node
+// with the labels, e.g. region=us-east1,zone=us-east1-b. It is empty when the
+// Kubernetes node has none of the labels of the tiers.
+func (t *TopologyLocality) Locality(labels map[string]string) string {
+	var tiers []string
+	for _, tier := range t.TiersOrDefault() {
+		if value := labels[tier.NodeLabel]; value != "" {
+			tiers = append(tiers, tier.Key+"="+value)
+		}
+	}
+	return strings.Join(tiers, ",")
+}
+
+// ValidateTopologyLocality checks that the tiers are listed once each, and
+// that the spec sets no other locality for the nodes.
+func (s *CrdbClusterSpec) ValidateTopologyLocality() error {
+	t := s.TopologyLocality
+	if t == nil {
+		return nil
+	}
+
+	keys := map[string]bool{}
+	for _, tier := range t.Tiers {
+		if tier.Key == "" || strings.ContainsAny(tier.Key, "=,") {
+			return errors.Newf("invalid key %q of a locality tier", tier.Key)
+		}
+		if keys[tier.Key] {
+			return errors.Newf("locality tier %q is listed more than once", tier.Key)
+		}
+		keys[tier.Key] = true
+		if !labelKey.MatchString(tier.NodeLabel) {
+			return errors.Newf("invalid node label %q of locality tier %s", tier.NodeLabel, tier.Key)
+		}
+	}
+
+	for _, arg := range s.AdditionalArgs {
+		if strings.HasPrefix(arg, "--locality=") {
+			return errors.New("the --locality of the additional arguments cannot be set with topologyLocality")
+		}
+	}
+	for _, pool := range s.NodePools {
+		if pool.Locality != "" {
+			return errors.Newf("the locality of node pool %q cannot be set with topologyLocality", pool.Name)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,96 @@
+/*
+Copyright 2021 The Cockroach Authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    https://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package v1alpha1
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestTopologyLocality(t *testing.T) {
+	labels := map[string]string{
+		"topology.kubernetes.io/region": "us-east1",
+		"topology.kubernetes.io/zone":   "us-east1-b",
+		"example.com/rack":              "r12",
+	}
+
+	var defaults *TopologyLocality
+	require.Equal(t, "region=us-east1,zone=us-east1-b", defaults.Locality(labels))
+	require.Equal(t, "region=us-east1,zone=us-east1-b", (&TopologyLocality{}).Locality(labels))
+
+	custom := &TopologyLocality{Tiers: []LocalityTier{
+		{Key: "cloud", NodeLabel: "example.com/cloud"},
+		{Key: "region", NodeLabel: "topology.kubernetes.io/region"},
+		{Key: "rack", NodeLabel: "example.com/rack"},
+	}}
+	require.Equal(t, "region=us-east1,rack=r12", custom.Locality(labels))
+	require.Empty(t, custom.Locality(nil))
+}
+
+func TestValidateTopologyLocality(t *testing.T) {
+	require.NoError(t, (&CrdbClusterSpec{AdditionalArgs: []string{"--locality=region=us-east1"}}).ValidateTopologyLocality())
+
+	valid := CrdbClusterSpec{
+		TopologyLocality: &TopologyLocality{Tiers: []LocalityTier{
+			{Key: "region", NodeLabel: "topology.kubernetes.io/region"},
+			{Key: "rack", NodeLabel: "rack"},
+		}},
+		AdditionalArgs: []string{"--cache=.25"},
+		NodePools:      []NodePool{{Name: "large", Nodes: 3}},
+	}
+	require.NoError(t, valid.ValidateTopologyLocality())
+
+	tests := []struct {
+		name     string
+		update   func(s *CrdbClusterSpec)
+		expected string
+	}{
+		{
+			name:     "invalid key",
+			update:   func(s *CrdbClusterSpec) { s.TopologyLocality.Tiers[1].Key = "rack=a" },
+			expected: `invalid key "rack=a" of a locality tier`,
+		},
+		{
+			name:     "key listed twice",
+			update:   func(s *CrdbClusterSpec) { s.TopologyLocality.Tiers[1].Key = "region" },
+			expected: `locality tier "region" is listed more than once`,
+		},
+		{
+			name:     "invalid node label",
+			update:   func(s *CrdbClusterSpec) { s.TopologyLocality.Tiers[1].NodeLabel = "Example.com/rack" },
+			expected: `invalid node label "Example.com/rack" of locality tier rack`,
+		},
+		{
+			name:     "locality of the additional arguments",
+			update:   func(s *CrdbClusterSpec) { s.AdditionalArgs = append(s.AdditionalArgs, "--locality=region=us-east1") },
+			expected: "the --locality of the additional arguments cannot be set with topologyLocality",
+		},
+		{
+			name:     "locality of a node pool",
+			update:   func(s *CrdbClusterSpec) { s.NodePools[0].Locality = "zone=b" },
+			expected: `the locality of node pool "large" cannot be set with topologyLocality`,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			spec := *valid.DeepCopy()
+			tt.update(&spec)
+			require.EqualError(t, spec.ValidateTopologyLocality(), tt.expected)
+		})
+	}
+}
@@ -0,0 +1,53 @@
+/*
+Copyright 2021 The Cockroach Authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    https://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package v1alpha1
+
+import (
+	"github.com/cockroachdb/errors"
+	corev1 "k8s.io/api/core/v1"
+)
+
+// ValidateTopologySpreadConstraints checks the topology spread constraints of
+// the pods, which the API server would only reject once the StatefulSet is
+// updated.
+func (s *CrdbClusterSpec) ValidateTopologySpreadConstraints() error {
+	seen := make(map[string]bool, len(s.TopologySpreadConstraints))
+	for _, c := range s.TopologySpreadConstraints {
+		if c.TopologyKey == "" {
+			return errors.New("a constraint has no topologyKey")
+		}
+		if !labelKey.MatchString(c.TopologyKey) {
+			return errors.Newf("topologyKey %q is not a label key", c.TopologyKey)
+		}
+		if c.MaxSkew < 1 {
+			return errors.Newf("maxSkew %d of topologyKey %q is less than 1", c.MaxSkew, c.TopologyKey)
+		}
+		switch c.WhenUnsatisfiable {
+		case corev1.DoNotSchedule, corev1.ScheduleAnyway:
+		default:
+			return errors.Newf("whenUnsatisfiable %q of topologyKey %q is neither %s nor %s",
+				c.WhenUnsatisfiable, c.TopologyKey, corev1.DoNotSchedule, corev1.ScheduleAnyway)
+		}
+
+		key := c.TopologyKey + "/" + string(c.WhenUnsatisfiable)
+		if seen[key] {
+			return errors.Newf("topologyKey %q is listed more than once with %s", c.TopologyKey, c.WhenUnsatisfiable)
+		}
+		seen[key] = true
+	}
+	return nil
+}
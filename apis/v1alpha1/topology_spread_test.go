@@ -0,0 +1,57 @@
+/*
+Copyright 2021 The Cockroach Authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    https://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package v1alpha1
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	corev1 "k8s.io/api/core/v1"
+)
+
+func TestValidateTopologySpreadConstraints(t *testing.T) {
+	zone := corev1.TopologySpreadConstraint{MaxSkew: 1, TopologyKey: "topology.kubernetes.io/zone", WhenUnsatisfiable: corev1.DoNotSchedule}
+	host := corev1.TopologySpreadConstraint{MaxSkew: 2, TopologyKey: "kubernetes.io/hostname", WhenUnsatisfiable: corev1.ScheduleAnyway}
+
+	spec := CrdbClusterSpec{}
+	require.NoError(t, spec.ValidateTopologySpreadConstraints())
+	spec.TopologySpreadConstraints = []corev1.TopologySpreadConstraint{zone, host}
+	require.NoError(t, spec.ValidateTopologySpreadConstraints())
+
+	for _, tt := range []struct {
+		mutate func(c *corev1.TopologySpreadConstraint)
+		err    string
+	}{
+		{func(c *corev1.TopologySpreadConstraint) { c.TopologyKey = "" }, "a constraint has no topologyKey"},
+		{func(c *corev1.TopologySpreadConstraint) { c.TopologyKey = "zone/" }, `topologyKey "zone/" is not a label key`},
+		{func(c *corev1.TopologySpreadConstraint) { c.MaxSkew = 0 }, `maxSkew 0 of topologyKey "topology.kubernetes.io/zone" is less than 1`},
+		{func(c *corev1.TopologySpreadConstraint) { c.WhenUnsatisfiable = "" },
+			`whenUnsatisfiable "" of topologyKey "topology.kubernetes.io/zone" is neither DoNotSchedule nor ScheduleAnyway`},
+	} {
+		c := zone
+		tt.mutate(&c)
+		spec.TopologySpreadConstraints = []corev1.TopologySpreadConstraint{c}
+		require.EqualError(t, spec.ValidateTopologySpreadConstraints(), tt.err)
+	}
+
+	// a key may be listed once with each of the actions
+	spec.TopologySpreadConstraints = []corev1.TopologySpreadConstraint{zone, host, host}
+	require.EqualError(t, spec.ValidateTopologySpreadConstraints(), `topologyKey "kubernetes.io/hostname" is listed more than once with ScheduleAnyway`)
+	host.TopologyKey = zone.TopologyKey
+	spec.TopologySpreadConstraints = []corev1.TopologySpreadConstraint{zone, host}
+	require.NoError(t, spec.ValidateTopologySpreadConstraints())
+}
@@ -0,0 +1,124 @@
+/*
+Copyright 2021 The Cockroach Authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    https://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package v1alpha1
+
+import "time"
+
+// defaultUpgradeTimeout is how long an upgraded pod can take to become ready
+// when the spec does not set it.
+const defaultUpgradeTimeout = 10 * time.Minute
+
+// the defaults of the canary nodes of an upgrade
+const (
+	defaultCanaryBakeTime                = 30 * time.Minute
+	defaultCanaryMaxSQLErrorRateIncrease = 5
+)
+
+//UpgradeState is the state of a version upgrade of the cluster
+type UpgradeState string
+
+const (
+	//UpgradePending the upgrade waits to start, no pod was upgraded yet
+	UpgradePending UpgradeState = "Pending"
+	//UpgradeInProgress the pods are being upgraded
+	UpgradeInProgress UpgradeState = "InProgress"
+	//UpgradeSucceeded all the pods run the new version
+	UpgradeSucceeded UpgradeState = "Succeeded"
+	//UpgradeFailed the upgrade stopped before all the pods ran the new version
+	UpgradeFailed UpgradeState = "Failed"
+)
+
+//UpgradeStates are all the states of an upgrade
+var UpgradeStates = []UpgradeState{UpgradePending, UpgradeInProgress, UpgradeSucceeded, UpgradeFailed}
+
+//CanaryState is the state of the canary nodes of an upgrade
+type CanaryState string
+
+const (
+	//CanaryBaking the canaries run the new version and the other nodes wait
+	CanaryBaking CanaryState = "Baking"
+	//CanaryPassed the canaries baked without degrading
+	CanaryPassed CanaryState = "Passed"
+	//CanaryHalted the canaries degraded and the upgrade stopped
+	CanaryHalted CanaryState = "Halted"
+)
+
+// UpgradeTimeoutOrDefault returns how long an upgraded pod can take to run the
+// new version and become ready before the upgrade is rolled back.
+func (s *CrdbClusterSpec) UpgradeTimeoutOrDefault() time.Duration {
+	if s.UpgradeTimeout == nil {
+		return defaultUpgradeTimeout
+	}
+	return s.UpgradeTimeout.Duration
+}
+
+// RolledBackAt returns whether the upgrade to the version, or to one of its
+// intermediate versions, was rolled back at the generation of the cluster.
+func (u *UpgradeStatus) RolledBackAt(version string, generation int64) bool {
+	return u != nil && u.State == UpgradeFailed && (u.ToVersion == version || u.TargetVersion == version) &&
+		u.RolledBackGeneration != 0 && u.RolledBackGeneration == generation
+}
+
+// HaltedAt returns whether the upgrade to the version halted at the
+// generation of the cluster after its canaries degraded.
+func (u *UpgradeStatus) HaltedAt(version string, generation int64) bool {
+	return u != nil && u.State == UpgradeFailed && u.ToVersion == version && u.Canary != nil &&
+		u.Canary.State == CanaryHalted && u.Canary.HaltedGeneration == generation
+}
+
+// BakingCanaries returns the canaries of the upgrade to the version while
+// they bake or once they passed, nil when the upgrade has no canaries or is
+// not in progress.
+func (u *UpgradeStatus) BakingCanaries(version string) *CanaryStatus {
+	if u == nil || u.State != UpgradeInProgress || u.ToVersion != version || u.Canary == nil {
+		return nil
+	}
+	return u.Canary
+}
+
+// SteppingTo returns whether the cluster is upgraded to the version through
+// intermediate versions, and does not run it yet.
+func (u *UpgradeStatus) SteppingTo(version string) bool {
+	return u != nil && u.TargetVersion == version && u.ToVersion != version
+}
+
+// NodesOrDefault returns the number of canary nodes.
+func (c *UpgradeCanary) NodesOrDefault() int32 {
+	if c == nil || c.Nodes < 1 {
+		return 1
+	}
+	return c.Nodes
+}
+
+// BakeTimeOrDefault returns how long the canaries run the new version before
+// the rest of the cluster is upgraded.
+func (c *UpgradeCanary) BakeTimeOrDefault() time.Duration {
+	if c == nil || c.BakeTime == nil {
+		return defaultCanaryBakeTime
+	}
+	return c.BakeTime.Duration
+}
+
+// MaxSQLErrorRateIncreaseOrDefault returns by how many percentage points the
+// share of failed SQL statements on the canaries can exceed the one on the
+// other nodes.
+func (c *UpgradeCanary) MaxSQLErrorRateIncreaseOrDefault() int32 {
+	if c == nil || c.MaxSQLErrorRateIncrease == nil {
+		return defaultCanaryMaxSQLErrorRateIncrease
+	}
+	return *c.MaxSQLErrorRateIncrease
+}
@@ -0,0 +1,106 @@
+/*
+Copyright 2021 The Cockroach Authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    https://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package v1alpha1_test
+
+import (
+	"testing"
+	"time"
+
+	. "github.com/cockroachdb/cockroach-operator/apis/v1alpha1"
+	"github.com/stretchr/testify/require"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+func TestUpgradeTimeoutOrDefault(t *testing.T) {
+	spec := &CrdbClusterSpec{}
+	require.Equal(t, 10*time.Minute, spec.UpgradeTimeoutOrDefault())
+
+	spec.UpgradeTimeout = &metav1.Duration{Duration: 3 * time.Minute}
+	require.Equal(t, 3*time.Minute, spec.UpgradeTimeoutOrDefault())
+}
+
+func TestRolledBackAt(t *testing.T) {
+	var unset *UpgradeStatus
+	require.False(t, unset.RolledBackAt("v21.1.0", 2))
+
+	upgrade := &UpgradeStatus{State: UpgradeFailed, ToVersion: "v21.1.0", RolledBackGeneration: 2}
+	require.True(t, upgrade.RolledBackAt("v21.1.0", 2))
+	require.False(t, upgrade.RolledBackAt("v21.1.0", 3))
+	require.False(t, upgrade.RolledBackAt("v21.1.1", 2))
+
+	failed := &UpgradeStatus{State: UpgradeFailed, ToVersion: "v21.1.0"}
+	require.False(t, failed.RolledBackAt("v21.1.0", 0))
+
+	retried := &UpgradeStatus{State: UpgradeInProgress, ToVersion: "v21.1.0", RolledBackGeneration: 2}
+	require.False(t, retried.RolledBackAt("v21.1.0", 2))
+
+	step := &UpgradeStatus{State: UpgradeFailed, ToVersion: "v20.2.15", TargetVersion: "v21.1.0", RolledBackGeneration: 2}
+	require.True(t, step.RolledBackAt("v21.1.0", 2))
+}
+
+func TestHaltedAt(t *testing.T) {
+	var unset *UpgradeStatus
+	require.False(t, unset.HaltedAt("v21.1.0", 2))
+
+	halted := &UpgradeStatus{State: UpgradeFailed, ToVersion: "v21.1.0", Canary: &CanaryStatus{State: CanaryHalted, HaltedGeneration: 2}}
+	require.True(t, halted.HaltedAt("v21.1.0", 2))
+	require.False(t, halted.HaltedAt("v21.1.0", 3))
+	require.False(t, halted.HaltedAt("v21.1.1", 2))
+
+	baking := &UpgradeStatus{State: UpgradeInProgress, ToVersion: "v21.1.0", Canary: &CanaryStatus{State: CanaryBaking}}
+	require.False(t, baking.HaltedAt("v21.1.0", 0))
+}
+
+func TestBakingCanaries(t *testing.T) {
+	var unset *UpgradeStatus
+	require.Nil(t, unset.BakingCanaries("v21.1.0"))
+
+	canary := &CanaryStatus{State: CanaryBaking, Pods: 1}
+	baking := &UpgradeStatus{State: UpgradeInProgress, ToVersion: "v21.1.0", Canary: canary}
+	require.Equal(t, canary, baking.BakingCanaries("v21.1.0"))
+	require.Nil(t, baking.BakingCanaries("v21.2.0"))
+
+	halted := &UpgradeStatus{State: UpgradeFailed, ToVersion: "v21.1.0", Canary: &CanaryStatus{State: CanaryHalted}}
+	require.Nil(t, halted.BakingCanaries("v21.1.0"))
+
+	require.Nil(t, (&UpgradeStatus{State: UpgradeInProgress, ToVersion: "v21.1.0"}).BakingCanaries("v21.1.0"))
+}
+
+func TestSteppingTo(t *testing.T) {
+	var unset *UpgradeStatus
+	require.False(t, unset.SteppingTo("v21.1.7"))
+
+	step := &UpgradeStatus{State: UpgradeSucceeded, ToVersion: "v20.2.15", TargetVersion: "v21.1.7"}
+	require.True(t, step.SteppingTo("v21.1.7"))
+	require.False(t, step.SteppingTo("v21.1.6"))
+
+	last := &UpgradeStatus{State: UpgradeInProgress, ToVersion: "v21.1.7"}
+	require.False(t, last.SteppingTo("v21.1.7"))
+}
+
+func TestUpgradeCanaryDefaults(t *testing.T) {
+	var unset *UpgradeCanary
+	require.Equal(t, int32(1), unset.NodesOrDefault())
+	require.Equal(t, 30*time.Minute, unset.BakeTimeOrDefault())
+	require.Equal(t, int32(5), unset.MaxSQLErrorRateIncreaseOrDefault())
+
+	increase := int32(0)
+	canary := &UpgradeCanary{Nodes: 3, BakeTime: &metav1.Duration{Duration: time.Hour}, MaxSQLErrorRateIncrease: &increase}
+	require.Equal(t, int32(3), canary.NodesOrDefault())
+	require.Equal(t, time.Hour, canary.BakeTimeOrDefault())
+	require.Equal(t, int32(0), canary.MaxSQLErrorRateIncreaseOrDefault())
+}
@@ -0,0 +1,57 @@
+/*
+Copyright 2021 The Cockroach Authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    https://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package v1alpha1
+
+import "time"
+
+const (
+	defaultVaultAuthPath = "kubernetes"
+	defaultVaultPKIPath  = "pki"
+)
+
+// AuthPathOrDefault returns the mount path of the Kubernetes auth method.
+func (v *VaultPKI) AuthPathOrDefault() string {
+	if v.AuthPath == "" {
+		return defaultVaultAuthPath
+	}
+	return v.AuthPath
+}
+
+// PKIPathOrDefault returns the mount path of the PKI secrets engine.
+func (v *VaultPKI) PKIPathOrDefault() string {
+	if v.PKIPath == "" {
+		return defaultVaultPKIPath
+	}
+	return v.PKIPath
+}
+
+// ClientRoleOrDefault returns the role that issues the client certificate.
+func (v *VaultPKI) ClientRoleOrDefault() string {
+	if v.ClientRole == "" {
+		return v.NodeRole
+	}
+	return v.ClientRole
+}
+
+// RenewalTime returns when a certificate valid from notBefore to notAfter is
+// renewed.
+func (v *VaultPKI) RenewalTime(notBefore, notAfter time.Time) time.Time {
+	if v.RenewBefore != nil {
+		return notAfter.Add(-v.RenewBefore.Duration)
+	}
+	return notAfter.Add(-notAfter.Sub(notBefore) / 3)
+}
@@ -0,0 +1,49 @@
+/*
+Copyright 2021 The Cockroach Authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    https://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package v1alpha1_test
+
+import (
+	"testing"
+	"time"
+
+	. "github.com/cockroachdb/cockroach-operator/apis/v1alpha1"
+	"github.com/stretchr/testify/require"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+func TestVaultPKIDefaults(t *testing.T) {
+	unset := &VaultPKI{NodeRole: "cockroachdb"}
+	require.Equal(t, "kubernetes", unset.AuthPathOrDefault())
+	require.Equal(t, "pki", unset.PKIPathOrDefault())
+	require.Equal(t, "cockroachdb", unset.ClientRoleOrDefault())
+
+	set := &VaultPKI{AuthPath: "k8s-east", PKIPath: "pki_int", NodeRole: "cockroachdb", ClientRole: "cockroachdb-client"}
+	require.Equal(t, "k8s-east", set.AuthPathOrDefault())
+	require.Equal(t, "pki_int", set.PKIPathOrDefault())
+	require.Equal(t, "cockroachdb-client", set.ClientRoleOrDefault())
+}
+
+func TestVaultPKIRenewalTime(t *testing.T) {
+	notBefore := time.Date(2021, 6, 1, 0, 0, 0, 0, time.UTC)
+	notAfter := notBefore.Add(30 * 24 * time.Hour)
+
+	// a third of the lifetime by default
+	require.Equal(t, notBefore.Add(20*24*time.Hour), (&VaultPKI{}).RenewalTime(notBefore, notAfter))
+
+	set := &VaultPKI{RenewBefore: &metav1.Duration{Duration: 48 * time.Hour}}
+	require.Equal(t, notBefore.Add(28*24*time.Hour), set.RenewalTime(notBefore, notAfter))
+}
@@ -0,0 +1,113 @@
+/*
+Copyright 2021 The Cockroach Authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    https://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"os"
+
+	crdbv1alpha1 "github.com/cockroachdb/cockroach-operator/apis/v1alpha1"
+	"github.com/cockroachdb/cockroach-operator/pkg/resource"
+	"github.com/cockroachdb/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+// runClone implements the clone subcommand. It creates a CrdbCluster with the
+// same topology as an existing one and asks the operator to restore a backup of
+// the existing cluster into it once it is initialized.
+func runClone(args []string) int {
+	var kubeconfig, namespace, from, to, backupURI, backup string
+
+	fs := flag.NewFlagSet("clone", flag.ExitOnError)
+	fs.StringVar(&kubeconfig, "kubeconfig", "", "Path to a kubeconfig. Defaults to $KUBECONFIG or the in-cluster configuration.")
+	fs.StringVar(&namespace, "namespace", "default", "The namespace of the clusters.")
+	fs.StringVar(&from, "from", "", "The name of the CrdbCluster to clone.")
+	fs.StringVar(&to, "to", "", "The name of the CrdbCluster to create.")
+	fs.StringVar(&backupURI, "backup-uri", "", "The URI of the backup collection the data goes through, e.g. s3://bucket/path?AUTH=implicit. Defaults to the backup volume of the source cluster.")
+	fs.StringVar(&backup, "backup", "", "The path of an existing backup in the collection to restore. Defaults to a new backup of the source cluster.")
+	_ = fs.Parse(args)
+
+	if from == "" || to == "" || fs.NArg() != 0 {
+		fmt.Fprintln(os.Stderr, "usage: cockroach-operator clone --from <cluster> --to <cluster> [--backup-uri <uri>] [--backup <path>] [--namespace <namespace>]")
+		return 2
+	}
+
+	cfg, err := getRESTConfig(kubeconfig)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "failed to get REST config: %v\n", err)
+		return 1
+	}
+
+	cl, err := client.New(cfg, client.Options{Scheme: scheme})
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "failed to create client: %v\n", err)
+		return 1
+	}
+
+	source := crdbv1alpha1.CloneSource{Cluster: from, BackupURI: backupURI, Backup: backup}
+	if err := createClone(context.Background(), cl, namespace, to, source); err != nil {
+		fmt.Fprintf(os.Stderr, "failed to clone %s: %v\n", from, err)
+		return 1
+	}
+
+	fmt.Printf("created %s %q, follow the clone with: kubectl get crdbcluster %s -n %s -o jsonpath='{.status.clone}'\n",
+		crdbClusterKind, to, to, namespace)
+	return 0
+}
+
+// createClone creates the CrdbCluster name with the spec of the source cluster.
+func createClone(ctx context.Context, cl client.Client, namespace, name string, source crdbv1alpha1.CloneSource) error {
+	original := &crdbv1alpha1.CrdbCluster{}
+	if err := cl.Get(ctx, types.NamespacedName{Namespace: namespace, Name: source.Cluster}, original); err != nil {
+		return errors.Wrapf(err, "failed to fetch %s %q", crdbClusterKind, source.Cluster)
+	}
+	if !source.HasBackupURI() && original.Spec.BackupVolume == nil {
+		return errors.Newf("%s %q has no backup volume, a backup URI is required", crdbClusterKind, source.Cluster)
+	}
+
+	if err := cl.Create(ctx, cloneCluster(original, name, source)); err != nil {
+		return errors.Wrapf(err, "failed to create %s %q", crdbClusterKind, name)
+	}
+	return nil
+}
+
+// cloneCluster returns a CrdbCluster with the same topology as original. The
+// certificates of original are not reused: the clone gets its own, generated
+// by the operator. The backup volume of original is shared, so that backups
+// can go through it.
+func cloneCluster(original *crdbv1alpha1.CrdbCluster, name string, source crdbv1alpha1.CloneSource) *crdbv1alpha1.CrdbCluster {
+	spec := *original.Spec.DeepCopy()
+	spec.NodeTLSSecret = ""
+	spec.ClientTLSSecret = ""
+	spec.CloneFrom = &source
+	if spec.BackupVolume != nil {
+		cluster := resource.NewCluster(original)
+		spec.BackupVolume = &crdbv1alpha1.BackupVolume{ClaimName: cluster.BackupVolumeClaimName()}
+	}
+
+	return &crdbv1alpha1.CrdbCluster{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      name,
+			Namespace: original.Namespace,
+		},
+		Spec: spec,
+	}
+}
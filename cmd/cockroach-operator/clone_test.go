@@ -0,0 +1,77 @@
+/*
+Copyright 2021 The Cockroach Authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    https://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package main
+
+import (
+	"context"
+	"testing"
+
+	crdbv1alpha1 "github.com/cockroachdb/cockroach-operator/apis/v1alpha1"
+	"github.com/stretchr/testify/require"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+)
+
+func TestCreateClone(t *testing.T) {
+	ctx := context.Background()
+	original := &crdbv1alpha1.CrdbCluster{
+		ObjectMeta: metav1.ObjectMeta{Name: "prod", Namespace: "db", Labels: map[string]string{"team": "payments"}},
+		Spec: crdbv1alpha1.CrdbClusterSpec{
+			Nodes:           5,
+			TLSEnabled:      true,
+			NodeTLSSecret:   "prod-certs",
+			ClientTLSSecret: "prod-root-certs",
+			Cache:           "30%",
+		},
+	}
+	source := crdbv1alpha1.CloneSource{Cluster: "prod", BackupURI: "s3://backups/prod?AUTH=implicit"}
+
+	cl := fake.NewFakeClientWithScheme(scheme, original)
+	require.NoError(t, createClone(ctx, cl, "db", "prod-clone", source))
+
+	clone := &crdbv1alpha1.CrdbCluster{}
+	require.NoError(t, cl.Get(ctx, types.NamespacedName{Namespace: "db", Name: "prod-clone"}, clone))
+	require.Equal(t, int32(5), clone.Spec.Nodes)
+	require.Equal(t, "30%", clone.Spec.Cache)
+	require.True(t, clone.Spec.TLSEnabled)
+	require.Empty(t, clone.Spec.NodeTLSSecret)
+	require.Empty(t, clone.Spec.ClientTLSSecret)
+	require.Equal(t, &source, clone.Spec.CloneFrom)
+	require.Empty(t, clone.Labels)
+
+	// the source cluster is left untouched
+	require.NoError(t, cl.Get(ctx, types.NamespacedName{Namespace: "db", Name: "prod"}, original))
+	require.Nil(t, original.Spec.CloneFrom)
+	require.Equal(t, "prod-certs", original.Spec.NodeTLSSecret)
+
+	require.Error(t, createClone(ctx, cl, "db", "other", crdbv1alpha1.CloneSource{Cluster: "missing", BackupURI: "s3://backups/prod"}))
+
+	err := createClone(ctx, cl, "db", "other", crdbv1alpha1.CloneSource{Cluster: "prod"})
+	require.EqualError(t, err, `CrdbCluster "prod" has no backup volume, a backup URI is required`)
+}
+
+func TestCloneSharesTheBackupVolume(t *testing.T) {
+	original := &crdbv1alpha1.CrdbCluster{
+		ObjectMeta: metav1.ObjectMeta{Name: "prod", Namespace: "db"},
+		Spec:       crdbv1alpha1.CrdbClusterSpec{Nodes: 3, BackupVolume: &crdbv1alpha1.BackupVolume{}},
+	}
+
+	clone := cloneCluster(original, "prod-clone", crdbv1alpha1.CloneSource{Cluster: "prod"})
+	require.Equal(t, &crdbv1alpha1.BackupVolume{ClaimName: "prod-backups"}, clone.Spec.BackupVolume)
+	require.Equal(t, &crdbv1alpha1.BackupVolume{}, original.Spec.BackupVolume)
+}
@@ -20,9 +20,12 @@ import (
 	"flag"
 	"fmt"
 	"os"
+	"time"
 
 	crdbv1alpha1 "github.com/cockroachdb/cockroach-operator/apis/v1alpha1"
 	"github.com/cockroachdb/cockroach-operator/pkg/controller"
+	"github.com/cockroachdb/cockroach-operator/pkg/features"
+	"github.com/cockroachdb/cockroach-operator/pkg/orphans"
 	"github.com/cockroachdb/cockroach-operator/pkg/utilfeature"
 	"github.com/go-logr/logr"
 	"k8s.io/apimachinery/pkg/runtime"
@@ -35,6 +38,10 @@ import (
 const (
 	certDir              = "/tmp/webhook-certs"
 	watchNamespaceEnvVar = "WATCH_NAMESPACE"
+	podNamespaceEnvVar   = "POD_NAMESPACE"
+	// leaderElectionID must stay the same across releases, so that an old and a
+	// new operator never reconcile at the same time during an upgrade.
+	leaderElectionID = "crdb-operator.cockroachlabs.com"
 )
 
 var (
@@ -42,14 +49,30 @@ var (
 	setupLog = ctrl.Log.WithName("setup")
 )
 
+// subcommands are run instead of the operator when their name is the first
+// argument, e.g. cockroach-operator validate -f cluster.yaml.
+var subcommands = map[string]func(args []string) int{
+	"clone":           runClone,
+	"migrate-storage": runMigrateStorage,
+	"preflight":       runPreflight,
+	"validate":        runValidate,
+}
+
 func init() {
 	_ = clientgoscheme.AddToScheme(scheme)
 	_ = crdbv1alpha1.AddToScheme(scheme)
 }
 
 func main() {
-	var metricsAddr, featureGatesString string
-	var enableLeaderElection bool
+	if len(os.Args) > 1 {
+		if run, ok := subcommands[os.Args[1]]; ok {
+			os.Exit(run(os.Args[2:]))
+		}
+	}
+
+	var metricsAddr, featureGatesString, orphanPolicyString string
+	var enableLeaderElection, enableWebhooks bool
+	var orphanSweepInterval, staleResourceRetention time.Duration
 
 	// use zap logging cli options
 	opts := zap.Options{}
@@ -59,6 +82,14 @@ func main() {
 	flag.StringVar(&featureGatesString, "feature-gates", "", "Feature gate to enable, format is a command separated list enabling features, for instance RunAsNonRoot=false")
 	flag.BoolVar(&enableLeaderElection, "enable-leader-election", false,
 		"Enable leader election for controller manager. Enabling this will ensure there is only one active controller manager.")
+	flag.BoolVar(&enableWebhooks, "enable-webhooks", true,
+		"Enable the admission webhooks. Disable them only when the webhook configurations are not installed.")
+	flag.StringVar(&orphanPolicyString, "orphan-policy", string(orphans.PolicyReport),
+		"What to do with PVCs, secrets and jobs of CrdbClusters that no longer exist: ignore, report or delete.")
+	flag.DurationVar(&orphanSweepInterval, "orphan-sweep-interval", orphans.DefaultInterval,
+		"How often to look for resources of CrdbClusters that no longer exist, and for stale resources of existing ones.")
+	flag.DurationVar(&staleResourceRetention, "stale-resource-retention", orphans.DefaultRetention,
+		"How long finished version checker jobs and superseded certificate secrets are kept before they are deleted. 0 keeps them forever.")
 	flag.Parse()
 
 	// create logger using zap cli options
@@ -74,6 +105,12 @@ func main() {
 		}
 	}
 
+	orphanPolicy, err := orphans.ParsePolicy(orphanPolicyString)
+	if err != nil {
+		setupLog.Error(err, "unable to parse orphan-policy flag")
+		os.Exit(1)
+	}
+
 	namespace, err := getWatchNamespace()
 	if err != nil {
 		setupLog.Error(err, "unable to get watch namespace")
@@ -85,6 +122,7 @@ func main() {
 		Namespace:          namespace,
 		MetricsBindAddress: metricsAddr,
 		LeaderElection:     enableLeaderElection,
+		LeaderElectionID:   leaderElectionID,
 		Port:               9443,
 		CertDir:            certDir,
 	})
@@ -93,9 +131,11 @@ func main() {
 		os.Exit(1)
 	}
 
-	if err := (&crdbv1alpha1.CrdbCluster{}).SetupWebhookWithManager(mgr); err != nil {
-		setupLog.Error(err, "unable to setup webhook")
-		os.Exit(1)
+	if enableWebhooks {
+		if err := (&crdbv1alpha1.CrdbCluster{}).SetupWebhookWithManager(mgr); err != nil {
+			setupLog.Error(err, "unable to setup webhook")
+			os.Exit(1)
+		}
 	}
 
 	reconciler := controller.InitClusterReconciler()
@@ -104,13 +144,68 @@ func main() {
 		os.Exit(1)
 	}
 
+	if utilfeature.DefaultMutableFeatureGate.Enabled(features.CrdbJobs) {
+		if err = controller.InitJobReconciler()(mgr); err != nil {
+			setupLog.Error(err, "unable to create controller", "controller", "CrdbJob")
+			os.Exit(1)
+		}
+	}
+
+	if utilfeature.DefaultMutableFeatureGate.Enabled(features.CrdbClientCerts) {
+		if err = controller.InitClientCertReconciler()(mgr); err != nil {
+			setupLog.Error(err, "unable to create controller", "controller", "CrdbClientCert")
+			os.Exit(1)
+		}
+	}
+
+	if utilfeature.DefaultMutableFeatureGate.Enabled(features.CrdbBackups) {
+		if err = controller.InitBackupReconciler()(mgr); err != nil {
+			setupLog.Error(err, "unable to create controller", "controller", "CrdbBackup")
+			os.Exit(1)
+		}
+	}
+
+	if utilfeature.DefaultMutableFeatureGate.Enabled(features.CrdbRestores) {
+		if err = controller.InitRestoreReconciler()(mgr); err != nil {
+			setupLog.Error(err, "unable to create controller", "controller", "CrdbRestore")
+			os.Exit(1)
+		}
+	}
+
+	if utilfeature.DefaultMutableFeatureGate.Enabled(features.CrdbChangefeeds) {
+		if err = controller.InitChangefeedReconciler()(mgr); err != nil {
+			setupLog.Error(err, "unable to create controller", "controller", "CrdbChangefeed")
+			os.Exit(1)
+		}
+	}
+
+	if orphanPolicy != orphans.PolicyIgnore {
+		sweeper := orphans.NewSweeper(mgr.GetAPIReader(), mgr.GetClient(), namespace, orphanPolicy,
+			orphanSweepInterval, ctrl.Log.WithName("orphans"))
+		if err := mgr.Add(sweeper); err != nil {
+			setupLog.Error(err, "unable to add orphaned resource sweeper")
+			os.Exit(1)
+		}
+	}
+
+	if staleResourceRetention > 0 {
+		pruner := orphans.NewPruner(mgr.GetAPIReader(), mgr.GetClient(), namespace, staleResourceRetention,
+			orphanSweepInterval, ctrl.Log.WithName("pruner"))
+		if err := mgr.Add(pruner); err != nil {
+			setupLog.Error(err, "unable to add stale resource pruner")
+			os.Exit(1)
+		}
+	}
+
 	// add a logger to the main context
 	ctx := logr.NewContext(ctrl.SetupSignalHandler(), logger)
 
 	// ensure TLS is all set up for webhooks
-	if err := SetupWebhookTLS(ctx, namespace, certDir); err != nil {
-		setupLog.Error(err, "failed to setup TLS")
-		os.Exit(1)
+	if enableWebhooks {
+		if err := SetupWebhookTLS(ctx, getOperatorNamespace(namespace), certDir); err != nil {
+			setupLog.Error(err, "failed to setup TLS")
+			os.Exit(1)
+		}
 	}
 
 	setupLog.Info("starting manager")
@@ -128,3 +223,13 @@ func getWatchNamespace() (string, error) {
 	}
 	return ns, nil
 }
+
+// getOperatorNamespace returns the namespace the operator runs in. It falls
+// back to the watch namespace, which is the same unless the operator watches
+// all namespaces.
+func getOperatorNamespace(watchNamespace string) string {
+	if ns := os.Getenv(podNamespaceEnvVar); ns != "" {
+		return ns
+	}
+	return watchNamespace
+}
@@ -0,0 +1,214 @@
+/*
+Copyright 2021 The Cockroach Authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    https://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+
+	"github.com/cockroachdb/errors"
+	apiErrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/client-go/dynamic"
+	"k8s.io/client-go/util/retry"
+)
+
+const (
+	defaultMigrationCRD = "crdbclusters.crdb.cockroachlabs.com"
+	migrationPageSize   = 100
+)
+
+var crdResource = schema.GroupVersionResource{
+	Group:    "apiextensions.k8s.io",
+	Version:  "v1",
+	Resource: "customresourcedefinitions",
+}
+
+// storageMigrator rewrites the objects of a CRD in its current storage version
+// and then drops the older versions from the CRD's stored versions. This is
+// required before an API version can be removed from the CRD: the API server
+// refuses to remove a version that is still listed in status.storedVersions.
+type storageMigrator struct {
+	client dynamic.Interface
+	out    io.Writer
+}
+
+// runMigrateStorage implements the migrate-storage subcommand. It is meant to
+// run as a Job after an operator upgrade that changed the storage version of
+// the CRD.
+func runMigrateStorage(args []string) int {
+	var kubeconfig, crdName string
+
+	fs := flag.NewFlagSet("migrate-storage", flag.ExitOnError)
+	fs.StringVar(&kubeconfig, "kubeconfig", "", "Path to a kubeconfig. Defaults to $KUBECONFIG or the in-cluster configuration.")
+	fs.StringVar(&crdName, "crd", defaultMigrationCRD, "The name of the CRD to migrate.")
+	_ = fs.Parse(args)
+
+	cfg, err := getRESTConfig(kubeconfig)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "failed to get REST config: %v\n", err)
+		return 1
+	}
+
+	client, err := dynamic.NewForConfig(cfg)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "failed to create dynamic client: %v\n", err)
+		return 1
+	}
+
+	m := &storageMigrator{client: client, out: os.Stdout}
+	if err := m.migrate(context.Background(), crdName); err != nil {
+		fmt.Fprintf(os.Stderr, "failed to migrate %s: %v\n", crdName, err)
+		return 1
+	}
+	return 0
+}
+
+func (m *storageMigrator) migrate(ctx context.Context, crdName string) error {
+	crd, err := m.client.Resource(crdResource).Get(ctx, crdName, metav1.GetOptions{})
+	if err != nil {
+		return errors.Wrap(err, "failed to fetch CRD")
+	}
+
+	gvr, err := storageVersionResource(crd)
+	if err != nil {
+		return err
+	}
+
+	stored, _, err := unstructured.NestedStringSlice(crd.Object, "status", "storedVersions")
+	if err != nil {
+		return errors.Wrap(err, "failed to read stored versions")
+	}
+	if len(stored) == 1 && stored[0] == gvr.Version {
+		fmt.Fprintf(m.out, "all %s are stored as %s, nothing to migrate\n", gvr.Resource, gvr.Version)
+		return nil
+	}
+
+	fmt.Fprintf(m.out, "migrating %s from stored versions %v to %s\n", gvr.Resource, stored, gvr.Version)
+	count, err := m.rewriteObjects(ctx, gvr)
+	if err != nil {
+		return err
+	}
+	fmt.Fprintf(m.out, "rewrote %d %s\n", count, gvr.Resource)
+
+	return m.pruneStoredVersions(ctx, crdName, gvr.Version)
+}
+
+// storageVersionResource returns the resource of the CRD at its storage version.
+func storageVersionResource(crd *unstructured.Unstructured) (schema.GroupVersionResource, error) {
+	group, _, _ := unstructured.NestedString(crd.Object, "spec", "group")
+	plural, _, _ := unstructured.NestedString(crd.Object, "spec", "names", "plural")
+	versions, _, err := unstructured.NestedSlice(crd.Object, "spec", "versions")
+	if err != nil {
+		return schema.GroupVersionResource{}, errors.Wrap(err, "failed to read CRD versions")
+	}
+
+	for _, v := range versions {
+		version, ok := v.(map[string]interface{})
+		if !ok {
+			continue
+		}
+		if storage, _, _ := unstructured.NestedBool(version, "storage"); storage {
+			name, _, _ := unstructured.NestedString(version, "name")
+			return schema.GroupVersionResource{Group: group, Version: name, Resource: plural}, nil
+		}
+	}
+
+	return schema.GroupVersionResource{}, errors.Newf("CRD %s has no storage version", crd.GetName())
+}
+
+// rewriteObjects writes every object back unchanged, which makes the API server
+// store it in the current storage version.
+func (m *storageMigrator) rewriteObjects(ctx context.Context, gvr schema.GroupVersionResource) (int, error) {
+	count := 0
+	opts := metav1.ListOptions{Limit: migrationPageSize}
+
+	for {
+		list, err := m.client.Resource(gvr).List(ctx, opts)
+		if err != nil {
+			return count, errors.Wrapf(err, "failed to list %s", gvr.Resource)
+		}
+
+		for i := range list.Items {
+			if err := m.rewriteObject(ctx, gvr, &list.Items[i]); err != nil {
+				return count, err
+			}
+			count++
+		}
+
+		opts.Continue = list.GetContinue()
+		if opts.Continue == "" {
+			return count, nil
+		}
+	}
+}
+
+func (m *storageMigrator) rewriteObject(ctx context.Context, gvr schema.GroupVersionResource, obj *unstructured.Unstructured) error {
+	api := m.client.Resource(gvr).Namespace(obj.GetNamespace())
+
+	err := retry.RetryOnConflict(retry.DefaultRetry, func() error {
+		_, err := api.Update(ctx, obj, metav1.UpdateOptions{})
+		if !apiErrors.IsConflict(err) {
+			return err
+		}
+
+		// the object changed since it was listed, which means it was already
+		// written in the storage version, but retry to be sure
+		latest, getErr := api.Get(ctx, obj.GetName(), metav1.GetOptions{})
+		if getErr != nil {
+			return getErr
+		}
+		obj = latest
+		return err
+	})
+
+	if apiErrors.IsNotFound(err) {
+		return nil
+	}
+	return errors.Wrapf(err, "failed to rewrite %s %s/%s", gvr.Resource, obj.GetNamespace(), obj.GetName())
+}
+
+// pruneStoredVersions sets the stored versions of the CRD to the storage
+// version, once every object has been rewritten.
+func (m *storageMigrator) pruneStoredVersions(ctx context.Context, crdName, version string) error {
+	api := m.client.Resource(crdResource)
+
+	err := retry.RetryOnConflict(retry.DefaultRetry, func() error {
+		crd, err := api.Get(ctx, crdName, metav1.GetOptions{})
+		if err != nil {
+			return err
+		}
+
+		if err := unstructured.SetNestedStringSlice(crd.Object, []string{version}, "status", "storedVersions"); err != nil {
+			return err
+		}
+
+		_, err = api.UpdateStatus(ctx, crd, metav1.UpdateOptions{})
+		return err
+	})
+	if err != nil {
+		return errors.Wrap(err, "failed to prune stored versions")
+	}
+
+	fmt.Fprintf(m.out, "set stored versions of %s to [%s]\n", crdName, version)
+	return nil
+}
@@ -0,0 +1,78 @@
+/*
+Copyright 2021 The Cockroach Authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    https://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package main
+
+import (
+	"bytes"
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/client-go/dynamic/fake"
+)
+
+func TestStorageMigrator(t *testing.T) {
+	crd := &unstructured.Unstructured{Object: map[string]interface{}{
+		"apiVersion": "apiextensions.k8s.io/v1",
+		"kind":       "CustomResourceDefinition",
+		"metadata":   map[string]interface{}{"name": defaultMigrationCRD},
+		"spec": map[string]interface{}{
+			"group": "crdb.cockroachlabs.com",
+			"names": map[string]interface{}{"plural": "crdbclusters"},
+			"versions": []interface{}{
+				map[string]interface{}{"name": "v1alpha1", "served": true, "storage": false},
+				map[string]interface{}{"name": "v1beta1", "served": true, "storage": true},
+			},
+		},
+		"status": map[string]interface{}{
+			"storedVersions": []interface{}{"v1alpha1", "v1beta1"},
+		},
+	}}
+	cluster := &unstructured.Unstructured{Object: map[string]interface{}{
+		"apiVersion": "crdb.cockroachlabs.com/v1beta1",
+		"kind":       "CrdbCluster",
+		"metadata":   map[string]interface{}{"name": "cockroachdb", "namespace": "default"},
+	}}
+
+	client := fake.NewSimpleDynamicClient(runtime.NewScheme(), crd, cluster)
+	out := &bytes.Buffer{}
+	m := &storageMigrator{client: client, out: out}
+
+	ctx := context.Background()
+	require.NoError(t, m.migrate(ctx, defaultMigrationCRD))
+
+	updated := 0
+	for _, action := range client.Actions() {
+		if action.GetVerb() == "update" && action.GetResource().Resource == "crdbclusters" {
+			updated++
+		}
+	}
+	require.Equal(t, 1, updated)
+
+	actual, err := client.Resource(crdResource).Get(ctx, defaultMigrationCRD, metav1.GetOptions{})
+	require.NoError(t, err)
+	stored, _, err := unstructured.NestedStringSlice(actual.Object, "status", "storedVersions")
+	require.NoError(t, err)
+	require.Equal(t, []string{"v1beta1"}, stored)
+
+	out.Reset()
+	require.NoError(t, m.migrate(ctx, defaultMigrationCRD))
+	require.Contains(t, out.String(), "nothing to migrate")
+}
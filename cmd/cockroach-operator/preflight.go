@@ -0,0 +1,455 @@
+/*
+Copyright 2021 The Cockroach Authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    https://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"time"
+
+	crdbv1alpha1 "github.com/cockroachdb/cockroach-operator/apis/v1alpha1"
+	admissionv1 "k8s.io/api/admissionregistration/v1"
+	authv1 "k8s.io/api/authorization/v1"
+	apiErrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/rest"
+	"k8s.io/client-go/tools/clientcmd"
+	ctrl "sigs.k8s.io/controller-runtime"
+)
+
+const (
+	defaultOperatorNamespace      = "default"
+	defaultOperatorServiceAccount = "cockroach-operator-sa"
+
+	crdbClusterResource = "crdbclusters"
+	csrGroup            = "certificates.k8s.io"
+
+	defaultStorageClassAnnotation     = "storageclass.kubernetes.io/is-default-class"
+	betaDefaultStorageClassAnnotation = "storageclass.beta.kubernetes.io/is-default-class"
+)
+
+type preflightSeverity string
+
+const (
+	preflightOK      preflightSeverity = "OK"
+	preflightWarning preflightSeverity = "WARNING"
+	preflightError   preflightSeverity = "ERROR"
+)
+
+// preflightFinding is the result of a single preflight check. The hint tells
+// the user how to fix the problem and is empty for successful checks.
+type preflightFinding struct {
+	check    string
+	severity preflightSeverity
+	message  string
+	hint     string
+}
+
+// preflightPermission is a permission the operator needs to manage clusters.
+type preflightPermission struct {
+	group         string
+	resource      string
+	subresource   string
+	verb          string
+	clusterScoped bool
+}
+
+func (p preflightPermission) String() string {
+	resource := p.resource
+	if p.subresource != "" {
+		resource += "/" + p.subresource
+	}
+	if p.group != "" {
+		resource += "." + p.group
+	}
+	return p.verb + " " + resource
+}
+
+// operatorPermissions lists the permissions the operator relies on. It is not
+// exhaustive, but a missing entry is a sure sign of broken RBAC.
+var operatorPermissions = []preflightPermission{
+	{group: crdbv1alpha1.SchemeGroupVersion.Group, resource: crdbClusterResource, verb: "watch"},
+	{group: crdbv1alpha1.SchemeGroupVersion.Group, resource: crdbClusterResource, verb: "update"},
+	{group: crdbv1alpha1.SchemeGroupVersion.Group, resource: crdbClusterResource, subresource: "status", verb: "update"},
+	{group: "apps", resource: "statefulsets", verb: "create"},
+	{group: "apps", resource: "statefulsets", verb: "update"},
+	{group: "batch", resource: "jobs", verb: "create"},
+	{group: "policy", resource: "poddisruptionbudgets", verb: "create"},
+	{resource: "services", verb: "create"},
+	{resource: "secrets", verb: "create"},
+	{resource: "configmaps", verb: "create"},
+	{resource: "pods", verb: "delete"},
+	{resource: "pods", subresource: "exec", verb: "create"},
+	{resource: "persistentvolumeclaims", verb: "delete"},
+	{resource: "nodes", verb: "get", clusterScoped: true},
+	{group: admissionv1.GroupName, resource: "mutatingwebhookconfigurations", verb: "update", clusterScoped: true},
+	{group: admissionv1.GroupName, resource: "validatingwebhookconfigurations", verb: "update", clusterScoped: true},
+}
+
+// preflightChecker inspects a cluster for problems that would prevent the
+// operator from working.
+type preflightChecker struct {
+	client         kubernetes.Interface
+	namespace      string
+	watchNamespace string
+	serviceAccount string
+	findings       []preflightFinding
+}
+
+// runPreflight implements the preflight subcommand. It checks the target
+// cluster for the operator's requirements and prints actionable findings. It
+// can be run both before and after installing the operator.
+func runPreflight(args []string) int {
+	var kubeconfig string
+	checker := &preflightChecker{}
+
+	fs := flag.NewFlagSet("preflight", flag.ExitOnError)
+	fs.StringVar(&kubeconfig, "kubeconfig", "", "Path to a kubeconfig. Defaults to $KUBECONFIG or the in-cluster configuration.")
+	fs.StringVar(&checker.namespace, "namespace", defaultOperatorNamespace, "The namespace the operator is installed in.")
+	fs.StringVar(&checker.watchNamespace, "watch-namespace", "", "The namespace the operator watches. Empty means all namespaces.")
+	fs.StringVar(&checker.serviceAccount, "service-account", defaultOperatorServiceAccount, "The service account the operator runs as.")
+	_ = fs.Parse(args)
+
+	cfg, err := getRESTConfig(kubeconfig)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "failed to get REST config: %v\n", err)
+		return 1
+	}
+
+	checker.client, err = kubernetes.NewForConfig(cfg)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "failed to create client set: %v\n", err)
+		return 1
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Minute)
+	defer cancel()
+
+	checker.run(ctx)
+	printFindings(os.Stdout, checker.findings)
+
+	if checker.failed() {
+		return 1
+	}
+	return 0
+}
+
+// getRESTConfig returns the configuration for the kubeconfig passed to a
+// subcommand, falling back to the default controller-runtime lookup.
+func getRESTConfig(kubeconfig string) (*rest.Config, error) {
+	if kubeconfig != "" {
+		return clientcmd.BuildConfigFromFlags("", kubeconfig)
+	}
+	return ctrl.GetConfig()
+}
+
+func (c *preflightChecker) run(ctx context.Context) {
+	c.checkCRD()
+	c.checkCSRAPI()
+	c.checkRBAC(ctx)
+	c.checkWebhooks(ctx)
+	c.checkStorageClass(ctx)
+}
+
+func (c *preflightChecker) add(check string, severity preflightSeverity, message, hint string) {
+	c.findings = append(c.findings, preflightFinding{
+		check:    check,
+		severity: severity,
+		message:  message,
+		hint:     hint,
+	})
+}
+
+func (c *preflightChecker) failed() bool {
+	for _, f := range c.findings {
+		if f.severity == preflightError {
+			return true
+		}
+	}
+	return false
+}
+
+// checkCRD verifies that the CrdbCluster CRD is installed and serves the API
+// version the operator uses.
+func (c *preflightChecker) checkCRD() {
+	const check = "CRD"
+	gv := crdbv1alpha1.SchemeGroupVersion
+	hint := "install the CRD with kubectl apply -f config/crd/bases/crdb.cockroachlabs.com_crdbclusters.yaml"
+
+	groups, err := c.client.Discovery().ServerGroups()
+	if err != nil {
+		c.add(check, preflightError, fmt.Sprintf("failed to list API groups: %v", err), "")
+		return
+	}
+
+	var served []string
+	for _, g := range groups.Groups {
+		if g.Name != gv.Group {
+			continue
+		}
+		for _, v := range g.Versions {
+			served = append(served, v.Version)
+		}
+	}
+
+	if len(served) == 0 {
+		c.add(check, preflightError, fmt.Sprintf("API group %s is not served", gv.Group), hint)
+		return
+	}
+
+	resources, err := c.client.Discovery().ServerResourcesForGroupVersion(gv.String())
+	if err != nil {
+		c.add(check, preflightError,
+			fmt.Sprintf("%s is not served, the cluster serves %s", gv, strings.Join(served, ", ")), hint)
+		return
+	}
+
+	for _, r := range resources.APIResources {
+		if r.Name == crdbClusterResource {
+			c.add(check, preflightOK, fmt.Sprintf("%s is served (versions: %s)", gv, strings.Join(served, ", ")), "")
+			return
+		}
+	}
+
+	c.add(check, preflightError, fmt.Sprintf("%s does not serve %s", gv, crdbClusterResource), hint)
+}
+
+// checkCSRAPI reports which versions of the certificate signing request API
+// are available.
+func (c *preflightChecker) checkCSRAPI() {
+	const check = "CSR API"
+
+	var versions []string
+	for _, v := range []string{"v1", "v1beta1"} {
+		if _, err := c.client.Discovery().ServerResourcesForGroupVersion(csrGroup + "/" + v); err == nil {
+			versions = append(versions, csrGroup+"/"+v)
+		}
+	}
+
+	if len(versions) == 0 {
+		c.add(check, preflightWarning, "the certificate signing request API is not available",
+			"provide the node and client certificates through nodeTLSSecret and clientTLSSecret")
+		return
+	}
+
+	c.add(check, preflightOK, fmt.Sprintf("available as %s", strings.Join(versions, ", ")), "")
+}
+
+// checkRBAC verifies that the operator's service account holds the
+// permissions the operator needs.
+func (c *preflightChecker) checkRBAC(ctx context.Context) {
+	const check = "RBAC"
+	user := fmt.Sprintf("system:serviceaccount:%s:%s", c.namespace, c.serviceAccount)
+
+	var missing []string
+	for _, p := range operatorPermissions {
+		attrs := &authv1.ResourceAttributes{
+			Group:       p.group,
+			Resource:    p.resource,
+			Subresource: p.subresource,
+			Verb:        p.verb,
+		}
+		if !p.clusterScoped {
+			attrs.Namespace = c.watchNamespace
+		}
+
+		review, err := c.client.AuthorizationV1().SubjectAccessReviews().Create(ctx, &authv1.SubjectAccessReview{
+			Spec: authv1.SubjectAccessReviewSpec{
+				User: user,
+				Groups: []string{
+					"system:serviceaccounts",
+					"system:serviceaccounts:" + c.namespace,
+					"system:authenticated",
+				},
+				ResourceAttributes: attrs,
+			},
+		}, metav1.CreateOptions{})
+		if err != nil {
+			c.add(check, preflightError, fmt.Sprintf("failed to review access for %s: %v", user, err),
+				"run the preflight checks as a user that can create subjectaccessreviews")
+			return
+		}
+
+		if !review.Status.Allowed {
+			missing = append(missing, p.String())
+		}
+	}
+
+	if len(missing) > 0 {
+		c.add(check, preflightError, fmt.Sprintf("%s is missing permissions: %s", user, strings.Join(missing, ", ")),
+			"apply the operator role and role bindings, or check -namespace and -service-account")
+		return
+	}
+
+	c.add(check, preflightOK, fmt.Sprintf("%s holds the required permissions", user), "")
+}
+
+// checkWebhooks verifies that the admission webhooks for CrdbClusters are
+// registered and that the service behind them has ready endpoints. Since the
+// webhooks fail closed, an unreachable webhook blocks every change to a
+// CrdbCluster.
+func (c *preflightChecker) checkWebhooks(ctx context.Context) {
+	const check = "Webhooks"
+	hint := "install the webhook configurations from the operator manifests, or run the operator with -enable-webhooks=false"
+
+	mutating, err := c.client.AdmissionregistrationV1().MutatingWebhookConfigurations().List(ctx, metav1.ListOptions{})
+	if err != nil {
+		c.add(check, preflightError, fmt.Sprintf("failed to list mutating webhook configurations: %v", err), "")
+		return
+	}
+
+	found := false
+	for _, cfg := range mutating.Items {
+		for _, wh := range cfg.Webhooks {
+			if handlesCrdbClusters(wh.Rules) {
+				found = true
+				c.checkWebhookClientConfig(ctx, check, "mutating webhook "+wh.Name, wh.ClientConfig)
+			}
+		}
+	}
+	if !found {
+		c.add(check, preflightWarning, "no mutating webhook is registered for CrdbClusters", hint)
+	}
+
+	validating, err := c.client.AdmissionregistrationV1().ValidatingWebhookConfigurations().List(ctx, metav1.ListOptions{})
+	if err != nil {
+		c.add(check, preflightError, fmt.Sprintf("failed to list validating webhook configurations: %v", err), "")
+		return
+	}
+
+	found = false
+	for _, cfg := range validating.Items {
+		for _, wh := range cfg.Webhooks {
+			if handlesCrdbClusters(wh.Rules) {
+				found = true
+				c.checkWebhookClientConfig(ctx, check, "validating webhook "+wh.Name, wh.ClientConfig)
+			}
+		}
+	}
+	if !found {
+		c.add(check, preflightWarning, "no validating webhook is registered for CrdbClusters", hint)
+	}
+}
+
+func (c *preflightChecker) checkWebhookClientConfig(ctx context.Context, check, name string, cfg admissionv1.WebhookClientConfig) {
+	if len(cfg.CABundle) == 0 {
+		c.add(check, preflightWarning, fmt.Sprintf("%s has no CA bundle", name),
+			"the operator sets the CA bundle when it starts; check the operator logs if it is running")
+	}
+
+	if cfg.Service == nil {
+		c.add(check, preflightOK, fmt.Sprintf("%s calls %s", name, strPtrValue(cfg.URL)), "")
+		return
+	}
+
+	svc := cfg.Service.Namespace + "/" + cfg.Service.Name
+	endpoints, err := c.client.CoreV1().Endpoints(cfg.Service.Namespace).Get(ctx, cfg.Service.Name, metav1.GetOptions{})
+	if apiErrors.IsNotFound(err) {
+		c.add(check, preflightError, fmt.Sprintf("%s points at service %s which does not exist", name, svc),
+			"install the operator manifests, which create the webhook service")
+		return
+	}
+	if err != nil {
+		c.add(check, preflightError, fmt.Sprintf("failed to get endpoints of service %s: %v", svc, err), "")
+		return
+	}
+
+	ready := 0
+	for _, subset := range endpoints.Subsets {
+		ready += len(subset.Addresses)
+	}
+	if ready == 0 {
+		c.add(check, preflightError, fmt.Sprintf("service %s of %s has no ready endpoints", svc, name),
+			"make sure the operator pod is running and ready; until then CrdbClusters cannot be created or changed")
+		return
+	}
+
+	c.add(check, preflightOK, fmt.Sprintf("%s is served by %d ready endpoint(s) of service %s", name, ready, svc), "")
+}
+
+// handlesCrdbClusters returns whether the webhook rules match CrdbClusters.
+func handlesCrdbClusters(rules []admissionv1.RuleWithOperations) bool {
+	for _, r := range rules {
+		if matchesAny(r.APIGroups, crdbv1alpha1.SchemeGroupVersion.Group) &&
+			matchesAny(r.Resources, crdbClusterResource) {
+			return true
+		}
+	}
+	return false
+}
+
+func matchesAny(values []string, value string) bool {
+	for _, v := range values {
+		if v == value || v == "*" {
+			return true
+		}
+	}
+	return false
+}
+
+func strPtrValue(s *string) string {
+	if s == nil {
+		return ""
+	}
+	return *s
+}
+
+// checkStorageClass verifies that a default StorageClass exists, which is
+// used by CrdbClusters that don't set a storageClassName.
+func (c *preflightChecker) checkStorageClass(ctx context.Context) {
+	const check = "StorageClass"
+
+	classes, err := c.client.StorageV1().StorageClasses().List(ctx, metav1.ListOptions{})
+	if err != nil {
+		c.add(check, preflightError, fmt.Sprintf("failed to list storage classes: %v", err), "")
+		return
+	}
+
+	var defaults []string
+	for _, sc := range classes.Items {
+		if sc.Annotations[defaultStorageClassAnnotation] == "true" ||
+			sc.Annotations[betaDefaultStorageClassAnnotation] == "true" {
+			defaults = append(defaults, sc.Name)
+		}
+	}
+
+	switch len(defaults) {
+	case 0:
+		c.add(check, preflightWarning, "there is no default StorageClass",
+			"set spec.dataStore.pvc.spec.storageClassName in every CrdbCluster, or mark a StorageClass as default")
+	case 1:
+		c.add(check, preflightOK, fmt.Sprintf("%s is the default StorageClass", defaults[0]), "")
+	default:
+		c.add(check, preflightWarning, fmt.Sprintf("several StorageClasses are marked as default: %s",
+			strings.Join(defaults, ", ")),
+			"keep a single default StorageClass, or set spec.dataStore.pvc.spec.storageClassName in every CrdbCluster")
+	}
+}
+
+func printFindings(w io.Writer, findings []preflightFinding) {
+	for _, f := range findings {
+		fmt.Fprintf(w, "[%s] %s: %s\n", f.severity, f.check, f.message)
+		if f.hint != "" {
+			fmt.Fprintf(w, "    hint: %s\n", f.hint)
+		}
+	}
+}
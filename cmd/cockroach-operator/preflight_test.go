@@ -0,0 +1,102 @@
+/*
+Copyright 2021 The Cockroach Authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    https://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package main
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	admissionv1 "k8s.io/api/admissionregistration/v1"
+	authv1 "k8s.io/api/authorization/v1"
+	corev1 "k8s.io/api/core/v1"
+	storagev1 "k8s.io/api/storage/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	fakediscovery "k8s.io/client-go/discovery/fake"
+	"k8s.io/client-go/kubernetes/fake"
+	k8stesting "k8s.io/client-go/testing"
+)
+
+func TestPreflightChecker(t *testing.T) {
+	crdbRules := []admissionv1.RuleWithOperations{{
+		Rule: admissionv1.Rule{
+			APIGroups: []string{"crdb.cockroachlabs.com"},
+			Resources: []string{"crdbclusters"},
+		},
+	}}
+	service := &admissionv1.ServiceReference{Namespace: "default", Name: "webhook-service"}
+
+	client := fake.NewSimpleClientset(
+		&admissionv1.MutatingWebhookConfiguration{
+			ObjectMeta: metav1.ObjectMeta{Name: "mutating-webhook-configuration"},
+			Webhooks: []admissionv1.MutatingWebhook{{
+				Name:         "mcrdbcluster.kb.io",
+				Rules:        crdbRules,
+				ClientConfig: admissionv1.WebhookClientConfig{Service: service, CABundle: []byte("ca")},
+			}},
+		},
+		&corev1.Endpoints{
+			ObjectMeta: metav1.ObjectMeta{Namespace: "default", Name: "webhook-service"},
+			Subsets: []corev1.EndpointSubset{{
+				Addresses: []corev1.EndpointAddress{{IP: "10.0.0.1"}},
+			}},
+		},
+		&storagev1.StorageClass{
+			ObjectMeta: metav1.ObjectMeta{
+				Name:        "standard",
+				Annotations: map[string]string{defaultStorageClassAnnotation: "true"},
+			},
+		},
+	)
+	client.Discovery().(*fakediscovery.FakeDiscovery).Resources = []*metav1.APIResourceList{
+		{
+			GroupVersion: "crdb.cockroachlabs.com/v1alpha1",
+			APIResources: []metav1.APIResource{{Name: "crdbclusters"}},
+		},
+		{
+			GroupVersion: "certificates.k8s.io/v1",
+			APIResources: []metav1.APIResource{{Name: "certificatesigningrequests"}},
+		},
+	}
+	client.PrependReactor("create", "subjectaccessreviews", func(action k8stesting.Action) (bool, runtime.Object, error) {
+		review := action.(k8stesting.CreateAction).GetObject().(*authv1.SubjectAccessReview)
+		review.Status.Allowed = review.Spec.ResourceAttributes.Resource != "nodes"
+		return true, review, nil
+	})
+
+	checker := &preflightChecker{
+		client:         client,
+		namespace:      "default",
+		serviceAccount: defaultOperatorServiceAccount,
+	}
+	checker.run(context.Background())
+
+	severities := map[string][]preflightSeverity{}
+	for _, f := range checker.findings {
+		severities[f.check] = append(severities[f.check], f.severity)
+	}
+
+	require.Equal(t, map[string][]preflightSeverity{
+		"CRD":          {preflightOK},
+		"CSR API":      {preflightOK},
+		"RBAC":         {preflightError},
+		"Webhooks":     {preflightOK, preflightWarning},
+		"StorageClass": {preflightOK},
+	}, severities)
+	require.True(t, checker.failed())
+}
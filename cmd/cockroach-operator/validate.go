@@ -0,0 +1,200 @@
+/*
+Copyright 2021 The Cockroach Authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    https://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+
+	crdbv1alpha1 "github.com/cockroachdb/cockroach-operator/apis/v1alpha1"
+	"github.com/cockroachdb/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	utilyaml "k8s.io/apimachinery/pkg/util/yaml"
+	"sigs.k8s.io/yaml"
+)
+
+const crdbClusterKind = "CrdbCluster"
+
+// fileList is a flag that can be repeated to pass several files.
+type fileList []string
+
+func (f *fileList) String() string {
+	return strings.Join(*f, ",")
+}
+
+func (f *fileList) Set(value string) error {
+	*f = append(*f, value)
+	return nil
+}
+
+// validatedCluster is a CrdbCluster read from a manifest after the webhook
+// defaults have been applied.
+type validatedCluster struct {
+	source  string
+	cluster *crdbv1alpha1.CrdbCluster
+}
+
+// runValidate implements the validate subcommand. It runs the defaulting and
+// validation logic of the admission webhooks against CrdbCluster manifests
+// without talking to a cluster, so manifests can be linted before they are
+// applied. Documents of other kinds are ignored.
+func runValidate(args []string) int {
+	var files fileList
+	var output string
+
+	fs := flag.NewFlagSet("validate", flag.ExitOnError)
+	fs.Var(&files, "f", "CrdbCluster manifest to validate, or - to read from stdin. Can be repeated.")
+	fs.StringVar(&output, "o", "", "Print the defaulted CrdbClusters in the given format (yaml or json).")
+	_ = fs.Parse(args)
+
+	if len(files) == 0 || fs.NArg() != 0 {
+		fmt.Fprintln(os.Stderr, "usage: cockroach-operator validate -f <file> [-f <file>...] [-o yaml|json]")
+		return 2
+	}
+	if output != "" && output != "yaml" && output != "json" {
+		fmt.Fprintf(os.Stderr, "unsupported output format %q\n", output)
+		return 2
+	}
+
+	var clusters []validatedCluster
+	failed := false
+	for _, file := range files {
+		validated, errs := validateFile(file)
+		for _, err := range errs {
+			fmt.Fprintf(os.Stderr, "%s: %v\n", file, err)
+		}
+		failed = failed || len(errs) > 0
+		clusters = append(clusters, validated...)
+	}
+
+	if output == "" {
+		for _, c := range clusters {
+			fmt.Printf("%s: %s %q is valid\n", c.source, crdbClusterKind, c.cluster.Name)
+		}
+	} else if err := printClusters(os.Stdout, clusters, output); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 1
+	}
+
+	if failed {
+		return 1
+	}
+	return 0
+}
+
+func validateFile(file string) ([]validatedCluster, []error) {
+	if file == "-" {
+		return validateClusters("<stdin>", os.Stdin)
+	}
+
+	f, err := os.Open(file)
+	if err != nil {
+		return nil, []error{err}
+	}
+	defer f.Close()
+
+	return validateClusters(file, f)
+}
+
+// validateClusters decodes every YAML document read from r, applies the webhook
+// defaults to each CrdbCluster and validates it as the webhook would on create.
+// It returns the clusters that passed validation and an error for each document
+// that did not.
+func validateClusters(source string, r io.Reader) ([]validatedCluster, []error) {
+	var clusters []validatedCluster
+	var errs []error
+
+	reader := utilyaml.NewYAMLReader(bufio.NewReader(r))
+	for i := 0; ; i++ {
+		doc, err := reader.Read()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return clusters, append(errs, errors.Wrap(err, "failed to read manifest"))
+		}
+
+		cluster, err := validateDocument(doc)
+		if err != nil {
+			errs = append(errs, errors.Wrapf(err, "document %d", i+1))
+			continue
+		}
+		if cluster != nil {
+			clusters = append(clusters, validatedCluster{source: source, cluster: cluster})
+		}
+	}
+
+	return clusters, errs
+}
+
+// validateDocument returns the defaulted CrdbCluster in doc, or nil if the
+// document is empty or holds another kind of object.
+func validateDocument(doc []byte) (*crdbv1alpha1.CrdbCluster, error) {
+	var typeMeta metav1.TypeMeta
+	if err := yaml.Unmarshal(doc, &typeMeta); err != nil {
+		return nil, errors.Wrap(err, "failed to parse document")
+	}
+	if typeMeta.Kind != crdbClusterKind {
+		return nil, nil
+	}
+	if typeMeta.APIVersion != crdbv1alpha1.SchemeGroupVersion.String() {
+		return nil, errors.Newf("unsupported apiVersion %q for %s, expected %s",
+			typeMeta.APIVersion, crdbClusterKind, crdbv1alpha1.SchemeGroupVersion)
+	}
+
+	// Unknown fields would be silently pruned by the API server, which usually
+	// means a typo in the manifest.
+	cluster := &crdbv1alpha1.CrdbCluster{}
+	if err := yaml.UnmarshalStrict(doc, cluster); err != nil {
+		return nil, errors.Wrap(err, "failed to decode CrdbCluster")
+	}
+
+	cluster.Default()
+	if err := cluster.ValidateCreate(); err != nil {
+		return nil, errors.Wrapf(err, "%s %q is invalid", crdbClusterKind, cluster.Name)
+	}
+
+	return cluster, nil
+}
+
+func printClusters(w io.Writer, clusters []validatedCluster, format string) error {
+	for i, c := range clusters {
+		var out []byte
+		var err error
+		if format == "json" {
+			out, err = json.MarshalIndent(c.cluster, "", "  ")
+			out = append(out, '\n')
+		} else {
+			out, err = yaml.Marshal(c.cluster)
+			if i > 0 {
+				out = append([]byte("---\n"), out...)
+			}
+		}
+		if err != nil {
+			return errors.Wrapf(err, "failed to encode %s %q", crdbClusterKind, c.cluster.Name)
+		}
+		if _, err := w.Write(out); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,79 @@
+/*
+Copyright 2021 The Cockroach Authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    https://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package main
+
+import (
+	"strings"
+	"testing"
+
+	crdbv1alpha1 "github.com/cockroachdb/cockroach-operator/apis/v1alpha1"
+	"github.com/stretchr/testify/require"
+)
+
+const validateManifest = `
+apiVersion: v1
+kind: Namespace
+metadata:
+  name: crdb
+---
+apiVersion: crdb.cockroachlabs.com/v1alpha1
+kind: CrdbCluster
+metadata:
+  name: cockroachdb
+spec:
+  nodes: 3
+  image:
+    name: cockroachdb/cockroach:v21.1.7
+  dataStore:
+    pvc:
+      spec:
+        accessModes:
+          - ReadWriteOnce
+---
+apiVersion: crdb.cockroachlabs.com/v1alpha1
+kind: CrdbCluster
+metadata:
+  name: typo
+spec:
+  node: 3
+---
+apiVersion: crdb.cockroachlabs.com/v1beta1
+kind: CrdbCluster
+metadata:
+  name: wrong-version
+`
+
+func TestValidateClusters(t *testing.T) {
+	clusters, errs := validateClusters("test.yaml", strings.NewReader(validateManifest))
+
+	require.Len(t, clusters, 1)
+	require.Equal(t, "test.yaml", clusters[0].source)
+
+	cluster := clusters[0].cluster
+	require.Equal(t, "cockroachdb", cluster.Name)
+	require.Equal(t, int32(3), cluster.Spec.Nodes)
+	require.Equal(t, &crdbv1alpha1.DefaultGRPCPort, cluster.Spec.GRPCPort)
+	require.Equal(t, &crdbv1alpha1.DefaultSQLPort, cluster.Spec.SQLPort)
+	require.Equal(t, &crdbv1alpha1.DefaultHTTPPort, cluster.Spec.HTTPPort)
+	require.NotNil(t, cluster.Spec.Image.PullPolicyName)
+
+	require.Len(t, errs, 2)
+	require.Contains(t, errs[0].Error(), "document 3")
+	require.Contains(t, errs[0].Error(), `unknown field "node"`)
+	require.Contains(t, errs[1].Error(), "document 4")
+	require.Contains(t, errs[1].Error(), "unsupported apiVersion")
+}
@@ -16,6 +16,7 @@ require (
 	github.com/gosimple/slug v1.9.0
 	github.com/jackc/pgx/v4 v4.9.0
 	github.com/octago/sflags v0.2.0
+	github.com/prometheus/client_golang v1.7.1
 	github.com/spf13/pflag v1.0.5
 	github.com/stretchr/testify v1.7.0
 	go.uber.org/zap v1.15.0
@@ -0,0 +1,165 @@
+/*
+Copyright 2021 The Cockroach Authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    https://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// This program generates the Argo CD health check of CrdbCluster resources
+// from the health rules of the API, see apis/v1alpha1/health.go.
+
+package main
+
+import (
+	"flag"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"text/template"
+
+	api "github.com/cockroachdb/cockroach-operator/apis/v1alpha1"
+)
+
+const script = `-- Code generated by hack/argocdhealth from apis/v1alpha1/health.go. DO NOT EDIT.
+--
+-- Argo CD health check of crdb.cockroachlabs.com/CrdbCluster resources. Add it
+-- to the argocd-cm ConfigMap under the
+-- resource.customizations.health.crdb.cockroachlabs.com_CrdbCluster key.
+hs = {}
+
+if obj.spec ~= nil and obj.spec.paused == true then
+  hs.status = "{{.Suspended}}"
+  hs.message = "{{.PausedMessage}}"
+  return hs
+end
+
+local observed = 0
+if obj.status ~= nil and obj.status.observedGeneration ~= nil then
+  observed = obj.status.observedGeneration
+end
+if obj.status == nil or (obj.metadata.generation ~= nil and observed < obj.metadata.generation) then
+  hs.status = "{{.Progressing}}"
+  hs.message = "{{.NotObservedMessage}}"
+  return hs
+end
+
+local function findAction(status)
+  if obj.status.operatorActions == nil then
+    return nil
+  end
+  for _, action in ipairs(obj.status.operatorActions) do
+    if action.status == status then
+      return action
+    end
+  end
+  return nil
+end
+
+local function findCondition(ctype, status)
+  if obj.status.conditions == nil then
+    return nil
+  end
+  for _, condition in ipairs(obj.status.conditions) do
+    if condition.type == ctype and condition.status == status then
+      return condition
+    end
+  end
+  return nil
+end
+
+local action
+{{- range .ActionRules}}
+
+action = findAction("{{.Status}}")
+if action ~= nil then
+  hs.status = "{{.Health}}"
+  hs.message = "Action " .. action.type .. " is {{.Status}}: " .. (action.message or "")
+  return hs
+end
+{{- end}}
+
+local condition
+{{- range .Rules}}
+
+condition = findCondition("{{.Condition}}", "{{.Status}}")
+if condition ~= nil then
+  hs.status = "{{.Health}}"
+  if condition.message ~= nil and condition.message ~= "" then
+    hs.message = condition.message
+  else
+    hs.message = "{{.Condition}} is {{.Status}}"
+  end
+  return hs
+end
+{{- end}}
+
+hs.status = "{{.Healthy}}"
+return hs
+`
+
+type actionRule struct {
+	Status string
+	Health api.HealthStatus
+}
+
+type scriptData struct {
+	Healthy            api.HealthStatus
+	Progressing        api.HealthStatus
+	Suspended          api.HealthStatus
+	PausedMessage      string
+	NotObservedMessage string
+	ActionRules        []actionRule
+	Rules              []api.HealthRule
+}
+
+// generate writes the health check script of the rules
+func generate(w io.Writer) error {
+	data := scriptData{
+		Healthy:            api.HealthHealthy,
+		Progressing:        api.HealthProgressing,
+		Suspended:          api.HealthSuspended,
+		PausedMessage:      api.HealthPausedMessage,
+		NotObservedMessage: api.HealthNotObservedMessage,
+		Rules:              api.HealthRules,
+	}
+	for _, rule := range api.HealthActionRules {
+		data.ActionRules = append(data.ActionRules, actionRule{Status: rule.Status.String(), Health: rule.Health})
+	}
+
+	tpl, err := template.New("health.lua").Parse(script)
+	if err != nil {
+		return fmt.Errorf("cannot parse the script template: %w", err)
+	}
+	return tpl.Execute(w, data)
+}
+
+func main() {
+	log.SetFlags(0)
+	output := flag.String("output", "", "Path of the generated Lua script")
+	flag.Parse()
+
+	if *output == "" {
+		flag.PrintDefaults()
+		os.Exit(1)
+	}
+
+	f, err := os.Create(*output)
+	if err != nil {
+		log.Fatalf("Cannot create output file: %s", err)
+	}
+	defer f.Close()
+
+	if err := generate(f); err != nil {
+		log.Fatalf("Cannot generate the health check: %s", err)
+	}
+}
@@ -0,0 +1,41 @@
+/*
+Copyright 2021 The Cockroach Authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    https://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package main
+
+import (
+	"bytes"
+	"io/ioutil"
+	"testing"
+)
+
+// TestScriptIsUpToDate checks that the health check script was generated again
+// after a change of the health rules.
+func TestScriptIsUpToDate(t *testing.T) {
+	var generated bytes.Buffer
+	if err := generate(&generated); err != nil {
+		t.Fatalf("cannot generate the script: %s", err)
+	}
+
+	committed, err := ioutil.ReadFile("../../config/argocd/health.lua")
+	if err != nil {
+		t.Fatalf("cannot read the committed script: %s", err)
+	}
+
+	if !bytes.Equal(generated.Bytes(), committed) {
+		t.Fatal("config/argocd/health.lua is out of date, run make release/gen-argocd-health")
+	}
+}
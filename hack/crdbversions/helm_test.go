@@ -0,0 +1,260 @@
+/*
+Copyright 2021 The Cockroach Authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    https://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package main
+
+import (
+	"bytes"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"regexp"
+	"strings"
+	"testing"
+
+	"gopkg.in/yaml.v2"
+)
+
+// The templates of the Helm chart are generated from config/templates/helm,
+// separately from the manifests. These tests check that the generated chart
+// is up to date and in sync with the templates the other manifests are
+// generated from.
+
+var copyrightYear = regexp.MustCompile(`Copyright (\d{4}) `)
+
+type resource = map[interface{}]interface{}
+
+// repoRoot returns the root of the repository, in the runfiles of the test
+// when it runs with bazel.
+func repoRoot() string {
+	runFiles, project := os.Getenv("RUNFILES_DIR"), os.Getenv("TEST_WORKSPACE")
+	if runFiles != "" && project != "" {
+		return filepath.Join(runFiles, project)
+	}
+	return filepath.Join("..", "..")
+}
+
+func parseResources(t *testing.T, name string, contents []byte) []resource {
+	var resources []resource
+	decoder := yaml.NewDecoder(bytes.NewReader(contents))
+	for {
+		var r resource
+		err := decoder.Decode(&r)
+		if err == io.EOF {
+			return resources
+		}
+		if err != nil {
+			t.Fatalf("cannot parse `%s`: %s", name, err)
+		}
+		if r != nil {
+			resources = append(resources, r)
+		}
+	}
+}
+
+// helmResources parses the resources of a template of the chart.
+func helmResources(t *testing.T, template string) []resource {
+	name := filepath.Join("helm/cockroach-operator/templates", template)
+	contents, err := ioutil.ReadFile(filepath.Join(repoRoot(), name))
+	if err != nil {
+		t.Fatalf("cannot read `%s`: %s", name, err)
+	}
+	return parseResources(t, name, []byte(stripHelm(string(contents))))
+}
+
+// testTemplateData returns the data the templates are generated with for the
+// supported versions.
+func testTemplateData(t *testing.T) templateData {
+	f, err := os.Open(filepath.Join(repoRoot(), "crdb-versions.yaml"))
+	if err != nil {
+		t.Fatalf("cannot open the versions file: %s", err)
+	}
+	defer f.Close()
+	vs, err := readCrdbVersions(f)
+	if err != nil {
+		t.Fatalf("cannot read the versions file: %s", err)
+	}
+	data, err := generateTemplateData(vs, "0.0.0")
+	if err != nil {
+		t.Fatalf("cannot generate template data: %s", err)
+	}
+	return data
+}
+
+// operatorResources parses the resources the operator template generates
+// for the supported versions.
+func operatorResources(t *testing.T) []resource {
+	data := testTemplateData(t)
+	name := "config/templates/operator.yaml.in"
+	contents, err := ioutil.ReadFile(filepath.Join(repoRoot(), name))
+	if err != nil {
+		t.Fatalf("cannot read `%s`: %s", name, err)
+	}
+	var output bytes.Buffer
+	if err := generateFile(name, string(contents), &output, data); err != nil {
+		t.Fatalf("cannot generate `%s`: %s", name, err)
+	}
+	return parseResources(t, name, output.Bytes())
+}
+
+// field returns the value at the path of keys of the resource, nil if there
+// is none.
+func field(r resource, path ...string) interface{} {
+	var value interface{} = r
+	for _, key := range path {
+		m, ok := value.(resource)
+		if !ok {
+			return nil
+		}
+		value = m[key]
+	}
+	return value
+}
+
+// find returns the resource of the kind with the name, nil if there is none.
+func find(resources []resource, kind, name string) resource {
+	for _, r := range resources {
+		if field(r, "kind") == kind && field(r, "metadata", "name") == name {
+			return r
+		}
+	}
+	return nil
+}
+
+func TestHelmTemplatesAreGenerated(t *testing.T) {
+	data := testTemplateData(t)
+	for _, f := range helmTargets {
+		expected, err := ioutil.ReadFile(filepath.Join(repoRoot(), f.output))
+		if err != nil {
+			t.Fatalf("cannot read `%s`: %s", f.output, err)
+		}
+		contents, err := ioutil.ReadFile(filepath.Join(repoRoot(), f.template))
+		if err != nil {
+			t.Fatalf("cannot read `%s`: %s", f.template, err)
+		}
+
+		// the files are only generated again when the templates change
+		if m := copyrightYear.FindSubmatch(expected); m != nil {
+			data.Year = string(m[1])
+		}
+		data.GeneratedWarning = generatedWarning(f.template)
+		var output bytes.Buffer
+		if err := generateHelmFile(filepath.Base(f.output), string(contents), &output, data); err != nil {
+			t.Fatalf("cannot generate `%s`: %s", f.output, err)
+		}
+		if output.String() != string(expected) {
+			t.Errorf("`%s` is not generated from `%s`, run make release/gen-templates", f.output, f.template)
+		}
+		if err := verifyHelmLoads(filepath.Join(repoRoot(), f.output)); err != nil {
+			t.Errorf("cannot load `%s`: %s", f.output, err)
+		}
+	}
+}
+
+func TestHelmRBACMatchesOperatorTemplate(t *testing.T) {
+	operator := operatorResources(t)
+	for _, template := range []string{"rbac.yaml", "serviceaccount.yaml"} {
+		for _, r := range helmResources(t, template) {
+			kind, _ := field(r, "kind").(string)
+			name, _ := field(r, "metadata", "name").(string)
+			expected := find(operator, kind, name)
+			if expected == nil {
+				t.Errorf("%s %s of `%s` is not in the operator template", kind, name, template)
+				continue
+			}
+			for _, key := range []string{"rules", "roleRef"} {
+				if !reflect.DeepEqual(field(expected, key), field(r, key)) {
+					t.Errorf("the %s of %s %s of `%s` differ from the operator template", key, kind, name, template)
+				}
+			}
+		}
+	}
+}
+
+func TestHelmDeploymentMatchesOperatorTemplate(t *testing.T) {
+	operator := find(operatorResources(t), "Deployment", "cockroach-operator")
+	if operator == nil {
+		t.Fatal("the operator template has no deployment")
+	}
+	helm := find(helmResources(t, "deployment.yaml"), "Deployment", "cockroach-operator")
+	if helm == nil {
+		t.Fatal("the chart has no deployment")
+	}
+
+	path := []string{"spec", "template", "spec", "serviceAccountName"}
+	if expected, actual := field(operator, path...), field(helm, path...); expected != actual {
+		t.Errorf("the service account of the chart is %v, not %v", actual, expected)
+	}
+
+	// the images of the supported versions are values of the chart
+	env := func(r resource) []interface{} {
+		var names []interface{}
+		containers, _ := field(r, "spec", "template", "spec", "containers").([]interface{})
+		for _, c := range containers {
+			vars, _ := field(c.(resource), "env").([]interface{})
+			for _, v := range vars {
+				name := field(v.(resource), "name")
+				if s, _ := name.(string); s != helmValue && !strings.HasPrefix(s, "RELATED_IMAGE_") {
+					names = append(names, name)
+				}
+			}
+		}
+		return names
+	}
+	if expected, actual := env(operator), env(helm); !reflect.DeepEqual(expected, actual) {
+		t.Errorf("the environment of the chart is %v, not %v", actual, expected)
+	}
+}
+
+func TestHelmWebhooksMatchGeneratedWebhooks(t *testing.T) {
+	name := "config/webhook/manifests.yaml"
+	contents, err := ioutil.ReadFile(filepath.Join(repoRoot(), name))
+	if err != nil {
+		t.Fatalf("cannot read `%s`: %s", name, err)
+	}
+	generated := parseResources(t, name, contents)
+	helm := helmResources(t, "webhook.yaml")
+
+	configurations := map[string]string{
+		"MutatingWebhookConfiguration":   "mutating-webhook-configuration",
+		"ValidatingWebhookConfiguration": "validating-webhook-configuration",
+	}
+	for kind, configuration := range configurations {
+		expected := find(generated, kind, configuration)
+		actual := find(helm, kind, configuration)
+		if expected == nil || actual == nil {
+			t.Errorf("%s is missing from `%s` or from the chart", kind, name)
+			continue
+		}
+
+		expectedHooks, _ := field(expected, "webhooks").([]interface{})
+		actualHooks, _ := field(actual, "webhooks").([]interface{})
+		if len(expectedHooks) != len(actualHooks) {
+			t.Errorf("the chart has %d webhooks of kind %s, not %d", len(actualHooks), kind, len(expectedHooks))
+			continue
+		}
+		for i := range expectedHooks {
+			e, a := expectedHooks[i].(resource), actualHooks[i].(resource)
+			for _, path := range [][]string{{"name"}, {"admissionReviewVersions"}, {"clientConfig", "service", "path"}, {"rules"}, {"sideEffects"}} {
+				if !reflect.DeepEqual(field(e, path...), field(a, path...)) {
+					t.Errorf("the %s of webhook %v differ from `%s`", strings.Join(path, "."), field(e, "name"), name)
+				}
+			}
+		}
+	}
+}
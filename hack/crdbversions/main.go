@@ -28,6 +28,7 @@ import (
 	"log"
 	"os"
 	"path/filepath"
+	"regexp"
 	"sort"
 	"strings"
 	"text/template"
@@ -44,19 +45,67 @@ var targets = []struct{ template, output string }{
 	{"config/templates/crdb-tls-example.yaml.in", "config/samples/crdb-tls-example.yaml"},
 	{"config/templates/example.yaml.in", "examples/example.yaml"},
 	{"config/templates/client-secure-operator.yaml.in", "examples/client-secure-operator.yaml"},
+	{"config/templates/csv_patch.yaml.in", "config/manifests/patches/csv_patch.yaml"},
+	{"config/templates/storage_migration_job.yaml.in", "manifests/storage_migration_job.yaml"},
+	{"config/templates/operator.yaml.in", "config/install/base/operator.yaml"},
+	{"config/templates/install/openshift_patch.yaml.in", "config/install/openshift/openshift_patch.yaml"},
+	{"config/templates/helm/Chart.yaml.in", "helm/cockroach-operator/Chart.yaml"},
+	{"config/templates/helm/values.yaml.in", "helm/cockroach-operator/values.yaml"},
+	// The CRD has no template directives, it is copied to keep the chart in sync
+	{"config/crd/bases/crdb.cockroachlabs.com_crdbclusters.yaml", "helm/cockroach-operator/crds/crdb.cockroachlabs.com_crdbclusters.yaml"},
 }
 
+// List of the templates of the Helm chart and destinations. The actions of
+// this program are delimited by [[ and ]] in these templates, so that the
+// actions of Helm are copied as they are.
+var helmTargets = []struct{ template, output string }{
+	{"config/templates/helm/templates/_helpers.tpl.in", "helm/cockroach-operator/templates/_helpers.tpl"},
+	{"config/templates/helm/templates/NOTES.txt.in", "helm/cockroach-operator/templates/NOTES.txt"},
+	{"config/templates/helm/templates/deployment.yaml.in", "helm/cockroach-operator/templates/deployment.yaml"},
+	{"config/templates/helm/templates/rbac.yaml.in", "helm/cockroach-operator/templates/rbac.yaml"},
+	{"config/templates/helm/templates/serviceaccount.yaml.in", "helm/cockroach-operator/templates/serviceaccount.yaml"},
+	{"config/templates/helm/templates/webhook.yaml.in", "helm/cockroach-operator/templates/webhook.yaml"},
+}
+
+// helmValue replaces the values of the Helm actions in the stripped templates
+const helmValue = "HELM_VALUE"
+
+var (
+	helmComment = regexp.MustCompile(`(?s)\{\{-?\s*/\*.*?\*/\s*-?\}\}`)
+	helmControl = regexp.MustCompile(`^\s*\{\{.*\}\}\s*$`)
+	helmAction  = regexp.MustCompile(`\{\{.*?\}\}`)
+)
+
+const (
+	rhCrdbRepository        = "registry.connect.redhat.com/cockroachdb/cockroach"
+	rhCrdbPlaceholderPrefix = "RH_COCKROACH_DB_IMAGE_PLACEHOLDER_"
+)
+
 // crdb-versions.yaml structure
 type crdbVersions struct {
 	CrdbVersions []string `yaml:"CrdbVersions"`
 }
 
+// crdb-versions metadata structure, generated by hack/update_crdb_versions
+type crdbVersionsMetadata struct {
+	CrdbVersions []struct {
+		Version string `yaml:"Version"`
+		Digest  string `yaml:"Digest"`
+	} `yaml:"CrdbVersions"`
+}
+
 type templateData struct {
 	CrdbVersions            []*semver.Version
 	LatestStableCrdbVersion string
 	OperatorVersion         string
 	GeneratedWarning        string
 	Year                    string
+	// CrdbDigests maps CRDB versions to the digests of their RedHat Connect
+	// images. It is empty unless a metadata file is passed.
+	CrdbDigests map[string]string
+	// Disconnected is set when all stable versions can be pinned by digest,
+	// which is required to install the operator in air-gapped clusters.
+	Disconnected bool
 }
 
 // readCrdbVersions reads CRDB versions from a YAML file and sorts them
@@ -82,6 +131,37 @@ func readCrdbVersions(r io.Reader) ([]*semver.Version, error) {
 	return vs, nil
 }
 
+// readCrdbDigests reads the image digests from a CRDB versions metadata file.
+// The file can be in either YAML or JSON format.
+func readCrdbDigests(r io.Reader) (map[string]string, error) {
+	contents, err := io.ReadAll(r)
+	if err != nil {
+		return nil, fmt.Errorf("cannot open CRDB versions metadata file: %w", err)
+	}
+	var metadata crdbVersionsMetadata
+	if err := yaml.Unmarshal(contents, &metadata); err != nil {
+		return nil, fmt.Errorf("cannot parse CRDB versions metadata file: %w", err)
+	}
+	digests := make(map[string]string)
+	for _, m := range metadata.CrdbVersions {
+		if m.Digest != "" {
+			digests[m.Version] = m.Digest
+		}
+	}
+	return digests, nil
+}
+
+// setDigests adds the image digests to the template data
+func (data *templateData) setDigests(digests map[string]string) {
+	data.CrdbDigests = digests
+	data.Disconnected = len(digests) > 0
+	for _, v := range data.CrdbVersions {
+		if _, ok := digests[v.Original()]; isStable(*v) && !ok {
+			data.Disconnected = false
+		}
+	}
+}
+
 func generateTemplateData(crdbVersions []*semver.Version, operatorVersion string) (templateData, error) {
 	var data templateData
 	data.Year = fmt.Sprint(time.Now().Year())
@@ -109,19 +189,70 @@ func dotsToUnderscore(v string) string {
 	return strings.ReplaceAll(v, ".", "_")
 }
 
+// trimV removes the leading "v" from a version, as required by OLM semver
+// ranges.
+func trimV(v string) string {
+	return strings.TrimPrefix(v, "v")
+}
+
+// rhImage returns the RedHat Connect image of the given CRDB version pinned
+// by digest if the digest is known, and the placeholder replaced with the
+// tagged image at release time otherwise.
+func rhImage(digests map[string]string, version string) string {
+	if digest, ok := digests[version]; ok {
+		return fmt.Sprintf("%s@%s", rhCrdbRepository, digest)
+	}
+	return rhCrdbPlaceholderPrefix + dotsToUnderscore(version)
+}
+
 func generateFile(name string, tplText string, output io.Writer, data templateData) error {
+	return generate(template.New(name), tplText, output, data)
+}
+
+// generateHelmFile generates a template of the Helm chart, whose actions are
+// delimited by [[ and ]].
+func generateHelmFile(name string, tplText string, output io.Writer, data templateData) error {
+	return generate(template.New(name).Delims("[[", "]]"), tplText, output, data)
+}
+
+func generate(tpl *template.Template, tplText string, output io.Writer, data templateData) error {
 	// Template functions
 	funcs := template.FuncMap{
 		"underscore": dotsToUnderscore,
 		"stable":     isStable,
+		"trimv":      trimV,
+		"rhImage": func(version string) string {
+			return rhImage(data.CrdbDigests, version)
+		},
 	}
-	tpl, err := template.New(name).Funcs(funcs).Parse(tplText)
+	tpl, err := tpl.Funcs(funcs).Parse(tplText)
 	if err != nil {
-		return fmt.Errorf("cannot parse `%s`: %w", name, err)
+		return fmt.Errorf("cannot parse `%s`: %w", tpl.Name(), err)
 	}
 	return tpl.Execute(output, data)
 }
 
+// generatedWarning returns the warning added to the files generated from the
+// template.
+func generatedWarning(template string) string {
+	return fmt.Sprintf("Generated, do not edit. Please edit this file instead: %s", template)
+}
+
+// stripHelm removes the actions of a Helm template, so that the resources it
+// renders can be parsed: the lines of the control actions are dropped and the
+// values are replaced with a placeholder.
+func stripHelm(text string) string {
+	text = helmComment.ReplaceAllString(text, "")
+	var lines []string
+	for _, line := range strings.Split(text, "\n") {
+		if helmControl.MatchString(line) {
+			continue
+		}
+		lines = append(lines, helmAction.ReplaceAllString(line, helmValue))
+	}
+	return strings.Join(lines, "\n")
+}
+
 // verifyYamlLoads tries to open a YAML file and parses its content in order to
 // verify that the generated file doesn't have any syntax errors
 func verifyYamlLoads(fName string) error {
@@ -136,11 +267,61 @@ func verifyYamlLoads(fName string) error {
 	return nil
 }
 
+// verifyHelmLoads verifies that the resources of a generated YAML template of
+// the Helm chart can be parsed once the actions of Helm are stripped. The
+// other files of the chart are not verified.
+func verifyHelmLoads(fName string) error {
+	if filepath.Ext(fName) != ".yaml" {
+		return nil
+	}
+	contents, err := ioutil.ReadFile(fName)
+	if err != nil {
+		return fmt.Errorf("cannot read file `%s`: %w", fName, err)
+	}
+	var data struct{}
+	if err := yaml.Unmarshal([]byte(stripHelm(string(contents))), &data); err != nil {
+		return fmt.Errorf("cannot parse Helm template: %w", err)
+	}
+	return nil
+}
+
+type generateFunc func(name string, tplText string, output io.Writer, data templateData) error
+
+// generateTarget generates the output file of the target from its template,
+// relative to the repository root, and verifies it.
+func generateTarget(repoRoot, template, output string, data templateData, generate generateFunc, verify func(string) error) {
+	tplFile := filepath.Join(repoRoot, template)
+	outputFile := filepath.Join(repoRoot, output)
+	log.Printf("generating `%s` from `%s`", outputFile, tplFile)
+	name := filepath.Base(outputFile)
+	tplContents, err := ioutil.ReadFile(tplFile)
+	if err != nil {
+		log.Fatalf("Cannot read template file `%s`: %s", tplFile, err)
+	}
+	out, err := os.Create(outputFile)
+	if err != nil {
+		log.Fatalf("Cannot create `%s`: %s", outputFile, err)
+	}
+
+	data.GeneratedWarning = generatedWarning(template)
+	if err := generate(name, string(tplContents), out, data); err != nil {
+		log.Fatalf("Cannot generate %s: %s", output, err)
+	}
+	if err := out.Close(); err != nil {
+		log.Fatalf("Cannot close `%s`: %s", outputFile, err)
+	}
+	log.Printf("verifying `%s`", outputFile)
+	if err := verify(outputFile); err != nil {
+		log.Fatalf("Cannot load YAML `%s`: %s", outputFile, err)
+	}
+}
+
 func main() {
 	log.SetFlags(0)
 	crdbVersionsFile := flag.String("crdb-versions", "", "YAML file with CRDB versions")
 	operatorVersion := flag.String("operator-version", "", "Current operator version")
 	repoRoot := flag.String("repo-root", "", "Git repository root")
+	crdbVersionsMetadataFile := flag.String("crdb-versions-metadata", "", "Optional YAML or JSON file with CRDB image digests, used to pin images by digest")
 	flag.Parse()
 
 	if *crdbVersionsFile == "" || *operatorVersion == "" || *repoRoot == "" {
@@ -164,30 +345,23 @@ func main() {
 		log.Fatalf("Cannot generate template data: %s", err)
 	}
 
-	for _, f := range targets {
-		tplFile := filepath.Join(*repoRoot, f.template)
-		outputFile := filepath.Join(*repoRoot, f.output)
-		log.Printf("generating `%s` from `%s`", outputFile, tplFile)
-		name := filepath.Base(outputFile)
-		tplContents, err := ioutil.ReadFile(tplFile)
+	if *crdbVersionsMetadataFile != "" {
+		mf, err := os.Open(*crdbVersionsMetadataFile)
 		if err != nil {
-			log.Fatalf("Cannot read template file `%s`: %s", tplFile, err)
+			log.Fatalf("Cannot open versions metadata file: %s", err)
 		}
-		output, err := os.Create(outputFile)
+		digests, err := readCrdbDigests(mf)
+		mf.Close()
 		if err != nil {
-			log.Fatalf("Cannot create `%s`: %s", outputFile, err)
+			log.Fatalf("Cannot read versions metadata file: %s", err)
 		}
+		data.setDigests(digests)
+	}
 
-		data.GeneratedWarning = fmt.Sprintf("Generated, do not edit. Please edit this file instead: %s", f.template)
-		if err := generateFile(name, string(tplContents), output, data); err != nil {
-			log.Fatalf("Cannot generate %s: %s", f.output, err)
-		}
-		if err := output.Close(); err != nil {
-			log.Fatalf("Cannot close `%s`: %s", outputFile, err)
-		}
-		log.Printf("verifying `%s`", outputFile)
-		if err := verifyYamlLoads(outputFile); err != nil {
-			log.Fatalf("Cannot load YAML `%s`: %s", outputFile, err)
-		}
+	for _, f := range targets {
+		generateTarget(*repoRoot, f.template, f.output, data, generateFile, verifyYamlLoads)
+	}
+	for _, f := range helmTargets {
+		generateTarget(*repoRoot, f.template, f.output, data, generateHelmFile, verifyHelmLoads)
 	}
 }
@@ -136,3 +136,72 @@ func TestGenerateFile(t *testing.T) {
 		t.Errorf("Expected `%s`, got `%s`", expected, output.String())
 	}
 }
+
+func TestTrimV(t *testing.T) {
+	tests := []struct {
+		version  string
+		expected string
+	}{
+		{"v2.1.0", "2.1.0"},
+		{"2.1.0", "2.1.0"},
+	}
+	for _, tc := range tests {
+		got := trimV(tc.version)
+		if got != tc.expected {
+			t.Errorf("expected %q for trimV(`%s`), got %s", tc.expected, tc.version, got)
+		}
+	}
+}
+
+func TestReadCrdbDigests(t *testing.T) {
+	s := `
+CrdbVersions:
+- Version: v21.1.0
+  Digest: sha256:abc
+  PublishDate: "2021-05-18T11:00:00+00:00"
+  Architectures:
+  - amd64
+- Version: v21.1.1
+`
+	digests, err := readCrdbDigests(strings.NewReader(s))
+	if err != nil {
+		t.Fatalf("cannot read metadata file: %s", err)
+	}
+	if len(digests) != 1 || digests["v21.1.0"] != "sha256:abc" {
+		t.Errorf("unexpected digests %v", digests)
+	}
+}
+
+func TestSetDigests(t *testing.T) {
+	var data templateData
+	for _, r := range []string{"v21.1.0", "v21.1.1", "v21.2.0-beta.1"} {
+		data.CrdbVersions = append(data.CrdbVersions, semver.MustParse(r))
+	}
+
+	data.setDigests(map[string]string{"v21.1.0": "sha256:abc"})
+	if data.Disconnected {
+		t.Error("expected Disconnected to be false when a stable version has no digest")
+	}
+
+	data.setDigests(map[string]string{"v21.1.0": "sha256:abc", "v21.1.1": "sha256:def"})
+	if !data.Disconnected {
+		t.Error("expected Disconnected to be true when all stable versions have digests")
+	}
+}
+
+func TestRHImage(t *testing.T) {
+	digests := map[string]string{"v21.1.0": "sha256:abc"}
+	tests := []struct {
+		version  string
+		expected string
+	}{
+		{"v21.1.0", "registry.connect.redhat.com/cockroachdb/cockroach@sha256:abc"},
+		{"v21.1.1", "RH_COCKROACH_DB_IMAGE_PLACEHOLDER_v21_1_1"},
+	}
+	for _, tc := range tests {
+		got := rhImage(digests, tc.version)
+		if got != tc.expected {
+			t.Errorf("expected %q for rhImage(`%s`), got %s", tc.expected, tc.version, got)
+		}
+	}
+}
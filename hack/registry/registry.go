@@ -0,0 +1,213 @@
+/*
+Copyright 2021 The Cockroach Authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    https://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// Package registry is a minimal Docker Registry HTTP API V2 client used by
+// the release tooling to check that images can be pulled.
+package registry
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+)
+
+const (
+	mediaTypeManifestList = "application/vnd.docker.distribution.manifest.list.v2+json"
+	mediaTypeManifest     = "application/vnd.docker.distribution.manifest.v2+json"
+	mediaTypeOCIIndex     = "application/vnd.oci.image.index.v1+json"
+	mediaTypeOCIManifest  = "application/vnd.oci.image.manifest.v1+json"
+
+	dockerHubRegistry = "registry-1.docker.io"
+)
+
+// ManifestList is the subset of a Docker manifest list or an OCI image index
+// used to verify the published architectures. Manifests is empty if the
+// reference points to a single architecture image.
+type ManifestList struct {
+	MediaType string `json:"mediaType"`
+	Manifests []struct {
+		Digest   string `json:"digest"`
+		Platform struct {
+			Architecture string `json:"architecture"`
+			OS           string `json:"os"`
+		} `json:"platform"`
+	} `json:"manifests"`
+}
+
+// Architectures returns the linux architectures listed in the manifest list.
+func (l ManifestList) Architectures() []string {
+	var archs []string
+	for _, m := range l.Manifests {
+		if m.Platform.OS == "" || m.Platform.OS == "linux" {
+			archs = append(archs, m.Platform.Architecture)
+		}
+	}
+	return archs
+}
+
+// Client talks to a Docker Registry HTTP API V2 endpoint using anonymous
+// bearer tokens when the registry requests them.
+type Client struct {
+	baseURL string
+	client  *http.Client
+}
+
+// NewClient creates a client for the registry at baseURL, e.g.
+// https://registry.connect.redhat.com.
+func NewClient(baseURL string) *Client {
+	return &Client{
+		baseURL: strings.TrimSuffix(baseURL, "/"),
+		client:  http.DefaultClient,
+	}
+}
+
+// ParseImage splits an image reference such as
+// registry.connect.redhat.com/cockroachdb/cockroach:v21.1.0 into the registry
+// URL, the repository and the tag or digest. Docker Hub is assumed when the
+// reference has no registry host.
+func ParseImage(image string) (baseURL, repository, reference string) {
+	name := image
+	reference = "latest"
+	if i := strings.Index(name, "@"); i >= 0 {
+		name, reference = name[:i], name[i+1:]
+	} else if i := strings.LastIndex(name, ":"); i > strings.LastIndex(name, "/") {
+		name, reference = name[:i], name[i+1:]
+	}
+
+	host := dockerHubRegistry
+	parts := strings.SplitN(name, "/", 2)
+	if len(parts) == 2 && (strings.ContainsAny(parts[0], ".:") || parts[0] == "localhost") {
+		host, name = parts[0], parts[1]
+	}
+	if host == "docker.io" {
+		host = dockerHubRegistry
+	}
+	if host == dockerHubRegistry && !strings.Contains(name, "/") {
+		name = "library/" + name
+	}
+	return "https://" + host, name, reference
+}
+
+// GetManifest fetches the manifest list, or the single image manifest, for
+// the given repository and tag or digest. An error is returned if the image
+// cannot be pulled.
+func (c *Client) GetManifest(repository, reference string) (ManifestList, error) {
+	var list ManifestList
+	manifestURL := fmt.Sprintf("%s/v2/%s/manifests/%s", c.baseURL, repository, reference)
+
+	resp, err := c.doManifestRequest(manifestURL, "")
+	if err != nil {
+		return list, err
+	}
+	if resp.StatusCode == http.StatusUnauthorized {
+		resp.Body.Close()
+		token, err := c.getToken(resp.Header.Get("WWW-Authenticate"))
+		if err != nil {
+			return list, err
+		}
+		if resp, err = c.doManifestRequest(manifestURL, token); err != nil {
+			return list, err
+		}
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return list, fmt.Errorf("cannot pull manifest for `%s:%s`: unexpected status code %d", repository, reference, resp.StatusCode)
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&list); err != nil {
+		return list, fmt.Errorf("cannot parse manifest for `%s:%s`: %w", repository, reference, err)
+	}
+	return list, nil
+}
+
+func (c *Client) doManifestRequest(manifestURL, token string) (*http.Response, error) {
+	req, err := http.NewRequest(http.MethodGet, manifestURL, nil)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Accept", strings.Join([]string{
+		mediaTypeManifestList, mediaTypeOCIIndex, mediaTypeManifest, mediaTypeOCIManifest,
+	}, ", "))
+	if token != "" {
+		req.Header.Set("Authorization", "Bearer "+token)
+	}
+	resp, err := c.client.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("cannot fetch `%s`: %w", manifestURL, err)
+	}
+	return resp, nil
+}
+
+// getToken requests an anonymous token as described by the Bearer challenge
+// returned by the registry.
+func (c *Client) getToken(challenge string) (string, error) {
+	params := parseChallenge(challenge)
+	realm, ok := params["realm"]
+	if !ok {
+		return "", fmt.Errorf("unsupported authentication challenge `%s`", challenge)
+	}
+	tokenURL, err := url.Parse(realm)
+	if err != nil {
+		return "", fmt.Errorf("cannot parse realm `%s`: %w", realm, err)
+	}
+	q := tokenURL.Query()
+	if service, ok := params["service"]; ok {
+		q.Set("service", service)
+	}
+	if scope, ok := params["scope"]; ok {
+		q.Set("scope", scope)
+	}
+	tokenURL.RawQuery = q.Encode()
+
+	resp, err := c.client.Get(tokenURL.String())
+	if err != nil {
+		return "", fmt.Errorf("cannot fetch token: %w", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return "", fmt.Errorf("cannot fetch token: unexpected status code %d", resp.StatusCode)
+	}
+	var token struct {
+		Token       string `json:"token"`
+		AccessToken string `json:"access_token"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&token); err != nil {
+		return "", fmt.Errorf("cannot parse token: %w", err)
+	}
+	if token.Token != "" {
+		return token.Token, nil
+	}
+	return token.AccessToken, nil
+}
+
+// parseChallenge parses a `Bearer realm="...",service="...",scope="..."`
+// WWW-Authenticate header value.
+func parseChallenge(challenge string) map[string]string {
+	params := make(map[string]string)
+	if !strings.HasPrefix(strings.ToLower(challenge), "bearer ") {
+		return params
+	}
+	for _, part := range strings.Split(challenge[len("bearer "):], ",") {
+		kv := strings.SplitN(strings.TrimSpace(part), "=", 2)
+		if len(kv) != 2 {
+			continue
+		}
+		params[kv[0]] = strings.Trim(kv[1], `"`)
+	}
+	return params
+}
@@ -0,0 +1,110 @@
+/*
+Copyright 2021 The Cockroach Authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    https://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package registry
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+const testManifestList = `{
+  "mediaType": "application/vnd.docker.distribution.manifest.list.v2+json",
+  "manifests": [
+    {"digest": "sha256:amd", "platform": {"architecture": "amd64", "os": "linux"}},
+    {"digest": "sha256:arm", "platform": {"architecture": "arm64", "os": "linux"}},
+    {"digest": "sha256:win", "platform": {"architecture": "amd64", "os": "windows"}}
+  ]
+}`
+
+func TestGetManifest(t *testing.T) {
+	var srv *httptest.Server
+	srv = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/token":
+			if r.URL.Query().Get("service") != "test" {
+				w.WriteHeader(http.StatusBadRequest)
+				return
+			}
+			fmt.Fprint(w, `{"token": "secret"}`)
+		case "/v2/cockroachdb/cockroach/manifests/v21.1.0":
+			if r.Header.Get("Authorization") != "Bearer secret" {
+				w.Header().Set("WWW-Authenticate", fmt.Sprintf(`Bearer realm="%s/token",service="test"`, srv.URL))
+				w.WriteHeader(http.StatusUnauthorized)
+				return
+			}
+			fmt.Fprint(w, testManifestList)
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+	defer srv.Close()
+
+	c := NewClient(srv.URL)
+	list, err := c.GetManifest("cockroachdb/cockroach", "v21.1.0")
+	if err != nil {
+		t.Fatalf("cannot get manifest: %s", err)
+	}
+	if got := strings.Join(list.Architectures(), ","); got != "amd64,arm64" {
+		t.Errorf("expected amd64,arm64 architectures, got %s", got)
+	}
+
+	if _, err := c.GetManifest("cockroachdb/cockroach", "v21.1.1"); err == nil {
+		t.Error("expected an error for a missing tag")
+	}
+}
+
+func TestParseImage(t *testing.T) {
+	tests := []struct {
+		image      string
+		baseURL    string
+		repository string
+		reference  string
+	}{
+		{"registry.connect.redhat.com/cockroachdb/cockroach:v21.1.0", "https://registry.connect.redhat.com", "cockroachdb/cockroach", "v21.1.0"},
+		{"cockroachdb/cockroach-operator:v2.1.0", "https://registry-1.docker.io", "cockroachdb/cockroach-operator", "v2.1.0"},
+		{"docker.io/cockroachdb/cockroach", "https://registry-1.docker.io", "cockroachdb/cockroach", "latest"},
+		{"busybox", "https://registry-1.docker.io", "library/busybox", "latest"},
+		{"localhost:5000/cockroach@sha256:abc", "https://localhost:5000", "cockroach", "sha256:abc"},
+	}
+	for _, tc := range tests {
+		baseURL, repository, reference := ParseImage(tc.image)
+		if baseURL != tc.baseURL || repository != tc.repository || reference != tc.reference {
+			t.Errorf("ParseImage(`%s`): expected (%s, %s, %s), got (%s, %s, %s)", tc.image,
+				tc.baseURL, tc.repository, tc.reference, baseURL, repository, reference)
+		}
+	}
+}
+
+func TestParseChallenge(t *testing.T) {
+	params := parseChallenge(`Bearer realm="https://auth.example.com/token",service="registry",scope="repository:cockroachdb/cockroach:pull"`)
+	expected := map[string]string{
+		"realm":   "https://auth.example.com/token",
+		"service": "registry",
+		"scope":   "repository:cockroachdb/cockroach:pull",
+	}
+	for k, v := range expected {
+		if params[k] != v {
+			t.Errorf("expected %s=%q, got %q", k, v, params[k])
+		}
+	}
+	if len(parseChallenge(`Basic realm="test"`)) != 0 {
+		t.Error("expected no parameters for a basic challenge")
+	}
+}
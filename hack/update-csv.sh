@@ -58,7 +58,9 @@ echo "RH_COCKROACH_DATABASE_IMAGE=$RH_COCKROACH_DATABASE_IMAGE"
 "$kstomize" build config/manifests | "$opsdk" generate bundle -q --overwrite --version ${RH_BUNDLE_VERSION} ${RH_BUNDLE_METADATA_OPTS}
 "$opsdk" bundle validate ./bundle
 
-cat bundle/manifests/cockroach-operator.clusterserviceversion.yaml | sed "s+RH_COCKROACH_OP_IMAGE_PLACEHOLDER+${RH_COCKROACH_OP_IMG}+g; s+CREATED_AT_PLACEHOLDER+"$(date +"%FT%H:%M:%SZ")"+g"> bundle/manifests/cockroach-operator.clusterserviceversion.yaml
+# Merge the generated relatedImages and olm.skipRange, see config/templates/csv_patch.yaml.in
+"$faq" -f yaml -o yaml --slurp '.[0] * .[1]' bundle/manifests/cockroach-operator.clusterserviceversion.yaml config/manifests/patches/csv_patch.yaml | sed "s+RH_COCKROACH_OP_IMAGE_PLACEHOLDER+${RH_COCKROACH_OP_IMG}+g; s+CREATED_AT_PLACEHOLDER+"$(date +"%FT%H:%M:%SZ")"+g"> bundle/manifests/csv.yaml
+mv bundle/manifests/csv.yaml bundle/manifests/cockroach-operator.clusterserviceversion.yaml
 for v in $("$faq" -r '.CrdbVersions' "${REPO_ROOT}/crdb-versions.yaml" | cut -d ' ' -f2)
 do
   vrs=${v//./_}
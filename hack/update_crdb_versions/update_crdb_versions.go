@@ -0,0 +1,397 @@
+/*
+Copyright 2021 The Cockroach Authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    https://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// This program queries the RedHat Catalog for the published CockroachDB
+// images and regenerates crdb-versions.yaml. Optionally it emits a richer
+// metadata document with image digests, publish dates and architectures,
+// which can be used for digest pinning in disconnected OLM bundles. When
+// manifest verification is enabled, versions whose image manifests cannot be
+// pulled or lack a required architecture are left out. The catalog can be
+// replaced by a local file, either a saved catalog API response or a manual
+// list of versions, for reproducible and air-gapped regeneration.
+
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"os"
+	"sort"
+	"strings"
+
+	"github.com/Masterminds/semver/v3"
+	"github.com/cockroachdb/cockroach-operator/hack/registry"
+	"gopkg.in/yaml.v2"
+)
+
+// TODO(rail): we may need to add pagination handling in case we pass 500 versions
+// Use anonymous API to get the list of published images from the RedHat Catalog.
+const catalogURL = "https://catalog.redhat.com/api/containers/v1/repositories/registry/registry.connect.redhat.com/repository/cockroachdb/cockroach/images?exclude=data.repositories.comparison.advisory_rpm_mapping,data.brew,data.cpe_ids,data.top_layer_id&page_size=500&page=0"
+
+const (
+	defaultRegistryURL = "https://registry.connect.redhat.com"
+	defaultRepository  = "cockroachdb/cockroach"
+)
+
+const crdbVersionsFileHeader = `# Copyright 2021 The Cockroach Authors
+#
+# Licensed under the Apache License, Version 2.0 (the "License");
+# you may not use this file except in compliance with the License.
+# You may obtain a copy of the License at
+#
+#     https://www.apache.org/licenses/LICENSE-2.0
+#
+# Unless required by applicable law or agreed to in writing, software
+# distributed under the License is distributed on an "AS IS" BASIS,
+# WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+# See the License for the specific language governing permissions and
+# limitations under the License.
+#
+# Supported CockroachDB versions.
+#
+# This file contains a list of CockroachDB versions that are supported by the
+# operator. hack/crdbversions/main.go uses this list to generate various
+# manifests.
+# Please update this file when CockroachDB releases new versions.
+
+`
+
+// catalogResponse is the subset of the RedHat Catalog images API response
+// used by this program.
+type catalogResponse struct {
+	Data []catalogImage `json:"data"`
+}
+
+type catalogImage struct {
+	Architecture string              `json:"architecture"`
+	Repositories []catalogRepository `json:"repositories"`
+}
+
+type catalogRepository struct {
+	ManifestListDigest    string       `json:"manifest_list_digest"`
+	ManifestSchema2Digest string       `json:"manifest_schema2_digest"`
+	Published             bool         `json:"published"`
+	PushDate              string       `json:"push_date"`
+	Tags                  []catalogTag `json:"tags"`
+}
+
+type catalogTag struct {
+	Name string `json:"name"`
+}
+
+// versionMetadata describes a single published CockroachDB image.
+type versionMetadata struct {
+	Version       string   `json:"Version" yaml:"Version"`
+	Digest        string   `json:"Digest" yaml:"Digest"`
+	PublishDate   string   `json:"PublishDate" yaml:"PublishDate"`
+	Architectures []string `json:"Architectures" yaml:"Architectures"`
+}
+
+// crdbVersionsMetadata is the structure of the optional metadata document.
+type crdbVersionsMetadata struct {
+	CrdbVersions []versionMetadata `json:"CrdbVersions" yaml:"CrdbVersions"`
+}
+
+func getCatalogResponse(url string) (catalogResponse, error) {
+	var data catalogResponse
+	resp, err := http.Get(url)
+	if err != nil {
+		return data, fmt.Errorf("cannot fetch `%s`: %w", url, err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return data, fmt.Errorf("unexpected status code %d fetching `%s`", resp.StatusCode, url)
+	}
+	return parseCatalogResponse(resp.Body)
+}
+
+func parseCatalogResponse(r io.Reader) (catalogResponse, error) {
+	var data catalogResponse
+	if err := json.NewDecoder(r).Decode(&data); err != nil {
+		return data, fmt.Errorf("cannot parse catalog response: %w", err)
+	}
+	return data, nil
+}
+
+// readInputFile reads a saved catalog API response or a manual version list.
+// Manual lists can use the crdb-versions.yaml format or contain one version
+// per line; empty lines and lines starting with `#` are ignored.
+func readInputFile(r io.Reader) (catalogResponse, error) {
+	contents, err := io.ReadAll(r)
+	if err != nil {
+		return catalogResponse{}, fmt.Errorf("cannot read input file: %w", err)
+	}
+	if strings.HasPrefix(strings.TrimSpace(string(contents)), "{") {
+		return parseCatalogResponse(bytes.NewReader(contents))
+	}
+
+	var tags []string
+	var versions struct {
+		CrdbVersions []string `yaml:"CrdbVersions"`
+	}
+	if err := yaml.Unmarshal(contents, &versions); err == nil && len(versions.CrdbVersions) > 0 {
+		tags = versions.CrdbVersions
+	} else {
+		for _, line := range strings.Split(string(contents), "\n") {
+			line = strings.TrimSpace(line)
+			if line == "" || strings.HasPrefix(line, "#") {
+				continue
+			}
+			tags = append(tags, line)
+		}
+	}
+
+	// Manual lists carry no image metadata, only tags.
+	var repo catalogRepository
+	for _, tag := range tags {
+		repo.Tags = append(repo.Tags, catalogTag{Name: tag})
+	}
+	return catalogResponse{Data: []catalogImage{{Repositories: []catalogRepository{repo}}}}, nil
+}
+
+// isSupportedTag filters out unsupported versions, the latest tag and the
+// UBI specific tags.
+func isSupportedTag(tag string) bool {
+	return !strings.HasPrefix(tag, "v19") &&
+		!strings.Contains(tag, "latest") &&
+		!strings.HasSuffix(tag, "ubi")
+}
+
+// collectVersionMetadata aggregates the per architecture catalog entries by
+// tag and returns them sorted according to the semantic version sorting
+// rules.
+func collectVersionMetadata(data catalogResponse) ([]versionMetadata, error) {
+	byTag := make(map[string]*versionMetadata)
+	for _, image := range data.Data {
+		for _, repo := range image.Repositories {
+			for _, tag := range repo.Tags {
+				if !isSupportedTag(tag.Name) {
+					continue
+				}
+				m, ok := byTag[tag.Name]
+				if !ok {
+					m = &versionMetadata{Version: tag.Name}
+					byTag[tag.Name] = m
+				}
+				// Prefer the manifest list digest, which covers all
+				// architectures, over the single image digest.
+				if repo.ManifestListDigest != "" {
+					m.Digest = repo.ManifestListDigest
+				} else if m.Digest == "" {
+					m.Digest = repo.ManifestSchema2Digest
+				}
+				if m.PublishDate == "" || repo.PushDate < m.PublishDate {
+					m.PublishDate = repo.PushDate
+				}
+				if image.Architecture != "" && !contains(m.Architectures, image.Architecture) {
+					m.Architectures = append(m.Architectures, image.Architecture)
+				}
+			}
+		}
+	}
+
+	var vs []*semver.Version
+	for tag := range byTag {
+		v, err := semver.NewVersion(tag)
+		if err != nil {
+			return nil, fmt.Errorf("cannot convert version `%s`: %w", tag, err)
+		}
+		vs = append(vs, v)
+	}
+	sort.Sort(semver.Collection(vs))
+
+	result := make([]versionMetadata, 0, len(vs))
+	for _, v := range vs {
+		m := byTag[v.Original()]
+		sort.Strings(m.Architectures)
+		result = append(result, *m)
+	}
+	return result, nil
+}
+
+// verifyImage checks that the given tag can be pulled from the registry and
+// that its manifest list contains images for all required architectures.
+// Single architecture manifests are only accepted if the architectures
+// reported by the catalog cover the required ones.
+func verifyImage(c *registry.Client, tag string, catalogArchs []string, requiredArchs []string) error {
+	list, err := c.GetManifest(defaultRepository, tag)
+	if err != nil {
+		return err
+	}
+
+	archs := catalogArchs
+	if len(list.Manifests) > 0 {
+		archs = list.Architectures()
+	}
+
+	var missing []string
+	for _, arch := range requiredArchs {
+		if !contains(archs, arch) {
+			missing = append(missing, arch)
+		}
+	}
+	if len(missing) > 0 {
+		return fmt.Errorf("image `%s` is missing architectures: %s", tag, strings.Join(missing, ", "))
+	}
+	return nil
+}
+
+// verifyFunc verifies that the image for a version is usable.
+type verifyFunc func(m versionMetadata) error
+
+// filterVerified returns the versions that pass verification. Versions that
+// fail are logged and skipped, so crdb-versions.yaml never lists a tag that
+// cannot be deployed.
+func filterVerified(metadata []versionMetadata, verify verifyFunc) []versionMetadata {
+	var result []versionMetadata
+	for _, m := range metadata {
+		if err := verify(m); err != nil {
+			log.Printf("skipping `%s`: %s", m.Version, err)
+			continue
+		}
+		result = append(result, m)
+	}
+	return result
+}
+
+func contains(items []string, item string) bool {
+	for _, i := range items {
+		if i == item {
+			return true
+		}
+	}
+	return false
+}
+
+// writeCrdbVersions writes the list of versions in the crdb-versions.yaml
+// format.
+func writeCrdbVersions(w io.Writer, metadata []versionMetadata) error {
+	if _, err := io.WriteString(w, crdbVersionsFileHeader+"CrdbVersions:\n"); err != nil {
+		return err
+	}
+	for _, m := range metadata {
+		if _, err := fmt.Fprintf(w, "  - %s\n", m.Version); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// writeMetadata writes the metadata document in the requested format.
+func writeMetadata(w io.Writer, metadata []versionMetadata, format string) error {
+	doc := crdbVersionsMetadata{CrdbVersions: metadata}
+	var (
+		contents []byte
+		err      error
+	)
+	switch format {
+	case "yaml":
+		contents, err = yaml.Marshal(doc)
+	case "json":
+		contents, err = json.MarshalIndent(doc, "", "  ")
+		contents = append(contents, '\n')
+	default:
+		return fmt.Errorf("unsupported metadata format `%s`", format)
+	}
+	if err != nil {
+		return fmt.Errorf("cannot marshal metadata: %w", err)
+	}
+	_, err = w.Write(contents)
+	return err
+}
+
+func writeFile(fName string, write func(io.Writer) error) error {
+	output, err := os.Create(fName)
+	if err != nil {
+		return fmt.Errorf("cannot create `%s`: %w", fName, err)
+	}
+	if err := write(output); err != nil {
+		output.Close()
+		return fmt.Errorf("cannot write `%s`: %w", fName, err)
+	}
+	return output.Close()
+}
+
+func main() {
+	log.SetFlags(0)
+	output := flag.String("output", "crdb-versions.yaml", "File to write the list of CRDB versions to")
+	metadataOutput := flag.String("metadata-output", "", "Optional file to write the CRDB image metadata (digest, publish date, architectures) to")
+	metadataFormat := flag.String("metadata-format", "yaml", "Format of the metadata file: yaml or json")
+	verifyManifests := flag.Bool("verify-manifests", false, "Verify that image manifests are pullable and contain the required architectures")
+	requiredArchs := flag.String("required-archs", "amd64", "Comma separated list of architectures each image must provide, e.g. amd64,arm64")
+	registryURL := flag.String("registry", defaultRegistryURL, "Registry used to verify image manifests")
+	fromFile := flag.String("from-file", "", "Read a saved catalog API response or a manual version list instead of querying the RedHat Catalog")
+	flag.Parse()
+
+	if *metadataFormat != "yaml" && *metadataFormat != "json" {
+		flag.PrintDefaults()
+		os.Exit(1)
+	}
+
+	var data catalogResponse
+	if *fromFile != "" {
+		f, err := os.Open(*fromFile)
+		if err != nil {
+			log.Fatalf("Cannot open input file: %s", err)
+		}
+		data, err = readInputFile(f)
+		f.Close()
+		if err != nil {
+			log.Fatalf("Cannot read input file `%s`: %s", *fromFile, err)
+		}
+	} else {
+		var err error
+		data, err = getCatalogResponse(catalogURL)
+		if err != nil {
+			log.Fatalf("Cannot get the list of published images: %s", err)
+		}
+	}
+
+	metadata, err := collectVersionMetadata(data)
+	if err != nil {
+		log.Fatalf("Cannot collect version metadata: %s", err)
+	}
+
+	if *verifyManifests {
+		archs := strings.Split(*requiredArchs, ",")
+		c := registry.NewClient(*registryURL)
+		metadata = filterVerified(metadata, func(m versionMetadata) error {
+			log.Printf("verifying `%s`", m.Version)
+			return verifyImage(c, m.Version, m.Architectures, archs)
+		})
+	}
+
+	log.Printf("generating `%s`", *output)
+	if err := writeFile(*output, func(w io.Writer) error {
+		return writeCrdbVersions(w, metadata)
+	}); err != nil {
+		log.Fatalf("Cannot generate versions file: %s", err)
+	}
+
+	if *metadataOutput != "" {
+		log.Printf("generating `%s`", *metadataOutput)
+		if err := writeFile(*metadataOutput, func(w io.Writer) error {
+			return writeMetadata(w, metadata, *metadataFormat)
+		}); err != nil {
+			log.Fatalf("Cannot generate metadata file: %s", err)
+		}
+	}
+}
@@ -0,0 +1,241 @@
+/*
+Copyright 2021 The Cockroach Authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    https://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package main
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/cockroachdb/cockroach-operator/hack/registry"
+)
+
+const testCatalogResponse = `{
+  "data": [
+    {
+      "architecture": "amd64",
+      "repositories": [
+        {
+          "manifest_list_digest": "sha256:list2110",
+          "manifest_schema2_digest": "sha256:amd2110",
+          "published": true,
+          "push_date": "2021-05-18T12:00:00+00:00",
+          "tags": [{"name": "v21.1.0"}, {"name": "latest"}]
+        }
+      ]
+    },
+    {
+      "architecture": "arm64",
+      "repositories": [
+        {
+          "manifest_list_digest": "sha256:list2110",
+          "manifest_schema2_digest": "sha256:arm2110",
+          "published": true,
+          "push_date": "2021-05-18T11:00:00+00:00",
+          "tags": [{"name": "v21.1.0"}]
+        }
+      ]
+    },
+    {
+      "architecture": "amd64",
+      "repositories": [
+        {
+          "manifest_schema2_digest": "sha256:amd20111",
+          "published": true,
+          "push_date": "2021-01-10T12:00:00+00:00",
+          "tags": [{"name": "v20.1.11"}, {"name": "v20.1.11-ubi"}, {"name": "v19.2.12"}]
+        }
+      ]
+    }
+  ]
+}`
+
+func TestIsSupportedTag(t *testing.T) {
+	tests := []struct {
+		tag       string
+		supported bool
+	}{
+		{"v21.1.0", true},
+		{"v21.2.0-beta.1", true},
+		{"v19.2.12", false},
+		{"latest", false},
+		{"latest-v21.1", false},
+		{"v21.1.0-ubi", false},
+	}
+	for _, tc := range tests {
+		if isSupportedTag(tc.tag) != tc.supported {
+			t.Errorf("expected %t for isSupportedTag(`%s`)", tc.supported, tc.tag)
+		}
+	}
+}
+
+func TestCollectVersionMetadata(t *testing.T) {
+	data, err := parseCatalogResponse(strings.NewReader(testCatalogResponse))
+	if err != nil {
+		t.Fatalf("cannot parse response: %s", err)
+	}
+	metadata, err := collectVersionMetadata(data)
+	if err != nil {
+		t.Fatalf("cannot collect metadata: %s", err)
+	}
+	if len(metadata) != 2 {
+		t.Fatalf("expected 2 versions, got %d", len(metadata))
+	}
+
+	old, current := metadata[0], metadata[1]
+	if old.Version != "v20.1.11" || current.Version != "v21.1.0" {
+		t.Errorf("unexpected version order: %s, %s", old.Version, current.Version)
+	}
+	if old.Digest != "sha256:amd20111" {
+		t.Errorf("expected single image digest, got %s", old.Digest)
+	}
+	if current.Digest != "sha256:list2110" {
+		t.Errorf("expected manifest list digest, got %s", current.Digest)
+	}
+	if current.PublishDate != "2021-05-18T11:00:00+00:00" {
+		t.Errorf("expected the earliest push date, got %s", current.PublishDate)
+	}
+	if strings.Join(current.Architectures, ",") != "amd64,arm64" {
+		t.Errorf("expected amd64,arm64 architectures, got %v", current.Architectures)
+	}
+}
+
+func TestWriteCrdbVersions(t *testing.T) {
+	metadata := []versionMetadata{{Version: "v20.1.11"}, {Version: "v21.1.0"}}
+	var output bytes.Buffer
+	if err := writeCrdbVersions(&output, metadata); err != nil {
+		t.Fatalf("cannot write versions: %s", err)
+	}
+	expected := "CrdbVersions:\n  - v20.1.11\n  - v21.1.0\n"
+	if !strings.HasSuffix(output.String(), expected) {
+		t.Errorf("expected output to end with `%s`, got `%s`", expected, output.String())
+	}
+}
+
+func TestWriteMetadata(t *testing.T) {
+	metadata := []versionMetadata{{
+		Version:       "v21.1.0",
+		Digest:        "sha256:list2110",
+		PublishDate:   "2021-05-18T11:00:00+00:00",
+		Architectures: []string{"amd64"},
+	}}
+	tests := []struct {
+		format   string
+		expected string
+	}{
+		{"yaml", "CrdbVersions:\n- Version: v21.1.0\n  Digest: sha256:list2110\n"},
+		{"json", "{\n  \"CrdbVersions\": [\n    {\n      \"Version\": \"v21.1.0\",\n      \"Digest\": \"sha256:list2110\",\n"},
+	}
+	for _, tc := range tests {
+		var output bytes.Buffer
+		if err := writeMetadata(&output, metadata, tc.format); err != nil {
+			t.Fatalf("cannot write %s metadata: %s", tc.format, err)
+		}
+		if !strings.HasPrefix(output.String(), tc.expected) {
+			t.Errorf("expected %s output to start with `%s`, got `%s`", tc.format, tc.expected, output.String())
+		}
+	}
+
+	var output bytes.Buffer
+	if err := writeMetadata(&output, metadata, "xml"); err == nil {
+		t.Error("expected an error for unsupported format")
+	}
+}
+
+func TestReadInputFile(t *testing.T) {
+	tests := []struct {
+		name     string
+		input    string
+		expected []string
+	}{
+		{"catalog response", testCatalogResponse, []string{"v20.1.11", "v21.1.0"}},
+		{"crdb-versions.yaml", "# comment\nCrdbVersions:\n  - v21.1.0\n  - v20.1.11\n", []string{"v20.1.11", "v21.1.0"}},
+		{"plain list", "# manual list\nv21.1.1\n\nv21.1.0\nlatest\n", []string{"v21.1.0", "v21.1.1"}},
+	}
+	for _, tc := range tests {
+		data, err := readInputFile(strings.NewReader(tc.input))
+		if err != nil {
+			t.Fatalf("%s: cannot read input: %s", tc.name, err)
+		}
+		metadata, err := collectVersionMetadata(data)
+		if err != nil {
+			t.Fatalf("%s: cannot collect metadata: %s", tc.name, err)
+		}
+		var got []string
+		for _, m := range metadata {
+			got = append(got, m.Version)
+		}
+		if strings.Join(got, ",") != strings.Join(tc.expected, ",") {
+			t.Errorf("%s: expected %v, got %v", tc.name, tc.expected, got)
+		}
+	}
+}
+
+func TestVerifyImage(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/v2/cockroachdb/cockroach/manifests/v21.1.0":
+			fmt.Fprint(w, `{"manifests": [
+				{"platform": {"architecture": "amd64", "os": "linux"}},
+				{"platform": {"architecture": "arm64", "os": "linux"}}
+			]}`)
+		case "/v2/cockroachdb/cockroach/manifests/v20.1.11":
+			fmt.Fprint(w, `{"mediaType": "application/vnd.docker.distribution.manifest.v2+json"}`)
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+	defer srv.Close()
+	c := registry.NewClient(srv.URL)
+
+	tests := []struct {
+		name          string
+		tag           string
+		catalogArchs  []string
+		requiredArchs []string
+		wantErr       bool
+	}{
+		{"manifest list with all archs", "v21.1.0", nil, []string{"amd64", "arm64"}, false},
+		{"manifest list missing arch", "v21.1.0", nil, []string{"amd64", "s390x"}, true},
+		{"single manifest covered by catalog", "v20.1.11", []string{"amd64"}, []string{"amd64"}, false},
+		{"single manifest not covered by catalog", "v20.1.11", []string{"amd64"}, []string{"amd64", "arm64"}, true},
+		{"missing tag", "v21.1.1", []string{"amd64"}, []string{"amd64"}, true},
+	}
+	for _, tc := range tests {
+		err := verifyImage(c, tc.tag, tc.catalogArchs, tc.requiredArchs)
+		if (err != nil) != tc.wantErr {
+			t.Errorf("%s: expected error %t, got %v", tc.name, tc.wantErr, err)
+		}
+	}
+}
+
+func TestFilterVerified(t *testing.T) {
+	metadata := []versionMetadata{{Version: "v20.1.11"}, {Version: "v21.1.0"}}
+	got := filterVerified(metadata, func(m versionMetadata) error {
+		if m.Version == "v20.1.11" {
+			return errors.New("not pullable")
+		}
+		return nil
+	})
+	if len(got) != 1 || got[0].Version != "v21.1.0" {
+		t.Errorf("expected only v21.1.0, got %v", got)
+	}
+}
@@ -0,0 +1,99 @@
+/*
+Copyright 2021 The Cockroach Authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    https://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package main
+
+import (
+	"fmt"
+
+	"github.com/Masterminds/semver/v3"
+)
+
+// apiLifetime describes the Kubernetes versions that serve a given
+// apiVersion and kind. An empty value means there is no bound.
+type apiLifetime struct {
+	introduced string
+	removed    string
+}
+
+// apiLifetimes lists the APIs used, or previously used, by the operator
+// manifests. APIs that are not listed are assumed to be always available.
+var apiLifetimes = map[string]apiLifetime{
+	"apiextensions.k8s.io/v1beta1/CustomResourceDefinition":               {removed: "1.22"},
+	"apiextensions.k8s.io/v1/CustomResourceDefinition":                    {introduced: "1.16"},
+	"admissionregistration.k8s.io/v1beta1/MutatingWebhookConfiguration":   {removed: "1.22"},
+	"admissionregistration.k8s.io/v1beta1/ValidatingWebhookConfiguration": {removed: "1.22"},
+	"admissionregistration.k8s.io/v1/MutatingWebhookConfiguration":        {introduced: "1.16"},
+	"admissionregistration.k8s.io/v1/ValidatingWebhookConfiguration":      {introduced: "1.16"},
+	"rbac.authorization.k8s.io/v1beta1/Role":                              {removed: "1.22"},
+	"rbac.authorization.k8s.io/v1beta1/RoleBinding":                       {removed: "1.22"},
+	"rbac.authorization.k8s.io/v1beta1/ClusterRole":                       {removed: "1.22"},
+	"rbac.authorization.k8s.io/v1beta1/ClusterRoleBinding":                {removed: "1.22"},
+	"extensions/v1beta1/Deployment":                                       {removed: "1.16"},
+	"apps/v1beta1/Deployment":                                             {removed: "1.16"},
+	"apps/v1beta2/Deployment":                                             {removed: "1.16"},
+	"apps/v1beta1/StatefulSet":                                            {removed: "1.16"},
+	"apps/v1beta2/StatefulSet":                                            {removed: "1.16"},
+	"extensions/v1beta1/Ingress":                                          {removed: "1.22"},
+	"networking.k8s.io/v1beta1/Ingress":                                   {removed: "1.22"},
+	"networking.k8s.io/v1/Ingress":                                        {introduced: "1.19"},
+	"policy/v1beta1/PodDisruptionBudget":                                  {removed: "1.25"},
+	"policy/v1/PodDisruptionBudget":                                       {introduced: "1.21"},
+	"policy/v1beta1/PodSecurityPolicy":                                    {removed: "1.25"},
+	"batch/v1beta1/CronJob":                                               {removed: "1.25"},
+	"batch/v1/CronJob":                                                    {introduced: "1.21"},
+	"certificates.k8s.io/v1beta1/CertificateSigningRequest":               {removed: "1.22"},
+	"certificates.k8s.io/v1/CertificateSigningRequest":                    {introduced: "1.19"},
+	"autoscaling/v2beta2/HorizontalPodAutoscaler":                         {removed: "1.26"},
+	"autoscaling/v2/HorizontalPodAutoscaler":                              {introduced: "1.23"},
+	"scheduling.k8s.io/v1beta1/PriorityClass":                             {removed: "1.22"},
+	"coordination.k8s.io/v1beta1/Lease":                                   {removed: "1.22"},
+}
+
+// openShiftKubeVersions maps OpenShift releases to the Kubernetes version
+// they are based on.
+var openShiftKubeVersions = map[string]string{
+	"4.5":  "1.18",
+	"4.6":  "1.19",
+	"4.7":  "1.20",
+	"4.8":  "1.21",
+	"4.9":  "1.22",
+	"4.10": "1.23",
+	"4.11": "1.24",
+	"4.12": "1.25",
+}
+
+// checkAPIAvailable returns an error if the apiVersion and kind are not
+// served by the given Kubernetes version.
+func checkAPIAvailable(apiVersion, kind string, kubeVersion *semver.Version) error {
+	lifetime, ok := apiLifetimes[apiVersion+"/"+kind]
+	if !ok {
+		return nil
+	}
+	if lifetime.introduced != "" {
+		introduced := semver.MustParse(lifetime.introduced)
+		if kubeVersion.LessThan(introduced) {
+			return fmt.Errorf("%s %s is not available before Kubernetes %s", apiVersion, kind, lifetime.introduced)
+		}
+	}
+	if lifetime.removed != "" {
+		removed := semver.MustParse(lifetime.removed)
+		if !kubeVersion.LessThan(removed) {
+			return fmt.Errorf("%s %s was removed in Kubernetes %s", apiVersion, kind, lifetime.removed)
+		}
+	}
+	return nil
+}
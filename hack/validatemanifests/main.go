@@ -0,0 +1,489 @@
+/*
+Copyright 2021 The Cockroach Authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    https://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// This program validates the generated manifests (CRDs, CSV, RBAC, webhook
+// configuration and the images they reference) against a list of target
+// Kubernetes and OpenShift versions, so that breakage is caught before a
+// release rather than during a cluster install.
+
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/Masterminds/semver/v3"
+	"github.com/cockroachdb/cockroach-operator/hack/registry"
+	"gopkg.in/yaml.v2"
+)
+
+// List of manifests validated by default, relative to the repository root
+var defaultFiles = []string{
+	"manifests/operator.yaml",
+	"config/crd/bases/crdb.cockroachlabs.com_crdbbackups.yaml",
+	"config/crd/bases/crdb.cockroachlabs.com_crdbchangefeeds.yaml",
+	"config/crd/bases/crdb.cockroachlabs.com_crdbclientcerts.yaml",
+	"config/crd/bases/crdb.cockroachlabs.com_crdbexports.yaml",
+	"config/crd/bases/crdb.cockroachlabs.com_crdbclusters.yaml",
+	"config/crd/bases/crdb.cockroachlabs.com_crdbjobs.yaml",
+	"config/crd/bases/crdb.cockroachlabs.com_crdbrestores.yaml",
+	"config/rbac/role.yaml",
+	"config/webhook/manifests.yaml",
+	"bundle/manifests/cockroach-operator.clusterserviceversion.yaml",
+	"bundle/manifests/crdb.cockroachlabs.com_crdbclusters.yaml",
+}
+
+// placeholderMarker is part of every image placeholder that is replaced at
+// release time, such images are not resolved.
+const placeholderMarker = "PLACEHOLDER"
+
+type metadata struct {
+	Name        string            `yaml:"name"`
+	Annotations map[string]string `yaml:"annotations"`
+}
+
+// document is a single YAML document of a manifest file
+type document struct {
+	file       string
+	raw        []byte
+	APIVersion string   `yaml:"apiVersion"`
+	Kind       string   `yaml:"kind"`
+	Metadata   metadata `yaml:"metadata"`
+}
+
+func (d document) String() string {
+	return fmt.Sprintf("%s: %s/%s", d.file, d.Kind, d.Metadata.Name)
+}
+
+type crd struct {
+	Spec struct {
+		Versions []struct {
+			Name    string `yaml:"name"`
+			Served  bool   `yaml:"served"`
+			Storage bool   `yaml:"storage"`
+			Schema  *struct {
+				OpenAPIV3Schema *struct {
+					Type string `yaml:"type"`
+				} `yaml:"openAPIV3Schema"`
+			} `yaml:"schema"`
+		} `yaml:"versions"`
+	} `yaml:"spec"`
+}
+
+type policyRule struct {
+	APIGroups       []string `yaml:"apiGroups"`
+	Resources       []string `yaml:"resources"`
+	NonResourceURLs []string `yaml:"nonResourceURLs"`
+	Verbs           []string `yaml:"verbs"`
+}
+
+type role struct {
+	Rules []policyRule `yaml:"rules"`
+}
+
+type webhookConfiguration struct {
+	Webhooks []struct {
+		Name                    string   `yaml:"name"`
+		AdmissionReviewVersions []string `yaml:"admissionReviewVersions"`
+		SideEffects             string   `yaml:"sideEffects"`
+		ClientConfig            struct {
+			URL     string `yaml:"url"`
+			Service *struct {
+				Name string `yaml:"name"`
+			} `yaml:"service"`
+		} `yaml:"clientConfig"`
+	} `yaml:"webhooks"`
+}
+
+type container struct {
+	Name  string `yaml:"name"`
+	Image string `yaml:"image"`
+	Env   []struct {
+		Name  string `yaml:"name"`
+		Value string `yaml:"value"`
+	} `yaml:"env"`
+}
+
+type podTemplate struct {
+	Spec struct {
+		InitContainers []container `yaml:"initContainers"`
+		Containers     []container `yaml:"containers"`
+	} `yaml:"spec"`
+}
+
+type deployment struct {
+	Spec struct {
+		Template podTemplate `yaml:"template"`
+	} `yaml:"spec"`
+}
+
+type csv struct {
+	Spec struct {
+		Version        string `yaml:"version"`
+		MinKubeVersion string `yaml:"minKubeVersion"`
+		Install        struct {
+			Strategy string `yaml:"strategy"`
+			Spec     struct {
+				Deployments []struct {
+					Name string     `yaml:"name"`
+					Spec deployment `yaml:"spec"`
+				} `yaml:"deployments"`
+				ClusterPermissions []struct {
+					ServiceAccountName string       `yaml:"serviceAccountName"`
+					Rules              []policyRule `yaml:"rules"`
+				} `yaml:"clusterPermissions"`
+			} `yaml:"spec"`
+		} `yaml:"install"`
+		CustomResourceDefinitions struct {
+			Owned []struct {
+				Name    string `yaml:"name"`
+				Version string `yaml:"version"`
+			} `yaml:"owned"`
+		} `yaml:"customresourcedefinitions"`
+		RelatedImages []struct {
+			Name  string `yaml:"name"`
+			Image string `yaml:"image"`
+		} `yaml:"relatedImages"`
+	} `yaml:"spec"`
+}
+
+// readDocuments splits a multi document YAML stream
+func readDocuments(file string, r io.Reader) ([]document, error) {
+	var docs []document
+	decoder := yaml.NewDecoder(r)
+	for {
+		var content map[string]interface{}
+		err := decoder.Decode(&content)
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			return nil, fmt.Errorf("cannot parse `%s`: %w", file, err)
+		}
+		if len(content) == 0 {
+			continue
+		}
+		raw, err := yaml.Marshal(content)
+		if err != nil {
+			return nil, err
+		}
+		doc := document{file: file, raw: raw}
+		if err := yaml.Unmarshal(raw, &doc); err != nil {
+			return nil, fmt.Errorf("cannot parse `%s`: %w", file, err)
+		}
+		if doc.APIVersion == "" || doc.Kind == "" {
+			return nil, fmt.Errorf("%s: document without apiVersion or kind", file)
+		}
+		docs = append(docs, doc)
+	}
+	return docs, nil
+}
+
+// validator accumulates the problems found in the manifests
+type validator struct {
+	kubeVersions []*semver.Version
+	problems     []string
+	images       map[string]string
+}
+
+func newValidator(kubeVersions []*semver.Version) *validator {
+	return &validator{
+		kubeVersions: kubeVersions,
+		images:       make(map[string]string),
+	}
+}
+
+func (v *validator) addProblem(doc document, format string, args ...interface{}) {
+	v.problems = append(v.problems, fmt.Sprintf("%s: %s", doc, fmt.Sprintf(format, args...)))
+}
+
+func (v *validator) addImage(doc document, image string) {
+	if image == "" || strings.Contains(image, placeholderMarker) {
+		return
+	}
+	if _, ok := v.images[image]; !ok {
+		v.images[image] = doc.String()
+	}
+}
+
+// validate runs all checks applicable to the given documents
+func (v *validator) validate(docs []document) {
+	for _, doc := range docs {
+		for _, kv := range v.kubeVersions {
+			if err := checkAPIAvailable(doc.APIVersion, doc.Kind, kv); err != nil {
+				v.addProblem(doc, "%s", err)
+			}
+		}
+
+		var err error
+		switch doc.Kind {
+		case "CustomResourceDefinition":
+			err = v.validateCRD(doc)
+		case "ClusterServiceVersion":
+			err = v.validateCSV(doc)
+		case "Role", "ClusterRole":
+			err = v.validateRole(doc)
+		case "MutatingWebhookConfiguration", "ValidatingWebhookConfiguration":
+			err = v.validateWebhooks(doc)
+		case "Deployment":
+			err = v.validateDeployment(doc)
+		}
+		if err != nil {
+			v.addProblem(doc, "cannot parse: %s", err)
+		}
+	}
+}
+
+func (v *validator) validateCRD(doc document) error {
+	var obj crd
+	if err := yaml.Unmarshal(doc.raw, &obj); err != nil {
+		return err
+	}
+	if doc.APIVersion != "apiextensions.k8s.io/v1" {
+		// v1beta1 CRDs allow non-structural schemas, only the API
+		// availability is verified for them.
+		return nil
+	}
+	storage := 0
+	for _, version := range obj.Spec.Versions {
+		if version.Storage {
+			storage++
+		}
+		if version.Schema == nil || version.Schema.OpenAPIV3Schema == nil {
+			v.addProblem(doc, "version %s has no openAPIV3Schema", version.Name)
+		} else if version.Schema.OpenAPIV3Schema.Type != "object" {
+			v.addProblem(doc, "version %s schema must be of type object to be structural", version.Name)
+		}
+	}
+	if storage != 1 {
+		v.addProblem(doc, "exactly one storage version is required, found %d", storage)
+	}
+	return nil
+}
+
+func (v *validator) validateCSV(doc document) error {
+	var obj csv
+	if err := yaml.Unmarshal(doc.raw, &obj); err != nil {
+		return err
+	}
+	if doc.Metadata.Name == "" {
+		v.addProblem(doc, "metadata.name is required")
+	}
+	if _, err := semver.NewVersion(obj.Spec.Version); err != nil {
+		v.addProblem(doc, "spec.version `%s` is not a semantic version", obj.Spec.Version)
+	}
+	if obj.Spec.Install.Strategy != "deployment" {
+		v.addProblem(doc, "unsupported install strategy `%s`", obj.Spec.Install.Strategy)
+	}
+	if len(obj.Spec.Install.Spec.Deployments) == 0 {
+		v.addProblem(doc, "no deployments in the install strategy")
+	}
+	if len(obj.Spec.CustomResourceDefinitions.Owned) == 0 {
+		v.addProblem(doc, "no owned CRDs")
+	}
+	if obj.Spec.MinKubeVersion != "" {
+		minVersion, err := semver.NewVersion(obj.Spec.MinKubeVersion)
+		if err != nil {
+			v.addProblem(doc, "minKubeVersion `%s` is not a semantic version", obj.Spec.MinKubeVersion)
+		} else {
+			for _, kv := range v.kubeVersions {
+				if kv.LessThan(minVersion) {
+					v.addProblem(doc, "cannot be installed on Kubernetes %s, minKubeVersion is %s", kv, minVersion)
+				}
+			}
+		}
+	}
+	for _, d := range obj.Spec.Install.Spec.Deployments {
+		v.validatePodTemplate(doc, d.Spec.Spec.Template)
+	}
+	for _, p := range obj.Spec.Install.Spec.ClusterPermissions {
+		v.validateRules(doc, p.Rules)
+	}
+	for _, image := range obj.Spec.RelatedImages {
+		if image.Name == "" || image.Image == "" {
+			v.addProblem(doc, "relatedImages entries require a name and an image")
+			continue
+		}
+		v.addImage(doc, image.Image)
+	}
+	return nil
+}
+
+func (v *validator) validateRole(doc document) error {
+	var obj role
+	if err := yaml.Unmarshal(doc.raw, &obj); err != nil {
+		return err
+	}
+	v.validateRules(doc, obj.Rules)
+	return nil
+}
+
+func (v *validator) validateRules(doc document, rules []policyRule) {
+	for i, rule := range rules {
+		if len(rule.Verbs) == 0 {
+			v.addProblem(doc, "rule %d has no verbs", i)
+		}
+		if len(rule.Resources) == 0 && len(rule.NonResourceURLs) == 0 {
+			v.addProblem(doc, "rule %d has neither resources nor nonResourceURLs", i)
+		}
+		if len(rule.Resources) > 0 && len(rule.APIGroups) == 0 {
+			v.addProblem(doc, "rule %d has resources but no apiGroups", i)
+		}
+	}
+}
+
+func (v *validator) validateWebhooks(doc document) error {
+	var obj webhookConfiguration
+	if err := yaml.Unmarshal(doc.raw, &obj); err != nil {
+		return err
+	}
+	for _, w := range obj.Webhooks {
+		if w.ClientConfig.URL == "" && w.ClientConfig.Service == nil {
+			v.addProblem(doc, "webhook %s requires a clientConfig url or service", w.Name)
+		}
+		if doc.APIVersion != "admissionregistration.k8s.io/v1" {
+			continue
+		}
+		if len(w.AdmissionReviewVersions) == 0 {
+			v.addProblem(doc, "webhook %s requires admissionReviewVersions", w.Name)
+		}
+		if w.SideEffects != "None" && w.SideEffects != "NoneOnDryRun" {
+			v.addProblem(doc, "webhook %s sideEffects must be None or NoneOnDryRun", w.Name)
+		}
+	}
+	return nil
+}
+
+func (v *validator) validateDeployment(doc document) error {
+	var obj deployment
+	if err := yaml.Unmarshal(doc.raw, &obj); err != nil {
+		return err
+	}
+	v.validatePodTemplate(doc, obj.Spec.Template)
+	return nil
+}
+
+// validatePodTemplate collects the container images and the
+// RELATED_IMAGE_* environment variables used by the operator
+func (v *validator) validatePodTemplate(doc document, tpl podTemplate) {
+	containers := append(tpl.Spec.InitContainers, tpl.Spec.Containers...)
+	for _, c := range containers {
+		if c.Image == "" {
+			v.addProblem(doc, "container %s has no image", c.Name)
+		}
+		v.addImage(doc, c.Image)
+		for _, env := range c.Env {
+			if strings.HasPrefix(env.Name, "RELATED_IMAGE_") {
+				v.addImage(doc, env.Value)
+			}
+		}
+	}
+}
+
+// resolveImages verifies that every collected image can be pulled
+func (v *validator) resolveImages() {
+	for image, source := range v.images {
+		baseURL, repository, reference := registry.ParseImage(image)
+		log.Printf("resolving `%s`", image)
+		if _, err := registry.NewClient(baseURL).GetManifest(repository, reference); err != nil {
+			v.problems = append(v.problems, fmt.Sprintf("%s: image %s cannot be resolved: %s", source, image, err))
+		}
+	}
+}
+
+// parseKubeVersions converts the Kubernetes and OpenShift target versions
+// into a list of Kubernetes versions
+func parseKubeVersions(kubeVersions, openShiftVersions string) ([]*semver.Version, error) {
+	var result []*semver.Version
+	for _, raw := range strings.Split(kubeVersions, ",") {
+		if raw = strings.TrimSpace(raw); raw == "" {
+			continue
+		}
+		kv, err := semver.NewVersion(raw)
+		if err != nil {
+			return nil, fmt.Errorf("cannot convert Kubernetes version `%s`: %w", raw, err)
+		}
+		result = append(result, kv)
+	}
+	for _, raw := range strings.Split(openShiftVersions, ",") {
+		if raw = strings.TrimSpace(raw); raw == "" {
+			continue
+		}
+		kubeVersion, ok := openShiftKubeVersions[raw]
+		if !ok {
+			return nil, fmt.Errorf("unknown OpenShift version `%s`", raw)
+		}
+		result = append(result, semver.MustParse(kubeVersion))
+	}
+	return result, nil
+}
+
+func main() {
+	log.SetFlags(0)
+	repoRoot := flag.String("repo-root", "", "Git repository root")
+	kubeVersions := flag.String("kube-versions", "1.18,1.20", "Comma separated list of target Kubernetes versions")
+	openShiftVersions := flag.String("openshift-versions", "4.6,4.7", "Comma separated list of target OpenShift versions")
+	resolveImages := flag.Bool("resolve-images", false, "Verify that all referenced images can be pulled")
+	flag.Parse()
+
+	if *repoRoot == "" {
+		flag.PrintDefaults()
+		os.Exit(1)
+	}
+
+	versions, err := parseKubeVersions(*kubeVersions, *openShiftVersions)
+	if err != nil {
+		log.Fatalf("Cannot parse target versions: %s", err)
+	}
+
+	files := flag.Args()
+	if len(files) == 0 {
+		files = defaultFiles
+	}
+
+	v := newValidator(versions)
+	for _, f := range files {
+		fName := filepath.Join(*repoRoot, f)
+		log.Printf("validating `%s`", fName)
+		r, err := os.Open(fName)
+		if err != nil {
+			log.Fatalf("Cannot open `%s`: %s", fName, err)
+		}
+		docs, err := readDocuments(f, r)
+		r.Close()
+		if err != nil {
+			log.Fatalf("Cannot read `%s`: %s", fName, err)
+		}
+		v.validate(docs)
+	}
+	if *resolveImages {
+		v.resolveImages()
+	}
+
+	if len(v.problems) > 0 {
+		for _, p := range v.problems {
+			log.Println(p)
+		}
+		log.Fatalf("Found %d problems", len(v.problems))
+	}
+	log.Printf("All manifests are valid")
+}
@@ -0,0 +1,149 @@
+/*
+Copyright 2021 The Cockroach Authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    https://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package main
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/Masterminds/semver/v3"
+)
+
+func TestCheckAPIAvailable(t *testing.T) {
+	tests := []struct {
+		apiVersion  string
+		kind        string
+		kubeVersion string
+		available   bool
+	}{
+		{"apiextensions.k8s.io/v1", "CustomResourceDefinition", "1.15", false},
+		{"apiextensions.k8s.io/v1", "CustomResourceDefinition", "1.16", true},
+		{"apiextensions.k8s.io/v1beta1", "CustomResourceDefinition", "1.21", true},
+		{"apiextensions.k8s.io/v1beta1", "CustomResourceDefinition", "1.22", false},
+		{"policy/v1beta1", "PodDisruptionBudget", "1.25.3", false},
+		{"v1", "Service", "1.22", true},
+	}
+	for _, tc := range tests {
+		err := checkAPIAvailable(tc.apiVersion, tc.kind, semver.MustParse(tc.kubeVersion))
+		if (err == nil) != tc.available {
+			t.Errorf("expected available=%t for %s %s on %s, got %v", tc.available, tc.apiVersion, tc.kind, tc.kubeVersion, err)
+		}
+	}
+}
+
+func TestParseKubeVersions(t *testing.T) {
+	versions, err := parseKubeVersions("1.18, 1.20", "4.6")
+	if err != nil {
+		t.Fatalf("cannot parse versions: %s", err)
+	}
+	var got []string
+	for _, v := range versions {
+		got = append(got, v.String())
+	}
+	if strings.Join(got, ",") != "1.18.0,1.20.0,1.19.0" {
+		t.Errorf("unexpected versions %v", got)
+	}
+	if _, err := parseKubeVersions("", "3.11"); err == nil {
+		t.Error("expected an error for an unknown OpenShift version")
+	}
+}
+
+const testManifests = `
+apiVersion: apiextensions.k8s.io/v1
+kind: CustomResourceDefinition
+metadata:
+  name: crdbclusters.crdb.cockroachlabs.com
+spec:
+  versions:
+  - name: v1alpha1
+    served: true
+    storage: true
+    schema:
+      openAPIV3Schema:
+        type: object
+  - name: v1alpha2
+    served: true
+---
+apiVersion: rbac.authorization.k8s.io/v1beta1
+kind: ClusterRole
+metadata:
+  name: role
+rules:
+- apiGroups: [""]
+  resources: ["pods"]
+- resources: ["secrets"]
+  verbs: ["get"]
+---
+apiVersion: admissionregistration.k8s.io/v1
+kind: ValidatingWebhookConfiguration
+metadata:
+  name: webhook
+webhooks:
+- name: vcrdbcluster.kb.io
+  clientConfig: {}
+---
+apiVersion: apps/v1
+kind: Deployment
+metadata:
+  name: cockroach-operator
+spec:
+  template:
+    spec:
+      containers:
+      - name: cockroach-operator
+        image: cockroachdb/cockroach-operator:v2.1.0
+        env:
+        - name: RELATED_IMAGE_COCKROACH_v21_1_0
+          value: cockroachdb/cockroach:v21.1.0
+        - name: RELATED_IMAGE_COCKROACH_v21_1_1
+          value: RH_COCKROACH_DB_IMAGE_PLACEHOLDER_v21_1_1
+`
+
+func TestValidate(t *testing.T) {
+	docs, err := readDocuments("test.yaml", strings.NewReader(testManifests))
+	if err != nil {
+		t.Fatalf("cannot read documents: %s", err)
+	}
+	if len(docs) != 4 {
+		t.Fatalf("expected 4 documents, got %d", len(docs))
+	}
+
+	v := newValidator([]*semver.Version{semver.MustParse("1.22")})
+	v.validate(docs)
+
+	expected := []string{
+		"CustomResourceDefinition/crdbclusters.crdb.cockroachlabs.com: version v1alpha2 has no openAPIV3Schema",
+		"ClusterRole/role: rbac.authorization.k8s.io/v1beta1 ClusterRole was removed in Kubernetes 1.22",
+		"ClusterRole/role: rule 0 has no verbs",
+		"ClusterRole/role: rule 1 has resources but no apiGroups",
+		"ValidatingWebhookConfiguration/webhook: webhook vcrdbcluster.kb.io requires a clientConfig url or service",
+		"ValidatingWebhookConfiguration/webhook: webhook vcrdbcluster.kb.io requires admissionReviewVersions",
+		"ValidatingWebhookConfiguration/webhook: webhook vcrdbcluster.kb.io sideEffects must be None or NoneOnDryRun",
+	}
+	if len(v.problems) != len(expected) {
+		t.Fatalf("expected %d problems, got %d: %v", len(expected), len(v.problems), v.problems)
+	}
+	for i, p := range v.problems {
+		if !strings.HasSuffix(p, expected[i]) {
+			t.Errorf("expected problem `%s`, got `%s`", expected[i], p)
+		}
+	}
+
+	if len(v.images) != 2 {
+		t.Errorf("expected 2 images without placeholders, got %v", v.images)
+	}
+}
@@ -0,0 +1,30 @@
+{{- /* Generated, do not edit. Please edit this file instead: config/templates/helm/templates/_helpers.tpl.in */ -}}
+{{/*
+Common labels added to every resource created by the chart.
+*/}}
+{{- define "cockroach-operator.labels" -}}
+app: cockroach-operator
+app.kubernetes.io/name: cockroach-operator
+app.kubernetes.io/instance: {{ .Release.Name }}
+app.kubernetes.io/version: {{ .Chart.AppVersion | quote }}
+app.kubernetes.io/managed-by: {{ .Release.Service }}
+helm.sh/chart: {{ printf "%s-%s" .Chart.Name .Chart.Version | replace "+" "_" }}
+{{- end -}}
+
+{{/*
+Namespace watched by the operator.
+*/}}
+{{- define "cockroach-operator.watchNamespace" -}}
+{{- default .Release.Namespace .Values.watchNamespace -}}
+{{- end -}}
+
+{{/*
+Comma separated list of feature gates, e.g. AutoPrunePVC=true,AffinityRules=false.
+*/}}
+{{- define "cockroach-operator.featureGates" -}}
+{{- $gates := list -}}
+{{- range $name, $enabled := .Values.featureGates -}}
+{{- $gates = append $gates (printf "%s=%t" $name $enabled) -}}
+{{- end -}}
+{{- join "," $gates -}}
+{{- end -}}
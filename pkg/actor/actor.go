@@ -18,6 +18,7 @@ package actor
 
 import (
 	"context"
+	"time"
 
 	"github.com/cockroachdb/cockroach-operator/pkg/condition"
 	"github.com/cockroachdb/cockroach-operator/pkg/features"
@@ -30,6 +31,7 @@ import (
 	"go.uber.org/zap/zapcore"
 	"k8s.io/apimachinery/pkg/runtime"
 	"k8s.io/client-go/rest"
+	"k8s.io/client-go/tools/record"
 	"sigs.k8s.io/controller-runtime/pkg/client"
 	logf "sigs.k8s.io/controller-runtime/pkg/log"
 )
@@ -56,6 +58,28 @@ func (e PermanentErr) Error() string {
 	return e.Err.Error()
 }
 
+//DeferredErr is returned by an actor that has to wait before acting. The
+//other actions still run and the request is requeued after RequeueAfter.
+type DeferredErr struct {
+	Err          error
+	RequeueAfter time.Duration
+}
+
+func (e DeferredErr) Error() string {
+	return e.Err.Error()
+}
+
+//FailureErr is returned by an actor that failed for a known reason. The action
+//is retried according to the retry policy of the reason.
+type FailureErr struct {
+	Reason api.FailureReason
+	Err    error
+}
+
+func (e FailureErr) Error() string {
+	return e.Err.Error()
+}
+
 //InvalidContainerVersionError error used to stop requeue the request on failure
 type InvalidContainerVersionError struct {
 	Err error
@@ -80,24 +104,87 @@ type Actor interface {
 	GetActionType() api.ActionType
 }
 
+// Poller is an actor that checks the cluster again after an interval, even
+// when nothing changed. The controller requeues the request for it, so that it
+// does not return an error when it succeeds.
+type Poller interface {
+	Actor
+	// PollInterval returns how long until the cluster is checked again, 0 when
+	// it is not polled
+	PollInterval(*resource.Cluster) time.Duration
+}
+
+// PollInterval returns the shortest poll interval of the actors that poll the
+// cluster, 0 when none of them does.
+func PollInterval(actors []Actor, cluster *resource.Cluster) time.Duration {
+	var interval time.Duration
+	for _, a := range actors {
+		p, ok := a.(Poller)
+		if !ok {
+			continue
+		}
+		if i := p.PollInterval(cluster); i > 0 && (interval == 0 || i < interval) {
+			interval = i
+		}
+	}
+	return interval
+}
+
 type Director interface {
 	GetActorsToExecute(*resource.Cluster) []Actor
+	// GetObserversToExecute returns the actors to execute that only observe the
+	// cluster and report it in its status and in the metrics, which still run
+	// while the reconciliation of the cluster is paused
+	GetObserversToExecute(*resource.Cluster) []Actor
+}
+
+// observers are the actions that only observe the cluster, without changing it
+// or its resources.
+var observers = map[api.ActionType]bool{
+	api.NodeHealthAction:        true,
+	api.SQLReadinessAction:      true,
+	api.HealthMetricsAction:     true,
+	api.BackupHealthAction:      true,
+	api.CertificateExpiryAction: true,
 }
 
 type clusterDirector struct {
 	actors map[api.ActionType]Actor
 }
 
-func NewDirector(scheme *runtime.Scheme, cl client.Client, config *rest.Config) Director {
+func NewDirector(scheme *runtime.Scheme, cl client.Client, config *rest.Config, recorder record.EventRecorder) Director {
 	actors := map[api.ActionType]Actor{
-		api.DecommissionAction:      newDecommission(scheme, cl, config),
-		api.VersionCheckerAction:    newVersionChecker(scheme, cl, config),
-		api.GenerateCertAction:      newGenerateCert(scheme, cl, config),
-		api.PartitionedUpdateAction: newPartitionedUpdate(scheme, cl, config),
-		api.ResizePVCAction:         newResizePVC(scheme, cl, config),
-		api.DeployAction:            newDeploy(scheme, cl, config, kube.NewKubernetesDistribution()),
-		api.InitializeAction:        newInitialize(scheme, cl, config),
-		api.ClusterRestartAction:    newClusterRestart(scheme, cl, config),
+		api.DecommissionAction:        newDecommission(scheme, cl, config),
+		api.VersionCheckerAction:      newVersionChecker(scheme, cl, config),
+		api.GenerateCertAction:        newGenerateCert(scheme, cl, config),
+		api.PartitionedUpdateAction:   newPartitionedUpdate(scheme, cl, config),
+		api.ResizePVCAction:           newResizePVC(scheme, cl, config),
+		api.ResizeResourcesAction:     newResizeResources(scheme, cl, config),
+		api.ScheduledScalingAction:    newScheduledScaling(scheme, cl, config),
+		api.ScheduledRestartAction:    newScheduledRestart(scheme, cl, config),
+		api.DeployAction:              newDeploy(scheme, cl, config, recorder, kube.NewKubernetesDistribution()),
+		api.InitializeAction:          newInitialize(scheme, cl, config),
+		api.ClusterRestartAction:      newClusterRestart(scheme, cl, config),
+		api.SelfHealingAction:         newSelfHealing(scheme, cl, config, recorder),
+		api.NodeHealthAction:          newNodeHealth(scheme, cl, config),
+		api.StoragePressureAction:     newStoragePressure(scheme, cl, config, recorder),
+		api.CloneAction:               newClone(scheme, cl, config),
+		api.DatabaseRegionsAction:     newDatabaseRegions(scheme, cl, config),
+		api.SQLReadinessAction:        newSQLReadiness(scheme, cl, config),
+		api.DemoWorkloadAction:        newDemoWorkload(scheme, cl, config),
+		api.EvictionAction:            newEviction(scheme, cl, config),
+		api.HealthMetricsAction:       newHealthMetrics(scheme, cl, config),
+		api.RequestedOperationAction:  newRequestedOperations(scheme, cl, config),
+		api.ScheduledExportAction:     newScheduledExport(scheme, cl, config),
+		api.ReplicationAction:         newReplication(scheme, cl, config),
+		api.BackupHealthAction:        newBackupHealth(scheme, cl, config),
+		api.AutoscalingAction:         newAutoscaler(scheme, cl, config),
+		api.ResourceAutoscalingAction: newResourceAutoscaler(scheme, cl, config),
+		api.DeadNodeReplacementAction: newDeadNodeReplacement(scheme, cl, config, recorder),
+		api.CertificateRenewalAction:  newCertRenewal(scheme, cl, config),
+		api.CertificateExpiryAction:   newCertExpiry(scheme, cl, config, recorder),
+		api.CertificateReloadAction:   newCertReload(scheme, cl, config),
+		api.TopologyLocalityAction:    newTopologyLocality(scheme, cl, config),
 	}
 	return &clusterDirector{
 		actors: actors,
@@ -110,6 +197,30 @@ func (cd *clusterDirector) GetActorsToExecute(cluster *resource.Cluster) []Actor
 	featureDecommissionEnabled := utilfeature.DefaultMutableFeatureGate.Enabled(features.Decommission)
 	featureResizePVCEnabled := utilfeature.DefaultMutableFeatureGate.Enabled(features.ResizePVC)
 	featureClusterRestartEnabled := utilfeature.DefaultMutableFeatureGate.Enabled(features.ClusterRestart)
+	featureVerticalResizeEnabled := utilfeature.DefaultMutableFeatureGate.Enabled(features.VerticalResize)
+	featureScheduledScalingEnabled := utilfeature.DefaultMutableFeatureGate.Enabled(features.ScheduledScaling)
+	featureScheduledRestartEnabled := utilfeature.DefaultMutableFeatureGate.Enabled(features.ScheduledRestart)
+	featureSelfHealingEnabled := utilfeature.DefaultMutableFeatureGate.Enabled(features.SelfHealing)
+	featureNodeHealthEnabled := utilfeature.DefaultMutableFeatureGate.Enabled(features.NodeHealth)
+	featureStoragePressureEnabled := utilfeature.DefaultMutableFeatureGate.Enabled(features.StoragePressure)
+	featureSQLReadinessEnabled := utilfeature.DefaultMutableFeatureGate.Enabled(features.SQLReadiness)
+	featureCloneEnabled := utilfeature.DefaultMutableFeatureGate.Enabled(features.Clone)
+	featureDatabaseRegionsEnabled := utilfeature.DefaultMutableFeatureGate.Enabled(features.DatabaseRegions)
+	featureDemoWorkloadEnabled := utilfeature.DefaultMutableFeatureGate.Enabled(features.DemoWorkload)
+	featureEvictionPolicyEnabled := utilfeature.DefaultMutableFeatureGate.Enabled(features.EvictionPolicy)
+	featureHealthMetricsEnabled := utilfeature.DefaultMutableFeatureGate.Enabled(features.HealthMetrics)
+	featureRequestedOperationsEnabled := utilfeature.DefaultMutableFeatureGate.Enabled(features.RequestedOperations)
+	featureCrdbExportsEnabled := utilfeature.DefaultMutableFeatureGate.Enabled(features.CrdbExports)
+	featureClusterReplicationEnabled := utilfeature.DefaultMutableFeatureGate.Enabled(features.ClusterReplication)
+	featureCrdbBackupsEnabled := utilfeature.DefaultMutableFeatureGate.Enabled(features.CrdbBackups)
+	featureBackupHealthEnabled := utilfeature.DefaultMutableFeatureGate.Enabled(features.BackupHealth)
+	featureAutoscalingEnabled := utilfeature.DefaultMutableFeatureGate.Enabled(features.Autoscaling)
+	featureResourceAutoscalingEnabled := utilfeature.DefaultMutableFeatureGate.Enabled(features.ResourceAutoscaling)
+	featureDeadNodeReplacementEnabled := utilfeature.DefaultMutableFeatureGate.Enabled(features.DeadNodeReplacement)
+	featureCertificateRenewalEnabled := utilfeature.DefaultMutableFeatureGate.Enabled(features.CertificateRenewal)
+	featureCertificateExpiryEnabled := utilfeature.DefaultMutableFeatureGate.Enabled(features.CertificateExpiry)
+	featureCertificateReloadEnabled := utilfeature.DefaultMutableFeatureGate.Enabled(features.CertificateReload)
+	featureTopologyLocalityEnabled := utilfeature.DefaultMutableFeatureGate.Enabled(features.TopologyLocality)
 	conditionInitializedTrue := condition.True(api.InitializedCondition, conditions)
 	conditionInitializedFalse := condition.False(api.InitializedCondition, conditions)
 	conditionVersionCheckedTrue := condition.True(api.CrdbVersionChecked, conditions)
@@ -117,6 +228,56 @@ func (cd *clusterDirector) GetActorsToExecute(cluster *resource.Cluster) []Actor
 
 	var actorsToExecute []Actor
 
+	// a scheduled change of the number of nodes cancels the loop, the other
+	// actors apply it on the next one
+	if featureScheduledScalingEnabled && conditionInitializedTrue && len(cluster.Spec().ScalingSchedule) > 0 {
+		actorsToExecute = append(actorsToExecute, cd.actors[api.ScheduledScalingAction])
+	}
+
+	// the autoscaler changes the number of nodes and cancels the loop like a
+	// scheduled change, the nodes it removes are decommissioned on the next one
+	if featureAutoscalingEnabled && featureDecommissionEnabled && conditionInitializedTrue && cluster.Spec().Autoscaling != nil {
+		actorsToExecute = append(actorsToExecute, cd.actors[api.AutoscalingAction])
+	}
+
+	// the resource autoscaler changes the requests in the spec and cancels the
+	// loop, the pods are resized one at a time on the next one
+	if featureResourceAutoscalingEnabled && featureVerticalResizeEnabled && conditionInitializedTrue && cluster.Spec().ResourceAutoscaling != nil {
+		actorsToExecute = append(actorsToExecute, cd.actors[api.ResourceAutoscalingAction])
+	}
+
+	// a scheduled restart, or the one of restartAt, sets the restart type
+	// annotation and cancels the loop, the cluster restart actor restarts the
+	// pods on the next one
+	if featureScheduledRestartEnabled && featureClusterRestartEnabled && conditionInitializedTrue &&
+		(cluster.Spec().RestartSchedule != "" || cluster.Spec().RestartAt != nil) {
+		actorsToExecute = append(actorsToExecute, cd.actors[api.ScheduledRestartAction])
+	}
+
+	// the renewal of the certificates sets the restart type or the reload
+	// annotation and cancels the loop like a scheduled restart. The
+	// certificates issued from Vault are renewed without a rotation policy.
+	if featureCertificateRenewalEnabled && featureClusterRestartEnabled && conditionInitializedTrue &&
+		cluster.Spec().TLSEnabled && cluster.Spec().NodeTLSSecret == "" &&
+		(cluster.Spec().VaultPKI != nil || cluster.Spec().CertificateRotation != nil) {
+		actorsToExecute = append(actorsToExecute, cd.actors[api.CertificateRenewalAction])
+	}
+
+	// the nodes load the changed node certificate with the SIGHUP reload or a
+	// rolling restart. The reloads the renewals and the requested rotations
+	// start are finished with the feature gate disabled.
+	if conditionInitializedTrue && cluster.Spec().TLSEnabled &&
+		(featureCertificateReloadEnabled || cluster.GetAnnotationCertReload() != "") {
+		actorsToExecute = append(actorsToExecute, cd.actors[api.CertificateReloadAction])
+	}
+
+	// a requested restart sets the restart type annotation and cancels the
+	// loop like a scheduled one
+	if featureRequestedOperationsEnabled && conditionInitializedTrue &&
+		(cluster.GetAnnotationOperation() != "" || cluster.RunningOperation() != nil) {
+		actorsToExecute = append(actorsToExecute, cd.actors[api.RequestedOperationAction])
+	}
+
 	if featureDecommissionEnabled && conditionInitializedTrue {
 		actorsToExecute = append(actorsToExecute, cd.actors[api.DecommissionAction])
 	}
@@ -141,6 +302,17 @@ func (cd *clusterDirector) GetActorsToExecute(cluster *resource.Cluster) []Actor
 		actorsToExecute = append(actorsToExecute, cd.actors[api.ResizePVCAction])
 	}
 
+	if featureVerticalResizeEnabled && conditionInitializedTrue {
+		actorsToExecute = append(actorsToExecute, cd.actors[api.ResizeResourcesAction])
+	}
+
+	// the pods wait for their locality before their nodes start, including
+	// the nodes that initialize the cluster. It runs before the deploy, which
+	// cancels the loop when it changes the StatefulSet.
+	if featureTopologyLocalityEnabled && cluster.Spec().TopologyLocality != nil && (conditionInitializedTrue || conditionInitializedFalse) {
+		actorsToExecute = append(actorsToExecute, cd.actors[api.TopologyLocalityAction])
+	}
+
 	if featureVersionValidatorEnabled && conditionVersionCheckedTrue && (conditionInitializedTrue || conditionInitializedFalse) {
 		actorsToExecute = append(actorsToExecute, cd.actors[api.DeployAction])
 	} else if !featureVersionValidatorEnabled && (conditionInitializedTrue || conditionInitializedFalse) {
@@ -158,9 +330,79 @@ func (cd *clusterDirector) GetActorsToExecute(cluster *resource.Cluster) []Actor
 		actorsToExecute = append(actorsToExecute, cd.actors[api.ClusterRestartAction])
 	}
 
+	if featureSelfHealingEnabled && conditionInitializedTrue {
+		actorsToExecute = append(actorsToExecute, cd.actors[api.SelfHealingAction])
+	}
+
+	if featureDeadNodeReplacementEnabled && conditionInitializedTrue && cluster.Spec().SelfHealing.ReplaceDeadNodesEnabled() {
+		actorsToExecute = append(actorsToExecute, cd.actors[api.DeadNodeReplacementAction])
+	}
+
+	if featureNodeHealthEnabled && conditionInitializedTrue {
+		actorsToExecute = append(actorsToExecute, cd.actors[api.NodeHealthAction])
+	}
+
+	if featureStoragePressureEnabled && conditionInitializedTrue {
+		actorsToExecute = append(actorsToExecute, cd.actors[api.StoragePressureAction])
+	}
+
+	if featureCloneEnabled && conditionInitializedTrue && cluster.Spec().CloneFrom != nil && !cluster.Status().Clone.Done() {
+		actorsToExecute = append(actorsToExecute, cd.actors[api.CloneAction])
+	}
+
+	if featureDatabaseRegionsEnabled && conditionInitializedTrue && len(cluster.Spec().DatabaseRegions) > 0 {
+		actorsToExecute = append(actorsToExecute, cd.actors[api.DatabaseRegionsAction])
+	}
+
+	// the data is loaded once, after the data of a clone is restored
+	if featureDemoWorkloadEnabled && conditionInitializedTrue && cluster.Spec().DemoWorkload != nil &&
+		!cluster.True(api.DemoWorkloadLoadedCondition) && (cluster.Spec().CloneFrom == nil || cluster.Status().Clone.Done()) {
+		actorsToExecute = append(actorsToExecute, cd.actors[api.DemoWorkloadAction])
+	}
+
+	if featureSQLReadinessEnabled && conditionInitializedTrue {
+		actorsToExecute = append(actorsToExecute, cd.actors[api.SQLReadinessAction])
+	}
+
+	// the condition left by a removed policy has the actor clean up after it
+	if featureEvictionPolicyEnabled && conditionInitializedTrue &&
+		(cluster.Spec().Eviction != nil || findCondition(cluster, api.EvictionSafeCondition).Type != "") {
+		actorsToExecute = append(actorsToExecute, cd.actors[api.EvictionAction])
+	}
+
+	if featureHealthMetricsEnabled && conditionInitializedTrue {
+		actorsToExecute = append(actorsToExecute, cd.actors[api.HealthMetricsAction])
+	}
+
+	if featureCertificateExpiryEnabled && conditionInitializedTrue && cluster.Spec().TLSEnabled {
+		actorsToExecute = append(actorsToExecute, cd.actors[api.CertificateExpiryAction])
+	}
+
+	if featureCrdbExportsEnabled && conditionInitializedTrue {
+		actorsToExecute = append(actorsToExecute, cd.actors[api.ScheduledExportAction])
+	}
+
+	if featureClusterReplicationEnabled && conditionInitializedTrue && cluster.Spec().Replication != nil {
+		actorsToExecute = append(actorsToExecute, cd.actors[api.ReplicationAction])
+	}
+
+	if featureBackupHealthEnabled && featureCrdbBackupsEnabled && conditionInitializedTrue {
+		actorsToExecute = append(actorsToExecute, cd.actors[api.BackupHealthAction])
+	}
+
 	return actorsToExecute
 }
 
+func (cd *clusterDirector) GetObserversToExecute(cluster *resource.Cluster) []Actor {
+	var observersToExecute []Actor
+	for _, a := range cd.GetActorsToExecute(cluster) {
+		if observers[a.GetActionType()] {
+			observersToExecute = append(observersToExecute, a)
+		}
+	}
+	return observersToExecute
+}
+
 //Log var
 var Log = logf.Log.WithName("action")
 
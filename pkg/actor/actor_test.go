@@ -19,10 +19,14 @@ package actor_test
 import (
 	api "github.com/cockroachdb/cockroach-operator/apis/v1alpha1"
 	"github.com/cockroachdb/cockroach-operator/pkg/actor"
+	"github.com/cockroachdb/cockroach-operator/pkg/features"
 	"github.com/cockroachdb/cockroach-operator/pkg/resource"
 	"github.com/cockroachdb/cockroach-operator/pkg/testutil"
 	"github.com/cockroachdb/cockroach-operator/pkg/utilfeature"
 	"github.com/stretchr/testify/require"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/tools/record"
 	"testing"
 )
 
@@ -44,11 +48,18 @@ func createTestDirectorAndCluster(t *testing.T) (*resource.Cluster, actor.Direct
 
 	scheme := testutil.InitScheme(t)
 	client := testutil.NewFakeClient(scheme)
-	director := actor.NewDirector(scheme, client, nil)
+	director := actor.NewDirector(scheme, client, nil, record.NewFakeRecorder(10))
 
 	return cluster, director
 }
 
+// updateSpec changes the spec of the cluster in place, Spec only returns a copy
+func updateSpec(cluster *resource.Cluster, update func(spec *api.CrdbClusterSpec)) {
+	cr := cluster.Unwrap()
+	update(&cr.Spec)
+	*cluster = resource.NewCluster(cr)
+}
+
 func TestDecommissionFeatureGate(t *testing.T) {
 	cluster, director := createTestDirectorAndCluster(t)
 
@@ -91,6 +102,223 @@ func TestResizePVCFeatureGate(t *testing.T) {
 	require.False(t, containsAction(actors, api.ResizePVCAction))
 }
 
+func TestVerticalResizeFeatureGate(t *testing.T) {
+	cluster, director := createTestDirectorAndCluster(t)
+
+	cluster.SetTrue(api.InitializedCondition)
+
+	enabled := utilfeature.DefaultMutableFeatureGate.Enabled(features.VerticalResize)
+	t.Cleanup(func() {
+		utilfeature.DefaultMutableFeatureGate.SetFromMap(map[string]bool{string(features.VerticalResize): enabled})
+	})
+
+	utilfeature.DefaultMutableFeatureGate.Set("VerticalResize=true")
+	actors := director.GetActorsToExecute(cluster)
+	require.True(t, containsAction(actors, api.ResizeResourcesAction))
+
+	utilfeature.DefaultMutableFeatureGate.Set("VerticalResize=false")
+	actors = director.GetActorsToExecute(cluster)
+	require.False(t, containsAction(actors, api.ResizeResourcesAction))
+}
+
+func TestScheduledScalingFeatureGate(t *testing.T) {
+	_, director := createTestDirectorAndCluster(t)
+
+	cr := testutil.NewBuilder("cockroachdb").Namespaced("default").WithNodeCount(3).Cr()
+	cr.Spec.ScalingSchedule = []api.ScheduledScaling{{Schedule: "@daily", Nodes: 3}}
+	cluster := resource.NewCluster(cr)
+	cluster.SetTrue(api.InitializedCondition)
+
+	utilfeature.DefaultMutableFeatureGate.Set("ScheduledScaling=true")
+	defer utilfeature.DefaultMutableFeatureGate.Set("ScheduledScaling=false")
+	actors := director.GetActorsToExecute(&cluster)
+	require.Equal(t, api.ScheduledScalingAction, actors[0].GetActionType())
+
+	utilfeature.DefaultMutableFeatureGate.Set("ScheduledScaling=false")
+	actors = director.GetActorsToExecute(&cluster)
+	require.False(t, containsAction(actors, api.ScheduledScalingAction))
+}
+
+func TestAutoscalingFeatureGate(t *testing.T) {
+	cluster, director := createTestDirectorAndCluster(t)
+	cluster.SetTrue(api.InitializedCondition)
+
+	utilfeature.DefaultMutableFeatureGate.Set("Autoscaling=true")
+	defer utilfeature.DefaultMutableFeatureGate.Set("Autoscaling=false")
+	actors := director.GetActorsToExecute(cluster)
+	require.False(t, containsAction(actors, api.AutoscalingAction))
+
+	updateSpec(cluster, func(spec *api.CrdbClusterSpec) {
+		spec.Autoscaling = &api.Autoscaling{MinNodes: 3, MaxNodes: 9}
+	})
+	actors = director.GetActorsToExecute(cluster)
+	require.True(t, containsAction(actors, api.AutoscalingAction))
+
+	utilfeature.DefaultMutableFeatureGate.Set("Autoscaling=false")
+	actors = director.GetActorsToExecute(cluster)
+	require.False(t, containsAction(actors, api.AutoscalingAction))
+	utilfeature.DefaultMutableFeatureGate.Set("Autoscaling=true")
+
+	utilfeature.DefaultMutableFeatureGate.Set("Decommission=false")
+	actors = director.GetActorsToExecute(cluster)
+	require.False(t, containsAction(actors, api.AutoscalingAction))
+	utilfeature.DefaultMutableFeatureGate.Set("Decommission=true")
+}
+
+func TestResourceAutoscalingFeatureGate(t *testing.T) {
+	cluster, director := createTestDirectorAndCluster(t)
+	cluster.SetTrue(api.InitializedCondition)
+
+	utilfeature.DefaultMutableFeatureGate.Set("ResourceAutoscaling=true,VerticalResize=true")
+	defer utilfeature.DefaultMutableFeatureGate.Set("ResourceAutoscaling=false,VerticalResize=false")
+	actors := director.GetActorsToExecute(cluster)
+	require.False(t, containsAction(actors, api.ResourceAutoscalingAction))
+
+	updateSpec(cluster, func(spec *api.CrdbClusterSpec) {
+		spec.ResourceAutoscaling = &api.ResourceAutoscaling{}
+	})
+	actors = director.GetActorsToExecute(cluster)
+	require.True(t, containsAction(actors, api.ResourceAutoscalingAction))
+
+	utilfeature.DefaultMutableFeatureGate.Set("ResourceAutoscaling=false")
+	actors = director.GetActorsToExecute(cluster)
+	require.False(t, containsAction(actors, api.ResourceAutoscalingAction))
+	utilfeature.DefaultMutableFeatureGate.Set("ResourceAutoscaling=true")
+
+	utilfeature.DefaultMutableFeatureGate.Set("VerticalResize=false")
+	actors = director.GetActorsToExecute(cluster)
+	require.False(t, containsAction(actors, api.ResourceAutoscalingAction))
+}
+
+func TestDeadNodeReplacementFeatureGate(t *testing.T) {
+	cluster, director := createTestDirectorAndCluster(t)
+	cluster.SetTrue(api.InitializedCondition)
+
+	utilfeature.DefaultMutableFeatureGate.Set("DeadNodeReplacement=true")
+	defer utilfeature.DefaultMutableFeatureGate.Set("DeadNodeReplacement=false")
+	actors := director.GetActorsToExecute(cluster)
+	require.False(t, containsAction(actors, api.DeadNodeReplacementAction))
+
+	updateSpec(cluster, func(spec *api.CrdbClusterSpec) {
+		spec.SelfHealing = &api.SelfHealing{ReplaceDeadNodes: true}
+	})
+	actors = director.GetActorsToExecute(cluster)
+	require.True(t, containsAction(actors, api.DeadNodeReplacementAction))
+
+	utilfeature.DefaultMutableFeatureGate.Set("DeadNodeReplacement=false")
+	actors = director.GetActorsToExecute(cluster)
+	require.False(t, containsAction(actors, api.DeadNodeReplacementAction))
+}
+
+func TestScheduledRestartFeatureGate(t *testing.T) {
+	cluster, director := createTestDirectorAndCluster(t)
+	cluster.SetTrue(api.InitializedCondition)
+
+	utilfeature.DefaultMutableFeatureGate.Set("ScheduledRestart=true")
+	defer utilfeature.DefaultMutableFeatureGate.Set("ScheduledRestart=false")
+	actors := director.GetActorsToExecute(cluster)
+	require.False(t, containsAction(actors, api.ScheduledRestartAction))
+
+	updateSpec(cluster, func(spec *api.CrdbClusterSpec) {
+		spec.RestartSchedule = "0 2 * * sun"
+	})
+	actors = director.GetActorsToExecute(cluster)
+	require.True(t, containsAction(actors, api.ScheduledRestartAction))
+
+	utilfeature.DefaultMutableFeatureGate.Set("ScheduledRestart=false")
+	actors = director.GetActorsToExecute(cluster)
+	require.False(t, containsAction(actors, api.ScheduledRestartAction))
+	utilfeature.DefaultMutableFeatureGate.Set("ScheduledRestart=true")
+
+	utilfeature.DefaultMutableFeatureGate.Set("ClusterRestart=false")
+	actors = director.GetActorsToExecute(cluster)
+	require.False(t, containsAction(actors, api.ScheduledRestartAction))
+	utilfeature.DefaultMutableFeatureGate.Set("ClusterRestart=true")
+}
+
+func TestCertificateRenewalFeatureGate(t *testing.T) {
+	cluster, director := createTestDirectorAndCluster(t)
+	cluster.SetTrue(api.InitializedCondition)
+
+	utilfeature.DefaultMutableFeatureGate.Set("CertificateRenewal=true")
+	defer utilfeature.DefaultMutableFeatureGate.Set("CertificateRenewal=false")
+	updateSpec(cluster, func(spec *api.CrdbClusterSpec) {
+		spec.TLSEnabled = true
+	})
+	actors := director.GetActorsToExecute(cluster)
+	require.False(t, containsAction(actors, api.CertificateRenewalAction))
+
+	updateSpec(cluster, func(spec *api.CrdbClusterSpec) {
+		spec.CertificateRotation = &api.CertificateRotation{Reload: api.CertificateReloadSIGHUP}
+	})
+	actors = director.GetActorsToExecute(cluster)
+	require.True(t, containsAction(actors, api.CertificateRenewalAction))
+
+	utilfeature.DefaultMutableFeatureGate.Set("CertificateRenewal=false")
+	actors = director.GetActorsToExecute(cluster)
+	require.False(t, containsAction(actors, api.CertificateRenewalAction))
+	utilfeature.DefaultMutableFeatureGate.Set("CertificateRenewal=true")
+
+	// the certificates of the secrets of the spec are not the operator's
+	updateSpec(cluster, func(spec *api.CrdbClusterSpec) {
+		spec.NodeTLSSecret = "node-certs"
+	})
+	actors = director.GetActorsToExecute(cluster)
+	require.False(t, containsAction(actors, api.CertificateRenewalAction))
+}
+
+func TestCertificateExpiryFeatureGate(t *testing.T) {
+	cluster, director := createTestDirectorAndCluster(t)
+	cluster.SetTrue(api.InitializedCondition)
+
+	utilfeature.DefaultMutableFeatureGate.Set("CertificateExpiry=true")
+	defer utilfeature.DefaultMutableFeatureGate.Set("CertificateExpiry=false")
+	actors := director.GetActorsToExecute(cluster)
+	require.False(t, containsAction(actors, api.CertificateExpiryAction))
+
+	// the certificates of the secrets of the spec are reported too
+	updateSpec(cluster, func(spec *api.CrdbClusterSpec) {
+		spec.TLSEnabled = true
+		spec.NodeTLSSecret = "node-certs"
+	})
+	actors = director.GetActorsToExecute(cluster)
+	require.True(t, containsAction(actors, api.CertificateExpiryAction))
+	require.True(t, containsAction(director.GetObserversToExecute(cluster), api.CertificateExpiryAction))
+
+	utilfeature.DefaultMutableFeatureGate.Set("CertificateExpiry=false")
+	actors = director.GetActorsToExecute(cluster)
+	require.False(t, containsAction(actors, api.CertificateExpiryAction))
+}
+
+func TestCertificateReloadFeatureGate(t *testing.T) {
+	cluster, director := createTestDirectorAndCluster(t)
+	cluster.SetTrue(api.InitializedCondition)
+
+	utilfeature.DefaultMutableFeatureGate.Set("CertificateReload=true")
+	defer utilfeature.DefaultMutableFeatureGate.Set("CertificateReload=false")
+	actors := director.GetActorsToExecute(cluster)
+	require.False(t, containsAction(actors, api.CertificateReloadAction))
+
+	// the certificates of the secrets of the spec are reloaded too
+	updateSpec(cluster, func(spec *api.CrdbClusterSpec) {
+		spec.TLSEnabled = true
+		spec.NodeTLSSecret = "node-certs"
+	})
+	actors = director.GetActorsToExecute(cluster)
+	require.True(t, containsAction(actors, api.CertificateReloadAction))
+
+	utilfeature.DefaultMutableFeatureGate.Set("CertificateReload=false")
+	actors = director.GetActorsToExecute(cluster)
+	require.False(t, containsAction(actors, api.CertificateReloadAction))
+
+	// the running reload is finished with the feature gate disabled
+	cr := cluster.Unwrap()
+	cr.Annotations = map[string]string{resource.CrdbCertReloadAnnotation: "fingerprint"}
+	*cluster = resource.NewCluster(cr)
+	actors = director.GetActorsToExecute(cluster)
+	require.True(t, containsAction(actors, api.CertificateReloadAction))
+}
+
 func TestClusterRestartFeatureGate(t *testing.T) {
 	cluster, director := createTestDirectorAndCluster(t)
 
@@ -106,6 +334,295 @@ func TestClusterRestartFeatureGate(t *testing.T) {
 	require.False(t, containsAction(actors, api.ClusterRestartAction))
 }
 
+func TestSelfHealingFeatureGate(t *testing.T) {
+	cluster, director := createTestDirectorAndCluster(t)
+
+	utilfeature.DefaultMutableFeatureGate.Set("SelfHealing=true")
+	defer utilfeature.DefaultMutableFeatureGate.Set("SelfHealing=false")
+	actors := director.GetActorsToExecute(cluster)
+	require.False(t, containsAction(actors, api.SelfHealingAction))
+
+	cluster.SetTrue(api.InitializedCondition)
+	actors = director.GetActorsToExecute(cluster)
+	require.True(t, containsAction(actors, api.SelfHealingAction))
+
+	utilfeature.DefaultMutableFeatureGate.Set("SelfHealing=false")
+	actors = director.GetActorsToExecute(cluster)
+	require.False(t, containsAction(actors, api.SelfHealingAction))
+}
+
+func TestNodeHealthFeatureGate(t *testing.T) {
+	cluster, director := createTestDirectorAndCluster(t)
+
+	cluster.SetTrue(api.InitializedCondition)
+
+	utilfeature.DefaultMutableFeatureGate.Set("NodeHealth=true")
+	defer utilfeature.DefaultMutableFeatureGate.Set("NodeHealth=false")
+	actors := director.GetActorsToExecute(cluster)
+	require.True(t, containsAction(actors, api.NodeHealthAction))
+
+	utilfeature.DefaultMutableFeatureGate.Set("NodeHealth=false")
+	actors = director.GetActorsToExecute(cluster)
+	require.False(t, containsAction(actors, api.NodeHealthAction))
+}
+
+func TestStoragePressureFeatureGate(t *testing.T) {
+	cluster, director := createTestDirectorAndCluster(t)
+
+	cluster.SetTrue(api.InitializedCondition)
+
+	utilfeature.DefaultMutableFeatureGate.Set("StoragePressure=true")
+	defer utilfeature.DefaultMutableFeatureGate.Set("StoragePressure=false")
+	actors := director.GetActorsToExecute(cluster)
+	require.True(t, containsAction(actors, api.StoragePressureAction))
+
+	utilfeature.DefaultMutableFeatureGate.Set("StoragePressure=false")
+	actors = director.GetActorsToExecute(cluster)
+	require.False(t, containsAction(actors, api.StoragePressureAction))
+}
+
+func TestSQLReadinessFeatureGate(t *testing.T) {
+	cluster, director := createTestDirectorAndCluster(t)
+
+	utilfeature.DefaultMutableFeatureGate.Set("SQLReadiness=true")
+	defer utilfeature.DefaultMutableFeatureGate.Set("SQLReadiness=false")
+	actors := director.GetActorsToExecute(cluster)
+	require.False(t, containsAction(actors, api.SQLReadinessAction))
+
+	cluster.SetTrue(api.InitializedCondition)
+	actors = director.GetActorsToExecute(cluster)
+	require.True(t, containsAction(actors, api.SQLReadinessAction))
+
+	utilfeature.DefaultMutableFeatureGate.Set("SQLReadiness=false")
+	actors = director.GetActorsToExecute(cluster)
+	require.False(t, containsAction(actors, api.SQLReadinessAction))
+}
+
+func TestCloneFeatureGate(t *testing.T) {
+	cluster, director := createTestDirectorAndCluster(t)
+	cluster.SetTrue(api.InitializedCondition)
+
+	utilfeature.DefaultMutableFeatureGate.Set("Clone=true")
+	defer utilfeature.DefaultMutableFeatureGate.Set("Clone=false")
+	actors := director.GetActorsToExecute(cluster)
+	require.False(t, containsAction(actors, api.CloneAction))
+
+	updateSpec(cluster, func(spec *api.CrdbClusterSpec) {
+		spec.CloneFrom = &api.CloneSource{Cluster: "source", BackupURI: "s3://backups/crdb"}
+	})
+	actors = director.GetActorsToExecute(cluster)
+	require.True(t, containsAction(actors, api.CloneAction))
+
+	utilfeature.DefaultMutableFeatureGate.Set("Clone=false")
+	actors = director.GetActorsToExecute(cluster)
+	require.False(t, containsAction(actors, api.CloneAction))
+	utilfeature.DefaultMutableFeatureGate.Set("Clone=true")
+
+	cluster.SetCloneStatus(api.CloneStatus{State: api.CloneSucceeded}, metav1.Now())
+	actors = director.GetActorsToExecute(cluster)
+	require.False(t, containsAction(actors, api.CloneAction))
+}
+
+func TestDatabaseRegionsFeatureGate(t *testing.T) {
+	cluster, director := createTestDirectorAndCluster(t)
+	cluster.SetTrue(api.InitializedCondition)
+
+	utilfeature.DefaultMutableFeatureGate.Set("DatabaseRegions=true")
+	defer utilfeature.DefaultMutableFeatureGate.Set("DatabaseRegions=false")
+	actors := director.GetActorsToExecute(cluster)
+	require.False(t, containsAction(actors, api.DatabaseRegionsAction))
+
+	updateSpec(cluster, func(spec *api.CrdbClusterSpec) {
+		spec.DatabaseRegions = []api.DatabaseRegionConfig{{Database: "movr", PrimaryRegion: "us-east1"}}
+	})
+	actors = director.GetActorsToExecute(cluster)
+	require.True(t, containsAction(actors, api.DatabaseRegionsAction))
+
+	utilfeature.DefaultMutableFeatureGate.Set("DatabaseRegions=false")
+	actors = director.GetActorsToExecute(cluster)
+	require.False(t, containsAction(actors, api.DatabaseRegionsAction))
+}
+
+func TestDemoWorkloadFeatureGate(t *testing.T) {
+	cluster, director := createTestDirectorAndCluster(t)
+	cluster.SetTrue(api.InitializedCondition)
+
+	utilfeature.DefaultMutableFeatureGate.Set("DemoWorkload=true")
+	defer utilfeature.DefaultMutableFeatureGate.Set("DemoWorkload=false")
+	actors := director.GetActorsToExecute(cluster)
+	require.False(t, containsAction(actors, api.DemoWorkloadAction))
+
+	updateSpec(cluster, func(spec *api.CrdbClusterSpec) {
+		spec.DemoWorkload = &api.DemoWorkload{Name: api.MovrWorkload}
+	})
+	actors = director.GetActorsToExecute(cluster)
+	require.True(t, containsAction(actors, api.DemoWorkloadAction))
+
+	utilfeature.DefaultMutableFeatureGate.Set("DemoWorkload=false")
+	actors = director.GetActorsToExecute(cluster)
+	require.False(t, containsAction(actors, api.DemoWorkloadAction))
+	utilfeature.DefaultMutableFeatureGate.Set("DemoWorkload=true")
+
+	// a clone loads the data once it is restored
+	updateSpec(cluster, func(spec *api.CrdbClusterSpec) {
+		spec.CloneFrom = &api.CloneSource{Cluster: "source", BackupURI: "s3://backups/crdb"}
+	})
+	actors = director.GetActorsToExecute(cluster)
+	require.False(t, containsAction(actors, api.DemoWorkloadAction))
+	cluster.SetCloneStatus(api.CloneStatus{State: api.CloneSucceeded}, metav1.Now())
+	actors = director.GetActorsToExecute(cluster)
+	require.True(t, containsAction(actors, api.DemoWorkloadAction))
+
+	cluster.SetTrue(api.DemoWorkloadLoadedCondition)
+	actors = director.GetActorsToExecute(cluster)
+	require.False(t, containsAction(actors, api.DemoWorkloadAction))
+}
+
+func TestEvictionPolicyFeatureGate(t *testing.T) {
+	cluster, director := createTestDirectorAndCluster(t)
+	cluster.SetTrue(api.InitializedCondition)
+
+	utilfeature.DefaultMutableFeatureGate.Set("EvictionPolicy=true")
+	defer utilfeature.DefaultMutableFeatureGate.Set("EvictionPolicy=false")
+	actors := director.GetActorsToExecute(cluster)
+	require.False(t, containsAction(actors, api.EvictionAction))
+
+	updateSpec(cluster, func(spec *api.CrdbClusterSpec) {
+		spec.Eviction = &api.EvictionPolicy{HealthAwareBudget: true}
+	})
+	actors = director.GetActorsToExecute(cluster)
+	require.True(t, containsAction(actors, api.EvictionAction))
+
+	utilfeature.DefaultMutableFeatureGate.Set("EvictionPolicy=false")
+	actors = director.GetActorsToExecute(cluster)
+	require.False(t, containsAction(actors, api.EvictionAction))
+	utilfeature.DefaultMutableFeatureGate.Set("EvictionPolicy=true")
+
+	// the actor runs once more after the policy is removed to clean up
+	updateSpec(cluster, func(spec *api.CrdbClusterSpec) {
+		spec.Eviction = nil
+	})
+	cluster.SetCondition(api.EvictionSafeCondition, metav1.ConditionFalse, "PodsNotReady", "2 of 3 pods are ready")
+	actors = director.GetActorsToExecute(cluster)
+	require.True(t, containsAction(actors, api.EvictionAction))
+}
+
+func TestHealthMetricsFeatureGate(t *testing.T) {
+	cluster, director := createTestDirectorAndCluster(t)
+
+	utilfeature.DefaultMutableFeatureGate.Set("HealthMetrics=true")
+	defer utilfeature.DefaultMutableFeatureGate.Set("HealthMetrics=false")
+	actors := director.GetActorsToExecute(cluster)
+	require.False(t, containsAction(actors, api.HealthMetricsAction))
+
+	cluster.SetTrue(api.InitializedCondition)
+	actors = director.GetActorsToExecute(cluster)
+	require.True(t, containsAction(actors, api.HealthMetricsAction))
+
+	utilfeature.DefaultMutableFeatureGate.Set("HealthMetrics=false")
+	actors = director.GetActorsToExecute(cluster)
+	require.False(t, containsAction(actors, api.HealthMetricsAction))
+}
+
+func TestCrdbExportsFeatureGate(t *testing.T) {
+	cluster, director := createTestDirectorAndCluster(t)
+
+	utilfeature.DefaultMutableFeatureGate.Set("CrdbExports=true")
+	defer utilfeature.DefaultMutableFeatureGate.Set("CrdbExports=false")
+	actors := director.GetActorsToExecute(cluster)
+	require.False(t, containsAction(actors, api.ScheduledExportAction))
+
+	cluster.SetTrue(api.InitializedCondition)
+	actors = director.GetActorsToExecute(cluster)
+	require.True(t, containsAction(actors, api.ScheduledExportAction))
+
+	utilfeature.DefaultMutableFeatureGate.Set("CrdbExports=false")
+	actors = director.GetActorsToExecute(cluster)
+	require.False(t, containsAction(actors, api.ScheduledExportAction))
+}
+
+func TestClusterReplicationFeatureGate(t *testing.T) {
+	cluster, director := createTestDirectorAndCluster(t)
+	cluster.SetTrue(api.InitializedCondition)
+
+	utilfeature.DefaultMutableFeatureGate.Set("ClusterReplication=true")
+	defer utilfeature.DefaultMutableFeatureGate.Set("ClusterReplication=false")
+	actors := director.GetActorsToExecute(cluster)
+	require.False(t, containsAction(actors, api.ReplicationAction))
+
+	updateSpec(cluster, func(spec *api.CrdbClusterSpec) {
+		spec.Replication = &api.ReplicationSource{
+			ConnectionSecretRef: corev1.SecretKeySelector{LocalObjectReference: corev1.LocalObjectReference{Name: "primary"}, Key: "uri"},
+		}
+	})
+	actors = director.GetActorsToExecute(cluster)
+	require.True(t, containsAction(actors, api.ReplicationAction))
+
+	utilfeature.DefaultMutableFeatureGate.Set("ClusterReplication=false")
+	actors = director.GetActorsToExecute(cluster)
+	require.False(t, containsAction(actors, api.ReplicationAction))
+}
+
+func TestBackupHealthFeatureGate(t *testing.T) {
+	cluster, director := createTestDirectorAndCluster(t)
+	cluster.SetTrue(api.InitializedCondition)
+
+	utilfeature.DefaultMutableFeatureGate.Set("BackupHealth=true,CrdbBackups=true")
+	defer utilfeature.DefaultMutableFeatureGate.Set("BackupHealth=false,CrdbBackups=false")
+	actors := director.GetActorsToExecute(cluster)
+	require.True(t, containsAction(actors, api.BackupHealthAction))
+
+	utilfeature.DefaultMutableFeatureGate.Set("CrdbBackups=false")
+	actors = director.GetActorsToExecute(cluster)
+	require.False(t, containsAction(actors, api.BackupHealthAction))
+	utilfeature.DefaultMutableFeatureGate.Set("CrdbBackups=true")
+
+	utilfeature.DefaultMutableFeatureGate.Set("BackupHealth=false")
+	actors = director.GetActorsToExecute(cluster)
+	require.False(t, containsAction(actors, api.BackupHealthAction))
+}
+
+func TestRequestedOperationsFeatureGate(t *testing.T) {
+	_, director := createTestDirectorAndCluster(t)
+
+	cr := testutil.NewBuilder("cockroachdb").Namespaced("default").WithNodeCount(1).Cr()
+	cluster := resource.NewCluster(cr)
+	cluster.SetTrue(api.InitializedCondition)
+
+	utilfeature.DefaultMutableFeatureGate.Set("RequestedOperations=true")
+	defer utilfeature.DefaultMutableFeatureGate.Set("RequestedOperations=false")
+	actors := director.GetActorsToExecute(&cluster)
+	require.False(t, containsAction(actors, api.RequestedOperationAction))
+
+	cr.Annotations = map[string]string{resource.CrdbOperationAnnotation: "r1:RollingRestart"}
+	cluster = resource.NewCluster(cr)
+	cluster.SetTrue(api.InitializedCondition)
+	actors = director.GetActorsToExecute(&cluster)
+	require.True(t, containsAction(actors, api.RequestedOperationAction))
+
+	utilfeature.DefaultMutableFeatureGate.Set("RequestedOperations=false")
+	actors = director.GetActorsToExecute(&cluster)
+	require.False(t, containsAction(actors, api.RequestedOperationAction))
+}
+
+func TestTopologyLocalityFeatureGate(t *testing.T) {
+	_, director := createTestDirectorAndCluster(t)
+
+	cr := testutil.NewBuilder("cockroachdb").Namespaced("default").WithNodeCount(1).Cr()
+	cr.Spec.TopologyLocality = &api.TopologyLocality{}
+	cluster := resource.NewCluster(cr)
+	cluster.SetTrue(api.InitializedCondition)
+
+	utilfeature.DefaultMutableFeatureGate.Set("TopologyLocality=true")
+	defer utilfeature.DefaultMutableFeatureGate.Set("TopologyLocality=false")
+	actors := director.GetActorsToExecute(&cluster)
+	require.True(t, containsAction(actors, api.TopologyLocalityAction))
+
+	utilfeature.DefaultMutableFeatureGate.Set("TopologyLocality=false")
+	actors = director.GetActorsToExecute(&cluster)
+	require.False(t, containsAction(actors, api.TopologyLocalityAction))
+}
+
 func actorsHaveTypes(actors []actor.Actor, actionTypes []api.ActionType) bool {
 	if len(actors) != len(actionTypes) {
 		return false
@@ -121,7 +638,8 @@ func actorsHaveTypes(actors []actor.Actor, actionTypes []api.ActionType) bool {
 func TestTotallyUninitialized(t *testing.T) {
 	cluster, director := createTestDirectorAndCluster(t)
 
-	utilfeature.DefaultMutableFeatureGate.Set("UseDecommission=true,CrdbVersionValidator=true,ResizePVC=true,ClusterRestart=true")
+	utilfeature.DefaultMutableFeatureGate.Set("UseDecommission=true,CrdbVersionValidator=true,ResizePVC=true,ClusterRestart=true,VerticalResize=true,SelfHealing=true,NodeHealth=true,StoragePressure=true,SQLReadiness=true,HealthMetrics=true,CrdbExports=true,CrdbBackups=true,BackupHealth=true")
+	defer utilfeature.DefaultMutableFeatureGate.Set("VerticalResize=false,SelfHealing=false,NodeHealth=false,StoragePressure=false,SQLReadiness=false,HealthMetrics=false,CrdbExports=false,CrdbBackups=false,BackupHealth=false")
 
 	actors := director.GetActorsToExecute(cluster)
 	require.True(t, actorsHaveTypes(actors, []api.ActionType{api.VersionCheckerAction, api.RequestCertAction}))
@@ -130,7 +648,8 @@ func TestTotallyUninitialized(t *testing.T) {
 func TestVersionCheckedButNotInitialized(t *testing.T) {
 	cluster, director := createTestDirectorAndCluster(t)
 
-	utilfeature.DefaultMutableFeatureGate.Set("UseDecommission=true,CrdbVersionValidator=true,ResizePVC=true,ClusterRestart=true")
+	utilfeature.DefaultMutableFeatureGate.Set("UseDecommission=true,CrdbVersionValidator=true,ResizePVC=true,ClusterRestart=true,VerticalResize=true,SelfHealing=true,NodeHealth=true,StoragePressure=true,SQLReadiness=true,HealthMetrics=true,CrdbExports=true,CrdbBackups=true,BackupHealth=true")
+	defer utilfeature.DefaultMutableFeatureGate.Set("VerticalResize=false,SelfHealing=false,NodeHealth=false,StoragePressure=false,SQLReadiness=false,HealthMetrics=false,CrdbExports=false,CrdbBackups=false,BackupHealth=false")
 	cluster.SetTrue(api.CrdbVersionChecked)
 
 	actors := director.GetActorsToExecute(cluster)
@@ -140,20 +659,34 @@ func TestVersionCheckedButNotInitialized(t *testing.T) {
 func TestInitializedButNotVersionChecked(t *testing.T) {
 	cluster, director := createTestDirectorAndCluster(t)
 
-	utilfeature.DefaultMutableFeatureGate.Set("UseDecommission=true,CrdbVersionValidator=true,ResizePVC=true,ClusterRestart=true")
+	utilfeature.DefaultMutableFeatureGate.Set("UseDecommission=true,CrdbVersionValidator=true,ResizePVC=true,ClusterRestart=true,VerticalResize=true,SelfHealing=true,NodeHealth=true,StoragePressure=true,SQLReadiness=true,HealthMetrics=true,CrdbExports=true,CrdbBackups=true,BackupHealth=true")
+	defer utilfeature.DefaultMutableFeatureGate.Set("VerticalResize=false,SelfHealing=false,NodeHealth=false,StoragePressure=false,SQLReadiness=false,HealthMetrics=false,CrdbExports=false,CrdbBackups=false,BackupHealth=false")
 	cluster.SetTrue(api.InitializedCondition)
 
 	actors := director.GetActorsToExecute(cluster)
-	require.True(t, actorsHaveTypes(actors, []api.ActionType{api.DecommissionAction, api.VersionCheckerAction, api.ResizePVCAction}))
+	require.True(t, actorsHaveTypes(actors, []api.ActionType{api.DecommissionAction, api.VersionCheckerAction, api.ResizePVCAction, api.ResizeResourcesAction, api.SelfHealingAction, api.NodeHealthAction, api.StoragePressureAction, api.SQLReadinessAction, api.HealthMetricsAction, api.ScheduledExportAction, api.BackupHealthAction}))
 }
 
 func TestVersionCheckedAndInitialized(t *testing.T) {
 	cluster, director := createTestDirectorAndCluster(t)
 
-	utilfeature.DefaultMutableFeatureGate.Set("UseDecommission=true,CrdbVersionValidator=true,ResizePVC=true,ClusterRestart=true")
+	utilfeature.DefaultMutableFeatureGate.Set("UseDecommission=true,CrdbVersionValidator=true,ResizePVC=true,ClusterRestart=true,VerticalResize=true,SelfHealing=true,NodeHealth=true,StoragePressure=true,SQLReadiness=true,HealthMetrics=true,CrdbExports=true,CrdbBackups=true,BackupHealth=true")
+	defer utilfeature.DefaultMutableFeatureGate.Set("VerticalResize=false,SelfHealing=false,NodeHealth=false,StoragePressure=false,SQLReadiness=false,HealthMetrics=false,CrdbExports=false,CrdbBackups=false,BackupHealth=false")
 	cluster.SetTrue(api.InitializedCondition)
 	cluster.SetTrue(api.CrdbVersionChecked)
 
 	actors := director.GetActorsToExecute(cluster)
-	require.True(t, actorsHaveTypes(actors, []api.ActionType{api.DecommissionAction, api.PartitionedUpdateAction, api.ResizePVCAction, api.DeployAction, api.ClusterRestartAction}))
+	require.True(t, actorsHaveTypes(actors, []api.ActionType{api.DecommissionAction, api.PartitionedUpdateAction, api.ResizePVCAction, api.ResizeResourcesAction, api.DeployAction, api.ClusterRestartAction, api.SelfHealingAction, api.NodeHealthAction, api.StoragePressureAction, api.SQLReadinessAction, api.HealthMetricsAction, api.ScheduledExportAction, api.BackupHealthAction}))
+}
+
+func TestObserversOnlyObserve(t *testing.T) {
+	cluster, director := createTestDirectorAndCluster(t)
+
+	utilfeature.DefaultMutableFeatureGate.Set("UseDecommission=true,CrdbVersionValidator=true,ResizePVC=true,ClusterRestart=true,VerticalResize=true,SelfHealing=true,NodeHealth=true,StoragePressure=true,SQLReadiness=true,HealthMetrics=true,CrdbExports=true,CrdbBackups=true,BackupHealth=true")
+	defer utilfeature.DefaultMutableFeatureGate.Set("VerticalResize=false,SelfHealing=false,NodeHealth=false,StoragePressure=false,SQLReadiness=false,HealthMetrics=false,CrdbExports=false,CrdbBackups=false,BackupHealth=false")
+	cluster.SetTrue(api.InitializedCondition)
+	cluster.SetTrue(api.CrdbVersionChecked)
+
+	actors := director.GetObserversToExecute(cluster)
+	require.True(t, actorsHaveTypes(actors, []api.ActionType{api.NodeHealthAction, api.SQLReadinessAction, api.HealthMetricsAction, api.BackupHealthAction}))
 }
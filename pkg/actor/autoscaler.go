@@ -0,0 +1,341 @@
+/*
+Copyright 2021 The Cockroach Authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    https://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package actor
+
+import (
+	"bufio"
+	"context"
+	"crypto/tls"
+	"fmt"
+	"io"
+	"math"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	api "github.com/cockroachdb/cockroach-operator/apis/v1alpha1"
+	"github.com/cockroachdb/cockroach-operator/pkg/kube"
+	"github.com/cockroachdb/cockroach-operator/pkg/resource"
+	"github.com/cockroachdb/errors"
+	appsv1 "k8s.io/api/apps/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/rest"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+// the metrics of the _status/vars endpoint of the nodes the load is read from
+const (
+	cpuMetric     = "sys_cpu_combined_percent_normalized"
+	connsMetric   = "sql_conns"
+	queriesMetric = "sql_query_count"
+)
+
+// scrapeTimeout is how long the metrics of a node can take to be read.
+const scrapeTimeout = 10 * time.Second
+
+func newAutoscaler(scheme *runtime.Scheme, cl client.Client, config *rest.Config) Actor {
+	a := &autoscaler{
+		action: newAction("autoscaler", scheme, cl),
+		config: config,
+		now:    time.Now,
+	}
+	a.scrape = a.scrapeNodes
+	return a
+}
+
+// nodeLoad is the load of a node read from its Prometheus endpoint.
+type nodeLoad struct {
+	// cpu is the fraction of the CPU of the node used
+	cpu float64
+	// conns is the number of open SQL connections
+	conns float64
+	// queries is the number of SQL queries the node ran since it started
+	queries float64
+}
+
+// autoscaler polls the load of the nodes and sets the number of nodes in the
+// spec to the number the targets of the autoscaling policy call for. The
+// decommission and deploy actors then scale the cluster like for a manual
+// change. Nodes are added all at once but removed one at a time, and only
+// after the cluster kept its nodes for the scale down delay.
+type autoscaler struct {
+	action
+
+	config *rest.Config
+	now    func() time.Time
+	// scrape reads the load of every node of the cluster
+	scrape func(ctx context.Context, cluster *resource.Cluster) ([]nodeLoad, error)
+}
+
+//GetActionType returns api.AutoscalingAction used to set the cluster status errors
+func (a autoscaler) GetActionType() api.ActionType {
+	return api.AutoscalingAction
+}
+
+func (a autoscaler) Act(ctx context.Context, cluster *resource.Cluster) error {
+	log := a.log.WithValues("CrdbCluster", cluster.ObjectKey())
+	log.V(DEBUGLEVEL).Info("checking the load of the nodes")
+
+	policy := cluster.Spec().Autoscaling
+	if err := policy.Validate(); err != nil {
+		return ValidationError{Err: err}
+	}
+	// the nodes of the node pools are neither measured nor scaled
+	if err := cluster.Spec().ValidateNodePools(); err != nil {
+		return ValidationError{Err: err}
+	}
+
+	// the load is only measured once the last change of the number of nodes
+	// is done and every node is ready
+	nodes := cluster.Spec().Nodes
+	ss := &appsv1.StatefulSet{}
+	key := types.NamespacedName{Namespace: cluster.Namespace(), Name: cluster.StatefulSetName()}
+	if err := a.client.Get(ctx, key, ss); err != nil {
+		if apierrors.IsNotFound(err) {
+			return nil
+		}
+		return errors.Wrap(err, "failed to fetch the statefulset")
+	}
+	if ss.Status.Replicas != nodes || ss.Status.ReadyReplicas != nodes {
+		log.V(DEBUGLEVEL).Info("waiting for the nodes to be ready", "nodes", nodes, "ready", ss.Status.ReadyReplicas)
+		return nil
+	}
+
+	loads, err := a.scrape(ctx, cluster)
+	if err != nil {
+		log.Error(err, "failed to read the load of the nodes")
+		return nil
+	}
+
+	now := a.now()
+	status := summarizeLoad(loads, cluster.Status().Autoscaling, now)
+	status.DesiredNodes = policy.DesiredNodes(nodes, *status)
+	cluster.SetAutoscalingStatus(status)
+
+	target := status.DesiredNodes
+	if target < nodes {
+		if last := status.LastScaleTime; last != nil && now.Sub(last.Time) < policy.ScaleDownDelayOrDefault() {
+			log.V(DEBUGLEVEL).Info("waiting for the scale down delay", "desiredNodes", target)
+			return nil
+		}
+		target = nodes - 1
+	}
+	if target == nodes {
+		return nil
+	}
+
+	log.Info("autoscaling the cluster", "from", nodes, "to", target, "cpuUtilization", status.CPUUtilization,
+		"sqlConnections", status.SQLConnections, "queriesPerSecond", status.QueriesPerSecond)
+	return a.scaleTo(ctx, cluster, target, status, now)
+}
+
+// PollInterval returns how often the load of the nodes is measured and the
+// number of nodes adjusted to it, one node at a time when scaling down.
+func (a autoscaler) PollInterval(*resource.Cluster) time.Duration {
+	return pollInterval
+}
+
+// scaleTo sets the number of nodes in the spec. The status is saved right away,
+// as the spec is updated and the other actors must wait for the next loop.
+func (a autoscaler) scaleTo(ctx context.Context, cluster *resource.Cluster, nodes int32, status *api.AutoscalingStatus, now time.Time) error {
+	fetcher := resource.NewKubeFetcher(ctx, cluster.Namespace(), a.client)
+	cr := resource.ClusterPlaceholder(cluster.Name())
+	if err := fetcher.Fetch(cr); err != nil {
+		return errors.Wrap(err, "failed to fetch the CrdbCluster")
+	}
+
+	cr.Spec.Nodes = nodes
+	if err := a.client.Update(ctx, cr); err != nil {
+		return errors.Wrap(err, "failed to update the number of nodes")
+	}
+
+	scaled := metav1.NewTime(now)
+	status.LastScaleTime = &scaled
+	cr.Status.Autoscaling = status.DeepCopy()
+	if err := a.client.Status().Update(ctx, cr); err != nil {
+		return errors.Wrap(err, "failed to save the autoscaling status")
+	}
+
+	CancelLoop(ctx)
+	return nil
+}
+
+// summarizeLoad averages the load of the nodes. The queries per second are
+// computed from the query count of the previous measure, and are left out
+// when there is none or when the count went down as nodes restarted.
+func summarizeLoad(loads []nodeLoad, previous *api.AutoscalingStatus, now time.Time) *api.AutoscalingStatus {
+	var cpu, conns, queries float64
+	for _, l := range loads {
+		cpu += l.cpu
+		conns += l.conns
+		queries += l.queries
+	}
+
+	scraped := metav1.NewTime(now)
+	status := &api.AutoscalingStatus{QueryCount: int64(queries), LastScrapeTime: &scraped}
+	if len(loads) == 0 {
+		return status
+	}
+	n := float64(len(loads))
+	status.CPUUtilization = int32(math.Round(100 * cpu / n))
+	status.SQLConnections = int32(math.Round(conns / n))
+
+	if previous == nil {
+		return status
+	}
+	status.LastScaleTime = previous.LastScaleTime
+	if previous.LastScrapeTime != nil && status.QueryCount >= previous.QueryCount {
+		if elapsed := now.Sub(previous.LastScrapeTime.Time).Seconds(); elapsed > 0 {
+			status.QueriesPerSecond = int32(math.Round(float64(status.QueryCount-previous.QueryCount) / elapsed / n))
+		}
+	}
+	return status
+}
+
+// scrapeNodes reads the load of every node from the _status/vars endpoint of
+// its pod.
+func (a autoscaler) scrapeNodes(ctx context.Context, cluster *resource.Cluster) ([]nodeLoad, error) {
+	cl, err := a.httpClient(cluster)
+	if err != nil {
+		return nil, err
+	}
+
+	scheme := "http"
+	if cluster.Spec().TLSEnabled {
+		scheme = "https"
+	}
+	sts := cluster.StatefulSetName()
+	var loads []nodeLoad
+	for i := int32(0); i < cluster.Spec().Nodes; i++ {
+		pod := fmt.Sprintf("%s-%d", sts, i)
+		url := fmt.Sprintf("%s://%s.%s.%s:%d/_status/vars", scheme, pod, sts, cluster.Namespace(), *cluster.Spec().HTTPPort)
+		load, err := scrapeNode(ctx, cl, url)
+		if err != nil {
+			return nil, errors.Wrapf(err, "failed to read the load of pod %s", pod)
+		}
+		loads = append(loads, load)
+	}
+	return loads, nil
+}
+
+// httpClient returns a client reaching the pods of the cluster.
+func (a autoscaler) httpClient(cluster *resource.Cluster) (*http.Client, error) {
+	return podHTTPClient(a.config, cluster.Namespace())
+}
+
+// podHTTPClient returns a client reaching the pods of the namespace, through
+// the API server when the operator runs outside of Kubernetes. The
+// certificates of the nodes are not verified, as there may be no CA to verify
+// them against.
+func podHTTPClient(config *rest.Config, namespace string) (*http.Client, error) {
+	transport := &http.Transport{TLSClientConfig: &tls.Config{InsecureSkipVerify: true}}
+	if !inK8s("/var/run/secrets/kubernetes.io/serviceaccount/token") {
+		dialer, err := kube.NewPodDialer(config, namespace)
+		if err != nil {
+			return nil, errors.Wrap(err, "failed to create the pod dialer")
+		}
+		transport.DialContext = dialer.DialContext
+	}
+	return &http.Client{Transport: transport, Timeout: scrapeTimeout}, nil
+}
+
+func scrapeNode(ctx context.Context, cl *http.Client, url string) (nodeLoad, error) {
+	metrics, err := scrapeMetrics(ctx, cl, url, cpuMetric, connsMetric, queriesMetric)
+	if err != nil {
+		return nodeLoad{}, err
+	}
+	return loadOf(metrics), nil
+}
+
+// scrapeMetrics reads the metrics of a node from its _status/vars endpoint.
+func scrapeMetrics(ctx context.Context, cl *http.Client, url string, names ...string) (map[string]float64, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		return nil, err
+	}
+	resp, err := cl.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, errors.Newf("unexpected status %s", resp.Status)
+	}
+	return parseMetrics(resp.Body, names...)
+}
+
+// parseLoad reads the load of a node from its metrics in the Prometheus text
+// format.
+func parseLoad(r io.Reader) (nodeLoad, error) {
+	metrics, err := parseMetrics(r, cpuMetric, connsMetric, queriesMetric)
+	if err != nil {
+		return nodeLoad{}, err
+	}
+	return loadOf(metrics), nil
+}
+
+// loadOf returns the load of a node from its metrics.
+func loadOf(metrics map[string]float64) nodeLoad {
+	return nodeLoad{cpu: metrics[cpuMetric], conns: metrics[connsMetric], queries: metrics[queriesMetric]}
+}
+
+// parseMetrics reads the named metrics of a node in the Prometheus text
+// format. The values of a metric with several label sets are summed, and every
+// metric must be found.
+func parseMetrics(r io.Reader, names ...string) (map[string]float64, error) {
+	wanted := map[string]bool{}
+	for _, name := range names {
+		wanted[name] = true
+	}
+	metrics := map[string]float64{}
+
+	scanner := bufio.NewScanner(r)
+	for scanner.Scan() {
+		fields := strings.Fields(scanner.Text())
+		if len(fields) < 2 || strings.HasPrefix(fields[0], "#") {
+			continue
+		}
+		name := fields[0]
+		if i := strings.IndexByte(name, '{'); i >= 0 {
+			name = name[:i]
+		}
+		if !wanted[name] {
+			continue
+		}
+
+		v, err := strconv.ParseFloat(fields[1], 64)
+		if err != nil {
+			return metrics, errors.Wrapf(err, "invalid value of metric %s", name)
+		}
+		metrics[name] += v
+	}
+	if err := scanner.Err(); err != nil {
+		return metrics, err
+	}
+
+	for _, name := range names {
+		if _, ok := metrics[name]; !ok {
+			return metrics, errors.Newf("metric %s not found", name)
+		}
+	}
+	return metrics, nil
+}
@@ -0,0 +1,174 @@
+/*
+Copyright 2021 The Cockroach Authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    https://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package actor
+
+import (
+	"context"
+	"strings"
+	"testing"
+	"time"
+
+	api "github.com/cockroachdb/cockroach-operator/apis/v1alpha1"
+	"github.com/cockroachdb/cockroach-operator/pkg/resource"
+	"github.com/cockroachdb/cockroach-operator/pkg/testutil"
+	"github.com/stretchr/testify/require"
+	appsv1 "k8s.io/api/apps/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+)
+
+func TestAutoscaler(t *testing.T) {
+	scheme := testutil.InitScheme(t)
+	now := time.Date(2021, time.June, 2, 20, 30, 0, 0, time.UTC)
+	at := func(ago time.Duration) *metav1.Time {
+		mt := metav1.NewTime(now.Add(-ago))
+		return &mt
+	}
+	// loadOf returns the same load for each node
+	loadOf := func(nodes int, load nodeLoad) []nodeLoad {
+		loads := make([]nodeLoad, nodes)
+		for i := range loads {
+			loads[i] = load
+		}
+		return loads
+	}
+
+	tests := []struct {
+		name     string
+		nodes    int32
+		ready    int32
+		previous *api.AutoscalingStatus
+		loads    []nodeLoad
+		expected int32
+		desired  int32
+		qps      int32
+	}{
+		{
+			name:     "scales up on CPU",
+			nodes:    3,
+			ready:    3,
+			loads:    loadOf(3, nodeLoad{cpu: 0.9, conns: 10}),
+			expected: 4,
+			desired:  4,
+		},
+		{
+			name:     "scales up on queries per second",
+			nodes:    3,
+			ready:    3,
+			previous: &api.AutoscalingStatus{QueryCount: 3000, LastScrapeTime: at(time.Minute)},
+			loads:    loadOf(3, nodeLoad{cpu: 0.7, queries: 1000 + 60*600}),
+			expected: 4,
+			desired:  4,
+			qps:      600,
+		},
+		{
+			name:     "keeps its nodes during the scale down delay",
+			nodes:    5,
+			ready:    5,
+			previous: &api.AutoscalingStatus{LastScaleTime: at(5 * time.Minute)},
+			loads:    loadOf(5, nodeLoad{cpu: 0.1}),
+			expected: 5,
+			desired:  3,
+		},
+		{
+			name:     "removes one node at a time",
+			nodes:    5,
+			ready:    5,
+			previous: &api.AutoscalingStatus{LastScaleTime: at(time.Hour)},
+			loads:    loadOf(5, nodeLoad{cpu: 0.1}),
+			expected: 4,
+			desired:  3,
+		},
+		{
+			name:     "keeps its nodes within the tolerance",
+			nodes:    4,
+			ready:    4,
+			loads:    loadOf(4, nodeLoad{cpu: 0.65, conns: 120}),
+			expected: 4,
+			desired:  4,
+		},
+		{
+			name:     "waits for the nodes to be ready",
+			nodes:    4,
+			ready:    3,
+			expected: 4,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cr := testutil.NewBuilder("crdb").Namespaced("default").WithNodeCount(tt.nodes).Cr()
+			cr.Spec.Autoscaling = &api.Autoscaling{MinNodes: 3, MaxNodes: 9, TargetQueriesPerSecond: 500}
+			cr.Status.Autoscaling = tt.previous
+			ss := &appsv1.StatefulSet{
+				ObjectMeta: metav1.ObjectMeta{Namespace: "default", Name: "crdb"},
+				Status:     appsv1.StatefulSetStatus{Replicas: tt.nodes, ReadyReplicas: tt.ready},
+			}
+			cluster := resource.NewCluster(cr)
+			cl := fake.NewFakeClientWithScheme(scheme, cr, ss)
+
+			a := newAutoscaler(scheme, cl, nil).(*autoscaler)
+			a.now = func() time.Time { return now }
+			a.scrape = func(context.Context, *resource.Cluster) ([]nodeLoad, error) {
+				require.NotNil(t, tt.loads, "the load should not be read")
+				return tt.loads, nil
+			}
+
+			ctx, cancel := context.WithCancel(context.Background())
+			defer cancel()
+			err := a.Act(ContextWithCancelFn(ctx, cancel), &cluster)
+
+			actual := &api.CrdbCluster{}
+			require.NoError(t, cl.Get(ctx, client.ObjectKeyFromObject(cr), actual))
+			require.Equal(t, tt.expected, actual.Spec.Nodes)
+			if tt.expected == tt.nodes {
+				require.NoError(t, err)
+				require.NoError(t, ctx.Err(), "the loop should go on")
+			} else {
+				require.NoError(t, err)
+				require.Error(t, ctx.Err(), "the loop should be cancelled")
+				require.True(t, actual.Status.Autoscaling.LastScaleTime.Time.Equal(now))
+			}
+
+			if tt.loads != nil {
+				status := cluster.Status().Autoscaling
+				require.Equal(t, tt.desired, status.DesiredNodes)
+				require.Equal(t, tt.qps, status.QueriesPerSecond)
+			}
+		})
+	}
+}
+
+func TestParseLoad(t *testing.T) {
+	vars := `# HELP sys_cpu_combined_percent_normalized Current user+system cpu percentage consumed by the CRDB process, normalized 0-1 by number of cores
+# TYPE sys_cpu_combined_percent_normalized gauge
+sys_cpu_combined_percent_normalized 0.42
+# TYPE sql_conns gauge
+sql_conns 12
+# TYPE sql_query_count counter
+sql_query_count{query_type="select"} 1000
+sql_query_count{query_type="update"} 234
+ranges_underreplicated{store="1"} 0
+`
+	load, err := parseLoad(strings.NewReader(vars))
+	require.NoError(t, err)
+	require.Equal(t, nodeLoad{cpu: 0.42, conns: 12, queries: 1234}, load)
+
+	_, err = parseLoad(strings.NewReader("sql_conns 12\nsql_query_count 1000\n"))
+	require.EqualError(t, err, "metric sys_cpu_combined_percent_normalized not found")
+}
@@ -0,0 +1,121 @@
+/*
+Copyright 2021 The Cockroach Authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    https://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package actor
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	api "github.com/cockroachdb/cockroach-operator/apis/v1alpha1"
+	"github.com/cockroachdb/cockroach-operator/pkg/metrics"
+	"github.com/cockroachdb/cockroach-operator/pkg/resource"
+	"github.com/cockroachdb/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/client-go/rest"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+func newBackupHealth(scheme *runtime.Scheme, cl client.Client, config *rest.Config) Actor {
+	return &backupHealth{
+		action: newAction("backupHealth", scheme, cl),
+	}
+}
+
+// backupHealth summarizes the status of the CrdbBackups of the cluster in the
+// LastBackupCompleted and BackupFailing conditions, and exports it as metrics
+// of the operator, so that the backups can be alerted on from the cluster. The
+// cluster is reconciled again whenever the status of its backups changes.
+type backupHealth struct {
+	action
+}
+
+//GetActionType returns api.BackupHealthAction used to set the cluster status errors
+func (b backupHealth) GetActionType() api.ActionType {
+	return api.BackupHealthAction
+}
+
+func (b backupHealth) Act(ctx context.Context, cluster *resource.Cluster) error {
+	log := b.log.WithValues("CrdbCluster", cluster.ObjectKey())
+	log.V(DEBUGLEVEL).Info("checking the health of the backups")
+
+	list := &api.CrdbBackupList{}
+	if err := b.client.List(ctx, list, client.InNamespace(cluster.Namespace())); err != nil {
+		return errors.Wrap(err, "failed to list backups")
+	}
+
+	var health metrics.BackupHealth
+	var failing []string
+	for i := range list.Items {
+		backup := &list.Items[i]
+		if backup.Spec.ClusterName != cluster.Name() || backup.DeletionTimestamp != nil {
+			continue
+		}
+
+		health.Backups++
+		status := backup.Status
+		if last := status.LastSuccessfulBackupTime; last != nil && last.Time.After(health.LastCompleted) {
+			health.LastCompleted = last.Time
+		}
+		if backupFailing(status) {
+			health.FailingBackups++
+			failing = append(failing, fmt.Sprintf("%s: %s", backup.Name, status.Message))
+		}
+	}
+	metrics.SetBackupHealth(cluster.Namespace(), cluster.Name(), health)
+
+	// the conditions are only reported for the clusters with backups
+	if health.Backups == 0 {
+		cluster.RemoveCondition(api.LastBackupCompletedCondition)
+		cluster.RemoveCondition(api.BackupFailingCondition)
+		return nil
+	}
+
+	if health.LastCompleted.IsZero() {
+		cluster.SetCondition(api.LastBackupCompletedCondition, metav1.ConditionFalse, "NoBackupCompleted",
+			"no backup of the cluster completed yet")
+	} else {
+		cluster.SetCondition(api.LastBackupCompletedCondition, metav1.ConditionTrue, "BackupCompleted",
+			fmt.Sprintf("the last backup completed at %s", health.LastCompleted.UTC().Format(time.RFC3339)))
+	}
+
+	previous := findCondition(cluster, api.BackupFailingCondition)
+	if len(failing) > 0 {
+		sort.Strings(failing)
+		message := strings.Join(failing, "; ")
+		cluster.SetCondition(api.BackupFailingCondition, metav1.ConditionTrue, "BackupFailed", message)
+		if previous.Status != metav1.ConditionTrue {
+			log.Info("backups are failing", "backups", failing)
+		}
+		return nil
+	}
+	cluster.SetCondition(api.BackupFailingCondition, metav1.ConditionFalse, "BackupsSucceeding", "")
+	return nil
+}
+
+// backupFailing returns whether the schedules of a backup could not be created
+// or its last backup failed.
+func backupFailing(status api.CrdbBackupStatus) bool {
+	if status.Phase == api.BackupFailed {
+		return true
+	}
+	failed, succeeded := status.LastFailedBackupTime, status.LastSuccessfulBackupTime
+	return failed != nil && (succeeded == nil || failed.After(succeeded.Time))
+}
@@ -0,0 +1,133 @@
+/*
+Copyright 2021 The Cockroach Authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    https://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package actor
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	api "github.com/cockroachdb/cockroach-operator/apis/v1alpha1"
+	"github.com/cockroachdb/cockroach-operator/pkg/resource"
+	"github.com/cockroachdb/cockroach-operator/pkg/testutil"
+	"github.com/stretchr/testify/require"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+)
+
+func TestBackupHealth(t *testing.T) {
+	scheme := testutil.InitScheme(t)
+	earlier := metav1.NewTime(time.Date(2021, time.June, 1, 2, 0, 0, 0, time.UTC))
+	later := metav1.NewTime(time.Date(2021, time.June, 2, 2, 0, 0, 0, time.UTC))
+
+	newBackup := func(name, cluster string, status api.CrdbBackupStatus) *api.CrdbBackup {
+		return &api.CrdbBackup{
+			ObjectMeta: metav1.ObjectMeta{Namespace: "default", Name: name},
+			Spec:       api.CrdbBackupSpec{ClusterName: cluster, FullBackupSchedule: "@daily"},
+			Status:     status,
+		}
+	}
+
+	tests := []struct {
+		name      string
+		backups   []client.Object
+		completed *api.ClusterCondition
+		failing   *api.ClusterCondition
+	}{
+		{
+			name:    "cluster without backups",
+			backups: []client.Object{newBackup("other", "other", api.CrdbBackupStatus{Phase: api.BackupFailed})},
+		},
+		{
+			name: "backups completing",
+			backups: []client.Object{
+				newBackup("daily", "crdb", api.CrdbBackupStatus{Phase: api.BackupScheduled, LastSuccessfulBackupTime: &later}),
+				newBackup("weekly", "crdb", api.CrdbBackupStatus{
+					Phase:                    api.BackupScheduled,
+					LastSuccessfulBackupTime: &later,
+					LastFailedBackupTime:     &earlier,
+				}),
+			},
+			completed: &api.ClusterCondition{
+				Status:  metav1.ConditionTrue,
+				Reason:  "BackupCompleted",
+				Message: "the last backup completed at 2021-06-02T02:00:00Z",
+			},
+			failing: &api.ClusterCondition{Status: metav1.ConditionFalse, Reason: "BackupsSucceeding"},
+		},
+		{
+			name: "last backup failed",
+			backups: []client.Object{
+				newBackup("daily", "crdb", api.CrdbBackupStatus{
+					Phase:                    api.BackupScheduled,
+					LastSuccessfulBackupTime: &earlier,
+					LastFailedBackupTime:     &later,
+					Message:                  "failed to write to the collection",
+				}),
+				newBackup("hourly", "crdb", api.CrdbBackupStatus{Phase: api.BackupFailed, Message: "invalid schedule"}),
+			},
+			completed: &api.ClusterCondition{
+				Status:  metav1.ConditionTrue,
+				Reason:  "BackupCompleted",
+				Message: "the last backup completed at 2021-06-01T02:00:00Z",
+			},
+			failing: &api.ClusterCondition{
+				Status:  metav1.ConditionTrue,
+				Reason:  "BackupFailed",
+				Message: "daily: failed to write to the collection; hourly: invalid schedule",
+			},
+		},
+		{
+			name:    "no backup completed yet",
+			backups: []client.Object{newBackup("daily", "crdb", api.CrdbBackupStatus{Phase: api.BackupPending})},
+			completed: &api.ClusterCondition{
+				Status:  metav1.ConditionFalse,
+				Reason:  "NoBackupCompleted",
+				Message: "no backup of the cluster completed yet",
+			},
+			failing: &api.ClusterCondition{Status: metav1.ConditionFalse, Reason: "BackupsSucceeding"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cluster := testutil.NewBuilder("crdb").Namespaced("default").WithNodeCount(3).Cluster()
+			// the conditions of the backups that were removed are not left behind
+			cluster.SetCondition(api.BackupFailingCondition, metav1.ConditionTrue, "BackupFailed", "removed: failed")
+
+			b := newBackupHealth(scheme, fake.NewFakeClientWithScheme(scheme, tt.backups...), nil)
+			require.NoError(t, b.Act(context.Background(), cluster))
+
+			requireCondition(t, cluster, api.LastBackupCompletedCondition, tt.completed)
+			requireCondition(t, cluster, api.BackupFailingCondition, tt.failing)
+		})
+	}
+}
+
+// requireCondition checks the status, the reason and the message of the
+// condition of the cluster, or that it is not set when expected is nil.
+func requireCondition(t *testing.T, cluster *resource.Cluster, ctype api.ClusterConditionType, expected *api.ClusterCondition) {
+	actual := findCondition(cluster, ctype)
+	if expected == nil {
+		require.Empty(t, actual.Type)
+		return
+	}
+	require.Equal(t, expected.Status, actual.Status)
+	require.Equal(t, expected.Reason, actual.Reason)
+	require.Equal(t, expected.Message, actual.Message)
+}
@@ -0,0 +1,269 @@
+/*
+Copyright 2021 The Cockroach Authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    https://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package actor
+
+import (
+	"bytes"
+	"context"
+	"io/ioutil"
+	"path/filepath"
+
+	api "github.com/cockroachdb/cockroach-operator/apis/v1alpha1"
+	"github.com/cockroachdb/cockroach-operator/pkg/kube"
+	"github.com/cockroachdb/cockroach-operator/pkg/labels"
+	"github.com/cockroachdb/cockroach-operator/pkg/resource"
+	"github.com/cockroachdb/cockroach-operator/pkg/security"
+	"github.com/cockroachdb/cockroach-operator/pkg/util"
+	"github.com/cockroachdb/errors"
+	"github.com/go-logr/logr"
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+func newCARotation(cl client.Client, log logr.Logger) *caRotation {
+	return &caRotation{
+		client:      cl,
+		log:         log,
+		createCA:    createCA,
+		newProvider: newCAProvider,
+	}
+}
+
+// caRotation runs the phases of the rotation of the CA the operator generated
+// for a cluster. The new CA is kept in the ca-next secret of the cluster until
+// the old one is retired, so that each phase can run again after a failure:
+//
+//   - TrustBundle: the node and client secrets get a bundle of the old and the
+//     new CA certificates, with their certificates still signed by the old CA
+//   - Reissue: the node and client certificates are signed by the new CA
+//   - RetireOldCA: the secrets only trust the new CA, whose key replaces the key
+//     of the CA secret
+//
+// Each phase is followed by a rolling restart, for the nodes to load the
+// secrets before the next phase.
+type caRotation struct {
+	client client.Client
+	log    logr.Logger
+
+	// createCA generates the certificate and the key of a new CA
+	createCA func(tls *api.TLSConfig) (cert, key []byte, err error)
+	// newProvider returns the provider of the certificates signed by the CA,
+	// and a func that removes its files
+	newProvider func(tls *api.TLSConfig, caCert, caKey []byte) (security.CertificateProvider, func(), error)
+}
+
+// run runs the phase of the rotation.
+func (r *caRotation) run(ctx context.Context, cluster *resource.Cluster, phase api.CARotationPhase) error {
+	log := r.log.WithValues("CrdbCluster", cluster.ObjectKey(), "phase", phase)
+	log.Info("rotating the CA")
+
+	switch phase {
+	case api.CARotationTrustBundle:
+		return r.trustBundle(ctx, cluster)
+	case api.CARotationReissue:
+		return r.reissue(ctx, cluster)
+	case api.CARotationRetireOldCA:
+		return r.retire(ctx, cluster)
+	}
+	return errors.Newf("unknown phase %q of the CA rotation", phase)
+}
+
+// trustBundle generates the new CA, unless it exists, and appends its
+// certificate to the CA certificates of the node and client secrets.
+func (r *caRotation) trustBundle(ctx context.Context, cluster *resource.Cluster) error {
+	next, err := r.loadNextCA(ctx, cluster)
+	if err != nil {
+		return err
+	}
+	if next == nil {
+		cert, key, err := r.createCA(cluster.Spec().TLS)
+		if err != nil {
+			return errors.Wrap(err, "failed to generate the new CA")
+		}
+		next = resource.CreateTLSSecret(cluster.CANextSecretName(), r.resource(ctx, cluster)).
+			WithLabels(labels.Propagated(cluster.Unwrap(), api.PropagateSecret)).
+			WithAnnotations(cluster.Spec().PropagatedAnnotations(api.PropagateSecret))
+		if err := next.UpdateCAKeyAndCA(key, cert, r.log); err != nil {
+			return errors.Wrap(err, "failed to save the new CA")
+		}
+	}
+
+	for _, name := range []string{cluster.NodeTLSSecretName(), cluster.ClientTLSSecretName()} {
+		secret, err := resource.LoadTLSSecret(name, r.resource(ctx, cluster))
+		if err != nil {
+			return errors.Wrapf(err, "failed to get TLS secret %s", name)
+		}
+		if err := secret.UpdateCertAndCA(secret.Key(), appendCert(secret.CA(), next.CA()), r.log); err != nil {
+			return errors.Wrapf(err, "failed to update the CA certificates of TLS secret %s", name)
+		}
+	}
+	return nil
+}
+
+// reissue signs new node and client certificates with the new CA. The secrets
+// keep the bundle of both CA certificates.
+func (r *caRotation) reissue(ctx context.Context, cluster *resource.Cluster) error {
+	next, err := r.loadNextCA(ctx, cluster)
+	if err != nil {
+		return err
+	}
+	if next == nil {
+		return errors.Newf("the new CA is missing from secret %s", cluster.CANextSecretName())
+	}
+
+	provider, cleanup, err := r.newProvider(cluster.Spec().TLS, next.CA(), next.CAKey())
+	if err != nil {
+		return errors.Wrap(err, "failed to configure the new CA")
+	}
+	defer cleanup()
+
+	node, err := resource.LoadTLSSecret(cluster.NodeTLSSecretName(), r.resource(ctx, cluster))
+	if err != nil {
+		return errors.Wrap(err, "failed to get node TLS secret")
+	}
+	cert, err := provider.NodeCertificate(ctx, nodeCertHosts(cluster))
+	if err != nil {
+		return errors.Wrap(err, "failed to generate node certificate and key")
+	}
+	if err := node.UpdateCertAndKeyAndCA(cert.Cert, cert.Key, appendCert(node.CA(), next.CA()), r.log); err != nil {
+		return errors.Wrap(err, "failed to update node TLS secret certs")
+	}
+
+	rootClient, err := resource.LoadTLSSecret(cluster.ClientTLSSecretName(), r.resource(ctx, cluster))
+	if err != nil {
+		return errors.Wrap(err, "failed to get client TLS secret")
+	}
+	cert, err = provider.ClientCertificate(ctx, security.SQLUsername{U: "root"})
+	if err != nil {
+		return errors.Wrap(err, "failed to generate client certificate and key")
+	}
+	if err := rootClient.UpdateCertAndKeyAndCA(cert.Cert, cert.Key, appendCert(rootClient.CA(), next.CA()), r.log); err != nil {
+		return errors.Wrap(err, "failed to update client TLS secret certs")
+	}
+	return nil
+}
+
+// retire removes the old CA certificate from the node and client secrets,
+// saves the key of the new CA in the CA secret, and deletes the ca-next
+// secret. The old CA is already retired without the ca-next secret.
+func (r *caRotation) retire(ctx context.Context, cluster *resource.Cluster) error {
+	next, err := r.loadNextCA(ctx, cluster)
+	if err != nil || next == nil {
+		return err
+	}
+
+	for _, name := range []string{cluster.NodeTLSSecretName(), cluster.ClientTLSSecretName()} {
+		secret, err := resource.LoadTLSSecret(name, r.resource(ctx, cluster))
+		if err != nil {
+			return errors.Wrapf(err, "failed to get TLS secret %s", name)
+		}
+		if err := secret.UpdateCertAndCA(secret.Key(), next.CA(), r.log); err != nil {
+			return errors.Wrapf(err, "failed to update the CA certificates of TLS secret %s", name)
+		}
+	}
+
+	ca, err := resource.LoadTLSSecret(cluster.CASecretName(), r.resource(ctx, cluster))
+	if err != nil {
+		return errors.Wrap(err, "failed to get ca key secret")
+	}
+	if err := ca.UpdateCAKey(next.CAKey(), r.log); err != nil {
+		return errors.Wrap(err, "failed to update ca key secret")
+	}
+
+	secret := &corev1.Secret{ObjectMeta: metav1.ObjectMeta{Name: cluster.CANextSecretName(), Namespace: cluster.Namespace()}}
+	if err := r.client.Delete(ctx, secret); err != nil && !apierrors.IsNotFound(err) {
+		return errors.Wrapf(err, "failed to delete secret %s", secret.Name)
+	}
+	return nil
+}
+
+// loadNextCA returns the secret of the new CA, nil if there is none.
+func (r *caRotation) loadNextCA(ctx context.Context, cluster *resource.Cluster) (*resource.TLSSecret, error) {
+	secret, err := resource.LoadTLSSecret(cluster.CANextSecretName(), r.resource(ctx, cluster))
+	if kube.IgnoreNotFound(err) != nil {
+		return nil, errors.Wrapf(err, "failed to get secret %s", cluster.CANextSecretName())
+	}
+	if err != nil || !secret.ReadyCA() || len(secret.CA()) == 0 {
+		return nil, nil
+	}
+	return secret, nil
+}
+
+func (r *caRotation) resource(ctx context.Context, cluster *resource.Cluster) resource.Resource {
+	return resource.NewKubeResource(ctx, r.client, cluster.Namespace(), kube.DefaultPersister)
+}
+
+// appendCert returns the PEM bundle with the certificate appended, unless the
+// bundle has it already.
+func appendCert(bundle, cert []byte) []byte {
+	if bytes.Contains(bundle, bytes.TrimSpace(cert)) {
+		return bundle
+	}
+	out := append([]byte{}, bytes.TrimRight(bundle, "\n")...)
+	if len(out) > 0 {
+		out = append(out, '\n')
+	}
+	return append(out, cert...)
+}
+
+// createCA generates a new CA, with the lifetime and the key of spec.tls when
+// it is set.
+func createCA(tls *api.TLSConfig) ([]byte, []byte, error) {
+	certsDir, cleanup := util.CreateTempDir("certsDir")
+	defer cleanup()
+	caDir, cleanupCADir := util.CreateTempDir("caDir")
+	defer cleanupCADir()
+	caKey := filepath.Join(caDir, "ca.key")
+
+	if err := createOperatorCA(tls, certsDir, caKey, false, true); err != nil {
+		return nil, nil, err
+	}
+	cert, err := ioutil.ReadFile(filepath.Join(certsDir, "ca.crt"))
+	if err != nil {
+		return nil, nil, errors.Wrap(err, "unable to read ca.crt")
+	}
+	key, err := ioutil.ReadFile(caKey)
+	if err != nil {
+		return nil, nil, errors.Wrap(err, "unable to read ca.key")
+	}
+	return cert, key, nil
+}
+
+// newCAProvider writes the certificate and the key of the CA, for the provider
+// of the operator to sign the certificates with them.
+func newCAProvider(tls *api.TLSConfig, caCert, caKey []byte) (security.CertificateProvider, func(), error) {
+	certsDir, cleanup := util.CreateTempDir("certsDir")
+	caDir, cleanupCADir := util.CreateTempDir("caDir")
+	done := func() {
+		cleanup()
+		cleanupCADir()
+	}
+
+	keyPath := filepath.Join(caDir, "ca.key")
+	if err := ioutil.WriteFile(keyPath, caKey, 0600); err != nil {
+		done()
+		return nil, nil, errors.Wrap(err, "unable to write ca.key")
+	}
+	if err := ioutil.WriteFile(filepath.Join(certsDir, "ca.crt"), caCert, 0600); err != nil {
+		done()
+		return nil, nil, errors.Wrap(err, "unable to write ca.crt")
+	}
+
+	return newOperatorCAProvider(tls, certsDir, keyPath), done, nil
+}
@@ -0,0 +1,158 @@
+/*
+Copyright 2021 The Cockroach Authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    https://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package actor
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"testing"
+	"time"
+
+	api "github.com/cockroachdb/cockroach-operator/apis/v1alpha1"
+	"github.com/cockroachdb/cockroach-operator/pkg/resource"
+	"github.com/cockroachdb/cockroach-operator/pkg/security"
+	"github.com/cockroachdb/cockroach-operator/pkg/testutil"
+	"github.com/stretchr/testify/require"
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+)
+
+// testCAProvider issues the same certificates, and records the CA they are
+// signed by.
+type testCAProvider struct {
+	node, client []byte
+	ca           []byte
+}
+
+func (p *testCAProvider) NodeCertificate(context.Context, []string) (*security.Certificate, error) {
+	return &security.Certificate{Cert: p.node, Key: []byte("node-key"), CA: p.ca}, nil
+}
+
+func (p *testCAProvider) ClientCertificate(context.Context, security.SQLUsername) (*security.Certificate, error) {
+	return &security.Certificate{Cert: p.client, Key: []byte("client-key"), CA: p.ca}, nil
+}
+
+func TestCARotation(t *testing.T) {
+	ctx := context.Background()
+	now := time.Now()
+	oldCA, newCA := selfSignedCert(t, now, now.Add(time.Hour)), selfSignedCert(t, now, now.Add(2*time.Hour))
+	nodeCert, clientCert := selfSignedCert(t, now, now.Add(time.Hour)), selfSignedCert(t, now, now.Add(time.Hour))
+
+	cr := testutil.NewBuilder("crdb").Namespaced("default").WithNodeCount(3).WithTLS().Cr()
+	cluster := resource.NewCluster(cr)
+	tlsSecret := func(name string, data map[string][]byte) *corev1.Secret {
+		return &corev1.Secret{ObjectMeta: metav1.ObjectMeta{Namespace: "default", Name: name}, Data: data}
+	}
+	cl := fake.NewFakeClientWithScheme(testutil.InitScheme(t), cr,
+		tlsSecret("crdb-ca", map[string][]byte{"ca.key": []byte("old-key")}),
+		tlsSecret("crdb-node", map[string][]byte{"ca.crt": oldCA, "tls.crt": nodeCert, "tls.key": []byte("node-key")}),
+		tlsSecret("crdb-root", map[string][]byte{"ca.crt": oldCA, "tls.crt": clientCert, "tls.key": []byte("client-key")}),
+	)
+	secret := func(name string) map[string][]byte {
+		s := &corev1.Secret{}
+		err := cl.Get(ctx, types.NamespacedName{Namespace: "default", Name: name}, s)
+		if apierrors.IsNotFound(err) {
+			return nil
+		}
+		require.NoError(t, err)
+		return s.Data
+	}
+
+	created := 0
+	provider := &testCAProvider{node: selfSignedCert(t, now, now.Add(time.Hour)), client: selfSignedCert(t, now, now.Add(time.Hour))}
+	r := newCARotation(cl, Log)
+	r.createCA = func(*api.TLSConfig) ([]byte, []byte, error) {
+		created++
+		return newCA, []byte("new-key"), nil
+	}
+	r.newProvider = func(_ *api.TLSConfig, caCert, caKey []byte) (security.CertificateProvider, func(), error) {
+		require.Equal(t, newCA, caCert)
+		require.Equal(t, []byte("new-key"), caKey)
+		provider.ca = caCert
+		return provider, func() {}, nil
+	}
+
+	// the bundle is only appended once when the phase runs again
+	bundle := append(append([]byte{}, oldCA...), newCA...)
+	for i := 0; i < 2; i++ {
+		require.NoError(t, r.run(ctx, &cluster, api.CARotationTrustBundle))
+		require.Equal(t, 1, created)
+		require.Equal(t, newCA, secret("crdb-ca-next")["ca.crt"])
+		for _, name := range []string{"crdb-node", "crdb-root"} {
+			require.Equal(t, bundle, secret(name)["ca.crt"])
+		}
+		require.Equal(t, nodeCert, secret("crdb-node")["tls.crt"])
+		require.Equal(t, clientCert, secret("crdb-root")["tls.crt"])
+	}
+
+	require.NoError(t, r.run(ctx, &cluster, api.CARotationReissue))
+	require.Equal(t, provider.node, secret("crdb-node")["tls.crt"])
+	require.Equal(t, provider.client, secret("crdb-root")["tls.crt"])
+	require.Equal(t, bundle, secret("crdb-node")["ca.crt"])
+	require.Equal(t, bundle, secret("crdb-root")["ca.crt"])
+	require.Equal(t, []byte("old-key"), secret("crdb-ca")["ca.key"])
+
+	for i := 0; i < 2; i++ {
+		require.NoError(t, r.run(ctx, &cluster, api.CARotationRetireOldCA))
+		require.Equal(t, newCA, secret("crdb-node")["ca.crt"])
+		require.Equal(t, newCA, secret("crdb-root")["ca.crt"])
+		require.Equal(t, []byte("new-key"), secret("crdb-ca")["ca.key"])
+		require.Nil(t, secret("crdb-ca-next"))
+	}
+
+	// the certificates cannot be reissued once the new CA is gone
+	require.EqualError(t, r.run(ctx, &cluster, api.CARotationReissue), "the new CA is missing from secret crdb-ca-next")
+}
+
+func TestAppendCert(t *testing.T) {
+	now := time.Now()
+	a, b := selfSignedCert(t, now, now.Add(time.Hour)), selfSignedCert(t, now, now.Add(time.Hour))
+
+	require.Equal(t, a, appendCert(nil, a))
+	require.Equal(t, append(append([]byte{}, a...), b...), appendCert(a, b))
+	require.Equal(t, a, appendCert(a, a))
+}
+
+func TestCreateCAWithTLS(t *testing.T) {
+	tls := &api.TLSConfig{
+		CertDuration: &metav1.Duration{Duration: 24 * time.Hour},
+		CADuration:   &metav1.Duration{Duration: 30 * 24 * time.Hour},
+		KeyAlgorithm: api.KeyAlgorithmECDSA,
+	}
+
+	caCert, caKey, err := createCA(tls)
+	require.NoError(t, err)
+	ca, err := parseCertificate(caCert)
+	require.NoError(t, err)
+	require.IsType(t, &ecdsa.PublicKey{}, ca.PublicKey)
+	require.WithinDuration(t, time.Now().Add(30*24*time.Hour), ca.NotAfter, time.Minute)
+
+	provider, cleanup, err := newCAProvider(tls, caCert, caKey)
+	require.NoError(t, err)
+	defer cleanup()
+
+	client, err := provider.ClientCertificate(context.Background(), security.SQLUsername{U: "root"})
+	require.NoError(t, err)
+	cert, err := parseCertificate(client.Cert)
+	require.NoError(t, err)
+	require.NoError(t, cert.CheckSignatureFrom(ca))
+	require.IsType(t, &ecdsa.PublicKey{}, cert.PublicKey)
+	require.WithinDuration(t, time.Now().Add(24*time.Hour), cert.NotAfter, time.Minute)
+}
@@ -0,0 +1,274 @@
+/*
+Copyright 2021 The Cockroach Authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    https://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package actor
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	api "github.com/cockroachdb/cockroach-operator/apis/v1alpha1"
+	"github.com/cockroachdb/cockroach-operator/pkg/features"
+	"github.com/cockroachdb/cockroach-operator/pkg/kube"
+	"github.com/cockroachdb/cockroach-operator/pkg/resource"
+	"github.com/cockroachdb/cockroach-operator/pkg/utilfeature"
+	"github.com/cockroachdb/errors"
+	"github.com/go-logr/logr"
+	appsv1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	kubetypes "k8s.io/apimachinery/pkg/types"
+)
+
+// the metric of the _status/vars endpoint of the nodes counting the SQL
+// statements that failed
+const sqlFailuresMetric = "sql_failure_count"
+
+// canaryCheckInterval is how often the canaries are checked while they bake.
+const canaryCheckInterval = time.Minute
+
+// sqlCounts are the SQL statements a node ran since it started, and the ones
+// that failed.
+type sqlCounts struct {
+	queries  float64
+	failures float64
+}
+
+// canaryPods returns the number of canary pods of an upgrade of a
+// StatefulSet with the replicas, 0 when the upgrade has no canaries or when
+// the StatefulSet has no other pods.
+func canaryPods(cluster *resource.Cluster, replicas int32) int32 {
+	canary := cluster.Spec().UpgradeCanary
+	if !utilfeature.DefaultMutableFeatureGate.Enabled(features.CanaryUpgrade) || canary == nil {
+		return 0
+	}
+	if pods := canary.NodesOrDefault(); pods < replicas {
+		return pods
+	}
+	return 0
+}
+
+// upgradeCanaries returns the canaries of the last upgrade to the version,
+// nil when it had none or when it succeeded.
+func upgradeCanaries(upgrade *api.UpgradeStatus, version string) *api.CanaryStatus {
+	if upgrade == nil || upgrade.ToVersion != version || upgrade.State == api.UpgradeSucceeded {
+		return nil
+	}
+	return upgrade.Canary
+}
+
+// heldByCanaries returns whether the last upgrade left the StatefulSet at the
+// partition of its canaries, while they bake or after they degraded.
+func heldByCanaries(upgrade *api.UpgradeStatus) bool {
+	return upgrade != nil && upgrade.Canary != nil &&
+		(upgrade.Canary.State == api.CanaryBaking || upgrade.Canary.State == api.CanaryHalted)
+}
+
+// startBake records that the canaries run the new version, along with the
+// restarts and the SQL statements the bake is measured against.
+func (up *partitionedUpdate) startBake(ctx context.Context, cluster *resource.Cluster, ss *appsv1.StatefulSet, pods int32, fromImage string) (*api.CanaryStatus, error) {
+	restarts, notReady, err := up.canaryRestarts(ctx, cluster, ss, pods)
+	if err != nil {
+		return nil, err
+	}
+	if notReady != "" {
+		return nil, NotReadyErr{Err: errors.Newf("canary pod %s is not ready", notReady)}
+	}
+
+	canary, other, err := up.sqlCountsOf(ctx, cluster, ss, pods)
+	if err != nil {
+		return nil, err
+	}
+
+	return &api.CanaryStatus{
+		State:          api.CanaryBaking,
+		Pods:           pods,
+		FromImage:      fromImage,
+		BakeStartedAt:  metav1.NewTime(up.now()),
+		Restarts:       restarts,
+		CanaryQueries:  int64(canary.queries),
+		CanaryFailures: int64(canary.failures),
+		OtherQueries:   int64(other.queries),
+		OtherFailures:  int64(other.failures),
+	}, nil
+}
+
+// bake checks the canaries of the upgrade in progress. It returns true once
+// they ran the new version for the bake time without degrading. Until then,
+// the request is requeued to check them again, and the upgrade halts if they
+// degrade.
+func (up *partitionedUpdate) bake(ctx context.Context, cluster *resource.Cluster, ss *appsv1.StatefulSet, l logr.Logger) (bool, error) {
+	upgrade := cluster.Status().Upgrade
+	degraded, err := up.checkCanaries(ctx, cluster, ss, upgrade.Canary)
+	if err != nil {
+		return false, errors.Wrap(err, "failed to check the canaries")
+	}
+
+	if degraded != "" {
+		l.Info("the canaries degraded, halting the upgrade", "reason", degraded)
+		upgrade.State = api.UpgradeFailed
+		upgrade.Message = "the canaries degraded: " + degraded
+		upgrade.Canary.State = api.CanaryHalted
+		upgrade.Canary.HaltedGeneration = cluster.Unwrap().Generation
+		up.reportUpgrade(ctx, cluster, *upgrade)
+		cluster.ClearPendingOperation(up.GetActionType())
+		return false, nil
+	}
+
+	bakeTime := cluster.Spec().UpgradeCanary.BakeTimeOrDefault()
+	baked := up.now().Sub(upgrade.Canary.BakeStartedAt.Time)
+	if baked < bakeTime {
+		wait := bakeTime - baked
+		if wait > canaryCheckInterval {
+			wait = canaryCheckInterval
+		}
+		return false, DeferredErr{
+			Err:          errors.Newf("the canaries bake for another %s", (bakeTime - baked).Round(time.Second)),
+			RequeueAfter: wait,
+		}
+	}
+
+	l.Info("the canaries baked, upgrading the other pods", "bakeTime", bakeTime.String())
+	return true, nil
+}
+
+// checkCanaries returns why the canaries degraded since the bake started, or
+// an empty string while they are healthy: a canary pod is not ready or
+// restarted, or the share of the SQL statements that failed on the canaries
+// exceeds the one on the other nodes by more than the spec allows.
+func (up *partitionedUpdate) checkCanaries(ctx context.Context, cluster *resource.Cluster, ss *appsv1.StatefulSet, canary *api.CanaryStatus) (string, error) {
+	restarts, notReady, err := up.canaryRestarts(ctx, cluster, ss, canary.Pods)
+	if err != nil {
+		return "", err
+	}
+	if notReady != "" {
+		return fmt.Sprintf("canary pod %s is not ready", notReady), nil
+	}
+	if restarts > canary.Restarts {
+		return fmt.Sprintf("the canary pods restarted %d times", restarts-canary.Restarts), nil
+	}
+
+	canaryCounts, otherCounts, err := up.sqlCountsOf(ctx, cluster, ss, canary.Pods)
+	if err != nil {
+		return "", err
+	}
+	canaryRate := errorRate(canaryCounts, canary.CanaryQueries, canary.CanaryFailures)
+	otherRate := errorRate(otherCounts, canary.OtherQueries, canary.OtherFailures)
+	if canaryRate > otherRate+float64(cluster.Spec().UpgradeCanary.MaxSQLErrorRateIncreaseOrDefault()) {
+		return fmt.Sprintf("%.1f%% of the SQL statements failed on the canaries and %.1f%% on the other nodes", canaryRate, otherRate), nil
+	}
+	return "", nil
+}
+
+// errorRate returns the percentage of the SQL statements run since the bake
+// started that failed.
+func errorRate(counts sqlCounts, queries, failures int64) float64 {
+	ran := counts.queries - float64(queries)
+	if ran <= 0 {
+		return 0
+	}
+	return 100 * (counts.failures - float64(failures)) / ran
+}
+
+// canaryRestarts returns the restarts of the CockroachDB containers of the
+// canary pods, and the name of a canary pod that is not ready if any.
+func (up *partitionedUpdate) canaryRestarts(ctx context.Context, cluster *resource.Cluster, ss *appsv1.StatefulSet, pods int32) (int32, string, error) {
+	var restarts int32
+	replicas := *ss.Spec.Replicas
+	for i := replicas - pods; i < replicas; i++ {
+		name := fmt.Sprintf("%s-%d", ss.Name, i)
+		pod := &corev1.Pod{}
+		if err := up.client.Get(ctx, kubetypes.NamespacedName{Namespace: cluster.Namespace(), Name: name}, pod); err != nil {
+			if apierrors.IsNotFound(err) {
+				return restarts, name, nil
+			}
+			return 0, "", errors.Wrapf(err, "failed to get pod %s", name)
+		}
+		if !kube.IsPodReady(pod) {
+			return restarts, name, nil
+		}
+		for _, status := range pod.Status.ContainerStatuses {
+			if status.Name == resource.DbContainerName {
+				restarts += status.RestartCount
+			}
+		}
+	}
+	return restarts, "", nil
+}
+
+// sqlCountsOf returns the SQL statements of the canary nodes and the ones of
+// the other nodes. The nodes of the node pools, which are upgraded after the
+// canaries passed, are among the other nodes.
+func (up *partitionedUpdate) sqlCountsOf(ctx context.Context, cluster *resource.Cluster, ss *appsv1.StatefulSet, pods int32) (sqlCounts, sqlCounts, error) {
+	var canary, other sqlCounts
+	replicas := *ss.Spec.Replicas
+	var names []string
+	for i := int32(0); i < replicas; i++ {
+		names = append(names, fmt.Sprintf("%s-%d", ss.Name, i))
+	}
+
+	pools, err := resource.NodePoolStatefulSets(ctx, up.client, cluster)
+	if err != nil {
+		return canary, other, err
+	}
+	for _, pool := range pools {
+		for i := int32(0); pool.Spec.Replicas != nil && i < *pool.Spec.Replicas; i++ {
+			names = append(names, fmt.Sprintf("%s-%d", pool.Name, i))
+		}
+	}
+
+	counts, err := up.scrapeSQL(ctx, cluster, names)
+	if err != nil {
+		return canary, other, err
+	}
+	for i, c := range counts {
+		sum := &other
+		if int32(i) >= replicas-pods && int32(i) < replicas {
+			sum = &canary
+		}
+		sum.queries += c.queries
+		sum.failures += c.failures
+	}
+	return canary, other, nil
+}
+
+// scrapeSQLCounts reads the SQL statements of the pods from their
+// _status/vars endpoint.
+func (up *partitionedUpdate) scrapeSQLCounts(ctx context.Context, cluster *resource.Cluster, pods []string) ([]sqlCounts, error) {
+	cl, err := podHTTPClient(up.config, cluster.Namespace())
+	if err != nil {
+		return nil, err
+	}
+
+	scheme := "http"
+	if cluster.Spec().TLSEnabled {
+		scheme = "https"
+	}
+	// the pods of the node pools are under the service of the cluster too
+	service := cluster.DiscoveryServiceName()
+	var counts []sqlCounts
+	for _, pod := range pods {
+		url := fmt.Sprintf("%s://%s.%s.%s:%d/_status/vars", scheme, pod, service, cluster.Namespace(), *cluster.Spec().HTTPPort)
+		metrics, err := scrapeMetrics(ctx, cl, url, queriesMetric, sqlFailuresMetric)
+		if err != nil {
+			return nil, errors.Wrapf(err, "failed to read the SQL statements of pod %s", pod)
+		}
+		counts = append(counts, sqlCounts{queries: metrics[queriesMetric], failures: metrics[sqlFailuresMetric]})
+	}
+	return counts, nil
+}
@@ -0,0 +1,191 @@
+/*
+Copyright 2021 The Cockroach Authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    https://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package actor
+
+import (
+	"context"
+	"fmt"
+	"testing"
+	"time"
+
+	api "github.com/cockroachdb/cockroach-operator/apis/v1alpha1"
+	"github.com/cockroachdb/cockroach-operator/pkg/ptr"
+	"github.com/cockroachdb/cockroach-operator/pkg/resource"
+	"github.com/cockroachdb/cockroach-operator/pkg/testutil"
+	"github.com/go-logr/logr"
+	"github.com/stretchr/testify/require"
+	appsv1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+)
+
+func TestBakeCanaries(t *testing.T) {
+	start := time.Date(2021, 6, 1, 12, 0, 0, 0, time.UTC)
+	healthy := []sqlCounts{{queries: 2000, failures: 20}, {queries: 2000, failures: 20}, {queries: 2000, failures: 20}}
+
+	tests := []struct {
+		name     string
+		elapsed  time.Duration
+		notReady bool
+		restarts int32
+		counts   []sqlCounts
+		passed   bool
+		wait     time.Duration
+		halted   string
+	}{
+		{
+			name:    "the canaries bake",
+			elapsed: 10 * time.Minute,
+			counts:  healthy,
+			wait:    time.Minute,
+		},
+		{
+			name:    "the canaries check again at the end of the bake",
+			elapsed: 29*time.Minute + 30*time.Second,
+			counts:  healthy,
+			wait:    30 * time.Second,
+		},
+		{
+			name:    "the canaries baked",
+			elapsed: 30 * time.Minute,
+			counts:  healthy,
+			passed:  true,
+		},
+		{
+			name:     "a canary is not ready",
+			elapsed:  10 * time.Minute,
+			notReady: true,
+			counts:   healthy,
+			halted:   "the canaries degraded: canary pod crdb-2 is not ready",
+		},
+		{
+			name:     "a canary restarted",
+			elapsed:  10 * time.Minute,
+			restarts: 1,
+			counts:   healthy,
+			halted:   "the canaries degraded: the canary pods restarted 1 times",
+		},
+		{
+			name:    "the SQL statements fail on the canaries",
+			elapsed: 10 * time.Minute,
+			counts:  []sqlCounts{{queries: 2000, failures: 20}, {queries: 2000, failures: 20}, {queries: 2000, failures: 210}},
+			halted:  "the canaries degraded: 20.0% of the SQL statements failed on the canaries and 1.0% on the other nodes",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctx := context.Background()
+			scheme := testutil.InitScheme(t)
+
+			cr := testutil.NewBuilder("crdb").Namespaced("default").WithNodeCount(3).Cr()
+			cr.Generation = 4
+			cr.Spec.UpgradeCanary = &api.UpgradeCanary{Nodes: 1, BakeTime: &metav1.Duration{Duration: 30 * time.Minute}}
+			cr.Status.Upgrade = &api.UpgradeStatus{
+				State:       api.UpgradeInProgress,
+				FromVersion: "v20.2.8",
+				ToVersion:   "v21.1.0",
+				Partition:   ptr.Int32(2),
+				UpdatedPods: 1,
+				Canary: &api.CanaryStatus{
+					State:          api.CanaryBaking,
+					Pods:           1,
+					BakeStartedAt:  metav1.NewTime(start),
+					Restarts:       1,
+					CanaryQueries:  1000,
+					CanaryFailures: 10,
+					OtherQueries:   2000,
+					OtherFailures:  20,
+				},
+			}
+
+			objs := []runtime.Object{cr}
+			for i := 0; i < 3; i++ {
+				// the canary restarted once before the bake started
+				ready, restarts := corev1.ConditionTrue, int32(0)
+				if i == 2 {
+					restarts = 1 + tt.restarts
+					if tt.notReady {
+						ready = corev1.ConditionFalse
+					}
+				}
+				objs = append(objs, &corev1.Pod{
+					ObjectMeta: metav1.ObjectMeta{Name: fmt.Sprintf("crdb-%d", i), Namespace: "default"},
+					Status: corev1.PodStatus{
+						Conditions:        []corev1.PodCondition{{Type: corev1.PodReady, Status: ready}},
+						ContainerStatuses: []corev1.ContainerStatus{{Name: resource.DbContainerName, RestartCount: restarts}},
+					},
+				})
+			}
+			cl := fake.NewFakeClientWithScheme(scheme, objs...)
+
+			actual := &api.CrdbCluster{}
+			require.NoError(t, cl.Get(ctx, client.ObjectKeyFromObject(cr), actual))
+			cluster := resource.NewCluster(actual)
+
+			up := newPartitionedUpdate(scheme, cl, nil).(*partitionedUpdate)
+			up.now = func() time.Time { return start.Add(tt.elapsed) }
+			up.scrapeSQL = func(_ context.Context, _ *resource.Cluster, pods []string) ([]sqlCounts, error) {
+				require.Equal(t, []string{"crdb-0", "crdb-1", "crdb-2"}, pods)
+				return tt.counts, nil
+			}
+
+			ss := &appsv1.StatefulSet{
+				ObjectMeta: metav1.ObjectMeta{Name: "crdb", Namespace: "default"},
+				Spec:       appsv1.StatefulSetSpec{Replicas: ptr.Int32(3)},
+			}
+			passed, err := up.bake(ctx, &cluster, ss, logr.Discard())
+			require.Equal(t, tt.passed, passed)
+
+			if tt.wait != 0 {
+				require.Error(t, err)
+				require.Equal(t, tt.wait, err.(DeferredErr).RequeueAfter)
+				return
+			}
+			require.NoError(t, err)
+
+			require.NoError(t, cl.Get(ctx, client.ObjectKeyFromObject(cr), actual))
+			if tt.halted == "" {
+				require.Equal(t, api.UpgradeInProgress, actual.Status.Upgrade.State)
+				require.Equal(t, api.CanaryBaking, actual.Status.Upgrade.Canary.State)
+				return
+			}
+			require.Equal(t, api.UpgradeFailed, actual.Status.Upgrade.State)
+			require.Equal(t, tt.halted, actual.Status.Upgrade.Message)
+			require.Equal(t, api.CanaryHalted, actual.Status.Upgrade.Canary.State)
+			require.Equal(t, int64(4), actual.Status.Upgrade.Canary.HaltedGeneration)
+		})
+	}
+}
+
+func TestUpgradeCanaries(t *testing.T) {
+	canary := &api.CanaryStatus{State: api.CanaryHalted, Pods: 1}
+	failed := &api.UpgradeStatus{State: api.UpgradeFailed, ToVersion: "v21.1.0", Canary: canary}
+	require.Equal(t, canary, upgradeCanaries(failed, "v21.1.0"))
+	require.Nil(t, upgradeCanaries(failed, "v21.1.1"))
+	require.True(t, heldByCanaries(failed))
+
+	succeeded := &api.UpgradeStatus{State: api.UpgradeSucceeded, ToVersion: "v21.1.0", Canary: &api.CanaryStatus{State: api.CanaryPassed}}
+	require.Nil(t, upgradeCanaries(succeeded, "v21.1.0"))
+	require.False(t, heldByCanaries(succeeded))
+
+	require.Nil(t, upgradeCanaries(nil, "v21.1.0"))
+	require.False(t, heldByCanaries(nil))
+}
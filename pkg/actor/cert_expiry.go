@@ -0,0 +1,220 @@
+/*
+Copyright 2021 The Cockroach Authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    https://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package actor
+
+import (
+	"context"
+	"crypto/x509"
+	"encoding/pem"
+	"fmt"
+	"strings"
+	"time"
+
+	api "github.com/cockroachdb/cockroach-operator/apis/v1alpha1"
+	"github.com/cockroachdb/cockroach-operator/pkg/kube"
+	"github.com/cockroachdb/cockroach-operator/pkg/metrics"
+	"github.com/cockroachdb/cockroach-operator/pkg/resource"
+	"github.com/cockroachdb/errors"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/client-go/rest"
+	"k8s.io/client-go/tools/record"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+// certificateExpiryWarning is how long before a certificate of a cluster
+// expires the CertificateExpiringSoon condition is set.
+const certificateExpiryWarning = 30 * 24 * time.Hour
+
+func newCertExpiry(scheme *runtime.Scheme, cl client.Client, config *rest.Config, recorder record.EventRecorder) Actor {
+	return &certExpiry{
+		action:   newAction("certExpiry", scheme, cl),
+		recorder: recorder,
+		now:      time.Now,
+	}
+}
+
+// certExpiry reports the validity of the node and client certificates of the
+// cluster, and of the CA certificates the nodes trust, in its status and as
+// metrics of the operator. The CertificateExpiringSoon condition is set while
+// one of them expires within certificateExpiryWarning, or has expired, whoever
+// issued them.
+type certExpiry struct {
+	action
+
+	recorder record.EventRecorder
+	now      func() time.Time
+}
+
+// GetActionType returns api.CertificateExpiryAction used to set the cluster status errors
+func (e *certExpiry) GetActionType() api.ActionType {
+	return api.CertificateExpiryAction
+}
+
+func (e *certExpiry) Act(ctx context.Context, cluster *resource.Cluster) error {
+	log := e.log.WithValues("CrdbCluster", cluster.ObjectKey())
+	log.V(DEBUGLEVEL).Info("checking the expiry of the certificates")
+
+	certs, err := e.certificates(ctx, cluster)
+	if err != nil {
+		log.Error(err, "failed to read the certificates")
+		cluster.SetCondition(api.CertificateExpiringSoonCondition, metav1.ConditionUnknown, "CertificatesUnknown", err.Error())
+		return nil
+	}
+	if len(certs) == 0 {
+		return nil
+	}
+	cluster.SetCertificates(certs)
+
+	now := e.now()
+	var expiring []string
+	status, reason := metav1.ConditionFalse, "CertificatesValid"
+	for _, c := range certs {
+		if c.Name != metrics.CACertificate {
+			metrics.SetCertificateExpiry(cluster.Namespace(), cluster.Name(), c.Name, c.NotAfter.Time)
+		}
+		if now.Before(c.NotAfter.Add(-certificateExpiryWarning)) {
+			continue
+		}
+
+		status = metav1.ConditionTrue
+		if now.Before(c.NotAfter.Time) {
+			expiring = append(expiring, fmt.Sprintf("%s certificate of secret %s expires at %s", c.Name, c.Secret, c.NotAfter.UTC().Format(time.RFC3339)))
+			if reason != "CertificateExpired" {
+				reason = "CertificateExpiring"
+			}
+		} else {
+			expiring = append(expiring, fmt.Sprintf("%s certificate of secret %s expired at %s", c.Name, c.Secret, c.NotAfter.UTC().Format(time.RFC3339)))
+			reason = "CertificateExpired"
+		}
+	}
+	// the CA certificate that expires first is the one that matters
+	if ca := firstExpiringCA(certs); ca != nil {
+		metrics.SetCertificateExpiry(cluster.Namespace(), cluster.Name(), metrics.CACertificate, ca.NotAfter.Time)
+	}
+	message := strings.Join(expiring, "; ")
+
+	previous := findCondition(cluster, api.CertificateExpiringSoonCondition)
+	cluster.SetCondition(api.CertificateExpiringSoonCondition, status, reason, message)
+
+	if previous.Reason != reason || previous.Message != message {
+		if status == metav1.ConditionTrue {
+			log.Info("certificates are expiring", "reason", reason, "certificates", message)
+			e.recorder.Event(cluster.Unwrap(), corev1.EventTypeWarning, "CertificateExpiringSoon", message)
+		} else if previous.Status == metav1.ConditionTrue {
+			e.recorder.Event(cluster.Unwrap(), corev1.EventTypeNormal, "CertificatesValid", "No certificate expires within 30 days")
+		}
+	}
+
+	return nil
+}
+
+// PollInterval returns how often the certificates are read, which also picks
+// up the secrets renewed outside of the operator.
+func (e *certExpiry) PollInterval(*resource.Cluster) time.Duration {
+	return pollInterval
+}
+
+// certificates returns the validity of the node and client certificates, and
+// of the CA certificates of the node secret, along with the client CA of a
+// split-CA cluster. There are none before the node secret exists.
+func (e *certExpiry) certificates(ctx context.Context, cluster *resource.Cluster) ([]api.CertificateStatus, error) {
+	spec := cluster.Spec()
+	nodeSecret, clientSecret := cluster.NodeTLSSecretName(), cluster.ClientTLSSecretName()
+	if spec.NodeTLSSecret != "" {
+		nodeSecret = spec.NodeTLSSecret
+	}
+	if spec.ClientTLSSecret != "" {
+		clientSecret = spec.ClientTLSSecret
+	}
+
+	r := resource.NewKubeResource(ctx, e.client, cluster.Namespace(), kube.DefaultPersister)
+	var certs []api.CertificateStatus
+	add := func(name, secret string, data []byte, all bool) {
+		for _, cert := range parseCertificates(data) {
+			certs = append(certs, api.CertificateStatus{
+				Name:      name,
+				Secret:    secret,
+				Subject:   cert.Subject.CommonName,
+				NotBefore: metav1.NewTime(cert.NotBefore),
+				NotAfter:  metav1.NewTime(cert.NotAfter),
+			})
+			if !all {
+				return
+			}
+		}
+	}
+
+	node, err := resource.LoadTLSSecret(nodeSecret, r)
+	if kube.IgnoreNotFound(err) != nil {
+		return nil, errors.Wrapf(err, "failed to get the secret %s", nodeSecret)
+	}
+	if err != nil {
+		// the certificates are not generated yet
+		return nil, nil
+	}
+	add(metrics.NodeCertificate, nodeSecret, node.Key(), false)
+
+	rootClient, err := resource.LoadTLSSecret(clientSecret, r)
+	if kube.IgnoreNotFound(err) != nil {
+		return nil, errors.Wrapf(err, "failed to get the secret %s", clientSecret)
+	}
+	if err == nil {
+		add(metrics.ClientCertificate, clientSecret, rootClient.Key(), false)
+	}
+	// the nodes trust both CAs while the CA is rotated
+	add(metrics.CACertificate, nodeSecret, node.CA(), true)
+
+	// the nodes of a split-CA cluster trust the client CA too
+	nodeClientSecret := cluster.NodeClientTLSSecretName()
+	nodeClient, err := resource.LoadTLSSecret(nodeClientSecret, r)
+	if kube.IgnoreNotFound(err) != nil {
+		return nil, errors.Wrapf(err, "failed to get the secret %s", nodeClientSecret)
+	}
+	if err == nil {
+		add(metrics.CACertificate, nodeClientSecret, nodeClient.CA(), true)
+	}
+	return certs, nil
+}
+
+// firstExpiringCA returns the CA certificate that expires first, if any.
+func firstExpiringCA(certs []api.CertificateStatus) *api.CertificateStatus {
+	var first *api.CertificateStatus
+	for i := range certs {
+		c := &certs[i]
+		if c.Name == metrics.CACertificate && (first == nil || c.NotAfter.Before(&first.NotAfter)) {
+			first = c
+		}
+	}
+	return first
+}
+
+// parseCertificates parses the certificates of the PEM encoded data, skipping
+// the blocks that are not certificates.
+func parseCertificates(data []byte) []*x509.Certificate {
+	var certs []*x509.Certificate
+	for block, rest := pem.Decode(data); block != nil; block, rest = pem.Decode(rest) {
+		if block.Type != "CERTIFICATE" {
+			continue
+		}
+		if cert, err := x509.ParseCertificate(block.Bytes); err == nil {
+			certs = append(certs, cert)
+		}
+	}
+	return certs
+}
@@ -0,0 +1,182 @@
+/*
+Copyright 2021 The Cockroach Authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    https://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package actor
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	api "github.com/cockroachdb/cockroach-operator/apis/v1alpha1"
+	"github.com/cockroachdb/cockroach-operator/pkg/resource"
+	"github.com/cockroachdb/cockroach-operator/pkg/testutil"
+	"github.com/stretchr/testify/require"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/client-go/tools/record"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+)
+
+func TestCertExpiry(t *testing.T) {
+	scheme := testutil.InitScheme(t)
+	now := time.Date(2021, time.June, 1, 12, 0, 0, 0, time.UTC)
+	day := 24 * time.Hour
+	year := 365 * day
+	valid := selfSignedCert(t, now.Add(-day), now.Add(year))
+	ca := selfSignedCert(t, now.Add(-day), now.Add(10*year))
+	expiring := selfSignedCert(t, now.Add(-year), now.Add(10*day))
+	expired := selfSignedCert(t, now.Add(-year), now.Add(-day))
+
+	tests := []struct {
+		name       string
+		userSecret bool
+		previous   *api.ClusterCondition
+		node       []byte
+		client     []byte
+		ca         []byte
+		certs      []string
+		status     metav1.ConditionStatus
+		reason     string
+		message    string
+		events     []string
+	}{
+		{
+			name: "certificates not generated yet",
+		},
+		{
+			name:   "certificates are valid",
+			node:   valid,
+			client: valid,
+			ca:     ca,
+			certs:  []string{"node crdb-node", "client crdb-root", "ca crdb-node"},
+			status: metav1.ConditionFalse,
+			reason: "CertificatesValid",
+		},
+		{
+			name:    "client certificate expires soon",
+			node:    valid,
+			client:  expiring,
+			ca:      ca,
+			certs:   []string{"node crdb-node", "client crdb-root", "ca crdb-node"},
+			status:  metav1.ConditionTrue,
+			reason:  "CertificateExpiring",
+			message: "client certificate of secret crdb-root expires at 2021-06-11T12:00:00Z",
+			events:  []string{"Warning CertificateExpiringSoon client certificate"},
+		},
+		{
+			name:    "node certificate expired",
+			node:    expired,
+			client:  expiring,
+			ca:      ca,
+			certs:   []string{"node crdb-node", "client crdb-root", "ca crdb-node"},
+			status:  metav1.ConditionTrue,
+			reason:  "CertificateExpired",
+			message: "node certificate of secret crdb-node expired at 2021-05-31T12:00:00Z; client certificate of secret crdb-root expires at 2021-06-11T12:00:00Z",
+			events:  []string{"Warning CertificateExpiringSoon node certificate"},
+		},
+		{
+			name:    "old CA expires soon during a rotation",
+			node:    valid,
+			client:  valid,
+			ca:      append(append([]byte{}, expiring...), ca...),
+			certs:   []string{"node crdb-node", "client crdb-root", "ca crdb-node", "ca crdb-node"},
+			status:  metav1.ConditionTrue,
+			reason:  "CertificateExpiring",
+			message: "ca certificate of secret crdb-node expires at 2021-06-11T12:00:00Z",
+			events:  []string{"Warning CertificateExpiringSoon"},
+		},
+		{
+			name:     "no event while the certificates still expire soon",
+			previous: &api.ClusterCondition{Status: metav1.ConditionTrue, Reason: "CertificateExpiring", Message: "client certificate of secret crdb-root expires at 2021-06-11T12:00:00Z"},
+			node:     valid,
+			client:   expiring,
+			ca:       ca,
+			certs:    []string{"node crdb-node", "client crdb-root", "ca crdb-node"},
+			status:   metav1.ConditionTrue,
+			reason:   "CertificateExpiring",
+			message:  "client certificate of secret crdb-root expires at 2021-06-11T12:00:00Z",
+		},
+		{
+			name:     "certificates renewed",
+			previous: &api.ClusterCondition{Status: metav1.ConditionTrue, Reason: "CertificateExpiring", Message: "client certificate of secret crdb-root expires at 2021-06-11T12:00:00Z"},
+			node:     valid,
+			client:   valid,
+			ca:       ca,
+			certs:    []string{"node crdb-node", "client crdb-root", "ca crdb-node"},
+			status:   metav1.ConditionFalse,
+			reason:   "CertificatesValid",
+			events:   []string{"Normal CertificatesValid"},
+		},
+		{
+			name:       "certificates of the user",
+			userSecret: true,
+			node:       valid,
+			client:     valid,
+			ca:         ca,
+			certs:      []string{"node my-node", "client my-client", "ca my-node"},
+			status:     metav1.ConditionFalse,
+			reason:     "CertificatesValid",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cr := testutil.NewBuilder("crdb").Namespaced("default").WithNodeCount(3).WithTLS().Cr()
+			nodeSecret, clientSecret := "crdb-node", "crdb-root"
+			if tt.userSecret {
+				nodeSecret, clientSecret = "my-node", "my-client"
+				cr.Spec.NodeTLSSecret, cr.Spec.ClientTLSSecret = nodeSecret, clientSecret
+			}
+			if tt.previous != nil {
+				previous := *tt.previous
+				previous.Type = api.CertificateExpiringSoonCondition
+				cr.Status.Conditions = []api.ClusterCondition{previous}
+			}
+			objs := []runtime.Object{cr}
+			if tt.node != nil {
+				objs = append(objs,
+					&corev1.Secret{ObjectMeta: metav1.ObjectMeta{Namespace: "default", Name: nodeSecret}, Data: map[string][]byte{"ca.crt": tt.ca, "tls.crt": tt.node}},
+					&corev1.Secret{ObjectMeta: metav1.ObjectMeta{Namespace: "default", Name: clientSecret}, Data: map[string][]byte{"ca.crt": tt.ca, "tls.crt": tt.client}})
+			}
+			cluster := resource.NewCluster(cr)
+			recorder := record.NewFakeRecorder(10)
+
+			e := newCertExpiry(scheme, fake.NewFakeClientWithScheme(scheme, objs...), nil, recorder).(*certExpiry)
+			e.now = func() time.Time { return now }
+
+			err := e.Act(context.Background(), &cluster)
+			require.NoError(t, err)
+
+			var certs []string
+			for _, c := range cluster.Status().Certificates {
+				certs = append(certs, c.Name+" "+c.Secret)
+			}
+			require.Equal(t, tt.certs, certs)
+
+			condition := findCondition(&cluster, api.CertificateExpiringSoonCondition)
+			require.Equal(t, tt.status, condition.Status)
+			require.Equal(t, tt.reason, condition.Reason)
+			require.Equal(t, tt.message, condition.Message)
+
+			require.Len(t, recorder.Events, len(tt.events))
+			for _, ev := range tt.events {
+				require.Contains(t, <-recorder.Events, ev)
+			}
+		})
+	}
+}
@@ -0,0 +1,251 @@
+/*
+Copyright 2021 The Cockroach Authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    https://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package actor
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"strings"
+	"time"
+
+	api "github.com/cockroachdb/cockroach-operator/apis/v1alpha1"
+	"github.com/cockroachdb/cockroach-operator/pkg/features"
+	"github.com/cockroachdb/cockroach-operator/pkg/kube"
+	"github.com/cockroachdb/cockroach-operator/pkg/labels"
+	"github.com/cockroachdb/cockroach-operator/pkg/resource"
+	"github.com/cockroachdb/cockroach-operator/pkg/utilfeature"
+	"github.com/cockroachdb/errors"
+	"github.com/go-logr/logr"
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/client-go/rest"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+// certReloadInterval is how often the pods are checked while they reload the
+// renewed certificates.
+const certReloadInterval = 15 * time.Second
+
+// reloadCertsCmd copies the node certificate of the secret, whose SHA-256
+// fingerprint is the argument, and the other certificates into the directory
+// the node reads them from, then signals the node to reload them. It prints
+// "pending" while the kubelet has not updated the secret in the pod yet, and
+// "reloaded" once the node has the certificate.
+const reloadCertsCmd = `certs=` + resource.CertsDirMountPath + `
+src=` + resource.CertsPrestageMountPath + `..data
+fingerprint() { sha256sum "$1" | cut -d ' ' -f 1; }
+if [ "$(fingerprint $certs/node.crt)" = "%[1]s" ]; then echo reloaded; exit 0; fi
+if [ "$(fingerprint $src/node.crt)" != "%[1]s" ]; then echo pending; exit 0; fi
+for f in $src/*; do cat "$f" > "$certs/$(basename "$f")"; done
+kill -HUP 1
+echo reloaded`
+
+func newCertReload(scheme *runtime.Scheme, cl client.Client, config *rest.Config) Actor {
+	r := &certReload{
+		action: newAction("certReload", scheme, cl),
+	}
+	r.reloadCerts = func(ctx context.Context, pod *corev1.Pod, fingerprint string) (bool, error) {
+		cmd := []string{"/bin/sh", "-c", fmt.Sprintf(reloadCertsCmd, fingerprint)}
+		stdout, stderr, err := kube.ExecInPod(scheme, config, pod.Namespace, pod.Name, resource.DbContainerName, cmd)
+		if err != nil {
+			return false, errors.Wrapf(err, "failed to reload the certificates of pod %s: %s", pod.Name, stderr)
+		}
+		return strings.TrimSpace(stdout) == "reloaded", nil
+	}
+	return r
+}
+
+// certReload has the nodes load the node certificate of the secret once it
+// changes, whether the operator renewed it or the secret of the spec was
+// updated, by cert-manager for instance. With the SIGHUP reload the
+// certificates are copied into the running pods and the nodes are signaled to
+// reload them, otherwise the pods are restarted one at a time. The fingerprint
+// annotation records the node certificate the nodes loaded.
+type certReload struct {
+	action
+
+	// reloadCerts has the node of the pod reload the certificates, and
+	// returns whether it has the node certificate of the fingerprint
+	reloadCerts func(ctx context.Context, pod *corev1.Pod, fingerprint string) (bool, error)
+}
+
+// GetActionType returns api.CertificateReloadAction action used to set the cluster status errors
+func (r *certReload) GetActionType() api.ActionType {
+	return api.CertificateReloadAction
+}
+
+// Act finishes the running reload, or starts one once the node certificate of
+// the secret is not the one the nodes loaded.
+func (r *certReload) Act(ctx context.Context, cluster *resource.Cluster) error {
+	log := r.log.WithValues("CrdbCluster", cluster.ObjectKey())
+
+	if fingerprint := cluster.GetAnnotationCertReload(); fingerprint != "" {
+		return r.reload(ctx, cluster, log, fingerprint)
+	}
+
+	// the actor still finishes the reloads of the renewals and of the
+	// requested rotations with the feature gate disabled
+	if !utilfeature.DefaultMutableFeatureGate.Enabled(features.CertificateReload) {
+		return nil
+	}
+
+	fingerprint, err := nodeCertFingerprint(ctx, r.client, cluster)
+	if err != nil || fingerprint == "" {
+		// the certificates are not generated yet without a secret
+		return err
+	}
+	if fingerprint == cluster.GetAnnotationCertFingerprint() {
+		log.V(DEBUGLEVEL).Info("the nodes have the node certificate of the secret")
+		return nil
+	}
+
+	// the nodes loaded the certificate when they started, or load it with the
+	// running restart, which the rotation of the CA starts for its phases
+	restartType := cluster.GetAnnotationRestartType()
+	if cluster.GetAnnotationCertFingerprint() == "" || restartType != "" || cluster.Status().CARotation != nil {
+		log.V(DEBUGLEVEL).Info("recording the fingerprint of the node certificate", "fingerprint", fingerprint)
+		if err := setCertAnnotations(ctx, r.client, cluster, fingerprint, false); err != nil {
+			return err
+		}
+		CancelLoop(ctx)
+		return nil
+	}
+
+	sighup := cluster.Spec().CertificateRotation.ReloadOrDefault() == api.CertificateReloadSIGHUP
+	if !sighup && !utilfeature.DefaultMutableFeatureGate.Enabled(features.ClusterRestart) {
+		log.Info("the node certificate changed, the pods load it when they restart")
+		return nil
+	}
+
+	log.Info("the node certificate changed, having the nodes load it", "fingerprint", fingerprint, "sighup", sighup)
+	if err := setCertAnnotations(ctx, r.client, cluster, fingerprint, true); err != nil {
+		return err
+	}
+	CancelLoop(ctx)
+	return nil
+}
+
+// reload has the nodes of the running pods reload the renewed certificates,
+// and removes the reload annotation once they all have them. The pods that are
+// not running copy the certificates when they start.
+func (r *certReload) reload(ctx context.Context, cluster *resource.Cluster, log logr.Logger, fingerprint string) error {
+	selector := labels.Common(cluster.Unwrap()).Selector(cluster.Spec().AdditionalLabels)
+	pods := &corev1.PodList{}
+	if err := r.client.List(ctx, pods, client.InNamespace(cluster.Namespace()), client.MatchingLabels(selector)); err != nil {
+		return errors.Wrap(err, "failed to list pods")
+	}
+
+	pending := 0
+	for i := range pods.Items {
+		pod := &pods.Items[i]
+		if pod.Status.Phase != corev1.PodRunning || pod.DeletionTimestamp != nil {
+			continue
+		}
+		reloaded, err := r.reloadCerts(ctx, pod, fingerprint)
+		if err != nil {
+			return err
+		}
+		if !reloaded {
+			pending++
+		}
+	}
+
+	if pending > 0 {
+		log.Info("waiting for the pods to see the renewed certificates", "pods", pending)
+		return DeferredErr{
+			Err:          errors.Newf("waiting for %d pods to see the renewed certificates", pending),
+			RequeueAfter: certReloadInterval,
+		}
+	}
+
+	fetcher := resource.NewKubeFetcher(ctx, cluster.Namespace(), r.client)
+	cr := resource.ClusterPlaceholder(cluster.Name())
+	if err := fetcher.Fetch(cr); err != nil {
+		return errors.Wrap(err, "failed to fetch the CrdbCluster")
+	}
+
+	delete(cr.Annotations, resource.CrdbCertReloadAnnotation)
+	metav1.SetMetaDataAnnotation(&cr.ObjectMeta, resource.CrdbCertFingerprintAnnotation, fingerprint)
+	if err := r.client.Update(ctx, cr); err != nil {
+		return errors.Wrap(err, "failed to remove the certificate reload annotation")
+	}
+	log.Info("the nodes reloaded the renewed certificates")
+
+	CancelLoop(ctx)
+	return nil
+}
+
+// nodeCertFingerprint returns the SHA-256 fingerprint of the node certificate
+// of the secret the pods mount, or an empty string if the secret does not
+// exist.
+func nodeCertFingerprint(ctx context.Context, cl client.Client, cluster *resource.Cluster) (string, error) {
+	name := cluster.NodeTLSSecretName()
+	if cluster.Spec().NodeTLSSecret != "" {
+		name = cluster.Spec().NodeTLSSecret
+	}
+
+	secret, err := resource.LoadTLSSecret(name,
+		resource.NewKubeResource(ctx, cl, cluster.Namespace(), kube.DefaultPersister))
+	if apierrors.IsNotFound(err) {
+		return "", nil
+	}
+	if err != nil {
+		return "", errors.Wrapf(err, "failed to get the secret %s", name)
+	}
+	if len(secret.Key()) == 0 {
+		return "", nil
+	}
+
+	sum := sha256.Sum256(secret.Key())
+	return hex.EncodeToString(sum[:]), nil
+}
+
+// setCertAnnotations records the fingerprint of the node certificate and, when
+// load is set, has the nodes load it: the reload annotation starts the SIGHUP
+// reload, the restart type annotation a rolling restart otherwise. The
+// annotations are updated, so the caller must cancel the loop.
+func setCertAnnotations(ctx context.Context, cl client.Client, cluster *resource.Cluster, fingerprint string, load bool) error {
+	sighup := cluster.Spec().CertificateRotation.ReloadOrDefault() == api.CertificateReloadSIGHUP
+	if load && sighup && fingerprint == "" {
+		return errors.New("the node certificate to reload is missing")
+	}
+
+	cr := resource.ClusterPlaceholder(cluster.Name())
+	if err := resource.NewKubeFetcher(ctx, cluster.Namespace(), cl).Fetch(cr); err != nil {
+		return errors.Wrap(err, "failed to fetch the CrdbCluster")
+	}
+
+	if fingerprint != "" {
+		metav1.SetMetaDataAnnotation(&cr.ObjectMeta, resource.CrdbCertFingerprintAnnotation, fingerprint)
+	}
+	if load {
+		if sighup {
+			metav1.SetMetaDataAnnotation(&cr.ObjectMeta, resource.CrdbCertReloadAnnotation, fingerprint)
+		} else {
+			metav1.SetMetaDataAnnotation(&cr.ObjectMeta, resource.CrdbRestartTypeAnnotation, api.ClusterRestartType(api.RollingRestart).String())
+		}
+	}
+	if err := cl.Update(ctx, cr); err != nil {
+		return errors.Wrap(err, "failed to load the certificates")
+	}
+	cluster.SetResourceVersion(cr.ResourceVersion)
+	return nil
+}
@@ -0,0 +1,208 @@
+/*
+Copyright 2021 The Cockroach Authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    https://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package actor
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"testing"
+	"time"
+
+	api "github.com/cockroachdb/cockroach-operator/apis/v1alpha1"
+	"github.com/cockroachdb/cockroach-operator/pkg/labels"
+	"github.com/cockroachdb/cockroach-operator/pkg/resource"
+	"github.com/cockroachdb/cockroach-operator/pkg/testutil"
+	"github.com/cockroachdb/cockroach-operator/pkg/utilfeature"
+	"github.com/stretchr/testify/require"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+)
+
+func TestCertReloadOnChange(t *testing.T) {
+	scheme := testutil.InitScheme(t)
+	nodeCert := selfSignedCert(t, time.Now(), time.Now().Add(time.Hour))
+	sum := sha256.Sum256(nodeCert)
+	fingerprint := hex.EncodeToString(sum[:])
+
+	tests := []struct {
+		name          string
+		nodeTLSSecret string
+		noSecret      bool
+		rotation      *api.CertificateRotation
+		annotations   map[string]string
+		caRotation    *api.CARotationStatus
+		gateDisabled  bool
+		recorded      bool
+		restartType   string
+		reload        string
+	}{
+		{
+			name:     "records the certificate the nodes started with",
+			recorded: true,
+		},
+		{
+			name:        "does nothing while the nodes have the certificate",
+			annotations: map[string]string{resource.CrdbCertFingerprintAnnotation: fingerprint},
+		},
+		{
+			name:        "restarts the pods once the certificate changes",
+			annotations: map[string]string{resource.CrdbCertFingerprintAnnotation: "old"},
+			recorded:    true,
+			restartType: "Rolling",
+		},
+		{
+			name:        "has the nodes reload the changed certificate",
+			rotation:    &api.CertificateRotation{Reload: api.CertificateReloadSIGHUP},
+			annotations: map[string]string{resource.CrdbCertFingerprintAnnotation: "old"},
+			recorded:    true,
+			reload:      fingerprint,
+		},
+		{
+			name:          "reloads the certificate of the secret of the spec",
+			nodeTLSSecret: "node-certs",
+			rotation:      &api.CertificateRotation{Reload: api.CertificateReloadSIGHUP},
+			annotations:   map[string]string{resource.CrdbCertFingerprintAnnotation: "old"},
+			recorded:      true,
+			reload:        fingerprint,
+		},
+		{
+			name: "records the certificate the running restart loads",
+			annotations: map[string]string{
+				resource.CrdbCertFingerprintAnnotation: "old",
+				resource.CrdbRestartTypeAnnotation:     "FullCluster",
+			},
+			recorded:    true,
+			restartType: "FullCluster",
+		},
+		{
+			name:        "records the certificate of the rotation of the CA",
+			annotations: map[string]string{resource.CrdbCertFingerprintAnnotation: "old"},
+			caRotation:  &api.CARotationStatus{Phase: api.CARotationReissue, OperationID: "ca1"},
+			recorded:    true,
+		},
+		{
+			name:         "does nothing with the feature gate disabled",
+			annotations:  map[string]string{resource.CrdbCertFingerprintAnnotation: "old"},
+			gateDisabled: true,
+		},
+		{
+			name:     "does nothing before the certificates are generated",
+			noSecret: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			utilfeature.DefaultMutableFeatureGate.Set(fmt.Sprintf("CertificateReload=%t", !tt.gateDisabled))
+			defer utilfeature.DefaultMutableFeatureGate.Set("CertificateReload=false")
+
+			cr := testutil.NewBuilder("crdb").Namespaced("default").WithNodeCount(3).WithTLS().Cr()
+			cr.Spec.NodeTLSSecret = tt.nodeTLSSecret
+			cr.Spec.CertificateRotation = tt.rotation
+			cr.Annotations = tt.annotations
+			cr.Status.CARotation = tt.caRotation
+			cluster := resource.NewCluster(cr)
+
+			objs := []runtime.Object{cr}
+			if !tt.noSecret {
+				name := "crdb-node"
+				if tt.nodeTLSSecret != "" {
+					name = tt.nodeTLSSecret
+				}
+				objs = append(objs, &corev1.Secret{
+					ObjectMeta: metav1.ObjectMeta{Name: name, Namespace: "default"},
+					Data:       map[string][]byte{corev1.TLSCertKey: nodeCert},
+				})
+			}
+			cl := fake.NewFakeClientWithScheme(scheme, objs...)
+			r := newCertReload(scheme, cl, nil).(*certReload)
+
+			ctx, cancel := context.WithCancel(context.Background())
+			defer cancel()
+			require.NoError(t, r.Act(ContextWithCancelFn(ctx, cancel), &cluster))
+
+			actual := &api.CrdbCluster{}
+			require.NoError(t, cl.Get(ctx, client.ObjectKeyFromObject(cr), actual))
+			require.Equal(t, tt.restartType, actual.Annotations[resource.CrdbRestartTypeAnnotation])
+			require.Equal(t, tt.reload, actual.Annotations[resource.CrdbCertReloadAnnotation])
+			if tt.recorded {
+				require.Equal(t, fingerprint, actual.Annotations[resource.CrdbCertFingerprintAnnotation])
+				require.Error(t, ctx.Err(), "the loop should be cancelled")
+			} else {
+				require.Equal(t, tt.annotations[resource.CrdbCertFingerprintAnnotation], actual.Annotations[resource.CrdbCertFingerprintAnnotation])
+				require.NoError(t, ctx.Err())
+			}
+		})
+	}
+}
+
+func TestCertReload(t *testing.T) {
+	scheme := testutil.InitScheme(t)
+
+	for _, reloaded := range []bool{false, true} {
+		cr := testutil.NewBuilder("crdb").Namespaced("default").WithNodeCount(3).WithTLS().Cr()
+		cr.Spec.CertificateRotation = &api.CertificateRotation{Reload: api.CertificateReloadSIGHUP}
+		cr.Annotations = map[string]string{resource.CrdbCertReloadAnnotation: "fingerprint"}
+		cluster := resource.NewCluster(cr)
+
+		objs := []runtime.Object{cr}
+		for i, phase := range []corev1.PodPhase{corev1.PodRunning, corev1.PodRunning, corev1.PodPending} {
+			objs = append(objs, &corev1.Pod{
+				ObjectMeta: metav1.ObjectMeta{
+					Name:      fmt.Sprintf("crdb-%d", i),
+					Namespace: "default",
+					Labels:    labels.Common(cr).Selector(nil),
+				},
+				Status: corev1.PodStatus{Phase: phase},
+			})
+		}
+		cl := fake.NewFakeClientWithScheme(scheme, objs...)
+
+		var signaled []string
+		r := newCertReload(scheme, cl, nil).(*certReload)
+		r.reloadCerts = func(ctx context.Context, pod *corev1.Pod, fingerprint string) (bool, error) {
+			require.Equal(t, "fingerprint", fingerprint)
+			signaled = append(signaled, pod.Name)
+			return reloaded, nil
+		}
+
+		ctx, cancel := context.WithCancel(context.Background())
+		defer cancel()
+		err := r.Act(ContextWithCancelFn(ctx, cancel), &cluster)
+		// the pods that are not running copy the certificates when they start
+		require.ElementsMatch(t, []string{"crdb-0", "crdb-1"}, signaled)
+
+		actual := &api.CrdbCluster{}
+		require.NoError(t, cl.Get(ctx, client.ObjectKeyFromObject(cr), actual))
+		if reloaded {
+			require.NoError(t, err)
+			require.NotContains(t, actual.Annotations, resource.CrdbCertReloadAnnotation)
+			require.Equal(t, "fingerprint", actual.Annotations[resource.CrdbCertFingerprintAnnotation])
+			require.Error(t, ctx.Err(), "the loop should be cancelled")
+		} else {
+			deferred, ok := err.(DeferredErr)
+			require.True(t, ok, err)
+			require.Equal(t, certReloadInterval, deferred.RequeueAfter)
+			require.Equal(t, "fingerprint", actual.Annotations[resource.CrdbCertReloadAnnotation])
+		}
+	}
+}
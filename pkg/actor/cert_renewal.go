@@ -0,0 +1,169 @@
+/*
+Copyright 2021 The Cockroach Authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    https://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package actor
+
+import (
+	"context"
+	"crypto/x509"
+	"encoding/pem"
+	"time"
+
+	api "github.com/cockroachdb/cockroach-operator/apis/v1alpha1"
+	"github.com/cockroachdb/cockroach-operator/pkg/kube"
+	"github.com/cockroachdb/cockroach-operator/pkg/resource"
+	"github.com/cockroachdb/errors"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/client-go/rest"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+func newCertRenewal(scheme *runtime.Scheme, cl client.Client, config *rest.Config) Actor {
+	r := &certRenewal{
+		action: newAction("certRenewal", scheme, cl),
+		now:    time.Now,
+	}
+	r.issueCerts = func(ctx context.Context, cluster *resource.Cluster) error {
+		g := newGenerateCert(scheme, cl, config).(*generateCert)
+		g.rotate = true
+		return g.Act(ctx, cluster)
+	}
+	return r
+}
+
+// certRenewal renews the node and client certificates the operator issues
+// before they expire, whether signed by its CA, issued from the Vault PKI or
+// signed by the external CA of the spec. The nodes load the new certificates
+// with a rolling restart, started with the restart type annotation, or with
+// the SIGHUP reload of the certificate reload actor.
+type certRenewal struct {
+	action
+
+	// issueCerts issues new node and client certificates
+	issueCerts func(ctx context.Context, cluster *resource.Cluster) error
+	now        func() time.Time
+}
+
+// GetActionType returns api.CertificateRenewalAction action used to set the cluster status errors
+func (r *certRenewal) GetActionType() api.ActionType {
+	return api.CertificateRenewalAction
+}
+
+// Act renews the certificates once the node or the client certificate is due
+// for renewal, and comes back when it is otherwise.
+func (r *certRenewal) Act(ctx context.Context, cluster *resource.Cluster) error {
+	log := r.log.WithValues("CrdbCluster", cluster.ObjectKey())
+
+	if cluster.GetAnnotationCertReload() != "" {
+		log.V(DEBUGLEVEL).Info("waiting for the nodes to reload the certificates")
+		return DeferredErr{
+			Err:          errors.New("waiting for the nodes to reload the certificates"),
+			RequeueAfter: certReloadInterval,
+		}
+	}
+
+	node, err := r.loadCertificate(ctx, cluster, cluster.NodeTLSSecretName())
+	if err != nil || node == nil {
+		// the certificates are not generated yet without a secret
+		return errors.Wrap(err, "failed to read the node certificate")
+	}
+	rootClient, err := r.loadCertificate(ctx, cluster, cluster.ClientTLSSecretName())
+	if err != nil {
+		return errors.Wrap(err, "failed to read the client certificate")
+	}
+
+	rotation, vault := cluster.Spec().CertificateRotation, cluster.Spec().VaultPKI
+	renewAt := rotation.RenewalTime(node.NotBefore, node.NotAfter, vault)
+	if rootClient != nil {
+		if at := rotation.RenewalTime(rootClient.NotBefore, rootClient.NotAfter, vault); at.Before(renewAt) {
+			renewAt = at
+		}
+	}
+
+	now := r.now()
+	if now.Before(renewAt) {
+		wait := renewAt.Sub(now)
+		log.V(DEBUGLEVEL).Info("the certificates are not due for renewal", "renewAt", renewAt)
+		return DeferredErr{
+			Err:          errors.Newf("the certificates will be renewed in %s", wait.Round(time.Second)),
+			RequeueAfter: wait,
+		}
+	}
+
+	if restartType := cluster.GetAnnotationRestartType(); restartType != "" {
+		log.Info("waiting for the running restart to finish before renewing the certificates", "restartType", restartType)
+		return DeferredErr{
+			Err:          errors.New("waiting for the running restart to finish"),
+			RequeueAfter: time.Minute,
+		}
+	}
+
+	// the certificates renewed with the old CA would not be trusted once it is
+	// retired, the rotation of the CA issues new certificates anyway
+	if rotation := cluster.Status().CARotation; rotation != nil {
+		log.Info("waiting for the rotation of the CA to finish before renewing the certificates", "phase", rotation.Phase)
+		return DeferredErr{
+			Err:          errors.New("waiting for the rotation of the CA to finish"),
+			RequeueAfter: time.Minute,
+		}
+	}
+
+	log.Info("renewing the certificates", "nodeNotAfter", node.NotAfter)
+	if err := r.issueCerts(ctx, cluster); err != nil {
+		// the certificates signed by an external CA take several loops
+		if _, ok := err.(DeferredErr); ok {
+			return err
+		}
+		return errors.Wrap(err, "failed to renew the certificates")
+	}
+
+	fingerprint, err := nodeCertFingerprint(ctx, r.client, cluster)
+	if err != nil {
+		return err
+	}
+	// the annotations are updated, so the other actors must wait for the next loop
+	if err := setCertAnnotations(ctx, r.client, cluster, fingerprint, true); err != nil {
+		return errors.Wrap(err, "failed to reload the renewed certificates")
+	}
+
+	CancelLoop(ctx)
+	return nil
+}
+
+// loadCertificate returns the certificate of the TLS secret, or nil if the
+// secret does not exist.
+func (r *certRenewal) loadCertificate(ctx context.Context, cluster *resource.Cluster, name string) (*x509.Certificate, error) {
+	secret, err := resource.LoadTLSSecret(name,
+		resource.NewKubeResource(ctx, r.client, cluster.Namespace(), kube.DefaultPersister))
+	if apierrors.IsNotFound(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, errors.Wrapf(err, "failed to get the secret %s", name)
+	}
+
+	return parseCertificate(secret.Key())
+}
+
+// parseCertificate parses the first certificate of the PEM encoded data.
+func parseCertificate(data []byte) (*x509.Certificate, error) {
+	block, _ := pem.Decode(data)
+	if block == nil {
+		return nil, errors.New("failed to decode certificate")
+	}
+	return x509.ParseCertificate(block.Bytes)
+}
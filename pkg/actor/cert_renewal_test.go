@@ -0,0 +1,210 @@
+/*
+Copyright 2021 The Cockroach Authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    https://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package actor
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/hex"
+	"encoding/pem"
+	"math/big"
+	"testing"
+	"time"
+
+	api "github.com/cockroachdb/cockroach-operator/apis/v1alpha1"
+	"github.com/cockroachdb/cockroach-operator/pkg/resource"
+	"github.com/cockroachdb/cockroach-operator/pkg/testutil"
+	"github.com/stretchr/testify/require"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+)
+
+func TestCertRenewal(t *testing.T) {
+	scheme := testutil.InitScheme(t)
+	issued := time.Date(2021, time.June, 1, 0, 0, 0, 0, time.UTC)
+	// the certificates are valid for 30 days, and renewed 10 days before they expire
+	notAfter := issued.Add(30 * 24 * time.Hour)
+
+	tests := []struct {
+		name        string
+		now         time.Time
+		noSecret    bool
+		clientCert  []byte
+		rotation    *api.CertificateRotation
+		annotations map[string]string
+		caRotation  *api.CARotationStatus
+		renewed     bool
+		reloaded    bool
+		wait        time.Duration
+	}{
+		{
+			name: "waits for the renewal time",
+			now:  issued.Add(24 * time.Hour),
+			wait: 19 * 24 * time.Hour,
+		},
+		{
+			name:    "renews the certificates and restarts the pods",
+			now:     issued.Add(21 * 24 * time.Hour),
+			renewed: true,
+		},
+		{
+			name:    "renews expired certificates",
+			now:     notAfter.Add(time.Hour),
+			renewed: true,
+		},
+		{
+			name:        "waits for the running restart",
+			now:         issued.Add(21 * 24 * time.Hour),
+			annotations: map[string]string{resource.CrdbRestartTypeAnnotation: "FullCluster"},
+			wait:        time.Minute,
+		},
+		{
+			name:        "waits for the nodes to reload the certificates",
+			now:         issued.Add(21 * 24 * time.Hour),
+			annotations: map[string]string{resource.CrdbCertReloadAnnotation: "fingerprint"},
+			wait:        certReloadInterval,
+		},
+		{
+			name:       "waits for the rotation of the CA",
+			now:        issued.Add(21 * 24 * time.Hour),
+			caRotation: &api.CARotationStatus{Phase: api.CARotationReissue, OperationID: "ca1"},
+			wait:       time.Minute,
+		},
+		{
+			name:       "renews the certificates when the client certificate is due",
+			now:        issued.Add(24 * time.Hour),
+			clientCert: selfSignedCert(t, issued.Add(-40*24*time.Hour), issued.Add(2*24*time.Hour)),
+			renewed:    true,
+		},
+		{
+			name:     "waits for the renewBefore of the rotation",
+			now:      issued.Add(21 * 24 * time.Hour),
+			rotation: &api.CertificateRotation{RenewBefore: &metav1.Duration{Duration: 48 * time.Hour}},
+			wait:     7 * 24 * time.Hour,
+		},
+		{
+			name:     "renews the certificates and has the nodes reload them",
+			now:      issued.Add(21 * 24 * time.Hour),
+			rotation: &api.CertificateRotation{Reload: api.CertificateReloadSIGHUP},
+			renewed:  true,
+			reloaded: true,
+		},
+		{
+			name:     "does nothing before the certificates are generated",
+			now:      issued.Add(21 * 24 * time.Hour),
+			noSecret: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cr := testutil.NewBuilder("crdb").Namespaced("default").WithNodeCount(3).WithTLS().Cr()
+			cr.Spec.VaultPKI = &api.VaultPKI{
+				Address:  "https://vault:8200",
+				Role:     "crdb",
+				NodeRole: "crdb",
+			}
+			cr.Spec.CertificateRotation = tt.rotation
+			cr.Annotations = tt.annotations
+			cr.Status.CARotation = tt.caRotation
+			cluster := resource.NewCluster(cr)
+
+			nodeCert := selfSignedCert(t, issued, notAfter)
+			objs := []runtime.Object{cr}
+			if !tt.noSecret {
+				objs = append(objs, &corev1.Secret{
+					ObjectMeta: metav1.ObjectMeta{Name: "crdb-node", Namespace: "default"},
+					Data: map[string][]byte{
+						corev1.TLSCertKey: nodeCert,
+					},
+				})
+			}
+			if tt.clientCert != nil {
+				objs = append(objs, &corev1.Secret{
+					ObjectMeta: metav1.ObjectMeta{Name: "crdb-root", Namespace: "default"},
+					Data: map[string][]byte{
+						corev1.TLSCertKey: tt.clientCert,
+					},
+				})
+			}
+			cl := fake.NewFakeClientWithScheme(scheme, objs...)
+
+			issuedCerts := false
+			r := newCertRenewal(scheme, cl, nil).(*certRenewal)
+			r.now = func() time.Time { return tt.now }
+			r.issueCerts = func(ctx context.Context, cluster *resource.Cluster) error {
+				issuedCerts = true
+				return nil
+			}
+
+			ctx, cancel := context.WithCancel(context.Background())
+			defer cancel()
+			err := r.Act(ContextWithCancelFn(ctx, cancel), &cluster)
+			if tt.wait != 0 {
+				deferred, ok := err.(DeferredErr)
+				require.True(t, ok, err)
+				require.Equal(t, tt.wait, deferred.RequeueAfter)
+			} else {
+				require.NoError(t, err)
+			}
+			require.Equal(t, tt.renewed, issuedCerts)
+
+			actual := &api.CrdbCluster{}
+			require.NoError(t, cl.Get(ctx, client.ObjectKeyFromObject(cr), actual))
+			sum := sha256.Sum256(nodeCert)
+			if tt.renewed {
+				require.Equal(t, hex.EncodeToString(sum[:]), actual.Annotations[resource.CrdbCertFingerprintAnnotation])
+			}
+			if tt.reloaded {
+				require.Equal(t, hex.EncodeToString(sum[:]), actual.Annotations[resource.CrdbCertReloadAnnotation])
+				require.Empty(t, actual.Annotations[resource.CrdbRestartTypeAnnotation])
+				require.Error(t, ctx.Err(), "the loop should be cancelled")
+			} else if tt.renewed {
+				require.Equal(t, "Rolling", actual.Annotations[resource.CrdbRestartTypeAnnotation])
+				require.Error(t, ctx.Err(), "the loop should be cancelled")
+			} else {
+				require.Equal(t, tt.annotations[resource.CrdbRestartTypeAnnotation], actual.Annotations[resource.CrdbRestartTypeAnnotation])
+				require.NoError(t, ctx.Err())
+			}
+		})
+	}
+}
+
+// selfSignedCert returns a PEM encoded certificate valid between the times.
+func selfSignedCert(t *testing.T, notBefore, notAfter time.Time) []byte {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(1),
+		Subject:      pkix.Name{CommonName: "node"},
+		NotBefore:    notBefore,
+		NotAfter:     notAfter,
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	require.NoError(t, err)
+
+	return pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der})
+}
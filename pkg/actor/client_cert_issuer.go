@@ -0,0 +1,130 @@
+/*
+Copyright 2021 The Cockroach Authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    https://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package actor
+
+import (
+	"context"
+	"encoding/pem"
+
+	api "github.com/cockroachdb/cockroach-operator/apis/v1alpha1"
+	"github.com/cockroachdb/cockroach-operator/pkg/kube"
+	"github.com/cockroachdb/cockroach-operator/pkg/resource"
+	"github.com/cockroachdb/cockroach-operator/pkg/security"
+	"github.com/cockroachdb/errors"
+	"github.com/go-logr/logr"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+// ClientCertIssuer issues the client certificates of the SQL users of a
+// cluster, signed by its CA.
+type ClientCertIssuer struct {
+	client      client.Client
+	log         logr.Logger
+	newProvider func(tls *api.TLSConfig, caCert, caKey []byte) (security.CertificateProvider, func(), error)
+}
+
+// NewClientCertIssuer returns the issuer of the client certificates of the
+// clusters.
+func NewClientCertIssuer(cl client.Client, log logr.Logger) *ClientCertIssuer {
+	return &ClientCertIssuer{
+		client:      cl,
+		log:         log,
+		newProvider: newCAProvider,
+	}
+}
+
+// SigningCA returns the certificate of the CA that signs the client
+// certificates of the cluster, nil when they are issued by a Vault PKI. Once
+// the nodes trust the new CA of a CA rotation, the new CA signs them.
+func (i *ClientCertIssuer) SigningCA(ctx context.Context, cluster *resource.Cluster) ([]byte, error) {
+	cert, _, err := i.signingCA(ctx, cluster)
+	return cert, err
+}
+
+// Issue issues the client certificate of the user.
+func (i *ClientCertIssuer) Issue(ctx context.Context, cluster *resource.Cluster, user string) (*security.Certificate, error) {
+	if vault := cluster.Spec().VaultPKI; vault != nil {
+		provider, err := newVaultProvider(ctx, i.client, cluster, vault)
+		if err != nil {
+			return nil, errors.Wrap(err, "error configuring the Vault PKI")
+		}
+		return provider.ClientCertificate(ctx, security.SQLUsername{U: user})
+	}
+
+	caCert, caKey, err := i.signingCA(ctx, cluster)
+	if err != nil {
+		return nil, err
+	}
+	provider, cleanup, err := i.newProvider(cluster.Spec().TLS, caCert, caKey)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to configure the CA")
+	}
+	defer cleanup()
+
+	cert, err := provider.ClientCertificate(ctx, security.SQLUsername{U: user})
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to generate client certificate and key")
+	}
+	return cert, nil
+}
+
+// signingCA returns the certificate and the key of the CA that signs the
+// client certificates. The key of the operator CA is in the CA secret, and its
+// certificate is the first one of the node secret. The client CA of a split-CA
+// cluster has a secret of its own.
+func (i *ClientCertIssuer) signingCA(ctx context.Context, cluster *resource.Cluster) ([]byte, []byte, error) {
+	if cluster.Spec().VaultPKI != nil {
+		return nil, nil, nil
+	}
+
+	if cluster.Spec().SplitCA != nil {
+		ca, err := loadCASecret(ctx, i.client, cluster, cluster.ClientCASecretName())
+		if err != nil {
+			return nil, nil, errors.Wrap(err, "failed to get the client CA secret")
+		}
+		block, _ := pem.Decode(ca.CA())
+		if block == nil {
+			return nil, nil, errors.New("the client CA secret holds no certificate")
+		}
+		return pem.EncodeToMemory(block), ca.CAKey(), nil
+	}
+
+	if rotation := cluster.Status().CARotation; rotation != nil && rotation.Phase != api.CARotationTrustBundle {
+		next, err := newCARotation(i.client, i.log).loadNextCA(ctx, cluster)
+		if err != nil {
+			return nil, nil, err
+		}
+		if next != nil {
+			return next.CA(), next.CAKey(), nil
+		}
+	}
+
+	r := resource.NewKubeResource(ctx, i.client, cluster.Namespace(), kube.DefaultPersister)
+	ca, err := resource.LoadTLSSecret(cluster.CASecretName(), r)
+	if err != nil {
+		return nil, nil, errors.Wrap(err, "failed to get ca key secret")
+	}
+	node, err := resource.LoadTLSSecret(cluster.NodeTLSSecretName(), r)
+	if err != nil {
+		return nil, nil, errors.Wrap(err, "failed to get node TLS secret")
+	}
+	block, _ := pem.Decode(node.CA())
+	if block == nil || len(ca.CAKey()) == 0 {
+		return nil, nil, errors.New("the CA of the cluster is not generated yet")
+	}
+	return pem.EncodeToMemory(block), ca.CAKey(), nil
+}
@@ -0,0 +1,125 @@
+/*
+Copyright 2021 The Cockroach Authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    https://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package actor
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	api "github.com/cockroachdb/cockroach-operator/apis/v1alpha1"
+	"github.com/cockroachdb/cockroach-operator/pkg/resource"
+	"github.com/cockroachdb/cockroach-operator/pkg/security"
+	"github.com/cockroachdb/cockroach-operator/pkg/testutil"
+	"github.com/stretchr/testify/require"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+)
+
+func TestClientCertIssuer(t *testing.T) {
+	ctx := context.Background()
+	now := time.Now()
+	oldCA, newCA := selfSignedCert(t, now, now.Add(time.Hour)), selfSignedCert(t, now, now.Add(2*time.Hour))
+	clientCA := selfSignedCert(t, now, now.Add(3*time.Hour))
+
+	tests := []struct {
+		name     string
+		rotation *api.CARotationStatus
+		vault    bool
+		split    bool
+		next     bool
+		wantCA   []byte
+		wantKey  []byte
+	}{
+		{
+			name:    "operator CA",
+			wantCA:  oldCA,
+			wantKey: []byte("old-key"),
+		},
+		{
+			name:     "new CA not trusted yet",
+			rotation: &api.CARotationStatus{Phase: api.CARotationTrustBundle},
+			next:     true,
+			wantCA:   oldCA,
+			wantKey:  []byte("old-key"),
+		},
+		{
+			name:     "new CA trusted",
+			rotation: &api.CARotationStatus{Phase: api.CARotationReissue},
+			next:     true,
+			wantCA:   newCA,
+			wantKey:  []byte("new-key"),
+		},
+		{
+			name:     "new CA retired already",
+			rotation: &api.CARotationStatus{Phase: api.CARotationRetireOldCA},
+			wantCA:   oldCA,
+			wantKey:  []byte("old-key"),
+		},
+		{
+			name:    "client CA of split CAs",
+			split:   true,
+			wantCA:  clientCA,
+			wantKey: []byte("client-key"),
+		},
+		{
+			name:  "vault",
+			vault: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cr := testutil.NewBuilder("crdb").Namespaced("default").WithNodeCount(3).WithTLS().Cr()
+			cr.Status.CARotation = tt.rotation
+			if tt.vault {
+				cr.Spec.VaultPKI = &api.VaultPKI{Address: "https://vault:8200", Role: "crdb"}
+			}
+			objs := []runtime.Object{cr,
+				&corev1.Secret{ObjectMeta: metav1.ObjectMeta{Namespace: "default", Name: "crdb-ca"}, Data: map[string][]byte{"ca.key": []byte("old-key")}},
+				&corev1.Secret{ObjectMeta: metav1.ObjectMeta{Namespace: "default", Name: "crdb-node"}, Data: map[string][]byte{"ca.crt": appendCert(oldCA, newCA)}},
+			}
+			if tt.split {
+				cr.Spec.SplitCA = &api.SplitCA{}
+				objs = append(objs, &corev1.Secret{ObjectMeta: metav1.ObjectMeta{Namespace: "default", Name: "crdb-client-ca"}, Data: map[string][]byte{"ca.crt": clientCA, "ca.key": []byte("client-key")}})
+			}
+			if tt.next {
+				objs = append(objs, &corev1.Secret{ObjectMeta: metav1.ObjectMeta{Namespace: "default", Name: "crdb-ca-next"}, Data: map[string][]byte{"ca.crt": newCA, "ca.key": []byte("new-key")}})
+			}
+			cluster := resource.NewCluster(cr)
+
+			issuer := NewClientCertIssuer(fake.NewFakeClientWithScheme(testutil.InitScheme(t), objs...), Log)
+			ca, err := issuer.SigningCA(ctx, &cluster)
+			require.NoError(t, err)
+			require.Equal(t, tt.wantCA, ca)
+			if tt.vault {
+				return
+			}
+
+			issuer.newProvider = func(_ *api.TLSConfig, caCert, caKey []byte) (security.CertificateProvider, func(), error) {
+				require.Equal(t, tt.wantCA, caCert)
+				require.Equal(t, tt.wantKey, caKey)
+				return &testCAProvider{client: []byte("client-cert")}, func() {}, nil
+			}
+			cert, err := issuer.Issue(ctx, &cluster, "app")
+			require.NoError(t, err)
+			require.Equal(t, []byte("client-cert"), cert.Cert)
+		})
+	}
+}
@@ -0,0 +1,352 @@
+/*
+Copyright 2021 The Cockroach Authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    https://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package actor
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"strconv"
+	"time"
+
+	api "github.com/cockroachdb/cockroach-operator/apis/v1alpha1"
+	"github.com/cockroachdb/cockroach-operator/pkg/clustersql"
+	"github.com/cockroachdb/cockroach-operator/pkg/labels"
+	"github.com/cockroachdb/cockroach-operator/pkg/resource"
+	"github.com/cockroachdb/errors"
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/client-go/rest"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/controller/controllerutil"
+)
+
+// cloneInterval is how often the BACKUP and RESTORE jobs of a clone are
+// polled.
+const cloneInterval = 30 * time.Second
+
+func newClone(scheme *runtime.Scheme, cl client.Client, config *rest.Config) Actor {
+	c := &clone{
+		action: newAction("clone", scheme, cl),
+		config: config,
+		now:    time.Now,
+	}
+	c.db = func(ctx context.Context, cluster *resource.Cluster) (*sql.DB, error) {
+		return openDatabase(ctx, cl, config, cluster)
+	}
+	return c
+}
+
+// clone restores a backup of another CrdbCluster into a cluster created with
+// cloneFrom. It takes a new backup of the source cluster unless an existing
+// one is given, restores it once the cluster is initialized and publishes a
+// secret with the details to connect to the clone
+type clone struct {
+	action
+
+	config *rest.Config
+	// db opens a connection to the given cluster
+	db  func(ctx context.Context, cluster *resource.Cluster) (*sql.DB, error)
+	now func() time.Time
+}
+
+//GetActionType returns api.CloneAction used to set the cluster status errors
+func (c clone) GetActionType() api.ActionType {
+	return api.CloneAction
+}
+
+func (c clone) Act(ctx context.Context, cluster *resource.Cluster) error {
+	log := c.log.WithValues("CrdbCluster", cluster.ObjectKey())
+	from := cluster.Spec().CloneFrom
+	status := cluster.Status().Clone
+
+	if status == nil {
+		if !from.HasBackupURI() && cluster.Spec().BackupVolume == nil {
+			return c.fail(ctx, cluster, "cloneFrom.backupURI is required without a backup volume")
+		}
+		if from.Backup != "" {
+			log.Info("restoring an existing backup", "source", from.Cluster, "backup", from.Backup)
+			return c.startRestore(ctx, cluster, from.Backup)
+		}
+		return c.startBackup(ctx, cluster)
+	}
+
+	switch status.State {
+	case api.CloneBackingUp:
+		source, err := c.sourceCluster(ctx, cluster)
+		if source == nil {
+			return err
+		}
+
+		job, err := c.job(ctx, source, status.JobID)
+		if err != nil {
+			return err
+		}
+		if !job.Finished() {
+			return c.wait(job)
+		}
+		if job.Status != clustersql.JobSucceeded {
+			return c.fail(ctx, cluster, fmt.Sprintf("backup job %d of %s %s: %s", job.ID, from.Cluster, job.Status, job.Error))
+		}
+
+		uri, err := c.backupURI(ctx, cluster, source)
+		if err != nil {
+			return err
+		}
+		path, err := c.latestBackup(ctx, source, uri)
+		if err != nil {
+			return err
+		}
+		log.Info("backup of the source cluster succeeded, restoring it", "source", from.Cluster, "backup", path)
+		return c.startRestore(ctx, cluster, path)
+
+	case api.CloneRestoring:
+		job, err := c.job(ctx, cluster, status.JobID)
+		if err != nil {
+			return err
+		}
+		if !job.Finished() {
+			return c.wait(job)
+		}
+		if job.Status != clustersql.JobSucceeded {
+			return c.fail(ctx, cluster, fmt.Sprintf("restore job %d %s: %s", job.ID, job.Status, job.Error))
+		}
+
+		secret, err := c.publishConnection(ctx, cluster)
+		if err != nil {
+			return err
+		}
+
+		log.Info("clone succeeded", "source", from.Cluster, "backup", status.Backup, "secret", secret)
+		c.save(ctx, cluster, api.CloneStatus{State: api.CloneSucceeded, Backup: status.Backup, ConnectionSecret: secret})
+	}
+
+	return nil
+}
+
+// startBackup takes a backup of the source cluster into the collection.
+func (c clone) startBackup(ctx context.Context, cluster *resource.Cluster) error {
+	from := cluster.Spec().CloneFrom
+	source, err := c.sourceCluster(ctx, cluster)
+	if source == nil {
+		return err
+	}
+
+	// both clusters read and write the nodelocal collection on their backup
+	// volume, which must be the same
+	if !from.HasBackupURI() && (source.Spec().BackupVolume == nil || source.BackupVolumeClaimName() != cluster.BackupVolumeClaimName()) {
+		return c.fail(ctx, cluster, fmt.Sprintf("source cluster %s does not mount the backup volume %s", from.Cluster, cluster.BackupVolumeClaimName()))
+	}
+
+	uri, err := c.backupURI(ctx, cluster, source)
+	if err != nil {
+		return err
+	}
+	db, err := c.db(ctx, source)
+	if err != nil {
+		return c.retry(err)
+	}
+	defer db.Close()
+
+	id, err := clustersql.StartBackup(ctx, db, uri)
+	if err != nil {
+		return c.retry(err)
+	}
+
+	c.log.Info("backing up the source cluster", "CrdbCluster", cluster.ObjectKey(), "source", from.Cluster,
+		"collection", clustersql.RedactURI(uri), "job", id)
+	c.save(ctx, cluster, api.CloneStatus{State: api.CloneBackingUp, JobID: id})
+	return c.wait(clustersql.Job{ID: id})
+}
+
+// startRestore restores the backup at path in the collection into the cluster.
+func (c clone) startRestore(ctx context.Context, cluster *resource.Cluster, path string) error {
+	uri, err := c.backupURI(ctx, cluster, cluster)
+	if err != nil {
+		return err
+	}
+	db, err := c.db(ctx, cluster)
+	if err != nil {
+		return c.retry(err)
+	}
+	defer db.Close()
+
+	id, err := clustersql.StartRestore(ctx, db, uri, path)
+	if err != nil {
+		return c.retry(err)
+	}
+
+	c.save(ctx, cluster, api.CloneStatus{State: api.CloneRestoring, Backup: path, JobID: id})
+	return c.wait(clustersql.Job{ID: id})
+}
+
+// backupURI returns the URI of the backup collection the data of the clone goes
+// through, for the statements run by the runner cluster. It defaults to a
+// collection of the backup volume. The clone waits for the secret holding the
+// URI when it does not exist yet.
+func (c clone) backupURI(ctx context.Context, cluster, runner *resource.Cluster) (string, error) {
+	from := cluster.Spec().CloneFrom
+	uri := from.BackupURI
+	if ref := from.BackupURISecretRef; ref != nil {
+		value, ok, err := resource.SecretValue(ctx, c.client, cluster.Namespace(), ref)
+		if err != nil {
+			return "", c.retry(err)
+		}
+		if !ok {
+			return "", c.retry(errors.Newf("waiting for key %s of secret %s with the backup URI", ref.Key, ref.Name))
+		}
+		uri = value
+	}
+
+	if uri == "" {
+		return clustersql.NodelocalURI("clones/" + cluster.Name()), nil
+	}
+	if runner.HasCloudIdentity() {
+		return clustersql.ImplicitAuthURI(uri), nil
+	}
+	return uri, nil
+}
+
+// sourceCluster returns the cluster being cloned, which must be in the same
+// namespace. The clone fails when the source cluster does not exist, in which
+// case neither a cluster nor an error is returned.
+func (c clone) sourceCluster(ctx context.Context, cluster *resource.Cluster) (*resource.Cluster, error) {
+	name := cluster.Spec().CloneFrom.Cluster
+	cr := resource.ClusterPlaceholder(name)
+	if err := resource.NewKubeFetcher(ctx, cluster.Namespace(), c.client).Fetch(cr); err != nil {
+		if apierrors.IsNotFound(err) {
+			return nil, c.fail(ctx, cluster, fmt.Sprintf("source cluster %s not found", name))
+		}
+		return nil, c.retry(errors.Wrapf(err, "failed to fetch source cluster %s", name))
+	}
+
+	source := resource.NewCluster(cr)
+	return &source, nil
+}
+
+func (c clone) job(ctx context.Context, cluster *resource.Cluster, id int64) (clustersql.Job, error) {
+	db, err := c.db(ctx, cluster)
+	if err != nil {
+		return clustersql.Job{}, c.retry(err)
+	}
+	defer db.Close()
+
+	job, err := clustersql.GetJob(ctx, db, id)
+	if err != nil {
+		return clustersql.Job{}, c.retry(err)
+	}
+	return job, nil
+}
+
+func (c clone) latestBackup(ctx context.Context, cluster *resource.Cluster, uri string) (string, error) {
+	db, err := c.db(ctx, cluster)
+	if err != nil {
+		return "", c.retry(err)
+	}
+	defer db.Close()
+
+	path, err := clustersql.LatestBackup(ctx, db, uri)
+	if err != nil {
+		return "", c.retry(err)
+	}
+	return path, nil
+}
+
+// publishConnection creates the secret with the details to connect to the
+// clone and returns its name. With TLS, clients use the certificates of the
+// client TLS secret of the cluster.
+func (c clone) publishConnection(ctx context.Context, cluster *resource.Cluster) (string, error) {
+	spec := cluster.Spec()
+	host := fmt.Sprintf("%s.%s.%s", cluster.PublicServiceName(), cluster.Namespace(), cluster.Domain())
+	port := strconv.Itoa(int(*spec.SQLPort))
+	sslMode := "disable"
+	if spec.TLSEnabled {
+		sslMode = "verify-full"
+	}
+
+	secret := &corev1.Secret{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      cluster.Name() + "-connection",
+			Namespace: cluster.Namespace(),
+		},
+	}
+	_, err := controllerutil.CreateOrUpdate(ctx, c.client, secret, func() error {
+		secret.Labels = labels.Propagated(cluster.Unwrap(), api.PropagateSecret).AsMap()
+		secret.StringData = nil
+		secret.Data = map[string][]byte{
+			"host":     []byte(host),
+			"port":     []byte(port),
+			"user":     []byte("root"),
+			"database": []byte("defaultdb"),
+			"sslmode":  []byte(sslMode),
+			"uri":      []byte(fmt.Sprintf("postgresql://root@%s:%s/defaultdb?sslmode=%s", host, port, sslMode)),
+		}
+		if spec.TLSEnabled {
+			secret.Data["clientTLSSecret"] = []byte(cluster.ClientTLSSecretName())
+		}
+		return controllerutil.SetControllerReference(cluster.Unwrap(), secret, c.scheme)
+	})
+	if err != nil {
+		return "", c.retry(errors.Wrap(err, "failed to publish the connection secret"))
+	}
+	return secret.Name, nil
+}
+
+// fail records that the clone failed. It is not retried: the data of the
+// cluster must be checked and the cluster recreated.
+func (c clone) fail(ctx context.Context, cluster *resource.Cluster, message string) error {
+	c.log.Info("clone failed", "CrdbCluster", cluster.ObjectKey(), "message", message)
+
+	status := api.CloneStatus{State: api.CloneFailed, Message: message}
+	if previous := cluster.Status().Clone; previous != nil {
+		status.Backup = previous.Backup
+		status.JobID = previous.JobID
+	}
+	c.save(ctx, cluster, status)
+	return nil
+}
+
+// save records the progress of the clone and saves it right away, so that a
+// job that was started is not started again if the reconciliation fails
+// afterwards.
+func (c clone) save(ctx context.Context, cluster *resource.Cluster, status api.CloneStatus) {
+	log := c.log.WithValues("CrdbCluster", cluster.ObjectKey())
+	cluster.SetCloneStatus(status, metav1.NewTime(c.now()))
+
+	cr := resource.ClusterPlaceholder(cluster.Name())
+	if err := resource.NewKubeFetcher(ctx, cluster.Namespace(), c.client).Fetch(cr); err != nil {
+		log.Error(err, "failed to fetch the CrdbCluster to save the clone progress")
+		return
+	}
+
+	cr.Status.Clone = cluster.Status().Clone.DeepCopy()
+	if err := c.client.Status().Update(ctx, cr); err != nil {
+		log.Error(err, "failed to save the clone progress")
+		return
+	}
+	cluster.SetResourceVersion(cr.ResourceVersion)
+}
+
+func (c clone) wait(job clustersql.Job) error {
+	return DeferredErr{Err: errors.Newf("waiting for job %d of the clone", job.ID), RequeueAfter: cloneInterval}
+}
+
+func (c clone) retry(err error) error {
+	return DeferredErr{Err: err, RequeueAfter: cloneInterval}
+}
@@ -0,0 +1,269 @@
+/*
+Copyright 2021 The Cockroach Authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    https://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package actor
+
+import (
+	"context"
+	"database/sql"
+	"regexp"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	api "github.com/cockroachdb/cockroach-operator/apis/v1alpha1"
+	"github.com/cockroachdb/cockroach-operator/pkg/resource"
+	"github.com/cockroachdb/cockroach-operator/pkg/testutil"
+	"github.com/stretchr/testify/require"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/types"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+)
+
+const backupURI = "s3://backups/crdb?AUTH=implicit"
+
+// connection is a connection the clone actor is expected to open to a cluster
+// and the queries it is expected to run
+type connection struct {
+	cluster string
+	expect  func(mock sqlmock.Sqlmock)
+}
+
+func newTestClone(t *testing.T, objs ...runtime.Object) (*clone, *[]connection) {
+	scheme := testutil.InitScheme(t)
+	cl := fake.NewFakeClientWithScheme(scheme, objs...)
+
+	var connections []connection
+	c := newClone(scheme, cl, nil).(*clone)
+	c.now = func() time.Time { return time.Date(2021, time.June, 2, 20, 30, 0, 0, time.UTC) }
+	c.db = func(_ context.Context, cluster *resource.Cluster) (*sql.DB, error) {
+		require.NotEmpty(t, connections, "unexpected connection to %s", cluster.Name())
+		next := connections[0]
+		connections = connections[1:]
+		require.Equal(t, next.cluster, cluster.Name())
+
+		db, mock, err := sqlmock.New()
+		require.NoError(t, err)
+		next.expect(mock)
+		mock.ExpectClose()
+		t.Cleanup(func() { require.NoError(t, mock.ExpectationsWereMet()) })
+		return db, nil
+	}
+	return c, &connections
+}
+
+func expectJob(id int64, status, jobErr string) func(sqlmock.Sqlmock) {
+	return func(mock sqlmock.Sqlmock) {
+		mock.ExpectQuery(regexp.QuoteMeta("SELECT status, error FROM crdb_internal.jobs WHERE job_id = $1")).
+			WithArgs(id).
+			WillReturnRows(sqlmock.NewRows([]string{"status", "error"}).AddRow(status, jobErr))
+	}
+}
+
+func cloneCr(backup string) *api.CrdbCluster {
+	cr := testutil.NewBuilder("clone").Namespaced("default").WithUID("clone-uid").WithTLS().Cr()
+	cr.Spec.CloneFrom = &api.CloneSource{Cluster: "source", BackupURI: backupURI, Backup: backup}
+	return cr
+}
+
+func TestCloneBacksUpAndRestoresTheSourceCluster(t *testing.T) {
+	ctx := context.Background()
+	source := testutil.NewBuilder("source").Namespaced("default").WithTLS().Cr()
+	cr := cloneCr("")
+	c, connections := newTestClone(t, source, cr)
+	cluster := resource.NewCluster(cr)
+
+	saved := func() *api.CloneStatus {
+		actual := &api.CrdbCluster{}
+		require.NoError(t, c.client.Get(ctx, types.NamespacedName{Namespace: "default", Name: "clone"}, actual))
+		return actual.Status.Clone
+	}
+
+	// a backup of the source cluster is started
+	*connections = []connection{{"source", func(mock sqlmock.Sqlmock) {
+		mock.ExpectQuery(regexp.QuoteMeta("BACKUP INTO $1 AS OF SYSTEM TIME '-10s' WITH detached")).
+			WithArgs(backupURI).
+			WillReturnRows(sqlmock.NewRows([]string{"job_id"}).AddRow(42))
+	}}}
+	err := c.Act(ctx, &cluster)
+	require.Equal(t, cloneInterval, err.(DeferredErr).RequeueAfter)
+	require.Equal(t, api.CloneBackingUp, cluster.Status().Clone.State)
+	require.Equal(t, int64(42), saved().JobID)
+
+	// the backup is running
+	*connections = []connection{{"source", expectJob(42, "running", "")}}
+	err = c.Act(ctx, &cluster)
+	require.Equal(t, cloneInterval, err.(DeferredErr).RequeueAfter)
+	require.Equal(t, api.CloneBackingUp, cluster.Status().Clone.State)
+
+	// the backup succeeded and is restored into the clone
+	*connections = []connection{
+		{"source", expectJob(42, "succeeded", "")},
+		{"source", func(mock sqlmock.Sqlmock) {
+			mock.ExpectQuery(regexp.QuoteMeta("SHOW BACKUPS IN $1")).
+				WithArgs(backupURI).
+				WillReturnRows(sqlmock.NewRows([]string{"path"}).AddRow("2021/06/02-203000.00"))
+		}},
+		{"clone", func(mock sqlmock.Sqlmock) {
+			mock.ExpectQuery(regexp.QuoteMeta("RESTORE FROM $1 IN $2 WITH detached")).
+				WithArgs("2021/06/02-203000.00", backupURI).
+				WillReturnRows(sqlmock.NewRows([]string{"job_id"}).AddRow(43))
+		}},
+	}
+	err = c.Act(ctx, &cluster)
+	require.Equal(t, cloneInterval, err.(DeferredErr).RequeueAfter)
+	require.Equal(t, api.CloneRestoring, saved().State)
+	require.Equal(t, "2021/06/02-203000.00", saved().Backup)
+	require.Equal(t, int64(43), saved().JobID)
+
+	// the restore succeeded and the connection details are published
+	*connections = []connection{{"clone", expectJob(43, "succeeded", "")}}
+	require.NoError(t, c.Act(ctx, &cluster))
+	require.Equal(t, &api.CloneStatus{
+		State:              api.CloneSucceeded,
+		Backup:             "2021/06/02-203000.00",
+		ConnectionSecret:   "clone-connection",
+		LastTransitionTime: saved().LastTransitionTime,
+	}, saved())
+	require.True(t, cluster.Status().Clone.Done())
+	require.Empty(t, *connections)
+
+	secret := &corev1.Secret{}
+	require.NoError(t, c.client.Get(ctx, types.NamespacedName{Namespace: "default", Name: "clone-connection"}, secret))
+	require.Equal(t, "clone", secret.OwnerReferences[0].Name)
+	require.Equal(t, "clone-public.default.svc.cluster.local", string(secret.Data["host"]))
+	require.Equal(t, "26257", string(secret.Data["port"]))
+	require.Equal(t, "postgresql://root@clone-public.default.svc.cluster.local:26257/defaultdb?sslmode=verify-full", string(secret.Data["uri"]))
+	require.Equal(t, "clone-root", string(secret.Data["clientTLSSecret"]))
+}
+
+func TestCloneRestoresAnExistingBackup(t *testing.T) {
+	cr := cloneCr("2021/06/01-120000.00")
+	c, connections := newTestClone(t, cr)
+	cluster := resource.NewCluster(cr)
+
+	*connections = []connection{{"clone", func(mock sqlmock.Sqlmock) {
+		mock.ExpectQuery(regexp.QuoteMeta("RESTORE FROM $1 IN $2 WITH detached")).
+			WithArgs("2021/06/01-120000.00", backupURI).
+			WillReturnRows(sqlmock.NewRows([]string{"job_id"}).AddRow(43))
+	}}}
+	err := c.Act(context.Background(), &cluster)
+	require.Equal(t, cloneInterval, err.(DeferredErr).RequeueAfter)
+	require.Equal(t, api.CloneRestoring, cluster.Status().Clone.State)
+	require.Equal(t, "2021/06/01-120000.00", cluster.Status().Clone.Backup)
+}
+
+func TestCloneFailures(t *testing.T) {
+	t.Run("source cluster does not exist", func(t *testing.T) {
+		cr := cloneCr("")
+		c, _ := newTestClone(t, cr)
+		cluster := resource.NewCluster(cr)
+
+		require.NoError(t, c.Act(context.Background(), &cluster))
+		require.Equal(t, api.CloneFailed, cluster.Status().Clone.State)
+		require.Equal(t, "source cluster source not found", cluster.Status().Clone.Message)
+		require.True(t, cluster.Status().Clone.Done())
+	})
+
+	t.Run("restore job failed", func(t *testing.T) {
+		cr := cloneCr("")
+		cr.Status.Clone = &api.CloneStatus{State: api.CloneRestoring, Backup: "2021/06/02-203000.00", JobID: 43}
+		c, connections := newTestClone(t, cr)
+		cluster := resource.NewCluster(cr)
+
+		*connections = []connection{{"clone", expectJob(43, "failed", "access denied")}}
+		require.NoError(t, c.Act(context.Background(), &cluster))
+		require.Equal(t, api.CloneFailed, cluster.Status().Clone.State)
+		require.Equal(t, "restore job 43 failed: access denied", cluster.Status().Clone.Message)
+		require.Equal(t, "2021/06/02-203000.00", cluster.Status().Clone.Backup)
+	})
+}
+
+func TestCloneThroughTheBackupVolume(t *testing.T) {
+	volume := &api.BackupVolume{ClaimName: "nfs-backups"}
+	cr := cloneCr("")
+	cr.Spec.CloneFrom.BackupURI = ""
+	cr.Spec.BackupVolume = volume
+
+	t.Run("backs up the source cluster to the shared volume", func(t *testing.T) {
+		source := testutil.NewBuilder("source").Namespaced("default").Cr()
+		source.Spec.BackupVolume = volume
+		c, connections := newTestClone(t, source, cr)
+		cluster := resource.NewCluster(cr)
+
+		*connections = []connection{{"source", func(mock sqlmock.Sqlmock) {
+			mock.ExpectQuery(regexp.QuoteMeta("BACKUP INTO $1 AS OF SYSTEM TIME '-10s' WITH detached")).
+				WithArgs("nodelocal://1/clones/clone").
+				WillReturnRows(sqlmock.NewRows([]string{"job_id"}).AddRow(42))
+		}}}
+		err := c.Act(context.Background(), &cluster)
+		require.Equal(t, cloneInterval, err.(DeferredErr).RequeueAfter)
+		require.Equal(t, api.CloneBackingUp, cluster.Status().Clone.State)
+	})
+
+	t.Run("fails when the source cluster does not share the volume", func(t *testing.T) {
+		source := testutil.NewBuilder("source").Namespaced("default").Cr()
+		c, _ := newTestClone(t, source, cr)
+		cluster := resource.NewCluster(cr)
+
+		require.NoError(t, c.Act(context.Background(), &cluster))
+		require.Equal(t, api.CloneFailed, cluster.Status().Clone.State)
+		require.Equal(t, "source cluster source does not mount the backup volume nfs-backups", cluster.Status().Clone.Message)
+	})
+
+	t.Run("fails without a backup URI nor a backup volume", func(t *testing.T) {
+		cr := cloneCr("")
+		cr.Spec.CloneFrom.BackupURI = ""
+		c, _ := newTestClone(t, cr)
+		cluster := resource.NewCluster(cr)
+
+		require.NoError(t, c.Act(context.Background(), &cluster))
+		require.Equal(t, "cloneFrom.backupURI is required without a backup volume", cluster.Status().Clone.Message)
+	})
+}
+
+func TestCloneReadsTheBackupURIFromASecret(t *testing.T) {
+	ctx := context.Background()
+	cr := cloneCr("2021/06/01-120000.00")
+	cr.Spec.CloneFrom.BackupURI = ""
+	cr.Spec.CloneFrom.BackupURISecretRef = &corev1.SecretKeySelector{
+		LocalObjectReference: corev1.LocalObjectReference{Name: "backup-uri"},
+		Key:                  "uri",
+	}
+	c, connections := newTestClone(t, cr)
+	cluster := resource.NewCluster(cr)
+
+	// the clone waits for the secret, created later by another controller
+	err := c.Act(ctx, &cluster)
+	require.Contains(t, err.Error(), "waiting for key uri of secret backup-uri")
+	require.Nil(t, cluster.Status().Clone)
+
+	require.NoError(t, c.client.Create(ctx, &corev1.Secret{
+		ObjectMeta: metav1.ObjectMeta{Namespace: "default", Name: "backup-uri"},
+		Data:       map[string][]byte{"uri": []byte(backupURI)},
+	}))
+
+	*connections = []connection{{"clone", func(mock sqlmock.Sqlmock) {
+		mock.ExpectQuery(regexp.QuoteMeta("RESTORE FROM $1 IN $2 WITH detached")).
+			WithArgs("2021/06/01-120000.00", backupURI).
+			WillReturnRows(sqlmock.NewRows([]string{"job_id"}).AddRow(43))
+	}}}
+	err = c.Act(ctx, &cluster)
+	require.Equal(t, cloneInterval, err.(DeferredErr).RequeueAfter)
+	require.Equal(t, api.CloneRestoring, cluster.Status().Clone.State)
+}
@@ -46,6 +46,7 @@ func newClusterRestart(scheme *runtime.Scheme, cl client.Client, config *rest.Co
 	return &clusterRestart{
 		action: newAction("Crdb Cluster Restart", scheme, cl),
 		config: config,
+		now:    time.Now,
 	}
 }
 
@@ -55,6 +56,7 @@ type clusterRestart struct {
 	action
 
 	config *rest.Config
+	now    func() time.Time
 }
 
 //GetActionType returns api.ClusterRestartAction action used to set the cluster status errors
@@ -68,6 +70,7 @@ func (r *clusterRestart) Act(ctx context.Context, cluster *resource.Cluster) err
 	restartType := cluster.GetAnnotationRestartType()
 	if restartType == "" {
 		log.V(DEBUGLEVEL).Info("No restart cluster action")
+		cluster.ClearPendingOperation(r.GetActionType())
 		return nil
 	}
 	// Get the sts and compare the sts size to the size in the CR
@@ -84,38 +87,61 @@ func (r *clusterRestart) Act(ctx context.Context, cluster *resource.Cluster) err
 	if err := r.client.Get(ctx, key, statefulSet); err != nil {
 		return errors.Wrap(err, "failed to fetch statefulset")
 	}
-	// TODO statefulSetIsUpdating is not quite working as expected.
-	// I had to check status.  We should look at the update code in partition update to address this
-	if statefulSetIsUpdating(statefulSet) {
-		return NotReadyErr{Err: errors.New("restart statefulset is updating, waiting for the update to finish")}
-	}
 
-	err = statefulSetReplicasAvailable(&statefulSet.Status)
+	// the pods of the node pools restart with the other pods
+	pools, err := resource.NodePoolStatefulSets(ctx, r.client, cluster)
 	if err != nil {
-		log.Info("restart statefulset does not have all replicas up")
 		return err
 	}
+	statefulSets := append([]appsv1.StatefulSet{*statefulSet}, pools...)
+
+	for i := range statefulSets {
+		// TODO statefulSetIsUpdating is not quite working as expected.
+		// I had to check status.  We should look at the update code in partition update to address this
+		if statefulSetIsUpdating(&statefulSets[i]) {
+			return NotReadyErr{Err: errors.New("restart statefulset is updating, waiting for the update to finish")}
+		}
+
+		err = statefulSetReplicasAvailable(&statefulSets[i].Status)
+		if err != nil {
+			log.Info("restart statefulset does not have all replicas up", "StatefulSet", statefulSets[i].Name)
+			return err
+		}
+	}
+
+	start := r.now()
+	if err := reserveOperation(ctx, r.client, log, cluster, r.GetActionType(), start); err != nil {
+		return err
+	}
+	// a failed restart is retried with the budget it reserved
+	release := func(err error) error {
+		return releaseOperation(ctx, r.client, log, cluster, r.GetActionType(), start, err)
+	}
 	healthChecker := healthchecker.NewHealthChecker(cluster, clientset, r.scheme, r.config)
 	if strings.EqualFold(restartType, api.ClusterRestartType(api.RollingRestart).String()) {
 		log.V(DEBUGLEVEL).Info("initiating rolling restart action")
-		if err := r.rollingSts(ctx, statefulSet.DeepCopy(), clientset, r.log, healthChecker); err != nil {
-			return errors.Wrapf(err, "error restarting statefulset %s.%s", cluster.Namespace(), cluster.StatefulSetName())
+		maxUnavailable := cluster.Spec().UpdateStrategy.MaxUnavailableOrDefault()
+		// the statefulsets restart one after the other
+		for i := range statefulSets {
+			if err := r.rollingSts(ctx, statefulSets[i].DeepCopy(), clientset, r.log, healthChecker, maxUnavailable); err != nil {
+				return release(errors.Wrapf(err, "error restarting statefulset %s.%s", cluster.Namespace(), statefulSets[i].Name))
+			}
 		}
 		log.V(DEBUGLEVEL).Info("completed rolling cluster restart")
 	} else if strings.EqualFold(restartType, api.ClusterRestartType(api.FullCluster).String()) {
-		if err := r.fullClusterRestart(ctx, statefulSet, log, clientset); err != nil {
-			return errors.Wrapf(err, "error reseting statefulset %s.%s to 0 replicas", cluster.Namespace(), cluster.StatefulSetName())
+		if err := r.fullClusterRestart(ctx, statefulSets, log, clientset); err != nil {
+			return release(errors.Wrapf(err, "error reseting statefulset %s.%s to 0 replicas", cluster.Namespace(), cluster.StatefulSetName()))
 		}
 		//sleep 1 minute to make sure the crdb is up and running
 		log.V(DEBUGLEVEL).Info("sleeping", "duration", sleepDuration.String(), "label", "after full cluster restart")
 		if err := healthChecker.Probe(ctx, log, fmt.Sprintf("waiting after restart for cluster %s", cluster.Name()), 0); err != nil {
-			return err
+			return release(err)
 		}
 		log.V(DEBUGLEVEL).Info("completed full cluster restart")
 	} else {
 		err := ValidationError{Err: errors.New("invalid annotation value, please use Rolling or FullCluster values")}
 		log.V(DEBUGLEVEL).Info("invalid annotation for cluster restart")
-		return err
+		return release(err)
 	}
 	// we force the saving of the status on the cluster and cancel the loop
 	fetcher := resource.NewKubeFetcher(ctx, cluster.Namespace(), r.client)
@@ -144,19 +170,28 @@ func statefulSetReplicasAvailable(status *v1.StatefulSetStatus) error {
 	return nil
 }
 
-// rollingSts performs a rolling update on the cluster.
+// rollingSts performs a rolling update on the cluster, restarting
+// maxUnavailable pods at a time.
 func (r *clusterRestart) rollingSts(ctx context.Context, sts *appsv1.StatefulSet,
 	clientset kubernetes.Interface,
 	l logr.Logger,
-	healthChecker healthchecker.HealthChecker) error {
+	healthChecker healthchecker.HealthChecker,
+	maxUnavailable int32) error {
 	timeNow := metav1.Now()
+	if maxUnavailable < 1 {
+		maxUnavailable = 1
+	}
 	// When a StatefulSet's partition number is set to `n`, only StatefulSet pods
 	// numbered greater or equal to `n` will be updated. The rest will remain untouched.
 	// https://kubernetes.io/docs/concepts/workloads/controllers/statefulset/#partitions
-	for partition := *sts.Spec.Replicas - 1; partition >= 0; partition-- {
+	for top := *sts.Spec.Replicas - 1; top >= 0; top -= maxUnavailable {
 		stsName := sts.Name
 		stsNamespace := sts.Namespace
 		replicas := sts.Spec.Replicas
+		partition := top - maxUnavailable + 1
+		if partition < 0 {
+			partition = 0
+		}
 
 		refreshedSts, err := clientset.AppsV1().StatefulSets(stsNamespace).Get(ctx, stsName, metav1.GetOptions{})
 		if err != nil {
@@ -179,7 +214,7 @@ func (r *clusterRestart) rollingSts(ctx context.Context, sts *appsv1.StatefulSet
 		// Wait until verificationFunction verifies the update, passing in
 		// the current partition so the function knows which pod to check
 		// the status of.
-		l.V(DEBUGLEVEL).Info("waiting until partition done restarting", "partition number:", partition)
+		l.V(DEBUGLEVEL).Info("waiting until partition done restarting", "partition number:", partition, "pods", top-partition+1)
 
 		if err := scale.WaitUntilStatefulSetIsReadyToServe(ctx, clientset, stsNamespace, stsName, *replicas); err != nil {
 			return errors.Wrapf(err, "error rolling update stategy on pod %d", int(partition))
@@ -193,32 +228,44 @@ func (r *clusterRestart) rollingSts(ctx context.Context, sts *appsv1.StatefulSet
 	return nil
 }
 
-//fullClusterRestart will delete all the pods of the sts
-//to force the reload of the certificateon the POD
+//fullClusterRestart will delete all the pods of the sts, those of the node
+//pools included, to force the reload of the certificateon the POD
 //used on the CA cert rotation
-func (r *clusterRestart) fullClusterRestart(ctx context.Context, sts *appsv1.StatefulSet, l logr.Logger, clientset kubernetes.Interface) error {
+func (r *clusterRestart) fullClusterRestart(ctx context.Context, statefulSets []appsv1.StatefulSet, l logr.Logger, clientset kubernetes.Interface) error {
 
 	timeNow := metav1.Now()
-	stsName := sts.Name
-	stsNamespace := sts.Namespace
-	sts.Annotations[resource.CrdbRestartAnnotation] = timeNow.Format(time.RFC3339)
+	for i := range statefulSets {
+		sts := &statefulSets[i]
+		stsName := sts.Name
+		stsNamespace := sts.Namespace
+		sts.Annotations[resource.CrdbRestartAnnotation] = timeNow.Format(time.RFC3339)
 
-	_, err := clientset.AppsV1().StatefulSets(stsNamespace).Update(ctx, sts, metav1.UpdateOptions{})
-	if err != nil {
-		return handleStsError(err, l, stsName, stsNamespace)
+		_, err := clientset.AppsV1().StatefulSets(stsNamespace).Update(ctx, sts, metav1.UpdateOptions{})
+		if err != nil {
+			return handleStsError(err, l, stsName, stsNamespace)
+		}
 	}
+
 	dp := metav1.DeletePropagationForeground
-	err = clientset.CoreV1().Pods(sts.Namespace).DeleteCollection(ctx, metav1.DeleteOptions{
-		PropagationPolicy: &dp,
-	}, metav1.ListOptions{
-		LabelSelector: labels.Set(sts.Spec.Selector.MatchLabels).AsSelector().String(),
-	})
-	if err != nil {
-		l.Error(err, "failed to delete the pods for sts")
-		return err
+	for _, sts := range statefulSets {
+		err := clientset.CoreV1().Pods(sts.Namespace).DeleteCollection(ctx, metav1.DeleteOptions{
+			PropagationPolicy: &dp,
+		}, metav1.ListOptions{
+			LabelSelector: labels.Set(sts.Spec.Selector.MatchLabels).AsSelector().String(),
+		})
+		if err != nil {
+			l.Error(err, "failed to delete the pods for sts")
+			return err
+		}
 	}
+
 	//waiting for autohealing
-	return scale.WaitUntilStatefulSetIsReadyToServe(ctx, clientset, stsNamespace, stsName, *sts.Spec.Replicas)
+	for _, sts := range statefulSets {
+		if err := scale.WaitUntilStatefulSetIsReadyToServe(ctx, clientset, sts.Namespace, sts.Name, *sts.Spec.Replicas); err != nil {
+			return err
+		}
+	}
+	return nil
 }
 
 func handleStsError(err error, l logr.Logger, stsName string, ns string) error {
@@ -100,7 +100,7 @@ func TestFullClusterRestart(t *testing.T) {
 		Version:  "v1",
 		Resource: "statefulset",
 	}, &sts, sts.Namespace)
-	require.NoError(t, cr.fullClusterRestart(context.TODO(), &sts, Log, cltSet))
+	require.NoError(t, cr.fullClusterRestart(context.TODO(), []appsv1.StatefulSet{sts}, Log, cltSet))
 }
 
 func TestRollingClusterRestart(t *testing.T) {
@@ -120,6 +120,7 @@ func TestRollingClusterRestart(t *testing.T) {
 
 	addPodsToStatefulSet(stsReplicas, sts, cltSet)
 
+	var partitions []int32
 	cltSet.PrependReactor("*", "*", func(action clienttesting.Action) (handled bool, ret runtime.Object, err error) {
 		tracker := cltSet.Tracker()
 		gvr := action.GetResource()
@@ -130,6 +131,7 @@ func TestRollingClusterRestart(t *testing.T) {
 		case "update":
 			updateAction := action.(clienttesting.UpdateAction)
 			obj := updateAction.GetObject().(*appsv1.StatefulSet)
+			partitions = append(partitions, *obj.Spec.UpdateStrategy.RollingUpdate.Partition)
 			tracker.Update(gvr, obj, ns)
 			return true, obj, nil
 		case "get":
@@ -153,7 +155,12 @@ func TestRollingClusterRestart(t *testing.T) {
 		Resource: "statefulsets",
 	}, &sts, sts.Namespace)
 	hcTest := HealthCheckerTest{}
-	require.NoError(t, cr.rollingSts(context.TODO(), &sts, cltSet, Log, &hcTest))
+	require.NoError(t, cr.rollingSts(context.TODO(), &sts, cltSet, Log, &hcTest, 1))
+	require.Equal(t, []int32{2, 1, 0}, partitions)
+
+	partitions = nil
+	require.NoError(t, cr.rollingSts(context.TODO(), &sts, cltSet, Log, &hcTest, 2))
+	require.Equal(t, []int32{1, 0}, partitions)
 }
 
 func createStatefulSet(stsReplicas int32) appsv1.StatefulSet {
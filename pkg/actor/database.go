@@ -0,0 +1,95 @@
+/*
+Copyright 2021 The Cockroach Authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    https://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package actor
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+
+	api "github.com/cockroachdb/cockroach-operator/apis/v1alpha1"
+	"github.com/cockroachdb/cockroach-operator/pkg/database"
+	"github.com/cockroachdb/cockroach-operator/pkg/resource"
+	"github.com/cockroachdb/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/rest"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	logf "sigs.k8s.io/controller-runtime/pkg/log"
+)
+
+// auditLog is the log stream of the SQL statements the operator runs against
+// the clusters.
+var auditLog = logf.Log.WithName("sql-audit")
+
+// openDatabase opens a connection to the system database of the cluster, as
+// the root user when the cluster uses TLS.
+func openDatabase(ctx context.Context, cl client.Client, config *rest.Config, cluster *resource.Cluster) (*sql.DB, error) {
+	// test to see if we are running inside of Kubernetes
+	// If we are running inside of k8s we will not find this file.
+	runningInsideK8s := inK8s("/var/run/secrets/kubernetes.io/serviceaccount/token")
+
+	serviceName := cluster.PublicServiceName()
+	if !runningInsideK8s {
+		serviceName = fmt.Sprintf("%s-0.%s.%s", cluster.Name(), cluster.Name(), cluster.Namespace())
+	}
+
+	// The connection needs to use the discovery service name because of the
+	// hostnames in the SSL certificates
+	conn := &database.DBConnection{
+		Ctx:              ctx,
+		Client:           cl,
+		RestConfig:       config,
+		ServiceName:      serviceName,
+		Namespace:        cluster.Namespace(),
+		DatabaseName:     "system",
+		Port:             cluster.Spec().SQLPort,
+		RunningInsideK8s: runningInsideK8s,
+		Audit:            sqlAudit(cluster),
+	}
+	if cluster.Spec().TLSEnabled {
+		conn.UseSSL = true
+		conn.ClientCertificateSecretName = cluster.ClientTLSSecretName()
+		conn.RootCertificateSecretName = cluster.NodeTLSSecretName()
+	}
+
+	db, err := database.NewDbConnection(conn)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to create database connection")
+	}
+	return db, nil
+}
+
+// OpenDatabase opens a connection to the system database of the cluster, for
+// the controllers of the resources running SQL against a cluster.
+func OpenDatabase(ctx context.Context, cl client.Client, config *rest.Config, cluster *resource.Cluster) (*sql.DB, error) {
+	return openDatabase(ctx, cl, config, cluster)
+}
+
+// sqlAudit logs the statements run against the cluster and keeps the ones
+// changing it in the audit history of its status.
+func sqlAudit(cluster *resource.Cluster) *database.Audit {
+	return &database.Audit{
+		Logger: auditLog.WithValues("CrdbCluster", cluster.ObjectKey()),
+		Record: func(s database.Statement) {
+			statement := api.SQLStatement{Time: metav1.NewTime(s.Time), SQL: s.SQL, Args: s.Args}
+			if s.Err != nil {
+				statement.Error = s.Err.Error()
+			}
+			cluster.RecordStatement(statement)
+		},
+	}
+}
@@ -0,0 +1,130 @@
+/*
+Copyright 2021 The Cockroach Authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    https://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package actor
+
+import (
+	"context"
+	"database/sql"
+	"strings"
+	"time"
+
+	api "github.com/cockroachdb/cockroach-operator/apis/v1alpha1"
+	"github.com/cockroachdb/cockroach-operator/pkg/clustersql"
+	"github.com/cockroachdb/cockroach-operator/pkg/resource"
+	"github.com/cockroachdb/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/client-go/rest"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+func newDatabaseRegions(scheme *runtime.Scheme, cl client.Client, config *rest.Config) Actor {
+	r := &databaseRegions{
+		action: newAction("databaseRegions", scheme, cl),
+		config: config,
+	}
+	r.db = func(ctx context.Context, cluster *resource.Cluster) (*sql.DB, error) {
+		return openDatabase(ctx, cl, config, cluster)
+	}
+	return r
+}
+
+// databaseRegions applies the multi-region configuration of the databases
+// listed in the spec: their primary region, their other regions and their
+// survival goal. The configuration is checked again on every poll, so changes
+// made by hand are reverted
+type databaseRegions struct {
+	action
+
+	config *rest.Config
+	// db opens a connection to the cluster
+	db func(ctx context.Context, cluster *resource.Cluster) (*sql.DB, error)
+}
+
+//GetActionType returns api.DatabaseRegionsAction used to set the cluster status errors
+func (r databaseRegions) GetActionType() api.ActionType {
+	return api.DatabaseRegionsAction
+}
+
+func (r databaseRegions) Act(ctx context.Context, cluster *resource.Cluster) error {
+	log := r.log.WithValues("CrdbCluster", cluster.ObjectKey())
+	log.V(DEBUGLEVEL).Info("checking the regions of the databases")
+
+	notConfigured := func(reason string, err error) error {
+		log.Error(err, "failed to configure the regions of the databases", "reason", reason)
+		cluster.SetCondition(api.DatabaseRegionsCondition, metav1.ConditionFalse, reason, err.Error())
+		return nil
+	}
+
+	db, err := r.db(ctx, cluster)
+	if err != nil {
+		return notConfigured("SQLUnavailable", err)
+	}
+	defer db.Close()
+
+	available, err := clustersql.ClusterRegions(ctx, db)
+	if err != nil {
+		return notConfigured("SQLUnavailable", err)
+	}
+	inCluster := make(map[string]bool, len(available))
+	for _, region := range available {
+		inCluster[region] = true
+	}
+
+	for _, config := range cluster.Spec().DatabaseRegions {
+		desired := clustersql.DatabaseRegions{
+			PrimaryRegion: config.PrimaryRegion,
+			Regions:       config.Regions,
+			SurvivalGoal:  string(config.SurvivalGoal),
+		}
+
+		// CockroachDB only accepts the regions of the localities of the nodes
+		var missing []string
+		for _, region := range append([]string{config.PrimaryRegion}, config.Regions...) {
+			if !inCluster[region] {
+				missing = append(missing, region)
+			}
+		}
+		if len(missing) > 0 {
+			return notConfigured("RegionUnavailable", errors.Newf("regions %s of database %s are not in the localities of the nodes",
+				strings.Join(missing, ", "), config.Database))
+		}
+
+		current, err := clustersql.GetDatabaseRegions(ctx, db, config.Database)
+		if err != nil {
+			return notConfigured("ConfigurationFailed", err)
+		}
+
+		statements, err := clustersql.AlterDatabaseRegions(ctx, db, config.Database, current, desired)
+		if err != nil {
+			return notConfigured("ConfigurationFailed", err)
+		}
+		if len(statements) > 0 {
+			log.Info("configured the regions of the database", "database", config.Database, "statements", statements)
+		}
+	}
+
+	cluster.SetCondition(api.DatabaseRegionsCondition, metav1.ConditionTrue, "Configured", "")
+	return nil
+}
+
+// PollInterval returns how often the configuration of the databases is checked
+// and the changes made by hand are reverted, or the regions missing from the
+// localities of the nodes are looked for again.
+func (r databaseRegions) PollInterval(*resource.Cluster) time.Duration {
+	return pollInterval
+}
@@ -0,0 +1,108 @@
+/*
+Copyright 2021 The Cockroach Authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    https://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package actor
+
+import (
+	"context"
+	"database/sql"
+	"regexp"
+	"testing"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	api "github.com/cockroachdb/cockroach-operator/apis/v1alpha1"
+	"github.com/cockroachdb/cockroach-operator/pkg/resource"
+	"github.com/cockroachdb/cockroach-operator/pkg/testutil"
+	"github.com/stretchr/testify/require"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+)
+
+func newTestDatabaseRegions(t *testing.T, expect func(mock sqlmock.Sqlmock)) *databaseRegions {
+	scheme := testutil.InitScheme(t)
+	r := newDatabaseRegions(scheme, fake.NewFakeClientWithScheme(scheme), nil).(*databaseRegions)
+	r.db = func(context.Context, *resource.Cluster) (*sql.DB, error) {
+		db, mock, err := sqlmock.New()
+		require.NoError(t, err)
+		expect(mock)
+		mock.ExpectClose()
+		t.Cleanup(func() { require.NoError(t, mock.ExpectationsWereMet()) })
+		return db, nil
+	}
+	return r
+}
+
+func expectClusterRegions(regions ...string) func(sqlmock.Sqlmock) {
+	return func(mock sqlmock.Sqlmock) {
+		rows := sqlmock.NewRows([]string{"region"})
+		for _, region := range regions {
+			rows.AddRow(region)
+		}
+		mock.ExpectQuery(regexp.QuoteMeta("SELECT region FROM [SHOW REGIONS FROM CLUSTER]")).WillReturnRows(rows)
+	}
+}
+
+func TestDatabaseRegions(t *testing.T) {
+	databaseQuery := regexp.QuoteMeta("SELECT primary_region, array_to_string(regions, ','), survival_goal FROM [SHOW DATABASES] WHERE database_name = $1")
+	columns := []string{"primary_region", "regions", "survival_goal"}
+
+	cr := testutil.NewBuilder("cockroachdb").Namespaced("default").Cr()
+	cr.Spec.DatabaseRegions = []api.DatabaseRegionConfig{{
+		Database:      "movr",
+		PrimaryRegion: "us-east1",
+		Regions:       []string{"us-west1"},
+	}}
+	c := resource.NewCluster(cr)
+	cluster := &c
+
+	t.Run("alters the database", func(t *testing.T) {
+		r := newTestDatabaseRegions(t, func(mock sqlmock.Sqlmock) {
+			expectClusterRegions("us-east1", "us-west1")(mock)
+			mock.ExpectQuery(databaseQuery).WithArgs("movr").
+				WillReturnRows(sqlmock.NewRows(columns).AddRow(nil, "", nil))
+			mock.ExpectExec(regexp.QuoteMeta(`ALTER DATABASE "movr" SET PRIMARY REGION "us-east1"`)).
+				WillReturnResult(sqlmock.NewResult(0, 0))
+			mock.ExpectExec(regexp.QuoteMeta(`ALTER DATABASE "movr" ADD REGION "us-west1"`)).
+				WillReturnResult(sqlmock.NewResult(0, 0))
+		})
+
+		err := r.Act(context.Background(), cluster)
+		require.NoError(t, err)
+		require.True(t, cluster.True(api.DatabaseRegionsCondition))
+	})
+
+	t.Run("does nothing once configured", func(t *testing.T) {
+		r := newTestDatabaseRegions(t, func(mock sqlmock.Sqlmock) {
+			expectClusterRegions("us-east1", "us-west1")(mock)
+			mock.ExpectQuery(databaseQuery).WithArgs("movr").
+				WillReturnRows(sqlmock.NewRows(columns).AddRow("us-east1", "us-east1,us-west1", "zone"))
+		})
+
+		err := r.Act(context.Background(), cluster)
+		require.NoError(t, err)
+		require.True(t, cluster.True(api.DatabaseRegionsCondition))
+	})
+
+	t.Run("waits for the regions to be in the localities of the nodes", func(t *testing.T) {
+		r := newTestDatabaseRegions(t, expectClusterRegions("us-east1"))
+
+		err := r.Act(context.Background(), cluster)
+		require.NoError(t, err)
+
+		cond := findCondition(cluster, api.DatabaseRegionsCondition)
+		require.Equal(t, "RegionUnavailable", cond.Reason)
+		require.Equal(t, "regions us-west1 of database movr are not in the localities of the nodes", cond.Message)
+	})
+}
@@ -0,0 +1,54 @@
+/*
+Copyright 2021 The Cockroach Authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    https://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package actor
+
+import (
+	"errors"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/cockroachdb/cockroach-operator/pkg/database"
+	"github.com/cockroachdb/cockroach-operator/pkg/resource"
+	"github.com/cockroachdb/cockroach-operator/pkg/testutil"
+	"github.com/stretchr/testify/require"
+)
+
+func TestSQLAuditHistory(t *testing.T) {
+	cluster := testutil.NewBuilder("cockroachdb").Namespaced("default").Cluster()
+	audit := sqlAudit(cluster)
+
+	// the status keeps no statement by default
+	audit.Record(database.Statement{Time: time.Now(), SQL: "SET CLUSTER SETTING version = $1"})
+	require.Empty(t, cluster.Status().SQLAudit)
+
+	// the audit keeps recording to the same cluster once its spec changes
+	cr := cluster.Unwrap()
+	cr.Spec.SQLAuditHistory = 2
+	*cluster = resource.NewCluster(cr)
+	for i := 0; i < 3; i++ {
+		audit.Record(database.Statement{Time: time.Now(), SQL: fmt.Sprintf("ALTER DATABASE movr ADD REGION r%d", i)})
+	}
+	audit.Record(database.Statement{Time: time.Now(), SQL: "ALTER DATABASE movr ADD REGION r3", Err: errors.New("region r3 not found")})
+
+	history := cluster.Status().SQLAudit
+	require.Len(t, history, 2)
+	require.Equal(t, "ALTER DATABASE movr ADD REGION r2", history[0].SQL)
+	require.Empty(t, history[0].Error)
+	require.Equal(t, "ALTER DATABASE movr ADD REGION r3", history[1].SQL)
+	require.Equal(t, "region r3 not found", history[1].Error)
+}
@@ -0,0 +1,331 @@
+/*
+Copyright 2021 The Cockroach Authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    https://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package actor
+
+import (
+	"context"
+	"database/sql"
+	"strconv"
+	"strings"
+	"time"
+
+	api "github.com/cockroachdb/cockroach-operator/apis/v1alpha1"
+	"github.com/cockroachdb/cockroach-operator/pkg/clustersql"
+	"github.com/cockroachdb/cockroach-operator/pkg/kube"
+	"github.com/cockroachdb/cockroach-operator/pkg/resource"
+	"github.com/cockroachdb/errors"
+	appsv1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/client-go/rest"
+	"k8s.io/client-go/tools/record"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+func newDeadNodeReplacement(scheme *runtime.Scheme, cl client.Client, config *rest.Config, recorder record.EventRecorder) Actor {
+	r := &deadNodeReplacement{
+		action:   newAction("deadNodeReplacement", scheme, cl),
+		recorder: recorder,
+		now:      time.Now,
+	}
+	r.db = func(ctx context.Context, cluster *resource.Cluster) (*sql.DB, error) {
+		return openDatabase(ctx, cl, config, cluster)
+	}
+	r.decommission = func(ctx context.Context, cluster *resource.Cluster, podIdx uint, id int) error {
+		return startNodeDecommission(ctx, config, r.log, cluster, podIdx, id)
+	}
+	return r
+}
+
+// deadNodeReplacement decommissions the dead nodes of the cluster. A dead node
+// whose pod runs a new node, or was removed, is gone for good. The pod of a
+// node that stays dead, for instance because its volume was lost with a zone
+// or a local SSD, has its store replaced once the other nodes hold every
+// replica, so that the statefulset controller recreates it as a new node
+type deadNodeReplacement struct {
+	action
+
+	recorder record.EventRecorder
+	now      func() time.Time
+	// db opens a connection to the cluster
+	db func(ctx context.Context, cluster *resource.Cluster) (*sql.DB, error)
+	// decommission starts the decommission of the node with the ID from the
+	// pod of the ordinal
+	decommission func(ctx context.Context, cluster *resource.Cluster, podIdx uint, id int) error
+}
+
+// GetActionType returns api.DeadNodeReplacementAction used to set the cluster status errors
+func (r deadNodeReplacement) GetActionType() api.ActionType {
+	return api.DeadNodeReplacementAction
+}
+
+func (r deadNodeReplacement) Act(ctx context.Context, cluster *resource.Cluster) error {
+	log := r.log.WithValues("CrdbCluster", cluster.ObjectKey())
+	log.V(DEBUGLEVEL).Info("checking for dead nodes")
+
+	// the pods of a restarting cluster are not ready on purpose
+	if cluster.GetAnnotationRestartType() != "" {
+		log.V(DEBUGLEVEL).Info("cluster is restarting, not replacing dead nodes")
+		return nil
+	}
+
+	// the dead nodes of the node pools are replaced like the other nodes, and
+	// decommissioned from the pods of the statefulset of the nodes
+	statefulSets, err := resource.ClusterStatefulSets(ctx, r.client, cluster)
+	if err != nil {
+		return err
+	}
+	if len(statefulSets) == 0 || statefulSets[0].Name != cluster.StatefulSetName() {
+		return nil
+	}
+
+	pods, err := statefulSetPods(ctx, r.client, statefulSets)
+	if err != nil {
+		return err
+	}
+
+	db, err := r.db(ctx, cluster)
+	if err != nil {
+		log.Error(err, "failed to connect to the cluster to check for dead nodes")
+		return nil
+	}
+	defer db.Close()
+
+	nodes, err := clustersql.Nodes(ctx, db)
+	if err != nil {
+		log.Error(err, "failed to get the liveness of the nodes")
+		return nil
+	}
+	timeUntilStoreDead, err := clustersql.TimeUntilStoreDead(ctx, db)
+	if err != nil {
+		log.Error(err, "failed to get the liveness of the nodes")
+		return nil
+	}
+
+	now := r.now()
+	dead, _ := clustersql.UnavailableNodes(nodes, timeUntilStoreDead, now)
+	if len(dead) == 0 {
+		return nil
+	}
+
+	replicas := statefulSetReplicas(statefulSets, pods)
+	ready := 0
+	for i := range pods.Items {
+		if pods.Items[i].DeletionTimestamp == nil && kube.IsPodReady(&pods.Items[i]) {
+			ready++
+		}
+	}
+
+	policy := cluster.Spec().SelfHealing
+	// only one dead node is handled at a time, the others are checked again
+	// on the next poll
+	for _, id := range dead {
+		node, _ := nodeByID(nodes, id)
+		ss := podStatefulSet(statefulSets, node.PodName())
+		if ss == nil {
+			continue
+		}
+		ordinal, _ := podOrdinal(ss, node.PodName())
+		execIdx, ok := readyOrdinal(&statefulSets[0], pods, node.PodName())
+		if !ok {
+			log.Info("no pod is ready to decommission the dead node from", "NodeID", id)
+			return nil
+		}
+
+		if current, _ := nodeOfPod(nodes, node.PodName()); current.ID != node.ID || ss.Spec.Replicas != nil && ordinal >= int(*ss.Spec.Replicas) {
+			if err := r.decommission(ctx, cluster, execIdx, id); err != nil {
+				return errors.Wrapf(err, "failed to decommission dead node %d", id)
+			}
+			log.Info("decommissioned a dead node that was replaced", "NodeID", id, "pod", node.PodName())
+			r.recorder.Eventf(cluster.Unwrap(), corev1.EventTypeNormal, "DeadNodeDecommissioned",
+				"Node %d of pod %s is dead and no longer runs in its pod, decommissioned it", id, node.PodName())
+			return nil
+		}
+
+		deadFor := now.Sub(node.LivenessUpdatedAt)
+		if !node.LivenessUpdatedAt.IsZero() && deadFor < policy.ReplaceDeadNodesAfterOrDefault() {
+			continue
+		}
+
+		pod := podByName(pods, node.PodName())
+		if pod == nil || pod.DeletionTimestamp != nil {
+			continue
+		}
+		if ready < replicas-1 {
+			log.Info("not replacing a dead node while other pods are not ready", "NodeID", id, "ready", ready, "replicas", replicas)
+			return nil
+		}
+
+		reason, err := r.replicasElsewhere(ctx, db, nodes, node)
+		if err != nil {
+			log.Error(err, "failed to check the replication of the ranges")
+			return nil
+		}
+		if reason != "" {
+			log.Info("not replacing a dead node", "NodeID", id, "reason", reason)
+			return nil
+		}
+
+		if err := r.decommission(ctx, cluster, execIdx, id); err != nil {
+			return errors.Wrapf(err, "failed to decommission dead node %d", id)
+		}
+		if err := replaceStore(ctx, r.client, ss, pod); err != nil {
+			return err
+		}
+		log.Info("replaced a dead node", "NodeID", id, "pod", pod.Name)
+		r.recorder.Eventf(cluster.Unwrap(), corev1.EventTypeWarning, "DeadNodeReplaced",
+			"Node %d of pod %s was dead for %s, decommissioned it and replaced the store of the pod", id, pod.Name, deadFor.Round(time.Second))
+		return nil
+	}
+
+	return nil
+}
+
+// PollInterval returns how often the liveness of the nodes is checked for dead
+// nodes. A restarting cluster is not checked, its pods are down on purpose.
+func (r deadNodeReplacement) PollInterval(cluster *resource.Cluster) time.Duration {
+	if cluster.GetAnnotationRestartType() != "" {
+		return 0
+	}
+	return pollInterval
+}
+
+// replicasElsewhere returns why the store of the dead node cannot be replaced
+// yet: its replicas must all have been up-replicated to the other nodes, which
+// must be enough for the replication factor of every zone. It is empty when
+// the store can be replaced.
+func (r deadNodeReplacement) replicasElsewhere(ctx context.Context, db *sql.DB, nodes []clustersql.Node, dead clustersql.Node) (string, error) {
+	others := 0
+	for _, n := range nodes {
+		if n.ID != dead.ID && n.IsLive && !n.Decommissioning {
+			others++
+		}
+	}
+
+	zones, err := clustersql.ZoneConfigs(ctx, db)
+	if err != nil {
+		return "", err
+	}
+	if replicas, target := clustersql.MaxReplicationFactor(zones); others < int(replicas) {
+		return "fewer live nodes than the replicas of " + target, nil
+	}
+
+	replication, err := clustersql.ReplicationStatus(ctx, db)
+	if err != nil {
+		return "", err
+	}
+	if !replication.FullyReplicated() {
+		return "some ranges are not fully replicated", nil
+	}
+	return "", nil
+}
+
+// nodeByID returns the node with the ID.
+func nodeByID(nodes []clustersql.Node, id int) (clustersql.Node, bool) {
+	for _, n := range nodes {
+		if n.ID == id {
+			return n, true
+		}
+	}
+	return clustersql.Node{}, false
+}
+
+// podOrdinal returns the ordinal of the pod of the statefulset with the name,
+// false for the pods of other statefulsets.
+func podOrdinal(ss *appsv1.StatefulSet, podName string) (int, bool) {
+	prefix := ss.Name + "-"
+	if !strings.HasPrefix(podName, prefix) {
+		return 0, false
+	}
+	ordinal, err := strconv.Atoi(strings.TrimPrefix(podName, prefix))
+	return ordinal, err == nil && ordinal >= 0
+}
+
+// podStatefulSet returns the statefulset of the list the pod with the name
+// belongs to, nil if there is none.
+func podStatefulSet(statefulSets []appsv1.StatefulSet, podName string) *appsv1.StatefulSet {
+	for i := range statefulSets {
+		if _, ok := podOrdinal(&statefulSets[i], podName); ok {
+			return &statefulSets[i]
+		}
+	}
+	return nil
+}
+
+// statefulSetPods lists the pods of the statefulsets. The selector of the
+// statefulset of the nodes also matches the pods of the node pools, so the
+// pods are told apart by their names.
+func statefulSetPods(ctx context.Context, cl client.Client, statefulSets []appsv1.StatefulSet) (*corev1.PodList, error) {
+	pods := &corev1.PodList{}
+	for i := range statefulSets {
+		ss := &statefulSets[i]
+		list := &corev1.PodList{}
+		if err := cl.List(ctx, list, client.InNamespace(ss.Namespace), client.MatchingLabels(ss.Spec.Selector.MatchLabels)); err != nil {
+			return nil, errors.Wrap(err, "failed to list pods")
+		}
+		for _, pod := range list.Items {
+			if _, ok := podOrdinal(ss, pod.Name); ok {
+				pods.Items = append(pods.Items, pod)
+			}
+		}
+	}
+	return pods, nil
+}
+
+// statefulSetReplicas returns the number of pods the statefulsets should
+// have, the number of pods listed for those whose replicas are not set.
+func statefulSetReplicas(statefulSets []appsv1.StatefulSet, pods *corev1.PodList) int {
+	replicas := 0
+	for i := range statefulSets {
+		ss := &statefulSets[i]
+		if ss.Spec.Replicas != nil {
+			replicas += int(*ss.Spec.Replicas)
+			continue
+		}
+		for j := range pods.Items {
+			if _, ok := podOrdinal(ss, pods.Items[j].Name); ok {
+				replicas++
+			}
+		}
+	}
+	return replicas
+}
+
+// readyOrdinal returns the ordinal of a ready pod of the statefulset other than
+// the excluded one.
+func readyOrdinal(ss *appsv1.StatefulSet, pods *corev1.PodList, exclude string) (uint, bool) {
+	for i := range pods.Items {
+		pod := &pods.Items[i]
+		if pod.Name == exclude || pod.DeletionTimestamp != nil || !kube.IsPodReady(pod) {
+			continue
+		}
+		if ordinal, ok := podOrdinal(ss, pod.Name); ok {
+			return uint(ordinal), true
+		}
+	}
+	return 0, false
+}
+
+// podByName returns the pod of the list with the name, nil if there is none.
+func podByName(pods *corev1.PodList, name string) *corev1.Pod {
+	for i := range pods.Items {
+		if pods.Items[i].Name == name {
+			return &pods.Items[i]
+		}
+	}
+	return nil
+}
@@ -0,0 +1,194 @@
+/*
+Copyright 2021 The Cockroach Authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    https://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package actor
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"regexp"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	api "github.com/cockroachdb/cockroach-operator/apis/v1alpha1"
+	"github.com/cockroachdb/cockroach-operator/pkg/ptr"
+	"github.com/cockroachdb/cockroach-operator/pkg/resource"
+	"github.com/cockroachdb/cockroach-operator/pkg/testutil"
+	"github.com/stretchr/testify/require"
+	appsv1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/tools/record"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+)
+
+func TestDeadNodeReplacement(t *testing.T) {
+	scheme := testutil.InitScheme(t)
+	now := time.Date(2021, time.June, 2, 20, 30, 0, 0, time.UTC)
+	selector := map[string]string{"app": "crdb"}
+
+	ss := &appsv1.StatefulSet{
+		ObjectMeta: metav1.ObjectMeta{Name: "crdb", Namespace: "default"},
+		Spec: appsv1.StatefulSetSpec{
+			Replicas:             ptr.Int32(4),
+			Selector:             &metav1.LabelSelector{MatchLabels: selector},
+			VolumeClaimTemplates: []corev1.PersistentVolumeClaim{{ObjectMeta: metav1.ObjectMeta{Name: "datadir"}}},
+		},
+	}
+	pod := func(name string, ready bool) *corev1.Pod {
+		status := corev1.ConditionTrue
+		if !ready {
+			status = corev1.ConditionFalse
+		}
+		return &corev1.Pod{
+			ObjectMeta: metav1.ObjectMeta{Name: name, Namespace: "default", Labels: selector},
+			Status: corev1.PodStatus{
+				Conditions: []corev1.PodCondition{{Type: corev1.PodReady, Status: status}},
+			},
+		}
+	}
+	pvc := &corev1.PersistentVolumeClaim{ObjectMeta: metav1.ObjectMeta{Name: "datadir-crdb-2", Namespace: "default"}}
+
+	// node is a row of the nodes query, dead nodes were last live deadFor ago
+	type node struct {
+		id      int
+		pod     string
+		deadFor time.Duration
+	}
+	live := []node{{id: 1, pod: "crdb-0"}, {id: 2, pod: "crdb-1"}, {id: 4, pod: "crdb-3"}}
+
+	tests := []struct {
+		name           string
+		nodes          []node
+		podReady       bool
+		replicas       string
+		underReplicas  int
+		decommissioned []int
+		replaced       bool
+		event          string
+	}{
+		{
+			name:  "all nodes are live",
+			nodes: append(live, node{id: 3, pod: "crdb-2"}),
+		},
+		{
+			name:           "the pod of the dead node runs a new node",
+			nodes:          append(live, node{id: 3, pod: "crdb-2", deadFor: 10 * time.Minute}, node{id: 5, pod: "crdb-2"}),
+			podReady:       true,
+			decommissioned: []int{3},
+			event:          "DeadNodeDecommissioned",
+		},
+		{
+			name:  "the node is not dead for long enough",
+			nodes: append(live, node{id: 3, pod: "crdb-2", deadFor: 30 * time.Minute}),
+		},
+		{
+			name:          "some ranges are under-replicated",
+			nodes:         append(live, node{id: 3, pod: "crdb-2", deadFor: 2 * time.Hour}),
+			replicas:      "num_replicas: 3\n",
+			underReplicas: 4,
+		},
+		{
+			name:     "the replication factor needs the dead node",
+			nodes:    append(live, node{id: 3, pod: "crdb-2", deadFor: 2 * time.Hour}),
+			replicas: "num_replicas: 5\n",
+		},
+		{
+			name:           "the dead node is replaced",
+			nodes:          append(live, node{id: 3, pod: "crdb-2", deadFor: 2 * time.Hour}),
+			replicas:       "num_replicas: 3\n",
+			decommissioned: []int{3},
+			replaced:       true,
+			event:          "DeadNodeReplaced",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cr := testutil.NewBuilder("crdb").Namespaced("default").WithNodeCount(4).Cr()
+			cr.Spec.SelfHealing = &api.SelfHealing{ReplaceDeadNodes: true}
+			cl := fake.NewFakeClientWithScheme(scheme, ss.DeepCopy(), pvc.DeepCopy(),
+				pod("crdb-0", true), pod("crdb-1", true), pod("crdb-2", tt.podReady), pod("crdb-3", true))
+			recorder := record.NewFakeRecorder(10)
+
+			r := newDeadNodeReplacement(scheme, cl, nil, recorder).(*deadNodeReplacement)
+			r.now = func() time.Time { return now }
+			r.db = func(context.Context, *resource.Cluster) (*sql.DB, error) {
+				db, mock, err := sqlmock.New()
+				require.NoError(t, err)
+
+				rows := sqlmock.NewRows([]string{"node_id", "address", "is_live", "decommissioning", "updated_at"})
+				for _, n := range tt.nodes {
+					rows.AddRow(n.id, fmt.Sprintf("%s.crdb.default:26257", n.pod), n.deadFor == 0, false, now.Add(-n.deadFor))
+				}
+				mock.ExpectQuery(regexp.QuoteMeta("SELECT n.node_id, n.address")).WillReturnRows(rows)
+				mock.ExpectQuery("SHOW CLUSTER SETTING server.time_until_store_dead").
+					WillReturnRows(sqlmock.NewRows([]string{"value"}).AddRow("5m0s"))
+				if tt.replicas != "" {
+					mock.ExpectQuery("SELECT target, full_config_yaml FROM crdb_internal.zones").
+						WillReturnRows(sqlmock.NewRows([]string{"target", "full_config_yaml"}).AddRow("RANGE default", tt.replicas))
+				}
+				if tt.replicas == "num_replicas: 3\n" {
+					mock.ExpectQuery(regexp.QuoteMeta("SELECT COALESCE(sum((metrics->>'ranges.underreplicated')::INT8), 0)")).
+						WillReturnRows(sqlmock.NewRows([]string{"underreplicated", "unavailable"}).AddRow(tt.underReplicas, 0))
+				}
+				mock.ExpectClose()
+				t.Cleanup(func() { require.NoError(t, mock.ExpectationsWereMet()) })
+				return db, nil
+			}
+			var decommissioned []int
+			r.decommission = func(_ context.Context, _ *resource.Cluster, podIdx uint, id int) error {
+				require.Equal(t, uint(0), podIdx)
+				decommissioned = append(decommissioned, id)
+				return nil
+			}
+
+			cluster := resource.NewCluster(cr)
+			err := r.Act(context.Background(), &cluster)
+			require.NoError(t, err)
+			require.Equal(t, tt.decommissioned, decommissioned)
+
+			pvcErr := cl.Get(context.Background(), types.NamespacedName{Namespace: "default", Name: "datadir-crdb-2"}, &corev1.PersistentVolumeClaim{})
+			require.Equal(t, tt.replaced, pvcErr != nil)
+			podErr := cl.Get(context.Background(), types.NamespacedName{Namespace: "default", Name: "crdb-2"}, &corev1.Pod{})
+			require.Equal(t, tt.replaced, podErr != nil)
+
+			if tt.event == "" {
+				require.Empty(t, recorder.Events)
+			} else {
+				require.Contains(t, <-recorder.Events, tt.event)
+			}
+		})
+	}
+}
+
+func TestPodOrdinal(t *testing.T) {
+	ss := &appsv1.StatefulSet{ObjectMeta: metav1.ObjectMeta{Name: "crdb"}}
+
+	ordinal, ok := podOrdinal(ss, "crdb-2")
+	require.True(t, ok)
+	require.Equal(t, 2, ordinal)
+
+	// the pods of a node pool
+	_, ok = podOrdinal(ss, "crdb-large-2")
+	require.False(t, ok)
+
+	_, ok = podOrdinal(ss, "other-2")
+	require.False(t, ok)
+}
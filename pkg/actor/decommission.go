@@ -18,6 +18,7 @@ package actor
 
 import (
 	"context"
+	"database/sql"
 	"fmt"
 
 	api "github.com/cockroachdb/cockroach-operator/apis/v1alpha1"
@@ -29,7 +30,9 @@ import (
 	"github.com/cockroachdb/cockroach-operator/pkg/scale"
 	"github.com/cockroachdb/cockroach-operator/pkg/utilfeature"
 	"github.com/cockroachdb/errors"
+	"github.com/go-logr/logr"
 	appsv1 "k8s.io/api/apps/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/apimachinery/pkg/runtime"
 	kubetypes "k8s.io/apimachinery/pkg/types"
 	"k8s.io/client-go/kubernetes"
@@ -77,18 +80,108 @@ func (d decommission) Act(ctx context.Context, cluster *resource.Cluster) error
 		log.Error(err, "decommission failed to fetch statefulset")
 		return kube.IgnoreNotFound(err)
 	}
-	status := &ss.Status
+	targets := []decommissionTarget{{statefulSet: ss, nodes: cluster.Spec().Nodes}}
 
-	if status.CurrentReplicas == 0 || status.CurrentReplicas < status.Replicas {
-		log.V(WARNLEVEL).Info("decommission statefulset does not have all replicas up")
-		return NotReadyErr{Err: errors.New("decommission statefulset does not have all replicas up")}
+	if utilfeature.DefaultMutableFeatureGate.Enabled(features.NodePools) {
+		pools, err := resource.NodePoolStatefulSets(ctx, d.client, cluster)
+		if err != nil {
+			return err
+		}
+		for i := range pools {
+			pool := &pools[i]
+			// the statefulset of a pool without nodes has none to decommission
+			if pool.Spec.Replicas != nil && *pool.Spec.Replicas == 0 {
+				continue
+			}
+
+			// the nodes of a removed pool are all decommissioned
+			var nodes int32
+			if spec := cluster.Spec().NodePool(pool.Labels[resource.NodePoolLabel]); spec != nil {
+				nodes = spec.Nodes
+			}
+			targets = append(targets, decommissionTarget{statefulSet: pool, nodes: nodes})
+		}
 	}
 
-	nodes := uint(cluster.Spec().Nodes)
-	log.Info("replicas decommissioning", "status.CurrentReplicas", status.CurrentReplicas, "expected", cluster.Spec().Nodes)
-	if status.CurrentReplicas <= cluster.Spec().Nodes {
-		return nil
+	for _, target := range targets {
+		status := &target.statefulSet.Status
+		if status.CurrentReplicas == 0 || status.CurrentReplicas < status.Replicas {
+			log.V(WARNLEVEL).Info("decommission statefulset does not have all replicas up", "StatefulSet", target.statefulSet.Name)
+			return NotReadyErr{Err: errors.New("decommission statefulset does not have all replicas up")}
+		}
+	}
+
+	// the nodes left once every statefulset is scaled down
+	var remaining int32
+	for _, target := range targets {
+		if current := target.statefulSet.Status.CurrentReplicas; current < target.nodes {
+			remaining += current
+		} else {
+			remaining += target.nodes
+		}
+	}
+
+	// the statefulsets are scaled down one at a time
+	for _, target := range targets {
+		status := &target.statefulSet.Status
+		log.Info("replicas decommissioning", "StatefulSet", target.statefulSet.Name,
+			"status.CurrentReplicas", status.CurrentReplicas, "expected", target.nodes)
+		if status.CurrentReplicas > target.nodes {
+			return d.scaleDown(ctx, cluster, target.statefulSet, uint(target.nodes), remaining)
+		}
+	}
+
+	// a scale down that was blocked is no longer wanted
+	if findCondition(cluster, api.ScaleDownSafeCondition).Status == metav1.ConditionFalse {
+		cluster.SetCondition(api.ScaleDownSafeCondition, metav1.ConditionTrue, "NoScaleDown", "")
+	}
+
+	return nil
+}
+
+// checkScaleDownSafe sets the ScaleDownSafe condition, and returns a
+// NotReadyErr while the remaining nodes are fewer than the largest replication
+// factor of the zones or while some ranges miss replicas. Decommissioning a
+// node then would leave its replicas nowhere to go and stall. The error stops
+// the loop, so that the deploy action does not scale the statefulset down
+// either.
+func (d decommission) checkScaleDownSafe(ctx context.Context, cluster *resource.Cluster, db *sql.DB, remaining int32) error {
+	zones, err := clustersql.ZoneConfigs(ctx, db)
+	if err != nil {
+		return errors.Wrap(err, "failed to get the zone configurations")
+	}
+	if replicas, target := clustersql.MaxReplicationFactor(zones); remaining < int32(replicas) {
+		message := fmt.Sprintf("%d nodes would remain, fewer than the %d replicas of %s", remaining, replicas, target)
+		cluster.SetCondition(api.ScaleDownSafeCondition, metav1.ConditionFalse, "ReplicationFactorTooHigh", message)
+		return NotReadyErr{Err: errors.Newf("scale down blocked: %s", message)}
+	}
+
+	replication, err := clustersql.ReplicationStatus(ctx, db)
+	if err != nil {
+		return err
 	}
+	if !replication.FullyReplicated() {
+		message := fmt.Sprintf("%d ranges are under-replicated, %d are unavailable", replication.UnderReplicated, replication.Unavailable)
+		cluster.SetCondition(api.ScaleDownSafeCondition, metav1.ConditionFalse, "RangesUnderReplicated", message)
+		return NotReadyErr{Err: errors.Newf("scale down blocked: %s", message)}
+	}
+
+	cluster.SetCondition(api.ScaleDownSafeCondition, metav1.ConditionTrue, "ReplicasFit", "")
+	return nil
+}
+
+// decommissionTarget is a statefulset of the cluster and the number of nodes
+// it is scaled down to
+type decommissionTarget struct {
+	statefulSet *appsv1.StatefulSet
+	nodes       int32
+}
+
+// scaleDown decommissions the nodes of the statefulset beyond the given
+// number of nodes, one at a time. The remaining nodes are those of all the
+// statefulsets of the cluster once they are scaled down.
+func (d decommission) scaleDown(ctx context.Context, cluster *resource.Cluster, ss *appsv1.StatefulSet, nodes uint, remaining int32) error {
+	log := d.log.WithValues("CrdbCluster", cluster.ObjectKey(), "StatefulSet", ss.Name)
 	clientset, err := kubernetes.NewForConfig(d.config)
 	if err != nil {
 		return errors.Wrapf(err, "decommission failed to create kubernetes clientset")
@@ -116,6 +209,7 @@ func (d decommission) Act(ctx context.Context, cluster *resource.Cluster) error
 		DatabaseName:     "system", // TODO we need to use variable instead of string
 		Port:             cluster.Spec().SQLPort,
 		RunningInsideK8s: runningInsideK8s,
+		Audit:            sqlAudit(cluster),
 	}
 
 	// see https://github.com/cockroachdb/cockroach-operator/issues/204 for above TODO
@@ -131,12 +225,19 @@ func (d decommission) Act(ctx context.Context, cluster *resource.Cluster) error
 	log.V(DEBUGLEVEL).Info("opened db connection")
 	defer db.Close()
 
+	if utilfeature.DefaultMutableFeatureGate.Enabled(features.ScaleDownSafety) {
+		if err := d.checkScaleDownSafe(ctx, cluster, db, remaining); err != nil {
+			return err
+		}
+	}
+
 	timeout, err := clustersql.RangeMoveDuration(ctx, db)
 	if err != nil {
 		return errors.Wrap(err, "failed to get range move duration")
 	}
 
-	drainer := scale.NewCockroachNodeDrainer(d.log, cluster.Namespace(), ss.Name, d.config, clientset, cluster.Spec().TLSEnabled, 3*timeout)
+	drainer := scale.NewCockroachNodeDrainer(d.log, cluster.Namespace(), ss.Name, cluster.DiscoveryServiceName(), d.config, clientset,
+		cluster.Spec().TLSEnabled, 3*timeout)
 	pvcPruner := scale.PersistentVolumePruner{
 		Namespace:   cluster.Namespace(),
 		StatefulSet: ss.Name,
@@ -154,10 +255,13 @@ func (d decommission) Act(ctx context.Context, cluster *resource.Cluster) error
 		Drainer:   drainer,
 		PVCPruner: &pvcPruner,
 	}
-	if err := scaler.EnsureScale(ctx, nodes, *cluster.Spec().GRPCPort, utilfeature.DefaultMutableFeatureGate.Enabled(features.AutoPrunePVC)); err != nil {
-		/// now check if the decommissionStaleErr and update status
+	if err := scaler.EnsureScale(ctx, nodes, *cluster.Spec().GRPCPort, prunesPVCs(cluster, ss)); err != nil {
 		log.Error(err, "decommission failed")
 		cluster.SetFalse(api.DecommissionCondition)
+		// the loop is not cancelled, so that the retry is recorded in the status
+		if errors.Is(err, scale.ErrDecommissioningStalled) {
+			return FailureErr{Reason: api.DecommissionStalledReason, Err: err}
+		}
 		CancelLoop(ctx)
 		return err
 	}
@@ -167,3 +271,39 @@ func (d decommission) Act(ctx context.Context, cluster *resource.Cluster) error
 	CancelLoop(ctx)
 	return nil
 }
+
+// prunesPVCs returns whether the PVCs of the nodes decommissioned from the
+// statefulset are deleted. The reclaim policy of its data store wins over the
+// AutoPrunePVC feature gate.
+func prunesPVCs(cluster *resource.Cluster, ss *appsv1.StatefulSet) bool {
+	switch cluster.Spec().PVCReclaimPolicy(ss.Labels[resource.NodePoolLabel]) {
+	case api.PVCReclaimDelete:
+		return true
+	case api.PVCReclaimRetain:
+		return false
+	default:
+		return utilfeature.DefaultMutableFeatureGate.Enabled(features.AutoPrunePVC)
+	}
+}
+
+// startNodeDecommission starts the decommission of the node with the ID from
+// the pod of the ordinal of the statefulset, without waiting for its replicas
+// to move to the other nodes.
+func startNodeDecommission(ctx context.Context, config *rest.Config, log logr.Logger, cluster *resource.Cluster, podIdx uint, id int) error {
+	clientset, err := kubernetes.NewForConfig(config)
+	if err != nil {
+		return errors.Wrap(err, "failed to create kubernetes clientset")
+	}
+	drainer := &scale.CockroachNodeDrainer{
+		Secure:      cluster.Spec().TLSEnabled,
+		Logger:      log,
+		ServiceName: cluster.DiscoveryServiceName(),
+		Executor: &scale.CockroachExecutor{
+			Namespace:   cluster.Namespace(),
+			StatefulSet: cluster.StatefulSetName(),
+			Config:      config,
+			ClientSet:   clientset,
+		},
+	}
+	return drainer.StartDecommission(ctx, podIdx, uint(id), *cluster.Spec().GRPCPort)
+}
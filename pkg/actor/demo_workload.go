@@ -0,0 +1,107 @@
+/*
+Copyright 2021 The Cockroach Authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    https://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package actor
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	api "github.com/cockroachdb/cockroach-operator/apis/v1alpha1"
+	"github.com/cockroachdb/cockroach-operator/pkg/kube"
+	"github.com/cockroachdb/cockroach-operator/pkg/resource"
+	"github.com/cockroachdb/errors"
+	kbatch "k8s.io/api/batch/v1"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	kubetypes "k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/rest"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+// demoWorkloadInterval is how often the Job loading the demo workload is
+// polled.
+const demoWorkloadInterval = 15 * time.Second
+
+func newDemoWorkload(scheme *runtime.Scheme, cl client.Client, config *rest.Config) Actor {
+	return &demoWorkload{
+		action: newAction("demoWorkload", scheme, cl),
+		config: config,
+	}
+}
+
+// demoWorkload loads the sample data of the demo workload of the spec with a
+// Job, once the cluster is initialized. The data is loaded once: the actor
+// stops running when the Job succeeded. A failed Job is left for its logs to
+// be read, the data is loaded again once it is deleted
+type demoWorkload struct {
+	action
+
+	config *rest.Config
+}
+
+//GetActionType returns api.DemoWorkloadAction used to set the cluster status errors
+func (w demoWorkload) GetActionType() api.ActionType {
+	return api.DemoWorkloadAction
+}
+
+func (w demoWorkload) Act(ctx context.Context, cluster *resource.Cluster) error {
+	log := w.log.WithValues("CrdbCluster", cluster.ObjectKey())
+	log.V(DEBUGLEVEL).Info("loading the demo workload")
+
+	r := resource.NewManagedKubeResource(ctx, w.client, cluster, kube.AnnotatingPersister)
+	b := resource.DemoWorkloadJobBuilder{
+		Cluster:  cluster,
+		Selector: r.Labels.Selector(cluster.Spec().AdditionalLabels),
+	}
+	if _, err := (resource.Reconciler{
+		ManagedResource: r,
+		Builder:         b,
+		Owner:           cluster.Unwrap(),
+		Scheme:          w.scheme,
+	}).Reconcile(); err != nil {
+		return errors.Wrapf(err, "failed to reconcile %s", b.ResourceName())
+	}
+
+	job := &kbatch.Job{}
+	key := kubetypes.NamespacedName{Namespace: cluster.Namespace(), Name: b.ResourceName()}
+	if err := w.client.Get(ctx, key, job); err != nil {
+		return errors.Wrapf(err, "failed to fetch job %s", key.Name)
+	}
+
+	workload := cluster.Spec().DemoWorkload
+	if job.Status.Succeeded > 0 {
+		log.Info("loaded the demo workload", "workload", workload.Name, "scaleFactor", workload.ScaleFactorOrDefault())
+		cluster.SetCondition(api.DemoWorkloadLoadedCondition, metav1.ConditionTrue, "Loaded",
+			fmt.Sprintf("loaded %s at scale factor %d", workload.Name, workload.ScaleFactorOrDefault()))
+		return nil
+	}
+
+	for _, c := range job.Status.Conditions {
+		if c.Type == kbatch.JobFailed && c.Status == corev1.ConditionTrue {
+			message := fmt.Sprintf("job %s failed, delete it to load %s again: %s", key.Name, workload.Name, c.Message)
+			log.Info(message)
+			cluster.SetCondition(api.DemoWorkloadLoadedCondition, metav1.ConditionFalse, "LoadFailed", message)
+			return DeferredErr{Err: errors.New(message), RequeueAfter: demoWorkloadInterval}
+		}
+	}
+
+	cluster.SetCondition(api.DemoWorkloadLoadedCondition, metav1.ConditionFalse, "Loading",
+		fmt.Sprintf("job %s is loading %s", key.Name, workload.Name))
+	return DeferredErr{Err: errors.Newf("waiting for job %s to load the demo workload", key.Name), RequeueAfter: demoWorkloadInterval}
+}
@@ -0,0 +1,72 @@
+/*
+Copyright 2021 The Cockroach Authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    https://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package actor
+
+import (
+	"context"
+	"testing"
+
+	api "github.com/cockroachdb/cockroach-operator/apis/v1alpha1"
+	"github.com/cockroachdb/cockroach-operator/pkg/resource"
+	"github.com/cockroachdb/cockroach-operator/pkg/testutil"
+	"github.com/stretchr/testify/require"
+	kbatch "k8s.io/api/batch/v1"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+)
+
+func TestDemoWorkload(t *testing.T) {
+	scheme := testutil.InitScheme(t)
+	ctx := context.Background()
+
+	cr := testutil.NewBuilder("crdb").Namespaced("default").WithNodeCount(3).WithPVDataStore("1Gi", "standard").Cr()
+	cr.Spec.DemoWorkload = &api.DemoWorkload{Name: api.MovrWorkload, ScaleFactor: 2}
+	cluster := resource.NewCluster(cr)
+	cl := fake.NewFakeClientWithScheme(scheme, cr)
+	w := newDemoWorkload(scheme, cl, nil)
+
+	// the Job is created and polled until it finishes
+	deferred, ok := w.Act(ctx, &cluster).(DeferredErr)
+	require.True(t, ok)
+	require.Equal(t, demoWorkloadInterval, deferred.RequeueAfter)
+	condition := findCondition(&cluster, api.DemoWorkloadLoadedCondition)
+	require.Equal(t, metav1.ConditionFalse, condition.Status)
+	require.Equal(t, "Loading", condition.Reason)
+
+	job := &kbatch.Job{}
+	require.NoError(t, cl.Get(ctx, types.NamespacedName{Namespace: "default", Name: "crdb-demo-workload"}, job))
+	require.Contains(t, job.Spec.Template.Spec.Containers[0].Command, "--num-rides=1000")
+
+	job.Status.Conditions = []kbatch.JobCondition{{Type: kbatch.JobFailed, Status: corev1.ConditionTrue, Message: "BackoffLimitExceeded"}}
+	require.NoError(t, cl.Status().Update(ctx, job))
+	_, ok = w.Act(ctx, &cluster).(DeferredErr)
+	require.True(t, ok)
+	condition = findCondition(&cluster, api.DemoWorkloadLoadedCondition)
+	require.Equal(t, metav1.ConditionFalse, condition.Status)
+	require.Equal(t, "LoadFailed", condition.Reason)
+
+	job.Status.Conditions = nil
+	job.Status.Succeeded = 1
+	require.NoError(t, cl.Status().Update(ctx, job))
+	require.NoError(t, w.Act(ctx, &cluster))
+	condition = findCondition(&cluster, api.DemoWorkloadLoadedCondition)
+	require.Equal(t, metav1.ConditionTrue, condition.Status)
+	require.Equal(t, "Loaded", condition.Reason)
+	require.True(t, cluster.True(api.DemoWorkloadLoadedCondition))
+}
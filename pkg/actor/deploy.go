@@ -18,29 +18,44 @@ package actor
 
 import (
 	"context"
+	"fmt"
+	"strings"
 
 	api "github.com/cockroachdb/cockroach-operator/apis/v1alpha1"
+	"github.com/cockroachdb/cockroach-operator/pkg/features"
 	"github.com/cockroachdb/cockroach-operator/pkg/kube"
+	"github.com/cockroachdb/cockroach-operator/pkg/labels"
 	"github.com/cockroachdb/cockroach-operator/pkg/resource"
+	"github.com/cockroachdb/cockroach-operator/pkg/utilfeature"
 	"github.com/cockroachdb/errors"
+	appsv1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+	networkingv1 "k8s.io/api/networking/v1"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/types"
 	"k8s.io/client-go/rest"
+	"k8s.io/client-go/tools/record"
 	"sigs.k8s.io/controller-runtime/pkg/client"
 )
 
-func newDeploy(scheme *runtime.Scheme, cl client.Client, config *rest.Config, kd kube.KubernetesDistribution) Actor {
+func newDeploy(scheme *runtime.Scheme, cl client.Client, config *rest.Config, recorder record.EventRecorder, kd kube.KubernetesDistribution) Actor {
 	return &deploy{
-		action: newAction("deploy", scheme, cl),
-		config: config,
-		kd:     kd,
+		action:   newAction("deploy", scheme, cl),
+		config:   config,
+		recorder: recorder,
+		kd:       kd,
 	}
 }
 
 // deploy initializes and reconciles the Kubernetes resources needed by the CockroachDB cluster:
-// services, a statefulset and a pod disruption budget
+// services, the statefulsets of the nodes and of the node pools, a pod disruption budget, the claim of the
+// backup volume and the client pod
 type deploy struct {
 	action
-	config *rest.Config
+	config   *rest.Config
+	recorder record.EventRecorder
 
 	kd kube.KubernetesDistribution
 }
@@ -54,6 +69,75 @@ func (d deploy) Act(ctx context.Context, cluster *resource.Cluster) error {
 	log := d.log.WithValues("CrdbCluster", cluster.ObjectKey())
 	log.V(DEBUGLEVEL).Info("reconciling resources on deploy action")
 
+	featureNodePoolsEnabled := utilfeature.DefaultMutableFeatureGate.Enabled(features.NodePools)
+	if featureNodePoolsEnabled {
+		if err := cluster.Spec().ValidateNodePools(); err != nil {
+			return ValidationError{Err: err}
+		}
+	}
+
+	if err := cluster.Spec().ValidatePorts(); err != nil {
+		return ValidationError{Err: errors.Wrap(err, "invalid ports")}
+	}
+	if publicService := cluster.Spec().PublicService; publicService != nil {
+		if err := publicService.Validate(); err != nil {
+			return ValidationError{Err: errors.Wrap(err, "invalid publicService")}
+		}
+		if err := validateRegions(cluster, featureNodePoolsEnabled); err != nil {
+			return ValidationError{Err: errors.Wrap(err, "invalid publicService")}
+		}
+	}
+	if ingress := cluster.Spec().Ingress; ingress != nil {
+		if err := ingress.Validate(); err != nil {
+			return ValidationError{Err: errors.Wrap(err, "invalid ingress")}
+		}
+	}
+	if networkPolicy := cluster.Spec().NetworkPolicy; networkPolicy != nil {
+		if err := networkPolicy.Validate(); err != nil {
+			return ValidationError{Err: errors.Wrap(err, "invalid networkPolicy")}
+		}
+	}
+	if serviceMesh := cluster.Spec().ServiceMesh; serviceMesh != nil {
+		if err := serviceMesh.Validate(); err != nil {
+			return ValidationError{Err: errors.Wrap(err, "invalid serviceMesh")}
+		}
+	}
+	if network := cluster.Spec().Network; network != nil {
+		if err := network.Validate(); err != nil {
+			return ValidationError{Err: errors.Wrap(err, "invalid network")}
+		}
+	}
+	if err := cluster.Spec().ValidateHostNetwork(); err != nil {
+		return ValidationError{Err: errors.Wrap(err, "invalid hostNetwork")}
+	}
+	if err := cluster.Spec().ValidateMultiCluster(cluster.Name()); err != nil {
+		return ValidationError{Err: errors.Wrap(err, "invalid multiCluster")}
+	}
+	if err := cluster.Spec().ValidateTopologyLocality(); err != nil {
+		return ValidationError{Err: errors.Wrap(err, "invalid topologyLocality")}
+	}
+	if err := cluster.Spec().ValidateTopologySpreadConstraints(); err != nil {
+		return ValidationError{Err: errors.Wrap(err, "invalid topologySpreadConstraints")}
+	}
+
+	// the secrets provided by the user can be created after the cluster, the
+	// pods would not start without them
+	missing, err := resource.MissingSecrets(ctx, d.client, cluster)
+	if err != nil {
+		return err
+	}
+	if len(missing) > 0 {
+		message := fmt.Sprintf("waiting for secrets %s", strings.Join(missing, ", "))
+		log.Info(message)
+		cluster.SetCondition(api.SecretsAvailableCondition, metav1.ConditionFalse, "SecretNotFound", message)
+		return NotReadyErr{Err: errors.New(message)}
+	}
+	cluster.SetCondition(api.SecretsAvailableCondition, metav1.ConditionTrue, "SecretsFound", "")
+
+	if err := d.relaxAntiAffinity(ctx, cluster); err != nil {
+		return errors.Wrap(err, "failed to check the schedulable nodes")
+	}
+
 	owner := cluster.Unwrap()
 	r := resource.NewManagedKubeResource(ctx, d.client, cluster, kube.AnnotatingPersister)
 
@@ -64,15 +148,42 @@ func (d deploy) Act(ctx context.Context, cluster *resource.Cluster) error {
 
 	kubernetesDistro = "kubernetes-operator-" + kubernetesDistro
 
+	replicas, err := d.scaleUpReplicas(ctx, cluster, cluster.StatefulSetName(), cluster.Spec().Nodes, cluster.Spec().NodeSelector)
+	if err != nil {
+		return err
+	}
+
 	labelSelector := r.Labels.Selector(cluster.Spec().AdditionalLabels)
 	builders := []resource.Builder{
 		resource.DiscoveryServiceBuilder{Cluster: cluster, Selector: labelSelector},
 		resource.PublicServiceBuilder{Cluster: cluster, Selector: labelSelector},
-		resource.StatefulSetBuilder{Cluster: cluster, Selector: labelSelector, Telemetry: kubernetesDistro},
+		resource.StatefulSetBuilder{Cluster: cluster, Selector: labelSelector, Telemetry: kubernetesDistro, Replicas: replicas},
 		resource.PdbBuilder{Cluster: cluster, Selector: labelSelector},
 	}
+	// the pods are not created until their service account exists
+	if cluster.HasCloudIdentity() {
+		builders = append([]resource.Builder{resource.ServiceAccountBuilder{Cluster: cluster}}, builders...)
+	}
+	if cluster.Spec().BackupVolume.Provisioned() {
+		builders = append(builders, resource.BackupVolumeClaimBuilder{Cluster: cluster})
+	}
+	if cluster.Spec().ClientPod.IsEnabled() {
+		builders = append(builders, resource.ClientDeploymentBuilder{Cluster: cluster, Selector: labelSelector})
+	}
+	builders = append(builders, resource.IngressBuilders(cluster)...)
+	if cluster.Spec().NetworkPolicy.IsEnabled() {
+		builders = append(builders, resource.NetworkPolicyBuilder{Cluster: cluster, Selector: labelSelector})
+	}
 
 	for _, b := range builders {
+		// the statefulset keeps the version of a rolled back upgrade, and the
+		// partition of the canaries of an upgrade while they bake or after
+		// they degraded
+		if _, ok := b.(resource.StatefulSetBuilder); ok && (cluster.UpgradeRolledBack() || cluster.UpgradeHeld()) {
+			log.V(DEBUGLEVEL).Info("not reconciling the statefulset of a rolled back or held upgrade")
+			continue
+		}
+
 		changed, err := resource.Reconciler{
 			ManagedResource: r,
 			Builder:         b,
@@ -91,6 +202,434 @@ func (d deploy) Act(ctx context.Context, cluster *resource.Cluster) error {
 		}
 	}
 
+	if featureNodePoolsEnabled && !cluster.UpgradeRolledBack() && !cluster.UpgradeHeld() {
+		changed, err := d.reconcileNodePools(ctx, cluster, r, labelSelector, kubernetesDistro)
+		if err != nil {
+			return errors.Wrap(err, "failed to reconcile the node pools")
+		}
+		if changed {
+			CancelLoop(ctx)
+			return nil
+		}
+	}
+
+	if featureNodePoolsEnabled {
+		changed, err := d.reconcileRegionServices(ctx, cluster, r, labelSelector)
+		if err != nil {
+			return errors.Wrap(err, "failed to reconcile the public services of the regions")
+		}
+		if changed {
+			CancelLoop(ctx)
+			return nil
+		}
+	}
+
+	if !cluster.Spec().ClientPod.IsEnabled() {
+		if err := d.deleteClientPod(ctx, cluster); err != nil {
+			return errors.Wrap(err, "failed to delete the client pod")
+		}
+	}
+
+	if err := d.deleteIngresses(ctx, cluster); err != nil {
+		return errors.Wrap(err, "failed to delete the ingresses")
+	}
+
+	if !cluster.Spec().NetworkPolicy.IsEnabled() {
+		if err := d.deleteNetworkPolicy(ctx, cluster); err != nil {
+			return errors.Wrap(err, "failed to delete the network policy")
+		}
+	}
+
+	if err := d.reconcileSecretMetadata(ctx, cluster); err != nil {
+		return errors.Wrap(err, "failed to reconcile labels and annotations of certificate secrets")
+	}
+
+	if err := d.reconcilePVCMetadata(ctx, cluster); err != nil {
+		return errors.Wrap(err, "failed to reconcile labels and annotations of pvcs")
+	}
+
 	log.Info("deployed database")
 	return nil
 }
+
+// reconcileNodePools reconciles the StatefulSets of the node pools and
+// returns whether one was created or updated. The StatefulSet of a removed
+// pool is deleted once the decommission action has scaled it down.
+func (d deploy) reconcileNodePools(ctx context.Context, cluster *resource.Cluster, r resource.ManagedResource,
+	selector labels.Labels, telemetry string) (bool, error) {
+	log := d.log.WithValues("CrdbCluster", cluster.ObjectKey())
+	owner := cluster.Unwrap()
+
+	for _, pool := range cluster.Spec().NodePools {
+		b := resource.NewNodePoolStatefulSetBuilder(cluster, selector, telemetry, pool)
+		replicas, err := d.scaleUpReplicas(ctx, cluster, b.ResourceName(), pool.Nodes, cluster.Spec().PoolNodeSelector(pool.Name))
+		if err != nil {
+			return false, err
+		}
+		b.Replicas = replicas
+		poolResource := r
+		poolResource.Labels = resource.NodePoolLabels(r.Labels, pool.Name)
+
+		changed, err := resource.Reconciler{
+			ManagedResource: poolResource,
+			Builder:         b,
+			Owner:           owner,
+			Scheme:          d.scheme,
+		}.Reconcile()
+		if err != nil {
+			return false, errors.Wrapf(err, "failed to reconcile %s", b.ResourceName())
+		}
+		if changed {
+			log.Info("created/updated a resource, stopping request processing", "resource", b.ResourceName())
+			return true, nil
+		}
+	}
+
+	statefulSets, err := resource.NodePoolStatefulSets(ctx, d.client, cluster)
+	if err != nil {
+		return false, err
+	}
+	for i := range statefulSets {
+		ss := &statefulSets[i]
+		if cluster.Spec().NodePool(ss.Labels[resource.NodePoolLabel]) != nil {
+			continue
+		}
+		if ss.Spec.Replicas == nil || *ss.Spec.Replicas > 0 || ss.Status.Replicas > 0 {
+			log.V(DEBUGLEVEL).Info("waiting for the nodes of the removed node pool to be decommissioned", "StatefulSet", ss.Name)
+			continue
+		}
+
+		log.Info("deleting the statefulset of a removed node pool", "StatefulSet", ss.Name)
+		if err := d.client.Delete(ctx, ss); kube.IgnoreNotFound(err) != nil {
+			return false, errors.Wrapf(err, "failed to delete statefulset %s", ss.Name)
+		}
+	}
+
+	return false, nil
+}
+
+// reconcileRegionServices reconciles the public services of the regions of
+// externalDNS and returns whether one was created or updated. The service of
+// a removed region is deleted.
+func (d deploy) reconcileRegionServices(ctx context.Context, cluster *resource.Cluster, r resource.ManagedResource,
+	selector labels.Labels) (bool, error) {
+	log := d.log.WithValues("CrdbCluster", cluster.ObjectKey())
+	owner := cluster.Unwrap()
+
+	regions := map[string]bool{}
+	if publicService := cluster.Spec().PublicService; publicService != nil && publicService.ExternalDNS != nil {
+		for _, region := range publicService.ExternalDNS.Regions {
+			regions[region.Region] = true
+			pool := cluster.Spec().RegionNodePools(region.Region)[0]
+			b := resource.PublicServiceBuilder{
+				Cluster:  cluster,
+				Selector: resource.NodePoolLabels(selector, pool.Name),
+				Region:   region.Region,
+			}
+			regionResource := r
+			regionResource.Labels = resource.RegionLabels(r.Labels, region.Region)
+
+			changed, err := resource.Reconciler{
+				ManagedResource: regionResource,
+				Builder:         b,
+				Owner:           owner,
+				Scheme:          d.scheme,
+			}.Reconcile()
+			if err != nil {
+				return false, errors.Wrapf(err, "failed to reconcile %s", b.ResourceName())
+			}
+			if changed {
+				log.Info("created/updated a resource, stopping request processing", "resource", b.ResourceName())
+				return true, nil
+			}
+		}
+	}
+
+	services, err := resource.RegionPublicServices(ctx, d.client, cluster)
+	if err != nil {
+		return false, err
+	}
+	for i := range services {
+		service := &services[i]
+		if regions[service.Labels[resource.RegionLabel]] {
+			continue
+		}
+
+		log.Info("deleting the public service of a removed region", "Service", service.Name)
+		if err := d.client.Delete(ctx, service); kube.IgnoreNotFound(err) != nil {
+			return false, errors.Wrapf(err, "failed to delete service %s", service.Name)
+		}
+	}
+
+	return false, nil
+}
+
+// validateRegions checks that each region of externalDNS has a single node
+// pool, whose pods the public service of the region selects.
+func validateRegions(cluster *resource.Cluster, nodePoolsEnabled bool) error {
+	dns := cluster.Spec().PublicService.ExternalDNS
+	if dns == nil || len(dns.Regions) == 0 {
+		return nil
+	}
+	if !nodePoolsEnabled {
+		return errors.New("the regions of externalDNS need the NodePools feature gate")
+	}
+	for _, region := range dns.Regions {
+		if pools := cluster.Spec().RegionNodePools(region.Region); len(pools) != 1 {
+			return errors.Newf("region %q of externalDNS needs one node pool in its locality, not %d", region.Region, len(pools))
+		}
+	}
+	return nil
+}
+
+// scaleUpReplicas returns the replicas of the statefulset with the name while
+// a scale up to the nodes adds them a few at a time, following the scale up
+// strategy of the spec, and nil to scale it to the nodes at once. A new
+// statefulset is created with all its nodes.
+func (d deploy) scaleUpReplicas(ctx context.Context, cluster *resource.Cluster, name string, nodes int32, nodeSelector map[string]string) (*int32, error) {
+	strategy := cluster.Spec().ScaleUp
+	if !utilfeature.DefaultMutableFeatureGate.Enabled(features.ScaleUpStrategy) || strategy.TypeOrDefault() == api.ScaleUpAllAtOnce {
+		return nil, nil
+	}
+
+	ss := &appsv1.StatefulSet{}
+	if err := d.client.Get(ctx, types.NamespacedName{Namespace: cluster.Namespace(), Name: name}, ss); err != nil {
+		return nil, kube.IgnoreNotFound(err)
+	}
+	if ss.Spec.Replicas == nil || *ss.Spec.Replicas >= nodes {
+		return nil, nil
+	}
+
+	domains := 1
+	if strategy.TypeOrDefault() == api.ScaleUpZoneParallel {
+		var err error
+		if domains, err = resource.FailureDomains(ctx, d.client, cluster, strategy.TopologyKeyOrDefault(), nodeSelector); err != nil {
+			return nil, err
+		}
+	}
+
+	// the status of a statefulset that was just scaled up does not count the
+	// new pods yet
+	ready := ss.Status.ReadyReplicas
+	if ss.Status.ObservedGeneration < ss.Generation {
+		ready = 0
+	}
+
+	current := *ss.Spec.Replicas
+	next := strategy.NextReplicas(current, ready, nodes, domains)
+	if next == current {
+		d.log.V(DEBUGLEVEL).Info("waiting for the new pods to be ready to add more nodes", "StatefulSet", name, "ready", ready, "replicas", current)
+	} else {
+		d.log.Info("scaling up", "StatefulSet", name, "from", current, "to", next, "nodes", nodes, "domains", domains)
+	}
+	return &next, nil
+}
+
+// relaxAntiAffinity sets the AntiAffinityRelaxed condition while the
+// Kubernetes cluster has fewer schedulable nodes than the CockroachDB cluster
+// has nodes, if the spec allows it. The statefulset builder turns the required
+// pod anti-affinity terms into preferred ones while the condition is true.
+func (d deploy) relaxAntiAffinity(ctx context.Context, cluster *resource.Cluster) error {
+	log := d.log.WithValues("CrdbCluster", cluster.ObjectKey())
+	relaxed := cluster.True(api.AntiAffinityRelaxedCondition)
+
+	if !cluster.CanRelaxAntiAffinity() {
+		if relaxed {
+			cluster.SetCondition(api.AntiAffinityRelaxedCondition, metav1.ConditionFalse, "RelaxationDisabled", "")
+			d.recorder.Event(cluster.Unwrap(), corev1.EventTypeNormal, "AntiAffinityRestored", "Restored the required pod anti-affinity")
+		}
+		return nil
+	}
+
+	schedulable, err := resource.SchedulableNodes(ctx, d.client, cluster)
+	if err != nil {
+		return err
+	}
+
+	nodes := int(cluster.Spec().Nodes)
+	message := fmt.Sprintf("%d schedulable nodes for %d CockroachDB nodes", schedulable, nodes)
+	if schedulable >= nodes {
+		cluster.SetCondition(api.AntiAffinityRelaxedCondition, metav1.ConditionFalse, "EnoughNodes", message)
+		if relaxed {
+			log.Info("restoring the required pod anti-affinity", "schedulable", schedulable)
+			d.recorder.Eventf(cluster.Unwrap(), corev1.EventTypeNormal, "AntiAffinityRestored", "Restored the required pod anti-affinity: %s", message)
+		}
+		return nil
+	}
+
+	cluster.SetCondition(api.AntiAffinityRelaxedCondition, metav1.ConditionTrue, "NotEnoughNodes", message)
+	if !relaxed {
+		log.Info("relaxing the required pod anti-affinity", "schedulable", schedulable, "nodes", nodes)
+		d.recorder.Eventf(cluster.Unwrap(), corev1.EventTypeWarning, "AntiAffinityRelaxed", "Relaxed the required pod anti-affinity: %s", message)
+	}
+
+	return nil
+}
+
+// deleteClientPod deletes the Deployment of the client pod once it is
+// disabled. A Deployment with the same name not controlled by the cluster is
+// left alone.
+func (d deploy) deleteClientPod(ctx context.Context, cluster *resource.Cluster) error {
+	pod := &appsv1.Deployment{}
+	key := types.NamespacedName{Namespace: cluster.Namespace(), Name: cluster.ClientDeploymentName()}
+	if err := d.client.Get(ctx, key, pod); err != nil {
+		return kube.IgnoreNotFound(err)
+	}
+
+	if !metav1.IsControlledBy(pod, cluster.Unwrap()) {
+		return nil
+	}
+
+	d.log.Info("deleting the client pod", "Deployment", key)
+	return kube.IgnoreNotFound(d.client.Delete(ctx, pod))
+}
+
+// deleteNetworkPolicy deletes the NetworkPolicy of the nodes once it is
+// disabled. A NetworkPolicy with the same name not controlled by the cluster
+// is left alone.
+func (d deploy) deleteNetworkPolicy(ctx context.Context, cluster *resource.Cluster) error {
+	policy := &networkingv1.NetworkPolicy{}
+	key := types.NamespacedName{Namespace: cluster.Namespace(), Name: cluster.NetworkPolicyName()}
+	if err := d.client.Get(ctx, key, policy); err != nil {
+		return kube.IgnoreNotFound(err)
+	}
+
+	if !metav1.IsControlledBy(policy, cluster.Unwrap()) {
+		return nil
+	}
+
+	d.log.Info("deleting the network policy", "NetworkPolicy", key)
+	return kube.IgnoreNotFound(d.client.Delete(ctx, policy))
+}
+
+// deleteIngresses deletes the Ingress objects and the routes of the endpoints
+// that were removed from spec.ingress, or that changed between an Ingress and
+// a route. The routes are only looked up if the Gateway API is installed.
+func (d deploy) deleteIngresses(ctx context.Context, cluster *resource.Cluster) error {
+	ingress := cluster.Spec().Ingress
+	if ingress == nil {
+		ingress = &api.Ingress{}
+	}
+
+	owner := cluster.Unwrap()
+	for _, sql := range []bool{false, true} {
+		endpoint := ingress.UI
+		if sql {
+			endpoint = ingress.SQL
+		}
+
+		var unused []client.Object
+		if endpoint == nil || endpoint.Gateway != nil {
+			unused = append(unused, resource.IngressBuilder{Cluster: cluster, SQL: sql}.Placeholder())
+		}
+		if endpoint == nil || endpoint.Gateway == nil {
+			unused = append(unused, resource.RouteBuilder{Cluster: cluster, SQL: sql}.Placeholder())
+		}
+
+		for _, obj := range unused {
+			key := types.NamespacedName{Namespace: cluster.Namespace(), Name: obj.GetName()}
+			if err := d.client.Get(ctx, key, obj); err != nil {
+				if meta.IsNoMatchError(err) {
+					continue
+				}
+				if err := kube.IgnoreNotFound(err); err != nil {
+					return errors.Wrapf(err, "failed to get %s", key.Name)
+				}
+				continue
+			}
+			if !metav1.IsControlledBy(obj, owner) {
+				continue
+			}
+
+			d.log.Info("deleting an unused ingress", "name", key.Name, "kind", obj.GetObjectKind().GroupVersionKind().Kind)
+			if err := d.client.Delete(ctx, obj); kube.IgnoreNotFound(err) != nil {
+				return errors.Wrapf(err, "failed to delete %s", key.Name)
+			}
+		}
+	}
+	return nil
+}
+
+// reconcileSecretMetadata keeps the labels and annotations of the certificate
+// secrets generated by the operator up to date. The secrets are not owned by
+// the cluster, so the reconciler does not handle them.
+func (d deploy) reconcileSecretMetadata(ctx context.Context, cluster *resource.Cluster) error {
+	if !cluster.Spec().TLSEnabled || cluster.Spec().NodeTLSSecret != "" {
+		return nil
+	}
+
+	r := resource.NewKubeResource(ctx, d.client, cluster.Namespace(), kube.DefaultPersister)
+	for _, name := range []string{cluster.CASecretName(), cluster.NodeTLSSecretName(), cluster.ClientTLSSecretName()} {
+		secret, err := resource.LoadTLSSecret(name, r)
+		if kube.IgnoreNotFound(err) != nil {
+			return errors.Wrapf(err, "failed to get secret %s", name)
+		} else if err != nil {
+			continue
+		}
+
+		err = secret.WithLabels(labels.Propagated(cluster.Unwrap(), api.PropagateSecret)).
+			WithoutLabels(labels.Unpropagated(cluster.Unwrap(), api.PropagateSecret)).
+			WithAnnotations(cluster.Spec().PropagatedAnnotations(api.PropagateSecret)).
+			UpdateMetadata()
+		if err != nil {
+			return errors.Wrapf(err, "failed to update secret %s", name)
+		}
+	}
+
+	return nil
+}
+
+// reconcilePVCMetadata adds the propagated labels and annotations to the PVCs
+// of the cluster, which the StatefulSets create from their volume claim
+// templates and never update. The StatefulSets also label the new PVCs with
+// their selector, so the additional labels metadataPropagation keeps off the
+// PVCs are removed from them. The PVCs are labelled as managed by the
+// operator, which the sweep of the orphaned resources requires.
+func (d deploy) reconcilePVCMetadata(ctx context.Context, cluster *resource.Cluster) error {
+	spec := cluster.Spec()
+	propagated := labels.Labels{labels.ManagedByKey: labels.ManagedByOperator}
+	propagated.Merge(spec.PropagatedLabels(api.PropagatePersistentVolumeClaim))
+	unpropagated := labels.Unpropagated(cluster.Unwrap(), api.PropagatePersistentVolumeClaim)
+	annotations := spec.PropagatedAnnotations(api.PropagatePersistentVolumeClaim)
+
+	// the PVCs created before a change of the additional labels do not have
+	// them yet
+	selector := labels.Common(cluster.Unwrap()).Selector(nil)
+	pvcs := &corev1.PersistentVolumeClaimList{}
+	if err := d.client.List(ctx, pvcs, client.InNamespace(cluster.Namespace()), client.MatchingLabels(selector)); err != nil {
+		return errors.Wrap(err, "failed to list pvcs")
+	}
+
+	for i := range pvcs.Items {
+		pvc := &pvcs.Items[i]
+		patch := client.MergeFrom(pvc.DeepCopy())
+		changed := false
+		for k, v := range propagated {
+			if pvc.Labels[k] != v {
+				metav1.SetMetaDataLabel(&pvc.ObjectMeta, k, v)
+				changed = true
+			}
+		}
+		for k, v := range unpropagated {
+			if pvc.Labels[k] == v {
+				delete(pvc.Labels, k)
+				changed = true
+			}
+		}
+		for k, v := range annotations {
+			if pvc.Annotations[k] != v {
+				metav1.SetMetaDataAnnotation(&pvc.ObjectMeta, k, v)
+				changed = true
+			}
+		}
+		if !changed {
+			continue
+		}
+
+		if err := d.client.Patch(ctx, pvc, patch); client.IgnoreNotFound(err) != nil {
+			return errors.Wrapf(err, "failed to update pvc %s", pvc.Name)
+		}
+	}
+
+	return nil
+}
@@ -23,11 +23,24 @@ import (
 	api "github.com/cockroachdb/cockroach-operator/apis/v1alpha1"
 	"github.com/cockroachdb/cockroach-operator/pkg/actor"
 	"github.com/cockroachdb/cockroach-operator/pkg/kube"
+	"github.com/cockroachdb/cockroach-operator/pkg/labels"
+	"github.com/cockroachdb/cockroach-operator/pkg/ptr"
+	"github.com/cockroachdb/cockroach-operator/pkg/resource"
 	"github.com/cockroachdb/cockroach-operator/pkg/testutil"
+	"github.com/cockroachdb/cockroach-operator/pkg/utilfeature"
 	"github.com/cockroachdb/errors"
 	"github.com/go-logr/zapr"
 	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
 	"go.uber.org/zap/zaptest"
+	appsv1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+	networkingv1 "k8s.io/api/networking/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/tools/record"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
 )
 
 type key struct {
@@ -75,7 +88,7 @@ func TestDeploysNotInitalizedClusterAfterVersionChecker(t *testing.T) {
 	cluster.SetTrue(api.CrdbVersionChecked)
 
 	mock := kube.MockKubernetesDistribution()
-	deploy := actor.NewDeploy(scheme, client, nil, mock)
+	deploy := actor.NewDeploy(scheme, client, nil, record.NewFakeRecorder(10), mock)
 	t.Log(cluster.Status().Conditions)
 
 	// 3 is the number of resources we expect to be created. The action should be repeated as it is
@@ -86,3 +99,566 @@ func TestDeploysNotInitalizedClusterAfterVersionChecker(t *testing.T) {
 
 	assert.Equal(t, expected, actual)
 }
+
+func TestDeployWaitsForReferencedSecrets(t *testing.T) {
+	actor.Log = zapr.NewLogger(zaptest.NewLogger(t)).WithName("deploy-test")
+	ctx := actor.ContextWithCancelFn(context.TODO(), func() {})
+
+	scheme := testutil.InitScheme(t)
+	client := testutil.NewFakeClient(scheme)
+
+	cluster := testutil.NewBuilder("cockroachdb").
+		Namespaced("default").
+		WithUID("cockroachdb-uid").
+		WithPVDataStore("1Gi", "standard").
+		WithNodeCount(1).
+		WithTLS().
+		WithNodeTLS("node-certs").Cluster()
+	cluster.SetTrue(api.CrdbVersionChecked)
+
+	deploy := actor.NewDeploy(scheme, client, nil, record.NewFakeRecorder(10), kube.MockKubernetesDistribution())
+
+	err := deploy.Act(ctx, cluster)
+	require.IsType(t, actor.NotReadyErr{}, err)
+	require.Contains(t, err.Error(), "node-certs")
+	require.False(t, cluster.True(api.SecretsAvailableCondition))
+
+	secret := &corev1.Secret{ObjectMeta: metav1.ObjectMeta{Namespace: "default", Name: "node-certs"}}
+	require.NoError(t, client.Create(ctx, secret))
+
+	require.NoError(t, deploy.Act(ctx, cluster))
+	require.True(t, cluster.True(api.SecretsAvailableCondition))
+}
+
+func TestDeployTogglesTheClientPod(t *testing.T) {
+	actor.Log = zapr.NewLogger(zaptest.NewLogger(t)).WithName("deploy-test")
+	ctx := actor.ContextWithCancelFn(context.TODO(), func() {})
+
+	scheme := testutil.InitScheme(t)
+	client := testutil.NewFakeClient(scheme)
+
+	cr := testutil.NewBuilder("cockroachdb").
+		Namespaced("default").
+		WithUID("cockroachdb-uid").
+		WithPVDataStore("1Gi", "standard").
+		WithNodeCount(1).Cr()
+	cr.Spec.ClientPod = &api.ClientPod{Enabled: true}
+	cluster := resource.NewCluster(cr)
+	cluster.SetTrue(api.CrdbVersionChecked)
+
+	deploy := actor.NewDeploy(scheme, client, nil, record.NewFakeRecorder(10), kube.MockKubernetesDistribution())
+
+	// the action is restarted after each resource is created
+	for i := 0; i < 5; i++ {
+		require.NoError(t, deploy.Act(ctx, &cluster))
+	}
+
+	key := types.NamespacedName{Namespace: "default", Name: "cockroachdb-client"}
+	require.NoError(t, client.Get(ctx, key, &appsv1.Deployment{}))
+
+	cr = cluster.Unwrap()
+	cr.Spec.ClientPod.Enabled = false
+	cluster = resource.NewCluster(cr)
+	for i := 0; i < 5; i++ {
+		require.NoError(t, deploy.Act(ctx, &cluster))
+	}
+
+	err := client.Get(ctx, key, &appsv1.Deployment{})
+	require.True(t, apierrors.IsNotFound(err))
+}
+
+func TestDeployPropagatesTheMetadata(t *testing.T) {
+	actor.Log = zapr.NewLogger(zaptest.NewLogger(t)).WithName("deploy-test")
+	ctx := actor.ContextWithCancelFn(context.TODO(), func() {})
+
+	scheme := testutil.InitScheme(t)
+	annotations := map[string]string{"cost-center": "databases"}
+	cr := testutil.NewBuilder("cockroachdb").
+		Namespaced("default").
+		WithUID("cockroachdb-uid").
+		WithPVDataStore("1Gi", "standard").
+		WithAnnotations(annotations).
+		WithLabels(map[string]string{"team": "storage"}).
+		WithNodeCount(1).Cr()
+	cr.Spec.MetadataPropagation = &api.MetadataPropagation{Resources: []api.PropagatedResource{
+		api.PropagatePod,
+		api.PropagatePersistentVolumeClaim,
+	}}
+	cluster := resource.NewCluster(cr)
+	cluster.SetTrue(api.CrdbVersionChecked)
+
+	// a PVC created by the StatefulSet before the annotations were added
+	pvc := &corev1.PersistentVolumeClaim{
+		ObjectMeta: metav1.ObjectMeta{
+			Namespace: "default",
+			Name:      "datadir-cockroachdb-0",
+			Labels:    labels.Common(cr).Selector(nil),
+		},
+	}
+	client := testutil.NewFakeClient(scheme, pvc)
+
+	deploy := actor.NewDeploy(scheme, client, nil, record.NewFakeRecorder(10), kube.MockKubernetesDistribution())
+
+	// the action is restarted after each resource is created
+	for i := 0; i < 5; i++ {
+		require.NoError(t, deploy.Act(ctx, &cluster))
+	}
+
+	ss := &appsv1.StatefulSet{}
+	require.NoError(t, client.Get(ctx, types.NamespacedName{Namespace: "default", Name: "cockroachdb"}, ss))
+	require.NotContains(t, ss.Annotations, "cost-center")
+	require.Equal(t, "databases", ss.Spec.Template.Annotations["cost-center"])
+	require.NotContains(t, ss.Labels, "team")
+	require.Equal(t, "storage", ss.Spec.Template.Labels["team"])
+	require.Equal(t, "storage", ss.Spec.Selector.MatchLabels["team"])
+
+	service := &corev1.Service{}
+	require.NoError(t, client.Get(ctx, types.NamespacedName{Namespace: "default", Name: "cockroachdb"}, service))
+	require.NotContains(t, service.Annotations, "cost-center")
+	require.NotContains(t, service.Labels, "team")
+	require.Equal(t, "storage", service.Spec.Selector["team"])
+
+	require.NoError(t, client.Get(ctx, types.NamespacedName{Namespace: "default", Name: "datadir-cockroachdb-0"}, pvc))
+	require.Equal(t, "databases", pvc.Annotations["cost-center"])
+	require.Equal(t, "storage", pvc.Labels["team"])
+	require.Equal(t, labels.ManagedByOperator, pvc.Labels[labels.ManagedByKey])
+
+	// the PVCs left out lose the additional labels, including those the
+	// StatefulSet copies from its selector
+	cr.Spec.MetadataPropagation.Resources = []api.PropagatedResource{api.PropagatePod}
+	cluster = resource.NewCluster(cr)
+	cluster.SetTrue(api.CrdbVersionChecked)
+	other := &corev1.PersistentVolumeClaim{
+		ObjectMeta: metav1.ObjectMeta{
+			Namespace: "default",
+			Name:      "datadir-cockroachdb-1",
+			Labels:    labels.Common(cr).Selector(cr.Spec.AdditionalLabels),
+		},
+	}
+	require.NoError(t, client.Create(ctx, other))
+	require.NoError(t, deploy.Act(ctx, &cluster))
+
+	require.NoError(t, client.Get(ctx, types.NamespacedName{Namespace: "default", Name: "datadir-cockroachdb-1"}, other))
+	require.NotContains(t, other.Annotations, "cost-center")
+	require.NotContains(t, other.Labels, "team")
+
+	require.NoError(t, client.Get(ctx, types.NamespacedName{Namespace: "default", Name: "datadir-cockroachdb-0"}, pvc))
+	require.NotContains(t, pvc.Labels, "team")
+
+	ss = &appsv1.StatefulSet{}
+	require.NoError(t, client.Get(ctx, types.NamespacedName{Namespace: "default", Name: "cockroachdb"}, ss))
+	require.Equal(t, "storage", ss.Spec.Template.Labels["team"])
+}
+
+func TestDeployCreatesTheServiceAccount(t *testing.T) {
+	actor.Log = zapr.NewLogger(zaptest.NewLogger(t)).WithName("deploy-test")
+	ctx := actor.ContextWithCancelFn(context.TODO(), func() {})
+
+	scheme := testutil.InitScheme(t)
+	client := testutil.NewFakeClient(scheme)
+
+	cr := testutil.NewBuilder("cockroachdb").
+		Namespaced("default").
+		WithUID("cockroachdb-uid").
+		WithPVDataStore("1Gi", "standard").
+		WithNodeCount(1).Cr()
+	cr.Spec.ServiceAccountAnnotations = map[string]string{
+		"iam.gke.io/gcp-service-account": "crdb@project.iam.gserviceaccount.com",
+	}
+	cluster := resource.NewCluster(cr)
+	cluster.SetTrue(api.CrdbVersionChecked)
+
+	deploy := actor.NewDeploy(scheme, client, nil, record.NewFakeRecorder(10), kube.MockKubernetesDistribution())
+
+	// the action is restarted after each resource is created
+	for i := 0; i < 5; i++ {
+		require.NoError(t, deploy.Act(ctx, &cluster))
+	}
+
+	sa := &corev1.ServiceAccount{}
+	require.NoError(t, client.Get(ctx, types.NamespacedName{Namespace: "default", Name: "cockroachdb-sa"}, sa))
+	require.Equal(t, "crdb@project.iam.gserviceaccount.com", sa.Annotations["iam.gke.io/gcp-service-account"])
+
+	ss := &appsv1.StatefulSet{}
+	require.NoError(t, client.Get(ctx, types.NamespacedName{Namespace: "default", Name: "cockroachdb"}, ss))
+	require.Equal(t, "cockroachdb-sa", ss.Spec.Template.Spec.ServiceAccountName)
+}
+
+func TestDeployRelaxesAntiAffinity(t *testing.T) {
+	actor.Log = zapr.NewLogger(zaptest.NewLogger(t)).WithName("deploy-test")
+	ctx := actor.ContextWithCancelFn(context.TODO(), func() {})
+	utilfeature.DefaultMutableFeatureGate.Set("AffinityRules=true")
+	defer utilfeature.DefaultMutableFeatureGate.Set("AffinityRules=false")
+
+	node := func(name string) *corev1.Node {
+		return &corev1.Node{
+			ObjectMeta: metav1.ObjectMeta{Name: name},
+			Status: corev1.NodeStatus{
+				Conditions: []corev1.NodeCondition{{Type: corev1.NodeReady, Status: corev1.ConditionTrue}},
+			},
+		}
+	}
+
+	scheme := testutil.InitScheme(t)
+	client := fake.NewFakeClientWithScheme(scheme, node("node-1"))
+
+	cr := testutil.NewBuilder("cockroachdb").
+		Namespaced("default").
+		WithUID("cockroachdb-uid").
+		WithPVDataStore("1Gi", "standard").
+		WithNodeCount(3).
+		WithAffinity(&corev1.Affinity{
+			PodAntiAffinity: &corev1.PodAntiAffinity{
+				RequiredDuringSchedulingIgnoredDuringExecution: []corev1.PodAffinityTerm{{
+					LabelSelector: &metav1.LabelSelector{MatchLabels: map[string]string{"app.kubernetes.io/instance": "cockroachdb"}},
+					TopologyKey:   "kubernetes.io/hostname",
+				}},
+			},
+		}).Cr()
+	cr.Spec.RelaxAntiAffinity = true
+	cluster := resource.NewCluster(cr)
+	cluster.SetTrue(api.CrdbVersionChecked)
+
+	recorder := record.NewFakeRecorder(10)
+	deploy := actor.NewDeploy(scheme, client, nil, recorder, kube.MockKubernetesDistribution())
+
+	// the action is restarted after each resource is created or updated
+	act := func() *corev1.PodAntiAffinity {
+		for i := 0; i < 5; i++ {
+			require.NoError(t, deploy.Act(ctx, &cluster))
+		}
+
+		sts := &appsv1.StatefulSet{}
+		require.NoError(t, client.Get(ctx, types.NamespacedName{Namespace: "default", Name: "cockroachdb"}, sts))
+		return sts.Spec.Template.Spec.Affinity.PodAntiAffinity
+	}
+
+	anti := act()
+	require.True(t, cluster.True(api.AntiAffinityRelaxedCondition))
+	require.Empty(t, anti.RequiredDuringSchedulingIgnoredDuringExecution)
+	require.Len(t, anti.PreferredDuringSchedulingIgnoredDuringExecution, 1)
+	require.Contains(t, <-recorder.Events, "AntiAffinityRelaxed")
+
+	require.NoError(t, client.Create(ctx, node("node-2")))
+	require.NoError(t, client.Create(ctx, node("node-3")))
+
+	anti = act()
+	require.False(t, cluster.True(api.AntiAffinityRelaxedCondition))
+	require.Len(t, anti.RequiredDuringSchedulingIgnoredDuringExecution, 1)
+	require.Empty(t, anti.PreferredDuringSchedulingIgnoredDuringExecution)
+	require.Contains(t, <-recorder.Events, "AntiAffinityRestored")
+}
+
+func TestDeployScalesUpOneNodePerFailureDomain(t *testing.T) {
+	actor.Log = zapr.NewLogger(zaptest.NewLogger(t)).WithName("deploy-test")
+	ctx := actor.ContextWithCancelFn(context.TODO(), func() {})
+	utilfeature.DefaultMutableFeatureGate.Set("ScaleUpStrategy=true")
+	defer utilfeature.DefaultMutableFeatureGate.Set("ScaleUpStrategy=false")
+
+	node := func(name, zone string) *corev1.Node {
+		return &corev1.Node{
+			ObjectMeta: metav1.ObjectMeta{Name: name, Labels: map[string]string{api.DefaultScaleUpTopologyKey: zone}},
+			Status: corev1.NodeStatus{
+				Conditions: []corev1.NodeCondition{{Type: corev1.NodeReady, Status: corev1.ConditionTrue}},
+			},
+		}
+	}
+
+	scheme := testutil.InitScheme(t)
+	client := fake.NewFakeClientWithScheme(scheme, node("node-1", "a"), node("node-2", "b"), node("node-3", "c"))
+
+	cr := testutil.NewBuilder("cockroachdb").
+		Namespaced("default").
+		WithUID("cockroachdb-uid").
+		WithPVDataStore("1Gi", "standard").
+		WithNodeCount(3).Cr()
+	cr.Spec.ScaleUp = &api.ScaleUpStrategy{Type: api.ScaleUpZoneParallel}
+	cluster := resource.NewCluster(cr)
+	cluster.SetTrue(api.CrdbVersionChecked)
+
+	deploy := actor.NewDeploy(scheme, client, nil, record.NewFakeRecorder(10), kube.MockKubernetesDistribution())
+
+	key := types.NamespacedName{Namespace: "default", Name: "cockroachdb"}
+	// act runs the action, restarted after each resource is created or
+	// updated, with ready pods and returns the replicas of the statefulset
+	act := func(ready int32) int32 {
+		sts := &appsv1.StatefulSet{}
+		if err := client.Get(ctx, key, sts); err == nil {
+			sts.Status.ReadyReplicas = ready
+			require.NoError(t, client.Update(ctx, sts))
+		}
+
+		for i := 0; i < 5; i++ {
+			require.NoError(t, deploy.Act(ctx, &cluster))
+		}
+
+		require.NoError(t, client.Get(ctx, key, sts))
+		return *sts.Spec.Replicas
+	}
+
+	// the statefulset is created with all its nodes
+	require.Equal(t, int32(3), act(0))
+
+	cr = cluster.Unwrap()
+	cr.Spec.Nodes = 8
+	cluster = resource.NewCluster(cr)
+
+	require.Equal(t, int32(6), act(3))
+	// the new pods are not ready yet
+	require.Equal(t, int32(6), act(4))
+	require.Equal(t, int32(8), act(6))
+}
+
+func TestDeployReconcilesTheNodePools(t *testing.T) {
+	actor.Log = zapr.NewLogger(zaptest.NewLogger(t)).WithName("deploy-test")
+	ctx := actor.ContextWithCancelFn(context.TODO(), func() {})
+	utilfeature.DefaultMutableFeatureGate.Set("NodePools=true")
+	defer utilfeature.DefaultMutableFeatureGate.Set("NodePools=false")
+
+	scheme := testutil.InitScheme(t)
+	client := testutil.NewFakeClient(scheme)
+
+	cr := testutil.NewBuilder("cockroachdb").
+		Namespaced("default").
+		WithUID("cockroachdb-uid").
+		WithPVDataStore("1Gi", "standard").
+		WithNodeCount(3).Cr()
+	cr.Spec.NodePools = []api.NodePool{{
+		Name:         "large",
+		Nodes:        2,
+		Locality:     "zone=us-east1-b",
+		NodeSelector: map[string]string{"node.kubernetes.io/instance-type": "n2-standard-8"},
+	}}
+	cluster := resource.NewCluster(cr)
+	cluster.SetTrue(api.CrdbVersionChecked)
+
+	deploy := actor.NewDeploy(scheme, client, nil, record.NewFakeRecorder(10), kube.MockKubernetesDistribution())
+
+	// the action is restarted after each resource is created
+	for i := 0; i < 6; i++ {
+		require.NoError(t, deploy.Act(ctx, &cluster))
+	}
+
+	key := types.NamespacedName{Namespace: "default", Name: "cockroachdb-large"}
+	pool := &appsv1.StatefulSet{}
+	require.NoError(t, client.Get(ctx, key, pool))
+	require.Equal(t, int32(2), *pool.Spec.Replicas)
+	require.Equal(t, "large", pool.Labels[resource.NodePoolLabel])
+	require.Equal(t, "n2-standard-8", pool.Spec.Template.Spec.NodeSelector["node.kubernetes.io/instance-type"])
+
+	// the statefulset of a removed pool is kept until its nodes are decommissioned
+	cr = cluster.Unwrap()
+	cr.Spec.NodePools = nil
+	cluster = resource.NewCluster(cr)
+	require.NoError(t, deploy.Act(ctx, &cluster))
+	require.NoError(t, client.Get(ctx, key, pool))
+
+	pool.Spec.Replicas = ptr.Int32(0)
+	require.NoError(t, client.Update(ctx, pool))
+	require.NoError(t, deploy.Act(ctx, &cluster))
+	require.True(t, apierrors.IsNotFound(client.Get(ctx, key, pool)))
+}
+
+func TestDeployRejectsDuplicateNodePools(t *testing.T) {
+	ctx := actor.ContextWithCancelFn(context.TODO(), func() {})
+	utilfeature.DefaultMutableFeatureGate.Set("NodePools=true")
+	defer utilfeature.DefaultMutableFeatureGate.Set("NodePools=false")
+	scheme := testutil.InitScheme(t)
+
+	cr := testutil.NewBuilder("cockroachdb").Namespaced("default").WithNodeCount(3).Cr()
+	cr.Spec.NodePools = []api.NodePool{{Name: "large", Nodes: 2}, {Name: "large", Nodes: 1}}
+	cluster := resource.NewCluster(cr)
+
+	deploy := actor.NewDeploy(scheme, testutil.NewFakeClient(scheme), nil, record.NewFakeRecorder(10), kube.MockKubernetesDistribution())
+	err := deploy.Act(ctx, &cluster)
+	require.IsType(t, actor.ValidationError{}, err)
+}
+
+func TestDeployRejectsConflictingPorts(t *testing.T) {
+	ctx := actor.ContextWithCancelFn(context.TODO(), func() {})
+	scheme := testutil.InitScheme(t)
+
+	cr := testutil.NewBuilder("cockroachdb").Namespaced("default").WithNodeCount(3).WithHTTPPort(26257).Cr()
+	cr.Spec.SQLPort = ptr.Int32(26257)
+	cluster := resource.NewCluster(cr)
+
+	deploy := actor.NewDeploy(scheme, testutil.NewFakeClient(scheme), nil, record.NewFakeRecorder(10), kube.MockKubernetesDistribution())
+	err := deploy.Act(ctx, &cluster)
+	require.IsType(t, actor.ValidationError{}, err)
+	require.Contains(t, err.Error(), "httpPort and sqlPort are both 26257")
+}
+
+func TestDeployExposesThePublicService(t *testing.T) {
+	ctx := actor.ContextWithCancelFn(context.TODO(), func() {})
+	scheme := testutil.InitScheme(t)
+	client := testutil.NewFakeClient(scheme)
+
+	cr := testutil.NewBuilder("cockroachdb").
+		Namespaced("default").
+		WithUID("cockroachdb-uid").
+		WithPVDataStore("1Gi", "standard").
+		WithNodeCount(1).Cr()
+	cr.Spec.PublicService = &api.PublicService{
+		Type:                     corev1.ServiceTypeLoadBalancer,
+		LoadBalancerSourceRanges: []string{"10.0.0.0/8"},
+	}
+	cluster := resource.NewCluster(cr)
+	cluster.SetTrue(api.CrdbVersionChecked)
+
+	deploy := actor.NewDeploy(scheme, client, nil, record.NewFakeRecorder(10), kube.MockKubernetesDistribution())
+
+	// the action is restarted after each resource is created
+	for i := 0; i < 5; i++ {
+		require.NoError(t, deploy.Act(ctx, &cluster))
+	}
+
+	service := &corev1.Service{}
+	require.NoError(t, client.Get(ctx, types.NamespacedName{Namespace: "default", Name: "cockroachdb-public"}, service))
+	require.Equal(t, corev1.ServiceTypeLoadBalancer, service.Spec.Type)
+	require.Equal(t, []string{"10.0.0.0/8"}, service.Spec.LoadBalancerSourceRanges)
+	require.Equal(t, corev1.ServiceExternalTrafficPolicyTypeCluster, service.Spec.ExternalTrafficPolicy)
+
+	// the source ranges only apply to a load balancer
+	cr = cluster.Unwrap()
+	cr.Spec.PublicService.Type = corev1.ServiceTypeNodePort
+	cluster = resource.NewCluster(cr)
+	err := deploy.Act(ctx, &cluster)
+	require.IsType(t, actor.ValidationError{}, err)
+}
+
+func TestDeployDeletesTheRemovedIngress(t *testing.T) {
+	ctx := actor.ContextWithCancelFn(context.TODO(), func() {})
+	scheme := testutil.InitScheme(t)
+	client := testutil.NewFakeClient(scheme)
+
+	cr := testutil.NewBuilder("cockroachdb").
+		Namespaced("default").
+		WithUID("cockroachdb-uid").
+		WithPVDataStore("1Gi", "standard").
+		WithNodeCount(1).Cr()
+	cr.Spec.Ingress = &api.Ingress{
+		UI: &api.IngressEndpoint{Host: "ui.example.com"},
+	}
+	cluster := resource.NewCluster(cr)
+	cluster.SetTrue(api.CrdbVersionChecked)
+
+	deploy := actor.NewDeploy(scheme, client, nil, record.NewFakeRecorder(10), kube.MockKubernetesDistribution())
+
+	// the action is restarted after each resource is created
+	for i := 0; i < 6; i++ {
+		require.NoError(t, deploy.Act(ctx, &cluster))
+	}
+
+	key := types.NamespacedName{Namespace: "default", Name: "cockroachdb-ui"}
+	ingress := &networkingv1.Ingress{}
+	require.NoError(t, client.Get(ctx, key, ingress))
+	require.Equal(t, "ui.example.com", ingress.Spec.Rules[0].Host)
+
+	cr = cluster.Unwrap()
+	cr.Spec.Ingress = nil
+	cluster = resource.NewCluster(cr)
+	require.NoError(t, deploy.Act(ctx, &cluster))
+
+	err := client.Get(ctx, key, &networkingv1.Ingress{})
+	require.True(t, apierrors.IsNotFound(err))
+}
+
+func TestDeployNetworkPolicy(t *testing.T) {
+	ctx := actor.ContextWithCancelFn(context.TODO(), func() {})
+	scheme := testutil.InitScheme(t)
+	client := testutil.NewFakeClient(scheme)
+
+	cr := testutil.NewBuilder("cockroachdb").
+		Namespaced("default").
+		WithUID("cockroachdb-uid").
+		WithPVDataStore("1Gi", "standard").
+		WithNodeCount(1).Cr()
+	cr.Spec.NetworkPolicy = &api.NetworkPolicy{Enabled: true, AllowedNamespaces: []string{"web"}}
+	cluster := resource.NewCluster(cr)
+	cluster.SetTrue(api.CrdbVersionChecked)
+
+	deploy := actor.NewDeploy(scheme, client, nil, record.NewFakeRecorder(10), kube.MockKubernetesDistribution())
+
+	// the action is restarted after each resource is created
+	for i := 0; i < 6; i++ {
+		require.NoError(t, deploy.Act(ctx, &cluster))
+	}
+
+	key := types.NamespacedName{Namespace: "default", Name: "cockroachdb"}
+	policy := &networkingv1.NetworkPolicy{}
+	require.NoError(t, client.Get(ctx, key, policy))
+	require.Len(t, policy.Spec.Ingress, 3)
+
+	cr = cluster.Unwrap()
+	cr.Spec.NetworkPolicy = &api.NetworkPolicy{AllowedNamespaces: []string{"web"}}
+	cluster = resource.NewCluster(cr)
+	err := deploy.Act(ctx, &cluster)
+	require.IsType(t, actor.ValidationError{}, err)
+
+	cr.Spec.NetworkPolicy.AllowedNamespaces = nil
+	cluster = resource.NewCluster(cr)
+	require.NoError(t, deploy.Act(ctx, &cluster))
+
+	err = client.Get(ctx, key, &networkingv1.NetworkPolicy{})
+	require.True(t, apierrors.IsNotFound(err))
+}
+
+func TestDeployPublishesTheRegions(t *testing.T) {
+	ctx := actor.ContextWithCancelFn(context.TODO(), func() {})
+	utilfeature.DefaultMutableFeatureGate.Set("NodePools=true")
+	defer utilfeature.DefaultMutableFeatureGate.Set("NodePools=false")
+	scheme := testutil.InitScheme(t)
+	client := testutil.NewFakeClient(scheme)
+
+	cr := testutil.NewBuilder("cockroachdb").
+		Namespaced("default").
+		WithUID("cockroachdb-uid").
+		WithPVDataStore("1Gi", "standard").
+		WithNodeCount(3).Cr()
+	cr.Spec.NodePools = []api.NodePool{{Name: "east", Nodes: 3, Locality: "region=us-east1"}}
+	cr.Spec.PublicService = &api.PublicService{
+		Type: corev1.ServiceTypeLoadBalancer,
+		ExternalDNS: &api.ExternalDNS{
+			Hostnames: []string{"db.example.com"},
+			Regions: []api.RegionHostnames{
+				{Region: "us-east1", Hostnames: []string{"us-east1.db.example.com"}},
+			},
+		},
+	}
+	cluster := resource.NewCluster(cr)
+	cluster.SetTrue(api.CrdbVersionChecked)
+
+	deploy := actor.NewDeploy(scheme, client, nil, record.NewFakeRecorder(10), kube.MockKubernetesDistribution())
+
+	// the action is restarted after each resource is created
+	for i := 0; i < 7; i++ {
+		require.NoError(t, deploy.Act(ctx, &cluster))
+	}
+
+	service := &corev1.Service{}
+	require.NoError(t, client.Get(ctx, types.NamespacedName{Namespace: "default", Name: "cockroachdb-public"}, service))
+	require.Equal(t, "db.example.com", service.Annotations[resource.ExternalDNSHostnameAnnotation])
+
+	key := types.NamespacedName{Namespace: "default", Name: "cockroachdb-public-us-east1"}
+	require.NoError(t, client.Get(ctx, key, service))
+	require.Equal(t, "us-east1.db.example.com", service.Annotations[resource.ExternalDNSHostnameAnnotation])
+	require.Equal(t, "us-east1", service.Labels[resource.RegionLabel])
+	require.Equal(t, "east", service.Spec.Selector[resource.NodePoolLabel])
+	require.Equal(t, corev1.ServiceTypeLoadBalancer, service.Spec.Type)
+
+	// a region needs a node pool
+	cr = cluster.Unwrap()
+	cr.Spec.PublicService.ExternalDNS.Regions = append(cr.Spec.PublicService.ExternalDNS.Regions,
+		api.RegionHostnames{Region: "us-west1", Hostnames: []string{"us-west1.db.example.com"}})
+	cluster = resource.NewCluster(cr)
+	err := deploy.Act(ctx, &cluster)
+	require.IsType(t, actor.ValidationError{}, err)
+
+	// the service of a removed region is deleted
+	cr.Spec.PublicService.ExternalDNS.Regions = nil
+	cluster = resource.NewCluster(cr)
+	for i := 0; i < 2; i++ {
+		require.NoError(t, deploy.Act(ctx, &cluster))
+	}
+	require.True(t, apierrors.IsNotFound(client.Get(ctx, key, &corev1.Service{})))
+}
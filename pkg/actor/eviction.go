@@ -0,0 +1,193 @@
+/*
+Copyright 2021 The Cockroach Authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    https://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package actor
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"time"
+
+	api "github.com/cockroachdb/cockroach-operator/apis/v1alpha1"
+	"github.com/cockroachdb/cockroach-operator/pkg/clustersql"
+	"github.com/cockroachdb/cockroach-operator/pkg/kube"
+	"github.com/cockroachdb/cockroach-operator/pkg/labels"
+	"github.com/cockroachdb/cockroach-operator/pkg/resource"
+	"github.com/cockroachdb/errors"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/client-go/rest"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+func newEviction(scheme *runtime.Scheme, cl client.Client, config *rest.Config) Actor {
+	e := &eviction{
+		action: newAction("eviction", scheme, cl),
+		config: config,
+	}
+	e.replication = e.clusterReplication
+	return e
+}
+
+// eviction polls whether a pod of the cluster can be evicted without losing
+// the quorum of some ranges, sets the EvictionSafe condition, and keeps the
+// PodDisruptionBudget and the safe-to-evict annotation of the pods in line
+// with it
+type eviction struct {
+	action
+
+	config *rest.Config
+	// replication returns the number of ranges of the cluster that are not
+	// fully replicated
+	replication func(ctx context.Context, cluster *resource.Cluster) (clustersql.Replication, error)
+}
+
+//GetActionType returns api.EvictionAction used to set the cluster status errors
+func (e eviction) GetActionType() api.ActionType {
+	return api.EvictionAction
+}
+
+func (e eviction) Act(ctx context.Context, cluster *resource.Cluster) error {
+	log := e.log.WithValues("CrdbCluster", cluster.ObjectKey())
+	log.V(DEBUGLEVEL).Info("checking whether the pods can be evicted")
+
+	selector := labels.Common(cluster.Unwrap()).Selector(cluster.Spec().AdditionalLabels)
+	pods := &corev1.PodList{}
+	if err := e.client.List(ctx, pods, client.InNamespace(cluster.Namespace()), client.MatchingLabels(selector)); err != nil {
+		return errors.Wrap(err, "failed to list pods")
+	}
+
+	policy := cluster.EvictionPolicy()
+	if policy == nil {
+		// the annotations set under a removed policy are not left behind, and
+		// the cluster is not polled anymore once its condition is removed
+		if err := e.annotate(ctx, pods, ""); err != nil {
+			return err
+		}
+		cluster.RemoveCondition(api.EvictionSafeCondition)
+		return nil
+	}
+
+	status, reason, message := e.evictionSafe(ctx, cluster, pods)
+	previous := findCondition(cluster, api.EvictionSafeCondition)
+	cluster.SetCondition(api.EvictionSafeCondition, status, reason, message)
+	if previous.Status != status {
+		log.Info("eviction safety changed", "safe", status, "reason", reason, "message", message)
+	}
+
+	// the deploy action builds the same budget, it is reconciled here so that
+	// it does not wait for the next loop
+	r := resource.NewManagedKubeResource(ctx, e.client, cluster, kube.AnnotatingPersister)
+	b := resource.PdbBuilder{Cluster: cluster, Selector: selector}
+	changed, err := (resource.Reconciler{
+		ManagedResource: r,
+		Builder:         b,
+		Owner:           cluster.Unwrap(),
+		Scheme:          e.scheme,
+	}).Reconcile()
+	if err != nil {
+		return errors.Wrapf(err, "failed to reconcile %s", b.ResourceName())
+	}
+	if changed {
+		log.Info("updated the pod disruption budget", "blocksEvictions", cluster.BlocksEvictions())
+	}
+
+	value := ""
+	if policy.SafeToEvict {
+		value = strconv.FormatBool(status == metav1.ConditionTrue)
+	}
+	if err := e.annotate(ctx, pods, value); err != nil {
+		return err
+	}
+
+	return nil
+}
+
+// PollInterval returns how often the pods and the ranges are checked while the
+// cluster has an eviction policy, so that a node that falls behind blocks the
+// evictions before a drain reaches it.
+func (e eviction) PollInterval(cluster *resource.Cluster) time.Duration {
+	if cluster.EvictionPolicy() == nil {
+		return 0
+	}
+	return pollInterval
+}
+
+// evictionSafe returns the status, reason and message of the EvictionSafe
+// condition: every pod of the cluster must be ready and every range must have
+// all of its replicas.
+func (e eviction) evictionSafe(ctx context.Context, cluster *resource.Cluster, pods *corev1.PodList) (metav1.ConditionStatus, string, string) {
+	ready := 0
+	for i := range pods.Items {
+		if pods.Items[i].DeletionTimestamp == nil && kube.IsPodReady(&pods.Items[i]) {
+			ready++
+		}
+	}
+	if nodes := int(cluster.Spec().Nodes); ready < nodes {
+		return metav1.ConditionFalse, "PodsNotReady", fmt.Sprintf("%d of %d pods are ready", ready, nodes)
+	}
+
+	replication, err := e.replication(ctx, cluster)
+	if err != nil {
+		// a drain is not safe while the ranges cannot be checked
+		return metav1.ConditionFalse, "ReplicationUnknown", err.Error()
+	}
+	if !replication.FullyReplicated() {
+		return metav1.ConditionFalse, "RangesUnderReplicated",
+			fmt.Sprintf("%d ranges are under-replicated, %d are unavailable", replication.UnderReplicated, replication.Unavailable)
+	}
+	return metav1.ConditionTrue, "FullyReplicated", ""
+}
+
+// annotate sets the safe-to-evict annotation of the pods to the value, or
+// removes it when the value is empty.
+func (e eviction) annotate(ctx context.Context, pods *corev1.PodList, value string) error {
+	for i := range pods.Items {
+		pod := &pods.Items[i]
+		current, found := pod.Annotations[resource.SafeToEvictAnnotation]
+		if (found && current == value) || (!found && value == "") {
+			continue
+		}
+
+		patch := client.MergeFrom(pod.DeepCopy())
+		if value == "" {
+			delete(pod.Annotations, resource.SafeToEvictAnnotation)
+		} else {
+			if pod.Annotations == nil {
+				pod.Annotations = map[string]string{}
+			}
+			pod.Annotations[resource.SafeToEvictAnnotation] = value
+		}
+		if err := e.client.Patch(ctx, pod, patch); err != nil {
+			return errors.Wrapf(err, "failed to annotate pod %s", pod.Name)
+		}
+	}
+	return nil
+}
+
+// clusterReplication returns the number of ranges that are not fully
+// replicated from the metrics of the stores.
+func (e eviction) clusterReplication(ctx context.Context, cluster *resource.Cluster) (clustersql.Replication, error) {
+	db, err := openDatabase(ctx, e.client, e.config, cluster)
+	if err != nil {
+		return clustersql.Replication{}, err
+	}
+	defer db.Close()
+
+	return clustersql.ReplicationStatus(ctx, db)
+}
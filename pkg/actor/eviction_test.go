@@ -0,0 +1,174 @@
+/*
+Copyright 2021 The Cockroach Authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    https://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package actor
+
+import (
+	"context"
+	"fmt"
+	"testing"
+
+	api "github.com/cockroachdb/cockroach-operator/apis/v1alpha1"
+	"github.com/cockroachdb/cockroach-operator/pkg/clustersql"
+	"github.com/cockroachdb/cockroach-operator/pkg/labels"
+	"github.com/cockroachdb/cockroach-operator/pkg/resource"
+	"github.com/cockroachdb/cockroach-operator/pkg/testutil"
+	"github.com/cockroachdb/cockroach-operator/pkg/utilfeature"
+	"github.com/cockroachdb/errors"
+	"github.com/stretchr/testify/require"
+	corev1 "k8s.io/api/core/v1"
+	policy "k8s.io/api/policy/v1beta1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/types"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+)
+
+func TestEviction(t *testing.T) {
+	scheme := testutil.InitScheme(t)
+	ctx := context.Background()
+	utilfeature.DefaultMutableFeatureGate.Set("EvictionPolicy=true")
+	defer utilfeature.DefaultMutableFeatureGate.Set("EvictionPolicy=false")
+	var maxUnavailable int32 = 1
+
+	tests := []struct {
+		name           string
+		ready          int
+		replication    clustersql.Replication
+		err            error
+		status         metav1.ConditionStatus
+		reason         string
+		annotation     string
+		maxUnavailable int
+	}{
+		{
+			name:           "cluster is healthy",
+			ready:          3,
+			status:         metav1.ConditionTrue,
+			reason:         "FullyReplicated",
+			annotation:     "true",
+			maxUnavailable: 1,
+		},
+		{
+			name:           "a pod is not ready",
+			ready:          2,
+			status:         metav1.ConditionFalse,
+			reason:         "PodsNotReady",
+			annotation:     "false",
+			maxUnavailable: 0,
+		},
+		{
+			name:           "ranges are under-replicated",
+			ready:          3,
+			replication:    clustersql.Replication{UnderReplicated: 12},
+			status:         metav1.ConditionFalse,
+			reason:         "RangesUnderReplicated",
+			annotation:     "false",
+			maxUnavailable: 0,
+		},
+		{
+			name:           "replication is unknown",
+			ready:          3,
+			err:            errors.New("connection refused"),
+			status:         metav1.ConditionFalse,
+			reason:         "ReplicationUnknown",
+			annotation:     "false",
+			maxUnavailable: 0,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cr := testutil.NewBuilder("crdb").Namespaced("default").WithNodeCount(3).WithMaxUnavailable(&maxUnavailable).Cr()
+			cr.Spec.Eviction = &api.EvictionPolicy{SafeToEvict: true, HealthAwareBudget: true}
+			cluster := resource.NewCluster(cr)
+			objs := append([]runtime.Object{cr}, evictionTestPods(cr, tt.ready)...)
+			cl := fake.NewFakeClientWithScheme(scheme, objs...)
+
+			e := newEviction(scheme, cl, nil).(*eviction)
+			e.replication = func(context.Context, *resource.Cluster) (clustersql.Replication, error) {
+				return tt.replication, tt.err
+			}
+
+			err := e.Act(ctx, &cluster)
+			require.NoError(t, err)
+
+			condition := findCondition(&cluster, api.EvictionSafeCondition)
+			require.Equal(t, tt.status, condition.Status)
+			require.Equal(t, tt.reason, condition.Reason)
+
+			pods := &corev1.PodList{}
+			require.NoError(t, cl.List(ctx, pods, client.InNamespace("default")))
+			require.Len(t, pods.Items, 3)
+			for _, pod := range pods.Items {
+				require.Equal(t, tt.annotation, pod.Annotations[resource.SafeToEvictAnnotation], pod.Name)
+			}
+
+			pdb := &policy.PodDisruptionBudget{}
+			require.NoError(t, cl.Get(ctx, types.NamespacedName{Namespace: "default", Name: "crdb"}, pdb))
+			require.Nil(t, pdb.Spec.MinAvailable)
+			require.Equal(t, tt.maxUnavailable, pdb.Spec.MaxUnavailable.IntValue())
+		})
+	}
+}
+
+func TestEvictionRemovesAnnotations(t *testing.T) {
+	scheme := testutil.InitScheme(t)
+	ctx := context.Background()
+
+	cr := testutil.NewBuilder("crdb").Namespaced("default").WithNodeCount(3).Cr()
+	cluster := resource.NewCluster(cr)
+	cluster.SetCondition(api.EvictionSafeCondition, metav1.ConditionTrue, "FullyReplicated", "")
+	pods := evictionTestPods(cr, 3)
+	pods[0].(*corev1.Pod).Annotations = map[string]string{resource.SafeToEvictAnnotation: "false"}
+	cl := fake.NewFakeClientWithScheme(scheme, append([]runtime.Object{cr}, pods...)...)
+
+	// without a policy the cluster is not polled anymore
+	e := newEviction(scheme, cl, nil).(*eviction)
+	require.NoError(t, e.Act(ctx, &cluster))
+	require.Zero(t, e.PollInterval(&cluster))
+	require.Empty(t, findCondition(&cluster, api.EvictionSafeCondition).Type)
+
+	pod := &corev1.Pod{}
+	require.NoError(t, cl.Get(ctx, types.NamespacedName{Namespace: "default", Name: "crdb-0"}, pod))
+	require.NotContains(t, pod.Annotations, resource.SafeToEvictAnnotation)
+}
+
+// evictionTestPods returns three pods of the cluster, of which the given
+// number are ready.
+func evictionTestPods(cr *api.CrdbCluster, ready int) []runtime.Object {
+	selector := labels.Common(cr).Selector(cr.Spec.AdditionalLabels)
+
+	var pods []runtime.Object
+	for i := 0; i < 3; i++ {
+		status := corev1.ConditionFalse
+		if i < ready {
+			status = corev1.ConditionTrue
+		}
+		pods = append(pods, &corev1.Pod{
+			ObjectMeta: metav1.ObjectMeta{
+				Name:      fmt.Sprintf("%s-%d", cr.Name, i),
+				Namespace: cr.Namespace,
+				Labels:    selector,
+			},
+			Status: corev1.PodStatus{
+				Conditions: []corev1.PodCondition{{Type: corev1.PodReady, Status: status}},
+			},
+		})
+	}
+	return pods
+}
@@ -0,0 +1,253 @@
+/*
+Copyright 2021 The Cockroach Authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    https://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package actor
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+
+	api "github.com/cockroachdb/cockroach-operator/apis/v1alpha1"
+	"github.com/cockroachdb/cockroach-operator/pkg/labels"
+	"github.com/cockroachdb/cockroach-operator/pkg/resource"
+	"github.com/cockroachdb/cockroach-operator/pkg/security"
+	"github.com/cockroachdb/errors"
+	"github.com/go-logr/logr"
+	certv1 "k8s.io/api/certificates/v1"
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+// externalCAPollInterval is how often the actor checks whether the external CA
+// signed the certificates.
+const externalCAPollInterval = 30 * time.Second
+
+// externalCAProvider issues the certificates signed by the external CA of the
+// spec. The keys and the signing requests are kept in the CSR secret of the
+// cluster until all the certificates are signed, which takes several loops:
+// the provider returns security.ErrCertificatePending in the meantime. With a
+// signer name, the requests are submitted as Kubernetes
+// CertificateSigningRequests as well.
+type externalCAProvider struct {
+	client     client.Client
+	log        logr.Logger
+	cluster    *resource.Cluster
+	ca         []byte
+	signerName string
+}
+
+// NodeCertificate implements security.CertificateProvider.
+func (p *externalCAProvider) NodeCertificate(ctx context.Context, hosts []string) (*security.Certificate, error) {
+	usages := []certv1.KeyUsage{
+		certv1.UsageDigitalSignature,
+		certv1.UsageKeyEncipherment,
+		certv1.UsageServerAuth,
+		certv1.UsageClientAuth,
+	}
+	return p.issue(ctx, "node", "node", hosts, usages)
+}
+
+// ClientCertificate implements security.CertificateProvider.
+func (p *externalCAProvider) ClientCertificate(ctx context.Context, user security.SQLUsername) (*security.Certificate, error) {
+	usages := []certv1.KeyUsage{
+		certv1.UsageDigitalSignature,
+		certv1.UsageKeyEncipherment,
+		certv1.UsageClientAuth,
+	}
+	return p.issue(ctx, fmt.Sprintf("client.%s", user.U), user.U, nil, usages)
+}
+
+// issue returns the certificate signed for the request of the name, and
+// submits the request when there is none.
+func (p *externalCAProvider) issue(ctx context.Context, name, commonName string, hosts []string, usages []certv1.KeyUsage) (*security.Certificate, error) {
+	secret, err := p.csrSecret(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	key, csr := secret.Data[name+".key"], secret.Data[name+".csr"]
+	if len(key) == 0 || len(csr) == 0 {
+		if key, csr, err = security.CreateCSR(commonName, hosts); err != nil {
+			return nil, err
+		}
+		secret.Data[name+".key"] = key
+		secret.Data[name+".csr"] = csr
+		delete(secret.Data, name+".crt")
+		if err := p.saveCSRSecret(ctx, secret); err != nil {
+			return nil, err
+		}
+		if p.signerName != "" {
+			// a request left from a previous certificate has another key
+			if err := p.deleteRequest(ctx, name); err != nil {
+				return nil, err
+			}
+		}
+	}
+
+	cert, err := p.signed(ctx, name, secret, csr, usages)
+	if err != nil {
+		return nil, err
+	}
+	if len(cert) == 0 {
+		p.log.Info("waiting for the external CA to sign the certificate", "name", name)
+		return nil, security.ErrCertificatePending
+	}
+	if err := security.VerifyCertificate(cert, key, p.ca); err != nil {
+		return nil, errors.Wrapf(err, "invalid certificate signed for %s", name)
+	}
+
+	return &security.Certificate{Cert: cert, Key: key, CA: p.ca}, nil
+}
+
+// done forgets the requests once all the certificates are signed and saved,
+// so that the next certificates have new keys.
+func (p *externalCAProvider) done(ctx context.Context) error {
+	secret, err := p.csrSecret(ctx)
+	if err != nil || secret.ResourceVersion == "" {
+		return err
+	}
+
+	if p.signerName != "" {
+		for k := range secret.Data {
+			if name := strings.TrimSuffix(k, ".csr"); name != k {
+				if err := p.deleteRequest(ctx, name); err != nil {
+					return err
+				}
+			}
+		}
+	}
+
+	if err := p.client.Delete(ctx, secret); err != nil && !apierrors.IsNotFound(err) {
+		return errors.Wrapf(err, "failed to delete the secret %s", secret.Name)
+	}
+	return nil
+}
+
+// signed returns the certificate signed for the request of the name, or nil
+// until it is signed. Without a signer name, the certificate is written to the
+// CSR secret. Otherwise it is the certificate of the CertificateSigningRequest,
+// which is submitted when it does not exist.
+func (p *externalCAProvider) signed(ctx context.Context, name string, secret *corev1.Secret, csr []byte, usages []certv1.KeyUsage) ([]byte, error) {
+	if p.signerName == "" {
+		return secret.Data[name+".crt"], nil
+	}
+
+	request := &certv1.CertificateSigningRequest{}
+	err := p.client.Get(ctx, types.NamespacedName{Name: p.requestName(name)}, request)
+	if apierrors.IsNotFound(err) {
+		request = &certv1.CertificateSigningRequest{
+			ObjectMeta: metav1.ObjectMeta{
+				Name:   p.requestName(name),
+				Labels: labels.Common(p.cluster.Unwrap()).AsMap(),
+			},
+			Spec: certv1.CertificateSigningRequestSpec{
+				Request:    csr,
+				SignerName: p.signerName,
+				Usages:     usages,
+			},
+		}
+		if err := p.client.Create(ctx, request); err != nil {
+			return nil, errors.Wrapf(err, "failed to create the certificate signing request %s", request.Name)
+		}
+		p.log.Info("submitted the certificate signing request", "request", request.Name, "signer", p.signerName)
+		return nil, nil
+	} else if err != nil {
+		return nil, errors.Wrapf(err, "failed to get the certificate signing request %s", p.requestName(name))
+	}
+
+	for _, c := range request.Status.Conditions {
+		if (c.Type == certv1.CertificateDenied || c.Type == certv1.CertificateFailed) && c.Status == corev1.ConditionTrue {
+			return nil, errors.Newf("the certificate signing request %s is %s: %s", request.Name, c.Type, c.Message)
+		}
+	}
+	return request.Status.Certificate, nil
+}
+
+// csrSecret returns the CSR secret of the cluster, or a new one when it does
+// not exist yet.
+func (p *externalCAProvider) csrSecret(ctx context.Context) (*corev1.Secret, error) {
+	secret := &corev1.Secret{}
+	key := types.NamespacedName{Namespace: p.cluster.Namespace(), Name: p.cluster.CSRSecretName()}
+	if err := p.client.Get(ctx, key, secret); apierrors.IsNotFound(err) {
+		secret = &corev1.Secret{
+			ObjectMeta: metav1.ObjectMeta{
+				Namespace:   key.Namespace,
+				Name:        key.Name,
+				Labels:      labels.Propagated(p.cluster.Unwrap(), api.PropagateSecret).AsMap(),
+				Annotations: p.cluster.Spec().PropagatedAnnotations(api.PropagateSecret),
+			},
+		}
+	} else if err != nil {
+		return nil, errors.Wrapf(err, "failed to get the secret %s", key.Name)
+	}
+
+	if secret.Data == nil {
+		secret.Data = map[string][]byte{}
+	}
+	return secret, nil
+}
+
+// saveCSRSecret creates or updates the CSR secret of the cluster.
+func (p *externalCAProvider) saveCSRSecret(ctx context.Context, secret *corev1.Secret) error {
+	var err error
+	if secret.ResourceVersion == "" {
+		err = p.client.Create(ctx, secret)
+	} else {
+		err = p.client.Update(ctx, secret)
+	}
+	return errors.Wrapf(err, "failed to save the secret %s", secret.Name)
+}
+
+// deleteRequest deletes the CertificateSigningRequest of the name.
+func (p *externalCAProvider) deleteRequest(ctx context.Context, name string) error {
+	request := &certv1.CertificateSigningRequest{ObjectMeta: metav1.ObjectMeta{Name: p.requestName(name)}}
+	if err := p.client.Delete(ctx, request); err != nil && !apierrors.IsNotFound(err) {
+		return errors.Wrapf(err, "failed to delete the certificate signing request %s", request.Name)
+	}
+	return nil
+}
+
+// requestName returns the name of the CertificateSigningRequest of the name.
+// The requests are cluster scoped, so the name includes the namespace.
+func (p *externalCAProvider) requestName(name string) string {
+	return fmt.Sprintf("%s.%s.%s", p.cluster.Namespace(), p.cluster.Name(), name)
+}
+
+// newExternalCAProvider returns the provider of the certificates signed by the
+// external CA of the spec, which is trusted with the CA certificate of its
+// secret.
+func newExternalCAProvider(ctx context.Context, cl client.Client, log logr.Logger, cluster *resource.Cluster, external *api.ExternalCA) (*externalCAProvider, error) {
+	ca, ok, err := resource.SecretValue(ctx, cl, cluster.Namespace(), &external.CASecretRef)
+	if err != nil {
+		return nil, err
+	}
+	if !ok {
+		return nil, errors.Newf("the secret %s has no key %s with the certificate of the external CA", external.CASecretRef.Name, external.CASecretRef.Key)
+	}
+
+	return &externalCAProvider{
+		client:     cl,
+		log:        log,
+		cluster:    cluster,
+		ca:         []byte(ca),
+		signerName: external.SignerName,
+	}, nil
+}
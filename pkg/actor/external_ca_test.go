@@ -0,0 +1,133 @@
+/*
+Copyright 2021 The Cockroach Authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    https://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package actor
+
+import (
+	"context"
+	"testing"
+
+	api "github.com/cockroachdb/cockroach-operator/apis/v1alpha1"
+	"github.com/cockroachdb/cockroach-operator/pkg/resource"
+	"github.com/cockroachdb/cockroach-operator/pkg/security"
+	"github.com/cockroachdb/cockroach-operator/pkg/testutil"
+	"github.com/cockroachdb/errors"
+	"github.com/stretchr/testify/require"
+	certv1 "k8s.io/api/certificates/v1"
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+)
+
+func TestExternalCASecret(t *testing.T) {
+	ctx := context.Background()
+	ca, caKey := testutil.NewCA(t)
+	p, cl := newTestExternalCAProvider(t, ca, "")
+
+	_, err := p.NodeCertificate(ctx, []string{"localhost", "127.0.0.1"})
+	require.True(t, errors.Is(err, security.ErrCertificatePending), err)
+	_, err = p.ClientCertificate(ctx, security.SQLUsername{U: "root"})
+	require.True(t, errors.Is(err, security.ErrCertificatePending), err)
+
+	// the requests wait in the secret until the certificates are written there
+	secret := &corev1.Secret{}
+	key := types.NamespacedName{Namespace: "default", Name: "crdb-csr"}
+	require.NoError(t, cl.Get(ctx, key, secret))
+	for _, k := range []string{"node.key", "node.csr", "client.root.key", "client.root.csr"} {
+		require.Contains(t, secret.Data, k)
+	}
+	_, err = p.NodeCertificate(ctx, []string{"localhost", "127.0.0.1"})
+	require.True(t, errors.Is(err, security.ErrCertificatePending), err)
+
+	secret.Data["node.crt"] = testutil.SignCSR(t, secret.Data["node.csr"], ca, caKey)
+	require.NoError(t, cl.Update(ctx, secret))
+
+	node, err := p.NodeCertificate(ctx, []string{"localhost", "127.0.0.1"})
+	require.NoError(t, err)
+	require.Equal(t, secret.Data["node.crt"], node.Cert)
+	require.Equal(t, secret.Data["node.key"], node.Key)
+	require.Equal(t, ca, node.CA)
+
+	// a certificate of another key is rejected
+	secret.Data["client.root.crt"] = node.Cert
+	require.NoError(t, cl.Update(ctx, secret))
+	_, err = p.ClientCertificate(ctx, security.SQLUsername{U: "root"})
+	require.Error(t, err)
+	require.False(t, errors.Is(err, security.ErrCertificatePending))
+
+	require.NoError(t, p.done(ctx))
+	require.True(t, apierrors.IsNotFound(cl.Get(ctx, key, &corev1.Secret{})))
+}
+
+func TestExternalCASigner(t *testing.T) {
+	ctx := context.Background()
+	ca, caKey := testutil.NewCA(t)
+	p, cl := newTestExternalCAProvider(t, ca, "example.com/cockroachdb")
+
+	_, err := p.ClientCertificate(ctx, security.SQLUsername{U: "root"})
+	require.True(t, errors.Is(err, security.ErrCertificatePending), err)
+
+	request := &certv1.CertificateSigningRequest{}
+	key := types.NamespacedName{Name: "default.crdb.client.root"}
+	require.NoError(t, cl.Get(ctx, key, request))
+	require.Equal(t, "example.com/cockroachdb", request.Spec.SignerName)
+	require.Equal(t, []certv1.KeyUsage{certv1.UsageDigitalSignature, certv1.UsageKeyEncipherment, certv1.UsageClientAuth}, request.Spec.Usages)
+
+	request.Status.Certificate = testutil.SignCSR(t, request.Spec.Request, ca, caKey)
+	require.NoError(t, cl.Update(ctx, request))
+
+	root, err := p.ClientCertificate(ctx, security.SQLUsername{U: "root"})
+	require.NoError(t, err)
+	require.Equal(t, request.Status.Certificate, root.Cert)
+
+	require.NoError(t, p.done(ctx))
+	require.True(t, apierrors.IsNotFound(cl.Get(ctx, key, &certv1.CertificateSigningRequest{})))
+
+	// a denied request fails until it is deleted
+	_, err = p.ClientCertificate(ctx, security.SQLUsername{U: "root"})
+	require.True(t, errors.Is(err, security.ErrCertificatePending), err)
+	require.NoError(t, cl.Get(ctx, key, request))
+	request.Status.Conditions = []certv1.CertificateSigningRequestCondition{
+		{Type: certv1.CertificateDenied, Status: corev1.ConditionTrue, Message: "not allowed"},
+	}
+	require.NoError(t, cl.Update(ctx, request))
+
+	_, err = p.ClientCertificate(ctx, security.SQLUsername{U: "root"})
+	require.EqualError(t, err, "the certificate signing request default.crdb.client.root is Denied: not allowed")
+}
+
+func newTestExternalCAProvider(t *testing.T, ca []byte, signerName string) (*externalCAProvider, client.Client) {
+	cr := testutil.NewBuilder("crdb").Namespaced("default").WithNodeCount(3).WithTLS().Cr()
+	cr.Spec.ExternalCA = &api.ExternalCA{
+		CASecretRef: corev1.SecretKeySelector{
+			LocalObjectReference: corev1.LocalObjectReference{Name: "external-ca"},
+			Key:                  "ca.crt",
+		},
+		SignerName: signerName,
+	}
+	cluster := resource.NewCluster(cr)
+	cl := fake.NewFakeClientWithScheme(testutil.InitScheme(t), cr, &corev1.Secret{
+		ObjectMeta: metav1.ObjectMeta{Namespace: "default", Name: "external-ca"},
+		Data:       map[string][]byte{"ca.crt": ca},
+	})
+
+	p, err := newExternalCAProvider(context.Background(), cl, Log, &cluster, cr.Spec.ExternalCA)
+	require.NoError(t, err)
+	return p, cl
+}
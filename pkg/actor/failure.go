@@ -0,0 +1,65 @@
+/*
+Copyright 2021 The Cockroach Authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    https://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package actor
+
+import (
+	"context"
+
+	"github.com/cockroachdb/errors"
+	appsv1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/client-go/kubernetes"
+)
+
+// imagePullWaitingReasons are the reasons a container waits for when its image
+// cannot be pulled.
+var imagePullWaitingReasons = map[string]bool{
+	"ImagePullBackOff": true,
+	"ErrImagePull":     true,
+	"InvalidImageName": true,
+}
+
+// imagePullFailure returns an error naming the first pod with a container that
+// cannot pull its image, or nil if there is none.
+func imagePullFailure(pods []corev1.Pod) error {
+	for _, pod := range pods {
+		for _, status := range pod.Status.ContainerStatuses {
+			waiting := status.State.Waiting
+			if waiting != nil && imagePullWaitingReasons[waiting.Reason] {
+				return errors.Newf("pod %s cannot pull image %s: %s", pod.Name, status.Image, waiting.Message)
+			}
+		}
+	}
+
+	return nil
+}
+
+// statefulSetImagePullFailure is like imagePullFailure for the pods of the
+// statefulset. It returns nil when the pods cannot be listed, the caller has
+// an error to report already.
+func statefulSetImagePullFailure(ctx context.Context, clientset kubernetes.Interface, ss *appsv1.StatefulSet) error {
+	pods, err := clientset.CoreV1().Pods(ss.Namespace).List(ctx, metav1.ListOptions{
+		LabelSelector: labels.Set(ss.Spec.Selector.MatchLabels).AsSelector().String(),
+	})
+	if err != nil {
+		return nil
+	}
+
+	return imagePullFailure(pods.Items)
+}
@@ -0,0 +1,50 @@
+/*
+Copyright 2021 The Cockroach Authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    https://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package actor
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+func TestImagePullFailure(t *testing.T) {
+	pod := func(name string, waiting *corev1.ContainerStateWaiting) corev1.Pod {
+		return corev1.Pod{
+			ObjectMeta: metav1.ObjectMeta{Name: name},
+			Status: corev1.PodStatus{
+				ContainerStatuses: []corev1.ContainerStatus{{
+					Image: "cockroachdb/cockroach:v99.1.0",
+					State: corev1.ContainerState{Waiting: waiting},
+				}},
+			},
+		}
+	}
+
+	require.NoError(t, imagePullFailure([]corev1.Pod{
+		pod("crdb-0", nil),
+		pod("crdb-1", &corev1.ContainerStateWaiting{Reason: "ContainerCreating"}),
+	}))
+
+	err := imagePullFailure([]corev1.Pod{
+		pod("crdb-0", nil),
+		pod("crdb-1", &corev1.ContainerStateWaiting{Reason: "ImagePullBackOff", Message: "Back-off pulling image"}),
+	})
+	require.EqualError(t, err, "pod crdb-1 cannot pull image cockroachdb/cockroach:v99.1.0: Back-off pulling image")
+}
@@ -27,13 +27,16 @@ import (
 
 	api "github.com/cockroachdb/cockroach-operator/apis/v1alpha1"
 	"github.com/cockroachdb/cockroach-operator/pkg/kube"
+	"github.com/cockroachdb/cockroach-operator/pkg/labels"
 	"github.com/cockroachdb/cockroach-operator/pkg/resource"
 	"github.com/cockroachdb/cockroach-operator/pkg/security"
 	"github.com/cockroachdb/cockroach-operator/pkg/util"
 	"github.com/cockroachdb/errors"
 	"github.com/go-logr/logr"
+	corev1 "k8s.io/api/core/v1"
 	k8sErrors "k8s.io/apimachinery/pkg/api/errors"
 	"k8s.io/apimachinery/pkg/runtime"
+	kubetypes "k8s.io/apimachinery/pkg/types"
 	"k8s.io/client-go/rest"
 	"k8s.io/client-go/util/retry"
 	"sigs.k8s.io/controller-runtime/pkg/client"
@@ -46,6 +49,46 @@ var allowCAKeyReuse bool
 var overwriteFiles bool
 var generatePKCS8Key bool
 
+// createOperatorCA generates the CA of the operator, writing its certificate
+// to certsDir and its key at caKeyPath: with the cockroach binary, or with the
+// lifetime and the key of spec.tls when it is set.
+func createOperatorCA(tls *api.TLSConfig, certsDir, caKeyPath string, allowKeyReuse, overwrite bool) error {
+	if tls == nil {
+		return security.CreateCAPair(certsDir, caKeyPath, caCertificateLifetime, allowKeyReuse, overwrite)
+	}
+	return security.CreateCA(certsDir, caKeyPath, tls.CADurationOrDefault(), keySpec(tls))
+}
+
+// newOperatorCAProvider returns the provider of the certificates signed by the
+// CA of the operator, whose certificate is in certsDir and whose key is at
+// caKeyPath. The cockroach binary issues them, unless spec.tls sets their
+// lifetime and keys.
+func newOperatorCAProvider(tls *api.TLSConfig, certsDir, caKeyPath string) security.CertificateProvider {
+	if tls == nil {
+		return &security.CockroachProvider{
+			CertsDir:  certsDir,
+			CAKey:     caKeyPath,
+			Lifetime:  certificateLifetime,
+			Overwrite: overwriteFiles,
+			PKCS8Key:  generatePKCS8Key,
+		}
+	}
+	return &security.SignerProvider{
+		CertsDir: certsDir,
+		CAKey:    caKeyPath,
+		Lifetime: tls.CertDurationOrDefault(),
+		Key:      keySpec(tls),
+	}
+}
+
+// keySpec returns the private keys spec.tls calls for.
+func keySpec(tls *api.TLSConfig) security.KeySpec {
+	return security.KeySpec{
+		Algorithm: string(tls.KeyAlgorithmOrDefault()),
+		Size:      int(tls.KeySizeOrDefault()),
+	}
+}
+
 func newGenerateCert(scheme *runtime.Scheme, cl client.Client, config *rest.Config) Actor {
 
 	return &generateCert{
@@ -54,13 +97,17 @@ func newGenerateCert(scheme *runtime.Scheme, cl client.Client, config *rest.Conf
 	}
 }
 
-// generateCert issues node and root client certificates via Kubernetes cluster CA
+// generateCert issues node and root client certificates, signed by a CA the
+// operator generates or issued from the Vault PKI of the spec
 type generateCert struct {
 	action
 
 	config   *rest.Config
 	CertsDir string
 	CAKey    string
+	// rotate issues new node and client certificates, signed by the existing
+	// CA, even when they exist
+	rotate bool
 }
 
 //GetActionType returns api.RequestCertAction action used to set the cluster status errors
@@ -79,28 +126,105 @@ func (rc *generateCert) Act(ctx context.Context, cluster *resource.Cluster) erro
 		return nil
 	}
 
-	// create the various temporary directories to store the certficates in
-	// the directors will delete when the code is completed.
-	certsDir, cleanup := util.CreateTempDir("certsDir")
-	defer cleanup()
-	rc.CertsDir = certsDir
+	if cluster.Spec().VaultPKI != nil && cluster.Spec().ExternalCA != nil {
+		return ValidationError{Err: errors.New("vaultPKI and externalCA cannot be set together")}
+	}
+	if cluster.Spec().SplitCA != nil && (cluster.Spec().VaultPKI != nil || cluster.Spec().ExternalCA != nil) {
+		return ValidationError{Err: errors.New("splitCA requires the CAs of the operator, it cannot be set with vaultPKI or externalCA")}
+	}
+	if rc.rotate {
+		if err := checkSplitCAUnchanged(ctx, rc.client, cluster); err != nil {
+			return err
+		}
+	}
 
-	caDir, cleanupCADir := util.CreateTempDir("caDir")
-	defer cleanupCADir()
-	rc.CAKey = filepath.Join(caDir, "ca.key")
+	var provider security.CertificateProvider
+	// clientProvider issues the client certificates, signed by the client CA
+	// of a split-CA cluster
+	var clientProvider security.CertificateProvider
+	// done is called once all the certificates are saved
+	done := func(context.Context) error { return nil }
+	if vault := cluster.Spec().VaultPKI; vault != nil {
+		// the certificates are issued from Vault, there is no CA to generate
+		p, err := newVaultProvider(ctx, rc.client, cluster, vault)
+		if err != nil {
+			msg := "error configuring the Vault PKI"
+			log.Error(err, msg)
+			return FailureErr{Reason: api.CertErrorReason, Err: errors.Wrap(err, msg)}
+		}
+		provider = p
+	} else if external := cluster.Spec().ExternalCA; external != nil {
+		// the certificates are signed by the external CA, whose key is not here
+		p, err := newExternalCAProvider(ctx, rc.client, log, cluster, external)
+		if err != nil {
+			msg := "error configuring the external CA"
+			log.Error(err, msg)
+			return FailureErr{Reason: api.CertErrorReason, Err: errors.Wrap(err, msg)}
+		}
+		provider, done = p, p.done
+	} else {
+		// create the various temporary directories to store the certficates in
+		// the directors will delete when the code is completed.
+		certsDir, cleanup := util.CreateTempDir("certsDir")
+		defer cleanup()
+		rc.CertsDir = certsDir
+
+		caDir, cleanupCADir := util.CreateTempDir("caDir")
+		defer cleanupCADir()
+		rc.CAKey = filepath.Join(caDir, "ca.key")
+
+		tls := cluster.Spec().TLS
+		if tls != nil {
+			if err := tls.Validate(); err != nil {
+				return ValidationError{Err: errors.Wrap(err, "invalid tls")}
+			}
+		}
 
-	// generate the base CA cert and key
-	if err := rc.generateCA(ctx, log, cluster); err != nil {
-		msg := "error generating CA"
-		log.Error(err, msg)
-		return errors.Wrap(err, msg)
+		// generate the base CA cert and key
+		if err := rc.generateCA(ctx, log, cluster); err != nil {
+			// the other regions wait for the shared CA of the first region
+			var notReady NotReadyErr
+			if errors.As(err, &notReady) {
+				return err
+			}
+			msg := "error generating CA"
+			log.Error(err, msg)
+			return FailureErr{Reason: api.CertErrorReason, Err: errors.Wrap(err, msg)}
+		}
+		provider = newOperatorCAProvider(tls, rc.CertsDir, rc.CAKey)
+
+		if cluster.Spec().SplitCA != nil {
+			caCert, caKey, err := clientCA(ctx, rc.client, log, cluster)
+			if err != nil {
+				msg := "error getting the client CA"
+				log.Error(err, msg)
+				return FailureErr{Reason: api.CertErrorReason, Err: errors.Wrap(err, msg)}
+			}
+			p, cleanupClientCA, err := newCAProvider(tls, caCert, caKey)
+			if err != nil {
+				msg := "error configuring the client CA"
+				log.Error(err, msg)
+				return FailureErr{Reason: api.CertErrorReason, Err: errors.Wrap(err, msg)}
+			}
+			defer cleanupClientCA()
+			clientProvider = p
+		}
+	}
+	if clientProvider == nil {
+		clientProvider = provider
 	}
+
 	var expirationDatePtr *string
+	// the certificates signed by an external CA are requested together, and
+	// the actor waits until both are signed
+	pending := false
 	// generate the node certificate for the database to use
-	if expirationDate, err := rc.generateNodeCert(ctx, log, cluster); err != nil {
+	if expirationDate, err := rc.generateNodeCert(ctx, log, cluster, provider); errors.Is(err, security.ErrCertificatePending) {
+		pending = true
+	} else if err != nil {
 		msg := "error generating Node Certificate"
 		log.Error(err, msg)
-		return errors.Wrap(err, msg)
+		return FailureErr{Reason: api.CertErrorReason, Err: errors.Wrap(err, msg)}
 	} else {
 		expirationDatePtr = &expirationDate
 	}
@@ -109,9 +233,31 @@ func (rc *generateCert) Act(ctx context.Context, cluster *resource.Cluster) erro
 	// certificate should we delete the node secret?
 
 	// generate the client certificates for the database to use
-	if err := rc.generateClientCert(ctx, log, cluster); err != nil {
+	if err := rc.generateClientCert(ctx, log, cluster, clientProvider); errors.Is(err, security.ErrCertificatePending) {
+		pending = true
+	} else if err != nil {
 		msg := "error generating Client Certificate"
 		log.Error(err, msg)
+		return FailureErr{Reason: api.CertErrorReason, Err: errors.Wrap(err, msg)}
+	}
+
+	if cluster.Spec().SplitCA != nil {
+		if err := rc.generateNodeClientCert(ctx, log, cluster, clientProvider); err != nil {
+			msg := "error generating the client certificate of user node"
+			log.Error(err, msg)
+			return FailureErr{Reason: api.CertErrorReason, Err: errors.Wrap(err, msg)}
+		}
+	}
+
+	if pending {
+		return DeferredErr{
+			Err:          errors.New("waiting for the external CA to sign the certificates"),
+			RequeueAfter: externalCAPollInterval,
+		}
+	}
+	if err := done(ctx); err != nil {
+		msg := "error cleaning up the certificate signing requests"
+		log.Error(err, msg)
 		return errors.Wrap(err, msg)
 	}
 
@@ -197,6 +343,25 @@ func (rc *generateCert) Act(ctx context.Context, cluster *resource.Cluster) erro
 }
 
 func (rc *generateCert) generateCA(ctx context.Context, log logr.Logger, cluster *resource.Cluster) error {
+	// the node CA of the spec of a split-CA cluster is never generated
+	if split := cluster.Spec().SplitCA; split != nil && split.NodeCASecret != "" {
+		secret, err := loadCASecret(ctx, rc.client, cluster, split.NodeCASecret)
+		if err != nil {
+			return errors.Wrapf(err, "failed to get the node CA secret %s", split.NodeCASecret)
+		}
+		return writeCA(rc.CertsDir, rc.CAKey, secret.CA(), secret.CAKey())
+	}
+
+	// the regions of a multi-cluster deployment sign their certificates with
+	// the same CA, generated by the first region
+	if mc := cluster.Spec().MultiCluster; mc != nil && mc.CASecret != "" {
+		cert, key, err := sharedCA(ctx, rc.client, log, cluster)
+		if err != nil {
+			return err
+		}
+		return writeCA(rc.CertsDir, rc.CAKey, cert, key)
+	}
+
 	log.V(DEBUGLEVEL).Info("generating CA")
 	// load the secret.  If it exists don't update the cert
 	secret, err := resource.LoadTLSSecret(cluster.CASecretName(),
@@ -209,14 +374,17 @@ func (rc *generateCert) generateCA(ctx context.Context, log logr.Logger, cluster
 	// the Actor should have already generated the secret
 	if secret.ReadyCA() {
 		log.V(DEBUGLEVEL).Info("not updating ca key as it exists")
+		if rc.rotate {
+			return rc.loadCA(ctx, cluster, secret)
+		}
 		return nil
 	}
 
 	err = errors.Wrap(
-		security.CreateCAPair(
+		createOperatorCA(
+			cluster.Spec().TLS,
 			rc.CertsDir,
 			rc.CAKey,
-			caCertificateLifetime,
 			allowCAKeyReuse,
 			overwriteFiles),
 		"failed to generate CA cert and key")
@@ -231,7 +399,9 @@ func (rc *generateCert) generateCA(ctx context.Context, log logr.Logger, cluster
 
 	// create and save the TLS certificates into a secret
 	secret = resource.CreateTLSSecret(cluster.CASecretName(),
-		resource.NewKubeResource(ctx, rc.client, cluster.Namespace(), kube.DefaultPersister))
+		resource.NewKubeResource(ctx, rc.client, cluster.Namespace(), kube.DefaultPersister)).
+		WithLabels(labels.Propagated(cluster.Unwrap(), api.PropagateSecret)).
+		WithAnnotations(cluster.Spec().PropagatedAnnotations(api.PropagateSecret))
 
 	if err = secret.UpdateCAKey(cakey, log); err != nil {
 		return errors.Wrap(err, "failed to update ca key secret ")
@@ -241,6 +411,21 @@ func (rc *generateCert) generateCA(ctx context.Context, log logr.Logger, cluster
 	return nil
 }
 
+// loadCA writes the key of the existing CA and its certificate, taken from the
+// node secret, where the node and client certificates are signed with them.
+func (rc *generateCert) loadCA(ctx context.Context, cluster *resource.Cluster, caSecret *resource.TLSSecret) error {
+	node, err := resource.LoadTLSSecret(cluster.NodeTLSSecretName(),
+		resource.NewKubeResource(ctx, rc.client, cluster.Namespace(), kube.DefaultPersister))
+	if err != nil {
+		return errors.Wrap(err, "failed to get node TLS secret")
+	}
+	if len(node.CA()) == 0 {
+		return errors.New("the node TLS secret has no CA certificate")
+	}
+
+	return writeCA(rc.CertsDir, rc.CAKey, node.CA(), caSecret.CAKey())
+}
+
 // TODO we have an edge case that exists that the actor is not handling properly
 // If any errors occurs and we have save secrets we may need to delete the secrets
 // We can get into a race condition where the Node certifcate was created, but the Client certificate was not.
@@ -248,7 +433,7 @@ func (rc *generateCert) generateCA(ctx context.Context, log logr.Logger, cluster
 // This time a new CA is generated, the Node secret is not updated, but the client certicate is generated
 // using a new CA.
 
-func (rc *generateCert) generateNodeCert(ctx context.Context, log logr.Logger, cluster *resource.Cluster) (string, error) {
+func (rc *generateCert) generateNodeCert(ctx context.Context, log logr.Logger, cluster *resource.Cluster, provider security.CertificateProvider) (string, error) {
 	log.V(DEBUGLEVEL).Info("generating node certificate")
 
 	// load the secret.  If it exists don't update the cert
@@ -260,52 +445,15 @@ func (rc *generateCert) generateNodeCert(ctx context.Context, log logr.Logger, c
 
 	// if the secret is ready then don't update the secret
 	// the Actor should have already generated the secret
-	if secret.Ready() {
+	if secret.Ready() && !rc.rotate {
 		log.V(DEBUGLEVEL).Info("not updating node certificate as it exists")
 		return rc.getCertificateExpirationDate(ctx, log, secret.Key())
 	}
 
-	// hosts are the various DNS names and IP address that have to exist in the Node certificates
-	// for the database to function
-	hosts := []string{
-		"localhost",
-		"127.0.0.1",
-		cluster.PublicServiceName(),
-		fmt.Sprintf("%s.%s", cluster.PublicServiceName(), cluster.Namespace()),
-		fmt.Sprintf("%s.%s.%s", cluster.PublicServiceName(), cluster.Namespace(), cluster.Domain()),
-		fmt.Sprintf("*.%s", cluster.DiscoveryServiceName()),
-		fmt.Sprintf("*.%s.%s", cluster.DiscoveryServiceName(), cluster.Namespace()),
-		fmt.Sprintf("*.%s.%s.%s", cluster.DiscoveryServiceName(), cluster.Namespace(), cluster.Domain()),
-	}
-
 	// create the Node Pair certificates
-	err = errors.Wrap(
-		security.CreateNodePair(
-			rc.CertsDir,
-			rc.CAKey,
-			certificateLifetime,
-			overwriteFiles,
-			hosts),
-		"failed to generate node certificate and key")
-
+	node, err := provider.NodeCertificate(ctx, nodeCertHosts(cluster))
 	if err != nil {
-		return "", err
-	}
-
-	// Read the node certificates into memory
-	ca, err := ioutil.ReadFile(filepath.Join(rc.CertsDir, "ca.crt"))
-	if err != nil {
-		return "", errors.Wrap(err, "unable to read ca.crt")
-	}
-
-	pemCert, err := ioutil.ReadFile(filepath.Join(rc.CertsDir, "node.crt"))
-	if err != nil {
-		return "", errors.Wrap(err, "unable to read node.crt")
-	}
-
-	pemKey, err := ioutil.ReadFile(filepath.Join(rc.CertsDir, "node.key"))
-	if err != nil {
-		return "", errors.Wrap(err, "unable to ready node.key")
+		return "", errors.Wrap(err, "failed to generate node certificate and key")
 	}
 
 	// TODO we are not using the TLS secret type, but are using Opaque secrets.
@@ -313,17 +461,47 @@ func (rc *generateCert) generateNodeCert(ctx context.Context, log logr.Logger, c
 
 	// create and save the TLS certificates into a secret
 	secret = resource.CreateTLSSecret(cluster.NodeTLSSecretName(),
-		resource.NewKubeResource(ctx, rc.client, cluster.Namespace(), kube.DefaultPersister))
+		resource.NewKubeResource(ctx, rc.client, cluster.Namespace(), kube.DefaultPersister)).
+		WithLabels(labels.Propagated(cluster.Unwrap(), api.PropagateSecret)).
+		WithAnnotations(cluster.Spec().PropagatedAnnotations(api.PropagateSecret))
 
-	if err = secret.UpdateCertAndKeyAndCA(pemCert, pemKey, ca, log); err != nil {
+	if err = secret.UpdateCertAndKeyAndCA(node.Cert, node.Key, node.CA, log); err != nil {
 		return "", errors.Wrap(err, "failed to update node TLS secret certs")
 	}
 
 	log.V(DEBUGLEVEL).Info("generated and saved node certificate and key")
-	return rc.getCertificateExpirationDate(ctx, log, pemCert)
+	return rc.getCertificateExpirationDate(ctx, log, node.Cert)
+}
+
+// nodeCertHosts returns the various DNS names and IP address that have to exist
+// in the Node certificates for the database to function
+func nodeCertHosts(cluster *resource.Cluster) []string {
+	hosts := []string{
+		"localhost",
+		"127.0.0.1",
+		cluster.PublicServiceName(),
+		fmt.Sprintf("%s.%s", cluster.PublicServiceName(), cluster.Namespace()),
+		fmt.Sprintf("%s.%s.%s", cluster.PublicServiceName(), cluster.Namespace(), cluster.Domain()),
+		fmt.Sprintf("*.%s", cluster.DiscoveryServiceName()),
+		fmt.Sprintf("*.%s.%s", cluster.DiscoveryServiceName(), cluster.Namespace()),
+		fmt.Sprintf("*.%s.%s.%s", cluster.DiscoveryServiceName(), cluster.Namespace(), cluster.Domain()),
+	}
+	// the addresses the nodes advertise to the nodes outside the cluster
+	if network := cluster.Spec().Network; network != nil {
+		seen := map[string]bool{}
+		for _, host := range hosts {
+			seen[host] = true
+		}
+		for _, host := range network.CertHosts() {
+			if !seen[host] {
+				hosts = append(hosts, host)
+			}
+		}
+	}
+	return hosts
 }
 
-func (rc *generateCert) generateClientCert(ctx context.Context, log logr.Logger, cluster *resource.Cluster) error {
+func (rc *generateCert) generateClientCert(ctx context.Context, log logr.Logger, cluster *resource.Cluster, provider security.CertificateProvider) error {
 	log.V(DEBUGLEVEL).Info("generating client certificate")
 
 	// load the secret.  If it exists don't update the cert
@@ -336,7 +514,7 @@ func (rc *generateCert) generateClientCert(ctx context.Context, log logr.Logger,
 	// if the secret is ready then don't update the secret
 	// the Actor should have already generated the secret
 	//but we should read the expiration date
-	if secret.Ready() {
+	if secret.Ready() && !rc.rotate {
 		log.V(DEBUGLEVEL).Info("not updating client certificate")
 		return nil
 	}
@@ -347,47 +525,101 @@ func (rc *generateCert) generateClientCert(ctx context.Context, log logr.Logger,
 	}
 
 	// Create the client certificates
-	err = errors.Wrap(
-		security.CreateClientPair(
-			rc.CertsDir,
-			rc.CAKey,
-			certificateLifetime,
-			overwriteFiles,
-			*u,
-			generatePKCS8Key),
-		"failed to generate client certificate and key")
+	clientCert, err := provider.ClientCertificate(ctx, *u)
 	if err != nil {
-		return err
+		return errors.Wrap(err, "failed to generate client certificate and key")
 	}
 
-	// Load the certificates into memory
-	ca, err := ioutil.ReadFile(filepath.Join(rc.CertsDir, "ca.crt"))
-	if err != nil {
-		return errors.Wrap(err, "unable to read ca.crt")
+	// the clients of a split-CA cluster verify the nodes with the node CA
+	ca := clientCert.CA
+	if cluster.Spec().SplitCA != nil {
+		node, err := resource.LoadTLSSecret(cluster.NodeTLSSecretName(),
+			resource.NewKubeResource(ctx, rc.client, cluster.Namespace(), kube.DefaultPersister))
+		if err != nil {
+			return errors.Wrap(err, "failed to get node TLS secret")
+		}
+		ca = node.CA()
 	}
 
-	pemCert, err := ioutil.ReadFile(filepath.Join(rc.CertsDir, "client.root.crt"))
-	if err != nil {
-		return errors.Wrap(err, "unable to read client.root.crt")
+	// create and save the TLS certificates into a secret
+	secret = resource.CreateTLSSecret(cluster.ClientTLSSecretName(),
+		resource.NewKubeResource(ctx, rc.client, cluster.Namespace(), kube.DefaultPersister)).
+		WithLabels(labels.Propagated(cluster.Unwrap(), api.PropagateSecret)).
+		WithAnnotations(cluster.Spec().PropagatedAnnotations(api.PropagateSecret))
+
+	if err = secret.UpdateCertAndKeyAndCA(clientCert.Cert, clientCert.Key, ca, log); err != nil {
+		return errors.Wrap(err, "failed to update client TLS secret certs")
 	}
 
-	pemKey, err := ioutil.ReadFile(filepath.Join(rc.CertsDir, "client.root.key"))
+	log.V(DEBUGLEVEL).Info("generated and saved client certificate and key")
+	return nil
+}
+
+// generateNodeClientCert issues the client certificate of user node of a
+// split-CA cluster, which the nodes connect to each other with. The secret
+// holds the certificate of the client CA that signs it.
+func (rc *generateCert) generateNodeClientCert(ctx context.Context, log logr.Logger, cluster *resource.Cluster, provider security.CertificateProvider) error {
+	log.V(DEBUGLEVEL).Info("generating the client certificate of user node")
+
+	secret, err := resource.LoadTLSSecret(cluster.NodeClientTLSSecretName(),
+		resource.NewKubeResource(ctx, rc.client, cluster.Namespace(), kube.DefaultPersister))
+	if kube.IgnoreNotFound(err) != nil {
+		return errors.Wrap(err, "failed to get the node client TLS secret")
+	}
+	if secret.Ready() && !rc.rotate {
+		log.V(DEBUGLEVEL).Info("not updating the client certificate of user node")
+		return nil
+	}
+
+	cert, err := provider.ClientCertificate(ctx, security.SQLUsername{U: "node"})
 	if err != nil {
-		return errors.Wrap(err, "unable to read client.root.key")
+		return errors.Wrap(err, "failed to generate client certificate and key")
 	}
 
-	// create and save the TLS certificates into a secret
-	secret = resource.CreateTLSSecret(cluster.ClientTLSSecretName(),
-		resource.NewKubeResource(ctx, rc.client, cluster.Namespace(), kube.DefaultPersister))
+	secret = resource.CreateTLSSecret(cluster.NodeClientTLSSecretName(),
+		resource.NewKubeResource(ctx, rc.client, cluster.Namespace(), kube.DefaultPersister)).
+		WithLabels(labels.Propagated(cluster.Unwrap(), api.PropagateSecret)).
+		WithAnnotations(cluster.Spec().PropagatedAnnotations(api.PropagateSecret))
 
-	if err = secret.UpdateCertAndKeyAndCA(pemCert, pemKey, ca, log); err != nil {
-		return errors.Wrap(err, "failed to update client TLS secret certs")
+	if err = secret.UpdateCertAndKeyAndCA(cert.Cert, cert.Key, cert.CA, log); err != nil {
+		return errors.Wrap(err, "failed to update the node client TLS secret certs")
 	}
 
-	log.V(DEBUGLEVEL).Info("generated and saved client certificate and key")
+	log.V(DEBUGLEVEL).Info("generated and saved the client certificate of user node")
 	return nil
 }
 
+// newVaultProvider returns the provider of the certificates issued by the Vault
+// PKI of the spec, which trusts the CA certificate of its secret.
+func newVaultProvider(ctx context.Context, cl client.Client, cluster *resource.Cluster, vault *api.VaultPKI) (*security.VaultProvider, error) {
+	config := security.VaultConfig{
+		Address:    vault.Address,
+		AuthPath:   vault.AuthPathOrDefault(),
+		Role:       vault.Role,
+		PKIPath:    vault.PKIPathOrDefault(),
+		NodeRole:   vault.NodeRole,
+		ClientRole: vault.ClientRoleOrDefault(),
+	}
+	if vault.TTL != nil {
+		config.TTL = vault.TTL.Duration
+	}
+
+	if ref := vault.CASecretRef; ref != nil {
+		secret := &corev1.Secret{}
+		key := kubetypes.NamespacedName{Namespace: cluster.Namespace(), Name: ref.Name}
+		if err := cl.Get(ctx, key, secret); err != nil {
+			return nil, errors.Wrapf(err, "failed to get the CA secret %s of the Vault server", ref.Name)
+		}
+		ca, ok := secret.Data[ref.Key]
+		if !ok {
+			return nil, errors.Newf("the CA secret %s of the Vault server has no key %s", ref.Name, ref.Key)
+		}
+		config.CACert = ca
+	}
+
+	return security.NewVaultProvider(config)
+}
+
 func (rc *generateCert) getCertificateExpirationDate(ctx context.Context, log logr.Logger, pemCert []byte) (string, error) {
 	log.V(DEBUGLEVEL).Info("getExpirationDate from cert")
 	block, _ := pem.Decode(pemCert)
@@ -0,0 +1,43 @@
+/*
+Copyright 2021 The Cockroach Authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    https://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package actor
+
+import (
+	"testing"
+
+	api "github.com/cockroachdb/cockroach-operator/apis/v1alpha1"
+	"github.com/cockroachdb/cockroach-operator/pkg/resource"
+	"github.com/cockroachdb/cockroach-operator/pkg/testutil"
+	"github.com/stretchr/testify/require"
+)
+
+func TestNodeCertHosts(t *testing.T) {
+	cr := testutil.NewBuilder("crdb").Namespaced("default").WithNodeCount(3).WithTLS().Cr()
+	cluster := resource.NewCluster(cr)
+	hosts := nodeCertHosts(&cluster)
+	require.Contains(t, hosts, "crdb-public.default")
+	require.Contains(t, hosts, "*.crdb.default")
+
+	cr.Spec.Network = &api.NetworkSettings{
+		AdvertiseAddr: "$(POD_NAME).east.db.example.com:26258",
+		LocalityAdvertiseAddrs: []api.LocalityAdvertiseAddr{
+			{Locality: "region=us-east1", Addr: "$(POD_NAME).crdb.default:26258"},
+		},
+	}
+	cluster = resource.NewCluster(cr)
+	require.Equal(t, append(hosts, "*.east.db.example.com"), nodeCertHosts(&cluster))
+}
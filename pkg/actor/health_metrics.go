@@ -0,0 +1,141 @@
+/*
+Copyright 2021 The Cockroach Authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    https://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package actor
+
+import (
+	"context"
+	"time"
+
+	api "github.com/cockroachdb/cockroach-operator/apis/v1alpha1"
+	"github.com/cockroachdb/cockroach-operator/pkg/clustersql"
+	"github.com/cockroachdb/cockroach-operator/pkg/metrics"
+	"github.com/cockroachdb/cockroach-operator/pkg/resource"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/client-go/rest"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+func newHealthMetrics(scheme *runtime.Scheme, cl client.Client, config *rest.Config) Actor {
+	m := &healthMetrics{
+		action: newAction("healthMetrics", scheme, cl),
+		config: config,
+		now:    time.Now,
+	}
+	m.scrape = m.clusterHealth
+	return m
+}
+
+// healthScrape is what the operator reads from the SQL interface of a cluster
+// to summarize its health.
+type healthScrape struct {
+	nodes              []clustersql.Node
+	timeUntilStoreDead time.Duration
+	stores             []clustersql.Store
+	replication        clustersql.Replication
+}
+
+// healthMetrics polls the liveness of the nodes, the replication of the ranges
+// and the capacity of the stores, and exports them as metrics of the operator
+// for the platforms that do not scrape each cluster
+type healthMetrics struct {
+	action
+
+	config *rest.Config
+	now    func() time.Time
+	// scrape reads the health of the cluster from its SQL interface
+	scrape func(ctx context.Context, cluster *resource.Cluster) (healthScrape, error)
+}
+
+//GetActionType returns api.HealthMetricsAction used to set the cluster status errors
+func (m healthMetrics) GetActionType() api.ActionType {
+	return api.HealthMetricsAction
+}
+
+func (m healthMetrics) Act(ctx context.Context, cluster *resource.Cluster) error {
+	log := m.log.WithValues("CrdbCluster", cluster.ObjectKey())
+	log.V(DEBUGLEVEL).Info("scraping the health of the cluster")
+
+	scrape, err := m.scrape(ctx, cluster)
+	if err != nil {
+		log.Error(err, "failed to scrape the health of the cluster")
+		metrics.SetHealthUnknown(cluster.Namespace(), cluster.Name())
+		return nil
+	}
+
+	metrics.SetHealth(cluster.Namespace(), cluster.Name(), summarizeHealth(scrape, m.now()))
+	return nil
+}
+
+// PollInterval returns how often the cluster is scraped, which is as stale as
+// the exported metrics get.
+func (m healthMetrics) PollInterval(*resource.Cluster) time.Duration {
+	return pollInterval
+}
+
+// summarizeHealth counts the nodes by liveness and sums the capacity of the
+// stores.
+func summarizeHealth(scrape healthScrape, now time.Time) metrics.ClusterHealth {
+	dead, suspect := clustersql.UnavailableNodes(scrape.nodes, scrape.timeUntilStoreDead, now)
+	health := metrics.ClusterHealth{
+		SuspectNodes:          len(suspect),
+		DeadNodes:             len(dead),
+		UnderReplicatedRanges: scrape.replication.UnderReplicated,
+		UnavailableRanges:     scrape.replication.Unavailable,
+	}
+
+	for _, n := range scrape.nodes {
+		switch {
+		case n.Decommissioning:
+			health.DecommissioningNodes++
+		case n.IsLive:
+			health.LiveNodes++
+		}
+	}
+
+	for _, s := range scrape.stores {
+		health.CapacityBytes += s.Capacity
+		health.AvailableBytes += s.Available
+		health.UsedBytes += s.Used
+	}
+	return health
+}
+
+// clusterHealth reads the nodes with their liveness, the time until store dead
+// setting, the capacity of the stores and the replication of the ranges.
+func (m healthMetrics) clusterHealth(ctx context.Context, cluster *resource.Cluster) (healthScrape, error) {
+	var scrape healthScrape
+
+	db, err := openDatabase(ctx, m.client, m.config, cluster)
+	if err != nil {
+		return scrape, err
+	}
+	defer db.Close()
+
+	if scrape.nodes, err = clustersql.Nodes(ctx, db); err != nil {
+		return scrape, err
+	}
+	if scrape.timeUntilStoreDead, err = clustersql.TimeUntilStoreDead(ctx, db); err != nil {
+		return scrape, err
+	}
+	if scrape.stores, err = clustersql.Stores(ctx, db); err != nil {
+		return scrape, err
+	}
+	if scrape.replication, err = clustersql.ReplicationStatus(ctx, db); err != nil {
+		return scrape, err
+	}
+	return scrape, nil
+}
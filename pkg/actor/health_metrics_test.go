@@ -0,0 +1,81 @@
+/*
+Copyright 2021 The Cockroach Authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    https://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package actor
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/cockroachdb/cockroach-operator/pkg/clustersql"
+	"github.com/cockroachdb/cockroach-operator/pkg/metrics"
+	"github.com/cockroachdb/cockroach-operator/pkg/resource"
+	"github.com/cockroachdb/cockroach-operator/pkg/testutil"
+	"github.com/cockroachdb/errors"
+	"github.com/stretchr/testify/require"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+)
+
+func TestSummarizeHealth(t *testing.T) {
+	now := time.Date(2021, time.June, 2, 20, 30, 0, 0, time.UTC)
+
+	health := summarizeHealth(healthScrape{
+		nodes: []clustersql.Node{
+			{ID: 1, IsLive: true},
+			{ID: 2, IsLive: true},
+			{ID: 3, LivenessUpdatedAt: now.Add(-time.Minute)},
+			{ID: 4, LivenessUpdatedAt: now.Add(-time.Hour)},
+			{ID: 5, IsLive: true, Decommissioning: true},
+		},
+		timeUntilStoreDead: 5 * time.Minute,
+		stores: []clustersql.Store{
+			{NodeID: 1, StoreID: 1, Capacity: 100, Available: 60, Used: 30},
+			{NodeID: 2, StoreID: 2, Capacity: 100, Available: 50, Used: 40},
+		},
+		replication: clustersql.Replication{UnderReplicated: 7, Unavailable: 1},
+	}, now)
+
+	require.Equal(t, metrics.ClusterHealth{
+		LiveNodes:             2,
+		SuspectNodes:          1,
+		DeadNodes:             1,
+		DecommissioningNodes:  1,
+		UnderReplicatedRanges: 7,
+		UnavailableRanges:     1,
+		CapacityBytes:         200,
+		AvailableBytes:        110,
+		UsedBytes:             70,
+	}, health)
+}
+
+func TestHealthMetricsPolls(t *testing.T) {
+	scheme := testutil.InitScheme(t)
+	cr := testutil.NewBuilder("crdb").Namespaced("default").WithNodeCount(3).Cr()
+	cluster := resource.NewCluster(cr)
+	cl := fake.NewFakeClientWithScheme(scheme, cr)
+	defer metrics.DeleteCluster("default", "crdb")
+
+	m := newHealthMetrics(scheme, cl, nil).(*healthMetrics)
+	for _, scrapeErr := range []error{nil, errors.New("connection refused")} {
+		m.scrape = func(context.Context, *resource.Cluster) (healthScrape, error) {
+			return healthScrape{}, scrapeErr
+		}
+
+		err := m.Act(context.Background(), &cluster)
+		require.NoError(t, err)
+	}
+}
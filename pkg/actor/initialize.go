@@ -21,6 +21,7 @@ import (
 	"fmt"
 	"strconv"
 	"strings"
+	"time"
 
 	api "github.com/cockroachdb/cockroach-operator/apis/v1alpha1"
 	"github.com/cockroachdb/cockroach-operator/pkg/kube"
@@ -37,6 +38,10 @@ import (
 	"sigs.k8s.io/controller-runtime/pkg/client"
 )
 
+// initTimeout is how long the first pod has to start before the cluster
+// initialization fails.
+const initTimeout = 10 * time.Minute
+
 func newInitialize(scheme *runtime.Scheme, cl client.Client, config *rest.Config) Actor {
 	return &initialize{
 		action: newAction("initialize", scheme, cl),
@@ -89,18 +94,33 @@ func (init initialize) Act(ctx context.Context, cluster *resource.Cluster) error
 		return errors.Wrap(err, msg)
 	}
 
+	if err := imagePullFailure(pods.Items); err != nil {
+		return FailureErr{Reason: api.ImagePullBackOffReason, Err: err}
+	}
+
 	if len(pods.Items) == 0 {
-		return NotReadyErr{Err: errors.New("pod not created")}
+		return init.notReady(ss, "pod not created")
 	}
 
 	phase := pods.Items[0].Status.Phase
 	podName := pods.Items[0].Name
 	if phase != corev1.PodRunning {
-		return NotReadyErr{Err: errors.New("pod is not running")}
+		return init.notReady(ss, "pod is not running")
 	}
 
 	log.V(DEBUGLEVEL).Info("Pod is ready")
 
+	// the nodes of the other regions of a multi-cluster deployment join the
+	// cluster the first region initialized, an init would start another one
+	if mc := cluster.Spec().MultiCluster; mc != nil && !mc.IsFirstRegion() {
+		if !kube.IsPodReady(&pods.Items[0]) {
+			return NotReadyErr{Err: errors.Newf("pod %s has not joined the cluster of region %s", podName, mc.FirstRegion())}
+		}
+		cluster.SetTrue(api.InitializedCondition)
+		log.V(DEBUGLEVEL).Info("joined the cluster of the first region", "region", mc.FirstRegion())
+		return nil
+	}
+
 	port := strconv.FormatInt(int64(*cluster.Spec().GRPCPort), 10)
 	cmd := []string{
 		"/cockroach/cockroach.sh",
@@ -108,6 +128,11 @@ func (init initialize) Act(ctx context.Context, cluster *resource.Cluster) error
 		cluster.SecureMode(),
 		"--host=localhost:" + port,
 	}
+	// a standby cluster starts without a virtual cluster for the application
+	// data, which the replication stream creates
+	if cluster.Spec().Replication != nil {
+		cmd = append(cmd, "--virtualized-empty")
+	}
 
 	log.V(DEBUGLEVEL).Info(fmt.Sprintf("Executing init in pod %s with phase %s", podName, phase))
 	_, stderr, err := kube.ExecInPod(init.scheme, init.config, cluster.Namespace(),
@@ -119,7 +144,7 @@ func (init initialize) Act(ctx context.Context, cluster *resource.Cluster) error
 		if strings.Contains(err.Error(), "unable to upgrade connection: container not found") ||
 			strings.Contains(err.Error(), "does not have a host assigned") {
 			log.V(DEBUGLEVEL).Info("pod has not completely started")
-			return NotReadyErr{Err: errors.New("pod has not completely started")}
+			return init.notReady(ss, "pod has not completely started")
 		}
 
 		msg := "failed to initialize the cluster"
@@ -133,6 +158,19 @@ func (init initialize) Act(ctx context.Context, cluster *resource.Cluster) error
 	return nil
 }
 
+// notReady returns a NotReadyErr with the given message, or a FailureErr if
+// the statefulset was created more than initTimeout ago.
+func (init initialize) notReady(ss *appsv1.StatefulSet, msg string) error {
+	if age := time.Since(ss.CreationTimestamp.Time); age > initTimeout {
+		return FailureErr{
+			Reason: api.InitTimeoutReason,
+			Err:    errors.Newf("%s %s after the creation of the statefulset", msg, age.Round(time.Second)),
+		}
+	}
+
+	return NotReadyErr{Err: errors.New(msg)}
+}
+
 func alreadyInitialized(out string) bool {
 	return strings.Contains(out, "cluster has already been initialized")
 }
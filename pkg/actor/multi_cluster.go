@@ -0,0 +1,94 @@
+/*
+Copyright 2021 The Cockroach Authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    https://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package actor
+
+import (
+	"context"
+	"database/sql"
+
+	"github.com/Masterminds/semver/v3"
+	api "github.com/cockroachdb/cockroach-operator/apis/v1alpha1"
+	"github.com/cockroachdb/cockroach-operator/pkg/clustersql"
+	"github.com/cockroachdb/cockroach-operator/pkg/kube"
+	"github.com/cockroachdb/cockroach-operator/pkg/labels"
+	"github.com/cockroachdb/cockroach-operator/pkg/resource"
+	"github.com/cockroachdb/errors"
+	"github.com/go-logr/logr"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+// sharedCA returns the certificate and the key of the CA shared by the regions
+// of a multi-cluster deployment. The first region generates the CA the first
+// time, the secret is then copied to the Kubernetes clusters of the other
+// regions.
+func sharedCA(ctx context.Context, cl client.Client, log logr.Logger, cluster *resource.Cluster) ([]byte, []byte, error) {
+	mc := cluster.Spec().MultiCluster
+	secret, err := loadCASecret(ctx, cl, cluster, mc.CASecret)
+	if err == nil {
+		return secret.CA(), secret.CAKey(), nil
+	}
+	if !apierrors.IsNotFound(err) {
+		return nil, nil, errors.Wrapf(err, "failed to get the shared CA secret %s", mc.CASecret)
+	}
+	if !mc.IsFirstRegion() {
+		return nil, nil, NotReadyErr{Err: errors.Newf("waiting for the shared CA secret %s of region %s to be copied", mc.CASecret, mc.FirstRegion())}
+	}
+
+	cert, key, err := createCA(cluster.Spec().TLS)
+	if err != nil {
+		return nil, nil, errors.Wrap(err, "failed to generate the shared CA")
+	}
+	secret = resource.CreateTLSSecret(mc.CASecret, resource.NewKubeResource(ctx, cl, cluster.Namespace(), kube.DefaultPersister)).
+		WithLabels(labels.Propagated(cluster.Unwrap(), api.PropagateSecret)).
+		WithAnnotations(cluster.Spec().PropagatedAnnotations(api.PropagateSecret))
+	if err := secret.UpdateCAKeyAndCA(key, cert, log); err != nil {
+		return nil, nil, errors.Wrap(err, "failed to save the shared CA")
+	}
+	log.Info("generated the shared CA, copy its secret to the other regions", "secret", mc.CASecret)
+	return cert, key, nil
+}
+
+// checkRegionsUpgraded holds the upgrade of a region of a multi-cluster
+// deployment to version until the nodes of the regions before it run it, so
+// that the regions are upgraded one at a time and in order.
+func checkRegionsUpgraded(ctx context.Context, cluster *resource.Cluster, db *sql.DB, version *semver.Version) error {
+	before := cluster.Spec().MultiCluster.RegionsBefore()
+	if len(before) == 0 {
+		return nil
+	}
+
+	builds, err := clustersql.RegionBuilds(ctx, db)
+	if err != nil {
+		return err
+	}
+	for _, region := range before {
+		upgraded := 0
+		for _, tag := range builds[region.Name] {
+			if v, err := semver.NewVersion(tag); err == nil && !v.LessThan(version) {
+				upgraded++
+			}
+		}
+		if upgraded < int(region.Nodes) {
+			return DeferredErr{
+				Err:          errors.Newf("waiting for region %s to run %s, %d of its %d nodes do", region.Name, version.Original(), upgraded, region.Nodes),
+				RequeueAfter: finalizeInterval,
+			}
+		}
+	}
+	return nil
+}
@@ -0,0 +1,119 @@
+/*
+Copyright 2021 The Cockroach Authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    https://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package actor
+
+import (
+	"context"
+	"regexp"
+	"testing"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/Masterminds/semver/v3"
+	api "github.com/cockroachdb/cockroach-operator/apis/v1alpha1"
+	"github.com/cockroachdb/cockroach-operator/pkg/resource"
+	"github.com/cockroachdb/cockroach-operator/pkg/testutil"
+	"github.com/stretchr/testify/require"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+)
+
+func multiClusterCr(name, region string) *api.CrdbCluster {
+	cr := testutil.NewBuilder(name).Namespaced("default").WithNodeCount(3).WithTLS().Cr()
+	cr.Spec.TLS = &api.TLSConfig{KeyAlgorithm: api.KeyAlgorithmECDSA}
+	cr.Spec.MultiCluster = &api.MultiCluster{
+		Region: region,
+		Regions: []api.ClusterRegion{
+			{Name: "us-east1", Cluster: "crdb-east", Nodes: 3},
+			{Name: "us-west1", Cluster: "crdb-west", Nodes: 3},
+		},
+		CASecret: "crdb-shared-ca",
+	}
+	return cr
+}
+
+func TestGenerateCertSharedCA(t *testing.T) {
+	ctx := context.Background()
+	east, west := multiClusterCr("crdb-east", "us-east1"), multiClusterCr("crdb-west", "us-west1")
+	cl := fake.NewFakeClientWithScheme(testutil.InitScheme(t), east, west)
+	g := newGenerateCert(testutil.InitScheme(t), cl, nil).(*generateCert)
+
+	// the other regions wait for the CA of the first region
+	westCluster := resource.NewCluster(west)
+	require.IsType(t, NotReadyErr{}, g.Act(ctx, &westCluster))
+
+	eastCluster := resource.NewCluster(east)
+	require.NoError(t, g.Act(ctx, &eastCluster))
+	require.NoError(t, g.Act(ctx, &westCluster))
+
+	ca := testutil.ParseCert(t, getSecret(t, cl, "crdb-shared-ca").Data["ca.crt"])
+	for _, name := range []string{"crdb-east-node", "crdb-west-node"} {
+		node := getSecret(t, cl, name)
+		require.NoError(t, testutil.ParseCert(t, node.Data["tls.crt"]).CheckSignatureFrom(ca), name)
+	}
+}
+
+func TestCheckRegionsUpgraded(t *testing.T) {
+	version := semver.MustParse("v21.1.0")
+
+	tests := []struct {
+		name     string
+		region   string
+		builds   []string
+		expected bool
+	}{
+		{
+			name:     "the first region is not held",
+			region:   "us-east1",
+			expected: true,
+		},
+		{
+			name:   "the first region runs the old version",
+			region: "us-west1",
+			builds: []string{"v21.1.0", "v20.2.9", "v20.2.9"},
+		},
+		{
+			name:     "the first region is upgraded",
+			region:   "us-west1",
+			builds:   []string{"v21.1.0", "v21.1.0", "v21.1.1"},
+			expected: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			db, mock, err := sqlmock.New()
+			require.NoError(t, err)
+			defer db.Close()
+
+			if tt.builds != nil {
+				rows := sqlmock.NewRows([]string{"locality", "build_tag"})
+				for _, tag := range tt.builds {
+					rows.AddRow("region=us-east1", tag)
+				}
+				mock.ExpectQuery(regexp.QuoteMeta("SELECT locality, build_tag FROM crdb_internal.gossip_nodes")).WillReturnRows(rows)
+			}
+
+			cluster := resource.NewCluster(multiClusterCr("crdb", tt.region))
+			err = checkRegionsUpgraded(context.Background(), &cluster, db, version)
+			require.NoError(t, mock.ExpectationsWereMet())
+			if tt.expected {
+				require.NoError(t, err)
+			} else {
+				require.IsType(t, DeferredErr{}, err)
+			}
+		})
+	}
+}
@@ -0,0 +1,137 @@
+/*
+Copyright 2021 The Cockroach Authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    https://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package actor
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+
+	api "github.com/cockroachdb/cockroach-operator/apis/v1alpha1"
+	"github.com/cockroachdb/cockroach-operator/pkg/clustersql"
+	"github.com/cockroachdb/cockroach-operator/pkg/resource"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/client-go/rest"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+// pollInterval is how often the liveness of the nodes, the capacity of the
+// stores and the SQL interface of a ready cluster are polled.
+const pollInterval = time.Minute
+
+func newNodeHealth(scheme *runtime.Scheme, cl client.Client, config *rest.Config) Actor {
+	h := &nodeHealth{
+		action: newAction("nodeHealth", scheme, cl),
+		config: config,
+		now:    time.Now,
+	}
+	h.liveness = h.clusterLiveness
+	return h
+}
+
+// nodeHealth polls the liveness of the nodes and sets the Degraded condition
+// when some of them are dead or suspect
+type nodeHealth struct {
+	action
+
+	config *rest.Config
+	now    func() time.Time
+	// liveness returns the nodes of the cluster and how long a node can be
+	// not live before it is dead
+	liveness func(ctx context.Context, cluster *resource.Cluster) ([]clustersql.Node, time.Duration, error)
+}
+
+//GetActionType returns api.NodeHealthAction used to set the cluster status errors
+func (h nodeHealth) GetActionType() api.ActionType {
+	return api.NodeHealthAction
+}
+
+func (h nodeHealth) Act(ctx context.Context, cluster *resource.Cluster) error {
+	log := h.log.WithValues("CrdbCluster", cluster.ObjectKey())
+	log.V(DEBUGLEVEL).Info("checking the liveness of the nodes")
+
+	nodes, timeUntilStoreDead, err := h.liveness(ctx, cluster)
+	if err != nil {
+		log.Error(err, "failed to get the liveness of the nodes")
+		cluster.SetCondition(api.DegradedCondition, metav1.ConditionUnknown, "LivenessUnknown", err.Error())
+		return nil
+	}
+
+	dead, suspect := clustersql.UnavailableNodes(nodes, timeUntilStoreDead, h.now())
+	message := unavailableNodesMessage(dead, suspect)
+	switch {
+	case len(dead) > 0:
+		log.Info("some nodes are dead", "dead", dead, "suspect", suspect)
+		cluster.SetCondition(api.DegradedCondition, metav1.ConditionTrue, "NodesDead", message)
+	case len(suspect) > 0:
+		log.Info("some nodes are suspect", "suspect", suspect)
+		cluster.SetCondition(api.DegradedCondition, metav1.ConditionTrue, "NodesSuspect", message)
+	default:
+		cluster.SetCondition(api.DegradedCondition, metav1.ConditionFalse, "NodesLive", "")
+	}
+
+	return nil
+}
+
+// PollInterval returns how often the liveness is checked, so that the Degraded
+// condition follows the nodes that die and come back.
+func (h nodeHealth) PollInterval(*resource.Cluster) time.Duration {
+	return pollInterval
+}
+
+// unavailableNodesMessage lists the IDs of the dead and suspect nodes.
+func unavailableNodesMessage(dead, suspect []int) string {
+	ids := func(nodes []int) string {
+		var s []string
+		for _, id := range nodes {
+			s = append(s, fmt.Sprint(id))
+		}
+		return strings.Join(s, ", ")
+	}
+
+	var parts []string
+	if len(dead) > 0 {
+		parts = append(parts, "dead nodes: "+ids(dead))
+	}
+	if len(suspect) > 0 {
+		parts = append(parts, "suspect nodes: "+ids(suspect))
+	}
+	return strings.Join(parts, "; ")
+}
+
+// clusterLiveness returns the nodes of the cluster from its gossip network and
+// the time until store dead setting.
+func (h nodeHealth) clusterLiveness(ctx context.Context, cluster *resource.Cluster) ([]clustersql.Node, time.Duration, error) {
+	db, err := openDatabase(ctx, h.client, h.config, cluster)
+	if err != nil {
+		return nil, 0, err
+	}
+	defer db.Close()
+
+	nodes, err := clustersql.Nodes(ctx, db)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	timeUntilStoreDead, err := clustersql.TimeUntilStoreDead(ctx, db)
+	if err != nil {
+		return nil, 0, err
+	}
+	return nodes, timeUntilStoreDead, nil
+}
@@ -0,0 +1,110 @@
+/*
+Copyright 2021 The Cockroach Authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    https://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package actor
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	api "github.com/cockroachdb/cockroach-operator/apis/v1alpha1"
+	"github.com/cockroachdb/cockroach-operator/pkg/clustersql"
+	"github.com/cockroachdb/cockroach-operator/pkg/resource"
+	"github.com/cockroachdb/cockroach-operator/pkg/testutil"
+	"github.com/cockroachdb/errors"
+	"github.com/stretchr/testify/require"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+)
+
+func TestNodeHealth(t *testing.T) {
+	scheme := testutil.InitScheme(t)
+	now := time.Date(2021, time.June, 2, 20, 30, 0, 0, time.UTC)
+
+	tests := []struct {
+		name    string
+		nodes   []clustersql.Node
+		err     error
+		status  metav1.ConditionStatus
+		reason  string
+		message string
+	}{
+		{
+			name: "all nodes are live",
+			nodes: []clustersql.Node{
+				{ID: 1, IsLive: true}, {ID: 2, IsLive: true}, {ID: 3, IsLive: true},
+			},
+			status: metav1.ConditionFalse,
+			reason: "NodesLive",
+		},
+		{
+			name: "a node is suspect",
+			nodes: []clustersql.Node{
+				{ID: 1, IsLive: true}, {ID: 2, LivenessUpdatedAt: now.Add(-time.Minute)}, {ID: 3, IsLive: true},
+			},
+			status:  metav1.ConditionTrue,
+			reason:  "NodesSuspect",
+			message: "suspect nodes: 2",
+		},
+		{
+			name: "nodes are dead and suspect",
+			nodes: []clustersql.Node{
+				{ID: 1, LivenessUpdatedAt: now.Add(-time.Hour)}, {ID: 2, LivenessUpdatedAt: now.Add(-time.Minute)}, {ID: 3, IsLive: true},
+				{ID: 4, Decommissioning: true, LivenessUpdatedAt: now.Add(-time.Hour)},
+			},
+			status:  metav1.ConditionTrue,
+			reason:  "NodesDead",
+			message: "dead nodes: 1; suspect nodes: 2",
+		},
+		{
+			name:    "liveness is unknown",
+			err:     errors.New("connection refused"),
+			status:  metav1.ConditionUnknown,
+			reason:  "LivenessUnknown",
+			message: "connection refused",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cr := testutil.NewBuilder("crdb").Namespaced("default").WithNodeCount(3).Cr()
+			cluster := resource.NewCluster(cr)
+			cl := fake.NewFakeClientWithScheme(scheme, cr)
+
+			h := newNodeHealth(scheme, cl, nil).(*nodeHealth)
+			h.now = func() time.Time { return now }
+			h.liveness = func(context.Context, *resource.Cluster) ([]clustersql.Node, time.Duration, error) {
+				return tt.nodes, 5 * time.Minute, tt.err
+			}
+
+			err := h.Act(context.Background(), &cluster)
+			require.NoError(t, err)
+
+			var degraded *api.ClusterCondition
+			conditions := cluster.Status().Conditions
+			for i := range conditions {
+				if conditions[i].Type == api.DegradedCondition {
+					degraded = &conditions[i]
+				}
+			}
+			require.NotNil(t, degraded)
+			require.Equal(t, tt.status, degraded.Status)
+			require.Equal(t, tt.reason, degraded.Reason)
+			require.Equal(t, tt.message, degraded.Message)
+		})
+	}
+}
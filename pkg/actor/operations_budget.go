@@ -0,0 +1,107 @@
+/*
+Copyright 2021 The Cockroach Authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    https://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package actor
+
+import (
+	"context"
+	"time"
+
+	api "github.com/cockroachdb/cockroach-operator/apis/v1alpha1"
+	"github.com/cockroachdb/cockroach-operator/pkg/resource"
+	"github.com/cockroachdb/errors"
+	"github.com/go-logr/logr"
+	"k8s.io/apimachinery/pkg/api/equality"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+// reserveOperation checks the operations budget and the maintenance window of
+// the cluster before the action starts a disruptive operation: an upgrade, a
+// rolling restart or a resize of the pods. The operation is recorded when both
+// allow it. Otherwise it is recorded as pending and a DeferredErr is returned
+// until they allow it. The status is saved right away, as the disruptive
+// operations hold the reconciliation loop and cancel it once done.
+func reserveOperation(ctx context.Context, cl client.Client, log logr.Logger, cluster *resource.Cluster, atype api.ActionType, now time.Time) error {
+	window, err := cluster.UntilMaintenanceWindow(now)
+	if err != nil {
+		return ValidationError{Err: err}
+	}
+
+	before := cluster.Status().DeepCopy()
+
+	wait := cluster.Spec().OperationsBudget.UntilOperationAllowed(cluster.Status().DisruptiveOperations, now)
+	budgetWait := wait
+	if window > wait {
+		wait = window
+	}
+	if wait > 0 {
+		cluster.SetPendingOperation(atype, metav1.NewTime(now), metav1.NewTime(now.Add(wait)))
+	} else {
+		cluster.RecordDisruptiveOperation(atype, metav1.NewTime(now))
+	}
+
+	if !equality.Semantic.DeepEqual(before, cluster.Status()) {
+		saveOperations(ctx, cl, log, cluster)
+	}
+
+	if wait > 0 && window > budgetWait {
+		log.Info("waiting for the maintenance window", "Action", atype, "wait", wait.String())
+		return DeferredErr{
+			Err:          errors.Newf("the maintenance window opens in %s", wait.Round(time.Second)),
+			RequeueAfter: wait,
+		}
+	} else if wait > 0 {
+		log.Info("waiting for the operations budget", "Action", atype, "wait", wait.String())
+		return DeferredErr{
+			Err:          errors.Newf("the operations budget allows the operation in %s", wait.Round(time.Second)),
+			RequeueAfter: wait,
+		}
+	}
+	return nil
+}
+
+// releaseOperation forgets the disruptive operation the action reserved at
+// start once the action failed, and returns err. The retry of the action
+// reserves the operation again, so that it counts once against the operations
+// budget.
+func releaseOperation(ctx context.Context, cl client.Client, log logr.Logger, cluster *resource.Cluster, atype api.ActionType, start time.Time, err error) error {
+	before := cluster.Status().DeepCopy()
+	cluster.ForgetDisruptiveOperation(atype, metav1.NewTime(start))
+	if !equality.Semantic.DeepEqual(before, cluster.Status()) {
+		saveOperations(ctx, cl, log, cluster)
+	}
+	return err
+}
+
+// saveOperations saves the disruptive operations and the pending operations of
+// the cluster in its status.
+func saveOperations(ctx context.Context, cl client.Client, log logr.Logger, cluster *resource.Cluster) {
+	cr := resource.ClusterPlaceholder(cluster.Name())
+	if err := resource.NewKubeFetcher(ctx, cluster.Namespace(), cl).Fetch(cr); err != nil {
+		log.Error(err, "failed to fetch the CrdbCluster to save the disruptive operations")
+		return
+	}
+
+	status := cluster.Status().DeepCopy()
+	cr.Status.DisruptiveOperations = status.DisruptiveOperations
+	cr.Status.PendingOperations = status.PendingOperations
+	if err := cl.Status().Update(ctx, cr); err != nil {
+		log.Error(err, "failed to save the disruptive operations")
+		return
+	}
+	cluster.SetResourceVersion(cr.ResourceVersion)
+}
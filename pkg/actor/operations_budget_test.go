@@ -0,0 +1,170 @@
+/*
+Copyright 2021 The Cockroach Authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    https://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package actor
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	api "github.com/cockroachdb/cockroach-operator/apis/v1alpha1"
+	"github.com/cockroachdb/cockroach-operator/pkg/ptr"
+	"github.com/cockroachdb/cockroach-operator/pkg/resource"
+	"github.com/cockroachdb/cockroach-operator/pkg/testutil"
+	"github.com/cockroachdb/errors"
+	"github.com/go-logr/logr"
+	"github.com/stretchr/testify/require"
+	appsv1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+)
+
+func TestReserveOperation(t *testing.T) {
+	scheme := testutil.InitScheme(t)
+	ctx := context.Background()
+	now := time.Date(2021, time.June, 2, 12, 0, 0, 0, time.UTC)
+
+	cr := testutil.NewBuilder("crdb").Namespaced("default").WithNodeCount(3).Cr()
+	cr.Spec.OperationsBudget = &api.OperationsBudget{MaxPerHour: 1}
+	cr.Status.DisruptiveOperations = []api.DisruptiveOperation{
+		// forgotten with the next operation
+		{Action: api.ClusterRestartAction, StartTime: metav1.NewTime(now.Add(-25 * time.Hour))},
+	}
+	cluster := resource.NewCluster(cr)
+	cl := fake.NewFakeClientWithScheme(scheme, cr)
+	saved := func() api.CrdbClusterStatus {
+		actual := &api.CrdbCluster{}
+		require.NoError(t, cl.Get(ctx, client.ObjectKeyFromObject(cr), actual))
+		return actual.Status
+	}
+
+	// the first operation fits in the budget
+	require.NoError(t, reserveOperation(ctx, cl, logr.Discard(), &cluster, api.ResizeResourcesAction, now.Add(-40*time.Minute)))
+	require.Equal(t, []api.DisruptiveOperation{
+		{Action: api.ResizeResourcesAction, StartTime: metav1.NewTime(now.Add(-40 * time.Minute))},
+	}, cluster.Status().DisruptiveOperations)
+	require.Len(t, saved().DisruptiveOperations, 1)
+
+	// the second one waits for the first one to leave the hour
+	err := reserveOperation(ctx, cl, logr.Discard(), &cluster, api.ClusterRestartAction, now)
+	deferred, ok := err.(DeferredErr)
+	require.True(t, ok, err)
+	require.Equal(t, 20*time.Minute, deferred.RequeueAfter)
+	require.Equal(t, []api.PendingOperation{
+		{Action: api.ClusterRestartAction, Since: metav1.NewTime(now), NotBefore: metav1.NewTime(now.Add(20 * time.Minute))},
+	}, cluster.Status().PendingOperations)
+	require.Len(t, saved().PendingOperations, 1)
+	require.Len(t, saved().DisruptiveOperations, 1)
+
+	// and starts once it did
+	later := now.Add(20 * time.Minute)
+	require.NoError(t, reserveOperation(ctx, cl, logr.Discard(), &cluster, api.ClusterRestartAction, later))
+	require.Empty(t, saved().PendingOperations)
+	require.Len(t, saved().DisruptiveOperations, 2)
+}
+
+func TestReserveOperationMaintenanceWindow(t *testing.T) {
+	scheme := testutil.InitScheme(t)
+	ctx := context.Background()
+	now := time.Date(2021, time.June, 2, 12, 0, 0, 0, time.UTC)
+
+	newCluster := func(timeZone string, annotations map[string]string) (client.Client, resource.Cluster) {
+		cr := testutil.NewBuilder("crdb").Namespaced("default").WithNodeCount(3).Cr()
+		cr.Annotations = annotations
+		cr.Spec.MaintenanceWindow = &api.MaintenanceSchedule{
+			Windows:  []api.ScheduledWindow{{Schedule: "0 22 * * *", Duration: metav1.Duration{Duration: 2 * time.Hour}}},
+			TimeZone: timeZone,
+		}
+		return fake.NewFakeClientWithScheme(scheme, cr), resource.NewCluster(cr)
+	}
+
+	// the operation waits for the window
+	cl, cluster := newCluster("", nil)
+	err := reserveOperation(ctx, cl, logr.Discard(), &cluster, api.PartitionedUpdateAction, now)
+	deferred, ok := err.(DeferredErr)
+	require.True(t, ok, err)
+	require.Equal(t, 10*time.Hour, deferred.RequeueAfter)
+	require.Equal(t, "the maintenance window opens in 10h0m0s", deferred.Error())
+	require.Equal(t, []api.PendingOperation{
+		{Action: api.PartitionedUpdateAction, Since: metav1.NewTime(now), NotBefore: metav1.NewTime(now.Add(10 * time.Hour))},
+	}, cluster.Status().PendingOperations)
+
+	// unless the window is overridden for an emergency
+	cl, cluster = newCluster("", map[string]string{resource.CrdbMaintenanceOverrideAnnotation: "2021-06-02T14:00:00Z"})
+	require.NoError(t, reserveOperation(ctx, cl, logr.Discard(), &cluster, api.PartitionedUpdateAction, now))
+	require.Empty(t, cluster.Status().PendingOperations)
+	require.Len(t, cluster.Status().DisruptiveOperations, 1)
+
+	// an invalid window holds the operation until the spec changes
+	cl, cluster = newCluster("Mars/Olympus_Mons", nil)
+	err = reserveOperation(ctx, cl, logr.Discard(), &cluster, api.PartitionedUpdateAction, now)
+	_, ok = err.(ValidationError)
+	require.True(t, ok, err)
+}
+
+// failingDeletes fails the deletions while fail is set.
+type failingDeletes struct {
+	client.Client
+	fail bool
+}
+
+func (c *failingDeletes) Delete(ctx context.Context, obj client.Object, opts ...client.DeleteOption) error {
+	if c.fail {
+		return errors.New("the API server is unavailable")
+	}
+	return c.Client.Delete(ctx, obj, opts...)
+}
+
+func TestReserveOperationRetriedAction(t *testing.T) {
+	ctx := context.Background()
+	ss := &appsv1.StatefulSet{
+		ObjectMeta: metav1.ObjectMeta{Namespace: "default", Name: "crdb"},
+		Spec: appsv1.StatefulSetSpec{
+			Replicas: ptr.Int32(3),
+			VolumeClaimTemplates: []corev1.PersistentVolumeClaim{
+				{ObjectMeta: metav1.ObjectMeta{Name: "datadir"}},
+			},
+		},
+		Status: appsv1.StatefulSetStatus{ReadyReplicas: 3},
+	}
+	pod := &corev1.Pod{ObjectMeta: metav1.ObjectMeta{Namespace: "default", Name: "crdb-2"}}
+	pvc := &corev1.PersistentVolumeClaim{ObjectMeta: metav1.ObjectMeta{Namespace: "default", Name: "datadir-crdb-2"}}
+
+	cr := operationCr("n1:ReplaceNode:2")
+	cr.Spec.OperationsBudget = &api.OperationsBudget{MaxPerHour: 1}
+	o := newTestRequestedOperations(t, cr, ss, pod, pvc)
+	cl := &failingDeletes{Client: o.client, fail: true}
+	o.client = cl
+
+	// the replacement fails once the operation was reserved, which releases it
+	cluster := savedCluster(t, o)
+	require.Error(t, o.Act(ctx, &cluster))
+	require.Empty(t, cluster.Status().DisruptiveOperations)
+	require.Empty(t, savedCluster(t, o).Status().DisruptiveOperations)
+	require.Nil(t, savedCluster(t, o).RequestedOperation("n1"))
+
+	// so that the retry fits in the budget of one operation
+	cl.fail = false
+	cluster = savedCluster(t, o)
+	_, ok := o.Act(ctx, &cluster).(DeferredErr)
+	require.True(t, ok)
+	require.Equal(t, api.OperationRunning, savedCluster(t, o).RequestedOperation("n1").State)
+	require.Len(t, savedCluster(t, o).Status().DisruptiveOperations, 1)
+	require.Empty(t, savedCluster(t, o).Status().PendingOperations)
+}
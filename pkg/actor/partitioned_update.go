@@ -26,12 +26,17 @@ import (
 	"github.com/Masterminds/semver/v3"
 	api "github.com/cockroachdb/cockroach-operator/apis/v1alpha1"
 	"github.com/cockroachdb/cockroach-operator/pkg/database"
+	"github.com/cockroachdb/cockroach-operator/pkg/features"
 	"github.com/cockroachdb/cockroach-operator/pkg/healthchecker"
+	"github.com/cockroachdb/cockroach-operator/pkg/metrics"
+	"github.com/cockroachdb/cockroach-operator/pkg/ptr"
 	"github.com/cockroachdb/cockroach-operator/pkg/resource"
 	"github.com/cockroachdb/cockroach-operator/pkg/update"
+	"github.com/cockroachdb/cockroach-operator/pkg/utilfeature"
 	"github.com/cockroachdb/errors"
 	"go.uber.org/zap/zapcore"
 	appsv1 "k8s.io/api/apps/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/apimachinery/pkg/runtime"
 	kubetypes "k8s.io/apimachinery/pkg/types"
 	"k8s.io/client-go/kubernetes"
@@ -39,11 +44,22 @@ import (
 	"sigs.k8s.io/controller-runtime/pkg/client"
 )
 
+// finalizeInterval is how often the finalization of an intermediate version
+// of an upgrade is checked.
+const finalizeInterval = 30 * time.Second
+
+// podMaxPollingInterval is the longest wait between two checks of the pods
+// being replaced by an update of their statefulset.
+const podMaxPollingInterval = 30 * time.Minute
+
 func newPartitionedUpdate(scheme *runtime.Scheme, cl client.Client, config *rest.Config) Actor {
-	return &partitionedUpdate{
+	up := &partitionedUpdate{
 		action: newAction("partitionedUpdate", scheme, cl),
 		config: config,
+		now:    time.Now,
 	}
+	up.scrapeSQL = up.scrapeSQLCounts
+	return up
 }
 
 // upgrade handles minor and major version upgrades without finalization
@@ -51,6 +67,9 @@ type partitionedUpdate struct {
 	action
 
 	config *rest.Config
+	now    func() time.Time
+	// scrapeSQL reads the SQL statements of the pods while canaries bake
+	scrapeSQL func(ctx context.Context, cluster *resource.Cluster, pods []string) ([]sqlCounts, error)
 }
 
 // GetActionType returns api.PartitionedUpdateAction action used to set the cluster status errors
@@ -75,6 +94,20 @@ func (up *partitionedUpdate) Act(ctx context.Context, cluster *resource.Cluster)
 		return nil
 	}
 
+	// a rolled back upgrade is not retried until the spec changes
+	if cluster.UpgradeRolledBack() {
+		log.V(DEBUGLEVEL).Info("not retrying the upgrade that was rolled back", "version", cluster.GetVersionAnnotation())
+		cluster.ClearPendingOperation(up.GetActionType())
+		return nil
+	}
+
+	// a halted upgrade is not resumed until the spec changes
+	if cluster.UpgradeHalted() {
+		log.V(DEBUGLEVEL).Info("not resuming the upgrade whose canaries degraded", "version", cluster.GetVersionAnnotation())
+		cluster.ClearPendingOperation(up.GetActionType())
+		return nil
+	}
+
 	stsName := cluster.StatefulSetName()
 
 	key := kubetypes.NamespacedName{
@@ -86,7 +119,9 @@ func (up *partitionedUpdate) Act(ctx context.Context, cluster *resource.Cluster)
 		return errors.Wrap(err, "failed to fetch statefulset")
 	}
 
-	if statefulSetIsUpdating(statefulSet) {
+	// the pods of the canaries of an upgrade run another revision until the
+	// upgrade resumes
+	if statefulSetIsUpdating(statefulSet) && !heldByCanaries(cluster.Status().Upgrade) {
 		return NotReadyErr{Err: errors.New("statefulset is updating, waiting for the update to finish")}
 	}
 
@@ -115,9 +150,39 @@ func (up *partitionedUpdate) Act(ctx context.Context, cluster *resource.Cluster)
 		return nil
 	}
 
+	// the statefulset has the new version once the canaries are upgraded, and
+	// the intermediate version once a step of the upgrade started
+	previous := cluster.Status().Upgrade
+	canary := upgradeCanaries(previous, versionWantedCalFmtStr)
+	stepping := cluster.UpgradeSteppingToVersion() && previous.ToVersion == currentVersionCalFmtStr
+	if canary != nil || stepping && previous.State != api.UpgradeSucceeded {
+		currentVersionCalFmtStr = previous.FromVersion
+	}
+
+	// the node pools are upgraded after the statefulset, an upgrade that was
+	// interrupted before they all were is resumed
+	if currentVersionCalFmtStr == versionWantedCalFmtStr && previous != nil && previous.State == api.UpgradeInProgress &&
+		previous.ToVersion == versionWantedCalFmtStr {
+		pools, err := up.outdatedNodePools(ctx, cluster, versionWantedCalFmtStr)
+		if err != nil {
+			return err
+		}
+		if len(pools) > 0 {
+			currentVersionCalFmtStr = previous.FromVersion
+		}
+	}
+
 	// check annotation
 	if currentVersionCalFmtStr == versionWantedCalFmtStr {
 		log.Info("no version changes needed")
+		// an upgrade that was held is no longer wanted
+		if findCondition(cluster, api.UpgradeSafeCondition).Status == metav1.ConditionFalse {
+			cluster.SetCondition(api.UpgradeSafeCondition, metav1.ConditionTrue, "NoUpgrade", "")
+		}
+		if previous != nil && previous.State == api.UpgradePending {
+			up.cancelPendingUpgrade(ctx, cluster)
+		}
+		cluster.ClearPendingOperation(up.GetActionType())
 		return nil
 	}
 	containerWanted = getImageNameNoVersion(containerWanted)
@@ -131,10 +196,49 @@ func (up *partitionedUpdate) Act(ctx context.Context, cluster *resource.Cluster)
 		return errors.Wrapf(err, "failed to parse spec image version: %s", versionWantedCalFmtStr)
 	}
 
+	// a version more than one major release ahead is reached one major
+	// release at a time, through the latest supported version of each
+	stepVersion := wantVersion
+	if utilfeature.DefaultMutableFeatureGate.Enabled(features.MultiStepUpgrade) && update.NeedsIntermediateVersions(wantVersion, currentVersion) {
+		path, err := update.UpgradePath(wantVersion, currentVersion, supportedVersions(cluster))
+		if err != nil {
+			up.reportUpgrade(ctx, cluster, api.UpgradeStatus{
+				State:       api.UpgradeFailed,
+				FromVersion: currentVersionCalFmtStr,
+				ToVersion:   versionWantedCalFmtStr,
+				Message:     err.Error(),
+			})
+			cluster.ClearPendingOperation(up.GetActionType())
+			return ValidationError{Err: errors.Wrap(err, "no upgrade path")}
+		}
+		stepVersion = path[0]
+		log.Info("upgrading through intermediate versions", "path", fmt.Sprint(path))
+	}
+	stepVersionCalFmtStr := stepVersion.Original()
+	if stepVersion != wantVersion {
+		image := cluster.SupportedImage(stepVersionCalFmtStr)
+		if image == "" {
+			return errors.Newf("no image of the intermediate version %s", stepVersionCalFmtStr)
+		}
+		containerWanted = getImageNameNoVersion(image)
+	}
+
 	// TODO we probably should make these items and more configurable
 	// see https://github.com/cockroachdb/cockroach-operator/issues/203
-	podUpdateTimeout := 10 * time.Minute
-	podMaxPollingInterval := 30 * time.Minute
+	podUpdateTimeout := cluster.Spec().UpgradeTimeoutOrDefault()
+
+	// an upgrade interrupted by a restart of the operator resumes without
+	// waiting for the operations budget
+	resuming := previous != nil && previous.State == api.UpgradeInProgress && previous.ToVersion == stepVersionCalFmtStr
+
+	// the other pods are upgraded once the canaries baked
+	if resuming && canary != nil && canary.State == api.CanaryBaking {
+		passed, err := up.bake(ctx, cluster, statefulSet, log)
+		if !passed {
+			return err
+		}
+		canary.State = api.CanaryPassed
+	}
 
 	clientset, err := kubernetes.NewForConfig(up.config)
 	if err != nil {
@@ -164,6 +268,7 @@ func (up *partitionedUpdate) Act(ctx context.Context, cluster *resource.Cluster)
 		DatabaseName:     "system", // TODO we need to use variable instead of string
 		Port:             cluster.Spec().SQLPort,
 		RunningInsideK8s: runningInsideK8s,
+		Audit:            sqlAudit(cluster),
 	}
 
 	// see https://github.com/cockroachdb/cockroach-operator/issues/204 for above TODO
@@ -192,15 +297,111 @@ func (up *partitionedUpdate) Act(ctx context.Context, cluster *resource.Cluster)
 	// TODO test downgrades
 	// see https://github.com/cockroachdb/cockroach-operator/issues/208
 	healthChecker := healthchecker.NewHealthChecker(cluster, clientset, up.scheme, up.config)
-	log.V(int(zapcore.InfoLevel)).Info("update starting with partitioned update", "old version", currentVersionCalFmtStr, "new version", versionWantedCalFmtStr, "image", containerWanted)
+	log.V(int(zapcore.InfoLevel)).Info("update starting with partitioned update", "old version", currentVersionCalFmtStr, "new version", stepVersionCalFmtStr, "image", containerWanted)
+
+	// a downgrade returns the pods to the version the cluster ran before, so
+	// there are no canaries
+	downgrade := wantVersion.LessThan(currentVersion)
+	if downgrade {
+		log.Info("rolling the cluster back", "from", currentVersionCalFmtStr, "to", versionWantedCalFmtStr)
+	}
+
+	// the intermediate version the previous step reached is finalized before
+	// the next step starts
+	if stepping && previous.State == api.UpgradeSucceeded {
+		finalized, err := update.FinalizeUpgrade(ctx, db, currentVersion)
+		if err != nil {
+			return errors.Wrapf(err, "failed to finalize the upgrade to %s", currentVersionCalFmtStr)
+		}
+		if !finalized {
+			log.Info("waiting for the upgrade to finalize before the next step", "version", currentVersionCalFmtStr)
+			return DeferredErr{Err: errors.Newf("the upgrade to %s finalizes", currentVersionCalFmtStr), RequeueAfter: finalizeInterval}
+		}
+	}
+
+	// an upgrade held before it starts is reported pending, with what it
+	// waits for
+	replicas := *statefulSet.Spec.Replicas
+	pending := api.UpgradeStatus{
+		State:        api.UpgradePending,
+		FromVersion:  currentVersionCalFmtStr,
+		ToVersion:    stepVersionCalFmtStr,
+		Partition:    ptr.Int32(replicas),
+		OutdatedPods: replicas,
+		Canary:       canary,
+	}
+	if stepVersion != wantVersion {
+		pending.TargetVersion = versionWantedCalFmtStr
+	}
+	if previous != nil && previous.FromVersion == pending.FromVersion && previous.ToVersion == pending.ToVersion {
+		pending.Partition = previous.Partition
+		pending.UpdatedPods = previous.UpdatedPods
+		pending.OutdatedPods = previous.OutdatedPods
+	}
+
+	// an upgrade starts on a healthy cluster only, a downgrade is how an
+	// unhealthy upgrade is undone
+	if !resuming && !downgrade && utilfeature.DefaultMutableFeatureGate.Enabled(features.UpgradePreflight) {
+		if err := checkUpgradeSafe(ctx, cluster, db, up.now()); err != nil {
+			up.holdUpgrade(ctx, cluster, pending, err)
+			return err
+		}
+	}
+
+	// the regions of a multi-cluster deployment are upgraded in order
+	if cluster.Spec().MultiCluster != nil && !resuming && !downgrade {
+		if err := checkRegionsUpgraded(ctx, cluster, db, stepVersion); err != nil {
+			up.holdUpgrade(ctx, cluster, pending, err)
+			return err
+		}
+	}
+
+	var start time.Time
+	if !resuming {
+		start = up.now()
+		if err := reserveOperation(ctx, up.client, log, cluster, up.GetActionType(), start); err != nil {
+			up.holdUpgrade(ctx, cluster, pending, err)
+			return err
+		}
+	}
+
+	previousImage := containerImage(statefulSet)
+	if canary != nil && canary.FromImage != "" {
+		previousImage = canary.FromImage
+	}
+	progress := api.UpgradeStatus{
+		State:        api.UpgradeInProgress,
+		FromVersion:  currentVersionCalFmtStr,
+		ToVersion:    stepVersionCalFmtStr,
+		Partition:    ptr.Int32(replicas),
+		OutdatedPods: replicas,
+	}
+	if stepVersion != wantVersion {
+		progress.TargetVersion = versionWantedCalFmtStr
+	}
+
+	// the canaries are upgraded first, and bake before the other pods are.
+	// The intermediate versions of an upgrade have none.
+	partition := int32(0)
+	if resuming && canary != nil && canary.State == api.CanaryPassed {
+		progress.Canary = canary
+		progress.Partition = ptr.Int32(replicas - canary.Pods)
+		progress.UpdatedPods = canary.Pods
+		progress.OutdatedPods = replicas - canary.Pods
+	} else if pods := canaryPods(cluster, replicas); pods > 0 && !downgrade && stepVersion == wantVersion {
+		partition = replicas - pods
+		log.Info("upgrading the canaries first", "pods", pods)
+	}
+	up.reportUpgrade(ctx, cluster, progress)
 
 	updateRoach := &update.UpdateRoach{
 		CurrentVersion: currentVersion,
-		WantVersion:    wantVersion,
+		WantVersion:    stepVersion,
 		WantImageName:  containerWanted,
 		StsName:        stsName,
 		StsNamespace:   cluster.Namespace(),
 		Db:             db,
+		Partition:      partition,
 	}
 
 	k8sCluster := &update.UpdateCluster{
@@ -208,30 +409,237 @@ func (up *partitionedUpdate) Act(ctx context.Context, cluster *resource.Cluster)
 		PodUpdateTimeout:      podUpdateTimeout,
 		PodMaxPollingInterval: podMaxPollingInterval,
 		HealthChecker:         healthChecker,
+		MaxUnavailable:        cluster.Spec().UpdateStrategy.MaxUnavailableOrDefault(),
+		OnProgress: func(p update.Progress) {
+			progress.Partition = ptr.Int32(p.Partition)
+			progress.UpdatedPods = p.UpdatedPods
+			progress.OutdatedPods = p.OutdatedPods
+			progress.BlockedReason = ""
+			up.reportUpgrade(ctx, cluster, progress)
+		},
+		OnWait: func(podNumber int) {
+			progress.BlockedReason = fmt.Sprintf("waiting for pod %s-%d to run %s and become ready", updateRoach.StsName, podNumber, stepVersionCalFmtStr)
+			up.reportUpgrade(ctx, cluster, progress)
+		},
+	}
+
+	// the pods of the node pools are upgraded once the other pods are, one
+	// pool at a time and with the same checks. The canaries are never pods
+	// of the node pools.
+	statefulSets := []*appsv1.StatefulSet{statefulSet}
+	if partition == 0 {
+		pools, err := up.outdatedNodePools(ctx, cluster, stepVersionCalFmtStr)
+		if err != nil {
+			return err
+		}
+		statefulSets = append(statefulSets, pools...)
 	}
 
-	err = update.UpdateClusterCockroachVersion(
-		ctx,
-		updateRoach,
-		k8sCluster,
-		log,
-	)
+	var upgraded []*appsv1.StatefulSet
+	for _, ss := range statefulSets {
+		updateRoach.StsName = ss.Name
+		if ss != statefulSet {
+			// the progress is the one of the pods of the statefulset
+			k8sCluster.OnProgress = nil
+			log.Info("upgrading the node pool", "StatefulSet", ss.Name)
+		}
+
+		err = update.UpdateClusterCockroachVersion(
+			ctx,
+			updateRoach,
+			k8sCluster,
+			log,
+		)
+
+		if err != nil {
+			// the retry of the upgrade reserves the operation again
+			err = up.failUpgrade(ctx, cluster, clientset, updateRoach, append(upgraded, ss), previousImage, progress, err)
+			return releaseOperation(ctx, up.client, log, cluster, up.GetActionType(), start, err)
+		}
+		upgraded = append(upgraded, ss)
+	}
 
-	// TODO set status so that we will not try to update the cluster again
-	// TODO set status to rollback cluster?
-	// This work is pending the status field updates
-	// see https://github.com/cockroachdb/cockroach-operator/issues/209
+	if partition > 0 {
+		baking, err := up.startBake(ctx, cluster, statefulSet, replicas-partition, previousImage)
+		if err != nil {
+			return errors.Wrap(err, "failed to start the bake of the canaries")
+		}
+		bakeTime := cluster.Spec().UpgradeCanary.BakeTimeOrDefault()
+		progress.Canary = baking
+		progress.BlockedReason = fmt.Sprintf("the canaries bake until %s", baking.BakeStartedAt.Add(bakeTime).UTC().Format(time.RFC3339))
+		up.reportUpgrade(ctx, cluster, progress)
+
+		log.Info("upgraded the canaries, baking", "pods", baking.Pods, "bakeTime", bakeTime.String())
+		wait := bakeTime
+		if wait > canaryCheckInterval {
+			wait = canaryCheckInterval
+		}
+		return DeferredErr{Err: errors.New("the canaries bake"), RequeueAfter: wait}
+	}
 
-	if err != nil {
-		return errors.Wrapf(err, "failed to update sts with partitioned update: %s", stsName)
+	progress.State = api.UpgradeSucceeded
+	progress.Partition = ptr.Int32(0)
+	progress.UpdatedPods = replicas
+	progress.OutdatedPods = 0
+	progress.BlockedReason = ""
+	up.reportUpgrade(ctx, cluster, progress)
+
+	if stepVersion != wantVersion {
+		log.Info("upgraded to an intermediate version", "version", stepVersionCalFmtStr, "target", versionWantedCalFmtStr)
+		return DeferredErr{Err: errors.Newf("upgraded to %s on the way to %s", stepVersionCalFmtStr, versionWantedCalFmtStr), RequeueAfter: finalizeInterval}
 	}
 
-	// TODO set status that we are completed.
 	log.V(DEBUGLEVEL).Info("update completed with partitioned update", "new version", versionWantedCalFmtStr)
 	CancelLoop(ctx)
 	return nil
 }
 
+// failUpgrade reports the upgrade that failed on the last of the statefulsets,
+// and rolls the statefulsets back when a pod did not become ready in time.
+func (up *partitionedUpdate) failUpgrade(ctx context.Context, cluster *resource.Cluster, clientset kubernetes.Interface,
+	updateRoach *update.UpdateRoach, statefulSets []*appsv1.StatefulSet, previousImage string, progress api.UpgradeStatus, err error) error {
+	log := up.log.WithValues("CrdbCluster", cluster.ObjectKey())
+	failed := statefulSets[len(statefulSets)-1]
+	replicas := *statefulSets[0].Spec.Replicas
+
+	progress.State = api.UpgradeFailed
+	progress.Message = err.Error()
+	progress.BlockedReason = ""
+
+	// a version change the cluster cannot take, e.g. a downgrade after
+	// the upgrade was finalized, is not retried until the spec changes
+	var notAllowed update.UpdateNotAllowed
+	if errors.As(err, &notAllowed) {
+		up.reportUpgrade(ctx, cluster, progress)
+		cluster.ClearPendingOperation(up.GetActionType())
+		return ValidationError{Err: errors.Wrapf(err, "version change of sts %s rejected", failed.Name)}
+	}
+
+	var timeoutErr update.PodUpdateTimeoutErr
+	if utilfeature.DefaultMutableFeatureGate.Enabled(features.UpgradeRollback) && errors.As(err, &timeoutErr) {
+		log.Info("updated pod did not become ready in time, rolling back the upgrade", "pod", timeoutErr.PodNumber,
+			"StatefulSet", failed.Name, "version", updateRoach.CurrentVersion.Original())
+		// the statefulsets upgraded before the one that failed are rolled
+		// back too
+		var diagnostics []string
+		for _, ss := range statefulSets {
+			rollback := *updateRoach
+			rollback.StsName = ss.Name
+			ssDiagnostics, rollbackErr := update.RollbackCockroachVersion(ctx, clientset, &rollback, previousImage, log)
+			if rollbackErr != nil {
+				up.reportUpgrade(ctx, cluster, progress)
+				return errors.Wrapf(rollbackErr, "failed to roll back sts %s after: %s", ss.Name, err.Error())
+			}
+			diagnostics = append(diagnostics, ssDiagnostics...)
+		}
+
+		progress.RolledBackGeneration = cluster.Unwrap().Generation
+		progress.Partition = ptr.Int32(replicas)
+		progress.UpdatedPods = 0
+		progress.OutdatedPods = replicas
+		progress.Message = fmt.Sprintf("%s; rolled back to %s", err.Error(), updateRoach.CurrentVersion.Original())
+		if len(diagnostics) > 0 {
+			progress.Message += ": " + strings.Join(diagnostics, "; ")
+		}
+		up.reportUpgrade(ctx, cluster, progress)
+		cluster.ClearPendingOperation(up.GetActionType())
+
+		CancelLoop(ctx)
+		return nil
+	}
+	up.reportUpgrade(ctx, cluster, progress)
+
+	err = errors.Wrapf(err, "failed to update sts with partitioned update: %s", failed.Name)
+	if pullErr := statefulSetImagePullFailure(ctx, clientset, failed); pullErr != nil {
+		return FailureErr{Reason: api.ImagePullBackOffReason, Err: errors.Wrap(err, pullErr.Error())}
+	}
+	return err
+}
+
+// outdatedNodePools returns the statefulsets of the node pools that do not
+// run the version yet.
+func (up *partitionedUpdate) outdatedNodePools(ctx context.Context, cluster *resource.Cluster, version string) ([]*appsv1.StatefulSet, error) {
+	if !utilfeature.DefaultMutableFeatureGate.Enabled(features.NodePools) {
+		return nil, nil
+	}
+
+	pools, err := resource.NodePoolStatefulSets(ctx, up.client, cluster)
+	if err != nil {
+		return nil, err
+	}
+	var outdated []*appsv1.StatefulSet
+	for i := range pools {
+		if pools[i].Annotations[resource.CrdbVersionAnnotation] != version {
+			outdated = append(outdated, &pools[i])
+		}
+	}
+	return outdated, nil
+}
+
+// reportUpgrade records the progress of the upgrade in the status of the
+// cluster and in the operator metrics. The status is saved right away, as the
+// upgrade holds the reconciliation loop until the last pod is updated.
+func (up *partitionedUpdate) reportUpgrade(ctx context.Context, cluster *resource.Cluster, progress api.UpgradeStatus) {
+	log := up.log.WithValues("CrdbCluster", cluster.ObjectKey())
+
+	cluster.SetUpgradeStatus(progress, metav1.NewTime(up.now()))
+	metrics.SetUpgrade(cluster.Namespace(), cluster.Name(), cluster.Status().Upgrade)
+
+	fetcher := resource.NewKubeFetcher(ctx, cluster.Namespace(), up.client)
+	cr := resource.ClusterPlaceholder(cluster.Name())
+	if err := fetcher.Fetch(cr); err != nil {
+		log.Error(err, "failed to fetch the CrdbCluster to save the upgrade progress")
+		return
+	}
+
+	cr.Status.Upgrade = cluster.Status().Upgrade.DeepCopy()
+	if err := up.client.Status().Update(ctx, cr); err != nil {
+		log.Error(err, "failed to save the upgrade progress")
+		return
+	}
+	cluster.SetResourceVersion(cr.ResourceVersion)
+}
+
+// holdUpgrade reports the upgrade pending while err holds it before any pod is
+// upgraded. The status is only saved when what the upgrade waits for changes.
+func (up *partitionedUpdate) holdUpgrade(ctx context.Context, cluster *resource.Cluster, pending api.UpgradeStatus, err error) {
+	var notReady NotReadyErr
+	var deferred DeferredErr
+	if !errors.As(err, &notReady) && !errors.As(err, &deferred) {
+		return
+	}
+
+	pending.BlockedReason = err.Error()
+	if previous := cluster.Status().Upgrade; previous != nil && previous.State == api.UpgradePending &&
+		previous.ToVersion == pending.ToVersion && previous.BlockedReason == pending.BlockedReason {
+		return
+	}
+	up.reportUpgrade(ctx, cluster, pending)
+}
+
+// cancelPendingUpgrade removes from the status the upgrade that was pending,
+// once its version is no longer wanted.
+func (up *partitionedUpdate) cancelPendingUpgrade(ctx context.Context, cluster *resource.Cluster) {
+	log := up.log.WithValues("CrdbCluster", cluster.ObjectKey())
+
+	cluster.ClearUpgradeStatus()
+	metrics.SetUpgrade(cluster.Namespace(), cluster.Name(), nil)
+
+	fetcher := resource.NewKubeFetcher(ctx, cluster.Namespace(), up.client)
+	cr := resource.ClusterPlaceholder(cluster.Name())
+	if err := fetcher.Fetch(cr); err != nil {
+		log.Error(err, "failed to fetch the CrdbCluster to cancel the pending upgrade")
+		return
+	}
+
+	cr.Status.Upgrade = nil
+	if err := up.client.Status().Update(ctx, cr); err != nil {
+		log.Error(err, "failed to cancel the pending upgrade")
+		return
+	}
+	cluster.SetResourceVersion(cr.ResourceVersion)
+}
+
 // inK8s checks to see if the a file exists
 func inK8s(file string) bool {
 	_, err := os.Stat(file)
@@ -254,6 +662,28 @@ func getImageNameNoVersion(image string) string {
 	return image[:i]
 }
 
+// supportedVersions returns the versions the operator has an image of.
+func supportedVersions(cluster *resource.Cluster) []*semver.Version {
+	var versions []*semver.Version
+	for _, v := range cluster.SupportedVersions() {
+		if version, err := semver.NewVersion(v); err == nil {
+			versions = append(versions, version)
+		}
+	}
+	return versions
+}
+
+// containerImage returns the image of the CockroachDB container of the
+// StatefulSet.
+func containerImage(ss *appsv1.StatefulSet) string {
+	for _, container := range ss.Spec.Template.Spec.Containers {
+		if container.Name == resource.DbContainerName {
+			return container.Image
+		}
+	}
+	return ""
+}
+
 func statefulSetIsUpdating(ss *appsv1.StatefulSet) bool {
 	if ss.Status.ObservedGeneration == 0 {
 		return false
@@ -17,11 +17,21 @@ limitations under the License.
 package actor
 
 import (
+	"context"
 	"io/ioutil"
 	"os"
 	"testing"
+	"time"
 
+	api "github.com/cockroachdb/cockroach-operator/apis/v1alpha1"
+	"github.com/cockroachdb/cockroach-operator/pkg/ptr"
+	"github.com/cockroachdb/cockroach-operator/pkg/resource"
+	"github.com/cockroachdb/cockroach-operator/pkg/testutil"
+	"github.com/cockroachdb/errors"
 	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
 )
 
 func TestDeployedInCluster(t *testing.T) {
@@ -69,3 +79,107 @@ func TestGetImageNameNoVersion(t *testing.T) {
 		})
 	}
 }
+
+func TestReportUpgrade(t *testing.T) {
+	ctx := context.Background()
+	scheme := testutil.InitScheme(t)
+	cr := testutil.NewBuilder("crdb").Namespaced("default").WithNodeCount(3).Cr()
+	cl := fake.NewFakeClientWithScheme(scheme, cr)
+
+	// the cluster is read at the beginning of the reconciliation
+	actual := &api.CrdbCluster{}
+	require.NoError(t, cl.Get(ctx, client.ObjectKeyFromObject(cr), actual))
+	cluster := resource.NewCluster(actual)
+
+	start := time.Date(2021, 6, 1, 12, 0, 0, 0, time.UTC)
+	now := start
+	up := newPartitionedUpdate(scheme, cl, nil).(*partitionedUpdate)
+	up.now = func() time.Time { return now }
+
+	progress := api.UpgradeStatus{
+		State:        api.UpgradeInProgress,
+		FromVersion:  "v20.2.8",
+		ToVersion:    "v21.1.0",
+		Partition:    ptr.Int32(3),
+		OutdatedPods: 3,
+	}
+	up.reportUpgrade(ctx, &cluster, progress)
+
+	// the same progress does not change the transition time
+	now = start.Add(time.Minute)
+	up.reportUpgrade(ctx, &cluster, progress)
+	require.Equal(t, start, cluster.Status().Upgrade.LastTransitionTime.Time.UTC())
+
+	now = start.Add(2 * time.Minute)
+	progress.Partition = ptr.Int32(2)
+	progress.UpdatedPods, progress.OutdatedPods = 1, 2
+	up.reportUpgrade(ctx, &cluster, progress)
+
+	require.NoError(t, cl.Get(ctx, client.ObjectKeyFromObject(cr), actual))
+	require.Equal(t, api.UpgradeInProgress, actual.Status.Upgrade.State)
+	require.Equal(t, int32(2), *actual.Status.Upgrade.Partition)
+	require.Equal(t, int32(1), actual.Status.Upgrade.UpdatedPods)
+	require.Equal(t, int32(2), actual.Status.Upgrade.OutdatedPods)
+	require.Equal(t, start, actual.Status.Upgrade.StartedAt.Time.UTC())
+	require.Equal(t, now, actual.Status.Upgrade.LastTransitionTime.Time.UTC())
+
+	// the status can still be saved at the end of the reconciliation
+	fresh, err := cluster.IsFresh(resource.NewKubeFetcher(ctx, "default", cl))
+	require.NoError(t, err)
+	require.True(t, fresh)
+	require.NoError(t, cl.Status().Update(ctx, cluster.Unwrap()))
+}
+
+func TestHoldUpgrade(t *testing.T) {
+	ctx := context.Background()
+	scheme := testutil.InitScheme(t)
+	cr := testutil.NewBuilder("crdb").Namespaced("default").WithNodeCount(3).Cr()
+	cl := fake.NewFakeClientWithScheme(scheme, cr)
+
+	actual := &api.CrdbCluster{}
+	require.NoError(t, cl.Get(ctx, client.ObjectKeyFromObject(cr), actual))
+	cluster := resource.NewCluster(actual)
+
+	start := time.Date(2021, 6, 1, 12, 0, 0, 0, time.UTC)
+	now := start
+	up := newPartitionedUpdate(scheme, cl, nil).(*partitionedUpdate)
+	up.now = func() time.Time { return now }
+
+	pending := api.UpgradeStatus{
+		State:        api.UpgradePending,
+		FromVersion:  "v20.2.8",
+		ToVersion:    "v21.1.0",
+		Partition:    ptr.Int32(3),
+		OutdatedPods: 3,
+	}
+
+	// an error that does not hold the upgrade is not reported
+	up.holdUpgrade(ctx, &cluster, pending, errors.New("failed to list the nodes"))
+	require.Nil(t, cluster.Status().Upgrade)
+
+	up.holdUpgrade(ctx, &cluster, pending, DeferredErr{Err: errors.New("the maintenance window opens in 1h0m0s"), RequeueAfter: time.Hour})
+	require.NoError(t, cl.Get(ctx, client.ObjectKeyFromObject(cr), actual))
+	require.Equal(t, api.UpgradePending, actual.Status.Upgrade.State)
+	require.Equal(t, "the maintenance window opens in 1h0m0s", actual.Status.Upgrade.BlockedReason)
+
+	// the upgrade starts when it leaves the Pending state
+	now = start.Add(time.Hour)
+	up.reportUpgrade(ctx, &cluster, api.UpgradeStatus{
+		State:        api.UpgradeInProgress,
+		FromVersion:  "v20.2.8",
+		ToVersion:    "v21.1.0",
+		Partition:    ptr.Int32(3),
+		OutdatedPods: 3,
+	})
+	require.NoError(t, cl.Get(ctx, client.ObjectKeyFromObject(cr), actual))
+	require.Equal(t, api.UpgradeInProgress, actual.Status.Upgrade.State)
+	require.Empty(t, actual.Status.Upgrade.BlockedReason)
+	require.Equal(t, now, actual.Status.Upgrade.StartedAt.Time.UTC())
+
+	// a pending upgrade whose version is reverted is removed
+	up.holdUpgrade(ctx, &cluster, pending, NotReadyErr{Err: errors.New("upgrade held: 2 schema changes are running")})
+	up.cancelPendingUpgrade(ctx, &cluster)
+	require.NoError(t, cl.Get(ctx, client.ObjectKeyFromObject(cr), actual))
+	require.Nil(t, actual.Status.Upgrade)
+	require.Nil(t, cluster.Status().Upgrade)
+}
@@ -0,0 +1,209 @@
+/*
+Copyright 2021 The Cockroach Authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    https://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package actor
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"time"
+
+	api "github.com/cockroachdb/cockroach-operator/apis/v1alpha1"
+	"github.com/cockroachdb/cockroach-operator/pkg/clustersql"
+	"github.com/cockroachdb/cockroach-operator/pkg/resource"
+	"github.com/cockroachdb/errors"
+	"github.com/go-logr/logr"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/client-go/rest"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+// promotionInterval is how often the cutover of a standby cluster being
+// promoted is polled.
+const promotionInterval = 10 * time.Second
+
+func newReplication(scheme *runtime.Scheme, cl client.Client, config *rest.Config) Actor {
+	r := &replication{
+		action: newAction("replication", scheme, cl),
+		config: config,
+		now:    time.Now,
+	}
+	r.db = func(ctx context.Context, cluster *resource.Cluster) (*sql.DB, error) {
+		return openDatabase(ctx, cl, config, cluster)
+	}
+	return r
+}
+
+// replication starts the physical replication stream of a standby cluster once
+// it is initialized, creating the virtual cluster replicating the one of the
+// primary cluster, then reports the progress of the stream in the status. The
+// stream is polled every minute, until the standby is promoted to primary
+type replication struct {
+	action
+
+	config *rest.Config
+	// db opens a connection to the cluster
+	db  func(ctx context.Context, cluster *resource.Cluster) (*sql.DB, error)
+	now func() time.Time
+}
+
+//GetActionType returns api.ReplicationAction used to set the cluster status errors
+func (r replication) GetActionType() api.ActionType {
+	return api.ReplicationAction
+}
+
+func (r replication) Act(ctx context.Context, cluster *resource.Cluster) error {
+	log := r.log.WithValues("CrdbCluster", cluster.ObjectKey())
+	log.V(DEBUGLEVEL).Info("checking the replication stream")
+
+	// a promoted cluster is a primary cluster of its own
+	if status := cluster.Status().Replication; status != nil && status.PromotedAt != nil {
+		log.V(DEBUGLEVEL).Info("the standby cluster was promoted")
+		return nil
+	}
+
+	source := cluster.Spec().Replication
+	name := source.VirtualClusterName()
+
+	notReplicating := func(reason string, err error) error {
+		log.Error(err, "the standby cluster is not replicating", "reason", reason)
+		cluster.SetCondition(api.ReplicatingCondition, metav1.ConditionFalse, reason, err.Error())
+		return nil
+	}
+
+	db, err := r.db(ctx, cluster)
+	if err != nil {
+		return notReplicating("SQLUnavailable", err)
+	}
+	defer db.Close()
+
+	exists, err := clustersql.VirtualClusterExists(ctx, db, name)
+	if err != nil {
+		return notReplicating("SQLUnavailable", err)
+	}
+	if !exists {
+		ref := source.ConnectionSecretRef
+		uri, ok, err := resource.SecretValue(ctx, r.client, cluster.Namespace(), &ref)
+		if err != nil {
+			return notReplicating("SecretUnavailable", err)
+		}
+		if !ok {
+			return notReplicating("SecretNotFound", errors.Newf("waiting for key %s of secret %s with the connection URI of the primary cluster", ref.Key, ref.Name))
+		}
+
+		if err := clustersql.StartReplication(ctx, db, name, source.SourceVirtualClusterName(), uri); err != nil {
+			return notReplicating("ReplicationFailed", err)
+		}
+		log.Info("started the replication stream", "virtualCluster", name, "source", source.SourceVirtualClusterName(),
+			"primary", clustersql.RedactURI(uri))
+	}
+
+	stream, err := clustersql.GetReplicationStream(ctx, db, name)
+	if err != nil {
+		return notReplicating("SQLUnavailable", err)
+	}
+	status := r.status(stream)
+	cluster.SetReplicationStatus(status)
+
+	if stream.Replicating() {
+		cluster.SetCondition(api.ReplicatingCondition, metav1.ConditionTrue, "Replicating", "")
+	} else {
+		cluster.SetCondition(api.ReplicatingCondition, metav1.ConditionFalse, "NotReplicating",
+			fmt.Sprintf("the replication stream of virtual cluster %s is %s", name, stream.Status))
+	}
+
+	if source.Promote {
+		return r.promote(ctx, log, cluster, db, stream, status)
+	}
+	return nil
+}
+
+// PollInterval returns how often the progress of the replication stream is
+// reported in the status, until the standby cluster is promoted.
+func (r replication) PollInterval(cluster *resource.Cluster) time.Duration {
+	if status := cluster.Status().Replication; status != nil && status.PromotedAt != nil {
+		return 0
+	}
+	return pollInterval
+}
+
+// promote cuts the standby cluster over to primary once the promotion is
+// confirmed by the annotation: the stream is completed up to the latest
+// replicated time, then the virtual cluster is started and the SQL connections
+// to the services of the cluster are routed to it.
+func (r replication) promote(ctx context.Context, log logr.Logger, cluster *resource.Cluster, db *sql.DB,
+	stream clustersql.ReplicationStream, status *api.ReplicationStatus) error {
+	name := stream.VirtualCluster
+	notPromoted := func(reason, message string, after time.Duration) error {
+		cluster.SetCondition(api.PromotedCondition, metav1.ConditionFalse, reason, message)
+		return DeferredErr{Err: errors.New(message), RequeueAfter: after}
+	}
+
+	// the annotation guards against a promotion by mistake, such as a spec
+	// applied to the wrong cluster
+	if cluster.Unwrap().Annotations[resource.CrdbConfirmPromotionAnnotation] != cluster.Name() {
+		return notPromoted("ConfirmationRequired", fmt.Sprintf("annotate the cluster with %s=%s to confirm its promotion",
+			resource.CrdbConfirmPromotionAnnotation, cluster.Name()), pollInterval)
+	}
+
+	switch {
+	case stream.Replicating():
+		if err := clustersql.CompleteReplication(ctx, db, name); err != nil {
+			log.Error(err, "failed to cut the standby cluster over")
+			return notPromoted("CutoverFailed", err.Error(), promotionInterval)
+		}
+		log.Info("cutting the standby cluster over", "virtualCluster", name, "replicatedTime", stream.ReplicatedTime)
+		return notPromoted("CuttingOver", fmt.Sprintf("cutting virtual cluster %s over", name), promotionInterval)
+	case stream.Status != clustersql.ReplicationReady:
+		return notPromoted("CuttingOver", fmt.Sprintf("the replication stream of virtual cluster %s is %s", name, stream.Status), promotionInterval)
+	}
+
+	if err := clustersql.ActivateVirtualCluster(ctx, db, name); err != nil {
+		log.Error(err, "failed to activate the virtual cluster")
+		return notPromoted("ActivationFailed", err.Error(), promotionInterval)
+	}
+
+	promoted := metav1.NewTime(r.now())
+	status.PromotedAt = &promoted
+	cluster.SetReplicationStatus(status)
+	cluster.SetCondition(api.ReplicatingCondition, metav1.ConditionFalse, "Promoted", "")
+	cluster.SetCondition(api.PromotedCondition, metav1.ConditionTrue, "Promoted", "")
+	log.Info("promoted the standby cluster to primary", "virtualCluster", name)
+	return nil
+}
+
+// status returns the status of the stream, with its lag behind the current
+// time once the initial scan is done.
+func (r replication) status(stream clustersql.ReplicationStream) *api.ReplicationStatus {
+	status := &api.ReplicationStatus{VirtualCluster: stream.VirtualCluster, Status: stream.Status}
+	if !stream.ReplicatedTime.IsZero() {
+		replicated := metav1.NewTime(stream.ReplicatedTime)
+		status.ReplicatedTime = &replicated
+
+		lag := r.now().Sub(stream.ReplicatedTime).Round(time.Second)
+		if lag < 0 {
+			lag = 0
+		}
+		status.Lag = &metav1.Duration{Duration: lag}
+	}
+	if !stream.RetainedTime.IsZero() {
+		retained := metav1.NewTime(stream.RetainedTime)
+		status.RetainedTime = &retained
+	}
+	return status
+}
@@ -0,0 +1,683 @@
+/*
+Copyright 2021 The Cockroach Authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    https://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package actor
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	api "github.com/cockroachdb/cockroach-operator/apis/v1alpha1"
+	"github.com/cockroachdb/cockroach-operator/pkg/clustersql"
+	"github.com/cockroachdb/cockroach-operator/pkg/features"
+	"github.com/cockroachdb/cockroach-operator/pkg/kube"
+	"github.com/cockroachdb/cockroach-operator/pkg/resource"
+	"github.com/cockroachdb/cockroach-operator/pkg/utilfeature"
+	"github.com/cockroachdb/errors"
+	appsv1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	kubetypes "k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/rest"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+// requestedOperationInterval is how often a running requested operation is
+// checked.
+const requestedOperationInterval = 30 * time.Second
+
+func newRequestedOperations(scheme *runtime.Scheme, cl client.Client, config *rest.Config) Actor {
+	o := &requestedOperations{
+		action: newAction("requestedOperations", scheme, cl),
+		now:    time.Now,
+	}
+	o.db = func(ctx context.Context, cluster *resource.Cluster) (*sql.DB, error) {
+		return openDatabase(ctx, cl, config, cluster)
+	}
+	o.rotateCerts = func(ctx context.Context, cluster *resource.Cluster) error {
+		g := newGenerateCert(scheme, cl, config).(*generateCert)
+		g.rotate = true
+		return g.Act(ctx, cluster)
+	}
+	o.rotateCA = func(ctx context.Context, cluster *resource.Cluster, phase api.CARotationPhase) error {
+		return newCARotation(cl, o.log).run(ctx, cluster, phase)
+	}
+	o.decommissionNode = func(ctx context.Context, cluster *resource.Cluster, id int) error {
+		return startNodeDecommission(ctx, config, o.log, cluster, 0, id)
+	}
+	return o
+}
+
+// requestedOperations runs the operations requested with the operation
+// annotation, one at a time, and reports their progress in the status: a
+// rolling restart, a backup into the backup volume, a rotation of the
+// certificates or of the CA, the replacement of the store of a pod or the
+// decommission of the node of a pod
+type requestedOperations struct {
+	action
+
+	// db opens a connection to the cluster
+	db func(ctx context.Context, cluster *resource.Cluster) (*sql.DB, error)
+	// rotateCerts issues new node and client certificates
+	rotateCerts func(ctx context.Context, cluster *resource.Cluster) error
+	// rotateCA runs a phase of the rotation of the CA
+	rotateCA func(ctx context.Context, cluster *resource.Cluster, phase api.CARotationPhase) error
+	// decommissionNode starts the decommission of the node with the ID
+	decommissionNode func(ctx context.Context, cluster *resource.Cluster, id int) error
+	now              func() time.Time
+}
+
+// GetActionType returns api.RequestedOperationAction used to set the cluster status errors
+func (o requestedOperations) GetActionType() api.ActionType {
+	return api.RequestedOperationAction
+}
+
+func (o requestedOperations) Act(ctx context.Context, cluster *resource.Cluster) error {
+	log := o.log.WithValues("CrdbCluster", cluster.ObjectKey())
+
+	if running := cluster.RunningOperation(); running != nil {
+		return o.track(ctx, cluster, *running)
+	}
+
+	value := cluster.GetAnnotationOperation()
+	if value == "" {
+		return nil
+	}
+
+	op, err := resource.ParseOperation(value)
+	if op.ID == "" {
+		log.Info("ignoring the operation annotation", "value", value, "reason", err.Error())
+		return nil
+	}
+	if cluster.RequestedOperation(op.ID) != nil {
+		log.V(DEBUGLEVEL).Info("the requested operation already ran", "id", op.ID)
+		return nil
+	}
+	if err != nil {
+		return o.fail(ctx, cluster, op, err.Error())
+	}
+
+	log.Info("starting the requested operation", "id", op.ID, "type", op.Type, "argument", op.Argument)
+	switch op.Type {
+	case api.OperationRollingRestart:
+		return o.startRestart(ctx, cluster, op, "restarting the pods")
+	case api.OperationBackup:
+		return o.startBackup(ctx, cluster, op)
+	case api.OperationRotateCerts:
+		return o.startRotateCerts(ctx, cluster, op)
+	case api.OperationRotateCA:
+		return o.startRotateCA(ctx, cluster, op)
+	case api.OperationReplaceNode:
+		return o.startReplaceNode(ctx, cluster, op)
+	case api.OperationDecommissionNode:
+		return o.startDecommissionNode(ctx, cluster, op)
+	}
+	return nil
+}
+
+// track checks whether the running operation is over.
+func (o requestedOperations) track(ctx context.Context, cluster *resource.Cluster, op api.RequestedOperation) error {
+	switch op.Type {
+	case api.OperationRollingRestart:
+		if cluster.Failed(api.ClusterRestartAction) {
+			return o.fail(ctx, cluster, op, "the rolling restart failed, see status.operatorActions")
+		}
+		if cluster.GetAnnotationRestartType() != "" {
+			return o.wait(op)
+		}
+		return o.succeed(ctx, cluster, op, "the pods were restarted")
+
+	case api.OperationRotateCerts:
+		if cluster.Failed(api.ClusterRestartAction) {
+			return o.fail(ctx, cluster, op, "the rolling restart failed, see status.operatorActions")
+		}
+		if cluster.GetAnnotationRestartType() != "" || cluster.GetAnnotationCertReload() != "" {
+			return o.wait(op)
+		}
+		return o.succeed(ctx, cluster, op, "the nodes loaded the new certificates")
+
+	case api.OperationRotateCA:
+		if cluster.Failed(api.ClusterRestartAction) {
+			return o.fail(ctx, cluster, op, "the rolling restart failed, see status.operatorActions, request RotateCA again to resume the rotation")
+		}
+		if cluster.GetAnnotationRestartType() != "" {
+			return o.wait(op)
+		}
+		return o.nextCAPhase(ctx, cluster, op)
+
+	case api.OperationBackup:
+		db, err := o.db(ctx, cluster)
+		if err != nil {
+			return o.retry(err)
+		}
+		defer db.Close()
+
+		job, err := clustersql.GetJob(ctx, db, op.JobID)
+		if err != nil {
+			return o.retry(err)
+		}
+		if !job.Finished() {
+			return o.wait(op)
+		}
+		if job.Status != clustersql.JobSucceeded {
+			return o.fail(ctx, cluster, op, fmt.Sprintf("backup job %d %s: %s", job.ID, job.Status, job.Error))
+		}
+		return o.succeed(ctx, cluster, op, fmt.Sprintf("backup taken into %s", backupCollection(op)))
+
+	case api.OperationReplaceNode:
+		pod := &corev1.Pod{}
+		key := kubetypes.NamespacedName{Namespace: cluster.Namespace(), Name: replacedPodName(cluster, op)}
+		if err := o.client.Get(ctx, key, pod); err != nil {
+			if apierrors.IsNotFound(err) {
+				return o.wait(op)
+			}
+			return errors.Wrapf(err, "failed to get pod %s", key.Name)
+		}
+		if pod.CreationTimestamp.Before(&op.StartedAt) || !kube.IsPodReady(pod) {
+			return o.wait(op)
+		}
+		return o.succeed(ctx, cluster, op, fmt.Sprintf("pod %s is ready with a new store", pod.Name))
+
+	case api.OperationDecommissionNode:
+		return o.trackDecommissionNode(ctx, cluster, op)
+	}
+	return nil
+}
+
+// startRestart sets the restart type annotation, like for a manual restart,
+// so that the cluster restart actor restarts the pods one at a time.
+func (o requestedOperations) startRestart(ctx context.Context, cluster *resource.Cluster, op api.RequestedOperation, message string) error {
+	if !utilfeature.DefaultMutableFeatureGate.Enabled(features.ClusterRestart) {
+		return o.fail(ctx, cluster, op, "the ClusterRestart feature gate is disabled")
+	}
+
+	// the annotations are updated, so the other actors must wait for the next loop
+	cr := resource.ClusterPlaceholder(cluster.Name())
+	if err := resource.NewKubeFetcher(ctx, cluster.Namespace(), o.client).Fetch(cr); err != nil {
+		return errors.Wrap(err, "failed to fetch the CrdbCluster")
+	}
+	metav1.SetMetaDataAnnotation(&cr.ObjectMeta, resource.CrdbRestartTypeAnnotation, api.ClusterRestartType(api.RollingRestart).String())
+	if err := o.client.Update(ctx, cr); err != nil {
+		return errors.Wrap(err, "failed to start the rolling restart")
+	}
+	cluster.SetResourceVersion(cr.ResourceVersion)
+
+	op.State = api.OperationRunning
+	op.Message = message
+	o.save(ctx, cluster, op)
+
+	CancelLoop(ctx)
+	return nil
+}
+
+// startBackup takes a full backup of the cluster into a collection of the
+// backup volume named after the operation.
+func (o requestedOperations) startBackup(ctx context.Context, cluster *resource.Cluster, op api.RequestedOperation) error {
+	if cluster.Spec().BackupVolume == nil {
+		return o.fail(ctx, cluster, op, "Backup needs the backupVolume of the spec")
+	}
+
+	db, err := o.db(ctx, cluster)
+	if err != nil {
+		return o.retry(err)
+	}
+	defer db.Close()
+
+	id, err := clustersql.StartBackup(ctx, db, backupCollection(op))
+	if err != nil {
+		return o.fail(ctx, cluster, op, err.Error())
+	}
+
+	op.State = api.OperationRunning
+	op.JobID = id
+	op.Message = fmt.Sprintf("backing up into %s", backupCollection(op))
+	o.save(ctx, cluster, op)
+	return o.wait(op)
+}
+
+// startRotateCerts issues new node and client certificates signed by the CA
+// of the cluster, and restarts the pods for them to load the certificates, or
+// has the nodes reload them with the SIGHUP reload of the certificate rotation.
+func (o requestedOperations) startRotateCerts(ctx context.Context, cluster *resource.Cluster, op api.RequestedOperation) error {
+	if !cluster.Spec().TLSEnabled {
+		return o.fail(ctx, cluster, op, "the cluster does not use TLS")
+	}
+	if cluster.Spec().NodeTLSSecret != "" {
+		return o.fail(ctx, cluster, op, "the certificates are not issued by the operator, rotate them in the secrets of the spec")
+	}
+	if cluster.Status().CARotation != nil {
+		return o.fail(ctx, cluster, op, "the rotation of the CA is not over, request RotateCA again to resume it")
+	}
+	sighup := cluster.Spec().CertificateRotation.ReloadOrDefault() == api.CertificateReloadSIGHUP
+	if !sighup && !utilfeature.DefaultMutableFeatureGate.Enabled(features.ClusterRestart) {
+		return o.fail(ctx, cluster, op, "the ClusterRestart feature gate is disabled")
+	}
+	if cluster.GetAnnotationRestartType() != "" {
+		return o.retry(errors.New("waiting for the running restart to finish"))
+	}
+	if cluster.GetAnnotationCertReload() != "" {
+		return o.retry(errors.New("waiting for the nodes to reload the certificates"))
+	}
+
+	// the certificates are issued right away, so the rotation waits for the
+	// maintenance window rather than only its restart
+	wait, err := cluster.UntilMaintenanceWindow(o.now())
+	if err != nil {
+		return o.fail(ctx, cluster, op, err.Error())
+	}
+	if wait > 0 {
+		return DeferredErr{Err: errors.Newf("the maintenance window opens in %s", wait.Round(time.Second)), RequeueAfter: wait}
+	}
+
+	if err := o.rotateCerts(ctx, cluster); err != nil {
+		// the certificates signed by an external CA take several loops
+		if _, ok := err.(DeferredErr); ok {
+			return err
+		}
+		return o.fail(ctx, cluster, op, errors.Wrap(err, "failed to issue the certificates").Error())
+	}
+	fingerprint, err := nodeCertFingerprint(ctx, o.client, cluster)
+	if err != nil {
+		return err
+	}
+	// the annotations are updated, so the other actors must wait for the next loop
+	if err := setCertAnnotations(ctx, o.client, cluster, fingerprint, true); err != nil {
+		return err
+	}
+
+	op.State = api.OperationRunning
+	op.Message = "new certificates issued, restarting the pods"
+	if sighup {
+		op.Message = "new certificates issued, reloading them in the running pods"
+	}
+	o.save(ctx, cluster, op)
+
+	CancelLoop(ctx)
+	return nil
+}
+
+// startRotateCA starts the rotation of the CA the operator generated, or
+// resumes it from the phase of the status after it failed.
+func (o requestedOperations) startRotateCA(ctx context.Context, cluster *resource.Cluster, op api.RequestedOperation) error {
+	if !cluster.Spec().TLSEnabled {
+		return o.fail(ctx, cluster, op, "the cluster does not use TLS")
+	}
+	if cluster.Spec().NodeTLSSecret != "" || cluster.Spec().VaultPKI != nil || cluster.Spec().ExternalCA != nil {
+		return o.fail(ctx, cluster, op, "the CA is not generated by the operator")
+	}
+	if cluster.Spec().SplitCA != nil {
+		return o.fail(ctx, cluster, op, "the rotation of split CAs is not supported")
+	}
+	if mc := cluster.Spec().MultiCluster; mc != nil && mc.CASecret != "" {
+		return o.fail(ctx, cluster, op, "the rotation of the CA shared by the regions is not supported")
+	}
+	if !utilfeature.DefaultMutableFeatureGate.Enabled(features.ClusterRestart) {
+		return o.fail(ctx, cluster, op, "the ClusterRestart feature gate is disabled")
+	}
+	if cluster.GetAnnotationRestartType() != "" {
+		return o.retry(errors.New("waiting for the running restart to finish"))
+	}
+
+	wait, err := cluster.UntilMaintenanceWindow(o.now())
+	if err != nil {
+		return o.fail(ctx, cluster, op, err.Error())
+	}
+	if wait > 0 {
+		return DeferredErr{Err: errors.Newf("the maintenance window opens in %s", wait.Round(time.Second)), RequeueAfter: wait}
+	}
+
+	phase := api.CARotationPhases[0]
+	if rotation := cluster.Status().CARotation; rotation != nil {
+		phase = rotation.Phase
+	}
+	return o.runCAPhase(ctx, cluster, op, phase)
+}
+
+// nextCAPhase runs the phase of the rotation of the CA after the one whose
+// restart is over, and succeeds after the last one.
+func (o requestedOperations) nextCAPhase(ctx context.Context, cluster *resource.Cluster, op api.RequestedOperation) error {
+	rotation := cluster.Status().CARotation
+	if rotation == nil {
+		return o.fail(ctx, cluster, op, "the status of the rotation of the CA is missing")
+	}
+
+	for i, phase := range api.CARotationPhases[:len(api.CARotationPhases)-1] {
+		if phase == rotation.Phase {
+			return o.runCAPhase(ctx, cluster, op, api.CARotationPhases[i+1])
+		}
+	}
+	cluster.SetCARotationStatus(nil, metav1.NewTime(o.now()))
+	return o.succeed(ctx, cluster, op, "the CA was rotated, the old CA is retired")
+}
+
+// runCAPhase runs the phase of the rotation of the CA, records it in the
+// status and restarts the pods for the nodes to load the secrets. A phase that
+// failed runs again when the rotation resumes.
+func (o requestedOperations) runCAPhase(ctx context.Context, cluster *resource.Cluster, op api.RequestedOperation, phase api.CARotationPhase) error {
+	if err := o.rotateCA(ctx, cluster, phase); err != nil {
+		return o.fail(ctx, cluster, op, errors.Wrapf(err, "the %s phase of the CA rotation failed, request RotateCA again to resume it", phase).Error())
+	}
+
+	cluster.SetCARotationStatus(&api.CARotationStatus{Phase: phase, OperationID: op.ID}, metav1.NewTime(o.now()))
+	return o.startRestart(ctx, cluster, op, caPhaseMessages[phase])
+}
+
+// caPhaseMessages are the messages of the operation while the pods restart
+// after each phase of the rotation of the CA.
+var caPhaseMessages = map[api.CARotationPhase]string{
+	api.CARotationTrustBundle: "the nodes trust the old and the new CA, restarting the pods",
+	api.CARotationReissue:     "the certificates are signed by the new CA, restarting the pods",
+	api.CARotationRetireOldCA: "the old CA is retired, restarting the pods",
+}
+
+// startReplaceNode deletes the pod of the ordinal with its PVCs, so that it
+// starts again with an empty store. The other pods must be ready, for the
+// ranges of the store to be up-replicated from them.
+func (o requestedOperations) startReplaceNode(ctx context.Context, cluster *resource.Cluster, op api.RequestedOperation) error {
+	log := o.log.WithValues("CrdbCluster", cluster.ObjectKey())
+
+	ss, err := o.replacedStatefulSet(ctx, cluster, op)
+	if err != nil || ss == nil {
+		return err
+	}
+
+	pod := &corev1.Pod{}
+	podKey := kubetypes.NamespacedName{Namespace: cluster.Namespace(), Name: replacedPodName(cluster, op)}
+	if err := o.client.Get(ctx, podKey, pod); err != nil {
+		return errors.Wrapf(err, "failed to get pod %s", podKey.Name)
+	}
+
+	othersReady := ss.Status.ReadyReplicas
+	if kube.IsPodReady(pod) {
+		othersReady--
+	}
+	if othersReady < *ss.Spec.Replicas-1 {
+		return o.fail(ctx, cluster, op, fmt.Sprintf("%d of the other %d pods are ready, replacing the store of pod %s could lose the quorum of some ranges",
+			othersReady, *ss.Spec.Replicas-1, pod.Name))
+	}
+
+	start := o.now()
+	if err := reserveOperation(ctx, o.client, log, cluster, o.GetActionType(), start); err != nil {
+		return err
+	}
+
+	log.Info("replacing the store of a pod", "pod", pod.Name)
+	if err := replaceStore(ctx, o.client, ss, pod); err != nil {
+		return releaseOperation(ctx, o.client, log, cluster, o.GetActionType(), start, err)
+	}
+
+	op.State = api.OperationRunning
+	op.Message = fmt.Sprintf("replacing the store of pod %s", pod.Name)
+	o.save(ctx, cluster, op)
+	return o.wait(op)
+}
+
+// startDecommissionNode starts the decommission of the node of the pod of the
+// ordinal. Its replicas move to the other nodes, which must be enough for the
+// replication factor of every zone, and every range must have all of its
+// replicas.
+func (o requestedOperations) startDecommissionNode(ctx context.Context, cluster *resource.Cluster, op api.RequestedOperation) error {
+	log := o.log.WithValues("CrdbCluster", cluster.ObjectKey())
+
+	ss, err := o.replacedStatefulSet(ctx, cluster, op)
+	if err != nil || ss == nil {
+		return err
+	}
+	if len(ss.Spec.VolumeClaimTemplates) == 0 {
+		return o.fail(ctx, cluster, op, "the stores of the pods are not in PVCs, the pod could not join as a new node")
+	}
+
+	db, err := o.db(ctx, cluster)
+	if err != nil {
+		return o.retry(err)
+	}
+	defer db.Close()
+
+	nodes, err := clustersql.Nodes(ctx, db)
+	if err != nil {
+		return o.retry(err)
+	}
+	podName := replacedPodName(cluster, op)
+	node, found := nodeOfPod(nodes, podName)
+	if !found || node.Decommissioning {
+		return o.fail(ctx, cluster, op, fmt.Sprintf("pod %s runs no node that can be decommissioned", podName))
+	}
+
+	others := 0
+	for _, n := range nodes {
+		if n.ID != node.ID && n.IsLive && !n.Decommissioning {
+			others++
+		}
+	}
+	zones, err := clustersql.ZoneConfigs(ctx, db)
+	if err != nil {
+		return o.retry(err)
+	}
+	if replicas, target := clustersql.MaxReplicationFactor(zones); others < int(replicas) {
+		return o.fail(ctx, cluster, op, fmt.Sprintf("%d other nodes are live, fewer than the %d replicas of %s", others, replicas, target))
+	}
+
+	replication, err := clustersql.ReplicationStatus(ctx, db)
+	if err != nil {
+		return o.retry(err)
+	}
+	if !replication.FullyReplicated() {
+		return o.fail(ctx, cluster, op, fmt.Sprintf("%d ranges are under-replicated, %d are unavailable, decommissioning node %d could lose some of them",
+			replication.UnderReplicated, replication.Unavailable, node.ID))
+	}
+
+	start := o.now()
+	if err := reserveOperation(ctx, o.client, log, cluster, o.GetActionType(), start); err != nil {
+		return err
+	}
+
+	log.Info("decommissioning the node of a pod", "pod", podName, "NodeID", node.ID)
+	if err := o.decommissionNode(ctx, cluster, node.ID); err != nil {
+		err = o.fail(ctx, cluster, op, errors.Wrapf(err, "failed to decommission node %d", node.ID).Error())
+		return releaseOperation(ctx, o.client, log, cluster, o.GetActionType(), start, err)
+	}
+
+	op.State = api.OperationRunning
+	op.NodeID = int32(node.ID)
+	op.Message = fmt.Sprintf("decommissioning node %d of pod %s", node.ID, podName)
+	o.save(ctx, cluster, op)
+	return o.wait(op)
+}
+
+// trackDecommissionNode replaces the store of the pod once its node has no
+// replicas left, so that the pod joins the cluster as a new node, and succeeds
+// once the new node runs and the pod is ready.
+func (o requestedOperations) trackDecommissionNode(ctx context.Context, cluster *resource.Cluster, op api.RequestedOperation) error {
+	log := o.log.WithValues("CrdbCluster", cluster.ObjectKey())
+
+	db, err := o.db(ctx, cluster)
+	if err != nil {
+		return o.retry(err)
+	}
+	defer db.Close()
+
+	nodes, err := clustersql.Nodes(ctx, db)
+	if err != nil {
+		return o.retry(err)
+	}
+
+	pod := &corev1.Pod{}
+	key := kubetypes.NamespacedName{Namespace: cluster.Namespace(), Name: replacedPodName(cluster, op)}
+	if err := o.client.Get(ctx, key, pod); err != nil {
+		if apierrors.IsNotFound(err) {
+			return o.wait(op)
+		}
+		return errors.Wrapf(err, "failed to get pod %s", key.Name)
+	}
+
+	if node, found := nodeOfPod(nodes, pod.Name); found && node.ID != int(op.NodeID) {
+		if !kube.IsPodReady(pod) {
+			return o.wait(op)
+		}
+		return o.succeed(ctx, cluster, op, fmt.Sprintf("node %d was decommissioned, pod %s is ready with node %d", op.NodeID, pod.Name, node.ID))
+	}
+
+	for _, n := range nodes {
+		if n.ID == int(op.NodeID) && !n.Decommissioning {
+			return o.fail(ctx, cluster, op, fmt.Sprintf("node %d is no longer decommissioning", op.NodeID))
+		}
+	}
+
+	replicas, err := clustersql.NodeReplicas(ctx, db, int(op.NodeID))
+	if err != nil {
+		return o.retry(err)
+	}
+	if replicas > 0 {
+		return o.wait(op)
+	}
+
+	ss := &appsv1.StatefulSet{}
+	name, _ := replacedPod(cluster, op)
+	ssKey := kubetypes.NamespacedName{Namespace: cluster.Namespace(), Name: name}
+	if err := o.client.Get(ctx, ssKey, ss); err != nil {
+		return errors.Wrap(err, "failed to fetch statefulset")
+	}
+
+	// the store is replaced once, the PVCs created since then are those of
+	// the new node
+	replaced, err := o.claimsCreatedSince(ctx, ss, pod, op.StartedAt)
+	if err != nil || replaced || pod.DeletionTimestamp != nil {
+		return o.wait(op)
+	}
+
+	log.Info("replacing the store of a decommissioned node", "pod", pod.Name, "NodeID", op.NodeID)
+	if err := replaceStore(ctx, o.client, ss, pod); err != nil {
+		return err
+	}
+	return o.wait(op)
+}
+
+// replacedStatefulSet returns the statefulset of the pod whose store the
+// operation replaces. It fails the operation, and returns nil, when the
+// argument is not the ordinal of one of its pods.
+func (o requestedOperations) replacedStatefulSet(ctx context.Context, cluster *resource.Cluster, op api.RequestedOperation) (*appsv1.StatefulSet, error) {
+	name, arg := replacedPod(cluster, op)
+	ss := &appsv1.StatefulSet{}
+	key := kubetypes.NamespacedName{Namespace: cluster.Namespace(), Name: name}
+	if err := o.client.Get(ctx, key, ss); err != nil {
+		if apierrors.IsNotFound(err) && name != cluster.StatefulSetName() {
+			return nil, o.fail(ctx, cluster, op, fmt.Sprintf("invalid node pool in %q", op.Argument))
+		}
+		return nil, errors.Wrap(err, "failed to fetch statefulset")
+	}
+
+	ordinal, err := strconv.Atoi(arg)
+	if err != nil || ordinal < 0 || ordinal >= int(*ss.Spec.Replicas) {
+		return nil, o.fail(ctx, cluster, op, fmt.Sprintf("invalid ordinal %q, statefulset %s has %d pods", op.Argument, ss.Name, *ss.Spec.Replicas))
+	}
+	return ss, nil
+}
+
+// claimsCreatedSince returns whether the PVCs of the pod were created after
+// the time, or are gone.
+func (o requestedOperations) claimsCreatedSince(ctx context.Context, ss *appsv1.StatefulSet, pod *corev1.Pod, since metav1.Time) (bool, error) {
+	for _, name := range claims(ss, pod) {
+		pvc := &corev1.PersistentVolumeClaim{}
+		if err := o.client.Get(ctx, kubetypes.NamespacedName{Namespace: pod.Namespace, Name: name}, pvc); err != nil {
+			if apierrors.IsNotFound(err) {
+				return true, nil
+			}
+			return false, errors.Wrapf(err, "failed to get pvc %s", name)
+		}
+		if pvc.CreationTimestamp.Before(&since) {
+			return false, nil
+		}
+	}
+	return true, nil
+}
+
+// backupCollection returns the URI of the collection of the backup of the
+// operation, in the backup volume.
+func backupCollection(op api.RequestedOperation) string {
+	return clustersql.NodelocalURI("operations/" + op.ID)
+}
+
+// replacedPodName returns the name of the pod whose store the operation
+// replaces, or whose node it decommissions.
+func replacedPodName(cluster *resource.Cluster, op api.RequestedOperation) string {
+	statefulSet, ordinal := replacedPod(cluster, op)
+	return fmt.Sprintf("%s-%s", statefulSet, ordinal)
+}
+
+// replacedPod returns the name of the statefulset of the pod whose store the
+// operation replaces, and the ordinal of the pod. The argument is the ordinal
+// of a pod of the nodes, or <pool>/<ordinal> for a pod of a node pool.
+func replacedPod(cluster *resource.Cluster, op api.RequestedOperation) (string, string) {
+	if parts := strings.SplitN(op.Argument, "/", 2); len(parts) == 2 {
+		return cluster.NodePoolStatefulSetName(parts[0]), parts[1]
+	}
+	return cluster.StatefulSetName(), op.Argument
+}
+
+func (o requestedOperations) succeed(ctx context.Context, cluster *resource.Cluster, op api.RequestedOperation, message string) error {
+	o.log.Info("requested operation succeeded", "CrdbCluster", cluster.ObjectKey(), "id", op.ID, "type", op.Type)
+	op.State = api.OperationSucceeded
+	op.Message = message
+	o.save(ctx, cluster, op)
+	return nil
+}
+
+// fail records that the operation failed. It is not retried: the cause must
+// be fixed and the operation requested again with a new ID.
+func (o requestedOperations) fail(ctx context.Context, cluster *resource.Cluster, op api.RequestedOperation, message string) error {
+	o.log.Info("requested operation failed", "CrdbCluster", cluster.ObjectKey(), "id", op.ID, "type", op.Type, "message", message)
+	op.State = api.OperationFailed
+	op.Message = message
+	o.save(ctx, cluster, op)
+	return nil
+}
+
+// save records the progress of the operation and saves it right away, so that
+// an operation that was started is not started again if the reconciliation
+// fails afterwards.
+func (o requestedOperations) save(ctx context.Context, cluster *resource.Cluster, op api.RequestedOperation) {
+	log := o.log.WithValues("CrdbCluster", cluster.ObjectKey())
+	cluster.SetRequestedOperation(op, metav1.NewTime(o.now()))
+
+	cr := resource.ClusterPlaceholder(cluster.Name())
+	if err := resource.NewKubeFetcher(ctx, cluster.Namespace(), o.client).Fetch(cr); err != nil {
+		log.Error(err, "failed to fetch the CrdbCluster to save the requested operation")
+		return
+	}
+
+	status := cluster.Status()
+	cr.Status.RequestedOperations = status.RequestedOperations
+	cr.Status.CARotation = status.CARotation
+	if err := o.client.Status().Update(ctx, cr); err != nil {
+		log.Error(err, "failed to save the requested operation")
+		return
+	}
+	cluster.SetResourceVersion(cr.ResourceVersion)
+}
+
+func (o requestedOperations) wait(op api.RequestedOperation) error {
+	return DeferredErr{Err: errors.Newf("waiting for the requested operation %s", op.ID), RequeueAfter: requestedOperationInterval}
+}
+
+func (o requestedOperations) retry(err error) error {
+	return DeferredErr{Err: err, RequeueAfter: requestedOperationInterval}
+}
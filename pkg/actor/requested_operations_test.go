@@ -0,0 +1,492 @@
+/*
+Copyright 2021 The Cockroach Authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    https://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package actor
+
+import (
+	"context"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/hex"
+	"fmt"
+	"regexp"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	api "github.com/cockroachdb/cockroach-operator/apis/v1alpha1"
+	"github.com/cockroachdb/cockroach-operator/pkg/ptr"
+	"github.com/cockroachdb/cockroach-operator/pkg/resource"
+	"github.com/cockroachdb/cockroach-operator/pkg/testutil"
+	"github.com/cockroachdb/errors"
+	"github.com/stretchr/testify/require"
+	appsv1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/types"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+)
+
+func operationCr(operation string) *api.CrdbCluster {
+	cr := testutil.NewBuilder("crdb").Namespaced("default").WithNodeCount(3).WithTLS().Cr()
+	cr.Annotations = map[string]string{resource.CrdbOperationAnnotation: operation}
+	return cr
+}
+
+func newTestRequestedOperations(t *testing.T, objs ...runtime.Object) *requestedOperations {
+	scheme := testutil.InitScheme(t)
+	cl := fake.NewFakeClientWithScheme(scheme, objs...)
+
+	o := newRequestedOperations(scheme, cl, nil).(*requestedOperations)
+	o.now = func() time.Time { return time.Date(2021, time.June, 2, 20, 30, 0, 0, time.UTC) }
+	o.db = func(context.Context, *resource.Cluster) (*sql.DB, error) {
+		t.Fatal("unexpected connection to the cluster")
+		return nil, nil
+	}
+	o.rotateCerts = func(context.Context, *resource.Cluster) error {
+		t.Fatal("unexpected rotation of the certificates")
+		return nil
+	}
+	o.rotateCA = func(context.Context, *resource.Cluster, api.CARotationPhase) error {
+		t.Fatal("unexpected rotation of the CA")
+		return nil
+	}
+	o.decommissionNode = func(context.Context, *resource.Cluster, int) error {
+		t.Fatal("unexpected decommission of a node")
+		return nil
+	}
+	return o
+}
+
+// savedCluster returns the cluster as saved by the actor.
+func savedCluster(t *testing.T, o *requestedOperations) resource.Cluster {
+	cr := &api.CrdbCluster{}
+	require.NoError(t, o.client.Get(context.Background(), types.NamespacedName{Namespace: "default", Name: "crdb"}, cr))
+	return resource.NewCluster(cr)
+}
+
+func TestRequestedRollingRestart(t *testing.T) {
+	ctx := context.Background()
+	o := newTestRequestedOperations(t, operationCr("r1:RollingRestart"))
+	cluster := savedCluster(t, o)
+
+	require.NoError(t, o.Act(ctx, &cluster))
+	saved := savedCluster(t, o)
+	require.Equal(t, "Rolling", saved.GetAnnotationRestartType())
+	require.Equal(t, api.OperationRunning, saved.RequestedOperation("r1").State)
+
+	// the restart is running
+	err := o.Act(ctx, &saved)
+	require.Equal(t, requestedOperationInterval, err.(DeferredErr).RequeueAfter)
+
+	// the cluster restart actor removed the annotation
+	saved.DeleteRestartTypeAnnotation()
+	require.NoError(t, o.Act(ctx, &saved))
+	saved = savedCluster(t, o)
+	require.Equal(t, api.OperationSucceeded, saved.RequestedOperation("r1").State)
+
+	// the operation is not run again
+	require.NoError(t, o.Act(ctx, &saved))
+	require.Len(t, savedCluster(t, o).Status().RequestedOperations, 1)
+}
+
+func TestRequestedBackup(t *testing.T) {
+	ctx := context.Background()
+	cr := operationCr("b1:Backup")
+	cr.Spec.BackupVolume = &api.BackupVolume{ClaimName: "nfs-backups"}
+	o := newTestRequestedOperations(t, cr)
+	cluster := savedCluster(t, o)
+
+	connect := func(expect func(sqlmock.Sqlmock)) {
+		o.db = func(context.Context, *resource.Cluster) (*sql.DB, error) {
+			db, mock, err := sqlmock.New()
+			require.NoError(t, err)
+			expect(mock)
+			mock.ExpectClose()
+			t.Cleanup(func() { require.NoError(t, mock.ExpectationsWereMet()) })
+			return db, nil
+		}
+	}
+
+	connect(func(mock sqlmock.Sqlmock) {
+		mock.ExpectQuery(regexp.QuoteMeta("BACKUP INTO $1 AS OF SYSTEM TIME '-10s' WITH detached")).
+			WithArgs("nodelocal://1/operations/b1").
+			WillReturnRows(sqlmock.NewRows([]string{"job_id"}).AddRow(42))
+	})
+	err := o.Act(ctx, &cluster)
+	require.Equal(t, requestedOperationInterval, err.(DeferredErr).RequeueAfter)
+	op := savedCluster(t, o).RequestedOperation("b1")
+	require.Equal(t, api.OperationRunning, op.State)
+	require.Equal(t, int64(42), op.JobID)
+
+	connect(expectJob(42, "failed", "permission denied"))
+	require.NoError(t, o.Act(ctx, &cluster))
+	op = savedCluster(t, o).RequestedOperation("b1")
+	require.Equal(t, api.OperationFailed, op.State)
+	require.Equal(t, "backup job 42 failed: permission denied", op.Message)
+}
+
+func TestRequestedRotateCerts(t *testing.T) {
+	ctx := context.Background()
+	o := newTestRequestedOperations(t, operationCr("c1:RotateCerts"))
+	cluster := savedCluster(t, o)
+
+	rotated := false
+	o.rotateCerts = func(context.Context, *resource.Cluster) error {
+		rotated = true
+		return nil
+	}
+
+	require.NoError(t, o.Act(ctx, &cluster))
+	require.True(t, rotated)
+	saved := savedCluster(t, o)
+	require.Equal(t, "Rolling", saved.GetAnnotationRestartType())
+	require.Equal(t, api.OperationRunning, saved.RequestedOperation("c1").State)
+}
+
+func TestRequestedRotateCertsSIGHUP(t *testing.T) {
+	ctx := context.Background()
+	cr := operationCr("c1:RotateCerts")
+	cr.Spec.CertificateRotation = &api.CertificateRotation{Reload: api.CertificateReloadSIGHUP}
+	nodeCert := selfSignedCert(t, time.Now(), time.Now().Add(time.Hour))
+	o := newTestRequestedOperations(t, cr, &corev1.Secret{
+		ObjectMeta: metav1.ObjectMeta{Name: "crdb-node", Namespace: "default"},
+		Data:       map[string][]byte{corev1.TLSCertKey: nodeCert},
+	})
+	cluster := savedCluster(t, o)
+	o.rotateCerts = func(context.Context, *resource.Cluster) error { return nil }
+
+	// the nodes reload the certificates instead of restarting
+	require.NoError(t, o.Act(ctx, &cluster))
+	saved := savedCluster(t, o)
+	sum := sha256.Sum256(nodeCert)
+	require.Equal(t, hex.EncodeToString(sum[:]), saved.GetAnnotationCertReload())
+	require.Empty(t, saved.GetAnnotationRestartType())
+	require.Equal(t, api.OperationRunning, saved.RequestedOperation("c1").State)
+
+	err := o.Act(ctx, &saved)
+	require.Equal(t, requestedOperationInterval, err.(DeferredErr).RequeueAfter)
+
+	// the certificate reload actor removed the annotation
+	cr = saved.Unwrap()
+	delete(cr.Annotations, resource.CrdbCertReloadAnnotation)
+	require.NoError(t, o.client.Update(ctx, cr))
+	saved = savedCluster(t, o)
+	require.NoError(t, o.Act(ctx, &saved))
+	require.Equal(t, api.OperationSucceeded, savedCluster(t, o).RequestedOperation("c1").State)
+}
+
+func TestRequestedRotateCA(t *testing.T) {
+	ctx := context.Background()
+	o := newTestRequestedOperations(t, operationCr("ca1:RotateCA"))
+	cluster := savedCluster(t, o)
+
+	var phases []api.CARotationPhase
+	o.rotateCA = func(_ context.Context, _ *resource.Cluster, phase api.CARotationPhase) error {
+		phases = append(phases, phase)
+		return nil
+	}
+
+	// each phase restarts the pods before the next one runs
+	require.NoError(t, o.Act(ctx, &cluster))
+	for _, phase := range api.CARotationPhases {
+		saved := savedCluster(t, o)
+		require.Equal(t, "Rolling", saved.GetAnnotationRestartType())
+		require.Equal(t, phase, saved.Status().CARotation.Phase)
+		require.Equal(t, "ca1", saved.Status().CARotation.OperationID)
+		require.Equal(t, api.OperationRunning, saved.RequestedOperation("ca1").State)
+
+		err := o.Act(ctx, &saved)
+		require.Equal(t, requestedOperationInterval, err.(DeferredErr).RequeueAfter)
+
+		// the cluster restart actor removes the annotation
+		cr := saved.Unwrap()
+		delete(cr.Annotations, resource.CrdbRestartTypeAnnotation)
+		require.NoError(t, o.client.Update(ctx, cr))
+		saved = savedCluster(t, o)
+		require.NoError(t, o.Act(ctx, &saved))
+	}
+
+	require.Equal(t, api.CARotationPhases, phases)
+	saved := savedCluster(t, o)
+	require.Nil(t, saved.Status().CARotation)
+	require.Equal(t, api.OperationSucceeded, saved.RequestedOperation("ca1").State)
+	require.Empty(t, saved.GetAnnotationRestartType())
+}
+
+func TestRequestedRotateCAResumes(t *testing.T) {
+	ctx := context.Background()
+	cr := operationCr("ca2:RotateCA")
+	cr.Status.CARotation = &api.CARotationStatus{Phase: api.CARotationReissue, OperationID: "ca1"}
+	cr.Status.RequestedOperations = []api.RequestedOperation{
+		{ID: "ca1", Type: api.OperationRotateCA, State: api.OperationFailed},
+	}
+	o := newTestRequestedOperations(t, cr)
+	cluster := savedCluster(t, o)
+
+	// the phase that failed fails the operation again, and is kept
+	o.rotateCA = func(context.Context, *resource.Cluster, api.CARotationPhase) error {
+		return errors.New("secrets is forbidden")
+	}
+	require.NoError(t, o.Act(ctx, &cluster))
+	saved := savedCluster(t, o)
+	require.Equal(t, api.OperationFailed, saved.RequestedOperation("ca2").State)
+	require.Contains(t, saved.RequestedOperation("ca2").Message, "the Reissue phase of the CA rotation failed")
+	require.Equal(t, "ca1", saved.Status().CARotation.OperationID)
+	require.Empty(t, saved.GetAnnotationRestartType())
+
+	// the certificates are not rotated with the old CA meanwhile
+	cr = saved.Unwrap()
+	cr.Annotations[resource.CrdbOperationAnnotation] = "c1:RotateCerts"
+	require.NoError(t, o.client.Update(ctx, cr))
+	saved = savedCluster(t, o)
+	require.NoError(t, o.Act(ctx, &saved))
+	require.Equal(t, api.OperationFailed, savedCluster(t, o).RequestedOperation("c1").State)
+
+	// a new request resumes the rotation from its phase
+	var phases []api.CARotationPhase
+	o.rotateCA = func(_ context.Context, _ *resource.Cluster, phase api.CARotationPhase) error {
+		phases = append(phases, phase)
+		return nil
+	}
+	cr = savedCluster(t, o).Unwrap()
+	cr.Annotations[resource.CrdbOperationAnnotation] = "ca3:RotateCA"
+	require.NoError(t, o.client.Update(ctx, cr))
+	saved = savedCluster(t, o)
+	require.NoError(t, o.Act(ctx, &saved))
+	require.Equal(t, []api.CARotationPhase{api.CARotationReissue}, phases)
+	saved = savedCluster(t, o)
+	require.Equal(t, "ca3", saved.Status().CARotation.OperationID)
+	require.Equal(t, "Rolling", saved.GetAnnotationRestartType())
+}
+
+func TestRequestedReplaceNode(t *testing.T) {
+	ctx := context.Background()
+	ss := &appsv1.StatefulSet{
+		ObjectMeta: metav1.ObjectMeta{Namespace: "default", Name: "crdb"},
+		Spec: appsv1.StatefulSetSpec{
+			Replicas: ptr.Int32(3),
+			VolumeClaimTemplates: []corev1.PersistentVolumeClaim{
+				{ObjectMeta: metav1.ObjectMeta{Name: "datadir"}},
+			},
+		},
+		Status: appsv1.StatefulSetStatus{ReadyReplicas: 2},
+	}
+	pod := &corev1.Pod{ObjectMeta: metav1.ObjectMeta{Namespace: "default", Name: "crdb-2"}}
+	pvc := &corev1.PersistentVolumeClaim{ObjectMeta: metav1.ObjectMeta{Namespace: "default", Name: "datadir-crdb-2"}}
+
+	tests := []struct {
+		name      string
+		operation string
+		ready     int32
+		state     api.OperationState
+		message   string
+		deleted   bool
+	}{
+		{
+			name:      "the store of the pod is replaced",
+			operation: "n1:ReplaceNode:2",
+			ready:     2,
+			state:     api.OperationRunning,
+			message:   "replacing the store of pod crdb-2",
+			deleted:   true,
+		},
+		{
+			name:      "the other pods are not ready",
+			operation: "n1:ReplaceNode:2",
+			ready:     1,
+			state:     api.OperationFailed,
+			message:   "1 of the other 2 pods are ready, replacing the store of pod crdb-2 could lose the quorum of some ranges",
+		},
+		{
+			name:      "the ordinal is out of range",
+			operation: "n1:ReplaceNode:3",
+			ready:     3,
+			state:     api.OperationFailed,
+			message:   `invalid ordinal "3", statefulset crdb has 3 pods`,
+		},
+		{
+			name:      "the node pool does not exist",
+			operation: "n1:ReplaceNode:west/0",
+			ready:     3,
+			state:     api.OperationFailed,
+			message:   `invalid node pool in "west/0"`,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ss := ss.DeepCopy()
+			ss.Status.ReadyReplicas = tt.ready
+			o := newTestRequestedOperations(t, operationCr(tt.operation), ss, pod.DeepCopy(), pvc.DeepCopy())
+			cluster := savedCluster(t, o)
+
+			_ = o.Act(ctx, &cluster)
+			op := savedCluster(t, o).RequestedOperation("n1")
+			require.Equal(t, tt.state, op.State)
+			require.Equal(t, tt.message, op.Message)
+
+			err := o.client.Get(ctx, types.NamespacedName{Namespace: "default", Name: "datadir-crdb-2"}, &corev1.PersistentVolumeClaim{})
+			require.Equal(t, tt.deleted, err != nil)
+		})
+	}
+}
+
+func TestRequestedDecommissionNode(t *testing.T) {
+	ctx := context.Background()
+	ss := &appsv1.StatefulSet{
+		ObjectMeta: metav1.ObjectMeta{Namespace: "default", Name: "crdb"},
+		Spec: appsv1.StatefulSetSpec{
+			Replicas: ptr.Int32(4),
+			VolumeClaimTemplates: []corev1.PersistentVolumeClaim{
+				{ObjectMeta: metav1.ObjectMeta{Name: "datadir"}},
+			},
+		},
+	}
+	pod := &corev1.Pod{ObjectMeta: metav1.ObjectMeta{Namespace: "default", Name: "crdb-2"}}
+	pvc := &corev1.PersistentVolumeClaim{ObjectMeta: metav1.ObjectMeta{Namespace: "default", Name: "datadir-crdb-2"}}
+	o := newTestRequestedOperations(t, operationCr("d1:DecommissionNode:2"), ss, pod, pvc)
+	cluster := savedCluster(t, o)
+
+	connect := func(expect func(sqlmock.Sqlmock)) {
+		o.db = func(context.Context, *resource.Cluster) (*sql.DB, error) {
+			db, mock, err := sqlmock.New()
+			require.NoError(t, err)
+			expect(mock)
+			mock.ExpectClose()
+			t.Cleanup(func() { require.NoError(t, mock.ExpectationsWereMet()) })
+			return db, nil
+		}
+	}
+	expectNodes := func(mock sqlmock.Sqlmock, decommissioning bool, newNode bool) {
+		rows := sqlmock.NewRows([]string{"node_id", "address", "is_live", "decommissioning", "updated_at"})
+		for i := 0; i < 4; i++ {
+			rows.AddRow(i+1, fmt.Sprintf("crdb-%d.crdb.default:26257", i), true, decommissioning && i == 2, time.Time{})
+		}
+		if newNode {
+			rows.AddRow(5, "crdb-2.crdb.default:26257", true, false, time.Time{})
+		}
+		mock.ExpectQuery(regexp.QuoteMeta("SELECT n.node_id, n.address")).WillReturnRows(rows)
+	}
+	expectReplicas := func(mock sqlmock.Sqlmock, replicas int) {
+		mock.ExpectQuery(regexp.QuoteMeta("SELECT COALESCE(sum(range_count), 0) FROM crdb_internal.kv_store_status WHERE node_id = $1")).
+			WithArgs(3).
+			WillReturnRows(sqlmock.NewRows([]string{"sum"}).AddRow(replicas))
+	}
+
+	// the node of the pod is decommissioned
+	var decommissioned []int
+	o.decommissionNode = func(_ context.Context, _ *resource.Cluster, id int) error {
+		decommissioned = append(decommissioned, id)
+		return nil
+	}
+	connect(func(mock sqlmock.Sqlmock) {
+		expectNodes(mock, false, false)
+		mock.ExpectQuery("SELECT target, full_config_yaml FROM crdb_internal.zones").
+			WillReturnRows(sqlmock.NewRows([]string{"target", "full_config_yaml"}).AddRow("RANGE default", "num_replicas: 3\n"))
+		mock.ExpectQuery(regexp.QuoteMeta("SELECT COALESCE(sum((metrics->>'ranges.underreplicated')::INT8), 0)")).
+			WillReturnRows(sqlmock.NewRows([]string{"underreplicated", "unavailable"}).AddRow(0, 0))
+	})
+	err := o.Act(ctx, &cluster)
+	require.Equal(t, requestedOperationInterval, err.(DeferredErr).RequeueAfter)
+	require.Equal(t, []int{3}, decommissioned)
+	op := savedCluster(t, o).RequestedOperation("d1")
+	require.Equal(t, api.OperationRunning, op.State)
+	require.Equal(t, int32(3), op.NodeID)
+	require.Equal(t, "decommissioning node 3 of pod crdb-2", op.Message)
+
+	// the node still has replicas
+	connect(func(mock sqlmock.Sqlmock) {
+		expectNodes(mock, true, false)
+		expectReplicas(mock, 12)
+	})
+	require.IsType(t, DeferredErr{}, o.Act(ctx, &cluster))
+	require.NoError(t, o.client.Get(ctx, types.NamespacedName{Namespace: "default", Name: "datadir-crdb-2"}, &corev1.PersistentVolumeClaim{}))
+
+	// the store of the pod is replaced once the node has no replicas left
+	connect(func(mock sqlmock.Sqlmock) {
+		expectNodes(mock, true, false)
+		expectReplicas(mock, 0)
+	})
+	require.IsType(t, DeferredErr{}, o.Act(ctx, &cluster))
+	require.Error(t, o.client.Get(ctx, types.NamespacedName{Namespace: "default", Name: "datadir-crdb-2"}, &corev1.PersistentVolumeClaim{}))
+	require.Error(t, o.client.Get(ctx, types.NamespacedName{Namespace: "default", Name: "crdb-2"}, &corev1.Pod{}))
+
+	// the pod joins as a new node
+	ready := &corev1.Pod{
+		ObjectMeta: metav1.ObjectMeta{Namespace: "default", Name: "crdb-2"},
+		Status: corev1.PodStatus{
+			Conditions: []corev1.PodCondition{{Type: corev1.PodReady, Status: corev1.ConditionTrue}},
+		},
+	}
+	require.NoError(t, o.client.Create(ctx, ready))
+	connect(func(mock sqlmock.Sqlmock) {
+		expectNodes(mock, true, true)
+	})
+	require.NoError(t, o.Act(ctx, &cluster))
+	op = savedCluster(t, o).RequestedOperation("d1")
+	require.Equal(t, api.OperationSucceeded, op.State)
+	require.Equal(t, "node 3 was decommissioned, pod crdb-2 is ready with node 5", op.Message)
+}
+
+func TestRequestedDecommissionNodeChecksTheReplicationFactor(t *testing.T) {
+	ss := &appsv1.StatefulSet{
+		ObjectMeta: metav1.ObjectMeta{Namespace: "default", Name: "crdb"},
+		Spec: appsv1.StatefulSetSpec{
+			Replicas: ptr.Int32(3),
+			VolumeClaimTemplates: []corev1.PersistentVolumeClaim{
+				{ObjectMeta: metav1.ObjectMeta{Name: "datadir"}},
+			},
+		},
+	}
+	o := newTestRequestedOperations(t, operationCr("d1:DecommissionNode:0"), ss)
+	cluster := savedCluster(t, o)
+
+	o.db = func(context.Context, *resource.Cluster) (*sql.DB, error) {
+		db, mock, err := sqlmock.New()
+		require.NoError(t, err)
+		rows := sqlmock.NewRows([]string{"node_id", "address", "is_live", "decommissioning", "updated_at"})
+		for i := 0; i < 3; i++ {
+			rows.AddRow(i+1, fmt.Sprintf("crdb-%d.crdb.default:26257", i), true, false, time.Time{})
+		}
+		mock.ExpectQuery(regexp.QuoteMeta("SELECT n.node_id, n.address")).WillReturnRows(rows)
+		mock.ExpectQuery("SELECT target, full_config_yaml FROM crdb_internal.zones").
+			WillReturnRows(sqlmock.NewRows([]string{"target", "full_config_yaml"}).AddRow("RANGE default", "num_replicas: 3\n"))
+		mock.ExpectClose()
+		t.Cleanup(func() { require.NoError(t, mock.ExpectationsWereMet()) })
+		return db, nil
+	}
+	o.decommissionNode = func(context.Context, *resource.Cluster, int) error {
+		t.Fatal("unexpected decommission")
+		return nil
+	}
+
+	require.NoError(t, o.Act(context.Background(), &cluster))
+	op := savedCluster(t, o).RequestedOperation("d1")
+	require.Equal(t, api.OperationFailed, op.State)
+	require.Equal(t, "2 other nodes are live, fewer than the 3 replicas of RANGE default", op.Message)
+}
+
+func TestInvalidRequestedOperation(t *testing.T) {
+	o := newTestRequestedOperations(t, operationCr("x1:Upgrade"))
+	cluster := savedCluster(t, o)
+
+	require.NoError(t, o.Act(context.Background(), &cluster))
+	op := savedCluster(t, o).RequestedOperation("x1")
+	require.Equal(t, api.OperationFailed, op.State)
+	require.Contains(t, op.Message, `unknown operation type "Upgrade"`)
+}
@@ -0,0 +1,249 @@
+/*
+Copyright 2021 The Cockroach Authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    https://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package actor
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/cockroachdb/cockroach-operator/pkg/kube"
+	"github.com/cockroachdb/cockroach-operator/pkg/resource"
+	"github.com/cockroachdb/errors"
+	appsv1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	kubetypes "k8s.io/apimachinery/pkg/types"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+// nodeLostAtAnnotation records on a pod when its node was first seen lost.
+const nodeLostAtAnnotation = "crdb.io/node-lost-at"
+
+// lostNode is why a pod cannot run on its node anymore.
+type lostNode struct {
+	reason string
+	// force deletes the pod without waiting for its kubelet to confirm it
+	// stopped, the kubelet is not reachable
+	force bool
+	// replaceStore deletes the PVCs of the pod with it, their local volume is
+	// gone with the node
+	replaceStore bool
+}
+
+// reschedule deletes the pods that stayed on a lost node for the reschedule
+// period, one at a time, so that the statefulset controller recreates them on
+// another node. It returns how long until a pod on a lost node is rescheduled,
+// zero if no pod is on a lost node.
+func (h selfHealing) reschedule(ctx context.Context, cluster *resource.Cluster, statefulSets []appsv1.StatefulSet, pods *corev1.PodList, now time.Time) (time.Duration, error) {
+	log := h.log.WithValues("CrdbCluster", cluster.ObjectKey())
+	policy := cluster.Spec().SelfHealing
+
+	ready := 0
+	for i := range pods.Items {
+		if pods.Items[i].DeletionTimestamp == nil && kube.IsPodReady(&pods.Items[i]) {
+			ready++
+		}
+	}
+	replicas := statefulSetReplicas(statefulSets, pods)
+
+	var wait time.Duration
+	for i := range pods.Items {
+		pod := &pods.Items[i]
+		ss := podStatefulSet(statefulSets, pod.Name)
+		lost, err := h.findLostNode(ctx, ss, pod)
+		if err != nil {
+			return 0, err
+		}
+		if lost == nil {
+			if err := h.setNodeLostAt(ctx, pod, ""); err != nil {
+				return 0, err
+			}
+			continue
+		}
+
+		lostAt, err := time.Parse(time.RFC3339, pod.Annotations[nodeLostAtAnnotation])
+		if err != nil {
+			log.Info("pod is on a lost node", "pod", pod.Name, "reason", lost.reason)
+			lostAt = now
+			if err := h.setNodeLostAt(ctx, pod, now.UTC().Format(time.RFC3339)); err != nil {
+				return 0, err
+			}
+		}
+		remaining := policy.RescheduleAfterOrDefault() - now.Sub(lostAt)
+		if remaining > 0 {
+			if wait == 0 || remaining < wait {
+				wait = remaining
+			}
+			continue
+		}
+
+		var opts []client.DeleteOption
+		if lost.force {
+			opts = append(opts, client.GracePeriodSeconds(0))
+		}
+
+		if lost.replaceStore {
+			// the ranges of the store are up-replicated from the other nodes
+			if ready < replicas-1 {
+				log.Info("not replacing the store of a pod on a lost node while other pods are not ready", "pod", pod.Name)
+				if wait == 0 || selfHealingRecheck < wait {
+					wait = selfHealingRecheck
+				}
+				continue
+			}
+			if err := replaceStore(ctx, h.client, ss, pod, opts...); err != nil {
+				return 0, err
+			}
+			log.Info("replaced the store of a pod on a lost node", "pod", pod.Name, "reason", lost.reason)
+			h.recorder.Eventf(cluster.Unwrap(), corev1.EventTypeWarning, "StoreReplaced",
+				"Pod %s stayed on a lost node: %s, replaced its store; the dead node should be decommissioned", pod.Name, lost.reason)
+			return 0, DeferredErr{Err: errors.Newf("replaced the store of pod %s", pod.Name), RequeueAfter: selfHealingRecheck}
+		}
+
+		if err := h.client.Delete(ctx, pod, opts...); client.IgnoreNotFound(err) != nil {
+			return 0, errors.Wrapf(err, "failed to reschedule pod %s", pod.Name)
+		}
+		log.Info("rescheduled a pod on a lost node", "pod", pod.Name, "reason", lost.reason, "force", lost.force)
+		h.recorder.Eventf(cluster.Unwrap(), corev1.EventTypeWarning, "PodRescheduled",
+			"Pod %s stayed on a lost node for %s: %s, deleted it to reschedule it", pod.Name, now.Sub(lostAt).Round(time.Second), lost.reason)
+		return 0, DeferredErr{Err: errors.Newf("rescheduled pod %s", pod.Name), RequeueAfter: selfHealingRecheck}
+	}
+
+	return wait, nil
+}
+
+// findLostNode returns why the node of the pod is lost, nil if it is not. A
+// pod with a local volume is only rescheduled once the node of the volume is
+// gone, it could not run anywhere else before.
+func (h selfHealing) findLostNode(ctx context.Context, ss *appsv1.StatefulSet, pod *corev1.Pod) (*lostNode, error) {
+	volumeHost, err := h.localVolumeHost(ctx, ss, pod)
+	if err != nil {
+		return nil, err
+	}
+
+	// a pod recreated after its node was removed cannot be scheduled next to
+	// its local volume
+	if pod.Spec.NodeName == "" {
+		if volumeHost == "" {
+			return nil, nil
+		}
+		nodes := &corev1.NodeList{}
+		if err := h.client.List(ctx, nodes, client.MatchingLabels{corev1.LabelHostname: volumeHost}); err != nil {
+			return nil, errors.Wrap(err, "failed to list nodes")
+		}
+		if len(nodes.Items) > 0 {
+			return nil, nil
+		}
+		return &lostNode{reason: fmt.Sprintf("the local volume of the pod is on node %s, which is gone", volumeHost), replaceStore: true}, nil
+	}
+
+	node := &corev1.Node{}
+	if err := h.client.Get(ctx, kubetypes.NamespacedName{Name: pod.Spec.NodeName}, node); err != nil {
+		if !apierrors.IsNotFound(err) {
+			return nil, errors.Wrapf(err, "failed to get node %s", pod.Spec.NodeName)
+		}
+		return &lostNode{reason: fmt.Sprintf("node %s is gone", pod.Spec.NodeName), force: true, replaceStore: volumeHost != ""}, nil
+	}
+	if volumeHost != "" {
+		return nil, nil
+	}
+
+	if !nodeReady(node) {
+		return &lostNode{reason: fmt.Sprintf("node %s is not ready", node.Name), force: true}, nil
+	}
+	// the kubelet of a cordoned node stops a deleted pod on its own
+	if node.Spec.Unschedulable && pod.DeletionTimestamp == nil {
+		return &lostNode{reason: fmt.Sprintf("node %s is cordoned", node.Name)}, nil
+	}
+	return nil, nil
+}
+
+// localVolumeHost returns the hostname of the node the volumes of the pod are
+// pinned to, empty if the pod has no local volume.
+func (h selfHealing) localVolumeHost(ctx context.Context, ss *appsv1.StatefulSet, pod *corev1.Pod) (string, error) {
+	for _, name := range claims(ss, pod) {
+		pvc := &corev1.PersistentVolumeClaim{}
+		if err := h.client.Get(ctx, kubetypes.NamespacedName{Namespace: pod.Namespace, Name: name}, pvc); err != nil {
+			if apierrors.IsNotFound(err) {
+				continue
+			}
+			return "", errors.Wrapf(err, "failed to get pvc %s", name)
+		}
+		if pvc.Spec.VolumeName == "" {
+			continue
+		}
+
+		pv := &corev1.PersistentVolume{}
+		if err := h.client.Get(ctx, kubetypes.NamespacedName{Name: pvc.Spec.VolumeName}, pv); err != nil {
+			if apierrors.IsNotFound(err) {
+				continue
+			}
+			return "", errors.Wrapf(err, "failed to get pv %s", pvc.Spec.VolumeName)
+		}
+		if host := pinnedHostname(pv); host != "" {
+			return host, nil
+		}
+	}
+	return "", nil
+}
+
+// pinnedHostname returns the hostname the node affinity of the volume requires,
+// empty if the volume can be attached to several nodes.
+func pinnedHostname(pv *corev1.PersistentVolume) string {
+	if pv.Spec.NodeAffinity == nil || pv.Spec.NodeAffinity.Required == nil {
+		return ""
+	}
+	for _, term := range pv.Spec.NodeAffinity.Required.NodeSelectorTerms {
+		for _, e := range term.MatchExpressions {
+			if e.Key == corev1.LabelHostname && e.Operator == corev1.NodeSelectorOpIn && len(e.Values) == 1 {
+				return e.Values[0]
+			}
+		}
+	}
+	return ""
+}
+
+// nodeReady returns whether the kubelet of the node reports it ready.
+func nodeReady(node *corev1.Node) bool {
+	for _, c := range node.Status.Conditions {
+		if c.Type == corev1.NodeReady {
+			return c.Status == corev1.ConditionTrue
+		}
+	}
+	return false
+}
+
+// setNodeLostAt records on the pod when its node was first seen lost, or
+// removes the record when the value is empty.
+func (h selfHealing) setNodeLostAt(ctx context.Context, pod *corev1.Pod, value string) error {
+	if _, ok := pod.Annotations[nodeLostAtAnnotation]; !ok && value == "" {
+		return nil
+	}
+
+	patch := client.MergeFrom(pod.DeepCopy())
+	if value == "" {
+		delete(pod.Annotations, nodeLostAtAnnotation)
+	} else {
+		metav1.SetMetaDataAnnotation(&pod.ObjectMeta, nodeLostAtAnnotation, value)
+	}
+	if err := h.client.Patch(ctx, pod, patch); client.IgnoreNotFound(err) != nil {
+		return errors.Wrapf(err, "failed to annotate pod %s", pod.Name)
+	}
+	return nil
+}
@@ -0,0 +1,205 @@
+/*
+Copyright 2021 The Cockroach Authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    https://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package actor
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	api "github.com/cockroachdb/cockroach-operator/apis/v1alpha1"
+	"github.com/cockroachdb/cockroach-operator/pkg/clustersql"
+	"github.com/cockroachdb/cockroach-operator/pkg/resource"
+	"github.com/cockroachdb/cockroach-operator/pkg/testutil"
+	"github.com/stretchr/testify/require"
+	appsv1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/tools/record"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+)
+
+func TestReschedule(t *testing.T) {
+	scheme := testutil.InitScheme(t)
+	now := time.Date(2021, time.June, 2, 20, 30, 0, 0, time.UTC)
+	selector := map[string]string{"app": "crdb"}
+	replicas := int32(3)
+
+	ss := &appsv1.StatefulSet{
+		ObjectMeta: metav1.ObjectMeta{Name: "crdb", Namespace: "default"},
+		Spec: appsv1.StatefulSetSpec{
+			Replicas:             &replicas,
+			Selector:             &metav1.LabelSelector{MatchLabels: selector},
+			VolumeClaimTemplates: []corev1.PersistentVolumeClaim{{ObjectMeta: metav1.ObjectMeta{Name: "datadir"}}},
+		},
+	}
+
+	node := func(name string, ready, cordoned bool) *corev1.Node {
+		status := corev1.ConditionTrue
+		if !ready {
+			status = corev1.ConditionUnknown
+		}
+		return &corev1.Node{
+			ObjectMeta: metav1.ObjectMeta{Name: name, Labels: map[string]string{corev1.LabelHostname: name}},
+			Spec:       corev1.NodeSpec{Unschedulable: cordoned},
+			Status:     corev1.NodeStatus{Conditions: []corev1.NodeCondition{{Type: corev1.NodeReady, Status: status}}},
+		}
+	}
+	pod := func(name, nodeName string, lostFor time.Duration) *corev1.Pod {
+		p := &corev1.Pod{
+			ObjectMeta: metav1.ObjectMeta{Name: name, Namespace: "default", Labels: selector},
+			Spec:       corev1.PodSpec{NodeName: nodeName},
+			Status: corev1.PodStatus{
+				Conditions: []corev1.PodCondition{{Type: corev1.PodReady, Status: corev1.ConditionTrue}},
+			},
+		}
+		if lostFor > 0 {
+			p.Annotations = map[string]string{nodeLostAtAnnotation: now.Add(-lostFor).Format(time.RFC3339)}
+		}
+		return p
+	}
+	// localVolume returns the PVC of the pod bound to a local volume of the host
+	localVolume := func(name, host string) []runtime.Object {
+		pv := &corev1.PersistentVolume{
+			ObjectMeta: metav1.ObjectMeta{Name: "pv-" + name},
+			Spec: corev1.PersistentVolumeSpec{
+				NodeAffinity: &corev1.VolumeNodeAffinity{
+					Required: &corev1.NodeSelector{
+						NodeSelectorTerms: []corev1.NodeSelectorTerm{{
+							MatchExpressions: []corev1.NodeSelectorRequirement{{
+								Key: corev1.LabelHostname, Operator: corev1.NodeSelectorOpIn, Values: []string{host},
+							}},
+						}},
+					},
+				},
+			},
+		}
+		pvc := &corev1.PersistentVolumeClaim{
+			ObjectMeta: metav1.ObjectMeta{Name: "datadir-" + name, Namespace: "default"},
+			Spec:       corev1.PersistentVolumeClaimSpec{VolumeName: pv.Name},
+		}
+		return []runtime.Object{pv, pvc}
+	}
+
+	healthy := []runtime.Object{node("node-0", true, false), pod("crdb-0", "node-0", 0), node("node-2", true, false), pod("crdb-2", "node-2", 0)}
+
+	tests := []struct {
+		name        string
+		objs        []runtime.Object
+		deferred    time.Duration
+		deletedPods []string
+		deletedPVCs []string
+		event       string
+		lostAt      string
+	}{
+		{
+			name: "the lost node of a pod is cleared when the node is ready again",
+			objs: []runtime.Object{node("node-1", true, false), pod("crdb-1", "node-1", time.Minute)},
+		},
+		{
+			name:     "waits before rescheduling a pod of a node that is not ready",
+			objs:     []runtime.Object{node("node-1", false, false), pod("crdb-1", "node-1", 0)},
+			deferred: 5 * time.Minute,
+			lostAt:   "2021-06-02T20:30:00Z",
+		},
+		{
+			name:        "force-deletes a pod of a node that stayed not ready",
+			objs:        []runtime.Object{node("node-1", false, false), pod("crdb-1", "node-1", 10*time.Minute)},
+			deferred:    selfHealingRecheck,
+			deletedPods: []string{"crdb-1"},
+			event:       "Warning PodRescheduled",
+		},
+		{
+			name:        "deletes a pod of a cordoned node",
+			objs:        []runtime.Object{node("node-1", true, true), pod("crdb-1", "node-1", 10*time.Minute)},
+			deferred:    selfHealingRecheck,
+			deletedPods: []string{"crdb-1"},
+			event:       "Warning PodRescheduled",
+		},
+		{
+			name: "does not reschedule a pod whose local volume is on its node",
+			objs: append([]runtime.Object{node("node-1", false, false), pod("crdb-1", "node-1", 0)},
+				localVolume("crdb-1", "node-1")...),
+		},
+		{
+			name:        "replaces the store of a pod whose node is gone with its local volume",
+			objs:        append([]runtime.Object{pod("crdb-1", "node-1", 10*time.Minute)}, localVolume("crdb-1", "node-1")...),
+			deferred:    selfHealingRecheck,
+			deletedPods: []string{"crdb-1"},
+			deletedPVCs: []string{"datadir-crdb-1"},
+			event:       "Warning StoreReplaced",
+		},
+		{
+			name:     "waits before replacing the store of a pending pod whose local volume is gone",
+			objs:     append([]runtime.Object{pod("crdb-1", "", 0)}, localVolume("crdb-1", "node-1")...),
+			deferred: 5 * time.Minute,
+			lostAt:   "2021-06-02T20:30:00Z",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cr := testutil.NewBuilder("crdb").Namespaced("default").WithNodeCount(3).Cr()
+			cr.Spec.SelfHealing = &api.SelfHealing{RescheduleFromLostNodes: true}
+			cluster := resource.NewCluster(cr)
+			objs := append([]runtime.Object{cr, ss.DeepCopy()}, healthy...)
+			cl := fake.NewFakeClientWithScheme(scheme, append(objs, tt.objs...)...)
+			recorder := record.NewFakeRecorder(10)
+
+			h := newSelfHealing(scheme, cl, nil, recorder).(*selfHealing)
+			h.now = func() time.Time { return now }
+			h.nodes = func(context.Context, *resource.Cluster) ([]clustersql.Node, error) {
+				return nil, nil
+			}
+
+			ctx := context.Background()
+			err := h.Act(ctx, &cluster)
+			if tt.deferred == 0 {
+				require.NoError(t, err)
+			} else {
+				deferred, ok := err.(DeferredErr)
+				require.True(t, ok, err)
+				require.Equal(t, tt.deferred, deferred.RequeueAfter)
+			}
+
+			for _, name := range tt.deletedPods {
+				err := cl.Get(ctx, types.NamespacedName{Namespace: "default", Name: name}, &corev1.Pod{})
+				require.True(t, apierrors.IsNotFound(err), name)
+			}
+			for _, name := range tt.deletedPVCs {
+				err := cl.Get(ctx, types.NamespacedName{Namespace: "default", Name: name}, &corev1.PersistentVolumeClaim{})
+				require.True(t, apierrors.IsNotFound(err), name)
+			}
+
+			if tt.event == "" {
+				require.Empty(t, recorder.Events)
+			} else {
+				require.Len(t, recorder.Events, 1)
+				require.Contains(t, <-recorder.Events, tt.event)
+			}
+
+			if len(tt.deletedPods) == 0 {
+				p := &corev1.Pod{}
+				require.NoError(t, cl.Get(ctx, types.NamespacedName{Namespace: "default", Name: "crdb-1"}, p))
+				require.Equal(t, tt.lostAt, p.Annotations[nodeLostAtAnnotation])
+			}
+		})
+	}
+}
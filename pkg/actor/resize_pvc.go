@@ -23,11 +23,14 @@ import (
 
 	"github.com/cenkalti/backoff"
 	api "github.com/cockroachdb/cockroach-operator/apis/v1alpha1"
+	"github.com/cockroachdb/cockroach-operator/pkg/features"
 	"github.com/cockroachdb/cockroach-operator/pkg/kube"
 	"github.com/cockroachdb/cockroach-operator/pkg/resource"
+	"github.com/cockroachdb/cockroach-operator/pkg/utilfeature"
 	"github.com/cockroachdb/errors"
 	appsv1 "k8s.io/api/apps/v1"
 	v1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/apimachinery/pkg/runtime"
 	kubetypes "k8s.io/apimachinery/pkg/types"
@@ -69,61 +72,98 @@ func (rp *resizePVC) GetActionType() api.ActionType {
 
 // Act in this implementation resizes PVC volumes of a CR sts.
 func (rp *resizePVC) Act(ctx context.Context, cluster *resource.Cluster) error {
-	log := rp.log.WithValues("CrdbCluster", cluster.ObjectKey())
+	r := resource.NewManagedKubeResource(ctx, rp.client, cluster, kube.AnnotatingPersister)
+	selector := r.Labels.Selector(cluster.Spec().AdditionalLabels)
+	builders := []resource.StatefulSetBuilder{{Cluster: cluster, Selector: selector}}
+	resources := []resource.ManagedResource{r}
+
+	// the volumes of the node pools are resized to the size of the data store
+	// of their pool, one statefulset at a time
+	if utilfeature.DefaultMutableFeatureGate.Enabled(features.NodePools) {
+		for _, pool := range cluster.Spec().NodePools {
+			poolResource := r
+			poolResource.Labels = resource.NodePoolLabels(r.Labels, pool.Name)
+			builders = append(builders, resource.NewNodePoolStatefulSetBuilder(cluster, selector, "", pool))
+			resources = append(resources, poolResource)
+		}
+	}
+
+	for i, b := range builders {
+		resized, err := rp.resizeStatefulSet(ctx, cluster, resources[i], b)
+		if err != nil {
+			return err
+		}
+		if resized {
+			CancelLoop(ctx)
+			return nil
+		}
+	}
+	return nil
+}
+
+// resizeStatefulSet resizes the PVCs of the statefulset of the builder to the
+// size of its data store, and returns whether they were resized.
+func (rp *resizePVC) resizeStatefulSet(ctx context.Context, cluster *resource.Cluster, r resource.ManagedResource,
+	b resource.StatefulSetBuilder) (bool, error) {
+	log := rp.log.WithValues("CrdbCluster", cluster.ObjectKey(), "StatefulSet", b.ResourceName())
 
 	// If we do not have a volume claim we do not have PVCs
-	if cluster.Spec().DataStore.VolumeClaim == nil {
+	if b.Cluster.Spec().DataStore.VolumeClaim == nil {
 		log.Info("Skipping PVC resize as VolumeClaim does not exist")
-		return nil
+		return false, nil
 	}
 
 	// Get the sts and compare the sts size to the size in the CR
 	key := kubetypes.NamespacedName{
 		Namespace: cluster.Namespace(),
-		Name:      cluster.StatefulSetName(),
+		Name:      b.ResourceName(),
 	}
 	statefulSet := &appsv1.StatefulSet{}
 	if err := rp.client.Get(ctx, key, statefulSet); err != nil {
-		return errors.Wrap(err, "failed to fetch statefulset")
+		// the statefulset of a new node pool is created by the deploy action
+		if b.Pool != nil && apierrors.IsNotFound(err) {
+			return false, nil
+		}
+		return false, errors.Wrap(err, "failed to fetch statefulset")
 	}
 
 	// TODO statefulSetIsUpdating is not quite working as expected.
 	// I had to check status.  We should look at the update code in partition update to address this
 	if statefulSetIsUpdating(statefulSet) {
-		return NotReadyErr{Err: errors.New("resize statefulset is updating, waiting for the update to finish")}
+		return false, NotReadyErr{Err: errors.New("resize statefulset is updating, waiting for the update to finish")}
 	}
 
 	status := &statefulSet.Status
 	if status.CurrentReplicas == 0 || status.CurrentReplicas < status.Replicas {
 		log.Info("resize pvc statefulset does not have all replicas up")
-		return NotReadyErr{Err: errors.New("resize pvc statefulset does not have all replicas up")}
+		return false, NotReadyErr{Err: errors.New("resize pvc statefulset does not have all replicas up")}
 	}
 
 	// Maybe this should be an error since we should not have this, but I wanted to check anyways
 	if len(statefulSet.Spec.VolumeClaimTemplates) == 0 {
 		log.Info("Skipping PVC resize as PVCs do not exist")
-		return nil
+		return false, nil
 	}
 
 	clientset, err := kubernetes.NewForConfig(rp.config)
 	if err != nil {
-		return errors.Wrapf(err, "failed to create kubernetes clientset")
+		return false, errors.Wrapf(err, "failed to create kubernetes clientset")
 	}
 
 	stsStorageSizeDeployed := statefulSet.Spec.VolumeClaimTemplates[0].Spec.Resources.Requests.Storage()
-	stsStorageSizeSet := cluster.Spec().DataStore.VolumeClaim.PersistentVolumeClaimSpec.Resources.Requests.Storage()
+	stsStorageSizeSet := b.Cluster.Spec().DataStore.VolumeClaim.PersistentVolumeClaimSpec.Resources.Requests.Storage()
 
 	// If the sizes match do not resize
 	if stsStorageSizeDeployed.Equal(stsStorageSizeSet.DeepCopy()) {
 		log.Info("Skipping PVC resize as sizes match")
-		return nil
+		return false, nil
 	}
 
 	log.Info("Starting PVC resize")
 
 	// Find all of the PVCs and resize them
-	if err := rp.findAndResizePVC(ctx, statefulSet, cluster, clientset); err != nil {
-		return errors.Wrapf(err, "updating PVCs for statefulset %s.%s", cluster.Namespace(), cluster.StatefulSetName())
+	if err := rp.findAndResizePVC(ctx, statefulSet, b.Cluster, clientset); err != nil {
+		return false, errors.Wrapf(err, "updating PVCs for statefulset %s.%s", cluster.Namespace(), statefulSet.Name)
 	}
 
 	log.Info("Starting updating sts")
@@ -131,8 +171,8 @@ func (rp *resizePVC) Act(ctx context.Context, cluster *resource.Cluster) error {
 	// Update the STS with the correct volume size, in case more pods are created
 	// We will create a copy and update the copy, and then delete the original without
 	// deleting the Pods.  The new sts is then used to create a new statefulset.
-	if err := rp.updateSts(ctx, statefulSet, cluster); err != nil {
-		return errors.Wrapf(err, "updating statefulset %s.%s", cluster.Namespace(), cluster.StatefulSetName())
+	if err := rp.updateSts(ctx, statefulSet, cluster, r, b); err != nil {
+		return false, errors.Wrapf(err, "updating statefulset %s.%s", cluster.Namespace(), statefulSet.Name)
 	}
 
 	// TODO this is not working so we will need to patch the sts
@@ -150,15 +190,14 @@ func (rp *resizePVC) Act(ctx context.Context, cluster *resource.Cluster) error {
 		}*/
 
 	log.Info("PVC resize completed")
-	CancelLoop(ctx)
-
-	return nil
+	return true, nil
 }
 
 // updateSts updates the size of an STS' VolumeClaimTemplate to match the new size in the CR.
 // In order to update the volume claim template we have to delete the STS without cascading and then
 // create the sts.
-func (rp *resizePVC) updateSts(ctx context.Context, sts *appsv1.StatefulSet, cluster *resource.Cluster) error {
+func (rp *resizePVC) updateSts(ctx context.Context, sts *appsv1.StatefulSet, cluster *resource.Cluster,
+	r resource.ManagedResource, builder resource.StatefulSetBuilder) error {
 
 	// delete the original sts, but do not delete the Pods
 	orphan := metav1.DeletePropagationOrphan
@@ -167,26 +206,22 @@ func (rp *resizePVC) updateSts(ctx context.Context, sts *appsv1.StatefulSet, clu
 	}
 
 	f := func() error {
-		return rp.recreateSTS(ctx, cluster)
+		return rp.recreateSTS(ctx, cluster, r, builder)
 	}
 
 	b := backoffFactory(5 * time.Minute)
 	return backoff.Retry(f, backoff.WithContext(b, ctx))
 }
 
-func (rp *resizePVC) recreateSTS(ctx context.Context, cluster *resource.Cluster) error {
+func (rp *resizePVC) recreateSTS(ctx context.Context, cluster *resource.Cluster, r resource.ManagedResource, b resource.StatefulSetBuilder) error {
 	log := rp.log.WithValues("CrdbCluster", cluster.ObjectKey())
 	// Use same StatefulSetBuilder that we run in Deploy to
 	// rebuild and save the StatefulSet with the new PVC size
-	r := resource.NewManagedKubeResource(ctx, rp.client, cluster, kube.AnnotatingPersister)
 	_, err := (resource.Reconciler{
 		ManagedResource: r,
-		Builder: resource.StatefulSetBuilder{
-			Cluster:  cluster,
-			Selector: r.Labels.Selector(cluster.Spec().AdditionalLabels),
-		},
-		Owner:  cluster.Unwrap(),
-		Scheme: rp.scheme,
+		Builder:         b,
+		Owner:           cluster.Unwrap(),
+		Scheme:          rp.scheme,
 	}).Reconcile()
 
 	if err != nil {
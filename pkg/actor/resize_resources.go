@@ -0,0 +1,207 @@
+/*
+Copyright 2021 The Cockroach Authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    https://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package actor
+
+import (
+	"context"
+	"time"
+
+	api "github.com/cockroachdb/cockroach-operator/apis/v1alpha1"
+	"github.com/cockroachdb/cockroach-operator/pkg/features"
+	"github.com/cockroachdb/cockroach-operator/pkg/healthchecker"
+	"github.com/cockroachdb/cockroach-operator/pkg/kube"
+	"github.com/cockroachdb/cockroach-operator/pkg/resource"
+	"github.com/cockroachdb/cockroach-operator/pkg/update"
+	"github.com/cockroachdb/cockroach-operator/pkg/utilfeature"
+	"github.com/cockroachdb/errors"
+	"github.com/go-logr/logr"
+	appsv1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/equality"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/runtime"
+	kubetypes "k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/rest"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+func newResizeResources(scheme *runtime.Scheme, cl client.Client, config *rest.Config) Actor {
+	return &resizeResources{
+		action: newAction("resizeResources", scheme, cl),
+		config: config,
+		now:    time.Now,
+	}
+}
+
+// resizeResources rolls out a change of the resources of the database
+// container, those of the node pools included. The StatefulSetBuilder keeps
+// the resources of an existing statefulset, so that the pods are not all
+// restarted by the statefulset controller at once.
+type resizeResources struct {
+	action
+
+	config *rest.Config
+	now    func() time.Time
+}
+
+// GetActionType returns api.ResizeResourcesAction action used to set the cluster status errors
+func (rr *resizeResources) GetActionType() api.ActionType {
+	return api.ResizeResourcesAction
+}
+
+// Act resizes the pods one at a time when the resources in the spec differ from
+// the ones of the statefulset, during a maintenance window if there are any.
+func (rr *resizeResources) Act(ctx context.Context, cluster *resource.Cluster) error {
+	log := rr.log.WithValues("CrdbCluster", cluster.ObjectKey())
+
+	if cluster.GetAnnotationRestartType() != "" {
+		log.V(DEBUGLEVEL).Info("not resizing the pods because a restart already runs")
+		return nil
+	}
+
+	// the pods of the node pools are resized to the resources of their pool,
+	// one statefulset at a time
+	targets := []resizeTarget{{statefulSet: cluster.StatefulSetName(), resources: cluster.ContainerResources()}}
+	if utilfeature.DefaultMutableFeatureGate.Enabled(features.NodePools) {
+		for _, pool := range cluster.Spec().NodePools {
+			b := resource.NewNodePoolStatefulSetBuilder(cluster, nil, "", pool)
+			targets = append(targets, resizeTarget{statefulSet: b.ResourceName(), resources: b.Cluster.ContainerResources(), pool: true})
+		}
+	}
+
+	for _, target := range targets {
+		resized, err := rr.resizeStatefulSet(ctx, cluster, target)
+		if err != nil {
+			return err
+		}
+		if resized {
+			CancelLoop(ctx)
+			return nil
+		}
+	}
+
+	log.V(DEBUGLEVEL).Info("no resource changes needed")
+	cluster.ClearPendingOperation(rr.GetActionType())
+	return nil
+}
+
+// resizeTarget is a statefulset of the cluster and the resources of its
+// database container
+type resizeTarget struct {
+	statefulSet string
+	resources   corev1.ResourceRequirements
+	// pool is whether the statefulset is the one of a node pool
+	pool bool
+}
+
+// resizeStatefulSet resizes the pods of the statefulset of the target when
+// their resources differ, and returns whether they were resized.
+func (rr *resizeResources) resizeStatefulSet(ctx context.Context, cluster *resource.Cluster, target resizeTarget) (bool, error) {
+	log := rr.log.WithValues("CrdbCluster", cluster.ObjectKey(), "StatefulSet", target.statefulSet)
+
+	key := kubetypes.NamespacedName{
+		Namespace: cluster.Namespace(),
+		Name:      target.statefulSet,
+	}
+	statefulSet := &appsv1.StatefulSet{}
+	if err := rr.client.Get(ctx, key, statefulSet); err != nil {
+		// the statefulset of a new node pool is created by the deploy action
+		if target.pool && apierrors.IsNotFound(err) {
+			return false, nil
+		}
+		return false, errors.Wrap(err, "failed to fetch statefulset")
+	}
+
+	container, err := kube.FindContainer(resource.DbContainerName, &statefulSet.Spec.Template.Spec)
+	if err != nil {
+		return false, errors.Wrap(err, "failed to find the database container")
+	}
+
+	wanted := target.resources
+	if equality.Semantic.DeepEqual(container.Resources, wanted) {
+		return false, nil
+	}
+
+	if statefulSetIsUpdating(statefulSet) {
+		return false, NotReadyErr{Err: errors.New("statefulset is updating, waiting for the update to finish")}
+	}
+
+	strategy := cluster.Spec().ResourceUpdate
+	wait, err := strategy.UntilMaintenanceWindow(rr.now())
+	if err != nil {
+		return false, ValidationError{Err: err}
+	}
+	if wait > 0 {
+		log.Info("waiting for the next maintenance window to resize the pods", "wait", wait.String())
+		return false, DeferredErr{
+			Err:          errors.Newf("the pods will be resized in the next maintenance window in %s", wait.Round(time.Second)),
+			RequeueAfter: wait,
+		}
+	}
+
+	start := rr.now()
+	if err := reserveOperation(ctx, rr.client, log, cluster, rr.GetActionType(), start); err != nil {
+		return false, err
+	}
+
+	clientset, err := kubernetes.NewForConfig(rr.config)
+	if err != nil {
+		return false, releaseOperation(ctx, rr.client, log, cluster, rr.GetActionType(), start,
+			errors.Wrapf(err, "failed to create kubernetes clientset"))
+	}
+
+	k8sCluster := &update.UpdateCluster{
+		Clientset:             clientset,
+		PodUpdateTimeout:      strategy.PodTimeoutOrDefault(),
+		PodMaxPollingInterval: podMaxPollingInterval,
+		HealthChecker:         healthchecker.NewHealthChecker(cluster, clientset, rr.scheme, rr.config),
+		MaxUnavailable:        cluster.Spec().UpdateStrategy.MaxUnavailableOrDefault(),
+	}
+
+	updateResources := &update.UpdateResources{
+		Resources:     wanted,
+		ContainerName: resource.DbContainerName,
+		StsName:       statefulSet.Name,
+		StsNamespace:  statefulSet.Namespace,
+	}
+
+	inPlace := strategy != nil && strategy.InPlace
+	log.Info("resizing the pods", "from", container.Resources, "to", wanted, "inPlace", inPlace)
+	if err := rr.resize(ctx, updateResources, k8sCluster, inPlace, log); err != nil {
+		// the retry resizes the pods left with the budget it reserved
+		return false, releaseOperation(ctx, rr.client, log, cluster, rr.GetActionType(), start,
+			errors.Wrapf(err, "failed to resize the pods of sts: %s", statefulSet.Name))
+	}
+
+	log.Info("resized the pods")
+	return true, nil
+}
+
+// resize resizes the pods in place if asked to and if the Kubernetes cluster
+// supports it, and restarts them in batches otherwise.
+func (rr *resizeResources) resize(ctx context.Context, updateResources *update.UpdateResources, k8sCluster *update.UpdateCluster, inPlace bool, l logr.Logger) error {
+	if inPlace {
+		err := update.ResizeInPlace(ctx, updateResources, k8sCluster, l)
+		if !errors.Is(err, update.ErrInPlaceResizeUnsupported) {
+			return err
+		}
+		l.Info("in-place pod resize is not supported, restarting the pods", "reason", err.Error())
+	}
+
+	return update.UpdateClusterResources(ctx, updateResources, k8sCluster, l)
+}
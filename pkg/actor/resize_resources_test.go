@@ -0,0 +1,114 @@
+/*
+Copyright 2021 The Cockroach Authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    https://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package actor
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	api "github.com/cockroachdb/cockroach-operator/apis/v1alpha1"
+	"github.com/cockroachdb/cockroach-operator/pkg/resource"
+	"github.com/cockroachdb/cockroach-operator/pkg/testutil"
+	"github.com/stretchr/testify/require"
+	appsv1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+	apiresource "k8s.io/apimachinery/pkg/api/resource"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+)
+
+func TestResizeResourcesWaitsForMaintenanceWindow(t *testing.T) {
+	scheme := testutil.InitScheme(t)
+	// a Wednesday
+	now := time.Date(2021, time.June, 2, 10, 30, 0, 0, time.UTC)
+
+	limits := func(memory string) corev1.ResourceRequirements {
+		return corev1.ResourceRequirements{
+			Limits: corev1.ResourceList{corev1.ResourceMemory: apiresource.MustParse(memory)},
+		}
+	}
+
+	window := func(start string, days ...string) *api.ResourceUpdateStrategy {
+		return &api.ResourceUpdateStrategy{
+			MaintenanceWindows: []api.MaintenanceWindow{{
+				Start:    start,
+				Duration: metav1.Duration{Duration: time.Hour},
+				Days:     days,
+			}},
+		}
+	}
+
+	tests := []struct {
+		name      string
+		resources corev1.ResourceRequirements
+		strategy  *api.ResourceUpdateStrategy
+		check     func(t *testing.T, err error)
+	}{
+		{
+			name:      "resources are unchanged",
+			resources: limits("4Gi"),
+			strategy:  window("22:00"),
+			check: func(t *testing.T, err error) {
+				require.NoError(t, err)
+			},
+		},
+		{
+			name:      "window is closed",
+			resources: limits("8Gi"),
+			strategy:  window("22:00"),
+			check: func(t *testing.T, err error) {
+				deferred, ok := err.(DeferredErr)
+				require.True(t, ok, err)
+				require.Equal(t, 11*time.Hour+30*time.Minute, deferred.RequeueAfter)
+			},
+		},
+		{
+			name:      "window is invalid",
+			resources: limits("8Gi"),
+			strategy:  window("22:00", "Someday"),
+			check: func(t *testing.T, err error) {
+				_, ok := err.(ValidationError)
+				require.True(t, ok, err)
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cr := testutil.NewBuilder("crdb").Namespaced("default").WithResources(tt.resources).Cr()
+			cr.Spec.ResourceUpdate = tt.strategy
+			cluster := resource.NewCluster(cr)
+
+			sts := &appsv1.StatefulSet{
+				ObjectMeta: metav1.ObjectMeta{Name: cluster.StatefulSetName(), Namespace: "default"},
+				Spec: appsv1.StatefulSetSpec{
+					Template: corev1.PodTemplateSpec{
+						Spec: corev1.PodSpec{
+							Containers: []corev1.Container{{Name: resource.DbContainerName, Resources: limits("4Gi")}},
+						},
+					},
+				},
+			}
+
+			rr := newResizeResources(scheme, fake.NewFakeClientWithScheme(scheme, sts), nil).(*resizeResources)
+			rr.now = func() time.Time { return now }
+
+			tt.check(t, rr.Act(context.Background(), &cluster))
+		})
+	}
+}
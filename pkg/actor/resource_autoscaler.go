@@ -0,0 +1,280 @@
+/*
+Copyright 2021 The Cockroach Authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    https://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package actor
+
+import (
+	"context"
+	"math"
+	"time"
+
+	api "github.com/cockroachdb/cockroach-operator/apis/v1alpha1"
+	"github.com/cockroachdb/cockroach-operator/pkg/kube"
+	"github.com/cockroachdb/cockroach-operator/pkg/labels"
+	"github.com/cockroachdb/cockroach-operator/pkg/resource"
+	"github.com/cockroachdb/errors"
+	appsv1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/equality"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	apiresource "k8s.io/apimachinery/pkg/api/resource"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/rest"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+// podMetricsListGVK is the kind of the usage of the pods served by the metrics
+// API of the metrics-server
+var podMetricsListGVK = schema.GroupVersionKind{Group: "metrics.k8s.io", Version: "v1beta1", Kind: "PodMetricsList"}
+
+func newResourceAutoscaler(scheme *runtime.Scheme, cl client.Client, config *rest.Config) Actor {
+	ra := &resourceAutoscaler{
+		action: newAction("resourceAutoscaler", scheme, cl),
+		now:    time.Now,
+	}
+	ra.usage = ra.readUsage
+	return ra
+}
+
+// resourceAutoscaler polls the usage of the pods and sets the requests of the
+// database container in the spec to the ones the peak usage calls for. The
+// resizeResources actor then resizes the pods one at a time like for a manual
+// change. Requests are raised right away but only lowered once the usage was
+// observed for the resize down delay.
+type resourceAutoscaler struct {
+	action
+
+	now func() time.Time
+	// usage reads the CPU and memory used by the busiest pod of the cluster
+	usage func(ctx context.Context, cluster *resource.Cluster) (corev1.ResourceList, error)
+}
+
+//GetActionType returns api.ResourceAutoscalingAction used to set the cluster status errors
+func (ra resourceAutoscaler) GetActionType() api.ActionType {
+	return api.ResourceAutoscalingAction
+}
+
+func (ra resourceAutoscaler) Act(ctx context.Context, cluster *resource.Cluster) error {
+	log := ra.log.WithValues("CrdbCluster", cluster.ObjectKey())
+	log.V(DEBUGLEVEL).Info("checking the usage of the pods")
+
+	policy := cluster.Spec().ResourceAutoscaling
+	if err := policy.Validate(); err != nil {
+		return ValidationError{Err: err}
+	}
+	// the nodes of the node pools are neither measured nor scaled
+	if err := cluster.Spec().ValidateNodePools(); err != nil {
+		return ValidationError{Err: err}
+	}
+
+	if cluster.GetAnnotationRestartType() != "" {
+		log.V(DEBUGLEVEL).Info("not measuring the usage because a restart runs")
+		return nil
+	}
+
+	// the usage is only measured once the last resize is rolled out and every
+	// pod is ready, as the pods that just restarted use less than they will
+	ss := &appsv1.StatefulSet{}
+	key := types.NamespacedName{Namespace: cluster.Namespace(), Name: cluster.StatefulSetName()}
+	if err := ra.client.Get(ctx, key, ss); err != nil {
+		if apierrors.IsNotFound(err) {
+			return nil
+		}
+		return errors.Wrap(err, "failed to fetch the statefulset")
+	}
+	container, err := kube.FindContainer(resource.DbContainerName, &ss.Spec.Template.Spec)
+	if err != nil {
+		return errors.Wrap(err, "failed to find the database container")
+	}
+	wanted := cluster.ContainerResources()
+	if !equality.Semantic.DeepEqual(container.Resources, wanted) || statefulSetIsUpdating(ss) ||
+		ss.Status.ReadyReplicas != cluster.Spec().Nodes {
+		log.V(DEBUGLEVEL).Info("waiting for the pods to be resized and ready")
+		return nil
+	}
+
+	usage, err := ra.usage(ctx, cluster)
+	if err != nil {
+		log.Error(err, "failed to read the usage of the pods")
+		return nil
+	}
+
+	now := ra.now()
+	status := trackUsage(usage, cluster.Status().ResourceAutoscaling, now)
+	status.Recommended = policy.Recommend(status.PeakUsage)
+	cluster.SetResourceAutoscalingStatus(status)
+
+	lower := now.Sub(status.PeakSince.Time) >= policy.ResizeDownDelayOrDefault()
+	requests, changed := api.NextRequests(wanted.Requests, status.Recommended, lower)
+	if !changed {
+		// the peak is tracked anew once it was observed for the whole delay, so
+		// that it follows the usage down
+		if lower {
+			status.PeakSince = status.LastMeasureTime.DeepCopy()
+			status.PeakUsage = usage
+		}
+		return nil
+	}
+
+	log.Info("autoscaling the resources of the pods", "from", wanted.Requests, "to", requests,
+		"peakUsage", status.PeakUsage)
+	return ra.resizeTo(ctx, cluster, wanted.Requests, requests, status, now)
+}
+
+// PollInterval returns how often the usage of the pods is measured. The peak
+// usage only moves at this interval, so a short spike can be missed.
+func (ra resourceAutoscaler) PollInterval(*resource.Cluster) time.Duration {
+	return pollInterval
+}
+
+// resizeTo sets the requests of the database container in the spec. The limits
+// set in the spec are scaled by as much, so that they keep their ratio to the
+// requests. The status is saved right away, as the spec is updated and the
+// other actors must wait for the next loop.
+func (ra resourceAutoscaler) resizeTo(ctx context.Context, cluster *resource.Cluster, current, requests corev1.ResourceList,
+	status *api.ResourceAutoscalingStatus, now time.Time) error {
+	fetcher := resource.NewKubeFetcher(ctx, cluster.Namespace(), ra.client)
+	cr := resource.ClusterPlaceholder(cluster.Name())
+	if err := fetcher.Fetch(cr); err != nil {
+		return errors.Wrap(err, "failed to fetch the CrdbCluster")
+	}
+
+	resources := &cr.Spec.Resources
+	if resources.Requests == nil {
+		resources.Requests = corev1.ResourceList{}
+	}
+	for name, request := range requests {
+		resources.Requests[name] = request
+		if limit, ok := resources.Limits[name]; ok {
+			resources.Limits[name] = scaleLimit(name, limit, current[name], request)
+		}
+	}
+	if err := ra.client.Update(ctx, cr); err != nil {
+		return errors.Wrap(err, "failed to update the resources")
+	}
+
+	// the peak usage is tracked anew with the new requests
+	resized := metav1.NewTime(now)
+	status.LastResizeTime = &resized
+	status.PeakSince = resized.DeepCopy()
+	status.PeakUsage = status.Usage.DeepCopy()
+	cr.Status.ResourceAutoscaling = status.DeepCopy()
+	if err := ra.client.Status().Update(ctx, cr); err != nil {
+		return errors.Wrap(err, "failed to save the resource autoscaling status")
+	}
+
+	CancelLoop(ctx)
+	return nil
+}
+
+// scaleLimit returns the limit that keeps its ratio to the request as the
+// request changes, or at least the new request when there was none.
+func scaleLimit(name corev1.ResourceName, limit, from, to apiresource.Quantity) apiresource.Quantity {
+	if from.IsZero() {
+		if limit.Cmp(to) < 0 {
+			return to.DeepCopy()
+		}
+		return limit
+	}
+
+	if name == corev1.ResourceCPU {
+		milli := math.Round(float64(limit.MilliValue()) * float64(to.MilliValue()) / float64(from.MilliValue()))
+		return *apiresource.NewMilliQuantity(int64(milli), limit.Format)
+	}
+	bytes := math.Round(float64(limit.Value()) * float64(to.Value()) / float64(from.Value()))
+	return *apiresource.NewQuantity(int64(bytes), limit.Format)
+}
+
+// trackUsage records the usage of the busiest pod, and the peak usage since
+// the start of the current window.
+func trackUsage(usage corev1.ResourceList, previous *api.ResourceAutoscalingStatus, now time.Time) *api.ResourceAutoscalingStatus {
+	measured := metav1.NewTime(now)
+	status := &api.ResourceAutoscalingStatus{
+		Usage:           usage,
+		PeakUsage:       usage.DeepCopy(),
+		PeakSince:       measured.DeepCopy(),
+		LastMeasureTime: &measured,
+	}
+	if previous == nil || previous.PeakSince == nil {
+		return status
+	}
+
+	status.PeakSince = previous.PeakSince.DeepCopy()
+	status.LastResizeTime = previous.LastResizeTime.DeepCopy()
+	for name, peak := range previous.PeakUsage {
+		if current, ok := status.PeakUsage[name]; !ok || peak.Cmp(current) > 0 {
+			status.PeakUsage[name] = peak.DeepCopy()
+		}
+	}
+	return status
+}
+
+// readUsage reads the usage of the pods from the metrics API.
+func (ra resourceAutoscaler) readUsage(ctx context.Context, cluster *resource.Cluster) (corev1.ResourceList, error) {
+	metrics := &unstructured.UnstructuredList{}
+	metrics.SetGroupVersionKind(podMetricsListGVK)
+	selector := labels.Common(cluster.Unwrap()).Selector(cluster.Spec().AdditionalLabels)
+	if err := ra.client.List(ctx, metrics, client.InNamespace(cluster.Namespace()), client.MatchingLabels(selector)); err != nil {
+		return nil, errors.Wrap(err, "failed to list the metrics of the pods")
+	}
+	return busiestUsage(metrics)
+}
+
+// busiestUsage returns the largest CPU and memory used by the database
+// container of any pod of the PodMetrics.
+func busiestUsage(metrics *unstructured.UnstructuredList) (corev1.ResourceList, error) {
+	busiest := corev1.ResourceList{}
+	for _, pod := range metrics.Items {
+		containers, _, err := unstructured.NestedSlice(pod.Object, "containers")
+		if err != nil {
+			return nil, errors.Wrapf(err, "invalid metrics of pod %s", pod.GetName())
+		}
+
+		for _, c := range containers {
+			container, ok := c.(map[string]interface{})
+			if !ok || container["name"] != resource.DbContainerName {
+				continue
+			}
+			usage, _, err := unstructured.NestedStringMap(container, "usage")
+			if err != nil {
+				return nil, errors.Wrapf(err, "invalid metrics of pod %s", pod.GetName())
+			}
+
+			for _, name := range []corev1.ResourceName{corev1.ResourceCPU, corev1.ResourceMemory} {
+				value, ok := usage[string(name)]
+				if !ok {
+					continue
+				}
+				quantity, err := apiresource.ParseQuantity(value)
+				if err != nil {
+					return nil, errors.Wrapf(err, "invalid %s usage of pod %s", name, pod.GetName())
+				}
+				if max, ok := busiest[name]; !ok || quantity.Cmp(max) > 0 {
+					busiest[name] = quantity
+				}
+			}
+		}
+	}
+
+	if len(busiest) == 0 {
+		return nil, errors.New("no usage of the pods in the metrics API")
+	}
+	return busiest, nil
+}
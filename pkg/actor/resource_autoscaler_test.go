@@ -0,0 +1,196 @@
+/*
+Copyright 2021 The Cockroach Authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    https://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package actor
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	api "github.com/cockroachdb/cockroach-operator/apis/v1alpha1"
+	"github.com/cockroachdb/cockroach-operator/pkg/resource"
+	"github.com/cockroachdb/cockroach-operator/pkg/testutil"
+	"github.com/stretchr/testify/require"
+	appsv1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+	apiresource "k8s.io/apimachinery/pkg/api/resource"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+)
+
+func TestResourceAutoscaler(t *testing.T) {
+	scheme := testutil.InitScheme(t)
+	now := time.Date(2021, time.June, 2, 20, 30, 0, 0, time.UTC)
+	at := func(ago time.Duration) *metav1.Time {
+		mt := metav1.NewTime(now.Add(-ago))
+		return &mt
+	}
+	list := func(cpu, memory string) corev1.ResourceList {
+		return corev1.ResourceList{
+			corev1.ResourceCPU:    apiresource.MustParse(cpu),
+			corev1.ResourceMemory: apiresource.MustParse(memory),
+		}
+	}
+	requireQuantities := func(t *testing.T, expected, actual corev1.ResourceList) {
+		require.Len(t, actual, len(expected))
+		for name, quantity := range expected {
+			got := actual[name]
+			require.Zero(t, quantity.Cmp(got), "%s: expected %s, got %s", name, quantity.String(), got.String())
+		}
+	}
+
+	current := corev1.ResourceRequirements{Requests: list("1", "4Gi"), Limits: list("2", "8Gi")}
+
+	tests := []struct {
+		name      string
+		rolledOut corev1.ResourceRequirements
+		previous  *api.ResourceAutoscalingStatus
+		usage     corev1.ResourceList
+		expected  corev1.ResourceRequirements
+		peakSince *metav1.Time
+	}{
+		{
+			name:      "raises the requests right away",
+			rolledOut: current,
+			usage:     list("1400m", "2Gi"),
+			expected:  corev1.ResourceRequirements{Requests: list("2", "4Gi"), Limits: list("4", "8Gi")},
+			peakSince: at(0),
+		},
+		{
+			name:      "raises the requests to the peak usage",
+			rolledOut: current,
+			previous:  &api.ResourceAutoscalingStatus{PeakUsage: list("1400m", "2Gi"), PeakSince: at(time.Hour)},
+			usage:     list("300m", "1Gi"),
+			expected:  corev1.ResourceRequirements{Requests: list("2", "4Gi"), Limits: list("4", "8Gi")},
+			peakSince: at(0),
+		},
+		{
+			name:      "keeps the requests during the resize down delay",
+			rolledOut: current,
+			previous:  &api.ResourceAutoscalingStatus{PeakUsage: list("500m", "2Gi"), PeakSince: at(time.Hour)},
+			usage:     list("500m", "2Gi"),
+			expected:  current,
+			peakSince: at(time.Hour),
+		},
+		{
+			name:      "lowers the requests after the resize down delay",
+			rolledOut: current,
+			previous:  &api.ResourceAutoscalingStatus{PeakUsage: list("500m", "2Gi"), PeakSince: at(7 * time.Hour)},
+			usage:     list("500m", "2Gi"),
+			expected:  corev1.ResourceRequirements{Requests: list("800m", "2944Mi"), Limits: list("1600m", "5888Mi")},
+			peakSince: at(0),
+		},
+		{
+			name:      "tracks the peak anew after the resize down delay",
+			rolledOut: current,
+			previous:  &api.ResourceAutoscalingStatus{PeakUsage: list("700m", "2800Mi"), PeakSince: at(7 * time.Hour)},
+			usage:     list("300m", "1Gi"),
+			expected:  current,
+			peakSince: at(0),
+		},
+		{
+			name:      "waits for the last resize to be rolled out",
+			rolledOut: corev1.ResourceRequirements{Requests: list("500m", "4Gi"), Limits: list("1", "8Gi")},
+			expected:  current,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cr := testutil.NewBuilder("crdb").Namespaced("default").WithNodeCount(3).WithResources(current).Cr()
+			cr.Spec.ResourceAutoscaling = &api.ResourceAutoscaling{
+				MinAllowed: list("500m", "2Gi"),
+				MaxAllowed: list("4", "16Gi"),
+			}
+			cr.Status.ResourceAutoscaling = tt.previous
+			ss := &appsv1.StatefulSet{
+				ObjectMeta: metav1.ObjectMeta{Namespace: "default", Name: "crdb"},
+				Spec: appsv1.StatefulSetSpec{
+					Template: corev1.PodTemplateSpec{
+						Spec: corev1.PodSpec{
+							Containers: []corev1.Container{{Name: resource.DbContainerName, Resources: tt.rolledOut}},
+						},
+					},
+				},
+				Status: appsv1.StatefulSetStatus{Replicas: 3, ReadyReplicas: 3},
+			}
+			cluster := resource.NewCluster(cr)
+			cl := fake.NewFakeClientWithScheme(scheme, cr, ss)
+
+			ra := newResourceAutoscaler(scheme, cl, nil).(*resourceAutoscaler)
+			ra.now = func() time.Time { return now }
+			ra.usage = func(context.Context, *resource.Cluster) (corev1.ResourceList, error) {
+				require.NotNil(t, tt.usage, "the usage should not be read")
+				return tt.usage, nil
+			}
+
+			ctx, cancel := context.WithCancel(context.Background())
+			defer cancel()
+			err := ra.Act(ContextWithCancelFn(ctx, cancel), &cluster)
+
+			actual := &api.CrdbCluster{}
+			require.NoError(t, cl.Get(ctx, client.ObjectKeyFromObject(cr), actual))
+			requireQuantities(t, tt.expected.Requests, actual.Spec.Resources.Requests)
+			requireQuantities(t, tt.expected.Limits, actual.Spec.Resources.Limits)
+
+			status := cluster.Status().ResourceAutoscaling
+			if equalRequests := tt.expected.Requests.Cpu().Cmp(*current.Requests.Cpu()) == 0 &&
+				tt.expected.Requests.Memory().Cmp(*current.Requests.Memory()) == 0; equalRequests {
+				require.NoError(t, err)
+				require.NoError(t, ctx.Err(), "the loop should go on")
+			} else {
+				require.NoError(t, err)
+				require.Error(t, ctx.Err(), "the loop should be cancelled")
+				status = actual.Status.ResourceAutoscaling
+				require.True(t, status.LastResizeTime.Time.Equal(now))
+			}
+
+			if tt.usage != nil {
+				require.True(t, status.PeakSince.Time.Equal(tt.peakSince.Time))
+				requireQuantities(t, tt.usage, status.Usage)
+			}
+		})
+	}
+}
+
+func TestBusiestUsage(t *testing.T) {
+	podMetrics := func(name string, containers ...interface{}) unstructured.Unstructured {
+		pod := unstructured.Unstructured{Object: map[string]interface{}{"containers": containers}}
+		pod.SetName(name)
+		return pod
+	}
+	container := func(name, cpu, memory string) interface{} {
+		return map[string]interface{}{
+			"name":  name,
+			"usage": map[string]interface{}{"cpu": cpu, "memory": memory},
+		}
+	}
+
+	metrics := &unstructured.UnstructuredList{Items: []unstructured.Unstructured{
+		podMetrics("crdb-0", container(resource.DbContainerName, "250m", "3Gi"), container("sidecar", "2", "8Gi")),
+		podMetrics("crdb-1", container(resource.DbContainerName, "1200m", "2Gi")),
+	}}
+	usage, err := busiestUsage(metrics)
+	require.NoError(t, err)
+	require.Equal(t, "1200m", usage.Cpu().String())
+	require.Equal(t, "3Gi", usage.Memory().String())
+
+	_, err = busiestUsage(&unstructured.UnstructuredList{})
+	require.EqualError(t, err, "no usage of the pods in the metrics API")
+}
@@ -0,0 +1,283 @@
+/*
+Copyright 2021 The Cockroach Authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    https://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package actor
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"time"
+
+	api "github.com/cockroachdb/cockroach-operator/apis/v1alpha1"
+	"github.com/cockroachdb/cockroach-operator/pkg/clustersql"
+	"github.com/cockroachdb/cockroach-operator/pkg/cron"
+	"github.com/cockroachdb/cockroach-operator/pkg/kube"
+	"github.com/cockroachdb/cockroach-operator/pkg/resource"
+	"github.com/cockroachdb/errors"
+	"github.com/go-logr/logr"
+	kbatch "k8s.io/api/batch/v1"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/equality"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/client-go/rest"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+// exportInterval is how often the Job of a running export is polled.
+const exportInterval = time.Minute
+
+func newScheduledExport(scheme *runtime.Scheme, cl client.Client, config *rest.Config) Actor {
+	return &scheduledExport{
+		action: newAction("scheduledExport", scheme, cl),
+		now:    time.Now,
+	}
+}
+
+// scheduledExport runs the exports of the CrdbExports of the cluster on their
+// schedules, like a CronJob: each export is a Job running the EXPORT statement
+// with the cockroach sql client, one at a time, and the Jobs of the last
+// exports are kept. Only the last export missed while the operator was down
+// runs once it is back.
+type scheduledExport struct {
+	action
+
+	now func() time.Time
+}
+
+// GetActionType returns api.ScheduledExportAction action used to set the cluster status errors
+func (e *scheduledExport) GetActionType() api.ActionType {
+	return api.ScheduledExportAction
+}
+
+// Act starts the exports of the cluster that are due, records the outcome of
+// the finished ones in the status of their CrdbExport, and comes back when the
+// next export is due or to poll the running ones.
+func (e *scheduledExport) Act(ctx context.Context, cluster *resource.Cluster) error {
+	log := e.log.WithValues("CrdbCluster", cluster.ObjectKey())
+
+	exports := &api.CrdbExportList{}
+	if err := e.client.List(ctx, exports, client.InNamespace(cluster.Namespace())); err != nil {
+		return errors.Wrap(err, "failed to list exports")
+	}
+
+	now := e.now().UTC()
+	var wait time.Duration
+	for i := range exports.Items {
+		export := &exports.Items[i]
+		if export.Spec.ClusterName != cluster.Name() || export.DeletionTimestamp != nil {
+			continue
+		}
+
+		status := *export.Status.DeepCopy()
+		next, err := e.reconcile(ctx, log, cluster, export, &status, now)
+		if err != nil {
+			return errors.Wrapf(err, "failed to run export %s", export.Name)
+		}
+		if err := e.updateStatus(ctx, export, status); err != nil {
+			return errors.Wrapf(err, "failed to update the status of export %s", export.Name)
+		}
+		if next > 0 && (wait == 0 || next < wait) {
+			wait = next
+		}
+	}
+
+	if wait == 0 {
+		log.V(DEBUGLEVEL).Info("no export scheduled")
+		return nil
+	}
+	return DeferredErr{
+		Err:          errors.Newf("checking the exports again in %s", wait.Round(time.Second)),
+		RequeueAfter: wait,
+	}
+}
+
+// reconcile records the finished Jobs of the export, then starts the Job of
+// its last scheduled export if it did not start yet. It returns how long to
+// wait before coming back, zero when no export is scheduled.
+func (e *scheduledExport) reconcile(ctx context.Context, log logr.Logger, cluster *resource.Cluster, export *api.CrdbExport, status *api.CrdbExportStatus, now time.Time) (time.Duration, error) {
+	spec := export.Spec
+	if err := spec.Validate(); err != nil {
+		status.Message = err.Error()
+		return 0, nil
+	}
+	schedule, err := cron.Parse(spec.Schedule)
+	if err != nil {
+		status.Message = fmt.Sprintf("invalid schedule: %s", err)
+		return 0, nil
+	}
+
+	if err := e.recordJobs(ctx, export, status); err != nil {
+		return 0, err
+	}
+	if status.Active != "" {
+		return exportInterval, nil
+	}
+	if spec.Suspend {
+		return 0, nil
+	}
+
+	// an export created after the last scheduled time waits for the next one
+	last := schedule.Prev(now)
+	since := export.CreationTimestamp.Time
+	if status.LastScheduleTime != nil {
+		since = status.LastScheduleTime.Time
+	}
+	if !last.IsZero() && last.After(since) {
+		return exportInterval, e.start(ctx, log, cluster, export, status, last)
+	}
+
+	next := schedule.Next(now)
+	if next.IsZero() {
+		return 0, nil
+	}
+	return next.Sub(now), nil
+}
+
+// recordJobs records the running Job of the export and when the last exports
+// succeeded and failed, then deletes the oldest finished Jobs beyond the
+// history limits.
+func (e *scheduledExport) recordJobs(ctx context.Context, export *api.CrdbExport, status *api.CrdbExportStatus) error {
+	jobs := &kbatch.JobList{}
+	if err := e.client.List(ctx, jobs, client.InNamespace(export.Namespace), client.MatchingLabels{resource.CrdbExportLabel: export.Name}); err != nil {
+		return errors.Wrap(err, "failed to list jobs")
+	}
+
+	status.Active = ""
+	var succeeded, failed []kbatch.Job
+	for _, job := range jobs.Items {
+		c := finishedCondition(job)
+		if c == nil {
+			status.Active = job.Name
+			continue
+		}
+
+		finished := c.LastTransitionTime
+		if c.Type == kbatch.JobComplete {
+			succeeded = append(succeeded, job)
+			if status.LastSuccessfulTime == nil || finished.After(status.LastSuccessfulTime.Time) {
+				status.LastSuccessfulTime = &finished
+			}
+			continue
+		}
+
+		failed = append(failed, job)
+		if status.LastFailedTime == nil || finished.After(status.LastFailedTime.Time) {
+			status.LastFailedTime = &finished
+			status.Message = fmt.Sprintf("export job %s failed: %s", job.Name, c.Message)
+		}
+	}
+	if status.LastFailedTime == nil || (status.LastSuccessfulTime != nil && status.LastSuccessfulTime.After(status.LastFailedTime.Time)) {
+		status.Message = ""
+	}
+
+	if err := e.pruneJobs(ctx, succeeded, export.Spec.SuccessfulJobsHistoryLimitOrDefault()); err != nil {
+		return err
+	}
+	return e.pruneJobs(ctx, failed, export.Spec.FailedJobsHistoryLimitOrDefault())
+}
+
+// pruneJobs deletes the oldest of the jobs beyond the limit, with their pods.
+func (e *scheduledExport) pruneJobs(ctx context.Context, jobs []kbatch.Job, limit int) error {
+	if len(jobs) <= limit {
+		return nil
+	}
+
+	sort.Slice(jobs, func(i, j int) bool {
+		if !jobs[i].CreationTimestamp.Equal(&jobs[j].CreationTimestamp) {
+			return jobs[i].CreationTimestamp.Before(&jobs[j].CreationTimestamp)
+		}
+		return jobs[i].Name < jobs[j].Name
+	})
+	for i := range jobs[:len(jobs)-limit] {
+		err := e.client.Delete(ctx, &jobs[i], client.PropagationPolicy(metav1.DeletePropagationBackground))
+		if client.IgnoreNotFound(err) != nil {
+			return errors.Wrapf(err, "failed to delete job %s", jobs[i].Name)
+		}
+	}
+	return nil
+}
+
+// start starts the Job of the export scheduled at t, which writes its files in
+// the subdirectory of the URI named after t. The nodes of a cluster with a
+// cloud identity authenticate implicitly.
+func (e *scheduledExport) start(ctx context.Context, log logr.Logger, cluster *resource.Cluster, export *api.CrdbExport, status *api.CrdbExportStatus, t time.Time) error {
+	spec := export.Spec
+	uri := spec.URI
+	if ref := spec.URISecretRef; ref != nil {
+		value, ok, err := resource.SecretValue(ctx, e.client, export.Namespace, ref)
+		if err != nil {
+			return err
+		}
+		if !ok {
+			status.Message = fmt.Sprintf("waiting for key %s of secret %s with the export URI", ref.Key, ref.Name)
+			return nil
+		}
+		uri = value
+	}
+	if cluster.HasCloudIdentity() {
+		uri = clustersql.ImplicitAuthURI(uri)
+	}
+	uri = clustersql.URIWithPath(uri, t.Format(resource.ExportPathFormat))
+	statement := clustersql.ExportStatement(uri, clustersql.Export{Format: string(spec.Format), Table: spec.Table, Query: spec.Query})
+
+	// the export label selects the Jobs of the export
+	managed := resource.NewManagedKubeResource(ctx, e.client, cluster, kube.DefaultPersister)
+	selector := managed.Labels.Selector(cluster.Spec().AdditionalLabels)
+	managed.Labels[resource.CrdbExportLabel] = export.Name
+	builders := []resource.Builder{
+		resource.ExportSecretBuilder{Cluster: cluster, Export: export, Statement: statement},
+		resource.ExportJobBuilder{Cluster: cluster, Export: export, ScheduledAt: t, Selector: selector},
+	}
+	for _, b := range builders {
+		_, err := resource.Reconciler{
+			ManagedResource: managed,
+			Builder:         b,
+			Owner:           export,
+			Scheme:          e.scheme,
+		}.Reconcile()
+		if err != nil {
+			return errors.Wrapf(err, "failed to reconcile %s", b.ResourceName())
+		}
+	}
+
+	log.Info("started export", "export", export.Name, "scheduledAt", t, "uri", clustersql.RedactURI(uri))
+	scheduled := metav1.NewTime(t)
+	status.LastScheduleTime = &scheduled
+	status.Active = resource.ExportJobName(export, t)
+	return nil
+}
+
+func (e *scheduledExport) updateStatus(ctx context.Context, export *api.CrdbExport, status api.CrdbExportStatus) error {
+	if equality.Semantic.DeepEqual(export.Status, status) {
+		return nil
+	}
+
+	export.Status = status
+	return e.client.Status().Update(ctx, export)
+}
+
+// finishedCondition returns the condition of a Job that completed or failed,
+// nil while it runs.
+func finishedCondition(job kbatch.Job) *kbatch.JobCondition {
+	for i, c := range job.Status.Conditions {
+		if (c.Type == kbatch.JobComplete || c.Type == kbatch.JobFailed) && c.Status == corev1.ConditionTrue {
+			return &job.Status.Conditions[i]
+		}
+	}
+	return nil
+}
@@ -0,0 +1,190 @@
+/*
+Copyright 2021 The Cockroach Authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    https://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package actor
+
+import (
+	"context"
+	"fmt"
+	"testing"
+	"time"
+
+	api "github.com/cockroachdb/cockroach-operator/apis/v1alpha1"
+	"github.com/cockroachdb/cockroach-operator/pkg/resource"
+	"github.com/cockroachdb/cockroach-operator/pkg/testutil"
+	"github.com/stretchr/testify/require"
+	kbatch "k8s.io/api/batch/v1"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+)
+
+func TestScheduledExport(t *testing.T) {
+	scheme := testutil.InitScheme(t)
+	now := time.Date(2021, time.June, 2, 20, 30, 0, 0, time.UTC)
+	lastScheduled := time.Date(2021, time.June, 2, 20, 0, 0, 0, time.UTC)
+
+	// finishedJob returns the Job of the export scheduled minutes before the
+	// last scheduled time, finished with a condition of the given type.
+	finishedJob := func(export *api.CrdbExport, minutes int, condition kbatch.JobConditionType) *kbatch.Job {
+		at := lastScheduled.Add(-time.Duration(minutes) * time.Minute)
+		return &kbatch.Job{
+			ObjectMeta: metav1.ObjectMeta{
+				Namespace: "default",
+				Name:      resource.ExportJobName(export, at),
+				Labels:    map[string]string{resource.CrdbExportLabel: export.Name},
+			},
+			Status: kbatch.JobStatus{
+				Conditions: []kbatch.JobCondition{{
+					Type:               condition,
+					Status:             corev1.ConditionTrue,
+					LastTransitionTime: metav1.NewTime(at.Add(time.Minute)),
+					Message:            "Job has reached the specified backoff limit",
+				}},
+			},
+		}
+	}
+
+	tests := []struct {
+		name    string
+		suspend bool
+		// scheduled is whether the export already ran at the last scheduled time
+		scheduled bool
+		jobs      func(export *api.CrdbExport) []client.Object
+		check     func(t *testing.T, cl client.Client, export *api.CrdbExport, err error)
+	}{
+		{
+			name: "starts the last scheduled export",
+			check: func(t *testing.T, cl client.Client, export *api.CrdbExport, err error) {
+				deferred, ok := err.(DeferredErr)
+				require.True(t, ok, err)
+				require.Equal(t, exportInterval, deferred.RequeueAfter)
+
+				name := resource.ExportJobName(export, lastScheduled)
+				job := &kbatch.Job{}
+				require.NoError(t, cl.Get(context.Background(), types.NamespacedName{Namespace: "default", Name: name}, job))
+				require.Equal(t, "rides", job.Labels[resource.CrdbExportLabel])
+
+				secret := &corev1.Secret{}
+				require.NoError(t, cl.Get(context.Background(), types.NamespacedName{Namespace: "default", Name: "rides-export"}, secret))
+				require.Equal(t,
+					`EXPORT INTO CSV 's3://exports/rides/2021/06/02-200000' FROM TABLE "movr"."public"."rides"`,
+					string(secret.Data["EXPORT_STATEMENT"]))
+
+				require.Equal(t, name, export.Status.Active)
+				require.True(t, export.Status.LastScheduleTime.Time.Equal(lastScheduled))
+			},
+		},
+		{
+			name:      "records the finished exports and prunes the oldest",
+			scheduled: true,
+			jobs: func(export *api.CrdbExport) []client.Object {
+				var jobs []client.Object
+				for i := 0; i < 5; i++ {
+					jobs = append(jobs, finishedJob(export, i*60, kbatch.JobComplete))
+				}
+				return jobs
+			},
+			check: func(t *testing.T, cl client.Client, export *api.CrdbExport, err error) {
+				deferred, ok := err.(DeferredErr)
+				require.True(t, ok, err)
+				require.Equal(t, 30*time.Minute, deferred.RequeueAfter)
+
+				jobs := &kbatch.JobList{}
+				require.NoError(t, cl.List(context.Background(), jobs, client.InNamespace("default")))
+				require.Len(t, jobs.Items, 3)
+				for _, job := range jobs.Items {
+					require.NotEqual(t, resource.ExportJobName(export, lastScheduled.Add(-4*time.Hour)), job.Name)
+				}
+
+				require.Empty(t, export.Status.Active)
+				require.Empty(t, export.Status.Message)
+				require.True(t, export.Status.LastSuccessfulTime.Time.Equal(lastScheduled.Add(time.Minute)))
+			},
+		},
+		{
+			name:      "records a failed export",
+			scheduled: true,
+			jobs: func(export *api.CrdbExport) []client.Object {
+				return []client.Object{
+					finishedJob(export, 60, kbatch.JobComplete),
+					finishedJob(export, 0, kbatch.JobFailed),
+				}
+			},
+			check: func(t *testing.T, cl client.Client, export *api.CrdbExport, err error) {
+				_, ok := err.(DeferredErr)
+				require.True(t, ok, err)
+
+				name := resource.ExportJobName(export, lastScheduled)
+				require.Equal(t, fmt.Sprintf("export job %s failed: Job has reached the specified backoff limit", name), export.Status.Message)
+				require.True(t, export.Status.LastFailedTime.Time.Equal(lastScheduled.Add(time.Minute)))
+			},
+		},
+		{
+			name:    "suspended export does not start",
+			suspend: true,
+			check: func(t *testing.T, cl client.Client, export *api.CrdbExport, err error) {
+				require.NoError(t, err)
+
+				jobs := &kbatch.JobList{}
+				require.NoError(t, cl.List(context.Background(), jobs, client.InNamespace("default")))
+				require.Empty(t, jobs.Items)
+				require.Nil(t, export.Status.LastScheduleTime)
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cr := testutil.NewBuilder("crdb").Namespaced("default").WithNodeCount(3).WithTLS().Cr()
+			cluster := resource.NewCluster(cr)
+			export := &api.CrdbExport{
+				ObjectMeta: metav1.ObjectMeta{
+					Namespace:         "default",
+					Name:              "rides",
+					CreationTimestamp: metav1.NewTime(now.Add(-24 * time.Hour)),
+				},
+				Spec: api.CrdbExportSpec{
+					ClusterName: "crdb",
+					Schedule:    "0 * * * *",
+					Table:       "movr.public.rides",
+					URI:         "s3://exports/rides",
+					Suspend:     tt.suspend,
+				},
+			}
+			if tt.scheduled {
+				scheduled := metav1.NewTime(lastScheduled)
+				export.Status.LastScheduleTime = &scheduled
+			}
+
+			objs := []client.Object{cr, export}
+			if tt.jobs != nil {
+				objs = append(objs, tt.jobs(export)...)
+			}
+			cl := fake.NewFakeClientWithScheme(scheme, objs...)
+
+			e := newScheduledExport(scheme, cl, nil).(*scheduledExport)
+			e.now = func() time.Time { return now }
+			err := e.Act(context.Background(), &cluster)
+
+			actual := &api.CrdbExport{}
+			require.NoError(t, cl.Get(context.Background(), types.NamespacedName{Namespace: "default", Name: "rides"}, actual))
+			tt.check(t, cl, actual, err)
+		})
+	}
+}
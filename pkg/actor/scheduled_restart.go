@@ -0,0 +1,156 @@
+/*
+Copyright 2021 The Cockroach Authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    https://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package actor
+
+import (
+	"context"
+	"time"
+
+	api "github.com/cockroachdb/cockroach-operator/apis/v1alpha1"
+	"github.com/cockroachdb/cockroach-operator/pkg/cron"
+	"github.com/cockroachdb/cockroach-operator/pkg/resource"
+	"github.com/cockroachdb/errors"
+	"github.com/go-logr/logr"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/client-go/rest"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+// restartWindow is how long after its scheduled time a restart can still
+// start, for instance while another restart or an update runs.
+const restartWindow = time.Hour
+
+func newScheduledRestart(scheme *runtime.Scheme, cl client.Client, config *rest.Config) Actor {
+	return &scheduledRestart{
+		action: newAction("scheduledRestart", scheme, cl),
+		now:    time.Now,
+	}
+}
+
+// scheduledRestart starts a rolling restart of the pods when the restart
+// schedule fires, or at the time of restartAt. It sets the restart type
+// annotation like for a manual restart, and the cluster restart actor restarts
+// the pods one at a time.
+type scheduledRestart struct {
+	action
+
+	now func() time.Time
+}
+
+// GetActionType returns api.ScheduledRestartAction action used to set the cluster status errors
+func (s *scheduledRestart) GetActionType() api.ActionType {
+	return api.ScheduledRestartAction
+}
+
+// Act starts the restart of restartAt or the last scheduled restart if it was
+// not started yet, and comes back at the time of the next one.
+func (s *scheduledRestart) Act(ctx context.Context, cluster *resource.Cluster) error {
+	log := s.log.WithValues("CrdbCluster", cluster.ObjectKey())
+	now := s.now().UTC()
+	created := cluster.Unwrap().CreationTimestamp.Time
+
+	// a restartAt set when the cluster was created is not due, as the pods
+	// just started
+	var wait time.Duration
+	if at := cluster.Spec().RestartAt; at != nil && at.Time.After(created) &&
+		at.Time.After(s.lastStarted(cluster, cluster.GetAnnotationRestartAt())) {
+		if !at.Time.After(now) {
+			log.Info("restarting the cluster for restartAt", "restartAt", at.Time)
+			return s.startRestart(ctx, cluster, log, resource.CrdbRestartAtAnnotation, at.Time)
+		}
+		wait = at.Time.Sub(now)
+	}
+
+	if cluster.Spec().RestartSchedule != "" {
+		schedule, err := cron.Parse(cluster.Spec().RestartSchedule)
+		if err != nil {
+			return ValidationError{Err: err}
+		}
+
+		last := schedule.Prev(now)
+
+		// the restarts scheduled before the cluster was created are not due
+		due := !last.IsZero() && last.After(s.lastStarted(cluster, cluster.GetAnnotationScheduledRestart())) &&
+			!last.Before(created)
+		if due && now.Sub(last) > restartWindow {
+			log.Info("skipping the scheduled restart, its window is closed", "scheduledAt", last)
+			due = false
+		}
+
+		if due {
+			log.Info("restarting the cluster on schedule", "scheduledAt", last)
+			return s.startRestart(ctx, cluster, log, resource.CrdbScheduledRestartAnnotation, last)
+		}
+
+		if next := schedule.Next(now); !next.IsZero() && (wait == 0 || next.Sub(now) < wait) {
+			wait = next.Sub(now)
+		}
+	}
+
+	if wait == 0 {
+		log.V(DEBUGLEVEL).Info("no scheduled restart left")
+		return nil
+	}
+	return DeferredErr{
+		Err:          errors.Newf("the cluster will be restarted on schedule in %s", wait.Round(time.Second)),
+		RequeueAfter: wait,
+	}
+}
+
+// startRestart sets the restart type annotation, and records the time of the
+// restart in the annotation, once the running restart is over.
+func (s *scheduledRestart) startRestart(ctx context.Context, cluster *resource.Cluster, log logr.Logger, annotation string, at time.Time) error {
+	if restartType := cluster.GetAnnotationRestartType(); restartType != "" {
+		log.Info("waiting for the running restart to finish before the scheduled restart", "restartType", restartType)
+		return DeferredErr{
+			Err:          errors.New("waiting for the running restart to finish"),
+			RequeueAfter: time.Minute,
+		}
+	}
+
+	// the annotations are updated, so the other actors must wait for the next loop
+	fetcher := resource.NewKubeFetcher(ctx, cluster.Namespace(), s.client)
+	cr := resource.ClusterPlaceholder(cluster.Name())
+	if err := fetcher.Fetch(cr); err != nil {
+		return errors.Wrap(err, "failed to fetch the CrdbCluster")
+	}
+
+	metav1.SetMetaDataAnnotation(&cr.ObjectMeta, annotation, at.UTC().Format(time.RFC3339))
+	metav1.SetMetaDataAnnotation(&cr.ObjectMeta, resource.CrdbRestartTypeAnnotation, api.ClusterRestartType(api.RollingRestart).String())
+	if err := s.client.Update(ctx, cr); err != nil {
+		return errors.Wrap(err, "failed to start the scheduled restart")
+	}
+
+	CancelLoop(ctx)
+	return nil
+}
+
+// lastStarted returns the time of the last restart that was started, the value
+// of its annotation, or the zero time if none was.
+func (s *scheduledRestart) lastStarted(cluster *resource.Cluster, value string) time.Time {
+	if value == "" {
+		return time.Time{}
+	}
+
+	t, err := time.Parse(time.RFC3339, value)
+	if err != nil {
+		s.log.Info("ignoring invalid restart annotation", "CrdbCluster", cluster.ObjectKey(), "value", value)
+		return time.Time{}
+	}
+	return t
+}
@@ -0,0 +1,222 @@
+/*
+Copyright 2021 The Cockroach Authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    https://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package actor
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	api "github.com/cockroachdb/cockroach-operator/apis/v1alpha1"
+	"github.com/cockroachdb/cockroach-operator/pkg/resource"
+	"github.com/cockroachdb/cockroach-operator/pkg/testutil"
+	"github.com/stretchr/testify/require"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+)
+
+func TestScheduledRestart(t *testing.T) {
+	scheme := testutil.InitScheme(t)
+	// a Wednesday night, 30 minutes after the restart scheduled at 02:00
+	now := time.Date(2021, time.June, 2, 2, 30, 0, 0, time.UTC)
+	created := time.Date(2021, time.May, 1, 0, 0, 0, 0, time.UTC)
+
+	tests := []struct {
+		name        string
+		schedule    string
+		created     time.Time
+		annotations map[string]string
+		restarted   bool
+		check       func(t *testing.T, err error)
+	}{
+		{
+			name:      "restarts on the last scheduled time",
+			schedule:  "0 2 * * *",
+			created:   created,
+			restarted: true,
+			check: func(t *testing.T, err error) {
+				require.NoError(t, err)
+			},
+		},
+		{
+			name:        "waits for the next scheduled time",
+			schedule:    "0 2 * * *",
+			created:     created,
+			annotations: map[string]string{resource.CrdbScheduledRestartAnnotation: "2021-06-02T02:00:00Z"},
+			check: func(t *testing.T, err error) {
+				deferred, ok := err.(DeferredErr)
+				require.True(t, ok, err)
+				require.Equal(t, 23*time.Hour+30*time.Minute, deferred.RequeueAfter)
+			},
+		},
+		{
+			name:     "skips a restart whose window is closed",
+			schedule: "0 1 * * *",
+			created:  created,
+			check: func(t *testing.T, err error) {
+				deferred, ok := err.(DeferredErr)
+				require.True(t, ok, err)
+				require.Equal(t, 22*time.Hour+30*time.Minute, deferred.RequeueAfter)
+			},
+		},
+		{
+			name:     "skips the restarts scheduled before the cluster was created",
+			schedule: "0 2 * * *",
+			created:  now.Add(-10 * time.Minute),
+			check: func(t *testing.T, err error) {
+				_, ok := err.(DeferredErr)
+				require.True(t, ok, err)
+			},
+		},
+		{
+			name:        "waits for the running restart",
+			schedule:    "0 2 * * *",
+			created:     created,
+			annotations: map[string]string{resource.CrdbRestartTypeAnnotation: "FullCluster"},
+			check: func(t *testing.T, err error) {
+				deferred, ok := err.(DeferredErr)
+				require.True(t, ok, err)
+				require.Equal(t, time.Minute, deferred.RequeueAfter)
+			},
+		},
+		{
+			name:     "schedule is invalid",
+			schedule: "0 2 * *",
+			created:  created,
+			check: func(t *testing.T, err error) {
+				_, ok := err.(ValidationError)
+				require.True(t, ok, err)
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cr := testutil.NewBuilder("crdb").Namespaced("default").WithNodeCount(3).Cr()
+			cr.Spec.RestartSchedule = tt.schedule
+			cr.CreationTimestamp = metav1.NewTime(tt.created)
+			cr.Annotations = tt.annotations
+			cluster := resource.NewCluster(cr)
+			cl := fake.NewFakeClientWithScheme(scheme, cr)
+
+			s := newScheduledRestart(scheme, cl, nil).(*scheduledRestart)
+			s.now = func() time.Time { return now }
+
+			ctx, cancel := context.WithCancel(context.Background())
+			defer cancel()
+			tt.check(t, s.Act(ContextWithCancelFn(ctx, cancel), &cluster))
+
+			actual := &api.CrdbCluster{}
+			require.NoError(t, cl.Get(ctx, client.ObjectKeyFromObject(cr), actual))
+			if tt.restarted {
+				require.Equal(t, "Rolling", actual.Annotations[resource.CrdbRestartTypeAnnotation])
+				require.Equal(t, "2021-06-02T02:00:00Z", actual.Annotations[resource.CrdbScheduledRestartAnnotation])
+				require.Error(t, ctx.Err(), "the loop should be cancelled")
+			} else {
+				require.Equal(t, tt.annotations[resource.CrdbRestartTypeAnnotation], actual.Annotations[resource.CrdbRestartTypeAnnotation])
+				require.NoError(t, ctx.Err())
+			}
+		})
+	}
+}
+
+func TestRestartAt(t *testing.T) {
+	scheme := testutil.InitScheme(t)
+	now := time.Date(2021, time.June, 2, 2, 30, 0, 0, time.UTC)
+	created := time.Date(2021, time.May, 1, 0, 0, 0, 0, time.UTC)
+
+	tests := []struct {
+		name        string
+		restartAt   time.Time
+		schedule    string
+		annotations map[string]string
+		restarted   bool
+		wait        time.Duration
+	}{
+		{
+			name:      "restarts once restartAt is reached",
+			restartAt: now.Add(-5 * time.Minute),
+			restarted: true,
+		},
+		{
+			name:      "waits for restartAt",
+			restartAt: now.Add(time.Hour),
+			wait:      time.Hour,
+		},
+		{
+			name:        "does not restart again for the same restartAt",
+			restartAt:   now.Add(-5 * time.Minute),
+			annotations: map[string]string{resource.CrdbRestartAtAnnotation: "2021-06-02T02:25:00Z"},
+		},
+		{
+			name:        "restarts again for a later restartAt",
+			restartAt:   now.Add(-5 * time.Minute),
+			annotations: map[string]string{resource.CrdbRestartAtAnnotation: "2021-06-01T10:00:00Z"},
+			restarted:   true,
+		},
+		{
+			name:      "skips a restartAt set when the cluster was created",
+			restartAt: created.Add(-time.Hour),
+		},
+		{
+			name:        "waits for the first of restartAt and the schedule",
+			restartAt:   now.Add(time.Hour),
+			schedule:    "0 2 * * *",
+			annotations: map[string]string{resource.CrdbScheduledRestartAnnotation: "2021-06-02T02:00:00Z"},
+			wait:        time.Hour,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cr := testutil.NewBuilder("crdb").Namespaced("default").WithNodeCount(3).Cr()
+			restartAt := metav1.NewTime(tt.restartAt)
+			cr.Spec.RestartAt = &restartAt
+			cr.Spec.RestartSchedule = tt.schedule
+			cr.CreationTimestamp = metav1.NewTime(created)
+			cr.Annotations = tt.annotations
+			cluster := resource.NewCluster(cr)
+			cl := fake.NewFakeClientWithScheme(scheme, cr)
+
+			s := newScheduledRestart(scheme, cl, nil).(*scheduledRestart)
+			s.now = func() time.Time { return now }
+
+			ctx, cancel := context.WithCancel(context.Background())
+			defer cancel()
+			err := s.Act(ContextWithCancelFn(ctx, cancel), &cluster)
+			if tt.wait != 0 {
+				deferred, ok := err.(DeferredErr)
+				require.True(t, ok, err)
+				require.Equal(t, tt.wait, deferred.RequeueAfter)
+			} else {
+				require.NoError(t, err)
+			}
+
+			actual := &api.CrdbCluster{}
+			require.NoError(t, cl.Get(ctx, client.ObjectKeyFromObject(cr), actual))
+			if tt.restarted {
+				require.Equal(t, "Rolling", actual.Annotations[resource.CrdbRestartTypeAnnotation])
+				require.Equal(t, "2021-06-02T02:25:00Z", actual.Annotations[resource.CrdbRestartAtAnnotation])
+				require.Error(t, ctx.Err(), "the loop should be cancelled")
+			} else {
+				require.Empty(t, actual.Annotations[resource.CrdbRestartTypeAnnotation])
+				require.NoError(t, ctx.Err())
+			}
+		})
+	}
+}
@@ -0,0 +1,123 @@
+/*
+Copyright 2021 The Cockroach Authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    https://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package actor
+
+import (
+	"context"
+	"time"
+
+	api "github.com/cockroachdb/cockroach-operator/apis/v1alpha1"
+	"github.com/cockroachdb/cockroach-operator/pkg/cron"
+	"github.com/cockroachdb/cockroach-operator/pkg/resource"
+	"github.com/cockroachdb/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/client-go/rest"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+func newScheduledScaling(scheme *runtime.Scheme, cl client.Client, config *rest.Config) Actor {
+	return &scheduledScaling{
+		action: newAction("scheduledScaling", scheme, cl),
+		now:    time.Now,
+	}
+}
+
+// scheduledScaling sets the number of nodes in the spec when an entry of the
+// scaling schedule fires. The decommission and deploy actors then scale the
+// cluster like for a manual change.
+type scheduledScaling struct {
+	action
+
+	now func() time.Time
+}
+
+// GetActionType returns api.ScheduledScalingAction action used to set the cluster status errors
+func (s *scheduledScaling) GetActionType() api.ActionType {
+	return api.ScheduledScalingAction
+}
+
+// Act applies the last scheduled change of the number of nodes if it was not
+// applied yet, and comes back at the time of the next one.
+func (s *scheduledScaling) Act(ctx context.Context, cluster *resource.Cluster) error {
+	log := s.log.WithValues("CrdbCluster", cluster.ObjectKey())
+
+	now := s.now().UTC()
+	var last, next time.Time
+	var nodes int32
+	for _, entry := range cluster.Spec().ScalingSchedule {
+		schedule, err := cron.Parse(entry.Schedule)
+		if err != nil {
+			return ValidationError{Err: err}
+		}
+
+		// the last entry wins when several fire at the same time
+		if prev := schedule.Prev(now); !prev.IsZero() && !prev.Before(last) {
+			last, nodes = prev, entry.Nodes
+		}
+		if n := schedule.Next(now); !n.IsZero() && (next.IsZero() || n.Before(next)) {
+			next = n
+		}
+	}
+
+	if !last.IsZero() && last.After(s.lastApplied(cluster)) {
+		log.Info("scaling the cluster on schedule", "scheduledAt", last, "from", cluster.Spec().Nodes, "to", nodes)
+
+		// the spec is updated, so the other actors must wait for the next loop
+		fetcher := resource.NewKubeFetcher(ctx, cluster.Namespace(), s.client)
+		cr := resource.ClusterPlaceholder(cluster.Name())
+		if err := fetcher.Fetch(cr); err != nil {
+			return errors.Wrap(err, "failed to fetch the CrdbCluster")
+		}
+
+		metav1.SetMetaDataAnnotation(&cr.ObjectMeta, resource.CrdbScheduledScalingAnnotation, last.Format(time.RFC3339))
+		cr.Spec.Nodes = nodes
+		if err := s.client.Update(ctx, cr); err != nil {
+			return errors.Wrap(err, "failed to update the number of nodes")
+		}
+
+		CancelLoop(ctx)
+		return nil
+	}
+
+	if next.IsZero() {
+		log.V(DEBUGLEVEL).Info("no scheduled scaling left")
+		return nil
+	}
+
+	wait := next.Sub(now)
+	return DeferredErr{
+		Err:          errors.Newf("the cluster will be scaled on schedule in %s", wait.Round(time.Second)),
+		RequeueAfter: wait,
+	}
+}
+
+// lastApplied returns the time of the last scheduled change that was applied,
+// or the zero time if none was.
+func (s *scheduledScaling) lastApplied(cluster *resource.Cluster) time.Time {
+	value := cluster.GetAnnotationScheduledScaling()
+	if value == "" {
+		return time.Time{}
+	}
+
+	t, err := time.Parse(time.RFC3339, value)
+	if err != nil {
+		s.log.Info("ignoring invalid scheduled scaling annotation", "CrdbCluster", cluster.ObjectKey(), "value", value)
+		return time.Time{}
+	}
+	return t
+}
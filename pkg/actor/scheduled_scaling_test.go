@@ -0,0 +1,104 @@
+/*
+Copyright 2021 The Cockroach Authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    https://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package actor
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	api "github.com/cockroachdb/cockroach-operator/apis/v1alpha1"
+	"github.com/cockroachdb/cockroach-operator/pkg/resource"
+	"github.com/cockroachdb/cockroach-operator/pkg/testutil"
+	"github.com/stretchr/testify/require"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+)
+
+func TestScheduledScaling(t *testing.T) {
+	scheme := testutil.InitScheme(t)
+	// a Wednesday evening
+	now := time.Date(2021, time.June, 2, 20, 30, 0, 0, time.UTC)
+	schedule := []api.ScheduledScaling{
+		{Schedule: "0 7 * * mon-fri", Nodes: 6},
+		{Schedule: "0 20 * * mon-fri", Nodes: 3},
+	}
+
+	tests := []struct {
+		name        string
+		schedule    []api.ScheduledScaling
+		lastApplied string
+		nodes       int32
+		check       func(t *testing.T, err error)
+	}{
+		{
+			name:     "scales on the last scheduled change",
+			schedule: schedule,
+			nodes:    3,
+			check: func(t *testing.T, err error) {
+				require.NoError(t, err)
+			},
+		},
+		{
+			name:        "waits for the next scheduled change",
+			schedule:    schedule,
+			lastApplied: "2021-06-02T20:00:00Z",
+			nodes:       6,
+			check: func(t *testing.T, err error) {
+				deferred, ok := err.(DeferredErr)
+				require.True(t, ok, err)
+				require.Equal(t, 10*time.Hour+30*time.Minute, deferred.RequeueAfter)
+			},
+		},
+		{
+			name:     "schedule is invalid",
+			schedule: []api.ScheduledScaling{{Schedule: "0 7 * *", Nodes: 6}},
+			nodes:    6,
+			check: func(t *testing.T, err error) {
+				_, ok := err.(ValidationError)
+				require.True(t, ok, err)
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cr := testutil.NewBuilder("crdb").Namespaced("default").WithNodeCount(6).Cr()
+			cr.Spec.ScalingSchedule = tt.schedule
+			if tt.lastApplied != "" {
+				cr.Annotations = map[string]string{resource.CrdbScheduledScalingAnnotation: tt.lastApplied}
+			}
+			cluster := resource.NewCluster(cr)
+			cl := fake.NewFakeClientWithScheme(scheme, cr)
+
+			s := newScheduledScaling(scheme, cl, nil).(*scheduledScaling)
+			s.now = func() time.Time { return now }
+
+			ctx, cancel := context.WithCancel(context.Background())
+			defer cancel()
+			tt.check(t, s.Act(ContextWithCancelFn(ctx, cancel), &cluster))
+
+			actual := &api.CrdbCluster{}
+			require.NoError(t, cl.Get(ctx, client.ObjectKeyFromObject(cr), actual))
+			require.Equal(t, tt.nodes, actual.Spec.Nodes)
+			if tt.nodes != cr.Spec.Nodes {
+				require.Equal(t, "2021-06-02T20:00:00Z", actual.Annotations[resource.CrdbScheduledScalingAnnotation])
+				require.Error(t, ctx.Err(), "the loop should be cancelled")
+			}
+		})
+	}
+}
@@ -0,0 +1,377 @@
+/*
+Copyright 2021 The Cockroach Authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    https://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package actor
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	api "github.com/cockroachdb/cockroach-operator/apis/v1alpha1"
+	"github.com/cockroachdb/cockroach-operator/pkg/clustersql"
+	"github.com/cockroachdb/cockroach-operator/pkg/resource"
+	"github.com/cockroachdb/errors"
+	appsv1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	kubetypes "k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/rest"
+	"k8s.io/client-go/tools/record"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+const (
+	// restartedAtAnnotation records on the PVCs of a pod when the pod was
+	// restarted because it was unhealthy.
+	restartedAtAnnotation = "crdb.io/restarted-at"
+
+	// crashLoopBackOff is the reason a crash-looping container waits for.
+	crashLoopBackOff = "CrashLoopBackOff"
+
+	// selfHealingRecheck is how often pods that may become unhealthy, or pods
+	// whose node liveness is unknown, are checked again.
+	selfHealingRecheck = time.Minute
+)
+
+func newSelfHealing(scheme *runtime.Scheme, cl client.Client, config *rest.Config, recorder record.EventRecorder) Actor {
+	h := &selfHealing{
+		action:   newAction("selfHealing", scheme, cl),
+		config:   config,
+		recorder: recorder,
+		now:      time.Now,
+	}
+	h.nodes = h.clusterNodes
+	return h
+}
+
+// selfHealing restarts the pods that stay unhealthy while their CockroachDB
+// node is not live, and replaces their store when restarting them did not help
+// and the cluster spec allows it
+type selfHealing struct {
+	action
+
+	config   *rest.Config
+	recorder record.EventRecorder
+	now      func() time.Time
+	// nodes returns the nodes of the cluster with their liveness
+	nodes func(ctx context.Context, cluster *resource.Cluster) ([]clustersql.Node, error)
+}
+
+// unhealthyPod is a pod of the cluster that needs healing.
+type unhealthyPod struct {
+	pod    *corev1.Pod
+	reason string
+}
+
+//GetActionType returns api.SelfHealingAction used to set the cluster status errors
+func (h selfHealing) GetActionType() api.ActionType {
+	return api.SelfHealingAction
+}
+
+func (h selfHealing) Act(ctx context.Context, cluster *resource.Cluster) error {
+	log := h.log.WithValues("CrdbCluster", cluster.ObjectKey())
+	log.V(DEBUGLEVEL).Info("checking the health of the pods")
+
+	// the pods of a restarting cluster are not ready on purpose
+	if cluster.GetAnnotationRestartType() != "" {
+		log.V(DEBUGLEVEL).Info("cluster is restarting, not healing pods")
+		return nil
+	}
+
+	// the pods of the node pools are healed like the other pods
+	statefulSets, err := resource.ClusterStatefulSets(ctx, h.client, cluster)
+	if err != nil || len(statefulSets) == 0 {
+		return err
+	}
+
+	pods, err := statefulSetPods(ctx, h.client, statefulSets)
+	if err != nil {
+		return err
+	}
+	replicas := statefulSetReplicas(statefulSets, pods)
+
+	policy := cluster.Spec().SelfHealing
+	now := h.now()
+	// recheck is when a pod that is not ready yet may become unhealthy, or
+	// when a pod on a lost node is rescheduled
+	var recheck time.Duration
+	if policy.RescheduleEnabled() {
+		wait, err := h.reschedule(ctx, cluster, statefulSets, pods, now)
+		if err != nil {
+			return err
+		}
+		recheck = wait
+	}
+
+	var unhealthy []unhealthyPod
+	ready := 0
+	for i := range pods.Items {
+		pod := &pods.Items[i]
+		// the pods on lost nodes are rescheduled instead of restarted
+		_, lost := pod.Annotations[nodeLostAtAnnotation]
+		if pod.DeletionTimestamp != nil || (lost && policy.RescheduleEnabled()) {
+			continue
+		}
+
+		reason, wait := podHealth(pod, policy, now)
+		switch {
+		case reason != "":
+			unhealthy = append(unhealthy, unhealthyPod{pod: pod, reason: reason})
+		case wait > 0:
+			if recheck == 0 || wait < recheck {
+				recheck = wait
+			}
+		default:
+			ready++
+			if err := h.clearRestartedAt(ctx, podStatefulSet(statefulSets, pod.Name), pod); err != nil {
+				return err
+			}
+		}
+	}
+
+	if len(unhealthy) == 0 {
+		if recheck > 0 {
+			return DeferredErr{Err: errors.New("some pods are not ready"), RequeueAfter: recheck}
+		}
+		return nil
+	}
+
+	nodes, err := h.nodes(ctx, cluster)
+	if err != nil {
+		log.Error(err, "failed to get the liveness of the nodes")
+		return DeferredErr{
+			Err:          errors.Wrapf(err, "%d pods are unhealthy but the liveness of their nodes is unknown", len(unhealthy)),
+			RequeueAfter: selfHealingRecheck,
+		}
+	}
+
+	// only one pod is healed at a time, the others are checked again later
+	for _, u := range unhealthy {
+		node, found := nodeOfPod(nodes, u.pod.Name)
+		if found && node.IsLive {
+			h.recorder.Eventf(cluster.Unwrap(), corev1.EventTypeNormal, "PodUnhealthy",
+				"Pod %s is unhealthy: %s, but node %d is live, not restarting it", u.pod.Name, u.reason, node.ID)
+			continue
+		}
+
+		nodeDesc := "its node is not known to the cluster"
+		if found {
+			nodeDesc = fmt.Sprintf("node %d is not live", node.ID)
+		}
+
+		ss := podStatefulSet(statefulSets, u.pod.Name)
+		othersAreReady := ready == replicas-1
+		replace, err := h.shouldReplaceStore(ctx, ss, u.pod, policy, now)
+		if err != nil {
+			return err
+		}
+		if replace && othersAreReady {
+			if err := replaceStore(ctx, h.client, ss, u.pod); err != nil {
+				return err
+			}
+			log.Info("replaced the store of an unhealthy pod", "pod", u.pod.Name, "reason", u.reason)
+			h.recorder.Eventf(cluster.Unwrap(), corev1.EventTypeWarning, "StoreReplaced",
+				"Pod %s is still unhealthy after a restart: %s, and %s, replaced its store; the dead node should be decommissioned",
+				u.pod.Name, u.reason, nodeDesc)
+			return DeferredErr{Err: errors.Newf("replaced the store of pod %s", u.pod.Name), RequeueAfter: policy.UnhealthyThresholdOrDefault()}
+		}
+
+		if err := h.restart(ctx, ss, u.pod, now); err != nil {
+			return err
+		}
+		log.Info("restarted an unhealthy pod", "pod", u.pod.Name, "reason", u.reason)
+		h.recorder.Eventf(cluster.Unwrap(), corev1.EventTypeWarning, "PodRestarted",
+			"Pod %s is unhealthy: %s, and %s, restarted it", u.pod.Name, u.reason, nodeDesc)
+		return DeferredErr{Err: errors.Newf("restarted pod %s", u.pod.Name), RequeueAfter: policy.UnhealthyThresholdOrDefault()}
+	}
+
+	return DeferredErr{Err: errors.New("unhealthy pods have live nodes"), RequeueAfter: policy.UnhealthyThresholdOrDefault()}
+}
+
+// podHealth returns why the pod is unhealthy, or how long until it can become
+// unhealthy if it is not ready yet. Both are empty for ready pods.
+func podHealth(pod *corev1.Pod, policy *api.SelfHealing, now time.Time) (string, time.Duration) {
+	for _, status := range pod.Status.ContainerStatuses {
+		if status.Name != resource.DbContainerName {
+			continue
+		}
+		waiting := status.State.Waiting
+		if waiting != nil && waiting.Reason == crashLoopBackOff && status.RestartCount >= policy.CrashLoopRestartsOrDefault() {
+			return fmt.Sprintf("container %s is crash-looping after %d restarts", status.Name, status.RestartCount), 0
+		}
+	}
+
+	threshold := policy.UnhealthyThresholdOrDefault()
+	for _, c := range pod.Status.Conditions {
+		if c.Type != corev1.PodReady {
+			continue
+		}
+		if c.Status == corev1.ConditionTrue {
+			return "", 0
+		}
+
+		notReadyFor := now.Sub(c.LastTransitionTime.Time)
+		if notReadyFor >= threshold {
+			return fmt.Sprintf("not ready for %s", notReadyFor.Round(time.Second)), 0
+		}
+		return "", threshold - notReadyFor
+	}
+
+	// a pod without a ready condition has not been scheduled yet
+	notReadyFor := now.Sub(pod.CreationTimestamp.Time)
+	if notReadyFor >= threshold {
+		return fmt.Sprintf("not ready for %s", notReadyFor.Round(time.Second)), 0
+	}
+	return "", threshold - notReadyFor
+}
+
+// nodeOfPod returns the node the pod runs, which advertises the pod name.
+func nodeOfPod(nodes []clustersql.Node, podName string) (clustersql.Node, bool) {
+	var found clustersql.Node
+	ok := false
+	// a pod whose store was replaced runs a new node with a higher ID
+	for _, n := range nodes {
+		if n.PodName() == podName {
+			found, ok = n, true
+		}
+	}
+	return found, ok
+}
+
+// claims returns the names of the PVCs of the pod, created from the volume
+// claim templates of the statefulset.
+func claims(ss *appsv1.StatefulSet, pod *corev1.Pod) []string {
+	var names []string
+	for _, t := range ss.Spec.VolumeClaimTemplates {
+		names = append(names, fmt.Sprintf("%s-%s", t.Name, pod.Name))
+	}
+	return names
+}
+
+// restart deletes the pod, for the statefulset controller to recreate it, and
+// records the time of the restart on its PVCs.
+func (h selfHealing) restart(ctx context.Context, ss *appsv1.StatefulSet, pod *corev1.Pod, now time.Time) error {
+	for _, name := range claims(ss, pod) {
+		pvc := &corev1.PersistentVolumeClaim{}
+		if err := h.client.Get(ctx, kubetypes.NamespacedName{Namespace: pod.Namespace, Name: name}, pvc); err != nil {
+			if apierrors.IsNotFound(err) {
+				continue
+			}
+			return errors.Wrapf(err, "failed to get pvc %s", name)
+		}
+		// the first restart is kept, the store is replaced when restarts do not help
+		if _, ok := pvc.Annotations[restartedAtAnnotation]; ok {
+			continue
+		}
+
+		patch := client.MergeFrom(pvc.DeepCopy())
+		metav1.SetMetaDataAnnotation(&pvc.ObjectMeta, restartedAtAnnotation, now.UTC().Format(time.RFC3339))
+		if err := h.client.Patch(ctx, pvc, patch); err != nil {
+			return errors.Wrapf(err, "failed to annotate pvc %s", name)
+		}
+	}
+
+	if err := h.client.Delete(ctx, pod); client.IgnoreNotFound(err) != nil {
+		return errors.Wrapf(err, "failed to restart pod %s", pod.Name)
+	}
+	return nil
+}
+
+// shouldReplaceStore returns whether the store of the pod is replaced: the
+// spec allows it, and the pod is still unhealthy long enough after a restart.
+func (h selfHealing) shouldReplaceStore(ctx context.Context, ss *appsv1.StatefulSet, pod *corev1.Pod, policy *api.SelfHealing, now time.Time) (bool, error) {
+	if !policy.ReplaceStoreEnabled() {
+		return false, nil
+	}
+
+	names := claims(ss, pod)
+	if len(names) == 0 {
+		return false, nil
+	}
+
+	for _, name := range names {
+		pvc := &corev1.PersistentVolumeClaim{}
+		if err := h.client.Get(ctx, kubetypes.NamespacedName{Namespace: pod.Namespace, Name: name}, pvc); err != nil {
+			if apierrors.IsNotFound(err) {
+				return false, nil
+			}
+			return false, errors.Wrapf(err, "failed to get pvc %s", name)
+		}
+
+		restartedAt, err := time.Parse(time.RFC3339, pvc.Annotations[restartedAtAnnotation])
+		if err != nil || now.Sub(restartedAt) < policy.ReplaceStoreAfterOrDefault() {
+			return false, nil
+		}
+	}
+
+	return true, nil
+}
+
+// replaceStore deletes the PVCs of the pod, then the pod, so that the
+// statefulset controller recreates them and the pod starts with an empty store.
+// If the pod is recreated before its PVCs are gone, it stays pending, becomes
+// unhealthy and is restarted again. The options apply to the deletion of the
+// pod.
+func replaceStore(ctx context.Context, cl client.Client, ss *appsv1.StatefulSet, pod *corev1.Pod, opts ...client.DeleteOption) error {
+	for _, name := range claims(ss, pod) {
+		pvc := &corev1.PersistentVolumeClaim{ObjectMeta: metav1.ObjectMeta{Namespace: pod.Namespace, Name: name}}
+		if err := cl.Delete(ctx, pvc); client.IgnoreNotFound(err) != nil {
+			return errors.Wrapf(err, "failed to delete pvc %s", name)
+		}
+	}
+
+	if err := cl.Delete(ctx, pod, opts...); client.IgnoreNotFound(err) != nil {
+		return errors.Wrapf(err, "failed to delete pod %s", pod.Name)
+	}
+	return nil
+}
+
+// clearRestartedAt removes the restart time from the PVCs of a healthy pod.
+func (h selfHealing) clearRestartedAt(ctx context.Context, ss *appsv1.StatefulSet, pod *corev1.Pod) error {
+	for _, name := range claims(ss, pod) {
+		pvc := &corev1.PersistentVolumeClaim{}
+		if err := h.client.Get(ctx, kubetypes.NamespacedName{Namespace: pod.Namespace, Name: name}, pvc); err != nil {
+			if apierrors.IsNotFound(err) {
+				continue
+			}
+			return errors.Wrapf(err, "failed to get pvc %s", name)
+		}
+		if _, ok := pvc.Annotations[restartedAtAnnotation]; !ok {
+			continue
+		}
+
+		patch := client.MergeFrom(pvc.DeepCopy())
+		delete(pvc.Annotations, restartedAtAnnotation)
+		if err := h.client.Patch(ctx, pvc, patch); err != nil {
+			return errors.Wrapf(err, "failed to annotate pvc %s", name)
+		}
+	}
+	return nil
+}
+
+// clusterNodes returns the nodes of the cluster from its gossip network.
+func (h selfHealing) clusterNodes(ctx context.Context, cluster *resource.Cluster) ([]clustersql.Node, error) {
+	db, err := openDatabase(ctx, h.client, h.config, cluster)
+	if err != nil {
+		return nil, err
+	}
+	defer db.Close()
+
+	return clustersql.Nodes(ctx, db)
+}
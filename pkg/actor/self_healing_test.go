@@ -0,0 +1,224 @@
+/*
+Copyright 2021 The Cockroach Authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    https://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package actor
+
+import (
+	"context"
+	"fmt"
+	"testing"
+	"time"
+
+	api "github.com/cockroachdb/cockroach-operator/apis/v1alpha1"
+	"github.com/cockroachdb/cockroach-operator/pkg/clustersql"
+	"github.com/cockroachdb/cockroach-operator/pkg/resource"
+	"github.com/cockroachdb/cockroach-operator/pkg/testutil"
+	"github.com/cockroachdb/errors"
+	"github.com/stretchr/testify/require"
+	appsv1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/tools/record"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+)
+
+func TestSelfHealing(t *testing.T) {
+	scheme := testutil.InitScheme(t)
+	now := time.Date(2021, time.June, 2, 20, 30, 0, 0, time.UTC)
+	selector := map[string]string{"app": "crdb"}
+	replicas := int32(3)
+
+	ss := &appsv1.StatefulSet{
+		ObjectMeta: metav1.ObjectMeta{Name: "crdb", Namespace: "default"},
+		Spec: appsv1.StatefulSetSpec{
+			Replicas:             &replicas,
+			Selector:             &metav1.LabelSelector{MatchLabels: selector},
+			VolumeClaimTemplates: []corev1.PersistentVolumeClaim{{ObjectMeta: metav1.ObjectMeta{Name: "datadir"}}},
+		},
+	}
+
+	pod := func(name string, notReadyFor time.Duration) *corev1.Pod {
+		ready := corev1.PodCondition{Type: corev1.PodReady, Status: corev1.ConditionTrue}
+		if notReadyFor > 0 {
+			ready = corev1.PodCondition{
+				Type:               corev1.PodReady,
+				Status:             corev1.ConditionFalse,
+				LastTransitionTime: metav1.NewTime(now.Add(-notReadyFor)),
+			}
+		}
+		return &corev1.Pod{
+			ObjectMeta: metav1.ObjectMeta{Name: name, Namespace: "default", Labels: selector},
+			Status: corev1.PodStatus{
+				Conditions:        []corev1.PodCondition{ready},
+				ContainerStatuses: []corev1.ContainerStatus{{Name: resource.DbContainerName, Ready: notReadyFor == 0}},
+			},
+		}
+	}
+	crashLooping := func(name string) *corev1.Pod {
+		p := pod(name, time.Minute)
+		p.Status.ContainerStatuses[0].RestartCount = 5
+		p.Status.ContainerStatuses[0].State.Waiting = &corev1.ContainerStateWaiting{Reason: "CrashLoopBackOff"}
+		return p
+	}
+	pvc := func(name string, restartedAt time.Time) *corev1.PersistentVolumeClaim {
+		claim := &corev1.PersistentVolumeClaim{ObjectMeta: metav1.ObjectMeta{Name: "datadir-" + name, Namespace: "default"}}
+		if !restartedAt.IsZero() {
+			claim.Annotations = map[string]string{restartedAtAnnotation: restartedAt.Format(time.RFC3339)}
+		}
+		return claim
+	}
+
+	nodes := func(live ...bool) []clustersql.Node {
+		var nn []clustersql.Node
+		for i, l := range live {
+			nn = append(nn, clustersql.Node{ID: i + 1, Address: fmt.Sprintf("crdb-%d.crdb.default:26257", i), IsLive: l})
+		}
+		return nn
+	}
+
+	tests := []struct {
+		name         string
+		replaceStore bool
+		objs         []runtime.Object
+		nodes        []clustersql.Node
+		nodesErr     error
+		deferred     time.Duration
+		deletedPods  []string
+		deletedPVCs  []string
+		event        string
+		restartedAt  string
+	}{
+		{
+			name:  "all pods are ready",
+			objs:  []runtime.Object{pod("crdb-0", 0), pod("crdb-1", 0), pod("crdb-2", 0), pvc("crdb-1", now.Add(-time.Hour))},
+			nodes: nodes(true, true, true),
+		},
+		{
+			name:     "waits for a not ready pod to become unhealthy",
+			objs:     []runtime.Object{pod("crdb-0", 0), pod("crdb-1", 4*time.Minute), pod("crdb-2", 0)},
+			nodes:    nodes(true, false, true),
+			deferred: 6 * time.Minute,
+		},
+		{
+			name:     "does not restart a pod whose node is live",
+			objs:     []runtime.Object{pod("crdb-0", 0), crashLooping("crdb-1"), pod("crdb-2", 0)},
+			nodes:    nodes(true, true, true),
+			deferred: 10 * time.Minute,
+			event:    "Normal PodUnhealthy",
+		},
+		{
+			name:     "does not act when the liveness of the nodes is unknown",
+			objs:     []runtime.Object{pod("crdb-0", 0), crashLooping("crdb-1"), pod("crdb-2", 0)},
+			nodesErr: errors.New("boom"),
+			deferred: time.Minute,
+		},
+		{
+			name:        "restarts a crash-looping pod whose node is not live",
+			objs:        []runtime.Object{pod("crdb-0", 0), crashLooping("crdb-1"), pod("crdb-2", 0), pvc("crdb-1", time.Time{})},
+			nodes:       nodes(true, false, true),
+			deferred:    10 * time.Minute,
+			deletedPods: []string{"crdb-1"},
+			event:       "Warning PodRestarted",
+			restartedAt: "2021-06-02T20:30:00Z",
+		},
+		{
+			name:        "restarts a pod not ready for too long whose node is unknown",
+			objs:        []runtime.Object{pod("crdb-0", 0), pod("crdb-1", 0), pod("crdb-2", 20*time.Minute)},
+			nodes:       nodes(true, true),
+			deferred:    10 * time.Minute,
+			deletedPods: []string{"crdb-2"},
+			event:       "Warning PodRestarted",
+		},
+		{
+			name:         "replaces the store of a pod that is unhealthy after a restart",
+			replaceStore: true,
+			objs:         []runtime.Object{pod("crdb-0", 0), crashLooping("crdb-1"), pod("crdb-2", 0), pvc("crdb-1", now.Add(-time.Hour))},
+			nodes:        nodes(true, false, true),
+			deferred:     10 * time.Minute,
+			deletedPods:  []string{"crdb-1"},
+			deletedPVCs:  []string{"datadir-crdb-1"},
+			event:        "Warning StoreReplaced",
+		},
+		{
+			name:         "restarts instead of replacing the store when other pods are not ready",
+			replaceStore: true,
+			objs:         []runtime.Object{pod("crdb-0", 0), crashLooping("crdb-1"), pod("crdb-2", time.Minute), pvc("crdb-1", now.Add(-time.Hour))},
+			nodes:        nodes(true, false, true),
+			deferred:     10 * time.Minute,
+			deletedPods:  []string{"crdb-1"},
+			event:        "Warning PodRestarted",
+			restartedAt:  "2021-06-02T19:30:00Z",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cr := testutil.NewBuilder("crdb").Namespaced("default").WithNodeCount(3).Cr()
+			if tt.replaceStore {
+				cr.Spec.SelfHealing = &api.SelfHealing{ReplaceStore: true}
+			}
+			cluster := resource.NewCluster(cr)
+			cl := fake.NewFakeClientWithScheme(scheme, append(tt.objs, cr, ss.DeepCopy())...)
+			recorder := record.NewFakeRecorder(10)
+
+			h := newSelfHealing(scheme, cl, nil, recorder).(*selfHealing)
+			h.now = func() time.Time { return now }
+			h.nodes = func(context.Context, *resource.Cluster) ([]clustersql.Node, error) {
+				return tt.nodes, tt.nodesErr
+			}
+
+			ctx := context.Background()
+			err := h.Act(ctx, &cluster)
+			if tt.deferred == 0 {
+				require.NoError(t, err)
+			} else {
+				deferred, ok := err.(DeferredErr)
+				require.True(t, ok, err)
+				require.Equal(t, tt.deferred, deferred.RequeueAfter)
+			}
+
+			for _, name := range tt.deletedPods {
+				err := cl.Get(ctx, types.NamespacedName{Namespace: "default", Name: name}, &corev1.Pod{})
+				require.True(t, apierrors.IsNotFound(err), name)
+			}
+			for _, name := range tt.deletedPVCs {
+				err := cl.Get(ctx, types.NamespacedName{Namespace: "default", Name: name}, &corev1.PersistentVolumeClaim{})
+				require.True(t, apierrors.IsNotFound(err), name)
+			}
+			pods := &corev1.PodList{}
+			require.NoError(t, cl.List(ctx, pods))
+			require.Len(t, pods.Items, 3-len(tt.deletedPods))
+
+			if tt.event == "" {
+				require.Empty(t, recorder.Events)
+			} else {
+				require.Len(t, recorder.Events, 1)
+				require.Contains(t, <-recorder.Events, tt.event)
+			}
+
+			// the restart time is recorded on the PVC of a restarted pod and
+			// cleared from the PVC of a healthy one
+			claims := &corev1.PersistentVolumeClaimList{}
+			require.NoError(t, cl.List(ctx, claims))
+			for _, claim := range claims.Items {
+				require.Equal(t, tt.restartedAt, claim.Annotations[restartedAtAnnotation], claim.Name)
+			}
+		})
+	}
+}
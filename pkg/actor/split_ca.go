@@ -0,0 +1,104 @@
+/*
+Copyright 2021 The Cockroach Authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    https://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package actor
+
+import (
+	"context"
+	"io/ioutil"
+	"path/filepath"
+
+	api "github.com/cockroachdb/cockroach-operator/apis/v1alpha1"
+	"github.com/cockroachdb/cockroach-operator/pkg/kube"
+	"github.com/cockroachdb/cockroach-operator/pkg/labels"
+	"github.com/cockroachdb/cockroach-operator/pkg/resource"
+	"github.com/cockroachdb/errors"
+	"github.com/go-logr/logr"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+// loadCASecret returns the secret of a CA, which holds its certificate and its
+// key.
+func loadCASecret(ctx context.Context, cl client.Client, cluster *resource.Cluster, name string) (*resource.TLSSecret, error) {
+	secret, err := resource.LoadTLSSecret(name, resource.NewKubeResource(ctx, cl, cluster.Namespace(), kube.DefaultPersister))
+	if err != nil {
+		return nil, err
+	}
+	if len(secret.CA()) == 0 || len(secret.CAKey()) == 0 {
+		return nil, errors.Newf("secret %s must hold ca.crt and ca.key", name)
+	}
+	return secret, nil
+}
+
+// clientCA returns the certificate and the key of the client CA of a split-CA
+// cluster. The operator generates the CA of its own secret the first time,
+// while the secret of the spec must exist.
+func clientCA(ctx context.Context, cl client.Client, log logr.Logger, cluster *resource.Cluster) ([]byte, []byte, error) {
+	name := cluster.ClientCASecretName()
+	secret, err := loadCASecret(ctx, cl, cluster, name)
+	if err == nil {
+		return secret.CA(), secret.CAKey(), nil
+	}
+	if !apierrors.IsNotFound(err) || cluster.Spec().SplitCA.ClientCASecret != "" {
+		return nil, nil, errors.Wrapf(err, "failed to get the client CA secret %s", name)
+	}
+
+	cert, key, err := createCA(cluster.Spec().TLS)
+	if err != nil {
+		return nil, nil, errors.Wrap(err, "failed to generate the client CA")
+	}
+	secret = resource.CreateTLSSecret(name, resource.NewKubeResource(ctx, cl, cluster.Namespace(), kube.DefaultPersister)).
+		WithLabels(labels.Propagated(cluster.Unwrap(), api.PropagateSecret)).
+		WithAnnotations(cluster.Spec().PropagatedAnnotations(api.PropagateSecret))
+	if err := secret.UpdateCAKeyAndCA(key, cert, log); err != nil {
+		return nil, nil, errors.Wrap(err, "failed to save the client CA")
+	}
+	return cert, key, nil
+}
+
+// checkSplitCAUnchanged checks that the certificates are issued again in the
+// mode they were first issued in: the nodes of a running cluster cannot switch
+// between one CA and split CAs. The secret of the client certificate of user
+// node only exists in the split-CA mode.
+func checkSplitCAUnchanged(ctx context.Context, cl client.Client, cluster *resource.Cluster) error {
+	_, err := resource.LoadTLSSecret(cluster.NodeClientTLSSecretName(),
+		resource.NewKubeResource(ctx, cl, cluster.Namespace(), kube.DefaultPersister))
+	if kube.IgnoreNotFound(err) != nil {
+		return errors.Wrap(err, "failed to get the node client TLS secret")
+	}
+
+	split := err == nil
+	if cluster.Spec().SplitCA != nil && !split {
+		return ValidationError{Err: errors.New("splitCA can only be set when the cluster is created")}
+	}
+	if cluster.Spec().SplitCA == nil && split {
+		return ValidationError{Err: errors.New("splitCA cannot be removed from a cluster whose certificates are issued by split CAs")}
+	}
+	return nil
+}
+
+// writeCA writes the certificate of a CA to the certs directory and its key
+// at caKeyPath, where the providers read them.
+func writeCA(certsDir, caKeyPath string, cert, key []byte) error {
+	if err := ioutil.WriteFile(caKeyPath, key, 0600); err != nil {
+		return errors.Wrap(err, "unable to write ca.key")
+	}
+	if err := ioutil.WriteFile(filepath.Join(certsDir, "ca.crt"), cert, 0600); err != nil {
+		return errors.Wrap(err, "unable to write ca.crt")
+	}
+	return nil
+}
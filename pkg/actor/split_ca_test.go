@@ -0,0 +1,115 @@
+/*
+Copyright 2021 The Cockroach Authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    https://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package actor
+
+import (
+	"context"
+	"io/ioutil"
+	"path/filepath"
+	"testing"
+	"time"
+
+	api "github.com/cockroachdb/cockroach-operator/apis/v1alpha1"
+	"github.com/cockroachdb/cockroach-operator/pkg/resource"
+	"github.com/cockroachdb/cockroach-operator/pkg/security"
+	"github.com/cockroachdb/cockroach-operator/pkg/testutil"
+	"github.com/cockroachdb/cockroach-operator/pkg/util"
+	"github.com/stretchr/testify/require"
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+)
+
+func TestGenerateCertSplitCA(t *testing.T) {
+	ctx := context.Background()
+	cr := testutil.NewBuilder("crdb").Namespaced("default").WithNodeCount(3).WithTLS().Cr()
+	// spec.tls has the certificates issued without the cockroach binary
+	cr.Spec.TLS = &api.TLSConfig{KeyAlgorithm: api.KeyAlgorithmECDSA}
+	cr.Spec.SplitCA = &api.SplitCA{}
+	cl := fake.NewFakeClientWithScheme(testutil.InitScheme(t), cr)
+	cluster := resource.NewCluster(cr)
+
+	g := newGenerateCert(testutil.InitScheme(t), cl, nil).(*generateCert)
+	require.NoError(t, g.Act(ctx, &cluster))
+
+	node, root := getSecret(t, cl, "crdb-node"), getSecret(t, cl, "crdb-root")
+	nodeClient, clientCASecret := getSecret(t, cl, "crdb-node-client"), getSecret(t, cl, "crdb-client-ca")
+	nodeCA, clientCA := testutil.ParseCert(t, node.Data["ca.crt"]), testutil.ParseCert(t, clientCASecret.Data["ca.crt"])
+	require.NotEqual(t, nodeCA.Raw, clientCA.Raw)
+
+	// the node certificate is signed by the node CA, the client certificates
+	// by the client CA
+	require.NoError(t, testutil.ParseCert(t, node.Data[corev1.TLSCertKey]).CheckSignatureFrom(nodeCA))
+	require.NoError(t, testutil.ParseCert(t, root.Data[corev1.TLSCertKey]).CheckSignatureFrom(clientCA))
+	nodeUser := testutil.ParseCert(t, nodeClient.Data[corev1.TLSCertKey])
+	require.Equal(t, "node", nodeUser.Subject.CommonName)
+	require.NoError(t, nodeUser.CheckSignatureFrom(clientCA))
+
+	// the clients verify the nodes with the node CA, and the nodes verify the
+	// clients with the client CA
+	require.Equal(t, node.Data["ca.crt"], root.Data["ca.crt"])
+	require.Equal(t, clientCASecret.Data["ca.crt"], nodeClient.Data["ca.crt"])
+
+	// the nodes cannot switch back to a single CA
+	single := cr.DeepCopy()
+	single.Spec.SplitCA = nil
+	singleCluster := resource.NewCluster(single)
+	g.rotate = true
+	err := g.Act(ctx, &singleCluster)
+	_, ok := err.(ValidationError)
+	require.True(t, ok, err)
+}
+
+func TestGenerateCertSplitCANodeCASecret(t *testing.T) {
+	ctx := context.Background()
+	certsDir, cleanup := util.CreateTempDir("certsDir")
+	defer cleanup()
+	caKey := filepath.Join(certsDir, "ca.key")
+	require.NoError(t, security.CreateCA(certsDir, caKey, 24*time.Hour, security.KeySpec{Algorithm: security.RSAKey, Size: 2048}))
+	caCert, err := ioutil.ReadFile(filepath.Join(certsDir, "ca.crt"))
+	require.NoError(t, err)
+	key, err := ioutil.ReadFile(caKey)
+	require.NoError(t, err)
+
+	cr := testutil.NewBuilder("crdb").Namespaced("default").WithNodeCount(3).WithTLS().Cr()
+	cr.Spec.TLS = &api.TLSConfig{}
+	cr.Spec.SplitCA = &api.SplitCA{NodeCASecret: "node-ca"}
+	cl := fake.NewFakeClientWithScheme(testutil.InitScheme(t), cr, &corev1.Secret{
+		ObjectMeta: metav1.ObjectMeta{Namespace: "default", Name: "node-ca"},
+		Data:       map[string][]byte{"ca.crt": caCert, "ca.key": key},
+	})
+	cluster := resource.NewCluster(cr)
+
+	require.NoError(t, newGenerateCert(testutil.InitScheme(t), cl, nil).Act(ctx, &cluster))
+
+	node := getSecret(t, cl, "crdb-node")
+	require.Equal(t, caCert, node.Data["ca.crt"])
+	require.NoError(t, testutil.ParseCert(t, node.Data[corev1.TLSCertKey]).CheckSignatureFrom(testutil.ParseCert(t, caCert)))
+
+	// the operator does not generate a node CA of its own
+	err = cl.Get(ctx, types.NamespacedName{Namespace: "default", Name: "crdb-ca"}, &corev1.Secret{})
+	require.True(t, apierrors.IsNotFound(err), err)
+}
+
+func getSecret(t *testing.T, cl client.Client, name string) *corev1.Secret {
+	secret := &corev1.Secret{}
+	require.NoError(t, cl.Get(context.Background(), types.NamespacedName{Namespace: "default", Name: name}, secret))
+	return secret
+}
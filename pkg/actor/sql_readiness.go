@@ -0,0 +1,138 @@
+/*
+Copyright 2021 The Cockroach Authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    https://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package actor
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	api "github.com/cockroachdb/cockroach-operator/apis/v1alpha1"
+	"github.com/cockroachdb/cockroach-operator/pkg/resource"
+	"github.com/cockroachdb/errors"
+	appsv1 "k8s.io/api/apps/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	kubetypes "k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/rest"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+const (
+	// notReadyInterval is how often the SQL probe is retried while the cluster
+	// is not ready.
+	notReadyInterval = 10 * time.Second
+
+	// sqlProbeTimeout bounds the time the SQL probe waits for an answer.
+	sqlProbeTimeout = 10 * time.Second
+)
+
+func newSQLReadiness(scheme *runtime.Scheme, cl client.Client, config *rest.Config) Actor {
+	r := &sqlReadiness{
+		action: newAction("sqlReadiness", scheme, cl),
+		config: config,
+	}
+	r.probe = r.selectOne
+	return r
+}
+
+// sqlReadiness sets the Ready condition once the pods pass their health checks
+// and a SQL query succeeds through the public service, so that automation
+// waiting for the cluster only starts when SQL is usable
+type sqlReadiness struct {
+	action
+
+	config *rest.Config
+	// probe runs a SQL query against the cluster
+	probe func(ctx context.Context, cluster *resource.Cluster) error
+}
+
+//GetActionType returns api.SQLReadinessAction used to set the cluster status errors
+func (r sqlReadiness) GetActionType() api.ActionType {
+	return api.SQLReadinessAction
+}
+
+func (r sqlReadiness) Act(ctx context.Context, cluster *resource.Cluster) error {
+	log := r.log.WithValues("CrdbCluster", cluster.ObjectKey())
+	log.V(DEBUGLEVEL).Info("probing the SQL interface of the cluster")
+
+	notReady := func(reason, message string) error {
+		log.V(DEBUGLEVEL).Info("cluster is not ready", "reason", reason, "message", message)
+		cluster.SetCondition(api.ReadyCondition, metav1.ConditionFalse, reason, message)
+		return DeferredErr{Err: errors.Newf("cluster is not ready: %s", reason), RequeueAfter: notReadyInterval}
+	}
+
+	key := kubetypes.NamespacedName{Namespace: cluster.Namespace(), Name: cluster.StatefulSetName()}
+	ss := &appsv1.StatefulSet{}
+	if err := r.client.Get(ctx, key, ss); err != nil {
+		return notReady("PodsNotReady", errors.Wrap(err, "failed to fetch statefulset").Error())
+	}
+
+	replicas := int32(1)
+	if ss.Spec.Replicas != nil {
+		replicas = *ss.Spec.Replicas
+	}
+	if ss.Status.ReadyReplicas < replicas {
+		return notReady("PodsNotReady", fmt.Sprintf("%d of %d pods are ready", ss.Status.ReadyReplicas, replicas))
+	}
+
+	// a clone is not ready before it has the data of its source
+	if cluster.Spec().CloneFrom != nil {
+		if clone := cluster.Status().Clone; clone == nil || clone.State != api.CloneSucceeded {
+			reason, message := "Cloning", fmt.Sprintf("cloning %s", cluster.Spec().CloneFrom.Cluster)
+			if clone != nil && clone.State == api.CloneFailed {
+				reason, message = "CloneFailed", clone.Message
+			}
+			return notReady(reason, message)
+		}
+	}
+
+	if err := r.probe(ctx, cluster); err != nil {
+		return notReady("SQLUnavailable", err.Error())
+	}
+
+	if !cluster.True(api.ReadyCondition) {
+		log.Info("cluster is ready, SQL queries succeed")
+	}
+	cluster.SetCondition(api.ReadyCondition, metav1.ConditionTrue, "SQLReady", "")
+	return nil
+}
+
+// PollInterval returns how often the SQL interface of a ready cluster is
+// probed. A cluster that is not ready defers for a shorter interval.
+func (r sqlReadiness) PollInterval(*resource.Cluster) time.Duration {
+	return pollInterval
+}
+
+// selectOne runs SELECT 1 through the public service, with the root client
+// certificate when the cluster uses TLS.
+func (r sqlReadiness) selectOne(ctx context.Context, cluster *resource.Cluster) error {
+	ctx, cancel := context.WithTimeout(ctx, sqlProbeTimeout)
+	defer cancel()
+
+	db, err := openDatabase(ctx, r.client, r.config, cluster)
+	if err != nil {
+		return err
+	}
+	defer db.Close()
+
+	var one int
+	if err := db.QueryRowContext(ctx, "SELECT 1").Scan(&one); err != nil {
+		return errors.Wrap(err, "failed to run SELECT 1")
+	}
+	return nil
+}
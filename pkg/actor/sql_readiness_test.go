@@ -0,0 +1,149 @@
+/*
+Copyright 2021 The Cockroach Authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    https://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package actor
+
+import (
+	"context"
+	"testing"
+
+	api "github.com/cockroachdb/cockroach-operator/apis/v1alpha1"
+	"github.com/cockroachdb/cockroach-operator/pkg/ptr"
+	"github.com/cockroachdb/cockroach-operator/pkg/resource"
+	"github.com/cockroachdb/cockroach-operator/pkg/testutil"
+	"github.com/cockroachdb/errors"
+	"github.com/stretchr/testify/require"
+	appsv1 "k8s.io/api/apps/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+)
+
+func TestSQLReadiness(t *testing.T) {
+	scheme := testutil.InitScheme(t)
+
+	tests := []struct {
+		name     string
+		ready    int32
+		noSts    bool
+		probeErr error
+		cloning  bool
+		clone    *api.CloneStatus
+		probed   bool
+		status   metav1.ConditionStatus
+		reason   string
+		message  string
+	}{
+		{
+			name:    "pods are not ready",
+			ready:   2,
+			status:  metav1.ConditionFalse,
+			reason:  "PodsNotReady",
+			message: "2 of 3 pods are ready",
+		},
+		{
+			name:   "statefulset does not exist yet",
+			noSts:  true,
+			status: metav1.ConditionFalse,
+			reason: "PodsNotReady",
+		},
+		{
+			name:     "SQL is not usable yet",
+			ready:    3,
+			probeErr: errors.New("connection refused"),
+			probed:   true,
+			status:   metav1.ConditionFalse,
+			reason:   "SQLUnavailable",
+			message:  "connection refused",
+		},
+		{
+			name:    "clone is in progress",
+			ready:   3,
+			cloning: true,
+			clone:   &api.CloneStatus{State: api.CloneRestoring},
+			status:  metav1.ConditionFalse,
+			reason:  "Cloning",
+			message: "cloning source",
+		},
+		{
+			name:    "clone failed",
+			ready:   3,
+			cloning: true,
+			clone:   &api.CloneStatus{State: api.CloneFailed, Message: "restore job 43 failed: access denied"},
+			status:  metav1.ConditionFalse,
+			reason:  "CloneFailed",
+			message: "restore job 43 failed: access denied",
+		},
+		{
+			name:    "clone succeeded",
+			ready:   3,
+			cloning: true,
+			clone:   &api.CloneStatus{State: api.CloneSucceeded},
+			probed:  true,
+			status:  metav1.ConditionTrue,
+			reason:  "SQLReady",
+		},
+		{
+			name:   "SQL queries succeed",
+			ready:  3,
+			probed: true,
+			status: metav1.ConditionTrue,
+			reason: "SQLReady",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cr := testutil.NewBuilder("crdb").Namespaced("default").WithNodeCount(3).Cr()
+			if tt.cloning {
+				cr.Spec.CloneFrom = &api.CloneSource{Cluster: "source", BackupURI: "s3://backups/crdb"}
+				cr.Status.Clone = tt.clone
+			}
+			objs := []runtime.Object{cr}
+			if !tt.noSts {
+				objs = append(objs, &appsv1.StatefulSet{
+					ObjectMeta: metav1.ObjectMeta{Namespace: "default", Name: "crdb"},
+					Spec:       appsv1.StatefulSetSpec{Replicas: ptr.Int32(3)},
+					Status:     appsv1.StatefulSetStatus{Replicas: 3, ReadyReplicas: tt.ready},
+				})
+			}
+			cluster := resource.NewCluster(cr)
+			cl := fake.NewFakeClientWithScheme(scheme, objs...)
+
+			probed := false
+			r := newSQLReadiness(scheme, cl, nil).(*sqlReadiness)
+			r.probe = func(context.Context, *resource.Cluster) error {
+				probed = true
+				return tt.probeErr
+			}
+
+			err := r.Act(context.Background(), &cluster)
+			require.Equal(t, tt.probed, probed)
+
+			condition := findCondition(&cluster, api.ReadyCondition)
+			require.Equal(t, tt.status, condition.Status)
+			require.Equal(t, tt.reason, condition.Reason)
+			if tt.status == metav1.ConditionTrue {
+				require.NoError(t, err)
+			} else {
+				require.Equal(t, notReadyInterval, err.(DeferredErr).RequeueAfter)
+			}
+			if tt.message != "" {
+				require.Equal(t, tt.message, condition.Message)
+			}
+		})
+	}
+}
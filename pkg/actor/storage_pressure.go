@@ -0,0 +1,281 @@
+/*
+Copyright 2021 The Cockroach Authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    https://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package actor
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+
+	api "github.com/cockroachdb/cockroach-operator/apis/v1alpha1"
+	"github.com/cockroachdb/cockroach-operator/pkg/clustersql"
+	"github.com/cockroachdb/cockroach-operator/pkg/resource"
+	"github.com/cockroachdb/errors"
+	corev1 "k8s.io/api/core/v1"
+	storagev1 "k8s.io/api/storage/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	apiresource "k8s.io/apimachinery/pkg/api/resource"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/rest"
+	"k8s.io/client-go/tools/record"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+const (
+	// expansionRounding is the size the expanded storage requests are rounded
+	// up to.
+	expansionRounding = int64(1 << 30)
+
+	// expandedCapacityRatio is the part of the storage request a store must
+	// report as its capacity for the last expansion to have reached it. The
+	// file system takes some of the volume.
+	expandedCapacityRatio = 0.9
+)
+
+// defaultStorageClassAnnotations mark the default storage class of the
+// Kubernetes cluster
+var defaultStorageClassAnnotations = []string{
+	"storageclass.kubernetes.io/is-default-class",
+	"storageclass.beta.kubernetes.io/is-default-class",
+}
+
+func newStoragePressure(scheme *runtime.Scheme, cl client.Client, config *rest.Config, recorder record.EventRecorder) Actor {
+	p := &storagePressure{
+		action:   newAction("storagePressure", scheme, cl),
+		config:   config,
+		recorder: recorder,
+	}
+	p.stores = p.clusterStores
+	return p
+}
+
+// storagePressure polls the capacity of the stores, sets the StoragePressure
+// condition when some of them cross a threshold and expands the volumes if
+// the cluster spec asks for it
+type storagePressure struct {
+	action
+
+	config   *rest.Config
+	recorder record.EventRecorder
+	// stores returns the capacity of the stores of the cluster
+	stores func(ctx context.Context, cluster *resource.Cluster) ([]clustersql.Store, error)
+}
+
+//GetActionType returns api.StoragePressureAction used to set the cluster status errors
+func (p storagePressure) GetActionType() api.ActionType {
+	return api.StoragePressureAction
+}
+
+func (p storagePressure) Act(ctx context.Context, cluster *resource.Cluster) error {
+	log := p.log.WithValues("CrdbCluster", cluster.ObjectKey())
+	log.V(DEBUGLEVEL).Info("checking the capacity of the stores")
+
+	stores, err := p.stores(ctx, cluster)
+	if err != nil {
+		log.Error(err, "failed to get the capacity of the stores")
+		cluster.SetCondition(api.StoragePressureCondition, metav1.ConditionUnknown, "CapacityUnknown", err.Error())
+		return nil
+	}
+
+	policy := cluster.Spec().StoragePressure
+	warning := float64(policy.WarningThresholdOrDefault())
+	critical := float64(policy.CriticalThresholdOrDefault())
+
+	var full []string
+	status, reason := metav1.ConditionFalse, "EnoughCapacity"
+	for _, s := range stores {
+		used := s.UsedPercent()
+		if used < warning && used < critical {
+			continue
+		}
+
+		full = append(full, fmt.Sprintf("store %d of node %d is %.0f%% full", s.StoreID, s.NodeID, used))
+		status = metav1.ConditionTrue
+		if used >= critical {
+			reason = "CriticalThreshold"
+		} else if reason != "CriticalThreshold" {
+			reason = "WarningThreshold"
+		}
+	}
+	message := strings.Join(full, "; ")
+
+	previous := findCondition(cluster, api.StoragePressureCondition)
+	cluster.SetCondition(api.StoragePressureCondition, status, reason, message)
+
+	if previous.Reason != reason || previous.Message != message {
+		if status == metav1.ConditionTrue {
+			log.Info("stores are nearly full", "reason", reason, "stores", message)
+			p.recorder.Eventf(cluster.Unwrap(), corev1.EventTypeWarning, "StoragePressure", "Stores crossed the %s: %s", thresholdName(reason), message)
+		} else if previous.Status == metav1.ConditionTrue {
+			p.recorder.Event(cluster.Unwrap(), corev1.EventTypeNormal, "StoragePressureRelieved", "No store is above the warning threshold")
+		}
+	}
+
+	if reason == "CriticalThreshold" && policy.ExpansionEnabled() {
+		if err := p.expand(ctx, cluster, stores); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// PollInterval returns how often the capacity of the stores is checked, so
+// that the volumes are expanded before the stores fill up.
+func (p storagePressure) PollInterval(*resource.Cluster) time.Duration {
+	return pollInterval
+}
+
+// expand grows the storage request of the volumes by the ExpandBy percentage
+// or the ExpandStep of the policy, up to its maximum size. The resize PVC
+// action resizes the volumes in the next loop. The volumes are left alone
+// when their storage class does not allow volume expansion.
+func (p storagePressure) expand(ctx context.Context, cluster *resource.Cluster, stores []clustersql.Store) error {
+	log := p.log.WithValues("CrdbCluster", cluster.ObjectKey())
+
+	claim := cluster.Spec().DataStore.VolumeClaim
+	if claim == nil {
+		log.V(DEBUGLEVEL).Info("not expanding the stores, they are not on volume claims")
+		return nil
+	}
+
+	requested := claim.PersistentVolumeClaimSpec.Resources.Requests.Storage().Value()
+	// the volumes are expanded again once the stores report the new capacity
+	for _, s := range stores {
+		if float64(s.Capacity) < float64(requested)*expandedCapacityRatio {
+			log.V(DEBUGLEVEL).Info("the last expansion has not reached the stores yet", "store", s.StoreID, "capacity", s.Capacity)
+			return nil
+		}
+	}
+
+	class, err := p.storageClass(ctx, claim.PersistentVolumeClaimSpec.StorageClassName)
+	if err != nil {
+		return err
+	}
+	if class == nil || class.AllowVolumeExpansion == nil || !*class.AllowVolumeExpansion {
+		p.recorder.Event(cluster.Unwrap(), corev1.EventTypeWarning, "StorageExpansionUnsupported",
+			"Stores crossed the critical threshold, but the storage class of the volumes does not allow volume expansion")
+		return nil
+	}
+
+	policy := cluster.Spec().StoragePressure
+	size := policy.ExpandedSize(requested)
+	size = (size + expansionRounding - 1) / expansionRounding * expansionRounding
+	if policy.MaxSize != nil && size > policy.MaxSize.Value() {
+		size = policy.MaxSize.Value()
+	}
+	if size <= requested {
+		p.recorder.Eventf(cluster.Unwrap(), corev1.EventTypeWarning, "StorageExpansionLimit",
+			"Stores crossed the critical threshold, but the volumes already have their maximum size %s", policy.MaxSize)
+		return nil
+	}
+
+	quantity := apiresource.NewQuantity(size, apiresource.BinarySI)
+	log.Info("expanding the volumes", "from", requested, "to", quantity.String())
+
+	// the spec is updated, so the other actors must wait for the next loop
+	fetcher := resource.NewKubeFetcher(ctx, cluster.Namespace(), p.client)
+	cr := resource.ClusterPlaceholder(cluster.Name())
+	if err := fetcher.Fetch(cr); err != nil {
+		return errors.Wrap(err, "failed to fetch the CrdbCluster")
+	}
+	if cr.Spec.DataStore.VolumeClaim == nil {
+		return nil
+	}
+
+	requests := cr.Spec.DataStore.VolumeClaim.PersistentVolumeClaimSpec.Resources.Requests
+	if requests == nil {
+		requests = corev1.ResourceList{}
+	}
+	requests[corev1.ResourceStorage] = *quantity
+	cr.Spec.DataStore.VolumeClaim.PersistentVolumeClaimSpec.Resources.Requests = requests
+	if err := p.client.Update(ctx, cr); err != nil {
+		return errors.Wrap(err, "failed to expand the volumes")
+	}
+
+	p.recorder.Eventf(cluster.Unwrap(), corev1.EventTypeNormal, "StorageExpanded", "Expanded the volumes to %s", quantity)
+	CancelLoop(ctx)
+	return nil
+}
+
+// storageClass returns the storage class of the volumes, the default one of the
+// Kubernetes cluster when the claim names none, or nil when there is no such
+// storage class.
+func (p storagePressure) storageClass(ctx context.Context, name *string) (*storagev1.StorageClass, error) {
+	if name != nil {
+		// an empty name binds the claims to volumes without a storage class
+		if *name == "" {
+			return nil, nil
+		}
+		class := &storagev1.StorageClass{}
+		if err := p.client.Get(ctx, types.NamespacedName{Name: *name}, class); err != nil {
+			if apierrors.IsNotFound(err) {
+				return nil, nil
+			}
+			return nil, errors.Wrapf(err, "failed to fetch storage class %s", *name)
+		}
+		return class, nil
+	}
+
+	classes := &storagev1.StorageClassList{}
+	if err := p.client.List(ctx, classes); err != nil {
+		return nil, errors.Wrap(err, "failed to list storage classes")
+	}
+	for i := range classes.Items {
+		for _, annotation := range defaultStorageClassAnnotations {
+			if classes.Items[i].Annotations[annotation] == "true" {
+				return &classes.Items[i], nil
+			}
+		}
+	}
+	return nil, nil
+}
+
+// thresholdName returns the threshold a reason of the StoragePressure
+// condition stands for.
+func thresholdName(reason string) string {
+	if reason == "CriticalThreshold" {
+		return "critical threshold"
+	}
+	return "warning threshold"
+}
+
+// findCondition returns the condition of the given type of the cluster, or an
+// empty condition if it is not set.
+func findCondition(cluster *resource.Cluster, ctype api.ClusterConditionType) api.ClusterCondition {
+	for _, c := range cluster.Status().Conditions {
+		if c.Type == ctype {
+			return c
+		}
+	}
+	return api.ClusterCondition{}
+}
+
+// clusterStores returns the capacity of the stores from the status of the
+// nodes.
+func (p storagePressure) clusterStores(ctx context.Context, cluster *resource.Cluster) ([]clustersql.Store, error) {
+	db, err := openDatabase(ctx, p.client, p.config, cluster)
+	if err != nil {
+		return nil, err
+	}
+	defer db.Close()
+
+	return clustersql.Stores(ctx, db)
+}
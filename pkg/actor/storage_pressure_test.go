@@ -0,0 +1,253 @@
+/*
+Copyright 2021 The Cockroach Authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    https://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package actor
+
+import (
+	"context"
+	"testing"
+
+	api "github.com/cockroachdb/cockroach-operator/apis/v1alpha1"
+	"github.com/cockroachdb/cockroach-operator/pkg/clustersql"
+	"github.com/cockroachdb/cockroach-operator/pkg/resource"
+	"github.com/cockroachdb/cockroach-operator/pkg/testutil"
+	"github.com/cockroachdb/errors"
+	"github.com/stretchr/testify/require"
+	corev1 "k8s.io/api/core/v1"
+	storagev1 "k8s.io/api/storage/v1"
+	apiresource "k8s.io/apimachinery/pkg/api/resource"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/tools/record"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+)
+
+func TestStoragePressure(t *testing.T) {
+	scheme := testutil.InitScheme(t)
+	const gi = int64(1 << 30)
+
+	// stores of 10Gi volumes with the given percentages of used capacity
+	stores := func(used ...int64) []clustersql.Store {
+		var ss []clustersql.Store
+		for i, u := range used {
+			ss = append(ss, clustersql.Store{NodeID: i + 1, StoreID: i + 1, Capacity: 10 * gi, Available: 10 * gi * (100 - u) / 100})
+		}
+		return ss
+	}
+	maxSize := apiresource.MustParse("12Gi")
+	step := apiresource.MustParse("4Gi")
+
+	tests := []struct {
+		name     string
+		policy   *api.StoragePressure
+		fixed    bool
+		previous *api.ClusterCondition
+		stores   []clustersql.Store
+		err      error
+		status   metav1.ConditionStatus
+		reason   string
+		message  string
+		events   []string
+		size     string
+	}{
+		{
+			name:   "stores have enough capacity",
+			stores: stores(10, 50, 79),
+			status: metav1.ConditionFalse,
+			reason: "EnoughCapacity",
+		},
+		{
+			name:    "a store crosses the warning threshold",
+			stores:  stores(10, 85, 50),
+			status:  metav1.ConditionTrue,
+			reason:  "WarningThreshold",
+			message: "store 2 of node 2 is 85% full",
+			events:  []string{"Warning StoragePressure Stores crossed the warning threshold"},
+		},
+		{
+			name:     "no event while the stores stay above the threshold",
+			previous: &api.ClusterCondition{Status: metav1.ConditionTrue, Reason: "WarningThreshold", Message: "store 2 of node 2 is 85% full"},
+			stores:   stores(10, 85, 50),
+			status:   metav1.ConditionTrue,
+			reason:   "WarningThreshold",
+			message:  "store 2 of node 2 is 85% full",
+		},
+		{
+			name:     "stores are back below the thresholds",
+			previous: &api.ClusterCondition{Status: metav1.ConditionTrue, Reason: "WarningThreshold", Message: "store 2 of node 2 is 85% full"},
+			stores:   stores(10, 50, 50),
+			status:   metav1.ConditionFalse,
+			reason:   "EnoughCapacity",
+			events:   []string{"Normal StoragePressureRelieved"},
+		},
+		{
+			name:    "volumes are not expanded by default",
+			stores:  stores(95, 85, 50),
+			status:  metav1.ConditionTrue,
+			reason:  "CriticalThreshold",
+			message: "store 1 of node 1 is 95% full; store 2 of node 2 is 85% full",
+			events:  []string{"Warning StoragePressure Stores crossed the critical threshold"},
+		},
+		{
+			name:    "volumes are expanded",
+			policy:  &api.StoragePressure{ExpandBy: 50},
+			stores:  stores(95, 50, 50),
+			status:  metav1.ConditionTrue,
+			reason:  "CriticalThreshold",
+			message: "store 1 of node 1 is 95% full",
+			events:  []string{"Warning StoragePressure", "Normal StorageExpanded Expanded the volumes to 15Gi"},
+			size:    "15Gi",
+		},
+		{
+			name:    "volumes are expanded up to the maximum size",
+			policy:  &api.StoragePressure{ExpandBy: 50, MaxSize: &maxSize},
+			stores:  stores(95, 50, 50),
+			status:  metav1.ConditionTrue,
+			reason:  "CriticalThreshold",
+			message: "store 1 of node 1 is 95% full",
+			events:  []string{"Warning StoragePressure", "Normal StorageExpanded Expanded the volumes to 12Gi"},
+			size:    "12Gi",
+		},
+		{
+			name:    "volumes are expanded by the larger of the percentage and the step",
+			policy:  &api.StoragePressure{ExpandBy: 10, ExpandStep: &step},
+			stores:  stores(95, 50, 50),
+			status:  metav1.ConditionTrue,
+			reason:  "CriticalThreshold",
+			message: "store 1 of node 1 is 95% full",
+			events:  []string{"Warning StoragePressure", "Normal StorageExpanded Expanded the volumes to 14Gi"},
+			size:    "14Gi",
+		},
+		{
+			name:    "volumes are not expanded when the storage class does not allow it",
+			policy:  &api.StoragePressure{ExpandBy: 50},
+			fixed:   true,
+			stores:  stores(95, 50, 50),
+			status:  metav1.ConditionTrue,
+			reason:  "CriticalThreshold",
+			message: "store 1 of node 1 is 95% full",
+			events:  []string{"Warning StoragePressure", "Warning StorageExpansionUnsupported"},
+		},
+		{
+			name:    "capacity is unknown",
+			err:     errors.New("connection refused"),
+			status:  metav1.ConditionUnknown,
+			reason:  "CapacityUnknown",
+			message: "connection refused",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cr := testutil.NewBuilder("crdb").Namespaced("default").WithNodeCount(3).WithPVDataStore("10Gi", "standard").Cr()
+			cr.Spec.StoragePressure = tt.policy
+			if tt.previous != nil {
+				previous := *tt.previous
+				previous.Type = api.StoragePressureCondition
+				cr.Status.Conditions = []api.ClusterCondition{previous}
+			}
+			cluster := resource.NewCluster(cr)
+			expansion := !tt.fixed
+			class := &storagev1.StorageClass{ObjectMeta: metav1.ObjectMeta{Name: "standard"}, AllowVolumeExpansion: &expansion}
+			cl := fake.NewFakeClientWithScheme(scheme, cr, class)
+			recorder := record.NewFakeRecorder(10)
+
+			p := newStoragePressure(scheme, cl, nil, recorder).(*storagePressure)
+			p.stores = func(context.Context, *resource.Cluster) ([]clustersql.Store, error) {
+				return tt.stores, tt.err
+			}
+
+			ctx, cancel := context.WithCancel(context.Background())
+			defer cancel()
+			err := p.Act(ContextWithCancelFn(ctx, cancel), &cluster)
+			require.NoError(t, err)
+
+			condition := findCondition(&cluster, api.StoragePressureCondition)
+			require.Equal(t, tt.status, condition.Status)
+			require.Equal(t, tt.reason, condition.Reason)
+			require.Equal(t, tt.message, condition.Message)
+
+			require.Len(t, recorder.Events, len(tt.events))
+			for _, e := range tt.events {
+				require.Contains(t, <-recorder.Events, e)
+			}
+
+			actual := &api.CrdbCluster{}
+			require.NoError(t, cl.Get(ctx, client.ObjectKeyFromObject(cr), actual))
+			size := actual.Spec.DataStore.VolumeClaim.PersistentVolumeClaimSpec.Resources.Requests[corev1.ResourceStorage]
+			if tt.size == "" {
+				require.Equal(t, "10Gi", size.String())
+			} else {
+				require.Equal(t, tt.size, size.String())
+				require.Error(t, ctx.Err(), "the loop should be cancelled")
+			}
+		})
+	}
+}
+
+func TestStoragePressureWaitsForTheLastExpansion(t *testing.T) {
+	scheme := testutil.InitScheme(t)
+	const gi = int64(1 << 30)
+
+	// the spec asks for 20Gi but the volumes still have 10Gi
+	cr := testutil.NewBuilder("crdb").Namespaced("default").WithNodeCount(3).WithPVDataStore("20Gi", "standard").Cr()
+	cr.Spec.StoragePressure = &api.StoragePressure{ExpandBy: 50}
+	cluster := resource.NewCluster(cr)
+	cl := fake.NewFakeClientWithScheme(scheme, cr)
+
+	p := newStoragePressure(scheme, cl, nil, record.NewFakeRecorder(10)).(*storagePressure)
+	p.stores = func(context.Context, *resource.Cluster) ([]clustersql.Store, error) {
+		return []clustersql.Store{{NodeID: 1, StoreID: 1, Capacity: 10 * gi, Available: gi / 2}}, nil
+	}
+
+	ctx := context.Background()
+	require.NoError(t, p.Act(ctx, &cluster))
+
+	actual := &api.CrdbCluster{}
+	require.NoError(t, cl.Get(ctx, client.ObjectKeyFromObject(cr), actual))
+	size := actual.Spec.DataStore.VolumeClaim.PersistentVolumeClaimSpec.Resources.Requests[corev1.ResourceStorage]
+	require.Equal(t, "20Gi", size.String())
+}
+
+func TestStoragePressureDefaultStorageClass(t *testing.T) {
+	scheme := testutil.InitScheme(t)
+	expansion := true
+	slow := &storagev1.StorageClass{ObjectMeta: metav1.ObjectMeta{Name: "slow"}}
+	fast := &storagev1.StorageClass{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:        "fast",
+			Annotations: map[string]string{"storageclass.kubernetes.io/is-default-class": "true"},
+		},
+		AllowVolumeExpansion: &expansion,
+	}
+	p := newStoragePressure(scheme, fake.NewFakeClientWithScheme(scheme, slow, fast), nil, record.NewFakeRecorder(10)).(*storagePressure)
+
+	ctx := context.Background()
+	class, err := p.storageClass(ctx, nil)
+	require.NoError(t, err)
+	require.Equal(t, "fast", class.Name)
+
+	name := "slow"
+	class, err = p.storageClass(ctx, &name)
+	require.NoError(t, err)
+	require.Equal(t, "slow", class.Name)
+
+	for _, name := range []string{"", "missing"} {
+		class, err = p.storageClass(ctx, &name)
+		require.NoError(t, err)
+		require.Nil(t, class)
+	}
+}
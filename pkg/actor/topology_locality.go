@@ -0,0 +1,103 @@
+/*
+Copyright 2021 The Cockroach Authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    https://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package actor
+
+import (
+	"context"
+	"time"
+
+	api "github.com/cockroachdb/cockroach-operator/apis/v1alpha1"
+	"github.com/cockroachdb/cockroach-operator/pkg/labels"
+	"github.com/cockroachdb/cockroach-operator/pkg/resource"
+	"github.com/cockroachdb/errors"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/rest"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+// schedulingInterval is how often the pods waiting to be scheduled are checked
+// for their locality.
+const schedulingInterval = 5 * time.Second
+
+func newTopologyLocality(scheme *runtime.Scheme, cl client.Client, config *rest.Config) Actor {
+	return &topologyLocality{
+		action: newAction("topologyLocality", scheme, cl),
+	}
+}
+
+// topologyLocality annotates the pods of the cluster with the locality of
+// their nodes, taken from the labels of the Kubernetes nodes they are
+// scheduled on. The pods wait for the annotation before their nodes start, and
+// a rescheduled pod is a new pod, annotated with the locality of its new
+// Kubernetes node.
+type topologyLocality struct {
+	action
+}
+
+// GetActionType returns api.TopologyLocalityAction used to set the cluster status errors
+func (t topologyLocality) GetActionType() api.ActionType {
+	return api.TopologyLocalityAction
+}
+
+func (t topologyLocality) Act(ctx context.Context, cluster *resource.Cluster) error {
+	log := t.log.WithValues("CrdbCluster", cluster.ObjectKey())
+
+	selector := labels.Common(cluster.Unwrap()).Selector(cluster.Spec().AdditionalLabels)
+	pods := &corev1.PodList{}
+	if err := t.client.List(ctx, pods, client.InNamespace(cluster.Namespace()), client.MatchingLabels(selector)); err != nil {
+		return errors.Wrap(err, "failed to list pods")
+	}
+
+	unscheduled := 0
+	for i := range pods.Items {
+		pod := &pods.Items[i]
+		if _, ok := pod.Annotations[resource.LocalityAnnotation]; ok {
+			continue
+		}
+		if pod.Spec.NodeName == "" {
+			unscheduled++
+			continue
+		}
+
+		node := &corev1.Node{}
+		if err := t.client.Get(ctx, types.NamespacedName{Name: pod.Spec.NodeName}, node); err != nil {
+			return errors.Wrapf(err, "failed to get node %s of pod %s", pod.Spec.NodeName, pod.Name)
+		}
+		locality := cluster.Spec().TopologyLocality.Locality(node.Labels)
+		if locality == "" {
+			// the pod would wait for a locality forever
+			return errors.Newf("node %s of pod %s has none of the labels of the locality tiers", node.Name, pod.Name)
+		}
+
+		patch := client.MergeFrom(pod.DeepCopy())
+		if pod.Annotations == nil {
+			pod.Annotations = map[string]string{}
+		}
+		pod.Annotations[resource.LocalityAnnotation] = locality
+		if err := t.client.Patch(ctx, pod, patch); err != nil {
+			return errors.Wrapf(err, "failed to annotate pod %s", pod.Name)
+		}
+		log.Info("set the locality of the pod", "pod", pod.Name, "node", node.Name, "locality", locality)
+	}
+
+	if unscheduled > 0 {
+		return DeferredErr{Err: errors.Newf("%d pods are not scheduled yet", unscheduled), RequeueAfter: schedulingInterval}
+	}
+	return nil
+}
@@ -0,0 +1,80 @@
+/*
+Copyright 2021 The Cockroach Authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    https://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package actor
+
+import (
+	"context"
+	"testing"
+
+	api "github.com/cockroachdb/cockroach-operator/apis/v1alpha1"
+	"github.com/cockroachdb/cockroach-operator/pkg/resource"
+	"github.com/cockroachdb/cockroach-operator/pkg/testutil"
+	"github.com/stretchr/testify/require"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/types"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+)
+
+func TestTopologyLocality(t *testing.T) {
+	scheme := testutil.InitScheme(t)
+	ctx := context.Background()
+
+	cr := testutil.NewBuilder("crdb").Namespaced("default").WithNodeCount(3).Cr()
+	cr.Spec.TopologyLocality = &api.TopologyLocality{}
+	cluster := resource.NewCluster(cr)
+
+	node := &corev1.Node{ObjectMeta: metav1.ObjectMeta{
+		Name: "node-b",
+		Labels: map[string]string{
+			corev1.LabelTopologyRegion: "us-east1",
+			corev1.LabelTopologyZone:   "us-east1-b",
+		},
+	}}
+	pods := evictionTestPods(cr, 3)
+	pods[0].(*corev1.Pod).Spec.NodeName = "node-b"
+	// the annotation of a pod is not changed
+	pods[1].(*corev1.Pod).Spec.NodeName = "node-b"
+	pods[1].(*corev1.Pod).Annotations = map[string]string{resource.LocalityAnnotation: "region=us-east1,zone=us-east1-c"}
+	cl := fake.NewFakeClientWithScheme(scheme, append([]runtime.Object{cr, node}, pods...)...)
+
+	// the pod that is not scheduled is checked again
+	err := newTopologyLocality(scheme, cl, nil).Act(ctx, &cluster)
+	deferred, ok := err.(DeferredErr)
+	require.True(t, ok, err)
+	require.Equal(t, schedulingInterval, deferred.RequeueAfter)
+
+	for name, locality := range map[string]string{
+		"crdb-0": "region=us-east1,zone=us-east1-b",
+		"crdb-1": "region=us-east1,zone=us-east1-c",
+		"crdb-2": "",
+	} {
+		pod := &corev1.Pod{}
+		require.NoError(t, cl.Get(ctx, types.NamespacedName{Namespace: "default", Name: name}, pod))
+		require.Equal(t, locality, pod.Annotations[resource.LocalityAnnotation], name)
+	}
+
+	// a node without the labels of the tiers would hold the pod forever
+	pod := &corev1.Pod{}
+	require.NoError(t, cl.Get(ctx, types.NamespacedName{Namespace: "default", Name: "crdb-2"}, pod))
+	pod.Spec.NodeName = "node-c"
+	require.NoError(t, cl.Update(ctx, pod))
+	require.NoError(t, cl.Create(ctx, &corev1.Node{ObjectMeta: metav1.ObjectMeta{Name: "node-c"}}))
+	err = newTopologyLocality(scheme, cl, nil).Act(ctx, &cluster)
+	require.EqualError(t, err, "node node-c of pod crdb-2 has none of the labels of the locality tiers")
+}
@@ -0,0 +1,77 @@
+/*
+Copyright 2021 The Cockroach Authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    https://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package actor
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"time"
+
+	api "github.com/cockroachdb/cockroach-operator/apis/v1alpha1"
+	"github.com/cockroachdb/cockroach-operator/pkg/clustersql"
+	"github.com/cockroachdb/cockroach-operator/pkg/resource"
+	"github.com/cockroachdb/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// checkUpgradeSafe sets the UpgradeSafe condition, and returns a NotReadyErr
+// while some nodes are dead or suspect, while some ranges miss replicas or
+// while schema changes run. Restarting the nodes one after the other then
+// could make ranges unavailable, and a schema change does not survive a
+// mixed-version cluster. The error stops the loop, so that the deploy action
+// does not roll the new version out either.
+func checkUpgradeSafe(ctx context.Context, cluster *resource.Cluster, db *sql.DB, now time.Time) error {
+	nodes, err := clustersql.Nodes(ctx, db)
+	if err != nil {
+		return errors.Wrap(err, "failed to list the nodes")
+	}
+	timeUntilStoreDead, err := clustersql.TimeUntilStoreDead(ctx, db)
+	if err != nil {
+		return err
+	}
+	if dead, suspect := clustersql.UnavailableNodes(nodes, timeUntilStoreDead, now); len(dead) > 0 || len(suspect) > 0 {
+		message := fmt.Sprintf("nodes %v are dead, nodes %v are suspect", dead, suspect)
+		return upgradeNotSafe(cluster, "NodesUnavailable", message)
+	}
+
+	replication, err := clustersql.ReplicationStatus(ctx, db)
+	if err != nil {
+		return err
+	}
+	if !replication.FullyReplicated() {
+		message := fmt.Sprintf("%d ranges are under-replicated, %d are unavailable", replication.UnderReplicated, replication.Unavailable)
+		return upgradeNotSafe(cluster, "RangesUnderReplicated", message)
+	}
+
+	schemaChanges, err := clustersql.RunningSchemaChanges(ctx, db)
+	if err != nil {
+		return err
+	}
+	if schemaChanges > 0 {
+		message := fmt.Sprintf("%d schema changes are running", schemaChanges)
+		return upgradeNotSafe(cluster, "SchemaChangesRunning", message)
+	}
+
+	cluster.SetCondition(api.UpgradeSafeCondition, metav1.ConditionTrue, "ClusterHealthy", "")
+	return nil
+}
+
+func upgradeNotSafe(cluster *resource.Cluster, reason, message string) error {
+	cluster.SetCondition(api.UpgradeSafeCondition, metav1.ConditionFalse, reason, message)
+	return NotReadyErr{Err: errors.Newf("upgrade held: %s", message)}
+}
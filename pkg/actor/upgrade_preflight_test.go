@@ -0,0 +1,105 @@
+/*
+Copyright 2021 The Cockroach Authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    https://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package actor
+
+import (
+	"context"
+	"regexp"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	api "github.com/cockroachdb/cockroach-operator/apis/v1alpha1"
+	"github.com/cockroachdb/cockroach-operator/pkg/resource"
+	"github.com/cockroachdb/cockroach-operator/pkg/testutil"
+	"github.com/stretchr/testify/require"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+func TestCheckUpgradeSafe(t *testing.T) {
+	now := time.Date(2021, time.June, 2, 20, 30, 0, 0, time.UTC)
+
+	tests := []struct {
+		name          string
+		deadFor       time.Duration
+		underReplicas int
+		schemaChanges int
+		reason        string
+	}{
+		{
+			name:   "healthy cluster",
+			reason: "ClusterHealthy",
+		},
+		{
+			name:    "a node is dead",
+			deadFor: 10 * time.Minute,
+			reason:  "NodesUnavailable",
+		},
+		{
+			name:    "a node is suspect",
+			deadFor: time.Minute,
+			reason:  "NodesUnavailable",
+		},
+		{
+			name:          "some ranges are under-replicated",
+			underReplicas: 4,
+			reason:        "RangesUnderReplicated",
+		},
+		{
+			name:          "a schema change runs",
+			schemaChanges: 1,
+			reason:        "SchemaChangesRunning",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			db, mock, err := sqlmock.New()
+			require.NoError(t, err)
+			defer db.Close()
+
+			mock.ExpectQuery(regexp.QuoteMeta("SELECT n.node_id, n.address")).WillReturnRows(
+				sqlmock.NewRows([]string{"node_id", "address", "is_live", "decommissioning", "updated_at"}).
+					AddRow(1, "crdb-0.crdb.default:26257", true, false, now).
+					AddRow(2, "crdb-1.crdb.default:26257", tt.deadFor == 0, false, now.Add(-tt.deadFor)))
+			mock.ExpectQuery("SHOW CLUSTER SETTING server.time_until_store_dead").
+				WillReturnRows(sqlmock.NewRows([]string{"value"}).AddRow("5m0s"))
+			if tt.deadFor == 0 {
+				mock.ExpectQuery(regexp.QuoteMeta("SELECT COALESCE(sum((metrics->>'ranges.underreplicated')::INT8), 0)")).
+					WillReturnRows(sqlmock.NewRows([]string{"underreplicated", "unavailable"}).AddRow(tt.underReplicas, 0))
+			}
+			if tt.deadFor == 0 && tt.underReplicas == 0 {
+				mock.ExpectQuery(regexp.QuoteMeta("SELECT count(*) FROM crdb_internal.jobs")).
+					WillReturnRows(sqlmock.NewRows([]string{"count"}).AddRow(tt.schemaChanges))
+			}
+
+			cluster := resource.NewCluster(testutil.NewBuilder("crdb").Namespaced("default").Cr())
+			err = checkUpgradeSafe(context.Background(), &cluster, db, now)
+			require.NoError(t, mock.ExpectationsWereMet())
+
+			condition := findCondition(&cluster, api.UpgradeSafeCondition)
+			require.Equal(t, tt.reason, condition.Reason)
+			if tt.reason == "ClusterHealthy" {
+				require.NoError(t, err)
+				require.Equal(t, metav1.ConditionTrue, condition.Status)
+			} else {
+				require.IsType(t, NotReadyErr{}, err)
+				require.Equal(t, metav1.ConditionFalse, condition.Status)
+			}
+		})
+	}
+}
@@ -24,6 +24,7 @@ import (
 	"strings"
 	"time"
 
+	"github.com/Masterminds/semver/v3"
 	"github.com/cenkalti/backoff"
 	api "github.com/cockroachdb/cockroach-operator/apis/v1alpha1"
 	"github.com/cockroachdb/cockroach-operator/pkg/kube"
@@ -32,6 +33,7 @@ import (
 	"github.com/cockroachdb/errors"
 	"github.com/go-logr/logr"
 	"go.uber.org/zap/zapcore"
+	appsv1 "k8s.io/api/apps/v1"
 	kbatch "k8s.io/api/batch/v1"
 	corev1 "k8s.io/api/core/v1"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
@@ -44,17 +46,31 @@ import (
 )
 
 func newVersionChecker(scheme *runtime.Scheme, cl client.Client, config *rest.Config) Actor {
-	return &versionChecker{
+	v := &versionChecker{
 		action: newAction("Crdb Version Validator", scheme, cl),
 		config: config,
 	}
+	v.podVersion = func(pod *corev1.Pod) (string, error) {
+		cmd := []string{"/bin/bash", "-c", resource.GetTagVersionCommand}
+		stdout, stderr, err := kube.ExecInPod(scheme, config, pod.Namespace, pod.Name, resource.DbContainerName, cmd)
+		if err != nil {
+			return "", errors.Wrapf(err, "failed to get the version of pod %s: %s", pod.Name, stderr)
+		}
+		return strings.TrimSpace(stdout), nil
+	}
+	return v
 }
 
-// versionChecker performs the validation of the crdb image for the new cluster
+// versionChecker performs the validation of the crdb image for the new cluster.
+// The version is probed from the supported images, from a running pod of the
+// image or from the version tag of the image; a job running the image is only
+// created when none of them knows it, for instance for a digest nobody runs yet
 type versionChecker struct {
 	action
 
 	config *rest.Config
+	// podVersion returns the build tag of the cockroach binary of the pod
+	podVersion func(pod *corev1.Pod) (string, error)
 }
 
 //GetActionType returns api.VersionCheckerAction action used to set the cluster status errors
@@ -98,6 +114,20 @@ func (v *versionChecker) Act(ctx context.Context, cluster *resource.Cluster) err
 	cluster.SetAnnotationVersion(calVersion)
 	cluster.SetCrdbContainerImage(containerImage)
 	cluster.SetAnnotationContainerImage(containerImage)
+
+	probed, err := v.probeVersion(ctx, cluster, log)
+	if err != nil {
+		return err
+	}
+	if probed != "" {
+		containerImage = cluster.GetCockroachDBImageName()
+		if err := v.saveVersionAnnotations(ctx, cluster, probed, containerImage); err != nil {
+			log.Error(err, "failed saving the annotations on version checker")
+			return err
+		}
+		return v.saveVersionStatus(ctx, cluster, probed, containerImage, log)
+	}
+
 	jobName := cluster.JobName()
 	changed, err := (resource.Reconciler{
 		ManagedResource: r,
@@ -273,21 +303,7 @@ func (v *versionChecker) Act(ctx context.Context, cluster *resource.Cluster) err
 			log.V(int(zapcore.DebugLevel)).Info("No update on container image annotation -> nothing changed")
 			return nil
 		}
-		//we refresh the resource to make sure we use the latest version
-		fetcher := resource.NewKubeFetcher(ctx, cluster.Namespace(), v.client)
-
-		cr := resource.ClusterPlaceholder(cluster.Name())
-		if err := fetcher.Fetch(cr); err != nil {
-			log.Error(err, "failed to retrieve CrdbCluster resource")
-			return err
-		}
-
-		refreshedCluster := resource.NewCluster(cr)
-		refreshedCluster.SetClusterVersion(calVersion)
-		refreshedCluster.SetAnnotationVersion(calVersion)
-		refreshedCluster.SetCrdbContainerImage(containerImage)
-		refreshedCluster.SetAnnotationContainerImage(containerImage)
-		if err := v.client.Update(ctx, refreshedCluster.Unwrap()); err != nil {
+		if err := v.saveVersionAnnotations(ctx, cluster, calVersion, containerImage); err != nil {
 			log.Error(err, "failed saving the annotations on version checker")
 			// TODO should we fail here?
 		}
@@ -305,7 +321,104 @@ func (v *versionChecker) Act(ctx context.Context, cluster *resource.Cluster) err
 		log.Error(dErr, "version checker job succeeded, but job failed to delete properly")
 	}
 
-	// we force the saving of the status on the cluster and cancel the loop
+	return v.saveVersionStatus(ctx, cluster, calVersion, containerImage, log)
+}
+
+// probeVersion returns the version of the image of the cluster when it is
+// known without running the image, or an empty string
+func (v *versionChecker) probeVersion(ctx context.Context, cluster *resource.Cluster, log logr.Logger) (string, error) {
+	// the operator ships the image of a supported cockroachDBVersion
+	if cluster.Spec().Image.Name == "" {
+		version, _ := cluster.LookupSupportedVersion(cluster.Spec().CockroachDBVersion)
+		return version, nil
+	}
+
+	// a pod that already runs the image knows its version, for instance
+	// when the operator restarts
+	image := cluster.Spec().Image.Name
+	version, err := v.runningPodVersion(ctx, cluster, image, log)
+	if err != nil || version != "" {
+		return version, err
+	}
+
+	// a new image of a release is tagged with its version, only an image
+	// without a version tag, such as a digest, is left to the job
+	tag := strings.TrimPrefix(image, getImageNameNoVersion(image)+":")
+	if !strings.HasPrefix(tag, "v") {
+		return "", nil
+	}
+	if _, err := semver.StrictNewVersion(tag[1:]); err != nil {
+		return "", nil
+	}
+	log.V(int(zapcore.DebugLevel)).Info("took the version from the tag of the image", "image", image, "calVersion", tag)
+	return tag, nil
+}
+
+// runningPodVersion asks a ready pod of the cluster running the image for its
+// version, and returns an empty string if no pod runs it
+func (v *versionChecker) runningPodVersion(ctx context.Context, cluster *resource.Cluster, image string, log logr.Logger) (string, error) {
+	sts := &appsv1.StatefulSet{}
+	key := kubetypes.NamespacedName{Namespace: cluster.Namespace(), Name: cluster.StatefulSetName()}
+	if err := v.client.Get(ctx, key, sts); err != nil {
+		return "", kube.IgnoreNotFound(err)
+	}
+
+	var replicas int32
+	if sts.Spec.Replicas != nil {
+		replicas = *sts.Spec.Replicas
+	}
+	for i := int32(0); i < replicas; i++ {
+		pod := &corev1.Pod{}
+		key := kubetypes.NamespacedName{Namespace: cluster.Namespace(), Name: fmt.Sprintf("%s-%d", sts.Name, i)}
+		if err := v.client.Get(ctx, key, pod); err != nil {
+			if kube.IgnoreNotFound(err) == nil {
+				continue
+			}
+			return "", err
+		}
+		if !kube.IsPodReady(pod) {
+			continue
+		}
+		container, err := kube.FindContainer(resource.DbContainerName, &pod.Spec)
+		if err != nil || container.Image != image {
+			continue
+		}
+
+		version, err := v.podVersion(pod)
+		if err != nil {
+			// another pod may answer
+			log.Error(err, "failed to probe the version of the pod", "pod", pod.Name)
+			continue
+		}
+		if version != "" {
+			log.V(int(zapcore.DebugLevel)).Info("probed the version of a running pod", "pod", pod.Name, "calVersion", version)
+			return version, nil
+		}
+	}
+	return "", nil
+}
+
+// saveVersionAnnotations saves the version and the image on the annotations of
+// the latest revision of the cluster
+func (v *versionChecker) saveVersionAnnotations(ctx context.Context, cluster *resource.Cluster, calVersion, containerImage string) error {
+	fetcher := resource.NewKubeFetcher(ctx, cluster.Namespace(), v.client)
+
+	cr := resource.ClusterPlaceholder(cluster.Name())
+	if err := fetcher.Fetch(cr); err != nil {
+		return errors.Wrap(err, "failed to retrieve CrdbCluster resource")
+	}
+
+	refreshedCluster := resource.NewCluster(cr)
+	refreshedCluster.SetClusterVersion(calVersion)
+	refreshedCluster.SetAnnotationVersion(calVersion)
+	refreshedCluster.SetCrdbContainerImage(containerImage)
+	refreshedCluster.SetAnnotationContainerImage(containerImage)
+	return v.client.Update(ctx, refreshedCluster.Unwrap())
+}
+
+// saveVersionStatus forces the saving of the version on the status of the
+// cluster and cancels the loop
+func (v *versionChecker) saveVersionStatus(ctx context.Context, cluster *resource.Cluster, calVersion, containerImage string, log logr.Logger) error {
 	fetcher := resource.NewKubeFetcher(ctx, cluster.Namespace(), v.client)
 
 	cr := resource.ClusterPlaceholder(cluster.Name())
@@ -0,0 +1,179 @@
+/*
+Copyright 2021 The Cockroach Authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    https://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package actor
+
+import (
+	"context"
+	"fmt"
+	"testing"
+
+	api "github.com/cockroachdb/cockroach-operator/apis/v1alpha1"
+	"github.com/cockroachdb/cockroach-operator/pkg/ptr"
+	"github.com/cockroachdb/cockroach-operator/pkg/resource"
+	"github.com/cockroachdb/cockroach-operator/pkg/testutil"
+	"github.com/cockroachdb/errors"
+	"github.com/go-logr/logr"
+	"github.com/stretchr/testify/require"
+	appsv1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+)
+
+func TestVersionCheckerProbesRunningPod(t *testing.T) {
+	image := "cockroachdb/cockroach@sha256:0123456789abcdef"
+
+	tests := []struct {
+		name    string
+		image   []string
+		ready   []bool
+		version string
+	}{
+		{
+			name:    "a ready pod runs the image",
+			image:   []string{"cockroachdb/cockroach:v20.2.8", image, image},
+			ready:   []bool{true, false, true},
+			version: "v21.1.9",
+		},
+		{
+			name:  "no ready pod runs the image",
+			image: []string{"cockroachdb/cockroach:v20.2.8", image, image},
+			ready: []bool{true, false, false},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctx := context.Background()
+			scheme := testutil.InitScheme(t)
+
+			cr := testutil.NewBuilder("crdb").Namespaced("default").WithNodeCount(3).WithImage(image).Cr()
+			objs := []runtime.Object{cr, &appsv1.StatefulSet{
+				ObjectMeta: metav1.ObjectMeta{Name: "crdb", Namespace: "default"},
+				Spec:       appsv1.StatefulSetSpec{Replicas: ptr.Int32(3)},
+			}}
+			for i := range tt.image {
+				ready := corev1.ConditionFalse
+				if tt.ready[i] {
+					ready = corev1.ConditionTrue
+				}
+				objs = append(objs, &corev1.Pod{
+					ObjectMeta: metav1.ObjectMeta{Name: fmt.Sprintf("crdb-%d", i), Namespace: "default"},
+					Spec:       corev1.PodSpec{Containers: []corev1.Container{{Name: resource.DbContainerName, Image: tt.image[i]}}},
+					Status:     corev1.PodStatus{Conditions: []corev1.PodCondition{{Type: corev1.PodReady, Status: ready}}},
+				})
+			}
+			cl := fake.NewFakeClientWithScheme(scheme, objs...)
+
+			v := newVersionChecker(scheme, cl, nil).(*versionChecker)
+			var probed []string
+			v.podVersion = func(pod *corev1.Pod) (string, error) {
+				probed = append(probed, pod.Name)
+				if pod.Name == "crdb-0" {
+					return "", errors.New("unexpected probe")
+				}
+				return "v21.1.9", nil
+			}
+
+			cluster := resource.NewCluster(cr)
+			version, err := v.runningPodVersion(ctx, &cluster, image, logr.Discard())
+			require.NoError(t, err)
+			require.Equal(t, tt.version, version)
+			if tt.version == "" {
+				require.Empty(t, probed)
+				return
+			}
+			require.Equal(t, []string{"crdb-2"}, probed)
+
+			require.NoError(t, v.saveVersionStatus(ctx, &cluster, version, image, logr.Discard()))
+			actual := &api.CrdbCluster{}
+			require.NoError(t, cl.Get(ctx, client.ObjectKeyFromObject(cr), actual))
+			require.Equal(t, "v21.1.9", actual.Status.Version)
+			require.Equal(t, image, actual.Status.CrdbContainerImage)
+		})
+	}
+}
+
+func TestVersionCheckerTakesTheVersionTag(t *testing.T) {
+	tests := []struct {
+		name    string
+		image   string
+		pods    bool
+		version string
+	}{
+		{
+			name:    "no pod runs the image, the tag is the version",
+			image:   "cockroachdb/cockroach:v21.1.9",
+			version: "v21.1.9",
+		},
+		{
+			name:    "the tag of a registry with a port is the version",
+			image:   "localhost:5000/cockroach:v21.2.0-beta.1",
+			version: "v21.2.0-beta.1",
+		},
+		{
+			name:    "a running pod reports another version than the tag",
+			image:   "cockroachdb/cockroach:v21.1.9",
+			pods:    true,
+			version: "v21.1.10",
+		},
+		{
+			name:  "a tag that is not a version is left to the job",
+			image: "cockroachdb/cockroach:latest-v21.1",
+		},
+		{
+			name:  "an untagged image is left to the job",
+			image: "localhost:5000/cockroach",
+		},
+		{
+			name:  "a digest is left to the job",
+			image: "cockroachdb/cockroach@sha256:0123456789abcdef",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			scheme := testutil.InitScheme(t)
+
+			cr := testutil.NewBuilder("crdb").Namespaced("default").WithNodeCount(1).WithImage(tt.image).Cr()
+			objs := []runtime.Object{cr, &appsv1.StatefulSet{
+				ObjectMeta: metav1.ObjectMeta{Name: "crdb", Namespace: "default"},
+				Spec:       appsv1.StatefulSetSpec{Replicas: ptr.Int32(1)},
+			}}
+			if tt.pods {
+				objs = append(objs, &corev1.Pod{
+					ObjectMeta: metav1.ObjectMeta{Name: "crdb-0", Namespace: "default"},
+					Spec:       corev1.PodSpec{Containers: []corev1.Container{{Name: resource.DbContainerName, Image: tt.image}}},
+					Status:     corev1.PodStatus{Conditions: []corev1.PodCondition{{Type: corev1.PodReady, Status: corev1.ConditionTrue}}},
+				})
+			}
+			cl := fake.NewFakeClientWithScheme(scheme, objs...)
+
+			v := newVersionChecker(scheme, cl, nil).(*versionChecker)
+			v.podVersion = func(pod *corev1.Pod) (string, error) {
+				return "v21.1.10", nil
+			}
+
+			cluster := resource.NewCluster(cr)
+			version, err := v.probeVersion(context.Background(), &cluster, logr.Discard())
+			require.NoError(t, err)
+			require.Equal(t, tt.version, version)
+		})
+	}
+}
@@ -0,0 +1,279 @@
+/*
+Copyright 2021 The Cockroach Authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    https://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package clustersql
+
+import (
+	"context"
+	"database/sql"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/cockroachdb/errors"
+	"github.com/jackc/pgx/v4"
+)
+
+// Job statuses of crdb_internal.jobs the operator cares about.
+const (
+	JobSucceeded = "succeeded"
+	JobFailed    = "failed"
+	JobCanceled  = "canceled"
+)
+
+// Job is a BACKUP or RESTORE job of the cluster.
+type Job struct {
+	ID     int64
+	Status string
+	Error  string
+}
+
+// Finished returns whether the job is over, successfully or not.
+func (j Job) Finished() bool {
+	return j.Status == JobSucceeded || j.Status == JobFailed || j.Status == JobCanceled
+}
+
+// StartBackup starts a full cluster backup into the collection at uri and
+// returns the ID of the job without waiting for it. The backup reads slightly
+// stale data to not conflict with the foreground traffic.
+func StartBackup(ctx context.Context, db *sql.DB, uri string) (int64, error) {
+	var id int64
+	r := db.QueryRowContext(ctx, "BACKUP INTO $1 AS OF SYSTEM TIME '-10s' WITH detached", uri)
+	if err := r.Scan(&id); err != nil {
+		return 0, errors.Wrap(err, "failed to start backup")
+	}
+	return id, nil
+}
+
+// ListBackups returns the paths of the full backups of the collection at uri,
+// from the oldest to the most recent.
+func ListBackups(ctx context.Context, db *sql.DB, uri string) ([]string, error) {
+	rows, err := db.QueryContext(ctx, "SHOW BACKUPS IN $1", uri)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to list backups")
+	}
+	defer rows.Close()
+
+	var paths []string
+	for rows.Next() {
+		var path string
+		if err := rows.Scan(&path); err != nil {
+			return nil, errors.Wrap(err, "failed to scan rows")
+		}
+		paths = append(paths, path)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, errors.Wrap(err, "failed to read rows")
+	}
+	return paths, nil
+}
+
+// LatestBackup returns the path of the most recent backup of the collection at
+// uri.
+func LatestBackup(ctx context.Context, db *sql.DB, uri string) (string, error) {
+	paths, err := ListBackups(ctx, db, uri)
+	if err != nil {
+		return "", err
+	}
+	if len(paths) == 0 {
+		return "", errors.Newf("no backup found in %s", RedactURI(uri))
+	}
+	return paths[len(paths)-1], nil
+}
+
+// StartRestore starts a full cluster restore of the backup at path in the
+// collection at uri and returns the ID of the job without waiting for it. The
+// cluster must not have any user data yet.
+func StartRestore(ctx context.Context, db *sql.DB, uri, path string) (int64, error) {
+	var id int64
+	r := db.QueryRowContext(ctx, "RESTORE FROM $1 IN $2 WITH detached", path, uri)
+	if err := r.Scan(&id); err != nil {
+		return 0, errors.Wrapf(err, "failed to start restore of %s", path)
+	}
+	return id, nil
+}
+
+// RestoreTarget selects what a restore restores: some databases, some tables,
+// or the whole cluster when both are empty, and as of when.
+type RestoreTarget struct {
+	// Databases are the names of the databases
+	Databases []string
+	// Tables are the qualified names of the tables, such as movr.public.rides
+	Tables []string
+	// IntoDB is the database the tables are restored into, instead of their
+	// original one
+	IntoDB string
+	// AsOf is the system time the data is restored as of, in the revision
+	// history of the backup. The zero time restores the end of the backup
+	AsOf time.Time
+}
+
+// systemTimeFormat formats the timestamps of AS OF SYSTEM TIME clauses.
+const systemTimeFormat = "2006-01-02 15:04:05.999999"
+
+// StartTargetedRestore starts a restore of the target from the backup at path
+// in the collection at uri and returns the ID of the job without waiting for
+// it. The restored databases and tables must not exist in the cluster.
+func StartTargetedRestore(ctx context.Context, db *sql.DB, uri, path string, target RestoreTarget) (int64, error) {
+	if len(target.Databases) == 0 && len(target.Tables) == 0 && target.AsOf.IsZero() {
+		return StartRestore(ctx, db, uri, path)
+	}
+
+	stmt := "RESTORE"
+	args := []interface{}{path, uri}
+	if len(target.Databases) > 0 {
+		var names []string
+		for _, name := range target.Databases {
+			names = append(names, quote(name))
+		}
+		stmt += " DATABASE " + strings.Join(names, ", ")
+	} else if len(target.Tables) > 0 {
+		var names []string
+		for _, name := range target.Tables {
+			names = append(names, pgx.Identifier(strings.Split(name, ".")).Sanitize())
+		}
+		stmt += " TABLE " + strings.Join(names, ", ")
+	}
+
+	stmt += " FROM $1 IN $2"
+	// the clause takes a constant, which the formatted time is
+	if !target.AsOf.IsZero() {
+		stmt += " AS OF SYSTEM TIME '" + target.AsOf.UTC().Format(systemTimeFormat) + "'"
+	}
+	stmt += " WITH detached"
+	if len(target.Tables) > 0 && target.IntoDB != "" {
+		stmt += ", into_db = $3"
+		args = append(args, target.IntoDB)
+	}
+
+	var id int64
+	r := db.QueryRowContext(ctx, stmt, args...)
+	if err := r.Scan(&id); err != nil {
+		return 0, errors.Wrapf(err, "failed to start restore of %s", path)
+	}
+	return id, nil
+}
+
+// BackupWindow returns the times the backup at path in the collection at uri
+// can be restored as of: from the end of its full backup to the end of its
+// last incremental backup. The times between the ends of the backups need the
+// revision history, which the RESTORE statement checks.
+func BackupWindow(ctx context.Context, db *sql.DB, uri, path string) (time.Time, time.Time, error) {
+	var start, end sql.NullTime
+	r := db.QueryRowContext(ctx, "SELECT min(end_time), max(end_time) FROM [SHOW BACKUP FROM $1 IN $2]", path, uri)
+	if err := r.Scan(&start, &end); err != nil {
+		return time.Time{}, time.Time{}, errors.Wrapf(err, "failed to show backup %s", path)
+	}
+	if !end.Valid {
+		return time.Time{}, time.Time{}, errors.Newf("backup %s is empty", path)
+	}
+	return start.Time, end.Time, nil
+}
+
+// JobProgress returns the fraction of the work of the job that is done,
+// between 0 and 1.
+func JobProgress(ctx context.Context, db *sql.DB, id int64) (float64, error) {
+	var fraction sql.NullFloat64
+	r := db.QueryRowContext(ctx, "SELECT fraction_completed FROM crdb_internal.jobs WHERE job_id = $1", id)
+	if err := r.Scan(&fraction); err != nil {
+		return 0, errors.Wrapf(err, "failed to get the progress of job %d", id)
+	}
+	return fraction.Float64, nil
+}
+
+// GetJob returns the job with the given ID.
+func GetJob(ctx context.Context, db *sql.DB, id int64) (Job, error) {
+	job := Job{ID: id}
+	var jobErr sql.NullString
+	r := db.QueryRowContext(ctx, "SELECT status, error FROM crdb_internal.jobs WHERE job_id = $1", id)
+	if err := r.Scan(&job.Status, &jobErr); err != nil {
+		return Job{}, errors.Wrapf(err, "failed to get job %d", id)
+	}
+	job.Error = jobErr.String
+	return job, nil
+}
+
+// NodelocalURI returns the URI of path in the external IO directory of the
+// nodes. With a volume shared by all the nodes, node 1 is as good as any.
+func NodelocalURI(path string) string {
+	return "nodelocal://1/" + strings.TrimPrefix(path, "/")
+}
+
+// cloudSchemes are the schemes of the cloud storage URIs that support the
+// implicit authentication of the nodes.
+var cloudSchemes = map[string]bool{
+	"s3":            true,
+	"gs":            true,
+	"azure":         true,
+	"azure-blob":    true,
+	"azure-storage": true,
+}
+
+// credentialParams are the query parameters of the URIs with explicit
+// credentials.
+var credentialParams = []string{"AWS_ACCESS_KEY_ID", "CREDENTIALS", "AZURE_ACCOUNT_KEY", "AZURE_CLIENT_SECRET"}
+
+// ImplicitAuthURI returns the cloud storage uri with AUTH=implicit, so the
+// nodes authenticate with the cloud identity of their service account. URIs
+// of other storage, or setting AUTH or credentials, are returned as is.
+func ImplicitAuthURI(uri string) string {
+	u, err := url.Parse(uri)
+	if err != nil || !cloudSchemes[u.Scheme] {
+		return uri
+	}
+
+	query := u.Query()
+	if query.Get("AUTH") != "" {
+		return uri
+	}
+	for _, param := range credentialParams {
+		if query.Get(param) != "" {
+			return uri
+		}
+	}
+
+	if u.RawQuery == "" {
+		return strings.TrimSuffix(uri, "?") + "?AUTH=implicit"
+	}
+	return uri + "&AUTH=implicit"
+}
+
+// RedactURI removes the query string of uri, which holds the credentials of
+// cloud storage, and the password of its user info, which holds the
+// credentials of the primary cluster of a replication stream, so it can be
+// logged.
+func RedactURI(uri string) string {
+	if i := strings.Index(uri, "?"); i >= 0 {
+		uri = uri[:i]
+	}
+
+	i := strings.Index(uri, "://")
+	if i < 0 {
+		return uri
+	}
+	authority := uri[i+3:]
+	if j := strings.Index(authority, "/"); j >= 0 {
+		authority = authority[:j]
+	}
+	at := strings.LastIndex(authority, "@")
+	if at < 0 {
+		return uri
+	}
+	if colon := strings.Index(authority[:at], ":"); colon >= 0 {
+		return uri[:i+3] + authority[:colon] + uri[i+3+at:]
+	}
+	return uri
+}
@@ -0,0 +1,223 @@
+/*
+Copyright 2021 The Cockroach Authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    https://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package clustersql_test
+
+import (
+	"context"
+	"database/sql/driver"
+	"regexp"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	. "github.com/cockroachdb/cockroach-operator/pkg/clustersql"
+	"github.com/stretchr/testify/require"
+)
+
+const collection = "s3://backups/crdb?AUTH=implicit"
+
+func TestStartBackup(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	require.NoError(t, err)
+	defer db.Close()
+
+	mock.ExpectQuery(regexp.QuoteMeta("BACKUP INTO $1 AS OF SYSTEM TIME '-10s' WITH detached")).
+		WithArgs(collection).
+		WillReturnRows(sqlmock.NewRows([]string{"job_id"}).AddRow(42))
+
+	id, err := StartBackup(context.Background(), db, collection)
+	require.NoError(t, err)
+	require.Equal(t, int64(42), id)
+	require.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestLatestBackup(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	require.NoError(t, err)
+	defer db.Close()
+
+	query := regexp.QuoteMeta("SHOW BACKUPS IN $1")
+
+	t.Run("returns the last backup of the collection", func(t *testing.T) {
+		rows := sqlmock.NewRows([]string{"path"}).
+			AddRow("2021/06/01-120000.00").
+			AddRow("2021/06/02-120000.00")
+		mock.ExpectQuery(query).WithArgs(collection).WillReturnRows(rows).RowsWillBeClosed()
+
+		path, err := LatestBackup(context.Background(), db, collection)
+		require.NoError(t, err)
+		require.Equal(t, "2021/06/02-120000.00", path)
+	})
+
+	t.Run("returns error without credentials when the collection is empty", func(t *testing.T) {
+		mock.ExpectQuery(query).WithArgs(collection).WillReturnRows(sqlmock.NewRows([]string{"path"}))
+
+		_, err := LatestBackup(context.Background(), db, collection)
+		require.EqualError(t, err, "no backup found in s3://backups/crdb")
+	})
+
+	require.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestStartRestore(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	require.NoError(t, err)
+	defer db.Close()
+
+	mock.ExpectQuery(regexp.QuoteMeta("RESTORE FROM $1 IN $2 WITH detached")).
+		WithArgs("2021/06/02-120000.00", collection).
+		WillReturnRows(sqlmock.NewRows([]string{"job_id"}).AddRow(43))
+
+	id, err := StartRestore(context.Background(), db, collection, "2021/06/02-120000.00")
+	require.NoError(t, err)
+	require.Equal(t, int64(43), id)
+	require.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestStartTargetedRestore(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	require.NoError(t, err)
+	defer db.Close()
+
+	path := "2021/06/02-120000.00"
+	tests := []struct {
+		name   string
+		target RestoreTarget
+		stmt   string
+		args   []driver.Value
+	}{
+		{
+			name:   "the whole cluster",
+			target: RestoreTarget{},
+			stmt:   "RESTORE FROM $1 IN $2 WITH detached",
+			args:   []driver.Value{path, collection},
+		},
+		{
+			name:   "databases",
+			target: RestoreTarget{Databases: []string{"movr", "bank"}},
+			stmt:   `RESTORE DATABASE "movr", "bank" FROM $1 IN $2 WITH detached`,
+			args:   []driver.Value{path, collection},
+		},
+		{
+			name:   "the whole cluster as of a time",
+			target: RestoreTarget{AsOf: time.Date(2021, time.June, 2, 11, 30, 0, 500000000, time.UTC)},
+			stmt:   "RESTORE FROM $1 IN $2 AS OF SYSTEM TIME '2021-06-02 11:30:00.5' WITH detached",
+			args:   []driver.Value{path, collection},
+		},
+		{
+			name:   "tables into another database",
+			target: RestoreTarget{Tables: []string{"movr.public.rides", "movr.users"}, IntoDB: "movr_copy"},
+			stmt:   `RESTORE TABLE "movr"."public"."rides", "movr"."users" FROM $1 IN $2 WITH detached, into_db = $3`,
+			args:   []driver.Value{path, collection, "movr_copy"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			mock.ExpectQuery(regexp.QuoteMeta(tt.stmt)).
+				WithArgs(tt.args...).
+				WillReturnRows(sqlmock.NewRows([]string{"job_id"}).AddRow(44))
+
+			id, err := StartTargetedRestore(context.Background(), db, collection, path, tt.target)
+			require.NoError(t, err)
+			require.Equal(t, int64(44), id)
+		})
+	}
+
+	require.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestBackupWindow(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	require.NoError(t, err)
+	defer db.Close()
+
+	path := "2021/06/02-120000.00"
+	full := time.Date(2021, time.June, 2, 12, 0, 0, 0, time.UTC)
+	incremental := time.Date(2021, time.June, 2, 18, 0, 0, 0, time.UTC)
+	mock.ExpectQuery(regexp.QuoteMeta("SELECT min(end_time), max(end_time) FROM [SHOW BACKUP FROM $1 IN $2]")).
+		WithArgs(path, collection).
+		WillReturnRows(sqlmock.NewRows([]string{"min", "max"}).AddRow(full, incremental))
+
+	start, end, err := BackupWindow(context.Background(), db, collection, path)
+	require.NoError(t, err)
+	require.Equal(t, full, start)
+	require.Equal(t, incremental, end)
+	require.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestJobProgress(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	require.NoError(t, err)
+	defer db.Close()
+
+	mock.ExpectQuery(regexp.QuoteMeta("SELECT fraction_completed FROM crdb_internal.jobs WHERE job_id = $1")).
+		WithArgs(44).
+		WillReturnRows(sqlmock.NewRows([]string{"fraction_completed"}).AddRow(0.25))
+
+	fraction, err := JobProgress(context.Background(), db, 44)
+	require.NoError(t, err)
+	require.Equal(t, 0.25, fraction)
+	require.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestGetJob(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	require.NoError(t, err)
+	defer db.Close()
+
+	query := regexp.QuoteMeta("SELECT status, error FROM crdb_internal.jobs WHERE job_id = $1")
+	columns := []string{"status", "error"}
+
+	mock.ExpectQuery(query).WithArgs(42).WillReturnRows(sqlmock.NewRows(columns).AddRow("running", nil))
+	job, err := GetJob(context.Background(), db, 42)
+	require.NoError(t, err)
+	require.Equal(t, Job{ID: 42, Status: "running"}, job)
+	require.False(t, job.Finished())
+
+	mock.ExpectQuery(query).WithArgs(42).WillReturnRows(sqlmock.NewRows(columns).AddRow("failed", "access denied"))
+	job, err = GetJob(context.Background(), db, 42)
+	require.NoError(t, err)
+	require.Equal(t, Job{ID: 42, Status: JobFailed, Error: "access denied"}, job)
+	require.True(t, job.Finished())
+
+	require.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestNodelocalURI(t *testing.T) {
+	require.Equal(t, "nodelocal://1/clones/crdb", NodelocalURI("clones/crdb"))
+	require.Equal(t, "nodelocal://1/clones/crdb", NodelocalURI("/clones/crdb"))
+}
+
+func TestImplicitAuthURI(t *testing.T) {
+	tests := []struct {
+		uri      string
+		expected string
+	}{
+		{"s3://bucket/path", "s3://bucket/path?AUTH=implicit"},
+		{"gs://bucket/path?", "gs://bucket/path?AUTH=implicit"},
+		{"azure-blob://container/path?AZURE_ACCOUNT_NAME=crdb", "azure-blob://container/path?AZURE_ACCOUNT_NAME=crdb&AUTH=implicit"},
+		{"s3://bucket/path?AUTH=specified&AWS_ACCESS_KEY_ID=id", "s3://bucket/path?AUTH=specified&AWS_ACCESS_KEY_ID=id"},
+		{"s3://bucket/path?AWS_ACCESS_KEY_ID=id&AWS_SECRET_ACCESS_KEY=secret", "s3://bucket/path?AWS_ACCESS_KEY_ID=id&AWS_SECRET_ACCESS_KEY=secret"},
+		{"gs://bucket/path?CREDENTIALS=base64", "gs://bucket/path?CREDENTIALS=base64"},
+		{"nodelocal://1/backups", "nodelocal://1/backups"},
+	}
+
+	for _, tt := range tests {
+		require.Equal(t, tt.expected, ImplicitAuthURI(tt.uri), tt.uri)
+	}
+}
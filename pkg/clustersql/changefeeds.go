@@ -0,0 +1,149 @@
+/*
+Copyright 2021 The Cockroach Authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    https://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package clustersql
+
+import (
+	"context"
+	"database/sql"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/cockroachdb/errors"
+	"github.com/jackc/pgx/v4"
+)
+
+// Job statuses of the changefeed jobs, which run until they are canceled.
+const (
+	JobRunning = "running"
+	JobPaused  = "paused"
+)
+
+// Changefeed selects what a changefeed emits to its sink.
+type Changefeed struct {
+	// Tables are the qualified names of the tables, such as movr.public.rides
+	Tables []string
+	// Format is the format of the messages, the default of CockroachDB when
+	// empty
+	Format string
+	// Resolved is how often resolved timestamps are emitted, never when zero
+	Resolved time.Duration
+}
+
+// ChangefeedJob is a changefeed job of the cluster.
+type ChangefeedJob struct {
+	Job
+	// RunningStatus is the status the running job reports
+	RunningStatus string
+	// HighWater is the time up to which all the changes were emitted, zero
+	// until the initial scan is done
+	HighWater time.Time
+}
+
+// CreateChangefeed starts a changefeed emitting the changes of the tables to
+// the sink at uri and returns the ID of its job.
+func CreateChangefeed(ctx context.Context, db *sql.DB, uri string, feed Changefeed) (int64, error) {
+	var names []string
+	for _, name := range feed.Tables {
+		names = append(names, pgx.Identifier(strings.Split(name, ".")).Sanitize())
+	}
+
+	stmt := "CREATE CHANGEFEED FOR TABLE " + strings.Join(names, ", ") + " INTO $1"
+	args := []interface{}{uri}
+	var options []string
+	if feed.Format != "" {
+		args = append(args, feed.Format)
+		options = append(options, "format = $"+strconv.Itoa(len(args)))
+	}
+	if feed.Resolved > 0 {
+		args = append(args, feed.Resolved.String())
+		options = append(options, "resolved = $"+strconv.Itoa(len(args)))
+	}
+	if len(options) > 0 {
+		stmt += " WITH " + strings.Join(options, ", ")
+	}
+
+	var id int64
+	r := db.QueryRowContext(ctx, stmt, args...)
+	if err := r.Scan(&id); err != nil {
+		return 0, errors.Wrapf(err, "failed to create changefeed into %s", RedactURI(uri))
+	}
+	return id, nil
+}
+
+// GetChangefeedJob returns the changefeed job with the given ID.
+func GetChangefeedJob(ctx context.Context, db *sql.DB, id int64) (ChangefeedJob, error) {
+	job := ChangefeedJob{Job: Job{ID: id}}
+	var jobErr, runningStatus, highWater sql.NullString
+	r := db.QueryRowContext(ctx, "SELECT status, error, running_status, high_water_timestamp::STRING FROM crdb_internal.jobs WHERE job_id = $1", id)
+	if err := r.Scan(&job.Status, &jobErr, &runningStatus, &highWater); err != nil {
+		return ChangefeedJob{}, errors.Wrapf(err, "failed to get job %d", id)
+	}
+	job.Error = jobErr.String
+	job.RunningStatus = runningStatus.String
+
+	if highWater.String != "" {
+		t, err := hlcTime(highWater.String)
+		if err != nil {
+			return ChangefeedJob{}, errors.Wrapf(err, "failed to parse the high water of job %d", id)
+		}
+		job.HighWater = t
+	}
+	return job, nil
+}
+
+// hlcTime returns the wall time of an HLC timestamp, a decimal whose integer
+// part is the nanoseconds since the epoch and whose fractional part is the
+// logical clock.
+func hlcTime(hlc string) (time.Time, error) {
+	wall := hlc
+	if i := strings.Index(hlc, "."); i >= 0 {
+		wall = hlc[:i]
+	}
+	nanos, err := strconv.ParseInt(wall, 10, 64)
+	if err != nil {
+		return time.Time{}, err
+	}
+	if nanos == 0 {
+		return time.Time{}, nil
+	}
+	return time.Unix(0, nanos).UTC(), nil
+}
+
+// PauseJob pauses the job with the given ID.
+func PauseJob(ctx context.Context, db *sql.DB, id int64) error {
+	if _, err := db.ExecContext(ctx, "PAUSE JOB $1", id); err != nil {
+		return errors.Wrapf(err, "failed to pause job %d", id)
+	}
+	return nil
+}
+
+// ResumeJob resumes the paused job with the given ID.
+func ResumeJob(ctx context.Context, db *sql.DB, id int64) error {
+	if _, err := db.ExecContext(ctx, "RESUME JOB $1", id); err != nil {
+		return errors.Wrapf(err, "failed to resume job %d", id)
+	}
+	return nil
+}
+
+// CancelJob cancels the job with the given ID.
+func CancelJob(ctx context.Context, db *sql.DB, id int64) error {
+	if _, err := db.ExecContext(ctx, "CANCEL JOB $1", id); err != nil {
+		return errors.Wrapf(err, "failed to cancel job %d", id)
+	}
+	return nil
+}
@@ -0,0 +1,152 @@
+/*
+Copyright 2021 The Cockroach Authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    https://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package clustersql_test
+
+import (
+	"context"
+	"database/sql/driver"
+	"regexp"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	. "github.com/cockroachdb/cockroach-operator/pkg/clustersql"
+	"github.com/stretchr/testify/require"
+)
+
+const sink = "kafka://kafka.default:9092?sasl_password=secret"
+
+func TestCreateChangefeed(t *testing.T) {
+	tests := []struct {
+		name  string
+		feed  Changefeed
+		query string
+		args  []interface{}
+	}{
+		{
+			name:  "with the default options",
+			feed:  Changefeed{Tables: []string{"movr.public.rides"}},
+			query: `CREATE CHANGEFEED FOR TABLE "movr"."public"."rides" INTO $1`,
+			args:  []interface{}{sink},
+		},
+		{
+			name:  "with a format and resolved timestamps",
+			feed:  Changefeed{Tables: []string{"movr.rides", "users"}, Format: "avro", Resolved: 10 * time.Second},
+			query: `CREATE CHANGEFEED FOR TABLE "movr"."rides", "users" INTO $1 WITH format = $2, resolved = $3`,
+			args:  []interface{}{sink, "avro", "10s"},
+		},
+		{
+			name:  "with resolved timestamps only",
+			feed:  Changefeed{Tables: []string{"users"}, Resolved: time.Minute},
+			query: `CREATE CHANGEFEED FOR TABLE "users" INTO $1 WITH resolved = $2`,
+			args:  []interface{}{sink, "1m0s"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			db, mock, err := sqlmock.New()
+			require.NoError(t, err)
+			defer db.Close()
+
+			var args []driver.Value
+			for _, arg := range tt.args {
+				args = append(args, arg)
+			}
+			mock.ExpectQuery(regexp.QuoteMeta(tt.query)).
+				WithArgs(args...).
+				WillReturnRows(sqlmock.NewRows([]string{"job_id"}).AddRow(42))
+
+			id, err := CreateChangefeed(context.Background(), db, sink, tt.feed)
+			require.NoError(t, err)
+			require.Equal(t, int64(42), id)
+			require.NoError(t, mock.ExpectationsWereMet())
+		})
+	}
+}
+
+func TestCreateChangefeedRedactsTheSink(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	require.NoError(t, err)
+	defer db.Close()
+
+	mock.ExpectQuery("CREATE CHANGEFEED").WillReturnError(sqlmock.ErrCancelled)
+
+	_, err = CreateChangefeed(context.Background(), db, sink, Changefeed{Tables: []string{"users"}})
+	require.Error(t, err)
+	require.NotContains(t, err.Error(), "secret")
+	require.Contains(t, err.Error(), "kafka://kafka.default:9092")
+}
+
+func TestGetChangefeedJob(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	require.NoError(t, err)
+	defer db.Close()
+
+	query := regexp.QuoteMeta("SELECT status, error, running_status, high_water_timestamp::STRING FROM crdb_internal.jobs WHERE job_id = $1")
+	columns := []string{"status", "error", "running_status", "high_water_timestamp"}
+
+	t.Run("returns the high water of a running job", func(t *testing.T) {
+		rows := sqlmock.NewRows(columns).AddRow("running", "", "running: resolved=1623456789.123456789,0", "1623456789123456789.0000000001")
+		mock.ExpectQuery(query).WithArgs(42).WillReturnRows(rows)
+
+		job, err := GetChangefeedJob(context.Background(), db, 42)
+		require.NoError(t, err)
+		require.Equal(t, JobRunning, job.Status)
+		require.Equal(t, "running: resolved=1623456789.123456789,0", job.RunningStatus)
+		require.Equal(t, time.Unix(0, 1623456789123456789).UTC(), job.HighWater)
+		require.False(t, job.Finished())
+	})
+
+	t.Run("returns a zero high water before the initial scan", func(t *testing.T) {
+		rows := sqlmock.NewRows(columns).AddRow("running", nil, nil, nil)
+		mock.ExpectQuery(query).WithArgs(42).WillReturnRows(rows)
+
+		job, err := GetChangefeedJob(context.Background(), db, 42)
+		require.NoError(t, err)
+		require.True(t, job.HighWater.IsZero())
+	})
+
+	t.Run("returns the error of a failed job", func(t *testing.T) {
+		rows := sqlmock.NewRows(columns).AddRow("failed", "kafka: client has run out of available brokers", nil, "0")
+		mock.ExpectQuery(query).WithArgs(42).WillReturnRows(rows)
+
+		job, err := GetChangefeedJob(context.Background(), db, 42)
+		require.NoError(t, err)
+		require.True(t, job.Finished())
+		require.Equal(t, "kafka: client has run out of available brokers", job.Error)
+		require.True(t, job.HighWater.IsZero())
+	})
+
+	require.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestControlJob(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	require.NoError(t, err)
+	defer db.Close()
+
+	mock.ExpectExec(regexp.QuoteMeta("PAUSE JOB $1")).WithArgs(42).WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectExec(regexp.QuoteMeta("RESUME JOB $1")).WithArgs(42).WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectExec(regexp.QuoteMeta("CANCEL JOB $1")).WithArgs(42).WillReturnResult(sqlmock.NewResult(0, 0))
+
+	ctx := context.Background()
+	require.NoError(t, PauseJob(ctx, db, 42))
+	require.NoError(t, ResumeJob(ctx, db, 42))
+	require.NoError(t, CancelJob(ctx, db, 42))
+	require.NoError(t, mock.ExpectationsWereMet())
+}
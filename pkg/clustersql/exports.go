@@ -0,0 +1,67 @@
+/*
+Copyright 2021 The Cockroach Authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    https://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package clustersql
+
+import (
+	"strings"
+
+	"github.com/jackc/pgx/v4"
+)
+
+// Export selects what an EXPORT statement writes, and in which format.
+type Export struct {
+	// Format is csv or parquet, csv when empty
+	Format string
+	// Table is the qualified name of the table to export, such as
+	// movr.public.rides
+	Table string
+	// Query is the SELECT statement whose results are exported, instead of a
+	// table
+	Query string
+}
+
+// ExportStatement returns the EXPORT statement writing the export into the
+// directory at uri. The statement is run by the cockroach sql client, which
+// cannot bind placeholders, so the URI is a string literal. The query is
+// parenthesized, so it cannot hold other statements.
+func ExportStatement(uri string, export Export) string {
+	format := "CSV"
+	if strings.EqualFold(export.Format, "parquet") {
+		format = "PARQUET"
+	}
+
+	from := "TABLE " + pgx.Identifier(strings.Split(export.Table, ".")).Sanitize()
+	if export.Query != "" {
+		from = "(" + strings.TrimSuffix(strings.TrimSpace(export.Query), ";") + ")"
+	}
+	return "EXPORT INTO " + format + " " + quoteLiteral(uri) + " FROM " + from
+}
+
+// URIWithPath returns uri with elem appended to its path, before its query
+// string.
+func URIWithPath(uri, elem string) string {
+	base, query := uri, ""
+	if i := strings.Index(uri, "?"); i >= 0 {
+		base, query = uri[:i], uri[i:]
+	}
+	return strings.TrimSuffix(base, "/") + "/" + strings.TrimPrefix(elem, "/") + query
+}
+
+// quoteLiteral quotes s as a SQL string literal.
+func quoteLiteral(s string) string {
+	return "'" + strings.ReplaceAll(s, "'", "''") + "'"
+}
@@ -0,0 +1,55 @@
+/*
+Copyright 2021 The Cockroach Authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    https://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package clustersql_test
+
+import (
+	"testing"
+
+	. "github.com/cockroachdb/cockroach-operator/pkg/clustersql"
+	"github.com/stretchr/testify/require"
+)
+
+func TestExportStatement(t *testing.T) {
+	uri := "s3://exports/rides?AWS_ACCESS_KEY_ID=id&AWS_SECRET_ACCESS_KEY=it's"
+	tests := []struct {
+		name     string
+		export   Export
+		expected string
+	}{
+		{
+			name:     "a table in CSV",
+			export:   Export{Table: "movr.public.rides"},
+			expected: `EXPORT INTO CSV 's3://exports/rides?AWS_ACCESS_KEY_ID=id&AWS_SECRET_ACCESS_KEY=it''s' FROM TABLE "movr"."public"."rides"`,
+		},
+		{
+			name:     "a query in Parquet",
+			export:   Export{Format: "parquet", Query: " SELECT city, count(*) FROM movr.rides GROUP BY city; "},
+			expected: `EXPORT INTO PARQUET 's3://exports/rides?AWS_ACCESS_KEY_ID=id&AWS_SECRET_ACCESS_KEY=it''s' FROM (SELECT city, count(*) FROM movr.rides GROUP BY city)`,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			require.Equal(t, tt.expected, ExportStatement(uri, tt.export))
+		})
+	}
+}
+
+func TestURIWithPath(t *testing.T) {
+	require.Equal(t, "s3://bucket/exports/2021/06/01-020000?AUTH=implicit", URIWithPath("s3://bucket/exports?AUTH=implicit", "2021/06/01-020000"))
+	require.Equal(t, "nodelocal://1/exports/2021/06/01-020000", URIWithPath("nodelocal://1/exports/", "/2021/06/01-020000"))
+}
@@ -0,0 +1,112 @@
+/*
+Copyright 2021 The Cockroach Authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    https://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package clustersql
+
+import (
+	"context"
+	"database/sql"
+	"strings"
+	"time"
+
+	"github.com/cockroachdb/errors"
+)
+
+// Node is a CockroachDB node of the cluster as seen by gossip.
+type Node struct {
+	ID      int
+	Address string
+	IsLive  bool
+	// Decommissioning is true for the nodes being removed from the cluster,
+	// and the nodes already removed.
+	Decommissioning bool
+	// LivenessUpdatedAt is when the liveness record of the node was last
+	// updated, which is about the last heartbeat of a node that is not live.
+	LivenessUpdatedAt time.Time
+}
+
+// Host returns the host of the address the node advertises. The operator
+// starts the nodes with the name of their pod as the first label of the host.
+func (n Node) Host() string {
+	if i := strings.LastIndex(n.Address, ":"); i >= 0 {
+		return n.Address[:i]
+	}
+	return n.Address
+}
+
+// PodName returns the name of the pod running the node.
+func (n Node) PodName() string {
+	return strings.SplitN(n.Host(), ".", 2)[0]
+}
+
+// Nodes returns the nodes of the cluster, including the dead ones.
+func Nodes(ctx context.Context, db *sql.DB) ([]Node, error) {
+	rows, err := db.QueryContext(ctx, `SELECT n.node_id, n.address, n.is_live, l.decommissioning, l.updated_at
+FROM crdb_internal.gossip_nodes n LEFT JOIN crdb_internal.gossip_liveness l ON l.node_id = n.node_id
+ORDER BY n.node_id`)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to select from crdb_internal.gossip_nodes")
+	}
+	defer rows.Close()
+
+	var nodes []Node
+	for rows.Next() {
+		var node Node
+		var decommissioning sql.NullBool
+		var updatedAt sql.NullTime
+		if err := rows.Scan(&node.ID, &node.Address, &node.IsLive, &decommissioning, &updatedAt); err != nil {
+			return nil, errors.Wrap(err, "failed to scan rows")
+		}
+		node.Decommissioning = decommissioning.Bool
+		node.LivenessUpdatedAt = updatedAt.Time
+		nodes = append(nodes, node)
+	}
+	return nodes, errors.Wrap(rows.Err(), "failed to read rows")
+}
+
+// TimeUntilStoreDead returns how long a node can be not live before it is
+// considered dead and its replicas are moved to other nodes.
+func TimeUntilStoreDead(ctx context.Context, db *sql.DB) (time.Duration, error) {
+	value, err := GetClusterSetting(ctx, db, "server.time_until_store_dead")
+	if err != nil {
+		return 0, err
+	}
+
+	d, err := time.ParseDuration(value)
+	if err != nil {
+		return 0, errors.Wrapf(err, "failed to parse server.time_until_store_dead %q", value)
+	}
+	return d, nil
+}
+
+// UnavailableNodes returns the IDs of the nodes that are not live: the dead
+// ones, not live for timeUntilStoreDead or longer, and the suspect ones, not
+// live for a shorter time. The decommissioning nodes are expected to stop and
+// are left out.
+func UnavailableNodes(nodes []Node, timeUntilStoreDead time.Duration, now time.Time) (dead, suspect []int) {
+	for _, n := range nodes {
+		if n.IsLive || n.Decommissioning {
+			continue
+		}
+
+		if n.LivenessUpdatedAt.IsZero() || now.Sub(n.LivenessUpdatedAt) >= timeUntilStoreDead {
+			dead = append(dead, n.ID)
+		} else {
+			suspect = append(suspect, n.ID)
+		}
+	}
+	return dead, suspect
+}
@@ -0,0 +1,93 @@
+/*
+Copyright 2021 The Cockroach Authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    https://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package clustersql_test
+
+import (
+	"context"
+	"regexp"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	. "github.com/cockroachdb/cockroach-operator/pkg/clustersql"
+	"github.com/cockroachdb/errors"
+	"github.com/stretchr/testify/require"
+)
+
+func TestNodes(t *testing.T) {
+	query := regexp.QuoteMeta("SELECT n.node_id, n.address, n.is_live, l.decommissioning, l.updated_at")
+	columns := []string{"node_id", "address", "is_live", "decommissioning", "updated_at"}
+	updatedAt := time.Date(2021, time.June, 2, 20, 30, 0, 0, time.UTC)
+
+	db, mock, err := sqlmock.New()
+	require.NoError(t, err)
+	defer db.Close()
+
+	t.Run("returns nodes from query results", func(t *testing.T) {
+		rows := sqlmock.NewRows(columns).
+			AddRow(1, "crdb-0.crdb.default:26257", true, false, updatedAt).
+			AddRow(2, "crdb-1.crdb.default:26257", false, true, updatedAt).
+			AddRow(3, "crdb-2.crdb.default:26257", false, nil, nil)
+		mock.ExpectQuery(query).WillReturnRows(rows).RowsWillBeClosed()
+
+		nodes, err := Nodes(context.Background(), db)
+		require.NoError(t, err)
+		require.Equal(t, []Node{
+			{ID: 1, Address: "crdb-0.crdb.default:26257", IsLive: true, LivenessUpdatedAt: updatedAt},
+			{ID: 2, Address: "crdb-1.crdb.default:26257", Decommissioning: true, LivenessUpdatedAt: updatedAt},
+			{ID: 3, Address: "crdb-2.crdb.default:26257"},
+		}, nodes)
+		require.Equal(t, "crdb-1.crdb.default", nodes[1].Host())
+		require.Equal(t, "crdb-1", nodes[1].PodName())
+	})
+
+	t.Run("returns error when query errors out", func(t *testing.T) {
+		mock.ExpectQuery(query).WillReturnError(errors.New("boom"))
+
+		nodes, err := Nodes(context.Background(), db)
+		require.Nil(t, nodes)
+		require.EqualError(t, errors.Cause(err), "boom")
+	})
+}
+
+func TestTimeUntilStoreDead(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	require.NoError(t, err)
+	defer db.Close()
+
+	rows := sqlmock.NewRows([]string{"server.time_until_store_dead"}).AddRow("5m0s")
+	mock.ExpectQuery("SHOW CLUSTER SETTING server.time_until_store_dead").WillReturnRows(rows)
+
+	d, err := TimeUntilStoreDead(context.Background(), db)
+	require.NoError(t, err)
+	require.Equal(t, 5*time.Minute, d)
+}
+
+func TestUnavailableNodes(t *testing.T) {
+	now := time.Date(2021, time.June, 2, 20, 30, 0, 0, time.UTC)
+	nodes := []Node{
+		{ID: 1, IsLive: true, LivenessUpdatedAt: now},
+		{ID: 2, LivenessUpdatedAt: now.Add(-10 * time.Minute)},
+		{ID: 3, LivenessUpdatedAt: now.Add(-time.Minute)},
+		{ID: 4, Decommissioning: true, LivenessUpdatedAt: now.Add(-time.Hour)},
+		{ID: 5},
+	}
+
+	dead, suspect := UnavailableNodes(nodes, 5*time.Minute, now)
+	require.Equal(t, []int{2, 5}, dead)
+	require.Equal(t, []int{3}, suspect)
+}
@@ -0,0 +1,199 @@
+/*
+Copyright 2021 The Cockroach Authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    https://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package clustersql
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"strings"
+
+	"github.com/cockroachdb/errors"
+	"github.com/jackc/pgx/v4"
+)
+
+// Survival goals of a multi-region database.
+const (
+	SurviveZoneFailure   = "zone"
+	SurviveRegionFailure = "region"
+)
+
+// DatabaseRegions is the multi-region configuration of a database. The primary
+// region is empty when the database is not multi-region.
+type DatabaseRegions struct {
+	PrimaryRegion string
+	// Regions are the regions of the database besides the primary region
+	Regions      []string
+	SurvivalGoal string
+}
+
+// ClusterRegions returns the regions of the nodes of the cluster, taken from
+// their localities.
+func ClusterRegions(ctx context.Context, db *sql.DB) ([]string, error) {
+	rows, err := db.QueryContext(ctx, "SELECT region FROM [SHOW REGIONS FROM CLUSTER]")
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to list the regions of the cluster")
+	}
+	defer rows.Close()
+
+	var regions []string
+	for rows.Next() {
+		var region string
+		if err := rows.Scan(&region); err != nil {
+			return nil, errors.Wrap(err, "failed to scan rows")
+		}
+		regions = append(regions, region)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, errors.Wrap(err, "failed to read rows")
+	}
+	return regions, nil
+}
+
+// RegionBuilds returns the build tags of the live nodes of the cluster, by the
+// region of their locality.
+func RegionBuilds(ctx context.Context, db *sql.DB) (map[string][]string, error) {
+	rows, err := db.QueryContext(ctx, "SELECT locality, build_tag FROM crdb_internal.gossip_nodes WHERE is_live")
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to select from crdb_internal.gossip_nodes")
+	}
+	defer rows.Close()
+
+	builds := map[string][]string{}
+	for rows.Next() {
+		var locality, tag string
+		if err := rows.Scan(&locality, &tag); err != nil {
+			return nil, errors.Wrap(err, "failed to scan rows")
+		}
+		region := LocalityRegion(locality)
+		builds[region] = append(builds[region], tag)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, errors.Wrap(err, "failed to read rows")
+	}
+	return builds, nil
+}
+
+// LocalityRegion returns the region tier of a locality such as
+// region=us-east1,zone=us-east1-b, empty when it has none.
+func LocalityRegion(locality string) string {
+	for _, tier := range strings.Split(locality, ",") {
+		if region := strings.TrimPrefix(tier, "region="); region != tier {
+			return region
+		}
+	}
+	return ""
+}
+
+// GetDatabaseRegions returns the multi-region configuration of database.
+func GetDatabaseRegions(ctx context.Context, db *sql.DB, database string) (DatabaseRegions, error) {
+	var primary, regions, goal sql.NullString
+	r := db.QueryRowContext(ctx,
+		"SELECT primary_region, array_to_string(regions, ','), survival_goal FROM [SHOW DATABASES] WHERE database_name = $1",
+		database)
+	if err := r.Scan(&primary, &regions, &goal); err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return DatabaseRegions{}, errors.Newf("database %s does not exist", database)
+		}
+		return DatabaseRegions{}, errors.Wrapf(err, "failed to get the regions of database %s", database)
+	}
+
+	current := DatabaseRegions{PrimaryRegion: primary.String, SurvivalGoal: goal.String}
+	if regions.String != "" {
+		for _, region := range strings.Split(regions.String, ",") {
+			if region != primary.String {
+				current.Regions = append(current.Regions, region)
+			}
+		}
+	}
+	return current, nil
+}
+
+// AlterDatabaseRegions runs the statements turning the configuration of
+// database from current into desired and returns them.
+func AlterDatabaseRegions(ctx context.Context, db *sql.DB, database string, current, desired DatabaseRegions) ([]string, error) {
+	statements := DatabaseRegionStatements(database, current, desired)
+	for _, statement := range statements {
+		if _, err := db.ExecContext(ctx, statement); err != nil {
+			return nil, errors.Wrapf(err, "failed to run %s", statement)
+		}
+	}
+	return statements, nil
+}
+
+// DatabaseRegionStatements returns the ALTER DATABASE statements turning the
+// configuration of database from current into desired. Regions are added
+// before the primary region moves to one of them, and the survival goal is
+// lowered before regions are dropped and raised after they are added, since
+// surviving the failure of a region takes 3 regions.
+func DatabaseRegionStatements(database string, current, desired DatabaseRegions) []string {
+	alter := func(format string, args ...interface{}) string {
+		return fmt.Sprintf("ALTER DATABASE %s ", quote(database)) + fmt.Sprintf(format, args...)
+	}
+
+	var statements []string
+	// the first region makes the database multi-region
+	if current.PrimaryRegion == "" {
+		statements = append(statements, alter("SET PRIMARY REGION %s", quote(desired.PrimaryRegion)))
+		current = DatabaseRegions{PrimaryRegion: desired.PrimaryRegion, SurvivalGoal: SurviveZoneFailure}
+	}
+
+	have := regionSet(current)
+	want := regionSet(desired)
+	for _, region := range append([]string{desired.PrimaryRegion}, desired.Regions...) {
+		if !have[region] {
+			statements = append(statements, alter("ADD REGION %s", quote(region)))
+			have[region] = true
+		}
+	}
+
+	if current.PrimaryRegion != desired.PrimaryRegion {
+		statements = append(statements, alter("SET PRIMARY REGION %s", quote(desired.PrimaryRegion)))
+	}
+
+	goal := desired.SurvivalGoal
+	if goal == "" {
+		goal = SurviveZoneFailure
+	}
+	if goal == SurviveZoneFailure && current.SurvivalGoal != SurviveZoneFailure {
+		statements = append(statements, alter("SURVIVE ZONE FAILURE"))
+	}
+
+	for _, region := range append([]string{current.PrimaryRegion}, current.Regions...) {
+		if !want[region] {
+			statements = append(statements, alter("DROP REGION %s", quote(region)))
+		}
+	}
+
+	if goal == SurviveRegionFailure && current.SurvivalGoal != SurviveRegionFailure {
+		statements = append(statements, alter("SURVIVE REGION FAILURE"))
+	}
+
+	return statements
+}
+
+func regionSet(r DatabaseRegions) map[string]bool {
+	set := map[string]bool{r.PrimaryRegion: true}
+	for _, region := range r.Regions {
+		set[region] = true
+	}
+	return set
+}
+
+func quote(identifier string) string {
+	return pgx.Identifier{identifier}.Sanitize()
+}
@@ -0,0 +1,140 @@
+/*
+Copyright 2021 The Cockroach Authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    https://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package clustersql_test
+
+import (
+	"context"
+	"regexp"
+	"testing"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	. "github.com/cockroachdb/cockroach-operator/pkg/clustersql"
+	"github.com/stretchr/testify/require"
+)
+
+func TestDatabaseRegionStatements(t *testing.T) {
+	tests := []struct {
+		name     string
+		current  DatabaseRegions
+		desired  DatabaseRegions
+		expected []string
+	}{
+		{
+			name:    "makes a database multi-region",
+			desired: DatabaseRegions{PrimaryRegion: "us-east1", Regions: []string{"us-west1", "europe-west1"}, SurvivalGoal: SurviveRegionFailure},
+			expected: []string{
+				`ALTER DATABASE "movr" SET PRIMARY REGION "us-east1"`,
+				`ALTER DATABASE "movr" ADD REGION "us-west1"`,
+				`ALTER DATABASE "movr" ADD REGION "europe-west1"`,
+				`ALTER DATABASE "movr" SURVIVE REGION FAILURE`,
+			},
+		},
+		{
+			name:    "nothing to do",
+			current: DatabaseRegions{PrimaryRegion: "us-east1", Regions: []string{"us-west1"}, SurvivalGoal: SurviveZoneFailure},
+			desired: DatabaseRegions{PrimaryRegion: "us-east1", Regions: []string{"us-west1"}},
+		},
+		{
+			name:    "moves the primary region to a new region",
+			current: DatabaseRegions{PrimaryRegion: "us-east1", Regions: []string{"us-west1"}, SurvivalGoal: SurviveZoneFailure},
+			desired: DatabaseRegions{PrimaryRegion: "europe-west1", Regions: []string{"us-west1"}},
+			expected: []string{
+				`ALTER DATABASE "movr" ADD REGION "europe-west1"`,
+				`ALTER DATABASE "movr" SET PRIMARY REGION "europe-west1"`,
+				`ALTER DATABASE "movr" DROP REGION "us-east1"`,
+			},
+		},
+		{
+			name:    "lowers the survival goal before dropping a region",
+			current: DatabaseRegions{PrimaryRegion: "us-east1", Regions: []string{"us-west1", "europe-west1"}, SurvivalGoal: SurviveRegionFailure},
+			desired: DatabaseRegions{PrimaryRegion: "us-east1", Regions: []string{"us-west1"}, SurvivalGoal: SurviveZoneFailure},
+			expected: []string{
+				`ALTER DATABASE "movr" SURVIVE ZONE FAILURE`,
+				`ALTER DATABASE "movr" DROP REGION "europe-west1"`,
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			require.Equal(t, tt.expected, DatabaseRegionStatements("movr", tt.current, tt.desired))
+		})
+	}
+}
+
+func TestGetDatabaseRegions(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	require.NoError(t, err)
+	defer db.Close()
+
+	query := regexp.QuoteMeta("SELECT primary_region, array_to_string(regions, ','), survival_goal FROM [SHOW DATABASES] WHERE database_name = $1")
+	columns := []string{"primary_region", "regions", "survival_goal"}
+
+	mock.ExpectQuery(query).WithArgs("movr").
+		WillReturnRows(sqlmock.NewRows(columns).AddRow("us-east1", "europe-west1,us-east1,us-west1", "region"))
+	regions, err := GetDatabaseRegions(context.Background(), db, "movr")
+	require.NoError(t, err)
+	require.Equal(t, DatabaseRegions{PrimaryRegion: "us-east1", Regions: []string{"europe-west1", "us-west1"}, SurvivalGoal: "region"}, regions)
+
+	mock.ExpectQuery(query).WithArgs("defaultdb").
+		WillReturnRows(sqlmock.NewRows(columns).AddRow(nil, "", nil))
+	regions, err = GetDatabaseRegions(context.Background(), db, "defaultdb")
+	require.NoError(t, err)
+	require.Equal(t, DatabaseRegions{}, regions)
+
+	mock.ExpectQuery(query).WithArgs("missing").WillReturnRows(sqlmock.NewRows(columns))
+	_, err = GetDatabaseRegions(context.Background(), db, "missing")
+	require.EqualError(t, err, "database missing does not exist")
+
+	require.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestClusterRegions(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	require.NoError(t, err)
+	defer db.Close()
+
+	mock.ExpectQuery(regexp.QuoteMeta("SELECT region FROM [SHOW REGIONS FROM CLUSTER]")).
+		WillReturnRows(sqlmock.NewRows([]string{"region"}).AddRow("us-east1").AddRow("us-west1"))
+
+	regions, err := ClusterRegions(context.Background(), db)
+	require.NoError(t, err)
+	require.Equal(t, []string{"us-east1", "us-west1"}, regions)
+	require.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestRegionBuilds(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	require.NoError(t, err)
+	defer db.Close()
+
+	mock.ExpectQuery(regexp.QuoteMeta("SELECT locality, build_tag FROM crdb_internal.gossip_nodes WHERE is_live")).
+		WillReturnRows(sqlmock.NewRows([]string{"locality", "build_tag"}).
+			AddRow("region=us-east1,zone=us-east1-b", "v21.1.0").
+			AddRow("region=us-east1,zone=us-east1-c", "v20.2.9").
+			AddRow("region=us-west1", "v21.1.0").
+			AddRow("zone=a", "v20.2.9"))
+
+	builds, err := RegionBuilds(context.Background(), db)
+	require.NoError(t, err)
+	require.Equal(t, map[string][]string{
+		"us-east1": {"v21.1.0", "v20.2.9"},
+		"us-west1": {"v21.1.0"},
+		"":         {"v20.2.9"},
+	}, builds)
+	require.NoError(t, mock.ExpectationsWereMet())
+}
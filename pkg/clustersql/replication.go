@@ -0,0 +1,128 @@
+/*
+Copyright 2021 The Cockroach Authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    https://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package clustersql
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"time"
+
+	"github.com/cockroachdb/errors"
+	"github.com/jackc/pgx/v4"
+)
+
+// Statuses of the replication streams.
+const (
+	// ReplicationReplicating is the status of a stream that replicates the
+	// changes of the primary cluster
+	ReplicationReplicating = "replicating"
+	// ReplicationReady is the status of a virtual cluster that was cut over,
+	// which can be started
+	ReplicationReady = "ready"
+)
+
+// defaultTargetClusterSetting is the cluster setting selecting the virtual
+// cluster the SQL connections that do not name one are routed to.
+const defaultTargetClusterSetting = "server.controller.default_target_cluster"
+
+// ReplicationStream is the physical replication stream of a virtual cluster of
+// a standby cluster.
+type ReplicationStream struct {
+	// VirtualCluster is the name of the virtual cluster replicated into
+	VirtualCluster string
+	// Status of the stream, such as replicating or replication paused
+	Status string
+	// ReplicatedTime is the time up to which the data of the primary cluster
+	// was replicated, zero until the initial scan is done
+	ReplicatedTime time.Time
+	// RetainedTime is the earliest time the virtual cluster can be cut over to,
+	// zero until the initial scan is done
+	RetainedTime time.Time
+}
+
+// Replicating returns whether the stream replicates the changes of the
+// primary cluster.
+func (s ReplicationStream) Replicating() bool {
+	return s.Status == ReplicationReplicating
+}
+
+// VirtualClusterExists returns whether the cluster has a virtual cluster with
+// the given name.
+func VirtualClusterExists(ctx context.Context, db *sql.DB, name string) (bool, error) {
+	var exists bool
+	r := db.QueryRowContext(ctx, "SELECT EXISTS (SELECT 1 FROM [SHOW VIRTUAL CLUSTERS] WHERE name = $1)", name)
+	if err := r.Scan(&exists); err != nil {
+		return false, errors.Wrapf(err, "failed to look up virtual cluster %s", name)
+	}
+	return exists, nil
+}
+
+// StartReplication creates the virtual cluster name of the standby cluster as
+// the replica of the virtual cluster source of the primary cluster at uri.
+func StartReplication(ctx context.Context, db *sql.DB, name, source, uri string) error {
+	stmt := fmt.Sprintf("CREATE VIRTUAL CLUSTER %s FROM REPLICATION OF %s ON $1",
+		pgx.Identifier{name}.Sanitize(), pgx.Identifier{source}.Sanitize())
+	if _, err := db.ExecContext(ctx, stmt, uri); err != nil {
+		return errors.Wrapf(err, "failed to start the replication of virtual cluster %s of %s", source, RedactURI(uri))
+	}
+	return nil
+}
+
+// GetReplicationStream returns the replication stream of the virtual cluster
+// with the given name.
+func GetReplicationStream(ctx context.Context, db *sql.DB, name string) (ReplicationStream, error) {
+	stream := ReplicationStream{VirtualCluster: name}
+	var status sql.NullString
+	var replicated, retained sql.NullTime
+	r := db.QueryRowContext(ctx, "SELECT status, replicated_time, retained_time FROM [SHOW VIRTUAL CLUSTER "+
+		pgx.Identifier{name}.Sanitize()+" WITH REPLICATION STATUS]")
+	if err := r.Scan(&status, &replicated, &retained); err != nil {
+		return ReplicationStream{}, errors.Wrapf(err, "failed to get the replication status of virtual cluster %s", name)
+	}
+
+	stream.Status = status.String
+	if replicated.Valid {
+		stream.ReplicatedTime = replicated.Time.UTC()
+	}
+	if retained.Valid {
+		stream.RetainedTime = retained.Time.UTC()
+	}
+	return stream, nil
+}
+
+// CompleteReplication cuts the virtual cluster over to the latest replicated
+// time, which stops its replication stream. The virtual cluster is ready once
+// the cutover is done.
+func CompleteReplication(ctx context.Context, db *sql.DB, name string) error {
+	stmt := "ALTER VIRTUAL CLUSTER " + pgx.Identifier{name}.Sanitize() + " COMPLETE REPLICATION TO LATEST"
+	if _, err := db.ExecContext(ctx, stmt); err != nil {
+		return errors.Wrapf(err, "failed to complete the replication of virtual cluster %s", name)
+	}
+	return nil
+}
+
+// ActivateVirtualCluster starts the SQL service of the virtual cluster on every
+// node, and routes the SQL connections that do not name a virtual cluster to
+// it.
+func ActivateVirtualCluster(ctx context.Context, db *sql.DB, name string) error {
+	stmt := "ALTER VIRTUAL CLUSTER " + pgx.Identifier{name}.Sanitize() + " START SERVICE SHARED"
+	if _, err := db.ExecContext(ctx, stmt); err != nil {
+		return errors.Wrapf(err, "failed to start virtual cluster %s", name)
+	}
+	return SetClusterSetting(ctx, db, defaultTargetClusterSetting, name)
+}
@@ -0,0 +1,115 @@
+/*
+Copyright 2021 The Cockroach Authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    https://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package clustersql
+
+import (
+	"context"
+	"database/sql"
+	"time"
+
+	"github.com/cockroachdb/errors"
+)
+
+// scheduledBackupJobs selects the BACKUP jobs started by the schedules with
+// the label $1.
+const scheduledBackupJobs = `FROM crdb_internal.jobs
+WHERE job_type = 'BACKUP' AND created_by_type = 'crdb_schedule'
+AND created_by_id IN (SELECT id FROM [SHOW SCHEDULES] WHERE label = $1)`
+
+// ScheduledBackups are the outcomes of the last backups taken by schedules.
+type ScheduledBackups struct {
+	// LastSucceeded is when the last successful backup finished, zero if none
+	// did
+	LastSucceeded time.Time
+	// LastFailed is when the last failed backup finished, zero if none did
+	LastFailed time.Time
+	// LastError is the error of the last failed backup
+	LastError string
+}
+
+// CreateBackupSchedules creates the schedules of the full backups of the
+// cluster into the collection at uri, and of the incremental backups in
+// between, and returns their IDs. Without an incremental crontab every backup
+// is a full backup. The first backup starts right away.
+func CreateBackupSchedules(ctx context.Context, db *sql.DB, label, uri, full, incremental string) ([]int64, error) {
+	stmt := "CREATE SCHEDULE $1 FOR BACKUP INTO $2 RECURRING $3 FULL BACKUP ALWAYS WITH SCHEDULE OPTIONS first_run = 'now'"
+	args := []interface{}{label, uri, full}
+	if incremental != "" {
+		stmt = "CREATE SCHEDULE $1 FOR BACKUP INTO $2 RECURRING $3 FULL BACKUP $4 WITH SCHEDULE OPTIONS first_run = 'now'"
+		args = []interface{}{label, uri, incremental, full}
+	}
+
+	rows, err := db.QueryContext(ctx, stmt, args...)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to create backup schedules")
+	}
+	defer rows.Close()
+
+	columns, err := rows.Columns()
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to read columns")
+	}
+
+	// only the schedule_id column is kept
+	var ids []int64
+	for rows.Next() {
+		var id int64
+		dest := []interface{}{&id}
+		for range columns[1:] {
+			dest = append(dest, new(sql.RawBytes))
+		}
+		if err := rows.Scan(dest...); err != nil {
+			return nil, errors.Wrap(err, "failed to scan rows")
+		}
+		ids = append(ids, id)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, errors.Wrap(err, "failed to read rows")
+	}
+	return ids, nil
+}
+
+// DropSchedules drops the schedules with the label. Their running jobs are
+// left to finish.
+func DropSchedules(ctx context.Context, db *sql.DB, label string) error {
+	_, err := db.ExecContext(ctx, "DROP SCHEDULES SELECT id FROM [SHOW SCHEDULES] WHERE label = $1", label)
+	return errors.Wrap(err, "failed to drop schedules")
+}
+
+// LastScheduledBackups returns the outcomes of the last backups taken by the
+// schedules with the label.
+func LastScheduledBackups(ctx context.Context, db *sql.DB, label string) (ScheduledBackups, error) {
+	var backups ScheduledBackups
+
+	var succeeded sql.NullTime
+	r := db.QueryRowContext(ctx, "SELECT max(finished) "+scheduledBackupJobs+" AND status = 'succeeded'", label)
+	if err := r.Scan(&succeeded); err != nil {
+		return backups, errors.Wrap(err, "failed to get the last successful backup")
+	}
+	backups.LastSucceeded = succeeded.Time
+
+	var failed sql.NullTime
+	var jobErr sql.NullString
+	r = db.QueryRowContext(ctx, "SELECT finished, error "+scheduledBackupJobs+" AND status = 'failed' ORDER BY finished DESC LIMIT 1", label)
+	if err := r.Scan(&failed, &jobErr); err != nil && !errors.Is(err, sql.ErrNoRows) {
+		return backups, errors.Wrap(err, "failed to get the last failed backup")
+	}
+	backups.LastFailed = failed.Time
+	backups.LastError = jobErr.String
+
+	return backups, nil
+}
@@ -0,0 +1,113 @@
+/*
+Copyright 2021 The Cockroach Authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    https://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package clustersql_test
+
+import (
+	"context"
+	"database/sql"
+	"regexp"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	. "github.com/cockroachdb/cockroach-operator/pkg/clustersql"
+	"github.com/stretchr/testify/require"
+)
+
+const label = "crdbbackup/nightly"
+
+func TestCreateBackupSchedules(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	require.NoError(t, err)
+	defer db.Close()
+
+	columns := []string{"schedule_id", "label", "status", "first_run", "schedule", "backup_stmt"}
+
+	t.Run("full and incremental backups", func(t *testing.T) {
+		mock.ExpectQuery(regexp.QuoteMeta("CREATE SCHEDULE $1 FOR BACKUP INTO $2 RECURRING $3 FULL BACKUP $4 WITH SCHEDULE OPTIONS first_run = 'now'")).
+			WithArgs(label, collection, "@hourly", "@daily").
+			WillReturnRows(sqlmock.NewRows(columns).
+				AddRow(1, label, "ACTIVE", "2021-06-02 20:30:00", "@daily", "BACKUP INTO ...").
+				AddRow(2, label, "PAUSED", nil, "@hourly", "BACKUP INTO LATEST IN ..."))
+
+		ids, err := CreateBackupSchedules(context.Background(), db, label, collection, "@daily", "@hourly")
+		require.NoError(t, err)
+		require.Equal(t, []int64{1, 2}, ids)
+	})
+
+	t.Run("full backups only", func(t *testing.T) {
+		mock.ExpectQuery(regexp.QuoteMeta("CREATE SCHEDULE $1 FOR BACKUP INTO $2 RECURRING $3 FULL BACKUP ALWAYS WITH SCHEDULE OPTIONS first_run = 'now'")).
+			WithArgs(label, collection, "@daily").
+			WillReturnRows(sqlmock.NewRows(columns).AddRow(3, label, "ACTIVE", "2021-06-02 20:30:00", "@daily", "BACKUP INTO ..."))
+
+		ids, err := CreateBackupSchedules(context.Background(), db, label, collection, "@daily", "")
+		require.NoError(t, err)
+		require.Equal(t, []int64{3}, ids)
+	})
+
+	require.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestDropSchedules(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	require.NoError(t, err)
+	defer db.Close()
+
+	mock.ExpectExec(regexp.QuoteMeta("DROP SCHEDULES SELECT id FROM [SHOW SCHEDULES] WHERE label = $1")).
+		WithArgs(label).
+		WillReturnResult(sqlmock.NewResult(0, 2))
+
+	require.NoError(t, DropSchedules(context.Background(), db, label))
+	require.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestLastScheduledBackups(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	require.NoError(t, err)
+	defer db.Close()
+
+	succeeded := time.Date(2021, time.June, 2, 1, 0, 0, 0, time.UTC)
+	failed := time.Date(2021, time.June, 2, 2, 0, 0, 0, time.UTC)
+
+	t.Run("returns the last successful and failed backups", func(t *testing.T) {
+		mock.ExpectQuery("SELECT max\\(finished\\) FROM crdb_internal.jobs .* AND status = 'succeeded'").
+			WithArgs(label).
+			WillReturnRows(sqlmock.NewRows([]string{"max"}).AddRow(succeeded))
+		mock.ExpectQuery("SELECT finished, error FROM crdb_internal.jobs .* AND status = 'failed' ORDER BY finished DESC LIMIT 1").
+			WithArgs(label).
+			WillReturnRows(sqlmock.NewRows([]string{"finished", "error"}).AddRow(failed, "access denied"))
+
+		backups, err := LastScheduledBackups(context.Background(), db, label)
+		require.NoError(t, err)
+		require.Equal(t, ScheduledBackups{LastSucceeded: succeeded, LastFailed: failed, LastError: "access denied"}, backups)
+	})
+
+	t.Run("no backup finished yet", func(t *testing.T) {
+		mock.ExpectQuery("SELECT max\\(finished\\)").
+			WithArgs(label).
+			WillReturnRows(sqlmock.NewRows([]string{"max"}).AddRow(nil))
+		mock.ExpectQuery("SELECT finished, error").
+			WithArgs(label).
+			WillReturnError(sql.ErrNoRows)
+
+		backups, err := LastScheduledBackups(context.Background(), db, label)
+		require.NoError(t, err)
+		require.Equal(t, ScheduledBackups{}, backups)
+	})
+
+	require.NoError(t, mock.ExpectationsWereMet())
+}
@@ -0,0 +1,33 @@
+/*
+Copyright 2021 The Cockroach Authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    https://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package clustersql
+
+import (
+	"context"
+	"database/sql"
+
+	"github.com/cockroachdb/errors"
+)
+
+// RunningSchemaChanges returns the number of schema changes of the cluster
+// that are not finished: running, waiting to run or being reverted.
+func RunningSchemaChanges(ctx context.Context, db *sql.DB) (int64, error) {
+	var count int64
+	err := db.QueryRowContext(ctx, `SELECT count(*) FROM crdb_internal.jobs
+WHERE job_type IN ('SCHEMA CHANGE', 'NEW SCHEMA CHANGE') AND status IN ('running', 'pending', 'reverting')`).Scan(&count)
+	return count, errors.Wrap(err, "failed to count the schema changes in crdb_internal.jobs")
+}
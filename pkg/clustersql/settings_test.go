@@ -89,6 +89,34 @@ func TestSetClusterSetting(t *testing.T) {
 	})
 }
 
+func TestResetClusterSetting(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	require.NoError(t, err)
+	defer db.Close()
+
+	t.Run("returns no error when resetting value", func(t *testing.T) {
+		mock.
+			ExpectExec("RESET CLUSTER SETTING bogus_setting").
+			WillReturnResult(sqlmock.NewResult(0, 0))
+
+		require.NoError(t, ResetClusterSetting(context.Background(), db, "bogus_setting"))
+	})
+
+	t.Run("returns error with an invalid setting name", func(t *testing.T) {
+		err := ResetClusterSetting(context.Background(), db, "!not#valid$")
+		require.Equal(t, ErrInvalidClusterSettingName, errors.Cause(err))
+	})
+
+	t.Run("returns error when exec fails", func(t *testing.T) {
+		mock.
+			ExpectExec("RESET CLUSTER SETTING bogus_setting").
+			WillReturnError(errors.New("boom"))
+
+		err := ResetClusterSetting(context.Background(), db, "bogus_setting")
+		require.EqualError(t, errors.Cause(err), "boom")
+	})
+}
+
 func TestRangeMoveDuration(t *testing.T) {
 	db, mock, err := sqlmock.New()
 	require.NoError(t, err)
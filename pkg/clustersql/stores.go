@@ -0,0 +1,93 @@
+/*
+Copyright 2021 The Cockroach Authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    https://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package clustersql
+
+import (
+	"context"
+	"database/sql"
+
+	"github.com/cockroachdb/errors"
+)
+
+// Store is the capacity of a store of the cluster, in bytes.
+type Store struct {
+	NodeID    int
+	StoreID   int
+	Capacity  int64
+	Available int64
+	Used      int64
+}
+
+// UsedPercent returns the percentage of the capacity of the store that is not
+// available, whether it is used by CockroachDB or by other files.
+func (s Store) UsedPercent() float64 {
+	if s.Capacity <= 0 {
+		return 0
+	}
+	return float64(s.Capacity-s.Available) * 100 / float64(s.Capacity)
+}
+
+// Stores returns the capacity of the stores of the cluster, as reported by the
+// status of the nodes.
+func Stores(ctx context.Context, db *sql.DB) ([]Store, error) {
+	rows, err := db.QueryContext(ctx, `SELECT node_id, store_id, capacity, available, used FROM crdb_internal.kv_store_status ORDER BY store_id`)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to select from crdb_internal.kv_store_status")
+	}
+	defer rows.Close()
+
+	var stores []Store
+	for rows.Next() {
+		var store Store
+		if err := rows.Scan(&store.NodeID, &store.StoreID, &store.Capacity, &store.Available, &store.Used); err != nil {
+			return nil, errors.Wrap(err, "failed to scan rows")
+		}
+		stores = append(stores, store)
+	}
+	return stores, errors.Wrap(rows.Err(), "failed to read rows")
+}
+
+// Replication is the number of ranges of the cluster that are not fully
+// replicated.
+type Replication struct {
+	// UnderReplicated ranges have fewer replicas than their replication factor
+	UnderReplicated int64
+	// Unavailable ranges have lost the quorum of their replicas
+	Unavailable int64
+}
+
+// FullyReplicated returns whether every range has all of its replicas.
+func (r Replication) FullyReplicated() bool {
+	return r.UnderReplicated == 0 && r.Unavailable == 0
+}
+
+// ReplicationStatus returns the number of under-replicated and unavailable
+// ranges of the cluster, from the metrics of the stores.
+func ReplicationStatus(ctx context.Context, db *sql.DB) (Replication, error) {
+	var r Replication
+	err := db.QueryRowContext(ctx, `SELECT COALESCE(sum((metrics->>'ranges.underreplicated')::INT8), 0),
+COALESCE(sum((metrics->>'ranges.unavailable')::INT8), 0) FROM crdb_internal.kv_store_status`).Scan(&r.UnderReplicated, &r.Unavailable)
+	return r, errors.Wrap(err, "failed to select the range metrics from crdb_internal.kv_store_status")
+}
+
+// NodeReplicas returns the number of replicas on the stores of the node, which
+// drops to zero once a decommissioning node has moved all of them away.
+func NodeReplicas(ctx context.Context, db *sql.DB, nodeID int) (int64, error) {
+	var replicas int64
+	err := db.QueryRowContext(ctx, `SELECT COALESCE(sum(range_count), 0) FROM crdb_internal.kv_store_status WHERE node_id = $1`, nodeID).Scan(&replicas)
+	return replicas, errors.Wrapf(err, "failed to select the replicas of node %d from crdb_internal.kv_store_status", nodeID)
+}
@@ -0,0 +1,107 @@
+/*
+Copyright 2021 The Cockroach Authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    https://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package clustersql_test
+
+import (
+	"context"
+	"regexp"
+	"testing"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	. "github.com/cockroachdb/cockroach-operator/pkg/clustersql"
+	"github.com/cockroachdb/errors"
+	"github.com/stretchr/testify/require"
+)
+
+func TestStores(t *testing.T) {
+	query := "SELECT node_id, store_id, capacity, available, used FROM crdb_internal.kv_store_status"
+
+	db, mock, err := sqlmock.New()
+	require.NoError(t, err)
+	defer db.Close()
+
+	t.Run("returns stores from query results", func(t *testing.T) {
+		rows := sqlmock.NewRows([]string{"node_id", "store_id", "capacity", "available", "used"}).
+			AddRow(1, 1, 1000, 250, 600).
+			AddRow(2, 2, 1000, 1000, 0)
+		mock.ExpectQuery(query).WillReturnRows(rows).RowsWillBeClosed()
+
+		stores, err := Stores(context.Background(), db)
+		require.NoError(t, err)
+		require.Equal(t, []Store{
+			{NodeID: 1, StoreID: 1, Capacity: 1000, Available: 250, Used: 600},
+			{NodeID: 2, StoreID: 2, Capacity: 1000, Available: 1000},
+		}, stores)
+		require.Equal(t, 75.0, stores[0].UsedPercent())
+		require.Equal(t, 0.0, stores[1].UsedPercent())
+	})
+
+	t.Run("returns error when query errors out", func(t *testing.T) {
+		mock.ExpectQuery(query).WillReturnError(errors.New("boom"))
+
+		stores, err := Stores(context.Background(), db)
+		require.Nil(t, stores)
+		require.EqualError(t, errors.Cause(err), "boom")
+	})
+}
+
+func TestReplicationStatus(t *testing.T) {
+	query := regexp.QuoteMeta("SELECT COALESCE(sum((metrics->>'ranges.underreplicated')::INT8), 0)")
+
+	db, mock, err := sqlmock.New()
+	require.NoError(t, err)
+	defer db.Close()
+
+	t.Run("returns the ranges that are not fully replicated", func(t *testing.T) {
+		mock.ExpectQuery(query).WillReturnRows(sqlmock.NewRows([]string{"underreplicated", "unavailable"}).AddRow(3, 0))
+
+		r, err := ReplicationStatus(context.Background(), db)
+		require.NoError(t, err)
+		require.Equal(t, Replication{UnderReplicated: 3}, r)
+		require.False(t, r.FullyReplicated())
+	})
+
+	t.Run("returns error when query errors out", func(t *testing.T) {
+		mock.ExpectQuery(query).WillReturnError(errors.New("boom"))
+
+		_, err := ReplicationStatus(context.Background(), db)
+		require.EqualError(t, errors.Cause(err), "boom")
+	})
+}
+
+func TestNodeReplicas(t *testing.T) {
+	query := regexp.QuoteMeta("SELECT COALESCE(sum(range_count), 0) FROM crdb_internal.kv_store_status WHERE node_id = $1")
+
+	db, mock, err := sqlmock.New()
+	require.NoError(t, err)
+	defer db.Close()
+
+	t.Run("returns the replicas of the node", func(t *testing.T) {
+		mock.ExpectQuery(query).WithArgs(3).WillReturnRows(sqlmock.NewRows([]string{"sum"}).AddRow(12))
+
+		replicas, err := NodeReplicas(context.Background(), db, 3)
+		require.NoError(t, err)
+		require.Equal(t, int64(12), replicas)
+	})
+
+	t.Run("returns error when query errors out", func(t *testing.T) {
+		mock.ExpectQuery(query).WithArgs(3).WillReturnError(errors.New("boom"))
+
+		_, err := NodeReplicas(context.Background(), db, 3)
+		require.EqualError(t, errors.Cause(err), "boom")
+	})
+}
@@ -19,6 +19,7 @@ package clustersql
 import (
 	"context"
 	"database/sql"
+	"strings"
 
 	"github.com/cockroachdb/errors"
 	"gopkg.in/yaml.v2"
@@ -71,3 +72,29 @@ func ZoneConfigs(ctx context.Context, db *sql.DB) ([]Zone, error) {
 	}
 	return zones, nil
 }
+
+// systemRanges are the ranges CockroachDB replicates 5 times by default. It
+// replicates them fewer times on smaller clusters, so they do not limit the
+// number of nodes.
+var systemRanges = map[string]bool{
+	"RANGE meta":     true,
+	"RANGE liveness": true,
+	"RANGE system":   true,
+}
+
+// MaxReplicationFactor returns the largest replication factor of the zones and
+// the target of the zone it is set on. The system ranges and the zones of the
+// system database are left out.
+func MaxReplicationFactor(zones []Zone) (uint, string) {
+	var max uint
+	var target string
+	for _, zone := range zones {
+		if systemRanges[zone.Target] || zone.Target == "DATABASE system" || strings.HasPrefix(zone.Target, "TABLE system.") {
+			continue
+		}
+		if zone.Config.Replicas > max {
+			max, target = zone.Config.Replicas, zone.Target
+		}
+	}
+	return max, target
+}
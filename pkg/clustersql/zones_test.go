@@ -88,3 +88,32 @@ func TestZoneConfigs(t *testing.T) {
 		require.Contains(t, err.Error(), "sql: Scan error on column index 1")
 	})
 }
+
+func TestMaxReplicationFactor(t *testing.T) {
+	zone := func(target string, replicas uint) Zone {
+		return Zone{Target: target, Config: ZoneConfig{Replicas: replicas}}
+	}
+
+	replicas, target := MaxReplicationFactor([]Zone{
+		zone("RANGE default", 3),
+		zone("RANGE meta", 5),
+		zone("RANGE liveness", 5),
+		zone("DATABASE system", 5),
+		zone("TABLE system.public.jobs", 5),
+		zone("TABLE movr.public.rides", 5),
+		zone("DATABASE movr", 4),
+	})
+	require.Equal(t, uint(5), replicas)
+	require.Equal(t, "TABLE movr.public.rides", target)
+
+	replicas, target = MaxReplicationFactor([]Zone{
+		zone("RANGE default", 3),
+		zone("RANGE system", 5),
+	})
+	require.Equal(t, uint(3), replicas)
+	require.Equal(t, "RANGE default", target)
+
+	replicas, target = MaxReplicationFactor(nil)
+	require.Zero(t, replicas)
+	require.Empty(t, target)
+}
@@ -31,23 +31,37 @@ func SetClusterStatusOnFirstReconcile(status *api.CrdbClusterStatus) {
 	status.ClusterStatus = api.ActionStatus(api.Starting).String()
 }
 
+// SetClusterStatus sets the status of the cluster from the status of its
+// actions: Failed if any action failed, then Retrying, Unknown and Finished.
 func SetClusterStatus(status *api.CrdbClusterStatus) {
 	InitOperatorActionsIfNeeded(status, metav1.Now())
-	for _, a := range status.OperatorActions {
-		if a.Status == api.ActionStatus(api.Failed).String() {
-			status.ClusterStatus = api.ActionStatus(api.Failed).String()
-			return
+	for _, s := range []api.ActionStatus{api.Failed, api.Retrying, api.Unknown} {
+		for _, a := range status.OperatorActions {
+			if a.Status == s.String() {
+				status.ClusterStatus = s.String()
+				return
+			}
 		}
+	}
+	status.ClusterStatus = api.ActionStatus(api.Finished).String()
+}
 
-		if a.Status == api.ActionStatus(api.Unknown).String() {
-			status.ClusterStatus = api.ActionStatus(api.Unknown).String()
-			return
+// ClearFailures removes the failed and retrying actions and updates the status
+// of the cluster. It returns whether any action was removed.
+func ClearFailures(status *api.CrdbClusterStatus) bool {
+	var actions []api.ClusterAction
+	for _, a := range status.OperatorActions {
+		if a.Status != api.ActionStatus(api.Failed).String() && a.Status != api.ActionStatus(api.Retrying).String() {
+			actions = append(actions, a)
 		}
-
-		status.ClusterStatus = api.ActionStatus(api.Finished).String()
-		return
 	}
-	status.ClusterStatus = api.ActionStatus(api.Finished).String()
+	if len(actions) == len(status.OperatorActions) {
+		return false
+	}
+
+	status.OperatorActions = actions
+	SetClusterStatus(status)
+	return true
 }
 
 func InitOperatorActionsIfNeeded(status *api.CrdbClusterStatus, now metav1.Time) {
@@ -74,6 +88,26 @@ func Failed(atype api.ActionType, actions []api.ClusterAction) bool {
 	return actions[pos].Status == api.ActionStatus(api.Failed).String()
 }
 
+func Retrying(atype api.ActionType, actions []api.ClusterAction) bool {
+	pos := pos(atype, actions)
+	if pos == -1 {
+		return false
+	}
+
+	return actions[pos].Status == api.ActionStatus(api.Retrying).String()
+}
+
+// Retries returns the number of times the action was retried since it failed
+// for the given reason.
+func Retries(atype api.ActionType, reason api.FailureReason, actions []api.ClusterAction) int32 {
+	pos := pos(atype, actions)
+	if pos == -1 || actions[pos].Reason != reason {
+		return 0
+	}
+
+	return actions[pos].Retries
+}
+
 func Unknown(atype api.ActionType, actions []api.ClusterAction) bool {
 	pos := pos(atype, actions)
 	if pos == -1 {
@@ -85,9 +119,34 @@ func Unknown(atype api.ActionType, actions []api.ClusterAction) bool {
 
 func SetActionFailed(atype api.ActionType, message string, status *api.CrdbClusterStatus) {
 	setActionStatus(atype, api.Failed, status, metav1.Now(), message)
+	action := findOrCreate(atype, status, message)
+	action.Reason = ""
+	action.Retries = 0
 	status.ClusterStatus = api.ActionStatus(api.Failed).String()
 }
 
+// SetActionFailedWithReason marks the action as failed for good, with the
+// reason of the failure.
+func SetActionFailedWithReason(atype api.ActionType, reason api.FailureReason, message string, status *api.CrdbClusterStatus) {
+	setActionStatus(atype, api.Failed, status, metav1.Now(), message)
+	action := findOrCreate(atype, status, message)
+	action.Reason = reason
+	status.ClusterStatus = api.ActionStatus(api.Failed).String()
+}
+
+// SetActionRetrying marks the action as failed for the given reason and about
+// to be retried. The retries are counted from the first failure for the reason.
+func SetActionRetrying(atype api.ActionType, reason api.FailureReason, message string, status *api.CrdbClusterStatus) {
+	action := findOrCreate(atype, status, message)
+	if action.Reason != reason {
+		action.Retries = 0
+	}
+	setActionStatus(atype, api.Retrying, status, metav1.Now(), message)
+	action.Reason = reason
+	action.Retries++
+	status.ClusterStatus = api.ActionStatus(api.Retrying).String()
+}
+
 //ResetActionType will delete the actiontype from the slice of operation action
 //this is used to reset if previously an error was thrown and now the action is ok
 //TO DO: each action has it's own states to follow on status
@@ -99,6 +158,9 @@ func ResetActionType(atype api.ActionType, status *api.CrdbClusterStatus) {
 }
 func SetActionFinished(atype api.ActionType, status *api.CrdbClusterStatus) {
 	setActionStatus(atype, api.Finished, status, metav1.Now(), "")
+	action := findOrCreate(atype, status, "")
+	action.Reason = ""
+	action.Retries = 0
 }
 
 func SetActionUnknown(atype api.ActionType, status *api.CrdbClusterStatus) {
@@ -34,3 +34,47 @@ func TestSetClusterStatusOnFirstReconcile(t *testing.T) {
 	assert.ElementsMatch(t, expectedActions, status.OperatorActions)
 	assert.Equal(t, expectedClusterStatus, status.ClusterStatus)
 }
+
+func TestSetActionRetrying(t *testing.T) {
+	status := api.CrdbClusterStatus{}
+
+	SetActionRetrying(api.DecommissionAction, api.DecommissionStalledReason, "stalled", &status)
+	SetActionRetrying(api.DecommissionAction, api.DecommissionStalledReason, "stalled", &status)
+	assert.True(t, Retrying(api.DecommissionAction, status.OperatorActions))
+	assert.Equal(t, int32(2), Retries(api.DecommissionAction, api.DecommissionStalledReason, status.OperatorActions))
+	assert.Equal(t, api.ActionStatus(api.Retrying).String(), status.ClusterStatus)
+
+	// the retries of another reason are counted from the start
+	SetActionRetrying(api.DecommissionAction, api.ImagePullBackOffReason, "cannot pull image", &status)
+	assert.Equal(t, int32(1), Retries(api.DecommissionAction, api.ImagePullBackOffReason, status.OperatorActions))
+	assert.Equal(t, int32(0), Retries(api.DecommissionAction, api.DecommissionStalledReason, status.OperatorActions))
+
+	SetActionFailedWithReason(api.DecommissionAction, api.ImagePullBackOffReason, "cannot pull image", &status)
+	assert.True(t, Failed(api.DecommissionAction, status.OperatorActions))
+	assert.Equal(t, api.ImagePullBackOffReason, status.OperatorActions[0].Reason)
+
+	SetActionFinished(api.DecommissionAction, &status)
+	assert.Equal(t, api.ClusterAction{
+		Type:               api.DecommissionAction,
+		Status:             api.ActionStatus(api.Finished).String(),
+		LastTransitionTime: status.OperatorActions[0].LastTransitionTime,
+	}, status.OperatorActions[0])
+}
+
+func TestSetClusterStatus(t *testing.T) {
+	status := api.CrdbClusterStatus{
+		OperatorActions: []api.ClusterAction{
+			{Type: api.DeployAction, Status: api.ActionStatus(api.Finished).String()},
+			{Type: api.DecommissionAction, Status: api.ActionStatus(api.Retrying).String()},
+			{Type: api.VersionCheckerAction, Status: api.ActionStatus(api.Failed).String()},
+		},
+	}
+
+	SetClusterStatus(&status)
+	assert.Equal(t, api.ActionStatus(api.Failed).String(), status.ClusterStatus)
+
+	assert.True(t, ClearFailures(&status))
+	assert.Equal(t, api.ActionStatus(api.Finished).String(), status.ClusterStatus)
+	assert.Len(t, status.OperatorActions, 1)
+	assert.False(t, ClearFailures(&status))
+}
@@ -68,6 +68,23 @@ func SetTrue(ctype api.ClusterConditionType, status *api.CrdbClusterStatus, now
 	setStatus(ctype, metav1.ConditionTrue, status, now)
 }
 
+// Set sets the status of the condition along with the reason and the message
+// explaining it. The transition time only changes with the status.
+func Set(ctype api.ClusterConditionType, status metav1.ConditionStatus, reason, message string, clusterStatus *api.CrdbClusterStatus, now metav1.Time) {
+	setStatus(ctype, status, clusterStatus, now)
+
+	cond := findOrCreate(ctype, clusterStatus)
+	cond.Reason = reason
+	cond.Message = message
+}
+
+// Remove deletes the condition from the status, if it is set.
+func Remove(ctype api.ClusterConditionType, status *api.CrdbClusterStatus) {
+	if pos := pos(ctype, status.Conditions); pos >= 0 {
+		status.Conditions = append(status.Conditions[:pos], status.Conditions[pos+1:]...)
+	}
+}
+
 func setStatus(ctype api.ClusterConditionType, status metav1.ConditionStatus, clusterStatus *api.CrdbClusterStatus, now metav1.Time) {
 	cond := findOrCreate(ctype, clusterStatus)
 
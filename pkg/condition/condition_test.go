@@ -18,6 +18,7 @@ package condition
 
 import (
 	"testing"
+	"time"
 
 	api "github.com/cockroachdb/cockroach-operator/apis/v1alpha1"
 	"github.com/stretchr/testify/assert"
@@ -46,3 +47,44 @@ func TestInitializesForEmptyConditions(t *testing.T) {
 
 	assert.ElementsMatch(t, expected, status.Conditions)
 }
+
+func TestSetWithReason(t *testing.T) {
+	before := metav1.NewTime(metav1.Now().Add(-time.Hour))
+	now := metav1.Now()
+
+	status := api.CrdbClusterStatus{}
+	Set(api.DegradedCondition, metav1.ConditionTrue, "NodesDead", "dead nodes: 2", &status, before)
+	Set(api.DegradedCondition, metav1.ConditionTrue, "NodesDead", "dead nodes: 2, 3", &status, now)
+
+	expected := []api.ClusterCondition{
+		{
+			Type:               api.DegradedCondition,
+			Status:             metav1.ConditionTrue,
+			LastTransitionTime: before,
+			Reason:             "NodesDead",
+			Message:            "dead nodes: 2, 3",
+		},
+	}
+	assert.Equal(t, expected, status.Conditions)
+
+	Set(api.DegradedCondition, metav1.ConditionFalse, "NodesLive", "", &status, now)
+	assert.True(t, False(api.DegradedCondition, status.Conditions))
+	assert.Equal(t, now, status.Conditions[0].LastTransitionTime)
+	assert.Empty(t, status.Conditions[0].Message)
+}
+
+func TestRemove(t *testing.T) {
+	now := metav1.Now()
+
+	status := api.CrdbClusterStatus{}
+	InitConditionsIfNeeded(&status, now)
+	Set(api.EvictionSafeCondition, metav1.ConditionTrue, "FullyReplicated", "", &status, now)
+
+	Remove(api.EvictionSafeCondition, &status)
+	assert.Len(t, status.Conditions, 2)
+	assert.False(t, True(api.EvictionSafeCondition, status.Conditions))
+
+	// removing a missing condition changes nothing
+	Remove(api.EvictionSafeCondition, &status)
+	assert.Len(t, status.Conditions, 2)
+}
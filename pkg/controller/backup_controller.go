@@ -0,0 +1,369 @@
+/*
+Copyright 2021 The Cockroach Authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    https://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controller
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"time"
+
+	api "github.com/cockroachdb/cockroach-operator/apis/v1alpha1"
+	"github.com/cockroachdb/cockroach-operator/pkg/actor"
+	"github.com/cockroachdb/cockroach-operator/pkg/clustersql"
+	"github.com/cockroachdb/cockroach-operator/pkg/condition"
+	"github.com/cockroachdb/cockroach-operator/pkg/kube"
+	"github.com/cockroachdb/cockroach-operator/pkg/resource"
+	"github.com/cockroachdb/errors"
+	"github.com/go-logr/logr"
+	kbatch "k8s.io/api/batch/v1"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/equality"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/types"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/controller/controllerutil"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
+)
+
+// BackupSchedulesFinalizer holds the deletion of a CrdbBackup until its
+// schedules are dropped from the cluster
+const BackupSchedulesFinalizer = "crdb.cockroachlabs.com/backup-schedules"
+
+// backupStatusInterval is how often the status of a CrdbBackup is refreshed
+// with the last backups of its schedules
+const backupStatusInterval = 5 * time.Minute
+
+// pruneInterval is how often the expired backups of a CrdbBackup with a
+// retention are looked for
+const pruneInterval = time.Hour
+
+// BackupReconciler reconciles a CrdbBackup object
+type BackupReconciler struct {
+	client.Client
+	Log    logr.Logger
+	Scheme *runtime.Scheme
+	// DB opens a connection to the cluster
+	DB func(ctx context.Context, cluster *resource.Cluster) (*sql.DB, error)
+}
+
+// +kubebuilder:rbac:groups=crdb.cockroachlabs.com,resources=crdbbackups,verbs=get;list;watch;update;patch
+// +kubebuilder:rbac:groups=crdb.cockroachlabs.com,resources=crdbbackups/status,verbs=get;update;patch
+
+// Reconcile creates the backup schedules of a CrdbBackup in its cluster, and
+// creates them again when the spec changes. The status reports when the last
+// backups of the schedules succeeded and failed. The schedules are dropped
+// when the CrdbBackup is deleted.
+func (r *BackupReconciler) Reconcile(ctx context.Context, req reconcile.Request) (reconcile.Result, error) {
+	log := r.Log.WithValues("CrdbBackup", req.NamespacedName)
+
+	backup := &api.CrdbBackup{}
+	if err := r.Get(ctx, req.NamespacedName, backup); err != nil {
+		return requeueIfError(client.IgnoreNotFound(err))
+	}
+
+	if backup.DeletionTimestamp != nil {
+		return r.finalize(ctx, log, backup)
+	}
+
+	if !controllerutil.ContainsFinalizer(backup, BackupSchedulesFinalizer) {
+		controllerutil.AddFinalizer(backup, BackupSchedulesFinalizer)
+		if err := r.Update(ctx, backup); err != nil {
+			return requeueIfError(err)
+		}
+		return requeueImmediately()
+	}
+
+	cluster, err := getCluster(ctx, r.Client, backup.Namespace, backup.Spec.ClusterName)
+	if err != nil {
+		return requeueIfError(err)
+	}
+	if cluster == nil {
+		return r.pending(ctx, backup, fmt.Sprintf("cluster %s not found", backup.Spec.ClusterName))
+	}
+	if !condition.True(api.InitializedCondition, cluster.Status().Conditions) {
+		return r.pending(ctx, backup, fmt.Sprintf("cluster %s is not initialized", backup.Spec.ClusterName))
+	}
+
+	uri, ok, err := collectionURI(ctx, r.Client, cluster, backup.Spec.URI, backup.Spec.URISecretRef)
+	if err != nil {
+		return requeueIfError(err)
+	}
+	if !ok {
+		ref := backup.Spec.URISecretRef
+		return r.pending(ctx, backup, fmt.Sprintf("waiting for key %s of secret %s with the backup URI", ref.Key, ref.Name))
+	}
+
+	db, err := r.DB(ctx, cluster)
+	if err != nil {
+		return requeueIfError(err)
+	}
+	defer db.Close()
+
+	status := *backup.Status.DeepCopy()
+	label := scheduleLabel(backup)
+	if status.ObservedGeneration != backup.Generation || len(status.ScheduleIDs) == 0 {
+		log.Info("creating backup schedules", "uri", clustersql.RedactURI(uri))
+		ids, err := r.createSchedules(ctx, db, backup, uri)
+		if err != nil {
+			status.Phase = api.BackupFailed
+			status.Message = err.Error()
+			if err := r.updateStatus(ctx, backup, status); err != nil {
+				return requeueIfError(err)
+			}
+			return requeueAfter(backupStatusInterval, nil)
+		}
+
+		status.ScheduleIDs = ids
+		status.ObservedGeneration = backup.Generation
+	}
+
+	last, err := clustersql.LastScheduledBackups(ctx, db, label)
+	if err != nil {
+		return requeueIfError(err)
+	}
+	status.Phase = api.BackupScheduled
+	status.LastSuccessfulBackupTime = optionalTime(last.LastSucceeded)
+	status.LastFailedBackupTime = optionalTime(last.LastFailed)
+	status.Message = ""
+	if last.LastFailed.After(last.LastSucceeded) {
+		status.Message = last.LastError
+	}
+
+	if backup.Spec.Retention != nil {
+		if err := r.prune(ctx, log, cluster, db, backup, &status, uri); err != nil {
+			return requeueIfError(err)
+		}
+	}
+
+	if err := r.updateStatus(ctx, backup, status); err != nil {
+		return requeueIfError(err)
+	}
+	return requeueAfter(backupStatusInterval, nil)
+}
+
+// createSchedules drops the schedules of the previous spec, if any, and creates
+// the schedules of the current one.
+func (r *BackupReconciler) createSchedules(ctx context.Context, db *sql.DB, backup *api.CrdbBackup, uri string) ([]int64, error) {
+	label := scheduleLabel(backup)
+	if err := clustersql.DropSchedules(ctx, db, label); err != nil {
+		return nil, err
+	}
+	return clustersql.CreateBackupSchedules(ctx, db, label, uri, backup.Spec.FullBackupSchedule, backup.Spec.IncrementalBackupSchedule)
+}
+
+// prune starts a Job deleting the backups of the collection the retention does
+// not keep, at most every pruneInterval. The previous Job is kept until then,
+// and left alone while it runs.
+func (r *BackupReconciler) prune(ctx context.Context, log logr.Logger, cluster *resource.Cluster, db *sql.DB, backup *api.CrdbBackup, status *api.CrdbBackupStatus, uri string) error {
+	if last := status.LastPruneTime; last != nil && time.Since(last.Time) < pruneInterval {
+		return nil
+	}
+
+	job := &kbatch.Job{}
+	key := types.NamespacedName{Namespace: backup.Namespace, Name: resource.BackupPruneName(backup)}
+	if err := r.Get(ctx, key, job); err == nil {
+		if !jobFinished(job) {
+			return nil
+		}
+		if err := r.Delete(ctx, job, client.PropagationPolicy(metav1.DeletePropagationBackground)); client.IgnoreNotFound(err) != nil {
+			return err
+		}
+	} else if !apierrors.IsNotFound(err) {
+		return err
+	}
+
+	sink, err := resource.NewPruneSink(uri)
+	if err != nil {
+		status.Message = err.Error()
+		return nil
+	}
+	if sink.BackupVolume && cluster.Spec().BackupVolume == nil {
+		status.Message = fmt.Sprintf("cluster %s has no backup volume to prune backups from", cluster.Name())
+		return nil
+	}
+
+	paths, err := clustersql.ListBackups(ctx, db, uri)
+	if err != nil {
+		return err
+	}
+	expired := resource.ExpiredBackups(paths, *backup.Spec.Retention, time.Now())
+	now := metav1.Now()
+	status.LastPruneTime = &now
+	status.PrunedBackups = expired
+	if len(expired) == 0 {
+		return nil
+	}
+
+	log.Info("pruning expired backups", "backups", expired)
+	managed := resource.NewManagedKubeResource(ctx, r.Client, cluster, kube.DefaultPersister)
+	builders := []resource.Builder{
+		resource.BackupPruneSecretBuilder{Cluster: cluster, Backup: backup, Sink: sink},
+		resource.BackupPruneJobBuilder{
+			Cluster:  cluster,
+			Backup:   backup,
+			Sink:     sink,
+			Paths:    expired,
+			Selector: managed.Labels.Selector(cluster.Spec().AdditionalLabels),
+		},
+	}
+	for _, b := range builders {
+		_, err := resource.Reconciler{
+			ManagedResource: managed,
+			Builder:         b,
+			Owner:           backup,
+			Scheme:          r.Scheme,
+		}.Reconcile()
+		if err != nil {
+			return errors.Wrapf(err, "failed to reconcile %s", b.ResourceName())
+		}
+	}
+	return nil
+}
+
+// jobFinished returns whether the Job completed or failed.
+func jobFinished(job *kbatch.Job) bool {
+	for _, c := range job.Status.Conditions {
+		if (c.Type == kbatch.JobComplete || c.Type == kbatch.JobFailed) && c.Status == corev1.ConditionTrue {
+			return true
+		}
+	}
+	return false
+}
+
+// finalize drops the schedules of a deleted CrdbBackup, then removes its
+// finalizer. The backups already taken are kept. There is nothing to drop when
+// the cluster was deleted.
+func (r *BackupReconciler) finalize(ctx context.Context, log logr.Logger, backup *api.CrdbBackup) (reconcile.Result, error) {
+	if !controllerutil.ContainsFinalizer(backup, BackupSchedulesFinalizer) {
+		return noRequeue()
+	}
+
+	cluster, err := getCluster(ctx, r.Client, backup.Namespace, backup.Spec.ClusterName)
+	if err != nil {
+		return requeueIfError(err)
+	}
+	if cluster != nil && len(backup.Status.ScheduleIDs) > 0 {
+		db, err := r.DB(ctx, cluster)
+		if err != nil {
+			return requeueIfError(err)
+		}
+		defer db.Close()
+
+		if err := clustersql.DropSchedules(ctx, db, scheduleLabel(backup)); err != nil {
+			log.Error(err, "failed to drop backup schedules")
+			return requeueIfError(err)
+		}
+		log.Info("dropped backup schedules")
+	}
+
+	controllerutil.RemoveFinalizer(backup, BackupSchedulesFinalizer)
+	return requeueIfError(client.IgnoreNotFound(r.Update(ctx, backup)))
+}
+
+// getCluster returns the cluster with the name in the namespace, nil when it
+// does not exist.
+func getCluster(ctx context.Context, cl client.Client, namespace, name string) (*resource.Cluster, error) {
+	cr := &api.CrdbCluster{}
+	if err := cl.Get(ctx, types.NamespacedName{Namespace: namespace, Name: name}, cr); err != nil {
+		if apierrors.IsNotFound(err) {
+			return nil, nil
+		}
+		return nil, err
+	}
+
+	cluster := resource.NewCluster(cr)
+	return &cluster, nil
+}
+
+// collectionURI returns the URI of a backup collection, read from the secret
+// when ref is set. It returns false while the secret does not exist. The nodes
+// of a cluster with a cloud identity authenticate implicitly.
+func collectionURI(ctx context.Context, cl client.Client, cluster *resource.Cluster, uri string, ref *corev1.SecretKeySelector) (string, bool, error) {
+	if ref != nil {
+		value, ok, err := resource.SecretValue(ctx, cl, cluster.Namespace(), ref)
+		if err != nil || !ok {
+			return "", ok, err
+		}
+		uri = value
+	}
+
+	if cluster.HasCloudIdentity() {
+		uri = clustersql.ImplicitAuthURI(uri)
+	}
+	return uri, true, nil
+}
+
+func (r *BackupReconciler) pending(ctx context.Context, backup *api.CrdbBackup, message string) (reconcile.Result, error) {
+	status := *backup.Status.DeepCopy()
+	status.Phase = api.BackupPending
+	status.Message = message
+	if err := r.updateStatus(ctx, backup, status); err != nil {
+		return requeueIfError(err)
+	}
+	return requeueAfter(clusterNotFoundInterval, nil)
+}
+
+func (r *BackupReconciler) updateStatus(ctx context.Context, backup *api.CrdbBackup, status api.CrdbBackupStatus) error {
+	if equality.Semantic.DeepEqual(backup.Status, status) {
+		return nil
+	}
+
+	backup.Status = status
+	return r.Status().Update(ctx, backup)
+}
+
+// scheduleLabel is the label of the schedules of the backup in the cluster.
+func scheduleLabel(backup *api.CrdbBackup) string {
+	return "crdbbackup/" + backup.Name
+}
+
+// optionalTime returns nil for the zero time. The time is truncated to the
+// precision of the status, so that an unchanged status is not updated.
+func optionalTime(t time.Time) *metav1.Time {
+	if t.IsZero() {
+		return nil
+	}
+	mt := metav1.NewTime(t.UTC().Truncate(time.Second))
+	return &mt
+}
+
+// SetupWithManager registers the controller with the controller.Manager from controller-runtime
+func (r *BackupReconciler) SetupWithManager(mgr ctrl.Manager) error {
+	return ctrl.NewControllerManagedBy(mgr).
+		For(&api.CrdbBackup{}).
+		Complete(r)
+}
+
+// InitBackupReconciler returns a registrator for a new CrdbBackup controller instance with the default logger
+func InitBackupReconciler() func(ctrl.Manager) error {
+	return func(mgr ctrl.Manager) error {
+		cl := mgr.GetClient()
+		config := mgr.GetConfig()
+		return (&BackupReconciler{
+			Client: cl,
+			Log:    ctrl.Log.WithName("controller").WithName("CrdbBackup"),
+			Scheme: mgr.GetScheme(),
+			DB: func(ctx context.Context, cluster *resource.Cluster) (*sql.DB, error) {
+				return actor.OpenDatabase(ctx, cl, config, cluster)
+			},
+		}).SetupWithManager(mgr)
+	}
+}
@@ -0,0 +1,223 @@
+/*
+Copyright 2021 The Cockroach Authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    https://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controller_test
+
+import (
+	"context"
+	"database/sql"
+	"regexp"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	api "github.com/cockroachdb/cockroach-operator/apis/v1alpha1"
+	"github.com/cockroachdb/cockroach-operator/pkg/controller"
+	"github.com/cockroachdb/cockroach-operator/pkg/resource"
+	"github.com/cockroachdb/cockroach-operator/pkg/testutil"
+	"github.com/go-logr/zapr"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/zap/zaptest"
+	kbatch "k8s.io/api/batch/v1"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/types"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+)
+
+const backupURI = "s3://backups/crdb?AUTH=implicit"
+
+func newBackupReconciler(t *testing.T, expect func(sqlmock.Sqlmock), objs ...runtime.Object) *controller.BackupReconciler {
+	scheme := testutil.InitScheme(t)
+	return &controller.BackupReconciler{
+		Client: fake.NewFakeClientWithScheme(scheme, objs...),
+		Log:    zapr.NewLogger(zaptest.NewLogger(t)).WithName("backup-controller-test"),
+		Scheme: scheme,
+		DB: func(context.Context, *resource.Cluster) (*sql.DB, error) {
+			db, mock, err := sqlmock.New()
+			require.NoError(t, err)
+			expect(mock)
+			mock.ExpectClose()
+			t.Cleanup(func() { require.NoError(t, mock.ExpectationsWereMet()) })
+			return db, nil
+		},
+	}
+}
+
+func initializedCluster() *api.CrdbCluster {
+	cr := testutil.NewBuilder("cluster").Namespaced("default").WithNodeCount(3).Cr()
+	cr.Status.Conditions = []api.ClusterCondition{{Type: api.InitializedCondition, Status: metav1.ConditionTrue}}
+	return cr
+}
+
+func TestBackupReconcile(t *testing.T) {
+	ctx := context.Background()
+	backup := &api.CrdbBackup{
+		ObjectMeta: metav1.ObjectMeta{Namespace: "default", Name: "nightly", Generation: 1},
+		Spec: api.CrdbBackupSpec{
+			ClusterName:               "cluster",
+			URI:                       backupURI,
+			FullBackupSchedule:        "@daily",
+			IncrementalBackupSchedule: "@hourly",
+		},
+	}
+	succeeded := time.Date(2021, time.June, 2, 1, 0, 0, 0, time.UTC)
+	failed := time.Date(2021, time.June, 2, 2, 0, 0, 0, time.UTC)
+
+	r := newBackupReconciler(t, func(mock sqlmock.Sqlmock) {
+		mock.ExpectExec(regexp.QuoteMeta("DROP SCHEDULES")).
+			WithArgs("crdbbackup/nightly").
+			WillReturnResult(sqlmock.NewResult(0, 0))
+		mock.ExpectQuery(regexp.QuoteMeta("CREATE SCHEDULE $1 FOR BACKUP INTO $2 RECURRING $3 FULL BACKUP $4")).
+			WithArgs("crdbbackup/nightly", backupURI, "@hourly", "@daily").
+			WillReturnRows(sqlmock.NewRows([]string{"schedule_id", "label"}).
+				AddRow(1, "crdbbackup/nightly").
+				AddRow(2, "crdbbackup/nightly"))
+		mock.ExpectQuery(regexp.QuoteMeta("SELECT max(finished)")).
+			WithArgs("crdbbackup/nightly").
+			WillReturnRows(sqlmock.NewRows([]string{"max"}).AddRow(succeeded))
+		mock.ExpectQuery(regexp.QuoteMeta("SELECT finished, error")).
+			WithArgs("crdbbackup/nightly").
+			WillReturnRows(sqlmock.NewRows([]string{"finished", "error"}).AddRow(failed, "access denied"))
+	}, initializedCluster(), backup)
+
+	key := types.NamespacedName{Namespace: "default", Name: "nightly"}
+	req := ctrl.Request{NamespacedName: key}
+
+	// the finalizer is added first
+	res, err := r.Reconcile(ctx, req)
+	require.NoError(t, err)
+	require.True(t, res.Requeue)
+	require.NoError(t, r.Get(ctx, key, backup))
+	require.Contains(t, backup.Finalizers, controller.BackupSchedulesFinalizer)
+
+	res, err = r.Reconcile(ctx, req)
+	require.NoError(t, err)
+	require.NotZero(t, res.RequeueAfter)
+
+	require.NoError(t, r.Get(ctx, key, backup))
+	status := backup.Status
+	require.Equal(t, api.BackupScheduled, status.Phase)
+	require.Equal(t, []int64{1, 2}, status.ScheduleIDs)
+	require.Equal(t, int64(1), status.ObservedGeneration)
+	require.True(t, succeeded.Equal(status.LastSuccessfulBackupTime.Time))
+	require.True(t, failed.Equal(status.LastFailedBackupTime.Time))
+	// the last backup failed after the last successful one
+	require.Equal(t, "access denied", status.Message)
+}
+
+func TestBackupWaitsForTheCluster(t *testing.T) {
+	ctx := context.Background()
+	backup := &api.CrdbBackup{
+		ObjectMeta: metav1.ObjectMeta{
+			Namespace:  "default",
+			Name:       "nightly",
+			Finalizers: []string{controller.BackupSchedulesFinalizer},
+		},
+		Spec: api.CrdbBackupSpec{ClusterName: "missing", URI: backupURI, FullBackupSchedule: "@daily"},
+	}
+	r := newBackupReconciler(t, func(sqlmock.Sqlmock) {
+		t.Fatal("unexpected connection to the cluster")
+	}, backup)
+
+	key := types.NamespacedName{Namespace: "default", Name: "nightly"}
+	res, err := r.Reconcile(ctx, ctrl.Request{NamespacedName: key})
+	require.NoError(t, err)
+	require.NotZero(t, res.RequeueAfter)
+
+	require.NoError(t, r.Get(ctx, key, backup))
+	require.Equal(t, api.BackupPending, backup.Status.Phase)
+	require.Equal(t, "cluster missing not found", backup.Status.Message)
+}
+
+func TestDeletedBackupDropsItsSchedules(t *testing.T) {
+	ctx := context.Background()
+	now := metav1.Now()
+	backup := &api.CrdbBackup{
+		ObjectMeta: metav1.ObjectMeta{
+			Namespace:         "default",
+			Name:              "nightly",
+			Finalizers:        []string{controller.BackupSchedulesFinalizer},
+			DeletionTimestamp: &now,
+		},
+		Spec:   api.CrdbBackupSpec{ClusterName: "cluster", URI: backupURI, FullBackupSchedule: "@daily"},
+		Status: api.CrdbBackupStatus{Phase: api.BackupScheduled, ScheduleIDs: []int64{1}},
+	}
+	r := newBackupReconciler(t, func(mock sqlmock.Sqlmock) {
+		mock.ExpectExec(regexp.QuoteMeta("DROP SCHEDULES")).
+			WithArgs("crdbbackup/nightly").
+			WillReturnResult(sqlmock.NewResult(0, 1))
+	}, initializedCluster(), backup)
+
+	key := types.NamespacedName{Namespace: "default", Name: "nightly"}
+	_, err := r.Reconcile(ctx, ctrl.Request{NamespacedName: key})
+	require.NoError(t, err)
+
+	require.NoError(t, r.Get(ctx, key, backup))
+	require.Empty(t, backup.Finalizers)
+}
+
+func TestBackupPrunesExpiredBackups(t *testing.T) {
+	ctx := context.Background()
+	backup := &api.CrdbBackup{
+		ObjectMeta: metav1.ObjectMeta{
+			Namespace:  "default",
+			Name:       "nightly",
+			Finalizers: []string{controller.BackupSchedulesFinalizer},
+		},
+		Spec: api.CrdbBackupSpec{
+			ClusterName:        "cluster",
+			URI:                backupURI,
+			FullBackupSchedule: "@daily",
+			Retention:          &api.BackupRetention{KeepLast: 2},
+		},
+		Status: api.CrdbBackupStatus{Phase: api.BackupScheduled, ScheduleIDs: []int64{1}},
+	}
+	r := newBackupReconciler(t, func(mock sqlmock.Sqlmock) {
+		mock.ExpectQuery(regexp.QuoteMeta("SELECT max(finished)")).
+			WithArgs("crdbbackup/nightly").
+			WillReturnRows(sqlmock.NewRows([]string{"max"}).AddRow(nil))
+		mock.ExpectQuery(regexp.QuoteMeta("SELECT finished, error")).
+			WithArgs("crdbbackup/nightly").
+			WillReturnRows(sqlmock.NewRows([]string{"finished", "error"}))
+		mock.ExpectQuery(regexp.QuoteMeta("SHOW BACKUPS IN $1")).
+			WithArgs(backupURI).
+			WillReturnRows(sqlmock.NewRows([]string{"path"}).
+				AddRow("/2021/06/01-000000.00").
+				AddRow("/2021/06/02-000000.00").
+				AddRow("/2021/06/03-000000.00"))
+	}, initializedCluster(), backup)
+
+	key := types.NamespacedName{Namespace: "default", Name: "nightly"}
+	_, err := r.Reconcile(ctx, ctrl.Request{NamespacedName: key})
+	require.NoError(t, err)
+
+	require.NoError(t, r.Get(ctx, key, backup))
+	require.NotNil(t, backup.Status.LastPruneTime)
+	require.Equal(t, []string{"/2021/06/01-000000.00"}, backup.Status.PrunedBackups)
+
+	pruneKey := types.NamespacedName{Namespace: "default", Name: "nightly-prune"}
+	secret := &corev1.Secret{}
+	require.NoError(t, r.Get(ctx, pruneKey, secret))
+	require.Equal(t, "true", string(secret.Data["RCLONE_S3_ENV_AUTH"]))
+
+	job := &kbatch.Job{}
+	require.NoError(t, r.Get(ctx, pruneKey, job))
+	require.Contains(t, job.Spec.Template.Spec.Containers[0].Command[2], "rclone purge ':s3:backups/crdb/2021/06/01-000000.00'")
+	require.Equal(t, "nightly", job.OwnerReferences[0].Name)
+}
@@ -0,0 +1,318 @@
+/*
+Copyright 2021 The Cockroach Authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    https://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controller
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"hash/fnv"
+	"strconv"
+	"time"
+
+	api "github.com/cockroachdb/cockroach-operator/apis/v1alpha1"
+	"github.com/cockroachdb/cockroach-operator/pkg/actor"
+	"github.com/cockroachdb/cockroach-operator/pkg/clustersql"
+	"github.com/cockroachdb/cockroach-operator/pkg/resource"
+	"github.com/cockroachdb/errors"
+	"github.com/go-logr/logr"
+	"k8s.io/apimachinery/pkg/api/equality"
+	"k8s.io/apimachinery/pkg/runtime"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/controller/controllerutil"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
+)
+
+// ChangefeedJobFinalizer holds the deletion of a CrdbChangefeed until its
+// changefeed job is canceled
+const ChangefeedJobFinalizer = "crdb.cockroachlabs.com/changefeed-job"
+
+// changefeedInterval is how often the status of a CrdbChangefeed is refreshed
+// with the status of its job
+const changefeedInterval = time.Minute
+
+// ChangefeedReconciler reconciles a CrdbChangefeed object
+type ChangefeedReconciler struct {
+	client.Client
+	Log    logr.Logger
+	Scheme *runtime.Scheme
+	// DB opens a connection to the cluster
+	DB func(ctx context.Context, cluster *resource.Cluster) (*sql.DB, error)
+}
+
+// +kubebuilder:rbac:groups=crdb.cockroachlabs.com,resources=crdbchangefeeds,verbs=get;list;watch;update;patch
+// +kubebuilder:rbac:groups=crdb.cockroachlabs.com,resources=crdbchangefeeds/status,verbs=get;update;patch
+
+// Reconcile creates the changefeed job of a CrdbChangefeed once its cluster is
+// ready, and creates it again when the tables, the sink, the format or the
+// resolved timestamps change. The job is paused and resumed with the spec, and
+// its status is reported in the status of the CrdbChangefeed. The job is
+// canceled when the CrdbChangefeed is deleted.
+func (r *ChangefeedReconciler) Reconcile(ctx context.Context, req reconcile.Request) (reconcile.Result, error) {
+	log := r.Log.WithValues("CrdbChangefeed", req.NamespacedName)
+
+	feed := &api.CrdbChangefeed{}
+	if err := r.Get(ctx, req.NamespacedName, feed); err != nil {
+		return requeueIfError(client.IgnoreNotFound(err))
+	}
+
+	if feed.DeletionTimestamp != nil {
+		return r.finalize(ctx, log, feed)
+	}
+
+	if !controllerutil.ContainsFinalizer(feed, ChangefeedJobFinalizer) {
+		controllerutil.AddFinalizer(feed, ChangefeedJobFinalizer)
+		if err := r.Update(ctx, feed); err != nil {
+			return requeueIfError(err)
+		}
+		return requeueImmediately()
+	}
+
+	status := *feed.Status.DeepCopy()
+	spec := feed.Spec
+	if spec.SinkURI == "" && spec.SinkURISecretRef == nil {
+		status.Phase = api.ChangefeedFailed
+		status.Message = "sinkURI or sinkURISecretRef is required"
+		return requeueIfError(r.updateStatus(ctx, feed, status))
+	}
+
+	name := spec.ClusterName
+	cluster, err := getCluster(ctx, r.Client, feed.Namespace, name)
+	if err != nil {
+		return requeueIfError(err)
+	}
+	if cluster == nil {
+		return r.pending(ctx, feed, status, fmt.Sprintf("cluster %s not found", name))
+	}
+	if !clusterReady(cluster) {
+		return r.pending(ctx, feed, status, fmt.Sprintf("waiting for cluster %s to be ready", name))
+	}
+
+	uri, ok, err := collectionURI(ctx, r.Client, cluster, spec.SinkURI, spec.SinkURISecretRef)
+	if err != nil {
+		return requeueIfError(err)
+	}
+	if !ok {
+		ref := spec.SinkURISecretRef
+		return r.pending(ctx, feed, status, fmt.Sprintf("waiting for key %s of secret %s with the sink URI", ref.Key, ref.Name))
+	}
+
+	db, err := r.DB(ctx, cluster)
+	if err != nil {
+		return requeueIfError(err)
+	}
+	defer db.Close()
+
+	hash := changefeedHash(spec, uri)
+	if status.JobID != 0 && status.SpecHash != hash {
+		if err := cancelJob(ctx, db, status.JobID); err != nil {
+			return requeueIfError(err)
+		}
+		log.Info("canceled the changefeed job of the previous spec", "job", status.JobID)
+		status.JobID = 0
+		status.HighWater = nil
+		status.RunningStatus = ""
+	}
+
+	if status.JobID == 0 {
+		// a spec the job could not be created for is not retried until it changes
+		if status.Phase == api.ChangefeedFailed && status.SpecHash == hash {
+			return noRequeue()
+		}
+		return r.create(ctx, log, db, feed, status, uri, hash)
+	}
+
+	job, err := clustersql.GetChangefeedJob(ctx, db, status.JobID)
+	if err != nil {
+		return requeueIfError(err)
+	}
+	status.HighWater = optionalTime(job.HighWater)
+	status.RunningStatus = job.RunningStatus
+	if job.Finished() {
+		log.Info("changefeed job failed", "job", job.ID, "status", job.Status)
+		status.Phase = api.ChangefeedFailed
+		status.Message = fmt.Sprintf("changefeed job %d %s: %s", job.ID, job.Status, job.Error)
+		return requeueIfError(r.updateStatus(ctx, feed, status))
+	}
+
+	if spec.Paused {
+		if job.Status == clustersql.JobRunning {
+			if err := clustersql.PauseJob(ctx, db, job.ID); err != nil {
+				return requeueIfError(err)
+			}
+			log.Info("paused changefeed job", "job", job.ID)
+		}
+		status.Phase = api.ChangefeedPaused
+	} else {
+		if job.Status == clustersql.JobPaused {
+			if err := clustersql.ResumeJob(ctx, db, job.ID); err != nil {
+				return requeueIfError(err)
+			}
+			log.Info("resumed changefeed job", "job", job.ID)
+		}
+		status.Phase = api.ChangefeedRunning
+	}
+	status.Message = ""
+
+	if err := r.updateStatus(ctx, feed, status); err != nil {
+		return requeueIfError(err)
+	}
+	return requeueAfter(changefeedInterval, nil)
+}
+
+// create creates the changefeed job of the spec. A paused spec pauses the job
+// right away, once its ID is recorded.
+func (r *ChangefeedReconciler) create(ctx context.Context, log logr.Logger, db *sql.DB, feed *api.CrdbChangefeed, status api.CrdbChangefeedStatus, uri, hash string) (reconcile.Result, error) {
+	if err := clustersql.SetClusterSetting(ctx, db, "kv.rangefeed.enabled", "true"); err != nil {
+		return requeueIfError(err)
+	}
+
+	spec := feed.Spec
+	target := clustersql.Changefeed{Tables: spec.Tables, Format: string(spec.Format)}
+	if spec.Resolved != nil {
+		target.Resolved = spec.Resolved.Duration
+	}
+	status.SpecHash = hash
+	id, err := clustersql.CreateChangefeed(ctx, db, uri, target)
+	if err != nil {
+		log.Info("failed to create changefeed job", "error", err.Error())
+		status.Phase = api.ChangefeedFailed
+		status.Message = err.Error()
+		return requeueIfError(r.updateStatus(ctx, feed, status))
+	}
+
+	log.Info("created changefeed job", "sink", clustersql.RedactURI(uri), "job", id)
+	status.Phase = api.ChangefeedRunning
+	status.JobID = id
+	status.Message = ""
+	if err := r.updateStatus(ctx, feed, status); err != nil {
+		return requeueIfError(err)
+	}
+	if spec.Paused {
+		return requeueImmediately()
+	}
+	return requeueAfter(changefeedInterval, nil)
+}
+
+// finalize cancels the changefeed job of a deleted CrdbChangefeed, then removes
+// its finalizer. There is nothing to cancel when the cluster was deleted.
+func (r *ChangefeedReconciler) finalize(ctx context.Context, log logr.Logger, feed *api.CrdbChangefeed) (reconcile.Result, error) {
+	if !controllerutil.ContainsFinalizer(feed, ChangefeedJobFinalizer) {
+		return noRequeue()
+	}
+
+	cluster, err := getCluster(ctx, r.Client, feed.Namespace, feed.Spec.ClusterName)
+	if err != nil {
+		return requeueIfError(err)
+	}
+	if cluster != nil && feed.Status.JobID != 0 {
+		db, err := r.DB(ctx, cluster)
+		if err != nil {
+			return requeueIfError(err)
+		}
+		defer db.Close()
+
+		if err := cancelJob(ctx, db, feed.Status.JobID); err != nil {
+			log.Error(err, "failed to cancel changefeed job")
+			return requeueIfError(err)
+		}
+		log.Info("canceled changefeed job", "job", feed.Status.JobID)
+	}
+
+	controllerutil.RemoveFinalizer(feed, ChangefeedJobFinalizer)
+	return requeueIfError(client.IgnoreNotFound(r.Update(ctx, feed)))
+}
+
+func (r *ChangefeedReconciler) pending(ctx context.Context, feed *api.CrdbChangefeed, status api.CrdbChangefeedStatus, message string) (reconcile.Result, error) {
+	status.Phase = api.ChangefeedPending
+	status.Message = message
+	if err := r.updateStatus(ctx, feed, status); err != nil {
+		return requeueIfError(err)
+	}
+	return requeueAfter(clusterNotFoundInterval, nil)
+}
+
+func (r *ChangefeedReconciler) updateStatus(ctx context.Context, feed *api.CrdbChangefeed, status api.CrdbChangefeedStatus) error {
+	if equality.Semantic.DeepEqual(feed.Status, status) {
+		return nil
+	}
+
+	feed.Status = status
+	return r.Status().Update(ctx, feed)
+}
+
+// cancelJob cancels the job unless it is already over, or gone from the jobs
+// of the cluster.
+func cancelJob(ctx context.Context, db *sql.DB, id int64) error {
+	job, err := clustersql.GetJob(ctx, db, id)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	if job.Finished() {
+		return nil
+	}
+	return clustersql.CancelJob(ctx, db, id)
+}
+
+// changefeedHash identifies what the changefeed job of the spec emits, and
+// where. The URI of the sink is read from its secret, so a new URI in the
+// secret creates the job again too.
+func changefeedHash(spec api.CrdbChangefeedSpec, uri string) string {
+	target := struct {
+		Tables   []string
+		URI      string
+		Format   api.ChangefeedFormat
+		Resolved string
+	}{Tables: spec.Tables, URI: uri, Format: spec.Format}
+	if spec.Resolved != nil {
+		target.Resolved = spec.Resolved.Duration.String()
+	}
+
+	// the struct always marshals
+	data, _ := json.Marshal(target)
+	h := fnv.New64a()
+	h.Write(data)
+	return strconv.FormatUint(h.Sum64(), 16)
+}
+
+// SetupWithManager registers the controller with the controller.Manager from controller-runtime
+func (r *ChangefeedReconciler) SetupWithManager(mgr ctrl.Manager) error {
+	return ctrl.NewControllerManagedBy(mgr).
+		For(&api.CrdbChangefeed{}).
+		Complete(r)
+}
+
+// InitChangefeedReconciler returns a registrator for a new CrdbChangefeed controller instance with the default logger
+func InitChangefeedReconciler() func(ctrl.Manager) error {
+	return func(mgr ctrl.Manager) error {
+		cl := mgr.GetClient()
+		config := mgr.GetConfig()
+		return (&ChangefeedReconciler{
+			Client: cl,
+			Log:    ctrl.Log.WithName("controller").WithName("CrdbChangefeed"),
+			Scheme: mgr.GetScheme(),
+			DB: func(ctx context.Context, cluster *resource.Cluster) (*sql.DB, error) {
+				return actor.OpenDatabase(ctx, cl, config, cluster)
+			},
+		}).SetupWithManager(mgr)
+	}
+}
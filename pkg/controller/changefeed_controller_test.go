@@ -0,0 +1,243 @@
+/*
+Copyright 2021 The Cockroach Authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    https://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controller_test
+
+import (
+	"context"
+	"database/sql"
+	"regexp"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	api "github.com/cockroachdb/cockroach-operator/apis/v1alpha1"
+	"github.com/cockroachdb/cockroach-operator/pkg/controller"
+	"github.com/cockroachdb/cockroach-operator/pkg/resource"
+	"github.com/cockroachdb/cockroach-operator/pkg/testutil"
+	"github.com/go-logr/zapr"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/zap/zaptest"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/types"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+)
+
+const sinkURI = "kafka://kafka.default:9092"
+
+var changefeedJobColumns = []string{"status", "error", "running_status", "high_water_timestamp"}
+
+// newChangefeedReconciler returns a reconciler whose successive connections to
+// the cluster expect the successive expectations.
+func newChangefeedReconciler(t *testing.T, expects []func(sqlmock.Sqlmock), objs ...runtime.Object) *controller.ChangefeedReconciler {
+	scheme := testutil.InitScheme(t)
+	return &controller.ChangefeedReconciler{
+		Client: fake.NewFakeClientWithScheme(scheme, objs...),
+		Log:    zapr.NewLogger(zaptest.NewLogger(t)).WithName("changefeed-controller-test"),
+		Scheme: scheme,
+		DB: func(context.Context, *resource.Cluster) (*sql.DB, error) {
+			require.NotEmpty(t, expects, "unexpected connection to the cluster")
+			db, mock, err := sqlmock.New()
+			require.NoError(t, err)
+			expects[0](mock)
+			expects = expects[1:]
+			mock.ExpectClose()
+			t.Cleanup(func() { require.NoError(t, mock.ExpectationsWereMet()) })
+			return db, nil
+		},
+	}
+}
+
+func newChangefeed() *api.CrdbChangefeed {
+	return &api.CrdbChangefeed{
+		ObjectMeta: metav1.ObjectMeta{
+			Namespace:  "default",
+			Name:       "rides",
+			Finalizers: []string{controller.ChangefeedJobFinalizer},
+		},
+		Spec: api.CrdbChangefeedSpec{
+			ClusterName: "cluster",
+			Tables:      []string{"movr.public.rides"},
+			SinkURI:     sinkURI,
+			Format:      api.ChangefeedJSON,
+			Resolved:    &metav1.Duration{Duration: 10 * time.Second},
+		},
+	}
+}
+
+func expectChangefeedCreated(mock sqlmock.Sqlmock, id int64) {
+	mock.ExpectExec(regexp.QuoteMeta("SET CLUSTER SETTING kv.rangefeed.enabled = $1")).
+		WithArgs("true").
+		WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectQuery(regexp.QuoteMeta(`CREATE CHANGEFEED FOR TABLE "movr"."public"."rides" INTO $1 WITH format = $2, resolved = $3`)).
+		WithArgs(sinkURI, "json", "10s").
+		WillReturnRows(sqlmock.NewRows([]string{"job_id"}).AddRow(id))
+}
+
+func TestChangefeedReconcile(t *testing.T) {
+	ctx := context.Background()
+	highWater := time.Date(2021, 6, 1, 12, 0, 0, 0, time.UTC)
+	r := newChangefeedReconciler(t, []func(sqlmock.Sqlmock){
+		func(mock sqlmock.Sqlmock) {
+			expectChangefeedCreated(mock, 42)
+		},
+		func(mock sqlmock.Sqlmock) {
+			mock.ExpectQuery(regexp.QuoteMeta("SELECT status, error, running_status")).
+				WithArgs(42).
+				WillReturnRows(sqlmock.NewRows(changefeedJobColumns).AddRow("running", nil, "running: resolved", "1622548800000000000.0000000000"))
+		},
+		func(mock sqlmock.Sqlmock) {
+			mock.ExpectQuery(regexp.QuoteMeta("SELECT status, error, running_status")).
+				WithArgs(42).
+				WillReturnRows(sqlmock.NewRows(changefeedJobColumns).AddRow("running", nil, "running: resolved", "1622548800000000000.0000000000"))
+			mock.ExpectExec(regexp.QuoteMeta("PAUSE JOB $1")).WithArgs(42).WillReturnResult(sqlmock.NewResult(0, 0))
+		},
+		func(mock sqlmock.Sqlmock) {
+			mock.ExpectQuery(regexp.QuoteMeta("SELECT status, error, running_status")).
+				WithArgs(42).
+				WillReturnRows(sqlmock.NewRows(changefeedJobColumns).AddRow("paused", nil, nil, "1622548800000000000.0000000000"))
+			mock.ExpectExec(regexp.QuoteMeta("RESUME JOB $1")).WithArgs(42).WillReturnResult(sqlmock.NewResult(0, 0))
+		},
+	}, readyCluster(), newChangefeed())
+
+	key := types.NamespacedName{Namespace: "default", Name: "rides"}
+	req := ctrl.Request{NamespacedName: key}
+	feed := &api.CrdbChangefeed{}
+
+	res, err := r.Reconcile(ctx, req)
+	require.NoError(t, err)
+	require.NotZero(t, res.RequeueAfter)
+	require.NoError(t, r.Get(ctx, key, feed))
+	require.Equal(t, api.ChangefeedRunning, feed.Status.Phase)
+	require.Equal(t, int64(42), feed.Status.JobID)
+	require.NotEmpty(t, feed.Status.SpecHash)
+
+	_, err = r.Reconcile(ctx, req)
+	require.NoError(t, err)
+	require.NoError(t, r.Get(ctx, key, feed))
+	require.Equal(t, highWater, feed.Status.HighWater.UTC())
+	require.Equal(t, "running: resolved", feed.Status.RunningStatus)
+
+	// pausing the changefeed keeps its job
+	feed.Spec.Paused = true
+	require.NoError(t, r.Update(ctx, feed))
+	_, err = r.Reconcile(ctx, req)
+	require.NoError(t, err)
+	require.NoError(t, r.Get(ctx, key, feed))
+	require.Equal(t, api.ChangefeedPaused, feed.Status.Phase)
+	require.Equal(t, int64(42), feed.Status.JobID)
+
+	feed.Spec.Paused = false
+	require.NoError(t, r.Update(ctx, feed))
+	_, err = r.Reconcile(ctx, req)
+	require.NoError(t, err)
+	require.NoError(t, r.Get(ctx, key, feed))
+	require.Equal(t, api.ChangefeedRunning, feed.Status.Phase)
+	require.Equal(t, int64(42), feed.Status.JobID)
+}
+
+func TestChangefeedIsCreatedAgainWhenTheSpecChanges(t *testing.T) {
+	ctx := context.Background()
+	feed := newChangefeed()
+	feed.Status = api.CrdbChangefeedStatus{Phase: api.ChangefeedRunning, JobID: 41, SpecHash: "previous"}
+	r := newChangefeedReconciler(t, []func(sqlmock.Sqlmock){
+		func(mock sqlmock.Sqlmock) {
+			mock.ExpectQuery(regexp.QuoteMeta("SELECT status, error FROM crdb_internal.jobs")).
+				WithArgs(41).
+				WillReturnRows(sqlmock.NewRows([]string{"status", "error"}).AddRow("running", nil))
+			mock.ExpectExec(regexp.QuoteMeta("CANCEL JOB $1")).WithArgs(41).WillReturnResult(sqlmock.NewResult(0, 0))
+			expectChangefeedCreated(mock, 42)
+		},
+	}, readyCluster(), feed)
+
+	key := types.NamespacedName{Namespace: "default", Name: "rides"}
+	_, err := r.Reconcile(ctx, ctrl.Request{NamespacedName: key})
+	require.NoError(t, err)
+
+	require.NoError(t, r.Get(ctx, key, feed))
+	require.Equal(t, api.ChangefeedRunning, feed.Status.Phase)
+	require.Equal(t, int64(42), feed.Status.JobID)
+	require.NotEqual(t, "previous", feed.Status.SpecHash)
+}
+
+func TestChangefeedFailedJob(t *testing.T) {
+	ctx := context.Background()
+	r := newChangefeedReconciler(t, []func(sqlmock.Sqlmock){
+		func(mock sqlmock.Sqlmock) {
+			expectChangefeedCreated(mock, 42)
+		},
+		func(mock sqlmock.Sqlmock) {
+			mock.ExpectQuery(regexp.QuoteMeta("SELECT status, error, running_status")).
+				WithArgs(42).
+				WillReturnRows(sqlmock.NewRows(changefeedJobColumns).AddRow("failed", "kafka: client has run out of available brokers", nil, nil))
+		},
+	}, readyCluster(), newChangefeed())
+
+	key := types.NamespacedName{Namespace: "default", Name: "rides"}
+	req := ctrl.Request{NamespacedName: key}
+	_, err := r.Reconcile(ctx, req)
+	require.NoError(t, err)
+
+	res, err := r.Reconcile(ctx, req)
+	require.NoError(t, err)
+	require.Zero(t, res.RequeueAfter)
+
+	feed := &api.CrdbChangefeed{}
+	require.NoError(t, r.Get(ctx, key, feed))
+	require.Equal(t, api.ChangefeedFailed, feed.Status.Phase)
+	require.Equal(t, "changefeed job 42 failed: kafka: client has run out of available brokers", feed.Status.Message)
+}
+
+func TestChangefeedWaitsForTheCluster(t *testing.T) {
+	ctx := context.Background()
+	feed := newChangefeed()
+	feed.Spec.ClusterName = "missing"
+	r := newChangefeedReconciler(t, nil, feed)
+
+	key := types.NamespacedName{Namespace: "default", Name: "rides"}
+	res, err := r.Reconcile(ctx, ctrl.Request{NamespacedName: key})
+	require.NoError(t, err)
+	require.NotZero(t, res.RequeueAfter)
+
+	require.NoError(t, r.Get(ctx, key, feed))
+	require.Equal(t, api.ChangefeedPending, feed.Status.Phase)
+	require.Equal(t, "cluster missing not found", feed.Status.Message)
+}
+
+func TestDeletedChangefeedCancelsItsJob(t *testing.T) {
+	ctx := context.Background()
+	now := metav1.Now()
+	feed := newChangefeed()
+	feed.DeletionTimestamp = &now
+	feed.Status = api.CrdbChangefeedStatus{Phase: api.ChangefeedRunning, JobID: 42}
+	r := newChangefeedReconciler(t, []func(sqlmock.Sqlmock){
+		func(mock sqlmock.Sqlmock) {
+			mock.ExpectQuery(regexp.QuoteMeta("SELECT status, error FROM crdb_internal.jobs")).
+				WithArgs(42).
+				WillReturnRows(sqlmock.NewRows([]string{"status", "error"}).AddRow("running", nil))
+			mock.ExpectExec(regexp.QuoteMeta("CANCEL JOB $1")).WithArgs(42).WillReturnResult(sqlmock.NewResult(0, 0))
+		},
+	}, readyCluster(), feed)
+
+	key := types.NamespacedName{Namespace: "default", Name: "rides"}
+	_, err := r.Reconcile(ctx, ctrl.Request{NamespacedName: key})
+	require.NoError(t, err)
+
+	require.NoError(t, r.Get(ctx, key, feed))
+	require.Empty(t, feed.Finalizers)
+}
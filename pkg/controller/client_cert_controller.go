@@ -0,0 +1,283 @@
+/*
+Copyright 2021 The Cockroach Authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    https://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controller
+
+import (
+	"bytes"
+	"context"
+	"crypto/x509"
+	"encoding/pem"
+	"fmt"
+	"time"
+
+	api "github.com/cockroachdb/cockroach-operator/apis/v1alpha1"
+	"github.com/cockroachdb/cockroach-operator/pkg/actor"
+	"github.com/cockroachdb/cockroach-operator/pkg/kube"
+	"github.com/cockroachdb/cockroach-operator/pkg/metrics"
+	"github.com/cockroachdb/cockroach-operator/pkg/resource"
+	"github.com/cockroachdb/cockroach-operator/pkg/security"
+	"github.com/go-logr/logr"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/equality"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/types"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/controller/controllerutil"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
+)
+
+// clientCertInterval is how often an issued client certificate is checked
+// against the CA of its cluster, which may have been rotated
+const clientCertInterval = 5 * time.Minute
+
+// ClientCertReconciler reconciles a CrdbClientCert object
+type ClientCertReconciler struct {
+	client.Client
+	Log    logr.Logger
+	Scheme *runtime.Scheme
+	// SigningCA returns the certificate of the CA that signs the client
+	// certificates of the cluster, nil when none is known
+	SigningCA func(ctx context.Context, cluster *resource.Cluster) ([]byte, error)
+	// Issue issues the client certificate of the user
+	Issue func(ctx context.Context, cluster *resource.Cluster, user string) (*security.Certificate, error)
+}
+
+// +kubebuilder:rbac:groups=crdb.cockroachlabs.com,resources=crdbclientcerts,verbs=get;list;watch;update;patch
+// +kubebuilder:rbac:groups=crdb.cockroachlabs.com,resources=crdbclientcerts/status,verbs=get;update;patch
+
+// Reconcile issues the client certificate of a CrdbClientCert into its secret
+// once the CA of its cluster exists. The certificate is issued again when the
+// user changes, when the CA of the cluster changes and before it expires.
+func (r *ClientCertReconciler) Reconcile(ctx context.Context, req reconcile.Request) (reconcile.Result, error) {
+	log := r.Log.WithValues("CrdbClientCert", req.NamespacedName)
+
+	cc := &api.CrdbClientCert{}
+	if err := r.Get(ctx, req.NamespacedName, cc); err != nil {
+		if apierrors.IsNotFound(err) {
+			metrics.DeleteClientCertificateExpiry(req.Namespace, req.Name)
+		}
+		return requeueIfError(client.IgnoreNotFound(err))
+	}
+	if cc.DeletionTimestamp != nil {
+		return noRequeue()
+	}
+
+	status := *cc.Status.DeepCopy()
+	namespace, name := cc.ClusterNamespaceOrDefault(), cc.Spec.ClusterName
+	cluster, err := getCluster(ctx, r.Client, namespace, name)
+	if err != nil {
+		return requeueIfError(err)
+	}
+	if cluster == nil {
+		return r.pending(ctx, cc, status, fmt.Sprintf("cluster %s/%s not found", namespace, name))
+	}
+	if reason := clientCertRefusal(cluster, cc); reason != "" {
+		status.Phase = api.ClientCertFailed
+		status.Message = reason
+		if err := r.updateStatus(ctx, cc, status); err != nil {
+			return requeueIfError(err)
+		}
+		return requeueAfter(clientCertInterval, nil)
+	}
+
+	node, err := resource.LoadTLSSecret(cluster.NodeTLSSecretName(),
+		resource.NewKubeResource(ctx, r.Client, cluster.Namespace(), kube.DefaultPersister))
+	if kube.IgnoreNotFound(err) != nil {
+		return requeueIfError(err)
+	}
+	if err != nil || !node.Ready() {
+		return r.pending(ctx, cc, status, fmt.Sprintf("waiting for the certificates of cluster %s/%s", namespace, name))
+	}
+	signer, err := r.SigningCA(ctx, cluster)
+	if err != nil {
+		return requeueIfError(err)
+	}
+
+	secret := &corev1.Secret{ObjectMeta: metav1.ObjectMeta{Namespace: cc.Namespace, Name: cc.SecretNameOrDefault()}}
+	if err := r.Get(ctx, types.NamespacedName{Namespace: secret.Namespace, Name: secret.Name}, secret); client.IgnoreNotFound(err) != nil {
+		return requeueIfError(err)
+	}
+	cert := parseCert(secret.Data[corev1.TLSCertKey])
+	now := time.Now()
+
+	if reason := clientCertReissueReason(cc, secret, cert, node.CA(), signer, now); reason != "" {
+		log.Info("issuing client certificate", "user", cc.Spec.User, "reason", reason)
+		issued, err := r.Issue(ctx, cluster, cc.Spec.User)
+		if err != nil {
+			log.Error(err, "failed to issue client certificate")
+			status.Message = err.Error()
+			if err := r.updateStatus(ctx, cc, status); err != nil {
+				return requeueIfError(err)
+			}
+			return requeueAfter(clusterNotFoundInterval, nil)
+		}
+
+		if _, err := controllerutil.CreateOrUpdate(ctx, r.Client, secret, func() error {
+			secret.Data = clientCertData(cc.Spec.User, issued, node.CA())
+			return controllerutil.SetControllerReference(cc, secret, r.Scheme)
+		}); err != nil {
+			return requeueIfError(err)
+		}
+		cert = parseCert(issued.Cert)
+		if cert == nil {
+			status.Phase = api.ClientCertFailed
+			status.Message = "the issued certificate cannot be parsed"
+			return requeueIfError(r.updateStatus(ctx, cc, status))
+		}
+	}
+
+	renewal := (&api.CertificateRotation{RenewBefore: cc.Spec.RenewBefore}).RenewalTime(cert.NotBefore, cert.NotAfter, nil)
+	status = api.CrdbClientCertStatus{
+		Phase:       api.ClientCertIssued,
+		NotBefore:   &metav1.Time{Time: cert.NotBefore},
+		NotAfter:    &metav1.Time{Time: cert.NotAfter},
+		RenewalTime: &metav1.Time{Time: renewal},
+	}
+	if err := r.updateStatus(ctx, cc, status); err != nil {
+		return requeueIfError(err)
+	}
+	metrics.SetClientCertificateExpiry(cc.Namespace, cc.Name, cert.NotAfter)
+
+	interval := clientCertInterval
+	if until := renewal.Sub(now); until < interval {
+		interval = until
+	}
+	return requeueAfter(interval, nil)
+}
+
+func (r *ClientCertReconciler) pending(ctx context.Context, cc *api.CrdbClientCert, status api.CrdbClientCertStatus, message string) (reconcile.Result, error) {
+	status.Phase = api.ClientCertPending
+	status.Message = message
+	if err := r.updateStatus(ctx, cc, status); err != nil {
+		return requeueIfError(err)
+	}
+	return requeueAfter(clusterNotFoundInterval, nil)
+}
+
+func (r *ClientCertReconciler) updateStatus(ctx context.Context, cc *api.CrdbClientCert, status api.CrdbClientCertStatus) error {
+	if equality.Semantic.DeepEqual(cc.Status, status) {
+		return nil
+	}
+
+	cc.Status = status
+	return r.Status().Update(ctx, cc)
+}
+
+// clientCertRefusal returns why the operator does not issue the certificate of
+// the CrdbClientCert, if it does not. The certificate of user node is never
+// issued, and the one of user root only in the namespace of the cluster.
+// Another namespace must be in the clientCertNamespaces of the cluster.
+func clientCertRefusal(cluster *resource.Cluster, cc *api.CrdbClientCert) string {
+	spec := cluster.Spec()
+	switch {
+	case !spec.TLSEnabled:
+		return fmt.Sprintf("cluster %s does not use TLS", cluster.Name())
+	case spec.NodeTLSSecret != "":
+		return fmt.Sprintf("the certificates of cluster %s are not issued by the operator", cluster.Name())
+	case spec.ExternalCA != nil:
+		return fmt.Sprintf("the certificates of cluster %s are signed by an external CA", cluster.Name())
+	case cc.Spec.User == "node":
+		return "the certificate of user node is only issued to the nodes"
+	case cc.Namespace == cluster.Namespace():
+		return ""
+	case cc.Spec.User == "root":
+		return fmt.Sprintf("the certificate of user root is only issued in namespace %s", cluster.Namespace())
+	}
+
+	for _, ns := range spec.ClientCertNamespaces {
+		if ns == cc.Namespace {
+			return ""
+		}
+	}
+	return fmt.Sprintf("namespace %s is not in the clientCertNamespaces of cluster %s", cc.Namespace, cluster.Name())
+}
+
+// clientCertReissueReason returns why the certificate in the secret must be
+// issued again, if it must.
+func clientCertReissueReason(cc *api.CrdbClientCert, secret *corev1.Secret, cert *x509.Certificate, ca, signer []byte, now time.Time) string {
+	if cert == nil {
+		return "no certificate"
+	}
+	if cert.Subject.CommonName != cc.Spec.User {
+		return "user changed"
+	}
+	if !bytes.Equal(secret.Data["ca.crt"], ca) {
+		return "CA certificates changed"
+	}
+	if signer != nil {
+		if ca := parseCert(signer); ca != nil && cert.CheckSignatureFrom(ca) != nil {
+			return "signed by another CA"
+		}
+	}
+	renewal := (&api.CertificateRotation{RenewBefore: cc.Spec.RenewBefore}).RenewalTime(cert.NotBefore, cert.NotAfter, nil)
+	if !now.Before(renewal) {
+		return "renewal due"
+	}
+	return ""
+}
+
+// clientCertData returns the keys of the secret of a client certificate, under
+// the names of the cockroach certs directory as well as the ones of a TLS
+// secret.
+func clientCertData(user string, cert *security.Certificate, ca []byte) map[string][]byte {
+	return map[string][]byte{
+		"ca.crt":                           ca,
+		corev1.TLSCertKey:                  cert.Cert,
+		corev1.TLSPrivateKeyKey:            cert.Key,
+		fmt.Sprintf("client.%s.crt", user): cert.Cert,
+		fmt.Sprintf("client.%s.key", user): cert.Key,
+	}
+}
+
+// parseCert returns the first certificate of the PEM data, nil if there is none.
+func parseCert(data []byte) *x509.Certificate {
+	block, _ := pem.Decode(data)
+	if block == nil {
+		return nil
+	}
+	cert, err := x509.ParseCertificate(block.Bytes)
+	if err != nil {
+		return nil
+	}
+	return cert
+}
+
+// SetupWithManager registers the controller with the controller.Manager from controller-runtime
+func (r *ClientCertReconciler) SetupWithManager(mgr ctrl.Manager) error {
+	return ctrl.NewControllerManagedBy(mgr).
+		For(&api.CrdbClientCert{}).
+		Owns(&corev1.Secret{}).
+		Complete(r)
+}
+
+// InitClientCertReconciler returns a registrator for a new CrdbClientCert controller instance with the default logger
+func InitClientCertReconciler() func(ctrl.Manager) error {
+	return func(mgr ctrl.Manager) error {
+		log := ctrl.Log.WithName("controller").WithName("CrdbClientCert")
+		issuer := actor.NewClientCertIssuer(mgr.GetClient(), log)
+		return (&ClientCertReconciler{
+			Client:    mgr.GetClient(),
+			Log:       log,
+			Scheme:    mgr.GetScheme(),
+			SigningCA: issuer.SigningCA,
+			Issue:     issuer.Issue,
+		}).SetupWithManager(mgr)
+	}
+}
@@ -0,0 +1,275 @@
+/*
+Copyright 2021 The Cockroach Authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    https://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controller_test
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"math/big"
+	"testing"
+	"time"
+
+	api "github.com/cockroachdb/cockroach-operator/apis/v1alpha1"
+	"github.com/cockroachdb/cockroach-operator/pkg/controller"
+	"github.com/cockroachdb/cockroach-operator/pkg/resource"
+	"github.com/cockroachdb/cockroach-operator/pkg/security"
+	"github.com/cockroachdb/cockroach-operator/pkg/testutil"
+	"github.com/go-logr/zapr"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/zap/zaptest"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/types"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+)
+
+// testCA signs the client certificates of the tests
+type testCA struct {
+	cert *x509.Certificate
+	key  *ecdsa.PrivateKey
+	pem  []byte
+}
+
+func newTestCA(t *testing.T) *testCA {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+	template := &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: "Cockroach CA"},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(24 * time.Hour),
+		IsCA:                  true,
+		BasicConstraintsValid: true,
+		KeyUsage:              x509.KeyUsageCertSign,
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	require.NoError(t, err)
+	cert, err := x509.ParseCertificate(der)
+	require.NoError(t, err)
+	return &testCA{cert: cert, key: key, pem: pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der})}
+}
+
+func (ca *testCA) issue(t *testing.T, user string, lifetime time.Duration) *security.Certificate {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(2),
+		Subject:      pkix.Name{CommonName: user},
+		NotBefore:    time.Now().Add(-time.Minute),
+		NotAfter:     time.Now().Add(lifetime),
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageClientAuth},
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, ca.cert, &key.PublicKey, ca.key)
+	require.NoError(t, err)
+	return &security.Certificate{
+		Cert: pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}),
+		Key:  []byte("key-of-" + user),
+		CA:   ca.pem,
+	}
+}
+
+// newClientCertReconciler returns a reconciler that signs the certificates
+// with the CA that *signer points to, and counts them.
+func newClientCertReconciler(t *testing.T, signer **testCA, issued *int, objs ...runtime.Object) *controller.ClientCertReconciler {
+	scheme := testutil.InitScheme(t)
+	return &controller.ClientCertReconciler{
+		Client: fake.NewFakeClientWithScheme(scheme, objs...),
+		Log:    zapr.NewLogger(zaptest.NewLogger(t)).WithName("client-cert-controller-test"),
+		Scheme: scheme,
+		SigningCA: func(context.Context, *resource.Cluster) ([]byte, error) {
+			return (*signer).pem, nil
+		},
+		Issue: func(_ context.Context, _ *resource.Cluster, user string) (*security.Certificate, error) {
+			*issued++
+			return (*signer).issue(t, user, 3*time.Hour), nil
+		},
+	}
+}
+
+func clientCertCluster(namespaces ...string) *api.CrdbCluster {
+	cr := testutil.NewBuilder("crdb").Namespaced("db").WithNodeCount(3).WithTLS().Cr()
+	cr.Spec.ClientCertNamespaces = namespaces
+	return cr
+}
+
+func clientCertNodeSecret(ca []byte) *corev1.Secret {
+	return &corev1.Secret{
+		ObjectMeta: metav1.ObjectMeta{Namespace: "db", Name: "crdb-node"},
+		Data:       map[string][]byte{"ca.crt": ca, "tls.crt": []byte("node-cert"), "tls.key": []byte("node-key")},
+	}
+}
+
+func newClientCert(namespace, user string) *api.CrdbClientCert {
+	return &api.CrdbClientCert{
+		ObjectMeta: metav1.ObjectMeta{Namespace: namespace, Name: "app"},
+		Spec:       api.CrdbClientCertSpec{ClusterName: "crdb", ClusterNamespace: "db", User: user},
+	}
+}
+
+func TestClientCertIssues(t *testing.T) {
+	ctx := context.Background()
+	oldCA, newCA := newTestCA(t), newTestCA(t)
+	signer, issued := oldCA, 0
+	r := newClientCertReconciler(t, &signer, &issued,
+		clientCertCluster("apps"), clientCertNodeSecret(oldCA.pem), newClientCert("apps", "app"))
+	key := types.NamespacedName{Namespace: "apps", Name: "app"}
+	req := ctrl.Request{NamespacedName: key}
+
+	res, err := r.Reconcile(ctx, req)
+	require.NoError(t, err)
+	require.Equal(t, 1, issued)
+	require.Equal(t, 5*time.Minute, res.RequeueAfter)
+
+	secret := &corev1.Secret{}
+	require.NoError(t, r.Get(ctx, key, secret))
+	require.Equal(t, oldCA.pem, secret.Data["ca.crt"])
+	require.Equal(t, secret.Data["tls.crt"], secret.Data["client.app.crt"])
+	require.Equal(t, []byte("key-of-app"), secret.Data["tls.key"])
+	require.Equal(t, []byte("key-of-app"), secret.Data["client.app.key"])
+	require.Len(t, secret.OwnerReferences, 1)
+	require.Equal(t, "app", secret.OwnerReferences[0].Name)
+
+	cc := &api.CrdbClientCert{}
+	require.NoError(t, r.Get(ctx, key, cc))
+	require.Equal(t, api.ClientCertIssued, cc.Status.Phase)
+	require.NotNil(t, cc.Status.NotAfter)
+	require.WithinDuration(t, cc.Status.NotAfter.Add(-time.Hour-time.Minute/3), cc.Status.RenewalTime.Time, time.Second)
+
+	// a valid certificate is kept
+	_, err = r.Reconcile(ctx, req)
+	require.NoError(t, err)
+	require.Equal(t, 1, issued)
+
+	// the CA is rotated: the nodes trust both CAs, then the new CA signs
+	bundle := append(append([]byte{}, oldCA.pem...), newCA.pem...)
+	node := &corev1.Secret{}
+	require.NoError(t, r.Get(ctx, types.NamespacedName{Namespace: "db", Name: "crdb-node"}, node))
+	node.Data["ca.crt"] = bundle
+	require.NoError(t, r.Update(ctx, node))
+	_, err = r.Reconcile(ctx, req)
+	require.NoError(t, err)
+	require.Equal(t, 2, issued)
+	require.NoError(t, r.Get(ctx, key, secret))
+	require.Equal(t, bundle, secret.Data["ca.crt"])
+
+	signer = newCA
+	_, err = r.Reconcile(ctx, req)
+	require.NoError(t, err)
+	require.Equal(t, 3, issued)
+	_, err = r.Reconcile(ctx, req)
+	require.NoError(t, err)
+	require.Equal(t, 3, issued)
+
+	// another user
+	require.NoError(t, r.Get(ctx, key, cc))
+	cc.Spec.User = "reporting"
+	require.NoError(t, r.Update(ctx, cc))
+	_, err = r.Reconcile(ctx, req)
+	require.NoError(t, err)
+	require.Equal(t, 4, issued)
+	require.NoError(t, r.Get(ctx, key, secret))
+	require.Contains(t, secret.Data, "client.reporting.crt")
+	require.NotContains(t, secret.Data, "client.app.crt")
+}
+
+func TestClientCertRefused(t *testing.T) {
+	ctx := context.Background()
+	ca := newTestCA(t)
+
+	tests := []struct {
+		name      string
+		namespace string
+		user      string
+		message   string
+	}{
+		{
+			name:      "namespace not allowed",
+			namespace: "other",
+			user:      "app",
+			message:   "namespace other is not in the clientCertNamespaces of cluster crdb",
+		},
+		{
+			name:      "root in another namespace",
+			namespace: "apps",
+			user:      "root",
+			message:   "the certificate of user root is only issued in namespace db",
+		},
+		{
+			name:      "node",
+			namespace: "db",
+			user:      "node",
+			message:   "the certificate of user node is only issued to the nodes",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			signer, issued := ca, 0
+			r := newClientCertReconciler(t, &signer, &issued,
+				clientCertCluster("apps"), clientCertNodeSecret(ca.pem), newClientCert(tt.namespace, tt.user))
+			key := types.NamespacedName{Namespace: tt.namespace, Name: "app"}
+
+			_, err := r.Reconcile(ctx, ctrl.Request{NamespacedName: key})
+			require.NoError(t, err)
+			require.Equal(t, 0, issued)
+
+			cc := &api.CrdbClientCert{}
+			require.NoError(t, r.Get(ctx, key, cc))
+			require.Equal(t, api.ClientCertFailed, cc.Status.Phase)
+			require.Equal(t, tt.message, cc.Status.Message)
+		})
+	}
+}
+
+func TestClientCertPending(t *testing.T) {
+	ctx := context.Background()
+	ca := newTestCA(t)
+	signer, issued := ca, 0
+	r := newClientCertReconciler(t, &signer, &issued, newClientCert("db", "app"))
+	key := types.NamespacedName{Namespace: "db", Name: "app"}
+	req := ctrl.Request{NamespacedName: key}
+
+	res, err := r.Reconcile(ctx, req)
+	require.NoError(t, err)
+	require.Equal(t, 30*time.Second, res.RequeueAfter)
+	cc := &api.CrdbClientCert{}
+	require.NoError(t, r.Get(ctx, key, cc))
+	require.Equal(t, api.ClientCertPending, cc.Status.Phase)
+	require.Equal(t, "cluster db/crdb not found", cc.Status.Message)
+
+	require.NoError(t, r.Create(ctx, clientCertCluster()))
+	_, err = r.Reconcile(ctx, req)
+	require.NoError(t, err)
+	require.NoError(t, r.Get(ctx, key, cc))
+	require.Equal(t, api.ClientCertPending, cc.Status.Phase)
+	require.Equal(t, "waiting for the certificates of cluster db/crdb", cc.Status.Message)
+
+	require.NoError(t, r.Create(ctx, clientCertNodeSecret(ca.pem)))
+	_, err = r.Reconcile(ctx, req)
+	require.NoError(t, err)
+	require.Equal(t, 1, issued)
+	require.NoError(t, r.Get(ctx, key, cc))
+	require.Equal(t, api.ClientCertIssued, cc.Status.Phase)
+	require.Empty(t, cc.Status.Message)
+}
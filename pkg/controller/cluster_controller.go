@@ -23,16 +23,30 @@ import (
 
 	api "github.com/cockroachdb/cockroach-operator/apis/v1alpha1"
 	"github.com/cockroachdb/cockroach-operator/pkg/actor"
+	"github.com/cockroachdb/cockroach-operator/pkg/features"
+	"github.com/cockroachdb/cockroach-operator/pkg/metrics"
 	"github.com/cockroachdb/cockroach-operator/pkg/resource"
+	"github.com/cockroachdb/cockroach-operator/pkg/utilfeature"
 	"github.com/go-logr/logr"
 	"go.uber.org/zap/zapcore"
 	appsv1 "k8s.io/api/apps/v1"
 	corev1 "k8s.io/api/core/v1"
+	networkingv1 "k8s.io/api/networking/v1"
 	policy "k8s.io/api/policy/v1beta1"
+	"k8s.io/apimachinery/pkg/api/equality"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/types"
 	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/builder"
 	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/controller/controllerutil"
+	"sigs.k8s.io/controller-runtime/pkg/event"
+	"sigs.k8s.io/controller-runtime/pkg/handler"
+	"sigs.k8s.io/controller-runtime/pkg/predicate"
 	"sigs.k8s.io/controller-runtime/pkg/reconcile"
+	"sigs.k8s.io/controller-runtime/pkg/source"
 )
 
 // ClusterReconciler reconciles a CrdbCluster object
@@ -47,24 +61,36 @@ type ClusterReconciler struct {
 
 // +kubebuilder:rbac:groups=crdb.cockroachlabs.com,resources=crdbclusters,verbs=get;list;watch;create;update;patch;delete
 // +kubebuilder:rbac:groups=crdb.cockroachlabs.com,resources=crdbclusters/status,verbs=get;update;patch
+// +kubebuilder:rbac:groups=crdb.cockroachlabs.com,resources=crdbexports,verbs=get;list;watch;update;patch
+// +kubebuilder:rbac:groups=crdb.cockroachlabs.com,resources=crdbexports/status,verbs=get;update;patch
 // +kubebuilder:rbac:groups=certificates.k8s.io,resources=certificatesigningrequests,verbs=get;list;watch;create;patch;delete
 // +kubebuilder:rbac:groups=certificates.k8s.io,resources=certificatesigningrequests/status,verbs=get;update;patch
 // +kubebuilder:rbac:groups=certificates.k8s.io,resources=certificatesigningrequests/approval,verbs=update
+// +kubebuilder:rbac:groups=core,resources=serviceaccounts,verbs=get;list;watch;create;update;patch
 // +kubebuilder:rbac:groups=core,resources=services,verbs=get;list;watch;create;update;patch;delete
 // +kubebuilder:rbac:groups=core,resources=services/status,verbs=get;update;patch
 // +kubebuilder:rbac:groups=core,resources=services/finalizers,verbs=get;list;watch
 // +kubebuilder:rbac:groups=core,resources=configmaps,verbs=get
 // +kubebuilder:rbac:groups=core,resources=configmaps/status,verbs=get
-// +kubebuilder:rbac:groups=core,resources=secrets,verbs=get;list;watch;create;update;patch
+// +kubebuilder:rbac:groups=core,resources=secrets,verbs=get;list;watch;create;update;patch;delete
 // +kubebuilder:rbac:groups=core,resources=pods/exec,verbs=create
-// +kubebuilder:rbac:groups=core,resources=pods,verbs=get
-// +kubebuilder:rbac:groups=core,resources=nodes,verbs=get
+// +kubebuilder:rbac:groups=core,resources=pods,verbs=get;list;watch;patch;delete
+// +kubebuilder:rbac:groups=core,resources=persistentvolumeclaims,verbs=get;list;watch;create;update;patch;delete
+// +kubebuilder:rbac:groups=core,resources=persistentvolumes,verbs=get
+// +kubebuilder:rbac:groups=core,resources=events,verbs=create;patch
+// +kubebuilder:rbac:groups=core,resources=pods/resize,verbs=patch
+// +kubebuilder:rbac:groups=core,resources=nodes,verbs=get;list;watch
+// +kubebuilder:rbac:groups=apps,resources=deployments,verbs=get;list;watch;create;update;patch;delete
 // +kubebuilder:rbac:groups=apps,resources=statefulsets,verbs=get;list;watch;create;update;patch;delete
 // +kubebuilder:rbac:groups=apps,resources=statefulsets/status,verbs=get;update;patch
 // +kubebuilder:rbac:groups=apps,resources=statefulsets/finalizers,verbs=get;list;watch
+// +kubebuilder:rbac:groups=metrics.k8s.io,resources=pods,verbs=get;list
+// +kubebuilder:rbac:groups=networking.k8s.io,resources=ingresses;networkpolicies,verbs=get;list;watch;create;update;patch;delete
+// +kubebuilder:rbac:groups=gateway.networking.k8s.io,resources=httproutes;tlsroutes,verbs=get;list;watch;create;update;patch;delete
 // +kubebuilder:rbac:groups=policy,resources=poddisruptionbudgets,verbs=get;list;watch;create;update;patch;delete
 // +kubebuilder:rbac:groups=policy,resources=poddisruptionbudgets/status,verbs=get
 // +kubebuilder:rbac:groups=policy,resources=poddisruptionbudgets/finalizers,verbs=get;list;watch
+// +kubebuilder:rbac:groups=storage.k8s.io,resources=storageclasses,verbs=get;list;watch
 // +kubebuilder:rbac:groups=batch,resources=jobs,verbs=get;list;watch;create;update;patch;delete
 // +kubebuilder:rbac:groups=batch,resources=jobs/status,verbs=get
 
@@ -90,11 +116,36 @@ func (r *ClusterReconciler) Reconcile(ctx context.Context, req reconcile.Request
 
 	cr := resource.ClusterPlaceholder(req.Name)
 	if err := fetcher.Fetch(cr); err != nil {
+		if apierrors.IsNotFound(err) {
+			metrics.DeleteCluster(req.Namespace, req.Name)
+		}
 		log.Error(err, "failed to retrieve CrdbCluster resource")
 		return requeueIfError(client.IgnoreNotFound(err))
 	}
 
+	if cr.DeletionTimestamp != nil {
+		return r.finalize(ctx, log, cr)
+	}
+
+	if resource.NeedsPVCFinalizer(cr) {
+		controllerutil.AddFinalizer(cr, resource.PVCFinalizer)
+		if err := r.Client.Update(ctx, cr); err != nil {
+			log.Error(err, "failed to add pvc finalizer")
+			return requeueIfError(err)
+		}
+		return requeueImmediately()
+	}
+
+	// the metrics are restored from the status when the operator restarts
+	metrics.SetUpgrade(cr.Namespace, cr.Name, cr.Status.Upgrade)
+
 	cluster := resource.NewCluster(cr)
+	// a paused cluster is left as it is, for instance while a GitOps tool
+	// suspends its syncs
+	if cluster.Spec().Paused {
+		return r.pause(ctx, log, &cluster, fetcher)
+	}
+
 	// on first run we need to save the status and exit to pass Openshift CI
 	// we added a state called Starting for field ClusterStatus to accomplish this
 	if cluster.Status().ClusterStatus == "" {
@@ -106,6 +157,17 @@ func (r *ClusterReconciler) Reconcile(ctx context.Context, req reconcile.Request
 		return requeueImmediately()
 	}
 
+	// the spec changed since some actions failed, run them again from a clean
+	// state instead of waiting for the cluster to be recreated
+	if cluster.ClearStaleFailures() {
+		log.Info("spec changed since the last failure, clearing failed actions")
+		if err := r.Client.Status().Update(ctx, cluster.Unwrap()); err != nil {
+			log.Error(err, "failed to update cluster status")
+			return requeueIfError(err)
+		}
+		return requeueImmediately()
+	}
+
 	//force version validation on mismatch between status and spec
 	if cluster.True(api.CrdbVersionChecked) {
 		if cluster.GetCockroachDBImageName() != cluster.Status().CrdbContainerImage {
@@ -124,9 +186,24 @@ func (r *ClusterReconciler) Reconcile(ctx context.Context, req reconcile.Request
 	// TODO: refactor this so that it's more like a state machine: determine what state we're in, and execute the actions
 	// necessary for that state.
 	actorsToExecute := r.Director.GetActorsToExecute(&cluster)
+	var deferred time.Duration
 	for _, a := range actorsToExecute {
 		log.Info(fmt.Sprintf("Running action with name: %s", a.GetActionType()))
 		if err := a.Act(ctx, &cluster); err != nil {
+			// Come back later, the other actions can run in the meantime
+			if deferredErr, ok := err.(actor.DeferredErr); ok {
+				log.Info("action deferred", "Action", a.GetActionType(), "reason", deferredErr.Error())
+				if deferred == 0 || deferredErr.RequeueAfter < deferred {
+					deferred = deferredErr.RequeueAfter
+				}
+				continue
+			}
+
+			// Retry according to the retry policy of the reason of the failure
+			if failure, ok := err.(actor.FailureErr); ok {
+				return r.retryOrFail(ctx, log, &cluster, a.GetActionType(), failure)
+			}
+
 			// Save the error on the Status for each action
 			log.Info("Error on action", "Action", a.GetActionType(), "err", err.Error())
 			cluster.SetActionFailed(a.GetActionType(), err.Error())
@@ -158,7 +235,7 @@ func (r *ClusterReconciler) Reconcile(ctx context.Context, req reconcile.Request
 		}
 		// reset errors on each run  if there was an error,
 		// this is to cover the not ready case
-		if cluster.Failed(a.GetActionType()) {
+		if cluster.Failed(a.GetActionType()) || cluster.Retrying(a.GetActionType()) {
 			cluster.SetActionFinished(a.GetActionType())
 		}
 
@@ -170,6 +247,11 @@ func (r *ClusterReconciler) Reconcile(ctx context.Context, req reconcile.Request
 		}
 	}
 
+	// the pollers check the cluster again even when nothing changes
+	if poll := actor.PollInterval(actorsToExecute, &cluster); poll > 0 && (deferred == 0 || poll < deferred) {
+		deferred = poll
+	}
+
 	// Check if the resource has been updated while the controller worked on it
 	fresh, err := cluster.IsFresh(fetcher)
 	if err != nil {
@@ -182,24 +264,295 @@ func (r *ClusterReconciler) Reconcile(ctx context.Context, req reconcile.Request
 		log.V(int(zapcore.DebugLevel)).Info("cluster resources is not up to date")
 		return requeueImmediately()
 	}
+	// the scale subresource reads the number of pods and their selector from
+	// the status
+	ss := &appsv1.StatefulSet{ObjectMeta: metav1.ObjectMeta{Name: cluster.StatefulSetName()}}
+	if err := fetcher.Fetch(ss); client.IgnoreNotFound(err) != nil {
+		log.Error(err, "failed to retrieve statefulset")
+		return requeueIfError(err)
+	}
+	cluster.SetScaleStatus(ss.Status.Replicas)
+	pools, err := resource.NodePoolStatefulSets(ctx, r.Client, &cluster)
+	if err != nil {
+		log.Error(err, "failed to retrieve the statefulsets of the node pools")
+		return requeueIfError(err)
+	}
+	cluster.SetNodePoolsStatus(pools)
+	cluster.SetProgressingCondition(ss)
+
 	cluster.SetClusterStatus()
 	if err := r.Client.Status().Update(ctx, cluster.Unwrap()); err != nil {
 		log.Error(err, "failed to update cluster status")
 		return requeueIfError(err)
 	}
 
+	if deferred > 0 {
+		log.V(int(zapcore.InfoLevel)).Info("reconciliation completed, with deferred actions", "requeueAfter", deferred.String())
+		return requeueAfter(deferred, nil)
+	}
+
 	log.V(int(zapcore.InfoLevel)).Info("reconciliation completed")
 	return noRequeue()
 }
 
+// retryOrFail records the failure of an action with a known reason and
+// requeues the request if the retry policy of the reason allows another retry.
+// Otherwise the failure is terminal: the action only runs again when the
+// cluster or its resources change.
+func (r *ClusterReconciler) retryOrFail(ctx context.Context, log logr.Logger, cluster *resource.Cluster, atype api.ActionType, failure actor.FailureErr) (reconcile.Result, error) {
+	retry := cluster.Retries(atype, failure.Reason) + 1
+	wait, ok := cluster.Spec().RetryPolicyFor(failure.Reason).RetryAfter(retry)
+	if ok {
+		cluster.SetActionRetrying(atype, failure.Reason, failure.Error())
+	} else {
+		cluster.SetActionFailedWithReason(atype, failure.Reason, failure.Error())
+	}
+
+	if err := r.Client.Status().Update(ctx, cluster.Unwrap()); err != nil {
+		log.Error(err, "failed to update cluster status")
+		return requeueIfError(err)
+	}
+
+	if !ok {
+		log.Error(failure, "action failed, no retries left", "Action", atype, "reason", failure.Reason)
+		return noRequeue()
+	}
+
+	log.Info("retrying action", "Action", atype, "reason", failure.Reason, "retry", retry, "after", wait.String())
+	return requeueAfter(wait, nil)
+}
+
+// pause records in the status that the reconciliation of the cluster is
+// paused. The actors run again once spec.paused is unset. In the meantime the
+// observers keep the health of the cluster up to date in the status and the
+// metrics, and the number of pods is still reported, but nothing is changed.
+func (r *ClusterReconciler) pause(ctx context.Context, log logr.Logger, cluster *resource.Cluster, fetcher resource.Fetcher) (reconcile.Result, error) {
+	status := cluster.Status().DeepCopy()
+
+	var deferred time.Duration
+	observers := r.Director.GetObserversToExecute(cluster)
+	for _, a := range observers {
+		err := a.Act(ctx, cluster)
+		if deferredErr, ok := err.(actor.DeferredErr); ok {
+			if deferred == 0 || deferredErr.RequeueAfter < deferred {
+				deferred = deferredErr.RequeueAfter
+			}
+		} else if err != nil {
+			log.Info("observer failed while paused", "Action", a.GetActionType(), "err", err.Error())
+		}
+	}
+	if poll := actor.PollInterval(observers, cluster); poll > 0 && (deferred == 0 || poll < deferred) {
+		deferred = poll
+	}
+
+	ss := &appsv1.StatefulSet{ObjectMeta: metav1.ObjectMeta{Name: cluster.StatefulSetName()}}
+	if err := fetcher.Fetch(ss); client.IgnoreNotFound(err) != nil {
+		log.Error(err, "failed to retrieve statefulset")
+		return requeueIfError(err)
+	}
+	cluster.SetScaleStatus(ss.Status.Replicas)
+	pools, err := resource.NodePoolStatefulSets(ctx, r.Client, cluster)
+	if err != nil {
+		log.Error(err, "failed to retrieve the statefulsets of the node pools")
+		return requeueIfError(err)
+	}
+	cluster.SetNodePoolsStatus(pools)
+	cluster.SetPausedCondition()
+
+	if !equality.Semantic.DeepEqual(status, cluster.Status()) {
+		log.Info("reconciliation is paused, updating the observed status")
+		if err := r.Client.Status().Update(ctx, cluster.Unwrap()); err != nil {
+			log.Error(err, "failed to update cluster status")
+			return requeueIfError(err)
+		}
+	} else {
+		log.V(int(zapcore.DebugLevel)).Info("reconciliation is paused")
+	}
+
+	if deferred > 0 {
+		return requeueAfter(deferred, nil)
+	}
+	return noRequeue()
+}
+
+// finalize applies the PVC reclaim policy of a cluster that is being deleted,
+// and then removes the PVC finalizer. Owned resources are deleted by the
+// garbage collector.
+func (r *ClusterReconciler) finalize(ctx context.Context, log logr.Logger, cr *api.CrdbCluster) (reconcile.Result, error) {
+	if !controllerutil.ContainsFinalizer(cr, resource.PVCFinalizer) {
+		return noRequeue()
+	}
+
+	done, err := resource.ReclaimPVCs(ctx, r.Client, cr)
+	if err != nil {
+		log.Error(err, "failed to reclaim pvcs")
+		return requeueIfError(err)
+	}
+	if !done {
+		log.V(int(zapcore.DebugLevel)).Info("waiting for the pods to be gone to delete the pvcs")
+		return requeueAfter(5*time.Second, nil)
+	}
+
+	controllerutil.RemoveFinalizer(cr, resource.PVCFinalizer)
+	if err := r.Client.Update(ctx, cr); err != nil {
+		log.Error(err, "failed to remove pvc finalizer")
+		return requeueIfError(client.IgnoreNotFound(err))
+	}
+
+	log.Info("reclaimed pvcs", "policy", cr.Spec.DataStore.ReclaimPolicy)
+	return noRequeue()
+}
+
 // SetupWithManager registers the controller with the controller.Manager from controller-runtime
 func (r *ClusterReconciler) SetupWithManager(mgr ctrl.Manager) error {
-	return ctrl.NewControllerManagedBy(mgr).
+	b := ctrl.NewControllerManagedBy(mgr).
 		For(&api.CrdbCluster{}).
 		Owns(&corev1.Service{}).
 		Owns(&appsv1.StatefulSet{}).
+		Owns(&appsv1.Deployment{}).
 		Owns(&policy.PodDisruptionBudget{}).
-		Complete(r)
+		Owns(&networkingv1.Ingress{}).
+		Owns(&networkingv1.NetworkPolicy{}).
+		// the secrets are read through the cache of the manager, whose
+		// informer holds every secret of the watched namespaces in memory
+		// whether or not they are watched; watching them adds no cache, and
+		// only the changes of the secrets the clusters refer to are queued
+		Watches(&source.Kind{Type: &corev1.Secret{}}, handler.EnqueueRequestsFromMapFunc(r.clustersReferencing),
+			builder.WithPredicates(r.referencedSecretChanged()))
+
+	// the relaxation of the pod anti-affinity follows the number of nodes the
+	// pods can be scheduled on
+	if utilfeature.DefaultMutableFeatureGate.Enabled(features.AffinityRules) {
+		b = b.Watches(&source.Kind{Type: &corev1.Node{}}, handler.EnqueueRequestsFromMapFunc(r.clustersRelaxingAntiAffinity),
+			builder.WithPredicates(schedulingChanged))
+	}
+	// the cluster runs the exports, so a new or changed export is scheduled
+	// right away
+	if utilfeature.DefaultMutableFeatureGate.Enabled(features.CrdbExports) {
+		b = b.Watches(&source.Kind{Type: &api.CrdbExport{}}, handler.EnqueueRequestsFromMapFunc(clusterOfExport))
+	}
+	// the status of the cluster reports the health of its backups, which
+	// changes with the status of its CrdbBackups
+	if utilfeature.DefaultMutableFeatureGate.Enabled(features.BackupHealth) && utilfeature.DefaultMutableFeatureGate.Enabled(features.CrdbBackups) {
+		b = b.Watches(&source.Kind{Type: &api.CrdbBackup{}}, handler.EnqueueRequestsFromMapFunc(clusterOfBackup))
+	}
+	return b.Complete(r)
+}
+
+// clusterOfExport maps an export to the cluster it runs on.
+func clusterOfExport(obj client.Object) []reconcile.Request {
+	export, ok := obj.(*api.CrdbExport)
+	if !ok || export.Spec.ClusterName == "" {
+		return nil
+	}
+	return []reconcile.Request{{NamespacedName: types.NamespacedName{Namespace: export.Namespace, Name: export.Spec.ClusterName}}}
+}
+
+// clusterOfBackup maps a backup to the cluster it backs up.
+func clusterOfBackup(obj client.Object) []reconcile.Request {
+	backup, ok := obj.(*api.CrdbBackup)
+	if !ok || backup.Spec.ClusterName == "" {
+		return nil
+	}
+	return []reconcile.Request{{NamespacedName: types.NamespacedName{Namespace: backup.Namespace, Name: backup.Spec.ClusterName}}}
+}
+
+// clustersRelaxingAntiAffinity maps a node to the clusters that may relax their
+// pod anti-affinity, so that the relaxation follows the number of schedulable
+// nodes.
+func (r *ClusterReconciler) clustersRelaxingAntiAffinity(node client.Object) []reconcile.Request {
+	clusters := &api.CrdbClusterList{}
+	if err := r.Client.List(context.Background(), clusters); err != nil {
+		r.Log.Error(err, "failed to list clusters relaxing their anti-affinity", "node", node.GetName())
+		return nil
+	}
+
+	var requests []reconcile.Request
+	for i := range clusters.Items {
+		cluster := resource.NewCluster(&clusters.Items[i])
+		if cluster.CanRelaxAntiAffinity() {
+			requests = append(requests, reconcile.Request{NamespacedName: cluster.ObjectKey()})
+		}
+	}
+	return requests
+}
+
+// schedulingChanged filters out the updates of nodes that do not change whether
+// pods can be scheduled on them, such as the status updates of the kubelet.
+var schedulingChanged = predicate.Funcs{
+	UpdateFunc: func(e event.UpdateEvent) bool {
+		old, ok := e.ObjectOld.(*corev1.Node)
+		if !ok {
+			return true
+		}
+		node, ok := e.ObjectNew.(*corev1.Node)
+		if !ok {
+			return true
+		}
+
+		return old.Spec.Unschedulable != node.Spec.Unschedulable ||
+			resource.NodeReady(old) != resource.NodeReady(node) ||
+			!equality.Semantic.DeepEqual(old.Spec.Taints, node.Spec.Taints)
+	},
+}
+
+// referencedSecretChanged filters out the events of the secrets no cluster
+// refers to, and the updates that do not change the content of a secret, such
+// as the ones of its metadata.
+func (r *ClusterReconciler) referencedSecretChanged() predicate.Predicate {
+	referenced := func(secret client.Object) bool {
+		return len(r.clustersReferencing(secret)) > 0
+	}
+	return predicate.Funcs{
+		CreateFunc: func(e event.CreateEvent) bool {
+			return referenced(e.Object)
+		},
+		DeleteFunc: func(e event.DeleteEvent) bool {
+			return referenced(e.Object)
+		},
+		UpdateFunc: func(e event.UpdateEvent) bool {
+			old, ok := e.ObjectOld.(*corev1.Secret)
+			if !ok {
+				return true
+			}
+			secret, ok := e.ObjectNew.(*corev1.Secret)
+			if !ok {
+				return true
+			}
+
+			if old.Type == secret.Type && equality.Semantic.DeepEqual(old.Data, secret.Data) {
+				return false
+			}
+			return referenced(secret)
+		},
+		GenericFunc: func(e event.GenericEvent) bool {
+			return referenced(e.Object)
+		},
+	}
+}
+
+// clustersReferencing maps a secret to the clusters that refer to it in their
+// spec, so that a cluster waiting for a secret created by another controller,
+// such as External Secrets Operator, is reconciled as soon as the secret
+// appears or changes.
+func (r *ClusterReconciler) clustersReferencing(secret client.Object) []reconcile.Request {
+	clusters := &api.CrdbClusterList{}
+	if err := r.Client.List(context.Background(), clusters, client.InNamespace(secret.GetNamespace())); err != nil {
+		r.Log.Error(err, "failed to list clusters referencing secret", "secret", client.ObjectKeyFromObject(secret))
+		return nil
+	}
+
+	var requests []reconcile.Request
+	for i := range clusters.Items {
+		cluster := resource.NewCluster(&clusters.Items[i])
+		for _, name := range cluster.ReferencedSecrets() {
+			if name == secret.GetName() {
+				requests = append(requests, reconcile.Request{NamespacedName: cluster.ObjectKey()})
+				break
+			}
+		}
+	}
+	return requests
 }
 
 // InitClusterReconciler returns a registrator for new controller instance with the default logger
@@ -214,7 +567,7 @@ func InitClusterReconcilerWithLogger(l logr.Logger) func(ctrl.Manager) error {
 			Client:   mgr.GetClient(),
 			Log:      l,
 			Scheme:   mgr.GetScheme(),
-			Director: actor.NewDirector(mgr.GetScheme(), mgr.GetClient(), mgr.GetConfig()),
+			Director: actor.NewDirector(mgr.GetScheme(), mgr.GetClient(), mgr.GetConfig(), mgr.GetEventRecorderFor("cockroach-operator")),
 		}).SetupWithManager(mgr)
 	}
 }
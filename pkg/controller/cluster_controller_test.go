@@ -25,18 +25,22 @@ import (
 	api "github.com/cockroachdb/cockroach-operator/apis/v1alpha1"
 	"github.com/cockroachdb/cockroach-operator/pkg/actor"
 	"github.com/cockroachdb/cockroach-operator/pkg/controller"
+	"github.com/cockroachdb/cockroach-operator/pkg/labels"
 	"github.com/cockroachdb/cockroach-operator/pkg/resource"
 	"github.com/cockroachdb/cockroach-operator/pkg/testutil"
 	"github.com/go-logr/zapr"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
 	"go.uber.org/zap/zaptest"
+	appsv1 "k8s.io/api/apps/v1"
 	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/apimachinery/pkg/runtime"
 	"k8s.io/apimachinery/pkg/types"
 	ctrl "sigs.k8s.io/controller-runtime"
 	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+	"sigs.k8s.io/controller-runtime/pkg/event"
 )
 
 type fakeActor struct {
@@ -54,14 +58,29 @@ func (a *fakeActor) GetActionType() api.ActionType {
 	return api.UnknownAction
 }
 
+// fakePoller is an actor that polls the cluster every interval
+type fakePoller struct {
+	fakeActor
+	interval time.Duration
+}
+
+func (p *fakePoller) PollInterval(*resource.Cluster) time.Duration {
+	return p.interval
+}
+
 type fakeDirector struct {
-	actorsToExecute []actor.Actor
+	actorsToExecute    []actor.Actor
+	observersToExecute []actor.Actor
 }
 
 func (fd *fakeDirector) GetActorsToExecute(cluster *resource.Cluster) []actor.Actor {
 	return fd.actorsToExecute
 }
 
+func (fd *fakeDirector) GetObserversToExecute(cluster *resource.Cluster) []actor.Actor {
+	return fd.observersToExecute
+}
+
 func TestReconcile(t *testing.T) {
 	scheme := testutil.InitScheme(t)
 
@@ -146,3 +165,353 @@ func TestReconcile(t *testing.T) {
 	}
 
 }
+
+func TestReconcileReclaimsPVCs(t *testing.T) {
+	scheme := testutil.InitScheme(t)
+	ctx := context.TODO()
+
+	cluster := testutil.NewBuilder("cluster").Namespaced("test-namespace").WithNodeCount(1).Cr()
+	cluster.Spec.DataStore.ReclaimPolicy = api.PVCReclaimDelete
+	pvc := &corev1.PersistentVolumeClaim{ObjectMeta: metav1.ObjectMeta{
+		Namespace: "test-namespace",
+		Name:      "datadir-cluster-0",
+		Labels:    labels.Common(cluster).Selector(nil),
+	}}
+
+	cl := fake.NewFakeClientWithScheme(scheme, cluster, pvc)
+	key := types.NamespacedName{Namespace: cluster.Namespace, Name: cluster.Name}
+	r := &controller.ClusterReconciler{
+		Client:   cl,
+		Log:      zapr.NewLogger(zaptest.NewLogger(t)).WithName("cluster-controller-test"),
+		Scheme:   scheme,
+		Director: &fakeDirector{},
+	}
+
+	// the finalizer is added on the first reconcile
+	actual, err := r.Reconcile(ctx, ctrl.Request{NamespacedName: key})
+	require.NoError(t, err)
+	assert.Equal(t, ctrl.Result{Requeue: true}, actual)
+
+	cr := &api.CrdbCluster{}
+	require.NoError(t, cl.Get(ctx, key, cr))
+	require.Contains(t, cr.Finalizers, resource.PVCFinalizer)
+
+	// the fake client deletes objects right away, so mark the cluster as
+	// being deleted instead
+	now := metav1.Now()
+	cr.DeletionTimestamp = &now
+	require.NoError(t, cl.Update(ctx, cr))
+
+	for i := 0; i < 2; i++ {
+		_, err := r.Reconcile(ctx, ctrl.Request{NamespacedName: key})
+		require.NoError(t, err)
+	}
+
+	require.NoError(t, cl.Get(ctx, key, cr))
+	require.NotContains(t, cr.Finalizers, resource.PVCFinalizer)
+	require.True(t, apierrors.IsNotFound(cl.Get(ctx, types.NamespacedName{Namespace: pvc.Namespace, Name: pvc.Name}, &corev1.PersistentVolumeClaim{})))
+}
+
+func TestReconcileUpdatesScaleStatus(t *testing.T) {
+	scheme := testutil.InitScheme(t)
+	ctx := context.TODO()
+
+	cluster := testutil.NewBuilder("cluster").Namespaced("test-namespace").WithNodeCount(3).Cr()
+	cluster.Status.ClusterStatus = "Starting"
+	ss := &appsv1.StatefulSet{
+		ObjectMeta: metav1.ObjectMeta{Namespace: cluster.Namespace, Name: cluster.Name},
+		Status:     appsv1.StatefulSetStatus{Replicas: 3},
+	}
+
+	cl := fake.NewFakeClientWithScheme(scheme, cluster, ss)
+	key := types.NamespacedName{Namespace: cluster.Namespace, Name: cluster.Name}
+	r := &controller.ClusterReconciler{
+		Client:   cl,
+		Log:      zapr.NewLogger(zaptest.NewLogger(t)).WithName("cluster-controller-test"),
+		Scheme:   scheme,
+		Director: &fakeDirector{},
+	}
+
+	actual, err := r.Reconcile(ctx, ctrl.Request{NamespacedName: key})
+	require.NoError(t, err)
+	assert.Equal(t, ctrl.Result{}, actual)
+
+	cr := &api.CrdbCluster{}
+	require.NoError(t, cl.Get(ctx, key, cr))
+	assert.Equal(t, int32(3), cr.Status.Nodes)
+	assert.Equal(t, "app.kubernetes.io/component=database,app.kubernetes.io/instance=cluster,app.kubernetes.io/name=cockroachdb,!crdb.cockroachlabs.com/node-pool", cr.Status.Selector)
+}
+
+func TestReconcileRequeuesThePollers(t *testing.T) {
+	scheme := testutil.InitScheme(t)
+	ctx := context.TODO()
+
+	cluster := testutil.NewBuilder("cluster").Namespaced("test-namespace").WithNodeCount(3).Cr()
+	cluster.Status.ClusterStatus = "Starting"
+
+	cl := fake.NewFakeClientWithScheme(scheme, cluster)
+	key := types.NamespacedName{Namespace: cluster.Namespace, Name: cluster.Name}
+	r := &controller.ClusterReconciler{
+		Client: cl,
+		Log:    zapr.NewLogger(zaptest.NewLogger(t)).WithName("cluster-controller-test"),
+		Scheme: scheme,
+		Director: &fakeDirector{
+			actorsToExecute: []actor.Actor{
+				&fakeActor{},
+				&fakePoller{interval: time.Minute},
+				&fakePoller{interval: 30 * time.Second},
+				// a poller with nothing to poll does not requeue the request
+				&fakePoller{},
+			},
+		},
+	}
+
+	actual, err := r.Reconcile(ctx, ctrl.Request{NamespacedName: key})
+	require.NoError(t, err)
+	assert.Equal(t, ctrl.Result{RequeueAfter: 30 * time.Second}, actual)
+
+	// a deferred action that waits less wins
+	r.Director = &fakeDirector{
+		actorsToExecute: []actor.Actor{
+			&fakePoller{interval: time.Minute},
+			&fakeActor{err: actor.DeferredErr{Err: errors.New("not ready"), RequeueAfter: 10 * time.Second}},
+		},
+	}
+	actual, err = r.Reconcile(ctx, ctrl.Request{NamespacedName: key})
+	require.NoError(t, err)
+	assert.Equal(t, ctrl.Result{RequeueAfter: 10 * time.Second}, actual)
+}
+
+func TestReconcileRetriesFailuresWithReason(t *testing.T) {
+	scheme := testutil.InitScheme(t)
+	ctx := context.TODO()
+
+	cluster := testutil.NewBuilder("cluster").Namespaced("test-namespace").WithNodeCount(3).Cr()
+	cluster.Status.ClusterStatus = "Starting"
+	one := int32(1)
+	cluster.Spec.RetryPolicies = []api.RetryPolicy{
+		{Reason: api.CertErrorReason, MaxRetries: &one, Backoff: &metav1.Duration{Duration: 20 * time.Second}},
+	}
+
+	cl := fake.NewFakeClientWithScheme(scheme, cluster)
+	key := types.NamespacedName{Namespace: cluster.Namespace, Name: cluster.Name}
+	r := &controller.ClusterReconciler{
+		Client: cl,
+		Log:    zapr.NewLogger(zaptest.NewLogger(t)).WithName("cluster-controller-test"),
+		Scheme: scheme,
+		Director: &fakeDirector{
+			actorsToExecute: []actor.Actor{&fakeActor{
+				err: actor.FailureErr{Reason: api.CertErrorReason, Err: errors.New("error generating CA")},
+			}},
+		},
+	}
+
+	tests := []struct {
+		name    string
+		want    ctrl.Result
+		status  string
+		retries int32
+	}{
+		{name: "failure is retried", want: ctrl.Result{RequeueAfter: 20 * time.Second}, status: "Retrying", retries: 1},
+		{name: "failure is terminal when no retries are left", want: ctrl.Result{}, status: "Failed", retries: 1},
+	}
+
+	for _, tt := range tests {
+		actual, err := r.Reconcile(ctx, ctrl.Request{NamespacedName: key})
+		require.NoError(t, err, tt.name)
+		assert.Equal(t, tt.want, actual, tt.name)
+
+		cr := &api.CrdbCluster{}
+		require.NoError(t, cl.Get(ctx, key, cr))
+		require.Len(t, cr.Status.OperatorActions, 1, tt.name)
+		action := cr.Status.OperatorActions[0]
+		assert.Equal(t, tt.status, cr.Status.ClusterStatus, tt.name)
+		assert.Equal(t, tt.status, action.Status, tt.name)
+		assert.Equal(t, api.CertErrorReason, action.Reason, tt.name)
+		assert.Equal(t, tt.retries, action.Retries, tt.name)
+	}
+}
+
+func TestReconcileClearsFailuresWhenSpecChanges(t *testing.T) {
+	scheme := testutil.InitScheme(t)
+	ctx := context.TODO()
+
+	cluster := testutil.NewBuilder("cluster").Namespaced("test-namespace").WithNodeCount(3).Cr()
+	cluster.Generation = 2
+	cluster.Status.ClusterStatus = "Failed"
+	cluster.Status.ObservedGeneration = 1
+	cluster.Status.OperatorActions = []api.ClusterAction{
+		{Type: api.VersionCheckerAction, Status: "Failed", Message: "crdb version v0.0.0 not supported"},
+		{Type: api.DeployAction, Status: "Finished"},
+	}
+
+	cl := fake.NewFakeClientWithScheme(scheme, cluster)
+	key := types.NamespacedName{Namespace: cluster.Namespace, Name: cluster.Name}
+	r := &controller.ClusterReconciler{
+		Client:   cl,
+		Log:      zapr.NewLogger(zaptest.NewLogger(t)).WithName("cluster-controller-test"),
+		Scheme:   scheme,
+		Director: &fakeDirector{},
+	}
+
+	actual, err := r.Reconcile(ctx, ctrl.Request{NamespacedName: key})
+	require.NoError(t, err)
+	assert.Equal(t, ctrl.Result{Requeue: true}, actual)
+
+	cr := &api.CrdbCluster{}
+	require.NoError(t, cl.Get(ctx, key, cr))
+	assert.Equal(t, "Finished", cr.Status.ClusterStatus)
+	assert.Equal(t, []api.ClusterAction{{Type: api.DeployAction, Status: "Finished"}}, cr.Status.OperatorActions)
+
+	// the failures of the current spec are kept
+	actual, err = r.Reconcile(ctx, ctrl.Request{NamespacedName: key})
+	require.NoError(t, err)
+	assert.Equal(t, ctrl.Result{}, actual)
+
+	require.NoError(t, cl.Get(ctx, key, cr))
+	assert.Equal(t, int64(2), cr.Status.ObservedGeneration)
+}
+
+func TestSecretsAreMappedToTheClustersReferencingThem(t *testing.T) {
+	scheme := testutil.InitScheme(t)
+
+	custom := testutil.NewBuilder("custom").Namespaced("test-namespace").WithTLS().WithNodeTLS("custom-certs").Cr()
+	generated := testutil.NewBuilder("generated").Namespaced("test-namespace").WithTLS().Cr()
+	other := testutil.NewBuilder("other").Namespaced("other-namespace").WithTLS().WithNodeTLS("custom-certs").Cr()
+
+	r := &controller.ClusterReconciler{
+		Client: fake.NewFakeClientWithScheme(scheme, custom, generated, other),
+		Log:    zapr.NewLogger(zaptest.NewLogger(t)).WithName("cluster-controller-test"),
+		Scheme: scheme,
+	}
+
+	secret := &corev1.Secret{ObjectMeta: metav1.ObjectMeta{Namespace: "test-namespace", Name: "custom-certs"}}
+	assert.Equal(t, []ctrl.Request{
+		{NamespacedName: types.NamespacedName{Namespace: "test-namespace", Name: "custom"}},
+	}, controller.ClustersReferencing(r, secret))
+
+	secret.Name = "unrelated"
+	assert.Empty(t, controller.ClustersReferencing(r, secret))
+}
+
+func TestOnlyTheChangesOfReferencedSecretsAreQueued(t *testing.T) {
+	scheme := testutil.InitScheme(t)
+
+	cluster := testutil.NewBuilder("custom").Namespaced("test-namespace").WithTLS().WithNodeTLS("custom-certs").Cr()
+	r := &controller.ClusterReconciler{
+		Client: fake.NewFakeClientWithScheme(scheme, cluster),
+		Log:    zapr.NewLogger(zaptest.NewLogger(t)).WithName("cluster-controller-test"),
+		Scheme: scheme,
+	}
+	p := controller.ReferencedSecretChanged(r)
+
+	secret := &corev1.Secret{
+		ObjectMeta: metav1.ObjectMeta{Namespace: "test-namespace", Name: "custom-certs"},
+		Data:       map[string][]byte{"tls.crt": []byte("old")},
+	}
+	unrelated := &corev1.Secret{ObjectMeta: metav1.ObjectMeta{Namespace: "test-namespace", Name: "unrelated"}}
+	assert.True(t, p.Create(event.CreateEvent{Object: secret}))
+	assert.False(t, p.Create(event.CreateEvent{Object: unrelated}))
+	assert.True(t, p.Delete(event.DeleteEvent{Object: secret}))
+	assert.False(t, p.Delete(event.DeleteEvent{Object: unrelated}))
+
+	relabeled := secret.DeepCopy()
+	relabeled.Labels = map[string]string{"team": "storage"}
+	assert.False(t, p.Update(event.UpdateEvent{ObjectOld: secret, ObjectNew: relabeled}))
+
+	renewed := secret.DeepCopy()
+	renewed.Data["tls.crt"] = []byte("new")
+	assert.True(t, p.Update(event.UpdateEvent{ObjectOld: secret, ObjectNew: renewed}))
+
+	changed := unrelated.DeepCopy()
+	changed.Data = map[string][]byte{"password": []byte("secret")}
+	assert.False(t, p.Update(event.UpdateEvent{ObjectOld: unrelated, ObjectNew: changed}))
+}
+
+func TestReconcileSkipsPausedClusters(t *testing.T) {
+	scheme := testutil.InitScheme(t)
+	ctx := context.TODO()
+
+	cluster := testutil.NewBuilder("cluster").Namespaced("test-namespace").WithNodeCount(3).Cr()
+	cluster.Generation = 2
+	cluster.Status.ClusterStatus = "Finished"
+	cluster.Spec.Paused = true
+
+	cl := fake.NewFakeClientWithScheme(scheme, cluster)
+	key := types.NamespacedName{Namespace: cluster.Namespace, Name: cluster.Name}
+	r := &controller.ClusterReconciler{
+		Client: cl,
+		Log:    zapr.NewLogger(zaptest.NewLogger(t)).WithName("cluster-controller-test"),
+		Scheme: scheme,
+		Director: &fakeDirector{
+			actorsToExecute: []actor.Actor{&fakeActor{err: errors.New("the actors must not run")}},
+		},
+	}
+
+	for i := 0; i < 2; i++ {
+		actual, err := r.Reconcile(ctx, ctrl.Request{NamespacedName: key})
+		require.NoError(t, err)
+		assert.Equal(t, ctrl.Result{}, actual)
+	}
+
+	cr := &api.CrdbCluster{}
+	require.NoError(t, cl.Get(ctx, key, cr))
+	assert.Equal(t, int64(2), cr.Status.ObservedGeneration)
+	assert.Empty(t, cr.Status.OperatorActions)
+	health, _ := cr.Health()
+	assert.Equal(t, api.HealthSuspended, health)
+
+	var progressing api.ClusterCondition
+	for _, c := range cr.Status.Conditions {
+		if c.Type == api.ProgressingCondition {
+			progressing = c
+		}
+	}
+	assert.Equal(t, metav1.ConditionFalse, progressing.Status)
+	assert.Equal(t, "Paused", progressing.Reason)
+
+	// the actors run again once the cluster is resumed
+	cr.Spec.Paused = false
+	require.NoError(t, cl.Update(ctx, cr))
+	_, err := r.Reconcile(ctx, ctrl.Request{NamespacedName: key})
+	require.EqualError(t, err, "the actors must not run")
+}
+
+func TestReconcileObservesPausedClusters(t *testing.T) {
+	scheme := testutil.InitScheme(t)
+	ctx := context.TODO()
+
+	cluster := testutil.NewBuilder("cluster").Namespaced("test-namespace").WithNodeCount(3).Cr()
+	cluster.Status.ClusterStatus = "Finished"
+	cluster.Spec.Paused = true
+	ss := &appsv1.StatefulSet{
+		ObjectMeta: metav1.ObjectMeta{Namespace: cluster.Namespace, Name: cluster.Name},
+		Status:     appsv1.StatefulSetStatus{Replicas: 2},
+	}
+
+	cl := fake.NewFakeClientWithScheme(scheme, cluster, ss)
+	key := types.NamespacedName{Namespace: cluster.Namespace, Name: cluster.Name}
+	r := &controller.ClusterReconciler{
+		Client: cl,
+		Log:    zapr.NewLogger(zaptest.NewLogger(t)).WithName("cluster-controller-test"),
+		Scheme: scheme,
+		Director: &fakeDirector{
+			actorsToExecute: []actor.Actor{&fakeActor{err: errors.New("the actors must not run")}},
+			observersToExecute: []actor.Actor{
+				&fakePoller{interval: time.Minute},
+				&fakeActor{err: actor.DeferredErr{Err: errors.New("not ready"), RequeueAfter: 30 * time.Second}},
+				&fakeActor{err: errors.New("the observers do not stop the reconciliation")},
+			},
+		},
+	}
+
+	actual, err := r.Reconcile(ctx, ctrl.Request{NamespacedName: key})
+	require.NoError(t, err)
+	assert.Equal(t, ctrl.Result{RequeueAfter: 30 * time.Second}, actual)
+
+	cr := &api.CrdbCluster{}
+	require.NoError(t, cl.Get(ctx, key, cr))
+	assert.Equal(t, int32(2), cr.Status.Nodes)
+	health, _ := cr.Health()
+	assert.Equal(t, api.HealthSuspended, health)
+}
@@ -0,0 +1,224 @@
+/*
+Copyright 2021 The Cockroach Authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    https://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controller
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	api "github.com/cockroachdb/cockroach-operator/apis/v1alpha1"
+	"github.com/cockroachdb/cockroach-operator/pkg/kube"
+	"github.com/cockroachdb/cockroach-operator/pkg/resource"
+	"github.com/go-logr/logr"
+	kbatch "k8s.io/api/batch/v1"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/equality"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/types"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
+)
+
+// clusterNotFoundInterval is how often a CrdbJob checks whether its cluster was
+// created
+const clusterNotFoundInterval = 30 * time.Second
+
+// JobReconciler reconciles a CrdbJob object
+type JobReconciler struct {
+	client.Client
+	Log    logr.Logger
+	Scheme *runtime.Scheme
+}
+
+// +kubebuilder:rbac:groups=crdb.cockroachlabs.com,resources=crdbjobs,verbs=get;list;watch;update;patch;delete
+// +kubebuilder:rbac:groups=crdb.cockroachlabs.com,resources=crdbjobs/status,verbs=get;update;patch
+
+// Reconcile runs the command of a CrdbJob as a Job with the certificates of
+// its cluster, and reports the phase and the exit code of the command in the
+// status. A finished CrdbJob is deleted, with its Job and pods, once its TTL
+// expired.
+func (r *JobReconciler) Reconcile(ctx context.Context, req reconcile.Request) (reconcile.Result, error) {
+	log := r.Log.WithValues("CrdbJob", req.NamespacedName)
+
+	crdbJob := &api.CrdbJob{}
+	if err := r.Get(ctx, req.NamespacedName, crdbJob); err != nil {
+		return requeueIfError(client.IgnoreNotFound(err))
+	}
+
+	if crdbJob.DeletionTimestamp != nil {
+		return noRequeue()
+	}
+
+	if crdbJob.Status.Finished() {
+		return r.cleanup(ctx, log, crdbJob)
+	}
+
+	cr := &api.CrdbCluster{}
+	key := types.NamespacedName{Namespace: crdbJob.Namespace, Name: crdbJob.Spec.ClusterName}
+	if err := r.Get(ctx, key, cr); err != nil {
+		if !apierrors.IsNotFound(err) {
+			return requeueIfError(err)
+		}
+
+		status := api.CrdbJobStatus{
+			Phase:   api.JobPending,
+			Message: fmt.Sprintf("cluster %s not found", crdbJob.Spec.ClusterName),
+		}
+		if err := r.updateStatus(ctx, crdbJob, status); err != nil {
+			return requeueIfError(err)
+		}
+		return requeueAfter(clusterNotFoundInterval, nil)
+	}
+
+	cluster := resource.NewCluster(cr)
+	managed := resource.NewManagedKubeResource(ctx, r.Client, &cluster, kube.DefaultPersister)
+	_, err := resource.Reconciler{
+		ManagedResource: managed,
+		Builder: resource.CrdbJobBuilder{
+			Cluster:  &cluster,
+			Job:      crdbJob,
+			Selector: managed.Labels.Selector(cr.Spec.AdditionalLabels),
+		},
+		Owner:  crdbJob,
+		Scheme: r.Scheme,
+	}.Reconcile()
+	if err != nil {
+		log.Error(err, "failed to reconcile Job")
+		return requeueIfError(err)
+	}
+
+	job := &kbatch.Job{}
+	if err := r.Get(ctx, req.NamespacedName, job); err != nil {
+		return requeueIfError(err)
+	}
+
+	pods := &corev1.PodList{}
+	if err := r.List(ctx, pods, client.InNamespace(job.Namespace), client.MatchingLabels{"job-name": job.Name}); err != nil {
+		return requeueIfError(err)
+	}
+
+	status := jobStatus(job, pods.Items)
+	if err := r.updateStatus(ctx, crdbJob, status); err != nil {
+		return requeueIfError(err)
+	}
+
+	if !status.Finished() {
+		return noRequeue()
+	}
+
+	log.Info("job finished", "phase", status.Phase, "exitCode", status.ExitCode)
+	return r.cleanup(ctx, log, crdbJob)
+}
+
+func (r *JobReconciler) updateStatus(ctx context.Context, crdbJob *api.CrdbJob, status api.CrdbJobStatus) error {
+	if equality.Semantic.DeepEqual(crdbJob.Status, status) {
+		return nil
+	}
+
+	crdbJob.Status = status
+	return r.Status().Update(ctx, crdbJob)
+}
+
+// cleanup deletes a finished CrdbJob once its TTL expired. The Job and its pods
+// are garbage collected with it.
+func (r *JobReconciler) cleanup(ctx context.Context, log logr.Logger, crdbJob *api.CrdbJob) (reconcile.Result, error) {
+	ttl := crdbJob.Spec.TTLSecondsAfterFinished
+	if ttl == nil || crdbJob.Status.CompletionTime == nil {
+		return noRequeue()
+	}
+
+	expiry := crdbJob.Status.CompletionTime.Add(time.Duration(*ttl) * time.Second)
+	if remaining := time.Until(expiry); remaining > 0 {
+		return requeueAfter(remaining, nil)
+	}
+
+	log.Info("deleting finished job after its TTL")
+	err := r.Delete(ctx, crdbJob, client.PropagationPolicy(metav1.DeletePropagationBackground))
+	return requeueIfError(client.IgnoreNotFound(err))
+}
+
+// jobStatus is the status of the command run by the Job. The exit code is the
+// one of the last pod that terminated.
+func jobStatus(job *kbatch.Job, pods []corev1.Pod) api.CrdbJobStatus {
+	status := api.CrdbJobStatus{
+		Phase:     api.JobPending,
+		StartTime: job.Status.StartTime,
+	}
+	if job.Status.Active > 0 {
+		status.Phase = api.JobRunning
+	}
+
+	for _, c := range job.Status.Conditions {
+		if c.Status != corev1.ConditionTrue {
+			continue
+		}
+
+		switch c.Type {
+		case kbatch.JobComplete:
+			status.Phase = api.JobSucceeded
+		case kbatch.JobFailed:
+			status.Phase = api.JobFailed
+			status.Message = c.Message
+		default:
+			continue
+		}
+		completed := c.LastTransitionTime
+		status.CompletionTime = &completed
+	}
+
+	var last *corev1.ContainerStateTerminated
+	for _, pod := range pods {
+		for _, c := range pod.Status.ContainerStatuses {
+			terminated := c.State.Terminated
+			if c.Name != resource.CrdbJobContainerName || terminated == nil {
+				continue
+			}
+			if last == nil || terminated.FinishedAt.After(last.FinishedAt.Time) {
+				last = terminated
+			}
+		}
+	}
+	if last != nil {
+		exitCode := last.ExitCode
+		status.ExitCode = &exitCode
+	}
+
+	return status
+}
+
+// SetupWithManager registers the controller with the controller.Manager from controller-runtime
+func (r *JobReconciler) SetupWithManager(mgr ctrl.Manager) error {
+	return ctrl.NewControllerManagedBy(mgr).
+		For(&api.CrdbJob{}).
+		Owns(&kbatch.Job{}).
+		Complete(r)
+}
+
+// InitJobReconciler returns a registrator for a new CrdbJob controller instance with the default logger
+func InitJobReconciler() func(ctrl.Manager) error {
+	return func(mgr ctrl.Manager) error {
+		return (&JobReconciler{
+			Client: mgr.GetClient(),
+			Log:    ctrl.Log.WithName("controller").WithName("CrdbJob"),
+			Scheme: mgr.GetScheme(),
+		}).SetupWithManager(mgr)
+	}
+}
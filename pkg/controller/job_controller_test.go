@@ -0,0 +1,158 @@
+/*
+Copyright 2021 The Cockroach Authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    https://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controller_test
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	api "github.com/cockroachdb/cockroach-operator/apis/v1alpha1"
+	"github.com/cockroachdb/cockroach-operator/pkg/controller"
+	"github.com/cockroachdb/cockroach-operator/pkg/resource"
+	"github.com/cockroachdb/cockroach-operator/pkg/testutil"
+	"github.com/go-logr/zapr"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/zap/zaptest"
+	kbatch "k8s.io/api/batch/v1"
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+)
+
+func TestJobReconcile(t *testing.T) {
+	ctx := context.Background()
+	scheme := testutil.InitScheme(t)
+
+	cluster := testutil.NewBuilder("cluster").Namespaced("default").WithNodeCount(1).Cr()
+	ttl := int32(60)
+	crdbJob := &api.CrdbJob{
+		ObjectMeta: metav1.ObjectMeta{Namespace: "default", Name: "movr"},
+		Spec: api.CrdbJobSpec{
+			ClusterName:             "missing",
+			Args:                    []string{"workload", "init", "movr"},
+			TTLSecondsAfterFinished: &ttl,
+		},
+	}
+
+	cl := fake.NewFakeClientWithScheme(scheme, cluster, crdbJob)
+	r := &controller.JobReconciler{
+		Client: cl,
+		Log:    zapr.NewLogger(zaptest.NewLogger(t)).WithName("job-controller-test"),
+		Scheme: scheme,
+	}
+	key := types.NamespacedName{Namespace: "default", Name: "movr"}
+	req := ctrl.Request{NamespacedName: key}
+
+	// the job waits for its cluster
+	res, err := r.Reconcile(ctx, req)
+	require.NoError(t, err)
+	require.NotZero(t, res.RequeueAfter)
+	require.NoError(t, cl.Get(ctx, key, crdbJob))
+	require.Equal(t, api.JobPending, crdbJob.Status.Phase)
+	require.Contains(t, crdbJob.Status.Message, "cluster missing not found")
+
+	crdbJob.Spec.ClusterName = "cluster"
+	require.NoError(t, cl.Update(ctx, crdbJob))
+
+	_, err = r.Reconcile(ctx, req)
+	require.NoError(t, err)
+
+	job := &kbatch.Job{}
+	require.NoError(t, cl.Get(ctx, key, job))
+	require.True(t, metav1.IsControlledBy(job, crdbJob))
+	require.NoError(t, cl.Get(ctx, key, crdbJob))
+	require.Equal(t, api.JobPending, crdbJob.Status.Phase)
+	require.Empty(t, crdbJob.Status.Message)
+
+	// the command fails
+	finished := metav1.NewTime(time.Now().Add(-time.Hour))
+	job.Status.Conditions = []kbatch.JobCondition{{
+		Type:               kbatch.JobFailed,
+		Status:             corev1.ConditionTrue,
+		LastTransitionTime: finished,
+		Message:            "Job has reached the specified backoff limit",
+	}}
+	require.NoError(t, cl.Status().Update(ctx, job))
+	pod := &corev1.Pod{
+		ObjectMeta: metav1.ObjectMeta{Namespace: "default", Name: "movr-abcde", Labels: map[string]string{"job-name": "movr"}},
+		Status: corev1.PodStatus{
+			ContainerStatuses: []corev1.ContainerStatus{{
+				Name: resource.CrdbJobContainerName,
+				State: corev1.ContainerState{
+					Terminated: &corev1.ContainerStateTerminated{ExitCode: 3, FinishedAt: finished},
+				},
+			}},
+		},
+	}
+	require.NoError(t, cl.Create(ctx, pod))
+
+	// the status reports the failure, then the job is deleted since its TTL expired
+	_, err = r.Reconcile(ctx, req)
+	require.NoError(t, err)
+	err = cl.Get(ctx, key, crdbJob)
+	require.True(t, apierrors.IsNotFound(err))
+}
+
+func TestJobStatusOfASucceededJob(t *testing.T) {
+	ctx := context.Background()
+	scheme := testutil.InitScheme(t)
+
+	cluster := testutil.NewBuilder("cluster").Namespaced("default").WithNodeCount(1).Cr()
+	crdbJob := &api.CrdbJob{
+		ObjectMeta: metav1.ObjectMeta{Namespace: "default", Name: "zip"},
+		Spec:       api.CrdbJobSpec{ClusterName: "cluster", Args: []string{"debug", "zip", "/tmp/debug.zip"}},
+	}
+
+	cl := fake.NewFakeClientWithScheme(scheme, cluster, crdbJob)
+	r := &controller.JobReconciler{
+		Client: cl,
+		Log:    zapr.NewLogger(zaptest.NewLogger(t)).WithName("job-controller-test"),
+		Scheme: scheme,
+	}
+	key := types.NamespacedName{Namespace: "default", Name: "zip"}
+
+	_, err := r.Reconcile(ctx, ctrl.Request{NamespacedName: key})
+	require.NoError(t, err)
+
+	job := &kbatch.Job{}
+	require.NoError(t, cl.Get(ctx, key, job))
+	job.Status.Conditions = []kbatch.JobCondition{{Type: kbatch.JobComplete, Status: corev1.ConditionTrue}}
+	require.NoError(t, cl.Status().Update(ctx, job))
+	pod := &corev1.Pod{
+		ObjectMeta: metav1.ObjectMeta{Namespace: "default", Name: "zip-abcde", Labels: map[string]string{"job-name": "zip"}},
+		Status: corev1.PodStatus{
+			ContainerStatuses: []corev1.ContainerStatus{{
+				Name:  resource.CrdbJobContainerName,
+				State: corev1.ContainerState{Terminated: &corev1.ContainerStateTerminated{ExitCode: 0}},
+			}},
+		},
+	}
+	require.NoError(t, cl.Create(ctx, pod))
+
+	// without a TTL the finished job is kept
+	res, err := r.Reconcile(ctx, ctrl.Request{NamespacedName: key})
+	require.NoError(t, err)
+	require.Equal(t, ctrl.Result{}, res)
+	require.NoError(t, cl.Get(ctx, key, crdbJob))
+	require.Equal(t, api.JobSucceeded, crdbJob.Status.Phase)
+	require.Equal(t, int32(0), *crdbJob.Status.ExitCode)
+	require.NotNil(t, crdbJob.Status.CompletionTime)
+}
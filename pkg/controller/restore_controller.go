@@ -0,0 +1,273 @@
+/*
+Copyright 2021 The Cockroach Authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    https://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controller
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"time"
+
+	api "github.com/cockroachdb/cockroach-operator/apis/v1alpha1"
+	"github.com/cockroachdb/cockroach-operator/pkg/actor"
+	"github.com/cockroachdb/cockroach-operator/pkg/clustersql"
+	"github.com/cockroachdb/cockroach-operator/pkg/condition"
+	"github.com/cockroachdb/cockroach-operator/pkg/features"
+	"github.com/cockroachdb/cockroach-operator/pkg/resource"
+	"github.com/cockroachdb/cockroach-operator/pkg/utilfeature"
+	"github.com/cockroachdb/errors"
+	"github.com/go-logr/logr"
+	"k8s.io/apimachinery/pkg/api/equality"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
+)
+
+// restoreInterval is how often the progress of a running restore is checked
+const restoreInterval = 30 * time.Second
+
+// RestoreReconciler reconciles a CrdbRestore object
+type RestoreReconciler struct {
+	client.Client
+	Log    logr.Logger
+	Scheme *runtime.Scheme
+	// DB opens a connection to the cluster
+	DB func(ctx context.Context, cluster *resource.Cluster) (*sql.DB, error)
+}
+
+// +kubebuilder:rbac:groups=crdb.cockroachlabs.com,resources=crdbrestores,verbs=get;list;watch;update;patch
+// +kubebuilder:rbac:groups=crdb.cockroachlabs.com,resources=crdbrestores/status,verbs=get;update;patch
+
+// Reconcile waits until the cluster of a CrdbRestore is ready, then starts the
+// RESTORE job and reports its progress in the status until it succeeds or
+// fails. A restore runs once: the spec of a started restore is not applied.
+func (r *RestoreReconciler) Reconcile(ctx context.Context, req reconcile.Request) (reconcile.Result, error) {
+	log := r.Log.WithValues("CrdbRestore", req.NamespacedName)
+
+	restore := &api.CrdbRestore{}
+	if err := r.Get(ctx, req.NamespacedName, restore); err != nil {
+		return requeueIfError(client.IgnoreNotFound(err))
+	}
+
+	if restore.DeletionTimestamp != nil || restore.Status.Finished() {
+		return noRequeue()
+	}
+
+	status := *restore.Status.DeepCopy()
+	if status.JobID == 0 {
+		if err := validateRestore(restore.Spec); err != nil {
+			return r.fail(ctx, log, restore, status, "InvalidSpec", err.Error())
+		}
+	}
+
+	name := restore.Spec.ClusterName
+	cluster, err := getCluster(ctx, r.Client, restore.Namespace, name)
+	if err != nil {
+		return requeueIfError(err)
+	}
+	if cluster == nil {
+		return r.waitForCluster(ctx, restore, status, "ClusterNotFound", fmt.Sprintf("cluster %s not found", name))
+	}
+	if !clusterReady(cluster) {
+		return r.waitForCluster(ctx, restore, status, "ClusterNotReady", fmt.Sprintf("waiting for cluster %s to be ready", name))
+	}
+	r.setCondition(restore, &status, api.RestoreClusterReady, metav1.ConditionTrue, "ClusterReady", fmt.Sprintf("cluster %s is ready", name))
+
+	spec := restore.Spec
+	uri, ok, err := collectionURI(ctx, r.Client, cluster, spec.URI, spec.URISecretRef)
+	if err != nil {
+		return requeueIfError(err)
+	}
+	if !ok {
+		status.Phase = api.RestorePending
+		r.setCondition(restore, &status, api.RestoreRestoring, metav1.ConditionFalse, "URINotFound",
+			fmt.Sprintf("waiting for key %s of secret %s with the backup URI", spec.URISecretRef.Key, spec.URISecretRef.Name))
+		return r.requeue(ctx, restore, status, clusterNotFoundInterval)
+	}
+
+	db, err := r.DB(ctx, cluster)
+	if err != nil {
+		return requeueIfError(err)
+	}
+	defer db.Close()
+
+	if status.JobID == 0 {
+		return r.start(ctx, log, db, restore, status, uri)
+	}
+
+	job, err := clustersql.GetJob(ctx, db, status.JobID)
+	if err != nil {
+		return requeueIfError(err)
+	}
+	if !job.Finished() {
+		progress, err := clustersql.JobProgress(ctx, db, job.ID)
+		if err != nil {
+			return requeueIfError(err)
+		}
+		status.Progress = int32(progress * 100)
+		return r.requeue(ctx, restore, status, restoreInterval)
+	}
+
+	if job.Status != clustersql.JobSucceeded {
+		return r.fail(ctx, log, restore, status, "JobFailed", fmt.Sprintf("restore job %d %s: %s", job.ID, job.Status, job.Error))
+	}
+
+	log.Info("restore succeeded", "job", job.ID)
+	now := metav1.Now()
+	status.Phase = api.RestoreSucceeded
+	status.Progress = 100
+	status.CompletionTime = &now
+	r.setCondition(restore, &status, api.RestoreRestoring, metav1.ConditionFalse, "Succeeded", fmt.Sprintf("restore job %d succeeded", job.ID))
+	r.setCondition(restore, &status, api.RestoreComplete, metav1.ConditionTrue, "Succeeded", fmt.Sprintf("backup %s restored", status.Backup))
+	return requeueIfError(r.updateStatus(ctx, restore, status))
+}
+
+// start starts the RESTORE job of the latest backup of the collection, unless
+// the spec names a backup, as of the time of the spec within the backup.
+func (r *RestoreReconciler) start(ctx context.Context, log logr.Logger, db *sql.DB, restore *api.CrdbRestore, status api.CrdbRestoreStatus, uri string) (reconcile.Result, error) {
+	spec := restore.Spec
+	path := spec.Backup
+	if path == "" {
+		latest, err := clustersql.LatestBackup(ctx, db, uri)
+		if err != nil {
+			return requeueIfError(err)
+		}
+		path = latest
+	}
+
+	target := clustersql.RestoreTarget{Databases: spec.Databases, Tables: spec.Tables, IntoDB: spec.IntoDB}
+	if spec.AsOf != nil {
+		start, end, err := clustersql.BackupWindow(ctx, db, uri, path)
+		if err != nil {
+			return requeueIfError(err)
+		}
+		asOf := spec.AsOf.Time
+		if asOf.Before(start) || asOf.After(end) {
+			return r.fail(ctx, log, restore, status, "InvalidSpec", fmt.Sprintf("asOf %s is not between the end of the full backup %s at %s and the end of its last backup at %s",
+				asOf.UTC().Format(time.RFC3339), path, start.UTC().Format(time.RFC3339), end.UTC().Format(time.RFC3339)))
+		}
+		target.AsOf = asOf
+	}
+	id, err := clustersql.StartTargetedRestore(ctx, db, uri, path, target)
+	if err != nil {
+		return r.fail(ctx, log, restore, status, "StartFailed", err.Error())
+	}
+
+	log.Info("restore started", "backup", path, "job", id)
+	now := metav1.Now()
+	status.Phase = api.RestoreRunning
+	status.Backup = path
+	status.JobID = id
+	status.StartTime = &now
+	r.setCondition(restore, &status, api.RestoreRestoring, metav1.ConditionTrue, "Started", fmt.Sprintf("restore job %d started", id))
+	return r.requeue(ctx, restore, status, restoreInterval)
+}
+
+// waitForCluster records that the restore waits for its cluster.
+func (r *RestoreReconciler) waitForCluster(ctx context.Context, restore *api.CrdbRestore, status api.CrdbRestoreStatus, reason, message string) (reconcile.Result, error) {
+	status.Phase = api.RestorePending
+	r.setCondition(restore, &status, api.RestoreClusterReady, metav1.ConditionFalse, reason, message)
+	return r.requeue(ctx, restore, status, clusterNotFoundInterval)
+}
+
+// fail records that the restore failed. It is not retried.
+func (r *RestoreReconciler) fail(ctx context.Context, log logr.Logger, restore *api.CrdbRestore, status api.CrdbRestoreStatus, reason, message string) (reconcile.Result, error) {
+	log.Info("restore failed", "reason", reason, "message", message)
+	now := metav1.Now()
+	status.Phase = api.RestoreFailed
+	status.CompletionTime = &now
+	r.setCondition(restore, &status, api.RestoreRestoring, metav1.ConditionFalse, reason, message)
+	r.setCondition(restore, &status, api.RestoreFailedCondition, metav1.ConditionTrue, reason, message)
+	return requeueIfError(r.updateStatus(ctx, restore, status))
+}
+
+func (r *RestoreReconciler) setCondition(restore *api.CrdbRestore, status *api.CrdbRestoreStatus, ctype string, s metav1.ConditionStatus, reason, message string) {
+	meta.SetStatusCondition(&status.Conditions, metav1.Condition{
+		Type:               ctype,
+		Status:             s,
+		ObservedGeneration: restore.Generation,
+		Reason:             reason,
+		Message:            message,
+	})
+}
+
+func (r *RestoreReconciler) requeue(ctx context.Context, restore *api.CrdbRestore, status api.CrdbRestoreStatus, interval time.Duration) (reconcile.Result, error) {
+	if err := r.updateStatus(ctx, restore, status); err != nil {
+		return requeueIfError(err)
+	}
+	return requeueAfter(interval, nil)
+}
+
+func (r *RestoreReconciler) updateStatus(ctx context.Context, restore *api.CrdbRestore, status api.CrdbRestoreStatus) error {
+	if equality.Semantic.DeepEqual(restore.Status, status) {
+		return nil
+	}
+
+	restore.Status = status
+	return r.Status().Update(ctx, restore)
+}
+
+// validateRestore checks the combination of the targets of the restore, which
+// the schema cannot express.
+func validateRestore(spec api.CrdbRestoreSpec) error {
+	if len(spec.Databases) > 0 && len(spec.Tables) > 0 {
+		return errors.New("databases and tables cannot be restored together")
+	}
+	if spec.IntoDB != "" && len(spec.Tables) == 0 {
+		return errors.New("intoDB needs tables to restore")
+	}
+	return nil
+}
+
+// clusterReady returns whether the cluster is initialized and, when its SQL
+// readiness is checked, answers SQL queries.
+func clusterReady(cluster *resource.Cluster) bool {
+	conditions := cluster.Status().Conditions
+	if !condition.True(api.InitializedCondition, conditions) {
+		return false
+	}
+	if utilfeature.DefaultMutableFeatureGate.Enabled(features.SQLReadiness) {
+		return condition.True(api.ReadyCondition, conditions)
+	}
+	return true
+}
+
+// SetupWithManager registers the controller with the controller.Manager from controller-runtime
+func (r *RestoreReconciler) SetupWithManager(mgr ctrl.Manager) error {
+	return ctrl.NewControllerManagedBy(mgr).
+		For(&api.CrdbRestore{}).
+		Complete(r)
+}
+
+// InitRestoreReconciler returns a registrator for a new CrdbRestore controller instance with the default logger
+func InitRestoreReconciler() func(ctrl.Manager) error {
+	return func(mgr ctrl.Manager) error {
+		cl := mgr.GetClient()
+		config := mgr.GetConfig()
+		return (&RestoreReconciler{
+			Client: cl,
+			Log:    ctrl.Log.WithName("controller").WithName("CrdbRestore"),
+			Scheme: mgr.GetScheme(),
+			DB: func(ctx context.Context, cluster *resource.Cluster) (*sql.DB, error) {
+				return actor.OpenDatabase(ctx, cl, config, cluster)
+			},
+		}).SetupWithManager(mgr)
+	}
+}
@@ -0,0 +1,237 @@
+/*
+Copyright 2021 The Cockroach Authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    https://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controller_test
+
+import (
+	"context"
+	"database/sql"
+	"regexp"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	api "github.com/cockroachdb/cockroach-operator/apis/v1alpha1"
+	"github.com/cockroachdb/cockroach-operator/pkg/controller"
+	"github.com/cockroachdb/cockroach-operator/pkg/resource"
+	"github.com/cockroachdb/cockroach-operator/pkg/testutil"
+	"github.com/cockroachdb/cockroach-operator/pkg/utilfeature"
+	"github.com/go-logr/zapr"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/zap/zaptest"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/types"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+)
+
+// newRestoreReconciler returns a reconciler whose successive connections to
+// the cluster expect the successive expectations.
+func newRestoreReconciler(t *testing.T, expects []func(sqlmock.Sqlmock), objs ...runtime.Object) *controller.RestoreReconciler {
+	scheme := testutil.InitScheme(t)
+	return &controller.RestoreReconciler{
+		Client: fake.NewFakeClientWithScheme(scheme, objs...),
+		Log:    zapr.NewLogger(zaptest.NewLogger(t)).WithName("restore-controller-test"),
+		Scheme: scheme,
+		DB: func(context.Context, *resource.Cluster) (*sql.DB, error) {
+			require.NotEmpty(t, expects, "unexpected connection to the cluster")
+			db, mock, err := sqlmock.New()
+			require.NoError(t, err)
+			expects[0](mock)
+			expects = expects[1:]
+			mock.ExpectClose()
+			t.Cleanup(func() { require.NoError(t, mock.ExpectationsWereMet()) })
+			return db, nil
+		},
+	}
+}
+
+func readyCluster() *api.CrdbCluster {
+	cr := initializedCluster()
+	cr.Status.Conditions = append(cr.Status.Conditions, api.ClusterCondition{Type: api.ReadyCondition, Status: metav1.ConditionTrue})
+	return cr
+}
+
+func TestRestoreReconcile(t *testing.T) {
+	ctx := context.Background()
+	restore := &api.CrdbRestore{
+		ObjectMeta: metav1.ObjectMeta{Namespace: "default", Name: "movr", Generation: 1},
+		Spec: api.CrdbRestoreSpec{
+			ClusterName: "cluster",
+			URI:         backupURI,
+			Databases:   []string{"movr"},
+		},
+	}
+
+	r := newRestoreReconciler(t, []func(sqlmock.Sqlmock){
+		func(mock sqlmock.Sqlmock) {
+			mock.ExpectQuery(regexp.QuoteMeta("SHOW BACKUPS IN $1")).
+				WithArgs(backupURI).
+				WillReturnRows(sqlmock.NewRows([]string{"path"}).
+					AddRow("/2021/06/01-000000.00").
+					AddRow("/2021/06/02-000000.00"))
+			mock.ExpectQuery(regexp.QuoteMeta(`RESTORE DATABASE "movr" FROM $1 IN $2 WITH detached`)).
+				WithArgs("/2021/06/02-000000.00", backupURI).
+				WillReturnRows(sqlmock.NewRows([]string{"job_id"}).AddRow(42))
+		},
+		func(mock sqlmock.Sqlmock) {
+			mock.ExpectQuery(regexp.QuoteMeta("SELECT status, error FROM crdb_internal.jobs")).
+				WithArgs(42).
+				WillReturnRows(sqlmock.NewRows([]string{"status", "error"}).AddRow("running", nil))
+			mock.ExpectQuery(regexp.QuoteMeta("SELECT fraction_completed FROM crdb_internal.jobs")).
+				WithArgs(42).
+				WillReturnRows(sqlmock.NewRows([]string{"fraction_completed"}).AddRow(0.25))
+		},
+		func(mock sqlmock.Sqlmock) {
+			mock.ExpectQuery(regexp.QuoteMeta("SELECT status, error FROM crdb_internal.jobs")).
+				WithArgs(42).
+				WillReturnRows(sqlmock.NewRows([]string{"status", "error"}).AddRow("succeeded", nil))
+		},
+	}, readyCluster(), restore)
+
+	key := types.NamespacedName{Namespace: "default", Name: "movr"}
+	req := ctrl.Request{NamespacedName: key}
+
+	res, err := r.Reconcile(ctx, req)
+	require.NoError(t, err)
+	require.NotZero(t, res.RequeueAfter)
+	require.NoError(t, r.Get(ctx, key, restore))
+	require.Equal(t, api.RestoreRunning, restore.Status.Phase)
+	require.Equal(t, int64(42), restore.Status.JobID)
+	require.Equal(t, "/2021/06/02-000000.00", restore.Status.Backup)
+	require.True(t, meta.IsStatusConditionTrue(restore.Status.Conditions, api.RestoreClusterReady))
+	require.True(t, meta.IsStatusConditionTrue(restore.Status.Conditions, api.RestoreRestoring))
+
+	res, err = r.Reconcile(ctx, req)
+	require.NoError(t, err)
+	require.NotZero(t, res.RequeueAfter)
+	require.NoError(t, r.Get(ctx, key, restore))
+	require.Equal(t, int32(25), restore.Status.Progress)
+
+	res, err = r.Reconcile(ctx, req)
+	require.NoError(t, err)
+	require.Zero(t, res.RequeueAfter)
+	require.NoError(t, r.Get(ctx, key, restore))
+	status := restore.Status
+	require.Equal(t, api.RestoreSucceeded, status.Phase)
+	require.Equal(t, int32(100), status.Progress)
+	require.NotNil(t, status.CompletionTime)
+	require.True(t, meta.IsStatusConditionFalse(status.Conditions, api.RestoreRestoring))
+	require.True(t, meta.IsStatusConditionTrue(status.Conditions, api.RestoreComplete))
+
+	// a finished restore is not run again
+	res, err = r.Reconcile(ctx, req)
+	require.NoError(t, err)
+	require.Zero(t, res.RequeueAfter)
+}
+
+func TestRestoreWaitsForTheCluster(t *testing.T) {
+	ctx := context.Background()
+	utilfeature.DefaultMutableFeatureGate.Set("SQLReadiness=true")
+	defer utilfeature.DefaultMutableFeatureGate.Set("SQLReadiness=false")
+	restore := &api.CrdbRestore{
+		ObjectMeta: metav1.ObjectMeta{Namespace: "default", Name: "movr"},
+		Spec:       api.CrdbRestoreSpec{ClusterName: "cluster", URI: backupURI},
+	}
+	cluster := readyCluster()
+	cluster.Status.Conditions[1].Status = metav1.ConditionFalse
+	r := newRestoreReconciler(t, nil, cluster, restore)
+
+	key := types.NamespacedName{Namespace: "default", Name: "movr"}
+	res, err := r.Reconcile(ctx, ctrl.Request{NamespacedName: key})
+	require.NoError(t, err)
+	require.NotZero(t, res.RequeueAfter)
+
+	require.NoError(t, r.Get(ctx, key, restore))
+	require.Equal(t, api.RestorePending, restore.Status.Phase)
+	cond := meta.FindStatusCondition(restore.Status.Conditions, api.RestoreClusterReady)
+	require.NotNil(t, cond)
+	require.Equal(t, metav1.ConditionFalse, cond.Status)
+	require.Equal(t, "ClusterNotReady", cond.Reason)
+}
+
+func TestRestoreInvalidSpecFails(t *testing.T) {
+	ctx := context.Background()
+	restore := &api.CrdbRestore{
+		ObjectMeta: metav1.ObjectMeta{Namespace: "default", Name: "movr"},
+		Spec: api.CrdbRestoreSpec{
+			ClusterName: "cluster",
+			URI:         backupURI,
+			Databases:   []string{"movr"},
+			IntoDB:      "movr_restored",
+		},
+	}
+	r := newRestoreReconciler(t, nil, readyCluster(), restore)
+
+	key := types.NamespacedName{Namespace: "default", Name: "movr"}
+	res, err := r.Reconcile(ctx, ctrl.Request{NamespacedName: key})
+	require.NoError(t, err)
+	require.Zero(t, res.RequeueAfter)
+
+	require.NoError(t, r.Get(ctx, key, restore))
+	require.Equal(t, api.RestoreFailed, restore.Status.Phase)
+	cond := meta.FindStatusCondition(restore.Status.Conditions, api.RestoreFailedCondition)
+	require.NotNil(t, cond)
+	require.Equal(t, "InvalidSpec", cond.Reason)
+}
+
+func TestRestoreAsOf(t *testing.T) {
+	ctx := context.Background()
+	path := "/2021/06/02-000000.00"
+	full := time.Date(2021, time.June, 2, 0, 0, 0, 0, time.UTC)
+	incremental := time.Date(2021, time.June, 2, 12, 0, 0, 0, time.UTC)
+
+	tests := []struct {
+		name  string
+		asOf  time.Time
+		phase api.RestorePhase
+	}{
+		{name: "within the backup", asOf: time.Date(2021, time.June, 2, 6, 0, 0, 0, time.UTC), phase: api.RestoreRunning},
+		{name: "before the full backup", asOf: time.Date(2021, time.June, 1, 23, 0, 0, 0, time.UTC), phase: api.RestoreFailed},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			asOf := metav1.NewTime(tt.asOf)
+			restore := &api.CrdbRestore{
+				ObjectMeta: metav1.ObjectMeta{Namespace: "default", Name: "movr"},
+				Spec:       api.CrdbRestoreSpec{ClusterName: "cluster", URI: backupURI, Backup: path, AsOf: &asOf},
+			}
+
+			r := newRestoreReconciler(t, []func(sqlmock.Sqlmock){
+				func(mock sqlmock.Sqlmock) {
+					mock.ExpectQuery(regexp.QuoteMeta("SELECT min(end_time), max(end_time) FROM [SHOW BACKUP FROM $1 IN $2]")).
+						WithArgs(path, backupURI).
+						WillReturnRows(sqlmock.NewRows([]string{"min", "max"}).AddRow(full, incremental))
+					if tt.phase == api.RestoreRunning {
+						mock.ExpectQuery(regexp.QuoteMeta("RESTORE FROM $1 IN $2 AS OF SYSTEM TIME '2021-06-02 06:00:00' WITH detached")).
+							WithArgs(path, backupURI).
+							WillReturnRows(sqlmock.NewRows([]string{"job_id"}).AddRow(42))
+					}
+				},
+			}, readyCluster(), restore)
+
+			key := types.NamespacedName{Namespace: "default", Name: "movr"}
+			_, err := r.Reconcile(ctx, ctrl.Request{NamespacedName: key})
+			require.NoError(t, err)
+
+			require.NoError(t, r.Get(ctx, key, restore))
+			require.Equal(t, tt.phase, restore.Status.Phase)
+		})
+	}
+}
@@ -0,0 +1,104 @@
+/*
+Copyright 2021 The Cockroach Authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    https://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package cron_test
+
+import (
+	"testing"
+	"time"
+
+	"github.com/cockroachdb/cockroach-operator/pkg/cron"
+	"github.com/stretchr/testify/require"
+)
+
+func TestSchedule(t *testing.T) {
+	// a Wednesday
+	now := time.Date(2021, time.June, 2, 10, 30, 0, 0, time.UTC)
+	at := func(month time.Month, day, hour, minute int) time.Time {
+		return time.Date(2021, month, day, hour, minute, 0, 0, time.UTC)
+	}
+
+	tests := []struct {
+		spec string
+		prev time.Time
+		next time.Time
+	}{
+		{spec: "30 10 * * *", prev: at(time.June, 2, 10, 30), next: at(time.June, 3, 10, 30)},
+		{spec: "0 20 * * 1-5", prev: at(time.June, 1, 20, 0), next: at(time.June, 2, 20, 0)},
+		{spec: "0 7 * * mon-fri", prev: at(time.June, 2, 7, 0), next: at(time.June, 3, 7, 0)},
+		{spec: "*/20 9-17 * * *", prev: at(time.June, 2, 10, 20), next: at(time.June, 2, 10, 40)},
+		{spec: "0 0 * * 0,7", prev: at(time.May, 30, 0, 0), next: at(time.June, 6, 0, 0)},
+		{spec: "0 12 1,15 * *", prev: at(time.June, 1, 12, 0), next: at(time.June, 15, 12, 0)},
+		// the 15th of the month or any friday
+		{spec: "0 12 15 * fri", prev: at(time.May, 28, 12, 0), next: at(time.June, 4, 12, 0)},
+		{spec: "@monthly", prev: at(time.June, 1, 0, 0), next: at(time.July, 1, 0, 0)},
+		{spec: "0 0 29 feb *", prev: time.Date(2020, time.February, 29, 0, 0, 0, 0, time.UTC), next: time.Date(2024, time.February, 29, 0, 0, 0, 0, time.UTC)},
+		{spec: "0 0 30 feb *"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.spec, func(t *testing.T) {
+			s, err := cron.Parse(tt.spec)
+			require.NoError(t, err)
+			require.Equal(t, tt.prev, s.Prev(now))
+			require.Equal(t, tt.next, s.Next(now))
+		})
+	}
+}
+
+func TestScheduleIn(t *testing.T) {
+	// 16:00 in a time zone half an hour off the hours of UTC
+	now := time.Date(2021, time.June, 2, 10, 30, 0, 0, time.UTC)
+	loc := time.FixedZone("IST", 5*3600+1800)
+
+	tests := []struct {
+		spec string
+		prev time.Time
+		next time.Time
+	}{
+		{spec: "0 2 * * *", prev: time.Date(2021, time.June, 1, 20, 30, 0, 0, time.UTC), next: time.Date(2021, time.June, 2, 20, 30, 0, 0, time.UTC)},
+		{spec: "0 */6 * * *", prev: time.Date(2021, time.June, 2, 6, 30, 0, 0, time.UTC), next: time.Date(2021, time.June, 2, 12, 30, 0, 0, time.UTC)},
+		{spec: "30 9 * * 4", prev: time.Date(2021, time.May, 27, 4, 0, 0, 0, time.UTC), next: time.Date(2021, time.June, 3, 4, 0, 0, 0, time.UTC)},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.spec, func(t *testing.T) {
+			s, err := cron.Parse(tt.spec)
+			require.NoError(t, err)
+			s = s.In(loc)
+			require.True(t, tt.prev.Equal(s.Prev(now)), "prev %s", s.Prev(now))
+			require.True(t, tt.next.Equal(s.Next(now)), "next %s", s.Next(now))
+		})
+	}
+}
+
+func TestParseErrors(t *testing.T) {
+	for _, spec := range []string{
+		"",
+		"* * * *",
+		"60 * * * *",
+		"* 24 * * *",
+		"* * 0 * *",
+		"* * * 13 *",
+		"* * * * 8",
+		"5-1 * * * *",
+		"*/0 * * * *",
+		"* * * * someday",
+	} {
+		_, err := cron.Parse(spec)
+		require.Error(t, err, spec)
+	}
+}
@@ -0,0 +1,104 @@
+/*
+Copyright 2021 The Cockroach Authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    https://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package database
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/cockroachdb/cockroach-operator/pkg/clustersql"
+	"github.com/go-logr/logr"
+	"github.com/jackc/pgx/v4"
+	"go.uber.org/zap/zapcore"
+)
+
+// Statement is a SQL statement run on a connection with an Audit.
+type Statement struct {
+	Time     time.Time
+	SQL      string
+	Args     []string
+	Duration time.Duration
+	Err      error
+}
+
+// ReadOnly returns whether the statement only reads data, in which case it
+// is left out of the audit history.
+func (s Statement) ReadOnly() bool {
+	sql := strings.ToUpper(strings.TrimSpace(s.SQL))
+	return strings.HasPrefix(sql, "SELECT") || strings.HasPrefix(sql, "SHOW")
+}
+
+// Audit records the statements run on a connection. Every statement is
+// logged, reads at the debug level, and the statements changing the cluster
+// are passed to Record.
+type Audit struct {
+	Logger logr.Logger
+	Record func(Statement)
+}
+
+var _ pgx.Logger = Audit{}
+
+// Log implements pgx.Logger, which pgx calls once a statement is over.
+func (a Audit) Log(_ context.Context, _ pgx.LogLevel, msg string, data map[string]interface{}) {
+	sql, ok := data["sql"].(string)
+	if !ok || msg == "Prepare" {
+		return
+	}
+
+	statement := Statement{Time: time.Now(), SQL: sql, Args: redactArgs(data["args"])}
+	if d, ok := data["time"].(time.Duration); ok {
+		statement.Duration = d
+	}
+	if err, ok := data["err"].(error); ok {
+		statement.Err = err
+	}
+
+	log := a.Logger.WithValues("sql", statement.SQL, "args", statement.Args, "duration", statement.Duration.String())
+	switch {
+	case statement.Err != nil:
+		log.Info("statement failed", "error", statement.Err.Error())
+	case statement.ReadOnly():
+		log.V(int(zapcore.DebugLevel)).Info("statement succeeded")
+	default:
+		log.Info("statement succeeded")
+	}
+
+	if a.Record != nil && !statement.ReadOnly() {
+		a.Record(statement)
+	}
+}
+
+// redactArgs formats the arguments of a statement, without the query strings
+// of URIs which hold the credentials of cloud storage, nor their passwords.
+func redactArgs(args interface{}) []string {
+	values, ok := args.([]interface{})
+	if !ok {
+		return nil
+	}
+
+	redacted := make([]string, 0, len(values))
+	for _, v := range values {
+		s := fmt.Sprint(v)
+		if strings.Contains(s, "://") {
+			s = clustersql.RedactURI(s)
+		}
+		redacted = append(redacted, s)
+	}
+	return redacted
+}
@@ -65,6 +65,8 @@ type DBConnection struct {
 	ClientCertificateSecretName string
 	// RootCertificateSecretName is the name of the secret that contains the rootCA
 	RootCertificateSecretName string
+	// Audit records the statements run on the connection, if set
+	Audit *Audit
 }
 
 // NewDbConnection returns a new sql.DB instance to the corresponding CockroachDB pod.
@@ -84,6 +86,7 @@ func NewDbConnection(dbConn *DBConnection) (*sql.DB, error) {
 		Database:       dbConn.DatabaseName,
 
 		RunningInsideK8s: dbConn.RunningInsideK8s,
+		Audit:            dbConn.Audit,
 	}
 
 	if dbConn.UseSSL {
@@ -144,6 +147,9 @@ type dbConfig struct {
 
 	// We use a dialer if we are not running inside K8s
 	RunningInsideK8s bool
+
+	// Audit records the statements run on the connection, if set
+	Audit *Audit
 }
 
 func (c dbConfig) getClientTLSConfig(clientCertificateSecretName string, rootCertificateSecretName string) (tlsConfig *tls.Config, err error) {
@@ -232,6 +238,11 @@ func (c dbConfig) openDB() (*sql.DB, error) {
 	pgCfg.TLSConfig = c.TLSConfig
 	pgCfg.ConnectTimeout = c.ConnectTimeout
 
+	if c.Audit != nil {
+		pgCfg.Logger = *c.Audit
+		pgCfg.LogLevel = pgx.LogLevelInfo
+	}
+
 	db := stdlib.OpenDB(*pgCfg)
 
 	// Test the database connection
@@ -88,8 +88,220 @@ const (
 
 	// owner: @abhishekdwivedi3060
 	// alpha: v1.0
+	// beta: v2.2
 	// TolerationRules allows setting toleration rules for scheduling sts pods onto some dedicated nodes
 	TolerationRules featuregate.Feature = "TolerationRules"
+
+	// owner: @SumLare
+	// alpha: v2.2
+	// VerticalResize rolls out changes of the database container resources
+	// one pod at a time, instead of letting the statefulset controller do it
+	VerticalResize featuregate.Feature = "VerticalResize"
+
+	// owner: @SumLare
+	// alpha: v2.2
+	// ScheduledScaling changes the number of nodes of the clusters that have a
+	// scaling schedule
+	ScheduledScaling featuregate.Feature = "ScheduledScaling"
+
+	// owner: @SumLare
+	// alpha: v2.2
+	// ScheduledRestart restarts the pods of the clusters that have a restart
+	// schedule. It relies on ClusterRestart for the rolling restart
+	ScheduledRestart featuregate.Feature = "ScheduledRestart"
+
+	// owner: @SumLare
+	// alpha: v2.2
+	// SelfHealing restarts the pods that stay unhealthy while their
+	// CockroachDB node is not live
+	SelfHealing featuregate.Feature = "SelfHealing"
+
+	// owner: @SumLare
+	// alpha: v2.2
+	// NodeHealth polls the liveness of the nodes and sets the Degraded
+	// condition of the clusters with dead or suspect nodes
+	NodeHealth featuregate.Feature = "NodeHealth"
+
+	// owner: @SumLare
+	// alpha: v2.2
+	// StoragePressure polls the capacity of the stores, sets the
+	// StoragePressure condition and expands the volumes if asked to
+	StoragePressure featuregate.Feature = "StoragePressure"
+
+	// owner: @SumLare
+	// alpha: v2.2
+	// SQLReadiness sets the Ready condition of the clusters once a SQL query
+	// succeeds through their public service
+	SQLReadiness featuregate.Feature = "SQLReadiness"
+
+	// owner: @SumLare
+	// alpha: v2.2
+	// Clone restores a backup of another cluster into the clusters created
+	// with cloneFrom
+	Clone featuregate.Feature = "Clone"
+
+	// owner: @SumLare
+	// alpha: v2.2
+	// DatabaseRegions applies the multi-region configuration of the databases
+	// listed in the spec of the clusters
+	DatabaseRegions featuregate.Feature = "DatabaseRegions"
+
+	// owner: @SumLare
+	// alpha: v2.2
+	// CrdbJobs runs the cockroach commands of the CrdbJob resources. The
+	// CrdbJob CRD must be installed when it is enabled
+	CrdbJobs featuregate.Feature = "CrdbJobs"
+
+	// owner: @SumLare
+	// alpha: v2.2
+	// DemoWorkload loads the sample data of the demo workload of the spec
+	DemoWorkload featuregate.Feature = "DemoWorkload"
+
+	// owner: @SumLare
+	// alpha: v2.2
+	// EvictionPolicy manages the safe-to-evict annotation of the pods and the
+	// PodDisruptionBudget of the clusters that have an eviction policy
+	EvictionPolicy featuregate.Feature = "EvictionPolicy"
+
+	// owner: @SumLare
+	// alpha: v2.2
+	// UpgradeRollback rolls back the upgrades whose upgraded pods do not become
+	// ready in time
+	UpgradeRollback featuregate.Feature = "UpgradeRollback"
+
+	// owner: @SumLare
+	// alpha: v2.2
+	// HealthMetrics exports the liveness of the nodes, the ranges and the
+	// capacity of the clusters as metrics of the operator
+	HealthMetrics featuregate.Feature = "HealthMetrics"
+
+	// owner: @SumLare
+	// alpha: v2.2
+	// RequestedOperations runs the operations requested with the
+	// crdb.io/operation annotation of the clusters
+	RequestedOperations featuregate.Feature = "RequestedOperations"
+
+	// owner: @SumLare
+	// alpha: v2.2
+	// CrdbBackups schedules the backups of the CrdbBackup resources. The
+	// CrdbBackup CRD must be installed when it is enabled
+	CrdbBackups featuregate.Feature = "CrdbBackups"
+
+	// owner: @SumLare
+	// alpha: v2.2
+	// CrdbRestores runs the restores of the CrdbRestore resources. The
+	// CrdbRestore CRD must be installed when it is enabled
+	CrdbRestores featuregate.Feature = "CrdbRestores"
+
+	// owner: @SumLare
+	// alpha: v2.2
+	// CrdbChangefeeds runs the changefeed jobs of the CrdbChangefeed
+	// resources. The CrdbChangefeed CRD must be installed when it is enabled
+	CrdbChangefeeds featuregate.Feature = "CrdbChangefeeds"
+
+	// owner: @SumLare
+	// alpha: v2.2
+	// CrdbExports runs the scheduled exports of the CrdbExport resources. The
+	// CrdbExport CRD must be installed when it is enabled
+	CrdbExports featuregate.Feature = "CrdbExports"
+
+	// owner: @SumLare
+	// alpha: v2.2
+	// ClusterReplication starts the physical replication stream of the
+	// standby clusters and reports its progress
+	ClusterReplication featuregate.Feature = "ClusterReplication"
+
+	// owner: @SumLare
+	// alpha: v2.2
+	// BackupHealth reports whether the backups of the CrdbBackup resources of
+	// the clusters complete, in their status and as metrics of the operator
+	BackupHealth featuregate.Feature = "BackupHealth"
+
+	// owner: @SumLare
+	// alpha: v2.2
+	// Autoscaling adjusts the number of nodes of the clusters with an
+	// autoscaling policy to the load of their nodes
+	Autoscaling featuregate.Feature = "Autoscaling"
+
+	// owner: @SumLare
+	// alpha: v2.2
+	// ResourceAutoscaling adjusts the CPU and memory requests of the clusters
+	// with a resource autoscaling policy to the usage of their pods
+	ResourceAutoscaling featuregate.Feature = "ResourceAutoscaling"
+
+	// owner: @SumLare
+	// alpha: v2.2
+	// NodePools runs the node pools of the clusters in StatefulSets of their
+	// own next to the default one
+	NodePools featuregate.Feature = "NodePools"
+
+	// owner: @SumLare
+	// alpha: v2.2
+	// ScaleDownSafety blocks the decommission of nodes that the replicas of the
+	// ranges would not fit without
+	ScaleDownSafety featuregate.Feature = "ScaleDownSafety"
+
+	// owner: @SumLare
+	// alpha: v2.2
+	// DeadNodeReplacement decommissions the dead nodes and replaces the stores
+	// of their pods when the self-healing policy allows it
+	DeadNodeReplacement featuregate.Feature = "DeadNodeReplacement"
+
+	// owner: @SumLare
+	// alpha: v2.2
+	// ScaleUpStrategy adds the nodes of a scale up a few at a time when the
+	// spec asks for it
+	ScaleUpStrategy featuregate.Feature = "ScaleUpStrategy"
+
+	// owner: @SumLare
+	// alpha: v2.2
+	// CanaryUpgrade upgrades the canary nodes set in the spec first and lets
+	// them bake before the rest of the cluster
+	CanaryUpgrade featuregate.Feature = "CanaryUpgrade"
+
+	// owner: @SumLare
+	// alpha: v2.2
+	// UpgradePreflight holds an upgrade until the cluster has no dead node, no
+	// range missing replicas and no schema change running
+	UpgradePreflight featuregate.Feature = "UpgradePreflight"
+
+	// owner: @SumLare
+	// alpha: v2.2
+	// MultiStepUpgrade upgrades the cluster to a version more than one major
+	// release ahead through the supported versions of the releases in between
+	MultiStepUpgrade featuregate.Feature = "MultiStepUpgrade"
+
+	// owner: @SumLare
+	// alpha: v2.2
+	// CertificateRenewal renews the certificates issued from the Vault PKI of
+	// the clusters before they expire, and restarts the pods to use them
+	CertificateRenewal featuregate.Feature = "CertificateRenewal"
+
+	// owner: @SumLare
+	// alpha: v2.2
+	// CrdbClientCerts issues the client certificates of the CrdbClientCert
+	// resources. The CrdbClientCert CRD must be installed when it is enabled
+	CrdbClientCerts featuregate.Feature = "CrdbClientCerts"
+
+	// owner: @SumLare
+	// alpha: v2.2
+	// CertificateExpiry reports the validity of the certificates of the
+	// clusters in their status and metrics, and sets the
+	// CertificateExpiringSoon condition
+	CertificateExpiry featuregate.Feature = "CertificateExpiry"
+
+	// owner: @SumLare
+	// alpha: v2.2
+	// CertificateReload has the nodes load the node certificate of the secret
+	// once it changes, with the SIGHUP reload of the certificate rotation or
+	// a rolling restart
+	CertificateReload featuregate.Feature = "CertificateReload"
+
+	// owner: @SumLare
+	// alpha: v2.2
+	// TopologyLocality sets the locality of the nodes from the topology labels
+	// of the Kubernetes nodes their pods are scheduled on
+	TopologyLocality featuregate.Feature = "TopologyLocality"
 )
 
 func init() {
@@ -106,6 +318,7 @@ var defaultOperatorFeatureGates = map[featuregate.Feature]featuregate.FeatureSpe
 	CrdbVersionValidator: {Default: true, PreRelease: featuregate.GA},
 	GenerateCerts:        {Default: true, PreRelease: featuregate.GA},
 	ClusterRestart:       {Default: true, PreRelease: featuregate.GA},
+	TolerationRules:      {Default: true, PreRelease: featuregate.Beta},
 
 	// We are leaving this in alpha because it can delete data at this point.
 	// We are still testing decommission, and are concerned that if a deco fails
@@ -114,6 +327,40 @@ var defaultOperatorFeatureGates = map[featuregate.Feature]featuregate.FeatureSpe
 	AutoPrunePVC: {Default: false, PreRelease: featuregate.Alpha},
 
 	// New features
-	AffinityRules:   {Default: false, PreRelease: featuregate.Alpha},
-	TolerationRules: {Default: false, PreRelease: featuregate.Alpha},
+	AffinityRules:       {Default: false, PreRelease: featuregate.Alpha},
+	VerticalResize:      {Default: false, PreRelease: featuregate.Alpha},
+	ScheduledScaling:    {Default: false, PreRelease: featuregate.Alpha},
+	ScheduledRestart:    {Default: false, PreRelease: featuregate.Alpha},
+	SelfHealing:         {Default: false, PreRelease: featuregate.Alpha},
+	NodeHealth:          {Default: false, PreRelease: featuregate.Alpha},
+	StoragePressure:     {Default: false, PreRelease: featuregate.Alpha},
+	SQLReadiness:        {Default: false, PreRelease: featuregate.Alpha},
+	Clone:               {Default: false, PreRelease: featuregate.Alpha},
+	DatabaseRegions:     {Default: false, PreRelease: featuregate.Alpha},
+	CrdbJobs:            {Default: false, PreRelease: featuregate.Alpha},
+	DemoWorkload:        {Default: false, PreRelease: featuregate.Alpha},
+	EvictionPolicy:      {Default: false, PreRelease: featuregate.Alpha},
+	UpgradeRollback:     {Default: false, PreRelease: featuregate.Alpha},
+	HealthMetrics:       {Default: false, PreRelease: featuregate.Alpha},
+	RequestedOperations: {Default: false, PreRelease: featuregate.Alpha},
+	CrdbBackups:         {Default: false, PreRelease: featuregate.Alpha},
+	CrdbRestores:        {Default: false, PreRelease: featuregate.Alpha},
+	CrdbChangefeeds:     {Default: false, PreRelease: featuregate.Alpha},
+	CrdbExports:         {Default: false, PreRelease: featuregate.Alpha},
+	ClusterReplication:  {Default: false, PreRelease: featuregate.Alpha},
+	BackupHealth:        {Default: false, PreRelease: featuregate.Alpha},
+	Autoscaling:         {Default: false, PreRelease: featuregate.Alpha},
+	ResourceAutoscaling: {Default: false, PreRelease: featuregate.Alpha},
+	NodePools:           {Default: false, PreRelease: featuregate.Alpha},
+	ScaleDownSafety:     {Default: false, PreRelease: featuregate.Alpha},
+	DeadNodeReplacement: {Default: false, PreRelease: featuregate.Alpha},
+	ScaleUpStrategy:     {Default: false, PreRelease: featuregate.Alpha},
+	CanaryUpgrade:       {Default: false, PreRelease: featuregate.Alpha},
+	UpgradePreflight:    {Default: false, PreRelease: featuregate.Alpha},
+	MultiStepUpgrade:    {Default: false, PreRelease: featuregate.Alpha},
+	CertificateRenewal:  {Default: false, PreRelease: featuregate.Alpha},
+	CrdbClientCerts:     {Default: false, PreRelease: featuregate.Alpha},
+	CertificateExpiry:   {Default: false, PreRelease: featuregate.Alpha},
+	CertificateReload:   {Default: false, PreRelease: featuregate.Alpha},
+	TopologyLocality:    {Default: false, PreRelease: featuregate.Alpha},
 }
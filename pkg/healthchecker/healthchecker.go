@@ -31,12 +31,16 @@ import (
 	"github.com/cenkalti/backoff"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 
+	api "github.com/cockroachdb/cockroach-operator/apis/v1alpha1"
 	"github.com/cockroachdb/cockroach-operator/pkg/kube"
+	"github.com/cockroachdb/cockroach-operator/pkg/labels"
 	"github.com/cockroachdb/cockroach-operator/pkg/resource"
 	"github.com/cockroachdb/cockroach-operator/pkg/scale"
 	"github.com/cockroachdb/errors"
 	"github.com/go-logr/logr"
 	"go.uber.org/zap/zapcore"
+	appsv1 "k8s.io/api/apps/v1"
+	k8slabels "k8s.io/apimachinery/pkg/labels"
 	"k8s.io/apimachinery/pkg/runtime"
 	"k8s.io/client-go/kubernetes"
 	"k8s.io/client-go/rest"
@@ -68,25 +72,24 @@ func NewHealthChecker(cluster *resource.Cluster, clientset *kubernetes.Clientset
 }
 
 // Probe will check the ranges_underreplicated metric  for value 0 on all pods after the resart of a
-// pod, before continue the rolling update of the next pod
+// pod, before continue the rolling update of the next pod. The pods of the node pools are checked too.
 func (hc *HealthCheckerImpl) Probe(ctx context.Context, l logr.Logger, logSuffix string, nodeID int) error {
 	l.V(int(zapcore.DebugLevel)).Info("Health check probe", "label", logSuffix, "nodeID", nodeID)
-	stsname := hc.cluster.StatefulSetName()
-	stsnamespace := hc.cluster.Namespace()
-
-	sts, err := hc.clientset.AppsV1().StatefulSets(stsnamespace).Get(ctx, stsname, metav1.GetOptions{})
+	statefulSets, err := hc.statefulSets(ctx, l)
 	if err != nil {
-		return kube.HandleStsError(err, l, stsname, stsnamespace)
+		return err
 	}
 
-	if err := scale.WaitUntilStatefulSetIsReadyToServe(ctx, hc.clientset, stsnamespace, stsname, *sts.Spec.Replicas); err != nil {
-		return errors.Wrapf(err, "error rolling update stategy on pod %d", nodeID)
+	for _, sts := range statefulSets {
+		if err := scale.WaitUntilStatefulSetIsReadyToServe(ctx, hc.clientset, sts.Namespace, sts.Name, *sts.Spec.Replicas); err != nil {
+			return errors.Wrapf(err, "error rolling update stategy on pod %d", nodeID)
+		}
 	}
 
 	// we check _status/vars on all cockroachdb pods looking for pairs like
 	// ranges_underreplicated{store="1"} 0 and wait if any are non-zero until all are 0.
 	// We can recheck every 10 seconds. We are waiting for this maximum 3 minutes
-	err = hc.waitUntilUnderReplicatedMetricIsZero(ctx, l, logSuffix, stsname, stsnamespace, *sts.Spec.Replicas)
+	err = hc.waitUntilUnderReplicatedMetricIsZero(ctx, l, logSuffix, statefulSets)
 	if err != nil {
 		return err
 	}
@@ -96,18 +99,51 @@ func (hc *HealthCheckerImpl) Probe(ctx context.Context, l logr.Logger, logSuffix
 	// is due to the fact that a node can be evicted in some cases
 	time.Sleep(22 * time.Second)
 	l.V(int(zapcore.DebugLevel)).Info("second wait loop for range_underreplicated metric", "label", logSuffix, "nodeID", nodeID)
-	err = hc.waitUntilUnderReplicatedMetricIsZero(ctx, l, logSuffix, stsname, stsnamespace, *sts.Spec.Replicas)
+	err = hc.waitUntilUnderReplicatedMetricIsZero(ctx, l, logSuffix, statefulSets)
 	if err != nil {
 		return err
 	}
 	return nil
 }
 
+// statefulSets returns the StatefulSet of the nodes of the cluster followed
+// by those of its node pools.
+func (hc *HealthCheckerImpl) statefulSets(ctx context.Context, l logr.Logger) ([]appsv1.StatefulSet, error) {
+	stsname := hc.cluster.StatefulSetName()
+	stsnamespace := hc.cluster.Namespace()
+
+	sts, err := hc.clientset.AppsV1().StatefulSets(stsnamespace).Get(ctx, stsname, metav1.GetOptions{})
+	if err != nil {
+		return nil, kube.HandleStsError(err, l, stsname, stsnamespace)
+	}
+
+	selector := labels.Common(hc.cluster.Unwrap()).Selector(hc.cluster.Spec().PropagatedLabels(api.PropagateStatefulSet))
+	list, err := hc.clientset.AppsV1().StatefulSets(stsnamespace).List(ctx, metav1.ListOptions{
+		LabelSelector: k8slabels.SelectorFromSet(selector).String(),
+	})
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to list the statefulsets of the node pools")
+	}
+
+	statefulSets := []appsv1.StatefulSet{*sts}
+	for _, ss := range list.Items {
+		if ss.Labels[resource.NodePoolLabel] != "" && metav1.IsControlledBy(&ss, hc.cluster.Unwrap()) {
+			statefulSets = append(statefulSets, ss)
+		}
+	}
+	return statefulSets, nil
+}
+
 //waitUntilUnderReplicatedMetricIsZero will check _status/vars on all cockroachdb pods looking for pairs like
 //ranges_underreplicated{store="1"} 0 and wait if any are non-zero until all are 0.
-func (hc *HealthCheckerImpl) waitUntilUnderReplicatedMetricIsZero(ctx context.Context, l logr.Logger, logSuffix, stsname, stsnamespace string, replicas int32) error {
+func (hc *HealthCheckerImpl) waitUntilUnderReplicatedMetricIsZero(ctx context.Context, l logr.Logger, logSuffix string, statefulSets []appsv1.StatefulSet) error {
 	f := func() error {
-		return hc.checkUnderReplicatedMetricAllPods(ctx, l, logSuffix, stsname, stsnamespace, replicas)
+		for _, sts := range statefulSets {
+			if err := hc.checkUnderReplicatedMetricAllPods(ctx, l, logSuffix, sts.Name, sts.Namespace, *sts.Spec.Replicas); err != nil {
+				return err
+			}
+		}
+		return nil
 	}
 	b := backoff.NewExponentialBackOff()
 	b.MaxElapsedTime = 3 * time.Minute
@@ -120,10 +156,11 @@ func (hc *HealthCheckerImpl) waitUntilUnderReplicatedMetricIsZero(ctx context.Co
 
 //checkUnderReplicatedMetric will make an http get call to _status/vars on a specific pod looking for pairs like
 //ranges_underreplicated{store="1"} 0
-func (hc *HealthCheckerImpl) checkUnderReplicatedMetric(ctx context.Context, l logr.Logger, logSuffix, podname, stsname, stsnamespace string, partition int32) error {
+func (hc *HealthCheckerImpl) checkUnderReplicatedMetric(ctx context.Context, l logr.Logger, logSuffix, podname, stsnamespace string, partition int32) error {
 	l.V(int(zapcore.DebugLevel)).Info("checkUnderReplicatedMetric", "label", logSuffix, "podname", podname, "partition", partition)
 	port := strconv.FormatInt(int64(*hc.cluster.Spec().HTTPPort), 10)
-	url := fmt.Sprintf("https://%s.%s.%s:%s/_status/vars", podname, stsname, stsnamespace, port)
+	// the pods of the node pools are under the service of the cluster too
+	url := fmt.Sprintf("https://%s.%s.%s:%s/_status/vars", podname, hc.cluster.DiscoveryServiceName(), stsnamespace, port)
 
 	runningInsideK8s := inK8s("/var/run/secrets/kubernetes.io/serviceaccount/token")
 
@@ -209,7 +246,7 @@ func (hc *HealthCheckerImpl) checkUnderReplicatedMetricAllPods(ctx context.Conte
 	l.V(int(zapcore.DebugLevel)).Info("checkUnderReplicatedMetric", "label", logSuffix, "replicas", replicas)
 	for partition := replicas - 1; partition >= 0; partition-- {
 		podName := fmt.Sprintf("%s-%v", stsname, partition)
-		if err := hc.checkUnderReplicatedMetric(ctx, l, logSuffix, podName, stsname, stsnamespace, partition); err != nil {
+		if err := hc.checkUnderReplicatedMetric(ctx, l, logSuffix, podName, stsnamespace, partition); err != nil {
 			return err
 		}
 	}
@@ -39,6 +39,10 @@ const (
 	ManagedByKey = "app.kubernetes.io/managed-by"
 )
 
+// ManagedByOperator is the value of ManagedByKey on the resources the operator
+// creates
+const ManagedByOperator = "cockroach-operator"
+
 var managed = []string{NameKey, InstanceKey, VersionKey, ComponentKey, PartOfKey, ManagedByKey}
 
 func Common(cluster *api.CrdbCluster) Labels {
@@ -49,6 +53,31 @@ func Common(cluster *api.CrdbCluster) Labels {
 	return ll
 }
 
+// Propagated returns the common labels of the resources of the kind, without
+// the additional labels metadataPropagation keeps off them.
+func Propagated(cluster *api.CrdbCluster, kind api.PropagatedResource) Labels {
+	ll := Labels{}
+	ll.Merge(makeCommonLabels(cluster.Labels, cluster.Name, cluster.Status.Version))
+	ll.Merge(cluster.Spec.PropagatedLabels(kind))
+
+	return ll
+}
+
+// Unpropagated returns the additional labels metadataPropagation keeps off the
+// resources of the kind.
+func Unpropagated(cluster *api.CrdbCluster, kind api.PropagatedResource) Labels {
+	propagated := Propagated(cluster, kind)
+
+	ll := Labels{}
+	for k, v := range cluster.Spec.AdditionalLabels {
+		if _, ok := propagated[k]; !ok {
+			ll[k] = v
+		}
+	}
+
+	return ll
+}
+
 func FromObject(obj runtime.Object) (Labels, error) {
 	accessor, err := meta.Accessor(obj)
 	if err != nil {
@@ -87,6 +116,15 @@ func (ll Labels) Merge(other map[string]string) {
 	}
 }
 
+// Remove deletes the labels of other whose values did not change.
+func (ll Labels) Remove(other map[string]string) {
+	for k, v := range other {
+		if ll[k] == v {
+			delete(ll, k)
+		}
+	}
+}
+
 func (ll Labels) ApplyTo(obj runtime.Object) error {
 	accessor, err := meta.Accessor(obj)
 	if err != nil {
@@ -143,7 +181,7 @@ func makeCommonLabels(other map[string]string, instance string, version string)
 	}
 
 	common[ComponentKey] = "database"
-	common[ManagedByKey] = "cockroach-operator"
+	common[ManagedByKey] = ManagedByOperator
 
 	return common
 }
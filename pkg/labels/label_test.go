@@ -19,6 +19,7 @@ package labels_test
 import (
 	"testing"
 
+	api "github.com/cockroachdb/cockroach-operator/apis/v1alpha1"
 	"github.com/cockroachdb/cockroach-operator/pkg/labels"
 	"github.com/cockroachdb/cockroach-operator/pkg/testutil"
 	"github.com/stretchr/testify/assert"
@@ -114,3 +115,33 @@ func TestSelector(t *testing.T) {
 
 	assert.Equal(t, expected, labels.Common(cr).Selector(cr.Spec.AdditionalLabels))
 }
+
+func TestPropagatedLabels(t *testing.T) {
+	custom := map[string]string{
+		"car": "koenigsegg",
+	}
+
+	cr := testutil.NewBuilder("test-cluster").Namespaced("test-ns").WithLabels(custom).Cr()
+	cr.Spec.MetadataPropagation = &api.MetadataPropagation{Resources: []api.PropagatedResource{api.PropagateStatefulSet}}
+
+	assert.Equal(t, labels.Common(cr), labels.Propagated(cr, api.PropagateStatefulSet))
+	assert.Equal(t, labels.Common(cr), labels.Propagated(cr, api.PropagatePod))
+	assert.Empty(t, labels.Unpropagated(cr, api.PropagateStatefulSet))
+
+	propagated := labels.Propagated(cr, api.PropagateService)
+	assert.NotContains(t, propagated, "car")
+	assert.Equal(t, "cockroach-operator", propagated[labels.ManagedByKey])
+	assert.Equal(t, labels.Labels(custom), labels.Unpropagated(cr, api.PropagateService))
+}
+
+func TestRemoveKeepsChangedLabels(t *testing.T) {
+	ll := labels.Labels{
+		"car":   "koenigsegg",
+		"color": "red",
+		"team":  "storage",
+	}
+
+	ll.Remove(map[string]string{"car": "koenigsegg", "color": "blue"})
+
+	assert.Equal(t, labels.Labels{"color": "red", "team": "storage"}, ll)
+}
@@ -0,0 +1,78 @@
+/*
+Copyright 2021 The Cockroach Authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    https://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package metrics
+
+import (
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"sigs.k8s.io/controller-runtime/pkg/metrics"
+)
+
+// BackupHealth is the summary of the CrdbBackups of a cluster.
+type BackupHealth struct {
+	Backups        int
+	FailingBackups int
+	// LastCompleted is when the last backup of any of the CrdbBackups
+	// completed, zero when none did
+	LastCompleted time.Time
+}
+
+var (
+	backups = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Namespace: namespace,
+		Name:      "cluster_backups",
+		Help:      "Number of CrdbBackups of a cluster.",
+	}, []string{"namespace", "cluster"})
+	backupsFailing = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Namespace: namespace,
+		Name:      "cluster_backups_failing",
+		Help:      "Number of CrdbBackups of a cluster whose schedules or last backup failed.",
+	}, []string{"namespace", "cluster"})
+	backupLastCompleted = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Namespace: namespace,
+		Name:      "cluster_last_backup_completed_timestamp_seconds",
+		Help:      "Time the last backup of a cluster completed, in seconds since the epoch.",
+	}, []string{"namespace", "cluster"})
+)
+
+func init() {
+	metrics.Registry.MustRegister(backups, backupsFailing, backupLastCompleted)
+}
+
+// SetBackupHealth exports the health of the backups of a cluster. The metrics
+// of the cluster are removed if it has no CrdbBackup.
+func SetBackupHealth(namespace, cluster string, health BackupHealth) {
+	if health.Backups == 0 {
+		deleteBackupHealth(namespace, cluster)
+		return
+	}
+
+	backups.WithLabelValues(namespace, cluster).Set(float64(health.Backups))
+	backupsFailing.WithLabelValues(namespace, cluster).Set(float64(health.FailingBackups))
+	if health.LastCompleted.IsZero() {
+		backupLastCompleted.DeleteLabelValues(namespace, cluster)
+	} else {
+		backupLastCompleted.WithLabelValues(namespace, cluster).Set(float64(health.LastCompleted.Unix()))
+	}
+}
+
+func deleteBackupHealth(namespace, cluster string) {
+	backups.DeleteLabelValues(namespace, cluster)
+	backupsFailing.DeleteLabelValues(namespace, cluster)
+	backupLastCompleted.DeleteLabelValues(namespace, cluster)
+}
@@ -0,0 +1,74 @@
+/*
+Copyright 2021 The Cockroach Authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    https://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package metrics_test
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/cockroachdb/cockroach-operator/pkg/metrics"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/stretchr/testify/require"
+	crmetrics "sigs.k8s.io/controller-runtime/pkg/metrics"
+)
+
+func TestSetBackupHealth(t *testing.T) {
+	names := []string{
+		"cockroach_operator_cluster_backups",
+		"cockroach_operator_cluster_backups_failing",
+		"cockroach_operator_cluster_last_backup_completed_timestamp_seconds",
+	}
+
+	metrics.SetBackupHealth("default", "crdb", metrics.BackupHealth{
+		Backups:        2,
+		FailingBackups: 1,
+		LastCompleted:  time.Date(2021, time.June, 1, 12, 0, 0, 0, time.UTC),
+	})
+
+	expected := `
+# HELP cockroach_operator_cluster_backups Number of CrdbBackups of a cluster.
+# TYPE cockroach_operator_cluster_backups gauge
+cockroach_operator_cluster_backups{cluster="crdb",namespace="default"} 2
+# HELP cockroach_operator_cluster_backups_failing Number of CrdbBackups of a cluster whose schedules or last backup failed.
+# TYPE cockroach_operator_cluster_backups_failing gauge
+cockroach_operator_cluster_backups_failing{cluster="crdb",namespace="default"} 1
+# HELP cockroach_operator_cluster_last_backup_completed_timestamp_seconds Time the last backup of a cluster completed, in seconds since the epoch.
+# TYPE cockroach_operator_cluster_last_backup_completed_timestamp_seconds gauge
+cockroach_operator_cluster_last_backup_completed_timestamp_seconds{cluster="crdb",namespace="default"} 1.6225488e+09
+`
+	require.NoError(t, testutil.GatherAndCompare(crmetrics.Registry, strings.NewReader(expected), names...))
+
+	// a cluster whose backups never completed has no completion time
+	metrics.SetBackupHealth("default", "crdb", metrics.BackupHealth{Backups: 1, FailingBackups: 1})
+	expected = `
+# HELP cockroach_operator_cluster_backups Number of CrdbBackups of a cluster.
+# TYPE cockroach_operator_cluster_backups gauge
+cockroach_operator_cluster_backups{cluster="crdb",namespace="default"} 1
+# HELP cockroach_operator_cluster_backups_failing Number of CrdbBackups of a cluster whose schedules or last backup failed.
+# TYPE cockroach_operator_cluster_backups_failing gauge
+cockroach_operator_cluster_backups_failing{cluster="crdb",namespace="default"} 1
+`
+	require.NoError(t, testutil.GatherAndCompare(crmetrics.Registry, strings.NewReader(expected), names...))
+
+	metrics.SetBackupHealth("default", "crdb", metrics.BackupHealth{})
+	require.NoError(t, testutil.GatherAndCompare(crmetrics.Registry, strings.NewReader(""), names...))
+
+	metrics.SetBackupHealth("default", "crdb", metrics.BackupHealth{Backups: 1})
+	metrics.DeleteCluster("default", "crdb")
+	require.NoError(t, testutil.GatherAndCompare(crmetrics.Registry, strings.NewReader(""), names...))
+}
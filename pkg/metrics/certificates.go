@@ -0,0 +1,70 @@
+/*
+Copyright 2021 The Cockroach Authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    https://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package metrics
+
+import (
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"sigs.k8s.io/controller-runtime/pkg/metrics"
+)
+
+// The certificates of a cluster whose expiry is exported.
+const (
+	NodeCertificate   = "node"
+	ClientCertificate = "client"
+	CACertificate     = "ca"
+)
+
+var certificateExpiry = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+	Namespace: namespace,
+	Name:      "cluster_certificate_expiry_timestamp_seconds",
+	Help:      "Time the certificate of a cluster expires, in seconds since the epoch.",
+}, []string{"namespace", "cluster", "certificate"})
+
+var clientCertificateExpiry = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+	Namespace: namespace,
+	Name:      "client_certificate_expiry_timestamp_seconds",
+	Help:      "Time the certificate of a CrdbClientCert expires, in seconds since the epoch.",
+}, []string{"namespace", "name"})
+
+func init() {
+	metrics.Registry.MustRegister(certificateExpiry, clientCertificateExpiry)
+}
+
+// SetCertificateExpiry exports when a certificate of a cluster expires.
+func SetCertificateExpiry(namespace, cluster, certificate string, notAfter time.Time) {
+	certificateExpiry.WithLabelValues(namespace, cluster, certificate).Set(float64(notAfter.Unix()))
+}
+
+func deleteCertificateExpiry(namespace, cluster string) {
+	certificateExpiry.DeleteLabelValues(namespace, cluster, NodeCertificate)
+	certificateExpiry.DeleteLabelValues(namespace, cluster, ClientCertificate)
+	certificateExpiry.DeleteLabelValues(namespace, cluster, CACertificate)
+}
+
+// SetClientCertificateExpiry exports when the certificate of a CrdbClientCert
+// expires.
+func SetClientCertificateExpiry(namespace, name string, notAfter time.Time) {
+	clientCertificateExpiry.WithLabelValues(namespace, name).Set(float64(notAfter.Unix()))
+}
+
+// DeleteClientCertificateExpiry stops exporting the expiry of the certificate
+// of a deleted CrdbClientCert.
+func DeleteClientCertificateExpiry(namespace, name string) {
+	clientCertificateExpiry.DeleteLabelValues(namespace, name)
+}
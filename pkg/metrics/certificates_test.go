@@ -0,0 +1,64 @@
+/*
+Copyright 2021 The Cockroach Authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    https://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package metrics_test
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/cockroachdb/cockroach-operator/pkg/metrics"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/stretchr/testify/require"
+	crmetrics "sigs.k8s.io/controller-runtime/pkg/metrics"
+)
+
+func TestSetCertificateExpiry(t *testing.T) {
+	name := "cockroach_operator_cluster_certificate_expiry_timestamp_seconds"
+
+	metrics.SetCertificateExpiry("default", "crdb", metrics.NodeCertificate, time.Date(2021, time.June, 1, 12, 0, 0, 0, time.UTC))
+	metrics.SetCertificateExpiry("default", "crdb", metrics.ClientCertificate, time.Date(2021, time.July, 1, 12, 0, 0, 0, time.UTC))
+	metrics.SetCertificateExpiry("default", "crdb", metrics.CACertificate, time.Date(2021, time.August, 1, 12, 0, 0, 0, time.UTC))
+
+	expected := `
+# HELP cockroach_operator_cluster_certificate_expiry_timestamp_seconds Time the certificate of a cluster expires, in seconds since the epoch.
+# TYPE cockroach_operator_cluster_certificate_expiry_timestamp_seconds gauge
+cockroach_operator_cluster_certificate_expiry_timestamp_seconds{certificate="ca",cluster="crdb",namespace="default"} 1.6278192e+09
+cockroach_operator_cluster_certificate_expiry_timestamp_seconds{certificate="client",cluster="crdb",namespace="default"} 1.6251408e+09
+cockroach_operator_cluster_certificate_expiry_timestamp_seconds{certificate="node",cluster="crdb",namespace="default"} 1.6225488e+09
+`
+	require.NoError(t, testutil.GatherAndCompare(crmetrics.Registry, strings.NewReader(expected), name))
+
+	metrics.DeleteCluster("default", "crdb")
+	require.NoError(t, testutil.GatherAndCompare(crmetrics.Registry, strings.NewReader(""), name))
+}
+
+func TestSetClientCertificateExpiry(t *testing.T) {
+	name := "cockroach_operator_client_certificate_expiry_timestamp_seconds"
+
+	metrics.SetClientCertificateExpiry("apps", "movr", time.Date(2021, time.June, 1, 12, 0, 0, 0, time.UTC))
+
+	expected := `
+# HELP cockroach_operator_client_certificate_expiry_timestamp_seconds Time the certificate of a CrdbClientCert expires, in seconds since the epoch.
+# TYPE cockroach_operator_client_certificate_expiry_timestamp_seconds gauge
+cockroach_operator_client_certificate_expiry_timestamp_seconds{name="movr",namespace="apps"} 1.6225488e+09
+`
+	require.NoError(t, testutil.GatherAndCompare(crmetrics.Registry, strings.NewReader(expected), name))
+
+	metrics.DeleteClientCertificateExpiry("apps", "movr")
+	require.NoError(t, testutil.GatherAndCompare(crmetrics.Registry, strings.NewReader(""), name))
+}
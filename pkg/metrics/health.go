@@ -0,0 +1,109 @@
+/*
+Copyright 2021 The Cockroach Authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    https://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package metrics
+
+import (
+	"github.com/prometheus/client_golang/prometheus"
+	"sigs.k8s.io/controller-runtime/pkg/metrics"
+)
+
+// ClusterHealth is the summary of the health of a cluster scraped by the
+// operator from its SQL interface.
+type ClusterHealth struct {
+	LiveNodes            int
+	SuspectNodes         int
+	DeadNodes            int
+	DecommissioningNodes int
+
+	UnderReplicatedRanges int64
+	UnavailableRanges     int64
+
+	// CapacityBytes, AvailableBytes and UsedBytes are the sums over the stores
+	CapacityBytes  int64
+	AvailableBytes int64
+	UsedBytes      int64
+}
+
+var (
+	healthUp = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Namespace: namespace,
+		Name:      "cluster_health_up",
+		Help:      "Whether the last scrape of the health of a cluster succeeded, 1 when it did and 0 when it did not.",
+	}, []string{"namespace", "cluster"})
+	healthNodes = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Namespace: namespace,
+		Name:      "cluster_nodes",
+		Help:      "Number of nodes of a cluster by liveness: live, suspect, dead or decommissioning.",
+	}, []string{"namespace", "cluster", "liveness"})
+	healthRanges = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Namespace: namespace,
+		Name:      "cluster_ranges",
+		Help:      "Number of ranges of a cluster that are underreplicated or unavailable.",
+	}, []string{"namespace", "cluster", "state"})
+	healthCapacity = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Namespace: namespace,
+		Name:      "cluster_capacity_bytes",
+		Help:      "Total, available and used capacity of the stores of a cluster, in bytes.",
+	}, []string{"namespace", "cluster", "kind"})
+)
+
+var (
+	livenesses  = []string{"live", "suspect", "dead", "decommissioning"}
+	rangeStates = []string{"underreplicated", "unavailable"}
+	capacities  = []string{"total", "available", "used"}
+)
+
+func init() {
+	metrics.Registry.MustRegister(healthUp, healthNodes, healthRanges, healthCapacity)
+}
+
+// SetHealth exports the health of a cluster from a successful scrape.
+func SetHealth(namespace, cluster string, health ClusterHealth) {
+	healthUp.WithLabelValues(namespace, cluster).Set(1)
+
+	healthNodes.WithLabelValues(namespace, cluster, "live").Set(float64(health.LiveNodes))
+	healthNodes.WithLabelValues(namespace, cluster, "suspect").Set(float64(health.SuspectNodes))
+	healthNodes.WithLabelValues(namespace, cluster, "dead").Set(float64(health.DeadNodes))
+	healthNodes.WithLabelValues(namespace, cluster, "decommissioning").Set(float64(health.DecommissioningNodes))
+
+	healthRanges.WithLabelValues(namespace, cluster, "underreplicated").Set(float64(health.UnderReplicatedRanges))
+	healthRanges.WithLabelValues(namespace, cluster, "unavailable").Set(float64(health.UnavailableRanges))
+
+	healthCapacity.WithLabelValues(namespace, cluster, "total").Set(float64(health.CapacityBytes))
+	healthCapacity.WithLabelValues(namespace, cluster, "available").Set(float64(health.AvailableBytes))
+	healthCapacity.WithLabelValues(namespace, cluster, "used").Set(float64(health.UsedBytes))
+}
+
+// SetHealthUnknown records that the health of a cluster could not be scraped.
+// The values of the last successful scrape are removed rather than left stale.
+func SetHealthUnknown(namespace, cluster string) {
+	deleteHealth(namespace, cluster)
+	healthUp.WithLabelValues(namespace, cluster).Set(0)
+}
+
+func deleteHealth(namespace, cluster string) {
+	healthUp.DeleteLabelValues(namespace, cluster)
+	for _, liveness := range livenesses {
+		healthNodes.DeleteLabelValues(namespace, cluster, liveness)
+	}
+	for _, state := range rangeStates {
+		healthRanges.DeleteLabelValues(namespace, cluster, state)
+	}
+	for _, kind := range capacities {
+		healthCapacity.DeleteLabelValues(namespace, cluster, kind)
+	}
+}
@@ -0,0 +1,83 @@
+/*
+Copyright 2021 The Cockroach Authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    https://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package metrics_test
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/cockroachdb/cockroach-operator/pkg/metrics"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/stretchr/testify/require"
+	crmetrics "sigs.k8s.io/controller-runtime/pkg/metrics"
+)
+
+func TestSetHealth(t *testing.T) {
+	names := []string{
+		"cockroach_operator_cluster_capacity_bytes",
+		"cockroach_operator_cluster_health_up",
+		"cockroach_operator_cluster_nodes",
+		"cockroach_operator_cluster_ranges",
+	}
+
+	metrics.SetHealth("default", "crdb", metrics.ClusterHealth{
+		LiveNodes:             2,
+		DeadNodes:             1,
+		UnderReplicatedRanges: 12,
+		CapacityBytes:         300,
+		AvailableBytes:        200,
+		UsedBytes:             80,
+	})
+
+	expected := `
+# HELP cockroach_operator_cluster_capacity_bytes Total, available and used capacity of the stores of a cluster, in bytes.
+# TYPE cockroach_operator_cluster_capacity_bytes gauge
+cockroach_operator_cluster_capacity_bytes{cluster="crdb",kind="available",namespace="default"} 200
+cockroach_operator_cluster_capacity_bytes{cluster="crdb",kind="total",namespace="default"} 300
+cockroach_operator_cluster_capacity_bytes{cluster="crdb",kind="used",namespace="default"} 80
+# HELP cockroach_operator_cluster_health_up Whether the last scrape of the health of a cluster succeeded, 1 when it did and 0 when it did not.
+# TYPE cockroach_operator_cluster_health_up gauge
+cockroach_operator_cluster_health_up{cluster="crdb",namespace="default"} 1
+# HELP cockroach_operator_cluster_nodes Number of nodes of a cluster by liveness: live, suspect, dead or decommissioning.
+# TYPE cockroach_operator_cluster_nodes gauge
+cockroach_operator_cluster_nodes{cluster="crdb",liveness="dead",namespace="default"} 1
+cockroach_operator_cluster_nodes{cluster="crdb",liveness="decommissioning",namespace="default"} 0
+cockroach_operator_cluster_nodes{cluster="crdb",liveness="live",namespace="default"} 2
+cockroach_operator_cluster_nodes{cluster="crdb",liveness="suspect",namespace="default"} 0
+# HELP cockroach_operator_cluster_ranges Number of ranges of a cluster that are underreplicated or unavailable.
+# TYPE cockroach_operator_cluster_ranges gauge
+cockroach_operator_cluster_ranges{cluster="crdb",namespace="default",state="unavailable"} 0
+cockroach_operator_cluster_ranges{cluster="crdb",namespace="default",state="underreplicated"} 12
+`
+	require.NoError(t, testutil.GatherAndCompare(crmetrics.Registry, strings.NewReader(expected), names...))
+
+	// the values of the last scrape are not left stale
+	metrics.SetHealthUnknown("default", "crdb")
+	expected = `
+# HELP cockroach_operator_cluster_health_up Whether the last scrape of the health of a cluster succeeded, 1 when it did and 0 when it did not.
+# TYPE cockroach_operator_cluster_health_up gauge
+cockroach_operator_cluster_health_up{cluster="crdb",namespace="default"} 0
+`
+	require.NoError(t, testutil.GatherAndCompare(crmetrics.Registry, strings.NewReader(expected), names...))
+
+	// the health metrics are kept while the cluster was never upgraded
+	metrics.SetUpgrade("default", "crdb", nil)
+	require.NoError(t, testutil.GatherAndCompare(crmetrics.Registry, strings.NewReader(expected), names...))
+
+	metrics.DeleteCluster("default", "crdb")
+	require.NoError(t, testutil.GatherAndCompare(crmetrics.Registry, strings.NewReader(""), names...))
+}
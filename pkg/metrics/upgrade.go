@@ -0,0 +1,103 @@
+/*
+Copyright 2021 The Cockroach Authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    https://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// Package metrics exports the Prometheus metrics of the operator. They are
+// served by the metrics endpoint of the manager along with the metrics of
+// controller-runtime.
+package metrics
+
+import (
+	api "github.com/cockroachdb/cockroach-operator/apis/v1alpha1"
+	"github.com/prometheus/client_golang/prometheus"
+	"sigs.k8s.io/controller-runtime/pkg/metrics"
+)
+
+const namespace = "cockroach_operator"
+
+var (
+	upgradeState = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Namespace: namespace,
+		Name:      "upgrade_state",
+		Help:      "State of the last version upgrade of a cluster, 1 for the current state and 0 for the others.",
+	}, []string{"namespace", "cluster", "state"})
+
+	upgradePartition = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Namespace: namespace,
+		Name:      "upgrade_partition",
+		Help:      "Partition of the StatefulSet of a cluster being upgraded, the pods with a greater or equal ordinal run the new version.",
+	}, []string{"namespace", "cluster"})
+
+	upgradePods = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Namespace: namespace,
+		Name:      "upgrade_pods",
+		Help:      "Number of pods of a cluster running the old and the new version during an upgrade.",
+	}, []string{"namespace", "cluster", "version"})
+
+	upgradeTransition = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Namespace: namespace,
+		Name:      "upgrade_last_transition_timestamp_seconds",
+		Help:      "Time the state or the partition of the upgrade of a cluster last changed, in seconds since the epoch.",
+	}, []string{"namespace", "cluster"})
+)
+
+func init() {
+	metrics.Registry.MustRegister(upgradeState, upgradePartition, upgradePods, upgradeTransition)
+}
+
+// SetUpgrade exports the progress of the last upgrade of a cluster. The
+// metrics of the cluster are removed if it was never upgraded.
+func SetUpgrade(namespace, cluster string, upgrade *api.UpgradeStatus) {
+	if upgrade == nil {
+		deleteUpgrade(namespace, cluster)
+		return
+	}
+
+	for _, state := range api.UpgradeStates {
+		value := 0.0
+		if state == upgrade.State {
+			value = 1
+		}
+		upgradeState.WithLabelValues(namespace, cluster, string(state)).Set(value)
+	}
+
+	if upgrade.Partition != nil {
+		upgradePartition.WithLabelValues(namespace, cluster).Set(float64(*upgrade.Partition))
+	} else {
+		upgradePartition.DeleteLabelValues(namespace, cluster)
+	}
+
+	upgradePods.WithLabelValues(namespace, cluster, "old").Set(float64(upgrade.OutdatedPods))
+	upgradePods.WithLabelValues(namespace, cluster, "new").Set(float64(upgrade.UpdatedPods))
+	upgradeTransition.WithLabelValues(namespace, cluster).Set(float64(upgrade.LastTransitionTime.Unix()))
+}
+
+// DeleteCluster removes the metrics of a cluster that no longer exists.
+func DeleteCluster(namespace, cluster string) {
+	deleteUpgrade(namespace, cluster)
+	deleteHealth(namespace, cluster)
+	deleteBackupHealth(namespace, cluster)
+	deleteCertificateExpiry(namespace, cluster)
+}
+
+func deleteUpgrade(namespace, cluster string) {
+	for _, state := range api.UpgradeStates {
+		upgradeState.DeleteLabelValues(namespace, cluster, string(state))
+	}
+	upgradePartition.DeleteLabelValues(namespace, cluster)
+	upgradePods.DeleteLabelValues(namespace, cluster, "old")
+	upgradePods.DeleteLabelValues(namespace, cluster, "new")
+	upgradeTransition.DeleteLabelValues(namespace, cluster)
+}
@@ -0,0 +1,74 @@
+/*
+Copyright 2021 The Cockroach Authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    https://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package metrics_test
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	api "github.com/cockroachdb/cockroach-operator/apis/v1alpha1"
+	"github.com/cockroachdb/cockroach-operator/pkg/metrics"
+	"github.com/cockroachdb/cockroach-operator/pkg/ptr"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/stretchr/testify/require"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	crmetrics "sigs.k8s.io/controller-runtime/pkg/metrics"
+)
+
+func TestSetUpgrade(t *testing.T) {
+	transition := metav1.NewTime(time.Date(2021, 6, 1, 12, 0, 0, 0, time.UTC))
+	metrics.SetUpgrade("default", "crdb", &api.UpgradeStatus{
+		State:              api.UpgradeInProgress,
+		FromVersion:        "v20.2.8",
+		ToVersion:          "v21.1.0",
+		Partition:          ptr.Int32(1),
+		UpdatedPods:        2,
+		OutdatedPods:       1,
+		LastTransitionTime: transition,
+	})
+
+	expected := `
+# HELP cockroach_operator_upgrade_last_transition_timestamp_seconds Time the state or the partition of the upgrade of a cluster last changed, in seconds since the epoch.
+# TYPE cockroach_operator_upgrade_last_transition_timestamp_seconds gauge
+cockroach_operator_upgrade_last_transition_timestamp_seconds{cluster="crdb",namespace="default"} 1.6225488e+09
+# HELP cockroach_operator_upgrade_partition Partition of the StatefulSet of a cluster being upgraded, the pods with a greater or equal ordinal run the new version.
+# TYPE cockroach_operator_upgrade_partition gauge
+cockroach_operator_upgrade_partition{cluster="crdb",namespace="default"} 1
+# HELP cockroach_operator_upgrade_pods Number of pods of a cluster running the old and the new version during an upgrade.
+# TYPE cockroach_operator_upgrade_pods gauge
+cockroach_operator_upgrade_pods{cluster="crdb",namespace="default",version="new"} 2
+cockroach_operator_upgrade_pods{cluster="crdb",namespace="default",version="old"} 1
+# HELP cockroach_operator_upgrade_state State of the last version upgrade of a cluster, 1 for the current state and 0 for the others.
+# TYPE cockroach_operator_upgrade_state gauge
+cockroach_operator_upgrade_state{cluster="crdb",namespace="default",state="Failed"} 0
+cockroach_operator_upgrade_state{cluster="crdb",namespace="default",state="InProgress"} 1
+cockroach_operator_upgrade_state{cluster="crdb",namespace="default",state="Pending"} 0
+cockroach_operator_upgrade_state{cluster="crdb",namespace="default",state="Succeeded"} 0
+`
+	names := []string{
+		"cockroach_operator_upgrade_last_transition_timestamp_seconds",
+		"cockroach_operator_upgrade_partition",
+		"cockroach_operator_upgrade_pods",
+		"cockroach_operator_upgrade_state",
+	}
+	require.NoError(t, testutil.GatherAndCompare(crmetrics.Registry, strings.NewReader(expected), names...))
+
+	// the metrics of a cluster that was never upgraded are removed
+	metrics.SetUpgrade("default", "crdb", nil)
+	require.NoError(t, testutil.GatherAndCompare(crmetrics.Registry, strings.NewReader(""), names...))
+}
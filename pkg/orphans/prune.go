@@ -0,0 +1,283 @@
+/*
+Copyright 2021 The Cockroach Authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    https://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package orphans
+
+import (
+	"context"
+	"strings"
+	"time"
+
+	api "github.com/cockroachdb/cockroach-operator/apis/v1alpha1"
+	"github.com/cockroachdb/cockroach-operator/pkg/labels"
+	"github.com/cockroachdb/cockroach-operator/pkg/resource"
+	"github.com/cockroachdb/errors"
+	"github.com/go-logr/logr"
+	batchv1 "k8s.io/api/batch/v1"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+const (
+	// SupersededAtAnnotation records when a certificate secret generated by the
+	// operator stopped being used by its cluster.
+	SupersededAtAnnotation = "crdb.io/superseded-at"
+
+	// DefaultRetention is the default time stale resources are kept for.
+	DefaultRetention = 24 * time.Hour
+)
+
+// Stale is a resource of an existing CrdbCluster that is no longer needed.
+type Stale struct {
+	Kind      string
+	Namespace string
+	Name      string
+	Cluster   string
+}
+
+// Pruner periodically deletes the resources of existing clusters that are no
+// longer needed once they have been kept for the retention period: finished
+// version checker jobs and the generated certificate secrets of clusters that
+// now use their own certificates or disabled TLS. It implements
+// manager.Runnable.
+type Pruner struct {
+	// Reader lists the resources. It should not be backed by the manager's
+	// cache, which would keep every secret of the cluster in memory.
+	Reader    client.Reader
+	Writer    client.Writer
+	Namespace string
+	Retention time.Duration
+	Interval  time.Duration
+	Log       logr.Logger
+
+	now func() time.Time
+}
+
+// NewPruner returns a pruner for the given namespace, or all namespaces if it
+// is empty.
+func NewPruner(reader client.Reader, writer client.Writer, namespace string, retention, interval time.Duration, log logr.Logger) *Pruner {
+	return &Pruner{
+		Reader:    reader,
+		Writer:    writer,
+		Namespace: namespace,
+		Retention: retention,
+		Interval:  interval,
+		Log:       log,
+		now:       time.Now,
+	}
+}
+
+// Start prunes stale resources every interval until the context is cancelled.
+func (p *Pruner) Start(ctx context.Context) error {
+	ticker := time.NewTicker(p.Interval)
+	defer ticker.Stop()
+
+	for {
+		if _, err := p.Prune(ctx); err != nil {
+			p.Log.Error(err, "failed to prune stale resources")
+		}
+
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-ticker.C:
+		}
+	}
+}
+
+// NeedLeaderElection makes sure only the leader deletes resources.
+func (p *Pruner) NeedLeaderElection() bool {
+	return true
+}
+
+// Prune deletes the stale resources whose retention period is over and returns
+// them.
+func (p *Pruner) Prune(ctx context.Context) ([]Stale, error) {
+	list := &api.CrdbClusterList{}
+	if err := p.Reader.List(ctx, list, client.InNamespace(p.Namespace)); err != nil {
+		return nil, errors.Wrap(err, "failed to list clusters")
+	}
+
+	clusters := make(map[string]*api.CrdbCluster, len(list.Items))
+	for i := range list.Items {
+		c := &list.Items[i]
+		clusters[c.Namespace+"/"+c.Name] = c
+	}
+
+	pruned, err := p.pruneJobs(ctx, clusters)
+	if err != nil {
+		return pruned, err
+	}
+
+	secrets, err := p.pruneSecrets(ctx, clusters)
+	return append(pruned, secrets...), err
+}
+
+// pruneJobs deletes the version checker jobs that finished more than the
+// retention period ago. The jobs ask for a TTL, but the TTL controller is not
+// enabled on every Kubernetes version.
+func (p *Pruner) pruneJobs(ctx context.Context, clusters map[string]*api.CrdbCluster) ([]Stale, error) {
+	jobs := &batchv1.JobList{}
+	if err := p.list(ctx, jobs); err != nil {
+		return nil, errors.Wrap(err, "failed to list jobs")
+	}
+
+	var pruned []Stale
+	for i := range jobs.Items {
+		job := &jobs.Items[i]
+		cluster := job.Labels[labels.InstanceKey]
+		if clusters[job.Namespace+"/"+cluster] == nil || !strings.Contains(job.Name, resource.VersionCheckJobName) {
+			continue
+		}
+
+		finishedAt, ok := jobFinishedAt(job)
+		if !ok || p.now().Sub(finishedAt) < p.Retention {
+			continue
+		}
+
+		stale := Stale{Kind: "Job", Namespace: job.Namespace, Name: job.Name, Cluster: cluster}
+		if err := p.delete(ctx, job, stale); err != nil {
+			return pruned, err
+		}
+		pruned = append(pruned, stale)
+	}
+
+	return pruned, nil
+}
+
+// pruneSecrets deletes the certificate secrets generated by the operator that
+// have been superseded for more than the retention period. The time a secret
+// was superseded at is recorded in an annotation the first time it is seen.
+func (p *Pruner) pruneSecrets(ctx context.Context, clusters map[string]*api.CrdbCluster) ([]Stale, error) {
+	secrets := &corev1.SecretList{}
+	if err := p.list(ctx, secrets); err != nil {
+		return nil, errors.Wrap(err, "failed to list secrets")
+	}
+
+	var pruned []Stale
+	for i := range secrets.Items {
+		secret := &secrets.Items[i]
+		cr := clusters[secret.Namespace+"/"+secret.Labels[labels.InstanceKey]]
+		if cr == nil || secret.DeletionTimestamp != nil {
+			continue
+		}
+
+		superseded, known := isSuperseded(cr, secret.Name)
+		if !known {
+			continue
+		}
+
+		supersededAt, marked := secret.Annotations[SupersededAtAnnotation]
+		if !superseded {
+			if marked {
+				// the cluster uses the generated certificates again
+				if err := p.annotate(ctx, secret, ""); err != nil {
+					return pruned, err
+				}
+			}
+			continue
+		}
+
+		if !marked {
+			if err := p.annotate(ctx, secret, p.now().UTC().Format(time.RFC3339)); err != nil {
+				return pruned, err
+			}
+			continue
+		}
+
+		since, err := time.Parse(time.RFC3339, supersededAt)
+		if err != nil {
+			p.Log.Info("ignoring invalid superseded-at annotation", "namespace", secret.Namespace, "name", secret.Name, "value", supersededAt)
+			continue
+		}
+		if p.now().Sub(since) < p.Retention {
+			continue
+		}
+
+		stale := Stale{Kind: "Secret", Namespace: secret.Namespace, Name: secret.Name, Cluster: cr.Name}
+		if err := p.delete(ctx, secret, stale); err != nil {
+			return pruned, err
+		}
+		pruned = append(pruned, stale)
+	}
+
+	return pruned, nil
+}
+
+// isSuperseded returns whether the secret with the given name is a certificate
+// secret generated for cr that cr no longer uses. known is false for secrets
+// the operator did not generate.
+func isSuperseded(cr *api.CrdbCluster, name string) (superseded, known bool) {
+	cluster := resource.NewCluster(cr)
+	switch name {
+	case cluster.CASecretName(), cluster.NodeTLSSecretName(), cluster.ClientTLSSecretName():
+	default:
+		return false, false
+	}
+
+	spec := cluster.Spec()
+	if !spec.TLSEnabled {
+		return true, true
+	}
+	if spec.NodeTLSSecret == "" {
+		return false, true
+	}
+
+	return name != spec.NodeTLSSecret && name != spec.ClientTLSSecret, true
+}
+
+func (p *Pruner) annotate(ctx context.Context, secret *corev1.Secret, value string) error {
+	patch := client.MergeFrom(secret.DeepCopy())
+	if value == "" {
+		delete(secret.Annotations, SupersededAtAnnotation)
+	} else {
+		metav1.SetMetaDataAnnotation(&secret.ObjectMeta, SupersededAtAnnotation, value)
+	}
+
+	if err := p.Writer.Patch(ctx, secret, patch); client.IgnoreNotFound(err) != nil {
+		return errors.Wrapf(err, "failed to annotate secret %s/%s", secret.Namespace, secret.Name)
+	}
+	return nil
+}
+
+func (p *Pruner) delete(ctx context.Context, obj client.Object, stale Stale) error {
+	if err := p.Writer.Delete(ctx, obj, client.PropagationPolicy(metav1.DeletePropagationBackground)); client.IgnoreNotFound(err) != nil {
+		return errors.Wrapf(err, "failed to delete %s %s/%s", stale.Kind, stale.Namespace, stale.Name)
+	}
+
+	p.Log.Info("deleted stale resource", "kind", stale.Kind, "namespace", stale.Namespace, "name", stale.Name, "CrdbCluster", stale.Cluster)
+	return nil
+}
+
+// list lists the objects the operator created for any cluster.
+func (p *Pruner) list(ctx context.Context, list client.ObjectList) error {
+	return p.Reader.List(ctx, list,
+		client.InNamespace(p.Namespace),
+		managedByOperator,
+		client.HasLabels{labels.InstanceKey},
+	)
+}
+
+// jobFinishedAt returns when the job completed or failed.
+func jobFinishedAt(job *batchv1.Job) (time.Time, bool) {
+	for _, c := range job.Status.Conditions {
+		if (c.Type == batchv1.JobComplete || c.Type == batchv1.JobFailed) && c.Status == corev1.ConditionTrue {
+			return c.LastTransitionTime.Time, true
+		}
+	}
+	return time.Time{}, false
+}
@@ -0,0 +1,118 @@
+/*
+Copyright 2021 The Cockroach Authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    https://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package orphans_test
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	. "github.com/cockroachdb/cockroach-operator/pkg/orphans"
+	"github.com/cockroachdb/cockroach-operator/pkg/testutil"
+	"github.com/go-logr/logr"
+	"github.com/stretchr/testify/require"
+	batchv1 "k8s.io/api/batch/v1"
+	corev1 "k8s.io/api/core/v1"
+	apiErrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/types"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+)
+
+func TestPrune(t *testing.T) {
+	scheme := testutil.InitScheme(t)
+	ctx := context.Background()
+	longAgo := time.Now().Add(-2 * DefaultRetention)
+
+	objectMeta := func(name, cluster string) metav1.ObjectMeta {
+		return metav1.ObjectMeta{
+			Name:      name,
+			Namespace: "default",
+			Labels: map[string]string{
+				"app.kubernetes.io/name":       "cockroachdb",
+				"app.kubernetes.io/component":  "database",
+				"app.kubernetes.io/instance":   cluster,
+				"app.kubernetes.io/managed-by": "cockroach-operator",
+			},
+		}
+	}
+
+	job := func(name, cluster string, finishedAt *time.Time) *batchv1.Job {
+		j := &batchv1.Job{ObjectMeta: objectMeta(name, cluster)}
+		if finishedAt != nil {
+			j.Status.Conditions = []batchv1.JobCondition{{
+				Type:               batchv1.JobComplete,
+				Status:             corev1.ConditionTrue,
+				LastTransitionTime: metav1.NewTime(*finishedAt),
+			}}
+		}
+		return j
+	}
+
+	recently := time.Now()
+	supersededLongAgo := objectMeta("custom-node", "custom")
+	supersededLongAgo.Annotations = map[string]string{SupersededAtAnnotation: longAgo.UTC().Format(time.RFC3339)}
+
+	objs := []runtime.Object{
+		testutil.NewBuilder("generated").Namespaced("default").WithTLS().Cr(),
+		testutil.NewBuilder("custom").Namespaced("default").WithTLS().WithNodeTLS("custom-certs").Cr(),
+		job("generated-vcheck-1", "generated", &longAgo),
+		job("generated-vcheck-2", "generated", &recently),
+		job("generated-vcheck-3", "generated", nil),
+		job("deleted-vcheck-1", "deleted", &longAgo),
+		&corev1.Secret{ObjectMeta: objectMeta("generated-node", "generated")},
+		&corev1.Secret{ObjectMeta: supersededLongAgo},
+		&corev1.Secret{ObjectMeta: objectMeta("custom-root", "custom")},
+		&corev1.Secret{ObjectMeta: objectMeta("custom-certs", "custom")},
+	}
+
+	cl := fake.NewFakeClientWithScheme(scheme, objs...)
+	p := NewPruner(cl, cl, "", DefaultRetention, DefaultInterval, logr.Discard())
+
+	pruned, err := p.Prune(ctx)
+	require.NoError(t, err)
+	require.Equal(t, []Stale{
+		{Kind: "Job", Namespace: "default", Name: "generated-vcheck-1", Cluster: "generated"},
+		{Kind: "Secret", Namespace: "default", Name: "custom-node", Cluster: "custom"},
+	}, pruned)
+
+	key := func(name string) types.NamespacedName {
+		return types.NamespacedName{Namespace: "default", Name: name}
+	}
+
+	require.True(t, apiErrors.IsNotFound(cl.Get(ctx, key("generated-vcheck-1"), &batchv1.Job{})))
+	for _, name := range []string{"generated-vcheck-2", "generated-vcheck-3", "deleted-vcheck-1"} {
+		require.NoError(t, cl.Get(ctx, key(name), &batchv1.Job{}), name)
+	}
+	require.True(t, apiErrors.IsNotFound(cl.Get(ctx, key("custom-node"), &corev1.Secret{})))
+
+	// a newly superseded secret is marked and kept for the retention period
+	secret := &corev1.Secret{}
+	require.NoError(t, cl.Get(ctx, key("custom-root"), secret))
+	require.Contains(t, secret.Annotations, SupersededAtAnnotation)
+
+	for _, name := range []string{"generated-node", "custom-certs"} {
+		secret := &corev1.Secret{}
+		require.NoError(t, cl.Get(ctx, key(name), secret), name)
+		require.NotContains(t, secret.Annotations, SupersededAtAnnotation, name)
+	}
+
+	pruned, err = p.Prune(ctx)
+	require.NoError(t, err)
+	require.Empty(t, pruned)
+}
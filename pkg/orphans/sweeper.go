@@ -0,0 +1,231 @@
+/*
+Copyright 2021 The Cockroach Authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    https://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// Package orphans finds resources that were created for a CrdbCluster that no
+// longer exists. Resources owned by a CrdbCluster are removed by the Kubernetes
+// garbage collector, but PVCs created from volume claim templates, secrets and
+// jobs left behind by interrupted actors are not, and accumulate forever. It
+// also prunes the resources existing clusters no longer need.
+package orphans
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	api "github.com/cockroachdb/cockroach-operator/apis/v1alpha1"
+	"github.com/cockroachdb/cockroach-operator/pkg/labels"
+	"github.com/cockroachdb/cockroach-operator/pkg/resource"
+	"github.com/cockroachdb/errors"
+	"github.com/go-logr/logr"
+	batchv1 "k8s.io/api/batch/v1"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+// Policy tells what to do with orphaned resources.
+type Policy string
+
+const (
+	// PolicyIgnore disables the sweep.
+	PolicyIgnore Policy = "ignore"
+	// PolicyReport logs orphaned resources without deleting them.
+	PolicyReport Policy = "report"
+	// PolicyDelete deletes orphaned resources.
+	PolicyDelete Policy = "delete"
+
+	// DefaultInterval is the default time between two sweeps.
+	DefaultInterval = time.Hour
+
+	// defaultMinAge protects resources of clusters that are being created while
+	// a sweep runs.
+	defaultMinAge = 10 * time.Minute
+)
+
+// managedByOperator selects the resources the operator created for a
+// cluster: the selector labels the operator puts on everything it creates, and
+// the label it manages them with. Resources created by other tools, such as
+// the CockroachDB Helm chart, can share the selector labels but are not
+// managed by the operator.
+var managedByOperator = client.MatchingLabels{
+	labels.NameKey:      "cockroachdb",
+	labels.ComponentKey: "database",
+	labels.ManagedByKey: labels.ManagedByOperator,
+}
+
+// ParsePolicy returns the policy with the given name.
+func ParsePolicy(name string) (Policy, error) {
+	switch p := Policy(name); p {
+	case PolicyIgnore, PolicyReport, PolicyDelete:
+		return p, nil
+	default:
+		return "", fmt.Errorf("unknown orphaned resource policy %q, expected one of %s, %s or %s",
+			name, PolicyIgnore, PolicyReport, PolicyDelete)
+	}
+}
+
+// Orphan is a resource whose CrdbCluster no longer exists.
+type Orphan struct {
+	Kind      string
+	Namespace string
+	Name      string
+	Cluster   string
+}
+
+// Sweeper periodically looks for orphaned resources and handles them according
+// to its policy. It implements manager.Runnable.
+type Sweeper struct {
+	// Reader lists the resources. It should not be backed by the manager's
+	// cache, which would keep every secret of the cluster in memory.
+	Reader    client.Reader
+	Writer    client.Writer
+	Namespace string
+	Policy    Policy
+	Interval  time.Duration
+	MinAge    time.Duration
+	Log       logr.Logger
+}
+
+// NewSweeper returns a sweeper for the given namespace, or all namespaces if it
+// is empty.
+func NewSweeper(reader client.Reader, writer client.Writer, namespace string, policy Policy, interval time.Duration, log logr.Logger) *Sweeper {
+	return &Sweeper{
+		Reader:    reader,
+		Writer:    writer,
+		Namespace: namespace,
+		Policy:    policy,
+		Interval:  interval,
+		MinAge:    defaultMinAge,
+		Log:       log,
+	}
+}
+
+// Start runs a sweep every interval until the context is cancelled.
+func (s *Sweeper) Start(ctx context.Context) error {
+	ticker := time.NewTicker(s.Interval)
+	defer ticker.Stop()
+
+	for {
+		if _, err := s.Sweep(ctx); err != nil {
+			s.Log.Error(err, "failed to sweep orphaned resources")
+		}
+
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-ticker.C:
+		}
+	}
+}
+
+// NeedLeaderElection makes sure only the leader deletes resources.
+func (s *Sweeper) NeedLeaderElection() bool {
+	return true
+}
+
+// Sweep finds the orphaned resources and deletes them if the policy says so.
+func (s *Sweeper) Sweep(ctx context.Context) ([]Orphan, error) {
+	clusters := &api.CrdbClusterList{}
+	if err := s.Reader.List(ctx, clusters, client.InNamespace(s.Namespace)); err != nil {
+		return nil, errors.Wrap(err, "failed to list clusters")
+	}
+
+	existing := make(map[string]bool, len(clusters.Items))
+	for _, c := range clusters.Items {
+		existing[c.Namespace+"/"+c.Name] = true
+	}
+
+	lists := []struct {
+		kind string
+		list client.ObjectList
+	}{
+		{"PersistentVolumeClaim", &corev1.PersistentVolumeClaimList{}},
+		{"Secret", &corev1.SecretList{}},
+		{"Job", &batchv1.JobList{}},
+	}
+
+	var orphans []Orphan
+	for _, l := range lists {
+		found, err := s.sweepList(ctx, l.kind, l.list, existing)
+		orphans = append(orphans, found...)
+		if err != nil {
+			return orphans, err
+		}
+	}
+
+	return orphans, nil
+}
+
+func (s *Sweeper) sweepList(ctx context.Context, kind string, list client.ObjectList, existing map[string]bool) ([]Orphan, error) {
+	err := s.Reader.List(ctx, list,
+		client.InNamespace(s.Namespace),
+		managedByOperator,
+		client.HasLabels{labels.InstanceKey},
+	)
+	if err != nil {
+		return nil, errors.Wrapf(err, "failed to list %s", kind)
+	}
+
+	items, err := meta.ExtractList(list)
+	if err != nil {
+		return nil, err
+	}
+
+	var orphans []Orphan
+	for _, item := range items {
+		obj, ok := item.(client.Object)
+		if !ok {
+			continue
+		}
+
+		cluster := obj.GetLabels()[labels.InstanceKey]
+		if existing[obj.GetNamespace()+"/"+cluster] || !s.canSweep(obj) {
+			continue
+		}
+
+		orphan := Orphan{Kind: kind, Namespace: obj.GetNamespace(), Name: obj.GetName(), Cluster: cluster}
+		orphans = append(orphans, orphan)
+
+		log := s.Log.WithValues("kind", kind, "namespace", orphan.Namespace, "name", orphan.Name, "CrdbCluster", cluster)
+		if s.Policy != PolicyDelete {
+			log.Info("found resource of a CrdbCluster that no longer exists")
+			continue
+		}
+
+		if err := s.Writer.Delete(ctx, obj, client.PropagationPolicy(metav1.DeletePropagationBackground)); client.IgnoreNotFound(err) != nil {
+			return orphans, errors.Wrapf(err, "failed to delete %s %s/%s", kind, orphan.Namespace, orphan.Name)
+		}
+		log.Info("deleted resource of a CrdbCluster that no longer exists")
+	}
+
+	return orphans, nil
+}
+
+// canSweep returns false for resources that are being deleted, that are
+// removed by the garbage collector, that were retained on purpose by the
+// reclaim policy of their cluster or that are too recent to tell.
+func (s *Sweeper) canSweep(obj client.Object) bool {
+	if obj.GetDeletionTimestamp() != nil || len(obj.GetOwnerReferences()) > 0 {
+		return false
+	}
+	if obj.GetAnnotations()[resource.RetainedAnnotation] == "true" {
+		return false
+	}
+
+	return time.Since(obj.GetCreationTimestamp().Time) >= s.MinAge
+}
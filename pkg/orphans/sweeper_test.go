@@ -0,0 +1,133 @@
+/*
+Copyright 2021 The Cockroach Authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    https://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package orphans_test
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	. "github.com/cockroachdb/cockroach-operator/pkg/orphans"
+	"github.com/cockroachdb/cockroach-operator/pkg/resource"
+	"github.com/cockroachdb/cockroach-operator/pkg/testutil"
+	"github.com/go-logr/logr"
+	"github.com/stretchr/testify/require"
+	batchv1 "k8s.io/api/batch/v1"
+	corev1 "k8s.io/api/core/v1"
+	apiErrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/types"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+)
+
+func TestSweep(t *testing.T) {
+	scheme := testutil.InitScheme(t)
+	old := metav1.NewTime(time.Now().Add(-time.Hour))
+
+	objectMeta := func(name, cluster string) metav1.ObjectMeta {
+		return metav1.ObjectMeta{
+			Name:              name,
+			Namespace:         "default",
+			CreationTimestamp: old,
+			Labels: map[string]string{
+				"app.kubernetes.io/name":       "cockroachdb",
+				"app.kubernetes.io/component":  "database",
+				"app.kubernetes.io/instance":   cluster,
+				"app.kubernetes.io/managed-by": "cockroach-operator",
+			},
+		}
+	}
+
+	owned := objectMeta("owned-ca", "deleted")
+	owned.OwnerReferences = []metav1.OwnerReference{{Kind: "CrdbCluster", Name: "deleted"}}
+
+	recent := objectMeta("recent-job", "deleted")
+	recent.CreationTimestamp = metav1.Now()
+
+	helm := objectMeta("datadir-helm-0", "helm")
+	helm.Labels["app.kubernetes.io/component"] = "cockroachdb"
+
+	// a PVC of the CockroachDB Helm chart sharing the selector labels of the
+	// operator
+	foreign := objectMeta("datadir-foreign-0", "foreign")
+	foreign.Labels["app.kubernetes.io/managed-by"] = "Helm"
+	foreign.Labels["helm.sh/chart"] = "cockroachdb-6.0.0"
+
+	// a PVC created before the operator labelled the PVCs it manages
+	unmanaged := objectMeta("datadir-unmanaged-0", "unmanaged")
+	delete(unmanaged.Labels, "app.kubernetes.io/managed-by")
+
+	retained := objectMeta("datadir-retained-0", "retained")
+	retained.Annotations = map[string]string{resource.RetainedAnnotation: "true"}
+
+	objs := []runtime.Object{
+		testutil.NewBuilder("live").Namespaced("default").Cr(),
+		&corev1.PersistentVolumeClaim{ObjectMeta: objectMeta("datadir-live-0", "live")},
+		&corev1.PersistentVolumeClaim{ObjectMeta: objectMeta("datadir-deleted-0", "deleted")},
+		&corev1.PersistentVolumeClaim{ObjectMeta: helm},
+		&corev1.PersistentVolumeClaim{ObjectMeta: foreign},
+		&corev1.PersistentVolumeClaim{ObjectMeta: unmanaged},
+		&corev1.PersistentVolumeClaim{ObjectMeta: retained},
+		&corev1.Secret{ObjectMeta: objectMeta("deleted-node", "deleted")},
+		&corev1.Secret{ObjectMeta: owned},
+		&batchv1.Job{ObjectMeta: recent},
+	}
+
+	tests := []struct {
+		name    string
+		policy  Policy
+		deleted bool
+	}{
+		{name: "report", policy: PolicyReport},
+		{name: "delete", policy: PolicyDelete, deleted: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctx := context.Background()
+			cl := fake.NewFakeClientWithScheme(scheme, objs...)
+
+			s := NewSweeper(cl, cl, "", tt.policy, DefaultInterval, logr.Discard())
+			orphans, err := s.Sweep(ctx)
+			require.NoError(t, err)
+
+			require.Equal(t, []Orphan{
+				{Kind: "PersistentVolumeClaim", Namespace: "default", Name: "datadir-deleted-0", Cluster: "deleted"},
+				{Kind: "Secret", Namespace: "default", Name: "deleted-node", Cluster: "deleted"},
+			}, orphans)
+
+			err = cl.Get(ctx, types.NamespacedName{Namespace: "default", Name: "datadir-deleted-0"}, &corev1.PersistentVolumeClaim{})
+			require.Equal(t, tt.deleted, apiErrors.IsNotFound(err))
+
+			require.NoError(t, cl.Get(ctx, types.NamespacedName{Namespace: "default", Name: "datadir-live-0"}, &corev1.PersistentVolumeClaim{}))
+			require.NoError(t, cl.Get(ctx, types.NamespacedName{Namespace: "default", Name: "owned-ca"}, &corev1.Secret{}))
+			require.NoError(t, cl.Get(ctx, types.NamespacedName{Namespace: "default", Name: "datadir-retained-0"}, &corev1.PersistentVolumeClaim{}))
+			require.NoError(t, cl.Get(ctx, types.NamespacedName{Namespace: "default", Name: "datadir-foreign-0"}, &corev1.PersistentVolumeClaim{}))
+			require.NoError(t, cl.Get(ctx, types.NamespacedName{Namespace: "default", Name: "datadir-unmanaged-0"}, &corev1.PersistentVolumeClaim{}))
+		})
+	}
+}
+
+func TestParsePolicy(t *testing.T) {
+	p, err := ParsePolicy("delete")
+	require.NoError(t, err)
+	require.Equal(t, PolicyDelete, p)
+
+	_, err = ParsePolicy("purge")
+	require.Error(t, err)
+}
@@ -27,3 +27,7 @@ func Int64(i int64) *int64 {
 func Bool(b bool) *bool {
 	return &b
 }
+
+func String(s string) *string {
+	return &s
+}
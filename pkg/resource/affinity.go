@@ -0,0 +1,207 @@
+/*
+Copyright 2021 The Cockroach Authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    https://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package resource
+
+import (
+	"context"
+
+	api "github.com/cockroachdb/cockroach-operator/apis/v1alpha1"
+	"github.com/cockroachdb/cockroach-operator/pkg/features"
+	"github.com/cockroachdb/cockroach-operator/pkg/labels"
+	"github.com/cockroachdb/cockroach-operator/pkg/utilfeature"
+	"github.com/cockroachdb/errors"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+// relaxedAntiAffinityWeight is the weight of the preferred terms the required
+// pod anti-affinity terms are turned into.
+const relaxedAntiAffinityWeight = 100
+
+// CanRelaxAntiAffinity returns whether the spec asks for the relaxation of the
+// pod anti-affinity and the pods have required anti-affinity terms.
+func (cluster Cluster) CanRelaxAntiAffinity() bool {
+	if !cluster.Spec().RelaxAntiAffinity || !utilfeature.DefaultMutableFeatureGate.Enabled(features.AffinityRules) {
+		return false
+	}
+
+	affinity := cluster.specAffinity()
+	return affinity != nil && affinity.PodAntiAffinity != nil &&
+		len(affinity.PodAntiAffinity.RequiredDuringSchedulingIgnoredDuringExecution) > 0
+}
+
+// PodAffinity returns the affinity of the pods. The required pod anti-affinity
+// terms are turned into preferred ones while the AntiAffinityRelaxed condition
+// is true.
+func (cluster Cluster) PodAffinity() *corev1.Affinity {
+	if !cluster.CanRelaxAntiAffinity() || !cluster.True(api.AntiAffinityRelaxedCondition) {
+		return cluster.specAffinity()
+	}
+
+	affinity := cluster.specAffinity().DeepCopy()
+	anti := affinity.PodAntiAffinity
+	for _, term := range anti.RequiredDuringSchedulingIgnoredDuringExecution {
+		anti.PreferredDuringSchedulingIgnoredDuringExecution = append(anti.PreferredDuringSchedulingIgnoredDuringExecution,
+			corev1.WeightedPodAffinityTerm{Weight: relaxedAntiAffinityWeight, PodAffinityTerm: term})
+	}
+	anti.RequiredDuringSchedulingIgnoredDuringExecution = nil
+
+	return affinity
+}
+
+// specAffinity returns the affinity of the spec, with the required pod
+// anti-affinity term of the topology key of the spec, which spreads the pods of
+// the cluster over the values of the label of the Kubernetes nodes. The
+// affinity of the spec needs the AffinityRules feature gate, the topology key
+// applies without it, like the node selector.
+func (cluster Cluster) specAffinity() *corev1.Affinity {
+	var spec *corev1.Affinity
+	if utilfeature.DefaultMutableFeatureGate.Enabled(features.AffinityRules) {
+		spec = cluster.Spec().Affinity
+	}
+
+	key := cluster.Spec().TopologyKey
+	if key == "" {
+		return spec
+	}
+
+	affinity := spec.DeepCopy()
+	if affinity == nil {
+		affinity = &corev1.Affinity{}
+	}
+	if affinity.PodAntiAffinity == nil {
+		affinity.PodAntiAffinity = &corev1.PodAntiAffinity{}
+	}
+	anti := affinity.PodAntiAffinity
+	anti.RequiredDuringSchedulingIgnoredDuringExecution = append(anti.RequiredDuringSchedulingIgnoredDuringExecution, corev1.PodAffinityTerm{
+		LabelSelector: &metav1.LabelSelector{
+			MatchLabels: labels.Common(cluster.cr).Selector(cluster.cr.Spec.AdditionalLabels),
+		},
+		TopologyKey: key,
+	})
+
+	return affinity
+}
+
+// TopologySpreadConstraints returns the topology spread constraints of the
+// spec, those without a label selector counting the pods of the cluster,
+// including the pods of the node pools.
+func (cluster Cluster) TopologySpreadConstraints() []corev1.TopologySpreadConstraint {
+	if len(cluster.Spec().TopologySpreadConstraints) == 0 {
+		return nil
+	}
+
+	constraints := make([]corev1.TopologySpreadConstraint, 0, len(cluster.Spec().TopologySpreadConstraints))
+	for _, c := range cluster.Spec().TopologySpreadConstraints {
+		c := *c.DeepCopy()
+		if c.LabelSelector == nil {
+			c.LabelSelector = &metav1.LabelSelector{
+				MatchLabels: labels.Common(cluster.cr).Selector(cluster.cr.Spec.AdditionalLabels),
+			}
+		}
+		constraints = append(constraints, c)
+	}
+	return constraints
+}
+
+// SchedulableNodes returns the number of nodes of the Kubernetes cluster the
+// pods can be scheduled on: ready nodes with the labels of the node selector of
+// the spec that are not cordoned and whose NoSchedule and NoExecute taints are
+// tolerated by the pods.
+func SchedulableNodes(ctx context.Context, cl client.Client, cluster *Cluster) (int, error) {
+	nodes := &corev1.NodeList{}
+	if err := cl.List(ctx, nodes, client.MatchingLabels(cluster.Spec().NodeSelector)); err != nil {
+		return 0, errors.Wrap(err, "failed to list the nodes")
+	}
+
+	var tolerations []corev1.Toleration
+	if utilfeature.DefaultMutableFeatureGate.Enabled(features.TolerationRules) {
+		tolerations = cluster.Spec().Tolerations
+	}
+
+	count := 0
+	for i := range nodes.Items {
+		if schedulable(&nodes.Items[i], tolerations) {
+			count++
+		}
+	}
+
+	return count, nil
+}
+
+// FailureDomains returns the number of failure domains of the Kubernetes
+// cluster: the values of the topology key label of the schedulable nodes with
+// the labels of the node selector. Nodes without the label are not counted.
+func FailureDomains(ctx context.Context, cl client.Client, cluster *Cluster, topologyKey string, nodeSelector map[string]string) (int, error) {
+	nodes := &corev1.NodeList{}
+	if err := cl.List(ctx, nodes, client.MatchingLabels(nodeSelector)); err != nil {
+		return 0, errors.Wrap(err, "failed to list the nodes")
+	}
+
+	var tolerations []corev1.Toleration
+	if utilfeature.DefaultMutableFeatureGate.Enabled(features.TolerationRules) {
+		tolerations = cluster.Spec().Tolerations
+	}
+
+	domains := make(map[string]bool)
+	for i := range nodes.Items {
+		node := &nodes.Items[i]
+		if domain := node.Labels[topologyKey]; domain != "" && schedulable(node, tolerations) {
+			domains[domain] = true
+		}
+	}
+
+	return len(domains), nil
+}
+
+func schedulable(node *corev1.Node, tolerations []corev1.Toleration) bool {
+	if node.Spec.Unschedulable || !NodeReady(node) {
+		return false
+	}
+
+	for i := range node.Spec.Taints {
+		taint := &node.Spec.Taints[i]
+		if taint.Effect == corev1.TaintEffectPreferNoSchedule {
+			continue
+		}
+		if !tolerated(taint, tolerations) {
+			return false
+		}
+	}
+
+	return true
+}
+
+// NodeReady returns whether the Ready condition of the node is true.
+func NodeReady(node *corev1.Node) bool {
+	for _, c := range node.Status.Conditions {
+		if c.Type == corev1.NodeReady {
+			return c.Status == corev1.ConditionTrue
+		}
+	}
+	return false
+}
+
+func tolerated(taint *corev1.Taint, tolerations []corev1.Toleration) bool {
+	for i := range tolerations {
+		if tolerations[i].ToleratesTaint(taint) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,236 @@
+/*
+Copyright 2021 The Cockroach Authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    https://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package resource_test
+
+import (
+	"context"
+	"testing"
+
+	api "github.com/cockroachdb/cockroach-operator/apis/v1alpha1"
+	"github.com/cockroachdb/cockroach-operator/pkg/labels"
+	"github.com/cockroachdb/cockroach-operator/pkg/resource"
+	"github.com/cockroachdb/cockroach-operator/pkg/testutil"
+	"github.com/cockroachdb/cockroach-operator/pkg/utilfeature"
+	"github.com/stretchr/testify/require"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+)
+
+func TestPodAffinity(t *testing.T) {
+	utilfeature.DefaultMutableFeatureGate.Set("AffinityRules=true")
+
+	term := corev1.PodAffinityTerm{
+		LabelSelector: &metav1.LabelSelector{MatchLabels: map[string]string{"app.kubernetes.io/instance": "crdb"}},
+		TopologyKey:   "kubernetes.io/hostname",
+	}
+	affinity := &corev1.Affinity{
+		PodAntiAffinity: &corev1.PodAntiAffinity{
+			RequiredDuringSchedulingIgnoredDuringExecution: []corev1.PodAffinityTerm{term},
+		},
+	}
+
+	cr := testutil.NewBuilder("crdb").Namespaced("default").WithAffinity(affinity).Cr()
+	cluster := resource.NewCluster(cr)
+
+	// the affinity is kept until the spec asks for the relaxation and the
+	// condition is set
+	cluster.SetCondition(api.AntiAffinityRelaxedCondition, metav1.ConditionTrue, "NotEnoughNodes", "")
+	require.False(t, cluster.CanRelaxAntiAffinity())
+	require.Equal(t, affinity, cluster.PodAffinity())
+
+	cr = cluster.Unwrap()
+	cr.Spec.RelaxAntiAffinity = true
+	cluster = resource.NewCluster(cr)
+	require.True(t, cluster.CanRelaxAntiAffinity())
+
+	relaxed := cluster.PodAffinity()
+	require.Empty(t, relaxed.PodAntiAffinity.RequiredDuringSchedulingIgnoredDuringExecution)
+	require.Equal(t, []corev1.WeightedPodAffinityTerm{{Weight: 100, PodAffinityTerm: term}},
+		relaxed.PodAntiAffinity.PreferredDuringSchedulingIgnoredDuringExecution)
+	// the spec is left as it is
+	require.Len(t, affinity.PodAntiAffinity.RequiredDuringSchedulingIgnoredDuringExecution, 1)
+
+	cluster.SetCondition(api.AntiAffinityRelaxedCondition, metav1.ConditionFalse, "EnoughNodes", "")
+	require.Equal(t, affinity, cluster.PodAffinity())
+}
+
+func TestPodAffinityTopologyKey(t *testing.T) {
+	utilfeature.DefaultMutableFeatureGate.Set("AffinityRules=true")
+
+	node := corev1.NodeSelectorTerm{
+		MatchExpressions: []corev1.NodeSelectorRequirement{{Key: "pool", Operator: corev1.NodeSelectorOpIn, Values: []string{"db"}}},
+	}
+	affinity := &corev1.Affinity{
+		NodeAffinity: &corev1.NodeAffinity{
+			RequiredDuringSchedulingIgnoredDuringExecution: &corev1.NodeSelector{NodeSelectorTerms: []corev1.NodeSelectorTerm{node}},
+		},
+	}
+
+	cr := testutil.NewBuilder("crdb").Namespaced("default").WithAffinity(affinity).Cr()
+	cr.Spec.TopologyKey = "topology.kubernetes.io/zone"
+	cluster := resource.NewCluster(cr)
+
+	// the anti-affinity term of the topology key is added to the affinity of
+	// the spec, which is left as it is
+	podAffinity := cluster.PodAffinity()
+	require.Equal(t, affinity.NodeAffinity, podAffinity.NodeAffinity)
+	require.Nil(t, affinity.PodAntiAffinity)
+	require.Equal(t, []corev1.PodAffinityTerm{{
+		LabelSelector: &metav1.LabelSelector{MatchLabels: labels.Common(cr).Selector(nil)},
+		TopologyKey:   "topology.kubernetes.io/zone",
+	}}, podAffinity.PodAntiAffinity.RequiredDuringSchedulingIgnoredDuringExecution)
+
+	// the term is relaxed like those of the spec
+	cr.Spec.Affinity = nil
+	cr.Spec.RelaxAntiAffinity = true
+	cluster = resource.NewCluster(cr)
+	require.True(t, cluster.CanRelaxAntiAffinity())
+	cluster.SetCondition(api.AntiAffinityRelaxedCondition, metav1.ConditionTrue, "NotEnoughNodes", "")
+	relaxed := cluster.PodAffinity()
+	require.Empty(t, relaxed.PodAntiAffinity.RequiredDuringSchedulingIgnoredDuringExecution)
+	require.Len(t, relaxed.PodAntiAffinity.PreferredDuringSchedulingIgnoredDuringExecution, 1)
+	require.Equal(t, "topology.kubernetes.io/zone", relaxed.PodAntiAffinity.PreferredDuringSchedulingIgnoredDuringExecution[0].PodAffinityTerm.TopologyKey)
+
+	// the topology key applies without the feature gate, the affinity of the
+	// spec does not
+	utilfeature.DefaultMutableFeatureGate.Set("AffinityRules=false")
+	defer utilfeature.DefaultMutableFeatureGate.Set("AffinityRules=true")
+	cr.Spec.Affinity = affinity
+	cluster = resource.NewCluster(cr)
+	podAffinity = cluster.PodAffinity()
+	require.Nil(t, podAffinity.NodeAffinity)
+	require.Len(t, podAffinity.PodAntiAffinity.RequiredDuringSchedulingIgnoredDuringExecution, 1)
+}
+
+func TestTopologySpreadConstraints(t *testing.T) {
+	cr := testutil.NewBuilder("crdb").Namespaced("default").Cr()
+	cluster := resource.NewCluster(cr)
+	require.Nil(t, cluster.TopologySpreadConstraints())
+
+	selector := &metav1.LabelSelector{MatchLabels: map[string]string{"app": "cockroachdb"}}
+	cr.Spec.TopologySpreadConstraints = []corev1.TopologySpreadConstraint{
+		{MaxSkew: 1, TopologyKey: "topology.kubernetes.io/zone", WhenUnsatisfiable: corev1.DoNotSchedule},
+		{MaxSkew: 2, TopologyKey: "kubernetes.io/hostname", WhenUnsatisfiable: corev1.ScheduleAnyway, LabelSelector: selector},
+	}
+	cluster = resource.NewCluster(cr)
+
+	// a constraint without a selector counts the pods of the cluster
+	constraints := cluster.TopologySpreadConstraints()
+	require.Len(t, constraints, 2)
+	require.Equal(t, "topology.kubernetes.io/zone", constraints[0].TopologyKey)
+	require.Equal(t, labels.Common(cr).Selector(nil), constraints[0].LabelSelector.MatchLabels)
+	require.Equal(t, selector, constraints[1].LabelSelector)
+	// the spec is left as it is
+	require.Nil(t, cr.Spec.TopologySpreadConstraints[0].LabelSelector)
+}
+
+func TestSchedulableNodes(t *testing.T) {
+	utilfeature.DefaultMutableFeatureGate.Set("TolerationRules=true")
+	scheme := testutil.InitScheme(t)
+
+	node := func(name string, ready bool, mutate func(n *corev1.Node)) *corev1.Node {
+		status := corev1.ConditionFalse
+		if ready {
+			status = corev1.ConditionTrue
+		}
+		n := &corev1.Node{
+			ObjectMeta: metav1.ObjectMeta{Name: name},
+			Status: corev1.NodeStatus{
+				Conditions: []corev1.NodeCondition{{Type: corev1.NodeReady, Status: status}},
+			},
+		}
+		mutate(n)
+		return n
+	}
+	taint := func(key string, effect corev1.TaintEffect) func(n *corev1.Node) {
+		return func(n *corev1.Node) {
+			n.Spec.Taints = append(n.Spec.Taints, corev1.Taint{Key: key, Effect: effect})
+		}
+	}
+
+	cl := fake.NewFakeClientWithScheme(scheme,
+		node("ready", true, func(n *corev1.Node) {}),
+		node("not-ready", false, func(n *corev1.Node) {}),
+		node("cordoned", true, func(n *corev1.Node) { n.Spec.Unschedulable = true }),
+		node("dedicated", true, func(n *corev1.Node) {
+			taint("dedicated", corev1.TaintEffectNoSchedule)(n)
+			n.Labels = map[string]string{"pool": "db"}
+		}),
+		node("preferred", true, taint("spot", corev1.TaintEffectPreferNoSchedule)),
+	)
+
+	cr := testutil.NewBuilder("crdb").Namespaced("default").Cr()
+	cluster := resource.NewCluster(cr)
+
+	count, err := resource.SchedulableNodes(context.TODO(), cl, &cluster)
+	require.NoError(t, err)
+	require.Equal(t, 2, count)
+
+	cr.Spec.Tolerations = []corev1.Toleration{{Key: "dedicated", Operator: corev1.TolerationOpExists}}
+	cluster = resource.NewCluster(cr)
+	count, err = resource.SchedulableNodes(context.TODO(), cl, &cluster)
+	require.NoError(t, err)
+	require.Equal(t, 3, count)
+
+	// only the nodes with the labels of the node selector are counted
+	cr.Spec.NodeSelector = map[string]string{"pool": "db"}
+	cluster = resource.NewCluster(cr)
+	count, err = resource.SchedulableNodes(context.TODO(), cl, &cluster)
+	require.NoError(t, err)
+	require.Equal(t, 1, count)
+}
+
+func TestFailureDomains(t *testing.T) {
+	scheme := testutil.InitScheme(t)
+
+	node := func(name, zone string, ready bool, pool string) *corev1.Node {
+		status := corev1.ConditionFalse
+		if ready {
+			status = corev1.ConditionTrue
+		}
+		n := &corev1.Node{
+			ObjectMeta: metav1.ObjectMeta{Name: name, Labels: map[string]string{"pool": pool}},
+			Status: corev1.NodeStatus{
+				Conditions: []corev1.NodeCondition{{Type: corev1.NodeReady, Status: status}},
+			},
+		}
+		if zone != "" {
+			n.Labels[api.DefaultScaleUpTopologyKey] = zone
+		}
+		return n
+	}
+
+	cl := fake.NewFakeClientWithScheme(scheme,
+		node("a-1", "a", true, "default"),
+		node("a-2", "a", true, "default"),
+		node("b-1", "b", true, "default"),
+		node("c-1", "c", false, "default"),
+		node("no-zone", "", true, "default"),
+		node("d-1", "d", true, "large"),
+	)
+
+	cluster := resource.NewCluster(testutil.NewBuilder("crdb").Namespaced("default").Cr())
+
+	domains, err := resource.FailureDomains(context.TODO(), cl, &cluster, api.DefaultScaleUpTopologyKey, nil)
+	require.NoError(t, err)
+	require.Equal(t, 3, domains)
+
+	domains, err = resource.FailureDomains(context.TODO(), cl, &cluster, api.DefaultScaleUpTopologyKey, map[string]string{"pool": "default"})
+	require.NoError(t, err)
+	require.Equal(t, 2, domains)
+}
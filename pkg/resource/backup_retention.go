@@ -0,0 +1,330 @@
+/*
+Copyright 2021 The Cockroach Authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    https://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package resource
+
+import (
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"net/url"
+	"path"
+	"sort"
+	"strings"
+	"time"
+
+	api "github.com/cockroachdb/cockroach-operator/apis/v1alpha1"
+	"github.com/cockroachdb/cockroach-operator/pkg/labels"
+	"github.com/cockroachdb/cockroach-operator/pkg/ptr"
+	kbatch "k8s.io/api/batch/v1"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+const (
+	// DefaultPruneImage is the rclone image deleting the expired backups
+	DefaultPruneImage = "rclone/rclone:1.57.0"
+
+	// BackupPruneContainerName is the name of the container deleting the
+	// expired backups
+	BackupPruneContainerName = "rclone"
+
+	// backupPathLayout is the layout of the paths of the full backups in a
+	// collection, as listed by SHOW BACKUPS
+	backupPathLayout = "2006/01/02-150405.00"
+
+	backupPruneComponent = "backup-prune"
+)
+
+// ExpiredBackups returns the paths of the full backups the retention does not
+// keep, from the oldest to the most recent. The latest backup and the paths
+// that are not named after the time of their backup are always kept, and so
+// are all the backups when the retention has no rule.
+func ExpiredBackups(paths []string, retention api.BackupRetention, now time.Time) []string {
+	if retention.KeepLast == 0 && retention.KeepDaily == 0 && retention.MaxAge == nil {
+		return nil
+	}
+
+	type backup struct {
+		path string
+		time time.Time
+	}
+	var backups []backup
+	for _, p := range paths {
+		t, err := time.Parse(backupPathLayout, strings.TrimPrefix(p, "/"))
+		if err != nil {
+			continue
+		}
+		backups = append(backups, backup{path: p, time: t})
+	}
+	if len(backups) == 0 {
+		return nil
+	}
+	sort.SliceStable(backups, func(i, j int) bool { return backups[i].time.Before(backups[j].time) })
+
+	last := len(backups) - 1
+	kept := map[int]bool{last: true}
+	for i := last; i >= 0 && i > last-int(retention.KeepLast); i-- {
+		kept[i] = true
+	}
+	days := make(map[string]bool)
+	for i := last; i >= 0 && len(days) < int(retention.KeepDaily); i-- {
+		day := backups[i].time.Format("2006-01-02")
+		if !days[day] {
+			days[day] = true
+			kept[i] = true
+		}
+	}
+	if retention.MaxAge != nil {
+		for i, b := range backups {
+			if now.Sub(b.time) <= retention.MaxAge.Duration {
+				kept[i] = true
+			}
+		}
+	}
+
+	var expired []string
+	for i, b := range backups {
+		if !kept[i] {
+			expired = append(expired, b.path)
+		}
+	}
+	return expired
+}
+
+// PruneSink is where rclone deletes the expired backups of a collection.
+type PruneSink struct {
+	// Remote is the rclone path of the collection, an on the fly remote such
+	// as :s3:bucket/path or a directory of the backup volume
+	Remote string
+	// Env configures the remote, credentials included
+	Env map[string]string
+	// BackupVolume is true when the collection is on the backup volume of
+	// the cluster
+	BackupVolume bool
+}
+
+// NewPruneSink returns the sink of the collection at uri, in the format of the
+// CockroachDB BACKUP statement. Only s3, gs, azure and nodelocal collections
+// can be pruned.
+func NewPruneSink(uri string) (PruneSink, error) {
+	u, err := url.Parse(uri)
+	if err != nil {
+		return PruneSink{}, errors.New("failed to parse the backup URI")
+	}
+
+	query := u.Query()
+	implicit := query.Get("AUTH") == "implicit"
+	env := make(map[string]string)
+	set := func(key, param string) {
+		if v := query.Get(param); v != "" {
+			env[key] = v
+		}
+	}
+
+	switch u.Scheme {
+	case "s3":
+		env["RCLONE_S3_PROVIDER"] = "AWS"
+		if query.Get("AWS_ENDPOINT") != "" {
+			env["RCLONE_S3_PROVIDER"] = "Other"
+		}
+		set("RCLONE_S3_ENDPOINT", "AWS_ENDPOINT")
+		set("RCLONE_S3_REGION", "AWS_REGION")
+		if implicit {
+			env["RCLONE_S3_ENV_AUTH"] = "true"
+		} else {
+			set("RCLONE_S3_ACCESS_KEY_ID", "AWS_ACCESS_KEY_ID")
+			set("RCLONE_S3_SECRET_ACCESS_KEY", "AWS_SECRET_ACCESS_KEY")
+			set("RCLONE_S3_SESSION_TOKEN", "AWS_SESSION_TOKEN")
+		}
+		return PruneSink{Remote: ":s3:" + u.Host + u.Path, Env: env}, nil
+	case "gs":
+		if implicit {
+			env["RCLONE_GCS_ENV_AUTH"] = "true"
+		} else if credentials := query.Get("CREDENTIALS"); credentials != "" {
+			decoded, err := base64.StdEncoding.DecodeString(credentials)
+			if err != nil {
+				return PruneSink{}, errors.New("failed to decode the CREDENTIALS of the backup URI")
+			}
+			env["RCLONE_GCS_SERVICE_ACCOUNT_CREDENTIALS"] = string(decoded)
+		}
+		return PruneSink{Remote: ":gcs:" + u.Host + u.Path, Env: env}, nil
+	case "azure", "azure-blob", "azure-storage":
+		set("RCLONE_AZUREBLOB_ACCOUNT", "AZURE_ACCOUNT_NAME")
+		if implicit {
+			env["RCLONE_AZUREBLOB_ENV_AUTH"] = "true"
+		} else {
+			set("RCLONE_AZUREBLOB_KEY", "AZURE_ACCOUNT_KEY")
+		}
+		return PruneSink{Remote: ":azureblob:" + u.Host + u.Path, Env: env}, nil
+	case "nodelocal":
+		return PruneSink{Remote: path.Join(backupsDirMountPath, u.Path), Env: env, BackupVolume: true}, nil
+	}
+
+	return PruneSink{}, fmt.Errorf("backups in %s URIs cannot be pruned", u.Scheme)
+}
+
+// BackupPruneName returns the name of the Job deleting the expired backups of
+// a CrdbBackup, and of the secret configuring it.
+func BackupPruneName(backup *api.CrdbBackup) string {
+	return fmt.Sprintf("%s-prune", backup.Name)
+}
+
+// BackupPruneSecretBuilder models the secret holding the configuration of the
+// rclone remote of a collection, which can include credentials.
+type BackupPruneSecretBuilder struct {
+	*Cluster
+
+	Backup *api.CrdbBackup
+	Sink   PruneSink
+}
+
+func (b BackupPruneSecretBuilder) ResourceName() string {
+	return BackupPruneName(b.Backup)
+}
+
+func (b BackupPruneSecretBuilder) Build(obj client.Object) error {
+	secret, ok := obj.(*corev1.Secret)
+	if !ok {
+		return errors.New("failed to cast to Secret object")
+	}
+
+	if secret.ObjectMeta.Name == "" {
+		secret.ObjectMeta.Name = b.ResourceName()
+	}
+
+	secret.Annotations = b.Spec().PropagatedAnnotations(api.PropagateSecret)
+	secret.Data = make(map[string][]byte)
+	for k, v := range b.Sink.Env {
+		secret.Data[k] = []byte(v)
+	}
+	return nil
+}
+
+func (b BackupPruneSecretBuilder) Placeholder() client.Object {
+	return &corev1.Secret{
+		ObjectMeta: metav1.ObjectMeta{
+			Name: b.ResourceName(),
+		},
+	}
+}
+
+// BackupPruneJobBuilder models the Job deleting the expired backups of a
+// collection with rclone, along with their incremental backups.
+type BackupPruneJobBuilder struct {
+	*Cluster
+
+	Backup   *api.CrdbBackup
+	Sink     PruneSink
+	Paths    []string
+	Selector labels.Labels
+}
+
+func (b BackupPruneJobBuilder) ResourceName() string {
+	return BackupPruneName(b.Backup)
+}
+
+// Build creates a kbatch.Job deleting the backups once. The pod template of a
+// Job is immutable, an existing Job is left as is.
+func (b BackupPruneJobBuilder) Build(obj client.Object) error {
+	job, ok := obj.(*kbatch.Job)
+	if !ok {
+		return errors.New("failed to cast to Job object")
+	}
+
+	if job.ObjectMeta.Name == "" {
+		job.ObjectMeta.Name = b.ResourceName()
+	}
+
+	job.Annotations = b.Spec().AdditionalAnnotations
+
+	if job.ResourceVersion != "" {
+		return nil
+	}
+
+	podLabels := labels.Labels{}
+	podLabels.Merge(b.Selector)
+	podLabels[labels.ComponentKey] = backupPruneComponent
+
+	image := b.Backup.Spec.Retention.Image
+	if image == "" {
+		image = DefaultPruneImage
+	}
+
+	// the incremental backups are either in the directory of their full
+	// backup or in the incrementals directory of the collection
+	script := []string{"set -e"}
+	for _, p := range b.Paths {
+		p = strings.TrimPrefix(p, "/")
+		script = append(script,
+			"rclone purge "+shellQuote(b.Sink.Remote+"/"+p),
+			"rclone purge "+shellQuote(b.Sink.Remote+"/incrementals/"+p)+" || true")
+	}
+
+	container := corev1.Container{
+		Name:    BackupPruneContainerName,
+		Image:   image,
+		Command: []string{"/bin/sh", "-c", strings.Join(script, "\n")},
+		EnvFrom: []corev1.EnvFromSource{{
+			SecretRef: &corev1.SecretEnvSource{
+				LocalObjectReference: corev1.LocalObjectReference{Name: b.ResourceName()},
+			},
+		}},
+	}
+
+	// the service account gives the cloud identity of the cluster
+	spec := corev1.PodSpec{
+		SecurityContext: &corev1.PodSecurityContext{
+			RunAsUser: ptr.Int64(1000581000),
+			FSGroup:   ptr.Int64(1000581000),
+		},
+		AutomountServiceAccountToken: ptr.Bool(false),
+		ServiceAccountName:           b.ServiceAccountName(),
+		RestartPolicy:                corev1.RestartPolicyNever,
+	}
+	if b.Sink.BackupVolume {
+		container.VolumeMounts = []corev1.VolumeMount{{Name: backupsDirName, MountPath: backupsDirMountPath}}
+		spec.Volumes = []corev1.Volume{{
+			Name: backupsDirName,
+			VolumeSource: corev1.VolumeSource{
+				PersistentVolumeClaim: &corev1.PersistentVolumeClaimVolumeSource{ClaimName: b.BackupVolumeClaimName()},
+			},
+		}}
+	}
+	spec.Containers = []corev1.Container{container}
+
+	job.Spec = kbatch.JobSpec{
+		BackoffLimit: ptr.Int32(2),
+		Template: corev1.PodTemplateSpec{
+			ObjectMeta: metav1.ObjectMeta{
+				Labels:      podLabels,
+				Annotations: b.JobPodAnnotations(),
+			},
+			Spec: spec,
+		},
+	}
+
+	return nil
+}
+
+func (b BackupPruneJobBuilder) Placeholder() client.Object {
+	return &kbatch.Job{
+		ObjectMeta: metav1.ObjectMeta{
+			Name: b.ResourceName(),
+		},
+	}
+}
@@ -0,0 +1,159 @@
+/*
+Copyright 2021 The Cockroach Authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    https://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package resource_test
+
+import (
+	"testing"
+	"time"
+
+	api "github.com/cockroachdb/cockroach-operator/apis/v1alpha1"
+	"github.com/cockroachdb/cockroach-operator/pkg/resource"
+	"github.com/cockroachdb/cockroach-operator/pkg/testutil"
+	"github.com/stretchr/testify/require"
+	kbatch "k8s.io/api/batch/v1"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+func TestExpiredBackups(t *testing.T) {
+	paths := []string{
+		"/2021/06/01-000000.00",
+		"/2021/06/01-120000.00",
+		"/2021/06/02-000000.00",
+		"/2021/06/02-120000.00",
+		"/2021/06/03-000000.00",
+		"/2021/06/03-120000.00",
+		"manual",
+	}
+	now := time.Date(2021, time.June, 3, 18, 0, 0, 0, time.UTC)
+
+	tests := []struct {
+		name      string
+		retention api.BackupRetention
+		expected  []string
+	}{
+		{
+			name:      "no rule keeps everything",
+			retention: api.BackupRetention{},
+		},
+		{
+			name:      "keep last",
+			retention: api.BackupRetention{KeepLast: 2},
+			expected:  []string{"/2021/06/01-000000.00", "/2021/06/01-120000.00", "/2021/06/02-000000.00", "/2021/06/02-120000.00"},
+		},
+		{
+			name:      "keep daily",
+			retention: api.BackupRetention{KeepDaily: 2},
+			expected:  []string{"/2021/06/01-000000.00", "/2021/06/01-120000.00", "/2021/06/02-000000.00", "/2021/06/03-000000.00"},
+		},
+		{
+			name:      "max age",
+			retention: api.BackupRetention{MaxAge: &metav1.Duration{Duration: 24 * time.Hour}},
+			expected:  []string{"/2021/06/01-000000.00", "/2021/06/01-120000.00", "/2021/06/02-000000.00", "/2021/06/02-120000.00"},
+		},
+		{
+			name:      "rules add up",
+			retention: api.BackupRetention{KeepLast: 1, KeepDaily: 3, MaxAge: &metav1.Duration{Duration: 18 * time.Hour}},
+			expected:  []string{"/2021/06/01-000000.00", "/2021/06/02-000000.00"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			require.Equal(t, tt.expected, resource.ExpiredBackups(paths, tt.retention, now))
+		})
+	}
+}
+
+func TestNewPruneSink(t *testing.T) {
+	tests := []struct {
+		uri      string
+		expected resource.PruneSink
+	}{
+		{
+			uri: "s3://backups/crdb?AUTH=implicit&AWS_REGION=us-east-1",
+			expected: resource.PruneSink{Remote: ":s3:backups/crdb", Env: map[string]string{
+				"RCLONE_S3_PROVIDER": "AWS",
+				"RCLONE_S3_REGION":   "us-east-1",
+				"RCLONE_S3_ENV_AUTH": "true",
+			}},
+		},
+		{
+			uri: "s3://backups/crdb?AWS_ACCESS_KEY_ID=id&AWS_SECRET_ACCESS_KEY=secret&AWS_ENDPOINT=http://minio:9000",
+			expected: resource.PruneSink{Remote: ":s3:backups/crdb", Env: map[string]string{
+				"RCLONE_S3_PROVIDER":          "Other",
+				"RCLONE_S3_ENDPOINT":          "http://minio:9000",
+				"RCLONE_S3_ACCESS_KEY_ID":     "id",
+				"RCLONE_S3_SECRET_ACCESS_KEY": "secret",
+			}},
+		},
+		{
+			uri: "gs://backups/crdb?AUTH=specified&CREDENTIALS=eyJ0eXBlIjoic2VydmljZV9hY2NvdW50In0=",
+			expected: resource.PruneSink{Remote: ":gcs:backups/crdb", Env: map[string]string{
+				"RCLONE_GCS_SERVICE_ACCOUNT_CREDENTIALS": `{"type":"service_account"}`,
+			}},
+		},
+		{
+			uri: "azure-blob://backups/crdb?AUTH=implicit&AZURE_ACCOUNT_NAME=crdb",
+			expected: resource.PruneSink{Remote: ":azureblob:backups/crdb", Env: map[string]string{
+				"RCLONE_AZUREBLOB_ACCOUNT":  "crdb",
+				"RCLONE_AZUREBLOB_ENV_AUTH": "true",
+			}},
+		},
+		{
+			uri:      "nodelocal://1/backups/crdb",
+			expected: resource.PruneSink{Remote: "/cockroach/cockroach-backups/backups/crdb", Env: map[string]string{}, BackupVolume: true},
+		},
+	}
+
+	for _, tt := range tests {
+		sink, err := resource.NewPruneSink(tt.uri)
+		require.NoError(t, err, tt.uri)
+		require.Equal(t, tt.expected, sink, tt.uri)
+	}
+
+	_, err := resource.NewPruneSink("userfile:///backups")
+	require.EqualError(t, err, "backups in userfile URIs cannot be pruned")
+}
+
+func TestBackupPruneJobBuilder(t *testing.T) {
+	cr := testutil.NewBuilder("crdb").Namespaced("default").WithPVDataStore("1Gi", "standard").Cr()
+	cr.Spec.BackupVolume = &api.BackupVolume{ClaimName: "nfs-backups"}
+	cluster := resource.NewCluster(cr)
+	backup := &api.CrdbBackup{
+		ObjectMeta: metav1.ObjectMeta{Namespace: "default", Name: "nightly"},
+		Spec:       api.CrdbBackupSpec{Retention: &api.BackupRetention{KeepLast: 7}},
+	}
+	sink, err := resource.NewPruneSink("nodelocal://1/nightly")
+	require.NoError(t, err)
+
+	b := resource.BackupPruneJobBuilder{Cluster: &cluster, Backup: backup, Sink: sink, Paths: []string{"/2021/06/01-000000.00"}}
+	job := b.Placeholder().(*kbatch.Job)
+	require.NoError(t, b.Build(job))
+	require.Equal(t, "nightly-prune", job.Name)
+
+	spec := job.Spec.Template.Spec
+	require.Equal(t, corev1.RestartPolicyNever, spec.RestartPolicy)
+	require.Equal(t, "nfs-backups", spec.Volumes[0].PersistentVolumeClaim.ClaimName)
+	container := spec.Containers[0]
+	require.Equal(t, resource.DefaultPruneImage, container.Image)
+	require.Equal(t, "nightly-prune", container.EnvFrom[0].SecretRef.Name)
+	require.Equal(t, []string{"/bin/sh", "-c", "set -e\n" +
+		"rclone purge '/cockroach/cockroach-backups/nightly/2021/06/01-000000.00'\n" +
+		"rclone purge '/cockroach/cockroach-backups/nightly/incrementals/2021/06/01-000000.00' || true",
+	}, container.Command)
+}
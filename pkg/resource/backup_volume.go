@@ -0,0 +1,74 @@
+/*
+Copyright 2021 The Cockroach Authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    https://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package resource
+
+import (
+	"errors"
+
+	api "github.com/cockroachdb/cockroach-operator/apis/v1alpha1"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+// BackupVolumeClaimBuilder models the PersistentVolumeClaim of the backup
+// volume that the operator provisions.
+type BackupVolumeClaimBuilder struct {
+	*Cluster
+}
+
+func (b BackupVolumeClaimBuilder) ResourceName() string {
+	return b.BackupVolumeClaimName()
+}
+
+// Build creates a corev1.PersistentVolumeClaim mounted by all the pods. The
+// spec of a claim is immutable once it is bound, except for the storage
+// request, which is only ever grown.
+func (b BackupVolumeClaimBuilder) Build(obj client.Object) error {
+	pvc, ok := obj.(*corev1.PersistentVolumeClaim)
+	if !ok {
+		return errors.New("failed to cast to PersistentVolumeClaim object")
+	}
+
+	if pvc.ObjectMeta.Name == "" {
+		pvc.ObjectMeta.Name = b.ResourceName()
+	}
+
+	pvc.Annotations = b.Spec().PropagatedAnnotations(api.PropagatePersistentVolumeClaim)
+
+	volume := b.Spec().BackupVolume
+	size := volume.SizeOrDefault()
+	if pvc.ResourceVersion == "" {
+		pvc.Spec = corev1.PersistentVolumeClaimSpec{
+			AccessModes:      []corev1.PersistentVolumeAccessMode{corev1.ReadWriteMany},
+			StorageClassName: volume.StorageClassName,
+		}
+	} else if current, ok := pvc.Spec.Resources.Requests[corev1.ResourceStorage]; ok && current.Cmp(size) >= 0 {
+		return nil
+	}
+
+	pvc.Spec.Resources.Requests = corev1.ResourceList{corev1.ResourceStorage: size}
+	return nil
+}
+
+func (b BackupVolumeClaimBuilder) Placeholder() client.Object {
+	return &corev1.PersistentVolumeClaim{
+		ObjectMeta: metav1.ObjectMeta{
+			Name: b.ResourceName(),
+		},
+	}
+}
@@ -0,0 +1,100 @@
+/*
+Copyright 2021 The Cockroach Authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    https://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package resource_test
+
+import (
+	"strings"
+	"testing"
+
+	api "github.com/cockroachdb/cockroach-operator/apis/v1alpha1"
+	"github.com/cockroachdb/cockroach-operator/pkg/labels"
+	"github.com/cockroachdb/cockroach-operator/pkg/resource"
+	"github.com/cockroachdb/cockroach-operator/pkg/testutil"
+	"github.com/stretchr/testify/require"
+	appsv1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+	apiresource "k8s.io/apimachinery/pkg/api/resource"
+)
+
+func backupVolumeCluster(volume *api.BackupVolume) *resource.Cluster {
+	cr := testutil.NewBuilder("crdb").Namespaced("default").WithPVDataStore("1Gi", "standard").Cr()
+	cr.Spec.BackupVolume = volume
+	cluster := resource.NewCluster(cr)
+	return &cluster
+}
+
+func TestBackupVolumeClaimBuilder(t *testing.T) {
+	nfs := "nfs"
+	size := apiresource.MustParse("200Gi")
+	cluster := backupVolumeCluster(&api.BackupVolume{StorageClassName: &nfs, Size: &size})
+	require.Equal(t, "crdb-backups", cluster.BackupVolumeClaimName())
+
+	b := resource.BackupVolumeClaimBuilder{Cluster: cluster}
+	pvc := b.Placeholder().(*corev1.PersistentVolumeClaim)
+	require.NoError(t, b.Build(pvc))
+	require.Equal(t, "crdb-backups", pvc.Name)
+	require.Equal(t, []corev1.PersistentVolumeAccessMode{corev1.ReadWriteMany}, pvc.Spec.AccessModes)
+	require.Equal(t, &nfs, pvc.Spec.StorageClassName)
+	require.Equal(t, "200Gi", pvc.Spec.Resources.Requests.Storage().String())
+
+	// a bound claim keeps its spec and is only grown
+	pvc.ResourceVersion = "1"
+	pvc.Spec.VolumeName = "pv-1"
+	pvc.Spec.Resources.Requests[corev1.ResourceStorage] = apiresource.MustParse("300Gi")
+	require.NoError(t, b.Build(pvc))
+	require.Equal(t, "pv-1", pvc.Spec.VolumeName)
+	require.Equal(t, "300Gi", pvc.Spec.Resources.Requests.Storage().String())
+
+	pvc.Spec.Resources.Requests[corev1.ResourceStorage] = apiresource.MustParse("100Gi")
+	require.NoError(t, b.Build(pvc))
+	require.Equal(t, "200Gi", pvc.Spec.Resources.Requests.Storage().String())
+
+	existing := backupVolumeCluster(&api.BackupVolume{ClaimName: "nfs-backups"})
+	require.Equal(t, "nfs-backups", existing.BackupVolumeClaimName())
+}
+
+func TestStatefulSetMountsTheBackupVolume(t *testing.T) {
+	for _, volume := range []*api.BackupVolume{nil, {ClaimName: "nfs-backups"}} {
+		cluster := backupVolumeCluster(volume)
+		ss := &appsv1.StatefulSet{}
+		err := resource.StatefulSetBuilder{
+			Cluster:  cluster,
+			Selector: labels.Common(cluster.Unwrap()).Selector(nil),
+		}.Build(ss)
+		require.NoError(t, err)
+
+		var claim string
+		for _, v := range ss.Spec.Template.Spec.Volumes {
+			if v.Name == "backups" {
+				claim = v.PersistentVolumeClaim.ClaimName
+			}
+		}
+		command := strings.Join(ss.Spec.Template.Spec.Containers[0].Command, " ")
+
+		if volume == nil {
+			require.Empty(t, claim)
+			require.NotContains(t, command, "--external-io-dir")
+			continue
+		}
+		require.Equal(t, "nfs-backups", claim)
+		require.Contains(t, ss.Spec.Template.Spec.Containers[0].VolumeMounts, corev1.VolumeMount{
+			Name:      "backups",
+			MountPath: "/cockroach/cockroach-backups/",
+		})
+		require.Contains(t, command, "--external-io-dir=/cockroach/cockroach-backups/")
+	}
+}
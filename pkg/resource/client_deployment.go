@@ -0,0 +1,108 @@
+/*
+Copyright 2021 The Cockroach Authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    https://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package resource
+
+import (
+	"errors"
+
+	"github.com/cockroachdb/cockroach-operator/pkg/labels"
+	"github.com/cockroachdb/cockroach-operator/pkg/ptr"
+	appsv1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+const (
+	// ClientContainerName is the name of the container of the client pod
+	ClientContainerName = "client"
+
+	clientComponent = "client"
+)
+
+// ClientDeploymentBuilder models the Deployment of the client pod, a pod with
+// the cockroach binary and the root client certificate where the SQL shell
+// connects to the cluster without any flags.
+type ClientDeploymentBuilder struct {
+	*Cluster
+
+	Selector labels.Labels
+}
+
+func (b ClientDeploymentBuilder) ResourceName() string {
+	return b.ClientDeploymentName()
+}
+
+// Build creates an appsv1.Deployment with a single replica. The pod labels use
+// their own component, so that the services and the PodDisruptionBudget of the
+// database do not select the client pod.
+func (b ClientDeploymentBuilder) Build(obj client.Object) error {
+	deploy, ok := obj.(*appsv1.Deployment)
+	if !ok {
+		return errors.New("failed to cast to Deployment object")
+	}
+
+	if deploy.ObjectMeta.Name == "" {
+		deploy.ObjectMeta.Name = b.ResourceName()
+	}
+
+	deploy.Annotations = b.Spec().AdditionalAnnotations
+
+	selector := labels.Labels{}
+	selector.Merge(b.Selector)
+	selector[labels.ComponentKey] = clientComponent
+
+	var resources corev1.ResourceRequirements
+	if p := b.Spec().ClientPod; p != nil {
+		resources = p.Resources
+	}
+
+	// the container sleeps until a shell is opened in it
+	spec, err := clientPodSpec(b.Cluster, corev1.Container{
+		Name:      ClientContainerName,
+		Command:   []string{"sleep", "2147483648"},
+		Resources: resources,
+	})
+	if err != nil {
+		return err
+	}
+	spec.TerminationGracePeriodSeconds = ptr.Int64(0)
+
+	deploy.Spec = appsv1.DeploymentSpec{
+		Replicas: ptr.Int32(1),
+		Selector: &metav1.LabelSelector{
+			MatchLabels: selector,
+		},
+		Template: corev1.PodTemplateSpec{
+			ObjectMeta: metav1.ObjectMeta{
+				Labels:      selector,
+				Annotations: b.Spec().AdditionalAnnotations,
+			},
+			Spec: spec,
+		},
+	}
+
+	return nil
+}
+
+func (b ClientDeploymentBuilder) Placeholder() client.Object {
+	return &appsv1.Deployment{
+		ObjectMeta: metav1.ObjectMeta{
+			Name: b.ResourceName(),
+		},
+	}
+}
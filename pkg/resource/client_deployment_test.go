@@ -0,0 +1,93 @@
+/*
+Copyright 2021 The Cockroach Authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    https://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package resource_test
+
+import (
+	"testing"
+
+	api "github.com/cockroachdb/cockroach-operator/apis/v1alpha1"
+	"github.com/cockroachdb/cockroach-operator/pkg/labels"
+	"github.com/cockroachdb/cockroach-operator/pkg/resource"
+	"github.com/cockroachdb/cockroach-operator/pkg/testutil"
+	"github.com/stretchr/testify/require"
+	appsv1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+	apiresource "k8s.io/apimachinery/pkg/api/resource"
+)
+
+func TestClientDeploymentBuilder(t *testing.T) {
+	resources := corev1.ResourceRequirements{
+		Limits: corev1.ResourceList{corev1.ResourceMemory: apiresource.MustParse("256Mi")},
+	}
+
+	cr := testutil.NewBuilder("crdb").Namespaced("default").WithPVDataStore("1Gi", "standard").WithTLS().Cr()
+	cr.Spec.ClientPod = &api.ClientPod{Enabled: true, Resources: resources}
+	cluster := resource.NewCluster(cr)
+	selector := labels.Common(cluster.Unwrap()).Selector(nil)
+
+	b := resource.ClientDeploymentBuilder{Cluster: &cluster, Selector: selector}
+	deploy := b.Placeholder().(*appsv1.Deployment)
+	require.NoError(t, b.Build(deploy))
+	require.Equal(t, "crdb-client", deploy.Name)
+	require.Equal(t, int32(1), *deploy.Spec.Replicas)
+
+	// the services of the database must not select the client pod
+	podLabels := deploy.Spec.Template.Labels
+	require.Equal(t, deploy.Spec.Selector.MatchLabels, podLabels)
+	require.Equal(t, "client", podLabels[labels.ComponentKey])
+	require.Equal(t, "database", selector[labels.ComponentKey])
+
+	spec := deploy.Spec.Template.Spec
+	require.Len(t, spec.Containers, 1)
+	container := spec.Containers[0]
+	require.Equal(t, resource.ClientContainerName, container.Name)
+	require.Equal(t, cluster.GetCockroachDBImageName(), container.Image)
+	require.Equal(t, resources, container.Resources)
+	require.Contains(t, container.Env, corev1.EnvVar{Name: "COCKROACH_HOST", Value: "crdb-public.default:26257"})
+	require.Contains(t, container.Env, corev1.EnvVar{Name: "COCKROACH_CERTS_DIR", Value: "/cockroach/cockroach-certs/"})
+	require.Equal(t, []corev1.VolumeMount{{Name: "emptydir", MountPath: "/cockroach/cockroach-certs/"}}, container.VolumeMounts)
+
+	require.Len(t, spec.InitContainers, 1)
+	require.Equal(t, "client-init", spec.InitContainers[0].Name)
+
+	var projected *corev1.ProjectedVolumeSource
+	for _, v := range spec.Volumes {
+		if v.Projected != nil {
+			projected = v.Projected
+		}
+	}
+	require.NotNil(t, projected)
+	require.Len(t, projected.Sources, 2)
+	require.Equal(t, "crdb-node", projected.Sources[0].Secret.Name)
+	require.Equal(t, []corev1.KeyToPath{{Key: "ca.crt", Path: "ca.crt", Mode: projected.Sources[0].Secret.Items[0].Mode}},
+		projected.Sources[0].Secret.Items)
+	require.Equal(t, "crdb-root", projected.Sources[1].Secret.Name)
+}
+
+func TestInsecureClientDeployment(t *testing.T) {
+	cr := testutil.NewBuilder("crdb").Namespaced("default").WithPVDataStore("1Gi", "standard").Cr()
+	cr.Spec.ClientPod = &api.ClientPod{Enabled: true}
+	cluster := resource.NewCluster(cr)
+
+	deploy := &appsv1.Deployment{}
+	require.NoError(t, resource.ClientDeploymentBuilder{Cluster: &cluster}.Build(deploy))
+
+	spec := deploy.Spec.Template.Spec
+	require.Empty(t, spec.InitContainers)
+	require.Empty(t, spec.Volumes)
+	require.Contains(t, spec.Containers[0].Env, corev1.EnvVar{Name: "COCKROACH_INSECURE", Value: "true"})
+}
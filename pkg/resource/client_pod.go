@@ -0,0 +1,145 @@
+/*
+Copyright 2021 The Cockroach Authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    https://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package resource
+
+import (
+	"fmt"
+
+	"github.com/cockroachdb/cockroach-operator/pkg/ptr"
+	corev1 "k8s.io/api/core/v1"
+)
+
+// clientPodSpec returns the spec of a pod where the container runs cockroach
+// commands against the cluster. The host of the cluster and, with TLS, the
+// root client certificate are given by the environment, so the commands need
+// no connection flags. The pod gets the CA and the root client certificate,
+// not the certificate of the nodes.
+func clientPodSpec(cluster *Cluster, container corev1.Container) (corev1.PodSpec, error) {
+	if container.Image == "" {
+		container.Image = cluster.GetCockroachDBImageName()
+	}
+	container.ImagePullPolicy = *cluster.Spec().Image.PullPolicyName
+	container.Env = append(clientEnvVars(cluster), container.Env...)
+
+	spec := corev1.PodSpec{
+		SecurityContext: &corev1.PodSecurityContext{
+			RunAsUser: ptr.Int64(1000581000),
+			FSGroup:   ptr.Int64(1000581000),
+		},
+		Containers:                   []corev1.Container{container},
+		AutomountServiceAccountToken: ptr.Bool(false),
+		ServiceAccountName:           "cockroach-database-sa",
+	}
+
+	cluster.applyDNS(&spec)
+
+	if secret := cluster.Spec().Image.PullSecret; secret != nil {
+		spec.ImagePullSecrets = []corev1.LocalObjectReference{{Name: *secret}}
+	}
+
+	if !cluster.Spec().TLSEnabled {
+		return spec, nil
+	}
+
+	spec.InitContainers = []corev1.Container{
+		{
+			Name:            fmt.Sprintf("%s-init", container.Name),
+			Image:           cluster.GetCockroachDBImageName(),
+			Command:         []string{"/bin/sh", "-c", certCpCmd},
+			ImagePullPolicy: *cluster.Spec().Image.PullPolicyName,
+			SecurityContext: &corev1.SecurityContext{
+				RunAsUser:                ptr.Int64(0),
+				AllowPrivilegeEscalation: ptr.Bool(false),
+			},
+		},
+	}
+	if err := addCertsVolumeMountOnInitContiners(container.Name, &spec); err != nil {
+		return spec, err
+	}
+	if err := addCertsVolumeMount(container.Name, &spec); err != nil {
+		return spec, err
+	}
+
+	certs := StatefulSetBuilder{Cluster: cluster}
+	spec.Volumes = append(spec.Volumes,
+		corev1.Volume{
+			Name: emptyDirName,
+			VolumeSource: corev1.VolumeSource{
+				EmptyDir: &corev1.EmptyDirVolumeSource{},
+			},
+		},
+		corev1.Volume{
+			Name: certsDirName,
+			VolumeSource: corev1.VolumeSource{
+				Projected: &corev1.ProjectedVolumeSource{
+					DefaultMode: ptr.Int32(400),
+					Sources: []corev1.VolumeProjection{
+						{
+							Secret: &corev1.SecretProjection{
+								LocalObjectReference: corev1.LocalObjectReference{
+									Name: certs.nodeTLSSecretName(),
+								},
+								Items: []corev1.KeyToPath{
+									{
+										Key:  "ca.crt",
+										Path: "ca.crt",
+										Mode: ptr.Int32(504),
+									},
+								},
+							},
+						},
+						{
+							Secret: &corev1.SecretProjection{
+								LocalObjectReference: corev1.LocalObjectReference{
+									Name: certs.clientTLSSecretName(),
+								},
+								Items: []corev1.KeyToPath{
+									{
+										Key:  corev1.TLSCertKey,
+										Path: "client.root.crt",
+										Mode: ptr.Int32(504),
+									},
+									{
+										Key:  corev1.TLSPrivateKeyKey,
+										Path: "client.root.key",
+										Mode: ptr.Int32(400),
+									},
+								},
+							},
+						},
+					},
+				},
+			},
+		})
+
+	return spec, nil
+}
+
+func clientEnvVars(cluster *Cluster) []corev1.EnvVar {
+	env := []corev1.EnvVar{
+		{
+			Name:  "COCKROACH_HOST",
+			Value: fmt.Sprintf("%s:%d", cluster.ServiceHost(cluster.PublicServiceName()), *cluster.Spec().SQLPort),
+		},
+	}
+
+	if cluster.Spec().TLSEnabled {
+		return append(env, corev1.EnvVar{Name: "COCKROACH_CERTS_DIR", Value: "/cockroach/cockroach-certs/"})
+	}
+
+	return append(env, corev1.EnvVar{Name: "COCKROACH_INSECURE", Value: "true"})
+}
@@ -25,9 +25,15 @@ import (
 	api "github.com/cockroachdb/cockroach-operator/apis/v1alpha1"
 	"github.com/cockroachdb/cockroach-operator/pkg/clusterstatus"
 	"github.com/cockroachdb/cockroach-operator/pkg/condition"
+	"github.com/cockroachdb/cockroach-operator/pkg/features"
+	"github.com/cockroachdb/cockroach-operator/pkg/labels"
+	"github.com/cockroachdb/cockroach-operator/pkg/utilfeature"
 	"github.com/cockroachdb/errors"
 	"github.com/gosimple/slug"
+	corev1 "k8s.io/api/core/v1"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	k8slabels "k8s.io/apimachinery/pkg/labels"
+	"k8s.io/apimachinery/pkg/selection"
 	"k8s.io/apimachinery/pkg/types"
 )
 
@@ -40,6 +46,24 @@ const (
 	CrdbRestartAnnotation        = "crdb.io/restart"
 	CrdbCertExpirationAnnotation = "crdb.io/certexpiration"
 	CrdbRestartTypeAnnotation    = "crdb.io/restarttype"
+	// CrdbScheduledScalingAnnotation records the time of the last scheduled
+	// change of the number of nodes that was applied
+	CrdbScheduledScalingAnnotation = "crdb.io/scheduledscaling"
+	// CrdbScheduledRestartAnnotation records the time of the last scheduled
+	// restart that was started
+	CrdbScheduledRestartAnnotation = "crdb.io/scheduledrestart"
+	// CrdbRestartAtAnnotation records the restartAt of the spec whose restart
+	// was started
+	CrdbRestartAtAnnotation = "crdb.io/restartat"
+	// CrdbCertReloadAnnotation records the SHA-256 fingerprint of the renewed
+	// node certificate while the running pods are signaled to reload it
+	CrdbCertReloadAnnotation = "crdb.io/certreload"
+	// CrdbCertFingerprintAnnotation records the SHA-256 fingerprint of the
+	// node certificate the nodes loaded
+	CrdbCertFingerprintAnnotation = "crdb.io/certfingerprint"
+	// CrdbConfirmPromotionAnnotation confirms the promotion of a standby
+	// cluster to primary, set to the name of the cluster
+	CrdbConfirmPromotionAnnotation = "crdb.io/confirm-promotion"
 
 	VersionCheckJobName = "vcheck"
 )
@@ -80,6 +104,17 @@ func (cluster Cluster) SetTrue(ctype api.ClusterConditionType) {
 	condition.SetTrue(ctype, &cluster.cr.Status, cluster.InitTime())
 }
 
+// SetCondition sets the status of the condition with the reason and the
+// message explaining it
+func (cluster Cluster) SetCondition(ctype api.ClusterConditionType, status metav1.ConditionStatus, reason, message string) {
+	condition.Set(ctype, status, reason, message, &cluster.cr.Status, cluster.InitTime())
+}
+
+// RemoveCondition deletes the condition from the status
+func (cluster Cluster) RemoveCondition(ctype api.ClusterConditionType) {
+	condition.Remove(ctype, &cluster.cr.Status)
+}
+
 // True checks if the api.ClusterConditionType is true
 func (cluster Cluster) True(ctype api.ClusterConditionType) bool {
 	return condition.True(ctype, cluster.cr.Status.Conditions)
@@ -90,7 +125,220 @@ func (cluster Cluster) SetClusterStatusOnFirstReconcile() {
 }
 func (cluster Cluster) SetClusterStatus() {
 	clusterstatus.SetClusterStatus(&cluster.cr.Status)
+	cluster.cr.Status.ObservedGeneration = cluster.cr.Generation
+}
+
+// ClearStaleFailures removes the failed actions when the spec changed since
+// they failed, so that every action runs again for the new spec. It returns
+// whether any failure was removed.
+func (cluster Cluster) ClearStaleFailures() bool {
+	if cluster.cr.Generation <= cluster.cr.Status.ObservedGeneration {
+		return false
+	}
+
+	return clusterstatus.ClearFailures(&cluster.cr.Status)
+}
+
+// SetScaleStatus records the number of pods of the StatefulSet and the label
+// selector of the pods, which are read through the scale subresource. The pods
+// of the node pools are left out of both.
+func (cluster Cluster) SetScaleStatus(nodes int32) {
+	selector := labels.Common(cluster.cr).Selector(cluster.cr.Spec.AdditionalLabels)
+	noPool, _ := k8slabels.NewRequirement(NodePoolLabel, selection.DoesNotExist, nil)
+
+	cluster.cr.Status.Nodes = nodes
+	cluster.cr.Status.Selector = k8slabels.SelectorFromSet(selector).Add(*noPool).String()
+}
+
+// SetUpgradeStatus records the progress of a version upgrade. The start time
+// is kept while the same upgrade goes on, a pending upgrade starting when it
+// leaves the Pending state, and the transition time only changes with the
+// state or the partition.
+func (cluster Cluster) SetUpgradeStatus(upgrade api.UpgradeStatus, now metav1.Time) {
+	upgrade.StartedAt = now
+	upgrade.LastTransitionTime = now
+
+	previous := cluster.cr.Status.Upgrade
+	if previous != nil && previous.FromVersion == upgrade.FromVersion && previous.ToVersion == upgrade.ToVersion {
+		if previous.State != api.UpgradePending || upgrade.State == api.UpgradePending {
+			upgrade.StartedAt = previous.StartedAt
+		}
+		if previous.State == upgrade.State && equalPartitions(previous.Partition, upgrade.Partition) {
+			upgrade.LastTransitionTime = previous.LastTransitionTime
+		}
+	}
+
+	cluster.cr.Status.Upgrade = &upgrade
+}
+
+// ClearUpgradeStatus removes the progress of the last upgrade, e.g. of an
+// upgrade canceled before it started.
+func (cluster Cluster) ClearUpgradeStatus() {
+	cluster.cr.Status.Upgrade = nil
+}
+
+func equalPartitions(a, b *int32) bool {
+	if a == nil || b == nil {
+		return a == b
+	}
+	return *a == *b
+}
+
+// UpgradeRolledBack returns whether the upgrade to the wanted version was
+// rolled back since the spec last changed. The StatefulSet keeps the previous
+// version until the spec changes again.
+func (cluster Cluster) UpgradeRolledBack() bool {
+	if !utilfeature.DefaultMutableFeatureGate.Enabled(features.UpgradeRollback) {
+		return false
+	}
+	return cluster.Status().Upgrade.RolledBackAt(cluster.GetVersionAnnotation(), cluster.cr.Generation)
+}
+
+// UpgradeHalted returns whether the upgrade to the wanted version halted
+// after its canaries degraded, since the spec last changed.
+func (cluster Cluster) UpgradeHalted() bool {
+	if !utilfeature.DefaultMutableFeatureGate.Enabled(features.CanaryUpgrade) {
+		return false
+	}
+	return cluster.Status().Upgrade.HaltedAt(cluster.GetVersionAnnotation(), cluster.cr.Generation)
+}
+
+// BakingCanaries returns the canaries of the upgrade to the wanted version
+// while they bake or once they passed, nil otherwise.
+func (cluster Cluster) BakingCanaries() *api.CanaryStatus {
+	if !utilfeature.DefaultMutableFeatureGate.Enabled(features.CanaryUpgrade) {
+		return nil
+	}
+	return cluster.Status().Upgrade.BakingCanaries(cluster.GetVersionAnnotation())
+}
+
+// UpgradeSteppingToVersion returns whether the cluster is upgraded to the
+// wanted version through intermediate versions, and does not run it yet.
+func (cluster Cluster) UpgradeSteppingToVersion() bool {
+	if !utilfeature.DefaultMutableFeatureGate.Enabled(features.MultiStepUpgrade) {
+		return false
+	}
+	return cluster.Status().Upgrade.SteppingTo(cluster.GetVersionAnnotation())
+}
+
+// UpgradeHeld returns whether the StatefulSet is held at the partition of
+// the canaries of the upgrade, while they bake or once they degraded, or at
+// an intermediate version of the upgrade.
+func (cluster Cluster) UpgradeHeld() bool {
+	if cluster.UpgradeHalted() || cluster.UpgradeSteppingToVersion() {
+		return true
+	}
+	canary := cluster.BakingCanaries()
+	return canary != nil && canary.State == api.CanaryBaking
+}
+
+// SetCloneStatus records the progress of the clone of another cluster. The
+// transition time only changes with the state.
+func (cluster Cluster) SetCloneStatus(clone api.CloneStatus, now metav1.Time) {
+	clone.LastTransitionTime = now
+	if previous := cluster.cr.Status.Clone; previous != nil && previous.State == clone.State {
+		clone.LastTransitionTime = previous.LastTransitionTime
+	}
+
+	cluster.cr.Status.Clone = &clone
+}
+
+// SetReplicationStatus records the progress of the replication stream of a
+// standby cluster
+func (cluster Cluster) SetReplicationStatus(status *api.ReplicationStatus) {
+	cluster.cr.Status.Replication = status
+}
+
+// SetAutoscalingStatus records the load of the nodes the autoscaler last
+// measured
+func (cluster Cluster) SetAutoscalingStatus(status *api.AutoscalingStatus) {
+	cluster.cr.Status.Autoscaling = status
+}
+
+// SetResourceAutoscalingStatus records the usage of the pods the resource
+// autoscaler last measured
+func (cluster Cluster) SetResourceAutoscalingStatus(status *api.ResourceAutoscalingStatus) {
+	cluster.cr.Status.ResourceAutoscaling = status
+}
+
+// SetCertificates records the validity of the certificates of the cluster
+func (cluster Cluster) SetCertificates(certs []api.CertificateStatus) {
+	cluster.cr.Status.Certificates = certs
+}
+
+// RecordStatement keeps a SQL statement the operator ran in the audit history
+// of the status, which holds the number of statements set in the spec.
+func (cluster Cluster) RecordStatement(statement api.SQLStatement) {
+	limit := int(cluster.Spec().SQLAuditHistory)
+	if limit <= 0 {
+		return
+	}
+
+	history := append(cluster.cr.Status.SQLAudit, statement)
+	if len(history) > limit {
+		history = history[len(history)-limit:]
+	}
+	cluster.cr.Status.SQLAudit = history
+}
+
+// RecordDisruptiveOperation records a disruptive operation the action started,
+// and forgets the operations older than the longest period of a budget. The
+// action no longer waits for the budget.
+func (cluster Cluster) RecordDisruptiveOperation(atype api.ActionType, now metav1.Time) {
+	var operations []api.DisruptiveOperation
+	for _, op := range cluster.cr.Status.DisruptiveOperations {
+		if now.Sub(op.StartTime.Time) < api.OperationsHistory {
+			operations = append(operations, op)
+		}
+	}
+	cluster.cr.Status.DisruptiveOperations = append(operations, api.DisruptiveOperation{Action: atype, StartTime: now})
+	cluster.ClearPendingOperation(atype)
+}
+
+// ForgetDisruptiveOperation forgets the disruptive operation the action
+// started at start, which failed before it disrupted the cluster for good.
+func (cluster Cluster) ForgetDisruptiveOperation(atype api.ActionType, start metav1.Time) {
+	var operations []api.DisruptiveOperation
+	for _, op := range cluster.cr.Status.DisruptiveOperations {
+		if op.Action != atype || !op.StartTime.Equal(&start) {
+			operations = append(operations, op)
+		}
+	}
+	cluster.cr.Status.DisruptiveOperations = operations
+}
+
+// SetPendingOperation records that a disruptive operation of the action waits
+// for the operations budget until notBefore.
+func (cluster Cluster) SetPendingOperation(atype api.ActionType, now, notBefore metav1.Time) {
+	for i, op := range cluster.cr.Status.PendingOperations {
+		if op.Action == atype {
+			cluster.cr.Status.PendingOperations[i].NotBefore = notBefore
+			return
+		}
+	}
+	cluster.cr.Status.PendingOperations = append(cluster.cr.Status.PendingOperations,
+		api.PendingOperation{Action: atype, Since: now, NotBefore: notBefore})
 }
+
+// ClearPendingOperation records that the action no longer waits for the
+// operations budget.
+func (cluster Cluster) ClearPendingOperation(atype api.ActionType) {
+	var pending []api.PendingOperation
+	for _, op := range cluster.cr.Status.PendingOperations {
+		if op.Action != atype {
+			pending = append(pending, op)
+		}
+	}
+	cluster.cr.Status.PendingOperations = pending
+}
+
+// SetResourceVersion records the version of the resource saved by an actor
+// in the middle of the reconciliation, so that the status can still be saved
+// at the end of it.
+func (cluster Cluster) SetResourceVersion(version string) {
+	cluster.cr.ResourceVersion = version
+}
+
 func (cluster Cluster) SetClusterVersion(version string) {
 	cluster.cr.Status.Version = version
 }
@@ -99,10 +347,19 @@ func (cluster Cluster) SetCrdbContainerImage(containerimage string) {
 }
 func (cluster Cluster) SetActionFailed(atype api.ActionType, errMsg string) {
 	clusterstatus.SetActionFailed(atype, errMsg, &cluster.cr.Status)
+	cluster.cr.Status.ObservedGeneration = cluster.cr.Generation
 }
 func (cluster Cluster) ResetActionType(atype api.ActionType) {
 	clusterstatus.ResetActionType(atype, &cluster.cr.Status)
 }
+func (cluster Cluster) SetActionFailedWithReason(atype api.ActionType, reason api.FailureReason, errMsg string) {
+	clusterstatus.SetActionFailedWithReason(atype, reason, errMsg, &cluster.cr.Status)
+	cluster.cr.Status.ObservedGeneration = cluster.cr.Generation
+}
+func (cluster Cluster) SetActionRetrying(atype api.ActionType, reason api.FailureReason, errMsg string) {
+	clusterstatus.SetActionRetrying(atype, reason, errMsg, &cluster.cr.Status)
+	cluster.cr.Status.ObservedGeneration = cluster.cr.Generation
+}
 func (cluster Cluster) SetActionFinished(atype api.ActionType) {
 	clusterstatus.SetActionFinished(atype, &cluster.cr.Status)
 }
@@ -113,6 +370,12 @@ func (cluster Cluster) SetActionUnknown(atype api.ActionType) {
 func (cluster Cluster) Failed(atype api.ActionType) bool {
 	return clusterstatus.Failed(atype, cluster.Status().OperatorActions)
 }
+func (cluster Cluster) Retrying(atype api.ActionType) bool {
+	return clusterstatus.Retrying(atype, cluster.Status().OperatorActions)
+}
+func (cluster Cluster) Retries(atype api.ActionType, reason api.FailureReason) int32 {
+	return clusterstatus.Retries(atype, reason, cluster.Status().OperatorActions)
+}
 func (cluster Cluster) SetFalse(ctype api.ClusterConditionType) {
 	condition.SetFalse(ctype, &cluster.cr.Status, cluster.InitTime())
 }
@@ -149,10 +412,43 @@ func (cluster Cluster) PublicServiceName() string {
 	return fmt.Sprintf("%s-public", cluster.Name())
 }
 
+// RegionPublicServiceName returns the name of the public service of the
+// nodes of the region.
+func (cluster Cluster) RegionPublicServiceName(region string) string {
+	return fmt.Sprintf("%s-public-%s", cluster.Name(), region)
+}
+
+// UIIngressName returns the name of the Ingress, or of the HTTPRoute, of the
+// DB Console.
+func (cluster Cluster) UIIngressName() string {
+	return fmt.Sprintf("%s-ui", cluster.Name())
+}
+
+// SQLIngressName returns the name of the Ingress, or of the TLSRoute, of the
+// SQL endpoint.
+func (cluster Cluster) SQLIngressName() string {
+	return fmt.Sprintf("%s-sql", cluster.Name())
+}
+
+// NetworkPolicyName returns the name of the NetworkPolicy of the nodes.
+func (cluster Cluster) NetworkPolicyName() string {
+	return cluster.Name()
+}
+
 func (cluster Cluster) StatefulSetName() string {
 	return cluster.Name()
 }
 
+// ClientDeploymentName returns the name of the Deployment of the client pod.
+func (cluster Cluster) ClientDeploymentName() string {
+	return fmt.Sprintf("%s-client", cluster.Name())
+}
+
+// DemoWorkloadJobName returns the name of the Job loading the demo workload.
+func (cluster Cluster) DemoWorkloadJobName() string {
+	return fmt.Sprintf("%s-demo-workload", cluster.Name())
+}
+
 func (cluster Cluster) JobName() string {
 	slug.MaxLength = 63
 	return slug.Make(fmt.Sprintf("%s-%s-%d", cluster.Name(), VersionCheckJobName, getTimeHashInMinutes(time.Now())))
@@ -164,6 +460,19 @@ func (cluster Cluster) IsSupportedImage() bool {
 	image := cluster.GetCockroachDBImageName()
 	return !strings.EqualFold(image, NotSupportedVersion)
 }
+
+// SupportedVersions returns the CockroachDB versions the operator has an image
+// of.
+func (cluster Cluster) SupportedVersions() []string {
+	return getSupportedCrdbVersions()
+}
+
+// SupportedImage returns the image of the supported version, empty if the
+// version is not supported.
+func (cluster Cluster) SupportedImage(version string) string {
+	return getSupportedCrdbImages()[version]
+}
+
 func (cluster Cluster) LookupSupportedVersion(version string) (string, bool) {
 	if version == "" {
 		return "", false
@@ -190,6 +499,26 @@ func (cluster Cluster) GetAnnotationRestartType() string {
 	return cluster.getAnnotation(CrdbRestartTypeAnnotation)
 }
 
+func (cluster Cluster) GetAnnotationScheduledScaling() string {
+	return cluster.getAnnotation(CrdbScheduledScalingAnnotation)
+}
+
+func (cluster Cluster) GetAnnotationScheduledRestart() string {
+	return cluster.getAnnotation(CrdbScheduledRestartAnnotation)
+}
+
+func (cluster Cluster) GetAnnotationRestartAt() string {
+	return cluster.getAnnotation(CrdbRestartAtAnnotation)
+}
+
+func (cluster Cluster) GetAnnotationCertReload() string {
+	return cluster.getAnnotation(CrdbCertReloadAnnotation)
+}
+
+func (cluster Cluster) GetAnnotationCertFingerprint() string {
+	return cluster.getAnnotation(CrdbCertFingerprintAnnotation)
+}
+
 func (cluster Cluster) GetAnnotationHistory() string {
 	return cluster.getAnnotation(CrdbHistoryAnnotation)
 }
@@ -253,14 +582,95 @@ func (cluster Cluster) NodeTLSSecretName() string {
 func (cluster Cluster) ClientTLSSecretName() string {
 	return fmt.Sprintf("%s-root", cluster.Name())
 }
+
+// BackupVolumeClaimName returns the name of the claim of the backup volume,
+// provisioned by the operator unless the spec names an existing one.
+func (cluster Cluster) BackupVolumeClaimName() string {
+	if v := cluster.Spec().BackupVolume; v != nil && v.ClaimName != "" {
+		return v.ClaimName
+	}
+	return fmt.Sprintf("%s-backups", cluster.Name())
+}
+
+// ServiceAccountName returns the name of the service account of the pods: a
+// service account of the cluster when the spec annotates it with a cloud
+// identity, the shared cockroach-database-sa otherwise.
+func (cluster Cluster) ServiceAccountName() string {
+	if !cluster.HasCloudIdentity() {
+		return DefaultServiceAccountName
+	}
+	return fmt.Sprintf("%s-sa", cluster.Name())
+}
+
+// HasCloudIdentity returns whether the pods of the cluster run with a service
+// account annotated with a cloud identity, which authenticates the backups.
+func (cluster Cluster) HasCloudIdentity() bool {
+	return len(cluster.Spec().ServiceAccountAnnotations) > 0
+}
+
 func (cluster Cluster) CASecretName() string {
 	return fmt.Sprintf("%s-ca", cluster.Name())
 }
 
+// CANextSecretName returns the name of the secret that holds the key and the
+// certificate of the new CA while the CA of the cluster is rotated.
+func (cluster Cluster) CANextSecretName() string {
+	return fmt.Sprintf("%s-ca-next", cluster.Name())
+}
+
+// ClientCASecretName returns the name of the secret that holds the key and the
+// certificate of the client CA of a split-CA cluster, unless the spec names one.
+func (cluster Cluster) ClientCASecretName() string {
+	if split := cluster.Spec().SplitCA; split != nil && split.ClientCASecret != "" {
+		return split.ClientCASecret
+	}
+	return fmt.Sprintf("%s-client-ca", cluster.Name())
+}
+
+// NodeClientTLSSecretName returns the name of the secret that holds the client
+// certificate of user node and the client CA certificate of a split-CA
+// cluster.
+func (cluster Cluster) NodeClientTLSSecretName() string {
+	return fmt.Sprintf("%s-node-client", cluster.Name())
+}
+
+// CSRSecretName returns the name of the secret that holds the keys and the
+// signing requests of the certificates signed by an external CA.
+func (cluster Cluster) CSRSecretName() string {
+	return fmt.Sprintf("%s-csr", cluster.Name())
+}
+
 func (cluster Cluster) Domain() string {
+	if dns := cluster.Spec().DNS; dns != nil && dns.ClusterDomain != "" {
+		return "svc." + dns.ClusterDomain
+	}
+
 	return "svc.cluster.local"
 }
 
+// ServiceHost returns the address of the service in the namespace of the
+// cluster. It is fully qualified when the spec sets the domain of the
+// Kubernetes cluster, and relative to the search domains of the pods otherwise.
+func (cluster Cluster) ServiceHost(service string) string {
+	if dns := cluster.Spec().DNS; dns != nil && dns.ClusterDomain != "" {
+		return fmt.Sprintf("%s.%s.%s", service, cluster.Namespace(), cluster.Domain())
+	}
+
+	return fmt.Sprintf("%s.%s", service, cluster.Namespace())
+}
+
+// applyDNS sets the DNS policy and configuration of the spec to the ones of
+// the cluster.
+func (cluster Cluster) applyDNS(spec *corev1.PodSpec) {
+	dns := cluster.Spec().DNS
+	if dns == nil {
+		return
+	}
+
+	spec.DNSPolicy = dns.Policy
+	spec.DNSConfig = dns.Config
+}
+
 func (cluster Cluster) SecureMode() string {
 	if cluster.Spec().TLSEnabled {
 		return "--certs-dir=/cockroach/cockroach-certs/"
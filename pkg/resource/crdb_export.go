@@ -0,0 +1,174 @@
+/*
+Copyright 2021 The Cockroach Authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    https://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package resource
+
+import (
+	"errors"
+	"fmt"
+	"time"
+
+	api "github.com/cockroachdb/cockroach-operator/apis/v1alpha1"
+	"github.com/cockroachdb/cockroach-operator/pkg/labels"
+	"github.com/cockroachdb/cockroach-operator/pkg/ptr"
+	kbatch "k8s.io/api/batch/v1"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+const (
+	// ExportContainerName is the name of the container running the EXPORT
+	// statement of a CrdbExport
+	ExportContainerName = "cockroach"
+
+	// CrdbExportLabel labels the Jobs of a CrdbExport with its name
+	CrdbExportLabel = "crdb.cockroachlabs.com/export"
+
+	// ExportPathFormat formats the scheduled time of an export into the name of
+	// the subdirectory it writes its files in
+	ExportPathFormat = "2006/01/02-150405"
+
+	// exportStatementEnv is the environment variable, and the key of the
+	// secret, holding the EXPORT statement
+	exportStatementEnv = "EXPORT_STATEMENT"
+
+	exportComponent = "export"
+)
+
+// ExportSecretName returns the name of the secret holding the statement of the
+// exports of a CrdbExport, whose URI can include credentials.
+func ExportSecretName(export *api.CrdbExport) string {
+	return export.Name + "-export"
+}
+
+// ExportJobName returns the name of the Job of the export scheduled at t. Like
+// the Jobs of a CronJob, it is unique for each scheduled minute.
+func ExportJobName(export *api.CrdbExport, t time.Time) string {
+	return fmt.Sprintf("%s-%d", export.Name, t.Unix()/60)
+}
+
+// ExportSecretBuilder models the secret holding the EXPORT statement of the
+// next export of a CrdbExport.
+type ExportSecretBuilder struct {
+	*Cluster
+
+	Export    *api.CrdbExport
+	Statement string
+}
+
+func (b ExportSecretBuilder) ResourceName() string {
+	return ExportSecretName(b.Export)
+}
+
+func (b ExportSecretBuilder) Build(obj client.Object) error {
+	secret, ok := obj.(*corev1.Secret)
+	if !ok {
+		return errors.New("failed to cast to Secret object")
+	}
+
+	if secret.ObjectMeta.Name == "" {
+		secret.ObjectMeta.Name = b.ResourceName()
+	}
+
+	secret.Annotations = b.Spec().PropagatedAnnotations(api.PropagateSecret)
+	secret.Data = map[string][]byte{exportStatementEnv: []byte(b.Statement)}
+	return nil
+}
+
+func (b ExportSecretBuilder) Placeholder() client.Object {
+	return &corev1.Secret{
+		ObjectMeta: metav1.ObjectMeta{
+			Name: b.ResourceName(),
+		},
+	}
+}
+
+// ExportJobBuilder models the Job running the export of a CrdbExport scheduled
+// at a time, with the cockroach sql client.
+type ExportJobBuilder struct {
+	*Cluster
+
+	Export      *api.CrdbExport
+	ScheduledAt time.Time
+	Selector    labels.Labels
+}
+
+func (b ExportJobBuilder) ResourceName() string {
+	return ExportJobName(b.Export, b.ScheduledAt)
+}
+
+// Build creates a kbatch.Job running the statement of the secret once. The pod
+// template of a Job is immutable, an existing Job is left as is.
+func (b ExportJobBuilder) Build(obj client.Object) error {
+	job, ok := obj.(*kbatch.Job)
+	if !ok {
+		return errors.New("failed to cast to Job object")
+	}
+
+	if job.ObjectMeta.Name == "" {
+		job.ObjectMeta.Name = b.ResourceName()
+	}
+
+	job.Annotations = b.Spec().AdditionalAnnotations
+
+	if job.ResourceVersion != "" {
+		return nil
+	}
+
+	podLabels := labels.Labels{}
+	podLabels.Merge(b.Selector)
+	podLabels[labels.ComponentKey] = exportComponent
+	podLabels[CrdbExportLabel] = b.Export.Name
+
+	// the statement is expanded by the shell as a single argument, its quotes
+	// and dollar signs are passed as is
+	spec, err := clientPodSpec(b.Cluster, corev1.Container{
+		Name:    ExportContainerName,
+		Command: []string{"/bin/sh", "-c", `exec /cockroach/cockroach sql -e "$` + exportStatementEnv + `"`},
+		EnvFrom: []corev1.EnvFromSource{{
+			SecretRef: &corev1.SecretEnvSource{
+				LocalObjectReference: corev1.LocalObjectReference{Name: ExportSecretName(b.Export)},
+			},
+		}},
+	})
+	if err != nil {
+		return err
+	}
+	spec.RestartPolicy = corev1.RestartPolicyNever
+
+	// a failed export is retried by the next one
+	job.Spec = kbatch.JobSpec{
+		BackoffLimit: ptr.Int32(0),
+		Template: corev1.PodTemplateSpec{
+			ObjectMeta: metav1.ObjectMeta{
+				Labels:      podLabels,
+				Annotations: b.JobPodAnnotations(),
+			},
+			Spec: spec,
+		},
+	}
+
+	return nil
+}
+
+func (b ExportJobBuilder) Placeholder() client.Object {
+	return &kbatch.Job{
+		ObjectMeta: metav1.ObjectMeta{
+			Name: b.ResourceName(),
+		},
+	}
+}
@@ -0,0 +1,76 @@
+/*
+Copyright 2021 The Cockroach Authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    https://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package resource_test
+
+import (
+	"testing"
+	"time"
+
+	api "github.com/cockroachdb/cockroach-operator/apis/v1alpha1"
+	"github.com/cockroachdb/cockroach-operator/pkg/labels"
+	"github.com/cockroachdb/cockroach-operator/pkg/resource"
+	"github.com/cockroachdb/cockroach-operator/pkg/testutil"
+	"github.com/stretchr/testify/require"
+	kbatch "k8s.io/api/batch/v1"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+func TestExportBuilders(t *testing.T) {
+	cluster := testutil.NewBuilder("crdb").Namespaced("default").WithPVDataStore("1Gi", "standard").WithTLS().Cluster()
+	export := &api.CrdbExport{
+		ObjectMeta: metav1.ObjectMeta{Namespace: "default", Name: "rides"},
+		Spec: api.CrdbExportSpec{
+			ClusterName: "crdb",
+			Schedule:    "@daily",
+			Table:       "movr.public.rides",
+			URI:         "s3://exports/rides",
+		},
+	}
+	statement := `EXPORT INTO CSV 's3://exports/rides/2021/06/01-000000' FROM TABLE "movr"."public"."rides"`
+
+	sb := resource.ExportSecretBuilder{Cluster: cluster, Export: export, Statement: statement}
+	secret := sb.Placeholder().(*corev1.Secret)
+	require.NoError(t, sb.Build(secret))
+	require.Equal(t, "rides-export", secret.Name)
+	require.Equal(t, statement, string(secret.Data["EXPORT_STATEMENT"]))
+
+	scheduledAt := time.Date(2021, 6, 1, 0, 0, 0, 0, time.UTC)
+	jb := resource.ExportJobBuilder{
+		Cluster:     cluster,
+		Export:      export,
+		ScheduledAt: scheduledAt,
+		Selector:    labels.Common(cluster.Unwrap()).Selector(nil),
+	}
+	job := jb.Placeholder().(*kbatch.Job)
+	require.NoError(t, jb.Build(job))
+	require.Equal(t, "rides-27041760", job.Name)
+	require.Equal(t, int32(0), *job.Spec.BackoffLimit)
+	require.Equal(t, "export", job.Spec.Template.Labels[labels.ComponentKey])
+	require.Equal(t, "rides", job.Spec.Template.Labels[resource.CrdbExportLabel])
+
+	spec := job.Spec.Template.Spec
+	require.Equal(t, corev1.RestartPolicyNever, spec.RestartPolicy)
+	require.Len(t, spec.Containers, 1)
+	container := spec.Containers[0]
+	require.Equal(t, resource.ExportContainerName, container.Name)
+	require.Equal(t, cluster.GetCockroachDBImageName(), container.Image)
+	require.Equal(t, []string{"/bin/sh", "-c", `exec /cockroach/cockroach sql -e "$EXPORT_STATEMENT"`}, container.Command)
+	require.Equal(t, "rides-export", container.EnvFrom[0].SecretRef.Name)
+	require.Contains(t, container.Env, corev1.EnvVar{Name: "COCKROACH_CERTS_DIR", Value: "/cockroach/cockroach-certs/"})
+	require.NotContains(t, container.Command[2], "s3://")
+}
@@ -0,0 +1,106 @@
+/*
+Copyright 2021 The Cockroach Authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    https://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package resource
+
+import (
+	"errors"
+
+	api "github.com/cockroachdb/cockroach-operator/apis/v1alpha1"
+	"github.com/cockroachdb/cockroach-operator/pkg/labels"
+	"github.com/cockroachdb/cockroach-operator/pkg/ptr"
+	kbatch "k8s.io/api/batch/v1"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+const (
+	// CrdbJobContainerName is the name of the container running the command
+	// of a CrdbJob
+	CrdbJobContainerName = "cockroach"
+
+	crdbJobComponent = "job"
+)
+
+// CrdbJobBuilder models the Job that runs the cockroach command of a CrdbJob
+// against the cluster.
+type CrdbJobBuilder struct {
+	*Cluster
+
+	Job      *api.CrdbJob
+	Selector labels.Labels
+}
+
+func (b CrdbJobBuilder) ResourceName() string {
+	return b.Job.Name
+}
+
+// Build creates a kbatch.Job running the command once. The pod template of a
+// Job is immutable, an existing Job is left as is.
+func (b CrdbJobBuilder) Build(obj client.Object) error {
+	job, ok := obj.(*kbatch.Job)
+	if !ok {
+		return errors.New("failed to cast to Job object")
+	}
+
+	if job.ObjectMeta.Name == "" {
+		job.ObjectMeta.Name = b.ResourceName()
+	}
+
+	job.Annotations = b.Spec().AdditionalAnnotations
+
+	if job.ResourceVersion != "" {
+		return nil
+	}
+
+	podLabels := labels.Labels{}
+	podLabels.Merge(b.Selector)
+	podLabels[labels.ComponentKey] = crdbJobComponent
+
+	spec, err := clientPodSpec(b.Cluster, corev1.Container{
+		Name:      CrdbJobContainerName,
+		Image:     b.Job.Spec.Image,
+		Command:   append([]string{"/cockroach/cockroach"}, b.Job.Spec.Args...),
+		Resources: b.Job.Spec.Resources,
+	})
+	if err != nil {
+		return err
+	}
+	spec.RestartPolicy = corev1.RestartPolicyNever
+
+	// the Job is deleted with the CrdbJob, once its TTL expired
+	job.Spec = kbatch.JobSpec{
+		BackoffLimit: ptr.Int32(b.Job.Spec.BackoffLimit),
+		Template: corev1.PodTemplateSpec{
+			ObjectMeta: metav1.ObjectMeta{
+				Labels:      podLabels,
+				Annotations: b.JobPodAnnotations(),
+			},
+			Spec: spec,
+		},
+	}
+
+	return nil
+}
+
+func (b CrdbJobBuilder) Placeholder() client.Object {
+	return &kbatch.Job{
+		ObjectMeta: metav1.ObjectMeta{
+			Name: b.ResourceName(),
+		},
+	}
+}
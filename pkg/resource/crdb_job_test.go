@@ -0,0 +1,71 @@
+/*
+Copyright 2021 The Cockroach Authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    https://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package resource_test
+
+import (
+	"testing"
+
+	api "github.com/cockroachdb/cockroach-operator/apis/v1alpha1"
+	"github.com/cockroachdb/cockroach-operator/pkg/labels"
+	"github.com/cockroachdb/cockroach-operator/pkg/resource"
+	"github.com/cockroachdb/cockroach-operator/pkg/testutil"
+	"github.com/stretchr/testify/require"
+	kbatch "k8s.io/api/batch/v1"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+func TestCrdbJobBuilder(t *testing.T) {
+	cluster := testutil.NewBuilder("crdb").Namespaced("default").WithPVDataStore("1Gi", "standard").WithTLS().Cluster()
+	crdbJob := &api.CrdbJob{
+		ObjectMeta: metav1.ObjectMeta{Namespace: "default", Name: "movr"},
+		Spec: api.CrdbJobSpec{
+			ClusterName:  "crdb",
+			Args:         []string{"workload", "init", "movr"},
+			BackoffLimit: 2,
+		},
+	}
+
+	b := resource.CrdbJobBuilder{
+		Cluster:  cluster,
+		Job:      crdbJob,
+		Selector: labels.Common(cluster.Unwrap()).Selector(nil),
+	}
+	job := b.Placeholder().(*kbatch.Job)
+	require.NoError(t, b.Build(job))
+	require.Equal(t, "movr", job.Name)
+	require.Equal(t, int32(2), *job.Spec.BackoffLimit)
+	require.Equal(t, "job", job.Spec.Template.Labels[labels.ComponentKey])
+
+	spec := job.Spec.Template.Spec
+	require.Equal(t, corev1.RestartPolicyNever, spec.RestartPolicy)
+	require.Len(t, spec.Containers, 1)
+	container := spec.Containers[0]
+	require.Equal(t, resource.CrdbJobContainerName, container.Name)
+	require.Equal(t, cluster.GetCockroachDBImageName(), container.Image)
+	require.Equal(t, []string{"/cockroach/cockroach", "workload", "init", "movr"}, container.Command)
+	require.Contains(t, container.Env, corev1.EnvVar{Name: "COCKROACH_CERTS_DIR", Value: "/cockroach/cockroach-certs/"})
+	require.Len(t, spec.InitContainers, 1)
+	require.Equal(t, "cockroach-init", spec.InitContainers[0].Name)
+
+	// the pod template of an existing Job is immutable
+	job.ResourceVersion = "1"
+	crdbJob.Spec.Args = []string{"debug", "zip", "/tmp/debug.zip"}
+	crdbJob.Spec.Image = "cockroachdb/cockroach:latest"
+	require.NoError(t, b.Build(job))
+	require.Equal(t, container, job.Spec.Template.Spec.Containers[0])
+}
@@ -0,0 +1,127 @@
+/*
+Copyright 2021 The Cockroach Authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    https://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package resource
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/cockroachdb/cockroach-operator/pkg/labels"
+	"github.com/cockroachdb/cockroach-operator/pkg/ptr"
+	kbatch "k8s.io/api/batch/v1"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+const (
+	// DemoWorkloadContainerName is the name of the container loading the demo
+	// workload
+	DemoWorkloadContainerName = "demo-workload"
+
+	demoWorkloadComponent    = "demo-workload"
+	demoWorkloadBackoffLimit = 3
+)
+
+// DemoWorkloadJobBuilder models the Job that loads the sample data of the demo
+// workload with `cockroach workload init`.
+type DemoWorkloadJobBuilder struct {
+	*Cluster
+
+	Selector labels.Labels
+}
+
+func (b DemoWorkloadJobBuilder) ResourceName() string {
+	return b.DemoWorkloadJobName()
+}
+
+// Build creates a kbatch.Job loading the data once. The pod template of a Job
+// is immutable, an existing Job is left as is.
+func (b DemoWorkloadJobBuilder) Build(obj client.Object) error {
+	job, ok := obj.(*kbatch.Job)
+	if !ok {
+		return errors.New("failed to cast to Job object")
+	}
+
+	workload := b.Spec().DemoWorkload
+	if workload == nil {
+		return errors.New("the cluster has no demo workload")
+	}
+
+	if job.ObjectMeta.Name == "" {
+		job.ObjectMeta.Name = b.ResourceName()
+	}
+
+	job.Annotations = b.Spec().AdditionalAnnotations
+
+	if job.ResourceVersion != "" {
+		return nil
+	}
+
+	podLabels := labels.Labels{}
+	podLabels.Merge(b.Selector)
+	podLabels[labels.ComponentKey] = demoWorkloadComponent
+
+	command := []string{"/cockroach/cockroach", "workload", "init", string(workload.Name)}
+	command = append(command, workload.InitFlags()...)
+	command = append(command, b.demoWorkloadURL())
+
+	spec, err := clientPodSpec(b.Cluster, corev1.Container{
+		Name:      DemoWorkloadContainerName,
+		Command:   command,
+		Resources: workload.Resources,
+	})
+	if err != nil {
+		return err
+	}
+	spec.RestartPolicy = corev1.RestartPolicyNever
+
+	job.Spec = kbatch.JobSpec{
+		BackoffLimit: ptr.Int32(demoWorkloadBackoffLimit),
+		Template: corev1.PodTemplateSpec{
+			ObjectMeta: metav1.ObjectMeta{
+				Labels:      podLabels,
+				Annotations: b.JobPodAnnotations(),
+			},
+			Spec: spec,
+		},
+	}
+
+	return nil
+}
+
+// demoWorkloadURL returns the connection URL of `cockroach workload`, which
+// does not read the connection flags from the environment. The host is
+// expanded by Kubernetes from the COCKROACH_HOST variable of the container.
+func (b DemoWorkloadJobBuilder) demoWorkloadURL() string {
+	url := "postgresql://root@$(COCKROACH_HOST)/"
+	if !b.Spec().TLSEnabled {
+		return url + "?sslmode=disable"
+	}
+
+	certs := "/cockroach/cockroach-certs"
+	return fmt.Sprintf("%s?sslmode=verify-full&sslrootcert=%s/ca.crt&sslcert=%s/client.root.crt&sslkey=%s/client.root.key",
+		url, certs, certs, certs)
+}
+
+func (b DemoWorkloadJobBuilder) Placeholder() client.Object {
+	return &kbatch.Job{
+		ObjectMeta: metav1.ObjectMeta{
+			Name: b.ResourceName(),
+		},
+	}
+}
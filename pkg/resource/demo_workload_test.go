@@ -0,0 +1,79 @@
+/*
+Copyright 2021 The Cockroach Authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    https://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package resource_test
+
+import (
+	"testing"
+
+	api "github.com/cockroachdb/cockroach-operator/apis/v1alpha1"
+	"github.com/cockroachdb/cockroach-operator/pkg/labels"
+	"github.com/cockroachdb/cockroach-operator/pkg/resource"
+	"github.com/cockroachdb/cockroach-operator/pkg/testutil"
+	"github.com/stretchr/testify/require"
+	kbatch "k8s.io/api/batch/v1"
+	corev1 "k8s.io/api/core/v1"
+)
+
+func TestDemoWorkloadJobBuilder(t *testing.T) {
+	cr := testutil.NewBuilder("crdb").Namespaced("default").WithPVDataStore("1Gi", "standard").WithTLS().Cr()
+	cr.Spec.DemoWorkload = &api.DemoWorkload{Name: api.BankWorkload, ScaleFactor: 2}
+	cluster := resource.NewCluster(cr)
+
+	b := resource.DemoWorkloadJobBuilder{
+		Cluster:  &cluster,
+		Selector: labels.Common(cluster.Unwrap()).Selector(nil),
+	}
+	job := b.Placeholder().(*kbatch.Job)
+	require.NoError(t, b.Build(job))
+	require.Equal(t, "crdb-demo-workload", job.Name)
+	require.Equal(t, "demo-workload", job.Spec.Template.Labels[labels.ComponentKey])
+
+	spec := job.Spec.Template.Spec
+	require.Equal(t, corev1.RestartPolicyNever, spec.RestartPolicy)
+	require.Len(t, spec.Containers, 1)
+	container := spec.Containers[0]
+	require.Equal(t, resource.DemoWorkloadContainerName, container.Name)
+	require.Equal(t, cluster.GetCockroachDBImageName(), container.Image)
+	require.Equal(t, []string{
+		"/cockroach/cockroach", "workload", "init", "bank", "--rows=2000",
+		"postgresql://root@$(COCKROACH_HOST)/?sslmode=verify-full&sslrootcert=/cockroach/cockroach-certs/ca.crt" +
+			"&sslcert=/cockroach/cockroach-certs/client.root.crt&sslkey=/cockroach/cockroach-certs/client.root.key",
+	}, container.Command)
+	require.Len(t, spec.InitContainers, 1)
+
+	// the pod template of an existing Job is immutable
+	job.ResourceVersion = "1"
+	cr.Spec.DemoWorkload.ScaleFactor = 5
+	changed := resource.NewCluster(cr)
+	b.Cluster = &changed
+	require.NoError(t, b.Build(job))
+	require.Equal(t, container, job.Spec.Template.Spec.Containers[0])
+}
+
+func TestDemoWorkloadJobBuilderInsecure(t *testing.T) {
+	cr := testutil.NewBuilder("crdb").Namespaced("default").WithPVDataStore("1Gi", "standard").Cr()
+	cr.Spec.DemoWorkload = &api.DemoWorkload{Name: api.MovrWorkload}
+	cluster := resource.NewCluster(cr)
+
+	b := resource.DemoWorkloadJobBuilder{Cluster: &cluster}
+	job := b.Placeholder().(*kbatch.Job)
+	require.NoError(t, b.Build(job))
+
+	command := job.Spec.Template.Spec.Containers[0].Command
+	require.Equal(t, "postgresql://root@$(COCKROACH_HOST)/?sslmode=disable", command[len(command)-1])
+	require.Empty(t, job.Spec.Template.Spec.InitContainers)
+}
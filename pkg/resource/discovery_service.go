@@ -24,6 +24,7 @@ import (
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"sigs.k8s.io/controller-runtime/pkg/client"
 
+	api "github.com/cockroachdb/cockroach-operator/apis/v1alpha1"
 	"github.com/cockroachdb/cockroach-operator/pkg/kube"
 )
 
@@ -55,7 +56,7 @@ func (b DiscoveryServiceBuilder) Build(obj client.Object) error {
 		service.ObjectMeta.Labels = map[string]string{}
 	}
 
-	service.Annotations = b.Spec().AdditionalAnnotations
+	service.Annotations = b.Spec().PropagatedAnnotations(api.PropagateService)
 
 	if service.ObjectMeta.Annotations == nil {
 		service.ObjectMeta.Annotations = map[string]string{}
@@ -67,9 +68,9 @@ func (b DiscoveryServiceBuilder) Build(obj client.Object) error {
 		ClusterIP:                "None",
 		PublishNotReadyAddresses: true,
 		Ports: []corev1.ServicePort{
-			{Name: "grpc", Port: *b.Cluster.Spec().GRPCPort},
-			{Name: "http", Port: *b.Cluster.Spec().HTTPPort},
-			{Name: "sql", Port: *b.Cluster.Spec().SQLPort},
+			{Name: b.Cluster.Spec().PortNames.GRPCOrDefault(), Port: *b.Cluster.Spec().GRPCPort},
+			{Name: b.Cluster.Spec().PortNames.HTTPOrDefault(), Port: *b.Cluster.Spec().HTTPPort},
+			{Name: b.Cluster.Spec().PortNames.SQLOrDefault(), Port: *b.Cluster.Spec().SQLPort},
 		},
 		Selector: b.Selector,
 	}
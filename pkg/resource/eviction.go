@@ -0,0 +1,46 @@
+/*
+Copyright 2021 The Cockroach Authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    https://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package resource
+
+import (
+	api "github.com/cockroachdb/cockroach-operator/apis/v1alpha1"
+	"github.com/cockroachdb/cockroach-operator/pkg/condition"
+	"github.com/cockroachdb/cockroach-operator/pkg/features"
+	"github.com/cockroachdb/cockroach-operator/pkg/utilfeature"
+)
+
+// SafeToEvictAnnotation tells the cluster autoscaler whether it can evict a pod
+// to scale down its node.
+const SafeToEvictAnnotation = "cluster-autoscaler.kubernetes.io/safe-to-evict"
+
+// EvictionPolicy returns the eviction policy of the spec, nil when there is
+// none or when the EvictionPolicy feature gate is disabled.
+func (cluster Cluster) EvictionPolicy() *api.EvictionPolicy {
+	if !utilfeature.DefaultMutableFeatureGate.Enabled(features.EvictionPolicy) {
+		return nil
+	}
+	return cluster.Spec().Eviction
+}
+
+// BlocksEvictions returns whether the PodDisruptionBudget must allow no
+// eviction: the spec asks for a health aware budget and the EvictionSafe
+// condition is false.
+func (cluster Cluster) BlocksEvictions() bool {
+	policy := cluster.EvictionPolicy()
+	return policy != nil && policy.HealthAwareBudget &&
+		condition.False(api.EvictionSafeCondition, cluster.Status().Conditions)
+}
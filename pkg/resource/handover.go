@@ -0,0 +1,125 @@
+/*
+Copyright 2021 The Cockroach Authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    https://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package resource
+
+import (
+	api "github.com/cockroachdb/cockroach-operator/apis/v1alpha1"
+	"github.com/cockroachdb/cockroach-operator/pkg/labels"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+const (
+	// CrdbAdoptedFromAnnotation records the manager a resource was taken over from.
+	CrdbAdoptedFromAnnotation = "crdb.io/adopted-from"
+
+	// ManagerHelm is the previous manager of resources deployed by a Helm chart.
+	ManagerHelm = "helm"
+	// ManagerPreviousOperator is the previous manager of resources owned by a
+	// CrdbCluster that has since been recreated, which happens when an old
+	// operator release is replaced by deleting the CRs with orphaned dependents.
+	ManagerPreviousOperator = "previous-operator"
+
+	helmManagedByValue             = "Helm"
+	helmChartLabel                 = "helm.sh/chart"
+	helmHeritageLabel              = "heritage"
+	helmReleaseLabel               = "release"
+	helmReleaseNameAnnotation      = "meta.helm.sh/release-name"
+	helmReleaseNamespaceAnnotation = "meta.helm.sh/release-namespace"
+	helmResourcePolicyAnnotation   = "helm.sh/resource-policy"
+	helmResourcePolicyKeep         = "keep"
+)
+
+// Adopter is implemented by builders whose resources need extra care when they
+// are taken over from a previous manager, for instance to keep immutable fields.
+type Adopter interface {
+	Adopt(existing, desired client.Object) error
+}
+
+// PreviousManager returns the manager obj was deployed by if it is not owned by
+// owner yet, or an empty string otherwise. Objects without any sign of another
+// manager are left to the usual ownership checks.
+func PreviousManager(obj, owner metav1.Object) string {
+	if obj.GetResourceVersion() == "" {
+		return ""
+	}
+
+	if obj.GetLabels()[labels.ManagedByKey] == helmManagedByValue ||
+		obj.GetLabels()[helmHeritageLabel] != "" ||
+		obj.GetAnnotations()[helmReleaseNameAnnotation] != "" {
+		return ManagerHelm
+	}
+
+	if ref := metav1.GetControllerOf(obj); ref != nil && isStaleClusterRef(*ref, owner) {
+		return ManagerPreviousOperator
+	}
+
+	return ""
+}
+
+// isStaleClusterRef returns whether ref points at a CrdbCluster with the name
+// of owner but a different UID.
+func isStaleClusterRef(ref metav1.OwnerReference, owner metav1.Object) bool {
+	gv, err := schema.ParseGroupVersion(ref.APIVersion)
+	if err != nil {
+		return false
+	}
+
+	return gv.Group == api.SchemeGroupVersion.Group &&
+		ref.Kind == "CrdbCluster" &&
+		ref.Name == owner.GetName() &&
+		ref.UID != owner.GetUID()
+}
+
+// adopt takes obj over from its previous manager. Helm release metadata is
+// removed so the release no longer claims the object, and the object is kept
+// when the release is uninstalled. A stale controller reference is dropped so
+// the current CrdbCluster can be set as the controller.
+func adopt(obj, owner metav1.Object, from string) {
+	annotations := obj.GetAnnotations()
+	if annotations == nil {
+		annotations = make(map[string]string)
+	}
+	annotations[CrdbAdoptedFromAnnotation] = from
+
+	switch from {
+	case ManagerHelm:
+		delete(annotations, helmReleaseNameAnnotation)
+		delete(annotations, helmReleaseNamespaceAnnotation)
+		annotations[helmResourcePolicyAnnotation] = helmResourcePolicyKeep
+
+		ll := obj.GetLabels()
+		delete(ll, helmChartLabel)
+		delete(ll, helmHeritageLabel)
+		delete(ll, helmReleaseLabel)
+		if ll[labels.ManagedByKey] == helmManagedByValue {
+			delete(ll, labels.ManagedByKey)
+		}
+		obj.SetLabels(ll)
+	case ManagerPreviousOperator:
+		var refs []metav1.OwnerReference
+		for _, ref := range obj.GetOwnerReferences() {
+			if !isStaleClusterRef(ref, owner) {
+				refs = append(refs, ref)
+			}
+		}
+		obj.SetOwnerReferences(refs)
+	}
+
+	obj.SetAnnotations(annotations)
+}
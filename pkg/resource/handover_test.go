@@ -0,0 +1,109 @@
+/*
+Copyright 2021 The Cockroach Authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    https://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package resource_test
+
+import (
+	"testing"
+
+	"github.com/cockroachdb/cockroach-operator/pkg/labels"
+	"github.com/cockroachdb/cockroach-operator/pkg/resource"
+	"github.com/cockroachdb/cockroach-operator/pkg/testutil"
+	"github.com/stretchr/testify/require"
+	appsv1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+func TestPreviousManager(t *testing.T) {
+	owner := testutil.NewBuilder("test-cluster").Namespaced("default").WithUID("test-cluster-uid").Cr()
+
+	tests := []struct {
+		name     string
+		obj      metav1.Object
+		expected string
+	}{
+		{
+			name:     "object does not exist yet",
+			obj:      &metav1.ObjectMeta{Name: "test-cluster"},
+			expected: "",
+		},
+		{
+			name:     "object owned by the cluster",
+			obj:      existing(makeTestService()),
+			expected: "",
+		},
+		{
+			name:     "object deployed by a helm chart",
+			obj:      existing(makeHelmService()),
+			expected: resource.ManagerHelm,
+		},
+		{
+			name:     "object owned by a previous instance of the cluster",
+			obj:      existing(modifyOwnerUID("previous-uid", makeTestService())),
+			expected: resource.ManagerPreviousOperator,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			require.Equal(t, tt.expected, resource.PreviousManager(tt.obj, owner))
+		})
+	}
+}
+
+func existing(service *corev1.Service) metav1.Object {
+	service.ResourceVersion = "1"
+
+	return service
+}
+
+func TestStatefulSetBuilderAdopt(t *testing.T) {
+	cluster := testutil.NewBuilder("test-cluster").Namespaced("default").
+		WithPVDataStore("1Gi", "standard").Cluster()
+	selector := labels.Common(cluster.Unwrap()).Selector(nil)
+	builder := resource.StatefulSetBuilder{Cluster: cluster, Selector: selector}
+
+	existing := &appsv1.StatefulSet{
+		Spec: appsv1.StatefulSetSpec{
+			ServiceName:         "test-cluster-helm",
+			PodManagementPolicy: appsv1.OrderedReadyPodManagement,
+			Selector: &metav1.LabelSelector{
+				MatchLabels: map[string]string{"app.kubernetes.io/component": "cockroachdb"},
+			},
+			VolumeClaimTemplates: []corev1.PersistentVolumeClaim{
+				{ObjectMeta: metav1.ObjectMeta{Name: "datadir"}},
+			},
+		},
+	}
+
+	desired := &appsv1.StatefulSet{}
+	require.NoError(t, builder.Build(desired))
+	require.NoError(t, builder.Adopt(existing, desired))
+
+	require.Equal(t, existing.Spec.ServiceName, desired.Spec.ServiceName)
+	require.Equal(t, existing.Spec.PodManagementPolicy, desired.Spec.PodManagementPolicy)
+	require.Equal(t, existing.Spec.Selector, desired.Spec.Selector)
+	require.Equal(t, existing.Spec.VolumeClaimTemplates, desired.Spec.VolumeClaimTemplates)
+	require.Equal(t, "cockroachdb", desired.Spec.Template.Labels["app.kubernetes.io/component"])
+	require.Equal(t, "test-cluster", desired.Spec.Template.Labels["app.kubernetes.io/instance"])
+
+	// the selector shared with the other resources is left alone
+	require.Equal(t, "database", selector["app.kubernetes.io/component"])
+
+	existing.Spec.VolumeClaimTemplates[0].Name = "data"
+	require.Error(t, builder.Adopt(existing, desired))
+}
@@ -0,0 +1,41 @@
+/*
+Copyright 2021 The Cockroach Authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    https://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package resource
+
+import corev1 "k8s.io/api/core/v1"
+
+// applyHostNetwork runs the pod in the network namespace of its node when the
+// spec sets it. The ports of the containers are opened on the node, so that the
+// scheduler does not run two pods listening on the same ports on a node, and
+// the pod keeps resolving the services of the cluster unless the spec sets
+// another DNS policy.
+func (b StatefulSetBuilder) applyHostNetwork(spec *corev1.PodSpec) {
+	if !b.Spec().HostNetwork {
+		return
+	}
+
+	spec.HostNetwork = true
+	if spec.DNSPolicy == "" {
+		spec.DNSPolicy = corev1.DNSClusterFirstWithHostNet
+	}
+	for i := range spec.Containers {
+		for j := range spec.Containers[i].Ports {
+			port := &spec.Containers[i].Ports[j]
+			port.HostPort = port.ContainerPort
+		}
+	}
+}
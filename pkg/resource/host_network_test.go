@@ -0,0 +1,64 @@
+/*
+Copyright 2021 The Cockroach Authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    https://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package resource_test
+
+import (
+	"testing"
+
+	api "github.com/cockroachdb/cockroach-operator/apis/v1alpha1"
+	"github.com/cockroachdb/cockroach-operator/pkg/labels"
+	"github.com/cockroachdb/cockroach-operator/pkg/resource"
+	"github.com/cockroachdb/cockroach-operator/pkg/testutil"
+	"github.com/stretchr/testify/require"
+	appsv1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+)
+
+func TestStatefulSetHostNetwork(t *testing.T) {
+	build := func(cr *api.CrdbCluster) corev1.PodSpec {
+		cluster := resource.NewCluster(cr)
+		ss := &appsv1.StatefulSet{}
+		err := resource.StatefulSetBuilder{
+			Cluster:  &cluster,
+			Selector: labels.Common(cr).Selector(nil),
+		}.Build(ss)
+		require.NoError(t, err)
+		return ss.Spec.Template.Spec
+	}
+
+	cr := testutil.NewBuilder("crdb").Namespaced("default").WithPVDataStore("1Gi", "standard").WithNodeCount(3).Cr()
+	spec := build(cr)
+	require.False(t, spec.HostNetwork)
+	require.Empty(t, spec.DNSPolicy)
+	for _, port := range spec.Containers[0].Ports {
+		require.Zero(t, port.HostPort)
+	}
+
+	cr.Spec.HostNetwork = true
+	spec = build(cr)
+	require.True(t, spec.HostNetwork)
+	require.Equal(t, corev1.DNSClusterFirstWithHostNet, spec.DNSPolicy)
+	require.Len(t, spec.Containers[0].Ports, 3)
+	for _, port := range spec.Containers[0].Ports {
+		require.Equal(t, port.ContainerPort, port.HostPort, port.Name)
+	}
+
+	// a DNS policy set by the spec is kept
+	cr.Spec.DNS = &api.DNSSettings{Policy: corev1.DNSDefault}
+	spec = build(cr)
+	require.Equal(t, corev1.DNSDefault, spec.DNSPolicy)
+}
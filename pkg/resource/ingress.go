@@ -0,0 +1,259 @@
+/*
+Copyright 2021 The Cockroach Authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    https://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package resource
+
+import (
+	"errors"
+
+	api "github.com/cockroachdb/cockroach-operator/apis/v1alpha1"
+	networkingv1 "k8s.io/api/networking/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+const (
+	// NginxSSLPassthroughAnnotation and NginxBackendProtocolAnnotation are
+	// the annotations of ingress-nginx, which the other ingress controllers
+	// ignore
+	NginxSSLPassthroughAnnotation  = "nginx.ingress.kubernetes.io/ssl-passthrough"
+	NginxBackendProtocolAnnotation = "nginx.ingress.kubernetes.io/backend-protocol"
+)
+
+var (
+	// HTTPRouteGVK and TLSRouteGVK are the kinds of the routes of the Gateway
+	// API. The routes are unstructured, the operator does not depend on the
+	// types of the Gateway API, whose CRDs are only needed to use them.
+	HTTPRouteGVK = schema.GroupVersionKind{Group: "gateway.networking.k8s.io", Version: "v1", Kind: "HTTPRoute"}
+	TLSRouteGVK  = schema.GroupVersionKind{Group: "gateway.networking.k8s.io", Version: "v1alpha2", Kind: "TLSRoute"}
+)
+
+// IngressBuilders returns the builders of the Ingress objects and of the
+// routes of the endpoints of spec.ingress.
+func IngressBuilders(cluster *Cluster) []Builder {
+	ingress := cluster.Spec().Ingress
+	if ingress == nil {
+		return nil
+	}
+
+	var builders []Builder
+	for _, sql := range []bool{false, true} {
+		endpoint := ingressEndpoint(cluster, sql)
+		if endpoint == nil {
+			continue
+		}
+		if endpoint.Gateway != nil {
+			builders = append(builders, RouteBuilder{Cluster: cluster, SQL: sql})
+		} else {
+			builders = append(builders, IngressBuilder{Cluster: cluster, SQL: sql})
+		}
+	}
+	return builders
+}
+
+// IngressBuilder models the Ingress of the DB Console, or of the SQL endpoint
+// when SQL is set.
+type IngressBuilder struct {
+	*Cluster
+
+	SQL bool
+}
+
+func (b IngressBuilder) ResourceName() string {
+	return ingressName(b.Cluster, b.SQL)
+}
+
+// Build routes the host of the endpoint to its port of the public service.
+// The TLS of the SQL endpoint, and of the DB Console without a TLS secret, is
+// passed through to the nodes.
+func (b IngressBuilder) Build(obj client.Object) error {
+	ingress, ok := obj.(*networkingv1.Ingress)
+	if !ok {
+		return errors.New("failed to cast to Ingress object")
+	}
+	endpoint := ingressEndpoint(b.Cluster, b.SQL)
+	if endpoint == nil {
+		return errors.New("the endpoint of the Ingress is not set")
+	}
+
+	if ingress.ObjectMeta.Name == "" {
+		ingress.ObjectMeta.Name = b.ResourceName()
+	}
+
+	if ingress.ObjectMeta.Labels == nil {
+		ingress.ObjectMeta.Labels = map[string]string{}
+	}
+
+	ingress.Annotations = map[string]string{}
+	if endpoint.Passthrough() {
+		ingress.Annotations[NginxSSLPassthroughAnnotation] = "true"
+	} else if b.Spec().TLSEnabled {
+		ingress.Annotations[NginxBackendProtocolAnnotation] = "HTTPS"
+	}
+	for k, v := range b.Spec().AdditionalAnnotations {
+		ingress.Annotations[k] = v
+	}
+	for k, v := range endpoint.Annotations {
+		ingress.Annotations[k] = v
+	}
+
+	port := b.Spec().PortNames.HTTPOrDefault()
+	if b.SQL {
+		port = b.Spec().PortNames.SQLOrDefault()
+	}
+	pathType := networkingv1.PathTypePrefix
+	ingress.Spec = networkingv1.IngressSpec{
+		IngressClassName: endpoint.IngressClassName,
+		Rules: []networkingv1.IngressRule{
+			{
+				Host: endpoint.Host,
+				IngressRuleValue: networkingv1.IngressRuleValue{
+					HTTP: &networkingv1.HTTPIngressRuleValue{
+						Paths: []networkingv1.HTTPIngressPath{
+							{
+								Path:     "/",
+								PathType: &pathType,
+								Backend: networkingv1.IngressBackend{
+									Service: &networkingv1.IngressServiceBackend{
+										Name: b.PublicServiceName(),
+										Port: networkingv1.ServiceBackendPort{Name: port},
+									},
+								},
+							},
+						},
+					},
+				},
+			},
+		},
+	}
+	if !endpoint.Passthrough() {
+		ingress.Spec.TLS = []networkingv1.IngressTLS{
+			{Hosts: []string{endpoint.Host}, SecretName: endpoint.TLSSecretName},
+		}
+	}
+
+	return nil
+}
+
+func (b IngressBuilder) Placeholder() client.Object {
+	return &networkingv1.Ingress{
+		ObjectMeta: metav1.ObjectMeta{
+			Name: b.ResourceName(),
+		},
+	}
+}
+
+// RouteBuilder models the HTTPRoute of the DB Console, or the TLSRoute of the
+// SQL endpoint when SQL is set, attached to the Gateway of the endpoint.
+type RouteBuilder struct {
+	*Cluster
+
+	SQL bool
+}
+
+func (b RouteBuilder) ResourceName() string {
+	return ingressName(b.Cluster, b.SQL)
+}
+
+// GroupVersionKind returns the kind of the route.
+func (b RouteBuilder) GroupVersionKind() schema.GroupVersionKind {
+	if b.SQL {
+		return TLSRouteGVK
+	}
+	return HTTPRouteGVK
+}
+
+// Build routes the host of the endpoint to its port of the public service.
+func (b RouteBuilder) Build(obj client.Object) error {
+	route, ok := obj.(*unstructured.Unstructured)
+	if !ok {
+		return errors.New("failed to cast to Unstructured object")
+	}
+	endpoint := ingressEndpoint(b.Cluster, b.SQL)
+	if endpoint == nil || endpoint.Gateway == nil {
+		return errors.New("the gateway of the route is not set")
+	}
+
+	route.SetGroupVersionKind(b.GroupVersionKind())
+	if route.GetName() == "" {
+		route.SetName(b.ResourceName())
+	}
+
+	if len(b.Spec().AdditionalAnnotations) > 0 || len(endpoint.Annotations) > 0 {
+		annotations := map[string]string{}
+		for k, v := range b.Spec().AdditionalAnnotations {
+			annotations[k] = v
+		}
+		for k, v := range endpoint.Annotations {
+			annotations[k] = v
+		}
+		route.SetAnnotations(annotations)
+	}
+
+	parent := map[string]interface{}{"name": endpoint.Gateway.Name}
+	if endpoint.Gateway.Namespace != "" {
+		parent["namespace"] = endpoint.Gateway.Namespace
+	}
+	if endpoint.Gateway.SectionName != "" {
+		parent["sectionName"] = endpoint.Gateway.SectionName
+	}
+
+	port := *b.Spec().HTTPPort
+	if b.SQL {
+		port = *b.Spec().SQLPort
+	}
+	backend := map[string]interface{}{
+		"name": b.PublicServiceName(),
+		"port": int64(port),
+	}
+
+	route.Object["spec"] = map[string]interface{}{
+		"parentRefs": []interface{}{parent},
+		"hostnames":  []interface{}{endpoint.Host},
+		"rules": []interface{}{
+			map[string]interface{}{"backendRefs": []interface{}{backend}},
+		},
+	}
+
+	return nil
+}
+
+func (b RouteBuilder) Placeholder() client.Object {
+	route := &unstructured.Unstructured{}
+	route.SetGroupVersionKind(b.GroupVersionKind())
+	route.SetName(b.ResourceName())
+	return route
+}
+
+func ingressEndpoint(cluster *Cluster, sql bool) *api.IngressEndpoint {
+	ingress := cluster.Spec().Ingress
+	if ingress == nil {
+		return nil
+	}
+	if sql {
+		return ingress.SQL
+	}
+	return ingress.UI
+}
+
+func ingressName(cluster *Cluster, sql bool) string {
+	if sql {
+		return cluster.SQLIngressName()
+	}
+	return cluster.UIIngressName()
+}
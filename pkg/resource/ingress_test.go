@@ -0,0 +1,193 @@
+/*
+Copyright 2021 The Cockroach Authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    https://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package resource_test
+
+import (
+	"fmt"
+	"testing"
+
+	api "github.com/cockroachdb/cockroach-operator/apis/v1alpha1"
+	"github.com/cockroachdb/cockroach-operator/pkg/ptr"
+	"github.com/cockroachdb/cockroach-operator/pkg/resource"
+	"github.com/cockroachdb/cockroach-operator/pkg/testutil"
+	"github.com/google/go-cmp/cmp"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	networkingv1 "k8s.io/api/networking/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+)
+
+func TestIngressBuilder(t *testing.T) {
+	prefix := networkingv1.PathTypePrefix
+	rule := func(host, port string) []networkingv1.IngressRule {
+		return []networkingv1.IngressRule{
+			{
+				Host: host,
+				IngressRuleValue: networkingv1.IngressRuleValue{
+					HTTP: &networkingv1.HTTPIngressRuleValue{
+						Paths: []networkingv1.HTTPIngressPath{
+							{
+								Path:     "/",
+								PathType: &prefix,
+								Backend: networkingv1.IngressBackend{
+									Service: &networkingv1.IngressServiceBackend{
+										Name: "test-cluster-public",
+										Port: networkingv1.ServiceBackendPort{Name: port},
+									},
+								},
+							},
+						},
+					},
+				},
+			},
+		}
+	}
+
+	tests := []struct {
+		name     string
+		tls      bool
+		ingress  *api.Ingress
+		sql      bool
+		expected *networkingv1.Ingress
+	}{
+		{
+			name: "passes the TLS of the DB Console through",
+			tls:  true,
+			ingress: &api.Ingress{
+				UI: &api.IngressEndpoint{Host: "ui.example.com", IngressClassName: ptr.String("nginx")},
+			},
+			expected: &networkingv1.Ingress{
+				ObjectMeta: metav1.ObjectMeta{
+					Name:        "test-cluster-ui",
+					Labels:      map[string]string{},
+					Annotations: map[string]string{resource.NginxSSLPassthroughAnnotation: "true"},
+				},
+				Spec: networkingv1.IngressSpec{
+					IngressClassName: ptr.String("nginx"),
+					Rules:            rule("ui.example.com", "http"),
+				},
+			},
+		},
+		{
+			name: "terminates the TLS of the DB Console with its secret",
+			tls:  true,
+			ingress: &api.Ingress{
+				UI: &api.IngressEndpoint{
+					Host:          "ui.example.com",
+					TLSSecretName: "ui-tls",
+					Annotations:   map[string]string{"cert-manager.io/cluster-issuer": "letsencrypt"},
+				},
+			},
+			expected: &networkingv1.Ingress{
+				ObjectMeta: metav1.ObjectMeta{
+					Name:   "test-cluster-ui",
+					Labels: map[string]string{},
+					Annotations: map[string]string{
+						resource.NginxBackendProtocolAnnotation: "HTTPS",
+						"cert-manager.io/cluster-issuer":        "letsencrypt",
+					},
+				},
+				Spec: networkingv1.IngressSpec{
+					Rules: rule("ui.example.com", "http"),
+					TLS:   []networkingv1.IngressTLS{{Hosts: []string{"ui.example.com"}, SecretName: "ui-tls"}},
+				},
+			},
+		},
+		{
+			name: "passes the TLS of SQL through",
+			tls:  true,
+			ingress: &api.Ingress{
+				SQL: &api.IngressEndpoint{Host: "sql.example.com"},
+			},
+			sql: true,
+			expected: &networkingv1.Ingress{
+				ObjectMeta: metav1.ObjectMeta{
+					Name:        "test-cluster-sql",
+					Labels:      map[string]string{},
+					Annotations: map[string]string{resource.NginxSSLPassthroughAnnotation: "true"},
+				},
+				Spec: networkingv1.IngressSpec{
+					Rules: rule("sql.example.com", "sql"),
+				},
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			builder := testutil.NewBuilder("test-cluster").Namespaced("test-ns")
+			if tt.tls {
+				builder = builder.WithTLS()
+			}
+			cr := builder.Cr()
+			cr.Spec.Ingress = tt.ingress
+
+			actual := &networkingv1.Ingress{}
+			err := resource.IngressBuilder{Cluster: clusterOf(cr), SQL: tt.sql}.Build(actual)
+			require.NoError(t, err)
+
+			if diff := cmp.Diff(tt.expected, actual); diff != "" {
+				assert.Fail(t, fmt.Sprintf("unexpected result (-want +got):\n%v", diff))
+			}
+		})
+	}
+}
+
+func TestRouteBuilder(t *testing.T) {
+	cr := testutil.NewBuilder("test-cluster").Namespaced("test-ns").WithTLS().Cr()
+	cr.Spec.Ingress = &api.Ingress{
+		UI: &api.IngressEndpoint{
+			Host:    "ui.example.com",
+			Gateway: &api.GatewayRef{Name: "public", Namespace: "gateways", SectionName: "https"},
+		},
+		SQL: &api.IngressEndpoint{
+			Host:    "sql.example.com",
+			Gateway: &api.GatewayRef{Name: "sql"},
+		},
+	}
+	cluster := clusterOf(cr)
+
+	builders := resource.IngressBuilders(cluster)
+	require.Len(t, builders, 2)
+	assert.Equal(t, resource.RouteBuilder{Cluster: cluster}, builders[0])
+	assert.Equal(t, resource.RouteBuilder{Cluster: cluster, SQL: true}, builders[1])
+
+	ui := &unstructured.Unstructured{}
+	require.NoError(t, resource.RouteBuilder{Cluster: cluster}.Build(ui))
+	assert.Equal(t, resource.HTTPRouteGVK, ui.GroupVersionKind())
+	assert.Equal(t, "test-cluster-ui", ui.GetName())
+	assert.Equal(t, map[string]interface{}{
+		"parentRefs": []interface{}{
+			map[string]interface{}{"name": "public", "namespace": "gateways", "sectionName": "https"},
+		},
+		"hostnames": []interface{}{"ui.example.com"},
+		"rules": []interface{}{
+			map[string]interface{}{"backendRefs": []interface{}{
+				map[string]interface{}{"name": "test-cluster-public", "port": int64(8080)},
+			}},
+		},
+	}, ui.Object["spec"])
+
+	sql := &unstructured.Unstructured{}
+	require.NoError(t, resource.RouteBuilder{Cluster: cluster, SQL: true}.Build(sql))
+	assert.Equal(t, resource.TLSRouteGVK, sql.GroupVersionKind())
+	assert.Equal(t, "test-cluster-sql", sql.GetName())
+	assert.Equal(t, []interface{}{
+		map[string]interface{}{"name": "sql"},
+	}, sql.Object["spec"].(map[string]interface{})["parentRefs"])
+}
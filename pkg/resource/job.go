@@ -83,6 +83,12 @@ func (b JobBuilder) buildPodTemplate() corev1.PodTemplateSpec {
 				Labels: b.Selector,
 			},
 		*/
+		// The additional labels alone do not match the selector of the
+		// services, so the job pod does not receive any traffic.
+		ObjectMeta: metav1.ObjectMeta{
+			Labels:      b.Spec().AdditionalLabels,
+			Annotations: b.JobPodAnnotations(),
+		},
 		Spec: corev1.PodSpec{
 			SecurityContext: &corev1.PodSecurityContext{
 				RunAsUser: ptr.Int64(1000581000),
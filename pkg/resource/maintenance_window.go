@@ -0,0 +1,97 @@
+/*
+Copyright 2021 The Cockroach Authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    https://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package resource
+
+import (
+	"time"
+
+	api "github.com/cockroachdb/cockroach-operator/apis/v1alpha1"
+	"github.com/cockroachdb/cockroach-operator/pkg/cron"
+	"github.com/cockroachdb/errors"
+)
+
+// CrdbMaintenanceOverrideAnnotation lets the disruptive operations begin
+// outside of the maintenance window, for an emergency. Its value is the time
+// until which the window is ignored, in the RFC 3339 format, for instance
+// 2021-06-02T18:00:00Z.
+const CrdbMaintenanceOverrideAnnotation = "crdb.io/maintenance-override"
+
+// UntilMaintenanceWindow returns how long to wait from now before a disruptive
+// operation can begin. It is zero when now is within one of the windows of the
+// maintenance window, when there is none, or while the override annotation
+// lasts.
+func (cluster Cluster) UntilMaintenanceWindow(now time.Time) (time.Duration, error) {
+	m := cluster.Spec().MaintenanceWindow
+	if m == nil || len(m.Windows) == 0 {
+		return 0, nil
+	}
+
+	if value := cluster.getAnnotation(CrdbMaintenanceOverrideAnnotation); value != "" {
+		until, err := time.Parse(time.RFC3339, value)
+		if err != nil {
+			return 0, errors.Wrapf(err, "invalid %s annotation %q, expected a time like 2021-06-02T18:00:00Z", CrdbMaintenanceOverrideAnnotation, value)
+		}
+		if now.Before(until) {
+			return 0, nil
+		}
+	}
+
+	loc, err := time.LoadLocation(m.TimeZone)
+	if err != nil {
+		return 0, errors.Wrapf(err, "invalid time zone of the maintenance window %q", m.TimeZone)
+	}
+
+	var wait time.Duration
+	for i, w := range m.Windows {
+		d, err := untilWindow(w, loc, now)
+		if err != nil {
+			return 0, err
+		}
+		if d == 0 {
+			return 0, nil
+		}
+		if i == 0 || d < wait {
+			wait = d
+		}
+	}
+
+	return wait, nil
+}
+
+// untilWindow returns how long to wait from now until the window opens, or
+// zero if it is open.
+func untilWindow(w api.ScheduledWindow, loc *time.Location, now time.Time) (time.Duration, error) {
+	schedule, err := cron.Parse(w.Schedule)
+	if err != nil {
+		return 0, errors.Wrap(err, "invalid maintenance window")
+	}
+	if w.Duration.Duration <= 0 {
+		return 0, errors.Newf("invalid duration of maintenance window %s, it must be positive", w.Duration.Duration)
+	}
+	schedule = schedule.In(loc)
+
+	// the last opening closes last, the windows of a schedule can overlap
+	if opened := schedule.Prev(now); !opened.IsZero() && now.Before(opened.Add(w.Duration.Duration)) {
+		return 0, nil
+	}
+
+	next := schedule.Next(now)
+	if next.IsZero() {
+		return 0, errors.Newf("maintenance window %q never opens", w.Schedule)
+	}
+	return next.Sub(now), nil
+}
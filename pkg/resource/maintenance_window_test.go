@@ -0,0 +1,85 @@
+/*
+Copyright 2021 The Cockroach Authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    https://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package resource_test
+
+import (
+	"testing"
+	"time"
+
+	api "github.com/cockroachdb/cockroach-operator/apis/v1alpha1"
+	"github.com/cockroachdb/cockroach-operator/pkg/resource"
+	"github.com/cockroachdb/cockroach-operator/pkg/testutil"
+	"github.com/stretchr/testify/require"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+func TestUntilMaintenanceWindow(t *testing.T) {
+	// a Wednesday
+	now := time.Date(2021, time.June, 2, 10, 30, 0, 0, time.UTC)
+
+	window := func(schedule string, duration time.Duration) api.ScheduledWindow {
+		return api.ScheduledWindow{Schedule: schedule, Duration: metav1.Duration{Duration: duration}}
+	}
+
+	tests := []struct {
+		name     string
+		windows  []api.ScheduledWindow
+		timeZone string
+		override string
+		wait     time.Duration
+		err      string
+	}{
+		{name: "no window"},
+		{name: "within a window", windows: []api.ScheduledWindow{window("0 10 * * *", time.Hour)}},
+		{name: "within a window opened days ago", windows: []api.ScheduledWindow{window("0 2 * * sun", 81*time.Hour)}},
+		{name: "the window closed", windows: []api.ScheduledWindow{window("0 10 * * *", 15*time.Minute)}, wait: 23*time.Hour + 30*time.Minute},
+		{
+			name:    "the window opening first",
+			windows: []api.ScheduledWindow{window("0 12 * * sat", 4*time.Hour), window("0 22 * * *", 2*time.Hour)},
+			wait:    11*time.Hour + 30*time.Minute,
+		},
+		{name: "a window in UTC", windows: []api.ScheduledWindow{window("0 12 * * *", time.Hour)}, timeZone: "UTC", wait: 90 * time.Minute},
+		{name: "the override lasts", windows: []api.ScheduledWindow{window("0 12 * * *", time.Hour)}, override: "2021-06-02T11:00:00Z"},
+		{name: "the override is over", windows: []api.ScheduledWindow{window("0 12 * * *", time.Hour)}, override: "2021-06-02T10:00:00Z", wait: 90 * time.Minute},
+		{name: "invalid override", windows: []api.ScheduledWindow{window("0 12 * * *", time.Hour)}, override: "now", err: "invalid crdb.io/maintenance-override annotation"},
+		{name: "invalid schedule", windows: []api.ScheduledWindow{window("0 25 * * *", time.Hour)}, err: "invalid hour"},
+		{name: "invalid duration", windows: []api.ScheduledWindow{window("0 12 * * *", 0)}, err: "it must be positive"},
+		{name: "invalid time zone", windows: []api.ScheduledWindow{window("0 12 * * *", time.Hour)}, timeZone: "Mars/Olympus_Mons", err: "invalid time zone"},
+		{name: "the window never opens", windows: []api.ScheduledWindow{window("0 0 30 feb *", time.Hour)}, err: "never opens"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cr := testutil.NewBuilder("crdb").Namespaced("default").Cr()
+			if tt.windows != nil {
+				cr.Spec.MaintenanceWindow = &api.MaintenanceSchedule{Windows: tt.windows, TimeZone: tt.timeZone}
+			}
+			if tt.override != "" {
+				cr.Annotations = map[string]string{resource.CrdbMaintenanceOverrideAnnotation: tt.override}
+			}
+
+			wait, err := resource.NewCluster(cr).UntilMaintenanceWindow(now)
+			if tt.err != "" {
+				require.Error(t, err)
+				require.Contains(t, err.Error(), tt.err)
+				return
+			}
+			require.NoError(t, err)
+			require.Equal(t, tt.wait, wait)
+		})
+	}
+}
@@ -0,0 +1,157 @@
+/*
+Copyright 2021 The Cockroach Authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    https://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package resource
+
+import (
+	"errors"
+	"os"
+
+	"github.com/cockroachdb/cockroach-operator/pkg/labels"
+	corev1 "k8s.io/api/core/v1"
+	networkingv1 "k8s.io/api/networking/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/util/intstr"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+const (
+	// NamespaceNameLabel is the label Kubernetes 1.21 and later set to the
+	// name of every namespace.
+	NamespaceNameLabel = "kubernetes.io/metadata.name"
+
+	operatorNamespaceEnvVar = "POD_NAMESPACE"
+	operatorLabel           = "app"
+	operatorLabelValue      = "cockroach-operator"
+)
+
+// NetworkPolicyBuilder models the NetworkPolicy of the nodes of the cluster.
+type NetworkPolicyBuilder struct {
+	*Cluster
+
+	Selector map[string]string
+}
+
+func (b NetworkPolicyBuilder) ResourceName() string {
+	return b.NetworkPolicyName()
+}
+
+// Build lets the pods of the cluster, those of its jobs and clients
+// included, connect to every port of the nodes, and the operator as well.
+// The allowed clients may only connect to SQL and the DB Console.
+func (b NetworkPolicyBuilder) Build(obj client.Object) error {
+	policy, ok := obj.(*networkingv1.NetworkPolicy)
+	if !ok {
+		return errors.New("failed to cast to NetworkPolicy object")
+	}
+	np := b.Spec().NetworkPolicy
+	if !np.IsEnabled() {
+		return errors.New("the network policy is not enabled")
+	}
+
+	if policy.ObjectMeta.Name == "" {
+		policy.ObjectMeta.Name = b.ResourceName()
+	}
+
+	if policy.ObjectMeta.Labels == nil {
+		policy.ObjectMeta.Labels = map[string]string{}
+	}
+
+	policy.Annotations = b.Spec().AdditionalAnnotations
+
+	// the pods of the jobs and of the client share the selector, but not the
+	// component of the nodes
+	instance := map[string]string{}
+	for k, v := range b.Selector {
+		if k != labels.ComponentKey {
+			instance[k] = v
+		}
+	}
+
+	grpc := networkPolicyPort(*b.Spec().GRPCPort)
+	http := networkPolicyPort(*b.Spec().HTTPPort)
+	sql := networkPolicyPort(*b.Spec().SQLPort)
+	allPorts := []networkingv1.NetworkPolicyPort{grpc, http, sql}
+
+	policy.Spec = networkingv1.NetworkPolicySpec{
+		PodSelector: metav1.LabelSelector{MatchLabels: b.Selector},
+		PolicyTypes: []networkingv1.PolicyType{networkingv1.PolicyTypeIngress},
+		Ingress: []networkingv1.NetworkPolicyIngressRule{
+			{
+				From:  []networkingv1.NetworkPolicyPeer{{PodSelector: &metav1.LabelSelector{MatchLabels: instance}}},
+				Ports: allPorts,
+			},
+			{
+				From:  []networkingv1.NetworkPolicyPeer{operatorPeer()},
+				Ports: allPorts,
+			},
+		},
+	}
+
+	var clients []networkingv1.NetworkPolicyPeer
+	if len(np.AllowedNamespaces) > 0 {
+		clients = append(clients, networkingv1.NetworkPolicyPeer{
+			NamespaceSelector: &metav1.LabelSelector{
+				MatchExpressions: []metav1.LabelSelectorRequirement{
+					{
+						Key:      NamespaceNameLabel,
+						Operator: metav1.LabelSelectorOpIn,
+						Values:   np.AllowedNamespaces,
+					},
+				},
+			},
+		})
+	}
+	clients = append(clients, np.AllowedClients...)
+	if len(clients) > 0 {
+		policy.Spec.Ingress = append(policy.Spec.Ingress, networkingv1.NetworkPolicyIngressRule{
+			From:  clients,
+			Ports: []networkingv1.NetworkPolicyPort{http, sql},
+		})
+	}
+
+	return nil
+}
+
+func (b NetworkPolicyBuilder) Placeholder() client.Object {
+	return &networkingv1.NetworkPolicy{
+		ObjectMeta: metav1.ObjectMeta{
+			Name: b.ResourceName(),
+		},
+	}
+}
+
+// operatorPeer selects the pods of the operator, in the namespace set in its
+// environment, or in the namespace of the cluster otherwise.
+func operatorPeer() networkingv1.NetworkPolicyPeer {
+	peer := networkingv1.NetworkPolicyPeer{
+		PodSelector: &metav1.LabelSelector{
+			MatchLabels: map[string]string{operatorLabel: operatorLabelValue},
+		},
+	}
+	if ns := os.Getenv(operatorNamespaceEnvVar); ns != "" {
+		peer.NamespaceSelector = &metav1.LabelSelector{
+			MatchLabels: map[string]string{NamespaceNameLabel: ns},
+		}
+	}
+	return peer
+}
+
+func networkPolicyPort(port int32) networkingv1.NetworkPolicyPort {
+	protocol := corev1.ProtocolTCP
+	p := intstr.FromInt(int(port))
+	return networkingv1.NetworkPolicyPort{Protocol: &protocol, Port: &p}
+}
@@ -0,0 +1,131 @@
+/*
+Copyright 2021 The Cockroach Authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    https://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package resource_test
+
+import (
+	"fmt"
+	"testing"
+
+	api "github.com/cockroachdb/cockroach-operator/apis/v1alpha1"
+	"github.com/cockroachdb/cockroach-operator/pkg/labels"
+	"github.com/cockroachdb/cockroach-operator/pkg/resource"
+	"github.com/cockroachdb/cockroach-operator/pkg/testutil"
+	"github.com/google/go-cmp/cmp"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	corev1 "k8s.io/api/core/v1"
+	networkingv1 "k8s.io/api/networking/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/util/intstr"
+)
+
+func TestNetworkPolicyBuilder(t *testing.T) {
+	web := networkingv1.NetworkPolicyPeer{
+		PodSelector: &metav1.LabelSelector{MatchLabels: map[string]string{"app": "web"}},
+	}
+
+	cr := testutil.NewBuilder("test-cluster").Namespaced("test-ns").Cr()
+	cr.Spec.NetworkPolicy = &api.NetworkPolicy{
+		Enabled:           true,
+		AllowedNamespaces: []string{"ingress-nginx"},
+		AllowedClients:    []networkingv1.NetworkPolicyPeer{web},
+	}
+	cluster := clusterOf(cr)
+	selector := labels.Common(cr).Selector(cr.Spec.AdditionalLabels)
+
+	port := func(p int) networkingv1.NetworkPolicyPort {
+		protocol := corev1.ProtocolTCP
+		port := intstr.FromInt(p)
+		return networkingv1.NetworkPolicyPort{Protocol: &protocol, Port: &port}
+	}
+	allPorts := []networkingv1.NetworkPolicyPort{port(26258), port(8080), port(26257)}
+
+	expected := &networkingv1.NetworkPolicy{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:   "test-cluster",
+			Labels: map[string]string{},
+		},
+		Spec: networkingv1.NetworkPolicySpec{
+			PodSelector: metav1.LabelSelector{MatchLabels: selector},
+			PolicyTypes: []networkingv1.PolicyType{networkingv1.PolicyTypeIngress},
+			Ingress: []networkingv1.NetworkPolicyIngressRule{
+				{
+					From: []networkingv1.NetworkPolicyPeer{{
+						PodSelector: &metav1.LabelSelector{MatchLabels: map[string]string{
+							"app.kubernetes.io/name":     "cockroachdb",
+							"app.kubernetes.io/instance": "test-cluster",
+						}},
+					}},
+					Ports: allPorts,
+				},
+				{
+					From: []networkingv1.NetworkPolicyPeer{{
+						PodSelector:       &metav1.LabelSelector{MatchLabels: map[string]string{"app": "cockroach-operator"}},
+						NamespaceSelector: &metav1.LabelSelector{MatchLabels: map[string]string{resource.NamespaceNameLabel: "operators"}},
+					}},
+					Ports: allPorts,
+				},
+				{
+					From: []networkingv1.NetworkPolicyPeer{
+						{
+							NamespaceSelector: &metav1.LabelSelector{
+								MatchExpressions: []metav1.LabelSelectorRequirement{{
+									Key:      resource.NamespaceNameLabel,
+									Operator: metav1.LabelSelectorOpIn,
+									Values:   []string{"ingress-nginx"},
+								}},
+							},
+						},
+						web,
+					},
+					Ports: []networkingv1.NetworkPolicyPort{port(8080), port(26257)},
+				},
+			},
+		},
+	}
+
+	actual := &networkingv1.NetworkPolicy{}
+	testutil.WithEnv(map[string]string{"POD_NAMESPACE": "operators"}, func() {
+		err := resource.NetworkPolicyBuilder{Cluster: cluster, Selector: selector}.Build(actual)
+		require.NoError(t, err)
+	})
+
+	if diff := cmp.Diff(expected, actual); diff != "" {
+		assert.Fail(t, fmt.Sprintf("unexpected result (-want +got):\n%v", diff))
+	}
+}
+
+func TestNetworkPolicyBuilderWithoutClients(t *testing.T) {
+	cr := testutil.NewBuilder("test-cluster").Namespaced("test-ns").Cr()
+	cr.Spec.NetworkPolicy = &api.NetworkPolicy{Enabled: true}
+	selector := labels.Common(cr).Selector(cr.Spec.AdditionalLabels)
+
+	actual := &networkingv1.NetworkPolicy{}
+	testutil.WithEnv(map[string]string{"POD_NAMESPACE": ""}, func() {
+		err := resource.NetworkPolicyBuilder{Cluster: clusterOf(cr), Selector: selector}.Build(actual)
+		require.NoError(t, err)
+	})
+
+	// without its namespace, the operator is looked up in the namespace of
+	// the cluster, and only the cluster and the operator are allowed
+	require.Len(t, actual.Spec.Ingress, 2)
+	assert.Nil(t, actual.Spec.Ingress[1].From[0].NamespaceSelector)
+
+	cr.Spec.NetworkPolicy.Enabled = false
+	err := resource.NetworkPolicyBuilder{Cluster: clusterOf(cr), Selector: selector}.Build(&networkingv1.NetworkPolicy{})
+	require.Error(t, err)
+}
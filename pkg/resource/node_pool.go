@@ -0,0 +1,119 @@
+/*
+Copyright 2021 The Cockroach Authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    https://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package resource
+
+import (
+	"context"
+	"fmt"
+
+	api "github.com/cockroachdb/cockroach-operator/apis/v1alpha1"
+	"github.com/cockroachdb/cockroach-operator/pkg/labels"
+	"github.com/cockroachdb/errors"
+	appsv1 "k8s.io/api/apps/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+// NodePoolLabel is the label of the StatefulSet, the pods and the volume
+// claims of a node pool, set to the name of the pool
+const NodePoolLabel = "crdb.cockroachlabs.com/node-pool"
+
+// NodePoolStatefulSetName returns the name of the StatefulSet of the node pool.
+func (cluster Cluster) NodePoolStatefulSetName(pool string) string {
+	return fmt.Sprintf("%s-%s", cluster.StatefulSetName(), pool)
+}
+
+// NodePoolLabels returns the labels with the label of the node pool added.
+func NodePoolLabels(ll labels.Labels, pool string) labels.Labels {
+	poolLabels := ll.Copy()
+	poolLabels[NodePoolLabel] = pool
+	return poolLabels
+}
+
+// NewNodePoolStatefulSetBuilder returns the builder of the StatefulSet of the
+// node pool. The pods of the pool have the resources and the data store of
+// the pool, or those of the cluster if the pool has none, and the locality of
+// the pool is added to the arguments of the nodes.
+func NewNodePoolStatefulSetBuilder(cluster *Cluster, selector labels.Labels, telemetry string, pool api.NodePool) StatefulSetBuilder {
+	cr := cluster.cr.DeepCopy()
+	if pool.Resources != nil {
+		cr.Spec.Resources = *pool.Resources
+	}
+	if pool.DataStore != nil {
+		cr.Spec.DataStore = *pool.DataStore
+	}
+	if pool.Locality != "" {
+		cr.Spec.AdditionalArgs = append(cr.Spec.AdditionalArgs, "--locality="+pool.Locality)
+	}
+
+	return StatefulSetBuilder{
+		Cluster:   &Cluster{Fetcher: cluster.Fetcher, cr: cr, initTime: cluster.initTime},
+		Selector:  NodePoolLabels(selector, pool.Name),
+		Telemetry: telemetry,
+		Pool:      &pool,
+	}
+}
+
+// NodePoolStatefulSets lists the StatefulSets of the node pools of the
+// cluster, including those of the pools removed from the spec.
+func NodePoolStatefulSets(ctx context.Context, cl client.Client, cluster *Cluster) ([]appsv1.StatefulSet, error) {
+	list := &appsv1.StatefulSetList{}
+	selector := labels.Common(cluster.Unwrap()).Selector(cluster.Spec().PropagatedLabels(api.PropagateStatefulSet))
+	if err := cl.List(ctx, list, client.InNamespace(cluster.Namespace()), client.MatchingLabels(selector)); err != nil {
+		return nil, errors.Wrap(err, "failed to list the statefulsets of the node pools")
+	}
+
+	owner := cluster.Unwrap()
+	var statefulSets []appsv1.StatefulSet
+	for _, ss := range list.Items {
+		if ss.Labels[NodePoolLabel] != "" && metav1.IsControlledBy(&ss, owner) {
+			statefulSets = append(statefulSets, ss)
+		}
+	}
+	return statefulSets, nil
+}
+
+// ClusterStatefulSets returns the StatefulSet of the nodes of the cluster,
+// unless it does not exist yet, followed by those of its node pools.
+func ClusterStatefulSets(ctx context.Context, cl client.Client, cluster *Cluster) ([]appsv1.StatefulSet, error) {
+	var statefulSets []appsv1.StatefulSet
+	ss := &appsv1.StatefulSet{}
+	key := types.NamespacedName{Namespace: cluster.Namespace(), Name: cluster.StatefulSetName()}
+	if err := cl.Get(ctx, key, ss); err == nil {
+		statefulSets = append(statefulSets, *ss)
+	} else if !apierrors.IsNotFound(err) {
+		return nil, errors.Wrap(err, "failed to fetch statefulset")
+	}
+
+	pools, err := NodePoolStatefulSets(ctx, cl, cluster)
+	if err != nil {
+		return nil, err
+	}
+	return append(statefulSets, pools...), nil
+}
+
+// SetNodePoolsStatus records the number of pods of the StatefulSets of the
+// node pools.
+func (cluster Cluster) SetNodePoolsStatus(statefulSets []appsv1.StatefulSet) {
+	var pools []api.NodePoolStatus
+	for _, ss := range statefulSets {
+		pools = append(pools, api.NodePoolStatus{Name: ss.Labels[NodePoolLabel], Nodes: ss.Status.Replicas})
+	}
+	cluster.cr.Status.NodePools = pools
+}
@@ -0,0 +1,145 @@
+/*
+Copyright 2021 The Cockroach Authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    https://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package resource_test
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	api "github.com/cockroachdb/cockroach-operator/apis/v1alpha1"
+	"github.com/cockroachdb/cockroach-operator/pkg/labels"
+	"github.com/cockroachdb/cockroach-operator/pkg/ptr"
+	"github.com/cockroachdb/cockroach-operator/pkg/resource"
+	"github.com/cockroachdb/cockroach-operator/pkg/testutil"
+	"github.com/stretchr/testify/require"
+	appsv1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+	apiresource "k8s.io/apimachinery/pkg/api/resource"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+)
+
+func TestNodePoolStatefulSetBuilder(t *testing.T) {
+	cr := testutil.NewBuilder("crdb").Namespaced("default").WithPVDataStore("1Gi", "standard").WithNodeCount(3).
+		WithResources(corev1.ResourceRequirements{
+			Requests: corev1.ResourceList{corev1.ResourceCPU: apiresource.MustParse("1")},
+		}).Cr()
+	cr.Spec.AdditionalArgs = []string{"--locality=region=us-east1"}
+	cluster := resource.NewCluster(cr)
+
+	large := corev1.ResourceRequirements{
+		Requests: corev1.ResourceList{corev1.ResourceCPU: apiresource.MustParse("8")},
+	}
+	pool := api.NodePool{
+		Name:         "large",
+		Nodes:        2,
+		Resources:    &large,
+		Locality:     "region=us-east1,zone=us-east1-b",
+		NodeSelector: map[string]string{"node.kubernetes.io/instance-type": "n2-standard-8"},
+		Tolerations:  []corev1.Toleration{{Key: "dedicated", Operator: corev1.TolerationOpExists}},
+	}
+
+	selector := labels.Common(cr).Selector(nil)
+	b := resource.NewNodePoolStatefulSetBuilder(&cluster, selector, "kubernetes-operator-gke", pool)
+	require.Equal(t, "crdb-large", b.ResourceName())
+
+	ss := b.Placeholder().(*appsv1.StatefulSet)
+	require.NoError(t, b.Build(ss))
+	require.Equal(t, "crdb-large", ss.Name)
+	require.Equal(t, int32(2), *ss.Spec.Replicas)
+	require.Equal(t, "crdb", ss.Spec.ServiceName)
+	require.Equal(t, "large", ss.Spec.Selector.MatchLabels[resource.NodePoolLabel])
+	require.Equal(t, "large", ss.Spec.Template.Labels[resource.NodePoolLabel])
+	require.Equal(t, "large", ss.Spec.VolumeClaimTemplates[0].Labels[resource.NodePoolLabel])
+	// the selector of the cluster is left as it is
+	require.NotContains(t, selector, resource.NodePoolLabel)
+
+	spec := ss.Spec.Template.Spec
+	require.Equal(t, pool.NodeSelector, spec.NodeSelector)
+	require.Equal(t, pool.Tolerations, spec.Tolerations)
+	require.Equal(t, large, spec.Containers[0].Resources)
+
+	// the nodes of the pool join the nodes of the default statefulset, and the
+	// locality of the pool comes last so that it takes precedence
+	command := spec.Containers[0].Command[2]
+	require.Contains(t, command, "--join=crdb-0.crdb.default")
+	require.True(t, strings.HasSuffix(command, "--locality=region=us-east1 --locality=region=us-east1,zone=us-east1-b"))
+
+	// the cluster keeps its own resources
+	require.True(t, cluster.Spec().Resources.Requests.Cpu().Equal(apiresource.MustParse("1")))
+}
+
+func TestNodePoolStatefulSets(t *testing.T) {
+	scheme := testutil.InitScheme(t)
+	cr := testutil.NewBuilder("crdb").Namespaced("default").WithUID("crdb-uid").Cr()
+	cluster := resource.NewCluster(cr)
+
+	selector := labels.Common(cr).Selector(nil)
+	statefulSet := func(name string, pool string, owned bool) *appsv1.StatefulSet {
+		ss := &appsv1.StatefulSet{ObjectMeta: metav1.ObjectMeta{
+			Name:      name,
+			Namespace: "default",
+			Labels:    map[string]string{},
+		}}
+		for k, v := range selector {
+			ss.Labels[k] = v
+		}
+		if pool != "" {
+			ss.Labels[resource.NodePoolLabel] = pool
+		}
+		if owned {
+			ss.OwnerReferences = []metav1.OwnerReference{{
+				APIVersion: "crdb.cockroachlabs.com/v1alpha1",
+				Kind:       "CrdbCluster",
+				Name:       "crdb",
+				UID:        "crdb-uid",
+				Controller: ptr.Bool(true),
+			}}
+		}
+		return ss
+	}
+
+	cl := fake.NewFakeClientWithScheme(scheme,
+		statefulSet("crdb", "", true),
+		statefulSet("crdb-large", "large", true),
+		statefulSet("crdb-removed", "removed", true),
+		statefulSet("crdb-other", "other", false),
+	)
+
+	statefulSets, err := resource.NodePoolStatefulSets(context.TODO(), cl, &cluster)
+	require.NoError(t, err)
+
+	var names []string
+	for _, ss := range statefulSets {
+		names = append(names, ss.Name)
+	}
+	require.ElementsMatch(t, []string{"crdb-large", "crdb-removed"}, names)
+
+	cluster.SetNodePoolsStatus(statefulSets)
+	var pools []string
+	for _, pool := range cluster.Status().NodePools {
+		pools = append(pools, pool.Name)
+	}
+	require.ElementsMatch(t, []string{"large", "removed"}, pools)
+
+	// the statefulset of the nodes comes first
+	statefulSets, err = resource.ClusterStatefulSets(context.TODO(), cl, &cluster)
+	require.NoError(t, err)
+	require.Len(t, statefulSets, 3)
+	require.Equal(t, "crdb", statefulSets[0].Name)
+}
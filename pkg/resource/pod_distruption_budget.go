@@ -81,6 +81,13 @@ func (b PdbBuilder) Build(obj client.Object) error {
 		pdb.Spec.MaxUnavailable = &maxUnavailableIS
 	}
 
+	// a node drain waits for the cluster to recover
+	if b.BlocksEvictions() {
+		none := intstr.FromInt(0)
+		pdb.Spec.MinAvailable = nil
+		pdb.Spec.MaxUnavailable = &none
+	}
+
 	return nil
 }
 
@@ -20,9 +20,12 @@ import (
 
 	"fmt"
 
+	api "github.com/cockroachdb/cockroach-operator/apis/v1alpha1"
+	"github.com/cockroachdb/cockroach-operator/pkg/condition"
 	"github.com/cockroachdb/cockroach-operator/pkg/labels"
 	"github.com/cockroachdb/cockroach-operator/pkg/resource"
 	"github.com/cockroachdb/cockroach-operator/pkg/testutil"
+	"github.com/cockroachdb/cockroach-operator/pkg/utilfeature"
 	"github.com/google/go-cmp/cmp"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
@@ -32,6 +35,9 @@ import (
 )
 
 func TestPDBBuilder(t *testing.T) {
+	utilfeature.DefaultMutableFeatureGate.Set("EvictionPolicy=true")
+	defer utilfeature.DefaultMutableFeatureGate.Set("EvictionPolicy=false")
+
 	var maxUnavailable int32 = 3
 	annotations := map[string]string{"key": "test-pdb"}
 
@@ -41,6 +47,12 @@ func TestPDBBuilder(t *testing.T) {
 	selector := commonLabels.Selector(cluster.Cr().Spec.AdditionalLabels)
 
 	maxUnavailableIS := intstr.FromInt(3)
+	noneIS := intstr.FromInt(0)
+
+	unhealthyCr := cluster.Cr()
+	unhealthyCr.Spec.Eviction = &api.EvictionPolicy{HealthAwareBudget: true}
+	condition.SetFalse(api.EvictionSafeCondition, &unhealthyCr.Status, metav1.Now())
+	unhealthy := resource.NewCluster(unhealthyCr)
 
 	tests := []struct {
 		name     string
@@ -66,6 +78,24 @@ func TestPDBBuilder(t *testing.T) {
 				},
 			},
 		},
+		{
+			name:     "blocks evictions while the cluster is unhealthy",
+			cluster:  &unhealthy,
+			selector: selector,
+			expected: &policy.PodDisruptionBudget{
+				ObjectMeta: metav1.ObjectMeta{
+					Name:        "test-cluster",
+					Labels:      map[string]string{},
+					Annotations: annotations,
+				},
+				Spec: policy.PodDisruptionBudgetSpec{
+					MaxUnavailable: &noneIS,
+					Selector: &metav1.LabelSelector{
+						MatchLabels: selector,
+					},
+				},
+			},
+		},
 	}
 
 	for _, tt := range tests {
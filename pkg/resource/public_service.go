@@ -17,20 +17,42 @@ limitations under the License.
 package resource
 
 import (
-	"errors"
+	"context"
+	"strconv"
+	"strings"
 
+	api "github.com/cockroachdb/cockroach-operator/apis/v1alpha1"
+	"github.com/cockroachdb/cockroach-operator/pkg/labels"
+	"github.com/cockroachdb/errors"
 	corev1 "k8s.io/api/core/v1"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"sigs.k8s.io/controller-runtime/pkg/client"
 )
 
+const (
+	// RegionLabel is the label of the public services of the regions, set
+	// to their region.
+	RegionLabel = "crdb.cockroachlabs.com/region"
+
+	// ExternalDNSHostnameAnnotation and ExternalDNSTTLAnnotation are the
+	// annotations external-dns creates the DNS records of a service from.
+	ExternalDNSHostnameAnnotation = "external-dns.alpha.kubernetes.io/hostname"
+	ExternalDNSTTLAnnotation      = "external-dns.alpha.kubernetes.io/ttl"
+)
+
 type PublicServiceBuilder struct {
 	*Cluster
 
 	Selector map[string]string
+	// Region is set for the public service of the nodes of a region, which
+	// is published under the hostnames of the region.
+	Region string
 }
 
 func (b PublicServiceBuilder) ResourceName() string {
+	if b.Region != "" {
+		return b.RegionPublicServiceName(b.Region)
+	}
 	return b.PublicServiceName()
 }
 
@@ -41,34 +63,126 @@ func (b PublicServiceBuilder) Build(obj client.Object) error {
 	}
 
 	if service.ObjectMeta.Name == "" {
-		service.ObjectMeta.Name = b.PublicServiceName()
+		service.ObjectMeta.Name = b.ResourceName()
 	}
 
 	if service.ObjectMeta.Labels == nil {
 		service.ObjectMeta.Labels = map[string]string{}
 	}
 
-	service.Annotations = b.Spec().AdditionalAnnotations
-
-	if service.Spec.Type != corev1.ServiceTypeClusterIP {
-		service.Spec = corev1.ServiceSpec{
-			Type: corev1.ServiceTypeClusterIP,
-			Ports: []corev1.ServicePort{
-				{Name: "grpc", Port: *b.Cluster.Spec().GRPCPort},
-				{Name: "http", Port: *b.Cluster.Spec().HTTPPort},
-				{Name: "sql", Port: *b.Cluster.Spec().SQLPort},
-			},
+	publicService := b.Spec().PublicService
+	service.Annotations = b.Spec().PropagatedAnnotations(api.PropagateService)
+	// the annotations of the public service, for instance those of the load
+	// balancer, and then those of external-dns override the additional ones
+	if annotations := b.annotations(); len(annotations) > 0 {
+		service.Annotations = map[string]string{}
+		for k, v := range b.Spec().PropagatedAnnotations(api.PropagateService) {
+			service.Annotations[k] = v
 		}
+		for k, v := range annotations {
+			service.Annotations[k] = v
+		}
+	}
+
+	serviceType := publicService.TypeOrDefault()
+	if service.Spec.Type != serviceType {
+		service.Spec = corev1.ServiceSpec{Type: serviceType}
+	}
+	service.Spec.Ports = b.ports(service.Spec.Ports)
+
+	service.Spec.LoadBalancerSourceRanges = nil
+	if serviceType == corev1.ServiceTypeLoadBalancer {
+		service.Spec.LoadBalancerSourceRanges = publicService.LoadBalancerSourceRanges
+	}
+	service.Spec.ExternalTrafficPolicy = publicService.ExternalTrafficPolicyOrDefault()
+	// the health check port of the load balancer is only allocated for the
+	// Local policy
+	if service.Spec.ExternalTrafficPolicy != corev1.ServiceExternalTrafficPolicyTypeLocal {
+		service.Spec.HealthCheckNodePort = 0
 	}
 	service.Spec.Selector = b.Selector
 
 	return nil
 }
 
+// annotations returns the annotations of the public service and those of
+// external-dns.
+func (b PublicServiceBuilder) annotations() map[string]string {
+	publicService := b.Spec().PublicService
+	if publicService == nil {
+		return nil
+	}
+
+	annotations := map[string]string{}
+	for k, v := range publicService.Annotations {
+		annotations[k] = v
+	}
+	if dns := publicService.ExternalDNS; dns != nil {
+		hostnames := dns.Hostnames
+		if b.Region != "" {
+			hostnames = dns.RegionHostnames(b.Region)
+		}
+		if len(hostnames) > 0 {
+			annotations[ExternalDNSHostnameAnnotation] = strings.Join(hostnames, ",")
+		}
+		if dns.TTL != nil {
+			annotations[ExternalDNSTTLAnnotation] = strconv.Itoa(int(*dns.TTL))
+		}
+	}
+	return annotations
+}
+
+// ports returns the ports of the service, keeping the node ports Kubernetes
+// allocated to the ports of a NodePort or LoadBalancer service.
+func (b PublicServiceBuilder) ports(current []corev1.ServicePort) []corev1.ServicePort {
+	nodePorts := map[string]int32{}
+	for _, port := range current {
+		nodePorts[port.Name] = port.NodePort
+	}
+
+	ports := []corev1.ServicePort{
+		{Name: b.Cluster.Spec().PortNames.GRPCOrDefault(), Port: *b.Cluster.Spec().GRPCPort},
+		{Name: b.Cluster.Spec().PortNames.HTTPOrDefault(), Port: *b.Cluster.Spec().HTTPPort},
+		{Name: b.Cluster.Spec().PortNames.SQLOrDefault(), Port: *b.Cluster.Spec().SQLPort},
+	}
+	if b.Spec().PublicService.TypeOrDefault() != corev1.ServiceTypeClusterIP {
+		for i := range ports {
+			ports[i].NodePort = nodePorts[ports[i].Name]
+		}
+	}
+	return ports
+}
+
 func (b PublicServiceBuilder) Placeholder() client.Object {
 	return &corev1.Service{
 		ObjectMeta: metav1.ObjectMeta{
-			Name: b.PublicServiceName(),
+			Name: b.ResourceName(),
 		},
 	}
 }
+
+// RegionLabels returns the labels with the label of the region added.
+func RegionLabels(ll labels.Labels, region string) labels.Labels {
+	regionLabels := ll.Copy()
+	regionLabels[RegionLabel] = region
+	return regionLabels
+}
+
+// RegionPublicServices lists the public services of the regions of the
+// cluster, including those of the regions removed from the spec.
+func RegionPublicServices(ctx context.Context, cl client.Client, cluster *Cluster) ([]corev1.Service, error) {
+	list := &corev1.ServiceList{}
+	selector := labels.Common(cluster.Unwrap()).Selector(cluster.Spec().PropagatedLabels(api.PropagateService))
+	if err := cl.List(ctx, list, client.InNamespace(cluster.Namespace()), client.MatchingLabels(selector)); err != nil {
+		return nil, errors.Wrap(err, "failed to list the public services of the regions")
+	}
+
+	owner := cluster.Unwrap()
+	var services []corev1.Service
+	for _, service := range list.Items {
+		if service.Labels[RegionLabel] != "" && metav1.IsControlledBy(&service, owner) {
+			services = append(services, service)
+		}
+	}
+	return services, nil
+}
@@ -20,7 +20,9 @@ import (
 	"fmt"
 	"testing"
 
+	api "github.com/cockroachdb/cockroach-operator/apis/v1alpha1"
 	"github.com/cockroachdb/cockroach-operator/pkg/labels"
+	"github.com/cockroachdb/cockroach-operator/pkg/ptr"
 	"github.com/cockroachdb/cockroach-operator/pkg/resource"
 	"github.com/cockroachdb/cockroach-operator/pkg/testutil"
 	"github.com/google/go-cmp/cmp"
@@ -35,10 +37,33 @@ func TestPublicServiceBuilder(t *testing.T) {
 	cluster := testutil.NewBuilder("test-cluster").Namespaced("test-ns").WithAnnotations(annotations)
 	commonLabels := labels.Common(cluster.Cr())
 
+	lb := testutil.NewBuilder("test-cluster").Namespaced("test-ns").WithAnnotations(annotations).Cr()
+	lb.Spec.PublicService = &api.PublicService{
+		Type:                     corev1.ServiceTypeLoadBalancer,
+		Annotations:              map[string]string{"service.beta.kubernetes.io/aws-load-balancer-internal": "true"},
+		LoadBalancerSourceRanges: []string{"10.0.0.0/8"},
+		ExternalTrafficPolicy:    corev1.ServiceExternalTrafficPolicyTypeLocal,
+	}
+	selector := commonLabels.Selector(cluster.Cr().Spec.AdditionalLabels)
+
+	dns := testutil.NewBuilder("test-cluster").Namespaced("test-ns").Cr()
+	dns.Spec.PublicService = &api.PublicService{
+		ExternalDNS: &api.ExternalDNS{
+			Hostnames: []string{"db.example.com", "sql.example.com"},
+			TTL:       ptr.Int32(60),
+			Regions: []api.RegionHostnames{
+				{Region: "us-east1", Hostnames: []string{"us-east1.db.example.com"}},
+			},
+		},
+	}
+	poolSelector := resource.NodePoolLabels(selector, "east")
+
 	tests := []struct {
 		name     string
 		cluster  *resource.Cluster
 		selector map[string]string
+		region   string
+		current  *corev1.Service
 		expected *corev1.Service
 	}{
 		{
@@ -66,15 +91,136 @@ func TestPublicServiceBuilder(t *testing.T) {
 				},
 			},
 		},
+		{
+			name:     "builds a load balancer and keeps its node ports",
+			cluster:  clusterOf(lb),
+			selector: selector,
+			current: &corev1.Service{
+				Spec: corev1.ServiceSpec{
+					Type: corev1.ServiceTypeLoadBalancer,
+					Ports: []corev1.ServicePort{
+						{Name: "grpc", Port: 26258, NodePort: 30001},
+						{Name: "http", Port: 8080, NodePort: 30002},
+						{Name: "sql", Port: 26257, NodePort: 30003},
+					},
+					HealthCheckNodePort: 30004,
+				},
+			},
+			expected: &corev1.Service{
+				ObjectMeta: metav1.ObjectMeta{
+					Name:   "test-cluster-public",
+					Labels: map[string]string{},
+					Annotations: map[string]string{
+						"key": "test-public-svc",
+						"service.beta.kubernetes.io/aws-load-balancer-internal": "true",
+					},
+				},
+				Spec: corev1.ServiceSpec{
+					Type: corev1.ServiceTypeLoadBalancer,
+					Ports: []corev1.ServicePort{
+						{Name: "grpc", Port: 26258, NodePort: 30001},
+						{Name: "http", Port: 8080, NodePort: 30002},
+						{Name: "sql", Port: 26257, NodePort: 30003},
+					},
+					LoadBalancerSourceRanges: []string{"10.0.0.0/8"},
+					ExternalTrafficPolicy:    corev1.ServiceExternalTrafficPolicyTypeLocal,
+					HealthCheckNodePort:      30004,
+					Selector:                 selector,
+				},
+			},
+		},
+		{
+			name:     "reverts a load balancer to the default type",
+			cluster:  cluster.Cluster(),
+			selector: selector,
+			current: &corev1.Service{
+				Spec: corev1.ServiceSpec{
+					Type:                  corev1.ServiceTypeLoadBalancer,
+					ExternalTrafficPolicy: corev1.ServiceExternalTrafficPolicyTypeCluster,
+					Ports: []corev1.ServicePort{
+						{Name: "sql", Port: 26257, NodePort: 30003},
+					},
+				},
+			},
+			expected: &corev1.Service{
+				ObjectMeta: metav1.ObjectMeta{
+					Name:        "test-cluster-public",
+					Labels:      map[string]string{},
+					Annotations: annotations,
+				},
+				Spec: corev1.ServiceSpec{
+					Type: corev1.ServiceTypeClusterIP,
+					Ports: []corev1.ServicePort{
+						{Name: "grpc", Port: 26258},
+						{Name: "http", Port: 8080},
+						{Name: "sql", Port: 26257},
+					},
+					Selector: selector,
+				},
+			},
+		},
+		{
+			name:     "publishes the public service with external-dns",
+			cluster:  clusterOf(dns),
+			selector: selector,
+			expected: &corev1.Service{
+				ObjectMeta: metav1.ObjectMeta{
+					Name:   "test-cluster-public",
+					Labels: map[string]string{},
+					Annotations: map[string]string{
+						resource.ExternalDNSHostnameAnnotation: "db.example.com,sql.example.com",
+						resource.ExternalDNSTTLAnnotation:      "60",
+					},
+				},
+				Spec: corev1.ServiceSpec{
+					Type: corev1.ServiceTypeClusterIP,
+					Ports: []corev1.ServicePort{
+						{Name: "grpc", Port: 26258},
+						{Name: "http", Port: 8080},
+						{Name: "sql", Port: 26257},
+					},
+					Selector: selector,
+				},
+			},
+		},
+		{
+			name:     "publishes the public service of a region with external-dns",
+			cluster:  clusterOf(dns),
+			selector: poolSelector,
+			region:   "us-east1",
+			expected: &corev1.Service{
+				ObjectMeta: metav1.ObjectMeta{
+					Name:   "test-cluster-public-us-east1",
+					Labels: map[string]string{},
+					Annotations: map[string]string{
+						resource.ExternalDNSHostnameAnnotation: "us-east1.db.example.com",
+						resource.ExternalDNSTTLAnnotation:      "60",
+					},
+				},
+				Spec: corev1.ServiceSpec{
+					Type: corev1.ServiceTypeClusterIP,
+					Ports: []corev1.ServicePort{
+						{Name: "grpc", Port: 26258},
+						{Name: "http", Port: 8080},
+						{Name: "sql", Port: 26257},
+					},
+					Selector: poolSelector,
+				},
+			},
+		},
 	}
 
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
 			actual := &corev1.Service{}
+			if tt.current != nil {
+				actual = tt.current
+			}
 
 			err := resource.PublicServiceBuilder{
 				Cluster:  tt.cluster,
 				Selector: tt.selector,
+				Region:   tt.region,
 			}.Build(actual)
 			require.NoError(t, err)
 
@@ -85,3 +231,8 @@ func TestPublicServiceBuilder(t *testing.T) {
 		})
 	}
 }
+
+func clusterOf(cr *api.CrdbCluster) *resource.Cluster {
+	cluster := resource.NewCluster(cr)
+	return &cluster
+}
@@ -0,0 +1,132 @@
+/*
+Copyright 2021 The Cockroach Authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    https://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package resource
+
+import (
+	"context"
+
+	api "github.com/cockroachdb/cockroach-operator/apis/v1alpha1"
+	"github.com/cockroachdb/cockroach-operator/pkg/labels"
+	"github.com/cockroachdb/errors"
+	appsv1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/controller/controllerutil"
+)
+
+const (
+	// PVCFinalizer holds the deletion of a CrdbCluster with a PVC reclaim
+	// policy until its PVCs are deleted, or marked as retained.
+	PVCFinalizer = "crdb.cockroachlabs.com/pvc-reclaim"
+
+	// RetainedAnnotation marks the PVCs of a deleted CrdbCluster that are kept
+	// on purpose. The sweep of orphaned resources leaves them alone.
+	RetainedAnnotation = "crdb.cockroachlabs.com/retained"
+)
+
+// NeedsPVCFinalizer returns whether the PVC finalizer should be added to cr.
+func NeedsPVCFinalizer(cr *api.CrdbCluster) bool {
+	return cr.Spec.DataStore.ReclaimPolicy != "" && cr.DeletionTimestamp == nil && !controllerutil.ContainsFinalizer(cr, PVCFinalizer)
+}
+
+// ReclaimPVCs applies the reclaim policy of cr, which is being deleted, to its
+// PVCs and returns whether it is done, in which case the PVC finalizer can be
+// removed. With Delete, the statefulsets of the cluster are deleted first and
+// the PVCs once all the pods are gone, so that no running node loses its
+// store. The PVCs are kept if cr is deleted with the orphan propagation
+// policy, like owned resources would be.
+func ReclaimPVCs(ctx context.Context, cl client.Client, cr *api.CrdbCluster) (bool, error) {
+	if controllerutil.ContainsFinalizer(cr, metav1.FinalizerOrphanDependents) {
+		return true, nil
+	}
+
+	selector := client.MatchingLabels(labels.Common(cr).Selector(cr.Spec.PropagatedLabels(api.PropagatePersistentVolumeClaim)))
+	pvcs := &corev1.PersistentVolumeClaimList{}
+	if err := cl.List(ctx, pvcs, client.InNamespace(cr.Namespace), selector); err != nil {
+		return false, errors.Wrap(err, "failed to list pvcs")
+	}
+
+	switch cr.Spec.DataStore.ReclaimPolicy {
+	case api.PVCReclaimRetain:
+		for i := range pvcs.Items {
+			if err := retainPVC(ctx, cl, &pvcs.Items[i]); err != nil {
+				return false, err
+			}
+		}
+		return true, nil
+	case api.PVCReclaimDelete:
+	default:
+		// the policy was removed, the PVCs are left to the orphan policy
+		return true, nil
+	}
+
+	selector = client.MatchingLabels(labels.Common(cr).Selector(cr.Spec.PropagatedLabels(api.PropagateStatefulSet)))
+	statefulSets := &appsv1.StatefulSetList{}
+	if err := cl.List(ctx, statefulSets, client.InNamespace(cr.Namespace), selector); err != nil {
+		return false, errors.Wrap(err, "failed to list statefulsets")
+	}
+	running := false
+	for i := range statefulSets.Items {
+		ss := &statefulSets.Items[i]
+		if !metav1.IsControlledBy(ss, cr) {
+			continue
+		}
+
+		running = true
+		if ss.DeletionTimestamp != nil {
+			continue
+		}
+		if err := cl.Delete(ctx, ss, client.PropagationPolicy(metav1.DeletePropagationBackground)); client.IgnoreNotFound(err) != nil {
+			return false, errors.Wrapf(err, "failed to delete statefulset %s", ss.Name)
+		}
+	}
+
+	pods := &corev1.PodList{}
+	if err := cl.List(ctx, pods, client.InNamespace(cr.Namespace), selector); err != nil {
+		return false, errors.Wrap(err, "failed to list pods")
+	}
+	if running || len(pods.Items) > 0 {
+		return false, nil
+	}
+
+	for i := range pvcs.Items {
+		pvc := &pvcs.Items[i]
+		if pvc.DeletionTimestamp != nil {
+			continue
+		}
+		if err := cl.Delete(ctx, pvc); client.IgnoreNotFound(err) != nil {
+			return false, errors.Wrapf(err, "failed to delete pvc %s", pvc.Name)
+		}
+	}
+
+	return len(pvcs.Items) == 0, nil
+}
+
+// retainPVC marks pvc as kept on purpose.
+func retainPVC(ctx context.Context, cl client.Client, pvc *corev1.PersistentVolumeClaim) error {
+	if pvc.Annotations[RetainedAnnotation] == "true" {
+		return nil
+	}
+
+	patch := client.MergeFrom(pvc.DeepCopy())
+	metav1.SetMetaDataAnnotation(&pvc.ObjectMeta, RetainedAnnotation, "true")
+	if err := cl.Patch(ctx, pvc, patch); client.IgnoreNotFound(err) != nil {
+		return errors.Wrapf(err, "failed to annotate pvc %s", pvc.Name)
+	}
+	return nil
+}
@@ -0,0 +1,119 @@
+/*
+Copyright 2021 The Cockroach Authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    https://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package resource_test
+
+import (
+	"context"
+	"testing"
+
+	api "github.com/cockroachdb/cockroach-operator/apis/v1alpha1"
+	"github.com/cockroachdb/cockroach-operator/pkg/labels"
+	"github.com/cockroachdb/cockroach-operator/pkg/ptr"
+	"github.com/cockroachdb/cockroach-operator/pkg/resource"
+	"github.com/cockroachdb/cockroach-operator/pkg/testutil"
+	"github.com/stretchr/testify/require"
+	appsv1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+)
+
+func TestReclaimPVCs(t *testing.T) {
+	ctx := context.TODO()
+	scheme := testutil.InitScheme(t)
+	owner := testutil.NewBuilder("test-cluster").Namespaced("default").WithUID("test-cluster-uid").Cr()
+	selector := labels.Common(owner).Selector(nil)
+
+	ss := &appsv1.StatefulSet{
+		ObjectMeta: metav1.ObjectMeta{
+			Namespace: "default",
+			Name:      "test-cluster",
+			Labels:    selector,
+			OwnerReferences: []metav1.OwnerReference{{
+				APIVersion: "crdb.cockroachlabs.com/v1alpha1",
+				Kind:       "CrdbCluster",
+				Name:       owner.Name,
+				UID:        owner.UID,
+				Controller: ptr.Bool(true),
+			}},
+		},
+	}
+	pod := &corev1.Pod{ObjectMeta: metav1.ObjectMeta{Namespace: "default", Name: "test-cluster-0", Labels: selector}}
+	pvc := &corev1.PersistentVolumeClaim{ObjectMeta: metav1.ObjectMeta{Namespace: "default", Name: "datadir-test-cluster-0", Labels: selector}}
+	other := &corev1.PersistentVolumeClaim{ObjectMeta: metav1.ObjectMeta{
+		Namespace: "default",
+		Name:      "datadir-other-cluster-0",
+		Labels:    labels.Common(testutil.NewBuilder("other-cluster").Cr()).Selector(nil),
+	}}
+
+	tests := []struct {
+		name       string
+		policy     api.PVCReclaimPolicy
+		finalizers []string
+		deleted    bool
+		retained   bool
+	}{
+		{name: "deletes the pvcs once the pods are gone", policy: api.PVCReclaimDelete, deleted: true},
+		{name: "marks the pvcs as retained", policy: api.PVCReclaimRetain, retained: true},
+		{name: "leaves the pvcs without a policy"},
+		{name: "keeps the pvcs when orphaning", policy: api.PVCReclaimDelete, finalizers: []string{metav1.FinalizerOrphanDependents}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cl := fake.NewFakeClientWithScheme(scheme, ss.DeepCopy(), pod.DeepCopy(), pvc.DeepCopy(), other.DeepCopy())
+
+			cr := owner.DeepCopy()
+			cr.Spec.DataStore.ReclaimPolicy = tt.policy
+			require.Equal(t, tt.policy != "", resource.NeedsPVCFinalizer(cr))
+
+			cr.Finalizers = append(tt.finalizers, resource.PVCFinalizer)
+			now := metav1.Now()
+			cr.DeletionTimestamp = &now
+			require.False(t, resource.NeedsPVCFinalizer(cr))
+
+			done, err := resource.ReclaimPVCs(ctx, cl, cr)
+			require.NoError(t, err)
+			if tt.deleted {
+				// the statefulset is deleted first, and the pvcs are kept
+				// while its pods are running
+				require.False(t, done)
+				require.True(t, apierrors.IsNotFound(cl.Get(ctx, client.ObjectKeyFromObject(ss), &appsv1.StatefulSet{})))
+				require.NoError(t, cl.Get(ctx, client.ObjectKeyFromObject(pvc), &corev1.PersistentVolumeClaim{}))
+
+				require.NoError(t, cl.Delete(ctx, pod.DeepCopy()))
+				for !done {
+					done, err = resource.ReclaimPVCs(ctx, cl, cr)
+					require.NoError(t, err)
+				}
+			}
+			require.True(t, done)
+
+			actual := &corev1.PersistentVolumeClaim{}
+			err = cl.Get(ctx, client.ObjectKeyFromObject(pvc), actual)
+			require.Equal(t, tt.deleted, apierrors.IsNotFound(err))
+			if !tt.deleted {
+				require.Equal(t, tt.retained, actual.Annotations[resource.RetainedAnnotation] == "true")
+			}
+
+			require.NoError(t, cl.Get(ctx, client.ObjectKeyFromObject(other), actual))
+			require.Empty(t, actual.Annotations)
+		})
+	}
+}
@@ -0,0 +1,92 @@
+/*
+Copyright 2021 The Cockroach Authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    https://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package resource
+
+import (
+	"github.com/cockroachdb/errors"
+	corev1 "k8s.io/api/core/v1"
+)
+
+// guaranteedResources are the resources whose requests and limits must be equal
+// for a pod to have the Guaranteed QoS class.
+var guaranteedResources = []corev1.ResourceName{corev1.ResourceCPU, corev1.ResourceMemory}
+
+// ContainerResources returns the resources of the database container. With
+// guaranteed QoS, the cpu and memory requests are made equal to the limits, a
+// missing limit taking the value of the request.
+func (cluster Cluster) ContainerResources() corev1.ResourceRequirements {
+	resources := *cluster.Spec().Resources.DeepCopy()
+	if !cluster.Spec().QoS.IsGuaranteed() {
+		return resources
+	}
+
+	if resources.Limits == nil {
+		resources.Limits = corev1.ResourceList{}
+	}
+	if resources.Requests == nil {
+		resources.Requests = corev1.ResourceList{}
+	}
+
+	for _, name := range guaranteedResources {
+		if limit, ok := resources.Limits[name]; ok {
+			resources.Requests[name] = limit
+		} else if request, ok := resources.Requests[name]; ok {
+			resources.Limits[name] = request
+		}
+	}
+
+	return resources
+}
+
+// ValidateQoS returns an error when the pods cannot have the QoS class asked
+// for in the spec.
+func (cluster Cluster) ValidateQoS() error {
+	if !cluster.Spec().QoS.IsGuaranteed() {
+		return nil
+	}
+
+	resources := cluster.ContainerResources()
+	for _, name := range guaranteedResources {
+		if _, ok := resources.Limits[name]; !ok {
+			return errors.Newf("guaranteed QoS needs a %s request or limit in the resources", name)
+		}
+	}
+
+	return nil
+}
+
+// applyQoS sets the runtime class and the overhead of the pod. With guaranteed
+// QoS, the init containers get the resources of the database container, since
+// every container of the pod must have equal requests and limits.
+func (cluster Cluster) applyQoS(spec *corev1.PodSpec) {
+	qos := cluster.Spec().QoS
+	if qos == nil {
+		return
+	}
+
+	spec.RuntimeClassName = qos.RuntimeClassName
+	spec.Overhead = qos.Overhead
+
+	if !qos.IsGuaranteed() {
+		return
+	}
+
+	resources := cluster.ContainerResources()
+	for i := range spec.InitContainers {
+		spec.InitContainers[i].Resources = *resources.DeepCopy()
+	}
+}
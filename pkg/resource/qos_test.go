@@ -0,0 +1,94 @@
+/*
+Copyright 2021 The Cockroach Authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    https://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package resource_test
+
+import (
+	"testing"
+
+	api "github.com/cockroachdb/cockroach-operator/apis/v1alpha1"
+	"github.com/cockroachdb/cockroach-operator/pkg/labels"
+	"github.com/cockroachdb/cockroach-operator/pkg/resource"
+	"github.com/cockroachdb/cockroach-operator/pkg/testutil"
+	"github.com/stretchr/testify/require"
+	appsv1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+	apiresource "k8s.io/apimachinery/pkg/api/resource"
+)
+
+func TestGuaranteedQoS(t *testing.T) {
+	kata := "kata"
+	overhead := corev1.ResourceList{corev1.ResourceMemory: apiresource.MustParse("120Mi")}
+	cr := testutil.NewBuilder("crdb").Namespaced("default").WithPVDataStore("1Gi", "standard").WithTLS().
+		WithResources(corev1.ResourceRequirements{
+			Requests: corev1.ResourceList{
+				corev1.ResourceCPU:    apiresource.MustParse("1"),
+				corev1.ResourceMemory: apiresource.MustParse("4Gi"),
+			},
+			Limits: corev1.ResourceList{
+				corev1.ResourceCPU: apiresource.MustParse("2"),
+			},
+		}).Cr()
+	cr.Spec.QoS = &api.QoSSettings{Guaranteed: true, RuntimeClassName: &kata, Overhead: overhead}
+	cluster := resource.NewCluster(cr)
+
+	// the limit wins over the request, a missing limit takes the request
+	expected := corev1.ResourceRequirements{
+		Requests: corev1.ResourceList{
+			corev1.ResourceCPU:    apiresource.MustParse("2"),
+			corev1.ResourceMemory: apiresource.MustParse("4Gi"),
+		},
+		Limits: corev1.ResourceList{
+			corev1.ResourceCPU:    apiresource.MustParse("2"),
+			corev1.ResourceMemory: apiresource.MustParse("4Gi"),
+		},
+	}
+	require.Equal(t, expected, cluster.ContainerResources())
+
+	ss := &appsv1.StatefulSet{}
+	err := resource.StatefulSetBuilder{
+		Cluster:  &cluster,
+		Selector: labels.Common(cr).Selector(nil),
+	}.Build(ss)
+	require.NoError(t, err)
+
+	spec := ss.Spec.Template.Spec
+	require.Equal(t, &kata, spec.RuntimeClassName)
+	require.Equal(t, overhead, spec.Overhead)
+	require.Equal(t, expected, spec.Containers[0].Resources)
+	require.NotEmpty(t, spec.InitContainers)
+	for _, c := range spec.InitContainers {
+		require.Equal(t, expected, c.Resources)
+	}
+}
+
+func TestGuaranteedQoSNeedsCPUAndMemory(t *testing.T) {
+	cr := testutil.NewBuilder("crdb").Namespaced("default").WithPVDataStore("1Gi", "standard").
+		WithResources(corev1.ResourceRequirements{
+			Limits: corev1.ResourceList{corev1.ResourceCPU: apiresource.MustParse("2")},
+		}).Cr()
+	cr.Spec.QoS = &api.QoSSettings{Guaranteed: true}
+	cluster := resource.NewCluster(cr)
+
+	err := resource.StatefulSetBuilder{Cluster: &cluster}.Build(&appsv1.StatefulSet{})
+	require.EqualError(t, err, "guaranteed QoS needs a memory request or limit in the resources")
+
+	// without guaranteed QoS the resources are left as they are
+	cr.Spec.QoS = nil
+	cluster = resource.NewCluster(cr)
+	require.NoError(t, cluster.ValidateQoS())
+	require.Equal(t, cr.Spec.Resources, cluster.ContainerResources())
+}
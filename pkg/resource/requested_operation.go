@@ -0,0 +1,135 @@
+/*
+Copyright 2021 The Cockroach Authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    https://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package resource
+
+import (
+	"strings"
+
+	api "github.com/cockroachdb/cockroach-operator/apis/v1alpha1"
+	"github.com/cockroachdb/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// CrdbOperationAnnotation requests an operation of the cluster. Its value is
+// <id>:<type>, or <id>:<type>:<argument>, for instance
+// 2021-06-01-restart:RollingRestart or ticket-42:ReplaceNode:2. Each ID is
+// run once, the progress of the operation is reported in the status.
+const CrdbOperationAnnotation = "crdb.io/operation"
+
+// requestedOperationsHistory is the number of requested operations kept in
+// the status.
+const requestedOperationsHistory = 10
+
+// ParseOperation parses the value of the operation annotation. The ID is
+// returned along with the error when only the rest of the value is invalid.
+func ParseOperation(value string) (api.RequestedOperation, error) {
+	parts := strings.SplitN(value, ":", 3)
+	op := api.RequestedOperation{ID: strings.TrimSpace(parts[0])}
+	if op.ID == "" || len(parts) < 2 {
+		return op, errors.Newf("invalid operation %q, the format is <id>:<type>[:<argument>]", value)
+	}
+
+	op.Type = api.OperationType(strings.TrimSpace(parts[1]))
+	if len(parts) == 3 {
+		op.Argument = strings.TrimSpace(parts[2])
+	}
+
+	switch op.Type {
+	case api.OperationReplaceNode, api.OperationDecommissionNode:
+		if op.Argument == "" {
+			return op, errors.Newf("%s needs the ordinal of the pod, as in <id>:%s:<ordinal>", op.Type, op.Type)
+		}
+	case api.OperationRollingRestart, api.OperationBackup, api.OperationRotateCerts, api.OperationRotateCA:
+		if op.Argument != "" {
+			return op, errors.Newf("%s takes no argument", op.Type)
+		}
+	default:
+		return op, errors.Newf("unknown operation type %q, expected one of %v", op.Type, api.OperationTypes)
+	}
+	return op, nil
+}
+
+// GetAnnotationOperation returns the value of the operation annotation.
+func (cluster Cluster) GetAnnotationOperation() string {
+	return cluster.getAnnotation(CrdbOperationAnnotation)
+}
+
+// RequestedOperation returns the operation of the status with the ID, nil if
+// there is none.
+func (cluster Cluster) RequestedOperation(id string) *api.RequestedOperation {
+	for i := range cluster.cr.Status.RequestedOperations {
+		if cluster.cr.Status.RequestedOperations[i].ID == id {
+			return &cluster.cr.Status.RequestedOperations[i]
+		}
+	}
+	return nil
+}
+
+// RunningOperation returns the requested operation that is running, nil if
+// there is none. The operations run one at a time.
+func (cluster Cluster) RunningOperation() *api.RequestedOperation {
+	for i := range cluster.cr.Status.RequestedOperations {
+		if !cluster.cr.Status.RequestedOperations[i].Done() {
+			return &cluster.cr.Status.RequestedOperations[i]
+		}
+	}
+	return nil
+}
+
+// SetRequestedOperation records the progress of a requested operation, and
+// forgets the oldest operations that are over beyond the history. The start
+// time is set when the operation is first recorded, and the transition time
+// only changes with the state.
+func (cluster Cluster) SetRequestedOperation(op api.RequestedOperation, now metav1.Time) {
+	op.StartedAt = now
+	op.LastTransitionTime = now
+	if previous := cluster.RequestedOperation(op.ID); previous != nil {
+		op.StartedAt = previous.StartedAt
+		if previous.State == op.State {
+			op.LastTransitionTime = previous.LastTransitionTime
+		}
+		*previous = op
+		return
+	}
+
+	operations := append(cluster.cr.Status.RequestedOperations, op)
+	for len(operations) > requestedOperationsHistory && operations[0].Done() {
+		operations = operations[1:]
+	}
+	cluster.cr.Status.RequestedOperations = operations
+}
+
+// SetCARotationStatus records the phase of the rotation of the CA, or clears it
+// when the status is nil. The start time is kept while the rotation goes on,
+// and the transition time only changes with the phase.
+func (cluster Cluster) SetCARotationStatus(status *api.CARotationStatus, now metav1.Time) {
+	if status == nil {
+		cluster.cr.Status.CARotation = nil
+		return
+	}
+
+	rotation := *status
+	rotation.StartedAt = now
+	rotation.LastTransitionTime = now
+	if previous := cluster.cr.Status.CARotation; previous != nil {
+		rotation.StartedAt = previous.StartedAt
+		if previous.Phase == rotation.Phase {
+			rotation.LastTransitionTime = previous.LastTransitionTime
+		}
+	}
+	cluster.cr.Status.CARotation = &rotation
+}
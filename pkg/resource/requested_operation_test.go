@@ -0,0 +1,114 @@
+/*
+Copyright 2021 The Cockroach Authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    https://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package resource_test
+
+import (
+	"fmt"
+	"testing"
+	"time"
+
+	api "github.com/cockroachdb/cockroach-operator/apis/v1alpha1"
+	"github.com/cockroachdb/cockroach-operator/pkg/resource"
+	"github.com/cockroachdb/cockroach-operator/pkg/testutil"
+	"github.com/stretchr/testify/require"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+func TestParseOperation(t *testing.T) {
+	tests := []struct {
+		value string
+		op    api.RequestedOperation
+		err   string
+	}{
+		{value: "r1:RollingRestart", op: api.RequestedOperation{ID: "r1", Type: api.OperationRollingRestart}},
+		{value: " b1 : Backup", op: api.RequestedOperation{ID: "b1", Type: api.OperationBackup}},
+		{value: "ticket-42:ReplaceNode:2", op: api.RequestedOperation{ID: "ticket-42", Type: api.OperationReplaceNode, Argument: "2"}},
+		{value: "RollingRestart", op: api.RequestedOperation{ID: "RollingRestart"}, err: "the format is <id>:<type>[:<argument>]"},
+		{value: ":Backup", err: "the format is <id>:<type>[:<argument>]"},
+		{value: "n1:ReplaceNode", op: api.RequestedOperation{ID: "n1", Type: api.OperationReplaceNode}, err: "needs the ordinal of the pod"},
+		{value: "d1:DecommissionNode:1", op: api.RequestedOperation{ID: "d1", Type: api.OperationDecommissionNode, Argument: "1"}},
+		{value: "d1:DecommissionNode", op: api.RequestedOperation{ID: "d1", Type: api.OperationDecommissionNode}, err: "DecommissionNode needs the ordinal of the pod"},
+		{value: "c1:RotateCerts:now", op: api.RequestedOperation{ID: "c1", Type: api.OperationRotateCerts, Argument: "now"}, err: "RotateCerts takes no argument"},
+		{value: "ca1:RotateCA", op: api.RequestedOperation{ID: "ca1", Type: api.OperationRotateCA}},
+		{value: "x1:Upgrade", op: api.RequestedOperation{ID: "x1", Type: "Upgrade"}, err: `unknown operation type "Upgrade"`},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.value, func(t *testing.T) {
+			op, err := resource.ParseOperation(tt.value)
+			if tt.err != "" {
+				require.Error(t, err)
+				require.Contains(t, err.Error(), tt.err)
+			} else {
+				require.NoError(t, err)
+			}
+			require.Equal(t, tt.op, op)
+		})
+	}
+}
+
+func TestSetRequestedOperation(t *testing.T) {
+	cluster := resource.NewCluster(testutil.NewBuilder("crdb").Namespaced("default").Cr())
+	start := metav1.NewTime(time.Date(2021, 6, 1, 12, 0, 0, 0, time.UTC))
+	later := metav1.NewTime(start.Add(time.Minute))
+
+	cluster.SetRequestedOperation(api.RequestedOperation{ID: "b1", Type: api.OperationBackup, State: api.OperationRunning}, start)
+	require.Equal(t, "b1", cluster.RunningOperation().ID)
+
+	cluster.SetRequestedOperation(api.RequestedOperation{ID: "b1", Type: api.OperationBackup, State: api.OperationRunning, JobID: 7}, later)
+	op := cluster.RequestedOperation("b1")
+	require.Equal(t, int64(7), op.JobID)
+	require.Equal(t, start, op.LastTransitionTime)
+
+	cluster.SetRequestedOperation(api.RequestedOperation{ID: "b1", Type: api.OperationBackup, State: api.OperationSucceeded}, later)
+	op = cluster.RequestedOperation("b1")
+	require.Equal(t, start, op.StartedAt)
+	require.Equal(t, later, op.LastTransitionTime)
+	require.Nil(t, cluster.RunningOperation())
+	require.Nil(t, cluster.RequestedOperation("b2"))
+
+	// the oldest operations that are over are forgotten
+	for i := 0; i < 12; i++ {
+		cluster.SetRequestedOperation(api.RequestedOperation{ID: fmt.Sprintf("r%d", i), State: api.OperationSucceeded}, later)
+	}
+	operations := cluster.Status().RequestedOperations
+	require.Len(t, operations, 10)
+	require.Equal(t, "r2", operations[0].ID)
+	require.Equal(t, "r11", operations[9].ID)
+}
+
+func TestSetCARotationStatus(t *testing.T) {
+	cluster := resource.NewCluster(testutil.NewBuilder("crdb").Namespaced("default").Cr())
+	start := metav1.NewTime(time.Date(2021, 6, 1, 12, 0, 0, 0, time.UTC))
+	later := metav1.NewTime(start.Add(time.Hour))
+
+	cluster.SetCARotationStatus(&api.CARotationStatus{Phase: api.CARotationTrustBundle, OperationID: "ca1"}, start)
+	cluster.SetCARotationStatus(&api.CARotationStatus{Phase: api.CARotationTrustBundle, OperationID: "ca1"}, later)
+	rotation := cluster.Status().CARotation
+	require.Equal(t, start, rotation.StartedAt)
+	require.Equal(t, start, rotation.LastTransitionTime)
+
+	cluster.SetCARotationStatus(&api.CARotationStatus{Phase: api.CARotationReissue, OperationID: "ca2"}, later)
+	rotation = cluster.Status().CARotation
+	require.Equal(t, api.CARotationReissue, rotation.Phase)
+	require.Equal(t, "ca2", rotation.OperationID)
+	require.Equal(t, start, rotation.StartedAt)
+	require.Equal(t, later, rotation.LastTransitionTime)
+
+	cluster.SetCARotationStatus(nil, later)
+	require.Nil(t, cluster.Status().CARotation)
+}
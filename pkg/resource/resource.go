@@ -19,9 +19,12 @@ package resource
 import (
 	"context"
 
+	api "github.com/cockroachdb/cockroach-operator/apis/v1alpha1"
 	"github.com/cockroachdb/cockroach-operator/pkg/kube"
 	"github.com/cockroachdb/cockroach-operator/pkg/labels"
 	"github.com/cockroachdb/errors"
+	appsv1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
 	"k8s.io/apimachinery/pkg/api/meta"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/apimachinery/pkg/runtime"
@@ -65,6 +68,8 @@ func NewManagedKubeResource(ctx context.Context, client client.Client, cluster *
 		Resource: NewKubeResource(ctx, client, cluster.Namespace(), persistFn),
 
 		Labels: labels.Common(cluster.Unwrap()),
+
+		cluster: cluster.Unwrap(),
 	}
 }
 
@@ -73,6 +78,10 @@ type ManagedResource struct {
 	Resource
 
 	labels.Labels
+
+	// cluster selects the additional labels kept off the resources by
+	// metadataPropagation
+	cluster *api.CrdbCluster
 }
 
 // Reconciler reconciles managed Kubernetes resource with `Builder` results
@@ -94,6 +103,9 @@ func (r Reconciler) Reconcile() (upserted bool, err error) {
 	original := current.DeepCopyObject()
 
 	return r.Persist(current, func() error {
+		existing := current.DeepCopyObject().(client.Object)
+		previousManager := PreviousManager(existing, r.Owner)
+
 		if err := r.Build(current); err != nil {
 			return err
 		}
@@ -106,6 +118,12 @@ func (r Reconciler) Reconcile() (upserted bool, err error) {
 			return errors.Wrap(err, "failed to reconcile annotations")
 		}
 
+		if previousManager != "" {
+			if err := r.adopt(existing, current, previousManager); err != nil {
+				return errors.Wrapf(err, "failed to adopt object from %s", previousManager)
+			}
+		}
+
 		if err := r.ensureIsOwned(current); err != nil {
 			return errors.Wrap(err, "failed to set object ownership")
 		}
@@ -120,11 +138,42 @@ func (r Reconciler) reconcileLabels(current, desired runtime.Object) error {
 		return err
 	}
 
-	labels.Update(ll, r.Labels)
+	update := r.Labels
+	if unpropagated := r.unpropagatedLabels(desired); len(unpropagated) > 0 {
+		update = update.Copy()
+		update.Remove(unpropagated)
+		ll.Remove(unpropagated)
+	}
+
+	labels.Update(ll, update)
 
 	return ll.ApplyTo(desired)
 }
 
+// unpropagatedLabels returns the additional labels metadataPropagation keeps
+// off the object. The pods always get them, which select them.
+func (r Reconciler) unpropagatedLabels(obj runtime.Object) labels.Labels {
+	if r.cluster == nil {
+		return nil
+	}
+
+	var kind api.PropagatedResource
+	switch obj.(type) {
+	case *appsv1.StatefulSet:
+		kind = api.PropagateStatefulSet
+	case *corev1.Service:
+		kind = api.PropagateService
+	case *corev1.PersistentVolumeClaim:
+		kind = api.PropagatePersistentVolumeClaim
+	case *corev1.Secret:
+		kind = api.PropagateSecret
+	default:
+		return nil
+	}
+
+	return labels.Unpropagated(r.cluster, kind)
+}
+
 func (r Reconciler) reconcileAnnotations(current, desired runtime.Object) error {
 	caccessor, err := meta.Accessor(current)
 	if err != nil {
@@ -153,6 +202,22 @@ func (r Reconciler) reconcileAnnotations(current, desired runtime.Object) error
 		aa[k] = v
 	}
 
+	daccessor.SetAnnotations(aa)
+
+	return nil
+}
+
+// adopt takes over an object deployed by a previous manager. The object is
+// updated in place, so that the pods of an adopted StatefulSet are not
+// recreated unless the desired pod template differs.
+func (r Reconciler) adopt(existing, desired client.Object, previousManager string) error {
+	if adopter, ok := r.Builder.(Adopter); ok {
+		if err := adopter.Adopt(existing, desired); err != nil {
+			return err
+		}
+	}
+
+	adopt(desired, r.Owner, previousManager)
 	return nil
 }
 
@@ -21,6 +21,7 @@ import (
 	"fmt"
 	"testing"
 
+	api "github.com/cockroachdb/cockroach-operator/apis/v1alpha1"
 	"github.com/cockroachdb/cockroach-operator/pkg/kube"
 	"github.com/cockroachdb/cockroach-operator/pkg/labels"
 	"github.com/cockroachdb/cockroach-operator/pkg/ptr"
@@ -70,6 +71,42 @@ func TestReconcile(t *testing.T) {
 			wantUpserted: false,
 			expected:     makeTestService(),
 		},
+		{
+			name: "adopts object deployed by a helm chart",
+			cluster: testutil.NewBuilder("test-cluster").Namespaced("default").
+				WithUID("test-cluster-uid").Cluster(),
+			existingObjs: []runtime.Object{makeHelmService()},
+			wantUpserted: true,
+			expected: addAnnotations(makeTestService(), map[string]string{
+				resource.CrdbAdoptedFromAnnotation: resource.ManagerHelm,
+				"helm.sh/resource-policy":          "keep",
+			}),
+		},
+		{
+			name: "adopts object owned by a previous instance of the cluster",
+			cluster: testutil.NewBuilder("test-cluster").Namespaced("default").
+				WithUID("test-cluster-uid").Cluster(),
+			existingObjs: []runtime.Object{modifyOwnerUID("previous-uid", makeTestService())},
+			wantUpserted: true,
+			expected: addAnnotations(makeTestService(), map[string]string{
+				resource.CrdbAdoptedFromAnnotation: resource.ManagerPreviousOperator,
+			}),
+		},
+		{
+			name:         "removes the additional labels metadata propagation keeps off the object",
+			cluster:      makeClusterPropagatingTo(api.PropagatePod),
+			existingObjs: []runtime.Object{addLabels(makeTestService(), map[string]string{"team": "storage"})},
+			wantUpserted: true,
+			expected:     addSelector(makeTestService(), map[string]string{"team": "storage"}),
+		},
+		{
+			name:         "keeps the additional labels propagated to the object",
+			cluster:      makeClusterPropagatingTo(api.PropagateService),
+			existingObjs: []runtime.Object{},
+			wantUpserted: true,
+			expected: addSelector(addLabels(makeTestService(), map[string]string{"team": "storage"}),
+				map[string]string{"team": "storage"}),
+		},
 	}
 
 	for _, tt := range tests {
@@ -170,6 +207,62 @@ func modifyHTTPPort(newValue int32, service *corev1.Service) *corev1.Service {
 	return service
 }
 
+func makeHelmService() *corev1.Service {
+	service := makeTestService()
+	service.OwnerReferences = nil
+	service.Labels = map[string]string{
+		"app.kubernetes.io/managed-by": "Helm",
+		"helm.sh/chart":                "cockroachdb-6.0.0",
+		"app.kubernetes.io/name":       "cockroachdb",
+		"app.kubernetes.io/instance":   "test-cluster",
+	}
+	service.Annotations = map[string]string{
+		"meta.helm.sh/release-name":      "test-cluster",
+		"meta.helm.sh/release-namespace": "default",
+	}
+
+	return service
+}
+
+func modifyOwnerUID(uid amtypes.UID, service *corev1.Service) *corev1.Service {
+	service.OwnerReferences[0].UID = uid
+
+	return service
+}
+
+func addAnnotations(service *corev1.Service, aa map[string]string) *corev1.Service {
+	for k, v := range aa {
+		service.Annotations[k] = v
+	}
+
+	return service
+}
+
+func addLabels(service *corev1.Service, ll map[string]string) *corev1.Service {
+	for k, v := range ll {
+		service.Labels[k] = v
+	}
+
+	return service
+}
+
+func addSelector(service *corev1.Service, selector map[string]string) *corev1.Service {
+	for k, v := range selector {
+		service.Spec.Selector[k] = v
+	}
+
+	return service
+}
+
+func makeClusterPropagatingTo(kinds ...api.PropagatedResource) *resource.Cluster {
+	cr := testutil.NewBuilder("test-cluster").Namespaced("default").
+		WithUID("test-cluster-uid").WithLabels(map[string]string{"team": "storage"}).Cr()
+	cr.Spec.MetadataPropagation = &api.MetadataPropagation{Resources: kinds}
+
+	cluster := resource.NewCluster(cr)
+	return &cluster
+}
+
 func stripOutLastAppliedAnnotation(aa map[string]string) {
 	delete(aa, kube.LastAppliedAnnotation)
 }
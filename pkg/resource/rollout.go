@@ -0,0 +1,78 @@
+/*
+Copyright 2021 The Cockroach Authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    https://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package resource
+
+import (
+	"fmt"
+
+	api "github.com/cockroachdb/cockroach-operator/apis/v1alpha1"
+	appsv1 "k8s.io/api/apps/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// SetProgressingCondition sets the Progressing condition from the rollout of
+// the spec to the statefulset of the cluster. An empty statefulset stands for
+// one that is not created yet.
+func (cluster Cluster) SetProgressingCondition(ss *appsv1.StatefulSet) {
+	reason, message := cluster.rollout(ss)
+	if reason == "" {
+		cluster.SetCondition(api.ProgressingCondition, metav1.ConditionFalse, "RolledOut", "")
+		return
+	}
+
+	cluster.SetCondition(api.ProgressingCondition, metav1.ConditionTrue, reason, message)
+}
+
+// SetPausedCondition records that the reconciliation of the cluster is paused.
+// The spec is observed, even though it is not rolled out.
+func (cluster Cluster) SetPausedCondition() {
+	cluster.SetCondition(api.ProgressingCondition, metav1.ConditionFalse, "Paused", "reconciliation is paused by spec.paused")
+	cluster.cr.Status.ObservedGeneration = cluster.cr.Generation
+}
+
+// rollout returns the reason and the message of the rollout in progress, or an
+// empty reason if the statefulset runs the spec on all its pods.
+func (cluster Cluster) rollout(ss *appsv1.StatefulSet) (string, string) {
+	if ss.Generation == 0 {
+		return "Deploying", "the statefulset is not created yet"
+	}
+
+	if !cluster.True(api.InitializedCondition) {
+		return "Initializing", "the cluster is not initialized yet"
+	}
+
+	if ss.Status.ObservedGeneration < ss.Generation {
+		return "RollingOut", "the statefulset controller has not observed the last change"
+	}
+
+	nodes := cluster.Spec().Nodes
+	if ss.Status.Replicas != nodes {
+		return "Scaling", fmt.Sprintf("%d of %d pods", ss.Status.Replicas, nodes)
+	}
+	if ss.Status.UpdatedReplicas < nodes {
+		return "RollingOut", fmt.Sprintf("%d of %d pods are updated", ss.Status.UpdatedReplicas, nodes)
+	}
+	if ss.Status.ReadyReplicas < nodes {
+		return "RollingOut", fmt.Sprintf("%d of %d pods are ready", ss.Status.ReadyReplicas, nodes)
+	}
+
+	if upgrade := cluster.Status().Upgrade; upgrade != nil && upgrade.State == api.UpgradeInProgress {
+		return "Upgrading", fmt.Sprintf("upgrading from %s to %s", upgrade.FromVersion, upgrade.ToVersion)
+	}
+
+	return "", ""
+}
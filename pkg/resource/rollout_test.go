@@ -0,0 +1,132 @@
+/*
+Copyright 2021 The Cockroach Authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    https://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package resource_test
+
+import (
+	"testing"
+
+	api "github.com/cockroachdb/cockroach-operator/apis/v1alpha1"
+	"github.com/cockroachdb/cockroach-operator/pkg/resource"
+	"github.com/cockroachdb/cockroach-operator/pkg/testutil"
+	"github.com/stretchr/testify/require"
+	appsv1 "k8s.io/api/apps/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+func TestSetProgressingCondition(t *testing.T) {
+	rolledOut := func() *appsv1.StatefulSet {
+		return &appsv1.StatefulSet{
+			ObjectMeta: metav1.ObjectMeta{Generation: 2},
+			Status: appsv1.StatefulSetStatus{
+				ObservedGeneration: 2,
+				Replicas:           3,
+				UpdatedReplicas:    3,
+				ReadyReplicas:      3,
+			},
+		}
+	}
+
+	tests := []struct {
+		name    string
+		mutate  func(cluster *resource.Cluster, ss *appsv1.StatefulSet)
+		status  metav1.ConditionStatus
+		reason  string
+		message string
+	}{
+		{
+			name:   "rolled out",
+			mutate: func(cluster *resource.Cluster, ss *appsv1.StatefulSet) {},
+			status: metav1.ConditionFalse,
+			reason: "RolledOut",
+		},
+		{
+			name: "statefulset not created",
+			mutate: func(cluster *resource.Cluster, ss *appsv1.StatefulSet) {
+				*ss = appsv1.StatefulSet{}
+			},
+			status:  metav1.ConditionTrue,
+			reason:  "Deploying",
+			message: "the statefulset is not created yet",
+		},
+		{
+			name: "not initialized",
+			mutate: func(cluster *resource.Cluster, ss *appsv1.StatefulSet) {
+				cluster.SetFalse(api.InitializedCondition)
+			},
+			status:  metav1.ConditionTrue,
+			reason:  "Initializing",
+			message: "the cluster is not initialized yet",
+		},
+		{
+			name: "scaling",
+			mutate: func(cluster *resource.Cluster, ss *appsv1.StatefulSet) {
+				ss.Status.Replicas = 4
+			},
+			status:  metav1.ConditionTrue,
+			reason:  "Scaling",
+			message: "4 of 3 pods",
+		},
+		{
+			name: "pods not updated",
+			mutate: func(cluster *resource.Cluster, ss *appsv1.StatefulSet) {
+				ss.Status.UpdatedReplicas = 1
+			},
+			status:  metav1.ConditionTrue,
+			reason:  "RollingOut",
+			message: "1 of 3 pods are updated",
+		},
+		{
+			name: "pods not ready",
+			mutate: func(cluster *resource.Cluster, ss *appsv1.StatefulSet) {
+				ss.Status.ReadyReplicas = 2
+			},
+			status:  metav1.ConditionTrue,
+			reason:  "RollingOut",
+			message: "2 of 3 pods are ready",
+		},
+		{
+			name: "upgrade in progress",
+			mutate: func(cluster *resource.Cluster, ss *appsv1.StatefulSet) {
+				cluster.SetUpgradeStatus(api.UpgradeStatus{FromVersion: "v20.2.8", ToVersion: "v21.1.1", State: api.UpgradeInProgress}, metav1.Now())
+			},
+			status:  metav1.ConditionTrue,
+			reason:  "Upgrading",
+			message: "upgrading from v20.2.8 to v21.1.1",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cluster := testutil.NewBuilder("crdb").Namespaced("default").WithNodeCount(3).Cluster()
+			cluster.SetTrue(api.InitializedCondition)
+			ss := rolledOut()
+			tt.mutate(cluster, ss)
+
+			cluster.SetProgressingCondition(ss)
+
+			var progressing api.ClusterCondition
+			for _, c := range cluster.Status().Conditions {
+				if c.Type == api.ProgressingCondition {
+					progressing = c
+				}
+			}
+			require.Equal(t, tt.status, progressing.Status)
+			require.Equal(t, tt.reason, progressing.Reason)
+			require.Equal(t, tt.message, progressing.Message)
+		})
+	}
+}
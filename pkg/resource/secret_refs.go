@@ -0,0 +1,87 @@
+/*
+Copyright 2021 The Cockroach Authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    https://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package resource
+
+import (
+	"context"
+
+	"github.com/cockroachdb/errors"
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/types"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+// ReferencedSecrets returns the names of the secrets the spec of the cluster
+// refers to and the operator does not create. They can be created after the
+// cluster, for instance by External Secrets Operator or a Vault injector.
+func (cluster Cluster) ReferencedSecrets() []string {
+	spec := cluster.Spec()
+
+	var names []string
+	if spec.TLSEnabled && spec.NodeTLSSecret != "" {
+		names = append(names, spec.NodeTLSSecret)
+		if spec.ClientTLSSecret != "" {
+			names = append(names, spec.ClientTLSSecret)
+		}
+	}
+	if spec.TLSEnabled && spec.NodeTLSSecret == "" && spec.ExternalCA != nil {
+		names = append(names, spec.ExternalCA.CASecretRef.Name)
+	}
+	if spec.Image.PullSecret != nil && *spec.Image.PullSecret != "" {
+		names = append(names, *spec.Image.PullSecret)
+	}
+	// the backup URI is only read until the clone is over
+	if from := spec.CloneFrom; from != nil && from.BackupURISecretRef != nil && !cluster.Status().Clone.Done() {
+		names = append(names, from.BackupURISecretRef.Name)
+	}
+
+	return names
+}
+
+// MissingSecrets returns the referenced secrets of the cluster that do not
+// exist yet.
+func MissingSecrets(ctx context.Context, cl client.Client, cluster *Cluster) ([]string, error) {
+	var missing []string
+	for _, name := range cluster.ReferencedSecrets() {
+		key := types.NamespacedName{Namespace: cluster.Namespace(), Name: name}
+		if err := cl.Get(ctx, key, &corev1.Secret{}); err != nil {
+			if !apierrors.IsNotFound(err) {
+				return nil, errors.Wrapf(err, "failed to get secret %s", name)
+			}
+			missing = append(missing, name)
+		}
+	}
+
+	return missing, nil
+}
+
+// SecretValue returns the value of the key of a secret selected by ref. It
+// returns false when the secret or the key does not exist yet.
+func SecretValue(ctx context.Context, cl client.Client, namespace string, ref *corev1.SecretKeySelector) (string, bool, error) {
+	secret := &corev1.Secret{}
+	key := types.NamespacedName{Namespace: namespace, Name: ref.Name}
+	if err := cl.Get(ctx, key, secret); err != nil {
+		if apierrors.IsNotFound(err) {
+			return "", false, nil
+		}
+		return "", false, errors.Wrapf(err, "failed to get secret %s", ref.Name)
+	}
+
+	value, ok := secret.Data[ref.Key]
+	return string(value), ok, nil
+}
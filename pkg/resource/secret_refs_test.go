@@ -0,0 +1,131 @@
+/*
+Copyright 2021 The Cockroach Authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    https://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package resource_test
+
+import (
+	"context"
+	"testing"
+
+	api "github.com/cockroachdb/cockroach-operator/apis/v1alpha1"
+	"github.com/cockroachdb/cockroach-operator/pkg/resource"
+	"github.com/cockroachdb/cockroach-operator/pkg/testutil"
+	"github.com/stretchr/testify/require"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+)
+
+func TestReferencedSecrets(t *testing.T) {
+	pullSecret := "registry"
+	uriRef := &corev1.SecretKeySelector{
+		LocalObjectReference: corev1.LocalObjectReference{Name: "backup-uri"},
+		Key:                  "uri",
+	}
+
+	tests := []struct {
+		name     string
+		mutate   func(cr *api.CrdbCluster)
+		expected []string
+	}{
+		{
+			name:   "generated certificates",
+			mutate: func(cr *api.CrdbCluster) {},
+		},
+		{
+			name: "user provided certificates",
+			mutate: func(cr *api.CrdbCluster) {
+				cr.Spec.NodeTLSSecret = "node-certs"
+				cr.Spec.ClientTLSSecret = "client-certs"
+			},
+			expected: []string{"node-certs", "client-certs"},
+		},
+		{
+			name: "certificates signed by an external CA",
+			mutate: func(cr *api.CrdbCluster) {
+				cr.Spec.ExternalCA = &api.ExternalCA{
+					CASecretRef: corev1.SecretKeySelector{
+						LocalObjectReference: corev1.LocalObjectReference{Name: "external-ca"},
+						Key:                  "ca.crt",
+					},
+				}
+			},
+			expected: []string{"external-ca"},
+		},
+		{
+			name: "pull secret and backup URI",
+			mutate: func(cr *api.CrdbCluster) {
+				cr.Spec.Image.PullSecret = &pullSecret
+				cr.Spec.CloneFrom = &api.CloneSource{Cluster: "source", BackupURISecretRef: uriRef}
+			},
+			expected: []string{"registry", "backup-uri"},
+		},
+		{
+			name: "backup URI of a finished clone",
+			mutate: func(cr *api.CrdbCluster) {
+				cr.Spec.CloneFrom = &api.CloneSource{Cluster: "source", BackupURISecretRef: uriRef}
+				cr.Status.Clone = &api.CloneStatus{State: api.CloneSucceeded}
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cr := testutil.NewBuilder("test-cluster").Namespaced("default").WithTLS().Cr()
+			tt.mutate(cr)
+
+			require.Equal(t, tt.expected, resource.NewCluster(cr).ReferencedSecrets())
+		})
+	}
+}
+
+func TestMissingSecrets(t *testing.T) {
+	ctx := context.TODO()
+	scheme := testutil.InitScheme(t)
+
+	cr := testutil.NewBuilder("test-cluster").Namespaced("default").WithTLS().WithNodeTLS("node-certs").Cr()
+	cr.Spec.ClientTLSSecret = "client-certs"
+	cluster := resource.NewCluster(cr)
+
+	cl := fake.NewFakeClientWithScheme(scheme,
+		&corev1.Secret{ObjectMeta: metav1.ObjectMeta{Namespace: "default", Name: "node-certs"}},
+		&corev1.Secret{
+			ObjectMeta: metav1.ObjectMeta{Namespace: "default", Name: "backup-uri"},
+			Data:       map[string][]byte{"uri": []byte("s3://bucket/path?AUTH=specified")},
+		},
+	)
+
+	missing, err := resource.MissingSecrets(ctx, cl, &cluster)
+	require.NoError(t, err)
+	require.Equal(t, []string{"client-certs"}, missing)
+
+	value, ok, err := resource.SecretValue(ctx, cl, "default", &corev1.SecretKeySelector{
+		LocalObjectReference: corev1.LocalObjectReference{Name: "backup-uri"},
+		Key:                  "uri",
+	})
+	require.NoError(t, err)
+	require.True(t, ok)
+	require.Equal(t, "s3://bucket/path?AUTH=specified", value)
+
+	for _, ref := range []corev1.SecretKeySelector{
+		{LocalObjectReference: corev1.LocalObjectReference{Name: "backup-uri"}, Key: "other"},
+		{LocalObjectReference: corev1.LocalObjectReference{Name: "missing"}, Key: "uri"},
+	} {
+		_, ok, err := resource.SecretValue(ctx, cl, "default", &ref)
+		require.NoError(t, err)
+		require.False(t, ok)
+	}
+}
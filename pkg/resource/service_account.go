@@ -0,0 +1,75 @@
+/*
+Copyright 2021 The Cockroach Authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    https://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package resource
+
+import (
+	"errors"
+
+	"github.com/cockroachdb/cockroach-operator/pkg/ptr"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+// DefaultServiceAccountName is the service account of the pods of the clusters
+// without a service account of their own, created with the operator.
+const DefaultServiceAccountName = "cockroach-database-sa"
+
+// ServiceAccountBuilder models the service account of the pods of a cluster,
+// annotated with the cloud identity the nodes use to reach the backup sinks.
+type ServiceAccountBuilder struct {
+	*Cluster
+}
+
+func (b ServiceAccountBuilder) ResourceName() string {
+	return b.ServiceAccountName()
+}
+
+// Build annotates the service account with the additional annotations and
+// the service account annotations of the spec, which take precedence.
+func (b ServiceAccountBuilder) Build(obj client.Object) error {
+	sa, ok := obj.(*corev1.ServiceAccount)
+	if !ok {
+		return errors.New("failed to cast to ServiceAccount object")
+	}
+
+	if sa.ObjectMeta.Name == "" {
+		sa.ObjectMeta.Name = b.ResourceName()
+	}
+
+	annotations := make(map[string]string)
+	for k, v := range b.Spec().AdditionalAnnotations {
+		annotations[k] = v
+	}
+	for k, v := range b.Spec().ServiceAccountAnnotations {
+		annotations[k] = v
+	}
+	sa.Annotations = annotations
+
+	// the pods do not call the Kubernetes API: the identity webhooks project
+	// their own tokens, and GKE answers on the metadata server
+	sa.AutomountServiceAccountToken = ptr.Bool(false)
+	return nil
+}
+
+func (b ServiceAccountBuilder) Placeholder() client.Object {
+	return &corev1.ServiceAccount{
+		ObjectMeta: metav1.ObjectMeta{
+			Name: b.ResourceName(),
+		},
+	}
+}
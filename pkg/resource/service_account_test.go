@@ -0,0 +1,67 @@
+/*
+Copyright 2021 The Cockroach Authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    https://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package resource_test
+
+import (
+	"testing"
+
+	"github.com/cockroachdb/cockroach-operator/pkg/labels"
+	"github.com/cockroachdb/cockroach-operator/pkg/resource"
+	"github.com/cockroachdb/cockroach-operator/pkg/testutil"
+	"github.com/stretchr/testify/require"
+	appsv1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+)
+
+func TestServiceAccountBuilder(t *testing.T) {
+	cr := testutil.NewBuilder("crdb").Namespaced("default").WithPVDataStore("1Gi", "standard").Cr()
+	cr.Spec.AdditionalAnnotations = map[string]string{"team": "db", "eks.amazonaws.com/role-arn": "ignored"}
+	cr.Spec.ServiceAccountAnnotations = map[string]string{"eks.amazonaws.com/role-arn": "arn:aws:iam::123456789012:role/crdb-backups"}
+	cluster := resource.NewCluster(cr)
+	require.Equal(t, "crdb-sa", cluster.ServiceAccountName())
+
+	b := resource.ServiceAccountBuilder{Cluster: &cluster}
+	sa := b.Placeholder().(*corev1.ServiceAccount)
+	require.NoError(t, b.Build(sa))
+	require.Equal(t, "crdb-sa", sa.Name)
+	require.Equal(t, map[string]string{
+		"team":                       "db",
+		"eks.amazonaws.com/role-arn": "arn:aws:iam::123456789012:role/crdb-backups",
+	}, sa.Annotations)
+	require.False(t, *sa.AutomountServiceAccountToken)
+}
+
+func TestStatefulSetServiceAccount(t *testing.T) {
+	for _, annotations := range []map[string]string{nil, {"iam.gke.io/gcp-service-account": "crdb@project.iam.gserviceaccount.com"}} {
+		cr := testutil.NewBuilder("crdb").Namespaced("default").WithPVDataStore("1Gi", "standard").Cr()
+		cr.Spec.ServiceAccountAnnotations = annotations
+		cluster := resource.NewCluster(cr)
+
+		ss := &appsv1.StatefulSet{}
+		err := resource.StatefulSetBuilder{
+			Cluster:  &cluster,
+			Selector: labels.Common(cr).Selector(nil),
+		}.Build(ss)
+		require.NoError(t, err)
+
+		expected := resource.DefaultServiceAccountName
+		if annotations != nil {
+			expected = "crdb-sa"
+		}
+		require.Equal(t, expected, ss.Spec.Template.Spec.ServiceAccountName)
+	}
+}
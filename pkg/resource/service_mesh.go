@@ -0,0 +1,110 @@
+/*
+Copyright 2021 The Cockroach Authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    https://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package resource
+
+import (
+	"fmt"
+	"strings"
+
+	api "github.com/cockroachdb/cockroach-operator/apis/v1alpha1"
+)
+
+const (
+	istioInjectAnnotation               = "sidecar.istio.io/inject"
+	istioRewriteProbesAnnotation        = "sidecar.istio.io/rewriteAppHTTPProbers"
+	istioProxyConfigAnnotation          = "proxy.istio.io/config"
+	istioExcludeInboundPortsAnnotation  = "traffic.sidecar.istio.io/excludeInboundPorts"
+	istioExcludeOutboundPortsAnnotation = "traffic.sidecar.istio.io/excludeOutboundPorts"
+
+	linkerdInjectAnnotation            = "linkerd.io/inject"
+	linkerdProxyAwaitAnnotation        = "config.linkerd.io/proxy-await"
+	linkerdSkipInboundPortsAnnotation  = "config.linkerd.io/skip-inbound-ports"
+	linkerdSkipOutboundPortsAnnotation = "config.linkerd.io/skip-outbound-ports"
+)
+
+// NodePodAnnotations returns the annotations of the pods of the nodes: the
+// additional annotations, and those of the service mesh. The database starts
+// once its proxy runs, and the gRPC connections between the nodes, which
+// CockroachDB encrypts with its own certificates, bypass the proxies.
+func (cluster Cluster) NodePodAnnotations() map[string]string {
+	mesh := cluster.Spec().ServiceMesh
+	if mesh == nil {
+		return cluster.Spec().PropagatedAnnotations(api.PropagatePod)
+	}
+
+	inbound := []int32{*cluster.Spec().GRPCPort}
+	if mesh.ExcludeClientPorts {
+		inbound = append(inbound, *cluster.Spec().SQLPort, *cluster.Spec().HTTPPort)
+	}
+	grpc := joinPorts([]int32{*cluster.Spec().GRPCPort})
+
+	annotations := map[string]string{}
+	switch mesh.Type {
+	case api.ServiceMeshIstio:
+		// the kubelet cannot reach the health endpoint through the proxy with
+		// mutual TLS, the proxy forwards the probes instead
+		annotations[istioRewriteProbesAnnotation] = "true"
+		annotations[istioProxyConfigAnnotation] = `{"holdApplicationUntilProxyStarts": true}`
+		annotations[istioExcludeInboundPortsAnnotation] = joinPorts(inbound)
+		annotations[istioExcludeOutboundPortsAnnotation] = grpc
+	case api.ServiceMeshLinkerd:
+		annotations[linkerdProxyAwaitAnnotation] = "enabled"
+		annotations[linkerdSkipInboundPortsAnnotation] = joinPorts(inbound)
+		annotations[linkerdSkipOutboundPortsAnnotation] = grpc
+	}
+	return mergeAnnotations(cluster.Spec().PropagatedAnnotations(api.PropagatePod), annotations)
+}
+
+// JobPodAnnotations returns the annotations of the pods of the jobs: the
+// additional annotations, and those that keep the service mesh from
+// injecting its proxy, since a job does not complete while its proxy runs.
+func (cluster Cluster) JobPodAnnotations() map[string]string {
+	mesh := cluster.Spec().ServiceMesh
+	if mesh == nil {
+		return cluster.Spec().PropagatedAnnotations(api.PropagatePod)
+	}
+
+	annotations := map[string]string{}
+	switch mesh.Type {
+	case api.ServiceMeshIstio:
+		annotations[istioInjectAnnotation] = "false"
+	case api.ServiceMeshLinkerd:
+		annotations[linkerdInjectAnnotation] = "disabled"
+	}
+	return mergeAnnotations(cluster.Spec().PropagatedAnnotations(api.PropagatePod), annotations)
+}
+
+// mergeAnnotations returns the additional annotations with the others added,
+// which take precedence.
+func mergeAnnotations(additional, others map[string]string) map[string]string {
+	merged := make(map[string]string, len(additional)+len(others))
+	for k, v := range additional {
+		merged[k] = v
+	}
+	for k, v := range others {
+		merged[k] = v
+	}
+	return merged
+}
+
+func joinPorts(ports []int32) string {
+	values := make([]string, len(ports))
+	for i, port := range ports {
+		values[i] = fmt.Sprint(port)
+	}
+	return strings.Join(values, ",")
+}
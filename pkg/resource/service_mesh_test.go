@@ -0,0 +1,103 @@
+/*
+Copyright 2021 The Cockroach Authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    https://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package resource_test
+
+import (
+	"testing"
+
+	api "github.com/cockroachdb/cockroach-operator/apis/v1alpha1"
+	"github.com/cockroachdb/cockroach-operator/pkg/labels"
+	"github.com/cockroachdb/cockroach-operator/pkg/resource"
+	"github.com/cockroachdb/cockroach-operator/pkg/testutil"
+	"github.com/stretchr/testify/require"
+	appsv1 "k8s.io/api/apps/v1"
+	kbatch "k8s.io/api/batch/v1"
+)
+
+func TestServiceMeshAnnotations(t *testing.T) {
+	additional := map[string]string{"team": "db"}
+
+	tests := []struct {
+		name  string
+		mesh  *api.ServiceMesh
+		nodes map[string]string
+		jobs  map[string]string
+	}{
+		{
+			name:  "keeps the additional annotations without a service mesh",
+			nodes: additional,
+			jobs:  additional,
+		},
+		{
+			name: "adapts the pods to Istio",
+			mesh: &api.ServiceMesh{Type: api.ServiceMeshIstio},
+			nodes: map[string]string{
+				"team":                                   "db",
+				"sidecar.istio.io/rewriteAppHTTPProbers": "true",
+				"proxy.istio.io/config":                  `{"holdApplicationUntilProxyStarts": true}`,
+				"traffic.sidecar.istio.io/excludeInboundPorts":  "26258",
+				"traffic.sidecar.istio.io/excludeOutboundPorts": "26258",
+			},
+			jobs: map[string]string{
+				"team":                    "db",
+				"sidecar.istio.io/inject": "false",
+			},
+		},
+		{
+			name: "adapts the pods to Linkerd and excludes the client ports",
+			mesh: &api.ServiceMesh{Type: api.ServiceMeshLinkerd, ExcludeClientPorts: true},
+			nodes: map[string]string{
+				"team":                                  "db",
+				"config.linkerd.io/proxy-await":         "enabled",
+				"config.linkerd.io/skip-inbound-ports":  "26258,26257,8080",
+				"config.linkerd.io/skip-outbound-ports": "26258",
+			},
+			jobs: map[string]string{
+				"team":              "db",
+				"linkerd.io/inject": "disabled",
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cr := testutil.NewBuilder("crdb").Namespaced("default").WithAnnotations(additional).Cr()
+			cr.Spec.ServiceMesh = tt.mesh
+			cluster := clusterOf(cr)
+
+			require.Equal(t, tt.nodes, cluster.NodePodAnnotations())
+			require.Equal(t, tt.jobs, cluster.JobPodAnnotations())
+			// the additional annotations are left alone
+			require.Equal(t, map[string]string{"team": "db"}, cluster.Spec().AdditionalAnnotations)
+		})
+	}
+}
+
+func TestServiceMeshPodTemplates(t *testing.T) {
+	cr := testutil.NewBuilder("crdb").Namespaced("default").WithPVDataStore("1Gi", "standard").WithNodeCount(3).WithTLS().Cr()
+	cr.Spec.ServiceMesh = &api.ServiceMesh{Type: api.ServiceMeshIstio}
+	cluster := clusterOf(cr)
+	selector := labels.Common(cr).Selector(nil)
+
+	ss := &appsv1.StatefulSet{}
+	require.NoError(t, resource.StatefulSetBuilder{Cluster: cluster, Selector: selector}.Build(ss))
+	require.Equal(t, "26258", ss.Spec.Template.Annotations["traffic.sidecar.istio.io/excludeInboundPorts"])
+
+	job := &kbatch.Job{}
+	require.NoError(t, resource.JobBuilder{Cluster: cluster, Selector: selector, JobName: "crdb-vcheck"}.Build(job))
+	require.Equal(t, "false", job.Spec.Template.Annotations["sidecar.istio.io/inject"])
+}
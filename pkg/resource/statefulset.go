@@ -22,6 +22,7 @@ import (
 	"os"
 	"strings"
 
+	api "github.com/cockroachdb/cockroach-operator/apis/v1alpha1"
 	"github.com/cockroachdb/cockroach-operator/pkg/features"
 	"github.com/cockroachdb/cockroach-operator/pkg/labels"
 	"github.com/cockroachdb/cockroach-operator/pkg/ptr"
@@ -35,19 +36,32 @@ import (
 )
 
 const (
-	httpPortName = "http"
-	grpcPortName = "grpc"
-	sqlPortName  = "sql"
-
 	dataDirName      = "datadir"
 	dataDirMountPath = "/cockroach/cockroach-data/"
 
+	backupsDirName      = "backups"
+	backupsDirMountPath = "/cockroach/cockroach-backups/"
+
 	certsDirName = "certs"
 	certCpCmd    = ">- cp -p /cockroach/cockroach-certs-prestage/..data/* /cockroach/cockroach-certs/ && chmod 700 /cockroach/cockroach-certs/*.key && chown 1000581000:1000581000 /cockroach/cockroach-certs/*.key"
 	emptyDirName = "emptydir"
 
+	// CertsDirMountPath is where the nodes read the certificates, which the
+	// init container copies from CertsPrestageMountPath
+	CertsDirMountPath = "/cockroach/cockroach-certs/"
+	// CertsPrestageMountPath is where the secrets of the certificates are
+	// mounted
+	CertsPrestageMountPath = "/cockroach/cockroach-certs-prestage/"
+
 	// DbContainerName is the name of the container definition in the pod spec
 	DbContainerName = "db"
+	// DNSCheckContainerName is the name of the init container checking that the
+	// join addresses resolve
+	DNSCheckContainerName = "dns-check"
+
+	// the join addresses are checked for two minutes
+	dnsCheckAttempts        = 60
+	dnsCheckIntervalSeconds = 2
 )
 
 type StatefulSetBuilder struct {
@@ -55,6 +69,12 @@ type StatefulSetBuilder struct {
 
 	Selector  labels.Labels
 	Telemetry string
+	// Pool is the node pool of the StatefulSet, nil for the default one. The
+	// builders of the node pools are created by NewNodePoolStatefulSetBuilder
+	Pool *api.NodePool
+	// Replicas overrides the number of nodes of the spec while a scale up
+	// adds them a few at a time
+	Replicas *int32
 }
 
 func (b StatefulSetBuilder) Build(obj client.Object) error {
@@ -63,19 +83,28 @@ func (b StatefulSetBuilder) Build(obj client.Object) error {
 		return errors.New("failed to cast to StatefulSet object")
 	}
 	if ss.ObjectMeta.Name == "" {
-		ss.ObjectMeta.Name = b.StatefulSetName()
+		ss.ObjectMeta.Name = b.ResourceName()
 	}
 
-	ss.Annotations = b.Spec().AdditionalAnnotations
+	ss.Annotations = b.Spec().PropagatedAnnotations(api.PropagateStatefulSet)
 
 	if ss.Annotations == nil {
 		ss.Annotations = make(map[string]string)
 	}
 	ss.Annotations[CrdbVersionAnnotation] = b.Cluster.GetVersionAnnotation()
 	ss.Annotations[CrdbContainerImageAnnotation] = b.Cluster.GetAnnotationContainerImage()
+
+	if err := b.ValidateQoS(); err != nil {
+		return err
+	}
+	if err := b.ValidateSysctls(); err != nil {
+		return err
+	}
+
+	current := ss.Spec.Template.Spec
 	ss.Spec = appsv1.StatefulSetSpec{
 		ServiceName: b.Cluster.DiscoveryServiceName(),
-		Replicas:    ptr.Int32(b.Spec().Nodes),
+		Replicas:    ptr.Int32(b.replicas()),
 		UpdateStrategy: appsv1.StatefulSetUpdateStrategy{
 			RollingUpdate: &appsv1.RollingUpdateStatefulSetStrategy{},
 		},
@@ -96,6 +125,19 @@ func (b StatefulSetBuilder) Build(obj client.Object) error {
 		return err
 	}
 
+	// the resources of the pods of an existing statefulset, those of the node
+	// pools included, are changed by the ResizeResources action, one pod at
+	// a time
+	if utilfeature.DefaultMutableFeatureGate.Enabled(features.VerticalResize) {
+		keepContainerResources(DbContainerName, &current, &ss.Spec.Template.Spec)
+	}
+
+	if b.Spec().BackupVolume != nil {
+		if err := b.addBackupVolume(DbContainerName, &ss.Spec.Template.Spec); err != nil {
+			return err
+		}
+	}
+
 	if b.Spec().TLSEnabled {
 		if err := addCertsVolumeMountOnInitContiners(DbContainerName, &ss.Spec.Template.Spec); err != nil {
 			return err
@@ -103,6 +145,13 @@ func (b StatefulSetBuilder) Build(obj client.Object) error {
 		if err := addCertsVolumeMount(DbContainerName, &ss.Spec.Template.Spec); err != nil {
 			return err
 		}
+		// the renewed certificates are copied from the secrets into the running
+		// pods, whose nodes reload them on SIGHUP
+		if b.Spec().CertificateRotation.ReloadOrDefault() == api.CertificateReloadSIGHUP {
+			if err := addCertsPrestageVolumeMount(DbContainerName, &ss.Spec.Template.Spec); err != nil {
+				return err
+			}
+		}
 
 		ss.Spec.Template.Spec.Volumes = append(ss.Spec.Template.Spec.Volumes, corev1.Volume{
 			Name: emptyDirName,
@@ -163,23 +212,123 @@ func (b StatefulSetBuilder) Build(obj client.Object) error {
 				},
 			},
 		})
+
+		// the nodes of a split-CA cluster verify the client certificates with
+		// the client CA, and connect to each other with a client certificate of
+		// user node it signed. The secret is optional, for the pods to start
+		// when splitCA is set on a cluster whose certificates are issued.
+		if b.Spec().SplitCA != nil {
+			certs := &ss.Spec.Template.Spec.Volumes[len(ss.Spec.Template.Spec.Volumes)-1]
+			certs.Projected.Sources = append(certs.Projected.Sources, corev1.VolumeProjection{
+				Secret: &corev1.SecretProjection{
+					LocalObjectReference: corev1.LocalObjectReference{
+						Name: b.Cluster.NodeClientTLSSecretName(),
+					},
+					Items: []corev1.KeyToPath{
+						{
+							Key:  "ca.crt",
+							Path: "ca-client.crt",
+							Mode: ptr.Int32(504),
+						},
+						{
+							Key:  corev1.TLSCertKey,
+							Path: "client.node.crt",
+							Mode: ptr.Int32(504),
+						},
+						{
+							Key:  corev1.TLSPrivateKeyKey,
+							Path: "client.node.key",
+							Mode: ptr.Int32(400),
+						},
+					},
+					Optional: ptr.Bool(true),
+				},
+			})
+		}
+	}
+
+	return nil
+}
+
+// keepContainerResources copies the resources of the container from the
+// current pod spec to the desired one, if the current one has the container.
+func keepContainerResources(container string, current, desired *corev1.PodSpec) {
+	for _, c := range current.Containers {
+		if c.Name != container {
+			continue
+		}
+
+		for i := range desired.Containers {
+			if desired.Containers[i].Name == container {
+				desired.Containers[i].Resources = c.Resources
+			}
+		}
+	}
+}
+
+// Adopt keeps the immutable fields of a StatefulSet deployed by a previous
+// manager, which would otherwise make every update fail. The pod template keeps
+// the labels of the existing selector so that the running pods still match it.
+func (b StatefulSetBuilder) Adopt(existing, desired client.Object) error {
+	current, ok := existing.(*appsv1.StatefulSet)
+	if !ok {
+		return errors.New("failed to cast to StatefulSet object")
+	}
+	ss, ok := desired.(*appsv1.StatefulSet)
+	if !ok {
+		return errors.New("failed to cast to StatefulSet object")
+	}
+
+	for i, claim := range current.Spec.VolumeClaimTemplates {
+		if i >= len(ss.Spec.VolumeClaimTemplates) || ss.Spec.VolumeClaimTemplates[i].Name != claim.Name {
+			return fmt.Errorf("volume claim template %s of StatefulSet %s does not match the data store", claim.Name, current.Name)
+		}
+	}
+
+	ss.Spec.ServiceName = current.Spec.ServiceName
+	ss.Spec.PodManagementPolicy = current.Spec.PodManagementPolicy
+	ss.Spec.VolumeClaimTemplates = current.Spec.VolumeClaimTemplates
+
+	if current.Spec.Selector != nil {
+		// the template labels are shared with the other resources, copy them
+		podLabels := labels.Labels{}
+		podLabels.Merge(ss.Spec.Template.Labels)
+		podLabels.Merge(current.Spec.Selector.MatchLabels)
+
+		ss.Spec.Selector = current.Spec.Selector
+		ss.Spec.Template.Labels = podLabels
 	}
 
 	return nil
 }
 
 func (b StatefulSetBuilder) ResourceName() string {
+	if b.Pool != nil {
+		return b.NodePoolStatefulSetName(b.Pool.Name)
+	}
 	return b.StatefulSetName()
 }
 
 func (b StatefulSetBuilder) Placeholder() client.Object {
 	return &appsv1.StatefulSet{
 		ObjectMeta: metav1.ObjectMeta{
-			Name: b.Name(),
+			Name: b.ResourceName(),
 		},
 	}
 }
 
+// replicas returns the number of nodes of the node pool, or of the cluster
+// for the default StatefulSet.
+func (b StatefulSetBuilder) replicas() int32 {
+	if b.Replicas != nil {
+		return *b.Replicas
+	}
+	if b.Pool != nil {
+		return b.Pool.Nodes
+	}
+	return b.Spec().Nodes
+}
+
 func (b StatefulSetBuilder) SetAnnotations(obj client.Object) error {
 	ss, ok := obj.(*appsv1.StatefulSet)
 	if !ok {
@@ -200,7 +349,7 @@ func (b StatefulSetBuilder) makePodTemplate() corev1.PodTemplateSpec {
 	pod := corev1.PodTemplateSpec{
 		ObjectMeta: metav1.ObjectMeta{
 			Labels:      b.Selector,
-			Annotations: b.Spec().AdditionalAnnotations,
+			Annotations: b.NodePodAnnotations(),
 		},
 		Spec: corev1.PodSpec{
 			SecurityContext: &corev1.PodSecurityContext{
@@ -210,7 +359,8 @@ func (b StatefulSetBuilder) makePodTemplate() corev1.PodTemplateSpec {
 			TerminationGracePeriodSeconds: ptr.Int64(60),
 			Containers:                    b.MakeContainers(),
 			AutomountServiceAccountToken:  ptr.Bool(false),
-			ServiceAccountName:            "cockroach-database-sa",
+			ServiceAccountName:            b.ServiceAccountName(),
+			PriorityClassName:             b.Spec().PriorityClassName,
 		},
 	}
 
@@ -218,13 +368,32 @@ func (b StatefulSetBuilder) makePodTemplate() corev1.PodTemplateSpec {
 		pod.Spec.InitContainers = b.MakeInitContainers()
 	}
 
-	if utilfeature.DefaultMutableFeatureGate.Enabled(features.AffinityRules) {
-		pod.Spec.Affinity = b.Spec().Affinity
+	b.applyDNS(&pod.Spec)
+	b.applyHostNetwork(&pod.Spec)
+	b.applyTopologyLocality(&pod.Spec)
+	if dns := b.Spec().DNS; dns != nil && dns.ValidateJoinAddresses {
+		pod.Spec.InitContainers = append(pod.Spec.InitContainers, b.makeDNSCheckContainer())
 	}
+	b.applySysctls(&pod.Spec)
+	b.applyQoS(&pod.Spec)
+
+	pod.Spec.Affinity = b.PodAffinity()
+	pod.Spec.TopologySpreadConstraints = b.TopologySpreadConstraints()
 
 	if utilfeature.DefaultMutableFeatureGate.Enabled(features.TolerationRules) {
 		pod.Spec.Tolerations = b.Spec().Tolerations
 	}
+	pod.Spec.NodeSelector = b.Spec().NodeSelector
+
+	// the pods of a node pool run on the Kubernetes nodes of the pool
+	if b.Pool != nil {
+		if b.Pool.NodeSelector != nil {
+			pod.Spec.NodeSelector = b.Pool.NodeSelector
+		}
+		if b.Pool.Tolerations != nil {
+			pod.Spec.Tolerations = b.Pool.Tolerations
+		}
+	}
 
 	secret := b.Spec().Image.PullSecret
 	if secret != nil {
@@ -257,6 +426,47 @@ func (b StatefulSetBuilder) MakeInitContainers() []corev1.Container {
 	}
 }
 
+// makeDNSCheckContainer creates the init container that waits until the pod
+// resolves its own address, which the other nodes join, and the address of the
+// public service. A pod whose search domains or DNS cache do not resolve them
+// would otherwise start a node that never joins the cluster.
+func (b StatefulSetBuilder) makeDNSCheckContainer() corev1.Container {
+	hosts := []string{
+		"$POD_NAME." + b.Cluster.ServiceHost(b.Cluster.DiscoveryServiceName()),
+		b.Cluster.ServiceHost(b.Cluster.PublicServiceName()),
+	}
+
+	script := fmt.Sprintf(`for host in %s; do
+  attempt=0
+  until getent hosts "$host" > /dev/null; do
+    attempt=$((attempt + 1))
+    if [ "$attempt" -ge %d ]; then
+      echo "join address $host does not resolve, check the dns settings of the CrdbCluster against /etc/resolv.conf:"
+      cat /etc/resolv.conf
+      exit 1
+    fi
+    sleep %d
+  done
+done`, strings.Join(hosts, " "), dnsCheckAttempts, dnsCheckIntervalSeconds)
+
+	return corev1.Container{
+		Name:            DNSCheckContainerName,
+		Image:           b.GetCockroachDBImageName(),
+		ImagePullPolicy: *b.Spec().Image.PullPolicyName,
+		Command:         []string{"/bin/sh", "-c", script},
+		Env: []corev1.EnvVar{
+			{
+				Name: "POD_NAME",
+				ValueFrom: &corev1.EnvVarSource{
+					FieldRef: &corev1.ObjectFieldSelector{
+						FieldPath: "metadata.name",
+					},
+				},
+			},
+		},
+	}
+}
+
 // MakeContainers creates a slice of corev1.Containers which includes a single
 // corev1.Container that is based on the CR.
 func (b StatefulSetBuilder) MakeContainers() []corev1.Container {
@@ -276,22 +486,22 @@ func (b StatefulSetBuilder) MakeContainers() []corev1.Container {
 					},
 				},
 			},
-			Resources: b.Spec().Resources,
+			Resources: b.ContainerResources(),
 			Command:   b.commandArgs(),
 			Env:       b.envVars(),
 			Ports: []corev1.ContainerPort{
 				{
-					Name:          grpcPortName,
+					Name:          b.Spec().PortNames.GRPCOrDefault(),
 					ContainerPort: *b.Spec().GRPCPort,
 					Protocol:      corev1.ProtocolTCP,
 				},
 				{
-					Name:          httpPortName,
+					Name:          b.Spec().PortNames.HTTPOrDefault(),
 					ContainerPort: *b.Spec().HTTPPort,
 					Protocol:      corev1.ProtocolTCP,
 				},
 				{
-					Name:          sqlPortName,
+					Name:          b.Spec().PortNames.SQLOrDefault(),
 					ContainerPort: *b.Spec().SQLPort,
 					Protocol:      corev1.ProtocolTCP,
 				},
@@ -300,7 +510,7 @@ func (b StatefulSetBuilder) MakeContainers() []corev1.Container {
 				Handler: corev1.Handler{
 					HTTPGet: &corev1.HTTPGetAction{
 						Path:   "/health?ready=1",
-						Port:   intstr.FromString(httpPortName),
+						Port:   intstr.FromString(b.Spec().PortNames.HTTPOrDefault()),
 						Scheme: b.probeScheme(),
 					},
 				},
@@ -342,6 +552,9 @@ func (b StatefulSetBuilder) clientTLSSecretName() string {
 
 func (b StatefulSetBuilder) commandArgs() []string {
 	exec := "exec " + strings.Join(b.dbArgs(), " ")
+	if ulimit := b.ulimitCommand(); ulimit != "" {
+		exec = ulimit + " && " + exec
+	}
 	return []string{"/bin/bash", "-ecx", exec}
 }
 
@@ -350,8 +563,7 @@ func (b StatefulSetBuilder) dbArgs() []string {
 		"/cockroach/cockroach.sh",
 		"start",
 		"--join=" + b.joinStr(),
-		fmt.Sprintf("--advertise-host=$(POD_NAME).%s.%s",
-			b.Cluster.DiscoveryServiceName(), b.Cluster.Namespace()),
+		b.advertiseArg(),
 		"--logtostderr=INFO",
 		b.Cluster.SecureMode(),
 		"--http-port=" + fmt.Sprint(*b.Spec().HTTPPort),
@@ -359,6 +571,14 @@ func (b StatefulSetBuilder) dbArgs() []string {
 		"--listen-addr=:" + fmt.Sprint(*b.Spec().GRPCPort),
 	}
 
+	if network := b.Spec().Network; network != nil && len(network.LocalityAdvertiseAddrs) > 0 {
+		var addrs []string
+		for _, addr := range network.LocalityAdvertiseAddrs {
+			addrs = append(addrs, addr.Locality+"@"+addr.Addr)
+		}
+		aa = append(aa, "--locality-advertise-addr="+strings.Join(addrs, ","))
+	}
+
 	if b.Spec().Cache != "" {
 		aa = append(aa, "--cache="+b.Spec().Cache)
 	} else {
@@ -371,6 +591,19 @@ func (b StatefulSetBuilder) dbArgs() []string {
 		aa = append(aa, "--max-sql-memory $(expr $MEMORY_LIMIT_MIB / 4)MiB")
 	}
 
+	// nodelocal backup URIs point at the shared backup volume
+	if b.Spec().BackupVolume != nil {
+		aa = append(aa, "--external-io-dir="+backupsDirMountPath)
+	}
+
+	// the locality is taken from the Kubernetes node of the pod, otherwise the
+	// nodes of a region of a multi-cluster deployment are at least in its region
+	if b.topologyLocality() {
+		aa = append(aa, localityArg())
+	} else if mc := b.Spec().MultiCluster; mc != nil && !hasArg(b.Spec().AdditionalArgs, "--locality=") {
+		aa = append(aa, "--locality=region="+mc.Region)
+	}
+
 	return append(aa, b.Spec().AdditionalArgs...)
 }
 
@@ -378,12 +611,39 @@ func (b StatefulSetBuilder) joinStr() string {
 	var seeds []string
 
 	for i := 0; i < int(b.Spec().Nodes) && i < 3; i++ {
-		seeds = append(seeds, fmt.Sprintf("%s-%d.%s.%s:%d", b.Cluster.StatefulSetName(), i,
-			b.Cluster.DiscoveryServiceName(), b.Cluster.Namespace(), *b.Cluster.Spec().GRPCPort))
+		seeds = append(seeds, fmt.Sprintf("%s-%d.%s:%d", b.Cluster.StatefulSetName(), i,
+			b.Cluster.ServiceHost(b.Cluster.DiscoveryServiceName()), *b.Cluster.Spec().GRPCPort))
+	}
+
+	if mc := b.Spec().MultiCluster; mc != nil {
+		seeds = append(seeds, mc.RemoteJoinAddrs()...)
+	}
+	if network := b.Spec().Network; network != nil {
+		seeds = append(seeds, network.AdditionalJoinAddrs...)
 	}
 
 	return strings.Join(seeds, ",")
 }
+
+// hasArg returns true when one of the arguments starts with prefix.
+func hasArg(args []string, prefix string) bool {
+	for _, arg := range args {
+		if strings.HasPrefix(arg, prefix) {
+			return true
+		}
+	}
+	return false
+}
+
+// advertiseArg returns the address the node advertises to the other nodes, the
+// address of its pod in the discovery service unless the spec sets another.
+func (b StatefulSetBuilder) advertiseArg() string {
+	if network := b.Spec().Network; network != nil && network.AdvertiseAddr != "" {
+		return "--advertise-addr=" + network.AdvertiseAddr
+	}
+	return "--advertise-host=$(POD_NAME)." + b.Cluster.ServiceHost(b.Cluster.DiscoveryServiceName())
+}
+
 func addCertsVolumeMountOnInitContiners(container string, spec *corev1.PodSpec) error {
 	found := false
 	initContainer := fmt.Sprintf("%s-init", container)
@@ -434,6 +694,57 @@ func addCertsVolumeMount(container string, spec *corev1.PodSpec) error {
 	return nil
 }
 
+// addCertsPrestageVolumeMount mounts the secrets of the certificates in the
+// container, read only.
+func addCertsPrestageVolumeMount(container string, spec *corev1.PodSpec) error {
+	for i := range spec.Containers {
+		c := &spec.Containers[i]
+		if c.Name == container {
+			c.VolumeMounts = append(c.VolumeMounts, corev1.VolumeMount{
+				Name:      certsDirName,
+				MountPath: CertsPrestageMountPath,
+				ReadOnly:  true,
+			})
+			return nil
+		}
+	}
+
+	return fmt.Errorf("failed to find container %s to attach volume", container)
+}
+
+// addBackupVolume mounts the claim of the backup volume, shared by all the
+// pods, in the container.
+func (b StatefulSetBuilder) addBackupVolume(container string, spec *corev1.PodSpec) error {
+	found := false
+	for i := range spec.Containers {
+		c := &spec.Containers[i]
+		if c.Name == container {
+			found = true
+
+			c.VolumeMounts = append(c.VolumeMounts, corev1.VolumeMount{
+				Name:      backupsDirName,
+				MountPath: backupsDirMountPath,
+			})
+			break
+		}
+	}
+
+	if !found {
+		return fmt.Errorf("failed to find container %s to attach volume", container)
+	}
+
+	spec.Volumes = append(spec.Volumes, corev1.Volume{
+		Name: backupsDirName,
+		VolumeSource: corev1.VolumeSource{
+			PersistentVolumeClaim: &corev1.PersistentVolumeClaimVolumeSource{
+				ClaimName: b.BackupVolumeClaimName(),
+			},
+		},
+	})
+
+	return nil
+}
+
 var CRDB_PREFIX string = "CRDB_"
 
 func (b StatefulSetBuilder) envVars() []corev1.EnvVar {
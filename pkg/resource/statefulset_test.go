@@ -22,9 +22,11 @@ import (
 	"fmt"
 	"io/ioutil"
 	"path/filepath"
+	"strings"
 
 	api "github.com/cockroachdb/cockroach-operator/apis/v1alpha1"
 	"github.com/cockroachdb/cockroach-operator/pkg/labels"
+	"github.com/cockroachdb/cockroach-operator/pkg/ptr"
 	"github.com/cockroachdb/cockroach-operator/pkg/resource"
 	"github.com/cockroachdb/cockroach-operator/pkg/testutil"
 	"github.com/cockroachdb/cockroach-operator/pkg/utilfeature"
@@ -32,6 +34,7 @@ import (
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
 	appsv1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
 
 	"testing"
 )
@@ -106,6 +109,268 @@ func TestRHImage(t *testing.T) {
 
 }
 
+func TestStatefulSetDNSSettings(t *testing.T) {
+	ndots := "2"
+	cr := testutil.NewBuilder("crdb").Namespaced("default").WithPVDataStore("1Gi", "standard").WithNodeCount(3).Cr()
+	cr.Spec.DNS = &api.DNSSettings{
+		ClusterDomain: "edge.example",
+		Policy:        corev1.DNSClusterFirst,
+		Config: &corev1.PodDNSConfig{
+			Searches: []string{"default.svc.edge.example"},
+			Options:  []corev1.PodDNSConfigOption{{Name: "ndots", Value: &ndots}},
+		},
+		ValidateJoinAddresses: true,
+	}
+	cluster := resource.NewCluster(cr)
+	require.Equal(t, "svc.edge.example", cluster.Domain())
+	require.Equal(t, "crdb-public.default.svc.edge.example", cluster.ServiceHost(cluster.PublicServiceName()))
+
+	ss := &appsv1.StatefulSet{}
+	err := resource.StatefulSetBuilder{
+		Cluster:  &cluster,
+		Selector: labels.Common(cr).Selector(nil),
+	}.Build(ss)
+	require.NoError(t, err)
+
+	spec := ss.Spec.Template.Spec
+	require.Equal(t, corev1.DNSClusterFirst, spec.DNSPolicy)
+	require.Equal(t, cr.Spec.DNS.Config, spec.DNSConfig)
+
+	command := strings.Join(spec.Containers[0].Command, " ")
+	require.Contains(t, command, "--join=crdb-0.crdb.default.svc.edge.example:26258,crdb-1.crdb.default.svc.edge.example:26258")
+	require.Contains(t, command, "--advertise-host=$(POD_NAME).crdb.default.svc.edge.example ")
+
+	require.Len(t, spec.InitContainers, 1)
+	check := spec.InitContainers[0]
+	require.Equal(t, resource.DNSCheckContainerName, check.Name)
+	require.Contains(t, check.Command[2], "$POD_NAME.crdb.default.svc.edge.example crdb-public.default.svc.edge.example")
+}
+
+func TestStatefulSetPorts(t *testing.T) {
+	cr := testutil.NewBuilder("crdb").Namespaced("default").WithPVDataStore("1Gi", "standard").WithNodeCount(3).Cr()
+	cr.Spec.GRPCPort = ptr.Int32(36258)
+	cr.Spec.HTTPPort = ptr.Int32(443)
+	cr.Spec.SQLPort = ptr.Int32(5432)
+	cr.Spec.PortNames = &api.PortNames{GRPC: "tcp-grpc", HTTP: "https-ui"}
+	cluster := resource.NewCluster(cr)
+	selector := labels.Common(cr).Selector(nil)
+
+	ss := &appsv1.StatefulSet{}
+	require.NoError(t, resource.StatefulSetBuilder{Cluster: &cluster, Selector: selector}.Build(ss))
+
+	container := ss.Spec.Template.Spec.Containers[0]
+	command := strings.Join(container.Command, " ")
+	require.Contains(t, command, "--http-port=443 --sql-addr=:5432 --listen-addr=:36258")
+	require.Contains(t, command, "--join=crdb-0.crdb.default:36258")
+	require.Equal(t, []corev1.ContainerPort{
+		{Name: "tcp-grpc", ContainerPort: 36258, Protocol: corev1.ProtocolTCP},
+		{Name: "https-ui", ContainerPort: 443, Protocol: corev1.ProtocolTCP},
+		{Name: "sql", ContainerPort: 5432, Protocol: corev1.ProtocolTCP},
+	}, container.Ports)
+	require.Equal(t, "https-ui", container.ReadinessProbe.HTTPGet.Port.StrVal)
+
+	expected := []corev1.ServicePort{
+		{Name: "tcp-grpc", Port: 36258},
+		{Name: "https-ui", Port: 443},
+		{Name: "sql", Port: 5432},
+	}
+	discovery := &corev1.Service{}
+	require.NoError(t, resource.DiscoveryServiceBuilder{Cluster: &cluster, Selector: selector}.Build(discovery))
+	require.Equal(t, expected, discovery.Spec.Ports)
+	public := &corev1.Service{}
+	require.NoError(t, resource.PublicServiceBuilder{Cluster: &cluster, Selector: selector}.Build(public))
+	require.Equal(t, expected, public.Spec.Ports)
+}
+
+func TestStatefulSetNetwork(t *testing.T) {
+	cr := testutil.NewBuilder("crdb").Namespaced("default").WithPVDataStore("1Gi", "standard").WithNodeCount(3).Cr()
+	cr.Spec.Network = &api.NetworkSettings{
+		AdvertiseAddr: "$(POD_NAME).east.db.example.com:26258",
+		LocalityAdvertiseAddrs: []api.LocalityAdvertiseAddr{
+			{Locality: "region=us-east1", Addr: "$(POD_NAME).crdb.default:26258"},
+			{Locality: "zone=us-east1-b", Addr: "10.0.0.1"},
+		},
+		AdditionalJoinAddrs: []string{"vm-0.west.db.example.com:26258", "vm-1.west.db.example.com:26258"},
+	}
+	cluster := resource.NewCluster(cr)
+
+	ss := &appsv1.StatefulSet{}
+	err := resource.StatefulSetBuilder{
+		Cluster:  &cluster,
+		Selector: labels.Common(cr).Selector(nil),
+	}.Build(ss)
+	require.NoError(t, err)
+
+	command := strings.Join(ss.Spec.Template.Spec.Containers[0].Command, " ")
+	require.Contains(t, command, "--join=crdb-0.crdb.default:26258,crdb-1.crdb.default:26258,crdb-2.crdb.default:26258,"+
+		"vm-0.west.db.example.com:26258,vm-1.west.db.example.com:26258 ")
+	require.Contains(t, command, "--advertise-addr=$(POD_NAME).east.db.example.com:26258 ")
+	require.NotContains(t, command, "--advertise-host")
+	require.Contains(t, command, "--locality-advertise-addr=region=us-east1@$(POD_NAME).crdb.default:26258,zone=us-east1-b@10.0.0.1 ")
+}
+
+func TestStatefulSetMultiCluster(t *testing.T) {
+	cr := testutil.NewBuilder("crdb-east").Namespaced("default").WithPVDataStore("1Gi", "standard").WithNodeCount(1).Cr()
+	cr.Spec.MultiCluster = &api.MultiCluster{
+		Region: "us-east1",
+		Regions: []api.ClusterRegion{
+			{Name: "us-east1", Cluster: "crdb-east", Nodes: 1, JoinAddrs: []string{"crdb-east-0.east.db.example.com:26258"}},
+			{Name: "us-west1", Cluster: "crdb-west", Nodes: 1, JoinAddrs: []string{"crdb-west-0.west.db.example.com:26258"}},
+		},
+	}
+
+	build := func() string {
+		cluster := resource.NewCluster(cr)
+		ss := &appsv1.StatefulSet{}
+		err := resource.StatefulSetBuilder{
+			Cluster:  &cluster,
+			Selector: labels.Common(cr).Selector(nil),
+		}.Build(ss)
+		require.NoError(t, err)
+		return strings.Join(ss.Spec.Template.Spec.Containers[0].Command, " ")
+	}
+
+	// the nodes join the other regions, and are in the region of the cluster
+	command := build()
+	require.Contains(t, command, "--join=crdb-east-0.crdb-east.default:26258,crdb-west-0.west.db.example.com:26258 ")
+	require.True(t, strings.HasSuffix(command, " --locality=region=us-east1"), command)
+
+	// the locality of the additional arguments is kept
+	cr.Spec.AdditionalArgs = []string{"--locality=region=us-east1,zone=us-east1-b"}
+	command = build()
+	require.True(t, strings.HasSuffix(command, " --locality=region=us-east1,zone=us-east1-b"), command)
+	require.Equal(t, 1, strings.Count(command, "--locality="))
+}
+
+func TestStatefulSetPriorityClassName(t *testing.T) {
+	cr := testutil.NewBuilder("crdb").Namespaced("default").WithPVDataStore("1Gi", "standard").WithNodeCount(3).Cr()
+	selector := labels.Common(cr).Selector(nil)
+
+	for _, name := range []string{"", "cockroachdb"} {
+		cr.Spec.PriorityClassName = name
+		cluster := resource.NewCluster(cr)
+
+		ss := &appsv1.StatefulSet{}
+		require.NoError(t, resource.StatefulSetBuilder{Cluster: &cluster, Selector: selector}.Build(ss))
+		require.Equal(t, name, ss.Spec.Template.Spec.PriorityClassName)
+	}
+}
+
+func TestStatefulSetTopologySpreadConstraints(t *testing.T) {
+	// the constraints apply without the AffinityRules feature gate, like the
+	// node selector
+	utilfeature.DefaultMutableFeatureGate.Set("AffinityRules=false")
+	defer utilfeature.DefaultMutableFeatureGate.Set("AffinityRules=true")
+
+	cr := testutil.NewBuilder("crdb").Namespaced("default").WithPVDataStore("1Gi", "standard").WithNodeCount(3).Cr()
+	cr.Spec.TopologySpreadConstraints = []corev1.TopologySpreadConstraint{
+		{MaxSkew: 1, TopologyKey: "topology.kubernetes.io/zone", WhenUnsatisfiable: corev1.DoNotSchedule},
+	}
+	cluster := resource.NewCluster(cr)
+	selector := labels.Common(cr).Selector(nil)
+
+	ss := &appsv1.StatefulSet{}
+	require.NoError(t, resource.StatefulSetBuilder{Cluster: &cluster, Selector: selector}.Build(ss))
+	require.Equal(t, cluster.TopologySpreadConstraints(), ss.Spec.Template.Spec.TopologySpreadConstraints)
+}
+
+func TestStatefulSetDedicatedNodes(t *testing.T) {
+	dedicated := corev1.Toleration{Key: "dedicated", Operator: corev1.TolerationOpEqual, Value: "cockroachdb", Effect: corev1.TaintEffectNoSchedule}
+	large := corev1.Toleration{Key: "large", Operator: corev1.TolerationOpExists, Effect: corev1.TaintEffectNoSchedule}
+	ssd := map[string]string{"disk": "local-ssd"}
+	n2 := map[string]string{"node.kubernetes.io/instance-type": "n2-standard-8"}
+	cr := testutil.NewBuilder("crdb").Namespaced("default").WithPVDataStore("1Gi", "standard").WithNodeCount(3).
+		WithTolerations([]corev1.Toleration{dedicated}).WithNodeSelector(ssd).Cr()
+	cluster := resource.NewCluster(cr)
+	selector := labels.Common(cr).Selector(nil)
+
+	ss := &appsv1.StatefulSet{}
+	require.NoError(t, resource.StatefulSetBuilder{Cluster: &cluster, Selector: selector}.Build(ss))
+	require.Equal(t, []corev1.Toleration{dedicated}, ss.Spec.Template.Spec.Tolerations)
+	require.Equal(t, ssd, ss.Spec.Template.Spec.NodeSelector)
+
+	// the tolerations and the node selector of a node pool replace those of the
+	// cluster
+	for _, tt := range []struct {
+		pool         api.NodePool
+		tolerations  []corev1.Toleration
+		nodeSelector map[string]string
+	}{
+		{pool: api.NodePool{Name: "small", Nodes: 1}, tolerations: []corev1.Toleration{dedicated}, nodeSelector: ssd},
+		{pool: api.NodePool{Name: "large", Nodes: 1, Tolerations: []corev1.Toleration{large}, NodeSelector: n2},
+			tolerations: []corev1.Toleration{large}, nodeSelector: n2},
+	} {
+		b := resource.NewNodePoolStatefulSetBuilder(&cluster, selector, "kubernetes-operator-gke", tt.pool)
+		ss := b.Placeholder().(*appsv1.StatefulSet)
+		require.NoError(t, b.Build(ss))
+		require.Equal(t, tt.tolerations, ss.Spec.Template.Spec.Tolerations, tt.pool.Name)
+		require.Equal(t, tt.nodeSelector, ss.Spec.Template.Spec.NodeSelector, tt.pool.Name)
+	}
+}
+
+func TestStatefulSetCertsReload(t *testing.T) {
+	for _, reload := range []api.CertificateReload{"", api.CertificateReloadRolling, api.CertificateReloadSIGHUP} {
+		cr := testutil.NewBuilder("crdb").Namespaced("default").WithPVDataStore("1Gi", "standard").WithNodeCount(3).WithTLS().Cr()
+		cr.Spec.CertificateRotation = &api.CertificateRotation{Reload: reload}
+		cluster := resource.NewCluster(cr)
+
+		ss := &appsv1.StatefulSet{}
+		err := resource.StatefulSetBuilder{
+			Cluster:  &cluster,
+			Selector: labels.Common(cr).Selector(nil),
+		}.Build(ss)
+		require.NoError(t, err)
+
+		var mounts []string
+		for _, m := range ss.Spec.Template.Spec.Containers[0].VolumeMounts {
+			mounts = append(mounts, m.MountPath)
+		}
+		require.Contains(t, mounts, resource.CertsDirMountPath)
+		if reload == api.CertificateReloadSIGHUP {
+			require.Contains(t, mounts, resource.CertsPrestageMountPath, "the secrets are mounted for the certificates to be reloaded")
+		} else {
+			require.NotContains(t, mounts, resource.CertsPrestageMountPath)
+		}
+	}
+}
+
+func TestStatefulSetSplitCA(t *testing.T) {
+	for _, split := range []*api.SplitCA{nil, {}} {
+		cr := testutil.NewBuilder("crdb").Namespaced("default").WithPVDataStore("1Gi", "standard").WithNodeCount(3).WithTLS().Cr()
+		cr.Spec.SplitCA = split
+		cluster := resource.NewCluster(cr)
+
+		ss := &appsv1.StatefulSet{}
+		err := resource.StatefulSetBuilder{
+			Cluster:  &cluster,
+			Selector: labels.Common(cr).Selector(nil),
+		}.Build(ss)
+		require.NoError(t, err)
+
+		var paths []string
+		for _, v := range ss.Spec.Template.Spec.Volumes {
+			if v.Projected == nil {
+				continue
+			}
+			for _, source := range v.Projected.Sources {
+				if source.Secret == nil {
+					continue
+				}
+				for _, item := range source.Secret.Items {
+					paths = append(paths, item.Path)
+				}
+			}
+		}
+		require.Contains(t, paths, "client.root.crt")
+		if split != nil {
+			require.Contains(t, paths, "ca-client.crt")
+			require.Contains(t, paths, "client.node.key")
+		} else {
+			require.NotContains(t, paths, "ca-client.crt")
+		}
+	}
+}
+
 func load(t *testing.T, file string) []byte {
 	content, err := ioutil.ReadFile(file)
 	if err != nil {
@@ -0,0 +1,101 @@
+/*
+Copyright 2021 The Cockroach Authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    https://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package resource
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+
+	"github.com/cockroachdb/cockroach-operator/pkg/ptr"
+	"github.com/cockroachdb/errors"
+	corev1 "k8s.io/api/core/v1"
+)
+
+// SysctlsContainerName is the name of the privileged init container setting
+// the sysctls Kubernetes does not consider safe
+const SysctlsContainerName = "sysctls"
+
+// sysctlName is the format of the name of a sysctl, as validated by Kubernetes.
+var sysctlName = regexp.MustCompile(`^([a-z0-9]([-_a-z0-9]*[a-z0-9])?[\./])*[a-z0-9]([-_a-z0-9]*[a-z0-9])?$`)
+
+// safeSysctls are the sysctls Kubernetes allows in the security context of a
+// pod without configuring the kubelet, since they are isolated between pods.
+var safeSysctls = map[string]bool{
+	"kernel.shm_rmid_forced":       true,
+	"net.ipv4.ip_local_port_range": true,
+	"net.ipv4.tcp_syncookies":      true,
+	"net.ipv4.ping_group_range":    true,
+}
+
+// ValidateSysctls returns an error when a sysctl of the spec cannot be set.
+func (cluster Cluster) ValidateSysctls() error {
+	for _, s := range cluster.Spec().Sysctls {
+		if !sysctlName.MatchString(s.Name) {
+			return errors.Newf("invalid sysctl name %q", s.Name)
+		}
+		if s.Value == "" {
+			return errors.Newf("sysctl %s has no value", s.Name)
+		}
+	}
+	return nil
+}
+
+// applySysctls sets the sysctls of the spec for the pod. The safe ones are set
+// in the security context, the others by a privileged init container that
+// writes them to /proc/sys before the other containers start.
+func (b StatefulSetBuilder) applySysctls(spec *corev1.PodSpec) {
+	var writes []string
+	for _, s := range b.Spec().Sysctls {
+		if safeSysctls[s.Name] {
+			spec.SecurityContext.Sysctls = append(spec.SecurityContext.Sysctls, s)
+			continue
+		}
+		path := "/proc/sys/" + strings.ReplaceAll(s.Name, ".", "/")
+		writes = append(writes, fmt.Sprintf("echo %s > %s", shellQuote(s.Value), path))
+	}
+
+	if len(writes) == 0 {
+		return
+	}
+
+	container := corev1.Container{
+		Name:            SysctlsContainerName,
+		Image:           b.GetCockroachDBImageName(),
+		ImagePullPolicy: *b.Spec().Image.PullPolicyName,
+		Command:         []string{"/bin/sh", "-ecx", strings.Join(writes, "\n")},
+		SecurityContext: &corev1.SecurityContext{
+			RunAsUser:  ptr.Int64(0),
+			Privileged: ptr.Bool(true),
+		},
+	}
+	spec.InitContainers = append([]corev1.Container{container}, spec.InitContainers...)
+}
+
+// ulimitCommand returns the command raising the limit on the open files of
+// the database, empty when the spec does not set it.
+func (b StatefulSetBuilder) ulimitCommand() string {
+	if b.Spec().MaxOpenFiles == 0 {
+		return ""
+	}
+	return fmt.Sprintf("ulimit -n %d", b.Spec().MaxOpenFiles)
+}
+
+// shellQuote quotes s for the shell.
+func shellQuote(s string) string {
+	return "'" + strings.ReplaceAll(s, "'", `'\''`) + "'"
+}
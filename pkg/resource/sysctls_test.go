@@ -0,0 +1,89 @@
+/*
+Copyright 2021 The Cockroach Authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    https://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package resource_test
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/cockroachdb/cockroach-operator/pkg/labels"
+	"github.com/cockroachdb/cockroach-operator/pkg/resource"
+	"github.com/cockroachdb/cockroach-operator/pkg/testutil"
+	"github.com/stretchr/testify/require"
+	appsv1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+)
+
+func TestSysctlsAndMaxOpenFiles(t *testing.T) {
+	cr := testutil.NewBuilder("crdb").Namespaced("default").WithPVDataStore("1Gi", "standard").WithTLS().Cr()
+	cr.Spec.Sysctls = []corev1.Sysctl{
+		{Name: "net.ipv4.ip_local_port_range", Value: "1024 65535"},
+		{Name: "net.core.somaxconn", Value: "4096"},
+		{Name: "vm.max_map_count", Value: "262144"},
+	}
+	cr.Spec.MaxOpenFiles = 65536
+	cluster := resource.NewCluster(cr)
+
+	ss := &appsv1.StatefulSet{}
+	err := resource.StatefulSetBuilder{
+		Cluster:  &cluster,
+		Selector: labels.Common(cr).Selector(nil),
+	}.Build(ss)
+	require.NoError(t, err)
+
+	spec := ss.Spec.Template.Spec
+	require.Equal(t, []corev1.Sysctl{{Name: "net.ipv4.ip_local_port_range", Value: "1024 65535"}}, spec.SecurityContext.Sysctls)
+
+	// the unsafe sysctls are set before the other init containers run
+	require.Len(t, spec.InitContainers, 2)
+	sysctls := spec.InitContainers[0]
+	require.Equal(t, resource.SysctlsContainerName, sysctls.Name)
+	require.True(t, *sysctls.SecurityContext.Privileged)
+	require.Equal(t, "echo '4096' > /proc/sys/net/core/somaxconn\necho '262144' > /proc/sys/vm/max_map_count", sysctls.Command[2])
+
+	require.True(t, strings.HasPrefix(spec.Containers[0].Command[2], "ulimit -n 65536 && exec /cockroach/cockroach.sh start"))
+}
+
+func TestSysctlsWithoutUnsafeSysctls(t *testing.T) {
+	cr := testutil.NewBuilder("crdb").Namespaced("default").WithPVDataStore("1Gi", "standard").Cr()
+	cr.Spec.Sysctls = []corev1.Sysctl{{Name: "net.ipv4.tcp_syncookies", Value: "1"}}
+	cluster := resource.NewCluster(cr)
+
+	ss := &appsv1.StatefulSet{}
+	err := resource.StatefulSetBuilder{
+		Cluster:  &cluster,
+		Selector: labels.Common(cr).Selector(nil),
+	}.Build(ss)
+	require.NoError(t, err)
+
+	spec := ss.Spec.Template.Spec
+	require.Empty(t, spec.InitContainers)
+	require.Len(t, spec.SecurityContext.Sysctls, 1)
+	require.True(t, strings.HasPrefix(spec.Containers[0].Command[2], "exec "))
+}
+
+func TestInvalidSysctl(t *testing.T) {
+	cr := testutil.NewBuilder("crdb").Namespaced("default").WithPVDataStore("1Gi", "standard").Cr()
+	cr.Spec.Sysctls = []corev1.Sysctl{{Name: "net/../../etc", Value: "1"}}
+	cluster := resource.NewCluster(cr)
+
+	err := resource.StatefulSetBuilder{
+		Cluster:  &cluster,
+		Selector: labels.Common(cr).Selector(nil),
+	}.Build(&appsv1.StatefulSet{})
+	require.EqualError(t, err, `invalid sysctl name "net/../../etc"`)
+}
@@ -50,6 +50,30 @@ func CreateTLSSecret(name string, r Resource) *TLSSecret {
 	return s
 }
 
+// WithLabels sets labels that are added to the secret whenever it is saved.
+// The labels allow to find the secrets of clusters that no longer exist.
+func (s *TLSSecret) WithLabels(ll map[string]string) *TLSSecret {
+	s.labels = ll
+
+	return s
+}
+
+// WithoutLabels sets labels that are removed from the secret whenever it is
+// saved, unless their values changed.
+func (s *TLSSecret) WithoutLabels(ll map[string]string) *TLSSecret {
+	s.removedLabels = ll
+
+	return s
+}
+
+// WithAnnotations sets annotations that are added to the secret whenever it is
+// saved.
+func (s *TLSSecret) WithAnnotations(aa map[string]string) *TLSSecret {
+	s.annotations = aa
+
+	return s
+}
+
 func LoadTLSSecret(name string, r Resource) (*TLSSecret, error) {
 	s := &TLSSecret{
 		Resource: r,
@@ -74,7 +98,43 @@ func LoadTLSSecret(name string, r Resource) (*TLSSecret, error) {
 type TLSSecret struct {
 	Resource
 
-	secret *corev1.Secret
+	secret        *corev1.Secret
+	labels        map[string]string
+	removedLabels map[string]string
+	annotations   map[string]string
+}
+
+// UpdateMetadata adds the labels and annotations to a secret that was loaded.
+// Secrets that do not exist are not created.
+func (s *TLSSecret) UpdateMetadata() error {
+	if s.secret.ResourceVersion == "" {
+		return nil
+	}
+
+	_, err := s.Persist(s.secret, func() error {
+		s.applyMetadata()
+		return nil
+	})
+
+	return err
+}
+
+func (s *TLSSecret) applyMetadata() {
+	if len(s.labels) > 0 && s.secret.Labels == nil {
+		s.secret.Labels = make(map[string]string, len(s.labels))
+	}
+	for k, v := range s.labels {
+		s.secret.Labels[k] = v
+	}
+	for k, v := range s.removedLabels {
+		if s.secret.Labels[k] == v {
+			delete(s.secret.Labels, k)
+		}
+	}
+
+	for k, v := range s.annotations {
+		metav1.SetMetaDataAnnotation(&s.secret.ObjectMeta, k, v)
+	}
 }
 
 func (s *TLSSecret) ReadyCA() bool {
@@ -108,6 +168,7 @@ func (s *TLSSecret) UpdateKey(key []byte) error {
 	newKey := append([]byte{}, key...)
 
 	_, err := s.Persist(s.secret, func() error {
+		s.applyMetadata()
 		s.secret.Data[corev1.TLSPrivateKeyKey] = newKey
 		return nil
 	})
@@ -119,6 +180,7 @@ func (s *TLSSecret) UpdateCertAndCA(cert, ca []byte, log logr.Logger) error {
 	newCert, newCA := append([]byte{}, cert...), append([]byte{}, ca...)
 
 	_, err := s.Persist(s.secret, func() error {
+		s.applyMetadata()
 		s.secret.Data[corev1.TLSCertKey] = newCert
 		s.secret.Data[caCrtKey] = newCA
 
@@ -135,6 +197,7 @@ func (s *TLSSecret) UpdateCertAndKeyAndCA(cert, key []byte, ca []byte, log logr.
 	newKey := append([]byte{}, key...)
 
 	_, err := s.Persist(s.secret, func() error {
+		s.applyMetadata()
 		s.secret.Data[corev1.TLSCertKey] = newCert
 		s.secret.Data[caCrtKey] = newCA
 		s.secret.Data[corev1.TLSPrivateKeyKey] = newKey
@@ -150,6 +213,7 @@ func (s *TLSSecret) UpdateCAKey(cakey []byte, log logr.Logger) error {
 	newCAKey := append([]byte{}, cakey...)
 
 	_, err := s.Persist(s.secret, func() error {
+		s.applyMetadata()
 		s.secret.Data[caKey] = newCAKey
 		return nil
 	})
@@ -157,6 +221,20 @@ func (s *TLSSecret) UpdateCAKey(cakey []byte, log logr.Logger) error {
 	return err
 }
 
+// UpdateCAKeyAndCA updates the CA key along with the CA certificate
+func (s *TLSSecret) UpdateCAKeyAndCA(cakey, ca []byte, log logr.Logger) error {
+	newCAKey, newCA := append([]byte{}, cakey...), append([]byte{}, ca...)
+
+	_, err := s.Persist(s.secret, func() error {
+		s.applyMetadata()
+		s.secret.Data[caKey] = newCAKey
+		s.secret.Data[caCrtKey] = newCA
+		return nil
+	})
+
+	return err
+}
+
 func (s *TLSSecret) CA() []byte {
 	return s.secret.Data[caCrtKey]
 }
@@ -23,6 +23,7 @@ import (
 	"github.com/cockroachdb/cockroach-operator/pkg/kube"
 	"github.com/cockroachdb/cockroach-operator/pkg/resource"
 	"github.com/cockroachdb/cockroach-operator/pkg/testutil"
+	"github.com/go-logr/logr"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
 	corev1 "k8s.io/api/core/v1"
@@ -94,3 +95,42 @@ func TestTLSSecretReady(t *testing.T) {
 		})
 	}
 }
+
+func TestTLSSecretMetadata(t *testing.T) {
+	ctx := context.TODO()
+	scheme := testutil.InitScheme(t)
+	fakeClient := testutil.NewFakeClient(scheme)
+	r := resource.NewKubeResource(ctx, fakeClient, "test-namespace", kube.DefaultPersister)
+
+	err := resource.CreateTLSSecret("test-ca", r).
+		WithLabels(map[string]string{"team": "db"}).
+		WithAnnotations(map[string]string{"owner": "sre"}).
+		UpdateCAKey([]byte("key"), logr.Discard())
+	require.NoError(t, err)
+
+	secret, err := resource.LoadTLSSecret("test-ca", r)
+	require.NoError(t, err)
+	require.True(t, secret.ReadyCA())
+
+	require.NoError(t, secret.WithLabels(map[string]string{"cost-center": "42"}).UpdateMetadata())
+
+	actual := &corev1.Secret{ObjectMeta: metav1.ObjectMeta{Name: "test-ca"}}
+	require.NoError(t, r.Fetch(actual))
+	assert.Equal(t, map[string]string{"team": "db", "cost-center": "42"}, actual.Labels)
+	assert.Equal(t, map[string]string{"owner": "sre"}, actual.Annotations)
+
+	// only the labels with the same values are removed
+	secret, err = resource.LoadTLSSecret("test-ca", r)
+	require.NoError(t, err)
+	require.NoError(t, secret.WithoutLabels(map[string]string{"team": "db", "cost-center": "7"}).UpdateMetadata())
+
+	require.NoError(t, r.Fetch(actual))
+	assert.Equal(t, map[string]string{"cost-center": "42"}, actual.Labels)
+
+	// secrets that do not exist are not created
+	missing, err := resource.LoadTLSSecret("missing", r)
+	require.True(t, apierrors.IsNotFound(err))
+	require.NoError(t, missing.WithLabels(map[string]string{"team": "db"}).UpdateMetadata())
+	_, err = resource.LoadTLSSecret("missing", r)
+	require.True(t, apierrors.IsNotFound(err))
+}
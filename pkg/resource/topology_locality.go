@@ -0,0 +1,102 @@
+/*
+Copyright 2021 The Cockroach Authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    https://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package resource
+
+import (
+	"fmt"
+
+	"github.com/cockroachdb/cockroach-operator/pkg/features"
+	"github.com/cockroachdb/cockroach-operator/pkg/utilfeature"
+	corev1 "k8s.io/api/core/v1"
+)
+
+const (
+	// LocalityAnnotation is the annotation of a pod holding the locality of
+	// its node, which the operator takes from the labels of the Kubernetes
+	// node the pod is scheduled on
+	LocalityAnnotation = "crdb.cockroachlabs.com/locality"
+	// LocalityWaitContainerName is the name of the init container waiting for
+	// the locality of the pod
+	LocalityWaitContainerName = "locality-wait"
+
+	localityDirName   = "locality"
+	localityMountPath = "/cockroach/locality/"
+	localityFile      = localityMountPath + "locality"
+)
+
+// topologyLocality reports whether the locality of the nodes is taken from
+// their Kubernetes nodes. Without the feature gate the operator does not set
+// the annotation, so the pods must not wait for it.
+func (b StatefulSetBuilder) topologyLocality() bool {
+	return b.Spec().TopologyLocality != nil && utilfeature.DefaultMutableFeatureGate.Enabled(features.TopologyLocality)
+}
+
+// applyTopologyLocality mounts the locality annotation of the pod with the
+// downward API, and adds the init container that waits until the operator sets
+// it. The volume is updated once the pod is annotated, while the environment
+// of a container is not.
+func (b StatefulSetBuilder) applyTopologyLocality(spec *corev1.PodSpec) {
+	if !b.topologyLocality() {
+		return
+	}
+
+	spec.Volumes = append(spec.Volumes, corev1.Volume{
+		Name: localityDirName,
+		VolumeSource: corev1.VolumeSource{
+			DownwardAPI: &corev1.DownwardAPIVolumeSource{
+				Items: []corev1.DownwardAPIVolumeFile{
+					{
+						Path: "locality",
+						FieldRef: &corev1.ObjectFieldSelector{
+							FieldPath: fmt.Sprintf("metadata.annotations['%s']", LocalityAnnotation),
+						},
+					},
+				},
+			},
+		},
+	})
+	mount := corev1.VolumeMount{
+		Name:      localityDirName,
+		MountPath: localityMountPath,
+		ReadOnly:  true,
+	}
+
+	for i := range spec.Containers {
+		if spec.Containers[i].Name == DbContainerName {
+			spec.Containers[i].VolumeMounts = append(spec.Containers[i].VolumeMounts, mount)
+		}
+	}
+
+	script := fmt.Sprintf(`until [ -s %[1]s ]; do
+  echo "waiting for the operator to set the locality of the pod"
+  sleep 2
+done
+cat %[1]s`, localityFile)
+	spec.InitContainers = append(spec.InitContainers, corev1.Container{
+		Name:            LocalityWaitContainerName,
+		Image:           b.GetCockroachDBImageName(),
+		ImagePullPolicy: *b.Spec().Image.PullPolicyName,
+		Command:         []string{"/bin/sh", "-c", script},
+		VolumeMounts:    []corev1.VolumeMount{mount},
+	})
+}
+
+// localityArg returns the `--locality` of the node read from the mounted
+// annotation of its pod.
+func localityArg() string {
+	return fmt.Sprintf("--locality=$(cat %s)", localityFile)
+}
@@ -0,0 +1,83 @@
+/*
+Copyright 2021 The Cockroach Authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    https://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package resource_test
+
+import (
+	"strings"
+	"testing"
+
+	api "github.com/cockroachdb/cockroach-operator/apis/v1alpha1"
+	"github.com/cockroachdb/cockroach-operator/pkg/labels"
+	"github.com/cockroachdb/cockroach-operator/pkg/resource"
+	"github.com/cockroachdb/cockroach-operator/pkg/testutil"
+	"github.com/cockroachdb/cockroach-operator/pkg/utilfeature"
+	"github.com/stretchr/testify/require"
+	appsv1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+)
+
+func TestStatefulSetTopologyLocality(t *testing.T) {
+	build := func(cr *api.CrdbCluster) corev1.PodSpec {
+		cluster := resource.NewCluster(cr)
+		ss := &appsv1.StatefulSet{}
+		err := resource.StatefulSetBuilder{
+			Cluster:  &cluster,
+			Selector: labels.Common(cr).Selector(nil),
+		}.Build(ss)
+		require.NoError(t, err)
+		return ss.Spec.Template.Spec
+	}
+
+	cr := testutil.NewBuilder("crdb").Namespaced("default").WithPVDataStore("1Gi", "standard").WithNodeCount(3).Cr()
+	spec := build(cr)
+	require.NotContains(t, strings.Join(spec.Containers[0].Command, " "), "--locality")
+	for _, c := range spec.InitContainers {
+		require.NotEqual(t, resource.LocalityWaitContainerName, c.Name)
+	}
+
+	// the pods do not wait for an annotation the operator does not set
+	// without the feature gate
+	cr.Spec.TopologyLocality = &api.TopologyLocality{}
+	spec = build(cr)
+	require.NotContains(t, strings.Join(spec.Containers[0].Command, " "), "--locality")
+	for _, c := range spec.InitContainers {
+		require.NotEqual(t, resource.LocalityWaitContainerName, c.Name)
+	}
+
+	utilfeature.DefaultMutableFeatureGate.Set("TopologyLocality=true")
+	defer utilfeature.DefaultMutableFeatureGate.Set("TopologyLocality=false")
+	spec = build(cr)
+	require.Contains(t, strings.Join(spec.Containers[0].Command, " "), "--locality=$(cat /cockroach/locality/locality)")
+
+	// the pod waits for the annotation the operator sets, mounted with the
+	// downward API
+	wait := spec.InitContainers[len(spec.InitContainers)-1]
+	require.Equal(t, resource.LocalityWaitContainerName, wait.Name)
+	require.Contains(t, wait.Command[2], "until [ -s /cockroach/locality/locality ]")
+
+	var volume *corev1.Volume
+	for i := range spec.Volumes {
+		if spec.Volumes[i].DownwardAPI != nil {
+			volume = &spec.Volumes[i]
+		}
+	}
+	require.NotNil(t, volume)
+	require.Equal(t, "metadata.annotations['crdb.cockroachlabs.com/locality']", volume.DownwardAPI.Items[0].FieldRef.FieldPath)
+	for _, c := range []corev1.Container{wait, spec.Containers[0]} {
+		require.Contains(t, c.VolumeMounts, corev1.VolumeMount{Name: volume.Name, MountPath: "/cockroach/locality/", ReadOnly: true}, c.Name)
+	}
+}
@@ -52,6 +52,9 @@ type CockroachNodeDrainer struct {
 	Secure   bool
 	Logger   logr.Logger
 	Executor *CockroachExecutor
+	// ServiceName is the governing service of the statefulset, which the
+	// addresses of the nodes are under
+	ServiceName string
 	// RangeRelocationTimeout is the maximum amount of time to wait
 	// for a range to move. If no ranges have moved from the draining
 	// node in the given durration Decommission will fail with
@@ -60,10 +63,11 @@ type CockroachNodeDrainer struct {
 }
 
 //NewCockroachNodeDrainer ctor
-func NewCockroachNodeDrainer(logger logr.Logger, namespace, ssname string, config *rest.Config, clientset kubernetes.Interface, secure bool, rangeRelocation time.Duration) Drainer {
+func NewCockroachNodeDrainer(logger logr.Logger, namespace, ssname, serviceName string, config *rest.Config, clientset kubernetes.Interface, secure bool, rangeRelocation time.Duration) Drainer {
 	return &CockroachNodeDrainer{
 		Secure:                 secure,
 		Logger:                 logger,
+		ServiceName:            serviceName,
 		RangeRelocationTimeout: rangeRelocation,
 		Executor: &CockroachExecutor{
 			Namespace:   namespace,
@@ -83,7 +87,7 @@ func (d *CockroachNodeDrainer) Decommission(ctx context.Context, replica uint, g
 
 	d.Logger.V(int(zapcore.InfoLevel)).Info("draining node", "NodeID", lastNodeID)
 
-	if err := d.executeDrainCmd(ctx, lastNodeID, gRPCPort); err != nil {
+	if err := d.executeDrainCmd(ctx, 0, lastNodeID, gRPCPort); err != nil {
 		return err
 	}
 
@@ -193,7 +197,14 @@ func (d *CockroachNodeDrainer) makeDrainStatusChecker(id uint) func(ctx context.
 	}
 }
 
-func (d *CockroachNodeDrainer) executeDrainCmd(ctx context.Context, id uint, gRPCPort int32) error {
+// StartDecommission starts the decommission of the node with the ID from the
+// pod of the ordinal, without waiting for its replicas to move to the other
+// nodes. A dead node can be decommissioned from any other pod.
+func (d *CockroachNodeDrainer) StartDecommission(ctx context.Context, podIdx uint, id uint, gRPCPort int32) error {
+	return d.executeDrainCmd(ctx, podIdx, id, gRPCPort)
+}
+
+func (d *CockroachNodeDrainer) executeDrainCmd(ctx context.Context, podIdx uint, id uint, gRPCPort int32) error {
 	cmd := []string{
 		"./cockroach", "node", "decommission", fmt.Sprintf("%d", id), "--wait=none", fmt.Sprintf("--port=%d", gRPCPort),
 	}
@@ -204,7 +215,7 @@ func (d *CockroachNodeDrainer) executeDrainCmd(ctx context.Context, id uint, gRP
 		cmd = append(cmd, "--insecure")
 	}
 
-	if _, _, err := d.Executor.Exec(ctx, 0, cmd); err != nil {
+	if _, _, err := d.Executor.Exec(ctx, podIdx, cmd); err != nil {
 		return errors.Wrapf(err, "failed to start draining node %d", id)
 	}
 
@@ -225,8 +236,11 @@ func (d *CockroachNodeDrainer) findNodeID(ctx context.Context, replica uint, sts
 		return 0, err
 	}
 
+	// the statefulsets of the node pools share the service of the cluster, the
+	// address must start with the host so that the pod db-1 is not mistaken
+	// for the pod db-mydb-1 of a pool
 	host := fmt.Sprintf("%s-%d.%s.%s", stsName,
-		replica, stsName, d.Executor.Namespace)
+		replica, d.ServiceName, d.Executor.Namespace)
 	r := csv.NewReader(strings.NewReader(stdout))
 	for {
 		record, err := r.Read()
@@ -238,7 +252,7 @@ func (d *CockroachNodeDrainer) findNodeID(ctx context.Context, replica uint, sts
 		}
 
 		idStr, address := record[0], record[1]
-		if strings.Contains(address, host) {
+		if strings.HasPrefix(address, host) {
 			id, err := strconv.ParseUint(idStr, 10, 32)
 			if err != nil {
 				return 0, errors.Wrap(err, "failed to extract node id from string")
@@ -20,6 +20,7 @@ import (
 	"context"
 	"fmt"
 	"sort"
+	"strconv"
 	"strings"
 
 	"github.com/cockroachdb/errors"
@@ -152,9 +153,15 @@ func (p *PersistentVolumePruner) pvcsToDelete(ctx context.Context, sts *appsv1.S
 		// Ensure that any PVC we consider deleting matches the expected naming
 		// convention for PVCs managed by a statefulset.
 		// <mount name>-<sts name>-<ordinal>
+		// The PVCs of the statefulsets of the node pools of the cluster,
+		// <mount name>-<sts name>-<pool>-<ordinal>, share the prefix but not
+		// the ordinal.
 		matched := false
 		for _, prefix := range prefixes {
-			if strings.HasPrefix(pvc.Name, prefix) {
+			if !strings.HasPrefix(pvc.Name, prefix) {
+				continue
+			}
+			if _, err := strconv.ParseUint(strings.TrimPrefix(pvc.Name, prefix), 10, 32); err == nil {
 				matched = true
 				break
 			}
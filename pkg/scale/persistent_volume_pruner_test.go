@@ -168,6 +168,32 @@ func TestPersistentVolumePruner_Prune(t *testing.T) {
 				require.True(t, found)
 			},
 		},
+		{
+			Name:     "PVCs of a node pool",
+			Replicas: 5,
+			PVCs:     7,
+			Setup: func(cs *fake.Clientset) {
+				for i := 0; i < 2; i++ {
+					_ = cs.Tracker().Add(&corev1.PersistentVolumeClaim{
+						ObjectMeta: metav1.ObjectMeta{
+							Name:      fmt.Sprintf("datadir-cockroachdb-large-%d", i),
+							Namespace: "testns",
+							Labels: map[string]string{
+								"app": "cockroach",
+							},
+						},
+					})
+				}
+			},
+			HandleError: func(t *testing.T, cs *fake.Clientset, err error) {
+				require.NoError(t, err)
+
+				// the PVCs of the pool are left to the statefulset of the pool
+				pvcs, err := cs.CoreV1().PersistentVolumeClaims("testns").List(context.TODO(), metav1.ListOptions{})
+				require.NoError(t, err)
+				require.Len(t, pvcs.Items, 7)
+			},
+		},
 		{
 			Name:     "long time to delete",
 			Replicas: 5,
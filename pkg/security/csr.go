@@ -0,0 +1,102 @@
+/*
+Copyright 2021 The Cockroach Authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    https://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package security
+
+import (
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"net"
+
+	"github.com/cockroachdb/errors"
+)
+
+// csrKeySize is the size of the RSA keys of the certificate signing requests,
+// the size the cockroach binary uses for the node and client keys.
+const csrKeySize = 2048
+
+// ErrCertificatePending is returned while a certificate signing request waits
+// for the external CA to sign it.
+var ErrCertificatePending = errors.New("the certificate is not signed yet")
+
+// CreateCSR generates a private key and a certificate signing request for the
+// common name, valid for the hosts, PEM encoded. The IP addresses among the
+// hosts are IP SANs.
+func CreateCSR(commonName string, hosts []string) (key []byte, csr []byte, err error) {
+	privateKey, err := rsa.GenerateKey(rand.Reader, csrKeySize)
+	if err != nil {
+		return nil, nil, errors.Wrap(err, "failed to generate the private key")
+	}
+
+	template := &x509.CertificateRequest{
+		Subject: pkix.Name{
+			CommonName: commonName,
+		},
+	}
+	for _, host := range hosts {
+		if ip := net.ParseIP(host); ip != nil {
+			template.IPAddresses = append(template.IPAddresses, ip)
+		} else {
+			template.DNSNames = append(template.DNSNames, host)
+		}
+	}
+
+	der, err := x509.CreateCertificateRequest(rand.Reader, template, privateKey)
+	if err != nil {
+		return nil, nil, errors.Wrap(err, "failed to create the certificate signing request")
+	}
+
+	key = pem.EncodeToMemory(&pem.Block{Type: "RSA PRIVATE KEY", Bytes: x509.MarshalPKCS1PrivateKey(privateKey)})
+	csr = pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE REQUEST", Bytes: der})
+	return key, csr, nil
+}
+
+// VerifyCertificate checks that the certificate signed for a request is the
+// certificate of the private key, and that it is issued by the CA.
+func VerifyCertificate(cert, key, ca []byte) error {
+	pair, err := tls.X509KeyPair(cert, key)
+	if err != nil {
+		return errors.Wrap(err, "the certificate does not match the private key")
+	}
+	leaf, err := x509.ParseCertificate(pair.Certificate[0])
+	if err != nil {
+		return errors.Wrap(err, "failed to parse the certificate")
+	}
+
+	roots := x509.NewCertPool()
+	if !roots.AppendCertsFromPEM(ca) {
+		return errors.New("no certificate found in the CA certificate")
+	}
+	intermediates := x509.NewCertPool()
+	for _, der := range pair.Certificate[1:] {
+		if c, err := x509.ParseCertificate(der); err == nil {
+			intermediates.AddCert(c)
+		}
+	}
+	opts := x509.VerifyOptions{
+		Roots:         roots,
+		Intermediates: intermediates,
+		KeyUsages:     []x509.ExtKeyUsage{x509.ExtKeyUsageAny},
+	}
+	if _, err := leaf.Verify(opts); err != nil {
+		return errors.Wrap(err, "the certificate is not issued by the CA")
+	}
+	return nil
+}
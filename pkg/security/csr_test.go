@@ -0,0 +1,62 @@
+/*
+Copyright 2021 The Cockroach Authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    https://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package security_test
+
+import (
+	"crypto/x509"
+	"encoding/pem"
+	"testing"
+
+	. "github.com/cockroachdb/cockroach-operator/pkg/security"
+	"github.com/cockroachdb/cockroach-operator/pkg/testutil"
+	"github.com/stretchr/testify/require"
+)
+
+func TestCreateCSR(t *testing.T) {
+	key, csr, err := CreateCSR("node", []string{"localhost", "127.0.0.1", "*.crdb.default"})
+	require.NoError(t, err)
+
+	block, _ := pem.Decode(key)
+	require.NotNil(t, block)
+	require.Equal(t, "RSA PRIVATE KEY", block.Type)
+
+	block, _ = pem.Decode(csr)
+	require.NotNil(t, block)
+	request, err := x509.ParseCertificateRequest(block.Bytes)
+	require.NoError(t, err)
+	require.NoError(t, request.CheckSignature())
+	require.Equal(t, "node", request.Subject.CommonName)
+	require.Equal(t, []string{"localhost", "*.crdb.default"}, request.DNSNames)
+	require.Len(t, request.IPAddresses, 1)
+	require.Equal(t, "127.0.0.1", request.IPAddresses[0].String())
+}
+
+func TestVerifyCertificate(t *testing.T) {
+	ca, caKey := testutil.NewCA(t)
+	other, _ := testutil.NewCA(t)
+
+	key, csr, err := CreateCSR("root", nil)
+	require.NoError(t, err)
+	cert := testutil.SignCSR(t, csr, ca, caKey)
+
+	require.NoError(t, VerifyCertificate(cert, key, ca))
+
+	otherKey, _, err := CreateCSR("root", nil)
+	require.NoError(t, err)
+	require.Error(t, VerifyCertificate(cert, otherKey, ca), "the certificate of another key")
+	require.Error(t, VerifyCertificate(cert, key, other), "the certificate of another CA")
+}
@@ -0,0 +1,94 @@
+/*
+Copyright 2021 The Cockroach Authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    https://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package security
+
+import (
+	"context"
+	"fmt"
+	"io/ioutil"
+	"path/filepath"
+	"time"
+
+	"github.com/cockroachdb/errors"
+)
+
+// Certificate is a certificate with its private key and the certificates of
+// the CA that issued it, PEM encoded.
+type Certificate struct {
+	Cert []byte
+	Key  []byte
+	CA   []byte
+}
+
+// CertificateProvider issues the certificates of the nodes of a cluster and of
+// its SQL users.
+type CertificateProvider interface {
+	// NodeCertificate issues the certificate of the nodes, valid for the hosts
+	NodeCertificate(ctx context.Context, hosts []string) (*Certificate, error)
+	// ClientCertificate issues the client certificate of the user
+	ClientCertificate(ctx context.Context, user SQLUsername) (*Certificate, error)
+}
+
+// CockroachProvider issues the certificates with the cockroach binary, signed
+// by the CA key at CAKey. The certificates are written to CertsDir, which holds
+// the certificate of the CA.
+type CockroachProvider struct {
+	CertsDir  string
+	CAKey     string
+	Lifetime  time.Duration
+	Overwrite bool
+	// PKCS8Key writes the private key of the client certificates in PKCS#8
+	// encoding as well
+	PKCS8Key bool
+}
+
+// NodeCertificate implements CertificateProvider.
+func (p *CockroachProvider) NodeCertificate(_ context.Context, hosts []string) (*Certificate, error) {
+	if err := CreateNodePair(p.CertsDir, p.CAKey, p.Lifetime, p.Overwrite, hosts); err != nil {
+		return nil, err
+	}
+	return p.read("node")
+}
+
+// ClientCertificate implements CertificateProvider.
+func (p *CockroachProvider) ClientCertificate(_ context.Context, user SQLUsername) (*Certificate, error) {
+	if err := CreateClientPair(p.CertsDir, p.CAKey, p.Lifetime, p.Overwrite, user, p.PKCS8Key); err != nil {
+		return nil, err
+	}
+	return p.read(fmt.Sprintf("client.%s", user.U))
+}
+
+// read loads the certificate and the key written under the name, along with
+// the certificate of the CA.
+func (p *CockroachProvider) read(name string) (*Certificate, error) {
+	ca, err := ioutil.ReadFile(filepath.Join(p.CertsDir, "ca.crt"))
+	if err != nil {
+		return nil, errors.Wrap(err, "unable to read ca.crt")
+	}
+
+	cert, err := ioutil.ReadFile(filepath.Join(p.CertsDir, name+".crt"))
+	if err != nil {
+		return nil, errors.Wrapf(err, "unable to read %s.crt", name)
+	}
+
+	key, err := ioutil.ReadFile(filepath.Join(p.CertsDir, name+".key"))
+	if err != nil {
+		return nil, errors.Wrapf(err, "unable to read %s.key", name)
+	}
+
+	return &Certificate{Cert: cert, Key: key, CA: ca}, nil
+}
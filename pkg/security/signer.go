@@ -0,0 +1,280 @@
+/*
+Copyright 2021 The Cockroach Authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    https://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package security
+
+import (
+	"context"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"io/ioutil"
+	"math/big"
+	"net"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/cockroachdb/errors"
+)
+
+// The algorithms of the private keys of a KeySpec.
+const (
+	RSAKey   = "RSA"
+	ECDSAKey = "ECDSA"
+)
+
+// certificateOrganization is the organization of the certificates issued by
+// the cockroach binary, kept by the certificates a SignerProvider issues.
+const certificateOrganization = "Cockroach"
+
+// KeySpec is the algorithm of the private keys and their size: the size of
+// the RSA keys in bits, or the size of the ECDSA curve.
+type KeySpec struct {
+	Algorithm string
+	Size      int
+}
+
+// generate generates a private key of the spec, along with its PEM encoding:
+// PKCS#1 for the RSA keys and SEC 1 for the ECDSA keys, as the cockroach
+// binary writes them.
+func (k KeySpec) generate() (crypto.Signer, []byte, error) {
+	switch k.Algorithm {
+	case RSAKey:
+		if k.Size < 2048 {
+			return nil, nil, errors.Newf("RSA keys of %d bits are not supported", k.Size)
+		}
+		key, err := rsa.GenerateKey(rand.Reader, k.Size)
+		if err != nil {
+			return nil, nil, errors.Wrap(err, "failed to generate the private key")
+		}
+		return key, pem.EncodeToMemory(&pem.Block{Type: "RSA PRIVATE KEY", Bytes: x509.MarshalPKCS1PrivateKey(key)}), nil
+	case ECDSAKey:
+		var curve elliptic.Curve
+		switch k.Size {
+		case 256:
+			curve = elliptic.P256()
+		case 384:
+			curve = elliptic.P384()
+		default:
+			return nil, nil, errors.Newf("ECDSA curves of %d bits are not supported", k.Size)
+		}
+		key, err := ecdsa.GenerateKey(curve, rand.Reader)
+		if err != nil {
+			return nil, nil, errors.Wrap(err, "failed to generate the private key")
+		}
+		der, err := x509.MarshalECPrivateKey(key)
+		if err != nil {
+			return nil, nil, errors.Wrap(err, "failed to encode the private key")
+		}
+		return key, pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: der}), nil
+	default:
+		return nil, nil, errors.Newf("unsupported key algorithm %q", k.Algorithm)
+	}
+}
+
+// keyUsage is the usage of the leaf certificates of the key: RSA keys encrypt
+// the keys of the TLS sessions, ECDSA keys only sign.
+func keyUsage(key crypto.Signer) x509.KeyUsage {
+	if _, ok := key.(*rsa.PrivateKey); ok {
+		return x509.KeyUsageDigitalSignature | x509.KeyUsageKeyEncipherment
+	}
+	return x509.KeyUsageDigitalSignature
+}
+
+// CreateCA generates a self-signed CA valid for the lifetime, with a private
+// key of the spec. The certificate is written as ca.crt in certsDir and the key
+// at caKeyPath, where a SignerProvider or the cockroach binary reads them.
+func CreateCA(certsDir, caKeyPath string, lifetime time.Duration, key KeySpec) error {
+	signer, keyPEM, err := key.generate()
+	if err != nil {
+		return err
+	}
+
+	serial, err := serialNumber()
+	if err != nil {
+		return err
+	}
+
+	now := time.Now()
+	template := &x509.Certificate{
+		SerialNumber: serial,
+		Subject: pkix.Name{
+			Organization: []string{certificateOrganization},
+			CommonName:   "Cockroach CA",
+		},
+		NotBefore:             now.Add(-time.Hour),
+		NotAfter:              now.Add(lifetime),
+		KeyUsage:              x509.KeyUsageCertSign | x509.KeyUsageCRLSign,
+		BasicConstraintsValid: true,
+		IsCA:                  true,
+		MaxPathLenZero:        true,
+	}
+
+	der, err := x509.CreateCertificate(rand.Reader, template, template, signer.Public(), signer)
+	if err != nil {
+		return errors.Wrap(err, "failed to create the CA certificate")
+	}
+
+	if err := os.MkdirAll(certsDir, 0700); err != nil {
+		return errors.Wrapf(err, "failed to create %s", certsDir)
+	}
+	if err := ioutil.WriteFile(caKeyPath, keyPEM, 0600); err != nil {
+		return errors.Wrap(err, "failed to write the CA key")
+	}
+	caPEM := pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der})
+	if err := ioutil.WriteFile(filepath.Join(certsDir, "ca.crt"), caPEM, 0600); err != nil {
+		return errors.Wrap(err, "failed to write ca.crt")
+	}
+	return nil
+}
+
+// SignerProvider issues the certificates in the process, signed by the CA key
+// at CAKey. CertsDir holds the certificate of the CA: the first one of ca.crt
+// signs. Unlike the cockroach binary, it sets the lifetime of the certificates
+// and generates ECDSA keys.
+type SignerProvider struct {
+	CertsDir string
+	CAKey    string
+	Lifetime time.Duration
+	Key      KeySpec
+}
+
+// NodeCertificate implements CertificateProvider.
+func (p *SignerProvider) NodeCertificate(_ context.Context, hosts []string) (*Certificate, error) {
+	template := &x509.Certificate{
+		Subject: pkix.Name{
+			Organization: []string{certificateOrganization},
+			CommonName:   "node",
+		},
+		ExtKeyUsage: []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth, x509.ExtKeyUsageClientAuth},
+	}
+	for _, host := range hosts {
+		if ip := net.ParseIP(host); ip != nil {
+			template.IPAddresses = append(template.IPAddresses, ip)
+		} else {
+			template.DNSNames = append(template.DNSNames, host)
+		}
+	}
+	return p.sign(template)
+}
+
+// ClientCertificate implements CertificateProvider.
+func (p *SignerProvider) ClientCertificate(_ context.Context, user SQLUsername) (*Certificate, error) {
+	template := &x509.Certificate{
+		Subject: pkix.Name{
+			Organization: []string{certificateOrganization},
+			CommonName:   user.U,
+		},
+		ExtKeyUsage: []x509.ExtKeyUsage{x509.ExtKeyUsageClientAuth},
+	}
+	return p.sign(template)
+}
+
+// sign issues the certificate of the template with a new private key. The
+// certificate does not outlive the CA.
+func (p *SignerProvider) sign(template *x509.Certificate) (*Certificate, error) {
+	caPEM, err := ioutil.ReadFile(filepath.Join(p.CertsDir, "ca.crt"))
+	if err != nil {
+		return nil, errors.Wrap(err, "unable to read ca.crt")
+	}
+	block, _ := pem.Decode(caPEM)
+	if block == nil {
+		return nil, errors.New("ca.crt holds no certificate")
+	}
+	ca, err := x509.ParseCertificate(block.Bytes)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to parse the CA certificate")
+	}
+
+	caKeyPEM, err := ioutil.ReadFile(p.CAKey)
+	if err != nil {
+		return nil, errors.Wrap(err, "unable to read the CA key")
+	}
+	caKey, err := parsePrivateKey(caKeyPEM)
+	if err != nil {
+		return nil, err
+	}
+
+	signer, keyPEM, err := p.Key.generate()
+	if err != nil {
+		return nil, err
+	}
+
+	serial, err := serialNumber()
+	if err != nil {
+		return nil, err
+	}
+
+	now := time.Now()
+	template.SerialNumber = serial
+	template.NotBefore = now.Add(-time.Hour)
+	template.NotAfter = now.Add(p.Lifetime)
+	if template.NotAfter.After(ca.NotAfter) {
+		template.NotAfter = ca.NotAfter
+	}
+	template.KeyUsage = keyUsage(signer)
+
+	der, err := x509.CreateCertificate(rand.Reader, template, ca, signer.Public(), caKey)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to sign the certificate")
+	}
+
+	return &Certificate{
+		Cert: pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}),
+		Key:  keyPEM,
+		CA:   caPEM,
+	}, nil
+}
+
+// parsePrivateKey parses a PEM encoded private key: PKCS#1, SEC 1 or PKCS#8.
+func parsePrivateKey(data []byte) (crypto.Signer, error) {
+	block, _ := pem.Decode(data)
+	if block == nil {
+		return nil, errors.New("the CA key is not PEM encoded")
+	}
+
+	switch block.Type {
+	case "RSA PRIVATE KEY":
+		return x509.ParsePKCS1PrivateKey(block.Bytes)
+	case "EC PRIVATE KEY":
+		return x509.ParseECPrivateKey(block.Bytes)
+	}
+
+	key, err := x509.ParsePKCS8PrivateKey(block.Bytes)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to parse the CA key")
+	}
+	signer, ok := key.(crypto.Signer)
+	if !ok {
+		return nil, errors.New("the CA key cannot sign")
+	}
+	return signer, nil
+}
+
+// serialNumber returns a random serial number of 128 bits.
+func serialNumber() (*big.Int, error) {
+	serial, err := rand.Int(rand.Reader, new(big.Int).Lsh(big.NewInt(1), 128))
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to generate the serial number")
+	}
+	return serial, nil
+}
@@ -0,0 +1,119 @@
+/*
+Copyright 2021 The Cockroach Authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    https://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package security_test
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/pem"
+	"io/ioutil"
+	"path/filepath"
+	"testing"
+	"time"
+
+	. "github.com/cockroachdb/cockroach-operator/pkg/security"
+	"github.com/cockroachdb/cockroach-operator/pkg/testutil"
+	"github.com/stretchr/testify/require"
+)
+
+func TestSignerProvider(t *testing.T) {
+	certsDir, cleanup := tempDir(t)
+	defer cleanup()
+	caKey := filepath.Join(certsDir, "ca.key")
+
+	require.NoError(t, CreateCA(certsDir, caKey, 48*time.Hour, KeySpec{Algorithm: RSAKey, Size: 2048}))
+	ca := testutil.ParseCert(t, readFile(t, filepath.Join(certsDir, "ca.crt")))
+	require.True(t, ca.IsCA)
+	require.WithinDuration(t, time.Now().Add(48*time.Hour), ca.NotAfter, time.Minute)
+
+	p := &SignerProvider{
+		CertsDir: certsDir,
+		CAKey:    caKey,
+		Lifetime: 24 * time.Hour,
+		Key:      KeySpec{Algorithm: ECDSAKey, Size: 384},
+	}
+
+	node, err := p.NodeCertificate(context.Background(), []string{"localhost", "127.0.0.1"})
+	require.NoError(t, err)
+	cert := testutil.ParseCert(t, node.Cert)
+	require.Equal(t, "node", cert.Subject.CommonName)
+	require.Equal(t, []string{"localhost"}, cert.DNSNames)
+	require.Equal(t, "127.0.0.1", cert.IPAddresses[0].String())
+	require.WithinDuration(t, time.Now().Add(24*time.Hour), cert.NotAfter, time.Minute)
+	require.NoError(t, cert.CheckSignatureFrom(ca))
+	require.NoError(t, VerifyCertificate(node.Cert, node.Key, node.CA))
+
+	block, _ := pem.Decode(node.Key)
+	require.Equal(t, "EC PRIVATE KEY", block.Type)
+	key, err := x509.ParseECPrivateKey(block.Bytes)
+	require.NoError(t, err)
+	require.Equal(t, elliptic.P384(), key.Curve)
+
+	// the certificates do not outlive the CA
+	p.Lifetime = 72 * time.Hour
+	client, err := p.ClientCertificate(context.Background(), SQLUsername{U: "app"})
+	require.NoError(t, err)
+	cert = testutil.ParseCert(t, client.Cert)
+	require.Equal(t, "app", cert.Subject.CommonName)
+	require.Equal(t, []x509.ExtKeyUsage{x509.ExtKeyUsageClientAuth}, cert.ExtKeyUsage)
+	require.Equal(t, ca.NotAfter, cert.NotAfter)
+}
+
+func TestCreateCAECDSA(t *testing.T) {
+	certsDir, cleanup := tempDir(t)
+	defer cleanup()
+	caKey := filepath.Join(certsDir, "ca.key")
+
+	require.NoError(t, CreateCA(certsDir, caKey, time.Hour, KeySpec{Algorithm: ECDSAKey, Size: 256}))
+	ca := testutil.ParseCert(t, readFile(t, filepath.Join(certsDir, "ca.crt")))
+	require.IsType(t, &ecdsa.PublicKey{}, ca.PublicKey)
+
+	p := &SignerProvider{
+		CertsDir: certsDir,
+		CAKey:    caKey,
+		Lifetime: time.Hour,
+		Key:      KeySpec{Algorithm: RSAKey, Size: 3072},
+	}
+	client, err := p.ClientCertificate(context.Background(), SQLUsername{U: "root"})
+	require.NoError(t, err)
+	cert := testutil.ParseCert(t, client.Cert)
+	require.NoError(t, cert.CheckSignatureFrom(ca))
+	require.Equal(t, 3072, cert.PublicKey.(*rsa.PublicKey).N.BitLen())
+}
+
+func TestUnsupportedKeySpec(t *testing.T) {
+	certsDir, cleanup := tempDir(t)
+	defer cleanup()
+	caKey := filepath.Join(certsDir, "ca.key")
+
+	for _, spec := range []KeySpec{
+		{Algorithm: RSAKey, Size: 1024},
+		{Algorithm: ECDSAKey, Size: 521},
+		{Algorithm: "DSA", Size: 2048},
+	} {
+		require.Error(t, CreateCA(certsDir, caKey, time.Hour, spec), "%v", spec)
+	}
+}
+
+func readFile(t *testing.T, name string) []byte {
+	data, err := ioutil.ReadFile(name)
+	require.NoError(t, err)
+	return data
+}
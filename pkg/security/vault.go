@@ -0,0 +1,242 @@
+/*
+Copyright 2021 The Cockroach Authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    https://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package security
+
+import (
+	"bytes"
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/cockroachdb/errors"
+)
+
+// ServiceAccountTokenPath is where the token of the service account of a pod
+// is mounted.
+const ServiceAccountTokenPath = "/var/run/secrets/kubernetes.io/serviceaccount/token"
+
+// VaultConfig sets the Vault server a VaultProvider issues the certificates
+// from.
+type VaultConfig struct {
+	// Address is the URL of the Vault server
+	Address string
+	// CACert is the PEM certificate of the CA of the Vault server, the system
+	// roots are used when it is empty
+	CACert []byte
+	// AuthPath is the mount path of the Kubernetes auth method
+	AuthPath string
+	// Role is the role of the Kubernetes auth method
+	Role string
+	// TokenPath is the file of the service account token the provider logs in
+	// with. Default: ServiceAccountTokenPath
+	TokenPath string
+	// PKIPath is the mount path of the PKI secrets engine
+	PKIPath string
+	// NodeRole is the role that issues the node certificates
+	NodeRole string
+	// ClientRole is the role that issues the client certificates
+	ClientRole string
+	// TTL is the lifetime of the certificates, zero for the TTL of the roles
+	TTL time.Duration
+}
+
+// VaultProvider issues the certificates from the PKI secrets engine of a
+// HashiCorp Vault server. It logs in with the Kubernetes auth method on its
+// first request.
+type VaultProvider struct {
+	config VaultConfig
+	client *http.Client
+	token  string
+}
+
+// NewVaultProvider returns a provider of the certificates issued by the Vault
+// server of the config.
+func NewVaultProvider(config VaultConfig) (*VaultProvider, error) {
+	if config.TokenPath == "" {
+		config.TokenPath = ServiceAccountTokenPath
+	}
+
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	if len(config.CACert) > 0 {
+		pool := x509.NewCertPool()
+		if !pool.AppendCertsFromPEM(config.CACert) {
+			return nil, errors.New("no certificate found in the CA certificate of the Vault server")
+		}
+		transport.TLSClientConfig = &tls.Config{RootCAs: pool}
+	}
+
+	return &VaultProvider{
+		config: config,
+		client: &http.Client{Transport: transport, Timeout: 30 * time.Second},
+	}, nil
+}
+
+// NodeCertificate implements CertificateProvider. The node certificates have
+// the "node" common name, and the IP addresses among the hosts are IP SANs.
+func (p *VaultProvider) NodeCertificate(ctx context.Context, hosts []string) (*Certificate, error) {
+	var names, ips []string
+	for _, host := range hosts {
+		if net.ParseIP(host) != nil {
+			ips = append(ips, host)
+		} else {
+			names = append(names, host)
+		}
+	}
+
+	request := map[string]interface{}{
+		"common_name":          "node",
+		"alt_names":            strings.Join(names, ","),
+		"ip_sans":              strings.Join(ips, ","),
+		"exclude_cn_from_sans": true,
+	}
+	return p.issue(ctx, p.config.NodeRole, request)
+}
+
+// ClientCertificate implements CertificateProvider. The common name of the
+// client certificates is the user.
+func (p *VaultProvider) ClientCertificate(ctx context.Context, user SQLUsername) (*Certificate, error) {
+	request := map[string]interface{}{
+		"common_name":          user.U,
+		"exclude_cn_from_sans": true,
+	}
+	return p.issue(ctx, p.config.ClientRole, request)
+}
+
+// vaultResponse is the body of the responses of Vault, of which only the
+// fields used are decoded.
+type vaultResponse struct {
+	Errors []string `json:"errors"`
+	Auth   *struct {
+		ClientToken string `json:"client_token"`
+	} `json:"auth"`
+	Data *struct {
+		Certificate string   `json:"certificate"`
+		PrivateKey  string   `json:"private_key"`
+		IssuingCA   string   `json:"issuing_ca"`
+		CAChain     []string `json:"ca_chain"`
+	} `json:"data"`
+}
+
+// issue issues a certificate with the role of the PKI secrets engine.
+func (p *VaultProvider) issue(ctx context.Context, role string, request map[string]interface{}) (*Certificate, error) {
+	if err := p.login(ctx); err != nil {
+		return nil, err
+	}
+
+	request["format"] = "pem"
+	if p.config.TTL > 0 {
+		request["ttl"] = p.config.TTL.String()
+	}
+
+	var response vaultResponse
+	path := fmt.Sprintf("%s/issue/%s", strings.Trim(p.config.PKIPath, "/"), role)
+	if err := p.post(ctx, path, request, &response); err != nil {
+		return nil, errors.Wrapf(err, "failed to issue a certificate with role %s", role)
+	}
+	if response.Data == nil || response.Data.Certificate == "" || response.Data.PrivateKey == "" {
+		return nil, errors.Newf("Vault issued no certificate with role %s", role)
+	}
+
+	// the chain holds the issuing CA and the CAs above it, the whole chain is
+	// needed to verify the certificates of the other nodes
+	chain := response.Data.CAChain
+	if len(chain) == 0 {
+		chain = []string{response.Data.IssuingCA}
+	}
+
+	return &Certificate{
+		Cert: []byte(pemBlock(response.Data.Certificate)),
+		Key:  []byte(pemBlock(response.Data.PrivateKey)),
+		CA:   []byte(pemBlock(strings.Join(chain, "\n"))),
+	}, nil
+}
+
+// login logs in with the Kubernetes auth method, once.
+func (p *VaultProvider) login(ctx context.Context) error {
+	if p.token != "" {
+		return nil
+	}
+
+	jwt, err := ioutil.ReadFile(p.config.TokenPath)
+	if err != nil {
+		return errors.Wrap(err, "failed to read the service account token")
+	}
+
+	request := map[string]interface{}{
+		"role": p.config.Role,
+		"jwt":  strings.TrimSpace(string(jwt)),
+	}
+	var response vaultResponse
+	path := fmt.Sprintf("auth/%s/login", strings.Trim(p.config.AuthPath, "/"))
+	if err := p.post(ctx, path, request, &response); err != nil {
+		return errors.Wrapf(err, "failed to log in to Vault with role %s", p.config.Role)
+	}
+	if response.Auth == nil || response.Auth.ClientToken == "" {
+		return errors.Newf("Vault returned no token for role %s", p.config.Role)
+	}
+
+	p.token = response.Auth.ClientToken
+	return nil
+}
+
+// post sends the request to the path of the Vault API and decodes the
+// response.
+func (p *VaultProvider) post(ctx context.Context, path string, request interface{}, response *vaultResponse) error {
+	body, err := json.Marshal(request)
+	if err != nil {
+		return err
+	}
+
+	url := fmt.Sprintf("%s/v1/%s", strings.TrimRight(p.config.Address, "/"), path)
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, url, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	if p.token != "" {
+		req.Header.Set("X-Vault-Token", p.token)
+	}
+
+	resp, err := p.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if err := json.NewDecoder(resp.Body).Decode(response); err != nil && resp.StatusCode == http.StatusOK {
+		return errors.Wrap(err, "failed to decode the response of Vault")
+	}
+	if resp.StatusCode != http.StatusOK {
+		if len(response.Errors) > 0 {
+			return errors.Newf("Vault returned %d: %s", resp.StatusCode, strings.Join(response.Errors, "; "))
+		}
+		return errors.Newf("Vault returned %d", resp.StatusCode)
+	}
+	return nil
+}
+
+// pemBlock ends the PEM encoded text with a newline.
+func pemBlock(text string) string {
+	return strings.TrimSpace(text) + "\n"
+}
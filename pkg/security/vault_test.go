@@ -0,0 +1,118 @@
+/*
+Copyright 2021 The Cockroach Authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    https://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package security_test
+
+import (
+	"context"
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"testing"
+
+	. "github.com/cockroachdb/cockroach-operator/pkg/security"
+	"github.com/stretchr/testify/require"
+)
+
+// fakeVault answers the login to the Kubernetes auth method and the issue of
+// certificates by the PKI secrets engine, recording the requests it issued.
+type fakeVault struct {
+	issued map[string]map[string]interface{}
+}
+
+func (v *fakeVault) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	var request map[string]interface{}
+	if err := json.NewDecoder(r.Body).Decode(&request); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	switch {
+	case r.URL.Path == "/v1/auth/kubernetes/login":
+		if request["role"] != "cockroach-operator" || request["jwt"] != "service-account-token" {
+			w.WriteHeader(http.StatusForbidden)
+			_, _ = w.Write([]byte(`{"errors":["permission denied"]}`))
+			return
+		}
+		_, _ = w.Write([]byte(`{"auth":{"client_token":"s.token"}}`))
+	case r.Header.Get("X-Vault-Token") != "s.token":
+		w.WriteHeader(http.StatusForbidden)
+		_, _ = w.Write([]byte(`{"errors":["permission denied"]}`))
+	case r.URL.Path == "/v1/pki_int/issue/cockroachdb":
+		v.issued[request["common_name"].(string)] = request
+		_, _ = w.Write([]byte(`{"data":{"certificate":"CERT","private_key":"KEY","issuing_ca":"INT","ca_chain":["INT","ROOT"]}}`))
+	default:
+		w.WriteHeader(http.StatusNotFound)
+		_, _ = w.Write([]byte(`{"errors":[]}`))
+	}
+}
+
+func TestVaultProvider(t *testing.T) {
+	ctx := context.Background()
+	vault := &fakeVault{issued: map[string]map[string]interface{}{}}
+	server := httptest.NewServer(vault)
+	defer server.Close()
+
+	dir, cleanup := tempDir(t)
+	defer cleanup()
+	tokenPath := filepath.Join(dir, "token")
+	require.NoError(t, ioutil.WriteFile(tokenPath, []byte("service-account-token\n"), 0600))
+
+	config := VaultConfig{
+		Address:    server.URL,
+		AuthPath:   "kubernetes",
+		Role:       "cockroach-operator",
+		TokenPath:  tokenPath,
+		PKIPath:    "pki_int",
+		NodeRole:   "cockroachdb",
+		ClientRole: "cockroachdb",
+	}
+	provider, err := NewVaultProvider(config)
+	require.NoError(t, err)
+
+	node, err := provider.NodeCertificate(ctx, []string{"localhost", "127.0.0.1", "*.crdb.default"})
+	require.NoError(t, err)
+	require.Equal(t, "CERT\n", string(node.Cert))
+	require.Equal(t, "KEY\n", string(node.Key))
+	require.Equal(t, "INT\nROOT\n", string(node.CA))
+	require.Equal(t, "localhost,*.crdb.default", vault.issued["node"]["alt_names"])
+	require.Equal(t, "127.0.0.1", vault.issued["node"]["ip_sans"])
+
+	_, err = provider.ClientCertificate(ctx, SQLUsername{U: "root"})
+	require.NoError(t, err)
+	require.Contains(t, vault.issued, "root")
+
+	// the errors of Vault are reported
+	config.Role = "other"
+	provider, err = NewVaultProvider(config)
+	require.NoError(t, err)
+	_, err = provider.NodeCertificate(ctx, []string{"localhost"})
+	require.EqualError(t, err, "failed to log in to Vault with role other: Vault returned 403: permission denied")
+
+	config.Role = "cockroach-operator"
+	config.NodeRole = "missing"
+	provider, err = NewVaultProvider(config)
+	require.NoError(t, err)
+	_, err = provider.NodeCertificate(ctx, []string{"localhost"})
+	require.EqualError(t, err, "failed to issue a certificate with role missing: Vault returned 404")
+}
+
+func TestVaultProviderCACert(t *testing.T) {
+	_, err := NewVaultProvider(VaultConfig{Address: "https://vault:8200", CACert: []byte("not a certificate")})
+	require.EqualError(t, err, "no certificate found in the CA certificate of the Vault server")
+}
@@ -127,6 +127,16 @@ func (b ClusterBuilder) WithAffinity(affinity *corev1.Affinity) ClusterBuilder {
 	return b
 }
 
+func (b ClusterBuilder) WithNodeSelector(selector map[string]string) ClusterBuilder {
+	b.cluster.Spec.NodeSelector = selector
+	return b
+}
+
+func (b ClusterBuilder) WithTolerations(tolerations []corev1.Toleration) ClusterBuilder {
+	b.cluster.Spec.Tolerations = tolerations
+	return b
+}
+
 func (b ClusterBuilder) WithResources(resources corev1.ResourceRequirements) ClusterBuilder {
 	b.cluster.Spec.Resources = resources
 	return b
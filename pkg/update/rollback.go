@@ -0,0 +1,150 @@
+/*
+Copyright 2021 The Cockroach Authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    https://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package update
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/cockroachdb/cockroach-operator/pkg/kube"
+	"github.com/cockroachdb/cockroach-operator/pkg/resource"
+	"github.com/cockroachdb/errors"
+	"github.com/go-logr/logr"
+	"go.uber.org/zap/zapcore"
+	v1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+	k8sErrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/util/retry"
+)
+
+// RollbackCockroachVersion reverts the CockroachDB container of the
+// StatefulSet to the image it ran before the update, with a partition of 0 so
+// that every pod runs it again. The StatefulSet controller does not replace
+// the pods that are not ready, so the updated pods that are not ready are
+// deleted. It returns why each of them was not ready.
+func RollbackCockroachVersion(
+	ctx context.Context,
+	clientset kubernetes.Interface,
+	update *UpdateRoach,
+	previousImage string,
+	l logr.Logger,
+) ([]string, error) {
+	var sts *v1.StatefulSet
+	err := retry.RetryOnConflict(retry.DefaultRetry, func() error {
+		var err error
+		sts, err = clientset.AppsV1().StatefulSets(update.StsNamespace).Get(ctx, update.StsName, metav1.GetOptions{})
+		if err != nil {
+			return err
+		}
+
+		found := false
+		for i := range sts.Spec.Template.Spec.Containers {
+			container := &sts.Spec.Template.Spec.Containers[i]
+			if container.Name == resource.DbContainerName {
+				container.Image = previousImage
+				found = true
+			}
+		}
+		if !found {
+			return errors.New("cockroachdb container not found in sts")
+		}
+
+		if sts.Annotations == nil {
+			sts.Annotations = map[string]string{}
+		}
+		sts.Annotations[resource.CrdbVersionAnnotation] = update.CurrentVersion.Original()
+		sts.Annotations[resource.CrdbContainerImageAnnotation] = previousImage
+		partition := int32(0)
+		sts.Spec.UpdateStrategy.RollingUpdate = &v1.RollingUpdateStatefulSetStrategy{
+			Partition: &partition,
+		}
+
+		sts, err = clientset.AppsV1().StatefulSets(update.StsNamespace).Update(ctx, sts, metav1.UpdateOptions{})
+		return err
+	})
+	if err != nil {
+		return nil, handleStsError(err, l, update.StsName, update.StsNamespace)
+	}
+	l.V(int(zapcore.InfoLevel)).Info("rolled back the statefulset", "image", previousImage)
+
+	pods, err := clientset.CoreV1().Pods(update.StsNamespace).List(ctx, metav1.ListOptions{
+		LabelSelector: labels.Set(sts.Spec.Selector.MatchLabels).AsSelector().String(),
+	})
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to list pods")
+	}
+
+	var diagnostics []string
+	for i := range pods.Items {
+		pod := &pods.Items[i]
+		if kube.IsPodReady(pod) || podImage(pod) == previousImage {
+			continue
+		}
+
+		diagnostics = append(diagnostics, fmt.Sprintf("pod %s: %s", pod.Name, podDiagnostics(pod)))
+		err := clientset.CoreV1().Pods(pod.Namespace).Delete(ctx, pod.Name, metav1.DeleteOptions{})
+		if err != nil && !k8sErrors.IsNotFound(err) {
+			return diagnostics, errors.Wrapf(err, "failed to delete pod %s", pod.Name)
+		}
+		l.V(int(zapcore.InfoLevel)).Info("deleted an updated pod that is not ready", "pod", pod.Name)
+	}
+	return diagnostics, nil
+}
+
+// podImage returns the image of the CockroachDB container of the pod.
+func podImage(pod *corev1.Pod) string {
+	for _, container := range pod.Spec.Containers {
+		if container.Name == resource.DbContainerName {
+			return container.Image
+		}
+	}
+	return ""
+}
+
+// podDiagnostics explains why the CockroachDB container of the pod is not
+// ready, from its current and last state.
+func podDiagnostics(pod *corev1.Pod) string {
+	for _, status := range pod.Status.ContainerStatuses {
+		if status.Name != resource.DbContainerName {
+			continue
+		}
+		if waiting := status.State.Waiting; waiting != nil {
+			if terminated := status.LastTerminationState.Terminated; terminated != nil {
+				diagnostics := fmt.Sprintf("%s after %d restarts, last exited with code %d %s",
+					waiting.Reason, status.RestartCount, terminated.ExitCode, terminated.Reason)
+				if terminated.Message != "" {
+					diagnostics += ": " + terminated.Message
+				}
+				return diagnostics
+			}
+			return fmt.Sprintf("%s: %s", waiting.Reason, waiting.Message)
+		}
+		if status.State.Running != nil {
+			return fmt.Sprintf("running but not ready after %d restarts", status.RestartCount)
+		}
+	}
+
+	for _, c := range pod.Status.Conditions {
+		if c.Type == corev1.PodScheduled && c.Status != corev1.ConditionTrue {
+			return fmt.Sprintf("not scheduled: %s", c.Message)
+		}
+	}
+	return fmt.Sprintf("pod is %s", pod.Status.Phase)
+}
@@ -0,0 +1,117 @@
+/*
+Copyright 2021 The Cockroach Authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    https://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package update
+
+import (
+	"context"
+	"testing"
+
+	"github.com/Masterminds/semver/v3"
+	"github.com/go-logr/logr"
+	"github.com/stretchr/testify/require"
+	appsv1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes/fake"
+)
+
+func TestRollbackCockroachVersion(t *testing.T) {
+	ctx := context.Background()
+	oldImage, newImage := "cockroachdb/cockroach:v20.2.5", "cockroachdb/cockroach:v21.1.0"
+	selector := map[string]string{"app": "crdb"}
+	partition := int32(2)
+
+	sts := &appsv1.StatefulSet{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      "crdb",
+			Namespace: "default",
+			Annotations: map[string]string{
+				"crdb.io/version":        "v21.1.0",
+				"crdb.io/containerimage": newImage,
+			},
+		},
+		Spec: appsv1.StatefulSetSpec{
+			Selector: &metav1.LabelSelector{MatchLabels: selector},
+			UpdateStrategy: appsv1.StatefulSetUpdateStrategy{
+				RollingUpdate: &appsv1.RollingUpdateStatefulSetStrategy{Partition: &partition},
+			},
+			Template: corev1.PodTemplateSpec{
+				Spec: corev1.PodSpec{Containers: []corev1.Container{{Name: "db", Image: newImage}}},
+			},
+		},
+	}
+
+	pod := func(name, image string, ready bool, status corev1.ContainerStatus) *corev1.Pod {
+		readiness := corev1.ConditionFalse
+		if ready {
+			readiness = corev1.ConditionTrue
+		}
+		status.Name = "db"
+		return &corev1.Pod{
+			ObjectMeta: metav1.ObjectMeta{Name: name, Namespace: "default", Labels: selector},
+			Spec:       corev1.PodSpec{Containers: []corev1.Container{{Name: "db", Image: image}}},
+			Status: corev1.PodStatus{
+				Phase:             corev1.PodRunning,
+				Conditions:        []corev1.PodCondition{{Type: corev1.PodReady, Status: readiness}},
+				ContainerStatuses: []corev1.ContainerStatus{status},
+			},
+		}
+	}
+	crashing := corev1.ContainerStatus{
+		RestartCount: 4,
+		State: corev1.ContainerState{
+			Waiting: &corev1.ContainerStateWaiting{Reason: "CrashLoopBackOff"},
+		},
+		LastTerminationState: corev1.ContainerState{
+			Terminated: &corev1.ContainerStateTerminated{ExitCode: 1, Reason: "Error", Message: "incompatible store version"},
+		},
+	}
+
+	clientset := fake.NewSimpleClientset(sts,
+		pod("crdb-0", oldImage, true, corev1.ContainerStatus{}),
+		pod("crdb-1", oldImage, false, corev1.ContainerStatus{}),
+		pod("crdb-2", newImage, false, crashing),
+	)
+
+	update := &UpdateRoach{
+		CurrentVersion: semver.MustParse("v20.2.5"),
+		WantVersion:    semver.MustParse("v21.1.0"),
+		StsName:        "crdb",
+		StsNamespace:   "default",
+	}
+
+	diagnostics, err := RollbackCockroachVersion(ctx, clientset, update, oldImage, logr.Discard())
+	require.NoError(t, err)
+	require.Equal(t, []string{
+		"pod crdb-2: CrashLoopBackOff after 4 restarts, last exited with code 1 Error: incompatible store version",
+	}, diagnostics)
+
+	actual, err := clientset.AppsV1().StatefulSets("default").Get(ctx, "crdb", metav1.GetOptions{})
+	require.NoError(t, err)
+	require.Equal(t, oldImage, actual.Spec.Template.Spec.Containers[0].Image)
+	require.Equal(t, "v20.2.5", actual.Annotations["crdb.io/version"])
+	require.Equal(t, oldImage, actual.Annotations["crdb.io/containerimage"])
+	require.Equal(t, int32(0), *actual.Spec.UpdateStrategy.RollingUpdate.Partition)
+
+	pods, err := clientset.CoreV1().Pods("default").List(ctx, metav1.ListOptions{})
+	require.NoError(t, err)
+	var names []string
+	for _, p := range pods.Items {
+		names = append(names, p.Name)
+	}
+	require.ElementsMatch(t, []string{"crdb-0", "crdb-1"}, names)
+}
@@ -75,6 +75,8 @@ type UpdateTimer struct {
 	podUpdateTimeout      time.Duration
 	podMaxPollingInterval time.Duration
 	healthChecker         healthchecker.HealthChecker
+	// maxUnavailable is the number of pods updated at a time.
+	maxUnavailable int32
 	// TODO check that this func is actually correct
 	waitUntilAllPodsReadyFunc func(context.Context, logr.Logger) error
 }
@@ -106,6 +108,7 @@ func UpdateClusterRegionStatefulSet(
 	podUpdateTimeout time.Duration,
 	podMaxPollingInterval time.Duration,
 	healthChecker healthchecker.HealthChecker,
+	maxUnavailable int32,
 	l logr.Logger,
 ) (bool, error) {
 	l = l.WithName(namespace)
@@ -135,6 +138,7 @@ func UpdateClusterRegionStatefulSet(
 		podUpdateTimeout:          podUpdateTimeout,
 		podMaxPollingInterval:     podMaxPollingInterval,
 		healthChecker:             healthChecker,
+		maxUnavailable:            maxUnavailable,
 		waitUntilAllPodsReadyFunc: waitUntilAllPodsReadyFunc,
 	}
 	// updateStrategyFunc is responsible for controlling the rollout of the
@@ -148,18 +152,27 @@ func UpdateClusterRegionStatefulSet(
 }
 
 // partitionedRollingUpdateStrategy is an update strategy which updates the
-// pods in a statefulset one at a time, and verifies the health of the
-// cluster throughout the update.
+// pods in a statefulset in batches of maxUnavailable pods, one at a time by
+// default, and verifies the health of the cluster throughout the update.
 //
 // partitionedRollingUpdateStrategy checks that all pods are ready before
-// replacing a pod within a cluster.
+// replacing a batch of pods within a cluster.
 //
-// After a pod has been updated, the perPodVerificationFunc will run to ensure
-// the pod is in the expected state before continuing the update. This function
-// takes a Kubernetes clientset, the StatefulSet being modified, and the pod
-// number of the Statefulset that has just been updated. If it returns an error,
-// the update is halted.
+// After a batch has been updated, the perPodVerificationFunc will run on each
+// of its pods to ensure they are in the expected state before continuing the
+// update. This function takes a Kubernetes clientset, the StatefulSet being
+// modified, and the pod number of the Statefulset that has just been updated.
+// If it returns an error, the update is halted.
 func PartitionedRollingUpdateStrategy(perPodVerificationFunc func(*UpdateSts, int, logr.Logger) error,
+) func(updateSts *UpdateSts, updateTimer *UpdateTimer, l logr.Logger) (bool, error) {
+	return PartitionedRollingUpdateStrategyDownTo(perPodVerificationFunc, 0)
+}
+
+// PartitionedRollingUpdateStrategyDownTo is PartitionedRollingUpdateStrategy
+// stopping once the pods with an ordinal greater than or equal to
+// lowestPartition are updated. The other pods keep their revision.
+func PartitionedRollingUpdateStrategyDownTo(perPodVerificationFunc func(*UpdateSts, int, logr.Logger) error,
+	lowestPartition int32,
 ) func(updateSts *UpdateSts, updateTimer *UpdateTimer, l logr.Logger) (bool, error) {
 	return func(updateSts *UpdateSts, updateTimer *UpdateTimer, l logr.Logger) (bool, error) {
 		// When a StatefulSet's partition number is set to `n`, only StatefulSet pods
@@ -167,13 +180,18 @@ func PartitionedRollingUpdateStrategy(perPodVerificationFunc func(*UpdateSts, in
 		// https://kubernetes.io/docs/concepts/workloads/controllers/statefulset/#partitions
 		skipSleep := false
 		sts := updateSts.sts
-		for partition := *sts.Spec.Replicas - 1; partition >= 0; partition-- {
+		batch := updateTimer.batchSize()
+		for top := *sts.Spec.Replicas - 1; top >= lowestPartition; top -= batch {
 			stsName := sts.Name
 			stsNamespace := sts.Namespace
+			partition := top - batch + 1
+			if partition < lowestPartition {
+				partition = lowestPartition
+			}
 
-			// If pod already updated, we are probably retrying a failed job
+			// If the pods are already updated, we are probably retrying a failed job
 			// attempt. Best not to redo the update in that case, especially the sleeps!!
-			if err := perPodVerificationFunc(updateSts, int(partition), l); err == nil {
+			if podsVerify(updateSts, perPodVerificationFunc, top, partition, l) {
 				l.V(int(zapcore.DebugLevel)).Info("already updated, skipping sleep", "partition", partition)
 				skipSleep = true
 				continue
@@ -212,12 +230,26 @@ func PartitionedRollingUpdateStrategy(perPodVerificationFunc func(*UpdateSts, in
 				return false, handleStsError(err, l, stsName, stsNamespace)
 			}
 
-			// Wait until verificationFunction verifies the update, passing in
-			// the current partition so the function knows which pod to check
-			// the status of.
-			l.V(int(zapcore.DebugLevel)).Info("waiting until partition done updating", "partition number:", partition)
-			if err := waitUntilPerPodVerificationFuncVerifies(updateSts, perPodVerificationFunc, int(partition), updateTimer, l); err != nil {
-				return false, errors.Wrapf(err, "error while running verificationFunc on pod %d", int(partition))
+			// The StatefulSet controller replaces the pods one at a time,
+			// whatever the partition, so the other pods of the batch are
+			// deleted to be recreated with the new revision together.
+			if top > partition {
+				if err := replaceBatch(updateSts, updateTimer, top, partition, l); err != nil {
+					return false, err
+				}
+			}
+
+			// Wait until verificationFunction verifies the update of each pod
+			// of the batch, passing in the pod number so the function knows
+			// which pod to check the status of.
+			l.V(int(zapcore.DebugLevel)).Info("waiting until partition done updating", "partition number:", partition, "pods", top-partition+1)
+			for pod := top; pod >= partition; pod-- {
+				if err := waitUntilPerPodVerificationFuncVerifies(updateSts, perPodVerificationFunc, int(pod), updateTimer, l); err != nil {
+					return false, PodUpdateTimeoutErr{
+						PodNumber: int(pod),
+						Err:       errors.Wrapf(err, "error while running verificationFunc on pod %d", int(pod)),
+					}
+				}
 			}
 
 			// Must refresh STS object, or the next time through the loop
@@ -235,6 +267,101 @@ func PartitionedRollingUpdateStrategy(perPodVerificationFunc func(*UpdateSts, in
 	}
 }
 
+// batchSize is the number of pods updated at a time.
+func (t *UpdateTimer) batchSize() int32 {
+	if t.maxUnavailable < 1 {
+		return 1
+	}
+	return t.maxUnavailable
+}
+
+// replaceBatch deletes the pods from top down to bottom that do not run the
+// update revision of the StatefulSet, once the StatefulSet controller has
+// observed the new partition. They are then recreated together, instead of
+// one at a time by the rolling update.
+func replaceBatch(
+	updateSts *UpdateSts,
+	updateTimer *UpdateTimer,
+	top int32,
+	bottom int32,
+	l logr.Logger,
+) error {
+	ctx := updateSts.ctx
+	stsName := updateSts.sts.Name
+	stsNamespace := updateSts.sts.Namespace
+
+	var revision string
+	f := func() error {
+		sts, err := updateSts.clientset.AppsV1().StatefulSets(stsNamespace).Get(ctx, stsName, metav1.GetOptions{})
+		if err != nil {
+			return backoff.Permanent(handleStsError(err, l, stsName, stsNamespace))
+		}
+		if sts.Status.ObservedGeneration < sts.Generation || sts.Status.UpdateRevision == "" {
+			return errors.Newf("statefulset %s has not observed generation %d yet", stsName, sts.Generation)
+		}
+		revision = sts.Status.UpdateRevision
+		return nil
+	}
+	b := backoff.NewExponentialBackOff()
+	b.MaxElapsedTime = updateTimer.podUpdateTimeout
+	b.MaxInterval = updateTimer.podMaxPollingInterval
+	if err := backoff.Retry(f, b); err != nil {
+		return errors.Wrapf(err, "error while waiting for the new partition of %s", stsName)
+	}
+
+	pods := updateSts.clientset.CoreV1().Pods(stsNamespace)
+	for ordinal := top; ordinal >= bottom; ordinal-- {
+		podName := fmt.Sprintf("%s-%d", stsName, ordinal)
+		pod, err := pods.Get(ctx, podName, metav1.GetOptions{})
+		if k8sErrors.IsNotFound(err) {
+			continue
+		} else if err != nil {
+			return errors.Wrapf(err, "failed to get pod %s", podName)
+		}
+		if pod.DeletionTimestamp != nil || pod.Labels[v1.ControllerRevisionHashLabelKey] == revision {
+			continue
+		}
+
+		if err := pods.Delete(ctx, podName, metav1.DeleteOptions{}); err != nil && !k8sErrors.IsNotFound(err) {
+			return errors.Wrapf(err, "failed to delete pod %s", podName)
+		}
+		l.V(int(zapcore.DebugLevel)).Info("deleted a pod of the batch", "pod", podName, "revision", revision)
+	}
+	return nil
+}
+
+// podsVerify returns whether perPodVerificationFunc verifies the pods from
+// top down to bottom.
+func podsVerify(
+	updateSts *UpdateSts,
+	perPodVerificationFunc func(*UpdateSts, int, logr.Logger) error,
+	top int32,
+	bottom int32,
+	l logr.Logger,
+) bool {
+	for pod := top; pod >= bottom; pod-- {
+		if err := perPodVerificationFunc(updateSts, int(pod), l); err != nil {
+			return false
+		}
+	}
+	return true
+}
+
+// PodUpdateTimeoutErr is returned by PartitionedRollingUpdateStrategy when an
+// updated pod is not verified within the pod update timeout.
+type PodUpdateTimeoutErr struct {
+	PodNumber int
+	Err       error
+}
+
+func (e PodUpdateTimeoutErr) Error() string {
+	return e.Err.Error()
+}
+
+func (e PodUpdateTimeoutErr) Unwrap() error {
+	return e.Err
+}
+
 func waitUntilPerPodVerificationFuncVerifies(
 	updateSts *UpdateSts,
 	perPodVerificationFunc func(*UpdateSts, int, logr.Logger) error,
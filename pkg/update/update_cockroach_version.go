@@ -58,6 +58,9 @@ type UpdateRoach struct {
 	StsName        string
 	StsNamespace   string
 	Db             *sql.DB
+	// Partition is the lowest ordinal of the pods upgraded, the other pods
+	// keep the current version. All the pods are upgraded when it is zero.
+	Partition int32
 }
 
 type UpdateCluster struct {
@@ -65,6 +68,24 @@ type UpdateCluster struct {
 	PodUpdateTimeout      time.Duration
 	PodMaxPollingInterval time.Duration
 	HealthChecker         healthchecker.HealthChecker
+	// MaxUnavailable is the number of pods updated at a time. The pods are
+	// updated one at a time when it is not positive.
+	MaxUnavailable int32
+	// OnProgress is called each time a pod is verified to run the new version.
+	// It is optional.
+	OnProgress func(Progress)
+	// OnWait is called when the update starts waiting for a pod to run the new
+	// version and become ready. It is optional.
+	OnWait func(podNumber int)
+}
+
+// Progress is the number of pods of the StatefulSet that run the new version.
+// The pods are updated from the highest ordinal down, so the pods with an
+// ordinal greater than or equal to Partition are updated.
+type Progress struct {
+	Partition    int32
+	UpdatedPods  int32
+	OutdatedPods int32
 }
 
 // UpdateClusterCockroachVersion, and allows specifying custom pod timeouts,
@@ -108,11 +129,14 @@ func UpdateClusterCockroachVersion(
 	}
 
 	updateFunction := makeUpdateCockroachVersionFunction(wantImage, update.WantVersion.Original(), update.CurrentVersion.Original())
-	perPodVerificationFunction := makeIsCRBPodIsRunningNewVersionFunction(
-		wantImage,
+	perPodVerificationFunction := reportProgress(
+		makeIsCRBPodIsRunningNewVersionFunction(wantImage),
+		cluster.OnProgress,
+		cluster.OnWait,
 	)
-	updateStrategyFunction := PartitionedRollingUpdateStrategy(
+	updateStrategyFunction := PartitionedRollingUpdateStrategyDownTo(
 		perPodVerificationFunction,
+		update.Partition,
 	)
 
 	updateSuite := &updateFunctionSuite{
@@ -145,6 +169,7 @@ func updateClusterStatefulSets(
 		cluster.PodUpdateTimeout,
 		cluster.PodMaxPollingInterval,
 		cluster.HealthChecker,
+		cluster.MaxUnavailable,
 		l)
 	if err != nil {
 		return err
@@ -152,6 +177,40 @@ func updateClusterStatefulSets(
 	return nil
 }
 
+// reportProgress wraps a per pod verification function so that onProgress is
+// called each time a pod is verified, and onWait the first time a pod is not.
+func reportProgress(
+	perPodVerificationFunc func(*UpdateSts, int, logr.Logger) error,
+	onProgress func(Progress),
+	onWait func(podNumber int),
+) func(*UpdateSts, int, logr.Logger) error {
+	if onProgress == nil && onWait == nil {
+		return perPodVerificationFunc
+	}
+
+	waiting := -1
+	return func(update *UpdateSts, podNumber int, l logr.Logger) error {
+		if err := perPodVerificationFunc(update, podNumber, l); err != nil {
+			if onWait != nil && podNumber != waiting {
+				waiting = podNumber
+				onWait(podNumber)
+			}
+			return err
+		}
+
+		if onProgress == nil {
+			return nil
+		}
+		replicas := *update.sts.Spec.Replicas
+		onProgress(Progress{
+			Partition:    int32(podNumber),
+			UpdatedPods:  replicas - int32(podNumber),
+			OutdatedPods: int32(podNumber),
+		})
+		return nil
+	}
+}
+
 // waitUntilAllPodsReady waits until all pods in all statefulsets are in the
 // ready state. The ready state implies all nodes are passing node liveness.
 func makeWaitUntilAllPodsReadyFunc(
@@ -228,7 +287,7 @@ func kindAndCheckPreserveDowngradeSetting(
 		return s, nil
 	} else if isBackOneMajorVersion(wantVersion, currentVersion) {
 		l.V(int(zapcore.DebugLevel)).Info("major rollback")
-		return CheckDowngradeSetting(ctx, wantVersion, currentVersion, db)
+		return CheckDowngradeSetting(ctx, wantVersion, currentVersion, db, l)
 	}
 
 	err := UpdateNotAllowed{
@@ -242,13 +301,27 @@ func kindAndCheckPreserveDowngradeSetting(
 
 // CheckDowngradeSetting retrieves the downgrade setting from the database and then tests that the update is feasible.
 // This func will return an error if the update is not to the Major and Minor version that is requested.
-func CheckDowngradeSetting(ctx context.Context, wantVersion *semver.Version, currentVersion *semver.Version, db *sql.DB) (string, error) {
+// An upgrade that was not finalized can still be rolled back when the downgrade setting is unset: the
+// setting is then pinned to the wanted version, so that the upgrade does not finalize during the rollback.
+func CheckDowngradeSetting(ctx context.Context, wantVersion *semver.Version, currentVersion *semver.Version, db *sql.DB, l logr.Logger) (string, error) {
 	s := "MAJOR_ROLLBACK"
 	preserve, err := preserveDowngradeSetting(ctx, db)
 	if err != nil {
 		return s, err
 	}
-	return checkDowngradeAllowed(wantVersion, currentVersion, preserve)
+	if preserve.Compare(&semver.Version{}) != 0 {
+		return checkDowngradeAllowed(wantVersion, currentVersion, preserve)
+	}
+
+	if err := checkNotFinalized(ctx, wantVersion, currentVersion, db); err != nil {
+		return s, err
+	}
+	// the option is set to the release rolled back to
+	if err := setDowngradeOption(ctx, currentVersion, wantVersion, db, l); err != nil {
+		return s, errors.Wrapf(err, "setting downgrade option for major rollback failed")
+	}
+	// the upgrade may have finalized before the downgrade option was set
+	return s, checkNotFinalized(ctx, wantVersion, currentVersion, db)
 }
 
 func checkDowngradeAllowed(wantVersion *semver.Version, currentVersion *semver.Version, preserve *semver.Version) (string, error) {
@@ -282,6 +355,24 @@ func preserveDowngradeSetting(ctx context.Context, db *sql.DB) (*semver.Version,
 	return preserveDowngradeVersion, nil
 }
 
+// checkNotFinalized returns an error unless the cluster version is still the
+// release of the wanted version. The cluster version has an internal suffix,
+// e.g. 21.1-14, once the upgrade starts to finalize.
+func checkNotFinalized(ctx context.Context, wantVersion *semver.Version, currentVersion *semver.Version, db *sql.DB) error {
+	version, err := clustersql.GetClusterSetting(ctx, db, "version")
+	if err != nil {
+		return errors.Wrapf(err, "getting cluster version failed")
+	}
+	if version != fmt.Sprintf("%d.%d", wantVersion.Major(), wantVersion.Minor()) {
+		return UpdateNotAllowed{
+			cur:   currentVersion,
+			want:  wantVersion,
+			extra: fmt.Sprintf("can't rollback since cluster version is already %s", version),
+		}
+	}
+	return nil
+}
+
 func setDowngradeOption(ctx context.Context, wantVersion *semver.Version, currentVersion *semver.Version, db *sql.DB, l logr.Logger) error {
 	newDowngradeOption := fmt.Sprintf("%d.%d", currentVersion.Major(), currentVersion.Minor())
 	if !validPreserveDowngradeOptionSetting.MatchString(newDowngradeOption) {
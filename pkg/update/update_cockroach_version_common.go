@@ -39,10 +39,14 @@ func makeUpdateCockroachVersionFunction(
 ) func(sts *v1.StatefulSet) (*v1.StatefulSet, error) {
 	return func(sts *v1.StatefulSet) (*v1.StatefulSet, error) {
 		timeNow := metav1.Now()
-		if val, ok := sts.Annotations[resource.CrdbHistoryAnnotation]; !ok {
-			sts.Annotations[resource.CrdbHistoryAnnotation] = fmt.Sprintf("%s=%s", timeNow.Format(time.RFC3339), oldVersion)
-		} else {
-			sts.Annotations[resource.CrdbHistoryAnnotation] = fmt.Sprintf("%s %s=%s", val, timeNow.Format(time.RFC3339), oldVersion)
+		// the upgrade of the rest of the pods after the canaries is already
+		// in the history
+		if sts.Annotations[resource.CrdbVersionAnnotation] != version {
+			if val, ok := sts.Annotations[resource.CrdbHistoryAnnotation]; !ok {
+				sts.Annotations[resource.CrdbHistoryAnnotation] = fmt.Sprintf("%s=%s", timeNow.Format(time.RFC3339), oldVersion)
+			} else {
+				sts.Annotations[resource.CrdbHistoryAnnotation] = fmt.Sprintf("%s %s=%s", val, timeNow.Format(time.RFC3339), oldVersion)
+			}
 		}
 		sts.Annotations[resource.CrdbVersionAnnotation] = version
 		sts.Annotations[resource.CrdbContainerImageAnnotation] = cockroachImage
@@ -17,10 +17,15 @@ limitations under the License.
 package update
 
 import (
+	"context"
 	"testing"
 
+	"github.com/DATA-DOG/go-sqlmock"
 	semver "github.com/Masterminds/semver/v3"
+	"github.com/cockroachdb/errors"
+	"github.com/go-logr/logr"
 	"github.com/stretchr/testify/require"
+	appsv1 "k8s.io/api/apps/v1"
 )
 
 func TestPerserveMatches(t *testing.T) {
@@ -72,3 +77,95 @@ func TestPerserveMatches(t *testing.T) {
 		})
 	}
 }
+
+func TestCheckDowngradeSetting(t *testing.T) {
+	tests := []struct {
+		description string
+		preserve    string
+		versions    []string
+		allowed     bool
+	}{
+		{
+			description: "preserve downgrade option set to the release rolled back to",
+			preserve:    "21.1",
+			allowed:     true,
+		},
+		{
+			description: "preserve downgrade option set to another release",
+			preserve:    "20.2",
+		},
+		{
+			description: "upgrade not finalized",
+			versions:    []string{"21.1", "21.1"},
+			allowed:     true,
+		},
+		{
+			description: "upgrade finalized",
+			versions:    []string{"21.2"},
+		},
+		{
+			description: "upgrade finalizing",
+			versions:    []string{"21.1-14"},
+		},
+		{
+			description: "upgrade finalized before the option was set",
+			versions:    []string{"21.1", "21.1-14"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.description, func(t *testing.T) {
+			db, mock, err := sqlmock.New()
+			require.NoError(t, err)
+			defer db.Close()
+
+			mock.ExpectQuery("SHOW CLUSTER SETTING cluster.preserve_downgrade_option").
+				WillReturnRows(sqlmock.NewRows([]string{"value"}).AddRow(tt.preserve))
+			for i, version := range tt.versions {
+				// the option is set between the two checks of the version
+				if i == 1 {
+					mock.ExpectExec("SET CLUSTER SETTING cluster.preserve_downgrade_option = \\$1").
+						WithArgs("21.1").
+						WillReturnResult(sqlmock.NewResult(0, 0))
+				}
+				mock.ExpectQuery("SHOW CLUSTER SETTING version").
+					WillReturnRows(sqlmock.NewRows([]string{"value"}).AddRow(version))
+			}
+
+			_, err = CheckDowngradeSetting(context.Background(), semver.MustParse("21.1.5"), semver.MustParse("21.2.0"), db, logr.Discard())
+			if tt.allowed {
+				require.NoError(t, err)
+			} else {
+				require.True(t, errors.As(err, &UpdateNotAllowed{}))
+			}
+			require.NoError(t, mock.ExpectationsWereMet())
+		})
+	}
+}
+
+func TestReportProgress(t *testing.T) {
+	replicas := int32(3)
+	sts := &appsv1.StatefulSet{Spec: appsv1.StatefulSetSpec{Replicas: &replicas}}
+	updated := map[int]bool{2: true, 1: true}
+	verify := func(_ *UpdateSts, podNumber int, _ logr.Logger) error {
+		if !updated[podNumber] {
+			return errors.Newf("pod %d is not updated", podNumber)
+		}
+		return nil
+	}
+
+	var reported []Progress
+	var waited []int
+	f := reportProgress(verify, func(p Progress) { reported = append(reported, p) }, func(pod int) { waited = append(waited, pod) })
+	for pod := 2; pod >= 0; pod-- {
+		_ = f(&UpdateSts{sts: sts}, pod, logr.Discard())
+	}
+	// the wait for a pod is reported once, however often it is verified
+	_ = f(&UpdateSts{sts: sts}, 0, logr.Discard())
+
+	require.Equal(t, []Progress{
+		{Partition: 2, UpdatedPods: 1, OutdatedPods: 2},
+		{Partition: 1, UpdatedPods: 2, OutdatedPods: 1},
+	}, reported)
+	require.Equal(t, []int{0}, waited)
+}
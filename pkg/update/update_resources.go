@@ -0,0 +1,382 @@
+/*
+Copyright 2021 The Cockroach Authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    https://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package update
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+
+	"github.com/cenkalti/backoff"
+	"github.com/cockroachdb/cockroach-operator/pkg/kube"
+	"github.com/cockroachdb/errors"
+	"github.com/go-logr/logr"
+	"go.uber.org/zap/zapcore"
+	v1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+	k8sErrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/util/retry"
+)
+
+// ErrInPlaceResizeUnsupported is returned by ResizeInPlace when the Kubernetes
+// cluster cannot change the resources of a running pod.
+var ErrInPlaceResizeUnsupported = errors.New("in-place pod resize is not supported")
+
+// UpdateResources describes a change of the resources of a container of the
+// pods of a StatefulSet.
+type UpdateResources struct {
+	Resources     corev1.ResourceRequirements
+	ContainerName string
+	StsName       string
+	StsNamespace  string
+}
+
+// UpdateClusterResources changes the resources of the container in the
+// StatefulSet and replaces its pods in batches of MaxUnavailable pods,
+// verifying the health of the cluster between two batches. The pods drain their node when they stop.
+func UpdateClusterResources(
+	ctx context.Context,
+	update *UpdateResources,
+	cluster *UpdateCluster,
+	l logr.Logger,
+) error {
+	l.V(int(zapcore.InfoLevel)).Info("starting rolling resize", "sts", update.StsName)
+
+	updateSuite := &updateFunctionSuite{
+		updateFunc:         makeUpdateResourcesFunc(update),
+		updateStrategyFunc: PartitionedRollingUpdateStrategy(makeIsPodResizedFunc(update)),
+	}
+
+	_, err := UpdateClusterRegionStatefulSet(
+		ctx,
+		cluster.Clientset,
+		update.StsName,
+		update.StsNamespace,
+		updateSuite,
+		makeWaitUntilAllPodsReadyFunc(ctx, cluster, &UpdateRoach{StsName: update.StsName, StsNamespace: update.StsNamespace}),
+		cluster.PodUpdateTimeout,
+		cluster.PodMaxPollingInterval,
+		cluster.HealthChecker,
+		cluster.MaxUnavailable,
+		l)
+	if err != nil {
+		return errors.Wrapf(err, "error resizing sts: %s namespace: %s", update.StsName, update.StsNamespace)
+	}
+
+	l.V(int(zapcore.InfoLevel)).Info("finished rolling resize", "sts", update.StsName)
+	return nil
+}
+
+// ResizeInPlace changes the resources of the container in the StatefulSet and
+// in its running pods, one pod at a time, without restarting them. It returns
+// ErrInPlaceResizeUnsupported if the first pod cannot be resized, in which case
+// nothing changed for the pods.
+//
+// The StatefulSet controller recreates the pods whose controller-revision-hash
+// label is not the update revision of the StatefulSet, from the partition up.
+// The partition is held at the number of replicas while the template changes,
+// and a resized pod is labeled with the update revision, whose template only
+// differs from the previous one by the resources the pod now has. Lifting the
+// partition then recreates none of the pods. A later change of the template
+// makes a new update revision, which the StatefulSet controller rolls out to
+// the resized pods like to any other.
+func ResizeInPlace(
+	ctx context.Context,
+	update *UpdateResources,
+	cluster *UpdateCluster,
+	l logr.Logger,
+) error {
+	l.V(int(zapcore.InfoLevel)).Info("starting in-place resize", "sts", update.StsName)
+	statefulSets := cluster.Clientset.AppsV1().StatefulSets(update.StsNamespace)
+	updateFunc := makeUpdateResourcesFunc(update)
+
+	// hold off the StatefulSet controller while the template changes
+	var replicas int32
+	var generation int64
+	err := retry.RetryOnConflict(retry.DefaultRetry, func() error {
+		sts, err := statefulSets.Get(ctx, update.StsName, metav1.GetOptions{})
+		if err != nil {
+			return err
+		}
+		if sts, err = updateFunc(sts); err != nil {
+			return err
+		}
+
+		replicas = *sts.Spec.Replicas
+		sts.Spec.UpdateStrategy.RollingUpdate = &v1.RollingUpdateStatefulSetStrategy{
+			Partition: &replicas,
+		}
+		updated, err := statefulSets.Update(ctx, sts, metav1.UpdateOptions{})
+		if err != nil {
+			return err
+		}
+		generation = updated.Generation
+		return nil
+	})
+	if err != nil {
+		return handleStsError(err, l, update.StsName, update.StsNamespace)
+	}
+
+	revision, err := waitForUpdateRevision(ctx, update, cluster, generation)
+	if err != nil {
+		return err
+	}
+
+	waitUntilAllPodsReady := makeWaitUntilAllPodsReadyFunc(ctx, cluster, &UpdateRoach{StsName: update.StsName, StsNamespace: update.StsNamespace})
+	resized := false
+	for ordinal := replicas - 1; ordinal >= 0; ordinal-- {
+		podName := fmt.Sprintf("%s-%d", update.StsName, ordinal)
+		pod, err := cluster.Clientset.CoreV1().Pods(update.StsNamespace).Get(ctx, podName, metav1.GetOptions{})
+		if err != nil {
+			return errors.Wrapf(err, "failed to get pod %s", podName)
+		}
+
+		// a previous attempt may have resized the pod already
+		if pod.Labels[v1.ControllerRevisionHashLabelKey] == revision && podHasResources(pod, update) {
+			resized = true
+			continue
+		}
+
+		if err := waitUntilAllPodsReady(ctx, l); err != nil {
+			return errors.Wrapf(err, "error while waiting for all pods to be ready")
+		}
+
+		if err := resizePod(ctx, cluster, update, pod, revision); err != nil {
+			if errors.Is(err, ErrInPlaceResizeUnsupported) && resized {
+				// restarting the other pods instead would restart the pods
+				// that were resized already
+				return errors.Newf("failed to resize pod %s after resizing others in place: %v", podName, err)
+			}
+			return err
+		}
+		resized = true
+		l.V(int(zapcore.DebugLevel)).Info("resized pod in place", "pod", podName)
+
+		if err := cluster.HealthChecker.Probe(ctx, l, fmt.Sprintf("between resizing pods for %s", update.StsName), int(ordinal)); err != nil {
+			return err
+		}
+	}
+
+	// every pod is on the new revision, so lifting the partition does not
+	// restart any of them
+	err = retry.RetryOnConflict(retry.DefaultRetry, func() error {
+		sts, err := statefulSets.Get(ctx, update.StsName, metav1.GetOptions{})
+		if err != nil {
+			return err
+		}
+
+		var partition int32
+		sts.Spec.UpdateStrategy.RollingUpdate = &v1.RollingUpdateStatefulSetStrategy{
+			Partition: &partition,
+		}
+		_, err = statefulSets.Update(ctx, sts, metav1.UpdateOptions{})
+		return err
+	})
+	if err != nil {
+		return handleStsError(err, l, update.StsName, update.StsNamespace)
+	}
+
+	l.V(int(zapcore.InfoLevel)).Info("finished in-place resize", "sts", update.StsName)
+	return nil
+}
+
+// resizePod changes the resources of the container of a running pod and labels
+// it with the given StatefulSet revision, once the pod matches its template.
+func resizePod(ctx context.Context, cluster *UpdateCluster, update *UpdateResources, pod *corev1.Pod, revision string) error {
+	pods := cluster.Clientset.CoreV1().Pods(pod.Namespace)
+
+	container, err := kube.FindContainer(update.ContainerName, &pod.Spec)
+	if err != nil {
+		return err
+	}
+
+	// the patch removes the resources that are no longer set, which a merge
+	// of the maps would keep
+	limits := make(map[corev1.ResourceName]interface{})
+	for name := range container.Resources.Limits {
+		limits[name] = nil
+	}
+	for name, quantity := range update.Resources.Limits {
+		limits[name] = quantity.String()
+	}
+
+	requests := make(map[corev1.ResourceName]interface{})
+	for name := range container.Resources.Requests {
+		requests[name] = nil
+	}
+	for name, quantity := range update.Resources.Limits {
+		requests[name] = quantity.String()
+	}
+	for name, quantity := range update.Resources.Requests {
+		requests[name] = quantity.String()
+	}
+
+	resize, err := json.Marshal(map[string]interface{}{
+		"spec": map[string]interface{}{
+			"containers": []map[string]interface{}{{
+				"name": update.ContainerName,
+				"resources": map[string]interface{}{
+					"limits":   limits,
+					"requests": requests,
+				},
+			}},
+		},
+	})
+	if err != nil {
+		return err
+	}
+
+	// recent Kubernetes versions only accept resizes through the resize
+	// subresource, older ones on the pod itself, which is invalid when the
+	// feature is disabled. Any other error, such as a missing permission or a
+	// resize that would change the QoS class of the pod, is a failure.
+	_, err = pods.Patch(ctx, pod.Name, types.StrategicMergePatchType, resize, metav1.PatchOptions{}, "resize")
+	if k8sErrors.IsNotFound(err) || k8sErrors.IsMethodNotSupported(err) {
+		_, err = pods.Patch(ctx, pod.Name, types.StrategicMergePatchType, resize, metav1.PatchOptions{})
+		if k8sErrors.IsInvalid(err) || k8sErrors.IsMethodNotSupported(err) {
+			return errors.Mark(errors.Wrapf(err, "failed to resize pod %s", pod.Name), ErrInPlaceResizeUnsupported)
+		}
+	}
+	if err != nil {
+		return errors.Wrapf(err, "failed to resize pod %s", pod.Name)
+	}
+
+	relabel, err := json.Marshal(map[string]interface{}{
+		"metadata": map[string]interface{}{
+			"labels": map[string]string{v1.ControllerRevisionHashLabelKey: revision},
+		},
+	})
+	if err != nil {
+		return err
+	}
+
+	if _, err := pods.Patch(ctx, pod.Name, types.MergePatchType, relabel, metav1.PatchOptions{}); err != nil {
+		return errors.Wrapf(err, "failed to label pod %s with revision %s", pod.Name, revision)
+	}
+
+	return nil
+}
+
+// waitForUpdateRevision waits until the StatefulSet controller has seen the
+// generation of the StatefulSet with the updated template and returns the
+// revision of it. It fails if the StatefulSet changed again, since the update
+// revision would then hold more than the new resources.
+func waitForUpdateRevision(ctx context.Context, update *UpdateResources, cluster *UpdateCluster, generation int64) (string, error) {
+	var revision string
+	f := func() error {
+		sts, err := cluster.Clientset.AppsV1().StatefulSets(update.StsNamespace).Get(ctx, update.StsName, metav1.GetOptions{})
+		if err != nil {
+			return err
+		}
+		if sts.Generation != generation {
+			return backoff.Permanent(errors.Newf("statefulset %s changed during the resize, generation %d instead of %d", update.StsName, sts.Generation, generation))
+		}
+		if sts.Status.ObservedGeneration < sts.Generation || sts.Status.UpdateRevision == "" {
+			return fmt.Errorf("statefulset %s has not observed generation %d yet", update.StsName, sts.Generation)
+		}
+
+		revision = sts.Status.UpdateRevision
+		return nil
+	}
+
+	b := backoff.NewExponentialBackOff()
+	b.MaxElapsedTime = cluster.PodUpdateTimeout
+	b.MaxInterval = cluster.PodMaxPollingInterval
+	if err := backoff.Retry(f, b); err != nil {
+		return "", errors.Wrapf(err, "failed to get the revision of sts %s", update.StsName)
+	}
+
+	return revision, nil
+}
+
+// makeUpdateResourcesFunc returns a function which sets the resources of the
+// container in the StatefulSet.
+func makeUpdateResourcesFunc(update *UpdateResources) func(sts *v1.StatefulSet) (*v1.StatefulSet, error) {
+	return func(sts *v1.StatefulSet) (*v1.StatefulSet, error) {
+		container, err := kube.FindContainer(update.ContainerName, &sts.Spec.Template.Spec)
+		if err != nil {
+			return nil, err
+		}
+
+		container.Resources = update.Resources
+		return sts, nil
+	}
+}
+
+// makeIsPodResizedFunc returns a function which checks that a pod of the
+// StatefulSet has the new resources and is ready.
+func makeIsPodResizedFunc(update *UpdateResources) func(updateSts *UpdateSts, podNumber int, l logr.Logger) error {
+	return func(updateSts *UpdateSts, podNumber int, l logr.Logger) error {
+		podName := fmt.Sprintf("%s-%d", updateSts.name, podNumber)
+		pod, err := updateSts.clientset.CoreV1().Pods(updateSts.namespace).Get(updateSts.ctx, podName, metav1.GetOptions{})
+		if err != nil {
+			return err
+		}
+
+		if !podHasResources(pod, update) {
+			l.V(int(zapcore.DebugLevel)).Info("pod is not resized yet", "podName", podName)
+			return fmt.Errorf("%s pod is not resized yet", podName)
+		}
+
+		if !kube.IsPodReady(pod) {
+			l.V(int(zapcore.DebugLevel)).Info("pod is not ready yet", "podName", podName)
+			return fmt.Errorf("%s pod not ready yet", podName)
+		}
+
+		return nil
+	}
+}
+
+// podHasResources returns whether the container of the pod has the resources
+// of the update. The API server defaults the requests of a pod to its limits,
+// which is accounted for.
+func podHasResources(pod *corev1.Pod, update *UpdateResources) bool {
+	container, err := kube.FindContainer(update.ContainerName, &pod.Spec)
+	if err != nil {
+		return false
+	}
+
+	want, got := update.Resources, container.Resources
+	if len(got.Limits) != len(want.Limits) {
+		return false
+	}
+	for name, quantity := range want.Limits {
+		if q, ok := got.Limits[name]; !ok || q.Cmp(quantity) != 0 {
+			return false
+		}
+	}
+
+	for name, q := range got.Requests {
+		quantity, ok := want.Requests[name]
+		if !ok {
+			// defaulted from the limit
+			quantity, ok = want.Limits[name]
+		}
+		if !ok || q.Cmp(quantity) != 0 {
+			return false
+		}
+	}
+	for name := range want.Requests {
+		if _, ok := got.Requests[name]; !ok {
+			return false
+		}
+	}
+
+	return true
+}
@@ -0,0 +1,242 @@
+/*
+Copyright 2021 The Cockroach Authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    https://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package update
+
+import (
+	"context"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/cockroachdb/errors"
+	"github.com/go-logr/logr"
+	"github.com/stretchr/testify/require"
+	appsv1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+	k8sErrors "k8s.io/apimachinery/pkg/api/errors"
+	apiresource "k8s.io/apimachinery/pkg/api/resource"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apimachinery/pkg/util/validation/field"
+	"k8s.io/client-go/kubernetes/fake"
+	clienttesting "k8s.io/client-go/testing"
+)
+
+type healthCheckerTest struct{}
+
+func (hc *healthCheckerTest) Probe(ctx context.Context, l logr.Logger, logSuffix string, partition int) error {
+	return nil
+}
+
+func resources(cpu, memory string) corev1.ResourceRequirements {
+	return corev1.ResourceRequirements{
+		Limits: corev1.ResourceList{
+			corev1.ResourceCPU:    apiresource.MustParse(cpu),
+			corev1.ResourceMemory: apiresource.MustParse(memory),
+		},
+	}
+}
+
+func TestPodHasResources(t *testing.T) {
+	update := &UpdateResources{ContainerName: "db", Resources: resources("2", "8Gi")}
+
+	pod := func(r corev1.ResourceRequirements) *corev1.Pod {
+		return &corev1.Pod{Spec: corev1.PodSpec{Containers: []corev1.Container{{Name: "db", Resources: r}}}}
+	}
+
+	defaulted := resources("2000m", "8Gi")
+	defaulted.Requests = defaulted.Limits.DeepCopy()
+	require.True(t, podHasResources(pod(defaulted), update))
+
+	require.False(t, podHasResources(pod(resources("1", "8Gi")), update))
+
+	smaller := resources("2", "8Gi")
+	smaller.Requests = corev1.ResourceList{corev1.ResourceCPU: apiresource.MustParse("1")}
+	require.False(t, podHasResources(pod(smaller), update))
+
+	require.False(t, podHasResources(&corev1.Pod{}, update))
+}
+
+// outdatedPods returns the pods the StatefulSet controller would recreate: the
+// ones from the partition up that are not labeled with the update revision.
+func outdatedPods(t *testing.T, clientset *fake.Clientset, name string) []string {
+	ctx := context.Background()
+	sts, err := clientset.AppsV1().StatefulSets("default").Get(ctx, name, metav1.GetOptions{})
+	require.NoError(t, err)
+
+	var partition int32
+	if rollingUpdate := sts.Spec.UpdateStrategy.RollingUpdate; rollingUpdate != nil && rollingUpdate.Partition != nil {
+		partition = *rollingUpdate.Partition
+	}
+
+	var outdated []string
+	for i := partition; i < *sts.Spec.Replicas; i++ {
+		pod, err := clientset.CoreV1().Pods("default").Get(ctx, fmt.Sprintf("%s-%d", name, i), metav1.GetOptions{})
+		require.NoError(t, err)
+		if pod.Labels[appsv1.ControllerRevisionHashLabelKey] != sts.Status.UpdateRevision {
+			outdated = append(outdated, pod.Name)
+		}
+	}
+	return outdated
+}
+
+func TestResizeInPlace(t *testing.T) {
+	var replicas int32 = 3
+	old, wanted := resources("1", "4Gi"), resources("2", "8Gi")
+
+	newClientset := func() *fake.Clientset {
+		sts := &appsv1.StatefulSet{
+			ObjectMeta: metav1.ObjectMeta{Name: "crdb", Namespace: "default", Generation: 2},
+			Spec: appsv1.StatefulSetSpec{
+				Replicas: &replicas,
+				Template: corev1.PodTemplateSpec{
+					Spec: corev1.PodSpec{Containers: []corev1.Container{{Name: "db", Resources: old}}},
+				},
+			},
+			Status: appsv1.StatefulSetStatus{
+				ObservedGeneration: 2,
+				Replicas:           replicas,
+				ReadyReplicas:      replicas,
+				CurrentRevision:    "crdb-1",
+				UpdateRevision:     "crdb-2",
+			},
+		}
+
+		objs := []runtime.Object{sts}
+		for i := int32(0); i < replicas; i++ {
+			objs = append(objs, &corev1.Pod{
+				ObjectMeta: metav1.ObjectMeta{
+					Name:      fmt.Sprintf("crdb-%d", i),
+					Namespace: "default",
+					Labels:    map[string]string{appsv1.ControllerRevisionHashLabelKey: "crdb-1"},
+				},
+				Spec: corev1.PodSpec{Containers: []corev1.Container{{Name: "db", Resources: old}}},
+				Status: corev1.PodStatus{
+					Conditions: []corev1.PodCondition{{Type: corev1.PodReady, Status: corev1.ConditionTrue}},
+				},
+			})
+		}
+
+		return fake.NewSimpleClientset(objs...)
+	}
+
+	update := &UpdateResources{Resources: wanted, ContainerName: "db", StsName: "crdb", StsNamespace: "default"}
+	cluster := func(clientset *fake.Clientset) *UpdateCluster {
+		return &UpdateCluster{
+			Clientset:             clientset,
+			PodUpdateTimeout:      time.Second,
+			PodMaxPollingInterval: 100 * time.Millisecond,
+			HealthChecker:         &healthCheckerTest{},
+		}
+	}
+
+	t.Run("resizes the pods", func(t *testing.T) {
+		ctx := context.Background()
+		clientset := newClientset()
+		require.NoError(t, ResizeInPlace(ctx, update, cluster(clientset), logr.Discard()))
+
+		sts, err := clientset.AppsV1().StatefulSets("default").Get(ctx, "crdb", metav1.GetOptions{})
+		require.NoError(t, err)
+		require.Equal(t, wanted, sts.Spec.Template.Spec.Containers[0].Resources)
+		require.Equal(t, int32(0), *sts.Spec.UpdateStrategy.RollingUpdate.Partition)
+
+		for i := int32(0); i < replicas; i++ {
+			pod, err := clientset.CoreV1().Pods("default").Get(ctx, fmt.Sprintf("crdb-%d", i), metav1.GetOptions{})
+			require.NoError(t, err)
+			require.Equal(t, "crdb-2", pod.Labels[appsv1.ControllerRevisionHashLabelKey])
+			require.True(t, podHasResources(pod, update), pod.Spec.Containers[0].Resources)
+		}
+
+		// the partition is lifted without recreating any pod
+		require.Empty(t, outdatedPods(t, clientset, "crdb"))
+	})
+
+	t.Run("resumes an interrupted resize", func(t *testing.T) {
+		ctx := context.Background()
+		clientset := newClientset()
+
+		pod, err := clientset.CoreV1().Pods("default").Get(ctx, "crdb-2", metav1.GetOptions{})
+		require.NoError(t, err)
+		pod.Labels[appsv1.ControllerRevisionHashLabelKey] = "crdb-2"
+		pod.Spec.Containers[0].Resources = wanted
+		_, err = clientset.CoreV1().Pods("default").Update(ctx, pod, metav1.UpdateOptions{})
+		require.NoError(t, err)
+
+		var patched []string
+		clientset.PrependReactor("patch", "pods", func(action clienttesting.Action) (bool, runtime.Object, error) {
+			patched = append(patched, action.(clienttesting.PatchAction).GetName())
+			return false, nil, nil
+		})
+
+		require.NoError(t, ResizeInPlace(ctx, update, cluster(clientset), logr.Discard()))
+		require.NotContains(t, patched, "crdb-2")
+		require.Contains(t, patched, "crdb-0")
+		require.Empty(t, outdatedPods(t, clientset, "crdb"))
+	})
+
+	t.Run("does not label the pods when the statefulset changes during the resize", func(t *testing.T) {
+		ctx := context.Background()
+		clientset := newClientset()
+
+		// another change of the statefulset lands after the one of the resize
+		clientset.PrependReactor("get", "statefulsets", func(action clienttesting.Action) (bool, runtime.Object, error) {
+			obj, err := clientset.Tracker().Get(appsv1.SchemeGroupVersion.WithResource("statefulsets"), "default", "crdb")
+			if err != nil {
+				return true, nil, err
+			}
+			sts := obj.(*appsv1.StatefulSet).DeepCopy()
+			if sts.Spec.UpdateStrategy.RollingUpdate != nil {
+				sts.Generation++
+			}
+			return true, sts, nil
+		})
+
+		require.Error(t, ResizeInPlace(ctx, update, cluster(clientset), logr.Discard()))
+		for i := int32(0); i < replicas; i++ {
+			pod, err := clientset.CoreV1().Pods("default").Get(ctx, fmt.Sprintf("crdb-%d", i), metav1.GetOptions{})
+			require.NoError(t, err)
+			require.Equal(t, "crdb-1", pod.Labels[appsv1.ControllerRevisionHashLabelKey])
+		}
+	})
+
+	t.Run("reports when in-place resize is not supported", func(t *testing.T) {
+		clientset := newClientset()
+		clientset.PrependReactor("patch", "pods", func(action clienttesting.Action) (bool, runtime.Object, error) {
+			if action.GetSubresource() == "resize" {
+				return true, nil, k8sErrors.NewNotFound(schema.GroupResource{Resource: "pods/resize"}, "crdb-2")
+			}
+			return true, nil, k8sErrors.NewInvalid(schema.GroupKind{Kind: "Pod"}, "crdb-2", field.ErrorList{
+				field.Forbidden(field.NewPath("spec"), "pod updates may not change fields other than image"),
+			})
+		})
+
+		err := ResizeInPlace(context.Background(), update, cluster(clientset), logr.Discard())
+		require.True(t, errors.Is(err, ErrInPlaceResizeUnsupported), err)
+	})
+
+	t.Run("fails when the resize is forbidden", func(t *testing.T) {
+		clientset := newClientset()
+		clientset.PrependReactor("patch", "pods", func(action clienttesting.Action) (bool, runtime.Object, error) {
+			return true, nil, k8sErrors.NewForbidden(schema.GroupResource{Resource: "pods/resize"}, "crdb-2", errors.New("no permission"))
+		})
+
+		err := ResizeInPlace(context.Background(), update, cluster(clientset), logr.Discard())
+		require.Error(t, err)
+		require.False(t, errors.Is(err, ErrInPlaceResizeUnsupported), err)
+	})
+}
@@ -0,0 +1,205 @@
+/*
+Copyright 2021 The Cockroach Authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    https://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package update
+
+import (
+	"context"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/go-logr/logr"
+	"github.com/stretchr/testify/require"
+	appsv1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/client-go/kubernetes/fake"
+	clienttesting "k8s.io/client-go/testing"
+)
+
+type recordingHealthChecker struct {
+	partitions []int
+}
+
+func (hc *recordingHealthChecker) Probe(ctx context.Context, l logr.Logger, logSuffix string, partition int) error {
+	hc.partitions = append(hc.partitions, partition)
+	return nil
+}
+
+func TestPartitionedRollingUpdateStrategy(t *testing.T) {
+	tests := []struct {
+		name           string
+		maxUnavailable int32
+		lowest         int32
+		updated        []int
+		partitions     []int32
+		probes         []int
+	}{
+		{
+			name:       "updates one pod at a time by default",
+			partitions: []int32{4, 3, 2, 1, 0},
+			probes:     []int{4, 3, 2, 1, 0},
+		},
+		{
+			name:           "updates the pods in batches",
+			maxUnavailable: 2,
+			partitions:     []int32{3, 1, 0},
+			probes:         []int{3, 1, 0},
+		},
+		{
+			name:           "updates all the pods at once",
+			maxUnavailable: 10,
+			partitions:     []int32{0},
+			probes:         []int{0},
+		},
+		{
+			name:           "skips the batches that are already updated",
+			maxUnavailable: 2,
+			updated:        []int{3, 4},
+			partitions:     []int32{1, 0},
+			probes:         []int{1, 0},
+		},
+		{
+			name:           "stops at the lowest partition",
+			maxUnavailable: 2,
+			lowest:         2,
+			partitions:     []int32{3, 2},
+			probes:         []int{3, 2},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var replicas int32 = 5
+			clientset := fake.NewSimpleClientset(&appsv1.StatefulSet{
+				ObjectMeta: metav1.ObjectMeta{Name: "crdb", Namespace: "default"},
+				Spec:       appsv1.StatefulSetSpec{Replicas: &replicas},
+			})
+
+			updated := map[int]bool{}
+			for _, pod := range tt.updated {
+				updated[pod] = true
+			}
+			var partitions []int32
+			clientset.PrependReactor("update", "statefulsets", func(action clienttesting.Action) (bool, runtime.Object, error) {
+				sts := action.(clienttesting.UpdateAction).GetObject().(*appsv1.StatefulSet)
+				partition := *sts.Spec.UpdateStrategy.RollingUpdate.Partition
+				partitions = append(partitions, partition)
+				sts.Status.UpdateRevision = "updated"
+				for pod := int(partition); pod < int(replicas); pod++ {
+					updated[pod] = true
+				}
+				return false, nil, nil
+			})
+
+			verify := func(update *UpdateSts, podNumber int, l logr.Logger) error {
+				if !updated[podNumber] {
+					return fmt.Errorf("pod %d is not updated", podNumber)
+				}
+				return nil
+			}
+			updateSuite := NewUpdateFunctionSuite(
+				func(sts *appsv1.StatefulSet) (*appsv1.StatefulSet, error) { return sts, nil },
+				PartitionedRollingUpdateStrategyDownTo(verify, tt.lowest),
+			)
+
+			hc := &recordingHealthChecker{}
+			_, err := UpdateClusterRegionStatefulSet(
+				context.Background(),
+				clientset,
+				"crdb",
+				"default",
+				updateSuite,
+				func(context.Context, logr.Logger) error { return nil },
+				time.Second,
+				100*time.Millisecond,
+				hc,
+				tt.maxUnavailable,
+				logr.Discard())
+			require.NoError(t, err)
+			require.Equal(t, tt.partitions, partitions)
+			require.Equal(t, tt.probes, hc.partitions)
+		})
+	}
+}
+
+func TestPartitionedRollingUpdateStrategyReplacesBatches(t *testing.T) {
+	var replicas int32 = 5
+	objs := []runtime.Object{&appsv1.StatefulSet{
+		ObjectMeta: metav1.ObjectMeta{Name: "crdb", Namespace: "default"},
+		Spec:       appsv1.StatefulSetSpec{Replicas: &replicas},
+	}}
+	for i := 0; i < int(replicas); i++ {
+		objs = append(objs, &corev1.Pod{ObjectMeta: metav1.ObjectMeta{
+			Name:      fmt.Sprintf("crdb-%d", i),
+			Namespace: "default",
+			Labels:    map[string]string{appsv1.ControllerRevisionHashLabelKey: "current"},
+		}})
+	}
+	clientset := fake.NewSimpleClientset(objs...)
+
+	clientset.PrependReactor("update", "statefulsets", func(action clienttesting.Action) (bool, runtime.Object, error) {
+		sts := action.(clienttesting.UpdateAction).GetObject().(*appsv1.StatefulSet)
+		sts.Status.UpdateRevision = "updated"
+		return false, nil, nil
+	})
+	// replacing holds the pods deleted and not verified yet
+	replacing := map[int]bool{}
+	maxReplacing := 0
+	var deleted []int
+	clientset.PrependReactor("delete", "pods", func(action clienttesting.Action) (bool, runtime.Object, error) {
+		var pod int
+		_, err := fmt.Sscanf(action.(clienttesting.DeleteAction).GetName(), "crdb-%d", &pod)
+		require.NoError(t, err)
+		deleted = append(deleted, pod)
+		replacing[pod] = true
+		if len(replacing) > maxReplacing {
+			maxReplacing = len(replacing)
+		}
+		return false, nil, nil
+	})
+
+	verify := func(update *UpdateSts, podNumber int, l logr.Logger) error {
+		if !replacing[podNumber] {
+			return fmt.Errorf("pod %d is not updated", podNumber)
+		}
+		delete(replacing, podNumber)
+		return nil
+	}
+	updateSuite := NewUpdateFunctionSuite(
+		func(sts *appsv1.StatefulSet) (*appsv1.StatefulSet, error) { return sts, nil },
+		PartitionedRollingUpdateStrategy(verify),
+	)
+
+	_, err := UpdateClusterRegionStatefulSet(
+		context.Background(),
+		clientset,
+		"crdb",
+		"default",
+		updateSuite,
+		func(context.Context, logr.Logger) error { return nil },
+		time.Second,
+		100*time.Millisecond,
+		&recordingHealthChecker{},
+		3,
+		logr.Discard())
+	require.NoError(t, err)
+	require.Equal(t, []int{4, 3, 2, 1, 0}, deleted)
+	// the pods of a batch are replaced at once
+	require.Equal(t, 3, maxReplacing)
+}
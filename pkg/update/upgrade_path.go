@@ -0,0 +1,83 @@
+/*
+Copyright 2021 The Cockroach Authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    https://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package update
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+
+	semver "github.com/Masterminds/semver/v3"
+	"github.com/cockroachdb/cockroach-operator/pkg/clustersql"
+	"github.com/cockroachdb/errors"
+)
+
+// NeedsIntermediateVersions returns whether wantVersion is more than one major
+// release ahead of currentVersion, which CockroachDB does not upgrade to
+// directly.
+func NeedsIntermediateVersions(wantVersion *semver.Version, currentVersion *semver.Version) bool {
+	return wantVersion.GreaterThan(currentVersion) &&
+		!isPatch(wantVersion, currentVersion) && !isForwardOneMajorVersion(wantVersion, currentVersion)
+}
+
+// UpgradePath returns the versions an upgrade from currentVersion goes through
+// to reach wantVersion, one major release at a time, with wantVersion last. The
+// intermediate versions are the latest of the given versions of each major
+// release in between.
+func UpgradePath(wantVersion *semver.Version, currentVersion *semver.Version, versions []*semver.Version) ([]*semver.Version, error) {
+	var path []*semver.Version
+	step := currentVersion
+	for NeedsIntermediateVersions(wantVersion, step) {
+		var next *semver.Version
+		for _, v := range versions {
+			if v.Prerelease() == "" && isForwardOneMajorVersion(v, step) && (next == nil || v.GreaterThan(next)) {
+				next = v
+			}
+		}
+		if next == nil {
+			return nil, UpdateNotAllowed{
+				cur:   currentVersion,
+				want:  wantVersion,
+				extra: fmt.Sprintf("no supported version of the major release after %d.%d to upgrade through", step.Major(), step.Minor()),
+			}
+		}
+		path = append(path, next)
+		step = next
+	}
+	return append(path, wantVersion), nil
+}
+
+// FinalizeUpgrade lets the upgrade of the cluster to the major release of
+// version finalize, and returns whether it did. The cluster only runs the
+// next major release once it has.
+func FinalizeUpgrade(ctx context.Context, db *sql.DB, version *semver.Version) (bool, error) {
+	preserve, err := preserveDowngradeSetting(ctx, db)
+	if err != nil {
+		return false, err
+	}
+	if preserve.Compare(&semver.Version{}) != 0 {
+		if err := clustersql.ResetClusterSetting(ctx, db, PreserveDowngradeOptionClusterSetting); err != nil {
+			return false, errors.Wrapf(err, "resetting preserve downgrade option failed")
+		}
+	}
+
+	clusterVersion, err := clustersql.GetClusterSetting(ctx, db, "version")
+	if err != nil {
+		return false, errors.Wrapf(err, "getting cluster version failed")
+	}
+	return clusterVersion == fmt.Sprintf("%d.%d", version.Major(), version.Minor()), nil
+}
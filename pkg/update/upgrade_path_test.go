@@ -0,0 +1,135 @@
+/*
+Copyright 2021 The Cockroach Authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    https://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package update
+
+import (
+	"context"
+	"testing"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	semver "github.com/Masterminds/semver/v3"
+	"github.com/cockroachdb/errors"
+	"github.com/stretchr/testify/require"
+)
+
+func TestUpgradePath(t *testing.T) {
+	var versions []*semver.Version
+	for _, v := range []string{"v20.1.16", "v20.2.3", "v20.2.15", "v20.2.9", "v21.1.0", "v21.1.7", "v21.2.0-beta.1"} {
+		versions = append(versions, semver.MustParse(v))
+	}
+
+	tests := []struct {
+		description string
+		current     string
+		want        string
+		path        []string
+	}{
+		{
+			description: "patch",
+			current:     "v20.2.3",
+			want:        "v20.2.15",
+			path:        []string{"v20.2.15"},
+		},
+		{
+			description: "next major release",
+			current:     "v20.1.16",
+			want:        "v20.2.3",
+			path:        []string{"v20.2.3"},
+		},
+		{
+			description: "two major releases ahead",
+			current:     "v20.1.4",
+			want:        "v21.1.7",
+			path:        []string{"v20.2.15", "v21.1.7"},
+		},
+		{
+			description: "three major releases ahead",
+			current:     "v19.2.6",
+			want:        "v21.1.0",
+			path:        []string{"v20.1.16", "v20.2.15", "v21.1.0"},
+		},
+		{
+			description: "no supported version of the release in between",
+			current:     "v21.1.7",
+			want:        "v22.1.0",
+			path:        nil,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.description, func(t *testing.T) {
+			path, err := UpgradePath(semver.MustParse(tt.want), semver.MustParse(tt.current), versions)
+			if tt.path == nil {
+				require.True(t, errors.As(err, &UpdateNotAllowed{}))
+				return
+			}
+			require.NoError(t, err)
+
+			var got []string
+			for _, v := range path {
+				got = append(got, v.Original())
+			}
+			require.Equal(t, tt.path, got)
+		})
+	}
+}
+
+func TestFinalizeUpgrade(t *testing.T) {
+	tests := []struct {
+		description string
+		preserve    string
+		version     string
+		finalized   bool
+	}{
+		{
+			description: "preserve downgrade option set",
+			preserve:    "20.1",
+			version:     "20.1-16",
+		},
+		{
+			description: "finalizing",
+			version:     "20.1-16",
+		},
+		{
+			description: "finalized",
+			version:     "20.2",
+			finalized:   true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.description, func(t *testing.T) {
+			db, mock, err := sqlmock.New()
+			require.NoError(t, err)
+			defer db.Close()
+
+			mock.ExpectQuery("SHOW CLUSTER SETTING cluster.preserve_downgrade_option").
+				WillReturnRows(sqlmock.NewRows([]string{"value"}).AddRow(tt.preserve))
+			if tt.preserve != "" {
+				mock.ExpectExec("RESET CLUSTER SETTING cluster.preserve_downgrade_option").
+					WillReturnResult(sqlmock.NewResult(0, 0))
+			}
+			mock.ExpectQuery("SHOW CLUSTER SETTING version").
+				WillReturnRows(sqlmock.NewRows([]string{"value"}).AddRow(tt.version))
+
+			finalized, err := FinalizeUpgrade(context.Background(), db, semver.MustParse("v20.2.15"))
+			require.NoError(t, err)
+			require.Equal(t, tt.finalized, finalized)
+			require.NoError(t, mock.ExpectationsWereMet())
+		})
+	}
+}